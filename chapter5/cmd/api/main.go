@@ -0,0 +1,931 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/breaker"
+	"coffeeco/internal/cache"
+	"coffeeco/internal/cash"
+	"coffeeco/internal/chaos"
+	"coffeeco/internal/command"
+	"coffeeco/internal/config"
+	"coffeeco/internal/consent"
+	"coffeeco/internal/delivery"
+	"coffeeco/internal/device"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/feature"
+	"coffeeco/internal/fiscal"
+	"coffeeco/internal/health"
+	"coffeeco/internal/history"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/lifecycle"
+	"coffeeco/internal/logging"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/marketplace"
+	"coffeeco/internal/metrics"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/notifications"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/preorder"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/procurement"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/ratelimit"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/redemption"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/royalty"
+	"coffeeco/internal/store"
+	"coffeeco/internal/submission"
+	"coffeeco/internal/subscription"
+	"coffeeco/internal/substitution"
+	"coffeeco/internal/tab"
+	"coffeeco/internal/target"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/transport/rest"
+	"coffeeco/internal/transport/stream"
+	"coffeeco/internal/waittime"
+	"coffeeco/internal/wallet"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// log.Print and slog both end up as redacted JSON lines from here on.
+	var level slog.LevelVar
+	logger := logging.New(os.Stderr, &level)
+	slog.SetDefault(logger)
+	life := lifecycle.New(cfg.Drain())
+
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-api")
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Flush, "traces", shutdownTracing)
+
+	csvc, err := payment.NewStripeService(cfg.StripeAPIKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	kpis := metrics.New()
+	prepo, err := newPurchaseRepo(ctx, cfg, kpis, life)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c, ok := prepo.(closer); ok {
+		life.Register(lifecycle.Close, "purchases", c.Close)
+	}
+	sRepo, err := store.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "stores", sRepo.Close)
+	cards, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "loyalty cards", cards.Close)
+	// Store lookups happen on every purchase, so they are cached; changes to stores invalidate them.
+	lookups, err := newCache(ctx, cfg, life)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cachedStores := cache.NewStores(kpis.Stores(sRepo), lookups, cfg.Tunables.StoreCacheTTL(), cache.WithRecorder(kpis), cache.WithLogger(logger))
+	sSvc := store.NewService(cachedStores)
+
+	// With CHAOS=true the ports get the faults in tunables.faults, under the metrics and breakers so they
+	// see them like real failures.
+	faults := chaos.New()
+	var (
+		charges   purchase.CardChargeService = csvc
+		purchases                            = prepo
+		discounts purchase.StoreService      = sSvc
+		cardRepo  loyalty.Repository         = cards
+	)
+	if cfg.Chaos {
+		log.Println("CHAOS is set, faults are injected from the config")
+		charges, purchases, discounts, cardRepo = faults.CardCharges(csvc), faults.Purchases(prepo), faults.Stores(sSvc), faults.LoyaltyCards(cards)
+	}
+
+	stock, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "inventory", stock.Close)
+	invOpts := []inventory.Option{inventory.WithLogger(logger)}
+	var ticketOpts []orders.Option
+	deliveryOpts := []delivery.Option{delivery.WithLogger(logger)}
+	adjustmentOpts := []adjustment.Option{adjustment.WithLogger(logger)}
+	experimentOpts := []experiment.Option{experiment.WithLogger(logger)}
+
+	flags := feature.NewMemory()
+	opts := []purchase.Option{purchase.WithLogger(logger), purchase.WithRecorder(kpis), purchase.WithFeatureFlags(flags)}
+	pub, err := newEventPublisher(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if pub != nil {
+		life.Register(lifecycle.Flush, "event publisher", func(context.Context) error { return pub.Close() })
+		var publisher events.Publisher = pub
+		if cfg.Chaos {
+			publisher = faults.Publisher(pub)
+		}
+		opts = append(opts, purchase.WithEventPublisher(publisher))
+		invOpts = append(invOpts, inventory.WithEventPublisher(publisher))
+		ticketOpts = append(ticketOpts, orders.WithEventPublisher(publisher))
+		deliveryOpts = append(deliveryOpts, delivery.WithEventPublisher(publisher))
+		adjustmentOpts = append(adjustmentOpts, adjustment.WithEventPublisher(publisher))
+		experimentOpts = append(experimentOpts, experiment.WithEventPublisher(publisher))
+	}
+	inv := inventory.NewService(stock, cfg.Recipes, invOpts...)
+	opts = append(opts, purchase.WithInventory(inv))
+	passes, err := subscription.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "passes", passes.Close)
+	opts = append(opts, purchase.WithPasses(subscription.NewService(passes, csvc, cfg.Plans, subscription.WithLogger(logger))))
+	var (
+		walletRepo *wallet.MongoRepository
+		wallets    *wallet.Service
+	)
+	if cfg.Wallet.Currency != "" {
+		if walletRepo, err = wallet.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "wallets", walletRepo.Close)
+		wallets = wallet.NewService(walletRepo, csvc, cfg.Wallet, wallet.WithLogger(logger))
+		opts = append(opts, purchase.WithWallet(wallets))
+	}
+	preOrderRepo, err := preorder.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "pre-orders", preOrderRepo.Close)
+	preOrders := preorder.NewService(preOrderRepo, preorder.WithGateway("stripe", csvc), preorder.WithPool(cfg.PreOrderPool()),
+		preorder.WithRecorder(kpis), preorder.WithLogger(logger))
+	// Every instance captures pre-orders; each one is claimed by a single worker at a time.
+	if cfg.PreOrders.Workers > 0 {
+		capturing, stopCapturing := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			preOrders.Run(capturing)
+		}()
+		life.Register(lifecycle.StopConsuming, "pre-order captures", func(ctx context.Context) error {
+			stopCapturing()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+	var (
+		courier      delivery.Provider
+		deliveryRepo *delivery.MongoRepository
+		deliveries   *delivery.Service
+	)
+	if cfg.Delivery.Provider != "" {
+		if courier, err = newCourier(cfg.Delivery); err != nil {
+			log.Fatal(err)
+		}
+		if deliveryRepo, err = delivery.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "deliveries", deliveryRepo.Close)
+		if cfg.Delivery.MinimumOrder > 0 {
+			deliveryOpts = append(deliveryOpts, delivery.WithMinimumOrder(*money.New(cfg.Delivery.MinimumOrder, cfg.Delivery.Currency)))
+		}
+		deliveries = delivery.NewService(deliveryRepo, courier, sSvc, deliveryOpts...)
+		opts = append(opts, purchase.WithDeliveries(deliveries))
+	}
+	// Stripe gets a few tries before card purchases fail fast; the stores live in our own Mongo, so a burst
+	// of errors there is more likely a blip and is probed again sooner.
+	cardBreaker := breaker.New("stripe", breaker.Settings{Failures: 5, OpenFor: 30 * time.Second, Probes: 1})
+	storeBreaker := breaker.New("stores", breaker.Settings{Failures: 10, OpenFor: 10 * time.Second, Probes: 2})
+	storeDiscounts := purchase.BreakingStoreService(discounts, storeBreaker)
+	entitlementRepo, err := entitlement.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "entitlements", entitlementRepo.Close)
+	entitlements := entitlement.NewService(entitlementRepo)
+	experiments := experiment.NewService(cfg.Tunables.Experiments, experimentOpts...)
+	prices := pricing.NewEngine(cfg.Tunables.Pricing, pricing.WithStoreDiscounts(storeDiscounts), pricing.WithEntitlements(entitlements),
+		pricing.WithExperiments(experiments), pricing.WithFeatureFlags(flags), pricing.WithLogger(logger))
+	opts = append(opts, purchase.WithPricing(prices), purchase.WithEntitlements(entitlements),
+		purchase.WithTax(cfg.Quotes.TaxPercent), purchase.WithTipSuggestions(cfg.Quotes.TipPercents...),
+		purchase.WithSubstitutes(substitution.NewService(prices, inv)))
+	if cfg.Quotes.SigningSecret != "" {
+		opts = append(opts, purchase.WithQuoteSigning([]byte(cfg.Quotes.SigningSecret), cfg.QuoteValidity()))
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "audit log", auditLog.Close)
+	opts = append(opts, purchase.WithAuditLog(auditLog))
+	// Managers can have their store stop taking some payment means, e.g. while its card reader is broken.
+	meansRepo, err := store.NewMongoMeansRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "store payment means", meansRepo.Close)
+	storeMeans := store.NewService(cachedStores, store.WithPaymentMeans(meansRepo), store.WithAuditLog(auditLog))
+	opts = append(opts, purchase.WithStoreMeans(storeMeans))
+	// Managers register the POS terminals of their store, and revoke those that are compromised.
+	deviceRepo, err := device.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "devices", deviceRepo.Close)
+	devices := device.NewService(deviceRepo, device.WithAuditLog(auditLog))
+	if cfg.RequireDevices {
+		opts = append(opts, purchase.WithDevices(devices))
+	}
+	// Store managers are emailed about purchases to review and cash that does not add up.
+	var managers *notifications.Managers
+	if len(cfg.Reviews.Managers) > 0 {
+		smtp, err := notifications.NewSMTP(cfg.Notifications.SMTP)
+		if err != nil {
+			log.Fatal(err)
+		}
+		loc, _ := moneyfmt.LocaleFor(cfg.Notifications.Locale)
+		managers = notifications.NewManagers(smtp, cfg.Reviews.Managers, loc)
+	}
+	// Large card purchases are only held when a threshold is configured.
+	var reviewRepo *purchase.MongoReviewRepository
+	if policy := cfg.ReviewPolicy(); policy.Threshold > 0 || len(policy.Stores) > 0 {
+		reviewRepo, err = purchase.NewMongoReviewRepo(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "purchase reviews", reviewRepo.Close)
+		opts = append(opts, purchase.WithReviews(policy, reviewRepo, csvc), purchase.WithLoyaltyCards(cardRepo))
+		if managers != nil {
+			opts = append(opts, purchase.WithReviewNotifier(managers))
+		}
+	}
+	// Receipt days end at midnight where the store is, as happy hours do.
+	codeRepo, err := receipt.NewMongoCodeRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "receipt codes", codeRepo.Close)
+	zones := map[uuid.UUID]*time.Location{}
+	for storeID, tz := range cfg.Tunables.Pricing.StoreTimeZones {
+		if zones[storeID], err = time.LoadLocation(tz); err != nil {
+			log.Fatal(err)
+		}
+	}
+	receiptCodes := receipt.NewCodes(codeRepo, receipt.WithTimeZones(zones))
+	// Sales targets follow the store's days and shifts where it is too. Progress is counted from the
+	// completed purchases, so without an event transport targets can be set but are never hit.
+	targetRepo, err := target.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "sales targets", targetRepo.Close)
+	targets := target.NewService(targetRepo, target.WithEventPublisher(pub), target.WithAuditLog(auditLog), target.WithTimeZones(zones), target.WithLogger(logger))
+	// The notifier reads the same consents before sending customers marketing.
+	consentRepo, err := consent.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "marketing consents", consentRepo.Close)
+	opts = append(opts, purchase.WithReceiptCodes(receiptCodes), purchase.WithCashRounding(cfg.CashRounding), purchase.WithStampChannels(cfg.Stamps()...), purchase.WithChannelFees(cfg.ChannelFees))
+	// Only document persistence can look up the purchases just made.
+	if recent, ok := prepo.(purchase.Finder); ok && cfg.Duplicates() > 0 {
+		opts = append(opts, purchase.WithDuplicateCheck(recent, cfg.Duplicates()))
+	}
+	// Practice purchases are charged in Stripe's test mode and kept in a collection of their own.
+	if cfg.Sandbox.StripeAPIKey != "" {
+		practiceCards, err := payment.NewStripeService(cfg.Sandbox.StripeAPIKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		practiceRepo, err := purchase.NewMongoSandboxRepo(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "practice purchases", practiceRepo.Close)
+		opts = append(opts, purchase.WithSandbox(practiceCards, practiceRepo))
+	}
+	// Only stores in a country that requires it are fiscalized.
+	var fiscalRepo *fiscal.MongoRepository
+	if len(cfg.Fiscal.Stores) > 0 {
+		if fiscalRepo, err = fiscal.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "fiscal receipts", fiscalRepo.Close)
+		fiscalOpts := []fiscal.Option{fiscal.WithPrinter("mock", fiscal.NewMockPrinter()), fiscal.WithRetry(cfg.FiscalRetry()), fiscal.WithLogger(logger)}
+		if cfg.Fiscal.Fiskaly.APIKey != "" {
+			fiskaly, err := fiscal.NewFiskaly(cfg.Fiscal.Fiskaly, &http.Client{Timeout: 30 * time.Second})
+			if err != nil {
+				log.Fatal(err)
+			}
+			fiscalOpts = append(fiscalOpts, fiscal.WithPrinter("fiskaly", fiskaly))
+		}
+		fiscals := fiscal.NewService(fiscalRepo, cfg.Fiscal.Stores, cfg.Fiscal.Jurisdictions, fiscalOpts...)
+		opts = append(opts, purchase.WithFiscalizer(fiscals))
+		// Every instance forwards receipts; each one is claimed by a single instance at a time.
+		forwarding, stopForwarding := context.WithCancel(ctx)
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			fiscals.Run(forwarding, cfg.FiscalEvery())
+		}()
+		life.Register(lifecycle.StopConsuming, "fiscal receipts", func(ctx context.Context) error {
+			stopForwarding()
+			select {
+			case <-stopped:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+	svc := purchase.NewService(
+		purchase.BreakingCardCharges(kpis.CardCharges(charges), cardBreaker),
+		kpis.Purchases(purchases),
+		storeDiscounts,
+		opts...,
+	)
+
+	// Low stock is only reordered from suppliers that are configured.
+	var orderRepo *procurement.MongoRepository
+	if len(cfg.Suppliers) > 0 {
+		if orderRepo, err = procurement.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "purchase orders", orderRepo.Close)
+	}
+
+	ticketRepo, err := orders.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "tickets", ticketRepo.Close)
+	ticketOpts = append(ticketOpts, orders.WithStatusUpdates(svc), orders.WithPrepTimes(cfg.Prep()), orders.WithRelease(cfg.TicketRelease()), orders.WithLogger(logger))
+	tickets := orders.NewService(ticketRepo, ticketOpts...)
+	// Every instance releases scheduled tickets that are due; releasing one twice changes nothing.
+	releasing, stopReleasing := context.WithCancel(ctx)
+	released := make(chan struct{})
+	go func() {
+		defer close(released)
+		tickets.Run(releasing, cfg.ReleaseEvery())
+	}()
+	life.Register(lifecycle.StopConsuming, "ticket releases", func(ctx context.Context) error {
+		stopReleasing()
+		select {
+		case <-released:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	waitRepo, err := waittime.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "store waits", waitRepo.Close)
+	waits := waittime.NewEstimator(waitRepo, ticketRepo, waittime.WithPrepTimes(cfg.Prep()), waittime.WithLogger(logger))
+	tabRepo, err := tab.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "tabs", tabRepo.Close)
+
+	var restOpts []rest.Option
+	authenticated := cfg.OIDCIssuer != ""
+	if authenticated {
+		authn, err := auth.NewOIDC(ctx, cfg.OIDCIssuer, cfg.OIDCAudience)
+		if err != nil {
+			log.Fatal(err)
+		}
+		restOpts = append(restOpts, rest.WithAuthenticator(authn))
+	} else {
+		log.Println("OIDC_ISSUER is not set, requests are not authenticated")
+	}
+	// Purchases made through the API are dispatched as commands, so tracing, logging, metrics, authorization
+	// and validation wrap them rather than living in the purchase service. Purchases completed in the
+	// background, e.g. submissions, have no caller to authorize and use the service directly.
+	middleware := []command.Middleware{command.Trace(), command.Log(logger), command.Measure(kpis)}
+	if authenticated {
+		middleware = append(middleware, command.Authorize())
+	}
+	commands := purchase.NewDispatcher(svc, command.NewBus(append(middleware, command.Validate())...))
+	limiter := ratelimit.NewLimiter(cfg.Tunables.RateLimit.PerKey, cfg.Tunables.RateLimit.PerIP)
+	limiter.TrustForwardedFor = cfg.TrustForwardedFor
+	restOpts = append(restOpts, rest.WithRateLimiter(limiter))
+	restOpts = append(restOpts, rest.WithAuditLog(auditLog), rest.WithStoreMeans(storeMeans))
+	restOpts = append(restOpts, rest.WithLocalizer(cfg.Localizer()))
+	// The facts are projected by cmd/projector; the API only reads them.
+	facts, err := analytics.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "analytics", facts.Close)
+	reports := analytics.NewService(facts, analytics.WithTaxPercent(cfg.Quotes.TaxPercent))
+	restOpts = append(restOpts, rest.WithAnalytics(reports))
+	cashRepo, err := cash.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "drawer sessions", cashRepo.Close)
+	cashOpts := []cash.Option{cash.WithLogger(logger)}
+	if managers != nil {
+		cashOpts = append(cashOpts, cash.WithNotifier(managers))
+	}
+	restOpts = append(restOpts, rest.WithCash(cash.NewService(cashRepo, reports, cfg.CashPolicy(), cashOpts...)))
+	restOpts = append(restOpts, rest.WithDevices(devices))
+	restOpts = append(restOpts, rest.WithTargets(targets))
+	restOpts = append(restOpts, rest.WithConsents(consent.NewService(consentRepo)))
+	// Finance corrects how purchases are reported with adjustments; the purchases themselves are not changed.
+	adjustmentRepo, err := adjustment.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "adjustments", adjustmentRepo.Close)
+	adjustmentOpts = append(adjustmentOpts, adjustment.WithAuditLog(auditLog))
+	restOpts = append(restOpts, rest.WithAdjustments(adjustment.NewService(adjustmentRepo, svc, sSvc, adjustmentOpts...)))
+	// Purchases can only be refunded to wallets, so there are only refunds to approve with wallets.
+	var refundRepo *refund.MongoRepository
+	if wallets != nil {
+		restOpts = append(restOpts, rest.WithWallets(wallets))
+		if refundRepo, err = refund.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "refunds", refundRepo.Close)
+		refunds := refund.NewService(refundRepo, svc, svc, cfg.RefundPolicy(), refund.WithAuditLog(auditLog))
+		restOpts = append(restOpts, rest.WithRefunds(refunds))
+	}
+	// Franchisees' royalty statements are worked out and exported with coffeectl, so the API needs neither
+	// sales nor refunds; finance reads and disputes them here.
+	var royaltyRepo *royalty.MongoRepository
+	if len(cfg.Royalties.Agreements) > 0 {
+		if royaltyRepo, err = royalty.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "royalty statements", royaltyRepo.Close)
+		royalties := royalty.NewService(royaltyRepo, cfg.Royalties.Agreements, nil, nil, royalty.WithAuditLog(auditLog))
+		restOpts = append(restOpts, rest.WithRoyalties(royalties))
+	}
+	restOpts = append(restOpts, rest.WithOrders(tickets))
+	restOpts = append(restOpts, rest.WithPreOrders(preOrders))
+	restOpts = append(restOpts, rest.WithPrices(prices), rest.WithPurchaseQuotes(svc))
+	if reviewRepo != nil {
+		restOpts = append(restOpts, rest.WithReviews(svc))
+	}
+	var qrRepo *redemption.MongoRepository
+	if cfg.QRCodes.SigningSecret != "" {
+		if qrRepo, err = redemption.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "QR codes", qrRepo.Close)
+		qrCodes := redemption.NewService([]byte(cfg.QRCodes.SigningSecret), qrRepo, cards, entitlements, redemption.WithValidity(cfg.QRCodeValidity()))
+		restOpts = append(restOpts, rest.WithQRCodes(qrCodes))
+	}
+	// Like the facts, the customer history is projected by cmd/projector.
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	restOpts = append(restOpts, rest.WithReceiptCodes(receiptCodes))
+	restOpts = append(restOpts, rest.WithHistory(history.NewService(rm.CustomerHistory, prices, inv)))
+	restOpts = append(restOpts, rest.WithWaitTimes(waits))
+	restOpts = append(restOpts, rest.WithTabs(tab.NewService(tabRepo, svc, tab.WithLogger(logger))))
+	if deliveries != nil {
+		restOpts = append(restOpts, rest.WithDeliveries(deliveries))
+	}
+	marketplaces, err := newMarketplaces(cfg.Marketplaces)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var (
+		marketRepo *marketplace.MongoRepository
+		menus      *marketplace.Service
+	)
+	if len(marketplaces) > 0 {
+		if marketRepo, err = marketplace.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "marketplace orders", marketRepo.Close)
+		marketOpts := []marketplace.Option{marketplace.WithLogger(logger)}
+		for _, m := range marketplaces {
+			marketOpts = append(marketOpts, marketplace.WithMarketplace(m))
+		}
+		menus = marketplace.NewService(marketRepo, prices, inv, svc, marketOpts...)
+		restOpts = append(restOpts, rest.WithMenus(menus))
+	}
+	// Purchases are only completed in the background when there is an event transport to queue them on.
+	var (
+		submissionRepo *submission.MongoRepository
+		submissions    *submission.Service
+	)
+	if pub != nil {
+		if submissionRepo, err = submission.NewMongoRepo(ctx, cfg.MongoURI); err != nil {
+			log.Fatal(err)
+		}
+		life.Register(lifecycle.Close, "purchase submissions", submissionRepo.Close)
+		submissions = submission.NewService(submissionRepo, pub, svc, kpis.LoyaltyCards(cardRepo), submission.WithDescribe(rest.DescribeError), submission.WithLogger(logger))
+		restOpts = append(restOpts, rest.WithSubmissions(submissions))
+	}
+	h, err := rest.NewHandler(commands, sSvc, kpis.LoyaltyCards(cardRepo), restOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	m := rest.NewMux(h)
+	hub := stream.NewHub()
+	m.HandleFunc("/customers/{customerID}/order-status", followOwnOrders(authenticated, hub.ServeCustomer(func(r *http.Request) string {
+		return mux.Vars(r)["customerID"]
+	}))).Methods(http.MethodGet)
+	ticketHub := stream.NewTicketHub()
+	m.HandleFunc("/stores/{storeID}/kitchen-display", workTickets(authenticated, ticketHub.ServeStore(func(r *http.Request) string {
+		return mux.Vars(r)["storeID"]
+	}))).Methods(http.MethodGet)
+	submissionHub := stream.NewSubmissionHub()
+	if submissions != nil {
+		m.HandleFunc("/purchase-submissions/{submissionID}/events", followSubmission(authenticated, submissions, submissionHub.ServeSubmission(func(r *http.Request) string {
+			return mux.Vars(r)["submissionID"]
+		}))).Methods(http.MethodGet)
+	}
+	if pub != nil {
+		host, _ := os.Hostname()
+		type consumer struct {
+			name, group, topic string
+			handle             events.Handler
+		}
+		// Tickets are queued once per purchase, by whichever instance gets it first, but every instance has
+		// to see every status change and ticket update to reach the customers and displays connected to it.
+		consumers := []consumer{
+			{"order status events", "coffeeco-api-status-" + host, events.TopicFor(purchase.EventTypeStatusChanged), hub.Handle},
+			{"ticket events", "coffeeco-api-tickets-" + host, events.TopicFor(orders.EventTypeTicketUpdated), ticketHub.Handle},
+			{"submission updates", "coffeeco-api-submissions-" + host, events.TopicFor(submission.EventTypeUpdated), submissionHub.Handle},
+			{"store changes", "coffeeco-api-stores-" + host, events.TopicFor(store.EventTypeCatalogChanged), cachedStores.Handle},
+			{"completed purchases", "coffeeco-orders", events.TopicFor(purchase.EventTypeCompleted), tickets.Handle},
+			{"wait times", "coffeeco-waittime", events.TopicFor(orders.EventTypeTicketUpdated), waits.Handle},
+			{"sales targets", "coffeeco-targets", events.TopicFor(purchase.EventTypeCompleted), targets.Handle},
+		}
+		if deliveries != nil {
+			consumers = append(consumers, consumer{"purchases to deliver", "coffeeco-delivery", events.TopicFor(purchase.EventTypeCompleted), deliveries.Handle})
+		}
+		if orderRepo != nil {
+			reorders := procurement.NewService(orderRepo, cfg.Suppliers, inv, procurement.WithEventPublisher(pub), procurement.WithLogger(logger))
+			consumers = append(consumers, consumer{"low stock", "coffeeco-procurement", events.TopicFor(inventory.EventTypeLowStock), reorders.Handle})
+		}
+		// The workers share a consumer group, so each submitted purchase is completed by one of them.
+		for range cfg.PurchaseWorkers {
+			consumers = append(consumers, consumer{"submitted purchases", "coffeeco-submissions", events.TopicFor(submission.EventTypePurchaseRequested), submissions.Handle})
+		}
+		for _, c := range consumers {
+			sub, err := newEventSubscriber(cfg.EventTransport, cfg.EventBrokers, c.group)
+			if err != nil {
+				log.Fatal(err)
+			}
+			consume(ctx, life, c.name, sub, c.topic, c.handle)
+		}
+	}
+
+	checks := health.NewChecker()
+	checks.Require("purchases", prepo)
+	checks.Require("stores", sRepo)
+	checks.Require("loyalty_cards", cards)
+	checks.Require("tickets", ticketRepo)
+	checks.Require("store_waits", waitRepo)
+	checks.Require("tabs", tabRepo)
+	checks.Require("pre_orders", preOrderRepo)
+	checks.Require("entitlements", entitlementRepo)
+	checks.Require("receipt_codes", codeRepo)
+	checks.Require("store_payment_means", meansRepo)
+	checks.Require("drawer_sessions", cashRepo)
+	checks.Require("devices", deviceRepo)
+	checks.Require("sales_targets", targetRepo)
+	checks.Require("marketing_consents", consentRepo)
+	if deliveryRepo != nil {
+		checks.Require("deliveries", deliveryRepo)
+	}
+	if marketRepo != nil {
+		checks.Require("marketplace_orders", marketRepo)
+	}
+	if walletRepo != nil {
+		checks.Require("wallets", walletRepo)
+	}
+	if refundRepo != nil {
+		checks.Require("refund_requests", refundRepo)
+	}
+	checks.Require("purchase_adjustments", adjustmentRepo)
+	if royaltyRepo != nil {
+		checks.Require("royalty_statements", royaltyRepo)
+	}
+	if orderRepo != nil {
+		checks.Require("purchase_orders", orderRepo)
+	}
+	if submissionRepo != nil {
+		checks.Require("purchase_submissions", submissionRepo)
+	}
+	if reviewRepo != nil {
+		checks.Require("purchase_reviews", reviewRepo)
+	}
+	if fiscalRepo != nil {
+		checks.Require("fiscal_receipts", fiscalRepo)
+	}
+	if qrRepo != nil {
+		checks.Require("qr_codes", qrRepo)
+	}
+	if p, ok := pub.(health.Pinger); ok {
+		checks.Require("broker", p)
+	}
+	// Cash and CoffeeBux purchases still work without Stripe.
+	checks.Optional("stripe", csvc)
+	root := http.NewServeMux()
+	root.Handle("/healthz", checks.Liveness())
+	root.Handle("/readyz", checks.Readiness())
+	root.Handle("/metrics", kpis.Handler())
+	root.Handle("/", m)
+	// Couriers authenticate with a token of their own rather than as a user of the API.
+	if dd, ok := courier.(*delivery.DoorDash); ok {
+		root.Handle("POST /webhooks/doordash", dd.Webhook(deliveries))
+	}
+	// Marketplaces send their orders the same way.
+	for _, m := range marketplaces {
+		root.Handle("POST /webhooks/marketplaces/"+m.Name(), menus.Webhook(m))
+	}
+
+	// The log level, rate limits, feature flags, faults and prices follow the config file without a restart.
+	reloader := config.NewReloader(os.Getenv(config.EnvFile), cfg, os.Getenv)
+	reloader.OnChange(func(t config.Tunables) {
+		level.Set(t.Level())
+		limiter.SetQuotas(t.RateLimit.PerKey, t.RateLimit.PerIP)
+		flags.Replace(t.FeatureFlags)
+		faults.Replace(t.Faults)
+		prices.Replace(t.Pricing)
+		experiments.Replace(t.Experiments)
+		cachedStores.SetTTL(t.StoreCacheTTL())
+	})
+	go reloader.Run(ctx, 10*time.Second)
+
+	log.Printf("serving the coffeeco API on %s", cfg.APIAddr)
+	// Health probes and scrapes are left out of the traces; they would drown everything else.
+	traced := otelhttp.NewHandler(root, "coffeeco-api", otelhttp.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/healthz" && r.URL.Path != "/readyz" && r.URL.Path != "/metrics"
+	}))
+	srv := &http.Server{Addr: cfg.APIAddr, Handler: traced}
+	// Purchases in flight are finished before anything they depend on is closed. Order status streams and
+	// kitchen displays never finish on their own, so they are ended first.
+	life.Register(lifecycle.Drain, "http server", func(ctx context.Context) error {
+		checks.Drain()
+		hub.Close()
+		ticketHub.Close()
+		submissionHub.Close()
+		return srv.Shutdown(ctx)
+	})
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	if cfg.PprofAddr != "" {
+		serveProfiler(cfg.PprofAddr, life)
+	}
+	if err := life.WaitForSignal(ctx, os.Interrupt, syscall.SIGTERM); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serveProfiler serves the Go profiler on its own server, so it is only reachable where PPROF_ADDR listens.
+func serveProfiler(addr string, life *lifecycle.Manager) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// No write timeout: a profile takes as long as it was asked to.
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	life.Register(lifecycle.Drain, "profiler", srv.Shutdown)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	log.Printf("serving the profiler on %s", addr)
+}
+
+type closer interface {
+	Close(ctx context.Context) error
+}
+
+// newCache caches in Redis if REDIS_URL is set, so every instance shares it, and in process otherwise.
+func newCache(ctx context.Context, cfg config.Config, life *lifecycle.Manager) (cache.Cache, error) {
+	if cfg.RedisURL == "" {
+		return cache.NewLRU(cfg.CacheSize, time.Now), nil
+	}
+	r, err := cache.NewRedis(ctx, cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	life.Register(lifecycle.Close, "cache", r.Close)
+	return r, nil
+}
+
+// newPurchaseRepo picks how purchases are persisted: as documents (the default) or, with
+// PURCHASE_PERSISTENCE=eventsourced, as an append-only stream of events, in Postgres if POSTGRES_URL is set.
+// The Postgres connection pool is exported to kpis and closed by life.
+func newPurchaseRepo(ctx context.Context, cfg config.Config, kpis *metrics.Metrics, life *lifecycle.Manager) (purchase.Repository, error) {
+	switch cfg.PurchasePersistence {
+	case "", "document":
+		return purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	case "eventsourced":
+		var es eventstore.Store
+		var err error
+		if cfg.PostgresURL != "" {
+			var pg *eventstore.PostgresStore
+			if pg, err = eventstore.NewPostgresStore(ctx, cfg.PostgresURL, "purchase", cfg.PostgresPool()); err == nil {
+				kpis.PostgresPool("purchase", pg.PoolStats)
+				life.Register(lifecycle.Close, "purchase events", pg.Close)
+			}
+			es = pg
+		} else {
+			es, err = eventstore.NewMongoStore(ctx, cfg.MongoURI, "purchase")
+		}
+		if err != nil {
+			return nil, err
+		}
+		return purchase.NewEventSourcedRepo(es, nil, 0)
+	default:
+		return nil, fmt.Errorf("unknown purchase persistence mode %q", cfg.PurchasePersistence)
+	}
+}
+
+// followOwnOrders only lets customers follow their own orders. The mux has already authenticated them.
+func followOwnOrders(enabled bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if enabled {
+			customerID, _ := uuid.Parse(mux.Vars(r)["customerID"])
+			p, _ := auth.FromContext(r.Context())
+			if err := auth.Authorize(p, auth.ActionFollowOrders, auth.Resource{CustomerID: customerID}); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// workTickets only lets baristas and managers of a store watch its kitchen display.
+func workTickets(enabled bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if enabled {
+			storeID, _ := uuid.Parse(mux.Vars(r)["storeID"])
+			p, _ := auth.FromContext(r.Context())
+			if err := auth.Authorize(p, auth.ActionWorkTickets, auth.Resource{StoreID: storeID}); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// followSubmission only lets whoever may see a purchase follow its submission.
+func followSubmission(enabled bool, submissions *submission.Service, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if enabled {
+			id, _ := uuid.Parse(mux.Vars(r)["submissionID"])
+			s, err := submissions.Get(r.Context(), id)
+			if errors.Is(err, submission.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			p, _ := auth.FromContext(r.Context())
+			if err := auth.Authorize(p, auth.ActionViewPurchase, auth.Resource{StoreID: s.StoreID, CustomerID: s.CustomerID}); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// newCourier picks who delivers purchases. The mock courier never goes anywhere; its deliveries only move
+// when told to.
+func newCourier(cfg config.Delivery) (delivery.Provider, error) {
+	switch cfg.Provider {
+	case "mock":
+		return delivery.NewMockProvider(*money.New(cfg.MockFee, cfg.Currency)), nil
+	case "doordash":
+		return delivery.NewDoorDash(cfg.DoorDash, &http.Client{Timeout: 10 * time.Second})
+	default:
+		return nil, fmt.Errorf("unknown delivery provider %q", cfg.Provider)
+	}
+}
+
+// newMarketplaces returns the marketplaces that are configured.
+func newMarketplaces(cfg marketplace.Config) ([]marketplace.Marketplace, error) {
+	var res []marketplace.Marketplace
+	if cfg.UberEats.ClientID != "" {
+		ue, err := marketplace.NewUberEats(cfg.UberEats, &http.Client{Timeout: 10 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ue)
+	}
+	if cfg.DoorDash.WebhookToken != "" {
+		dd, err := marketplace.NewDoorDash(cfg.DoorDash)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, dd)
+	}
+	return res, nil
+}
+
+type closablePublisher interface {
+	events.Publisher
+	Close() error
+}
+
+func newEventPublisher(transport, brokers string) (closablePublisher, error) {
+	switch transport {
+	case "":
+		return nil, nil
+	case "kafka":
+		return kafka.NewPublisher(strings.Split(brokers, ","), events.JSONCodec{})
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-api", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
+
+func newEventSubscriber(transport, brokers, group string) (events.Subscriber, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewSubscriber(strings.Split(brokers, ","), group)
+	case "nats":
+		return nats.NewJetStream(brokers, group, events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
+
+// consume handles topic in the background until the server stops consuming, then closes sub.
+func consume(ctx context.Context, life *lifecycle.Manager, name string, sub events.Subscriber, topic string, h events.Handler) {
+	consuming, stopConsuming := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := sub.Subscribe(consuming, topic, h); err != nil && consuming.Err() == nil {
+			log.Printf("%s stopped: %v", name, err)
+		}
+	}()
+	life.Register(lifecycle.StopConsuming, name, func(ctx context.Context) error {
+		stopConsuming()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if c, ok := sub.(interface{ Close() error }); ok {
+		life.Register(lifecycle.Close, name+" subscriber", func(context.Context) error { return c.Close() })
+	}
+}
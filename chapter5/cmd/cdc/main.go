@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"coffeeco/internal/cdc"
+	"coffeeco/internal/config"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/purchase"
+)
+
+type closablePublisher interface {
+	events.Publisher
+	Close() error
+}
+
+func main() {
+	source := flag.String("source", "mongo", "where purchases are written: mongo (change stream) or postgres (event store WAL)")
+	slot := flag.String("slot", "coffeeco_cdc", "postgres: logical replication slot to read from")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	pub, err := newEventPublisher(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pub.Close()
+
+	var tailErr error
+	switch *source {
+	case "mongo":
+		repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cps, err := cdc.NewMongoCheckpoints(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tailErr = cdc.TailMongoPurchases(ctx, repo, pub, cps)
+	case "postgres":
+		store, err := eventstore.NewPostgresStore(ctx, cfg.PostgresURL, "purchase", cfg.PostgresPool())
+		if err != nil {
+			log.Fatal(err)
+		}
+		registry := events.NewRegistry()
+		purchase.RegisterEvents(registry)
+		tailErr = cdc.TailPostgresEvents(ctx, store, *slot, registry, pub)
+	default:
+		log.Fatalf("unknown source %q", *source)
+	}
+	if tailErr != nil {
+		log.Fatal(tailErr)
+	}
+}
+
+func newEventPublisher(transport, brokers string) (closablePublisher, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewPublisher(strings.Split(brokers, ","), events.JSONCodec{})
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-cdc", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
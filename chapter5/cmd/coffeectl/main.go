@@ -0,0 +1,1315 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/command"
+	"coffeeco/internal/compliance"
+	"coffeeco/internal/config"
+	"coffeeco/internal/customer"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/feature"
+	"coffeeco/internal/importer"
+	"coffeeco/internal/incentives"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/legacypos"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/notifications"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/privacy"
+	"coffeeco/internal/procurement"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/royalty"
+	"coffeeco/internal/simulation"
+	"coffeeco/internal/store"
+	"coffeeco/internal/subscription"
+	"coffeeco/internal/wholesale"
+)
+
+const usage = `usage: coffeectl <command> [flags]
+
+commands:
+  store create       -location <name> [-products "latte=400,flat white=350"] [-currency USD]
+  store discount     -store <id> -percent <0-100> [-operator <name>]
+  inventory show     -store <id>
+  inventory restock  -store <id> -item <name> -qty <n>
+  inventory alert    -store <id> -item <name> -at <n>
+  order list         -store <id>
+  order packs        -order <id> -item <name> -packs <n>
+  order approve      -order <id> [-operator <name>]
+  order cancel       -order <id> -reason <why>
+  order receive      -order <id> [-received "milk_ml=2,beans_g=1"]
+  wholesale register -name <café> -credit <amount> [-days <n>] [-email <address>]
+  wholesale terms    -account <id> -credit <amount> [-days <n>]
+  wholesale price    -account <id> -product <name> -price <amount>   0 for the list price
+  wholesale accounts
+  wholesale place    -account <id> -products "house blend 1kg=20,espresso 1kg=5"
+  wholesale orders   -account <id>
+  wholesale approve  -order <id> [-operator <name>]
+  wholesale reject   -order <id> -reason <why>
+  wholesale cancel   -order <id> -reason <why>
+  wholesale ship     -order <id>
+  wholesale paid     -order <id>
+  pass subscribe     -customer <id> -plan <plan> -card <token>
+  pass show          -customer <id>
+  pass cancel        -pass <id>
+  pass renew         charge every pass whose month is over; run it regularly, e.g. hourly
+  entitlement grant  -customer <id> -kind employee|partner [-partner <company>] -percent <n> [-expires 2006-01-02] [-cap <n>] [-operator <name>]
+  entitlement list   -customer <id>
+  entitlement revoke -entitlement <id> [-operator <name>]
+  review list        [-store <id>]   purchases waiting for a manager, at every store if none is given
+  review approve     -purchase <id> [-operator <name>]
+  review reject      -purchase <id> -reason <why> [-operator <name>]
+  review expire      cancel the held purchases no manager decided on in time; run it regularly, e.g. every minute
+  loyalty adjust     -card <id> -drinks <+/-n> -note <why> [-operator <name>]
+  loyalty rebuild    [-batch 1000]   recompute every card balance from the loyalty events in NATS
+  audit              -from 2006-01-02 [-to 2006-01-02] [-actor <name>]
+  events replay      re-publish every stored purchase using EVENT_TRANSPORT and EVENT_BROKERS
+  projections rebuild
+  reconcile          [-from 2006-01-02] [-to 2006-01-02]
+  incentives         [-at 2006-01-02] [-barista <name>]   earnings of the pay period the day is in
+  royalty generate   [-month 2006-01]   work out what every franchisee owes for the month, the last one if none is given
+  royalty statements [-month 2006-01]
+  royalty export     [-month 2006-01]   book the statements that are not disputed in the accounts
+  compliance         [-from 2006-01-02] [-to 2006-01-02] [-totals] [-csv]   suspicious cash activity, or daily totals
+  import             -file <purchases.ndjson|purchases.csv> [-from <record>]
+  legacy import      -file <export.xml> -stores "LDN01=<store id>,..." [-currency USD] [-tz Europe/London]
+  legacy quarantine  list the legacy POS sales that could not be imported, and why
+  privacy erase      -customer <id> [-operator <name>]
+  simulate           [-day 2006-01-02] [-purchases 200] [-customers 50] [-decline 5] [-seed 1] [-v]   replay a day with the configured pricing
+`
+
+// cfg is loaded before any command runs.
+var cfg config.Config
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	if (cmd == "store" || cmd == "loyalty" || cmd == "events" || cmd == "projections" || cmd == "privacy" || cmd == "inventory" || cmd == "pass" || cmd == "order" || cmd == "wholesale" || cmd == "legacy" || cmd == "entitlement" || cmd == "review" || cmd == "royalty") && len(args) > 0 {
+		cmd, args = cmd+" "+args[0], args[1:]
+	}
+
+	ctx := context.Background()
+	var err error
+	if cfg, err = config.FromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	switch cmd {
+	case "store create":
+		err = createStore(ctx, args)
+	case "store discount":
+		err = setDiscount(ctx, args)
+	case "inventory show", "inventory restock", "inventory alert":
+		err = manageInventory(ctx, cmd, args)
+	case "order list", "order packs", "order approve", "order cancel", "order receive":
+		err = manageOrders(ctx, cmd, args)
+	case "wholesale register", "wholesale terms", "wholesale price", "wholesale accounts", "wholesale place", "wholesale orders",
+		"wholesale approve", "wholesale reject", "wholesale cancel", "wholesale ship", "wholesale paid":
+		err = manageWholesale(ctx, cmd, args)
+	case "pass subscribe", "pass show", "pass cancel", "pass renew":
+		err = managePasses(ctx, cmd, args)
+	case "entitlement grant", "entitlement list", "entitlement revoke":
+		err = manageEntitlements(ctx, cmd, args)
+	case "review list", "review approve", "review reject", "review expire":
+		err = manageReviews(ctx, cmd, args)
+	case "loyalty adjust":
+		err = adjustLoyalty(ctx, args)
+	case "loyalty rebuild":
+		err = rebuildLoyalty(ctx, args)
+	case "events replay":
+		err = replayEvents(ctx)
+	case "projections rebuild":
+		err = rebuildProjections(ctx)
+	case "reconcile":
+		err = reconcile(ctx, args)
+	case "incentives":
+		err = listEarnings(ctx, args)
+	case "royalty generate", "royalty statements", "royalty export":
+		err = manageRoyalties(ctx, cmd, args)
+	case "compliance":
+		err = reportCompliance(ctx, args)
+	case "import":
+		err = importPurchases(ctx, args)
+	case "audit":
+		err = listAudit(ctx, args)
+	case "legacy import":
+		err = importLegacySales(ctx, args)
+	case "legacy quarantine":
+		err = listQuarantine(ctx)
+	case "privacy erase":
+		err = eraseCustomer(ctx, args)
+	case "simulate":
+		err = simulateDay(ctx, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func storeService(ctx context.Context) (*store.Service, error) {
+	repo, err := store.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	opts := []store.Option{store.WithAuditLog(auditLog)}
+	// The API instances invalidate their cached lookups of the store from the events.
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		opts = append(opts, store.WithEventPublisher(pub))
+	}
+	return store.NewService(repo, opts...), nil
+}
+
+func createStore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("store create", flag.ExitOnError)
+	location := fs.String("location", "", "where the store is")
+	products := fs.String("products", "", "comma separated name=price pairs, prices in the currency's minor unit")
+	currency := fs.String("currency", "USD", "currency of the product prices")
+	_ = fs.Parse(args)
+
+	st := store.New(uuid.New(), *location)
+	if *products != "" {
+		for _, p := range strings.Split(*products, ",") {
+			name, price, ok := strings.Cut(p, "=")
+			amount, err := strconv.ParseInt(price, 10, 64)
+			if !ok || err != nil {
+				return fmt.Errorf("invalid product %q, expected name=price", p)
+			}
+			st.ProductsForSale = append(st.ProductsForSale, coffeeco.Product{ItemName: strings.TrimSpace(name), BasePrice: *money.New(amount, *currency)})
+		}
+	}
+
+	svc, err := storeService(ctx)
+	if err != nil {
+		return err
+	}
+	if err := svc.CreateStore(ctx, st); err != nil {
+		return err
+	}
+	fmt.Printf("created store %s\n", st.ID)
+	return nil
+}
+
+func setDiscount(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("store discount", flag.ExitOnError)
+	storeID := fs.String("store", "", "store ID")
+	percent := fs.Int64("percent", 0, "discount in percent, 0 to remove it")
+	operator := fs.String("operator", os.Getenv("USER"), "who is changing the discount; kept in the audit log")
+	_ = fs.Parse(args)
+
+	id, err := uuid.Parse(*storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+	svc, err := storeService(ctx)
+	if err != nil {
+		return err
+	}
+	return svc.SetDiscount(audit.WithActor(ctx, *operator), id, *percent)
+}
+
+func manageEntitlements(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	customerID := fs.String("customer", "", "customer ID")
+	kind := fs.String("kind", "", "employee or partner")
+	partner := fs.String("partner", "", "company a partner discount was negotiated with")
+	percent := fs.Float64("percent", 0, "discount in percent")
+	expires := fs.String("expires", "", "day the entitlement stops applying, UTC; it does not expire if empty")
+	monthlyCap := fs.Int("cap", 0, "purchases a month it may discount, 0 for no cap")
+	entitlementID := fs.String("entitlement", "", "entitlement ID")
+	operator := fs.String("operator", os.Getenv("USER"), "who grants or revokes the entitlement; kept in the audit log")
+	_ = fs.Parse(args)
+
+	repo, err := entitlement.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	svc := entitlement.NewService(repo, entitlement.WithAuditLog(auditLog))
+	ctx = audit.WithActor(ctx, *operator)
+
+	var list []*entitlement.Entitlement
+	switch cmd {
+	case "entitlement grant":
+		g := entitlement.Grant{Kind: entitlement.Kind(*kind), Partner: *partner, PercentOff: *percent, MonthlyCap: *monthlyCap}
+		if g.CustomerID, err = uuid.Parse(*customerID); err != nil {
+			return fmt.Errorf("invalid customer ID: %w", err)
+		}
+		if *expires != "" {
+			if g.ExpiresAt, err = time.Parse(time.DateOnly, *expires); err != nil {
+				return fmt.Errorf("invalid expiry: %w", err)
+			}
+		}
+		e, err := svc.Grant(ctx, g)
+		if err != nil {
+			return err
+		}
+		list = append(list, e)
+	case "entitlement list":
+		id, err := uuid.Parse(*customerID)
+		if err != nil {
+			return fmt.Errorf("invalid customer ID: %w", err)
+		}
+		if list, err = svc.ForCustomer(ctx, id); err != nil {
+			return err
+		}
+	case "entitlement revoke":
+		id, err := uuid.Parse(*entitlementID)
+		if err != nil {
+			return fmt.Errorf("invalid entitlement ID: %w", err)
+		}
+		e, err := svc.Revoke(ctx, id)
+		if err != nil {
+			return err
+		}
+		list = append(list, e)
+	}
+
+	now := time.Now()
+	day := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format(time.DateOnly)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTITLEMENT\tDISCOUNT\tEXPIRES\tUSED THIS MONTH\tCAP\tGRANTED BY\tGRANTED\tREVOKED")
+	for _, e := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n", e.ID, e.Name(), day(e.ExpiresAt), e.UsesIn(now), e.MonthlyCap, e.GrantedBy, day(e.GrantedAt), day(e.RevokedAt()))
+	}
+	return w.Flush()
+}
+
+func adjustLoyalty(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("loyalty adjust", flag.ExitOnError)
+	cardID := fs.String("card", "", "loyalty card ID")
+	drinks := fs.Int("drinks", 0, "free drinks to add, or remove if negative")
+	note := fs.String("note", "", "why the adjustment is made; kept on the card")
+	operator := fs.String("operator", os.Getenv("USER"), "who is making the adjustment")
+	_ = fs.Parse(args)
+
+	id, err := uuid.Parse(*cardID)
+	if err != nil {
+		return fmt.Errorf("invalid card ID: %w", err)
+	}
+	repo, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	opts := []loyalty.Option{loyalty.WithAuditLog(auditLog)}
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		opts = append(opts, loyalty.WithEventPublisher(pub))
+	}
+	card, err := loyalty.NewService(repo, opts...).AdjustBalance(ctx, id, *drinks, *note, *operator)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("card %s now has %d free drinks\n", card.ID, card.FreeDrinksAvailable)
+	return nil
+}
+
+// rebuildLoyalty replays the loyalty topic into the card balances. Only JetStream keeps the events to replay
+// them from the start.
+func rebuildLoyalty(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("loyalty rebuild", flag.ExitOnError)
+	batch := fs.Int("batch", loyalty.DefaultAccrualBatch, "events added up per card before they are written")
+	_ = fs.Parse(args)
+
+	if cfg.EventTransport != "nats" {
+		return fmt.Errorf("loyalty events can only be replayed from nats, not %q", cfg.EventTransport)
+	}
+	js, err := nats.NewJetStream(cfg.EventBrokers, "coffeectl", events.JSONCodec{})
+	if err != nil {
+		return err
+	}
+	defer js.Close()
+	repo, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	accrual := loyalty.NewBulkAccrual(repo, *batch)
+	src := projection.SourceFunc(func(ctx context.Context, h events.Handler) error {
+		return js.Replay(ctx, events.TopicFor(loyalty.EventTypeStampAdded), h)
+	})
+	if err := projection.Rebuild(ctx, src, accrual); err != nil {
+		return err
+	}
+	n, writes := accrual.Applied()
+	log.Printf("rebuilt loyalty balances from %d events in %d card writes", n, writes)
+	return nil
+}
+
+func manageInventory(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	storeID := fs.String("store", "", "store ID")
+	item := fs.String("item", "", "product or ingredient, e.g. croissant or milk_ml")
+	qty := fs.Int64("qty", 0, "quantity delivered")
+	at := fs.Int64("at", 0, "alert when this many are left, 0 to stop alerting")
+	_ = fs.Parse(args)
+
+	id, err := uuid.Parse(*storeID)
+	if err != nil {
+		return fmt.Errorf("invalid store ID: %w", err)
+	}
+	repo, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	var opts []inventory.Option
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		opts = append(opts, inventory.WithEventPublisher(pub))
+	}
+	svc := inventory.NewService(repo, cfg.Recipes, opts...)
+	switch cmd {
+	case "inventory restock":
+		err = svc.Restock(ctx, id, *item, *qty)
+	case "inventory alert":
+		err = svc.SetLowStockThreshold(ctx, id, *item, *at)
+	}
+	if err != nil {
+		return err
+	}
+	st, err := svc.Stock(ctx, id)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ITEM\tON HAND\tRESERVED\tAVAILABLE\tALERT AT")
+	for _, item := range st.Items() {
+		l, _ := st.Level(item)
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", item, l.OnHand, l.Reserved, l.Available(), l.LowAt)
+	}
+	return w.Flush()
+}
+
+// manageOrders works on the purchase orders drafted when stock runs low.
+func manageOrders(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	storeID := fs.String("store", "", "store ID")
+	orderID := fs.String("order", "", "purchase order ID")
+	item := fs.String("item", "", "item on the order, e.g. milk_ml")
+	packs := fs.Int64("packs", 0, "packs to order, 0 to take the item off the order")
+	operator := fs.String("operator", os.Getenv("USER"), "who approves the order; kept in the audit log")
+	reason := fs.String("reason", "", "why the order is cancelled")
+	received := fs.String("received", "", "comma separated item=packs pairs that arrived; everything ordered if empty")
+	_ = fs.Parse(args)
+
+	repo, err := procurement.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	stock, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	var invOpts []inventory.Option
+	opts := []procurement.Option{procurement.WithAuditLog(auditLog)}
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		invOpts = append(invOpts, inventory.WithEventPublisher(pub))
+		opts = append(opts, procurement.WithEventPublisher(pub))
+	}
+	svc := procurement.NewService(repo, cfg.Suppliers, inventory.NewService(stock, cfg.Recipes, invOpts...), opts...)
+
+	if cmd == "order list" {
+		id, err := uuid.Parse(*storeID)
+		if err != nil {
+			return fmt.Errorf("invalid store ID: %w", err)
+		}
+		open, err := svc.Open(ctx, id)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tSUPPLIER\tSTATUS\tITEM\tSKU\tPACKS\tTOTAL")
+		for _, o := range open {
+			for _, l := range o.Lines() {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", o.ID, o.SupplierID, o.Status(), l.Item, l.SKU, l.Packs, o.Total().Display())
+			}
+		}
+		return w.Flush()
+	}
+
+	id, err := uuid.Parse(*orderID)
+	if err != nil {
+		return fmt.Errorf("invalid purchase order ID: %w", err)
+	}
+	switch cmd {
+	case "order packs":
+		err = svc.SetPacks(ctx, id, *item, *packs)
+	case "order approve":
+		err = svc.Approve(audit.WithActor(ctx, *operator), id, *operator)
+	case "order cancel":
+		err = svc.Cancel(ctx, id, *reason)
+	case "order receive":
+		var arrived map[string]int64
+		if *received != "" {
+			arrived = map[string]int64{}
+			for _, p := range strings.Split(*received, ",") {
+				name, n, ok := strings.Cut(p, "=")
+				count, err := strconv.ParseInt(n, 10, 64)
+				if !ok || err != nil {
+					return fmt.Errorf("invalid item %q, expected item=packs", p)
+				}
+				arrived[strings.TrimSpace(name)] = count
+			}
+		}
+		err = svc.Receive(ctx, id, arrived)
+	}
+	if err != nil {
+		return err
+	}
+	o, err := svc.Order(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purchase order %s from %s is %s, %s\n", o.ID, o.SupplierID, o.Status(), o.Total().Display())
+	return nil
+}
+
+// manageWholesale runs the accounts of the cafés that buy beans in bulk, and their orders.
+func manageWholesale(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	name := fs.String("name", "", "name of the café")
+	email := fs.String("email", "", "where invoices are sent")
+	credit := fs.Int64("credit", 0, "credit limit, in the minor unit of the wholesale currency")
+	days := fs.Int("days", 0, "days to pay an invoice, 0 for the days of the config file")
+	accountID := fs.String("account", "", "wholesale account ID")
+	product := fs.String("product", "", "product on the wholesale price list")
+	price := fs.Int64("price", 0, "negotiated price, in the minor unit of the wholesale currency")
+	products := fs.String("products", "", "comma separated product=quantity pairs")
+	orderID := fs.String("order", "", "wholesale order ID")
+	operator := fs.String("operator", os.Getenv("USER"), "who approves the order; kept in the audit log")
+	reason := fs.String("reason", "", "why the order is rejected or cancelled")
+	_ = fs.Parse(args)
+
+	repo, err := wholesale.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	stock, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	var invOpts []inventory.Option
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		invOpts = append(invOpts, inventory.WithEventPublisher(pub))
+	}
+	svc := wholesale.NewService(repo, cfg.Wholesale, inventory.NewService(stock, cfg.Recipes, invOpts...), wholesale.WithAuditLog(auditLog))
+
+	switch cmd {
+	case "wholesale register":
+		a, err := svc.Register(ctx, *name, *email, *credit, *days)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("registered %s as wholesale account %s\n", a.Name, a.ID)
+		return nil
+	case "wholesale accounts":
+		accounts, err := svc.Accounts(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACCOUNT\tNAME\tCREDIT LIMIT\tOWED\tPAYMENT DAYS")
+		for _, a := range accounts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", a.ID, a.Name, money.New(a.CreditLimit(), cfg.Wholesale.Currency).Display(), money.New(a.Owed(), cfg.Wholesale.Currency).Display(), a.PaymentDays())
+		}
+		return w.Flush()
+	case "wholesale terms", "wholesale price", "wholesale place", "wholesale orders":
+		id, err := uuid.Parse(*accountID)
+		if err != nil {
+			return fmt.Errorf("invalid wholesale account ID: %w", err)
+		}
+		switch cmd {
+		case "wholesale terms":
+			return svc.SetTerms(ctx, id, *credit, *days)
+		case "wholesale price":
+			return svc.Negotiate(ctx, id, *product, *price)
+		case "wholesale place":
+			quantities := map[string]int64{}
+			for _, p := range strings.Split(*products, ",") {
+				name, n, ok := strings.Cut(p, "=")
+				qty, err := strconv.ParseInt(n, 10, 64)
+				if !ok || err != nil {
+					return fmt.Errorf("invalid product %q, expected product=quantity", p)
+				}
+				quantities[strings.TrimSpace(name)] += qty
+			}
+			o, err := svc.Place(ctx, id, quantities)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("wholesale order %s is %s, %s", o.ID, o.Status(), o.Total().Display())
+			if holds := o.Holds(); len(holds) > 0 {
+				fmt.Printf(", held: %s", strings.Join(holds, ", "))
+			}
+			fmt.Println()
+			return nil
+		}
+		orders, err := svc.Orders(ctx, id)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ORDER\tPLACED\tSTATUS\tTOTAL\tDUE\tHELD")
+		for _, o := range orders {
+			due := ""
+			if !o.DueAt().IsZero() {
+				due = o.DueAt().Format(time.DateOnly)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", o.ID, o.PlacedAt.Format(time.DateOnly), o.Status(), o.Total().Display(), due, strings.Join(o.Holds(), ", "))
+		}
+		return w.Flush()
+	}
+
+	id, err := uuid.Parse(*orderID)
+	if err != nil {
+		return fmt.Errorf("invalid wholesale order ID: %w", err)
+	}
+	switch cmd {
+	case "wholesale approve":
+		err = svc.Approve(audit.WithActor(ctx, *operator), id, *operator)
+	case "wholesale reject":
+		err = svc.Reject(ctx, id, *reason)
+	case "wholesale cancel":
+		err = svc.Cancel(ctx, id, *reason)
+	case "wholesale ship":
+		err = svc.Ship(ctx, id)
+	case "wholesale paid":
+		err = svc.Pay(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	o, err := svc.Order(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wholesale order %s is %s, %s\n", o.ID, o.Status(), o.Total().Display())
+	return nil
+}
+
+func managePasses(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	customerID := fs.String("customer", "", "customer ID")
+	planID := fs.String("plan", "", "plan ID, as in the plans of the config file")
+	card := fs.String("card", "", "card token that can be charged every month")
+	passID := fs.String("pass", "", "pass ID")
+	_ = fs.Parse(args)
+
+	repo, err := subscription.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	gateway, err := payment.NewStripeService(cfg.StripeAPIKey)
+	if err != nil {
+		return err
+	}
+	svc := subscription.NewService(repo, gateway, cfg.Plans)
+	var p *subscription.Pass
+	switch cmd {
+	case "pass renew":
+		report, err := svc.RenewDue(ctx)
+		fmt.Printf("renewed %d passes, %d declined\n", report.Renewed, report.Failed)
+		return err
+	case "pass cancel":
+		id, err := uuid.Parse(*passID)
+		if err != nil {
+			return fmt.Errorf("invalid pass ID: %w", err)
+		}
+		refund, err := svc.Cancel(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("cancelled pass %s, refunded %s\n", id, refund.Display())
+		return nil
+	case "pass subscribe":
+		id, err := uuid.Parse(*customerID)
+		if err != nil {
+			return fmt.Errorf("invalid customer ID: %w", err)
+		}
+		if p, err = svc.Subscribe(ctx, id, *planID, *card); err != nil {
+			return err
+		}
+	case "pass show":
+		id, err := uuid.Parse(*customerID)
+		if err != nil {
+			return fmt.Errorf("invalid customer ID: %w", err)
+		}
+		if p, err = svc.Current(ctx, id); err != nil {
+			return err
+		}
+	}
+	start, end := p.Period()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PASS\tPLAN\tSTATUS\tPAID FROM\tPAID UNTIL\tDRINKS LEFT TODAY")
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", p.ID, p.PlanID, p.Status(), start.Format(time.DateOnly), end.Format(time.DateOnly), p.DrinksLeft(time.Now()))
+	return w.Flush()
+}
+
+// manageReviews decides on the card purchases held for a manager's review. Approving one charges the card
+// and completes the purchase as the API would have.
+func manageReviews(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	storeID := fs.String("store", "", "store ID")
+	purchaseID := fs.String("purchase", "", "ID of the held purchase")
+	reason := fs.String("reason", "", "why the purchase is rejected")
+	operator := fs.String("operator", os.Getenv("USER"), "who decides on the purchase; kept in the audit log")
+	_ = fs.Parse(args)
+
+	svc, err := reviewService(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = audit.WithActor(ctx, *operator)
+	var r *purchase.Review
+	switch cmd {
+	case "review expire":
+		n, err := svc.ExpireReviews(ctx)
+		fmt.Printf("cancelled %d purchases that waited too long\n", n)
+		return err
+	case "review list":
+		id := uuid.Nil
+		if *storeID != "" {
+			if id, err = uuid.Parse(*storeID); err != nil {
+				return fmt.Errorf("invalid store ID: %w", err)
+			}
+		}
+		pending, err := svc.PendingReviews(ctx, id)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PURCHASE\tSTORE\tTOTAL\tHELD AT\tEXPIRES AT")
+		for _, r := range pending {
+			total := r.Purchase.Total()
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID(), r.StoreID, total.Display(), r.HeldAt.Format(time.DateTime), r.ExpiresAt.Format(time.DateTime))
+		}
+		return w.Flush()
+	case "review approve":
+		id, err := uuid.Parse(*purchaseID)
+		if err != nil {
+			return fmt.Errorf("invalid purchase ID: %w", err)
+		}
+		if r, err = svc.ApproveReview(ctx, id); err != nil {
+			return err
+		}
+	case "review reject":
+		id, err := uuid.Parse(*purchaseID)
+		if err != nil {
+			return fmt.Errorf("invalid purchase ID: %w", err)
+		}
+		if *reason == "" {
+			return errors.New("a reason is required to reject a purchase")
+		}
+		if r, err = svc.RejectReview(ctx, id, *reason); err != nil {
+			return err
+		}
+	}
+	total := r.Purchase.Total()
+	fmt.Printf("purchase %s of %s is %s by %s\n", r.ID(), total.Display(), r.Status(), r.DecidedBy())
+	return nil
+}
+
+// reviewService completes approved purchases with what they held: their stock, the drinks of the
+// customer's pass, their negotiated discount and the loyalty card they earn a stamp on.
+func reviewService(ctx context.Context) (*purchase.Service, error) {
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	reviews, err := purchase.NewMongoReviewRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := payment.NewStripeService(cfg.StripeAPIKey)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	passes, err := subscription.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	entitlements, err := entitlement.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	cards, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	var invOpts []inventory.Option
+	opts := []purchase.Option{
+		purchase.WithReviews(cfg.ReviewPolicy(), reviews, gateway),
+		purchase.WithLoyaltyCards(cards),
+		purchase.WithPasses(subscription.NewService(passes, gateway, cfg.Plans)),
+		purchase.WithEntitlements(entitlement.NewService(entitlements)),
+		purchase.WithAuditLog(auditLog),
+	}
+	if pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers); err == nil {
+		invOpts = append(invOpts, inventory.WithEventPublisher(pub))
+		opts = append(opts, purchase.WithEventPublisher(pub))
+	}
+	opts = append(opts, purchase.WithInventory(inventory.NewService(stock, cfg.Recipes, invOpts...)))
+	// Held purchases were priced when they were made, so there is no need to charge or discount them again.
+	return purchase.NewService(nil, repo, nil, opts...), nil
+}
+
+func replayEvents(ctx context.Context) error {
+	pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		return err
+	}
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	var n int
+	err = repo.Replay(ctx, func(ctx context.Context, msg events.Message) error {
+		n++
+		return pub.Republish(ctx, msg)
+	})
+	log.Printf("re-published %d purchases", n)
+	return err
+}
+
+func rebuildProjections(ctx context.Context) error {
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	facts, err := analytics.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	sales, err := incentives.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	cash, err := compliance.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	if err := projection.Rebuild(ctx, repo, append(rm.All(), analytics.NewFacts(facts), incentives.NewAttribution(sales), compliance.NewLedger(cash))...); err != nil {
+		return err
+	}
+	log.Println("read models rebuilt")
+	return nil
+}
+
+func reconcile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	from := fs.String("from", now.AddDate(0, 0, -7).Format(time.DateOnly), "first day to check")
+	to := fs.String("to", now.Format(time.DateOnly), "day after the last day to check")
+	_ = fs.Parse(args)
+
+	start, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.DateOnly, *to)
+	if err != nil {
+		return err
+	}
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	ds, err := projection.ReconcileStoreSales(ctx, repo, rm.StoreSales, start, end)
+	if err != nil {
+		return err
+	}
+	if len(ds) == 0 {
+		fmt.Println("store sales match the stored purchases")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DAY\tSTORE\tEXPECTED COUNT\tACTUAL COUNT\tEXPECTED TOTAL\tACTUAL TOTAL")
+	for _, d := range ds {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n", d.Day.Format(time.DateOnly), d.StoreID,
+			d.ExpectedCount, d.ActualCount, d.ExpectedTotal, d.ActualTotal)
+	}
+	_ = w.Flush()
+	return fmt.Errorf("%d discrepancies; run 'coffeectl projections rebuild' to fix them", len(ds))
+}
+
+func listEarnings(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("incentives", flag.ExitOnError)
+	at := fs.String("at", time.Now().UTC().Format(time.DateOnly), "a day of the pay period")
+	barista := fs.String("barista", "", "only list what this barista earned")
+	_ = fs.Parse(args)
+
+	if cfg.Incentives.Currency == "" {
+		return errors.New("there is no incentive plan; set incentives in COFFEECO_CONFIG")
+	}
+	day, err := time.Parse(time.DateOnly, *at)
+	if err != nil {
+		return err
+	}
+	sales, err := incentives.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	svc := incentives.NewService(sales, cfg.Incentives)
+	period, err := svc.Period(day)
+	if err != nil {
+		return err
+	}
+	earnings, err := svc.Earnings(ctx, period, *barista)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("pay period %s to %s, in %s\n", period.Start.Format(time.DateOnly), period.End.AddDate(0, 0, -1).Format(time.DateOnly), cfg.Incentives.Currency)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BARISTA\tPURCHASES\tSALES\tCOMMISSION\tUPSELLS\tUPSELL BONUS\tTOTAL\tUNPAID PURCHASES")
+	for _, e := range earnings {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n", e.Barista, e.Purchases, e.Sales, e.Commission,
+			e.Upsells, e.UpsellBonus, e.Total, e.Unpaid)
+	}
+	return w.Flush()
+}
+
+func manageRoyalties(ctx context.Context, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	month := fs.String("month", time.Now().UTC().AddDate(0, -1, 0).Format("2006-01"), "month of the statements")
+	_ = fs.Parse(args)
+
+	if len(cfg.Royalties.Agreements) == 0 {
+		return errors.New("there are no franchisees; set royalties.agreements in COFFEECO_CONFIG")
+	}
+	repo, err := royalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	facts, err := analytics.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	refunds, err := refund.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	var opts []royalty.Option
+	if cfg.Royalties.Accounting.URL != "" {
+		accounting, err := royalty.NewHTTPAccounting(cfg.Royalties.Accounting, nil)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, royalty.WithAccounting(accounting))
+	}
+	svc := royalty.NewService(repo, cfg.Royalties.Agreements, analytics.NewService(facts), refunds, opts...)
+
+	var statements []*royalty.Statement
+	switch cmd {
+	case "royalty generate":
+		statements, err = svc.Generate(ctx, *month)
+	case "royalty statements":
+		statements, err = svc.Statements(ctx, *month)
+	case "royalty export":
+		statements, err = svc.Export(ctx, *month)
+	}
+	// Export reports the statements it could not book along with those it did.
+	printStatements(statements)
+	return err
+}
+
+func printStatements(statements []*royalty.Statement) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, st := range statements {
+		state := "open"
+		switch {
+		case st.Exported():
+			state = "exported as " + st.ExportRef
+		case st.Disputed():
+			state = "disputed"
+		}
+		fmt.Fprintf(w, "%s (%s)\t%s\t%s\t%s\n", st.Name, st.FranchiseeID, st.Month, st.ID, state)
+		fmt.Fprintln(w, "STORE\tPURCHASES\tSALES\tREFUNDS")
+		for _, l := range st.Stores {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", l.StoreID, l.Purchases, l.Sales, l.Refunds)
+		}
+		fmt.Fprintf(w, "net sales\t\t%d %s\t\n", st.NetSales, st.Currency)
+		fmt.Fprintf(w, "royalty at %g%%\t\t%d %s\t\n", st.Percent, st.Royalty, st.Currency)
+		for _, a := range st.Annotations {
+			kind := "disputed"
+			if a.Resolution {
+				kind = "resolved"
+			}
+			fmt.Fprintf(w, "%s by %s on %s: %s\n", kind, a.By, a.At.Format(time.DateOnly), a.Note)
+		}
+		fmt.Fprintln(w)
+	}
+	_ = w.Flush()
+}
+
+func reportCompliance(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compliance", flag.ExitOnError)
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	from := fs.String("from", now.AddDate(0, 0, -7).Format(time.DateOnly), "first day to check")
+	to := fs.String("to", now.AddDate(0, 0, 1).Format(time.DateOnly), "day after the last day to check")
+	totals := fs.Bool("totals", false, "list the daily cash totals of every customer instead")
+	asCSV := fs.Bool("csv", false, "write CSV, e.g. to file a suspicious activity report")
+	_ = fs.Parse(args)
+
+	if cfg.Compliance.Currency == "" {
+		return errors.New("there are no compliance thresholds; set compliance in COFFEECO_CONFIG")
+	}
+	start, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.DateOnly, *to)
+	if err != nil {
+		return err
+	}
+	cash, err := compliance.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	svc := compliance.NewService(cash, cfg.Compliance)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if *totals {
+		days, err := svc.DailyTotals(ctx, start, end)
+		if err != nil {
+			return err
+		}
+		if *asCSV {
+			return analytics.WriteCSV(os.Stdout, days)
+		}
+		fmt.Fprintln(w, "DAY\tCUSTOMER\tCURRENCY\tAMOUNT\tTRANSACTIONS")
+		for _, d := range days {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", d.Day, d.CustomerID, d.Currency, d.Amount, d.Transactions)
+		}
+		return w.Flush()
+	}
+	activity, err := svc.SuspiciousActivity(ctx, start, end)
+	if err != nil {
+		return err
+	}
+	if *asCSV {
+		return analytics.WriteCSV(os.Stdout, activity)
+	}
+	fmt.Fprintln(w, "DAY\tRULE\tCUSTOMER\tAMOUNT\tTHRESHOLD\tSTORES\tTRANSACTIONS")
+	for _, a := range activity {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d %s\t%d\t%s\t%s\n", a.Day, a.Rule, cmp.Or(a.CustomerID, "anonymous"), a.Amount, a.Currency,
+			a.Threshold, a.StoreIDs, a.TransactionIDs)
+	}
+	return w.Flush()
+}
+
+func listAudit(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	now := time.Now().UTC().Truncate(24 * time.Hour)
+	from := fs.String("from", now.AddDate(0, 0, -7).Format(time.DateOnly), "first day to list")
+	to := fs.String("to", now.AddDate(0, 0, 1).Format(time.DateOnly), "day after the last day to list")
+	actor := fs.String("actor", "", "only list what this actor did")
+	_ = fs.Parse(args)
+
+	start, err := time.Parse(time.DateOnly, *from)
+	if err != nil {
+		return err
+	}
+	end, err := time.Parse(time.DateOnly, *to)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	entries, err := auditLog.Query(ctx, audit.Query{Actor: *actor, From: start, To: end, Limit: 1000})
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tACTOR\tACTION\tAGGREGATE\tBEFORE\tAFTER\tNOTE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s %s\t%s\t%s\t%s\n", e.At.Format(time.RFC3339), e.Actor, e.Action,
+			e.AggregateType, e.AggregateID, e.Before, e.After, e.Note)
+	}
+	return w.Flush()
+}
+
+func importPurchases(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "NDJSON or CSV export of historical purchases")
+	from := fs.Int("from", 1, "record to start at, to resume an interrupted import")
+	_ = fs.Parse(args)
+
+	format := importer.FormatNDJSON
+	if strings.HasSuffix(strings.ToLower(*file), ".csv") {
+		format = importer.FormatCSV
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	// Imported purchases are neither charged nor discounted, so there is no need for those services.
+	svc := purchase.NewService(nil, repo, nil)
+
+	sum, err := importer.Import(ctx, svc, f, format, *from, func(res importer.Result) error {
+		if res.Status == importer.StatusFailed {
+			fmt.Printf("record %d (%s): %s\n", res.Record, res.PurchaseID, res.Error)
+		}
+		return nil
+	})
+	fmt.Printf("imported %d, skipped %d already imported, %d failed\n", sum.Imported, sum.Skipped, sum.Failed)
+	if err != nil {
+		return err
+	}
+	if sum.Imported > 0 {
+		fmt.Println("run 'coffeectl projections rebuild' to include them in the read models")
+	}
+	return nil
+}
+
+// importLegacySales imports an XML export of the legacy POS through the anti-corruption layer, quarantining
+// the sales it cannot.
+func importLegacySales(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("legacy import", flag.ExitOnError)
+	file := fs.String("file", "", "XML export of the legacy POS")
+	codes := fs.String("stores", "", "store codes and the stores they stand for, e.g. LDN01=<id>,LDN02=<id>")
+	currency := fs.String("currency", "USD", "currency of sales that do not say")
+	tz := fs.String("tz", "UTC", "time zone of the tills' clocks")
+	_ = fs.Parse(args)
+
+	stores, err := legacypos.ParseStoreCodes(*codes)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	repo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	quarantine, err := legacypos.NewMongoQuarantine(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	bus := command.NewBus(command.Validate())
+	purchase.NewService(nil, repo, nil).RegisterCommands(bus)
+	acl := legacypos.NewTranslator(stores, quarantine, legacypos.WithCurrency(*currency), legacypos.WithLocation(loc))
+
+	sum, err := acl.Ingest(ctx, f, bus)
+	fmt.Printf("imported %d, skipped %d already imported, quarantined %d\n", sum.Imported, sum.Skipped, sum.Quarantined)
+	if err != nil {
+		return err
+	}
+	if sum.Quarantined > 0 {
+		fmt.Println("run 'coffeectl legacy quarantine' to see why")
+	}
+	return nil
+}
+
+func listQuarantine(ctx context.Context) error {
+	quarantine, err := legacypos.NewMongoQuarantine(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	rejected, err := quarantine.List(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AT\tSTORE CODE\tTXN\tREASON")
+	for _, r := range rejected {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.At.Format(time.RFC3339), r.StoreCode, r.TransactionNo, r.Reason)
+	}
+	return w.Flush()
+}
+
+// simulateDay replays a day of purchases with the configured pricing and feature flags. Nothing is stored;
+// run it before and after a change to the price book and compare the digests.
+func simulateDay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	day := fs.String("day", "2024-03-01", "day to replay, in UTC")
+	purchases := fs.Int("purchases", 200, "purchases made over the day")
+	customers := fs.Int("customers", 50, "loyalty card holders")
+	decline := fs.Int("decline", 5, "percentage of card payments declined")
+	seed := fs.Uint64("seed", 1, "seed the day is drawn from")
+	verbose := fs.Bool("v", false, "print every purchase")
+	_ = fs.Parse(args)
+
+	date, err := time.Parse(time.DateOnly, *day)
+	if err != nil {
+		return fmt.Errorf("invalid -day: %w", err)
+	}
+	flags := feature.NewMemory()
+	flags.Replace(cfg.Tunables.FeatureFlags)
+	report, err := simulation.Run(ctx, simulation.Day{
+		Date:           date,
+		Rules:          cfg.Tunables.Pricing,
+		Flags:          flags,
+		Customers:      *customers,
+		Purchases:      *purchases,
+		DeclinePercent: *decline,
+		Seed:           *seed,
+	})
+	if err != nil {
+		return err
+	}
+	if *verbose {
+		if _, err := report.WriteTo(os.Stdout); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("completed %d, failed %d, digest %s\n", report.Completed, report.Failed, report.Digest())
+	return nil
+}
+
+func eraseCustomer(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("privacy erase", flag.ExitOnError)
+	customerID := fs.String("customer", "", "ID of the customer who asked to be forgotten")
+	operator := fs.String("operator", os.Getenv("USER"), "who is handling the request; kept in the audit log")
+	_ = fs.Parse(args)
+
+	id, err := uuid.Parse(*customerID)
+	if err != nil {
+		return fmt.Errorf("invalid customer ID: %w", err)
+	}
+	if cfg.PurchasePersistence == "eventsourced" {
+		return errors.New("purchases in the event store cannot be anonymized yet; erase them by hand")
+	}
+	purchases, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	cards, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	stripe, err := payment.NewStripeService(cfg.StripeAPIKey)
+	if err != nil {
+		return err
+	}
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	customers, err := customer.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	prefs, err := notifications.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	facts, err := analytics.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	auditLog, err := audit.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	svc, err := privacy.NewService(purchases, cards, stripe,
+		privacy.WithEraser("customer profiles", customers),
+		privacy.WithEraser("customer history entries", rm.CustomerHistory),
+		privacy.WithEraser("notification preferences", prefs),
+		privacy.WithEraser("analytics sales", facts),
+		privacy.WithAuditLog(auditLog),
+	)
+	if err != nil {
+		return err
+	}
+	report, err := svc.Erase(audit.WithActor(ctx, *operator), id)
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		return fmt.Errorf("%w; run the command again to retry", err)
+	}
+	return nil
+}
+
+type republisher interface {
+	events.Publisher
+	deadletter.Republisher
+}
+
+func newRepublisher(transport, brokers string) (republisher, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewPublisher(strings.Split(brokers, ","), events.JSONCodec{})
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeectl", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+)
+
+const usage = `usage: dlq <list|redrive> [flags]
+
+Lists or redrives dead-lettered events. Redriven events are re-published to their original topic
+using EVENT_TRANSPORT and EVENT_BROKERS.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	var f deadletter.Filter
+	fs.StringVar(&f.Topic, "topic", "", "only dead letters from this topic")
+	fs.StringVar(&f.Consumer, "consumer", "", "only dead letters from this consumer")
+	fs.StringVar(&f.EventType, "type", "", "only events of this type, e.g. purchase.completed")
+	fs.StringVar(&f.AggregateID, "aggregate", "", "only events for this aggregate ID")
+	fs.BoolVar(&f.IncludeRedriven, "all", false, "list: include dead letters that were already redriven")
+	_ = fs.Parse(os.Args[2:])
+
+	ctx := context.Background()
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := deadletter.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd {
+	case "list":
+		entries, err := store.List(ctx, f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tFAILED AT\tCONSUMER\tTYPE\tAGGREGATE\tREDRIVEN\tERROR")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+				e.ID, e.FailedAt.Format(time.RFC3339), e.Consumer, e.Message.Type, e.Message.AggregateID,
+				e.RedrivenAt != nil, e.Error)
+		}
+		_ = w.Flush()
+	case "redrive":
+		pub, err := newRepublisher(cfg.EventTransport, cfg.EventBrokers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := deadletter.Redrive(ctx, store, pub, f)
+		if err != nil {
+			log.Fatalf("redrove %d before failing: %v", n, err)
+		}
+		log.Printf("redrove %d dead letters", n)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func newRepublisher(transport, brokers string) (deadletter.Republisher, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewPublisher(strings.Split(brokers, ","), events.JSONCodec{})
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-dlq", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
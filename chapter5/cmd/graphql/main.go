@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/health"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/store"
+	"coffeeco/internal/transport/gql"
+)
+
+func main() {
+	ctx := context.Background()
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sRepo, err := store.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cards, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	h, err := gql.NewHandler(rm.CustomerHistory, store.NewService(sRepo), cards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", h)
+	checks := health.NewChecker()
+	checks.Require("stores", sRepo)
+	checks.Require("loyalty_cards", cards)
+	mux.Handle("/healthz", checks.Liveness())
+	mux.Handle("/readyz", checks.Readiness())
+
+	addr := cfg.GraphQLAddr
+	log.Printf("serving GraphQL on %s/graphql", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+
+	"google.golang.org/grpc"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/lifecycle"
+	"coffeeco/internal/logging"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/subscription"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/transport/rpc"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// log.Print and slog both end up as redacted JSON lines from here on.
+	logger := logging.New(os.Stderr, cfg.Tunables.Level())
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-grpc")
+	if err != nil {
+		log.Fatal(err)
+	}
+	life := lifecycle.New(cfg.Drain())
+	life.Register(lifecycle.Flush, "traces", shutdownTracing)
+
+	csvc, err := payment.NewStripeService(cfg.StripeAPIKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	prepo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "purchases", prepo.Close)
+	sRepo, err := store.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "stores", sRepo.Close)
+	cards, err := loyalty.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "loyalty cards", cards.Close)
+	sSvc := store.NewService(sRepo)
+	stock, err := inventory.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "inventory", stock.Close)
+	invOpts := []inventory.Option{inventory.WithLogger(logger)}
+
+	opts := []purchase.Option{purchase.WithLogger(logger)}
+	pub, err := newEventPublisher(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if pub != nil {
+		life.Register(lifecycle.Flush, "event publisher", func(context.Context) error { return pub.Close() })
+		opts = append(opts, purchase.WithEventPublisher(pub))
+		invOpts = append(invOpts, inventory.WithEventPublisher(pub))
+	}
+	opts = append(opts, purchase.WithInventory(inventory.NewService(stock, cfg.Recipes, invOpts...)))
+	passes, err := subscription.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	life.Register(lifecycle.Close, "passes", passes.Close)
+	opts = append(opts, purchase.WithPasses(subscription.NewService(passes, csvc, cfg.Plans, subscription.WithLogger(logger))))
+	svc := purchase.NewService(csvc, prepo, sSvc, opts...)
+
+	srv, err := rpc.NewServer(svc, sSvc, cards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	gs := grpc.NewServer(grpc.UnaryInterceptor(correlation.UnaryServerInterceptor))
+	srv.Register(gs)
+
+	addr := cfg.GRPCAddr
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// GracefulStop waits for the calls in flight, purchases included; if they outlast the drain timeout
+	// they are cut off so the connections still get closed.
+	life.Register(lifecycle.Drain, "grpc server", func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			gs.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			gs.Stop()
+			return ctx.Err()
+		}
+	})
+	log.Printf("serving the coffeeco gRPC services on %s", addr)
+	go func() {
+		if err := gs.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	if err := life.WaitForSignal(ctx, os.Interrupt, syscall.SIGTERM); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type closablePublisher interface {
+	events.Publisher
+	Close() error
+}
+
+func newEventPublisher(transport, brokers string) (closablePublisher, error) {
+	switch transport {
+	case "":
+		return nil, nil
+	case "kafka":
+		return kafka.NewPublisher(strings.Split(brokers, ","), events.JSONCodec{})
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-grpc", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
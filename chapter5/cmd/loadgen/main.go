@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/loadgen"
+	"coffeeco/internal/payment"
+)
+
+const usage = `usage: loadgen -stores <id,...> [flags]
+
+Completes purchases sampled from a realistic mix against a running API and reports the throughput and
+latency of CompletePurchase. Run it against a staging API with Stripe's test key; every purchase is real.
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	addr := flag.String("addr", "http://localhost:8080", "base URL of the API")
+	stores := flag.String("stores", "", "comma separated IDs of the stores to buy from")
+	token := flag.String("token", os.Getenv("LOADGEN_TOKEN"), "bearer token, if the API authenticates callers")
+	duration := flag.Duration("duration", 30*time.Second, "how long to run")
+	purchases := flag.Int("purchases", 0, "stop after this many purchases, 0 to run for the duration")
+	concurrency := flag.Int("concurrency", 8, "purchases in flight at once")
+	rate := flag.Float64("rate", 0, "purchases started per second at most, 0 for as fast as they complete")
+	seed := flag.Uint64("seed", 1, "seed of the sampled purchases, the same seed makes the same purchases")
+	means := flag.String("means", "card=7,cash=3", "comma separated means=weight pairs of the payment means")
+	cards := flag.String("cards", "", "comma separated loyalty card IDs that pay for coffeebux purchases")
+	products := flag.String("products", "", "comma separated name=price pairs, prices in the currency's minor unit; default a coffee menu")
+	currency := flag.String("currency", loadgen.DefaultMix.Currency, "currency of the product prices")
+	pprofAddr := flag.String("pprof", "", "base URL of the API's pprof server, e.g. http://localhost:6060, to profile the API during the run")
+	cpuProfile := flag.String("cpuprofile", "cpu.pprof", "where the CPU profile of the API is written, with -pprof")
+	flag.Parse()
+
+	mix := loadgen.DefaultMix
+	mix.Currency = *currency
+	var err error
+	if mix.StoreIDs, err = parseIDs(*stores); err != nil {
+		log.Fatalf("invalid -stores: %v", err)
+	}
+	if mix.LoyaltyCards, err = parseIDs(*cards); err != nil {
+		log.Fatalf("invalid -cards: %v", err)
+	}
+	if mix.Means, err = parseMeans(*means); err != nil {
+		log.Fatalf("invalid -means: %v", err)
+	}
+	if *products != "" {
+		if mix.Products, err = parseProducts(*products); err != nil {
+			log.Fatalf("invalid -products: %v", err)
+		}
+	}
+	if err := mix.Validate(); err != nil {
+		flag.Usage()
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	profiled := make(chan error, 1)
+	if *pprofAddr != "" {
+		// The profile covers the run, less a second to be written before it ends.
+		seconds := max(int(duration.Seconds())-1, 1)
+		go func() { profiled <- profile(ctx, *pprofAddr, seconds, *cpuProfile) }()
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+	opts := loadgen.Options{Concurrency: *concurrency, Duration: *duration, Purchases: *purchases, Rate: *rate, Seed: *seed}
+	log.Printf("running %d purchases at once against %s for %s", *concurrency, *addr, *duration)
+	report, err := loadgen.Run(ctx, mix, opts, loadgen.HTTPTarget(client, strings.TrimSuffix(*addr, "/"), *token))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("purchases   %d in %s\n", report.Purchases, report.Elapsed.Round(time.Millisecond))
+	fmt.Printf("completed   %d (%.1f/s)\n", report.Completed, report.Throughput())
+	fmt.Printf("latency     p50 %s  p90 %s  p99 %s  max %s\n",
+		report.Latency(50).Round(time.Microsecond), report.Latency(90).Round(time.Microsecond),
+		report.Latency(99).Round(time.Microsecond), report.Latency(100).Round(time.Microsecond))
+	for failure, n := range report.Failures {
+		fmt.Printf("failed      %d × %s\n", n, failure)
+	}
+	if *pprofAddr != "" {
+		if err := <-profiled; err != nil {
+			log.Fatalf("failed to profile the API: %v", err)
+		}
+		fmt.Printf("cpu profile %s; go tool pprof -http :0 %s\n", *cpuProfile, *cpuProfile)
+	}
+}
+
+// profile writes a CPU profile of the API taken over seconds to path.
+func profile(ctx context.Context, pprofAddr string, seconds int, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/debug/pprof/profile?seconds=%d", strings.TrimSuffix(pprofAddr, "/"), seconds), nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("pprof answered %s", res.Status)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, res.Body); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func parseIDs(s string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an ID", v)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func parseMeans(s string) (map[payment.Means]int, error) {
+	means := map[payment.Means]int{}
+	for _, v := range strings.Split(s, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(v), "=")
+		w, err := strconv.Atoi(weight)
+		if !ok || err != nil || w < 0 {
+			return nil, fmt.Errorf("%q is not means=weight", v)
+		}
+		means[payment.Means(name)] = w
+	}
+	return means, nil
+}
+
+func parseProducts(s string) ([]loadgen.Product, error) {
+	var products []loadgen.Product
+	for _, v := range strings.Split(s, ",") {
+		name, price, ok := strings.Cut(v, "=")
+		amount, err := strconv.ParseInt(price, 10, 64)
+		if !ok || err != nil || amount <= 0 {
+			return nil, fmt.Errorf("%q is not name=price", v)
+		}
+		products = append(products, loadgen.Product{Name: strings.TrimSpace(name), Price: amount})
+	}
+	return products, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/consent"
+	"coffeeco/internal/customer"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/inbox"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/notifications"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/telemetry"
+)
+
+const usage = `usage: notifier <serve|show|choose|device|receipts> [flags]
+
+serve notifies customers of the purchase events on EVENT_TRANSPORT and EVENT_BROKERS, over the channels
+configured under notifications. The other commands manage a customer's preferences:
+
+  show      -customer <id>
+  choose    -customer <id> -topic <receipt|order_ready|points_expiring|offer> [-channels push,sms]
+            channels in order of preference; none opts the customer out of the topic. Offers are
+            marketing, only sent on the channels the customer consented to
+  device    -customer <id> -token <push token> [-remove]
+  receipts  -customer <id> -profile <standard|large_print|plain_text>
+            how emailed receipts are laid out; plain_text reads well with a screen reader
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	customerID := fs.String("customer", "", "customer ID")
+	topic := fs.String("topic", "", "choose: what the notifications are about")
+	channels := fs.String("channels", "", "choose: comma separated channels, most preferred first")
+	token := fs.String("token", "", "device: push token the customer's app registered")
+	remove := fs.Bool("remove", false, "device: stop pushing to the device")
+	profile := fs.String("profile", "", "receipts: how emailed receipts are laid out")
+	_ = fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-notifier")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc, err := newService(ctx, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cmd == "serve" {
+		if err := serve(ctx, svc, cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	id, err := uuid.Parse(*customerID)
+	if err != nil {
+		log.Fatalf("invalid customer ID: %v", err)
+	}
+	var p *notifications.Preferences
+	switch cmd {
+	case "show":
+		p, err = svc.Preferences(ctx, id)
+	case "choose":
+		var chs []notifications.Channel
+		if *channels != "" {
+			for _, c := range strings.Split(*channels, ",") {
+				chs = append(chs, notifications.Channel(strings.TrimSpace(c)))
+			}
+		}
+		p, err = svc.Choose(ctx, id, notifications.Topic(*topic), chs...)
+	case "device":
+		if *remove {
+			p, err = svc.RemovePushToken(ctx, id, *token)
+		} else {
+			p, err = svc.AddPushToken(ctx, id, *token)
+		}
+	case "receipts":
+		p, err = svc.ChooseReceiptProfile(ctx, id, receipt.Profile(*profile))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := show(p); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newService(ctx context.Context, cfg config.Config) (*notifications.Service, error) {
+	repo, err := notifications.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	customers, err := customer.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := consent.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		return nil, err
+	}
+	opts := []notifications.Option{notifications.WithConsents(consent.NewService(consents))}
+	n := cfg.Notifications
+	if n.SMTP.Addr != "" {
+		smtp, err := notifications.NewSMTP(n.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notifications.WithNotifier(notifications.ChannelEmail, smtp))
+	}
+	if n.SMS.AccountSID != "" {
+		twilio, err := notifications.NewTwilio(n.SMS, nil)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notifications.WithNotifier(notifications.ChannelSMS, twilio))
+	}
+	if n.Push.CredentialsFile != "" {
+		fcm, err := notifications.NewFCM(n.Push, nil)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, notifications.WithNotifier(notifications.ChannelPush, fcm))
+	}
+	if n.Locale != "" {
+		loc, _ := moneyfmt.LocaleFor(n.Locale)
+		opts = append(opts, notifications.WithLocale(loc))
+	}
+	if l := cfg.Localizer(); l != nil {
+		opts = append(opts, notifications.WithLocalizer(l))
+	}
+	return notifications.NewService(repo, customer.NewService(customers), opts...), nil
+}
+
+func serve(ctx context.Context, svc *notifications.Service, cfg config.Config) error {
+	sub, err := newEventSubscriber(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		return err
+	}
+	dlq, err := deadletter.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	// A provider that stays down for longer than the retries ends up in the dead letters.
+	dlqSub, err := deadletter.NewSubscriber(sub, dlq, "coffeeco-notifications", 3)
+	if err != nil {
+		return err
+	}
+	processed, err := inbox.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	log.Println("notifying customers")
+	// Completed purchases and status changes share the purchase topic.
+	return dlqSub.Subscribe(ctx, events.TopicFor(purchase.EventTypeCompleted), inbox.Idempotent(processed, "notifications", svc.Handle))
+}
+
+func show(p *notifications.Preferences) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tCHANNELS")
+	for _, t := range notifications.Topics {
+		var chs []string
+		for _, c := range p.ChannelsFor(t) {
+			chs = append(chs, string(c))
+		}
+		if len(chs) == 0 {
+			chs = []string{"(opted out)"}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", t, strings.Join(chs, ","))
+	}
+	fmt.Fprintf(w, "\nDEVICES\t%d\n", len(p.PushTokens))
+	receipts := p.ReceiptProfile
+	if receipts == "" {
+		receipts = receipt.ProfileStandard
+	}
+	fmt.Fprintf(w, "RECEIPTS\t%s\n", receipts)
+	return w.Flush()
+}
+
+func newEventSubscriber(transport, brokers string) (events.Subscriber, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewSubscriber(strings.Split(brokers, ","), "coffeeco-notifications")
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-notifications", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
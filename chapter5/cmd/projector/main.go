@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/compliance"
+	"coffeeco/internal/config"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/inbox"
+	"coffeeco/internal/incentives"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/telemetry"
+)
+
+func main() {
+	rebuild := flag.Bool("rebuild", false, "drop the read models and rebuild them from stored purchases, then exit")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-projector")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rm, err := projection.NewMongoReadModels(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	processed, err := inbox.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	facts, err := analytics.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sales, err := incentives.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cash, err := compliance.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// The analytics facts, incentive sales and cash transactions are keyed by event, so they do not need
+	// the inbox.
+	projections := append(projection.Idempotent(processed, rm.All()...), analytics.NewFacts(facts), incentives.NewAttribution(sales), compliance.NewLedger(cash))
+
+	if *rebuild {
+		prepo, err := purchase.NewMongoRepo(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		adjustments, err := adjustment.NewMongoRepo(ctx, cfg.MongoURI)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Adjustments are replayed after every purchase, so each finds the sale it corrects.
+		history := projection.SourceFunc(func(ctx context.Context, h events.Handler) error {
+			if err := prepo.Replay(ctx, h); err != nil {
+				return err
+			}
+			return adjustments.Replay(ctx, h)
+		})
+		if err := projection.Rebuild(ctx, history, projections...); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("read models rebuilt")
+		return
+	}
+
+	sub, err := newEventSubscriber(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dlq, err := deadletter.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Events a projection keeps failing on are parked for inspection and redrive with cmd/dlq.
+	dlqSub, err := deadletter.NewSubscriber(sub, dlq, "coffeeco-projector", 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w, err := projection.NewWorker(dlqSub, projections...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("projecting events")
+	if err := w.Run(ctx, events.TopicFor(purchase.EventTypeCompleted), events.TopicFor(loyalty.EventTypeStampAdded), events.TopicFor(adjustment.EventTypeRecorded)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newEventSubscriber(transport, brokers string) (events.Subscriber, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewSubscriber(strings.Split(brokers, ","), "coffeeco-projector")
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-projector", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sync/errgroup"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/warehouse"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-warehouse")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer, err := newWriter(cfg.Warehouse)
+	if err != nil {
+		log.Fatal(err)
+	}
+	staging, err := warehouse.NewMongoStaging(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	sink := warehouse.NewSink(staging, writer, warehouse.WithTable(cfg.Warehouse.Table), warehouse.WithBatchSize(cfg.Warehouse.BatchSize))
+	if err := sink.EnsureTable(ctx); err != nil {
+		log.Fatal(err)
+	}
+
+	sub, err := newEventSubscriber(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dlq, err := deadletter.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Events are only staged as they arrive, so just those that cannot be read end up in the dead letters.
+	dlqSub, err := deadletter.NewSubscriber(sub, dlq, "coffeeco-warehouse", 3)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("exporting purchases to %s table %s", cfg.Warehouse.Writer, cfg.Warehouse.Table)
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return dlqSub.Subscribe(gctx, events.TopicFor(purchase.EventTypeCompleted), sink.Handle)
+	})
+	g.Go(func() error {
+		sink.Run(gctx, cfg.WarehouseEvery())
+		return nil
+	})
+	if err := g.Wait(); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+func newWriter(cfg config.Warehouse) (warehouse.Writer, error) {
+	switch cfg.Writer {
+	case "bigquery":
+		return warehouse.NewBigQuery(cfg.BigQuery, nil)
+	case "snowflake":
+		return warehouse.NewSnowflake(cfg.Snowflake, nil), nil
+	default:
+		return nil, fmt.Errorf("set warehouse.writer to bigquery or snowflake to export purchases, not %q", cfg.Writer)
+	}
+}
+
+func newEventSubscriber(transport, brokers string) (events.Subscriber, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewSubscriber(strings.Split(brokers, ","), "coffeeco-warehouse")
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-warehouse", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
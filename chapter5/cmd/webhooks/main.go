@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/events/nats"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/webhook"
+)
+
+const usage = `usage: webhooks <serve|add|remove|list|attempts> [flags]
+
+serve delivers events from EVENT_TRANSPORT and EVENT_BROKERS to the registered partner webhooks.
+The other commands manage subscriptions and show delivery attempts.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	partner := fs.String("partner", "", "add: name of the partner")
+	url := fs.String("url", "", "add: URL events are POSTed to")
+	types := fs.String("types", "", "add: comma separated event types, empty for all")
+	id := fs.String("id", "", "remove, attempts: subscription ID")
+	eventID := fs.String("event", "", "attempts: only attempts for this event ID")
+	failed := fs.Bool("failed", false, "attempts: only failed attempts")
+	_ = fs.Parse(os.Args[2:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shutdownTracing, err := telemetry.Setup(ctx, "coffeeco-webhooks")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	repo, err := webhook.NewMongoRepo(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd {
+	case "serve":
+		err = serve(ctx, repo, cfg)
+	case "add":
+		err = add(ctx, repo, *partner, *url, *types)
+	case "remove":
+		var subID uuid.UUID
+		if subID, err = uuid.Parse(*id); err == nil {
+			err = repo.RemoveSubscription(ctx, subID)
+		}
+	case "list":
+		err = list(ctx, repo)
+	case "attempts":
+		var f webhook.AttemptFilter
+		f.FailedOnly = *failed
+		if *id != "" {
+			if f.SubscriptionID, err = uuid.Parse(*id); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *eventID != "" {
+			if f.EventID, err = uuid.Parse(*eventID); err != nil {
+				log.Fatal(err)
+			}
+		}
+		err = attempts(ctx, repo, f)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serve(ctx context.Context, repo webhook.Repository, cfg config.Config) error {
+	sub, err := newEventSubscriber(cfg.EventTransport, cfg.EventBrokers)
+	if err != nil {
+		return err
+	}
+	dlq, err := deadletter.NewMongoStore(ctx, cfg.MongoURI)
+	if err != nil {
+		return err
+	}
+	// A partner that stays down for longer than the dispatcher's retries ends up in the dead letters.
+	dlqSub, err := deadletter.NewSubscriber(sub, dlq, "coffeeco-webhooks", 3)
+	if err != nil {
+		return err
+	}
+	d, err := webhook.NewDispatcher(repo, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Println("delivering webhooks")
+	g, ctx := errgroup.WithContext(ctx)
+	for _, topic := range []string{events.TopicFor(purchase.EventTypeCompleted), events.TopicFor(loyalty.EventTypeStampAdded)} {
+		g.Go(func() error { return dlqSub.Subscribe(ctx, topic, d.Handle) })
+	}
+	return g.Wait()
+}
+
+func add(ctx context.Context, repo webhook.Repository, partner, url, types string) error {
+	if partner == "" || url == "" {
+		return fmt.Errorf("add needs -partner and -url")
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	s := webhook.Subscription{
+		ID:        uuid.New(),
+		Partner:   partner,
+		URL:       url,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+	if types != "" {
+		s.EventTypes = strings.Split(types, ",")
+	}
+	if err := repo.AddSubscription(ctx, s); err != nil {
+		return err
+	}
+	fmt.Printf("subscription %s\nsigning secret %s\n", s.ID, s.Secret)
+	return nil
+}
+
+func list(ctx context.Context, repo webhook.Repository) error {
+	subs, err := repo.Subscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPARTNER\tURL\tEVENT TYPES")
+	for _, s := range subs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.ID, s.Partner, s.URL, strings.Join(s.EventTypes, ","))
+	}
+	return w.Flush()
+}
+
+func attempts(ctx context.Context, repo webhook.Repository, f webhook.AttemptFilter) error {
+	as, err := repo.Attempts(ctx, f)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ATTEMPTED AT\tSUBSCRIPTION\tEVENT\tTYPE\t#\tSTATUS\tDURATION\tERROR")
+	for _, a := range as {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			a.AttemptedAt.Format(time.RFC3339), a.SubscriptionID, a.EventID, a.EventType, a.Number,
+			a.StatusCode, a.Duration.Round(time.Millisecond), a.Error)
+	}
+	return w.Flush()
+}
+
+func newEventSubscriber(transport, brokers string) (events.Subscriber, error) {
+	switch transport {
+	case "kafka":
+		return kafka.NewSubscriber(strings.Split(brokers, ","), "coffeeco-webhooks")
+	case "nats":
+		return nats.NewJetStream(brokers, "coffeeco-webhooks", events.JSONCodec{})
+	default:
+		return nil, fmt.Errorf("unknown event transport %q", transport)
+	}
+}
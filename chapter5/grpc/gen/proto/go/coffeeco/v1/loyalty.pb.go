@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: coffeeco/v1/loyalty.proto
+
+package coffeecov1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetBalanceRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CardId        string                 `protobuf:"bytes,1,opt,name=card_id,json=cardId,proto3" json:"card_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetBalanceRequest) Reset() {
+	*x = GetBalanceRequest{}
+	mi := &file_coffeeco_v1_loyalty_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBalanceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBalanceRequest) ProtoMessage() {}
+
+func (x *GetBalanceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_loyalty_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBalanceRequest.ProtoReflect.Descriptor instead.
+func (*GetBalanceRequest) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_loyalty_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetBalanceRequest) GetCardId() string {
+	if x != nil {
+		return x.CardId
+	}
+	return ""
+}
+
+type GetBalanceResponse struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	CardId                  string                 `protobuf:"bytes,1,opt,name=card_id,json=cardId,proto3" json:"card_id,omitempty"`
+	CustomerId              string                 `protobuf:"bytes,2,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	StoreId                 string                 `protobuf:"bytes,3,opt,name=store_id,json=storeId,proto3" json:"store_id,omitempty"`
+	FreeDrinksAvailable     int32                  `protobuf:"varint,4,opt,name=free_drinks_available,json=freeDrinksAvailable,proto3" json:"free_drinks_available,omitempty"`
+	PurchasesUntilFreeDrink int32                  `protobuf:"varint,5,opt,name=purchases_until_free_drink,json=purchasesUntilFreeDrink,proto3" json:"purchases_until_free_drink,omitempty"`
+	unknownFields           protoimpl.UnknownFields
+	sizeCache               protoimpl.SizeCache
+}
+
+func (x *GetBalanceResponse) Reset() {
+	*x = GetBalanceResponse{}
+	mi := &file_coffeeco_v1_loyalty_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetBalanceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBalanceResponse) ProtoMessage() {}
+
+func (x *GetBalanceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_loyalty_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBalanceResponse.ProtoReflect.Descriptor instead.
+func (*GetBalanceResponse) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_loyalty_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetBalanceResponse) GetCardId() string {
+	if x != nil {
+		return x.CardId
+	}
+	return ""
+}
+
+func (x *GetBalanceResponse) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *GetBalanceResponse) GetStoreId() string {
+	if x != nil {
+		return x.StoreId
+	}
+	return ""
+}
+
+func (x *GetBalanceResponse) GetFreeDrinksAvailable() int32 {
+	if x != nil {
+		return x.FreeDrinksAvailable
+	}
+	return 0
+}
+
+func (x *GetBalanceResponse) GetPurchasesUntilFreeDrink() int32 {
+	if x != nil {
+		return x.PurchasesUntilFreeDrink
+	}
+	return 0
+}
+
+var File_coffeeco_v1_loyalty_proto protoreflect.FileDescriptor
+
+const file_coffeeco_v1_loyalty_proto_rawDesc = "" +
+	"\n" +
+	"\x19coffeeco/v1/loyalty.proto\x12\vcoffeeco.v1\",\n" +
+	"\x11GetBalanceRequest\x12\x17\n" +
+	"\acard_id\x18\x01 \x01(\tR\x06cardId\"\xda\x01\n" +
+	"\x12GetBalanceResponse\x12\x17\n" +
+	"\acard_id\x18\x01 \x01(\tR\x06cardId\x12\x1f\n" +
+	"\vcustomer_id\x18\x02 \x01(\tR\n" +
+	"customerId\x12\x19\n" +
+	"\bstore_id\x18\x03 \x01(\tR\astoreId\x122\n" +
+	"\x15free_drinks_available\x18\x04 \x01(\x05R\x13freeDrinksAvailable\x12;\n" +
+	"\x1apurchases_until_free_drink\x18\x05 \x01(\x05R\x17purchasesUntilFreeDrink2a\n" +
+	"\x0eLoyaltyService\x12O\n" +
+	"\n" +
+	"GetBalance\x12\x1e.coffeeco.v1.GetBalanceRequest\x1a\x1f.coffeeco.v1.GetBalanceResponse\"\x00B3Z1coffeeco/grpc/gen/proto/go/coffeeco/v1;coffeecov1b\x06proto3"
+
+var (
+	file_coffeeco_v1_loyalty_proto_rawDescOnce sync.Once
+	file_coffeeco_v1_loyalty_proto_rawDescData []byte
+)
+
+func file_coffeeco_v1_loyalty_proto_rawDescGZIP() []byte {
+	file_coffeeco_v1_loyalty_proto_rawDescOnce.Do(func() {
+		file_coffeeco_v1_loyalty_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_coffeeco_v1_loyalty_proto_rawDesc), len(file_coffeeco_v1_loyalty_proto_rawDesc)))
+	})
+	return file_coffeeco_v1_loyalty_proto_rawDescData
+}
+
+var file_coffeeco_v1_loyalty_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_coffeeco_v1_loyalty_proto_goTypes = []any{
+	(*GetBalanceRequest)(nil),  // 0: coffeeco.v1.GetBalanceRequest
+	(*GetBalanceResponse)(nil), // 1: coffeeco.v1.GetBalanceResponse
+}
+var file_coffeeco_v1_loyalty_proto_depIdxs = []int32{
+	0, // 0: coffeeco.v1.LoyaltyService.GetBalance:input_type -> coffeeco.v1.GetBalanceRequest
+	1, // 1: coffeeco.v1.LoyaltyService.GetBalance:output_type -> coffeeco.v1.GetBalanceResponse
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_coffeeco_v1_loyalty_proto_init() }
+func file_coffeeco_v1_loyalty_proto_init() {
+	if File_coffeeco_v1_loyalty_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_coffeeco_v1_loyalty_proto_rawDesc), len(file_coffeeco_v1_loyalty_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_coffeeco_v1_loyalty_proto_goTypes,
+		DependencyIndexes: file_coffeeco_v1_loyalty_proto_depIdxs,
+		MessageInfos:      file_coffeeco_v1_loyalty_proto_msgTypes,
+	}.Build()
+	File_coffeeco_v1_loyalty_proto = out.File
+	file_coffeeco_v1_loyalty_proto_goTypes = nil
+	file_coffeeco_v1_loyalty_proto_depIdxs = nil
+}
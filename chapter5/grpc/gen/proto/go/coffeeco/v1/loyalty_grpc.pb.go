@@ -0,0 +1,125 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: coffeeco/v1/loyalty.proto
+
+package coffeecov1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	LoyaltyService_GetBalance_FullMethodName = "/coffeeco.v1.LoyaltyService/GetBalance"
+)
+
+// LoyaltyServiceClient is the client API for LoyaltyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// The Loyalty service exposes CoffeeBux cards.
+type LoyaltyServiceClient interface {
+	// Get how many free drinks a card has and how far it is from the next one.
+	GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error)
+}
+
+type loyaltyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLoyaltyServiceClient(cc grpc.ClientConnInterface) LoyaltyServiceClient {
+	return &loyaltyServiceClient{cc}
+}
+
+func (c *loyaltyServiceClient) GetBalance(ctx context.Context, in *GetBalanceRequest, opts ...grpc.CallOption) (*GetBalanceResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetBalanceResponse)
+	err := c.cc.Invoke(ctx, LoyaltyService_GetBalance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LoyaltyServiceServer is the server API for LoyaltyService service.
+// All implementations should embed UnimplementedLoyaltyServiceServer
+// for forward compatibility.
+//
+// The Loyalty service exposes CoffeeBux cards.
+type LoyaltyServiceServer interface {
+	// Get how many free drinks a card has and how far it is from the next one.
+	GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error)
+}
+
+// UnimplementedLoyaltyServiceServer should be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedLoyaltyServiceServer struct{}
+
+func (UnimplementedLoyaltyServiceServer) GetBalance(context.Context, *GetBalanceRequest) (*GetBalanceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetBalance not implemented")
+}
+func (UnimplementedLoyaltyServiceServer) testEmbeddedByValue() {}
+
+// UnsafeLoyaltyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LoyaltyServiceServer will
+// result in compilation errors.
+type UnsafeLoyaltyServiceServer interface {
+	mustEmbedUnimplementedLoyaltyServiceServer()
+}
+
+func RegisterLoyaltyServiceServer(s grpc.ServiceRegistrar, srv LoyaltyServiceServer) {
+	// If the following call panics, it indicates UnimplementedLoyaltyServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&LoyaltyService_ServiceDesc, srv)
+}
+
+func _LoyaltyService_GetBalance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBalanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LoyaltyServiceServer).GetBalance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LoyaltyService_GetBalance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LoyaltyServiceServer).GetBalance(ctx, req.(*GetBalanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LoyaltyService_ServiceDesc is the grpc.ServiceDesc for LoyaltyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LoyaltyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "coffeeco.v1.LoyaltyService",
+	HandlerType: (*LoyaltyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetBalance",
+			Handler:    _LoyaltyService_GetBalance_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "coffeeco/v1/loyalty.proto",
+}
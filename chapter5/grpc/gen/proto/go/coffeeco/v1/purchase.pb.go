@@ -0,0 +1,495 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: coffeeco/v1/purchase.proto
+
+package coffeecov1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PaymentMeans int32
+
+const (
+	PaymentMeans_PAYMENT_MEANS_UNSPECIFIED PaymentMeans = 0
+	PaymentMeans_PAYMENT_MEANS_CARD        PaymentMeans = 1
+	PaymentMeans_PAYMENT_MEANS_CASH        PaymentMeans = 2
+	PaymentMeans_PAYMENT_MEANS_COFFEEBUX   PaymentMeans = 3
+)
+
+// Enum value maps for PaymentMeans.
+var (
+	PaymentMeans_name = map[int32]string{
+		0: "PAYMENT_MEANS_UNSPECIFIED",
+		1: "PAYMENT_MEANS_CARD",
+		2: "PAYMENT_MEANS_CASH",
+		3: "PAYMENT_MEANS_COFFEEBUX",
+	}
+	PaymentMeans_value = map[string]int32{
+		"PAYMENT_MEANS_UNSPECIFIED": 0,
+		"PAYMENT_MEANS_CARD":        1,
+		"PAYMENT_MEANS_CASH":        2,
+		"PAYMENT_MEANS_COFFEEBUX":   3,
+	}
+)
+
+func (x PaymentMeans) Enum() *PaymentMeans {
+	p := new(PaymentMeans)
+	*p = x
+	return p
+}
+
+func (x PaymentMeans) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PaymentMeans) Descriptor() protoreflect.EnumDescriptor {
+	return file_coffeeco_v1_purchase_proto_enumTypes[0].Descriptor()
+}
+
+func (PaymentMeans) Type() protoreflect.EnumType {
+	return &file_coffeeco_v1_purchase_proto_enumTypes[0]
+}
+
+func (x PaymentMeans) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PaymentMeans.Descriptor instead.
+func (PaymentMeans) EnumDescriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{0}
+}
+
+type Receipt struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	PurchaseId string                 `protobuf:"bytes,1,opt,name=purchase_id,json=purchaseId,proto3" json:"purchase_id,omitempty"`
+	StoreId    string                 `protobuf:"bytes,2,opt,name=store_id,json=storeId,proto3" json:"store_id,omitempty"`
+	// Empty for anonymous purchases.
+	CustomerId    string                 `protobuf:"bytes,3,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	Items         []*Item                `protobuf:"bytes,4,rep,name=items,proto3" json:"items,omitempty"`
+	Total         *Money                 `protobuf:"bytes,5,opt,name=total,proto3" json:"total,omitempty"`
+	PaymentMeans  PaymentMeans           `protobuf:"varint,6,opt,name=payment_means,json=paymentMeans,proto3,enum=coffeeco.v1.PaymentMeans" json:"payment_means,omitempty"`
+	PurchasedAt   *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=purchased_at,json=purchasedAt,proto3" json:"purchased_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Receipt) Reset() {
+	*x = Receipt{}
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Receipt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Receipt) ProtoMessage() {}
+
+func (x *Receipt) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Receipt.ProtoReflect.Descriptor instead.
+func (*Receipt) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Receipt) GetPurchaseId() string {
+	if x != nil {
+		return x.PurchaseId
+	}
+	return ""
+}
+
+func (x *Receipt) GetStoreId() string {
+	if x != nil {
+		return x.StoreId
+	}
+	return ""
+}
+
+func (x *Receipt) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *Receipt) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+func (x *Receipt) GetTotal() *Money {
+	if x != nil {
+		return x.Total
+	}
+	return nil
+}
+
+func (x *Receipt) GetPaymentMeans() PaymentMeans {
+	if x != nil {
+		return x.PaymentMeans
+	}
+	return PaymentMeans_PAYMENT_MEANS_UNSPECIFIED
+}
+
+func (x *Receipt) GetPurchasedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.PurchasedAt
+	}
+	return nil
+}
+
+type CreatePurchaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StoreId       string                 `protobuf:"bytes,1,opt,name=store_id,json=storeId,proto3" json:"store_id,omitempty"`
+	CustomerId    string                 `protobuf:"bytes,2,opt,name=customer_id,json=customerId,proto3" json:"customer_id,omitempty"`
+	LoyaltyCardId string                 `protobuf:"bytes,3,opt,name=loyalty_card_id,json=loyaltyCardId,proto3" json:"loyalty_card_id,omitempty"`
+	PaymentMeans  PaymentMeans           `protobuf:"varint,4,opt,name=payment_means,json=paymentMeans,proto3,enum=coffeeco.v1.PaymentMeans" json:"payment_means,omitempty"`
+	CardToken     string                 `protobuf:"bytes,5,opt,name=card_token,json=cardToken,proto3" json:"card_token,omitempty"`
+	Items         []*Item                `protobuf:"bytes,6,rep,name=items,proto3" json:"items,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePurchaseRequest) Reset() {
+	*x = CreatePurchaseRequest{}
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePurchaseRequest) ProtoMessage() {}
+
+func (x *CreatePurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePurchaseRequest.ProtoReflect.Descriptor instead.
+func (*CreatePurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CreatePurchaseRequest) GetStoreId() string {
+	if x != nil {
+		return x.StoreId
+	}
+	return ""
+}
+
+func (x *CreatePurchaseRequest) GetCustomerId() string {
+	if x != nil {
+		return x.CustomerId
+	}
+	return ""
+}
+
+func (x *CreatePurchaseRequest) GetLoyaltyCardId() string {
+	if x != nil {
+		return x.LoyaltyCardId
+	}
+	return ""
+}
+
+func (x *CreatePurchaseRequest) GetPaymentMeans() PaymentMeans {
+	if x != nil {
+		return x.PaymentMeans
+	}
+	return PaymentMeans_PAYMENT_MEANS_UNSPECIFIED
+}
+
+func (x *CreatePurchaseRequest) GetCardToken() string {
+	if x != nil {
+		return x.CardToken
+	}
+	return ""
+}
+
+func (x *CreatePurchaseRequest) GetItems() []*Item {
+	if x != nil {
+		return x.Items
+	}
+	return nil
+}
+
+type CreatePurchaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Receipt       *Receipt               `protobuf:"bytes,1,opt,name=receipt,proto3" json:"receipt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreatePurchaseResponse) Reset() {
+	*x = CreatePurchaseResponse{}
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreatePurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreatePurchaseResponse) ProtoMessage() {}
+
+func (x *CreatePurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreatePurchaseResponse.ProtoReflect.Descriptor instead.
+func (*CreatePurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CreatePurchaseResponse) GetReceipt() *Receipt {
+	if x != nil {
+		return x.Receipt
+	}
+	return nil
+}
+
+type GetPurchaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	PurchaseId    string                 `protobuf:"bytes,1,opt,name=purchase_id,json=purchaseId,proto3" json:"purchase_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPurchaseRequest) Reset() {
+	*x = GetPurchaseRequest{}
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPurchaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPurchaseRequest) ProtoMessage() {}
+
+func (x *GetPurchaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPurchaseRequest.ProtoReflect.Descriptor instead.
+func (*GetPurchaseRequest) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetPurchaseRequest) GetPurchaseId() string {
+	if x != nil {
+		return x.PurchaseId
+	}
+	return ""
+}
+
+type GetPurchaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Receipt       *Receipt               `protobuf:"bytes,1,opt,name=receipt,proto3" json:"receipt,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPurchaseResponse) Reset() {
+	*x = GetPurchaseResponse{}
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPurchaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPurchaseResponse) ProtoMessage() {}
+
+func (x *GetPurchaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_purchase_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPurchaseResponse.ProtoReflect.Descriptor instead.
+func (*GetPurchaseResponse) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_purchase_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetPurchaseResponse) GetReceipt() *Receipt {
+	if x != nil {
+		return x.Receipt
+	}
+	return nil
+}
+
+var File_coffeeco_v1_purchase_proto protoreflect.FileDescriptor
+
+const file_coffeeco_v1_purchase_proto_rawDesc = "" +
+	"\n" +
+	"\x1acoffeeco/v1/purchase.proto\x12\vcoffeeco.v1\x1a\x18coffeeco/v1/common.proto\x1a\x1fgoogle/protobuf/timestamp.proto\"\xb8\x02\n" +
+	"\aReceipt\x12\x1f\n" +
+	"\vpurchase_id\x18\x01 \x01(\tR\n" +
+	"purchaseId\x12\x19\n" +
+	"\bstore_id\x18\x02 \x01(\tR\astoreId\x12\x1f\n" +
+	"\vcustomer_id\x18\x03 \x01(\tR\n" +
+	"customerId\x12'\n" +
+	"\x05items\x18\x04 \x03(\v2\x11.coffeeco.v1.ItemR\x05items\x12(\n" +
+	"\x05total\x18\x05 \x01(\v2\x12.coffeeco.v1.MoneyR\x05total\x12>\n" +
+	"\rpayment_means\x18\x06 \x01(\x0e2\x19.coffeeco.v1.PaymentMeansR\fpaymentMeans\x12=\n" +
+	"\fpurchased_at\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\vpurchasedAt\"\x83\x02\n" +
+	"\x15CreatePurchaseRequest\x12\x19\n" +
+	"\bstore_id\x18\x01 \x01(\tR\astoreId\x12\x1f\n" +
+	"\vcustomer_id\x18\x02 \x01(\tR\n" +
+	"customerId\x12&\n" +
+	"\x0floyalty_card_id\x18\x03 \x01(\tR\rloyaltyCardId\x12>\n" +
+	"\rpayment_means\x18\x04 \x01(\x0e2\x19.coffeeco.v1.PaymentMeansR\fpaymentMeans\x12\x1d\n" +
+	"\n" +
+	"card_token\x18\x05 \x01(\tR\tcardToken\x12'\n" +
+	"\x05items\x18\x06 \x03(\v2\x11.coffeeco.v1.ItemR\x05items\"H\n" +
+	"\x16CreatePurchaseResponse\x12.\n" +
+	"\areceipt\x18\x01 \x01(\v2\x14.coffeeco.v1.ReceiptR\areceipt\"5\n" +
+	"\x12GetPurchaseRequest\x12\x1f\n" +
+	"\vpurchase_id\x18\x01 \x01(\tR\n" +
+	"purchaseId\"E\n" +
+	"\x13GetPurchaseResponse\x12.\n" +
+	"\areceipt\x18\x01 \x01(\v2\x14.coffeeco.v1.ReceiptR\areceipt*z\n" +
+	"\fPaymentMeans\x12\x1d\n" +
+	"\x19PAYMENT_MEANS_UNSPECIFIED\x10\x00\x12\x16\n" +
+	"\x12PAYMENT_MEANS_CARD\x10\x01\x12\x16\n" +
+	"\x12PAYMENT_MEANS_CASH\x10\x02\x12\x1b\n" +
+	"\x17PAYMENT_MEANS_COFFEEBUX\x10\x032\xc2\x01\n" +
+	"\x0fPurchaseService\x12[\n" +
+	"\x0eCreatePurchase\x12\".coffeeco.v1.CreatePurchaseRequest\x1a#.coffeeco.v1.CreatePurchaseResponse\"\x00\x12R\n" +
+	"\vGetPurchase\x12\x1f.coffeeco.v1.GetPurchaseRequest\x1a .coffeeco.v1.GetPurchaseResponse\"\x00B3Z1coffeeco/grpc/gen/proto/go/coffeeco/v1;coffeecov1b\x06proto3"
+
+var (
+	file_coffeeco_v1_purchase_proto_rawDescOnce sync.Once
+	file_coffeeco_v1_purchase_proto_rawDescData []byte
+)
+
+func file_coffeeco_v1_purchase_proto_rawDescGZIP() []byte {
+	file_coffeeco_v1_purchase_proto_rawDescOnce.Do(func() {
+		file_coffeeco_v1_purchase_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_coffeeco_v1_purchase_proto_rawDesc), len(file_coffeeco_v1_purchase_proto_rawDesc)))
+	})
+	return file_coffeeco_v1_purchase_proto_rawDescData
+}
+
+var file_coffeeco_v1_purchase_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_coffeeco_v1_purchase_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_coffeeco_v1_purchase_proto_goTypes = []any{
+	(PaymentMeans)(0),              // 0: coffeeco.v1.PaymentMeans
+	(*Receipt)(nil),                // 1: coffeeco.v1.Receipt
+	(*CreatePurchaseRequest)(nil),  // 2: coffeeco.v1.CreatePurchaseRequest
+	(*CreatePurchaseResponse)(nil), // 3: coffeeco.v1.CreatePurchaseResponse
+	(*GetPurchaseRequest)(nil),     // 4: coffeeco.v1.GetPurchaseRequest
+	(*GetPurchaseResponse)(nil),    // 5: coffeeco.v1.GetPurchaseResponse
+	(*Item)(nil),                   // 6: coffeeco.v1.Item
+	(*Money)(nil),                  // 7: coffeeco.v1.Money
+	(*timestamppb.Timestamp)(nil),  // 8: google.protobuf.Timestamp
+}
+var file_coffeeco_v1_purchase_proto_depIdxs = []int32{
+	6,  // 0: coffeeco.v1.Receipt.items:type_name -> coffeeco.v1.Item
+	7,  // 1: coffeeco.v1.Receipt.total:type_name -> coffeeco.v1.Money
+	0,  // 2: coffeeco.v1.Receipt.payment_means:type_name -> coffeeco.v1.PaymentMeans
+	8,  // 3: coffeeco.v1.Receipt.purchased_at:type_name -> google.protobuf.Timestamp
+	0,  // 4: coffeeco.v1.CreatePurchaseRequest.payment_means:type_name -> coffeeco.v1.PaymentMeans
+	6,  // 5: coffeeco.v1.CreatePurchaseRequest.items:type_name -> coffeeco.v1.Item
+	1,  // 6: coffeeco.v1.CreatePurchaseResponse.receipt:type_name -> coffeeco.v1.Receipt
+	1,  // 7: coffeeco.v1.GetPurchaseResponse.receipt:type_name -> coffeeco.v1.Receipt
+	2,  // 8: coffeeco.v1.PurchaseService.CreatePurchase:input_type -> coffeeco.v1.CreatePurchaseRequest
+	4,  // 9: coffeeco.v1.PurchaseService.GetPurchase:input_type -> coffeeco.v1.GetPurchaseRequest
+	3,  // 10: coffeeco.v1.PurchaseService.CreatePurchase:output_type -> coffeeco.v1.CreatePurchaseResponse
+	5,  // 11: coffeeco.v1.PurchaseService.GetPurchase:output_type -> coffeeco.v1.GetPurchaseResponse
+	10, // [10:12] is the sub-list for method output_type
+	8,  // [8:10] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
+}
+
+func init() { file_coffeeco_v1_purchase_proto_init() }
+func file_coffeeco_v1_purchase_proto_init() {
+	if File_coffeeco_v1_purchase_proto != nil {
+		return
+	}
+	file_coffeeco_v1_common_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_coffeeco_v1_purchase_proto_rawDesc), len(file_coffeeco_v1_purchase_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_coffeeco_v1_purchase_proto_goTypes,
+		DependencyIndexes: file_coffeeco_v1_purchase_proto_depIdxs,
+		EnumInfos:         file_coffeeco_v1_purchase_proto_enumTypes,
+		MessageInfos:      file_coffeeco_v1_purchase_proto_msgTypes,
+	}.Build()
+	File_coffeeco_v1_purchase_proto = out.File
+	file_coffeeco_v1_purchase_proto_goTypes = nil
+	file_coffeeco_v1_purchase_proto_depIdxs = nil
+}
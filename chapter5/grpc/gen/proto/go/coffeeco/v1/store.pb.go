@@ -0,0 +1,234 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: coffeeco/v1/store.proto
+
+package coffeecov1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Store struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Location      string                 `protobuf:"bytes,2,opt,name=location,proto3" json:"location,omitempty"`
+	Products      []*Item                `protobuf:"bytes,3,rep,name=products,proto3" json:"products,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Store) Reset() {
+	*x = Store{}
+	mi := &file_coffeeco_v1_store_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Store) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Store) ProtoMessage() {}
+
+func (x *Store) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_store_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Store.ProtoReflect.Descriptor instead.
+func (*Store) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_store_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Store) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Store) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+func (x *Store) GetProducts() []*Item {
+	if x != nil {
+		return x.Products
+	}
+	return nil
+}
+
+type ListStoresRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStoresRequest) Reset() {
+	*x = ListStoresRequest{}
+	mi := &file_coffeeco_v1_store_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStoresRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStoresRequest) ProtoMessage() {}
+
+func (x *ListStoresRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_store_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStoresRequest.ProtoReflect.Descriptor instead.
+func (*ListStoresRequest) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_store_proto_rawDescGZIP(), []int{1}
+}
+
+type ListStoresResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stores        []*Store               `protobuf:"bytes,1,rep,name=stores,proto3" json:"stores,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStoresResponse) Reset() {
+	*x = ListStoresResponse{}
+	mi := &file_coffeeco_v1_store_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStoresResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStoresResponse) ProtoMessage() {}
+
+func (x *ListStoresResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_coffeeco_v1_store_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStoresResponse.ProtoReflect.Descriptor instead.
+func (*ListStoresResponse) Descriptor() ([]byte, []int) {
+	return file_coffeeco_v1_store_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListStoresResponse) GetStores() []*Store {
+	if x != nil {
+		return x.Stores
+	}
+	return nil
+}
+
+var File_coffeeco_v1_store_proto protoreflect.FileDescriptor
+
+const file_coffeeco_v1_store_proto_rawDesc = "" +
+	"\n" +
+	"\x17coffeeco/v1/store.proto\x12\vcoffeeco.v1\x1a\x18coffeeco/v1/common.proto\"b\n" +
+	"\x05Store\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\blocation\x18\x02 \x01(\tR\blocation\x12-\n" +
+	"\bproducts\x18\x03 \x03(\v2\x11.coffeeco.v1.ItemR\bproducts\"\x13\n" +
+	"\x11ListStoresRequest\"@\n" +
+	"\x12ListStoresResponse\x12*\n" +
+	"\x06stores\x18\x01 \x03(\v2\x12.coffeeco.v1.StoreR\x06stores2_\n" +
+	"\fStoreService\x12O\n" +
+	"\n" +
+	"ListStores\x12\x1e.coffeeco.v1.ListStoresRequest\x1a\x1f.coffeeco.v1.ListStoresResponse\"\x00B3Z1coffeeco/grpc/gen/proto/go/coffeeco/v1;coffeecov1b\x06proto3"
+
+var (
+	file_coffeeco_v1_store_proto_rawDescOnce sync.Once
+	file_coffeeco_v1_store_proto_rawDescData []byte
+)
+
+func file_coffeeco_v1_store_proto_rawDescGZIP() []byte {
+	file_coffeeco_v1_store_proto_rawDescOnce.Do(func() {
+		file_coffeeco_v1_store_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_coffeeco_v1_store_proto_rawDesc), len(file_coffeeco_v1_store_proto_rawDesc)))
+	})
+	return file_coffeeco_v1_store_proto_rawDescData
+}
+
+var file_coffeeco_v1_store_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_coffeeco_v1_store_proto_goTypes = []any{
+	(*Store)(nil),              // 0: coffeeco.v1.Store
+	(*ListStoresRequest)(nil),  // 1: coffeeco.v1.ListStoresRequest
+	(*ListStoresResponse)(nil), // 2: coffeeco.v1.ListStoresResponse
+	(*Item)(nil),               // 3: coffeeco.v1.Item
+}
+var file_coffeeco_v1_store_proto_depIdxs = []int32{
+	3, // 0: coffeeco.v1.Store.products:type_name -> coffeeco.v1.Item
+	0, // 1: coffeeco.v1.ListStoresResponse.stores:type_name -> coffeeco.v1.Store
+	1, // 2: coffeeco.v1.StoreService.ListStores:input_type -> coffeeco.v1.ListStoresRequest
+	2, // 3: coffeeco.v1.StoreService.ListStores:output_type -> coffeeco.v1.ListStoresResponse
+	3, // [3:4] is the sub-list for method output_type
+	2, // [2:3] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_coffeeco_v1_store_proto_init() }
+func file_coffeeco_v1_store_proto_init() {
+	if File_coffeeco_v1_store_proto != nil {
+		return
+	}
+	file_coffeeco_v1_common_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_coffeeco_v1_store_proto_rawDesc), len(file_coffeeco_v1_store_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_coffeeco_v1_store_proto_goTypes,
+		DependencyIndexes: file_coffeeco_v1_store_proto_depIdxs,
+		MessageInfos:      file_coffeeco_v1_store_proto_msgTypes,
+	}.Build()
+	File_coffeeco_v1_store_proto = out.File
+	file_coffeeco_v1_store_proto_goTypes = nil
+	file_coffeeco_v1_store_proto_depIdxs = nil
+}
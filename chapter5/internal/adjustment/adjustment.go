@@ -0,0 +1,134 @@
+package adjustment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+var (
+	ErrNotFound     = errors.New("adjustment not found")
+	ErrNoReason     = errors.New("adjustments need a reason")
+	ErrNoActor      = errors.New("adjustments are only made by someone signed in")
+	ErrNoChange     = errors.New("adjustment changes nothing about the purchase")
+	ErrUnknownStore = errors.New("adjustment moves the purchase to a store that does not exist")
+	// ErrInvalidTaxPercent means the tax rate is below 0 or 100 or more; prices include the tax.
+	ErrInvalidTaxPercent = errors.New("tax percent must be at least 0 and below 100")
+)
+
+// Attribution is what finance may correct about a stored purchase: the store its sale counts for and the
+// sales tax its prices include. TaxPercent is nil for the rate every purchase is taxed at by default.
+type Attribution struct {
+	StoreID    uuid.UUID
+	TaxPercent *float64
+}
+
+// Adjustment corrects how a purchase is reported, e.g. after it was rung up at the wrong store, without
+// changing the purchase itself: purchases are immutable records of what was paid. Reports and read models
+// apply the adjustments of a purchase, latest last, on top of it.
+type Adjustment struct {
+	ID         uuid.UUID
+	PurchaseID uuid.UUID
+	// PurchasedAt, Total and Currency are the purchase's, for projections to find the sale they adjust.
+	PurchasedAt time.Time
+	Total       int64
+	Currency    string
+	// Was is how the purchase was attributed before, and Now how it is from this adjustment on.
+	Was Attribution
+	Now Attribution
+	// Reason is why finance corrected the purchase, e.g. "rung up on the Soho till during the move".
+	Reason string
+	By     string
+	At     time.Time
+}
+
+// New corrects a purchase attributed as was, to now.
+func New(purchaseID uuid.UUID, purchasedAt time.Time, total int64, currency string, was, now Attribution, reason, by string, at time.Time) (*Adjustment, error) {
+	if reason == "" {
+		return nil, ErrNoReason
+	}
+	if by == "" {
+		return nil, ErrNoActor
+	}
+	if t := now.TaxPercent; t != nil && (*t < 0 || *t >= 100) {
+		return nil, fmt.Errorf("%w: %g", ErrInvalidTaxPercent, *t)
+	}
+	if now.StoreID == was.StoreID && sameTax(now.TaxPercent, was.TaxPercent) {
+		return nil, ErrNoChange
+	}
+	return &Adjustment{
+		ID:          uuid.New(),
+		PurchaseID:  purchaseID,
+		PurchasedAt: purchasedAt.UTC(),
+		Total:       total,
+		Currency:    currency,
+		Was:         was,
+		Now:         now,
+		Reason:      reason,
+		By:          by,
+		At:          at.UTC(),
+	}, nil
+}
+
+func sameTax(a, b *float64) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+const EventTypeRecorded = "adjustment.recorded"
+
+// Recorded is published once an adjustment is made, for reports and read models to apply it.
+type Recorded struct {
+	AdjustmentID uuid.UUID `json:"adjustment_id"`
+	PurchaseID   uuid.UUID `json:"purchase_id"`
+	PurchasedAt  time.Time `json:"purchased_at"`
+	Total        int64     `json:"total"`
+	Currency     string    `json:"currency"`
+	WasStoreID   uuid.UUID `json:"was_store_id"`
+	StoreID      uuid.UUID `json:"store_id"`
+	// WasTaxPercent and TaxPercent are absent for the default rate.
+	WasTaxPercent *float64  `json:"was_tax_percent,omitempty"`
+	TaxPercent    *float64  `json:"tax_percent,omitempty"`
+	Reason        string    `json:"reason"`
+	By            string    `json:"by"`
+	At            time.Time `json:"at"`
+}
+
+func (e Recorded) EventType() string {
+	return EventTypeRecorded
+}
+
+// AggregateID is the purchase's, so the adjustments of a purchase are delivered in order.
+func (e Recorded) AggregateID() uuid.UUID {
+	return e.PurchaseID
+}
+
+// EventID is derived from the adjustment, as it is recorded only once.
+func (e Recorded) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.AdjustmentID, []byte(EventTypeRecorded))
+}
+
+func (a *Adjustment) recorded() Recorded {
+	return Recorded{
+		AdjustmentID:  a.ID,
+		PurchaseID:    a.PurchaseID,
+		PurchasedAt:   a.PurchasedAt,
+		Total:         a.Total,
+		Currency:      a.Currency,
+		WasStoreID:    a.Was.StoreID,
+		StoreID:       a.Now.StoreID,
+		WasTaxPercent: a.Was.TaxPercent,
+		TaxPercent:    a.Now.TaxPercent,
+		Reason:        a.Reason,
+		By:            a.By,
+		At:            a.At,
+	}
+}
+
+// RegisterEvents adds decoders for every version of the adjustment events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeRecorded, 1, events.JSONDecoder[Recorded]())
+}
@@ -0,0 +1,122 @@
+package adjustment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+// project hands what is published straight to the analytics facts, as cmd/projector would.
+type project struct {
+	facts *analytics.Facts
+}
+
+func (p project) Publish(ctx context.Context, evts ...events.Event) error {
+	for _, e := range evts {
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			return err
+		}
+		if err := p.facts.Handle(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Test_FinanceAdjustsHowAPurchaseIsReported(t *testing.T) {
+	ctx := context.Background()
+	soho, camden := uuid.New(), uuid.New()
+	stores := store.NewMemoryRepo()
+	for _, id := range []uuid.UUID{soho, camden} {
+		if err := stores.SaveStore(ctx, store.Ref(id)); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	// A £25.00 purchase rung up on the Soho till for a customer of Camden.
+	purchases := purchase.NewService(nil, testsupport.NewFakePurchases(), nil)
+	id, at := uuid.New(), time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	p := &purchase.Purchase{
+		Store:              store.Ref(soho),
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "beans", BasePrice: *money.New(2500, "GBP")}},
+		PaymentMeans:       payment.MEANS_CARD,
+	}
+	if err := purchases.ImportPurchase(ctx, id, at, p); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	facts := analytics.NewMemoryStore()
+	pub := project{analytics.NewFacts(facts)}
+	if err := pub.Publish(ctx, purchase.Completed{PurchaseID: id, StoreID: soho, Total: 2500, Currency: "GBP", PurchasedAt: at}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	log := audit.NewMemoryRepo()
+	svc := adjustment.NewService(adjustment.NewMemoryRepo(), purchases, stores, adjustment.WithEventPublisher(pub), adjustment.WithAuditLog(log))
+	finance := audit.WithActor(ctx, "finance-1")
+
+	if _, err := svc.Adjust(finance, id, adjustment.Attribution{StoreID: soho}, "no change"); !errors.Is(err, adjustment.ErrNoChange) {
+		t.Fatalf("expected ErrNoChange but got %v", err)
+	}
+	if _, err := svc.Adjust(finance, id, adjustment.Attribution{StoreID: uuid.New()}, "closed store"); !errors.Is(err, adjustment.ErrUnknownStore) {
+		t.Fatalf("expected ErrUnknownStore but got %v", err)
+	}
+	if _, err := svc.Adjust(finance, id, adjustment.Attribution{StoreID: camden}, ""); !errors.Is(err, adjustment.ErrNoReason) {
+		t.Fatalf("expected ErrNoReason but got %v", err)
+	}
+	if _, err := svc.Adjust(finance, id, adjustment.Attribution{StoreID: camden}, "rung up on the Soho till"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	reduced := 5.0
+	a, err := svc.Adjust(finance, id, adjustment.Attribution{TaxPercent: &reduced}, "beans are taxed at the reduced rate")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if a.Was.StoreID != camden || a.Now.StoreID != camden || a.By != "finance-1" {
+		t.Fatalf("expected the tax adjusted on top of the move to Camden but got %+v", a)
+	}
+
+	reports := analytics.NewService(facts, analytics.WithTaxPercent(20))
+	q := analytics.Query{From: at.Truncate(24 * time.Hour), To: at.AddDate(0, 0, 1)}
+	sales, err := reports.SalesByStore(ctx, q)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(sales) != 1 || sales[0].StoreID != camden.String() || sales[0].Revenue != 2500 {
+		t.Fatalf("expected the sale reported at Camden but got %+v", sales)
+	}
+	taxes, err := reports.Taxes(ctx, analytics.Query{From: q.From, To: q.To, StoreIDs: []uuid.UUID{camden}})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(taxes) != 1 || taxes[0].TaxPercent != 5 || taxes[0].Tax != 119 {
+		t.Fatalf("expected £1.19 tax at 5%% but got %+v", taxes)
+	}
+
+	got, err := purchases.GetPurchase(ctx, id)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if got.Store.ID != soho {
+		t.Fatalf("expected the purchase left as it was paid but got store %s", got.Store.ID)
+	}
+	if all, _ := svc.ForPurchase(ctx, id); len(all) != 2 {
+		t.Fatalf("expected both adjustments kept but got %d", len(all))
+	}
+	entries, err := log.Query(ctx, audit.Query{Actor: "finance-1", From: at, To: time.Now().Add(time.Minute)})
+	if err != nil || len(entries) != 2 || entries[0].Note != "beans are taxed at the reduced rate" {
+		t.Fatalf("expected both adjustments audited with their reasons but got %+v and %v", entries, err)
+	}
+}
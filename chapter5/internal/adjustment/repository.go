@@ -0,0 +1,239 @@
+package adjustment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/telemetry"
+)
+
+// Repository keeps adjustments, which are never changed once they are made.
+type Repository interface {
+	Add(ctx context.Context, a *Adjustment) error
+	// Get returns ErrNotFound if there is no such adjustment.
+	Get(ctx context.Context, id uuid.UUID) (*Adjustment, error)
+	// ForPurchase returns the adjustments of a purchase, oldest first.
+	ForPurchase(ctx context.Context, purchaseID uuid.UUID) ([]*Adjustment, error)
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client      *mongo.Client
+	adjustments *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	adjustments := client.Database("coffeeco").Collection("purchase_adjustments")
+	_, err = adjustments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "purchase_id", Value: 1}, {Key: "at", Value: 1}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create adjustment indexes: %w", err)
+	}
+	return &MongoRepository{client: client, adjustments: adjustments}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoAdjustment struct {
+	ID            string    `bson:"_id"`
+	PurchaseID    string    `bson:"purchase_id"`
+	PurchasedAt   time.Time `bson:"purchased_at"`
+	Total         int64     `bson:"total"`
+	Currency      string    `bson:"currency"`
+	WasStoreID    string    `bson:"was_store_id"`
+	StoreID       string    `bson:"store_id"`
+	WasTaxPercent *float64  `bson:"was_tax_percent,omitempty"`
+	TaxPercent    *float64  `bson:"tax_percent,omitempty"`
+	Reason        string    `bson:"reason"`
+	By            string    `bson:"by"`
+	At            time.Time `bson:"at"`
+}
+
+func toMongoAdjustment(a *Adjustment) mongoAdjustment {
+	return mongoAdjustment{
+		ID:            a.ID.String(),
+		PurchaseID:    a.PurchaseID.String(),
+		PurchasedAt:   a.PurchasedAt,
+		Total:         a.Total,
+		Currency:      a.Currency,
+		WasStoreID:    a.Was.StoreID.String(),
+		StoreID:       a.Now.StoreID.String(),
+		WasTaxPercent: a.Was.TaxPercent,
+		TaxPercent:    a.Now.TaxPercent,
+		Reason:        a.Reason,
+		By:            a.By,
+		At:            a.At,
+	}
+}
+
+func (m mongoAdjustment) toAdjustment() (*Adjustment, error) {
+	a := &Adjustment{
+		PurchasedAt: m.PurchasedAt.UTC(),
+		Total:       m.Total,
+		Currency:    m.Currency,
+		Was:         Attribution{TaxPercent: m.WasTaxPercent},
+		Now:         Attribution{TaxPercent: m.TaxPercent},
+		Reason:      m.Reason,
+		By:          m.By,
+		At:          m.At.UTC(),
+	}
+	var err error
+	for _, id := range []struct {
+		dst *uuid.UUID
+		src string
+	}{{&a.ID, m.ID}, {&a.PurchaseID, m.PurchaseID}, {&a.Was.StoreID, m.WasStoreID}, {&a.Now.StoreID, m.StoreID}} {
+		if *id.dst, err = uuid.Parse(id.src); err != nil {
+			return nil, fmt.Errorf("failed to read adjustment %s: %w", m.ID, err)
+		}
+	}
+	return a, nil
+}
+
+func (m *MongoRepository) Add(ctx context.Context, a *Adjustment) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "adjustment.MongoRepository.Add", attribute.String("adjustment.id", a.ID.String()))
+	defer telemetry.End(span, &err)
+	if _, err := m.adjustments.InsertOne(ctx, toMongoAdjustment(a)); err != nil {
+		return fmt.Errorf("failed to add adjustment: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Adjustment, err error) {
+	ctx, span := telemetry.StartClient(ctx, "adjustment.MongoRepository.Get", attribute.String("adjustment.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoAdjustment
+	err = m.adjustments.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get adjustment: %w", err)
+	}
+	return doc.toAdjustment()
+}
+
+func (m *MongoRepository) ForPurchase(ctx context.Context, purchaseID uuid.UUID) (_ []*Adjustment, err error) {
+	ctx, span := telemetry.StartClient(ctx, "adjustment.MongoRepository.ForPurchase", attribute.String("purchase.id", purchaseID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.adjustments.Find(ctx, bson.D{{Key: "purchase_id", Value: purchaseID.String()}}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query adjustments: %w", err)
+	}
+	var docs []mongoAdjustment
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode adjustments: %w", err)
+	}
+	res := make([]*Adjustment, 0, len(docs))
+	for _, doc := range docs {
+		a, err := doc.toAdjustment()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// Replay feeds every adjustment to h as a Recorded message, oldest first, to rebuild read models from
+// scratch after the purchases they adjust.
+func (m *MongoRepository) Replay(ctx context.Context, h events.Handler) error {
+	cur, err := m.adjustments.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to query adjustments: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var doc mongoAdjustment
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode adjustment: %w", err)
+		}
+		a, err := doc.toAdjustment()
+		if err != nil {
+			return err
+		}
+		msg, err := events.NewMessage(a.recorded(), events.JSONCodec{})
+		if err != nil {
+			return err
+		}
+		msg.OccurredAt = a.At
+		if err := h(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.adjustments.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps adjustments in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu          sync.Mutex
+	adjustments []*Adjustment
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func (m *MemoryRepository) Add(_ context.Context, a *Adjustment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *a
+	m.adjustments = append(m.adjustments, &c)
+	return nil
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Adjustment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range m.adjustments {
+		if a.ID == id {
+			c := *a
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryRepository) ForPurchase(_ context.Context, purchaseID uuid.UUID) ([]*Adjustment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*Adjustment
+	for _, a := range m.adjustments {
+		if a.PurchaseID == purchaseID {
+			c := *a
+			res = append(res, &c)
+		}
+	}
+	slices.SortStableFunc(res, func(a, b *Adjustment) int { return a.At.Compare(b.At) })
+	return res, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package adjustment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// Purchases is where adjusted purchases are read from, e.g. purchase.Service.
+type Purchases interface {
+	GetPurchase(ctx context.Context, id uuid.UUID) (purchase.Purchase, error)
+}
+
+// Stores tells which stores exist, e.g. store.Service.
+type Stores interface {
+	GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error)
+}
+
+// Service has finance correct how stored purchases are reported.
+type Service struct {
+	repo      Repository
+	purchases Purchases
+	stores    Stores
+	publisher events.Publisher // 可选, 发布调整, 供报表和读模型使用
+	audit     audit.Recorder   // 可选, 记录谁调整了哪笔购买
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes Recorded, for analytics and the read models to apply adjustments. Without
+// it adjustments are only kept.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithAuditLog records every adjustment in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test the order adjustments are made in.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, purchases Purchases, stores Stores, opts ...Option) *Service {
+	s := &Service{repo: repo, purchases: purchases, stores: stores, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Adjust corrects how a purchase is reported from now on, for reason. to.StoreID moves its sale to another
+// store and to.TaxPercent sets the tax its prices include; fields left zero stay as the purchase and its
+// earlier adjustments have them. The purchase itself is not changed.
+func (s *Service) Adjust(ctx context.Context, purchaseID uuid.UUID, to Attribution, reason string) (*Adjustment, error) {
+	p, err := s.purchases.GetPurchase(ctx, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	was, err := s.Attribution(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	now := was
+	if to.StoreID != uuid.Nil {
+		found, err := s.stores.GetStores(ctx, []uuid.UUID{to.StoreID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up store: %w", err)
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStore, to.StoreID)
+		}
+		now.StoreID = to.StoreID
+	}
+	if to.TaxPercent != nil {
+		now.TaxPercent = to.TaxPercent
+	}
+	total := p.Total()
+	a, err := New(p.ID, p.PurchasedAt(), total.Amount(), total.Currency().Code, was, now, reason, audit.Actor(ctx), s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Add(ctx, a); err != nil {
+		return nil, err
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionPurchaseAdjustment, "purchase", p.ID.String(), describe(was), describe(now))
+		e.Note = reason
+		if err := s.audit.Record(ctx, e); err != nil {
+			return a, fmt.Errorf("purchase adjusted but failed to record it in the audit log: %w", err)
+		}
+	}
+	if s.publisher != nil {
+		if err := s.publisher.Publish(ctx, a.recorded()); err != nil {
+			s.logger.ErrorContext(ctx, "purchase adjusted but the adjustment not published", "adjustment", a.ID, "purchase", p.ID, "error", err)
+		}
+	}
+	return a, nil
+}
+
+// Attribution is how a purchase is reported once its adjustments are applied.
+func (s *Service) Attribution(ctx context.Context, p purchase.Purchase) (Attribution, error) {
+	adjustments, err := s.repo.ForPurchase(ctx, p.ID)
+	if err != nil {
+		return Attribution{}, err
+	}
+	if len(adjustments) == 0 {
+		return Attribution{StoreID: p.Store.ID}, nil
+	}
+	return adjustments[len(adjustments)-1].Now, nil
+}
+
+// ForPurchase returns the adjustments of a purchase, oldest first.
+func (s *Service) ForPurchase(ctx context.Context, purchaseID uuid.UUID) ([]*Adjustment, error) {
+	return s.repo.ForPurchase(ctx, purchaseID)
+}
+
+func describe(a Attribution) string {
+	tax := "the default tax"
+	if a.TaxPercent != nil {
+		tax = strconv.FormatFloat(*a.TaxPercent, 'f', -1, 64) + "% tax"
+	}
+	return fmt.Sprintf("store %s, %s", a.StoreID, tax)
+}
@@ -0,0 +1,165 @@
+package analytics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+)
+
+func project(t *testing.T, f *analytics.Facts, evts ...events.Event) {
+	t.Helper()
+	for _, e := range evts {
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		// Redelivered events must not count twice.
+		for range 2 {
+			if err := f.Handle(context.Background(), msg); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+	}
+}
+
+func Test_ReportsAggregateTheProjectedSales(t *testing.T) {
+	ctx := context.Background()
+	soho, camden := uuid.New(), uuid.New()
+	ada := uuid.New()
+	morning := time.Date(2024, 3, 1, 8, 15, 0, 0, time.UTC)
+	sale := func(storeID, customerID uuid.UUID, at time.Time, total int64, lines ...purchase.CompletedLine) purchase.Completed {
+		return purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, CustomerID: customerID, Lines: lines, Total: total, Currency: "USD", PurchasedAt: at}
+	}
+	latte := purchase.CompletedLine{ItemName: "latte", Amount: 400}
+	cookie := purchase.CompletedLine{ItemName: "cookie", Amount: 200}
+	ownCup := purchase.CompletedLine{ItemName: "latte", Amount: 400, ReusableCup: true}
+
+	store := analytics.NewMemoryStore()
+	project(t, analytics.NewFacts(store),
+		sale(soho, ada, morning, 600, latte, cookie),
+		// Discounted by 10%.
+		sale(soho, ada, morning.Add(30*time.Minute), 360, ownCup),
+		sale(soho, uuid.Nil, morning.Add(4*time.Hour), 400, latte, purchase.CompletedLine{ItemName: purchase.DeliveryFeeItem, Amount: 0}),
+		sale(camden, uuid.Nil, morning.Add(5*time.Hour), 200, cookie),
+		// Outside the period.
+		sale(soho, ada, morning.AddDate(0, 0, 2), 400, latte),
+		sale(camden, uuid.Nil, morning.AddDate(0, 0, 2), 800, ownCup, ownCup),
+		loyalty.DrinksRedeemed{CardID: uuid.New(), CustomerID: ada, StoreID: soho, Count: 2},
+	)
+	svc := analytics.NewService(store)
+	q := analytics.Query{From: morning.Truncate(24 * time.Hour), To: morning.AddDate(0, 0, 1)}
+
+	hours, err := svc.SalesByHour(ctx, q)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(hours) != 3 || hours[0].Hour != 8 || hours[0].Purchases != 2 || hours[0].Revenue != 960 || hours[0].AverageTicket != 480 {
+		t.Fatalf("expected the morning rush first but got %+v", hours)
+	}
+	stores, _ := svc.SalesByStore(ctx, analytics.Query{From: q.From, To: q.To, StoreIDs: []uuid.UUID{camden}})
+	if len(stores) != 1 || stores[0].StoreID != camden.String() || stores[0].Revenue != 200 {
+		t.Fatalf("expected only camden but got %+v", stores)
+	}
+	products, _ := svc.SalesByProduct(ctx, q)
+	if len(products) != 2 || products[0].Product != "latte" || products[0].Quantity != 3 || products[1].Quantity != 2 {
+		t.Fatalf("expected lattes then cookies, without delivery fees, but got %+v", products)
+	}
+	discounts, _ := svc.Discounts(ctx, q)
+	if len(discounts) != 2 || discounts[1].Purchases != 1 || discounts[1].Given != 40 || discounts[0].Purchases != 3 {
+		t.Fatalf("expected one discounted purchase that gave 40 cents away but got %+v", discounts)
+	}
+	conversion, _ := svc.Loyalty(ctx, analytics.Query{From: q.From, To: time.Now(), StoreIDs: []uuid.UUID{soho}})
+	if len(conversion) != 1 || conversion[0].MemberPurchases != 3 || conversion[0].Members != 1 || conversion[0].ReturningMembers != 1 || conversion[0].FreeDrinksRedeemed != 2 {
+		t.Fatalf("expected ada to have come back to soho and redeemed 2 drinks but got %+v", conversion)
+	}
+	cups, _ := svc.CupsSavedByStore(ctx, analytics.Query{From: q.From, To: time.Now()})
+	if len(cups) != 2 || cups[0].CupsSaved != 2 || cups[0].StoreID != camden.String() || cups[0].Customers != 0 || cups[1].Customers != 1 {
+		t.Fatalf("expected a cup saved at each store, by ada at soho, but got %+v", cups)
+	}
+	savers, _ := svc.CupsSavedByCustomer(ctx, q)
+	if len(savers) != 1 || savers[0].CustomerID != ada.String() || savers[0].CupsSaved != 1 {
+		t.Fatalf("expected only ada among the customers who saved cups but got %+v", savers)
+	}
+
+	var csv strings.Builder
+	if err := analytics.WriteCSV(&csv, hours[:1]); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if csv.String() != "hour,currency,purchases,revenue,average_ticket\n8,USD,2,960,480\n" {
+		t.Fatalf("expected the hours as CSV but got %q", csv.String())
+	}
+	if _, err := svc.AverageTicket(ctx, analytics.Query{From: q.To, To: q.From}); err == nil {
+		t.Fatalf("expected a period that ends before it starts to be refused")
+	}
+}
+
+func Test_SettlementsOweEachPayeeWhatIsTheirs(t *testing.T) {
+	ctx := context.Background()
+	soho := uuid.New()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	store := analytics.NewMemoryStore()
+	project(t, analytics.NewFacts(store),
+		purchase.Completed{PurchaseID: uuid.New(), StoreID: soho, Lines: []purchase.CompletedLine{{ItemName: "latte", Amount: 400}}, Total: 649, Currency: "USD", PurchasedAt: at,
+			Charges: []purchase.CompletedCharge{{Type: "service_fee", Payee: "marketplace", Amount: 99}, {Type: "courier_tip", Payee: "courier", Amount: 150}}},
+		purchase.Completed{PurchaseID: uuid.New(), StoreID: soho, Lines: []purchase.CompletedLine{{ItemName: "latte", Amount: 400}}, Total: 400, Currency: "USD", PurchasedAt: at},
+	)
+	svc := analytics.NewService(store)
+	q := analytics.Query{From: at.Add(-time.Hour), To: at.Add(time.Hour)}
+
+	owed, err := svc.Settlements(ctx, q)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(owed) != 3 || owed[0].Payee != "store" || owed[0].Amount != 800 || owed[0].Purchases != 2 || owed[0].Charges != 0 {
+		t.Fatalf("expected the store to be owed both lattes first but got %+v", owed)
+	}
+	if owed[1].Payee != "courier" || owed[1].Amount != 150 || owed[2].Payee != "marketplace" || owed[2].Amount != 99 || owed[2].Purchases != 1 {
+		t.Fatalf("expected the courier owed the tip and the marketplace its fee but got %+v", owed)
+	}
+	stores, _ := svc.SalesByStore(ctx, q)
+	if len(stores) != 1 || stores[0].Revenue != 800 {
+		t.Fatalf("expected the charges owed to others left out of the revenue but got %+v", stores)
+	}
+}
+
+func Test_RoundingIsLedgeredPerStoreAndDay(t *testing.T) {
+	ctx := context.Background()
+	soho, camden := uuid.New(), uuid.New()
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cash := func(storeID uuid.UUID, at time.Time, total, rounding int64) purchase.Completed {
+		return purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Lines: []purchase.CompletedLine{{ItemName: "latte", Amount: total - rounding}}, Total: total, Rounding: rounding, Currency: "CHF", PaymentMeans: "cash", PurchasedAt: at}
+	}
+	store := analytics.NewMemoryStore()
+	project(t, analytics.NewFacts(store),
+		cash(soho, at, 425, 2),
+		cash(soho, at.Add(time.Hour), 420, -2),
+		cash(soho, at.Add(2*time.Hour), 420, 1),
+		cash(soho, at.AddDate(0, 0, 1), 420, -1),
+		cash(camden, at, 500, 0),
+	)
+	svc := analytics.NewService(store)
+
+	days, err := svc.Rounding(ctx, analytics.Query{From: at.Add(-time.Hour), To: at.AddDate(0, 0, 2)})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	want := []analytics.StoreRounding{
+		{StoreID: soho.String(), Day: "2024-03-01", Currency: "CHF", Purchases: 3, Gained: 3, Lost: 2, Net: 1},
+		{StoreID: soho.String(), Day: "2024-03-02", Currency: "CHF", Purchases: 1, Gained: 0, Lost: 1, Net: -1},
+	}
+	if len(days) != len(want) || days[0] != want[0] || days[1] != want[1] {
+		t.Fatalf("expected %+v but got %+v", want, days)
+	}
+	stores, _ := svc.SalesByStore(ctx, analytics.Query{From: at.Add(-time.Hour), To: at.Add(time.Hour), StoreIDs: []uuid.UUID{soho}})
+	if len(stores) != 1 || stores[0].Revenue != 423 {
+		t.Fatalf("expected rounding left out of the revenue but got %+v", stores)
+	}
+}
@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// WriteCSV writes report rows, a slice of one of the row types of this package, as CSV with a header. The
+// columns are named and ordered like the fields of the JSON rows.
+func WriteCSV(w io.Writer, rows any) error {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot write %T as CSV", rows)
+	}
+	out := csv.NewWriter(w)
+	if err := out.Write(columns(v.Type().Elem())); err != nil {
+		return err
+	}
+	for i := range v.Len() {
+		if err := out.Write(record(v.Index(i))); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// columns names the fields of t by their JSON name. Embedded structs, like Totals, are flattened the way
+// encoding/json flattens them.
+func columns(t reflect.Type) []string {
+	var res []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			res = append(res, columns(f.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		res = append(res, name)
+	}
+	return res
+}
+
+func record(v reflect.Value) []string {
+	var res []string
+	for i := range v.NumField() {
+		f := v.Field(i)
+		if v.Type().Field(i).Anonymous && f.Kind() == reflect.Struct {
+			res = append(res, record(f)...)
+			continue
+		}
+		switch f.Kind() {
+		case reflect.Float64:
+			res = append(res, strconv.FormatFloat(f.Float(), 'f', -1, 64))
+		default:
+			res = append(res, fmt.Sprint(f.Interface()))
+		}
+	}
+	return res
+}
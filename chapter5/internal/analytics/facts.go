@@ -0,0 +1,171 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+)
+
+// Sale is what analytics keeps of a completed purchase. Amounts are in the minor unit of Currency.
+type Sale struct {
+	PurchaseID string `bson:"_id"`
+	StoreID    string `bson:"store_id"`
+	// CustomerID is empty for anonymous purchases and once the customer is erased; Member stays set.
+	CustomerID   string    `bson:"customer_id,omitempty"`
+	Member       bool      `bson:"member"`
+	PurchasedAt  time.Time `bson:"purchased_at"`
+	Currency     string    `bson:"currency"`
+	PaymentMeans string    `bson:"payment_means"`
+	// Channel is how the purchase was ordered; it is empty for purchases completed before it was recorded.
+	Channel string     `bson:"channel,omitempty"`
+	Lines   []SaleLine `bson:"lines"`
+	// ListPrice is what the lines cost before discounts and passes; Total is what was paid for them.
+	ListPrice int64 `bson:"list_price"`
+	Total     int64 `bson:"total"`
+	// Charges were paid besides the lines, e.g. the service fee of a marketplace; they are not in Total.
+	Charges []SaleCharge `bson:"charges,omitempty"`
+	// Rounding is what rounding the total of a cash purchase added to it, negative if it took some off; it
+	// is not in Total either.
+	Rounding int64 `bson:"rounding,omitempty"`
+	// Overrides are the prices managers overrode; what they gave is already off the lines and Total.
+	Overrides []SaleOverride `bson:"overrides,omitempty"`
+	// TaxPercent is the sales tax Total includes, if finance adjusted it; nil is the default rate.
+	TaxPercent *float64 `bson:"tax_percent,omitempty"`
+	// Experiment and Variant are the discount experiment the customer was priced in and their variant.
+	Experiment string `bson:"experiment,omitempty"`
+	Variant    string `bson:"variant,omitempty"`
+}
+
+type SaleOverride struct {
+	Reason string `bson:"reason"`
+	Given  int64  `bson:"given"`
+	By     string `bson:"by"`
+}
+
+type SaleCharge struct {
+	Type   string `bson:"type"`
+	Payee  string `bson:"payee"`
+	Amount int64  `bson:"amount"`
+}
+
+type SaleLine struct {
+	Item   string `bson:"item"`
+	Amount int64  `bson:"amount"`
+	// ReusableCup is a drink served in a cup the customer brought.
+	ReusableCup bool `bson:"reusable_cup,omitempty"`
+}
+
+// Redemption is free drinks given at a store.
+type Redemption struct {
+	ID      string    `bson:"_id"`
+	StoreID string    `bson:"store_id"`
+	Drinks  int64     `bson:"drinks"`
+	At      time.Time `bson:"at"`
+}
+
+// Adjustment is finance's correction of how a sale is reported. Sales keep what was recorded when they were
+// made; reports apply the latest adjustment of each on top.
+type Adjustment struct {
+	ID          string    `bson:"_id"`
+	PurchaseID  string    `bson:"purchase_id"`
+	PurchasedAt time.Time `bson:"purchased_at"`
+	StoreID     string    `bson:"store_id"`
+	TaxPercent  *float64  `bson:"tax_percent,omitempty"`
+	At          time.Time `bson:"at"`
+}
+
+// apply reports the sale as the adjustment has it.
+func (a Adjustment) apply(s *Sale) {
+	s.StoreID, s.TaxPercent = a.StoreID, a.TaxPercent
+}
+
+// Facts is the projection analytics is built from. It keeps one fact per event, keyed by the event, so
+// unlike the read models in package projection it needs no inbox to be applied at least once.
+type Facts struct {
+	store    Store
+	registry *events.Registry
+}
+
+func NewFacts(store Store) *Facts {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	loyalty.RegisterEvents(r)
+	adjustment.RegisterEvents(r)
+	return &Facts{store: store, registry: r}
+}
+
+func (f *Facts) Name() string {
+	return "analytics"
+}
+
+func (f *Facts) Handle(ctx context.Context, msg events.Message) error {
+	evt, err := f.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch e := evt.(type) {
+	case purchase.Completed:
+		return f.store.SaveSale(ctx, sale(e))
+	case loyalty.DrinksRedeemed:
+		if msg.ID == uuid.Nil {
+			return fmt.Errorf("redemption of card %s has no message ID", e.CardID)
+		}
+		return f.store.SaveRedemption(ctx, Redemption{ID: msg.ID.String(), StoreID: e.StoreID.String(), Drinks: int64(e.Count), At: msg.OccurredAt})
+	case adjustment.Recorded:
+		return f.store.SaveAdjustment(ctx, Adjustment{
+			ID:          e.AdjustmentID.String(),
+			PurchaseID:  e.PurchaseID.String(),
+			PurchasedAt: e.PurchasedAt,
+			StoreID:     e.StoreID.String(),
+			TaxPercent:  e.TaxPercent,
+			At:          e.At,
+		})
+	}
+	return nil
+}
+
+func (f *Facts) Reset(ctx context.Context) error {
+	return f.store.Reset(ctx)
+}
+
+func sale(e purchase.Completed) Sale {
+	s := Sale{
+		PurchaseID:   e.PurchaseID.String(),
+		StoreID:      e.StoreID.String(),
+		Member:       e.CustomerID != uuid.Nil,
+		PurchasedAt:  e.PurchasedAt,
+		Currency:     e.Currency,
+		PaymentMeans: e.PaymentMeans,
+		Channel:      e.Channel,
+		Total:        e.Total - e.Rounding,
+		Rounding:     e.Rounding,
+		Experiment:   e.Experiment,
+		Variant:      e.Variant,
+	}
+	if s.Member {
+		s.CustomerID = e.CustomerID.String()
+	}
+	for _, l := range e.Lines {
+		s.Lines = append(s.Lines, SaleLine{Item: l.ItemName, Amount: l.Amount, ReusableCup: l.ReusableCup})
+		s.ListPrice += l.Amount
+	}
+	for _, c := range e.Charges {
+		s.Charges = append(s.Charges, SaleCharge(c))
+		s.Total -= c.Amount
+	}
+	for _, o := range e.Overrides {
+		s.Overrides = append(s.Overrides, SaleOverride{Reason: o.Reason, Given: o.Was - o.Price, By: o.By})
+	}
+	return s
+}
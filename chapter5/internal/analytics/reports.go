@@ -0,0 +1,730 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+var ErrInvalidQuery = errors.New("invalid analytics query")
+
+// Query selects the facts a report is computed from.
+type Query struct {
+	// From is inclusive and To exclusive.
+	From, To time.Time
+	// StoreIDs limits the report to some stores; empty means every store.
+	StoreIDs []uuid.UUID
+	// Location is the time zone hours of the day are counted in, UTC if nil.
+	Location *time.Location
+}
+
+func (q Query) validate() error {
+	if !q.To.After(q.From) {
+		return fmt.Errorf("%w: to must be after from", ErrInvalidQuery)
+	}
+	return nil
+}
+
+func (q Query) includes(storeID string, at time.Time) bool {
+	if at.Before(q.From) || !at.Before(q.To) {
+		return false
+	}
+	return len(q.StoreIDs) == 0 || slices.ContainsFunc(q.StoreIDs, func(id uuid.UUID) bool { return id.String() == storeID })
+}
+
+func (q Query) location() *time.Location {
+	if q.Location == nil {
+		return time.UTC
+	}
+	return q.Location
+}
+
+// The report rows below are the stable API of analytics: their JSON names are also their CSV columns.
+// Columns may be added, but are never renamed or removed. Amounts are in the minor unit of the currency,
+// and sales in different currencies are never added up.
+
+// Totals sum up purchases in one currency. AverageTicket is rounded to the minor unit.
+type Totals struct {
+	Currency      string `json:"currency"`
+	Purchases     int64  `json:"purchases"`
+	Revenue       int64  `json:"revenue"`
+	AverageTicket int64  `json:"average_ticket"`
+}
+
+func (t *Totals) add(s Sale) {
+	t.Purchases++
+	t.Revenue += s.Total
+	t.AverageTicket = int64(math.Round(float64(t.Revenue) / float64(t.Purchases)))
+}
+
+type HourSales struct {
+	// Hour of the day, 0 to 23, in the query's time zone.
+	Hour int `json:"hour"`
+	Totals
+}
+
+type StoreSales struct {
+	StoreID string `json:"store_id"`
+	Totals
+}
+
+// ChannelSales sums up the purchases ordered through a channel, e.g. app. Channel is empty for purchases
+// completed before channels were recorded.
+type ChannelSales struct {
+	Channel string `json:"channel"`
+	Totals
+}
+
+// ProductSales counts the lines a product was sold on. Delivery fees are not products.
+type ProductSales struct {
+	Product  string `json:"product"`
+	Currency string `json:"currency"`
+	Quantity int64  `json:"quantity"`
+	Revenue  int64  `json:"revenue"`
+}
+
+// DiscountSales compares purchases that were discounted, by the store or by a pass, with those that were
+// not. Given is what the discounts cost: the list price of the purchases less what was paid.
+type DiscountSales struct {
+	Discounted bool `json:"discounted"`
+	Totals
+	ListPrice int64 `json:"list_price"`
+	Given     int64 `json:"given"`
+}
+
+// LoyaltyConversion tells how many purchases at a store are made by registered customers, and how many of
+// them come back. Members are counted by store, so a customer buying at two stores counts at both.
+type LoyaltyConversion struct {
+	StoreID         string  `json:"store_id"`
+	Purchases       int64   `json:"purchases"`
+	MemberPurchases int64   `json:"member_purchases"`
+	MemberShare     float64 `json:"member_share"`
+	Members         int64   `json:"members"`
+	// ReturningMembers made more than one purchase in the period.
+	ReturningMembers   int64 `json:"returning_members"`
+	FreeDrinksRedeemed int64 `json:"free_drinks_redeemed"`
+}
+
+// StoreCups is the sustainability report of a store: the disposable cups its customers saved by bringing
+// their own.
+type StoreCups struct {
+	StoreID   string `json:"store_id"`
+	CupsSaved int64  `json:"cups_saved"`
+	// Purchases and Customers are those with at least one reusable cup; erased customers are not counted.
+	Purchases int64 `json:"purchases"`
+	Customers int64 `json:"customers"`
+}
+
+// PayeeSettlement is what purchases paid that is owed to a payee: the store is owed what the lines were
+// paid and the charges that are its own, and marketplaces and couriers the charges that are theirs.
+type PayeeSettlement struct {
+	Payee    string `json:"payee"`
+	Currency string `json:"currency"`
+	// Purchases are those that owe the payee anything.
+	Purchases int64 `json:"purchases"`
+	Amount    int64 `json:"amount"`
+	// Charges is the part of Amount that was paid besides the lines.
+	Charges int64 `json:"charges"`
+}
+
+// StoreRounding is the rounding ledger of a store for a day: what rounding cash totals to the smallest coin
+// gained and lost it. Lost is positive, and Net is Gained less Lost.
+type StoreRounding struct {
+	StoreID string `json:"store_id"`
+	// Day is the date in the query's time zone, e.g. 2024-03-01.
+	Day      string `json:"day"`
+	Currency string `json:"currency"`
+	// Purchases are those whose total was rounded.
+	Purchases int64 `json:"purchases"`
+	Gained    int64 `json:"gained"`
+	Lost      int64 `json:"lost"`
+	Net       int64 `json:"net"`
+}
+
+// StoreCash is the cash a store took for its purchases: their totals as rounded, and the charges paid with
+// them.
+type StoreCash struct {
+	StoreID   string `json:"store_id"`
+	Currency  string `json:"currency"`
+	Purchases int64  `json:"purchases"`
+	Cash      int64  `json:"cash"`
+}
+
+// StoreOverrides are the prices managers of a store overrode in a day for a reason, and what they gave
+// away overriding them.
+type StoreOverrides struct {
+	StoreID string `json:"store_id"`
+	// Day is the date in the query's time zone, e.g. 2024-03-01.
+	Day       string `json:"day"`
+	Currency  string `json:"currency"`
+	Reason    string `json:"reason"`
+	Overrides int64  `json:"overrides"`
+	Given     int64  `json:"given"`
+}
+
+// StoreTax is the sales tax a store collected at a rate. Revenue includes Tax, which is rounded to the
+// minor unit for each sale.
+type StoreTax struct {
+	StoreID    string  `json:"store_id"`
+	Currency   string  `json:"currency"`
+	TaxPercent float64 `json:"tax_percent"`
+	Purchases  int64   `json:"purchases"`
+	Revenue    int64   `json:"revenue"`
+	Tax        int64   `json:"tax"`
+}
+
+// CustomerCups is the cups a registered customer saved, wherever they bought.
+type CustomerCups struct {
+	CustomerID string `json:"customer_id"`
+	CupsSaved  int64  `json:"cups_saved"`
+	Purchases  int64  `json:"purchases"`
+}
+
+type Service struct {
+	store      Store
+	taxPercent float64
+}
+
+type Option func(s *Service)
+
+// WithTaxPercent is the sales tax prices include, unless finance adjusted a sale's; the default is none.
+func WithTaxPercent(percent float64) Option {
+	return func(s *Service) {
+		s.taxPercent = percent
+	}
+}
+
+func NewService(store Store, opts ...Option) *Service {
+	s := &Service{store: store}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// sales calls fn with every sale in q as finance adjusted it. A sale moved to another store is reported for
+// that store, so with adjustments about the sales of every store are read and filtered here.
+func (s *Service) sales(ctx context.Context, q Query, fn func(Sale) error) error {
+	adjusted := map[string]Adjustment{}
+	err := s.store.Adjustments(ctx, q, func(a Adjustment) error {
+		adjusted[a.PurchaseID] = a
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(adjusted) == 0 {
+		return s.store.Sales(ctx, q, fn)
+	}
+	all := q
+	all.StoreIDs = nil
+	return s.store.Sales(ctx, all, func(sale Sale) error {
+		if a, ok := adjusted[sale.PurchaseID]; ok {
+			a.apply(&sale)
+		}
+		if !q.includes(sale.StoreID, sale.PurchasedAt) {
+			return nil
+		}
+		return fn(sale)
+	})
+}
+
+type currencyKey[K comparable] struct {
+	key      K
+	currency string
+}
+
+// totalsBy adds up sales by a key and their currency.
+func (s *Service) totalsBy(ctx context.Context, q Query, key func(Sale) string) (map[currencyKey[string]]*Totals, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	res := map[currencyKey[string]]*Totals{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		k := currencyKey[string]{key(sale), sale.Currency}
+		if res[k] == nil {
+			res[k] = &Totals{Currency: sale.Currency}
+		}
+		res[k].add(sale)
+		return nil
+	})
+	return res, err
+}
+
+// SalesByHour tells the busy hours of the day, earliest first.
+func (s *Service) SalesByHour(ctx context.Context, q Query) ([]HourSales, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	totals := map[currencyKey[int]]*Totals{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		k := currencyKey[int]{sale.PurchasedAt.In(q.location()).Hour(), sale.Currency}
+		if totals[k] == nil {
+			totals[k] = &Totals{Currency: sale.Currency}
+		}
+		totals[k].add(sale)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]HourSales, 0, len(totals))
+	for k, t := range totals {
+		res = append(res, HourSales{Hour: k.key, Totals: *t})
+	}
+	slices.SortFunc(res, func(a, b HourSales) int {
+		return cmp.Or(cmp.Compare(a.Hour, b.Hour), cmp.Compare(a.Currency, b.Currency))
+	})
+	return res, nil
+}
+
+// SalesByStore ranks the stores by revenue.
+func (s *Service) SalesByStore(ctx context.Context, q Query) ([]StoreSales, error) {
+	totals, err := s.totalsBy(ctx, q, func(sale Sale) string { return sale.StoreID })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreSales, 0, len(totals))
+	for k, t := range totals {
+		res = append(res, StoreSales{StoreID: k.key, Totals: *t})
+	}
+	slices.SortFunc(res, func(a, b StoreSales) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), cmp.Compare(b.Revenue, a.Revenue), cmp.Compare(a.StoreID, b.StoreID))
+	})
+	return res, nil
+}
+
+// SalesByChannel ranks the channels purchases are ordered through by revenue.
+func (s *Service) SalesByChannel(ctx context.Context, q Query) ([]ChannelSales, error) {
+	totals, err := s.totalsBy(ctx, q, func(sale Sale) string { return sale.Channel })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ChannelSales, 0, len(totals))
+	for k, t := range totals {
+		res = append(res, ChannelSales{Channel: k.key, Totals: *t})
+	}
+	slices.SortFunc(res, func(a, b ChannelSales) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), cmp.Compare(b.Revenue, a.Revenue), cmp.Compare(a.Channel, b.Channel))
+	})
+	return res, nil
+}
+
+// AverageTicket is what a purchase is worth on average, in each currency.
+func (s *Service) AverageTicket(ctx context.Context, q Query) ([]Totals, error) {
+	totals, err := s.totalsBy(ctx, q, func(Sale) string { return "" })
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Totals, 0, len(totals))
+	for _, t := range totals {
+		res = append(res, *t)
+	}
+	slices.SortFunc(res, func(a, b Totals) int { return cmp.Compare(a.Currency, b.Currency) })
+	return res, nil
+}
+
+// SalesByProduct ranks the products by how many were sold.
+func (s *Service) SalesByProduct(ctx context.Context, q Query) ([]ProductSales, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	products := map[currencyKey[string]]*ProductSales{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		for _, l := range sale.Lines {
+			if l.Item == purchase.DeliveryFeeItem {
+				continue
+			}
+			k := currencyKey[string]{l.Item, sale.Currency}
+			if products[k] == nil {
+				products[k] = &ProductSales{Product: l.Item, Currency: sale.Currency}
+			}
+			products[k].Quantity++
+			products[k].Revenue += l.Amount
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ProductSales, 0, len(products))
+	for _, p := range products {
+		res = append(res, *p)
+	}
+	slices.SortFunc(res, func(a, b ProductSales) int {
+		return cmp.Or(cmp.Compare(b.Quantity, a.Quantity), cmp.Compare(a.Product, b.Product), cmp.Compare(a.Currency, b.Currency))
+	})
+	return res, nil
+}
+
+// Discounts tells whether discounted purchases are worth what they cost, undiscounted ones first.
+func (s *Service) Discounts(ctx context.Context, q Query) ([]DiscountSales, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[currencyKey[bool]]*DiscountSales{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		k := currencyKey[bool]{sale.Total < sale.ListPrice, sale.Currency}
+		if rows[k] == nil {
+			rows[k] = &DiscountSales{Discounted: k.key, Totals: Totals{Currency: sale.Currency}}
+		}
+		rows[k].add(sale)
+		rows[k].ListPrice += sale.ListPrice
+		rows[k].Given += sale.ListPrice - sale.Total
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]DiscountSales, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b DiscountSales) int {
+		if a.Discounted != b.Discounted {
+			if b.Discounted {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Currency, b.Currency)
+	})
+	return res, nil
+}
+
+// Loyalty tells, store by store, how many purchases are made by registered customers.
+func (s *Service) Loyalty(ctx context.Context, q Query) ([]LoyaltyConversion, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[string]*LoyaltyConversion{}
+	row := func(storeID string) *LoyaltyConversion {
+		if rows[storeID] == nil {
+			rows[storeID] = &LoyaltyConversion{StoreID: storeID}
+		}
+		return rows[storeID]
+	}
+	visits := map[[2]string]int{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		r := row(sale.StoreID)
+		r.Purchases++
+		if !sale.Member {
+			return nil
+		}
+		r.MemberPurchases++
+		// Erased customers still count as members, but can no longer be told apart.
+		if sale.CustomerID == "" {
+			return nil
+		}
+		k := [2]string{sale.StoreID, sale.CustomerID}
+		visits[k]++
+		switch visits[k] {
+		case 1:
+			r.Members++
+		case 2:
+			r.ReturningMembers++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.Redemptions(ctx, q, func(red Redemption) error {
+		row(red.StoreID).FreeDrinksRedeemed += red.Drinks
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]LoyaltyConversion, 0, len(rows))
+	for _, r := range rows {
+		if r.Purchases > 0 {
+			r.MemberShare = math.Round(float64(r.MemberPurchases)/float64(r.Purchases)*1000) / 1000
+		}
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b LoyaltyConversion) int { return cmp.Compare(a.StoreID, b.StoreID) })
+	return res, nil
+}
+
+// Settlements tells what each payee is owed, store first.
+func (s *Service) Settlements(ctx context.Context, q Query) ([]PayeeSettlement, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[currencyKey[string]]*PayeeSettlement{}
+	row := func(payee, currency string) *PayeeSettlement {
+		k := currencyKey[string]{payee, currency}
+		if rows[k] == nil {
+			rows[k] = &PayeeSettlement{Payee: payee, Currency: currency}
+		}
+		return rows[k]
+	}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		owed := map[string]bool{string(purchase.PayeeStore): true}
+		// Rounding was paid to the store, in cash.
+		row(string(purchase.PayeeStore), sale.Currency).Amount += sale.Total + sale.Rounding
+		for _, c := range sale.Charges {
+			r := row(c.Payee, sale.Currency)
+			r.Amount += c.Amount
+			r.Charges += c.Amount
+			owed[c.Payee] = true
+		}
+		for payee := range owed {
+			row(payee, sale.Currency).Purchases++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PayeeSettlement, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b PayeeSettlement) int {
+		return cmp.Or(cmp.Compare(a.Currency, b.Currency), cmp.Compare(payeeOrder(a.Payee), payeeOrder(b.Payee)), cmp.Compare(a.Payee, b.Payee))
+	})
+	return res, nil
+}
+
+// Rounding tells what rounding cash totals gained and lost each store each day, for finance to reconcile the
+// tills with the sales. Days come first, then stores.
+func (s *Service) Rounding(ctx context.Context, q Query) ([]StoreRounding, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	type storeDay struct{ storeID, day string }
+	rows := map[currencyKey[storeDay]]*StoreRounding{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		if sale.Rounding == 0 {
+			return nil
+		}
+		k := currencyKey[storeDay]{storeDay{sale.StoreID, sale.PurchasedAt.In(q.location()).Format(time.DateOnly)}, sale.Currency}
+		if rows[k] == nil {
+			rows[k] = &StoreRounding{StoreID: k.key.storeID, Day: k.key.day, Currency: sale.Currency}
+		}
+		r := rows[k]
+		r.Purchases++
+		if sale.Rounding > 0 {
+			r.Gained += sale.Rounding
+		} else {
+			r.Lost -= sale.Rounding
+		}
+		r.Net += sale.Rounding
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreRounding, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b StoreRounding) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.StoreID, b.StoreID), cmp.Compare(a.Currency, b.Currency))
+	})
+	return res, nil
+}
+
+// CashTaken tells what cash each store took, for the cash in its drawer to be reconciled with the sales.
+func (s *Service) CashTaken(ctx context.Context, q Query) ([]StoreCash, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[currencyKey[string]]*StoreCash{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		if sale.PaymentMeans != payment.MEANS_CASH {
+			return nil
+		}
+		k := currencyKey[string]{sale.StoreID, sale.Currency}
+		if rows[k] == nil {
+			rows[k] = &StoreCash{StoreID: sale.StoreID, Currency: sale.Currency}
+		}
+		rows[k].Purchases++
+		rows[k].Cash += sale.Total + sale.Rounding
+		for _, c := range sale.Charges {
+			rows[k].Cash += c.Amount
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreCash, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b StoreCash) int {
+		return cmp.Or(cmp.Compare(a.StoreID, b.StoreID), cmp.Compare(a.Currency, b.Currency))
+	})
+	return res, nil
+}
+
+// PriceOverrides tells, each day and store, how many prices managers overrode for each reason and what
+// they gave away. Days come first, then stores.
+func (s *Service) PriceOverrides(ctx context.Context, q Query) ([]StoreOverrides, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	type storeDayReason struct{ storeID, day, reason string }
+	rows := map[currencyKey[storeDayReason]]*StoreOverrides{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		for _, o := range sale.Overrides {
+			k := currencyKey[storeDayReason]{storeDayReason{sale.StoreID, sale.PurchasedAt.In(q.location()).Format(time.DateOnly), o.Reason}, sale.Currency}
+			if rows[k] == nil {
+				rows[k] = &StoreOverrides{StoreID: k.key.storeID, Day: k.key.day, Currency: sale.Currency, Reason: o.Reason}
+			}
+			rows[k].Overrides++
+			rows[k].Given += o.Given
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreOverrides, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b StoreOverrides) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.StoreID, b.StoreID), cmp.Compare(a.Currency, b.Currency), cmp.Compare(a.Reason, b.Reason))
+	})
+	return res, nil
+}
+
+// Taxes tells the sales tax each store collected, by rate: the default rate, or the one finance adjusted a
+// sale to.
+func (s *Service) Taxes(ctx context.Context, q Query) ([]StoreTax, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	type storeRate struct {
+		storeID string
+		rate    float64
+	}
+	rows := map[currencyKey[storeRate]]*StoreTax{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		rate := s.taxPercent
+		if sale.TaxPercent != nil {
+			rate = *sale.TaxPercent
+		}
+		k := currencyKey[storeRate]{storeRate{sale.StoreID, rate}, sale.Currency}
+		if rows[k] == nil {
+			rows[k] = &StoreTax{StoreID: sale.StoreID, Currency: sale.Currency, TaxPercent: rate}
+		}
+		r := rows[k]
+		r.Purchases++
+		r.Revenue += sale.Total
+		r.Tax += sale.Total - int64(math.Round(float64(sale.Total)*100/(100+rate)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreTax, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b StoreTax) int {
+		return cmp.Or(cmp.Compare(a.StoreID, b.StoreID), cmp.Compare(a.Currency, b.Currency), cmp.Compare(a.TaxPercent, b.TaxPercent))
+	})
+	return res, nil
+}
+
+// payeeOrder puts the store before everyone else it shares purchases with.
+func payeeOrder(payee string) int {
+	if payee == string(purchase.PayeeStore) {
+		return 0
+	}
+	return 1
+}
+
+// cups counts the reusable cups of a sale.
+func cups(sale Sale) int64 {
+	var n int64
+	for _, l := range sale.Lines {
+		if l.ReusableCup {
+			n++
+		}
+	}
+	return n
+}
+
+// CupsSavedByStore ranks the stores by the disposable cups their customers saved.
+func (s *Service) CupsSavedByStore(ctx context.Context, q Query) ([]StoreCups, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[string]*StoreCups{}
+	customers := map[[2]string]bool{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		n := cups(sale)
+		if n == 0 {
+			return nil
+		}
+		if rows[sale.StoreID] == nil {
+			rows[sale.StoreID] = &StoreCups{StoreID: sale.StoreID}
+		}
+		r := rows[sale.StoreID]
+		r.CupsSaved += n
+		r.Purchases++
+		if k := [2]string{sale.StoreID, sale.CustomerID}; sale.CustomerID != "" && !customers[k] {
+			customers[k] = true
+			r.Customers++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]StoreCups, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b StoreCups) int {
+		return cmp.Or(cmp.Compare(b.CupsSaved, a.CupsSaved), cmp.Compare(a.StoreID, b.StoreID))
+	})
+	return res, nil
+}
+
+// CupsSavedByCustomer ranks the registered customers by the disposable cups they saved. Anonymous
+// purchases and erased customers are left out.
+func (s *Service) CupsSavedByCustomer(ctx context.Context, q Query) ([]CustomerCups, error) {
+	if err := q.validate(); err != nil {
+		return nil, err
+	}
+	rows := map[string]*CustomerCups{}
+	err := s.sales(ctx, q, func(sale Sale) error {
+		n := cups(sale)
+		if n == 0 || sale.CustomerID == "" {
+			return nil
+		}
+		if rows[sale.CustomerID] == nil {
+			rows[sale.CustomerID] = &CustomerCups{CustomerID: sale.CustomerID}
+		}
+		rows[sale.CustomerID].CupsSaved += n
+		rows[sale.CustomerID].Purchases++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]CustomerCups, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, *r)
+	}
+	slices.SortFunc(res, func(a, b CustomerCups) int {
+		return cmp.Or(cmp.Compare(b.CupsSaved, a.CupsSaved), cmp.Compare(a.CustomerID, b.CustomerID))
+	})
+	return res, nil
+}
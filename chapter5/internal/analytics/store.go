@@ -0,0 +1,290 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// Store keeps the facts reports are computed from.
+type Store interface {
+	// SaveSale and SaveRedemption replace a fact saved before under the same ID.
+	SaveSale(ctx context.Context, s Sale) error
+	SaveRedemption(ctx context.Context, r Redemption) error
+	// SaveAdjustment replaces an adjustment saved before under the same ID.
+	SaveAdjustment(ctx context.Context, a Adjustment) error
+	// Sales and Redemptions call fn with every fact in q, in no particular order, stopping at the first
+	// error fn returns.
+	Sales(ctx context.Context, q Query, fn func(Sale) error) error
+	Redemptions(ctx context.Context, q Query, fn func(Redemption) error) error
+	// Adjustments calls fn with the adjustments of the sales made in q, of every store, oldest first.
+	Adjustments(ctx context.Context, q Query, fn func(Adjustment) error) error
+	// EraseCustomer forgets who made a customer's purchases, for privacy.Service. The sales still count.
+	EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error)
+	Reset(ctx context.Context) error
+	Ping(ctx context.Context) error
+}
+
+type MongoStore struct {
+	client      *mongo.Client
+	sales       *mongo.Collection
+	redemptions *mongo.Collection
+	adjustments *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	return &MongoStore{
+		client:      client,
+		sales:       db.Collection("rm_analytics_sales"),
+		redemptions: db.Collection("rm_analytics_redemptions"),
+		adjustments: db.Collection("rm_analytics_adjustments"),
+	}, nil
+}
+
+// Close disconnects from Mongo. The store cannot be used afterwards.
+func (m *MongoStore) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+func (m *MongoStore) SaveSale(ctx context.Context, s Sale) error {
+	_, err := m.sales.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.PurchaseID}}, s, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save sale: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) SaveRedemption(ctx context.Context, r Redemption) error {
+	_, err := m.redemptions.ReplaceOne(ctx, bson.D{{Key: "_id", Value: r.ID}}, r, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save redemption: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) SaveAdjustment(ctx context.Context, a Adjustment) error {
+	_, err := m.adjustments.ReplaceOne(ctx, bson.D{{Key: "_id", Value: a.ID}}, a, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save adjustment: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Sales(ctx context.Context, q Query, fn func(Sale) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "analytics.MongoStore.Sales", attribute.String("analytics.from", q.From.String()), attribute.String("analytics.to", q.To.String()))
+	defer telemetry.End(span, &err)
+	return each(ctx, m.sales, filter(q, "purchased_at"), fn)
+}
+
+func (m *MongoStore) Redemptions(ctx context.Context, q Query, fn func(Redemption) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "analytics.MongoStore.Redemptions", attribute.String("analytics.from", q.From.String()), attribute.String("analytics.to", q.To.String()))
+	defer telemetry.End(span, &err)
+	return each(ctx, m.redemptions, filter(q, "at"), fn)
+}
+
+func (m *MongoStore) Adjustments(ctx context.Context, q Query, fn func(Adjustment) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "analytics.MongoStore.Adjustments", attribute.String("analytics.from", q.From.String()), attribute.String("analytics.to", q.To.String()))
+	defer telemetry.End(span, &err)
+	f := bson.D{{Key: "purchased_at", Value: bson.D{{Key: "$gte", Value: q.From.UTC()}, {Key: "$lt", Value: q.To.UTC()}}}}
+	cur, err := m.adjustments.Find(ctx, f, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", m.adjustments.Name(), err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var a Adjustment
+		if err := cur.Decode(&a); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", m.adjustments.Name(), err)
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func filter(q Query, at string) bson.D {
+	f := bson.D{{Key: at, Value: bson.D{{Key: "$gte", Value: q.From.UTC()}, {Key: "$lt", Value: q.To.UTC()}}}}
+	if len(q.StoreIDs) > 0 {
+		ids := make([]string, 0, len(q.StoreIDs))
+		for _, id := range q.StoreIDs {
+			ids = append(ids, id.String())
+		}
+		f = append(f, bson.E{Key: "store_id", Value: bson.D{{Key: "$in", Value: ids}}})
+	}
+	return f
+}
+
+// each streams the documents, so a report over a long period does not hold every fact in memory.
+func each[T any](ctx context.Context, c *mongo.Collection, filter bson.D, fn func(T) error) error {
+	cur, err := c.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", c.Name(), err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc T
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", c.Name(), err)
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (m *MongoStore) EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error) {
+	res, err := m.sales.UpdateMany(ctx,
+		bson.D{{Key: "customer_id", Value: customerID.String()}},
+		bson.D{{Key: "$unset", Value: bson.D{{Key: "customer_id", Value: ""}}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to erase customer from sales: %w", err)
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (m *MongoStore) Reset(ctx context.Context) error {
+	for _, c := range []*mongo.Collection{m.sales, m.redemptions, m.adjustments} {
+		if err := c.Drop(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MongoStore) Ping(ctx context.Context) error {
+	if _, err := m.sales.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps facts in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu          sync.Mutex
+	sales       map[string]Sale
+	redemptions map[string]Redemption
+	adjustments map[string]Adjustment
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sales: map[string]Sale{}, redemptions: map[string]Redemption{}, adjustments: map[string]Adjustment{}}
+}
+
+func (m *MemoryStore) SaveSale(_ context.Context, s Sale) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Lines = slices.Clone(s.Lines)
+	m.sales[s.PurchaseID] = s
+	return nil
+}
+
+func (m *MemoryStore) SaveRedemption(_ context.Context, r Redemption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.redemptions[r.ID] = r
+	return nil
+}
+
+func (m *MemoryStore) SaveAdjustment(_ context.Context, a Adjustment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adjustments[a.ID] = a
+	return nil
+}
+
+func (m *MemoryStore) Adjustments(_ context.Context, q Query, fn func(Adjustment) error) error {
+	m.mu.Lock()
+	var res []Adjustment
+	for _, a := range m.adjustments {
+		if !a.PurchasedAt.Before(q.From) && a.PurchasedAt.Before(q.To) {
+			res = append(res, a)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].At.Before(res[j].At) })
+	for _, a := range res {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Sales(_ context.Context, q Query, fn func(Sale) error) error {
+	m.mu.Lock()
+	var res []Sale
+	for _, s := range m.sales {
+		if q.includes(s.StoreID, s.PurchasedAt) {
+			res = append(res, s)
+		}
+	}
+	m.mu.Unlock()
+	// Map order changes between runs; sorting keeps reports that depend on it reproducible.
+	sort.Slice(res, func(i, j int) bool { return res[i].PurchaseID < res[j].PurchaseID })
+	for _, s := range res {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Redemptions(_ context.Context, q Query, fn func(Redemption) error) error {
+	m.mu.Lock()
+	var res []Redemption
+	for _, r := range m.redemptions {
+		if q.includes(r.StoreID, r.At) {
+			res = append(res, r)
+		}
+	}
+	m.mu.Unlock()
+	for _, r := range res {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) EraseCustomer(_ context.Context, customerID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for id, s := range m.sales {
+		if s.CustomerID == customerID.String() {
+			s.CustomerID = ""
+			m.sales[id] = s
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryStore) Reset(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sales, m.redemptions, m.adjustments = map[string]Sale{}, map[string]Redemption{}, map[string]Adjustment{}
+	return nil
+}
+
+func (m *MemoryStore) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+)
+
+type Action string
+
+const (
+	ActionRefund                Action = "purchase.refund"
+	ActionLoyaltyAdjustment     Action = "loyalty.adjust"
+	ActionDiscountChange        Action = "store.set_discount"
+	ActionPaymentMeansChange    Action = "store.set_payment_means"
+	ActionCustomerErasure       Action = "privacy.erase_customer"
+	ActionPurchaseOrderApproval Action = "procurement.approve_order"
+	ActionWholesaleApproval     Action = "wholesale.approve_order"
+	ActionEntitlementGrant      Action = "entitlement.grant"
+	ActionEntitlementRevoke     Action = "entitlement.revoke"
+	ActionPurchaseReview        Action = "purchase.review"
+	ActionRefundRequest         Action = "refund.request"
+	ActionRefundDecision        Action = "refund.decide"
+	ActionPriceOverride         Action = "purchase.override_price"
+	ActionPurchaseAdjustment    Action = "purchase.adjust"
+	ActionRoyaltyDispute        Action = "royalty.dispute"
+	ActionRoyaltyResolve        Action = "royalty.resolve"
+	ActionDeviceRegister        Action = "device.register"
+	ActionDeviceRevoke          Action = "device.revoke"
+	ActionTargetSet             Action = "target.set"
+)
+
+// ActorSystem is the actor of changes nobody asked for directly, e.g. a refund made by a saga compensating
+// a failed purchase.
+const ActorSystem = "system"
+
+var ErrInvalidQuery = errors.New("an audit query needs a time range that ends after it starts")
+
+// Entry is one sensitive change. Entries are only ever added; nothing changes or removes them.
+type Entry struct {
+	ID            uuid.UUID `json:"id"`
+	At            time.Time `json:"at"`
+	Actor         string    `json:"actor"`
+	Action        Action    `json:"action"`
+	AggregateType string    `json:"aggregateType"`
+	AggregateID   string    `json:"aggregateId"`
+	// Before and After summarize what changed, e.g. "10%" and "15%" for a discount.
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	Note   string `json:"note,omitempty"`
+}
+
+// NewEntry fills in the ID, the time and, from ctx, the actor.
+func NewEntry(ctx context.Context, action Action, aggregateType, aggregateID, before, after string) Entry {
+	return Entry{
+		ID:            uuid.New(),
+		At:            time.Now().UTC(),
+		Actor:         Actor(ctx),
+		Action:        action,
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Before:        before,
+		After:         after,
+	}
+}
+
+// Query selects entries made in [From, To), by Actor if it is set, newest first.
+type Query struct {
+	Actor string
+	From  time.Time
+	To    time.Time
+	// Limit caps the entries returned; 0 means 100.
+	Limit int
+}
+
+const defaultLimit = 100
+
+func (q Query) validate() (Query, error) {
+	if q.From.IsZero() || !q.To.After(q.From) {
+		return q, ErrInvalidQuery
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	}
+	return q, nil
+}
+
+// Recorder is what services need to leave an audit trail.
+type Recorder interface {
+	Record(ctx context.Context, e Entry) error
+}
+
+type Repository interface {
+	Recorder
+	Query(ctx context.Context, q Query) ([]Entry, error)
+}
+
+type actorKey struct{}
+
+// WithActor says who is acting in ctx, for callers that are not authenticated requests, e.g. an operator
+// on the command line.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor is who is acting in ctx: the actor set with WithActor, else the subject of the authenticated
+// principal, else ActorSystem.
+func Actor(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	if p, ok := auth.FromContext(ctx); ok && p.Subject != "" {
+		return p.Subject
+	}
+	return ActorSystem
+}
@@ -0,0 +1,79 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/auth"
+)
+
+func Test_QueryFiltersByActorAndTimeRange(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		repo = audit.NewMemoryRepo()
+		now  = time.Now().UTC()
+	)
+	record := func(actor string, ago time.Duration) {
+		e := audit.NewEntry(audit.WithActor(ctx, actor), audit.ActionDiscountChange, "store", "s1", "10%", "15%")
+		e.At = now.Add(-ago)
+		_ = repo.Record(ctx, e)
+	}
+	record("sam", 3*time.Hour)
+	record("sam", time.Hour)
+	record("alex", time.Hour)
+	record("sam", 30*time.Minute)
+
+	tests := map[string]struct {
+		q    audit.Query
+		want int
+	}{
+		"everyone":        {q: audit.Query{From: now.Add(-4 * time.Hour), To: now}, want: 4},
+		"one actor":       {q: audit.Query{Actor: "sam", From: now.Add(-4 * time.Hour), To: now}, want: 3},
+		"last two hours":  {q: audit.Query{Actor: "sam", From: now.Add(-2 * time.Hour), To: now}, want: 2},
+		"limited":         {q: audit.Query{From: now.Add(-4 * time.Hour), To: now, Limit: 1}, want: 1},
+		"nobody in range": {q: audit.Query{From: now.Add(-10 * time.Hour), To: now.Add(-5 * time.Hour)}, want: 0},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := repo.Query(ctx, tt.q)
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("expected %d entries but got %d", tt.want, len(got))
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].At.After(got[i-1].At) {
+					t.Fatalf("expected the newest entries first but got %v before %v", got[i-1].At, got[i].At)
+				}
+			}
+		})
+	}
+}
+
+func Test_QueryNeedsATimeRange(t *testing.T) {
+	now := time.Now()
+	for _, q := range []audit.Query{{To: now}, {From: now, To: now.Add(-time.Hour)}} {
+		if _, err := audit.NewMemoryRepo().Query(context.Background(), q); !errors.Is(err, audit.ErrInvalidQuery) {
+			t.Fatalf("expected ErrInvalidQuery but got %v", err)
+		}
+	}
+}
+
+func Test_ActorPrefersTheExplicitActorThenThePrincipal(t *testing.T) {
+	ctx := context.Background()
+	if got := audit.Actor(ctx); got != audit.ActorSystem {
+		t.Fatalf("expected %q but got %q", audit.ActorSystem, got)
+	}
+	ctx = auth.WithPrincipal(ctx, auth.Principal{Subject: "admin-1"})
+	if got := audit.Actor(ctx); got != "admin-1" {
+		t.Fatalf("expected the principal but got %q", got)
+	}
+	ctx = audit.WithActor(ctx, "sam")
+	if got := audit.Actor(ctx); got != "sam" {
+		t.Fatalf("expected the explicit actor but got %q", got)
+	}
+}
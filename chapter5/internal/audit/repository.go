@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRepository keeps the audit log in its own collection. It only inserts; grant the service's database
+// user insert and find on it, not update or remove, to keep it that way.
+type MongoRepository struct {
+	client  *mongo.Client
+	entries *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	entries := client.Database("coffeeco").Collection("audit_log")
+	_, err = entries.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "at", Value: -1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log indexes: %w", err)
+	}
+	return &MongoRepository{client: client, entries: entries}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (r *MongoRepository) Close(ctx context.Context) error {
+	return r.client.Disconnect(ctx)
+}
+
+type mongoEntry struct {
+	ID            string    `bson:"_id"`
+	At            time.Time `bson:"at"`
+	Actor         string    `bson:"actor"`
+	Action        string    `bson:"action"`
+	AggregateType string    `bson:"aggregate_type"`
+	AggregateID   string    `bson:"aggregate_id"`
+	Before        string    `bson:"before,omitempty"`
+	After         string    `bson:"after,omitempty"`
+	Note          string    `bson:"note,omitempty"`
+}
+
+func toMongoEntry(e Entry) mongoEntry {
+	return mongoEntry{
+		ID:            e.ID.String(),
+		At:            e.At,
+		Actor:         e.Actor,
+		Action:        string(e.Action),
+		AggregateType: e.AggregateType,
+		AggregateID:   e.AggregateID,
+		Before:        e.Before,
+		After:         e.After,
+		Note:          e.Note,
+	}
+}
+
+func (m mongoEntry) toEntry() Entry {
+	id, _ := uuid.Parse(m.ID)
+	return Entry{
+		ID:            id,
+		At:            m.At,
+		Actor:         m.Actor,
+		Action:        Action(m.Action),
+		AggregateType: m.AggregateType,
+		AggregateID:   m.AggregateID,
+		Before:        m.Before,
+		After:         m.After,
+		Note:          m.Note,
+	}
+}
+
+func (r *MongoRepository) Record(ctx context.Context, e Entry) error {
+	if _, err := r.entries.InsertOne(ctx, toMongoEntry(e)); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+func (r *MongoRepository) Query(ctx context.Context, q Query) ([]Entry, error) {
+	q, err := q.validate()
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{Key: "at", Value: bson.D{{Key: "$gte", Value: q.From}, {Key: "$lt", Value: q.To}}}}
+	if q.Actor != "" {
+		filter = append(filter, bson.E{Key: "actor", Value: q.Actor})
+	}
+	cur, err := r.entries.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(int64(q.Limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	var docs []mongoEntry
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+	entries := make([]Entry, 0, len(docs))
+	for _, d := range docs {
+		entries = append(entries, d.toEntry())
+	}
+	return entries, nil
+}
+
+func (r *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := r.entries.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps the audit log in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func (m *MemoryRepository) Record(_ context.Context, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *MemoryRepository) Query(_ context.Context, q Query) ([]Entry, error) {
+	q, err := q.validate()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []Entry
+	for _, e := range m.entries {
+		if e.At.Before(q.From) || !e.At.Before(q.To) || (q.Actor != "" && e.Actor != q.Actor) {
+			continue
+		}
+		found = append(found, e)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].At.After(found[j].At) })
+	if len(found) > q.Limit {
+		found = found[:q.Limit]
+	}
+	return found, nil
+}
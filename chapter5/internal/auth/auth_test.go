@@ -0,0 +1,132 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+)
+
+const (
+	issuer   = "https://id.coffeeco.test"
+	audience = "coffeeco-api"
+)
+
+func sign(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	token, _ := jws.CompactSerialize()
+	return token
+}
+
+func Test_OIDCReadsRolesAndStores(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	authn := auth.NewStaticOIDC(issuer, audience, &key.PublicKey)
+	storeID := uuid.New()
+
+	p, err := authn.Authenticate(context.Background(), sign(t, key, map[string]any{
+		"iss": issuer, "aud": audience, "sub": "manager-1", "exp": time.Now().Add(time.Hour).Unix(),
+		"roles": []string{"store-manager"}, "stores": []string{storeID.String()},
+	}))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !p.Has(auth.RoleManager) || !p.WorksAt(storeID) {
+		t.Fatalf("expected a manager of %s but got %+v", storeID, p)
+	}
+}
+
+func Test_OIDCRejectsBadTokens(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	authn := auth.NewStaticOIDC(issuer, audience, &key.PublicKey)
+	valid := map[string]any{"iss": issuer, "aud": audience, "sub": uuid.NewString(), "exp": time.Now().Add(time.Hour).Unix()}
+
+	tests := map[string]string{
+		"wrong key":      sign(t, other, valid),
+		"wrong audience": sign(t, key, map[string]any{"iss": issuer, "aud": "someone-else", "exp": valid["exp"]}),
+		"expired":        sign(t, key, map[string]any{"iss": issuer, "aud": audience, "exp": time.Now().Add(-time.Hour).Unix()}),
+		"customer without customer ID": sign(t, key, map[string]any{
+			"iss": issuer, "aud": audience, "sub": "alice", "exp": valid["exp"], "roles": []string{"customer"},
+		}),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := authn.Authenticate(context.Background(), token); !errors.Is(err, auth.ErrUnauthenticated) {
+				t.Fatalf("expected ErrUnauthenticated but got %v", err)
+			}
+		})
+	}
+}
+
+func Test_Authorize(t *testing.T) {
+	soho, camden := uuid.New(), uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+	var (
+		customer = auth.Principal{Roles: []auth.Role{auth.RoleCustomer}, CustomerID: alice}
+		barista  = auth.Principal{Roles: []auth.Role{auth.RoleBarista}, Stores: []uuid.UUID{soho}}
+		manager  = auth.Principal{Roles: []auth.Role{auth.RoleManager}, Stores: []uuid.UUID{soho}}
+		admin    = auth.Principal{Roles: []auth.Role{auth.RoleAdmin}}
+		analyst  = auth.Principal{Roles: []auth.Role{auth.RoleAnalyst}}
+	)
+	tests := map[string]struct {
+		p       auth.Principal
+		a       auth.Action
+		r       auth.Resource
+		allowed bool
+	}{
+		"customer buys for themselves":     {customer, auth.ActionCreatePurchase, auth.Resource{StoreID: soho, CustomerID: alice}, true},
+		"customer buys for someone else":   {customer, auth.ActionCreatePurchase, auth.Resource{StoreID: soho, CustomerID: bob}, false},
+		"customer sees their own card":     {customer, auth.ActionViewCard, auth.Resource{StoreID: soho, CustomerID: alice}, true},
+		"customer cannot move orders":      {customer, auth.ActionUpdateStatus, auth.Resource{StoreID: soho, CustomerID: alice}, false},
+		"barista moves orders at store":    {barista, auth.ActionUpdateStatus, auth.Resource{StoreID: soho}, true},
+		"barista elsewhere":                {barista, auth.ActionUpdateStatus, auth.Resource{StoreID: camden}, false},
+		"barista works the tickets":        {barista, auth.ActionWorkTickets, auth.Resource{StoreID: soho}, true},
+		"barista cannot adjust cards":      {barista, auth.ActionAdjustCard, auth.Resource{StoreID: soho}, false},
+		"manager adjusts cards at store":   {manager, auth.ActionAdjustCard, auth.Resource{StoreID: soho, CustomerID: bob}, true},
+		"manager cannot manage other shop": {manager, auth.ActionManageStore, auth.Resource{StoreID: camden}, false},
+		"admin does anything":              {admin, auth.ActionManageStore, auth.Resource{StoreID: camden}, true},
+		"anyone lists stores":              {customer, auth.ActionListStores, auth.Resource{}, true},
+		"analyst sees every store":         {analyst, auth.ActionViewAnalytics, auth.Resource{}, true},
+		"analyst cannot see purchases":     {analyst, auth.ActionViewPurchase, auth.Resource{StoreID: soho}, false},
+		"manager sees analytics of store":  {manager, auth.ActionViewAnalytics, auth.Resource{StoreID: soho}, true},
+		"manager cannot see all stores":    {manager, auth.ActionViewAnalytics, auth.Resource{}, false},
+		"customer tops up their wallet":    {customer, auth.ActionTopUpWallet, auth.Resource{CustomerID: alice}, true},
+		"customer cannot refund to wallet": {customer, auth.ActionRefundWallet, auth.Resource{StoreID: soho, CustomerID: alice}, false},
+		"manager refunds to wallet":        {manager, auth.ActionRefundWallet, auth.Resource{StoreID: soho, CustomerID: bob}, true},
+		"customer shows their QR code":     {customer, auth.ActionIssueQRToken, auth.Resource{CustomerID: alice}, true},
+		"customer cannot scan QR codes":    {customer, auth.ActionRedeemQRToken, auth.Resource{StoreID: soho, CustomerID: alice}, false},
+		"barista scans QR codes at store":  {barista, auth.ActionRedeemQRToken, auth.Resource{StoreID: soho}, true},
+		"barista asks for a refund":        {barista, auth.ActionRequestRefund, auth.Resource{StoreID: soho}, true},
+		"barista cannot approve refunds":   {barista, auth.ActionApproveRefund, auth.Resource{StoreID: soho}, false},
+		"manager approves refunds":         {manager, auth.ActionApproveRefund, auth.Resource{StoreID: soho}, true},
+		"customer cannot ask for refunds":  {customer, auth.ActionRequestRefund, auth.Resource{StoreID: soho, CustomerID: alice}, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := auth.Authorize(tc.p, tc.a, tc.r)
+			if tc.allowed && err != nil {
+				t.Fatalf("expected to be allowed but got %v", err)
+			}
+			if !tc.allowed && !errors.Is(err, auth.ErrForbidden) {
+				t.Fatalf("expected ErrForbidden but got %v", err)
+			}
+		})
+	}
+}
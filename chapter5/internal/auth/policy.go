@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"github.com/google/uuid"
+)
+
+type Action string
+
+const (
+	ActionCreatePurchase Action = "purchase:create"
+	ActionImport         Action = "purchase:import"
+	ActionViewPurchase   Action = "purchase:view"
+	ActionUpdateStatus   Action = "purchase:update_status"
+	ActionReviewPurchase Action = "purchase:review"
+	ActionOverridePrice  Action = "purchase:override_price"
+	ActionFollowOrders   Action = "purchase:follow"
+	ActionWorkTickets    Action = "orders:work"
+	ActionManageTabs     Action = "tab:manage"
+	ActionViewCard       Action = "loyalty:view"
+	ActionAdjustCard     Action = "loyalty:adjust"
+	ActionListStores     Action = "store:list"
+	ActionManageStore    Action = "store:manage"
+	ActionViewAudit      Action = "audit:view"
+	ActionViewAnalytics  Action = "analytics:view"
+	ActionViewWallet     Action = "wallet:view"
+	ActionTopUpWallet    Action = "wallet:top_up"
+	ActionRefundWallet   Action = "wallet:refund"
+	ActionIssueQRToken   Action = "redemption:issue"
+	ActionRedeemQRToken  Action = "redemption:redeem"
+	ActionRequestRefund  Action = "refund:request"
+	ActionApproveRefund  Action = "refund:approve"
+	ActionAdjustPurchase Action = "purchase:adjust"
+	ActionManageRoyalty  Action = "royalty:manage"
+	ActionHandleCash     Action = "cash:handle"
+	ActionDepositCash    Action = "cash:deposit"
+	ActionPractise       Action = "purchase:practise"
+	ActionApproach       Action = "orders:approach"
+	ActionManageDevices  Action = "device:manage"
+	ActionManageTargets  Action = "target:manage"
+	ActionManageConsent  Action = "consent:manage"
+	ActionExportConsents Action = "consent:export"
+)
+
+// Resource is what an action is performed on. Fields that do not apply are uuid.Nil.
+type Resource struct {
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID
+}
+
+// Authorize decides whether p may perform a on r:
+//   - admins may do anything, and only admins may read the audit log and export marketing consents;
+//   - managers may do anything at the stores they manage, and baristas may take purchases, move them
+//     along, run the tabs of tables, scan QR codes, ask for refunds, run the cash drawer and practise in
+//     training mode at the stores they work at, while only managers approve refunds, override prices and
+//     bank the cash;
+//   - customers may buy for themselves, see their own purchases, orders, loyalty cards and wallets, top
+//     their wallets up, show QR codes on their device, tell their app orders they are close and opt in to
+//     or out of marketing;
+//   - analysts may see the analytics of every store, and finance may too, adjust how any purchase is
+//     reported and manage the franchisees' royalty statements;
+//   - anyone signed in may list the stores.
+func Authorize(p Principal, a Action, r Resource) error {
+	if p.Has(RoleAdmin) || a == ActionListStores {
+		return nil
+	}
+	if p.Has(RoleAnalyst) && a == ActionViewAnalytics {
+		return nil
+	}
+	if p.Has(RoleFinance) && (a == ActionViewAnalytics || a == ActionAdjustPurchase || a == ActionManageRoyalty) {
+		return nil
+	}
+	atStore := r.StoreID != uuid.Nil && p.WorksAt(r.StoreID)
+	if p.Has(RoleManager) && atStore {
+		return nil
+	}
+	if p.Has(RoleBarista) && atStore {
+		switch a {
+		case ActionCreatePurchase, ActionViewPurchase, ActionUpdateStatus, ActionWorkTickets, ActionManageTabs, ActionRedeemQRToken, ActionRequestRefund, ActionHandleCash, ActionPractise:
+			return nil
+		}
+	}
+	if p.Has(RoleCustomer) && r.CustomerID != uuid.Nil && r.CustomerID == p.CustomerID {
+		switch a {
+		case ActionCreatePurchase, ActionViewPurchase, ActionFollowOrders, ActionViewCard, ActionViewWallet, ActionTopUpWallet, ActionIssueQRToken, ActionApproach, ActionManageConsent:
+			return nil
+		}
+	}
+	return ErrForbidden
+}
@@ -0,0 +1,149 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned without calling the dependency while its breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type Settings struct {
+	// Failures is how many failures in a row open the breaker.
+	Failures int
+	// OpenFor is how long an open breaker fails fast before it lets probes through.
+	OpenFor time.Duration
+	// Probes is how many calls a half-open breaker lets through at once; if they all succeed it closes, if
+	// any fails it opens again.
+	Probes int
+	// IsFailure tells a failing dependency from one that answered no, e.g. a declined card. Nil counts every
+	// error except a cancelled context.
+	IsFailure func(error) bool
+}
+
+// Breaker stops calling a dependency that keeps failing, so callers fail fast instead of queueing up
+// behind timeouts, and tries it again after a while.
+type Breaker struct {
+	name     string
+	settings Settings
+	now      func() time.Time
+
+	mu         sync.Mutex
+	state      State
+	failures   int
+	openedAt   time.Time
+	probing    int
+	probesOK   int
+	generation uint64
+}
+
+func New(name string, s Settings) *Breaker {
+	if s.Failures <= 0 {
+		s.Failures = 5
+	}
+	if s.OpenFor <= 0 {
+		s.OpenFor = 30 * time.Second
+	}
+	if s.Probes <= 0 {
+		s.Probes = 1
+	}
+	if s.IsFailure == nil {
+		s.IsFailure = func(err error) bool { return !errors.Is(err, context.Canceled) }
+	}
+	return &Breaker{name: name, settings: s, now: time.Now}
+}
+
+// Do calls fn unless the breaker is open, and counts how it went.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	gen, err := b.before()
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	b.after(gen, err != nil && b.settings.IsFailure(err))
+	return err
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenIfDue()
+	return b.state
+}
+
+func (b *Breaker) before() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenIfDue()
+	switch {
+	case b.state == Open, b.state == HalfOpen && b.probing >= b.settings.Probes:
+		return 0, fmt.Errorf("%s: %w", b.name, ErrOpen)
+	case b.state == HalfOpen:
+		b.probing++
+	}
+	return b.generation, nil
+}
+
+func (b *Breaker) after(gen uint64, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		// The breaker changed state while the call was running; its outcome belongs to the old state.
+		return
+	}
+	switch b.state {
+	case Closed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		if b.failures++; b.failures >= b.settings.Failures {
+			b.setState(Open)
+		}
+	case HalfOpen:
+		b.probing--
+		if failed {
+			b.setState(Open)
+			return
+		}
+		if b.probesOK++; b.probesOK >= b.settings.Probes {
+			b.setState(Closed)
+		}
+	}
+}
+
+func (b *Breaker) halfOpenIfDue() {
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.settings.OpenFor {
+		b.setState(HalfOpen)
+	}
+}
+
+func (b *Breaker) setState(s State) {
+	b.state = s
+	b.generation++
+	b.failures, b.probing, b.probesOK = 0, 0, 0
+	if s == Open {
+		b.openedAt = b.now()
+	}
+}
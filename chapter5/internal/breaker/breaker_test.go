@@ -0,0 +1,107 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"coffeeco/internal/breaker"
+)
+
+var errDown = errors.New("gateway is down")
+
+func call(b *breaker.Breaker, err error) (called bool, got error) {
+	got = b.Do(context.Background(), func(context.Context) error {
+		called = true
+		return err
+	})
+	return called, got
+}
+
+func Test_BreakerOpensAndFailsFast(t *testing.T) {
+	b := breaker.New("stripe", breaker.Settings{Failures: 3, OpenFor: time.Hour})
+	for i := 0; i < 3; i++ {
+		call(b, errDown)
+	}
+	if b.State() != breaker.Open {
+		t.Fatalf("expected the breaker to be open but it is %s", b.State())
+	}
+	called, err := call(b, nil)
+	if called || !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("expected to fail fast without calling but called=%v err=%v", called, err)
+	}
+}
+
+func Test_SuccessResetsTheFailureCount(t *testing.T) {
+	b := breaker.New("stripe", breaker.Settings{Failures: 2, OpenFor: time.Hour})
+	call(b, errDown)
+	call(b, nil)
+	call(b, errDown)
+	if b.State() != breaker.Closed {
+		t.Fatalf("expected failures that are not in a row to keep the breaker closed but it is %s", b.State())
+	}
+}
+
+func Test_HalfOpenProbes(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe error
+		want  breaker.State
+	}{
+		{name: "probe succeeds", probe: nil, want: breaker.Closed},
+		{name: "probe fails", probe: errDown, want: breaker.Open},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := breaker.New("stores", breaker.Settings{Failures: 1, OpenFor: 10 * time.Millisecond, Probes: 1})
+			call(b, errDown)
+			time.Sleep(20 * time.Millisecond)
+			if b.State() != breaker.HalfOpen {
+				t.Fatalf("expected the breaker to be half-open but it is %s", b.State())
+			}
+			if called, _ := call(b, tt.probe); !called {
+				t.Fatal("expected the probe to be let through")
+			}
+			if b.State() != tt.want {
+				t.Fatalf("expected the breaker to be %s but it is %s", tt.want, b.State())
+			}
+		})
+	}
+}
+
+func Test_HalfOpenLimitsConcurrentProbes(t *testing.T) {
+	b := breaker.New("stores", breaker.Settings{Failures: 1, OpenFor: 10 * time.Millisecond, Probes: 1})
+	call(b, errDown)
+	time.Sleep(20 * time.Millisecond)
+
+	started, release, done := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = b.Do(context.Background(), func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	if called, err := call(b, nil); called || !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("expected a second probe to be turned away but called=%v err=%v", called, err)
+	}
+	close(release)
+	<-done
+	if b.State() != breaker.Closed {
+		t.Fatalf("expected the probe to close the breaker but it is %s", b.State())
+	}
+}
+
+func Test_IsFailureIgnoresAnswers(t *testing.T) {
+	declined := errors.New("card declined")
+	b := breaker.New("stripe", breaker.Settings{Failures: 1, IsFailure: func(err error) bool { return !errors.Is(err, declined) }})
+	if _, err := call(b, declined); !errors.Is(err, declined) {
+		t.Fatalf("expected the decline to be returned but got %v", err)
+	}
+	if b.State() != breaker.Closed {
+		t.Fatalf("expected a decline to keep the breaker closed but it is %s", b.State())
+	}
+}
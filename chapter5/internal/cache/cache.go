@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache keeps values by key for a while. It is only ever a copy: callers fall back to where a value comes
+// from when the cache fails.
+type Cache interface {
+	// Get reports whether key is cached.
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// LRU keeps values in process, evicting the least recently used once it holds size of them. Every instance
+// has its own, so it takes events to invalidate them all.
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type entry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRU keeps up to size values, expiring them by now, e.g. time.Now.
+func NewLRU(size int, now func() time.Time) *LRU {
+	return &LRU{size: max(size, 1), order: list.New(), items: map[string]*list.Element{}, now: now}
+}
+
+func (l *LRU) Get(_ context.Context, key string) ([]byte, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*entry)
+	if !l.now().Before(e.expiresAt) {
+		l.order.Remove(el)
+		delete(l.items, key)
+		return nil, false, nil
+	}
+	l.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (l *LRU) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expiresAt := l.now().Add(ttl)
+	if el, ok := l.items[key]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expiresAt = value, expiresAt
+		l.order.MoveToFront(el)
+		return nil
+	}
+	l.items[key] = l.order.PushFront(&entry{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*entry).key)
+	}
+	return nil
+}
+
+func (l *LRU) Delete(_ context.Context, keys ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := l.items[key]; ok {
+			l.order.Remove(el)
+			delete(l.items, key)
+		}
+	}
+	return nil
+}
+
+// Len is how many values are cached, expired or not.
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
@@ -0,0 +1,130 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/cache"
+	"coffeeco/internal/events"
+	"coffeeco/internal/store"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func Test_LRUEvictsTheLeastRecentlyUsedAndExpires(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)}
+	lru := cache.NewLRU(2, c.Now)
+
+	_ = lru.Set(ctx, "a", []byte("1"), time.Minute)
+	_ = lru.Set(ctx, "b", []byte("2"), time.Minute)
+	_, _, _ = lru.Get(ctx, "a")
+	_ = lru.Set(ctx, "c", []byte("3"), time.Minute)
+	if _, ok, _ := lru.Get(ctx, "b"); ok {
+		t.Fatal("expected b, used least recently, to be evicted")
+	}
+	if v, ok, _ := lru.Get(ctx, "a"); !ok || string(v) != "1" {
+		t.Fatalf("expected a to be kept but got %q", v)
+	}
+
+	c.now = c.now.Add(time.Minute)
+	if _, ok, _ := lru.Get(ctx, "c"); ok {
+		t.Fatal("expected c to expire after its TTL")
+	}
+	if lru.Len() != 1 {
+		t.Fatalf("expected the expired value dropped but %d are left", lru.Len())
+	}
+}
+
+// stores counts the lookups that reach the database.
+type stores struct {
+	store.Repository
+	discounts map[uuid.UUID]int64
+	catalog   map[uuid.UUID]store.Store
+	lookups   int
+}
+
+func (s *stores) GetStoreDiscount(_ context.Context, id uuid.UUID) (int64, error) {
+	s.lookups++
+	d, ok := s.discounts[id]
+	if !ok {
+		return 0, store.ErrNoDiscount
+	}
+	return d, nil
+}
+
+func (s *stores) GetStores(_ context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	s.lookups++
+	var res []store.Store
+	for _, id := range ids {
+		if st, ok := s.catalog[id]; ok {
+			res = append(res, st)
+		}
+	}
+	return res, nil
+}
+
+func (s *stores) SetStoreDiscount(_ context.Context, id uuid.UUID, d int64) error {
+	s.discounts[id] = d
+	return nil
+}
+
+func Test_StoreLookupsAreReadThroughAndInvalidatedByChanges(t *testing.T) {
+	ctx := context.Background()
+	repo := &stores{discounts: map[uuid.UUID]int64{}, catalog: map[uuid.UUID]store.Store{}}
+	discounted, plain := uuid.New(), uuid.New()
+	repo.discounts[discounted] = 10
+	repo.catalog[discounted] = store.New(discounted, "Soho", coffeeco.Product{ItemName: "latte", BasePrice: *money.New(450, "GBP")})
+	cached := cache.NewStores(repo, cache.NewLRU(100, time.Now), time.Minute)
+
+	for range 3 {
+		if d, err := cached.GetStoreDiscount(ctx, discounted); err != nil || d != 10 {
+			t.Fatalf("expected a 10%% discount but got %d, %v", d, err)
+		}
+		if _, err := cached.GetStoreDiscount(ctx, plain); !errors.Is(err, store.ErrNoDiscount) {
+			t.Fatalf("expected ErrNoDiscount but got %v", err)
+		}
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("expected each discount looked up once but there were %d lookups", repo.lookups)
+	}
+
+	for range 2 {
+		got, err := cached.GetStores(ctx, []uuid.UUID{plain, discounted})
+		if err != nil || len(got) != 1 || got[0].Location != "Soho" || got[0].ProductsForSale[0].BasePrice.Amount() != 450 {
+			t.Fatalf("expected the Soho store with its latte but got %+v, %v", got, err)
+		}
+	}
+	if repo.lookups != 3 {
+		t.Fatalf("expected the stores looked up once but there were %d lookups in all", repo.lookups)
+	}
+
+	// A change made here is seen at once.
+	if err := cached.SetStoreDiscount(ctx, plain, 5); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if d, _ := cached.GetStoreDiscount(ctx, plain); d != 5 {
+		t.Fatalf("expected the new 5%% discount but got %d", d)
+	}
+
+	// A change made elsewhere is seen once its event arrives.
+	repo.discounts[discounted] = 20
+	if d, _ := cached.GetStoreDiscount(ctx, discounted); d != 10 {
+		t.Fatalf("expected the cached 10%% discount until the event but got %d", d)
+	}
+	msg, _ := events.NewMessage(store.DiscountChanged{StoreID: discounted, Discount: 20}, events.JSONCodec{})
+	if err := cached.Handle(ctx, msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if d, _ := cached.GetStoreDiscount(ctx, discounted); d != 20 {
+		t.Fatalf("expected the 20%% discount after the event but got %d", d)
+	}
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis keeps values in Redis, shared by every instance, under "coffeeco:" keys.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects to url, e.g. redis://localhost:6379/0.
+func NewRedis(ctx context.Context, url string) (*Redis, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+	if err := client.Ping(ctx).Err(); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return &Redis{client: client}, nil
+}
+
+// Close disconnects from Redis. The cache cannot be used afterwards.
+func (r *Redis) Close(context.Context) error {
+	return r.client.Close()
+}
+
+func key(k string) string {
+	return "coffeeco:" + k
+}
+
+func (r *Redis) Get(ctx context.Context, k string) ([]byte, bool, error) {
+	v, err := r.client.Get(ctx, key(k)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get %s from redis: %w", k, err)
+	}
+	return v, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, k string, value []byte, ttl time.Duration) error {
+	if err := r.client.Set(ctx, key(k), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set %s in redis: %w", k, err)
+	}
+	return nil
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, 0, len(keys))
+	for _, k := range keys {
+		prefixed = append(prefixed, key(k))
+	}
+	if err := r.client.Del(ctx, prefixed...).Err(); err != nil {
+		return fmt.Errorf("failed to delete from redis: %w", err)
+	}
+	return nil
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("failed to ping redis: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/events"
+	"coffeeco/internal/store"
+)
+
+// DefaultTTL is how long store lookups are cached when no TTL is configured. Changes made through the
+// store service invalidate them sooner, so it only bounds how stale a missed invalidation leaves them.
+const DefaultTTL = 5 * time.Minute
+
+// none is cached for stores without a discount, or that do not exist, which most lookups are.
+var none = []byte("none")
+
+// Recorder is told whether each lookup was cached, e.g. metrics.Metrics.
+type Recorder interface {
+	CacheLookup(cache string, hit bool)
+}
+
+type noRecorder struct{}
+
+func (noRecorder) CacheLookup(string, bool) {}
+
+// Stores is a read-through cache of the store lookups made on every purchase: discounts and what stores
+// sell. The other lookups and the writes go to the repository, and writes invalidate what they change.
+type Stores struct {
+	store.Repository
+	cache    Cache
+	ttl      atomic.Int64
+	registry *events.Registry
+	recorder Recorder
+	logger   *slog.Logger
+}
+
+type Option func(s *Stores)
+
+func WithRecorder(r Recorder) Option {
+	return func(s *Stores) {
+		s.recorder = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Stores) {
+		s.logger = l
+	}
+}
+
+// NewStores caches the lookups of repo in c for ttl, or DefaultTTL if ttl is not positive.
+func NewStores(repo store.Repository, c Cache, ttl time.Duration, opts ...Option) *Stores {
+	s := &Stores{Repository: repo, cache: c, recorder: noRecorder{}, logger: slog.Default()}
+	s.SetTTL(ttl)
+	s.registry = events.NewRegistry()
+	store.RegisterEvents(s.registry)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SetTTL changes how long lookups made from now on are cached, e.g. when the config file changes.
+func (s *Stores) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	s.ttl.Store(int64(ttl))
+}
+
+func discountKey(storeID uuid.UUID) string {
+	return "store:" + storeID.String() + ":discount"
+}
+
+func storeKey(storeID uuid.UUID) string {
+	return "store:" + storeID.String()
+}
+
+// get returns what is cached under key. A cache that fails is logged and taken as a miss.
+func (s *Stores) get(ctx context.Context, key string) ([]byte, bool) {
+	v, ok, err := s.cache.Get(ctx, key)
+	if err != nil {
+		s.logger.WarnContext(ctx, "store cache unavailable", "key", key, "error", err)
+	}
+	s.recorder.CacheLookup("stores", ok)
+	return v, ok
+}
+
+func (s *Stores) set(ctx context.Context, key string, v []byte) {
+	if err := s.cache.Set(ctx, key, v, time.Duration(s.ttl.Load())); err != nil {
+		s.logger.WarnContext(ctx, "store lookup not cached", "key", key, "error", err)
+	}
+}
+
+func (s *Stores) GetStoreDiscount(ctx context.Context, storeID uuid.UUID) (int64, error) {
+	if v, ok := s.get(ctx, discountKey(storeID)); ok {
+		return decodeDiscount(v)
+	}
+	d, err := s.Repository.GetStoreDiscount(ctx, storeID)
+	switch {
+	case errors.Is(err, store.ErrNoDiscount):
+		s.set(ctx, discountKey(storeID), none)
+	case err == nil:
+		s.set(ctx, discountKey(storeID), strconv.AppendInt(nil, d, 10))
+	}
+	return d, err
+}
+
+func decodeDiscount(v []byte) (int64, error) {
+	if string(v) == string(none) {
+		return 0, store.ErrNoDiscount
+	}
+	return strconv.ParseInt(string(v), 10, 64)
+}
+
+// GetStoreDiscounts looks up only the discounts that are not cached, all at once.
+func (s *Stores) GetStoreDiscounts(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+	res := make(map[uuid.UUID]int64, len(ids))
+	var missed []uuid.UUID
+	for _, id := range ids {
+		v, ok := s.get(ctx, discountKey(id))
+		if !ok {
+			missed = append(missed, id)
+			continue
+		}
+		if d, err := decodeDiscount(v); err == nil {
+			res[id] = d
+		}
+	}
+	if len(missed) == 0 {
+		return res, nil
+	}
+	found, err := s.Repository.GetStoreDiscounts(ctx, missed)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range missed {
+		d, ok := found[id]
+		if !ok {
+			s.set(ctx, discountKey(id), none)
+			continue
+		}
+		res[id] = d
+		s.set(ctx, discountKey(id), strconv.AppendInt(nil, d, 10))
+	}
+	return res, nil
+}
+
+// cachedStore exists because money.Money has no exported fields, so it cannot be encoded as is.
+type cachedStore struct {
+	Location string          `json:"location"`
+	Products []cachedProduct `json:"products"`
+}
+
+type cachedProduct struct {
+	ItemName string `json:"item_name"`
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+}
+
+func encodeStore(st store.Store) []byte {
+	c := cachedStore{Location: st.Location, Products: make([]cachedProduct, 0, len(st.ProductsForSale))}
+	for _, p := range st.ProductsForSale {
+		c.Products = append(c.Products, cachedProduct{ItemName: p.ItemName, Price: p.BasePrice.Amount(), Currency: p.BasePrice.Currency().Code})
+	}
+	v, _ := json.Marshal(c)
+	return v
+}
+
+func decodeStore(id uuid.UUID, v []byte) (store.Store, error) {
+	var c cachedStore
+	if err := json.Unmarshal(v, &c); err != nil {
+		return store.Store{}, err
+	}
+	st := store.New(id, c.Location, make([]coffeeco.Product, 0, len(c.Products))...)
+	for _, p := range c.Products {
+		st.ProductsForSale = append(st.ProductsForSale, coffeeco.Product{ItemName: p.ItemName, BasePrice: *money.New(p.Price, p.Currency)})
+	}
+	return st, nil
+}
+
+// GetStores looks up only the stores that are not cached, all at once, and keeps the order of ids.
+func (s *Stores) GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	byID := make(map[uuid.UUID]store.Store, len(ids))
+	var missed []uuid.UUID
+	for _, id := range ids {
+		v, ok := s.get(ctx, storeKey(id))
+		if !ok {
+			missed = append(missed, id)
+			continue
+		}
+		if string(v) == string(none) {
+			continue
+		}
+		st, err := decodeStore(id, v)
+		if err != nil {
+			missed = append(missed, id)
+			continue
+		}
+		byID[id] = st
+	}
+	if len(missed) > 0 {
+		found, err := s.Repository.GetStores(ctx, missed)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range found {
+			byID[st.ID] = st
+			s.set(ctx, storeKey(st.ID), encodeStore(st))
+		}
+		for _, id := range missed {
+			if _, ok := byID[id]; !ok {
+				s.set(ctx, storeKey(id), none)
+			}
+		}
+	}
+	stores := make([]store.Store, 0, len(byID))
+	for _, id := range ids {
+		if st, ok := byID[id]; ok {
+			stores = append(stores, st)
+			delete(byID, id)
+		}
+	}
+	return stores, nil
+}
+
+func (s *Stores) SaveStore(ctx context.Context, st store.Store) error {
+	if err := s.Repository.SaveStore(ctx, st); err != nil {
+		return err
+	}
+	return s.Invalidate(ctx, st.ID)
+}
+
+func (s *Stores) SetStoreDiscount(ctx context.Context, storeID uuid.UUID, discount int64) error {
+	if err := s.Repository.SetStoreDiscount(ctx, storeID, discount); err != nil {
+		return err
+	}
+	return s.Invalidate(ctx, storeID)
+}
+
+// Invalidate forgets what is cached about a store.
+func (s *Stores) Invalidate(ctx context.Context, storeID uuid.UUID) error {
+	return s.cache.Delete(ctx, storeKey(storeID), discountKey(storeID))
+}
+
+// Handle invalidates the stores that changed elsewhere, e.g. through coffeectl, from the store events.
+func (s *Stores) Handle(ctx context.Context, msg events.Message) error {
+	e, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch e := e.(type) {
+	case store.CatalogChanged:
+		return s.Invalidate(ctx, e.StoreID)
+	case store.DiscountChanged:
+		return s.Invalidate(ctx, e.StoreID)
+	}
+	return nil
+}
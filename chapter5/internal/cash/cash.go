@@ -0,0 +1,211 @@
+package cash
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("drawer session not found")
+	// ErrDrawerOpen means the store's drawer was opened and not closed since; a store has one drawer.
+	ErrDrawerOpen = errors.New("the store's drawer is already open")
+	// ErrDrawerClosed means the store's drawer is not open, its cash was counted when it was closed.
+	ErrDrawerClosed  = errors.New("the store's drawer is closed")
+	ErrInvalidAmount = errors.New("cash amounts must be positive")
+	ErrCurrency      = errors.New("cash is not in the currency of the drawer")
+	ErrNoBag         = errors.New("safe drops need the number of their bag")
+	ErrNoSlip        = errors.New("deposits need the number of their bank slip")
+	ErrNoActor       = errors.New("cash is only handled by someone signed in")
+	// ErrConcurrencyConflict means the session, or the store's deposits, changed since they were read.
+	ErrConcurrencyConflict = errors.New("cash changed since it was read")
+)
+
+// Policy tells which discrepancies are flagged to the store's manager: those over Threshold, in the minor
+// unit of Currency, either way. Any discrepancy in another currency is flagged.
+type Policy struct {
+	Currency  string
+	Threshold int64
+}
+
+func (p Policy) flags(currency string, discrepancy int64) bool {
+	if discrepancy == 0 {
+		return false
+	}
+	return currency != p.Currency || max(discrepancy, -discrepancy) > p.Threshold
+}
+
+// Drop is cash taken out of the drawer into a sealed bag in the safe, to be banked.
+type Drop struct {
+	Currency string
+	Amount   int64
+	Bag      string
+	By       string
+	At       time.Time
+}
+
+// Session is the time a store's drawer is open, from the float it starts with to the cash counted in it
+// when it is closed. Amounts are in the minor unit of Currency.
+type Session struct {
+	ID       uuid.UUID
+	StoreID  uuid.UUID
+	Currency string
+	Float    int64
+	OpenedBy string
+	OpenedAt time.Time
+	Drops    []Drop
+	// ClosedAt is zero while the drawer is open. CashSales is what the cash purchases of the store took
+	// while it was, and Counted the cash in it then.
+	ClosedAt  time.Time
+	ClosedBy  string
+	CashSales int64
+	Counted   int64
+	Note      string
+	// Flagged tells whether the discrepancy was over the policy's threshold.
+	Flagged bool
+
+	version int
+}
+
+// Open starts a session with the float counted into the drawer, which may be nothing.
+func Open(storeID uuid.UUID, float money.Money, by string, at time.Time) (*Session, error) {
+	if by == "" {
+		return nil, ErrNoActor
+	}
+	if float.IsNegative() {
+		return nil, fmt.Errorf("%w: the float is %s", ErrInvalidAmount, float.Display())
+	}
+	return &Session{
+		ID:       uuid.New(),
+		StoreID:  storeID,
+		Currency: float.Currency().Code,
+		Float:    float.Amount(),
+		OpenedBy: by,
+		OpenedAt: at.UTC(),
+	}, nil
+}
+
+func (s *Session) Closed() bool {
+	return !s.ClosedAt.IsZero()
+}
+
+// Dropped is what was taken to the safe during the session.
+func (s *Session) Dropped() int64 {
+	var sum int64
+	for _, d := range s.Drops {
+		sum += d.Amount
+	}
+	return sum
+}
+
+// Expected is the cash that should be in the drawer once it is closed.
+func (s *Session) Expected() int64 {
+	return s.Float + s.CashSales - s.Dropped()
+}
+
+// Discrepancy is what the counted cash is over what was expected, negative if it is short.
+func (s *Session) Discrepancy() int64 {
+	if !s.Closed() {
+		return 0
+	}
+	return s.Counted - s.Expected()
+}
+
+// Drop takes cash out of the open drawer to the safe.
+func (s *Session) Drop(amount money.Money, bag, by string, at time.Time) error {
+	if err := s.handle(amount, by); err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		return fmt.Errorf("%w: the drop is %s", ErrInvalidAmount, amount.Display())
+	}
+	if bag == "" {
+		return ErrNoBag
+	}
+	s.Drops = append(s.Drops, Drop{Currency: s.Currency, Amount: amount.Amount(), Bag: bag, By: by, At: at.UTC()})
+	return nil
+}
+
+// Close records the cash counted in the drawer and what the cash purchases took since it was opened,
+// flagging the discrepancy if p does.
+func (s *Session) Close(counted money.Money, cashSales int64, note, by string, at time.Time, p Policy) error {
+	if err := s.handle(counted, by); err != nil {
+		return err
+	}
+	if counted.IsNegative() {
+		return fmt.Errorf("%w: %s was counted", ErrInvalidAmount, counted.Display())
+	}
+	s.ClosedAt, s.ClosedBy, s.Note = at.UTC(), by, note
+	s.CashSales, s.Counted = cashSales, counted.Amount()
+	s.Flagged = p.flags(s.Currency, s.Discrepancy())
+	return nil
+}
+
+func (s *Session) handle(amount money.Money, by string) error {
+	if by == "" {
+		return ErrNoActor
+	}
+	if s.Closed() {
+		return ErrDrawerClosed
+	}
+	if amount.Currency().Code != s.Currency {
+		return fmt.Errorf("%w: %s is not %s", ErrCurrency, amount.Currency().Code, s.Currency)
+	}
+	return nil
+}
+
+// Deposit is cash of a store banked at once: every safe drop made since the previous deposit, whose sum is
+// Expected. Amounts are in the minor unit of Currency.
+type Deposit struct {
+	ID       uuid.UUID
+	StoreID  uuid.UUID
+	Currency string
+	Amount   int64
+	// Slip is the number of the bank's deposit slip.
+	Slip string
+	By   string
+	At   time.Time
+	// Since is when the previous deposit of the store was made, zero for its first.
+	Since    time.Time
+	Drops    int
+	Expected int64
+	Flagged  bool
+}
+
+// NewDeposit reconciles the cash banked with the drops made since the previous deposit, flagging the
+// discrepancy if p does.
+func NewDeposit(storeID uuid.UUID, amount money.Money, slip, by string, at, since time.Time, drops []Drop, p Policy) (*Deposit, error) {
+	if by == "" {
+		return nil, ErrNoActor
+	}
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("%w: the deposit is %s", ErrInvalidAmount, amount.Display())
+	}
+	if slip == "" {
+		return nil, ErrNoSlip
+	}
+	d := &Deposit{
+		ID:       uuid.New(),
+		StoreID:  storeID,
+		Currency: amount.Currency().Code,
+		Amount:   amount.Amount(),
+		Slip:     slip,
+		By:       by,
+		At:       at.UTC(),
+		Since:    since,
+		Drops:    len(drops),
+	}
+	for _, drop := range drops {
+		d.Expected += drop.Amount
+	}
+	d.Flagged = p.flags(d.Currency, d.Discrepancy())
+	return d, nil
+}
+
+// Discrepancy is what was banked over the drops, negative if it is short.
+func (d *Deposit) Discrepancy() int64 {
+	return d.Amount - d.Expected
+}
@@ -0,0 +1,127 @@
+package cash_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/cash"
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+// managers are the discrepancies the managers were told about.
+type managers struct {
+	told []cash.Discrepancy
+}
+
+func (m *managers) CashDiscrepancy(_ context.Context, d cash.Discrepancy) error {
+	m.told = append(m.told, d)
+	return nil
+}
+
+func Test_DrawersAndDepositsAreReconciledWithTheCashTaken(t *testing.T) {
+	ctx := context.Background()
+	soho, camden := uuid.New(), uuid.New()
+	monday := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+
+	facts := analytics.NewMemoryStore()
+	f := analytics.NewFacts(facts)
+	sell := func(storeID uuid.UUID, means string, total, rounding int64, at time.Time) {
+		t.Helper()
+		e := purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, PaymentMeans: means, Total: total, Rounding: rounding, Currency: "GBP", PurchasedAt: at}
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := f.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+
+	now := monday
+	told := &managers{}
+	svc := cash.NewService(cash.NewMemoryRepo(), analytics.NewService(facts), cash.Policy{Currency: "GBP", Threshold: 500},
+		cash.WithNotifier(told), cash.WithClock(func() time.Time { return now }))
+	barista, manager := audit.WithActor(ctx, "barista-1"), audit.WithActor(ctx, "manager-1")
+	gbp := func(pence int64) money.Money { return *money.New(pence, "GBP") }
+
+	if _, err := svc.Open(barista, soho, gbp(10000)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Open(barista, soho, gbp(10000)); !errors.Is(err, cash.ErrDrawerOpen) {
+		t.Fatalf("expected ErrDrawerOpen but got %v", err)
+	}
+	sell(soho, payment.MEANS_CASH, 3000, -2, monday.Add(time.Hour))
+	sell(soho, payment.MEANS_CARD, 9900, 0, monday.Add(time.Hour))
+	sell(camden, payment.MEANS_CASH, 9900, 0, monday.Add(time.Hour))
+	now = monday.Add(2 * time.Hour)
+	if _, err := svc.Drop(barista, soho, gbp(2000), "B-1"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Drop(barista, soho, *money.New(2000, "EUR"), "B-2"); !errors.Is(err, cash.ErrCurrency) {
+		t.Fatalf("expected ErrCurrency but got %v", err)
+	}
+	now = monday.Add(8 * time.Hour)
+	session, err := svc.Close(barista, soho, gbp(10950), "")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if session.CashSales != 3000 || session.Expected() != 11000 || session.Discrepancy() != -50 || session.Flagged {
+		t.Fatalf("expected £110.00 in the drawer, 50p short and not flagged, but got %+v", session)
+	}
+	if _, err := svc.Drop(barista, soho, gbp(1000), "B-2"); !errors.Is(err, cash.ErrDrawerClosed) {
+		t.Fatalf("expected ErrDrawerClosed but got %v", err)
+	}
+
+	tuesday := monday.AddDate(0, 0, 1)
+	now = tuesday
+	if _, err := svc.Open(barista, soho, gbp(10000)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	sell(soho, payment.MEANS_CASH, 5000, 0, tuesday.Add(time.Hour))
+	now = tuesday.Add(2 * time.Hour)
+	if _, err := svc.Drop(barista, soho, gbp(1000), "B-2"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	now = tuesday.Add(8 * time.Hour)
+	session, err = svc.Close(barista, soho, gbp(13000), "till roll jammed")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if session.Discrepancy() != -1000 || !session.Flagged {
+		t.Fatalf("expected the drawer £10.00 short and flagged but got %+v", session)
+	}
+	if n := len(told.told); n != 1 {
+		t.Fatalf("expected the manager told about the drawer but got %d discrepancies", n)
+	}
+
+	// Both bags of the safe are banked at once; what is banked later has no drops left to match.
+	now = tuesday.Add(9 * time.Hour)
+	d, err := svc.Deposit(manager, soho, gbp(3000), "SLIP-1")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if d.Drops != 2 || d.Expected != 3000 || d.Flagged {
+		t.Fatalf("expected both drops banked but got %+v", d)
+	}
+	now = tuesday.Add(10 * time.Hour)
+	if d, err = svc.Deposit(manager, soho, gbp(1000), "SLIP-2"); err != nil || !d.Flagged || d.Expected != 0 {
+		t.Fatalf("expected a deposit without drops flagged but got %+v and %v", d, err)
+	}
+	if last := told.told[len(told.told)-1]; last.Kind != "deposit" || last.Difference() != 1000 {
+		t.Fatalf("expected the manager told about the deposit but got %+v", last)
+	}
+
+	sessions, err := svc.Sessions(ctx, soho, monday, tuesday.AddDate(0, 0, 1))
+	if err != nil || len(sessions) != 2 || sessions[0].Flagged || !sessions[1].Flagged {
+		t.Fatalf("expected Tuesday's session flagged but got %v and %v", sessions, err)
+	}
+}
@@ -0,0 +1,465 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Current returns the open session of the store, or ErrNotFound if its drawer is closed.
+	Current(ctx context.Context, storeID uuid.UUID) (*Session, error)
+	// Save returns ErrDrawerOpen if a new session is saved while another of the store is open, and
+	// ErrConcurrencyConflict if the session was saved by someone else since it was read.
+	Save(ctx context.Context, s *Session) error
+	// Sessions returns the sessions of a store opened in [from, to), earliest first.
+	Sessions(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*Session, error)
+	// Drops returns the safe drops made at a store in [from, to), earliest first.
+	Drops(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]Drop, error)
+	// LastDeposit returns the latest deposit of the store, or ErrNotFound if it made none.
+	LastDeposit(ctx context.Context, storeID uuid.UUID) (*Deposit, error)
+	// AddDeposit returns ErrConcurrencyConflict if another deposit of the store was made since the one it
+	// follows.
+	AddDeposit(ctx context.Context, d *Deposit) error
+	// Deposits returns the deposits of a store made in [from, to), earliest first.
+	Deposits(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*Deposit, error)
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client   *mongo.Client
+	sessions *mongo.Collection
+	deposits *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	sessions, deposits := db.Collection("drawer_sessions"), db.Collection("cash_deposits")
+	_, err = sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "opened_at", Value: 1}}},
+		// A store has one drawer, open once at a time.
+		{
+			Keys:    bson.D{{Key: "store_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "open", Value: true}}),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create drawer session indexes: %w", err)
+	}
+	// Each deposit follows the previous one of its store, so two made at once do not bank the same drops.
+	_, err = deposits.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "store_id", Value: 1}, {Key: "since", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cash deposit indexes: %w", err)
+	}
+	return &MongoRepository{client: client, sessions: sessions, deposits: deposits}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoDrop struct {
+	Currency string    `bson:"currency"`
+	Amount   int64     `bson:"amount"`
+	Bag      string    `bson:"bag"`
+	By       string    `bson:"by"`
+	At       time.Time `bson:"at"`
+}
+
+type mongoSession struct {
+	ID        string      `bson:"_id"`
+	Version   int         `bson:"version"`
+	StoreID   string      `bson:"store_id"`
+	Open      bool        `bson:"open,omitempty"`
+	Currency  string      `bson:"currency"`
+	Float     int64       `bson:"float"`
+	OpenedBy  string      `bson:"opened_by"`
+	OpenedAt  time.Time   `bson:"opened_at"`
+	Drops     []mongoDrop `bson:"drops,omitempty"`
+	ClosedAt  time.Time   `bson:"closed_at,omitempty"`
+	ClosedBy  string      `bson:"closed_by,omitempty"`
+	CashSales int64       `bson:"cash_sales,omitempty"`
+	Counted   int64       `bson:"counted,omitempty"`
+	Note      string      `bson:"note,omitempty"`
+	Flagged   bool        `bson:"flagged,omitempty"`
+}
+
+func toMongoSession(s *Session) mongoSession {
+	doc := mongoSession{
+		ID:        s.ID.String(),
+		Version:   s.version,
+		StoreID:   s.StoreID.String(),
+		Open:      !s.Closed(),
+		Currency:  s.Currency,
+		Float:     s.Float,
+		OpenedBy:  s.OpenedBy,
+		OpenedAt:  s.OpenedAt,
+		ClosedAt:  s.ClosedAt,
+		ClosedBy:  s.ClosedBy,
+		CashSales: s.CashSales,
+		Counted:   s.Counted,
+		Note:      s.Note,
+		Flagged:   s.Flagged,
+	}
+	for _, d := range s.Drops {
+		doc.Drops = append(doc.Drops, mongoDrop(d))
+	}
+	return doc
+}
+
+func (m mongoSession) toSession() *Session {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	s := &Session{
+		ID:        id,
+		StoreID:   storeID,
+		Currency:  m.Currency,
+		Float:     m.Float,
+		OpenedBy:  m.OpenedBy,
+		OpenedAt:  m.OpenedAt.UTC(),
+		ClosedBy:  m.ClosedBy,
+		CashSales: m.CashSales,
+		Counted:   m.Counted,
+		Note:      m.Note,
+		Flagged:   m.Flagged,
+		version:   m.Version,
+	}
+	if !m.ClosedAt.IsZero() {
+		s.ClosedAt = m.ClosedAt.UTC()
+	}
+	for _, d := range m.Drops {
+		d.At = d.At.UTC()
+		s.Drops = append(s.Drops, Drop(d))
+	}
+	return s
+}
+
+type mongoDeposit struct {
+	ID       string    `bson:"_id"`
+	StoreID  string    `bson:"store_id"`
+	Currency string    `bson:"currency"`
+	Amount   int64     `bson:"amount"`
+	Slip     string    `bson:"slip"`
+	By       string    `bson:"by"`
+	At       time.Time `bson:"at"`
+	Since    time.Time `bson:"since"`
+	Drops    int       `bson:"drops"`
+	Expected int64     `bson:"expected"`
+	Flagged  bool      `bson:"flagged,omitempty"`
+}
+
+func toMongoDeposit(d *Deposit) mongoDeposit {
+	return mongoDeposit{
+		ID:       d.ID.String(),
+		StoreID:  d.StoreID.String(),
+		Currency: d.Currency,
+		Amount:   d.Amount,
+		Slip:     d.Slip,
+		By:       d.By,
+		At:       d.At,
+		Since:    d.Since,
+		Drops:    d.Drops,
+		Expected: d.Expected,
+		Flagged:  d.Flagged,
+	}
+}
+
+func (m mongoDeposit) toDeposit() *Deposit {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	d := &Deposit{
+		ID:       id,
+		StoreID:  storeID,
+		Currency: m.Currency,
+		Amount:   m.Amount,
+		Slip:     m.Slip,
+		By:       m.By,
+		At:       m.At.UTC(),
+		Drops:    m.Drops,
+		Expected: m.Expected,
+		Flagged:  m.Flagged,
+	}
+	if !m.Since.IsZero() {
+		d.Since = m.Since.UTC()
+	}
+	return d
+}
+
+func (m *MongoRepository) Current(ctx context.Context, storeID uuid.UUID) (_ *Session, err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.Current", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoSession
+	err = m.sessions.FindOne(ctx, bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "open", Value: true}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get drawer session: %w", err)
+	}
+	return doc.toSession(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, s *Session) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.Save", attribute.String("session.id", s.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoSession(s)
+	doc.Version = s.version + 1
+	if s.version == 0 {
+		if _, err := m.sessions.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrDrawerOpen
+			}
+			return fmt.Errorf("failed to save drawer session: %w", err)
+		}
+	} else {
+		res, err := m.sessions.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: s.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save drawer session: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Sessions(ctx context.Context, storeID uuid.UUID, from, to time.Time) (_ []*Session, err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.Sessions", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "opened_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}
+	docs, err := find[mongoSession](ctx, m.sessions, filter, "opened_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query drawer sessions: %w", err)
+	}
+	sessions := make([]*Session, 0, len(docs))
+	for _, doc := range docs {
+		sessions = append(sessions, doc.toSession())
+	}
+	return sessions, nil
+}
+
+func (m *MongoRepository) Drops(ctx context.Context, storeID uuid.UUID, from, to time.Time) (_ []Drop, err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.Drops", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "drops", Value: bson.D{{Key: "$elemMatch", Value: bson.D{{Key: "at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}}}}}},
+	}
+	docs, err := find[mongoSession](ctx, m.sessions, filter, "opened_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query safe drops: %w", err)
+	}
+	return drops(docs, from, to), nil
+}
+
+func (m *MongoRepository) LastDeposit(ctx context.Context, storeID uuid.UUID) (_ *Deposit, err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.LastDeposit", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoDeposit
+	opts := options.FindOne().SetSort(bson.D{{Key: "since", Value: -1}})
+	err = m.deposits.FindOne(ctx, bson.D{{Key: "store_id", Value: storeID.String()}}, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cash deposit: %w", err)
+	}
+	return doc.toDeposit(), nil
+}
+
+func (m *MongoRepository) AddDeposit(ctx context.Context, d *Deposit) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.AddDeposit", attribute.String("deposit.id", d.ID.String()))
+	defer telemetry.End(span, &err)
+	if _, err := m.deposits.InsertOne(ctx, toMongoDeposit(d)); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConcurrencyConflict
+		}
+		return fmt.Errorf("failed to save cash deposit: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Deposits(ctx context.Context, storeID uuid.UUID, from, to time.Time) (_ []*Deposit, err error) {
+	ctx, span := telemetry.StartClient(ctx, "cash.MongoRepository.Deposits", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+	}
+	docs, err := find[mongoDeposit](ctx, m.deposits, filter, "at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cash deposits: %w", err)
+	}
+	deposits := make([]*Deposit, 0, len(docs))
+	for _, doc := range docs {
+		deposits = append(deposits, doc.toDeposit())
+	}
+	return deposits, nil
+}
+
+func find[T any](ctx context.Context, c *mongo.Collection, filter bson.D, sort string) ([]T, error) {
+	cur, err := c.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: sort, Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []T
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.sessions.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// drops returns the drops of sessions made in [from, to), earliest first.
+func drops(sessions []mongoSession, from, to time.Time) []Drop {
+	var res []Drop
+	for _, s := range sessions {
+		for _, d := range s.toSession().Drops {
+			if !d.At.Before(from) && d.At.Before(to) {
+				res = append(res, d)
+			}
+		}
+	}
+	slices.SortStableFunc(res, func(a, b Drop) int { return a.At.Compare(b.At) })
+	return res
+}
+
+// MemoryRepository keeps sessions and deposits in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]mongoSession
+	deposits []mongoDeposit
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{sessions: map[uuid.UUID]mongoSession{}}
+}
+
+func (m *MemoryRepository) Current(_ context.Context, storeID uuid.UUID) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range m.sessions {
+		if doc.StoreID == storeID.String() && doc.Open {
+			return doc.toSession(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryRepository) Save(_ context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.version == 0 {
+		for _, doc := range m.sessions {
+			if doc.StoreID == s.StoreID.String() && doc.Open {
+				return ErrDrawerOpen
+			}
+		}
+	}
+	if m.sessions[s.ID].Version != s.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoSession(s)
+	doc.Version = s.version + 1
+	m.sessions[s.ID] = doc
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Sessions(_ context.Context, storeID uuid.UUID, from, to time.Time) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*Session
+	for _, doc := range m.sessions {
+		if doc.StoreID == storeID.String() && !doc.OpenedAt.Before(from) && doc.OpenedAt.Before(to) {
+			sessions = append(sessions, doc.toSession())
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *Session) int { return a.OpenedAt.Compare(b.OpenedAt) })
+	return sessions, nil
+}
+
+func (m *MemoryRepository) Drops(_ context.Context, storeID uuid.UUID, from, to time.Time) ([]Drop, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var docs []mongoSession
+	for _, doc := range m.sessions {
+		if doc.StoreID == storeID.String() {
+			docs = append(docs, doc)
+		}
+	}
+	return drops(docs, from, to), nil
+}
+
+func (m *MemoryRepository) LastDeposit(_ context.Context, storeID uuid.UUID) (*Deposit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last *Deposit
+	for _, doc := range m.deposits {
+		if doc.StoreID == storeID.String() && (last == nil || doc.Since.After(last.Since)) {
+			last = doc.toDeposit()
+		}
+	}
+	if last == nil {
+		return nil, ErrNotFound
+	}
+	return last, nil
+}
+
+func (m *MemoryRepository) AddDeposit(_ context.Context, d *Deposit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range m.deposits {
+		if doc.StoreID == d.StoreID.String() && doc.Since.Equal(d.Since) {
+			return ErrConcurrencyConflict
+		}
+	}
+	m.deposits = append(m.deposits, toMongoDeposit(d))
+	return nil
+}
+
+func (m *MemoryRepository) Deposits(_ context.Context, storeID uuid.UUID, from, to time.Time) ([]*Deposit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deposits []*Deposit
+	for _, doc := range m.deposits {
+		if doc.StoreID == storeID.String() && !doc.At.Before(from) && doc.At.Before(to) {
+			deposits = append(deposits, doc.toDeposit())
+		}
+	}
+	slices.SortFunc(deposits, func(a, b *Deposit) int { return a.At.Compare(b.At) })
+	return deposits, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
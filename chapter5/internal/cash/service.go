@@ -0,0 +1,257 @@
+package cash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the drawer first.
+const saveAttempts = 3
+
+// Sales is where the cash taken by the purchases of a store is read from: the analytics projection of the
+// purchases.
+type Sales interface {
+	CashTaken(ctx context.Context, q analytics.Query) ([]analytics.StoreCash, error)
+}
+
+// Discrepancy is cash that did not add up: a drawer counted at close, or a deposit banked, that is not what
+// was expected. Amounts are in the minor unit of Currency.
+type Discrepancy struct {
+	StoreID uuid.UUID
+	// Kind is "drawer" or "deposit", and ID the session or deposit.
+	Kind     string
+	ID       uuid.UUID
+	Currency string
+	Expected int64
+	Counted  int64
+	By       string
+	At       time.Time
+}
+
+// Difference is what was counted over what was expected, negative if it is short.
+func (d Discrepancy) Difference() int64 {
+	return d.Counted - d.Expected
+}
+
+// Notifier tells the manager of a store about discrepancies over the policy's threshold, e.g.
+// notifications.Managers.
+type Notifier interface {
+	CashDiscrepancy(ctx context.Context, d Discrepancy) error
+}
+
+// Service tracks the cash of the stores' drawers from the float to the bank.
+type Service struct {
+	repo     Repository
+	sales    Sales
+	policy   Policy
+	notifier Notifier // 可选, 差额超过阈值时通知店长
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithNotifier tells the manager of the store about flagged discrepancies.
+func WithNotifier(n Notifier) Option {
+	return func(s *Service) {
+		s.notifier = n
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test sessions spanning a day.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, sales Sales, policy Policy, opts ...Option) *Service {
+	s := &Service{repo: repo, sales: sales, policy: policy, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Open starts a session of the store's drawer with its float. The caller is recorded as who opened it.
+func (s *Service) Open(ctx context.Context, storeID uuid.UUID, float money.Money) (*Session, error) {
+	session, err := Open(storeID, float, audit.Actor(ctx), s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Current returns the open session of the store's drawer, or ErrNotFound if it is closed.
+func (s *Service) Current(ctx context.Context, storeID uuid.UUID) (*Session, error) {
+	return s.repo.Current(ctx, storeID)
+}
+
+// Drop records cash taken from the open drawer to the safe in a sealed bag.
+func (s *Service) Drop(ctx context.Context, storeID uuid.UUID, amount money.Money, bag string) (*Session, error) {
+	return s.update(ctx, storeID, func(session *Session) error {
+		return session.Drop(amount, bag, audit.Actor(ctx), s.now())
+	})
+}
+
+// Close records the cash counted in the drawer and reconciles it with the float, the cash purchases taken
+// since it was opened and the drops. A discrepancy over the threshold is flagged to the store's manager.
+// Purchases are read from analytics, so the drawer is closed once the last of them was projected.
+func (s *Service) Close(ctx context.Context, storeID uuid.UUID, counted money.Money, note string) (*Session, error) {
+	at := s.now()
+	session, err := s.update(ctx, storeID, func(session *Session) error {
+		cashSales, err := s.cashTaken(ctx, session, at)
+		if err != nil {
+			return err
+		}
+		return session.Close(counted, cashSales, note, audit.Actor(ctx), at, s.policy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session.Flagged {
+		s.notify(ctx, Discrepancy{
+			StoreID:  storeID,
+			Kind:     "drawer",
+			ID:       session.ID,
+			Currency: session.Currency,
+			Expected: session.Expected(),
+			Counted:  session.Counted,
+			By:       session.ClosedBy,
+			At:       session.ClosedAt,
+		})
+	}
+	return session, nil
+}
+
+func (s *Service) cashTaken(ctx context.Context, session *Session, to time.Time) (int64, error) {
+	rows, err := s.sales.CashTaken(ctx, analytics.Query{From: session.OpenedAt, To: to, StoreIDs: []uuid.UUID{session.StoreID}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the cash purchases: %w", err)
+	}
+	var sum int64
+	for _, r := range rows {
+		if r.Currency == session.Currency {
+			sum += r.Cash
+		}
+	}
+	return sum, nil
+}
+
+// Deposit records cash of the store banked, and reconciles it with the safe drops made since the previous
+// deposit. A discrepancy over the threshold is flagged to the store's manager.
+func (s *Service) Deposit(ctx context.Context, storeID uuid.UUID, amount money.Money, slip string) (*Deposit, error) {
+	for range saveAttempts {
+		var since time.Time
+		last, err := s.repo.LastDeposit(ctx, storeID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			since = last.At
+		}
+		at := s.now()
+		all, err := s.repo.Drops(ctx, storeID, since, at)
+		if err != nil {
+			return nil, err
+		}
+		var drops []Drop
+		for _, d := range all {
+			if d.Currency == amount.Currency().Code {
+				drops = append(drops, d)
+			}
+		}
+		d, err := NewDeposit(storeID, amount, slip, audit.Actor(ctx), at, since, drops, s.policy)
+		if err != nil {
+			return nil, err
+		}
+		err = s.repo.AddDeposit(ctx, d)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if d.Flagged {
+			s.notify(ctx, Discrepancy{
+				StoreID:  storeID,
+				Kind:     "deposit",
+				ID:       d.ID,
+				Currency: d.Currency,
+				Expected: d.Expected,
+				Counted:  d.Amount,
+				By:       d.By,
+				At:       d.At,
+			})
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("failed to save cash deposit after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// Sessions returns the sessions of the store's drawer opened in [from, to), earliest first.
+func (s *Service) Sessions(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*Session, error) {
+	return s.repo.Sessions(ctx, storeID, from, to)
+}
+
+// Deposits returns the deposits of the store made in [from, to), earliest first.
+func (s *Service) Deposits(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*Deposit, error) {
+	return s.repo.Deposits(ctx, storeID, from, to)
+}
+
+// update applies fn to the open session of the store and saves it, starting over if someone else saved in
+// between.
+func (s *Service) update(ctx context.Context, storeID uuid.UUID, fn func(session *Session) error) (*Session, error) {
+	for range saveAttempts {
+		session, err := s.repo.Current(ctx, storeID)
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrDrawerClosed
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(session); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, session)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return session, nil
+	}
+	return nil, fmt.Errorf("failed to update drawer session after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// notify tells the manager about a discrepancy. The cash was recorded regardless, and stays flagged in the
+// sessions and deposits of the store, so a manager who could not be told is only logged.
+func (s *Service) notify(ctx context.Context, d Discrepancy) {
+	s.logger.WarnContext(ctx, "cash discrepancy", "store", d.StoreID, "kind", d.Kind, "id", d.ID, "currency", d.Currency, "difference", d.Difference())
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.CashDiscrepancy(ctx, d); err != nil {
+		s.logger.ErrorContext(ctx, "failed to tell the manager about a cash discrepancy", "store", d.StoreID, "id", d.ID, "error", err)
+	}
+}
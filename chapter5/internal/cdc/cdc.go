@@ -0,0 +1,100 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/purchase"
+)
+
+// Change data capture is the fallback for deployments where the service cannot publish events itself:
+// purchases are picked up from the database's own change log and turned into the same domain events.
+// Positions are only saved after publishing, so an event can be published twice after a restart (or by
+// both the service and CDC). Purchase events have stable IDs, so idempotent consumers drop the duplicates.
+
+// Checkpoints remembers how far each tailer got.
+type Checkpoints interface {
+	// Load returns nil if name has no checkpoint yet.
+	Load(ctx context.Context, name string) ([]byte, error)
+	Save(ctx context.Context, name string, position []byte) error
+}
+
+// PurchaseWatcher calls fn with every purchase inserted from resumeToken on; *purchase.MongoRepository is one.
+type PurchaseWatcher interface {
+	Watch(ctx context.Context, resumeToken bson.Raw, fn func(ctx context.Context, p purchase.Purchase, token bson.Raw) error) error
+}
+
+// TailMongoPurchases publishes a purchase.completed event for every purchase inserted into Mongo. Imported
+// purchases were completed in another system, which published whatever it did, so they are skipped.
+func TailMongoPurchases(ctx context.Context, repo PurchaseWatcher, pub events.Publisher, cps Checkpoints) error {
+	const name = "mongo.purchases"
+	token, err := cps.Load(ctx, name)
+	if err != nil {
+		return err
+	}
+	return repo.Watch(ctx, token, func(ctx context.Context, p purchase.Purchase, token bson.Raw) error {
+		if !p.Imported() {
+			if err := pub.Publish(ctx, p.CompletedEvent()); err != nil {
+				return err
+			}
+		}
+		return cps.Save(ctx, name, token)
+	})
+}
+
+// TailPostgresEvents publishes every event appended to a Postgres event store, decoded through registry.
+// The replication slot itself tracks the position.
+func TailPostgresEvents(ctx context.Context, store *eventstore.PostgresStore, slot string, registry *events.Registry, pub events.Publisher) error {
+	return store.TailChanges(ctx, slot, time.Second, func(ctx context.Context, r eventstore.Record) error {
+		e, err := registry.Decode(events.Message{Type: r.Type, Version: r.SchemaVersion, Payload: r.Data})
+		if err != nil {
+			return fmt.Errorf("failed to decode %s v%d of %s: %w", r.Type, r.SchemaVersion, r.AggregateID, err)
+		}
+		return pub.Publish(ctx, e)
+	})
+}
+
+type MongoCheckpoints struct {
+	checkpoints *mongo.Collection
+}
+
+func NewMongoCheckpoints(ctx context.Context, connectionString string) (*MongoCheckpoints, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoCheckpoints{checkpoints: client.Database("coffeeco").Collection("cdc_checkpoints")}, nil
+}
+
+func (m *MongoCheckpoints) Load(ctx context.Context, name string) ([]byte, error) {
+	var doc struct {
+		Position []byte `bson:"position"`
+	}
+	if err := m.checkpoints.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", name, err)
+	}
+	return doc.Position, nil
+}
+
+func (m *MongoCheckpoints) Save(ctx context.Context, name string, position []byte) error {
+	_, err := m.checkpoints.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: name}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "position", Value: position}, {Key: "saved_at", Value: time.Now().UTC()}}}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cdc_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/cdc"
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+// change is a purchase inserted into Mongo, with the resume token of its change.
+type change struct {
+	purchase purchase.Purchase
+	token    bson.Raw
+}
+
+// stream plays back changes from the one after the resume token it is given.
+type stream struct {
+	changes []change
+	from    bson.Raw
+}
+
+func (s *stream) Watch(ctx context.Context, resumeToken bson.Raw, fn func(ctx context.Context, p purchase.Purchase, token bson.Raw) error) error {
+	s.from = resumeToken
+	start := 0
+	for i, c := range s.changes {
+		if string(c.token) == string(resumeToken) {
+			start = i + 1
+		}
+	}
+	for _, c := range s.changes[start:] {
+		if err := fn(ctx, c.purchase, c.token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type checkpoints map[string][]byte
+
+func (c checkpoints) Load(_ context.Context, name string) ([]byte, error) {
+	return c[name], nil
+}
+
+func (c checkpoints) Save(_ context.Context, name string, position []byte) error {
+	c[name] = position
+	return nil
+}
+
+// published fails every publish while down.
+type published struct {
+	events []events.Event
+	down   bool
+}
+
+func (p *published) Publish(_ context.Context, evts ...events.Event) error {
+	if p.down {
+		return errors.New("broker is down")
+	}
+	p.events = append(p.events, evts...)
+	return nil
+}
+
+// purchases are a latte completed here, one imported from the old tills and another latte completed here,
+// as the repository would read them back.
+func purchases(t *testing.T) []change {
+	t.Helper()
+	ctx := context.Background()
+	repo := testsupport.NewFakePurchases()
+	svc := purchase.NewService(testsupport.NewFakeCards(), repo, testsupport.FakeDiscounts{})
+	latte := func() *purchase.Purchase {
+		return &purchase.Purchase{
+			Store:              store.Ref(uuid.New()),
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       payment.MEANS_CASH,
+		}
+	}
+	first, imported, second := latte(), latte(), latte()
+	if err := svc.CompletePurchase(ctx, first.Store.ID, first, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.ImportPurchase(ctx, uuid.New(), time.Now().Add(-24*time.Hour), imported); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, second.Store.ID, second, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var changes []change
+	for i, p := range []*purchase.Purchase{first, imported, second} {
+		stored, err := repo.Get(ctx, p.ID)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		token, err := bson.Marshal(bson.D{{Key: "_data", Value: string(rune('a' + i))}})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		changes = append(changes, change{purchase: stored, token: token})
+	}
+	return changes
+}
+
+func Test_PurchasesCompletedHereArePublishedAndImportedOnesSkipped(t *testing.T) {
+	changes := purchases(t)
+	s, cps, pub := &stream{changes: changes}, checkpoints{}, &published{}
+	if err := cdc.TailMongoPurchases(context.Background(), s, pub, cps); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if s.from != nil {
+		t.Fatalf("expected the first tail to start from now but it resumed after %v", s.from)
+	}
+	if len(pub.events) != 2 {
+		t.Fatalf("expected the two purchases completed here to be published but got %d events", len(pub.events))
+	}
+	for i, want := range []purchase.Purchase{changes[0].purchase, changes[2].purchase} {
+		got, ok := pub.events[i].(purchase.Completed)
+		if !ok || got.PurchaseID != want.ID || got.StoreID != want.Store.ID || got.Total != 450 || got.Currency != "USD" || len(got.Lines) != 1 {
+			t.Fatalf("expected purchase.completed for %s but got %+v", want.ID, pub.events[i])
+		}
+	}
+	// The imported purchase is skipped, but not forgotten: the position moves past it.
+	if string(cps["mongo.purchases"]) != string(changes[2].token) {
+		t.Fatalf("expected the position of the last change to be saved but got %v", cps["mongo.purchases"])
+	}
+}
+
+func Test_TailingResumesAfterTheLastPublishedChange(t *testing.T) {
+	changes := purchases(t)
+	cps := checkpoints{}
+	pub := &published{down: true}
+	if err := cdc.TailMongoPurchases(context.Background(), &stream{changes: changes}, pub, cps); err == nil {
+		t.Fatal("expected the tail to stop when the change cannot be published")
+	}
+	if _, ok := cps["mongo.purchases"]; ok {
+		t.Fatalf("expected no position saved for a change that was not published but got %v", cps["mongo.purchases"])
+	}
+
+	// Once the broker is back the tail gets as far as the first change, stops, and is started again.
+	pub.down = false
+	s := &stream{changes: changes[:1]}
+	if err := cdc.TailMongoPurchases(context.Background(), s, pub, cps); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	s = &stream{changes: changes}
+	if err := cdc.TailMongoPurchases(context.Background(), s, pub, cps); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if string(s.from) != string(changes[0].token) {
+		t.Fatalf("expected the tail to resume after the first change but it resumed after %v", s.from)
+	}
+	if len(pub.events) != 2 || pub.events[1].(purchase.Completed).PurchaseID != changes[2].purchase.ID {
+		t.Fatalf("expected each purchase completed here to be published once but got %+v", pub.events)
+	}
+}
@@ -0,0 +1,158 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// The ports faults can be injected into.
+const (
+	TargetCardCharges  = "card_charges"
+	TargetCardRefunds  = "card_refunds"
+	TargetStores       = "stores"
+	TargetPurchases    = "purchases"
+	TargetLoyaltyCards = "loyalty_cards"
+	TargetPublish      = "publish"
+	TargetHandle       = "handle"
+)
+
+// Targets lists every target, for validating configuration.
+var Targets = []string{TargetCardCharges, TargetCardRefunds, TargetStores, TargetPurchases, TargetLoyaltyCards, TargetPublish, TargetHandle}
+
+func IsTarget(target string) bool {
+	for _, t := range Targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrInjected is the error of every injected failure.
+var ErrInjected = errors.New("injected fault")
+
+// Fault is what goes wrong with calls to a target.
+type Fault struct {
+	// Latency is added before every call.
+	Latency time.Duration
+	// ErrorRate is the share of calls, from 0 to 1, that fail with ErrInjected.
+	ErrorRate float64
+	// Partial makes failing calls go through before they report the error, like a charge the gateway made
+	// but whose answer was lost. It is what compensations have to cope with.
+	Partial bool
+}
+
+// UnmarshalJSON reads a fault as {"latency": "200ms", "error_rate": 0.1, "partial": true}.
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Latency   string  `json:"latency"`
+		ErrorRate float64 `json:"error_rate"`
+		Partial   bool    `json:"partial"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	f.ErrorRate, f.Partial, f.Latency = raw.ErrorRate, raw.Partial, 0
+	if raw.Latency != "" {
+		d, err := time.ParseDuration(raw.Latency)
+		if err != nil {
+			return fmt.Errorf("invalid latency %q: %w", raw.Latency, err)
+		}
+		f.Latency = d
+	}
+	return nil
+}
+
+func (f Fault) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Latency   string  `json:"latency,omitempty"`
+		ErrorRate float64 `json:"error_rate,omitempty"`
+		Partial   bool    `json:"partial,omitempty"`
+	}{Latency: durationString(f.Latency), ErrorRate: f.ErrorRate, Partial: f.Partial})
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Injector injects the faults it was given into the calls made through it. Faults in a call's context win
+// over the Injector's own, so a test can break a single purchase.
+type Injector struct {
+	mu     sync.RWMutex
+	faults map[string]Fault
+	roll   func() float64
+}
+
+func New() *Injector {
+	return &Injector{faults: map[string]Fault{}, roll: rand.Float64}
+}
+
+func (i *Injector) Set(target string, f Fault) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults[target] = f
+}
+
+// Replace swaps every fault for faults at once, e.g. after the config was reloaded.
+func (i *Injector) Replace(faults map[string]Fault) {
+	copied := make(map[string]Fault, len(faults))
+	for t, f := range faults {
+		copied[t] = f
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.faults = copied
+}
+
+type faultsKey struct{}
+
+// WithFaults injects faults into the calls made with ctx, on top of and over the Injector's.
+func WithFaults(ctx context.Context, faults map[string]Fault) context.Context {
+	return context.WithValue(ctx, faultsKey{}, faults)
+}
+
+func (i *Injector) fault(ctx context.Context, target string) (Fault, bool) {
+	if faults, ok := ctx.Value(faultsKey{}).(map[string]Fault); ok {
+		if f, ok := faults[target]; ok {
+			return f, true
+		}
+	}
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	f, ok := i.faults[target]
+	return f, ok
+}
+
+// Do calls fn with the fault of target, if it has one.
+func (i *Injector) Do(ctx context.Context, target string, fn func(ctx context.Context) error) error {
+	f, ok := i.fault(ctx, target)
+	if !ok {
+		return fn(ctx)
+	}
+	if f.Latency > 0 {
+		t := time.NewTimer(f.Latency)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	if f.ErrorRate <= 0 || i.roll() >= f.ErrorRate {
+		return fn(ctx)
+	}
+	if f.Partial {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%w into %s", ErrInjected, target)
+}
@@ -0,0 +1,118 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/chaos"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/saga"
+)
+
+func call(i *chaos.Injector, ctx context.Context) (called bool, err error) {
+	err = i.Do(ctx, chaos.TargetPurchases, func(context.Context) error {
+		called = true
+		return nil
+	})
+	return called, err
+}
+
+func Test_FaultsFailCallsOrLetThemThroughFirst(t *testing.T) {
+	tests := map[string]struct {
+		fault      chaos.Fault
+		wantCalled bool
+		wantErr    error
+	}{
+		"no fault":        {fault: chaos.Fault{}, wantCalled: true},
+		"failure":         {fault: chaos.Fault{ErrorRate: 1}, wantCalled: false, wantErr: chaos.ErrInjected},
+		"partial failure": {fault: chaos.Fault{ErrorRate: 1, Partial: true}, wantCalled: true, wantErr: chaos.ErrInjected},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := chaos.New()
+			i.Set(chaos.TargetPurchases, tt.fault)
+			called, err := call(i, context.Background())
+			if called != tt.wantCalled || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected called=%v err=%v but got called=%v err=%v", tt.wantCalled, tt.wantErr, called, err)
+			}
+		})
+	}
+}
+
+func Test_ContextFaultsWinOverTheInjectors(t *testing.T) {
+	i := chaos.New()
+	i.Set(chaos.TargetPurchases, chaos.Fault{ErrorRate: 1})
+	ctx := chaos.WithFaults(context.Background(), map[string]chaos.Fault{chaos.TargetPurchases: {}})
+	if called, err := call(i, ctx); !called || err != nil {
+		t.Fatalf("expected the context to turn the fault off but got called=%v err=%v", called, err)
+	}
+}
+
+func Test_LatencyGivesUpWithTheContext(t *testing.T) {
+	i := chaos.New()
+	i.Set(chaos.TargetPurchases, chaos.Fault{Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if called, err := call(i, ctx); called || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to win over the latency but got called=%v err=%v", called, err)
+	}
+}
+
+type gateway struct {
+	charges, refunds int
+}
+
+func (g *gateway) Charge(context.Context, money.Money, string) (string, error) {
+	g.charges++
+	return "ch_1", nil
+}
+
+func (g *gateway) Refund(context.Context, string) error {
+	g.refunds++
+	return nil
+}
+
+func (g *gateway) ChargeCard(context.Context, money.Money, string) error {
+	return nil
+}
+
+func (g *gateway) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return 0, nil
+}
+
+func Test_SagaRefundsTheCardWhenStoringFails(t *testing.T) {
+	faults := chaos.New()
+	faults.Set(chaos.TargetPurchases, chaos.Fault{ErrorRate: 1})
+	repo, err := purchase.NewEventSourcedRepo(eventstore.NewMemoryStore(), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &gateway{}
+	orchestrator, _ := saga.NewOrchestrator(saga.NewMemoryRepo())
+	cs, err := purchase.NewCompletionSaga(purchase.NewService(g, faults.Purchases(repo), g), faults.CardGateway(g), orchestrator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := "tok_visa"
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}},
+		PaymentMeans:       payment.MEANS_CARD,
+		CardToken:          &token,
+	}
+	state, err := cs.Complete(context.Background(), uuid.New(), p, nil)
+	if !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("expected the injected fault but got %v", err)
+	}
+	if state.Status != saga.StatusCompensated || g.charges != 1 || g.refunds != 1 {
+		t.Fatalf("expected the charge to be refunded but got status=%s charges=%d refunds=%d", state.Status, g.charges, g.refunds)
+	}
+}
@@ -0,0 +1,146 @@
+package chaos
+
+import (
+	"context"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+)
+
+// CardCharges injects the faults of TargetCardCharges into c.
+func (i *Injector) CardCharges(c purchase.CardChargeService) purchase.CardChargeService {
+	return faultyCharges{CardChargeService: c, i: i}
+}
+
+type faultyCharges struct {
+	purchase.CardChargeService
+	i *Injector
+}
+
+func (f faultyCharges) ChargeCard(ctx context.Context, amount money.Money, cardToken string) error {
+	return f.i.Do(ctx, TargetCardCharges, func(ctx context.Context) error {
+		return f.CardChargeService.ChargeCard(ctx, amount, cardToken)
+	})
+}
+
+// CardGateway injects the faults of TargetCardCharges into charges and of TargetCardRefunds into refunds,
+// to exercise the compensations of the completion saga.
+func (i *Injector) CardGateway(g purchase.CardGateway) purchase.CardGateway {
+	return faultyGateway{CardGateway: g, i: i}
+}
+
+type faultyGateway struct {
+	purchase.CardGateway
+	i *Injector
+}
+
+func (f faultyGateway) Charge(ctx context.Context, amount money.Money, cardToken string) (chargeID string, err error) {
+	err = f.i.Do(ctx, TargetCardCharges, func(ctx context.Context) error {
+		chargeID, err = f.CardGateway.Charge(ctx, amount, cardToken)
+		return err
+	})
+	return chargeID, err
+}
+
+func (f faultyGateway) Refund(ctx context.Context, chargeID string) error {
+	return f.i.Do(ctx, TargetCardRefunds, func(ctx context.Context) error {
+		return f.CardGateway.Refund(ctx, chargeID)
+	})
+}
+
+// Stores injects the faults of TargetStores into the discount lookups of s.
+func (i *Injector) Stores(s purchase.StoreService) purchase.StoreService {
+	return faultyStores{StoreService: s, i: i}
+}
+
+type faultyStores struct {
+	purchase.StoreService
+	i *Injector
+}
+
+func (f faultyStores) GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID) (discount float32, err error) {
+	err = f.i.Do(ctx, TargetStores, func(ctx context.Context) error {
+		discount, err = f.StoreService.GetStoreSpecificDiscount(ctx, storeID)
+		return err
+	})
+	return discount, err
+}
+
+// Purchases injects the faults of TargetPurchases into r. Pings are left alone, so readiness reflects the
+// real database.
+func (i *Injector) Purchases(r purchase.Repository) purchase.Repository {
+	return faultyPurchases{Repository: r, i: i}
+}
+
+type faultyPurchases struct {
+	purchase.Repository
+	i *Injector
+}
+
+func (f faultyPurchases) Store(ctx context.Context, p *purchase.Purchase) error {
+	return f.i.Do(ctx, TargetPurchases, func(ctx context.Context) error {
+		return f.Repository.Store(ctx, p)
+	})
+}
+
+func (f faultyPurchases) Get(ctx context.Context, id uuid.UUID) (p purchase.Purchase, err error) {
+	err = f.i.Do(ctx, TargetPurchases, func(ctx context.Context) error {
+		p, err = f.Repository.Get(ctx, id)
+		return err
+	})
+	return p, err
+}
+
+// LoyaltyCards injects the faults of TargetLoyaltyCards into r.
+func (i *Injector) LoyaltyCards(r loyalty.Repository) loyalty.Repository {
+	return faultyCards{Repository: r, i: i}
+}
+
+type faultyCards struct {
+	loyalty.Repository
+	i *Injector
+}
+
+func (f faultyCards) Get(ctx context.Context, id uuid.UUID) (card *loyalty.CoffeeBux, err error) {
+	err = f.i.Do(ctx, TargetLoyaltyCards, func(ctx context.Context) error {
+		card, err = f.Repository.Get(ctx, id)
+		return err
+	})
+	return card, err
+}
+
+func (f faultyCards) Save(ctx context.Context, card *loyalty.CoffeeBux) error {
+	return f.i.Do(ctx, TargetLoyaltyCards, func(ctx context.Context) error {
+		return f.Repository.Save(ctx, card)
+	})
+}
+
+// Publisher injects the faults of TargetPublish into p. A partial failure publishes the events and still
+// fails, so the caller's retry publishes them twice.
+func (i *Injector) Publisher(p events.Publisher) events.Publisher {
+	return faultyPublisher{p: p, i: i}
+}
+
+type faultyPublisher struct {
+	p events.Publisher
+	i *Injector
+}
+
+func (f faultyPublisher) Publish(ctx context.Context, evts ...events.Event) error {
+	return f.i.Do(ctx, TargetPublish, func(ctx context.Context) error {
+		return f.p.Publish(ctx, evts...)
+	})
+}
+
+// Handler injects the faults of TargetHandle into h, to exercise redelivery and dead-lettering.
+func (i *Injector) Handler(h events.Handler) events.Handler {
+	return func(ctx context.Context, msg events.Message) error {
+		return i.Do(ctx, TargetHandle, func(ctx context.Context) error {
+			return h(ctx, msg)
+		})
+	}
+}
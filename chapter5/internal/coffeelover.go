@@ -1,6 +1,10 @@
 package coffeeco
 
-import "github.com/google/uuid"
+import (
+	"log/slog"
+
+	"github.com/google/uuid"
+)
 
 type CoffeeLover struct {
 	ID           uuid.UUID
@@ -8,3 +12,8 @@ type CoffeeLover struct {
 	LastName     string
 	EmailAddress string
 }
+
+// LogValue logs a coffee lover by ID only; names and email addresses stay out of the logs.
+func (c CoffeeLover) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", c.ID.String()))
+}
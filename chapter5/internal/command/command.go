@@ -0,0 +1,144 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/telemetry"
+)
+
+var ErrNoHandler = errors.New("no handler for command")
+
+// Command asks an application service to change something, e.g. purchase.CompletePurchaseCommand. Commands
+// are values: CommandName must not depend on their fields.
+type Command interface {
+	CommandName() string
+}
+
+// Handler carries out a command.
+type Handler func(ctx context.Context, cmd Command) error
+
+// Middleware wraps every handler of a Bus with something all commands need, e.g. logging, so handlers
+// only hold what is particular to them.
+type Middleware func(next Handler) Handler
+
+// Bus dispatches commands to the handler registered for them, through its middleware.
+type Bus struct {
+	handlers   map[string]Handler
+	middleware []Middleware
+}
+
+// NewBus returns a Bus running mw around every handler, the first outermost.
+func NewBus(mw ...Middleware) *Bus {
+	return &Bus{handlers: map[string]Handler{}, middleware: mw}
+}
+
+// Handle registers fn as the handler of commands of type C, replacing any registered before.
+func Handle[C Command](b *Bus, fn func(ctx context.Context, cmd C) error) {
+	var zero C
+	h := Handler(func(ctx context.Context, cmd Command) error {
+		return fn(ctx, cmd.(C))
+	})
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		h = b.middleware[i](h)
+	}
+	b.handlers[zero.CommandName()] = h
+}
+
+// Dispatch has cmd carried out by its handler, returning ErrNoHandler if there is none.
+func (b *Bus) Dispatch(ctx context.Context, cmd Command) error {
+	h, ok := b.handlers[cmd.CommandName()]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHandler, cmd.CommandName())
+	}
+	return h(ctx, cmd)
+}
+
+// Validate rejects commands with a Validate method that returns an error, before they are handled.
+func Validate() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			if v, ok := cmd.(interface{ Validate() error }); ok {
+				if err := v.Validate(); err != nil {
+					return err
+				}
+			}
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// Authorizer is a command that knows who may dispatch it.
+type Authorizer interface {
+	Authorize(p auth.Principal) error
+}
+
+// Authorize rejects Authorizer commands dispatched by a principal they do not authorize, and by nobody,
+// with auth.ErrUnauthenticated. Commands that are not Authorizers go through.
+func Authorize() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			if a, ok := cmd.(Authorizer); ok {
+				p, ok := auth.FromContext(ctx)
+				if !ok {
+					return auth.ErrUnauthenticated
+				}
+				if err := a.Authorize(p); err != nil {
+					return err
+				}
+			}
+			return next(ctx, cmd)
+		}
+	}
+}
+
+// Log logs every command that fails at warning level, and every other at debug level, with how long it
+// took.
+func Log(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			start := time.Now()
+			err := next(ctx, cmd)
+			if err != nil {
+				logger.WarnContext(ctx, "command failed", "command", cmd.CommandName(), "took", time.Since(start), "error", err)
+				return err
+			}
+			logger.DebugContext(ctx, "command handled", "command", cmd.CommandName(), "took", time.Since(start))
+			return nil
+		}
+	}
+}
+
+// Recorder is told how long each command took and whether it failed, e.g. to export it as metrics.
+type Recorder interface {
+	CommandHandled(name string, took time.Duration, err error)
+}
+
+// Measure reports every command to r.
+func Measure(r Recorder) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) error {
+			start := time.Now()
+			err := next(ctx, cmd)
+			r.CommandHandled(cmd.CommandName(), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Trace handles every command in a span of its own.
+func Trace() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, cmd Command) (err error) {
+			ctx, span := telemetry.Start(ctx, "command "+cmd.CommandName(), attribute.String("command", cmd.CommandName()))
+			defer telemetry.End(span, &err)
+			return next(ctx, cmd)
+		}
+	}
+}
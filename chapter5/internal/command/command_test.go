@@ -0,0 +1,74 @@
+package command_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/command"
+)
+
+type brew struct{ cups int }
+
+func (brew) CommandName() string { return "test.brew" }
+
+func (b brew) Validate() error {
+	if b.cups <= 0 {
+		return errors.New("brew at least a cup")
+	}
+	return nil
+}
+
+func (brew) Authorize(p auth.Principal) error {
+	if !p.Has(auth.RoleBarista) {
+		return auth.ErrForbidden
+	}
+	return nil
+}
+
+type recorder []string
+
+func (r *recorder) CommandHandled(name string, _ time.Duration, err error) {
+	*r = append(*r, name+" "+map[bool]string{true: "ok", false: "failed"}[err == nil])
+}
+
+func Test_BusRunsCommandsThroughItsMiddleware(t *testing.T) {
+	var (
+		brewed   int
+		measured recorder
+	)
+	bus := command.NewBus(command.Log(slog.New(slog.DiscardHandler)), command.Measure(&measured), command.Authorize(), command.Validate())
+	command.Handle(bus, func(_ context.Context, b brew) error {
+		brewed += b.cups
+		return nil
+	})
+
+	barista := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "sam", Roles: []auth.Role{auth.RoleBarista}})
+	customer := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "kim", Roles: []auth.Role{auth.RoleCustomer}})
+	if err := bus.Dispatch(barista, brew{cups: 2}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := bus.Dispatch(customer, brew{cups: 2}); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected customers not to brew but got %v", err)
+	}
+	if err := bus.Dispatch(context.Background(), brew{cups: 2}); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("expected brewing to need a caller but got %v", err)
+	}
+	if err := bus.Dispatch(barista, brew{}); err == nil {
+		t.Fatal("expected an empty brew to be invalid")
+	}
+	if brewed != 2 {
+		t.Fatalf("expected 2 cups brewed but got %d", brewed)
+	}
+	if want := []string{"test.brew ok", "test.brew failed", "test.brew failed", "test.brew failed"}; !slices.Equal(measured, want) {
+		t.Fatalf("expected %v measured but got %v", want, measured)
+	}
+
+	if err := command.NewBus().Dispatch(barista, brew{cups: 1}); !errors.Is(err, command.ErrNoHandler) {
+		t.Fatalf("expected no handler but got %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package compliance_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/compliance"
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+func Test_CashAboveTheThresholdsIsReportedAsSuspicious(t *testing.T) {
+	ctx := context.Background()
+	cash := compliance.NewMemoryStore()
+	ledger := compliance.NewLedger(cash)
+	soho, camden := uuid.New(), uuid.New()
+	ada := uuid.New()
+	complete := func(storeID, customerID uuid.UUID, means payment.Means, currency string, at string, total int64) uuid.UUID {
+		t.Helper()
+		purchasedAt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		e := purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, CustomerID: customerID, PaymentMeans: string(means), Total: total, Currency: currency, PurchasedAt: purchasedAt}
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		// Redelivered events must not count twice.
+		for range 2 {
+			if err := ledger.Handle(ctx, msg); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+		return e.PurchaseID
+	}
+
+	complete(soho, ada, payment.MEANS_CASH, "USD", "2024-03-01T15:00:00Z", 90000)
+	// 19:30 on the 1st in New York.
+	complete(camden, ada, payment.MEANS_CASH, "USD", "2024-03-02T00:30:00Z", 70000)
+	// Not cash, or not in the currency of the thresholds.
+	complete(soho, ada, payment.MEANS_CARD, "USD", "2024-03-01T16:00:00Z", 500000)
+	complete(soho, ada, payment.MEANS_CASH, "EUR", "2024-03-01T16:00:00Z", 500000)
+	big := complete(soho, uuid.Nil, payment.MEANS_CASH, "USD", "2024-03-01T17:00:00Z", 120000)
+	// The next day.
+	complete(soho, ada, payment.MEANS_CASH, "USD", "2024-03-02T15:00:00Z", 100000)
+
+	svc := compliance.NewService(cash, compliance.Thresholds{Currency: "USD", TransactionAbove: 100000, DailyAbove: 150000, TimeZone: "America/New_York"})
+	from, to := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)
+
+	totals, err := svc.DailyTotals(ctx, from, to)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(totals) != 2 || totals[0].Day != "2024-03-01" || totals[0].Amount != 160000 || totals[0].Transactions != 2 || totals[1].Amount != 100000 {
+		t.Fatalf("expected ada's cash added up by New York day but got %+v", totals)
+	}
+
+	activity, err := svc.SuspiciousActivity(ctx, from, to)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(activity) != 2 {
+		t.Fatalf("expected 2 suspicious activities but got %+v", activity)
+	}
+	if a := activity[0]; a.Rule != compliance.RuleDailyAbove || a.CustomerID != ada.String() || a.Amount != 160000 || a.Threshold != 150000 {
+		t.Fatalf("expected ada's day reported but got %+v", a)
+	}
+	if a := activity[1]; a.Rule != compliance.RuleTransactionAbove || a.CustomerID != "" || a.TransactionIDs != big.String() {
+		t.Fatalf("expected the anonymous purchase reported but got %+v", a)
+	}
+}
@@ -0,0 +1,80 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+// Kind is what moved the cash.
+type Kind string
+
+const KindCashPurchase Kind = "cash_purchase"
+
+// Transaction is cash taken at a store. Amounts are in the minor unit of Currency.
+type Transaction struct {
+	ID      string `bson:"_id"`
+	Kind    Kind   `bson:"kind"`
+	StoreID string `bson:"store_id"`
+	// CustomerID is empty for anonymous purchases, which can only be checked one by one.
+	CustomerID string    `bson:"customer_id,omitempty"`
+	At         time.Time `bson:"at"`
+	Currency   string    `bson:"currency"`
+	Amount     int64     `bson:"amount"`
+}
+
+// Ledger is the projection that records the cash transactions compliance checks. A transaction is keyed
+// by its purchase, so like the analytics facts it needs no inbox to be applied at least once.
+type Ledger struct {
+	store    Store
+	registry *events.Registry
+}
+
+func NewLedger(store Store) *Ledger {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	return &Ledger{store: store, registry: r}
+}
+
+func (l *Ledger) Name() string {
+	return "compliance"
+}
+
+func (l *Ledger) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted {
+		return nil
+	}
+	evt, err := l.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.Completed)
+	if e.PaymentMeans != payment.MEANS_CASH {
+		return nil
+	}
+	t := Transaction{
+		ID:       e.PurchaseID.String(),
+		Kind:     KindCashPurchase,
+		StoreID:  e.StoreID.String(),
+		At:       e.PurchasedAt,
+		Currency: e.Currency,
+		Amount:   e.Total,
+	}
+	if e.CustomerID != uuid.Nil {
+		t.CustomerID = e.CustomerID.String()
+	}
+	return l.store.SaveTransaction(ctx, t)
+}
+
+func (l *Ledger) Reset(ctx context.Context) error {
+	return l.store.Reset(ctx)
+}
@@ -0,0 +1,165 @@
+package compliance
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	RuleTransactionAbove = "transaction_above"
+	RuleDailyAbove       = "daily_above"
+)
+
+// The rows below are exported as CSV like the analytics reports: their JSON names are their columns.
+
+// DailyTotal is the cash a registered customer spent in a day of the thresholds' time zone.
+type DailyTotal struct {
+	Day          string `json:"day"`
+	CustomerID   string `json:"customer_id"`
+	Currency     string `json:"currency"`
+	Amount       int64  `json:"amount"`
+	Transactions int64  `json:"transactions"`
+}
+
+// Activity is a suspicious activity: a transaction, or a customer's day of transactions, above a threshold.
+type Activity struct {
+	Rule string `json:"rule"`
+	Day  string `json:"day"`
+	// CustomerID is empty for an anonymous transaction.
+	CustomerID string `json:"customer_id"`
+	Currency   string `json:"currency"`
+	Amount     int64  `json:"amount"`
+	Threshold  int64  `json:"threshold"`
+	// StoreIDs and TransactionIDs are separated by spaces.
+	StoreIDs       string `json:"store_ids"`
+	TransactionIDs string `json:"transaction_ids"`
+}
+
+type Service struct {
+	store      Store
+	thresholds Thresholds
+}
+
+func NewService(store Store, thresholds Thresholds) *Service {
+	return &Service{store: store, thresholds: thresholds}
+}
+
+// day is a customer's cash of a day.
+type day struct {
+	DailyTotal
+	stores       []string
+	transactions []string
+}
+
+// days adds up the cash of each registered customer by day, from the date of from up to but not including
+// the date of to, both taken as dates in the thresholds' time zone. Only cash in the thresholds' currency
+// is added up.
+func (s *Service) days(ctx context.Context, from, to time.Time, each func(Transaction, string)) ([]*day, error) {
+	loc, err := s.thresholds.location()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, loc)
+	byCustomer := map[[2]string]*day{}
+	err = s.store.Transactions(ctx, start, end, func(t Transaction) error {
+		if t.Currency != s.thresholds.Currency {
+			return nil
+		}
+		date := t.At.In(loc).Format(time.DateOnly)
+		if each != nil {
+			each(t, date)
+		}
+		if t.CustomerID == "" {
+			return nil
+		}
+		k := [2]string{date, t.CustomerID}
+		if byCustomer[k] == nil {
+			byCustomer[k] = &day{DailyTotal: DailyTotal{Day: date, CustomerID: t.CustomerID, Currency: t.Currency}}
+		}
+		d := byCustomer[k]
+		d.Amount += t.Amount
+		d.Transactions++
+		if !slices.Contains(d.stores, t.StoreID) {
+			d.stores = append(d.stores, t.StoreID)
+		}
+		d.transactions = append(d.transactions, t.ID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add up cash transactions: %w", err)
+	}
+	res := make([]*day, 0, len(byCustomer))
+	for _, d := range byCustomer {
+		res = append(res, d)
+	}
+	slices.SortFunc(res, func(a, b *day) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(b.Amount, a.Amount), cmp.Compare(a.CustomerID, b.CustomerID))
+	})
+	return res, nil
+}
+
+// DailyTotals returns the cash each registered customer spent each day, from the date of from up to but not
+// including the date of to, the biggest spenders of a day first.
+func (s *Service) DailyTotals(ctx context.Context, from, to time.Time) ([]DailyTotal, error) {
+	days, err := s.days(ctx, from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]DailyTotal, 0, len(days))
+	for _, d := range days {
+		res = append(res, d.DailyTotal)
+	}
+	return res, nil
+}
+
+// SuspiciousActivity reports the transactions above TransactionAbove and the customers' days above
+// DailyAbove, for the same days as DailyTotals, day by day.
+func (s *Service) SuspiciousActivity(ctx context.Context, from, to time.Time) ([]Activity, error) {
+	var res []Activity
+	above := s.thresholds.TransactionAbove
+	days, err := s.days(ctx, from, to, func(t Transaction, date string) {
+		if above > 0 && t.Amount > above {
+			res = append(res, Activity{
+				Rule:           RuleTransactionAbove,
+				Day:            date,
+				CustomerID:     t.CustomerID,
+				Currency:       t.Currency,
+				Amount:         t.Amount,
+				Threshold:      above,
+				StoreIDs:       t.StoreID,
+				TransactionIDs: t.ID,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if daily := s.thresholds.DailyAbove; daily > 0 {
+		for _, d := range days {
+			if d.Amount <= daily {
+				continue
+			}
+			slices.Sort(d.stores)
+			slices.Sort(d.transactions)
+			res = append(res, Activity{
+				Rule:           RuleDailyAbove,
+				Day:            d.Day,
+				CustomerID:     d.CustomerID,
+				Currency:       d.Currency,
+				Amount:         d.Amount,
+				Threshold:      daily,
+				StoreIDs:       strings.Join(d.stores, " "),
+				TransactionIDs: strings.Join(d.transactions, " "),
+			})
+		}
+	}
+	slices.SortStableFunc(res, func(a, b Activity) int {
+		return cmp.Or(cmp.Compare(a.Day, b.Day), cmp.Compare(a.Rule, b.Rule), cmp.Compare(b.Amount, a.Amount), cmp.Compare(a.TransactionIDs, b.TransactionIDs))
+	})
+	return res, nil
+}
@@ -0,0 +1,130 @@
+package compliance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// Store keeps the cash transactions compliance checks.
+type Store interface {
+	// SaveTransaction replaces a transaction saved before with the same ID.
+	SaveTransaction(ctx context.Context, t Transaction) error
+	// Transactions calls fn with every transaction made from from up to but not including to, in no
+	// particular order, stopping at the first error fn returns.
+	Transactions(ctx context.Context, from, to time.Time, fn func(Transaction) error) error
+	Reset(ctx context.Context) error
+	Ping(ctx context.Context) error
+}
+
+type MongoStore struct {
+	client       *mongo.Client
+	transactions *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoStore{client: client, transactions: client.Database("coffeeco").Collection("rm_compliance_transactions")}, nil
+}
+
+// Close disconnects from Mongo. The store cannot be used afterwards.
+func (m *MongoStore) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+func (m *MongoStore) SaveTransaction(ctx context.Context, t Transaction) error {
+	_, err := m.transactions.ReplaceOne(ctx, bson.D{{Key: "_id", Value: t.ID}}, t, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save cash transaction: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Transactions(ctx context.Context, from, to time.Time, fn func(Transaction) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "compliance.MongoStore.Transactions", attribute.String("compliance.from", from.String()), attribute.String("compliance.to", to.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.transactions.Find(ctx, bson.D{{Key: "at", Value: bson.D{{Key: "$gte", Value: from.UTC()}, {Key: "$lt", Value: to.UTC()}}}})
+	if err != nil {
+		return fmt.Errorf("failed to query cash transactions: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var t Transaction
+		if err := cur.Decode(&t); err != nil {
+			return fmt.Errorf("failed to decode cash transaction: %w", err)
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (m *MongoStore) Reset(ctx context.Context) error {
+	return m.transactions.Drop(ctx)
+}
+
+func (m *MongoStore) Ping(ctx context.Context) error {
+	if _, err := m.transactions.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps transactions in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu           sync.Mutex
+	transactions map[string]Transaction
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{transactions: map[string]Transaction{}}
+}
+
+func (m *MemoryStore) SaveTransaction(_ context.Context, t Transaction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transactions[t.ID] = t
+	return nil
+}
+
+func (m *MemoryStore) Transactions(_ context.Context, from, to time.Time, fn func(Transaction) error) error {
+	m.mu.Lock()
+	var res []Transaction
+	for _, t := range m.transactions {
+		if !t.At.Before(from) && t.At.Before(to) {
+			res = append(res, t)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	for _, t := range res {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Reset(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transactions = map[string]Transaction{}
+	return nil
+}
+
+func (m *MemoryStore) Ping(context.Context) error {
+	return nil
+}
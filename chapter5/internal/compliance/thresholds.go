@@ -0,0 +1,26 @@
+package compliance
+
+import (
+	"fmt"
+	"time"
+)
+
+// Thresholds are the anti-money-laundering limits cash transactions are checked against. Amounts are in
+// the minor unit of Currency; cash in another currency is not checked.
+type Thresholds struct {
+	Currency string `json:"currency"`
+	// TransactionAbove flags any one transaction above it; 0 turns the check off.
+	TransactionAbove int64 `json:"transaction_above"`
+	// DailyAbove flags a customer whose transactions of a day add up to more than it; 0 turns the check off.
+	DailyAbove int64 `json:"daily_above"`
+	// TimeZone is where days start and end, UTC if empty.
+	TimeZone string `json:"time_zone"`
+}
+
+func (t Thresholds) location() (*time.Location, error) {
+	loc, err := time.LoadLocation(t.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid compliance time zone %q: %w", t.TimeZone, err)
+	}
+	return loc, nil
+}
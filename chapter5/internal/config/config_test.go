@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"coffeeco/internal/config"
+	"coffeeco/internal/feature"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_DefaultsAreValid(t *testing.T) {
+	c, err := config.Load("", env(nil))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if c.APIAddr != ":8080" || c.PurchasePersistence != "document" {
+		t.Fatalf("expected the defaults but got %+v", c)
+	}
+}
+
+func Test_EnvironmentOverridesTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coffeeco.json")
+	writeFile(t, path, `{"api_addr": ":9000", "event_transport": "kafka", "event_brokers": "kafka-1:9092", "tunables": {"log_level": "debug"}}`)
+
+	c, err := config.Load(path, env(map[string]string{"EVENT_BROKERS": "kafka-2:9092", "LOG_LEVEL": "warn"}))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if c.APIAddr != ":9000" || c.EventBrokers != "kafka-2:9092" || c.Tunables.LogLevel != "warn" {
+		t.Fatalf("expected the file then the environment to apply but got %+v", c)
+	}
+}
+
+func Test_EveryProblemIsReported(t *testing.T) {
+	_, err := config.Load("", env(map[string]string{
+		"MONGO_URI":            "localhost:27017",
+		"EVENT_TRANSPORT":      "kafka",
+		"OIDC_ISSUER":          "https://id.example.com",
+		"LOG_LEVEL":            "loud",
+		"QUOTE_SIGNING_SECRET": "short",
+		"QR_SIGNING_SECRET":    "short",
+	}))
+	if !errors.Is(err, config.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid but got %v", err)
+	}
+	for _, want := range []string{"MONGO_URI", "EVENT_BROKERS", "OIDC_AUDIENCE", "LOG_LEVEL", "QUOTE_SIGNING_SECRET", "QR_SIGNING_SECRET"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %s to be reported in %v", want, err)
+		}
+	}
+}
+
+func Test_ReloaderAppliesOnlyValidTunables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "coffeeco.json")
+	writeFile(t, path, `{"tunables": {"log_level": "info"}}`)
+	c, err := config.Load(path, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := config.NewReloader(path, c, env(nil))
+	var got []config.Tunables
+	r.OnChange(func(t config.Tunables) { got = append(got, t) })
+
+	writeFile(t, path, `{"tunables": {"log_level": "debug", "feature_flags": {"wallet-payments": {"everyone": true}}}}`)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	writeFile(t, path, `{"tunables": {"log_level": "loud"}}`)
+	if err := r.Reload(); !errors.Is(err, config.ErrInvalid) {
+		t.Fatalf("expected ErrInvalid but got %v", err)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("expected the initial and one reloaded set of tunables but got %d", len(got))
+	}
+	if got[1].LogLevel != "debug" || !got[1].FeatureFlags[feature.WalletPayments].Everyone {
+		t.Fatalf("expected the reloaded tunables but got %+v", got[1])
+	}
+}
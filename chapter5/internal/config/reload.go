@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Reloader reloads the config file when it changes and hands the new Tunables to everyone who asked for
+// them. A file that no longer loads is ignored, and changes to anything but the Tunables wait for a restart.
+type Reloader struct {
+	path   string
+	getenv func(string) string
+
+	mu       sync.Mutex
+	current  Config
+	modTime  time.Time
+	onChange []func(Tunables)
+}
+
+func NewReloader(path string, current Config, getenv func(string) string) *Reloader {
+	r := &Reloader{path: path, getenv: getenv, current: current}
+	if fi, err := os.Stat(path); err == nil {
+		r.modTime = fi.ModTime()
+	}
+	return r
+}
+
+// OnChange calls fn with the current Tunables now and with the new ones after every reload that changes them.
+func (r *Reloader) OnChange(fn func(Tunables)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = append(r.onChange, fn)
+	fn(r.current.Tunables)
+}
+
+// Reload loads the config again and applies its Tunables if they changed.
+func (r *Reloader) Reload() error {
+	next, err := Load(r.path, r.getenv)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	restartOnly := next
+	restartOnly.Tunables = r.current.Tunables
+	if !reflect.DeepEqual(restartOnly, r.current) {
+		slog.Warn("config changed outside of tunables; restart to apply it", "file", r.path)
+	}
+	if reflect.DeepEqual(next.Tunables, r.current.Tunables) {
+		return nil
+	}
+	r.current.Tunables = next.Tunables
+	for _, fn := range r.onChange {
+		fn(next.Tunables)
+	}
+	slog.Info("config tunables reloaded", "file", r.path)
+	return nil
+}
+
+// Run checks the config file for changes every interval until ctx is done.
+func (r *Reloader) Run(ctx context.Context, every time.Duration) {
+	if r.path == "" {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		fi, err := os.Stat(r.path)
+		if err != nil || !fi.ModTime().After(r.modTime) {
+			continue
+		}
+		r.modTime = fi.ModTime()
+		if err := r.Reload(); err != nil {
+			slog.Error("failed to reload config, keeping the current one", "file", r.path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package consent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUnknownChannel  = errors.New("unknown marketing channel")
+	ErrNoSource        = errors.New("consent needs the source it was given or withdrawn through")
+	ErrMissingCustomer = errors.New("consent needs the ID of the customer")
+	ErrInvalidQuery    = errors.New("a consent export needs a time range that ends after it starts")
+)
+
+// Channel is how a customer may be sent marketing. They are the channels of the notifications.
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+	ChannelPush  Channel = "push"
+)
+
+// Channels are all the channels, in the order they are shown to customers.
+var Channels = []Channel{ChannelEmail, ChannelSMS, ChannelPush}
+
+func (c Channel) valid() bool {
+	switch c {
+	case ChannelEmail, ChannelSMS, ChannelPush:
+		return true
+	}
+	return false
+}
+
+// Record is a customer opting in to or out of marketing on a channel. Records are only ever added; the
+// latest one of a channel is the customer's consent on it, and the earlier ones are kept as proof of what
+// they agreed to and when.
+type Record struct {
+	ID         uuid.UUID `json:"id"`
+	CustomerID uuid.UUID `json:"customerId"`
+	Channel    Channel   `json:"channel"`
+	// Granted is true for an opt-in, false for an opt-out.
+	Granted bool `json:"granted"`
+	// Source is where the customer decided, e.g. "app_settings", "signup_form" or "unsubscribe_link".
+	Source string    `json:"source"`
+	At     time.Time `json:"at"`
+	// RecordedBy is who recorded the decision, as in the audit log: the customer themselves, or e.g. the
+	// support agent they asked.
+	RecordedBy string `json:"recordedBy"`
+}
+
+// NewRecord records that customerID opted in to channel, or out of it, through source at at.
+func NewRecord(customerID uuid.UUID, channel Channel, granted bool, source, recordedBy string, at time.Time) (Record, error) {
+	source = strings.TrimSpace(source)
+	var errs []error
+	if customerID == uuid.Nil {
+		errs = append(errs, ErrMissingCustomer)
+	}
+	if !channel.valid() {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrUnknownChannel, channel))
+	}
+	if source == "" {
+		errs = append(errs, ErrNoSource)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return Record{}, err
+	}
+	return Record{
+		ID:         uuid.New(),
+		CustomerID: customerID,
+		Channel:    channel,
+		Granted:    granted,
+		Source:     source,
+		At:         at.UTC(),
+		RecordedBy: recordedBy,
+	}, nil
+}
+
+// Current is the consent of a customer on each channel, given the history of their records, oldest first.
+// Channels they never decided on are missing: nobody is sent marketing without opting in.
+func Current(history []Record) map[Channel]Record {
+	res := map[Channel]Record{}
+	for _, r := range history {
+		res[r.Channel] = r
+	}
+	return res
+}
@@ -0,0 +1,73 @@
+package consent_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/consent"
+)
+
+func Test_TheLatestDecisionOnAChannelIsTheCustomersConsentAndEveryOneIsExported(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	svc := consent.NewService(consent.NewMemoryRepo(), consent.WithClock(func() time.Time { return now }))
+	ada, bob := uuid.New(), uuid.New()
+
+	record := func(customerID uuid.UUID, ch consent.Channel, granted bool, source string) {
+		t.Helper()
+		if _, err := svc.Record(ctx, customerID, ch, granted, source); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		now = now.Add(time.Hour)
+	}
+	record(ada, consent.ChannelEmail, true, "signup_form")
+	record(ada, consent.ChannelSMS, true, "signup_form")
+	record(bob, consent.ChannelEmail, true, "app_settings")
+	record(ada, consent.ChannelEmail, false, "unsubscribe_link")
+
+	for _, c := range []struct {
+		customerID uuid.UUID
+		channel    string
+		want       bool
+	}{
+		{ada, "email", false},
+		{ada, "sms", true},
+		{ada, "push", false},
+		{bob, "email", true},
+	} {
+		got, err := svc.Allows(ctx, c.customerID, c.channel)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if got != c.want {
+			t.Fatalf("expected %s to be allowed %v but got %v", c.channel, c.want, got)
+		}
+	}
+
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	records, err := svc.Export(ctx, from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var out bytes.Buffer
+	if err := consent.WriteCSV(&out, records); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 || lines[0] != "id,customerId,channel,granted,source,at,recordedBy" {
+		t.Fatalf("expected a header and the 3 decisions from 10:00 but got\n%s", out.String())
+	}
+	if !strings.Contains(lines[3], ada.String()+",email,false,unsubscribe_link,2024-05-01T12:00:00Z,") {
+		t.Fatalf("expected the opt-out last but got %s", lines[3])
+	}
+
+	if _, err := svc.Record(ctx, ada, "pigeon", true, ""); !errors.Is(err, consent.ErrUnknownChannel) || !errors.Is(err, consent.ErrNoSource) {
+		t.Fatalf("expected an unknown channel and a missing source to be refused but got %v", err)
+	}
+}
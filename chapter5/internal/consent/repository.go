@@ -0,0 +1,193 @@
+package consent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Append adds a record. Records are never changed or removed.
+	Append(ctx context.Context, r Record) error
+	// History returns every record of a customer, oldest first.
+	History(ctx context.Context, customerID uuid.UUID) ([]Record, error)
+	// Export calls fn with every record made from from up to but not including to, oldest first, stopping at
+	// the first error fn returns.
+	Export(ctx context.Context, from, to time.Time, fn func(Record) error) error
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client   *mongo.Client
+	consents *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	consents := client.Database("coffeeco").Collection("marketing_consents")
+	_, err = consents.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "at", Value: 1}}},
+		{Keys: bson.D{{Key: "at", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consent indexes: %w", err)
+	}
+	return &MongoRepository{client: client, consents: consents}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoRecord struct {
+	ID         string    `bson:"_id"`
+	CustomerID string    `bson:"customer_id"`
+	Channel    string    `bson:"channel"`
+	Granted    bool      `bson:"granted"`
+	Source     string    `bson:"source"`
+	At         time.Time `bson:"at"`
+	RecordedBy string    `bson:"recorded_by"`
+}
+
+func toMongoRecord(r Record) mongoRecord {
+	return mongoRecord{
+		ID:         r.ID.String(),
+		CustomerID: r.CustomerID.String(),
+		Channel:    string(r.Channel),
+		Granted:    r.Granted,
+		Source:     r.Source,
+		At:         r.At,
+		RecordedBy: r.RecordedBy,
+	}
+}
+
+func (m mongoRecord) toRecord() Record {
+	id, _ := uuid.Parse(m.ID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	return Record{
+		ID:         id,
+		CustomerID: customerID,
+		Channel:    Channel(m.Channel),
+		Granted:    m.Granted,
+		Source:     m.Source,
+		At:         m.At,
+		RecordedBy: m.RecordedBy,
+	}
+}
+
+func (m *MongoRepository) Append(ctx context.Context, r Record) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "consent.MongoRepository.Append", attribute.String("customer.id", r.CustomerID.String()))
+	defer telemetry.End(span, &err)
+	if _, err := m.consents.InsertOne(ctx, toMongoRecord(r)); err != nil {
+		return fmt.Errorf("failed to record consent: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) History(ctx context.Context, customerID uuid.UUID) (_ []Record, err error) {
+	ctx, span := telemetry.StartClient(ctx, "consent.MongoRepository.History", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.consents.Find(ctx, bson.D{{Key: "customer_id", Value: customerID.String()}}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find consents: %w", err)
+	}
+	var docs []mongoRecord
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode consents: %w", err)
+	}
+	res := make([]Record, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.toRecord())
+	}
+	return res, nil
+}
+
+func (m *MongoRepository) Export(ctx context.Context, from, to time.Time, fn func(Record) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "consent.MongoRepository.Export", attribute.String("consent.from", from.String()), attribute.String("consent.to", to.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{{Key: "at", Value: bson.D{{Key: "$gte", Value: from.UTC()}, {Key: "$lt", Value: to.UTC()}}}}
+	cur, err := m.consents.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to query consents: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var doc mongoRecord
+		if err := cur.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode consent: %w", err)
+		}
+		if err := fn(doc.toRecord()); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.consents.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps consents in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+func (m *MemoryRepository) Append(_ context.Context, r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *MemoryRepository) History(_ context.Context, customerID uuid.UUID) ([]Record, error) {
+	return m.find(func(r Record) bool { return r.CustomerID == customerID }), nil
+}
+
+func (m *MemoryRepository) Export(_ context.Context, from, to time.Time, fn func(Record) error) error {
+	for _, r := range m.find(func(r Record) bool { return !r.At.Before(from) && r.At.Before(to) }) {
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find returns the records that match, oldest first.
+func (m *MemoryRepository) find(match func(Record) bool) []Record {
+	m.mu.Lock()
+	var res []Record
+	for _, r := range m.records {
+		if match(r) {
+			res = append(res, r)
+		}
+	}
+	m.mu.Unlock()
+	slices.SortStableFunc(res, func(a, b Record) int { return a.At.Compare(b.At) })
+	return res
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package consent
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+)
+
+type Service struct {
+	repo Repository
+	now  func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithClock replaces time.Now, e.g. to test when consent was given.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Record records that a customer opted in to marketing on channel, or out of it, through source. The caller
+// is recorded as having recorded it. Recording the same decision again adds a record all the same, as
+// proof the customer confirmed it.
+func (s *Service) Record(ctx context.Context, customerID uuid.UUID, channel Channel, granted bool, source string) (Record, error) {
+	r, err := NewRecord(customerID, channel, granted, source, audit.Actor(ctx), s.now())
+	if err != nil {
+		return Record{}, err
+	}
+	if err := s.repo.Append(ctx, r); err != nil {
+		return Record{}, err
+	}
+	return r, nil
+}
+
+// Current returns the consent of a customer on each channel they decided on.
+func (s *Service) Current(ctx context.Context, customerID uuid.UUID) (map[Channel]Record, error) {
+	history, err := s.repo.History(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	return Current(history), nil
+}
+
+// History returns every decision of a customer, oldest first.
+func (s *Service) History(ctx context.Context, customerID uuid.UUID) ([]Record, error) {
+	return s.repo.History(ctx, customerID)
+}
+
+// Allows tells whether a customer may be sent marketing on channel, e.g. "email": only if the last thing
+// they said about it was to opt in.
+func (s *Service) Allows(ctx context.Context, customerID uuid.UUID, channel string) (bool, error) {
+	current, err := s.Current(ctx, customerID)
+	if err != nil {
+		return false, err
+	}
+	return current[Channel(channel)].Granted, nil
+}
+
+// Export returns every decision recorded from from up to but not including to, oldest first, for
+// compliance audits.
+func (s *Service) Export(ctx context.Context, from, to time.Time) ([]Record, error) {
+	if !to.After(from) {
+		return nil, ErrInvalidQuery
+	}
+	var res []Record
+	err := s.repo.Export(ctx, from, to, func(r Record) error {
+		res = append(res, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// WriteCSV writes records as CSV, with a header row naming the columns as the JSON fields of Record.
+func WriteCSV(w io.Writer, records []Record) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"id", "customerId", "channel", "granted", "source", "at", "recordedBy"}); err != nil {
+		return err
+	}
+	for _, r := range records {
+		err := out.Write([]string{
+			r.ID.String(),
+			r.CustomerID.String(),
+			string(r.Channel),
+			strconv.FormatBool(r.Granted),
+			r.Source,
+			r.At.Format(time.RFC3339),
+			r.RecordedBy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,105 @@
+package correlation
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"coffeeco/internal/events"
+)
+
+// Header carries the correlation ID over HTTP; callers may set it to tie our logs and events to theirs, and
+// every response echoes it.
+const Header = "X-Correlation-ID"
+
+// metadataKey carries the correlation ID over gRPC.
+const metadataKey = "x-correlation-id"
+
+// validID keeps IDs we did not make short and free of anything that could forge a log line or header.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// IDs say where work comes from. CorrelationID is shared by everything caused by one originating request;
+// CausationID is the ID of the request or message that directly caused the work.
+type IDs struct {
+	CorrelationID string
+	CausationID   string
+}
+
+type idsKey struct{}
+
+func WithIDs(ctx context.Context, ids IDs) context.Context {
+	return context.WithValue(ctx, idsKey{}, ids)
+}
+
+func FromContext(ctx context.Context) (IDs, bool) {
+	ids, ok := ctx.Value(idsKey{}).(IDs)
+	return ids, ok
+}
+
+// ID is the correlation ID in ctx, or "" if there is none.
+func ID(ctx context.Context) string {
+	ids, _ := FromContext(ctx)
+	return ids.CorrelationID
+}
+
+// Start begins work that arrived with correlationID, e.g. from a header. A missing or malformed ID is
+// replaced by a new one. The work gets an ID of its own, which is the cause of what it does.
+func Start(ctx context.Context, correlationID string) context.Context {
+	if !validID.MatchString(correlationID) {
+		correlationID = uuid.NewString()
+	}
+	return WithIDs(ctx, IDs{CorrelationID: correlationID, CausationID: uuid.NewString()})
+}
+
+// Middleware starts every request with the correlation ID in its X-Correlation-ID header and echoes it.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Start(r.Context(), r.Header.Get(Header))
+		w.Header().Set(Header, ID(ctx))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UnaryServerInterceptor starts every call with the correlation ID in its x-correlation-id metadata and
+// echoes it in the response header.
+func UnaryServerInterceptor(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var incoming string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(metadataKey); len(v) > 0 {
+			incoming = v[0]
+		}
+	}
+	ctx = Start(ctx, incoming)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(metadataKey, ID(ctx)))
+	return handler(ctx, req)
+}
+
+// Stamp puts the IDs in ctx on a message about to be published, unless it already has its own.
+func Stamp(ctx context.Context, m *events.Message) {
+	ids, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	if m.CorrelationID == "" {
+		m.CorrelationID = ids.CorrelationID
+	}
+	if m.CausationID == "" {
+		m.CausationID = ids.CausationID
+	}
+}
+
+// Handler runs h with the correlation ID of the message it handles, and the message as the cause of
+// whatever h publishes. A message without a correlation ID starts a correlation of its own.
+func Handler(h events.Handler) events.Handler {
+	return func(ctx context.Context, msg events.Message) error {
+		correlationID := msg.CorrelationID
+		if correlationID == "" {
+			correlationID = msg.ID.String()
+		}
+		return h(WithIDs(ctx, IDs{CorrelationID: correlationID, CausationID: msg.ID.String()}), msg)
+	}
+}
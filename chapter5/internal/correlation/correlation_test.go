@@ -0,0 +1,100 @@
+package correlation_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+)
+
+func Test_MiddlewareKeepsOrReplacesTheIncomingID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		kept     bool
+	}{
+		{name: "missing", incoming: "", kept: false},
+		{name: "valid", incoming: "till-7:0042", kept: true},
+		{name: "forged log line", incoming: "abc\nlevel=ERROR", kept: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := correlation.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				seen = correlation.ID(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/purchases", nil)
+			req.Header.Set(correlation.Header, tt.incoming)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if seen == "" {
+				t.Fatalf("expected a correlation ID in the request context")
+			}
+			if got := rec.Header().Get(correlation.Header); got != seen {
+				t.Fatalf("expected the response to echo %s but got %s", seen, got)
+			}
+			if (seen == tt.incoming) != tt.kept {
+				t.Fatalf("expected kept to be %v but got ID %q", tt.kept, seen)
+			}
+		})
+	}
+}
+
+func Test_StampKeepsTheIDsAMessageAlreadyHas(t *testing.T) {
+	ctx := correlation.WithIDs(context.Background(), correlation.IDs{CorrelationID: "req-1", CausationID: "cmd-1"})
+
+	fresh := events.Message{}
+	correlation.Stamp(ctx, &fresh)
+	if fresh.CorrelationID != "req-1" || fresh.CausationID != "cmd-1" {
+		t.Fatalf("expected req-1 and cmd-1 but got %s and %s", fresh.CorrelationID, fresh.CausationID)
+	}
+
+	relayed := events.Message{CorrelationID: "req-0", CausationID: "msg-0"}
+	correlation.Stamp(ctx, &relayed)
+	if relayed.CorrelationID != "req-0" || relayed.CausationID != "msg-0" {
+		t.Fatalf("expected req-0 and msg-0 but got %s and %s", relayed.CorrelationID, relayed.CausationID)
+	}
+}
+
+func Test_HandlerMakesTheMessageTheCause(t *testing.T) {
+	tests := []struct {
+		name            string
+		msg             events.Message
+		wantCorrelation func(events.Message) string
+	}{
+		{
+			name:            "correlated",
+			msg:             events.Message{ID: uuid.New(), CorrelationID: "req-1"},
+			wantCorrelation: func(events.Message) string { return "req-1" },
+		},
+		{
+			name:            "uncorrelated",
+			msg:             events.Message{ID: uuid.New()},
+			wantCorrelation: func(m events.Message) string { return m.ID.String() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got correlation.IDs
+			h := correlation.Handler(func(ctx context.Context, _ events.Message) error {
+				got, _ = correlation.FromContext(ctx)
+				return nil
+			})
+			if err := h(context.Background(), tt.msg); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if want := tt.wantCorrelation(tt.msg); got.CorrelationID != want {
+				t.Fatalf("expected correlation ID %s but got %s", want, got.CorrelationID)
+			}
+			if got.CausationID != tt.msg.ID.String() {
+				t.Fatalf("expected causation ID %s but got %s", tt.msg.ID, got.CausationID)
+			}
+		})
+	}
+}
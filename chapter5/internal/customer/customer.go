@@ -0,0 +1,206 @@
+package customer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+)
+
+var (
+	ErrNotFound           = errors.New("customer not found")
+	ErrNoName             = errors.New("customer must have a name")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrInvalidPhone       = errors.New("invalid phone number, expected international format such as +44 20 7946 0958")
+	ErrEmailTaken         = errors.New("email address already registered")
+	ErrUnknownDietaryFlag = errors.New("unknown dietary flag")
+)
+
+// Email is a valid email address. The domain is lower-cased, as it is case-insensitive.
+type Email struct {
+	address string
+}
+
+func NewEmail(s string) (Email, error) {
+	a, err := mail.ParseAddress(strings.TrimSpace(s))
+	// A display name ("Ada <ada@example.com>") is not an email address.
+	if err != nil || a.Name != "" || a.Address != strings.TrimSpace(s) {
+		return Email{}, fmt.Errorf("%w: %q", ErrInvalidEmail, s)
+	}
+	local, domain, _ := strings.Cut(a.Address, "@")
+	return Email{address: local + "@" + strings.ToLower(domain)}, nil
+}
+
+func (e Email) String() string {
+	return e.address
+}
+
+func (e Email) IsZero() bool {
+	return e.address == ""
+}
+
+// Phone is a phone number in E.164 form, e.g. +442079460958. Spaces, dashes, dots and parentheses are
+// dropped when it is parsed.
+type Phone struct {
+	number string
+}
+
+func NewPhone(s string) (Phone, error) {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return Phone{}, ErrInvalidPhone
+		}
+	}
+	n := b.String()
+	if !strings.HasPrefix(n, "+") || len(n) < 9 || len(n) > 16 || n[1] == '0' {
+		return Phone{}, ErrInvalidPhone
+	}
+	return Phone{number: n}, nil
+}
+
+func (p Phone) String() string {
+	return p.number
+}
+
+func (p Phone) IsZero() bool {
+	return p.number == ""
+}
+
+// DietaryFlag is a dietary need baristas and the menu should know about.
+type DietaryFlag string
+
+const (
+	DietaryVegan      DietaryFlag = "vegan"
+	DietaryDairyFree  DietaryFlag = "dairy_free"
+	DietaryGlutenFree DietaryFlag = "gluten_free"
+	DietaryNutAllergy DietaryFlag = "nut_allergy"
+	DietaryDecafOnly  DietaryFlag = "decaf_only"
+)
+
+func (f DietaryFlag) valid() bool {
+	switch f {
+	case DietaryVegan, DietaryDairyFree, DietaryGlutenFree, DietaryNutAllergy, DietaryDecafOnly:
+		return true
+	}
+	return false
+}
+
+type Preferences struct {
+	// DefaultStoreID is where the customer usually orders; uuid.Nil if they have not said.
+	DefaultStoreID uuid.UUID
+	Dietary        []DietaryFlag
+}
+
+func (p Preferences) validate() error {
+	for _, f := range p.Dietary {
+		if !f.valid() {
+			return fmt.Errorf("%w: %q", ErrUnknownDietaryFlag, f)
+		}
+	}
+	return nil
+}
+
+// Has reports whether the customer has the dietary need f.
+func (p Preferences) Has(f DietaryFlag) bool {
+	for _, d := range p.Dietary {
+		if d == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Customer is someone who registered with us. Anonymous purchases have no Customer.
+type Customer struct {
+	id           uuid.UUID
+	firstName    string
+	lastName     string
+	email        Email
+	phone        Phone
+	preferences  Preferences
+	registeredAt time.Time
+}
+
+// Register makes a new customer. The email address is required, the phone number is optional.
+func Register(firstName, lastName string, email Email, phone Phone) (*Customer, error) {
+	firstName, lastName = strings.TrimSpace(firstName), strings.TrimSpace(lastName)
+	if firstName == "" {
+		return nil, ErrNoName
+	}
+	if email.IsZero() {
+		return nil, ErrInvalidEmail
+	}
+	return &Customer{
+		id:           uuid.New(),
+		firstName:    firstName,
+		lastName:     lastName,
+		email:        email,
+		phone:        phone,
+		registeredAt: time.Now().UTC(),
+	}, nil
+}
+
+func (c *Customer) ID() uuid.UUID {
+	return c.id
+}
+
+func (c *Customer) Name() (first, last string) {
+	return c.firstName, c.lastName
+}
+
+func (c *Customer) Email() Email {
+	return c.email
+}
+
+func (c *Customer) Phone() Phone {
+	return c.phone
+}
+
+func (c *Customer) Preferences() Preferences {
+	return c.preferences
+}
+
+func (c *Customer) RegisteredAt() time.Time {
+	return c.registeredAt
+}
+
+// ChangeContactDetails replaces the email address and phone number; a zero Phone removes the number.
+func (c *Customer) ChangeContactDetails(email Email, phone Phone) error {
+	if email.IsZero() {
+		return ErrInvalidEmail
+	}
+	c.email, c.phone = email, phone
+	return nil
+}
+
+func (c *Customer) SetPreferences(p Preferences) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	c.preferences = p
+	return nil
+}
+
+// CoffeeLover is the customer as the loyalty context knows them.
+func (c *Customer) CoffeeLover() coffeeco.CoffeeLover {
+	return coffeeco.CoffeeLover{ID: c.id, FirstName: c.firstName, LastName: c.lastName, EmailAddress: c.email.String()}
+}
+
+// LogValue logs a customer by ID only; names and contact details stay out of the logs.
+func (c Customer) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("id", c.id.String()))
+}
@@ -0,0 +1,140 @@
+package customer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/customer"
+	"coffeeco/internal/store"
+)
+
+func Test_NewEmail(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "ada@Example.COM", want: "ada@example.com"},
+		{in: "  ada.lovelace+coffee@example.com ", want: "ada.lovelace+coffee@example.com"},
+		{in: "Ada <ada@example.com>", err: true},
+		{in: "ada", err: true},
+		{in: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := customer.NewEmail(tt.in)
+			if tt.err {
+				if !errors.Is(err, customer.ErrInvalidEmail) {
+					t.Fatalf("expected ErrInvalidEmail but got %v", err)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Fatalf("expected %s but got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func Test_NewPhone(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "+44 20 7946 0958", want: "+442079460958"},
+		{in: "+1 (555) 010-0199", want: "+15550100199"},
+		{in: "020 7946 0958", err: true},
+		{in: "+44 20 7946 0958 ext 2", err: true},
+		{in: "+123", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := customer.NewPhone(tt.in)
+			if tt.err {
+				if !errors.Is(err, customer.ErrInvalidPhone) {
+					t.Fatalf("expected ErrInvalidPhone but got %v", err)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Fatalf("expected %s but got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func Test_RegisterReportsEveryInvalidField(t *testing.T) {
+	svc := customer.NewService(customer.NewMemoryRepo())
+	_, err := svc.Register(context.Background(), customer.Registration{Email: "not an email", Phone: "12"})
+	for _, want := range []error{customer.ErrNoName, customer.ErrInvalidEmail, customer.ErrInvalidPhone} {
+		if !errors.Is(err, want) {
+			t.Fatalf("expected %v in %v", want, err)
+		}
+	}
+}
+
+func Test_AnEmailAddressBelongsToOneCustomer(t *testing.T) {
+	ctx := context.Background()
+	svc := customer.NewService(customer.NewMemoryRepo())
+	ada, err := svc.Register(ctx, customer.Registration{FirstName: "Ada", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Register(ctx, customer.Registration{FirstName: "Ada", Email: "ada@EXAMPLE.com"}); !errors.Is(err, customer.ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken but got %v", err)
+	}
+	grace, _ := svc.Register(ctx, customer.Registration{FirstName: "Grace", Email: "grace@example.com"})
+	if _, err := svc.UpdateContactDetails(ctx, grace.ID(), "ada@example.com", ""); !errors.Is(err, customer.ErrEmailTaken) {
+		t.Fatalf("expected ErrEmailTaken but got %v", err)
+	}
+	if _, err := svc.UpdateContactDetails(ctx, ada.ID(), "ada@example.com", "+44 20 7946 0958"); err != nil {
+		t.Fatalf("expected customers to keep their own address but got %v", err)
+	}
+}
+
+type stores []store.Store
+
+func (s stores) GetStores(_ context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	var res []store.Store
+	for _, st := range s {
+		for _, id := range ids {
+			if st.ID == id {
+				res = append(res, st)
+			}
+		}
+	}
+	return res, nil
+}
+
+func Test_UpdatePreferences(t *testing.T) {
+	ctx := context.Background()
+	known := store.New(uuid.New(), "Soho")
+	svc := customer.NewService(customer.NewMemoryRepo(), customer.WithStores(stores{known}))
+	c, _ := svc.Register(ctx, customer.Registration{FirstName: "Ada", Email: "ada@example.com"})
+
+	tests := []struct {
+		name  string
+		prefs customer.Preferences
+		err   error
+	}{
+		{name: "valid", prefs: customer.Preferences{DefaultStoreID: known.ID, Dietary: []customer.DietaryFlag{customer.DietaryVegan}}},
+		{name: "unknown store", prefs: customer.Preferences{DefaultStoreID: uuid.New()}, err: customer.ErrUnknownStore},
+		{name: "unknown flag", prefs: customer.Preferences{Dietary: []customer.DietaryFlag{"carnivore"}}, err: customer.ErrUnknownDietaryFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.UpdatePreferences(ctx, c.ID(), tt.prefs)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v but got %v", tt.err, err)
+			}
+		})
+	}
+	got, _ := svc.Get(ctx, c.ID())
+	if p := got.Preferences(); p.DefaultStoreID != known.ID || !p.Has(customer.DietaryVegan) {
+		t.Fatalf("expected the valid preferences to be kept but got %+v", p)
+	}
+}
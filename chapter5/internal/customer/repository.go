@@ -0,0 +1,210 @@
+package customer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get and ByEmail return ErrNotFound if there is no such customer.
+	Get(ctx context.Context, id uuid.UUID) (*Customer, error)
+	ByEmail(ctx context.Context, email Email) (*Customer, error)
+	// Save returns ErrEmailTaken if another customer has the same email address.
+	Save(ctx context.Context, c *Customer) error
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client    *mongo.Client
+	customers *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	customers := client.Database("coffeeco").Collection("customers")
+	_, err = customers.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer indexes: %w", err)
+	}
+	return &MongoRepository{client: client, customers: customers}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoCustomer struct {
+	ID             string    `bson:"_id"`
+	FirstName      string    `bson:"first_name"`
+	LastName       string    `bson:"last_name"`
+	Email          string    `bson:"email"`
+	Phone          string    `bson:"phone,omitempty"`
+	DefaultStoreID string    `bson:"default_store_id,omitempty"`
+	Dietary        []string  `bson:"dietary,omitempty"`
+	RegisteredAt   time.Time `bson:"registered_at"`
+}
+
+func toMongoCustomer(c *Customer) mongoCustomer {
+	doc := mongoCustomer{
+		ID:           c.id.String(),
+		FirstName:    c.firstName,
+		LastName:     c.lastName,
+		Email:        c.email.address,
+		Phone:        c.phone.number,
+		RegisteredAt: c.registeredAt,
+	}
+	if c.preferences.DefaultStoreID != uuid.Nil {
+		doc.DefaultStoreID = c.preferences.DefaultStoreID.String()
+	}
+	for _, f := range c.preferences.Dietary {
+		doc.Dietary = append(doc.Dietary, string(f))
+	}
+	return doc
+}
+
+// toCustomer trusts what was stored, as it was validated before it was saved.
+func (m mongoCustomer) toCustomer() *Customer {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.DefaultStoreID)
+	c := &Customer{
+		id:           id,
+		firstName:    m.FirstName,
+		lastName:     m.LastName,
+		email:        Email{address: m.Email},
+		phone:        Phone{number: m.Phone},
+		preferences:  Preferences{DefaultStoreID: storeID},
+		registeredAt: m.RegisteredAt,
+	}
+	for _, f := range m.Dietary {
+		c.preferences.Dietary = append(c.preferences.Dietary, DietaryFlag(f))
+	}
+	return c
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Customer, err error) {
+	ctx, span := telemetry.StartClient(ctx, "customer.MongoRepository.Get", attribute.String("customer.id", id.String()))
+	defer telemetry.End(span, &err)
+	return m.findOne(ctx, bson.D{{Key: "_id", Value: id.String()}})
+}
+
+func (m *MongoRepository) ByEmail(ctx context.Context, email Email) (_ *Customer, err error) {
+	ctx, span := telemetry.StartClient(ctx, "customer.MongoRepository.ByEmail")
+	defer telemetry.End(span, &err)
+	return m.findOne(ctx, bson.D{{Key: "email", Value: email.address}})
+}
+
+func (m *MongoRepository) findOne(ctx context.Context, filter bson.D) (*Customer, error) {
+	var doc mongoCustomer
+	if err := m.customers.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find customer: %w", err)
+	}
+	return doc.toCustomer(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, c *Customer) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "customer.MongoRepository.Save", attribute.String("customer.id", c.id.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoCustomer(c)
+	if _, err := m.customers.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}}, doc, options.Replace().SetUpsert(true)); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to save customer: %w", err)
+	}
+	return nil
+}
+
+// EraseCustomer deletes the profile of customerID, for when they asked to be forgotten.
+func (m *MongoRepository) EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error) {
+	res, err := m.customers.DeleteOne(ctx, bson.D{{Key: "_id", Value: customerID.String()}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to erase customer: %w", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.customers.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps customers in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu        sync.Mutex
+	customers map[uuid.UUID]mongoCustomer
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{customers: map[uuid.UUID]mongoCustomer{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.customers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toCustomer(), nil
+}
+
+func (m *MemoryRepository) ByEmail(_ context.Context, email Email) (*Customer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range m.customers {
+		if doc.Email == email.address {
+			return doc.toCustomer(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Save stores a copy, so later changes to c only count once saved again.
+func (m *MemoryRepository) Save(_ context.Context, c *Customer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, doc := range m.customers {
+		if id != c.id && doc.Email == c.email.address {
+			return ErrEmailTaken
+		}
+	}
+	m.customers[c.id] = toMongoCustomer(c)
+	return nil
+}
+
+func (m *MemoryRepository) EraseCustomer(_ context.Context, customerID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.customers[customerID]; !ok {
+		return 0, nil
+	}
+	delete(m.customers, customerID)
+	return 1, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package customer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/store"
+)
+
+var ErrUnknownStore = errors.New("default store does not exist")
+
+// Stores checks that a default store exists.
+type Stores interface {
+	GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error)
+}
+
+type Service struct {
+	repo   Repository
+	stores Stores // 可选, 校验默认门店
+}
+
+type Option func(s *Service)
+
+// WithStores rejects default stores that do not exist.
+func WithStores(st Stores) Option {
+	return func(s *Service) {
+		s.stores = st
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Registration is what a customer gives us to sign up. Phone is optional.
+type Registration struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+}
+
+// Register signs a customer up. Every invalid field is reported, not just the first.
+func (s *Service) Register(ctx context.Context, r Registration) (*Customer, error) {
+	email, phone, err := contactDetails(r.Email, r.Phone)
+	if strings.TrimSpace(r.FirstName) == "" {
+		err = errors.Join(ErrNoName, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c, err := Register(r.FirstName, r.LastName, email, phone)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.ByEmail(ctx, email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func contactDetails(rawEmail, rawPhone string) (Email, Phone, error) {
+	email, err := NewEmail(rawEmail)
+	var phone Phone
+	if rawPhone != "" {
+		var phoneErr error
+		phone, phoneErr = NewPhone(rawPhone)
+		err = errors.Join(err, phoneErr)
+	}
+	return email, phone, err
+}
+
+// UpdateContactDetails replaces the email address and phone number of a customer; an empty phone removes it.
+func (s *Service) UpdateContactDetails(ctx context.Context, id uuid.UUID, email, phone string) (*Customer, error) {
+	e, p, err := contactDetails(email, phone)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e != c.email {
+		if _, err := s.repo.ByEmail(ctx, e); err == nil {
+			return nil, ErrEmailTaken
+		} else if !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+	}
+	if err := c.ChangeContactDetails(e, p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Service) UpdatePreferences(ctx context.Context, id uuid.UUID, p Preferences) (*Customer, error) {
+	if p.DefaultStoreID != uuid.Nil && s.stores != nil {
+		found, err := s.stores.GetStores(ctx, []uuid.UUID{p.DefaultStoreID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the default store: %w", err)
+		}
+		if len(found) == 0 {
+			return nil, ErrUnknownStore
+		}
+	}
+	c, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.SetPreferences(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Customer, error) {
+	return s.repo.Get(ctx, id)
+}
@@ -0,0 +1,73 @@
+package ddd
+
+import (
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+// AggregateRoot is embedded in the root entity of an aggregate. It holds what every aggregate has: its ID,
+// the version it was loaded at, for repositories to detect concurrent changes, and the events recorded
+// since, for the service to publish once the aggregate is saved.
+type AggregateRoot struct {
+	ID      uuid.UUID
+	version int
+	events  []events.Event
+}
+
+// Identity is the aggregate's ID, so aggregates are Entities.
+func (a *AggregateRoot) Identity() uuid.UUID {
+	return a.ID
+}
+
+// Version is how many times the aggregate had been saved when it was loaded; 0 if it never was.
+func (a *AggregateRoot) Version() int {
+	return a.version
+}
+
+// SetVersion is for repositories: they set the version an aggregate was loaded at, and the one it was
+// saved at.
+func (a *AggregateRoot) SetVersion(v int) {
+	a.version = v
+}
+
+// RecordEvent records what happened to the aggregate, to be published once it is saved.
+func (a *AggregateRoot) RecordEvent(evts ...events.Event) {
+	a.events = append(a.events, evts...)
+}
+
+// PopEvents returns the events recorded since the last call, for the caller to publish.
+func (a *AggregateRoot) PopEvents() []events.Event {
+	evts := a.events
+	a.events = nil
+	return evts
+}
+
+// Entity is anything told apart by its identity rather than by its attributes: two entities with the same
+// ID are the same one, whatever else differs.
+type Entity interface {
+	Identity() uuid.UUID
+}
+
+// SameEntity reports whether a and b are the same entity. Entities without an ID yet are not the same as
+// anything.
+func SameEntity(a, b Entity) bool {
+	return a.Identity() != uuid.Nil && a.Identity() == b.Identity()
+}
+
+// ValueObject is a value told apart by its attributes alone. It has no identity and is replaced rather than
+// changed, so it only needs to be valid.
+type ValueObject interface {
+	Validate() error
+}
+
+// NewValue returns v if it is valid, so value objects are only ever made valid, e.g.
+//
+//	delivery, err := ddd.NewValue(purchase.Delivery{Address: address, Phone: phone})
+func NewValue[V ValueObject](v V) (V, error) {
+	if err := v.Validate(); err != nil {
+		var zero V
+		return zero, err
+	}
+	return v, nil
+}
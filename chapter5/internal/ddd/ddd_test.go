@@ -0,0 +1,60 @@
+package ddd_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/events"
+)
+
+type opened struct{ events.Event }
+
+type card struct {
+	ddd.AggregateRoot
+	balance int
+}
+
+func Test_RecordedEventsArePoppedOnce(t *testing.T) {
+	c := card{AggregateRoot: ddd.AggregateRoot{ID: uuid.New()}}
+	c.RecordEvent(opened{}, opened{})
+	if got := len(c.PopEvents()); got != 2 {
+		t.Fatalf("expected 2 events but got %d", got)
+	}
+	if got := c.PopEvents(); got != nil {
+		t.Fatalf("expected no events left but got %v", got)
+	}
+}
+
+func Test_EntitiesAreTheSameByIDAlone(t *testing.T) {
+	id := uuid.New()
+	a, b := &card{AggregateRoot: ddd.AggregateRoot{ID: id}, balance: 1}, &card{AggregateRoot: ddd.AggregateRoot{ID: id}, balance: 2}
+	if !ddd.SameEntity(a, b) {
+		t.Fatal("expected cards with the same ID to be the same entity")
+	}
+	if ddd.SameEntity(&card{}, &card{}) {
+		t.Fatal("expected cards without an ID not to be the same entity")
+	}
+}
+
+type percent int
+
+var errOutOfRange = errors.New("out of range")
+
+func (p percent) Validate() error {
+	if p < 0 || p > 100 {
+		return errOutOfRange
+	}
+	return nil
+}
+
+func Test_ValuesAreOnlyMadeValid(t *testing.T) {
+	if v, err := ddd.NewValue(percent(20)); err != nil || v != 20 {
+		t.Fatalf("expected 20 but got %d, %v", v, err)
+	}
+	if _, err := ddd.NewValue(percent(120)); !errors.Is(err, errOutOfRange) {
+		t.Fatalf("expected errOutOfRange but got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package deadletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+var ErrNotFound = errors.New("dead letter not found")
+
+// Entry is a message a consumer gave up on, together with why.
+type Entry struct {
+	ID         uuid.UUID
+	Message    events.Message
+	Topic      string
+	Consumer   string
+	Error      string
+	Attempts   int
+	FailedAt   time.Time
+	RedrivenAt *time.Time
+}
+
+// Filter selects dead letters. Empty fields match everything.
+type Filter struct {
+	Topic           string
+	Consumer        string
+	EventType       string
+	AggregateID     string
+	IncludeRedriven bool
+}
+
+func (f Filter) Matches(e Entry) bool {
+	return (f.Topic == "" || f.Topic == e.Topic) &&
+		(f.Consumer == "" || f.Consumer == e.Consumer) &&
+		(f.EventType == "" || f.EventType == e.Message.Type) &&
+		(f.AggregateID == "" || f.AggregateID == e.Message.AggregateID) &&
+		(f.IncludeRedriven || e.RedrivenAt == nil)
+}
+
+type Store interface {
+	Add(ctx context.Context, e Entry) error
+	List(ctx context.Context, f Filter) ([]Entry, error)
+	MarkRedriven(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// Republisher puts already-encoded messages back on their topic, keeping their IDs.
+type Republisher interface {
+	Republish(ctx context.Context, msgs ...events.Message) error
+}
+
+// Subscriber decorates another events.Subscriber: a handler that still fails after maxAttempts has the
+// message parked in the Store and acknowledged, so one poison message cannot stall the whole topic.
+type Subscriber struct {
+	inner       events.Subscriber
+	store       Store
+	consumer    string
+	maxAttempts int
+}
+
+func NewSubscriber(inner events.Subscriber, store Store, consumer string, maxAttempts int) (*Subscriber, error) {
+	if inner == nil || store == nil {
+		return nil, errors.New("subscriber and store cannot be nil")
+	}
+	if consumer == "" {
+		return nil, errors.New("consumer name cannot be empty")
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Subscriber{inner: inner, store: store, consumer: consumer, maxAttempts: maxAttempts}, nil
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h events.Handler) error {
+	return s.inner.Subscribe(ctx, topic, func(ctx context.Context, msg events.Message) error {
+		var err error
+		for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+			if err = h(ctx, msg); err == nil {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return s.store.Add(ctx, Entry{
+			ID:       uuid.New(),
+			Message:  msg,
+			Topic:    topic,
+			Consumer: s.consumer,
+			Error:    err.Error(),
+			Attempts: s.maxAttempts,
+			FailedAt: time.Now().UTC(),
+		})
+	})
+}
+
+// Redrive re-publishes every dead letter matching f and marks it as redriven. It returns how many were
+// redriven; on error, the ones before the failure stay marked.
+func Redrive(ctx context.Context, store Store, pub Republisher, f Filter) (int, error) {
+	f.IncludeRedriven = false
+	entries, err := store.List(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range entries {
+		if err := pub.Republish(ctx, e.Message); err != nil {
+			return i, fmt.Errorf("failed to redrive %s: %w", e.ID, err)
+		}
+		if err := store.MarkRedriven(ctx, e.ID, time.Now().UTC()); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
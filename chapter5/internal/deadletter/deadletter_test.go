@@ -0,0 +1,80 @@
+package deadletter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"coffeeco/internal/deadletter"
+	"coffeeco/internal/events"
+)
+
+type sliceSubscriber []events.Message
+
+func (s sliceSubscriber) Subscribe(ctx context.Context, _ string, h events.Handler) error {
+	for _, m := range s {
+		if err := h(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type recordingRepublisher struct {
+	msgs []events.Message
+}
+
+func (r *recordingRepublisher) Republish(_ context.Context, msgs ...events.Message) error {
+	r.msgs = append(r.msgs, msgs...)
+	return nil
+}
+
+func Test_PoisonMessagesAreParkedAndCanBeRedriven(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = deadletter.NewMemoryStore()
+		msgs  = sliceSubscriber{
+			{Type: "purchase.completed", AggregateID: "ok"},
+			{Type: "purchase.completed", AggregateID: "poison"},
+			{Type: "loyalty.stamp_added", AggregateID: "poison"},
+		}
+		attempts int
+	)
+
+	sub, err := deadletter.NewSubscriber(msgs, store, "projector", 3)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	err = sub.Subscribe(ctx, "coffeeco.purchase", func(_ context.Context, m events.Message) error {
+		if m.AggregateID == "poison" {
+			attempts++
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected poison messages not to stop the subscription but got %v", err)
+	}
+	if attempts != 6 {
+		t.Fatalf("expected 3 attempts per poison message but got %d", attempts)
+	}
+
+	parked, _ := store.List(ctx, deadletter.Filter{})
+	if len(parked) != 2 || parked[0].Error != "boom" || parked[0].Consumer != "projector" {
+		t.Fatalf("expected 2 dead letters from projector but got %+v", parked)
+	}
+
+	pub := &recordingRepublisher{}
+	n, err := deadletter.Redrive(ctx, store, pub, deadletter.Filter{EventType: "purchase.completed"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if n != 1 || len(pub.msgs) != 1 || pub.msgs[0].Type != "purchase.completed" {
+		t.Fatalf("expected only the purchase event to be redriven but got %+v", pub.msgs)
+	}
+
+	left, _ := store.List(ctx, deadletter.Filter{})
+	if len(left) != 1 || left[0].Message.Type != "loyalty.stamp_added" {
+		t.Fatalf("expected only the loyalty dead letter to remain but got %+v", left)
+	}
+}
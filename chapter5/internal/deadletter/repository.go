@@ -0,0 +1,182 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"coffeeco/internal/events"
+)
+
+type MongoStore struct {
+	entries *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoStore{entries: client.Database("coffeeco").Collection("dead_letters")}, nil
+}
+
+type mongoEntry struct {
+	ID            string            `bson:"_id"`
+	Topic         string            `bson:"topic"`
+	Consumer      string            `bson:"consumer"`
+	Error         string            `bson:"error"`
+	Attempts      int               `bson:"attempts"`
+	FailedAt      time.Time         `bson:"failed_at"`
+	RedrivenAt    *time.Time        `bson:"redriven_at"`
+	MessageID     string            `bson:"message_id"`
+	EventType     string            `bson:"event_type"`
+	Version       int               `bson:"version"`
+	AggregateID   string            `bson:"aggregate_id"`
+	OccurredAt    time.Time         `bson:"occurred_at"`
+	ContentType   string            `bson:"content_type"`
+	CorrelationID string            `bson:"correlation_id"`
+	CausationID   string            `bson:"causation_id"`
+	Payload       []byte            `bson:"payload"`
+	Headers       map[string]string `bson:"headers"`
+}
+
+func toMongoEntry(e Entry) mongoEntry {
+	return mongoEntry{
+		ID:            e.ID.String(),
+		Topic:         e.Topic,
+		Consumer:      e.Consumer,
+		Error:         e.Error,
+		Attempts:      e.Attempts,
+		FailedAt:      e.FailedAt,
+		RedrivenAt:    e.RedrivenAt,
+		MessageID:     e.Message.ID.String(),
+		EventType:     e.Message.Type,
+		Version:       e.Message.Version,
+		AggregateID:   e.Message.AggregateID,
+		OccurredAt:    e.Message.OccurredAt,
+		ContentType:   e.Message.ContentType,
+		CorrelationID: e.Message.CorrelationID,
+		CausationID:   e.Message.CausationID,
+		Payload:       e.Message.Payload,
+		Headers:       e.Message.Headers,
+	}
+}
+
+func (m mongoEntry) toEntry() Entry {
+	id, _ := uuid.Parse(m.ID)
+	msgID, _ := uuid.Parse(m.MessageID)
+	return Entry{
+		ID:         id,
+		Topic:      m.Topic,
+		Consumer:   m.Consumer,
+		Error:      m.Error,
+		Attempts:   m.Attempts,
+		FailedAt:   m.FailedAt,
+		RedrivenAt: m.RedrivenAt,
+		Message: events.Message{
+			ID:            msgID,
+			Type:          m.EventType,
+			Version:       m.Version,
+			AggregateID:   m.AggregateID,
+			OccurredAt:    m.OccurredAt,
+			ContentType:   m.ContentType,
+			CorrelationID: m.CorrelationID,
+			CausationID:   m.CausationID,
+			Payload:       m.Payload,
+			Headers:       m.Headers,
+		},
+	}
+}
+
+func (m *MongoStore) Add(ctx context.Context, e Entry) error {
+	if _, err := m.entries.InsertOne(ctx, toMongoEntry(e)); err != nil {
+		return fmt.Errorf("failed to store dead letter: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) List(ctx context.Context, f Filter) ([]Entry, error) {
+	query := bson.D{}
+	for k, v := range map[string]string{"topic": f.Topic, "consumer": f.Consumer, "event_type": f.EventType, "aggregate_id": f.AggregateID} {
+		if v != "" {
+			query = append(query, bson.E{Key: k, Value: v})
+		}
+	}
+	if !f.IncludeRedriven {
+		query = append(query, bson.E{Key: "redriven_at", Value: nil})
+	}
+	cur, err := m.entries.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "failed_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	var docs []mongoEntry
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letters: %w", err)
+	}
+	res := make([]Entry, 0, len(docs))
+	for _, d := range docs {
+		res = append(res, d.toEntry())
+	}
+	return res, nil
+}
+
+func (m *MongoStore) MarkRedriven(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := m.entries.UpdateOne(ctx,
+		bson.D{{Key: "_id", Value: id.String()}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "redriven_at", Value: at}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark dead letter as redriven: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MemoryStore keeps dead letters in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Add(_ context.Context, e Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *MemoryStore) List(_ context.Context, f Filter) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []Entry
+	for _, e := range m.entries {
+		if f.Matches(e) {
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) MarkRedriven(_ context.Context, id uuid.UUID, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.entries {
+		if m.entries[i].ID == id {
+			m.entries[i].RedrivenAt = &at
+			return nil
+		}
+	}
+	return ErrNotFound
+}
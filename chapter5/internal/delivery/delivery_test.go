@@ -0,0 +1,214 @@
+package delivery_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/delivery"
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+type stores []store.Store
+
+func (s stores) GetStores(_ context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	var res []store.Store
+	for _, st := range s {
+		if st.ID == ids[0] {
+			res = append(res, st)
+		}
+	}
+	return res, nil
+}
+
+func Test_OnlyEligiblePurchasesAreDelivered(t *testing.T) {
+	ctx := context.Background()
+	shop := store.New(uuid.New(), "1 Harbour St")
+	courier := delivery.NewMockProvider(*money.New(350, "USD"))
+	courier.Serves = func(address string) bool { return !strings.Contains(address, "Island") }
+	svc := delivery.NewService(delivery.NewMemoryRepo(), courier, stores{shop}, delivery.WithMinimumOrder(*money.New(1000, "USD")))
+	home := purchase.Delivery{Address: "9 Hill Rd", Phone: "+15555550100"}
+
+	fee, err := svc.Quote(ctx, shop.ID, uuid.New(), home, *money.New(1200, "USD"))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if fee.Amount() != 350 {
+		t.Fatalf("expected the courier's fee but got %s", fee.Display())
+	}
+	for name, quote := range map[string]func() error{
+		"under the minimum order": func() error {
+			_, err := svc.Quote(ctx, shop.ID, uuid.New(), home, *money.New(800, "USD"))
+			return err
+		},
+		"out of range": func() error {
+			_, err := svc.Quote(ctx, shop.ID, uuid.New(), purchase.Delivery{Address: "Island Way", Phone: "+15555550100"}, *money.New(1200, "USD"))
+			return err
+		},
+		"without a phone": func() error {
+			_, err := svc.Quote(ctx, shop.ID, uuid.New(), purchase.Delivery{Address: "9 Hill Rd"}, *money.New(1200, "USD"))
+			return err
+		},
+		"from an unknown store": func() error {
+			_, err := svc.Quote(ctx, uuid.New(), uuid.New(), home, *money.New(1200, "USD"))
+			return err
+		},
+	} {
+		if err := quote(); !errors.Is(err, delivery.ErrNotDeliverable) {
+			t.Fatalf("expected a purchase %s not to be deliverable but got %v", name, err)
+		}
+	}
+}
+
+func Test_DeliveriesAreRequestedOnceAndTracked(t *testing.T) {
+	ctx := context.Background()
+	shop := store.New(uuid.New(), "1 Harbour St")
+	courier := delivery.NewMockProvider(*money.New(350, "USD"))
+	var published capture
+	svc := delivery.NewService(delivery.NewMemoryRepo(), courier, stores{shop}, delivery.WithEventPublisher(&published))
+
+	e := purchase.Completed{
+		PurchaseID: uuid.New(),
+		StoreID:    shop.ID,
+		Lines: []purchase.CompletedLine{
+			{ItemName: "latte", Amount: 450},
+			{ItemName: purchase.DeliveryFeeItem, Amount: 350},
+		},
+		Total:           800,
+		Currency:        "USD",
+		PurchasedAt:     time.Now(),
+		DeliveryAddress: "9 Hill Rd",
+		DeliveryPhone:   "+15555550100",
+	}
+	msg, err := events.NewMessage(e, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	for range 2 {
+		if err := svc.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	j, err := svc.Job(ctx, e.PurchaseID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if j.Status() != delivery.StatusRequested || j.Fee.Amount() != 350 || j.Pickup != shop.Location || j.TrackingURL() == "" {
+		t.Fatalf("expected the delivery to be requested from the store for its fee but got %+v", j)
+	}
+	if len(courier.Created()) != 1 || len(published) != 1 {
+		t.Fatalf("expected one request and one event but got %d and %d", len(courier.Created()), len(published))
+	}
+
+	now := time.Now()
+	for _, u := range []delivery.Update{
+		{Status: delivery.StatusPickedUp, Courier: "Sam", At: now},
+		// Late updates do not move the delivery back.
+		{Status: delivery.StatusCourierAssigned, Courier: "Sam", At: now.Add(-time.Minute)},
+		{Status: delivery.StatusDelivered, At: now.Add(10 * time.Minute)},
+		{Status: delivery.StatusCancelled, At: now.Add(11 * time.Minute)},
+	} {
+		if err := svc.Track(ctx, e.PurchaseID, u); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	j, _ = svc.Job(ctx, e.PurchaseID)
+	if j.Status() != delivery.StatusDelivered || j.Courier() != "Sam" {
+		t.Fatalf("expected the delivery to have been delivered by Sam but got %s by %q", j.Status(), j.Courier())
+	}
+	if len(published) != 3 {
+		t.Fatalf("expected only the changes to be published but got %+v", published)
+	}
+}
+
+type tracked []delivery.Update
+
+func (t *tracked) Track(_ context.Context, _ uuid.UUID, u delivery.Update) error {
+	*t = append(*t, u)
+	return nil
+}
+
+func Test_DoorDashAcceptsTheQuoteAndReportsDashers(t *testing.T) {
+	var paths []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/accept"):
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": "not_found", "message": "quote expired"})
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]any{"fee": 975, "currency": "USD", "tracking_url": "https://doordash.test/t/1"})
+		}
+	}))
+	defer api.Close()
+	dd, err := delivery.NewDoorDash(delivery.DoorDashConfig{
+		DeveloperID:   "dev",
+		KeyID:         "key",
+		SigningSecret: base64.RawURLEncoding.EncodeToString([]byte("a-signing-secret-of-32-bytes-or-more")),
+		WebhookToken:  "hook-token",
+		BaseURL:       api.URL,
+	}, api.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	r := delivery.Request{ID: uuid.New(), Pickup: "1 Harbour St", Dropoff: "9 Hill Rd", Phone: "+15555550100", OrderValue: *money.New(800, "USD")}
+
+	q, err := dd.Quote(context.Background(), r)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if q.Fee.Amount() != 975 {
+		t.Fatalf("expected a fee of 9.75 but got %s", q.Fee.Display())
+	}
+	url, err := dd.Create(context.Background(), r)
+	if err != nil || url != "https://doordash.test/t/1" {
+		t.Fatalf("expected the delivery to be created once the quote expired but got %q, %v", url, err)
+	}
+	if len(paths) != 3 || paths[2] != "/drive/v2/deliveries" {
+		t.Fatalf("expected quote, accept and create but got %v", paths)
+	}
+
+	var got tracked
+	hook := dd.Webhook(&got)
+	for _, c := range []struct {
+		token, body string
+		status      int
+	}{
+		{"wrong", `{"event_name":"DASHER_PICKED_UP","external_delivery_id":"` + r.ID.String() + `"}`, http.StatusUnauthorized},
+		{"hook-token", `{"event_name":"DASHER_PICKED_UP","external_delivery_id":"` + r.ID.String() + `","dasher_name":"Sam"}`, http.StatusNoContent},
+		{"hook-token", `{"event_name":"DELIVERY_BATCHED","external_delivery_id":"` + r.ID.String() + `"}`, http.StatusNoContent},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/doordash", strings.NewReader(c.body))
+		req.Header.Set("Authorization", c.token)
+		rec := httptest.NewRecorder()
+		hook.ServeHTTP(rec, req)
+		if rec.Code != c.status {
+			t.Fatalf("expected %d for %s but got %d", c.status, c.body, rec.Code)
+		}
+	}
+	if len(got) != 1 || got[0].Status != delivery.StatusPickedUp || got[0].Courier != "Sam" {
+		t.Fatalf("expected only the pick up to be tracked but got %+v", got)
+	}
+}
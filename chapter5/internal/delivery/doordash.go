@@ -0,0 +1,231 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/uuid"
+)
+
+const doorDashURL = "https://openapi.doordash.com"
+
+// DoorDashConfig holds the access key made under Developer Portal > Credentials, and the Authorization
+// header value DoorDash is set up to send with webhooks.
+type DoorDashConfig struct {
+	DeveloperID   string `json:"developer_id"`
+	KeyID         string `json:"key_id"`
+	SigningSecret string `json:"signing_secret"`
+	WebhookToken  string `json:"webhook_token"`
+	// BaseURL defaults to DoorDash's API; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// DoorDash delivers through the DoorDash Drive API. Deliveries are quoted when the purchase is priced and
+// the quote is accepted once the purchase is paid for, so the customer pays what was quoted.
+type DoorDash struct {
+	cfg    DoorDashConfig
+	secret []byte
+	client *http.Client
+}
+
+func NewDoorDash(cfg DoorDashConfig, client *http.Client) (*DoorDash, error) {
+	if cfg.DeveloperID == "" || cfg.KeyID == "" || cfg.WebhookToken == "" {
+		return nil, errors.New("doordash needs a developer ID, key ID and webhook token")
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(cfg.SigningSecret)
+	if err != nil || len(secret) == 0 {
+		return nil, errors.New("doordash signing secret must be the base64url secret of the access key")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = doorDashURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &DoorDash{cfg: cfg, secret: secret, client: client}, nil
+}
+
+type doorDashDelivery struct {
+	ExternalDeliveryID   string    `json:"external_delivery_id"`
+	PickupAddress        string    `json:"pickup_address,omitempty"`
+	DropoffAddress       string    `json:"dropoff_address,omitempty"`
+	DropoffPhoneNumber   string    `json:"dropoff_phone_number,omitempty"`
+	OrderValue           int64     `json:"order_value,omitempty"`
+	Currency             string    `json:"currency,omitempty"`
+	Fee                  int64     `json:"fee,omitempty"`
+	DropoffTimeEstimated time.Time `json:"dropoff_time_estimated,omitzero"`
+	TrackingURL          string    `json:"tracking_url,omitempty"`
+}
+
+type doorDashError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func toDoorDash(r Request) doorDashDelivery {
+	d := doorDashDelivery{
+		ExternalDeliveryID: r.ID.String(),
+		PickupAddress:      r.Pickup,
+		DropoffAddress:     r.Dropoff,
+		DropoffPhoneNumber: r.Phone,
+	}
+	// Only quotes need the order value.
+	if r.OrderValue.Currency() != nil {
+		d.OrderValue, d.Currency = r.OrderValue.Amount(), r.OrderValue.Currency().Code
+	}
+	return d
+}
+
+func (d *DoorDash) Quote(ctx context.Context, r Request) (Quote, error) {
+	var res doorDashDelivery
+	status, err := d.do(ctx, http.MethodPost, "/drive/v2/quotes", toDoorDash(r), &res)
+	if err != nil {
+		// DoorDash turns down addresses it does not serve as invalid requests.
+		if status == http.StatusBadRequest || status == http.StatusUnprocessableEntity {
+			return Quote{}, fmt.Errorf("%w: %w", ErrNotDeliverable, err)
+		}
+		return Quote{}, err
+	}
+	return Quote{Fee: *money.New(res.Fee, res.Currency), DropoffBy: res.DropoffTimeEstimated}, nil
+}
+
+// Create accepts the quote made for the purchase. A quote only lasts a few minutes, so if it is gone the
+// delivery is created at the current price; DoorDash charges any difference to the business, not the
+// customer. A delivery that already exists is returned as it is.
+func (d *DoorDash) Create(ctx context.Context, r Request) (string, error) {
+	var res doorDashDelivery
+	status, err := d.do(ctx, http.MethodPost, "/drive/v2/quotes/"+r.ID.String()+"/accept", struct{}{}, &res)
+	if status == http.StatusNotFound || status == http.StatusBadRequest {
+		status, err = d.do(ctx, http.MethodPost, "/drive/v2/deliveries", toDoorDash(r), &res)
+	}
+	if status == http.StatusConflict {
+		_, err = d.do(ctx, http.MethodGet, "/drive/v2/deliveries/"+r.ID.String(), nil, &res)
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.TrackingURL, nil
+}
+
+// do sends body, if any, and decodes a successful response into res. It returns the status code even when
+// the request failed, for callers that tell failures apart by it.
+func (d *DoorDash) do(ctx context.Context, method, path string, body, res any) (int, error) {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode doordash request: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.cfg.BaseURL+path, payload)
+	if err != nil {
+		return 0, err
+	}
+	token, err := d.token()
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach doordash: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e doorDashError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("doordash %s %s: %d %s: %s", method, path, resp.StatusCode, e.Code, e.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode doordash response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// token is the short-lived JWT DoorDash expects on every request, signed with the access key.
+func (d *DoorDash) token() (string, error) {
+	opts := (&jose.SignerOptions{}).WithType("JWT").WithHeader("dd-ver", "DD-JWT-V1").WithHeader("kid", d.cfg.KeyID)
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.HS256, Key: d.secret}, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign doordash token: %w", err)
+	}
+	now := time.Now()
+	return jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   d.cfg.DeveloperID,
+		Audience: jwt.Audience{"doordash"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}).Serialize()
+}
+
+// Tracker is told what couriers report, e.g. Service.
+type Tracker interface {
+	Track(ctx context.Context, id uuid.UUID, u Update) error
+}
+
+// doorDashStatuses maps the webhook events that move a delivery along. Other events are acknowledged
+// and ignored.
+var doorDashStatuses = map[string]Status{
+	"DASHER_CONFIRMED":                 StatusCourierAssigned,
+	"DASHER_CONFIRMED_PICKUP_ARRIVAL":  StatusCourierAssigned,
+	"DASHER_PICKED_UP":                 StatusPickedUp,
+	"DASHER_CONFIRMED_DROPOFF_ARRIVAL": StatusPickedUp,
+	"DASHER_DROPPED_OFF":               StatusDelivered,
+	"DELIVERY_CANCELLED":               StatusCancelled,
+	"DELIVERY_RETURNED":                StatusCancelled,
+}
+
+type doorDashEvent struct {
+	EventName          string    `json:"event_name"`
+	ExternalDeliveryID string    `json:"external_delivery_id"`
+	DasherName         string    `json:"dasher_name"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// Webhook receives DoorDash's delivery events and passes them to t. DoorDash retries anything but a 2xx,
+// so failures to track an event are returned as 5xx.
+func (d *DoorDash) Webhook(t Tracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(d.cfg.WebhookToken)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e doorDashEvent
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&e); err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		status, ok := doorDashStatuses[e.EventName]
+		id, err := uuid.Parse(e.ExternalDeliveryID)
+		if !ok || err != nil {
+			// Deliveries made from DoorDash's own dashboard do not have one of our IDs.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if e.CreatedAt.IsZero() {
+			e.CreatedAt = time.Now()
+		}
+		err = t.Track(r.Context(), id, Update{Status: status, Courier: e.DasherName, At: e.CreatedAt})
+		switch {
+		case errors.Is(err, ErrNotFound):
+			w.WriteHeader(http.StatusNoContent)
+		case err != nil:
+			http.Error(w, "event not tracked", http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
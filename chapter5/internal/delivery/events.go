@@ -0,0 +1,52 @@
+package delivery
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const EventTypeStatusChanged = "delivery.status_changed"
+
+// StatusChanged is published every time a delivery moves to a new Status, so the customer can follow it.
+type StatusChanged struct {
+	PurchaseID  uuid.UUID `json:"purchase_id"`
+	StoreID     uuid.UUID `json:"store_id"`
+	CustomerID  uuid.UUID `json:"customer_id"`
+	Status      Status    `json:"status"`
+	Courier     string    `json:"courier,omitempty"`
+	TrackingURL string    `json:"tracking_url,omitempty"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+func (s StatusChanged) EventType() string {
+	return EventTypeStatusChanged
+}
+
+func (s StatusChanged) AggregateID() uuid.UUID {
+	return s.PurchaseID
+}
+
+// EventID is derived from the delivery and status, as a delivery reaches each status only once.
+func (s StatusChanged) EventID() uuid.UUID {
+	return uuid.NewSHA1(s.PurchaseID, []byte(EventTypeStatusChanged+"."+string(s.Status)))
+}
+
+// RegisterEvents adds decoders for every version of the delivery events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeStatusChanged, 1, events.JSONDecoder[StatusChanged]())
+}
+
+func (j *Job) statusChanged() StatusChanged {
+	return StatusChanged{
+		PurchaseID:  j.ID,
+		StoreID:     j.StoreID,
+		CustomerID:  j.CustomerID,
+		Status:      j.status,
+		Courier:     j.courier,
+		TrackingURL: j.trackingURL,
+		ChangedAt:   j.updatedAt,
+	}
+}
@@ -0,0 +1,124 @@
+package delivery
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("no such delivery")
+	// ErrNotDeliverable is wrapped with the reason, e.g. the address is out of the courier's range.
+	ErrNotDeliverable      = errors.New("purchase cannot be delivered")
+	ErrConcurrencyConflict = errors.New("delivery changed since it was read")
+)
+
+// Status is where a delivery is on its way to the customer.
+type Status string
+
+const (
+	// StatusPending deliveries have not been handed to the courier yet.
+	StatusPending         Status = "pending"
+	StatusRequested       Status = "requested"
+	StatusCourierAssigned Status = "courier_assigned"
+	StatusPickedUp        Status = "picked_up"
+	StatusDelivered       Status = "delivered"
+	StatusCancelled       Status = "cancelled"
+)
+
+// rank orders the statuses a delivery goes through, so updates that arrive late can be told apart.
+var rank = map[Status]int{
+	StatusPending:         0,
+	StatusRequested:       1,
+	StatusCourierAssigned: 2,
+	StatusPickedUp:        3,
+	StatusDelivered:       4,
+	StatusCancelled:       4,
+}
+
+// Update is what a courier reports about a delivery.
+type Update struct {
+	Status Status
+	// Courier is the name of whoever is taking the delivery, once one is assigned.
+	Courier string
+	At      time.Time
+}
+
+// Job is the delivery of one purchase, identified by the purchase. The courier provider knows it by the
+// same ID.
+type Job struct {
+	ID         uuid.UUID
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID
+	Pickup     string
+	Dropoff    string
+	Phone      string
+	// Fee is what the customer was charged for the delivery.
+	Fee         money.Money
+	RequestedAt time.Time
+
+	version     int
+	status      Status
+	courier     string
+	trackingURL string
+	updatedAt   time.Time
+}
+
+func NewJob(id, storeID, customerID uuid.UUID, pickup, dropoff, phone string, fee money.Money, at time.Time) *Job {
+	return &Job{
+		ID:          id,
+		StoreID:     storeID,
+		CustomerID:  customerID,
+		Pickup:      pickup,
+		Dropoff:     dropoff,
+		Phone:       phone,
+		Fee:         fee,
+		RequestedAt: at.UTC(),
+		status:      StatusPending,
+		updatedAt:   at.UTC(),
+	}
+}
+
+func (j *Job) Status() Status {
+	return j.status
+}
+
+func (j *Job) Courier() string {
+	return j.courier
+}
+
+// TrackingURL is where the customer can follow the courier, once the courier provider has the delivery.
+func (j *Job) TrackingURL() string {
+	return j.trackingURL
+}
+
+func (j *Job) UpdatedAt() time.Time {
+	return j.updatedAt
+}
+
+// Requested records that the courier provider took the delivery on.
+func (j *Job) Requested(trackingURL string, at time.Time) bool {
+	if j.status != StatusPending {
+		return false
+	}
+	j.trackingURL = trackingURL
+	return j.Track(Update{Status: StatusRequested, At: at})
+}
+
+// Track applies an update from the courier and says whether it changed anything. Couriers do not
+// guarantee the order of their updates, so one that would move the delivery back, or change it once it
+// was delivered or cancelled, is ignored.
+func (j *Job) Track(u Update) bool {
+	r, ok := rank[u.Status]
+	if !ok || r <= rank[j.status] {
+		return false
+	}
+	j.status = u.Status
+	if u.Courier != "" {
+		j.courier = u.Courier
+	}
+	j.updatedAt = u.At.UTC()
+	return true
+}
@@ -0,0 +1,78 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+// Request is a delivery as a courier provider sees it.
+type Request struct {
+	// ID is the purchase's, which the provider keeps as its reference for the delivery.
+	ID      uuid.UUID
+	Pickup  string
+	Dropoff string
+	Phone   string
+	// OrderValue is only set when quoting.
+	OrderValue money.Money
+}
+
+// Quote is what a courier provider charges for a delivery and when it expects to drop it off.
+type Quote struct {
+	Fee       money.Money
+	DropoffBy time.Time
+}
+
+// Provider is a courier service, e.g. DoorDash. Couriers report on deliveries through their own webhooks,
+// which are fed to Service.Track.
+type Provider interface {
+	// Quote fails with an error matching ErrNotDeliverable if the provider cannot take the delivery.
+	Quote(ctx context.Context, r Request) (Quote, error)
+	// Create hands the delivery to the provider and returns where the customer can follow it. It must be
+	// safe to call again for the same request ID.
+	Create(ctx context.Context, r Request) (trackingURL string, err error)
+}
+
+// MockProvider charges a flat fee and delivers anywhere it Serves, without anyone going anywhere. It is
+// meant for tests and local experiments; feed it updates with Service.Track.
+type MockProvider struct {
+	Fee money.Money
+	// Serves says whether an address is in range. Nil serves every address.
+	Serves func(address string) bool
+
+	mu      sync.Mutex
+	created map[uuid.UUID]Request
+}
+
+func NewMockProvider(fee money.Money) *MockProvider {
+	return &MockProvider{Fee: fee, created: map[uuid.UUID]Request{}}
+}
+
+func (m *MockProvider) Quote(_ context.Context, r Request) (Quote, error) {
+	if m.Serves != nil && !m.Serves(r.Dropoff) {
+		return Quote{}, fmt.Errorf("%w: %s is out of range", ErrNotDeliverable, r.Dropoff)
+	}
+	return Quote{Fee: m.Fee, DropoffBy: time.Now().Add(30 * time.Minute)}, nil
+}
+
+func (m *MockProvider) Create(_ context.Context, r Request) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.created[r.ID] = r
+	return "https://courier.invalid/track/" + r.ID.String(), nil
+}
+
+// Created returns the deliveries handed to the provider, by ID.
+func (m *MockProvider) Created() map[uuid.UUID]Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[uuid.UUID]Request, len(m.created))
+	for id, r := range m.created {
+		res[id] = r
+	}
+	return res
+}
@@ -0,0 +1,188 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such delivery.
+	Get(ctx context.Context, id uuid.UUID) (*Job, error)
+	// Save returns ErrConcurrencyConflict if the delivery was saved by someone else since it was read, or
+	// if a new delivery already exists.
+	Save(ctx context.Context, j *Job) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps deliveries versioned, as couriers may report on the same one at once.
+type MongoRepository struct {
+	client     *mongo.Client
+	deliveries *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, deliveries: client.Database("coffeeco").Collection("deliveries")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoJob struct {
+	ID          string    `bson:"_id"`
+	Version     int       `bson:"version"`
+	StoreID     string    `bson:"store_id"`
+	CustomerID  string    `bson:"customer_id,omitempty"`
+	Pickup      string    `bson:"pickup"`
+	Dropoff     string    `bson:"dropoff"`
+	Phone       string    `bson:"phone"`
+	Fee         int64     `bson:"fee"`
+	Currency    string    `bson:"currency"`
+	RequestedAt time.Time `bson:"requested_at"`
+	Status      string    `bson:"status"`
+	Courier     string    `bson:"courier,omitempty"`
+	TrackingURL string    `bson:"tracking_url,omitempty"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+func toMongoJob(j *Job) mongoJob {
+	doc := mongoJob{
+		ID:          j.ID.String(),
+		Version:     j.version,
+		StoreID:     j.StoreID.String(),
+		Pickup:      j.Pickup,
+		Dropoff:     j.Dropoff,
+		Phone:       j.Phone,
+		Fee:         j.Fee.Amount(),
+		Currency:    j.Fee.Currency().Code,
+		RequestedAt: j.RequestedAt,
+		Status:      string(j.status),
+		Courier:     j.courier,
+		TrackingURL: j.trackingURL,
+		UpdatedAt:   j.updatedAt,
+	}
+	if j.CustomerID != uuid.Nil {
+		doc.CustomerID = j.CustomerID.String()
+	}
+	return doc
+}
+
+func (m mongoJob) toJob() *Job {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	return &Job{
+		ID:          id,
+		StoreID:     storeID,
+		CustomerID:  customerID,
+		Pickup:      m.Pickup,
+		Dropoff:     m.Dropoff,
+		Phone:       m.Phone,
+		Fee:         *money.New(m.Fee, m.Currency),
+		RequestedAt: m.RequestedAt,
+		version:     m.Version,
+		status:      Status(m.Status),
+		courier:     m.Courier,
+		trackingURL: m.TrackingURL,
+		updatedAt:   m.UpdatedAt,
+	}
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Job, err error) {
+	ctx, span := telemetry.StartClient(ctx, "delivery.MongoRepository.Get", attribute.String("delivery.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoJob
+	if err := m.deliveries.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find delivery: %w", err)
+	}
+	return doc.toJob(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, j *Job) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "delivery.MongoRepository.Save", attribute.String("delivery.id", j.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoJob(j)
+	doc.Version = j.version + 1
+	if j.version == 0 {
+		if _, err := m.deliveries.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save delivery: %w", err)
+		}
+	} else {
+		res, err := m.deliveries.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: j.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save delivery: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	j.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.deliveries.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps deliveries in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu         sync.Mutex
+	deliveries map[uuid.UUID]mongoJob
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{deliveries: map[uuid.UUID]mongoJob{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toJob(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, j *Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.deliveries[j.ID].Version != j.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoJob(j)
+	doc.Version = j.version + 1
+	m.deliveries[j.ID] = doc
+	j.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
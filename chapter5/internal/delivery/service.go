@@ -0,0 +1,216 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the delivery first.
+const saveAttempts = 3
+
+// Stores tells where purchases are picked up, e.g. store.Service.
+type Stores interface {
+	GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error)
+}
+
+type Service struct {
+	repo         Repository
+	provider     Provider
+	stores       Stores
+	registry     *events.Registry
+	minimumOrder *money.Money     // 可选, 低于此金额不配送
+	publisher    events.Publisher // 可选, 发布配送状态
+	logger       *slog.Logger
+	now          func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithMinimumOrder turns down deliveries of purchases worth less than m, before the fee.
+func WithMinimumOrder(m money.Money) Option {
+	return func(s *Service) {
+		s.minimumOrder = &m
+	}
+}
+
+// WithEventPublisher publishes StatusChanged so customers can follow their delivery.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when deliveries were requested.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, provider Provider, stores Stores, opts ...Option) *Service {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	s := &Service{repo: repo, provider: provider, stores: stores, registry: r, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Quote is what the courier charges to deliver a purchase, for purchase.Service to add to it. Purchases
+// are delivered if they are worth the minimum order, the store has an address and the courier serves
+// the customer's; otherwise Quote fails with an error matching ErrNotDeliverable.
+func (s *Service) Quote(ctx context.Context, storeID, purchaseID uuid.UUID, to purchase.Delivery, orderValue money.Money) (money.Money, error) {
+	if to.Address == "" || to.Phone == "" {
+		return money.Money{}, fmt.Errorf("%w: the courier needs an address and a phone number", ErrNotDeliverable)
+	}
+	if s.minimumOrder != nil {
+		if less, err := orderValue.LessThan(s.minimumOrder); err != nil || less {
+			return money.Money{}, fmt.Errorf("%w: purchases under %s are not delivered", ErrNotDeliverable, s.minimumOrder.Display())
+		}
+	}
+	pickup, err := s.pickup(ctx, storeID)
+	if err != nil {
+		return money.Money{}, err
+	}
+	q, err := s.provider.Quote(ctx, Request{ID: purchaseID, Pickup: pickup, Dropoff: to.Address, Phone: to.Phone, OrderValue: orderValue})
+	if err != nil {
+		return money.Money{}, err
+	}
+	return q.Fee, nil
+}
+
+func (s *Service) pickup(ctx context.Context, storeID uuid.UUID) (string, error) {
+	stores, err := s.stores.GetStores(ctx, []uuid.UUID{storeID})
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the store: %w", err)
+	}
+	if len(stores) == 0 || stores[0].Location == "" {
+		return "", fmt.Errorf("%w: the store has no address", ErrNotDeliverable)
+	}
+	return stores[0].Location, nil
+}
+
+// Handle is an events.Handler for the purchase topic that hands every completed purchase to be delivered
+// to the courier. Other events are ignored, and a purchase delivered twice is only handed over once.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.Completed)
+	if e.DeliveryAddress == "" {
+		return nil
+	}
+	j, err := s.repo.Get(ctx, e.PurchaseID)
+	if errors.Is(err, ErrNotFound) {
+		j, err = s.newJob(ctx, e)
+	}
+	if err != nil {
+		return err
+	}
+	return s.request(ctx, j)
+}
+
+func (s *Service) newJob(ctx context.Context, e purchase.Completed) (*Job, error) {
+	pickup, err := s.pickup(ctx, e.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	fee := money.New(0, e.Currency)
+	for _, l := range e.Lines {
+		if l.ItemName == purchase.DeliveryFeeItem {
+			fee = money.New(l.Amount, e.Currency)
+		}
+	}
+	j := NewJob(e.PurchaseID, e.StoreID, e.CustomerID, pickup, e.DeliveryAddress, e.DeliveryPhone, *fee, s.now())
+	err = s.repo.Save(ctx, j)
+	if errors.Is(err, ErrConcurrencyConflict) {
+		return s.repo.Get(ctx, e.PurchaseID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save delivery: %w", err)
+	}
+	return j, nil
+}
+
+// request hands a pending delivery to the courier. Deliveries the courier already has are left alone.
+func (s *Service) request(ctx context.Context, j *Job) error {
+	if j.Status() != StatusPending {
+		return nil
+	}
+	trackingURL, err := s.provider.Create(ctx, Request{ID: j.ID, Pickup: j.Pickup, Dropoff: j.Dropoff, Phone: j.Phone})
+	if err != nil {
+		return fmt.Errorf("failed to request a courier: %w", err)
+	}
+	return s.update(ctx, j.ID, func(j *Job) bool {
+		return j.Requested(trackingURL, s.now())
+	})
+}
+
+// Job returns the delivery of a purchase, ErrNotFound if it was collected at the store.
+func (s *Service) Job(ctx context.Context, id uuid.UUID) (*Job, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Track applies what the courier reports about a delivery. Updates that arrive out of order are ignored.
+func (s *Service) Track(ctx context.Context, id uuid.UUID, u Update) error {
+	return s.update(ctx, id, func(j *Job) bool {
+		return j.Track(u)
+	})
+}
+
+// update applies fn to the latest delivery and saves it if fn changed it, starting over if someone else
+// saved in between. Once saved, the change is published; failing that is only logged.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(j *Job) bool) error {
+	for range saveAttempts {
+		j, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !fn(j) {
+			return nil
+		}
+		err = s.repo.Save(ctx, j)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.publish(ctx, j)
+		return nil
+	}
+	return fmt.Errorf("failed to update delivery after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) publish(ctx context.Context, j *Job) {
+	if s.publisher == nil {
+		return
+	}
+	if err := s.publisher.Publish(ctx, j.statusChanged()); err != nil {
+		s.logger.ErrorContext(ctx, "delivery saved but not published", "delivery", j.ID, "error", err)
+	}
+}
@@ -0,0 +1,128 @@
+package device
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/ddd"
+)
+
+var (
+	ErrNotFound = errors.New("no such device")
+	// ErrUnregistered means a purchase was made on a device that is not registered at its store.
+	ErrUnregistered = errors.New("device is not registered at this store")
+	// ErrRevoked means the device was revoked, e.g. because it was stolen, and takes no more purchases.
+	ErrRevoked             = errors.New("device was revoked")
+	ErrInvalidKey          = errors.New("device public key must be an ed25519 key")
+	ErrNoFirmware          = errors.New("device firmware version is required")
+	ErrNoReason            = errors.New("revoking a device needs a reason")
+	ErrConcurrencyConflict = errors.New("device changed since it was read")
+)
+
+// Device is a POS terminal registered at a store. It keeps the private half of its key pair to itself;
+// the registry knows it by its public key.
+type Device struct {
+	ddd.AggregateRoot
+	StoreID uuid.UUID
+	// Name tells the staff which terminal it is, e.g. "front till".
+	Name      string
+	PublicKey ed25519.PublicKey
+	Firmware  string
+	// RegisteredBy is who registered it, as in the audit log.
+	RegisteredBy string
+	RegisteredAt time.Time
+
+	revokedAt    time.Time
+	revokedBy    string
+	revokeReason string
+}
+
+// Registration is what a device is registered with.
+type Registration struct {
+	StoreID   uuid.UUID
+	Name      string // 可选, 方便店员辨认
+	PublicKey ed25519.PublicKey
+	Firmware  string
+}
+
+// ParsePublicKey reads a base64 encoded ed25519 public key, as terminals send it.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, ErrInvalidKey
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// New registers r at at, by registeredBy.
+func New(r Registration, registeredBy string, at time.Time) (*Device, error) {
+	r.Firmware = strings.TrimSpace(r.Firmware)
+	var errs []error
+	if len(r.PublicKey) != ed25519.PublicKeySize {
+		errs = append(errs, ErrInvalidKey)
+	}
+	if r.Firmware == "" {
+		errs = append(errs, ErrNoFirmware)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &Device{
+		AggregateRoot: ddd.AggregateRoot{ID: uuid.New()},
+		StoreID:       r.StoreID,
+		Name:          strings.TrimSpace(r.Name),
+		PublicKey:     r.PublicKey,
+		Firmware:      r.Firmware,
+		RegisteredBy:  registeredBy,
+		RegisteredAt:  at.UTC(),
+	}, nil
+}
+
+// Usable tells why the device cannot take a purchase at the store, if it cannot.
+func (d *Device) Usable(storeID uuid.UUID) error {
+	switch {
+	case !d.revokedAt.IsZero():
+		return ErrRevoked
+	case d.StoreID != storeID:
+		return ErrUnregistered
+	}
+	return nil
+}
+
+// UpdateFirmware records the firmware the device runs now.
+func (d *Device) UpdateFirmware(version string) error {
+	version = strings.TrimSpace(version)
+	if version == "" {
+		return ErrNoFirmware
+	}
+	d.Firmware = version
+	return nil
+}
+
+// Revoke has the device turn away every purchase from at on, e.g. once it is reported stolen. Revoking it
+// again changes nothing.
+func (d *Device) Revoke(reason, by string, at time.Time) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrNoReason
+	}
+	if d.revokedAt.IsZero() {
+		d.revokedAt, d.revokedBy, d.revokeReason = at.UTC(), by, reason
+	}
+	return nil
+}
+
+// RevokedAt is when the device was revoked; zero if it was not.
+func (d *Device) RevokedAt() time.Time {
+	return d.revokedAt
+}
+
+// RevokedBy is who revoked the device and why.
+func (d *Device) RevokedBy() (by, reason string) {
+	return d.revokedBy, d.revokeReason
+}
@@ -0,0 +1,104 @@
+package device_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/device"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/testsupport"
+)
+
+func publicKey(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func Test_RevokedDevicesAreTurnedAwayAtOnceAndAudited(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "manager@coffeeco")
+	auditLog := audit.NewMemoryRepo()
+	svc := device.NewService(device.NewMemoryRepo(), device.WithAuditLog(auditLog))
+	soho := uuid.New()
+
+	_, err := svc.Register(ctx, device.Registration{StoreID: soho, PublicKey: ed25519.PublicKey("short")})
+	for _, want := range []error{device.ErrInvalidKey, device.ErrNoFirmware} {
+		if !errors.Is(err, want) {
+			t.Fatalf("expected %v among the errors but got %v", want, err)
+		}
+	}
+	d, err := svc.Register(ctx, device.Registration{StoreID: soho, Name: "front till", PublicKey: publicKey(t), Firmware: "4.2.0"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Check(ctx, soho, d.ID); err != nil {
+		t.Fatalf("expected the device to be usable at its store but got %v", err)
+	}
+	if err := svc.Check(ctx, uuid.New(), d.ID); !errors.Is(err, device.ErrUnregistered) {
+		t.Fatalf("expected ErrUnregistered at another store but got %v", err)
+	}
+	if err := svc.Check(ctx, soho, uuid.New()); !errors.Is(err, device.ErrUnregistered) {
+		t.Fatalf("expected ErrUnregistered for an unknown device but got %v", err)
+	}
+
+	if _, err := svc.Revoke(ctx, d.ID, ""); !errors.Is(err, device.ErrNoReason) {
+		t.Fatalf("expected ErrNoReason but got %v", err)
+	}
+	if _, err := svc.Revoke(ctx, d.ID, "reported stolen"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Check(ctx, soho, d.ID); !errors.Is(err, device.ErrRevoked) {
+		t.Fatalf("expected ErrRevoked but got %v", err)
+	}
+	entries, _ := auditLog.Query(ctx, audit.Query{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	if len(entries) != 2 || entries[0].Action != audit.ActionDeviceRevoke || entries[0].After != "reported stolen" || entries[1].Action != audit.ActionDeviceRegister {
+		t.Fatalf("expected the registration and the revocation but got %+v", entries)
+	}
+}
+
+func Test_InStorePurchasesNeedARegisteredDevice(t *testing.T) {
+	ctx := context.Background()
+	devices := device.NewService(device.NewMemoryRepo())
+	soho := uuid.New()
+	till, err := devices.Register(ctx, device.Registration{StoreID: soho, PublicKey: publicKey(t), Firmware: "4.2.0"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	svc := purchase.NewService(nil, testsupport.NewFakePurchases(), nil, purchase.WithDevices(devices))
+	buy := func(deviceID uuid.UUID, channel purchase.Channel) error {
+		return svc.CompletePurchase(ctx, soho, &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}},
+			PaymentMeans:       payment.MEANS_CASH,
+			Channel:            channel,
+			DeviceID:           deviceID,
+		}, nil)
+	}
+
+	if err := buy(uuid.Nil, ""); !errors.Is(err, purchase.ErrNoDevice) {
+		t.Fatalf("expected ErrNoDevice but got %v", err)
+	}
+	if err := buy(uuid.Nil, purchase.ChannelApp); err != nil {
+		t.Fatalf("expected app orders to need no device but got %v", err)
+	}
+	if err := buy(till.ID, ""); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := devices.Revoke(ctx, till.ID, "reported stolen"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := buy(till.ID, ""); !errors.Is(err, device.ErrRevoked) {
+		t.Fatalf("expected ErrRevoked but got %v", err)
+	}
+}
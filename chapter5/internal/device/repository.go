@@ -0,0 +1,214 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such device.
+	Get(ctx context.Context, id uuid.UUID) (*Device, error)
+	// ForStore returns every device registered at a store, revoked ones too, oldest first.
+	ForStore(ctx context.Context, storeID uuid.UUID) ([]*Device, error)
+	// Save returns ErrConcurrencyConflict if the device was saved by someone else since it was read.
+	Save(ctx context.Context, d *Device) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps devices versioned, as a device may be revoked while its firmware is updated.
+type MongoRepository struct {
+	client  *mongo.Client
+	devices *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	devices := client.Database("coffeeco").Collection("pos_devices")
+	_, err = devices.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "registered_at", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create device indexes: %w", err)
+	}
+	return &MongoRepository{client: client, devices: devices}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoDevice struct {
+	ID           string    `bson:"_id"`
+	Version      int       `bson:"version"`
+	StoreID      string    `bson:"store_id"`
+	Name         string    `bson:"name,omitempty"`
+	PublicKey    []byte    `bson:"public_key"`
+	Firmware     string    `bson:"firmware"`
+	RegisteredBy string    `bson:"registered_by"`
+	RegisteredAt time.Time `bson:"registered_at"`
+	RevokedAt    time.Time `bson:"revoked_at,omitempty"`
+	RevokedBy    string    `bson:"revoked_by,omitempty"`
+	RevokeReason string    `bson:"revoke_reason,omitempty"`
+}
+
+func toMongoDevice(d *Device) mongoDevice {
+	return mongoDevice{
+		ID:           d.ID.String(),
+		Version:      d.Version(),
+		StoreID:      d.StoreID.String(),
+		Name:         d.Name,
+		PublicKey:    slices.Clone(d.PublicKey),
+		Firmware:     d.Firmware,
+		RegisteredBy: d.RegisteredBy,
+		RegisteredAt: d.RegisteredAt,
+		RevokedAt:    d.revokedAt,
+		RevokedBy:    d.revokedBy,
+		RevokeReason: d.revokeReason,
+	}
+}
+
+func (m mongoDevice) toDevice() *Device {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	d := &Device{
+		StoreID:      storeID,
+		Name:         m.Name,
+		PublicKey:    slices.Clone(m.PublicKey),
+		Firmware:     m.Firmware,
+		RegisteredBy: m.RegisteredBy,
+		RegisteredAt: m.RegisteredAt,
+		revokedAt:    m.RevokedAt,
+		revokedBy:    m.RevokedBy,
+		revokeReason: m.RevokeReason,
+	}
+	d.ID = id
+	d.SetVersion(m.Version)
+	return d
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Device, err error) {
+	ctx, span := telemetry.StartClient(ctx, "device.MongoRepository.Get", attribute.String("device.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoDevice
+	if err := m.devices.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find device: %w", err)
+	}
+	return doc.toDevice(), nil
+}
+
+func (m *MongoRepository) ForStore(ctx context.Context, storeID uuid.UUID) (_ []*Device, err error) {
+	ctx, span := telemetry.StartClient(ctx, "device.MongoRepository.ForStore", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.devices.Find(ctx, bson.D{{Key: "store_id", Value: storeID.String()}}, options.Find().SetSort(bson.D{{Key: "registered_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find devices: %w", err)
+	}
+	var docs []mongoDevice
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode devices: %w", err)
+	}
+	res := make([]*Device, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.toDevice())
+	}
+	return res, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, d *Device) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "device.MongoRepository.Save", attribute.String("device.id", d.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoDevice(d)
+	doc.Version = d.Version() + 1
+	if d.Version() == 0 {
+		if _, err := m.devices.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save device: %w", err)
+		}
+	} else {
+		res, err := m.devices.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: d.Version()}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save device: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	d.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.devices.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps devices in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	devices map[uuid.UUID]mongoDevice
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{devices: map[uuid.UUID]mongoDevice{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.devices[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toDevice(), nil
+}
+
+func (m *MemoryRepository) ForStore(_ context.Context, storeID uuid.UUID) ([]*Device, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*Device
+	for _, doc := range m.devices {
+		if doc.StoreID == storeID.String() {
+			res = append(res, doc.toDevice())
+		}
+	}
+	slices.SortFunc(res, func(a, b *Device) int { return a.RegisteredAt.Compare(b.RegisteredAt) })
+	return res, nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, d *Device) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.devices[d.ID].Version != d.Version() {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoDevice(d)
+	doc.Version = d.Version() + 1
+	m.devices[d.ID] = doc
+	d.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
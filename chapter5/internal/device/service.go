@@ -0,0 +1,126 @@
+package device
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+)
+
+type Service struct {
+	repo  Repository
+	audit audit.Recorder // 可选, 记录登记和吊销
+	now   func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithAuditLog records every device registered or revoked in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithClock replaces time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a terminal to its store. Whoever acts in ctx, see audit.Actor, is recorded as having
+// registered it.
+func (s *Service) Register(ctx context.Context, r Registration) (*Device, error) {
+	d, err := New(r, audit.Actor(ctx), s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, audit.ActionDeviceRegister, d, "", "firmware "+d.Firmware); err != nil {
+		return nil, fmt.Errorf("device registered but failed to record it in the audit log: %w", err)
+	}
+	return d, nil
+}
+
+// UpdateFirmware records the firmware a device was updated to.
+func (s *Service) UpdateFirmware(ctx context.Context, id uuid.UUID, version string) (*Device, error) {
+	d, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.UpdateFirmware(version); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Revoke has a device turn away every further purchase, e.g. once it is reported stolen.
+func (s *Service) Revoke(ctx context.Context, id uuid.UUID, reason string) (*Device, error) {
+	d, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !d.RevokedAt().IsZero() {
+		return d, nil
+	}
+	if err := d.Revoke(reason, audit.Actor(ctx), s.now()); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, d); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, audit.ActionDeviceRevoke, d, "", reason); err != nil {
+		return nil, fmt.Errorf("device revoked but failed to record it in the audit log: %w", err)
+	}
+	return d, nil
+}
+
+func (s *Service) record(ctx context.Context, action audit.Action, d *Device, before, after string) error {
+	if s.audit == nil {
+		return nil
+	}
+	entry := audit.NewEntry(ctx, action, "device", d.ID.String(), before, after)
+	entry.Note = "store " + d.StoreID.String() + ", key " + base64.StdEncoding.EncodeToString(d.PublicKey)
+	return s.audit.Record(ctx, entry)
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Device, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *Service) ForStore(ctx context.Context, storeID uuid.UUID) ([]*Device, error) {
+	return s.repo.ForStore(ctx, storeID)
+}
+
+// Check tells why a purchase at the store cannot be made on the device, if it cannot: ErrUnregistered if
+// it is not registered there, or ErrRevoked. It reads the device every time, so a revoked device is turned
+// away at once.
+func (s *Service) Check(ctx context.Context, storeID, id uuid.UUID) error {
+	d, err := s.repo.Get(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return ErrUnregistered
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get device: %w", err)
+	}
+	return d.Usable(storeID)
+}
@@ -0,0 +1,156 @@
+package entitlement
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/ddd"
+)
+
+var (
+	ErrNotFound            = errors.New("no such entitlement")
+	ErrNotEntitled         = errors.New("customer has no discount entitlement")
+	ErrUnknownKind         = errors.New("entitlement must be for an employee or a partner")
+	ErrNoPartner           = errors.New("a partner entitlement needs the partner company")
+	ErrInvalidPercent      = errors.New("entitlement must take between 0 and 100 percent off")
+	ErrInvalidCap          = errors.New("monthly cap must not be negative")
+	ErrInvalidExpiry       = errors.New("entitlement must expire after it is granted")
+	ErrRevoked             = errors.New("entitlement was revoked")
+	ErrExpired             = errors.New("entitlement has expired")
+	ErrCapReached          = errors.New("entitlement was used as often as it may be this month")
+	ErrConcurrencyConflict = errors.New("entitlement changed since it was read")
+)
+
+// Kind is who a discount was negotiated for.
+type Kind string
+
+const (
+	KindEmployee Kind = "employee"
+	// KindPartner is for the staff of a company we have a deal with.
+	KindPartner Kind = "partner"
+)
+
+// monthLayout keys the uses of an entitlement by calendar month, in UTC.
+const monthLayout = "2006-01"
+
+// Entitlement is a discount negotiated for one customer, e.g. 30% off for employees, taken off their
+// purchases until it expires or is revoked, at most MonthlyCap purchases a month.
+type Entitlement struct {
+	ddd.AggregateRoot
+	CustomerID uuid.UUID
+	Kind       Kind
+	// Partner is the company a partner discount was negotiated with; empty for employees.
+	Partner    string
+	PercentOff float64
+	// ExpiresAt is when the entitlement stops applying; zero if it does not expire.
+	ExpiresAt time.Time
+	// MonthlyCap is how many purchases a month it may discount; 0 for no cap.
+	MonthlyCap int
+	// GrantedBy is who granted it, as in the audit log.
+	GrantedBy string
+	GrantedAt time.Time
+
+	revokedAt time.Time
+	uses      map[string]int
+}
+
+// Grant is what an entitlement is granted with.
+type Grant struct {
+	CustomerID uuid.UUID
+	Kind       Kind
+	Partner    string
+	PercentOff float64
+	ExpiresAt  time.Time // 可选, 默认不过期
+	MonthlyCap int       // 可选, 默认不限次数
+}
+
+// New grants g at at, by grantedBy.
+func New(g Grant, grantedBy string, at time.Time) (*Entitlement, error) {
+	g.Partner = strings.TrimSpace(g.Partner)
+	var errs []error
+	switch {
+	case g.Kind != KindEmployee && g.Kind != KindPartner:
+		errs = append(errs, ErrUnknownKind)
+	case g.Kind == KindPartner && g.Partner == "":
+		errs = append(errs, ErrNoPartner)
+	}
+	if g.PercentOff <= 0 || g.PercentOff > 100 {
+		errs = append(errs, ErrInvalidPercent)
+	}
+	if g.MonthlyCap < 0 {
+		errs = append(errs, ErrInvalidCap)
+	}
+	if !g.ExpiresAt.IsZero() && !g.ExpiresAt.After(at) {
+		errs = append(errs, ErrInvalidExpiry)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &Entitlement{
+		AggregateRoot: ddd.AggregateRoot{ID: uuid.New()},
+		CustomerID:    g.CustomerID,
+		Kind:          g.Kind,
+		Partner:       g.Partner,
+		PercentOff:    g.PercentOff,
+		ExpiresAt:     g.ExpiresAt,
+		MonthlyCap:    g.MonthlyCap,
+		GrantedBy:     grantedBy,
+		GrantedAt:     at.UTC(),
+		uses:          map[string]int{},
+	}, nil
+}
+
+// Name is what the discount is listed as on a price breakdown, e.g. "employee 30%" or "Acme 10%".
+func (e *Entitlement) Name() string {
+	who := string(e.Kind)
+	if e.Kind == KindPartner {
+		who = e.Partner
+	}
+	return fmt.Sprintf("%s %g%%", who, e.PercentOff)
+}
+
+// Usable tells why the entitlement cannot discount a purchase made at at, if it cannot.
+func (e *Entitlement) Usable(at time.Time) error {
+	switch {
+	case !e.revokedAt.IsZero():
+		return ErrRevoked
+	case !e.ExpiresAt.IsZero() && !at.Before(e.ExpiresAt):
+		return ErrExpired
+	case e.MonthlyCap > 0 && e.UsesIn(at) >= e.MonthlyCap:
+		return ErrCapReached
+	}
+	return nil
+}
+
+// UsesIn is how many purchases the entitlement discounted in the month of at.
+func (e *Entitlement) UsesIn(at time.Time) int {
+	return e.uses[at.UTC().Format(monthLayout)]
+}
+
+// Use counts a purchase made at at against the month's cap.
+func (e *Entitlement) Use(at time.Time) error {
+	if err := e.Usable(at); err != nil {
+		return err
+	}
+	if e.uses == nil {
+		e.uses = map[string]int{}
+	}
+	e.uses[at.UTC().Format(monthLayout)]++
+	return nil
+}
+
+// Revoke stops the entitlement from applying from at on. Revoking it again changes nothing.
+func (e *Entitlement) Revoke(at time.Time) {
+	if e.revokedAt.IsZero() {
+		e.revokedAt = at.UTC()
+	}
+}
+
+// RevokedAt is when the entitlement was revoked; zero if it was not.
+func (e *Entitlement) RevokedAt() time.Time {
+	return e.revokedAt
+}
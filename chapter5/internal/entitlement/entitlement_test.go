@@ -0,0 +1,103 @@
+package entitlement_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/testsupport"
+)
+
+func Test_GrantsAreAuditedWithWhoGrantedThem(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "hr@coffeeco")
+	auditLog := audit.NewMemoryRepo()
+	svc := entitlement.NewService(entitlement.NewMemoryRepo(), entitlement.WithAuditLog(auditLog))
+
+	_, err := svc.Grant(ctx, entitlement.Grant{CustomerID: uuid.New(), Kind: entitlement.KindPartner, PercentOff: 120, MonthlyCap: -1})
+	for _, want := range []error{entitlement.ErrNoPartner, entitlement.ErrInvalidPercent, entitlement.ErrInvalidCap} {
+		if !errors.Is(err, want) {
+			t.Fatalf("expected %v among the errors but got %v", want, err)
+		}
+	}
+
+	e, err := svc.Grant(ctx, entitlement.Grant{CustomerID: uuid.New(), Kind: entitlement.KindPartner, Partner: "Acme", PercentOff: 10})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if e.GrantedBy != "hr@coffeeco" || e.Name() != "Acme 10%" {
+		t.Fatalf("expected Acme 10%% granted by hr@coffeeco but got %+v", e)
+	}
+	if _, err := svc.Revoke(ctx, e.ID); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	entries, _ := auditLog.Query(ctx, audit.Query{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	if len(entries) != 2 || entries[1].Action != audit.ActionEntitlementGrant || entries[0].Action != audit.ActionEntitlementRevoke || entries[1].Actor != "hr@coffeeco" {
+		t.Fatalf("expected the grant and the revocation by hr@coffeeco but got %+v", entries)
+	}
+	if _, err := svc.Best(ctx, e.CustomerID, time.Now()); !errors.Is(err, entitlement.ErrNotEntitled) {
+		t.Fatalf("expected a revoked entitlement not to apply but got %v", err)
+	}
+}
+
+func Test_PurchasesAreDiscountedUpToTheMonthlyCapUntilExpiry(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		customer = uuid.New()
+		now      = time.Date(2024, 3, 30, 12, 0, 0, 0, time.UTC)
+		clock    = func() time.Time { return now }
+	)
+	svc := entitlement.NewService(entitlement.NewMemoryRepo(), entitlement.WithClock(clock))
+	if _, err := svc.Grant(ctx, entitlement.Grant{CustomerID: customer, Kind: entitlement.KindPartner, Partner: "Acme", PercentOff: 10}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	employee, err := svc.Grant(ctx, entitlement.Grant{
+		CustomerID: customer, Kind: entitlement.KindEmployee, PercentOff: 30, MonthlyCap: 2, ExpiresAt: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	engine := pricing.NewEngine(pricing.Rules{}, pricing.WithEntitlements(svc), pricing.WithClock(clock))
+	purchases := purchase.NewService(nil, testsupport.NewFakePurchases(), nil,
+		purchase.WithPricing(engine), purchase.WithEntitlements(svc), purchase.WithClock(clock))
+	buy := func() int64 {
+		t.Helper()
+		p := &purchase.Purchase{
+			CustomerID:         customer,
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}},
+			PaymentMeans:       payment.MEANS_CASH,
+		}
+		if err := purchases.CompletePurchase(ctx, uuid.New(), p, nil); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		total := p.Total()
+		return total.Amount()
+	}
+
+	// Twice 30% off, then the partner's 10% once the employee discount is used up for March.
+	for i, want := range []int64{280, 280, 360} {
+		if got := buy(); got != want {
+			t.Fatalf("purchase %d: expected %d but got %d", i+1, want, got)
+		}
+	}
+	now = time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC)
+	if got := buy(); got != 280 {
+		t.Fatalf("expected 30%% off again in April but got %d", got)
+	}
+	now = time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if got := buy(); got != 360 {
+		t.Fatalf("expected the employee discount to have expired but got %d", got)
+	}
+	if err := employee.Usable(now); !errors.Is(err, entitlement.ErrExpired) {
+		t.Fatalf("expected ErrExpired but got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package entitlement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such entitlement.
+	Get(ctx context.Context, id uuid.UUID) (*Entitlement, error)
+	// ForCustomer returns every entitlement granted to a customer, revoked and expired ones too, oldest
+	// first.
+	ForCustomer(ctx context.Context, customerID uuid.UUID) ([]*Entitlement, error)
+	// Save returns ErrConcurrencyConflict if the entitlement was saved by someone else since it was read.
+	Save(ctx context.Context, e *Entitlement) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps entitlements versioned, as a customer may buy at two tills at once.
+type MongoRepository struct {
+	client       *mongo.Client
+	entitlements *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	entitlements := client.Database("coffeeco").Collection("entitlements")
+	_, err = entitlements.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "granted_at", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entitlement indexes: %w", err)
+	}
+	return &MongoRepository{client: client, entitlements: entitlements}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoEntitlement struct {
+	ID         string         `bson:"_id"`
+	Version    int            `bson:"version"`
+	CustomerID string         `bson:"customer_id"`
+	Kind       string         `bson:"kind"`
+	Partner    string         `bson:"partner,omitempty"`
+	PercentOff float64        `bson:"percent_off"`
+	ExpiresAt  time.Time      `bson:"expires_at,omitempty"`
+	MonthlyCap int            `bson:"monthly_cap,omitempty"`
+	GrantedBy  string         `bson:"granted_by"`
+	GrantedAt  time.Time      `bson:"granted_at"`
+	RevokedAt  time.Time      `bson:"revoked_at,omitempty"`
+	Uses       map[string]int `bson:"uses,omitempty"`
+}
+
+func toMongoEntitlement(e *Entitlement) mongoEntitlement {
+	return mongoEntitlement{
+		ID:         e.ID.String(),
+		Version:    e.Version(),
+		CustomerID: e.CustomerID.String(),
+		Kind:       string(e.Kind),
+		Partner:    e.Partner,
+		PercentOff: e.PercentOff,
+		ExpiresAt:  e.ExpiresAt,
+		MonthlyCap: e.MonthlyCap,
+		GrantedBy:  e.GrantedBy,
+		GrantedAt:  e.GrantedAt,
+		RevokedAt:  e.revokedAt,
+		Uses:       maps.Clone(e.uses),
+	}
+}
+
+func (m mongoEntitlement) toEntitlement() *Entitlement {
+	id, _ := uuid.Parse(m.ID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	e := &Entitlement{
+		CustomerID: customerID,
+		Kind:       Kind(m.Kind),
+		Partner:    m.Partner,
+		PercentOff: m.PercentOff,
+		ExpiresAt:  m.ExpiresAt,
+		MonthlyCap: m.MonthlyCap,
+		GrantedBy:  m.GrantedBy,
+		GrantedAt:  m.GrantedAt,
+		revokedAt:  m.RevokedAt,
+		uses:       maps.Clone(m.Uses),
+	}
+	e.ID = id
+	e.SetVersion(m.Version)
+	return e
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Entitlement, err error) {
+	ctx, span := telemetry.StartClient(ctx, "entitlement.MongoRepository.Get", attribute.String("entitlement.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoEntitlement
+	if err := m.entitlements.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find entitlement: %w", err)
+	}
+	return doc.toEntitlement(), nil
+}
+
+func (m *MongoRepository) ForCustomer(ctx context.Context, customerID uuid.UUID) (_ []*Entitlement, err error) {
+	ctx, span := telemetry.StartClient(ctx, "entitlement.MongoRepository.ForCustomer", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.entitlements.Find(ctx, bson.D{{Key: "customer_id", Value: customerID.String()}}, options.Find().SetSort(bson.D{{Key: "granted_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find entitlements: %w", err)
+	}
+	var docs []mongoEntitlement
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode entitlements: %w", err)
+	}
+	res := make([]*Entitlement, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.toEntitlement())
+	}
+	return res, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, e *Entitlement) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "entitlement.MongoRepository.Save", attribute.String("entitlement.id", e.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoEntitlement(e)
+	doc.Version = e.Version() + 1
+	if e.Version() == 0 {
+		if _, err := m.entitlements.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save entitlement: %w", err)
+		}
+	} else {
+		res, err := m.entitlements.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: e.Version()}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save entitlement: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	e.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.entitlements.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps entitlements in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu           sync.Mutex
+	entitlements map[uuid.UUID]mongoEntitlement
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{entitlements: map[uuid.UUID]mongoEntitlement{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Entitlement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.entitlements[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toEntitlement(), nil
+}
+
+func (m *MemoryRepository) ForCustomer(_ context.Context, customerID uuid.UUID) ([]*Entitlement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*Entitlement
+	for _, doc := range m.entitlements {
+		if doc.CustomerID == customerID.String() {
+			res = append(res, doc.toEntitlement())
+		}
+	}
+	slices.SortFunc(res, func(a, b *Entitlement) int { return a.GrantedAt.Compare(b.GrantedAt) })
+	return res, nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, e *Entitlement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.entitlements[e.ID].Version != e.Version() {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoEntitlement(e)
+	doc.Version = e.Version() + 1
+	m.entitlements[e.ID] = doc
+	e.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
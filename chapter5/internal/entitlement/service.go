@@ -0,0 +1,134 @@
+package entitlement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+)
+
+// saveAttempts bounds how often a use is retried when other purchases keep saving the entitlement first.
+const saveAttempts = 3
+
+type Service struct {
+	repo  Repository
+	audit audit.Recorder // 可选, 记录授予和撤销
+	now   func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithAuditLog records every entitlement granted or revoked in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test expiry.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Grant gives a customer a negotiated discount. Whoever acts in ctx, see audit.Actor, is recorded as having
+// granted it.
+func (s *Service) Grant(ctx context.Context, g Grant) (*Entitlement, error) {
+	e, err := New(g, audit.Actor(ctx), s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, e); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, audit.ActionEntitlementGrant, e, "", e.Name()); err != nil {
+		return nil, fmt.Errorf("entitlement granted but failed to record it in the audit log: %w", err)
+	}
+	return e, nil
+}
+
+// Revoke stops an entitlement from applying to any further purchase.
+func (s *Service) Revoke(ctx context.Context, id uuid.UUID) (*Entitlement, error) {
+	e, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !e.RevokedAt().IsZero() {
+		return e, nil
+	}
+	e.Revoke(s.now())
+	if err := s.repo.Save(ctx, e); err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, audit.ActionEntitlementRevoke, e, e.Name(), ""); err != nil {
+		return nil, fmt.Errorf("entitlement revoked but failed to record it in the audit log: %w", err)
+	}
+	return e, nil
+}
+
+func (s *Service) record(ctx context.Context, action audit.Action, e *Entitlement, before, after string) error {
+	if s.audit == nil {
+		return nil
+	}
+	entry := audit.NewEntry(ctx, action, "entitlement", e.ID.String(), before, after)
+	entry.Note = "customer " + e.CustomerID.String()
+	return s.audit.Record(ctx, entry)
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Entitlement, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *Service) ForCustomer(ctx context.Context, customerID uuid.UUID) ([]*Entitlement, error) {
+	return s.repo.ForCustomer(ctx, customerID)
+}
+
+// Best is the entitlement that takes the most off a purchase the customer makes at at, or ErrNotEntitled
+// if none of theirs can be used then.
+func (s *Service) Best(ctx context.Context, customerID uuid.UUID, at time.Time) (*Entitlement, error) {
+	all, err := s.repo.ForCustomer(ctx, customerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entitlements: %w", err)
+	}
+	var best *Entitlement
+	for _, e := range all {
+		if e.Usable(at) == nil && (best == nil || e.PercentOff > best.PercentOff) {
+			best = e
+		}
+	}
+	if best == nil {
+		return nil, ErrNotEntitled
+	}
+	return best, nil
+}
+
+// Use counts a purchase made at at against the entitlement's monthly cap.
+func (s *Service) Use(ctx context.Context, id uuid.UUID, at time.Time) error {
+	for range saveAttempts {
+		e, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := e.Use(at); err != nil {
+			return err
+		}
+		err = s.repo.Save(ctx, e)
+		if !errors.Is(err, ErrConcurrencyConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to use entitlement after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,19 @@
+package events
+
+import "encoding/json"
+
+// Codec turns an Event into bytes for the wire.
+type Codec interface {
+	Encode(e Event) ([]byte, error)
+	ContentType() string
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(e Event) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (JSONCodec) ContentType() string {
+	return "application/json"
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event is something that happened inside a bounded context that other contexts may want to react to.
+type Event interface {
+	// EventType is namespaced by the owning context, e.g. "purchase.completed".
+	EventType() string
+	AggregateID() uuid.UUID
+}
+
+// Versioned is implemented by events whose payload shape has changed since it was first published.
+// Events that do not implement it are version 1.
+type Versioned interface {
+	EventVersion() int
+}
+
+// Identified is implemented by events that can derive a stable ID, so the same fact always produces the
+// same message ID, whether it is published live or replayed from storage. Other events get a random ID.
+type Identified interface {
+	EventID() uuid.UUID
+}
+
+// Header names used by transports to carry Message metadata alongside the payload.
+const (
+	HeaderEventID     = "event-id"
+	HeaderEventType   = "event-type"
+	HeaderAggregateID = "aggregate-id"
+	HeaderOccurredAt  = "occurred-at"
+	HeaderContentType = "content-type"
+	HeaderVersion     = "event-version"
+	HeaderCorrelation = "correlation-id"
+	HeaderCausation   = "causation-id"
+)
+
+// Message is the envelope an Event travels in. Adapters (kafka, nats, ...) only ever see messages,
+// so the domain never leaks into the broker and the broker never leaks into the domain.
+type Message struct {
+	ID          uuid.UUID
+	Type        string
+	Version     int
+	AggregateID string
+	OccurredAt  time.Time
+	ContentType string
+	// CorrelationID ties together everything caused by one originating request; CausationID is the ID of
+	// the command or message that directly caused this one.
+	CorrelationID string
+	CausationID   string
+	Payload       []byte
+	Headers       map[string]string
+}
+
+// NewMessage serializes e with the given codec.
+func NewMessage(e Event, codec Codec) (Message, error) {
+	payload, err := codec.Encode(e)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode %s: %w", e.EventType(), err)
+	}
+	version := 1
+	if v, ok := e.(Versioned); ok {
+		version = v.EventVersion()
+	}
+	id := uuid.New()
+	if i, ok := e.(Identified); ok {
+		id = i.EventID()
+	}
+	return Message{
+		ID:          id,
+		Type:        e.EventType(),
+		Version:     version,
+		AggregateID: e.AggregateID().String(),
+		OccurredAt:  time.Now().UTC(),
+		ContentType: codec.ContentType(),
+		Payload:     payload,
+		Headers:     map[string]string{},
+	}, nil
+}
+
+// TransportHeaders flattens the envelope metadata and custom headers into a single header map.
+func (m Message) TransportHeaders() map[string]string {
+	h := make(map[string]string, len(m.Headers)+9)
+	for k, v := range m.Headers {
+		h[k] = v
+	}
+	h[HeaderEventID] = m.ID.String()
+	h[HeaderEventType] = m.Type
+	h[HeaderVersion] = strconv.Itoa(m.Version)
+	h[HeaderAggregateID] = m.AggregateID
+	h[HeaderOccurredAt] = m.OccurredAt.Format(time.RFC3339Nano)
+	h[HeaderContentType] = m.ContentType
+	if m.CorrelationID != "" {
+		h[HeaderCorrelation] = m.CorrelationID
+	}
+	if m.CausationID != "" {
+		h[HeaderCausation] = m.CausationID
+	}
+	return h
+}
+
+// MessageFromTransport is the inverse of TransportHeaders. Headers that are not envelope metadata are
+// kept in Headers.
+func MessageFromTransport(headers map[string]string, payload []byte) Message {
+	m := Message{Version: 1, Payload: payload, Headers: map[string]string{}}
+	for k, v := range headers {
+		switch k {
+		case HeaderEventID:
+			m.ID, _ = uuid.Parse(v)
+		case HeaderEventType:
+			m.Type = v
+		case HeaderVersion:
+			if n, err := strconv.Atoi(v); err == nil {
+				m.Version = n
+			}
+		case HeaderAggregateID:
+			m.AggregateID = v
+		case HeaderOccurredAt:
+			m.OccurredAt, _ = time.Parse(time.RFC3339Nano, v)
+		case HeaderContentType:
+			m.ContentType = v
+		case HeaderCorrelation:
+			m.CorrelationID = v
+		case HeaderCausation:
+			m.CausationID = v
+		default:
+			m.Headers[k] = v
+		}
+	}
+	return m
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, evts ...Event) error
+}
+
+// Handler processes a single message. Returning an error tells the transport the message was not handled.
+type Handler func(ctx context.Context, msg Message) error
+
+// Subscriber blocks, delivering messages from topic to h until ctx is cancelled.
+type Subscriber interface {
+	Subscribe(ctx context.Context, topic string, h Handler) error
+}
+
+// TopicFor returns the per-context topic an event type is published to.
+// "purchase.completed" goes to "coffeeco.purchase".
+func TopicFor(eventType string) string {
+	boundedContext, _, _ := strings.Cut(eventType, ".")
+	return "coffeeco." + boundedContext
+}
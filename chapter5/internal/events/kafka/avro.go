@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+
+	"coffeeco/internal/events"
+)
+
+// AvroCodec encodes events with the Avro schema registered for their type. Event structs map onto schema
+// fields through `avro` struct tags.
+type AvroCodec struct {
+	schemas map[string]avro.Schema
+}
+
+// NewAvroCodec parses one schema per event type, e.g. {"purchase.completed": `{"type":"record",...}`}.
+func NewAvroCodec(schemas map[string]string) (*AvroCodec, error) {
+	parsed := make(map[string]avro.Schema, len(schemas))
+	for eventType, s := range schemas {
+		schema, err := avro.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid avro schema for %s: %w", eventType, err)
+		}
+		parsed[eventType] = schema
+	}
+	return &AvroCodec{schemas: parsed}, nil
+}
+
+func (a *AvroCodec) Encode(e events.Event) ([]byte, error) {
+	schema, ok := a.schemas[e.EventType()]
+	if !ok {
+		return nil, fmt.Errorf("no avro schema registered for %s", e.EventType())
+	}
+	return avro.Marshal(schema, e)
+}
+
+func (a *AvroCodec) ContentType() string {
+	return "avro/binary"
+}
@@ -0,0 +1,141 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/telemetry"
+)
+
+const (
+	defaultMaxAttempts = 3
+
+	headerDLTError     = "dlt-error"
+	headerDLTTopic     = "dlt-original-topic"
+	headerDLTPartition = "dlt-original-partition"
+	headerDLTOffset    = "dlt-original-offset"
+)
+
+// DeadLetterTopic is where messages that could not be handled after all attempts are parked.
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlt"
+}
+
+// reader is what a subscription needs of a *kafka.Reader.
+type reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// writer is what dead-lettering needs of a *kafka.Writer.
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Subscriber consumes topics as part of a consumer group. Offsets are committed manually, only once a message
+// has either been handled or safely parked on the dead-letter topic, so a crash never loses a message.
+type Subscriber struct {
+	maxAttempts int
+	backoff     time.Duration
+	newReader   func(topic string) reader
+	dlt         writer
+}
+
+func NewSubscriber(brokers []string, groupID string) (*Subscriber, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+	if groupID == "" {
+		return nil, errors.New("group ID cannot be empty")
+	}
+	return &Subscriber{
+		maxAttempts: defaultMaxAttempts,
+		backoff:     100 * time.Millisecond,
+		newReader: func(topic string) reader {
+			return kafka.NewReader(kafka.ReaderConfig{Brokers: brokers, GroupID: groupID, Topic: topic})
+		},
+		dlt: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+	}, nil
+}
+
+func (s *Subscriber) Subscribe(ctx context.Context, topic string, h events.Handler) error {
+	h = telemetry.Handler(correlation.Handler(h))
+	reader := s.newReader(topic)
+	defer reader.Close()
+
+	for {
+		km, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch message from %s: %w", topic, err)
+		}
+
+		if err := s.handle(ctx, h, km); err != nil {
+			if ctx.Err() != nil {
+				// Shutting down: the message is left uncommitted for whoever gets the partition next.
+				return nil
+			}
+			if err := s.deadLetter(ctx, km, err); err != nil {
+				return err
+			}
+		}
+
+		if err := reader.CommitMessages(ctx, km); err != nil {
+			return fmt.Errorf("failed to commit offset %d on %s: %w", km.Offset, topic, err)
+		}
+	}
+}
+
+func (s *Subscriber) Close() error {
+	return s.dlt.Close()
+}
+
+func (s *Subscriber) handle(ctx context.Context, h events.Handler, km kafka.Message) error {
+	var err error
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		if err = h(ctx, fromKafkaMessage(km)); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * s.backoff):
+		}
+	}
+	return err
+}
+
+func (s *Subscriber) deadLetter(ctx context.Context, km kafka.Message, cause error) error {
+	headers := append(slices.Clone(km.Headers),
+		kafka.Header{Key: headerDLTError, Value: []byte(cause.Error())},
+		kafka.Header{Key: headerDLTTopic, Value: []byte(km.Topic)},
+		kafka.Header{Key: headerDLTPartition, Value: []byte(strconv.Itoa(km.Partition))},
+		kafka.Header{Key: headerDLTOffset, Value: []byte(strconv.FormatInt(km.Offset, 10))},
+	)
+	err := s.dlt.WriteMessages(ctx, kafka.Message{
+		Topic:   DeadLetterTopic(km.Topic),
+		Key:     km.Key,
+		Value:   km.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter message at offset %d: %w", km.Offset, err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// partition hands out its messages in order and, once they are all fetched, shuts the subscription down.
+type partition struct {
+	messages  []kafka.Message
+	committed []int64
+	stop      context.CancelFunc
+}
+
+func (p *partition) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(p.messages) == 0 {
+		p.stop()
+		return kafka.Message{}, ctx.Err()
+	}
+	km := p.messages[0]
+	p.messages = p.messages[1:]
+	return km, nil
+}
+
+func (p *partition) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	for _, km := range msgs {
+		p.committed = append(p.committed, km.Offset)
+	}
+	return nil
+}
+
+func (p *partition) Close() error { return nil }
+
+// deadLetters records the messages written, failing writes while down.
+type deadLetters struct {
+	written []kafka.Message
+	down    bool
+}
+
+func (d *deadLetters) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if d.down {
+		return errors.New("kafka is down")
+	}
+	d.written = append(d.written, msgs...)
+	return nil
+}
+
+func (d *deadLetters) Close() error { return nil }
+
+// newTestSubscriber subscribes to p, without waiting between attempts.
+func newTestSubscriber(p *partition, dlt *deadLetters) *Subscriber {
+	return &Subscriber{
+		maxAttempts: defaultMaxAttempts,
+		newReader:   func(string) reader { return p },
+		dlt:         dlt,
+	}
+}
+
+// completed is a purchase.completed message fetched from offset on coffeeco.purchase.
+func completed(t *testing.T, offset int64) kafka.Message {
+	t.Helper()
+	m, err := events.NewMessage(purchase.Completed{PurchaseID: uuid.New(), Total: 450, Currency: "USD"}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	km := toKafkaMessage("coffeeco.purchase", m)
+	km.Partition, km.Offset = 2, offset
+	return km
+}
+
+func header(km kafka.Message, key string) string {
+	for _, h := range km.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func Test_FailedMessagesAreRetriedThenDeadLetteredAndCommitted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failing, handled := completed(t, 7), completed(t, 8)
+	p := &partition{messages: []kafka.Message{failing, handled}, stop: cancel}
+	dlt := &deadLetters{}
+
+	failingID := fromKafkaMessage(failing).ID
+	attempts := map[uuid.UUID]int{}
+	err := newTestSubscriber(p, dlt).Subscribe(ctx, "coffeeco.purchase", func(_ context.Context, m events.Message) error {
+		attempts[m.ID]++
+		if m.ID == failingID {
+			return errors.New("projection is down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if attempts[failingID] != defaultMaxAttempts || attempts[fromKafkaMessage(handled).ID] != 1 {
+		t.Fatalf("expected the failing message to be tried %d times and the other once but got %v", defaultMaxAttempts, attempts)
+	}
+	if len(dlt.written) != 1 {
+		t.Fatalf("expected the failing message to be dead-lettered once but got %d", len(dlt.written))
+	}
+	parked := dlt.written[0]
+	if parked.Topic != "coffeeco.purchase.dlt" || string(parked.Key) != string(failing.Key) || string(parked.Value) != string(failing.Value) {
+		t.Fatalf("expected the message parked as it was on coffeeco.purchase.dlt but got %s %s", parked.Topic, parked.Value)
+	}
+	if header(parked, headerDLTError) != "projection is down" || header(parked, headerDLTTopic) != "coffeeco.purchase" ||
+		header(parked, headerDLTPartition) != "2" || header(parked, headerDLTOffset) != "7" {
+		t.Fatalf("expected the parked message to say where it came from and why but got %v", parked.Headers)
+	}
+	if got := fromKafkaMessage(parked); got.Type != purchase.EventTypeCompleted || got.ID != failingID {
+		t.Fatalf("expected the parked message to decode as the original event but got %+v", got)
+	}
+	if len(p.committed) != 2 || p.committed[0] != 7 || p.committed[1] != 8 {
+		t.Fatalf("expected both offsets to be committed in order but got %v", p.committed)
+	}
+}
+
+func Test_MessagesThatCannotBeDeadLetteredAreNotCommitted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &partition{messages: []kafka.Message{completed(t, 7)}, stop: cancel}
+	err := newTestSubscriber(p, &deadLetters{down: true}).Subscribe(ctx, "coffeeco.purchase", func(context.Context, events.Message) error {
+		return errors.New("projection is down")
+	})
+	if err == nil {
+		t.Fatal("expected the subscription to stop when the message cannot be dead-lettered")
+	}
+	if len(p.committed) != 0 {
+		t.Fatalf("expected no offset committed for a message that was neither handled nor parked but got %v", p.committed)
+	}
+}
+
+func Test_MessagesBeingRetriedAtShutdownAreLeftForTheNextConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &partition{messages: []kafka.Message{completed(t, 7)}, stop: cancel}
+	dlt := &deadLetters{}
+	err := newTestSubscriber(p, dlt).Subscribe(ctx, "coffeeco.purchase", func(context.Context, events.Message) error {
+		cancel()
+		return errors.New("projection is down")
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(dlt.written) != 0 || len(p.committed) != 0 {
+		t.Fatalf("expected the message neither dead-lettered nor committed but got %d dead letters and offsets %v", len(dlt.written), p.committed)
+	}
+}
@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/trace"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/telemetry"
+)
+
+// Publisher writes domain events to one topic per bounded context, keyed by aggregate ID so all events
+// for an aggregate land on the same partition and keep their order.
+type Publisher struct {
+	writer  *kafka.Writer
+	codec   events.Codec
+	brokers []string
+}
+
+func NewPublisher(brokers []string, codec events.Codec) (*Publisher, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("at least one broker is required")
+	}
+	if codec == nil {
+		return nil, errors.New("codec cannot be nil")
+	}
+	return &Publisher{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		codec:   codec,
+		brokers: brokers,
+	}, nil
+}
+
+// Ping succeeds if any of the brokers can be reached; the client fails over to it.
+func (p *Publisher) Ping(ctx context.Context) error {
+	var errs []error
+	for _, b := range p.brokers {
+		conn, err := (&kafka.Dialer{}).DialContext(ctx, "tcp", b)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no kafka broker reachable: %w", errors.Join(errs...))
+}
+
+func (p *Publisher) Publish(ctx context.Context, evts ...events.Event) (err error) {
+	msgs := make([]kafka.Message, 0, len(evts))
+	spans := make([]trace.Span, 0, len(evts))
+	defer func() {
+		for _, span := range spans {
+			telemetry.End(span, &err)
+		}
+	}()
+	for _, e := range evts {
+		m, err := events.NewMessage(e, p.codec)
+		if err != nil {
+			return err
+		}
+		correlation.Stamp(ctx, &m)
+		_, span := telemetry.StartPublish(ctx, &m)
+		spans = append(spans, span)
+		msgs = append(msgs, toKafkaMessage(events.TopicFor(m.Type), m))
+	}
+	if err := p.writer.WriteMessages(ctx, msgs...); err != nil {
+		return fmt.Errorf("failed to publish events: %w", err)
+	}
+	return nil
+}
+
+// Republish writes already-encoded messages back to their topic unchanged, e.g. when redriving dead letters.
+func (p *Publisher) Republish(ctx context.Context, msgs ...events.Message) error {
+	kms := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		kms = append(kms, toKafkaMessage(events.TopicFor(m.Type), m))
+	}
+	if err := p.writer.WriteMessages(ctx, kms...); err != nil {
+		return fmt.Errorf("failed to republish messages: %w", err)
+	}
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
+
+func toKafkaMessage(topic string, m events.Message) kafka.Message {
+	var headers []kafka.Header
+	for k, v := range m.TransportHeaders() {
+		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return kafka.Message{
+		Topic:   topic,
+		Key:     []byte(m.AggregateID),
+		Value:   m.Payload,
+		Headers: headers,
+	}
+}
+
+func fromKafkaMessage(km kafka.Message) events.Message {
+	headers := make(map[string]string, len(km.Headers))
+	for _, h := range km.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	m := events.MessageFromTransport(headers, km.Value)
+	if m.AggregateID == "" {
+		m.AggregateID = string(km.Key)
+	}
+	return m
+}
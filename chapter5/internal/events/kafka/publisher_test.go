@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hamba/avro/v2"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+func Test_MessageRoundTrip(t *testing.T) {
+	codec, err := NewAvroCodec(map[string]string{purchase.EventTypeCompleted: purchase.CompletedAvroSchema})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	e := purchase.Completed{
+		PurchaseID:   uuid.New(),
+		StoreID:      uuid.New(),
+		Lines:        []purchase.CompletedLine{{ItemName: "latte", Amount: 350}},
+		Total:        350,
+		Currency:     "USD",
+		PaymentMeans: "card",
+		PurchasedAt:  time.Now().UTC().Truncate(time.Millisecond),
+		ReceiptCode:  "A7K",
+	}
+	m, err := events.NewMessage(e, codec)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	m.Headers["trace"] = "abc"
+
+	km := toKafkaMessage(events.TopicFor(m.Type), m)
+	if km.Topic != "coffeeco.purchase" {
+		t.Fatalf("expected topic coffeeco.purchase but got %s", km.Topic)
+	}
+	if string(km.Key) != e.PurchaseID.String() {
+		t.Fatalf("expected partition key %s but got %s", e.PurchaseID, km.Key)
+	}
+
+	got := fromKafkaMessage(km)
+	if got.ID != m.ID || got.Type != m.Type || got.ContentType != "avro/binary" || !got.OccurredAt.Equal(m.OccurredAt) {
+		t.Fatalf("expected %+v but got %+v", m, got)
+	}
+	if got.Headers["trace"] != "abc" {
+		t.Fatalf("expected custom header to survive but got %v", got.Headers)
+	}
+	var decoded purchase.Completed
+	if err := avro.Unmarshal(avro.MustParse(purchase.CompletedAvroSchema), got.Payload, &decoded); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if decoded.PurchaseID != e.PurchaseID || decoded.Total != 350 || decoded.ReceiptCode != "A7K" {
+		t.Fatalf("expected %+v but got %+v", e, decoded)
+	}
+}
@@ -0,0 +1,317 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/telemetry"
+)
+
+const (
+	maxDeliver = 5
+
+	headerDLTError    = "dlt-error"
+	headerDLTSubject  = "dlt-original-subject"
+	headerDLTSequence = "dlt-original-sequence"
+)
+
+// DeadLetterTopic is where messages of topic that could not be handled in maxDeliver deliveries are parked.
+// It is outside topic, so subscribers to topic do not get them.
+func DeadLetterTopic(topic string) string {
+	return "dlt." + topic
+}
+
+// streamName maps a topic ("coffeeco.purchase") onto the JetStream stream backing it ("COFFEECO_PURCHASE").
+func streamName(topic string) string {
+	return strings.ToUpper(strings.ReplaceAll(topic, ".", "_"))
+}
+
+// subject for an event type is its topic plus the event name, so "purchase.completed" is published
+// on "coffeeco.purchase.completed" and a subscriber to a topic receives every event of that context.
+func subject(eventType string) string {
+	_, name, _ := strings.Cut(eventType, ".")
+	return events.TopicFor(eventType) + "." + name
+}
+
+// JetStream is a lighter alternative to the kafka adapter for small deployments. It implements both
+// events.Publisher and events.Subscriber.
+type JetStream struct {
+	conn    *nats.Conn
+	js      jetstream.JetStream
+	codec   events.Codec
+	durable string
+
+	mu      sync.Mutex
+	streams map[string]bool
+}
+
+// NewJetStream connects to url. Subscriptions are durable under the given name, so a restarted
+// instance carries on from its last acknowledged message.
+func NewJetStream(url string, durable string, codec events.Codec) (*JetStream, error) {
+	if durable == "" {
+		return nil, errors.New("durable name cannot be empty")
+	}
+	if codec == nil {
+		return nil, errors.New("codec cannot be nil")
+	}
+	nc, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %w", err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	return &JetStream{conn: nc, js: js, codec: codec, durable: durable, streams: map[string]bool{}}, nil
+}
+
+func (j *JetStream) Publish(ctx context.Context, evts ...events.Event) error {
+	for _, e := range evts {
+		m, err := events.NewMessage(e, j.codec)
+		if err != nil {
+			return err
+		}
+		if err := j.publish(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *JetStream) publish(ctx context.Context, m events.Message) (err error) {
+	correlation.Stamp(ctx, &m)
+	ctx, span := telemetry.StartPublish(ctx, &m)
+	defer telemetry.End(span, &err)
+	if err := j.ensureStream(ctx, events.TopicFor(m.Type)); err != nil {
+		return err
+	}
+	// The event ID doubles as the JetStream message ID, so a retried publish is de-duplicated by the server.
+	if _, err := j.js.PublishMsg(ctx, toNatsMsg(m), jetstream.WithMsgID(m.ID.String())); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", m.Type, err)
+	}
+	return nil
+}
+
+// Republish writes already-encoded messages back to their subject unchanged, e.g. when redriving dead letters.
+// No message ID is set, so the server does not discard them as duplicates of the original publish.
+func (j *JetStream) Republish(ctx context.Context, msgs ...events.Message) error {
+	for _, m := range msgs {
+		if err := j.ensureStream(ctx, events.TopicFor(m.Type)); err != nil {
+			return err
+		}
+		if _, err := j.js.PublishMsg(ctx, toNatsMsg(m)); err != nil {
+			return fmt.Errorf("failed to republish %s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+func (j *JetStream) Subscribe(ctx context.Context, topic string, h events.Handler) error {
+	if err := j.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+	cons, err := j.js.CreateOrUpdateConsumer(ctx, streamName(topic), jetstream.ConsumerConfig{
+		Durable:       j.durable,
+		FilterSubject: topic + ".>",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		// The server does not give up on a message: handle parks it after maxDeliver deliveries, and has it
+		// delivered again if it cannot be parked.
+		MaxDeliver: -1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create durable consumer %s: %w", j.durable, err)
+	}
+	return j.consume(ctx, cons, topic, h)
+}
+
+// SubscribeFrom replays topic starting at the given stream sequence, e.g. to rebuild state after a bug fix.
+// It uses an ephemeral ordered consumer and leaves the durable consumer's position untouched.
+func (j *JetStream) SubscribeFrom(ctx context.Context, topic string, seq uint64, h events.Handler) error {
+	if err := j.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+	cons, err := j.js.OrderedConsumer(ctx, streamName(topic), jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{topic + ".>"},
+		DeliverPolicy:  jetstream.DeliverByStartSequencePolicy,
+		OptStartSeq:    seq,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create replay consumer: %w", err)
+	}
+	return j.consume(ctx, cons, topic, h)
+}
+
+// Replay feeds h every message of topic, oldest first, and returns once it reached the last one stored when
+// it began, e.g. to rebuild state from a bounded context's events. Unlike SubscribeFrom, the messages are
+// handled one at a time and the first error stops the replay.
+func (j *JetStream) Replay(ctx context.Context, topic string, h events.Handler) error {
+	if err := j.ensureStream(ctx, topic); err != nil {
+		return err
+	}
+	stream, err := j.js.Stream(ctx, streamName(topic))
+	if err != nil {
+		return fmt.Errorf("failed to find stream of %s: %w", topic, err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read stream of %s: %w", topic, err)
+	}
+	last := info.State.LastSeq
+	if info.State.Msgs == 0 {
+		return nil
+	}
+	cons, err := stream.OrderedConsumer(ctx, jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{topic + ".>"},
+		DeliverPolicy:  jetstream.DeliverAllPolicy,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create replay consumer: %w", err)
+	}
+	it, err := cons.Messages()
+	if err != nil {
+		return fmt.Errorf("failed to start replaying: %w", err)
+	}
+	defer it.Stop()
+	stop := context.AfterFunc(ctx, it.Stop)
+	defer stop()
+
+	h = correlation.Handler(h)
+	for {
+		msg, err := it.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to replay %s: %w", topic, err)
+		}
+		if err := h(ctx, fromNatsMsg(msg)); err != nil {
+			return err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return fmt.Errorf("failed to replay %s: %w", topic, err)
+		}
+		if meta.Sequence.Stream >= last {
+			return nil
+		}
+	}
+}
+
+// Ping checks the connection is up and JetStream is enabled for the account.
+func (j *JetStream) Ping(ctx context.Context) error {
+	if !j.conn.IsConnected() {
+		return fmt.Errorf("nats connection is %s", j.conn.Status())
+	}
+	if _, err := j.js.AccountInfo(ctx); err != nil {
+		return fmt.Errorf("jetstream unavailable: %w", err)
+	}
+	return nil
+}
+
+func (j *JetStream) Close() error {
+	j.conn.Close()
+	return nil
+}
+
+func (j *JetStream) ensureStream(ctx context.Context, topic string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.streams[topic] {
+		return nil
+	}
+	_, err := j.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     streamName(topic),
+		Subjects: []string{topic + ".>"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream for %s: %w", topic, err)
+	}
+	j.streams[topic] = true
+	return nil
+}
+
+func (j *JetStream) consume(ctx context.Context, cons jetstream.Consumer, topic string, h events.Handler) error {
+	h = telemetry.Handler(correlation.Handler(h))
+	cc, err := cons.Consume(func(msg jetstream.Msg) {
+		j.handle(ctx, h, topic, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start consuming: %w", err)
+	}
+	<-ctx.Done()
+	cc.Stop()
+	return nil
+}
+
+// handle acknowledges msg once h handled it. A message h fails is delivered again a second later, until it
+// was delivered maxDeliver times: then it is parked on the dead-letter topic, so one poison message is neither
+// retried forever nor dropped.
+func (j *JetStream) handle(ctx context.Context, h events.Handler, topic string, msg jetstream.Msg) {
+	err := h(ctx, fromNatsMsg(msg))
+	if err == nil {
+		_ = msg.Ack()
+		return
+	}
+	meta, metaErr := msg.Metadata()
+	if metaErr != nil || meta.NumDelivered < maxDeliver || ctx.Err() != nil {
+		_ = msg.NakWithDelay(time.Second)
+		return
+	}
+	if err := j.deadLetter(ctx, topic, msg, meta, err); err != nil {
+		_ = msg.NakWithDelay(time.Second)
+		return
+	}
+	_ = msg.Term()
+}
+
+func (j *JetStream) deadLetter(ctx context.Context, topic string, msg jetstream.Msg, meta *jetstream.MsgMetadata, cause error) error {
+	if err := j.ensureStream(ctx, DeadLetterTopic(topic)); err != nil {
+		return err
+	}
+	parked := nats.NewMsg(DeadLetterTopic(topic) + strings.TrimPrefix(msg.Subject(), topic))
+	parked.Data = msg.Data()
+	for k, v := range msg.Headers() {
+		// The original message ID would have the server discard a message parked twice as a duplicate.
+		if k != jetstream.MsgIDHeader {
+			parked.Header[k] = slices.Clone(v)
+		}
+	}
+	parked.Header.Set(headerDLTError, cause.Error())
+	parked.Header.Set(headerDLTSubject, msg.Subject())
+	parked.Header.Set(headerDLTSequence, strconv.FormatUint(meta.Sequence.Stream, 10))
+	if _, err := j.js.PublishMsg(ctx, parked); err != nil {
+		return fmt.Errorf("failed to dead-letter message %d of %s: %w", meta.Sequence.Stream, topic, err)
+	}
+	return nil
+}
+
+func toNatsMsg(m events.Message) *nats.Msg {
+	msg := nats.NewMsg(subject(m.Type))
+	msg.Data = m.Payload
+	for k, v := range m.TransportHeaders() {
+		msg.Header.Set(k, v)
+	}
+	return msg
+}
+
+func fromNatsMsg(msg jetstream.Msg) events.Message {
+	headers := map[string]string{}
+	for k := range msg.Headers() {
+		if k != jetstream.MsgIDHeader {
+			headers[k] = msg.Headers().Get(k)
+		}
+	}
+	return events.MessageFromTransport(headers, msg.Data())
+}
@@ -0,0 +1,136 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// server records the streams created and the messages published, failing publishes while down.
+type server struct {
+	jetstream.JetStream
+	streams   []jetstream.StreamConfig
+	published []*nats.Msg
+	down      bool
+}
+
+func (s *server) CreateOrUpdateStream(_ context.Context, cfg jetstream.StreamConfig) (jetstream.Stream, error) {
+	s.streams = append(s.streams, cfg)
+	return nil, nil
+}
+
+func (s *server) PublishMsg(_ context.Context, msg *nats.Msg, _ ...jetstream.PublishOpt) (*jetstream.PubAck, error) {
+	if s.down {
+		return nil, errors.New("nats is down")
+	}
+	s.published = append(s.published, msg)
+	return &jetstream.PubAck{}, nil
+}
+
+// delivery is a message delivered for the delivered-th time, remembering how it was answered.
+type delivery struct {
+	jetstream.Msg
+	msg       *nats.Msg
+	delivered uint64
+	answer    string
+}
+
+func (d *delivery) Subject() string      { return d.msg.Subject }
+func (d *delivery) Data() []byte         { return d.msg.Data }
+func (d *delivery) Headers() nats.Header { return d.msg.Header }
+
+func (d *delivery) Metadata() (*jetstream.MsgMetadata, error) {
+	return &jetstream.MsgMetadata{NumDelivered: d.delivered, Sequence: jetstream.SequencePair{Stream: 42}}, nil
+}
+
+func (d *delivery) Ack() error {
+	d.answer = "ack"
+	return nil
+}
+
+func (d *delivery) NakWithDelay(time.Duration) error {
+	d.answer = "nak"
+	return nil
+}
+
+func (d *delivery) Term() error {
+	d.answer = "term"
+	return nil
+}
+
+func deliver(t *testing.T, delivered uint64) *delivery {
+	t.Helper()
+	m, err := events.NewMessage(purchase.Completed{PurchaseID: uuid.New(), Total: 450, Currency: "USD"}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	msg := toNatsMsg(m)
+	msg.Header.Set(jetstream.MsgIDHeader, m.ID.String())
+	return &delivery{msg: msg, delivered: delivered}
+}
+
+func Test_HandledMessagesAreAcknowledged(t *testing.T) {
+	js := &JetStream{js: &server{}, streams: map[string]bool{}}
+	d := deliver(t, 1)
+	js.handle(context.Background(), func(context.Context, events.Message) error { return nil }, "coffeeco.purchase", d)
+	if d.answer != "ack" {
+		t.Fatalf("expected the message to be acknowledged but got %q", d.answer)
+	}
+}
+
+func Test_FailedMessagesAreRetriedAndThenDeadLettered(t *testing.T) {
+	srv := &server{}
+	js := &JetStream{js: srv, streams: map[string]bool{}}
+	failing := func(context.Context, events.Message) error { return errors.New("projection is down") }
+
+	for delivered := uint64(1); delivered < maxDeliver; delivered++ {
+		d := deliver(t, delivered)
+		js.handle(context.Background(), failing, "coffeeco.purchase", d)
+		if d.answer != "nak" || len(srv.published) != 0 {
+			t.Fatalf("expected delivery %d to be retried but got %q with %d dead letters", delivered, d.answer, len(srv.published))
+		}
+	}
+
+	d := deliver(t, maxDeliver)
+	js.handle(context.Background(), failing, "coffeeco.purchase", d)
+	if d.answer != "term" {
+		t.Fatalf("expected the last delivery to be terminated but got %q", d.answer)
+	}
+	if len(srv.streams) != 1 || srv.streams[0].Name != "DLT_COFFEECO_PURCHASE" || srv.streams[0].Subjects[0] != "dlt.coffeeco.purchase.>" {
+		t.Fatalf("expected a dead-letter stream outside the topic but got %+v", srv.streams)
+	}
+	if len(srv.published) != 1 {
+		t.Fatalf("expected the message to be dead-lettered once but got %d", len(srv.published))
+	}
+	parked := srv.published[0]
+	if parked.Subject != "dlt.coffeeco.purchase.completed" || string(parked.Data) != string(d.msg.Data) {
+		t.Fatalf("expected the message parked as it was on dlt.coffeeco.purchase.completed but got %s %s", parked.Subject, parked.Data)
+	}
+	if parked.Header.Get(headerDLTError) != "projection is down" || parked.Header.Get(headerDLTSubject) != "coffeeco.purchase.completed" || parked.Header.Get(headerDLTSequence) != "42" {
+		t.Fatalf("expected the parked message to say where it came from and why but got %v", parked.Header)
+	}
+	if parked.Header.Get(jetstream.MsgIDHeader) != "" {
+		t.Fatal("expected the parked message not to keep the message ID of the original")
+	}
+	if got := fromNatsMsg(&delivery{msg: parked}); got.Type != purchase.EventTypeCompleted || got.ID.String() != d.msg.Header.Get(jetstream.MsgIDHeader) {
+		t.Fatalf("expected the parked message to decode as the original event but got %+v", got)
+	}
+}
+
+func Test_MessagesThatCannotBeDeadLetteredAreRetried(t *testing.T) {
+	srv := &server{down: true}
+	js := &JetStream{js: srv, streams: map[string]bool{}}
+	d := deliver(t, maxDeliver+3)
+	js.handle(context.Background(), func(context.Context, events.Message) error { return errors.New("projection is down") }, "coffeeco.purchase", d)
+	if d.answer != "nak" {
+		t.Fatalf("expected the message to be delivered again rather than dropped but got %q", d.answer)
+	}
+}
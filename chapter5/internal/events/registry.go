@@ -0,0 +1,62 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrUnknownEvent = errors.New("no decoder registered for event")
+
+// Decoder turns a payload back into an Event. Decoders for old versions should return the current
+// event struct, so consumers only ever deal with the latest shape.
+type Decoder func(payload []byte) (Event, error)
+
+type registryKey struct {
+	eventType string
+	version   int
+}
+
+// Registry maps an event type and version to the decoder able to read it. Producers can therefore move
+// to a new version while consumers still understand events published with the old one.
+type Registry struct {
+	mu       sync.RWMutex
+	decoders map[registryKey]Decoder
+}
+
+func NewRegistry() *Registry {
+	return &Registry{decoders: map[registryKey]Decoder{}}
+}
+
+func (r *Registry) Register(eventType string, version int, d Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders[registryKey{eventType: eventType, version: version}] = d
+}
+
+// Decode returns ErrUnknownEvent if nothing is registered for the message's type and version.
+func (r *Registry) Decode(msg Message) (Event, error) {
+	r.mu.RLock()
+	d, ok := r.decoders[registryKey{eventType: msg.Type, version: msg.Version}]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s v%d", ErrUnknownEvent, msg.Type, msg.Version)
+	}
+	e, err := d(msg.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s v%d: %w", msg.Type, msg.Version, err)
+	}
+	return e, nil
+}
+
+// JSONDecoder decodes a JSON payload straight into T.
+func JSONDecoder[T Event]() Decoder {
+	return func(payload []byte) (Event, error) {
+		var e T
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+}
@@ -0,0 +1,75 @@
+package events_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+type priceChanged struct {
+	ID    uuid.UUID `json:"id"`
+	Cents int64     `json:"cents"`
+}
+
+func (p priceChanged) EventType() string      { return "catalog.price_changed" }
+func (p priceChanged) AggregateID() uuid.UUID { return p.ID }
+func (p priceChanged) EventVersion() int      { return 2 }
+
+func Test_RegistryDecodesOldVersionsIntoCurrentShape(t *testing.T) {
+	r := events.NewRegistry()
+	r.Register("catalog.price_changed", 2, events.JSONDecoder[priceChanged]())
+	r.Register("catalog.price_changed", 1, func(payload []byte) (events.Event, error) {
+		var v1 struct {
+			ID      uuid.UUID `json:"id"`
+			Dollars float64   `json:"dollars"`
+		}
+		if err := json.Unmarshal(payload, &v1); err != nil {
+			return nil, err
+		}
+		return priceChanged{ID: v1.ID, Cents: int64(v1.Dollars * 100)}, nil
+	})
+
+	current, err := events.NewMessage(priceChanged{ID: uuid.New(), Cents: 250}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if current.Version != 2 {
+		t.Fatalf("expected version 2 but got %d", current.Version)
+	}
+	old := events.Message{Type: "catalog.price_changed", Version: 1, Payload: []byte(`{"dollars":2.5}`)}
+
+	for _, m := range []events.Message{current, old} {
+		e, err := r.Decode(m)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if got := e.(priceChanged).Cents; got != 250 {
+			t.Fatalf("expected 250 cents from v%d but got %d", m.Version, got)
+		}
+	}
+
+	_, err = r.Decode(events.Message{Type: "catalog.price_changed", Version: 3})
+	if !errors.Is(err, events.ErrUnknownEvent) {
+		t.Fatalf("expected ErrUnknownEvent but got %v", err)
+	}
+}
+
+func Test_TransportHeadersRoundTrip(t *testing.T) {
+	m, err := events.NewMessage(priceChanged{ID: uuid.New()}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	m.CorrelationID = "corr"
+	m.CausationID = "cause"
+	m.Headers["custom"] = "value"
+
+	got := events.MessageFromTransport(m.TransportHeaders(), m.Payload)
+	if got.ID != m.ID || got.Version != 2 || got.CorrelationID != "corr" || got.CausationID != "cause" ||
+		got.Headers["custom"] != "value" || !got.OccurredAt.Equal(m.OccurredAt) {
+		t.Fatalf("expected %+v but got %+v", m, got)
+	}
+}
@@ -0,0 +1,89 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrConcurrencyConflict = errors.New("aggregate was modified concurrently")
+	ErrNoSnapshot          = errors.New("no snapshot for aggregate")
+	ErrAggregateNotFound   = errors.New("aggregate has no events")
+)
+
+// Record is one persisted event in an aggregate's stream. Version is the record's 1-based position in
+// the stream; SchemaVersion is the version of the payload's shape, used by upcasters.
+type Record struct {
+	AggregateID   uuid.UUID
+	Version       int
+	Type          string
+	SchemaVersion int
+	Data          []byte
+	RecordedAt    time.Time
+	// CorrelationID and CausationID say which request or message the event came from. They are metadata,
+	// kept next to the payload rather than in it.
+	CorrelationID string
+	CausationID   string
+}
+
+// Snapshot is the serialized state of an aggregate as of Version, so rehydration only needs the events after it.
+type Snapshot struct {
+	AggregateID uuid.UUID
+	Version     int
+	Data        []byte
+	TakenAt     time.Time
+}
+
+// Store is an append-only event store. Append fails with ErrConcurrencyConflict if the stream is no
+// longer at expectedVersion, which gives aggregates optimistic concurrency for free.
+type Store interface {
+	Append(ctx context.Context, aggregateID uuid.UUID, expectedVersion int, records []Record) error
+	Load(ctx context.Context, aggregateID uuid.UUID, afterVersion int) ([]Record, error)
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+	LatestSnapshot(ctx context.Context, aggregateID uuid.UUID) (Snapshot, error)
+	Ping(ctx context.Context) error
+}
+
+// Upcaster rewrites a record from an older schema version into the next one.
+type Upcaster func(r Record) (Record, error)
+
+// Upcasters lets event shapes evolve without rewriting history: old records are upgraded on read,
+// one schema version at a time.
+type Upcasters struct {
+	byType map[string]map[int]Upcaster
+}
+
+func NewUpcasters() *Upcasters {
+	return &Upcasters{byType: map[string]map[int]Upcaster{}}
+}
+
+// Register adds an upcaster for eventType records at fromVersion. It must return a record at fromVersion+1.
+func (u *Upcasters) Register(eventType string, fromVersion int, fn Upcaster) {
+	if u.byType[eventType] == nil {
+		u.byType[eventType] = map[int]Upcaster{}
+	}
+	u.byType[eventType][fromVersion] = fn
+}
+
+// Upcast applies registered upcasters until the record is at the latest known schema version.
+func (u *Upcasters) Upcast(r Record) (Record, error) {
+	for {
+		fn, ok := u.byType[r.Type][r.SchemaVersion]
+		if !ok {
+			return r, nil
+		}
+		from := r.SchemaVersion
+		upcasted, err := fn(r)
+		if err != nil {
+			return Record{}, fmt.Errorf("failed to upcast %s from v%d: %w", r.Type, from, err)
+		}
+		if upcasted.SchemaVersion != from+1 {
+			return Record{}, fmt.Errorf("upcaster for %s v%d produced v%d", r.Type, from, upcasted.SchemaVersion)
+		}
+		r = upcasted
+	}
+}
@@ -0,0 +1,65 @@
+package eventstore_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/eventstore"
+)
+
+func Test_AppendDetectsConcurrentWriters(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = eventstore.NewMemoryStore()
+		id    = uuid.New()
+	)
+	if err := store.Append(ctx, id, 0, []eventstore.Record{{Type: "a"}}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := store.Append(ctx, id, 0, []eventstore.Record{{Type: "b"}}); !errors.Is(err, eventstore.ErrConcurrencyConflict) {
+		t.Fatalf("expected ErrConcurrencyConflict but got %v", err)
+	}
+
+	records, err := store.Load(ctx, id, 0)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(records) != 1 || records[0].Version != 1 {
+		t.Fatalf("expected a single record at version 1 but got %+v", records)
+	}
+}
+
+func Test_UpcastersChainVersions(t *testing.T) {
+	u := eventstore.NewUpcasters()
+	// v1 stored the amount in dollars, v2 in cents, v3 renamed the field.
+	u.Register("thing.happened", 1, func(r eventstore.Record) (eventstore.Record, error) {
+		var v1 struct{ Dollars int64 }
+		if err := json.Unmarshal(r.Data, &v1); err != nil {
+			return eventstore.Record{}, err
+		}
+		r.Data, _ = json.Marshal(struct{ Cents int64 }{v1.Dollars * 100})
+		r.SchemaVersion = 2
+		return r, nil
+	})
+	u.Register("thing.happened", 2, func(r eventstore.Record) (eventstore.Record, error) {
+		var v2 struct{ Cents int64 }
+		if err := json.Unmarshal(r.Data, &v2); err != nil {
+			return eventstore.Record{}, err
+		}
+		r.Data, _ = json.Marshal(struct{ Amount int64 }{v2.Cents})
+		r.SchemaVersion = 3
+		return r, nil
+	})
+
+	got, err := u.Upcast(eventstore.Record{Type: "thing.happened", SchemaVersion: 1, Data: []byte(`{"Dollars":3}`)})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if got.SchemaVersion != 3 || string(got.Data) != `{"Amount":300}` {
+		t.Fatalf("expected v3 with Amount 300 but got v%d %s", got.SchemaVersion, got.Data)
+	}
+}
@@ -0,0 +1,68 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore keeps streams in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu        sync.Mutex
+	streams   map[uuid.UUID][]Record
+	snapshots map[uuid.UUID]Snapshot
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{streams: map[uuid.UUID][]Record{}, snapshots: map[uuid.UUID]Snapshot{}}
+}
+
+func (m *MemoryStore) Append(_ context.Context, aggregateID uuid.UUID, expectedVersion int, records []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.streams[aggregateID]) != expectedVersion {
+		return ErrConcurrencyConflict
+	}
+	for i, r := range records {
+		r.AggregateID = aggregateID
+		r.Version = expectedVersion + i + 1
+		r.RecordedAt = time.Now().UTC()
+		m.streams[aggregateID] = append(m.streams[aggregateID], r)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Load(_ context.Context, aggregateID uuid.UUID, afterVersion int) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stream := m.streams[aggregateID]
+	if afterVersion >= len(stream) {
+		return nil, nil
+	}
+	return append([]Record(nil), stream[afterVersion:]...), nil
+}
+
+func (m *MemoryStore) SaveSnapshot(_ context.Context, snapshot Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if snapshot.Version > m.snapshots[snapshot.AggregateID].Version {
+		m.snapshots[snapshot.AggregateID] = snapshot
+	}
+	return nil
+}
+
+func (m *MemoryStore) LatestSnapshot(_ context.Context, aggregateID uuid.UUID) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.snapshots[aggregateID]
+	if !ok {
+		return Snapshot{}, ErrNoSnapshot
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) Ping(context.Context) error {
+	return nil
+}
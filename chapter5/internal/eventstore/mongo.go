@@ -0,0 +1,153 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoStore struct {
+	events    *mongo.Collection
+	snapshots *mongo.Collection
+}
+
+// NewMongoStore stores events for one aggregate type in "<stream>_events" and "<stream>_snapshots".
+func NewMongoStore(ctx context.Context, connectionString string, stream string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	s := &MongoStore{
+		events:    db.Collection(stream + "_events"),
+		snapshots: db.Collection(stream + "_snapshots"),
+	}
+
+	// The unique index is what enforces optimistic concurrency: two writers appending the same version
+	// cannot both succeed.
+	_, err = s.events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "aggregate_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create event stream index: %w", err)
+	}
+	return s, nil
+}
+
+type mongoRecord struct {
+	AggregateID   string    `bson:"aggregate_id"`
+	Version       int       `bson:"version"`
+	Type          string    `bson:"type"`
+	SchemaVersion int       `bson:"schema_version"`
+	Data          []byte    `bson:"data"`
+	RecordedAt    time.Time `bson:"recorded_at"`
+	CorrelationID string    `bson:"correlation_id,omitempty"`
+	CausationID   string    `bson:"causation_id,omitempty"`
+}
+
+type mongoSnapshot struct {
+	AggregateID string    `bson:"aggregate_id"`
+	Version     int       `bson:"version"`
+	Data        []byte    `bson:"data"`
+	TakenAt     time.Time `bson:"taken_at"`
+}
+
+func (m *MongoStore) Append(ctx context.Context, aggregateID uuid.UUID, expectedVersion int, records []Record) error {
+	current, err := m.events.CountDocuments(ctx, bson.D{{Key: "aggregate_id", Value: aggregateID.String()}})
+	if err != nil {
+		return fmt.Errorf("failed to read stream version: %w", err)
+	}
+	if int(current) != expectedVersion {
+		return ErrConcurrencyConflict
+	}
+
+	docs := make([]interface{}, 0, len(records))
+	for i, r := range records {
+		docs = append(docs, mongoRecord{
+			AggregateID:   aggregateID.String(),
+			Version:       expectedVersion + i + 1,
+			Type:          r.Type,
+			SchemaVersion: r.SchemaVersion,
+			Data:          r.Data,
+			RecordedAt:    time.Now().UTC(),
+			CorrelationID: r.CorrelationID,
+			CausationID:   r.CausationID,
+		})
+	}
+	if _, err := m.events.InsertMany(ctx, docs); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrConcurrencyConflict
+		}
+		return fmt.Errorf("failed to append events: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Load(ctx context.Context, aggregateID uuid.UUID, afterVersion int) ([]Record, error) {
+	cur, err := m.events.Find(ctx,
+		bson.D{{Key: "aggregate_id", Value: aggregateID.String()}, {Key: "version", Value: bson.D{{Key: "$gt", Value: afterVersion}}}},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	var docs []mongoRecord
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+	records := make([]Record, 0, len(docs))
+	for _, d := range docs {
+		records = append(records, Record{
+			AggregateID:   aggregateID,
+			Version:       d.Version,
+			Type:          d.Type,
+			SchemaVersion: d.SchemaVersion,
+			Data:          d.Data,
+			RecordedAt:    d.RecordedAt,
+			CorrelationID: d.CorrelationID,
+			CausationID:   d.CausationID,
+		})
+	}
+	return records, nil
+}
+
+func (m *MongoStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	_, err := m.snapshots.InsertOne(ctx, mongoSnapshot{
+		AggregateID: snapshot.AggregateID.String(),
+		Version:     snapshot.Version,
+		Data:        snapshot.Data,
+		TakenAt:     snapshot.TakenAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) LatestSnapshot(ctx context.Context, aggregateID uuid.UUID) (Snapshot, error) {
+	var doc mongoSnapshot
+	err := m.snapshots.FindOne(ctx,
+		bson.D{{Key: "aggregate_id", Value: aggregateID.String()}},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}),
+	).Decode(&doc)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return Snapshot{}, ErrNoSnapshot
+		}
+		return Snapshot{}, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	return Snapshot{AggregateID: aggregateID, Version: doc.Version, Data: doc.Data, TakenAt: doc.TakenAt}, nil
+}
+
+func (m *MongoStore) Ping(ctx context.Context) error {
+	if _, err := m.events.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
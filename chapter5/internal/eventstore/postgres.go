@@ -0,0 +1,247 @@
+package eventstore
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const uniqueViolation = "23505"
+
+// validStream keeps stream names usable as table name prefixes.
+var validStream = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS %[1]s_events (
+	aggregate_id   UUID        NOT NULL,
+	version        INT         NOT NULL,
+	type           TEXT        NOT NULL,
+	schema_version INT         NOT NULL,
+	data           JSONB       NOT NULL,
+	recorded_at    TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (aggregate_id, version)
+);
+ALTER TABLE %[1]s_events ADD COLUMN IF NOT EXISTS correlation_id TEXT;
+ALTER TABLE %[1]s_events ADD COLUMN IF NOT EXISTS causation_id TEXT;
+CREATE TABLE IF NOT EXISTS %[1]s_snapshots (
+	aggregate_id UUID        NOT NULL,
+	version      INT         NOT NULL,
+	data         JSONB       NOT NULL,
+	taken_at     TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (aggregate_id, version)
+);`
+
+// PostgresPool sizes the connections a PostgresStore keeps to Postgres.
+type PostgresPool struct {
+	// MaxConns is how many connections are open at most. Queries beyond them wait for one to be released.
+	MaxConns int32
+	// MinConns are kept open even while idle, so a burst does not wait for connections to be made.
+	MinConns int32
+	// MaxConnLifetime closes connections that are older, e.g. to follow a failover or a rotated password.
+	MaxConnLifetime time.Duration
+	// MaxConnIdleTime closes connections idle for longer, down to MinConns.
+	MaxConnIdleTime time.Duration
+	// StatementCache is how many prepared statements each connection keeps. 0 prepares none, which
+	// PgBouncer in transaction mode needs since it hands every transaction to another server connection.
+	StatementCache int
+}
+
+var DefaultPostgresPool = PostgresPool{
+	MaxConns:        10,
+	MinConns:        2,
+	MaxConnLifetime: time.Hour,
+	MaxConnIdleTime: 5 * time.Minute,
+	StatementCache:  64,
+}
+
+// PoolStats is how busy the connections of a PostgresStore are.
+type PoolStats struct {
+	Acquired int32
+	Idle     int32
+	Total    int32
+	Max      int32
+	// Acquires counts the connections handed out. EmptyAcquires of them had to wait for one because all were
+	// busy, and CanceledAcquires gave up waiting; both growing means the pool is saturated.
+	Acquires         int64
+	EmptyAcquires    int64
+	CanceledAcquires int64
+	// AcquireWait is how long all the acquires took together.
+	AcquireWait time.Duration
+}
+
+// postgresStatements are the queries of a stream. They are built once, so each is the same string every
+// time and is prepared once per connection.
+type postgresStatements struct {
+	version        string
+	insert         string
+	load           string
+	saveSnapshot   string
+	latestSnapshot string
+}
+
+func newPostgresStatements(stream string) postgresStatements {
+	return postgresStatements{
+		version: "SELECT COALESCE(MAX(version), 0) FROM " + stream + "_events WHERE aggregate_id = $1",
+		insert:  "INSERT INTO " + stream + "_events (aggregate_id, version, type, schema_version, data, recorded_at, correlation_id, causation_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)",
+		load: "SELECT version, type, schema_version, data, recorded_at, COALESCE(correlation_id, ''), COALESCE(causation_id, '') FROM " + stream + "_events" +
+			" WHERE aggregate_id = $1 AND version > $2 ORDER BY version",
+		saveSnapshot:   "INSERT INTO " + stream + "_snapshots (aggregate_id, version, data, taken_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		latestSnapshot: "SELECT version, data, taken_at FROM " + stream + "_snapshots WHERE aggregate_id = $1 ORDER BY version DESC LIMIT 1",
+	}
+}
+
+type PostgresStore struct {
+	pool   *pgxpool.Pool
+	stream string
+	sql    postgresStatements
+}
+
+// NewPostgresStore stores events for one aggregate type in "<stream>_events" and "<stream>_snapshots",
+// creating the tables if they do not exist yet. Settings of the pool left zero are taken from
+// DefaultPostgresPool, except StatementCache.
+func NewPostgresStore(ctx context.Context, connectionString string, stream string, pool PostgresPool) (*PostgresStore, error) {
+	if !validStream.MatchString(stream) {
+		return nil, fmt.Errorf("invalid stream name %q", stream)
+	}
+	cfg, err := pgxpool.ParseConfig(connectionString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the postgres URL: %w", err)
+	}
+	cfg.MaxConns = cmp.Or(pool.MaxConns, DefaultPostgresPool.MaxConns)
+	cfg.MinConns = min(cmp.Or(pool.MinConns, DefaultPostgresPool.MinConns), cfg.MaxConns)
+	cfg.MaxConnLifetime = cmp.Or(pool.MaxConnLifetime, DefaultPostgresPool.MaxConnLifetime)
+	cfg.MaxConnIdleTime = cmp.Or(pool.MaxConnIdleTime, DefaultPostgresPool.MaxConnIdleTime)
+	if pool.StatementCache > 0 {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+		cfg.ConnConfig.StatementCacheCapacity = pool.StatementCache
+	} else {
+		cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	}
+	conns, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a postgres pool: %w", err)
+	}
+	if _, err := conns.Exec(ctx, fmt.Sprintf(postgresSchema, stream), pgx.QueryExecModeSimpleProtocol); err != nil {
+		conns.Close()
+		return nil, fmt.Errorf("failed to create event store tables: %w", err)
+	}
+	return &PostgresStore{pool: conns, stream: stream, sql: newPostgresStatements(stream)}, nil
+}
+
+func (p *PostgresStore) table(suffix string) string {
+	return p.stream + suffix
+}
+
+// Close closes the connections to Postgres. The store cannot be used afterwards.
+func (p *PostgresStore) Close(context.Context) error {
+	p.pool.Close()
+	return nil
+}
+
+// PoolStats is a snapshot of the connection pool, e.g. for metrics.Metrics.PostgresPool.
+func (p *PostgresStore) PoolStats() PoolStats {
+	s := p.pool.Stat()
+	return PoolStats{
+		Acquired:         s.AcquiredConns(),
+		Idle:             s.IdleConns(),
+		Total:            s.TotalConns(),
+		Max:              s.MaxConns(),
+		Acquires:         s.AcquireCount(),
+		EmptyAcquires:    s.EmptyAcquireCount(),
+		CanceledAcquires: s.CanceledAcquireCount(),
+		AcquireWait:      s.AcquireDuration(),
+	}
+}
+
+func (p *PostgresStore) Append(ctx context.Context, aggregateID uuid.UUID, expectedVersion int, records []Record) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	err = tx.QueryRow(ctx, p.sql.version, aggregateID).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read stream version: %w", err)
+	}
+	if current != expectedVersion {
+		return ErrConcurrencyConflict
+	}
+
+	batch := &pgx.Batch{}
+	for i, r := range records {
+		batch.Queue(p.sql.insert,
+			aggregateID, expectedVersion+i+1, r.Type, r.SchemaVersion, r.Data, time.Now().UTC(), r.CorrelationID, r.CausationID,
+		)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrConcurrencyConflict
+		}
+		return fmt.Errorf("failed to append events: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit events: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) Load(ctx context.Context, aggregateID uuid.UUID, afterVersion int) ([]Record, error) {
+	rows, err := p.pool.Query(ctx, p.sql.load, aggregateID, afterVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		r := Record{AggregateID: aggregateID}
+		if err := rows.Scan(&r.Version, &r.Type, &r.SchemaVersion, &r.Data, &r.RecordedAt, &r.CorrelationID, &r.CausationID); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load events: %w", err)
+	}
+	return records, nil
+}
+
+func (p *PostgresStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	_, err := p.pool.Exec(ctx, p.sql.saveSnapshot,
+		snapshot.AggregateID, snapshot.Version, snapshot.Data, snapshot.TakenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return nil
+}
+
+func (p *PostgresStore) LatestSnapshot(ctx context.Context, aggregateID uuid.UUID) (Snapshot, error) {
+	s := Snapshot{AggregateID: aggregateID}
+	err := p.pool.QueryRow(ctx, p.sql.latestSnapshot, aggregateID).Scan(&s.Version, &s.Data, &s.TakenAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Snapshot{}, ErrNoSnapshot
+		}
+		return Snapshot{}, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+	return s, nil
+}
+
+func (p *PostgresStore) Ping(ctx context.Context) error {
+	if err := p.pool.Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const duplicateObject = "42710"
+
+// wal2jsonChange is one change as emitted by the wal2json output plugin with format-version 2.
+type wal2jsonChange struct {
+	Action  string `json:"action"`
+	Columns []struct {
+		Name  string          `json:"name"`
+		Value json.RawMessage `json:"value"`
+	} `json:"columns"`
+}
+
+// TailChanges follows inserts into the events table through a logical replication slot, rather than by
+// querying the table, so nothing committed is ever missed. It needs the wal2json plugin on the server.
+// The slot only advances after fn succeeds for a whole batch, so records may be delivered again after a
+// restart; consumers are expected to deduplicate.
+func (p *PostgresStore) TailChanges(ctx context.Context, slot string, pollInterval time.Duration, fn func(ctx context.Context, r Record) error) error {
+	_, err := p.pool.Exec(ctx, "SELECT pg_create_logical_replication_slot($1, 'wal2json')", slot)
+	var pgErr *pgconn.PgError
+	if err != nil && !(errors.As(err, &pgErr) && pgErr.Code == duplicateObject) {
+		return fmt.Errorf("failed to create replication slot %s: %w", slot, err)
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.drainChanges(ctx, slot, fn); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *PostgresStore) drainChanges(ctx context.Context, slot string, fn func(ctx context.Context, r Record) error) error {
+	rows, err := p.pool.Query(ctx,
+		"SELECT lsn::text, data FROM pg_logical_slot_peek_changes($1, NULL, 500, 'format-version', '2', 'add-tables', $2, 'actions', 'insert')",
+		slot, "public."+p.table("_events"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read changes: %w", err)
+	}
+	type change struct {
+		lsn  string
+		data []byte
+	}
+	var changes []change
+	for rows.Next() {
+		var c change
+		if err := rows.Scan(&c.lsn, &c.data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read changes: %w", err)
+	}
+
+	for _, c := range changes {
+		var wc wal2jsonChange
+		if err := json.Unmarshal(c.data, &wc); err != nil {
+			return fmt.Errorf("failed to decode change at %s: %w", c.lsn, err)
+		}
+		if wc.Action != "I" {
+			continue
+		}
+		r, err := recordFromColumns(wc)
+		if err != nil {
+			return fmt.Errorf("failed to decode change at %s: %w", c.lsn, err)
+		}
+		if err := fn(ctx, r); err != nil {
+			return err
+		}
+	}
+	if len(changes) > 0 {
+		last := changes[len(changes)-1].lsn
+		if _, err := p.pool.Exec(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", slot, last); err != nil {
+			return fmt.Errorf("failed to advance replication slot to %s: %w", last, err)
+		}
+	}
+	return nil
+}
+
+func recordFromColumns(wc wal2jsonChange) (Record, error) {
+	var r Record
+	for _, col := range wc.Columns {
+		var err error
+		switch col.Name {
+		case "aggregate_id":
+			var s string
+			if err = json.Unmarshal(col.Value, &s); err == nil {
+				r.AggregateID, err = uuid.Parse(s)
+			}
+		case "version":
+			err = json.Unmarshal(col.Value, &r.Version)
+		case "type":
+			err = json.Unmarshal(col.Value, &r.Type)
+		case "schema_version":
+			err = json.Unmarshal(col.Value, &r.SchemaVersion)
+		case "data":
+			// jsonb columns come through as a JSON string holding the document.
+			var s string
+			if err = json.Unmarshal(col.Value, &s); err == nil {
+				r.Data = []byte(s)
+			}
+		case "correlation_id":
+			err = json.Unmarshal(col.Value, &r.CorrelationID)
+		case "causation_id":
+			err = json.Unmarshal(col.Value, &r.CausationID)
+		case "recorded_at":
+			var s string
+			if err = json.Unmarshal(col.Value, &s); err == nil {
+				r.RecordedAt, err = parsePostgresTimestamp(s)
+			}
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("column %s: %w", col.Name, err)
+		}
+	}
+	return r, nil
+}
+
+func parsePostgresTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999-07", "2006-01-02 15:04:05.999999-07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("unrecognised timestamp " + strconv.Quote(s))
+}
@@ -0,0 +1,252 @@
+package experiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/sandbox"
+)
+
+const EventTypeExposed = "experiment.exposed"
+
+var ErrInvalidExperiment = errors.New("invalid experiment")
+
+// Variant is one of the discounts an experiment tries. Customers are put in it Weight times as often as in a
+// variant of weight 1.
+type Variant struct {
+	Name            string  `json:"name"`
+	Weight          int     `json:"weight"`
+	DiscountPercent float32 `json:"discount_percent"`
+}
+
+// Experiment tries different store discounts on a cohort of customers, to see which sells best. A customer
+// in the cohort is given the discount of their variant at the experiment's stores instead of the store's
+// own.
+type Experiment struct {
+	Name string `json:"name"`
+	// Stores are where the experiment runs; every store if empty.
+	Stores []uuid.UUID `json:"stores,omitempty"`
+	// Percent is the share of customers in the cohort. The others keep the store's discount.
+	Percent  int       `json:"percent"`
+	Variants []Variant `json:"variants"`
+	// From and To bound when the experiment runs; it is not bounded on a side left zero.
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+}
+
+// Assignment is the variant a customer is in. The zero Assignment is for customers in no experiment.
+type Assignment struct {
+	Experiment      string  `json:"experiment"`
+	Variant         string  `json:"variant"`
+	DiscountPercent float32 `json:"discount_percent"`
+}
+
+func (a Assignment) IsZero() bool {
+	return a.Experiment == ""
+}
+
+// Exposed is published every time a customer is priced in their variant. Its ID is the same for every
+// exposure of a customer to an experiment, so consumers deduplicating by event ID count the first.
+type Exposed struct {
+	Experiment string    `json:"experiment"`
+	Variant    string    `json:"variant"`
+	StoreID    uuid.UUID `json:"store_id"`
+	CustomerID uuid.UUID `json:"customer_id"`
+	ExposedAt  time.Time `json:"exposed_at"`
+}
+
+func (e Exposed) EventType() string {
+	return EventTypeExposed
+}
+
+func (e Exposed) AggregateID() uuid.UUID {
+	return e.CustomerID
+}
+
+func (e Exposed) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.CustomerID, []byte(EventTypeExposed+"."+e.Experiment))
+}
+
+// RegisterEvents adds decoders for every version of the experiment events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeExposed, 1, events.JSONDecoder[Exposed]())
+}
+
+// Validate tells everything wrong with experiments: every one needs a unique name, a percent between 1 and
+// 100, and at least two variants of unique names, a positive weight and a discount between 0 and 100.
+func Validate(experiments []Experiment) error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidExperiment}, args...)...))
+	}
+	names := map[string]bool{}
+	for i, x := range experiments {
+		switch {
+		case x.Name == "":
+			invalid("experiment %d needs a name", i)
+		case names[x.Name]:
+			invalid("%q is the name of two experiments", x.Name)
+		}
+		names[x.Name] = true
+		if x.Percent < 1 || x.Percent > 100 {
+			invalid("%q must take between 1 and 100 percent of customers", x.Name)
+		}
+		if !x.From.IsZero() && !x.To.IsZero() && !x.To.After(x.From) {
+			invalid("%q must end after it starts", x.Name)
+		}
+		if len(x.Variants) < 2 {
+			invalid("%q needs at least two variants to compare", x.Name)
+		}
+		variants := map[string]bool{}
+		for _, v := range x.Variants {
+			if v.Name == "" || variants[v.Name] {
+				invalid("variants of %q need unique names", x.Name)
+			}
+			variants[v.Name] = true
+			if v.Weight < 1 {
+				invalid("variant %q of %q needs a weight of at least 1", v.Name, x.Name)
+			}
+			if v.DiscountPercent < 0 || v.DiscountPercent > 100 {
+				invalid("variant %q of %q must take between 0 and 100 percent off", v.Name, x.Name)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runs tells whether the experiment runs at the store at at.
+func (x Experiment) runs(storeID uuid.UUID, at time.Time) bool {
+	if (!x.From.IsZero() && at.Before(x.From)) || (!x.To.IsZero() && !at.Before(x.To)) {
+		return false
+	}
+	if len(x.Stores) == 0 {
+		return true
+	}
+	for _, id := range x.Stores {
+		if id == storeID {
+			return true
+		}
+	}
+	return false
+}
+
+// assign puts the customer in a variant, if they are in the cohort. Customers are bucketed by their ID
+// and the experiment's name, so a customer is always in the same variant of an experiment, and the cohorts
+// of two experiments are drawn apart.
+func (x Experiment) assign(customerID uuid.UUID) (Assignment, bool) {
+	if bucket(x.Name+"/cohort", customerID, 100) >= x.Percent {
+		return Assignment{}, false
+	}
+	total := 0
+	for _, v := range x.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return Assignment{}, false
+	}
+	n := bucket(x.Name+"/variant", customerID, total)
+	for _, v := range x.Variants {
+		if n < v.Weight {
+			return Assignment{Experiment: x.Name, Variant: v.Name, DiscountPercent: v.DiscountPercent}, true
+		}
+		n -= v.Weight
+	}
+	return Assignment{}, false
+}
+
+func bucket(salt string, customerID uuid.UUID, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(salt))
+	_, _ = h.Write(customerID[:])
+	return int(h.Sum32() % uint32(n))
+}
+
+// Service assigns customers to the variants of the experiments that run, and tells when they were exposed
+// to them.
+type Service struct {
+	mu          sync.RWMutex
+	experiments []Experiment
+
+	publisher events.Publisher // 可选, 发布 Exposed 事件
+	logger    *slog.Logger
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes an Exposed event every time a customer is assigned a variant. Without it
+// exposures are not told to anyone.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithLogger sets where the Service logs exposures it failed to publish. It logs to slog.Default() otherwise.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// NewService runs experiments, which are expected to have been validated with Validate.
+func NewService(experiments []Experiment, opts ...Option) *Service {
+	s := &Service{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Replace(experiments)
+	return s
+}
+
+// Replace swaps every experiment for experiments at once. Customers stay in their variants of the
+// experiments that are kept, as long as their variants are.
+func (s *Service) Replace(experiments []Experiment) {
+	copied := append([]Experiment(nil), experiments...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.experiments = copied
+}
+
+// Assign is the variant the customer is in at the store at at, from the first experiment running there
+// whose cohort they are in, or the zero Assignment. Anonymous customers are in no experiment, as they could
+// not be told apart. Practice purchases are priced in the variant but not exposed.
+func (s *Service) Assign(ctx context.Context, storeID, customerID uuid.UUID, at time.Time) (Assignment, error) {
+	if customerID == uuid.Nil {
+		return Assignment{}, nil
+	}
+	s.mu.RLock()
+	experiments := s.experiments
+	s.mu.RUnlock()
+	for _, x := range experiments {
+		if !x.runs(storeID, at) {
+			continue
+		}
+		a, ok := x.assign(customerID)
+		if !ok {
+			continue
+		}
+		s.expose(ctx, storeID, customerID, a, at)
+		return a, nil
+	}
+	return Assignment{}, nil
+}
+
+// expose publishes that the customer was exposed to their variant. An exposure that is not published is
+// logged rather than failing the purchase it was priced for.
+func (s *Service) expose(ctx context.Context, storeID, customerID uuid.UUID, a Assignment, at time.Time) {
+	if s.publisher == nil || sandbox.Enabled(ctx) {
+		return
+	}
+	e := Exposed{Experiment: a.Experiment, Variant: a.Variant, StoreID: storeID, CustomerID: customerID, ExposedAt: at.UTC()}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		s.logger.WarnContext(ctx, "failed to publish experiment exposure", "experiment", a.Experiment, "variant", a.Variant, "customer_id", customerID, "error", err)
+	}
+}
@@ -0,0 +1,121 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/sandbox"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+type percentOff float32
+
+func (p percentOff) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return float32(p), nil
+}
+
+func deeperDiscount(stores ...uuid.UUID) experiment.Experiment {
+	return experiment.Experiment{
+		Name:    "deeper-discount",
+		Stores:  stores,
+		Percent: 100,
+		Variants: []experiment.Variant{
+			{Name: "control", Weight: 1, DiscountPercent: 10},
+			{Name: "twenty", Weight: 1, DiscountPercent: 20},
+		},
+	}
+}
+
+func Test_CustomersStayInTheirVariantAndAreExposedEveryTime(t *testing.T) {
+	ctx := context.Background()
+	soho, leeds := uuid.New(), uuid.New()
+	exposed := &capture{}
+	svc := experiment.NewService([]experiment.Experiment{deeperDiscount(soho)}, experiment.WithEventPublisher(exposed))
+	at := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+
+	seen := map[string]int{}
+	for range 200 {
+		customer := uuid.New()
+		a, err := svc.Assign(ctx, soho, customer, at)
+		if err != nil || a.IsZero() {
+			t.Fatalf("expected every customer in the cohort but got %+v, %v", a, err)
+		}
+		again, _ := svc.Assign(ctx, soho, customer, at.Add(time.Hour))
+		if again != a {
+			t.Fatalf("expected the customer to stay in %+v but got %+v", a, again)
+		}
+		seen[a.Variant]++
+	}
+	if seen["control"] < 60 || seen["twenty"] < 60 {
+		t.Fatalf("expected customers split about evenly between the variants but got %v", seen)
+	}
+	if len(*exposed) != 400 {
+		t.Fatalf("expected an exposure every time a customer was priced but got %d", len(*exposed))
+	}
+	first, second := (*exposed)[0].(experiment.Exposed), (*exposed)[1].(experiment.Exposed)
+	if first.EventID() != second.EventID() || first.StoreID != soho || first.Experiment != "deeper-discount" {
+		t.Fatalf("expected exposures of a customer to share their ID but got %+v and %+v", first, second)
+	}
+
+	customer := uuid.New()
+	if a, _ := svc.Assign(ctx, leeds, customer, at); !a.IsZero() {
+		t.Fatalf("expected no experiment at another store but got %+v", a)
+	}
+	if a, _ := svc.Assign(ctx, soho, uuid.Nil, at); !a.IsZero() {
+		t.Fatalf("expected anonymous customers in no experiment but got %+v", a)
+	}
+	if a, _ := svc.Assign(sandbox.With(ctx), soho, customer, at); a.IsZero() || len(*exposed) != 400 {
+		t.Fatalf("expected practice purchases priced in the variant without an exposure but got %+v", a)
+	}
+}
+
+func Test_EnginesTakeTheVariantsDiscountInsteadOfTheStores(t *testing.T) {
+	ctx := context.Background()
+	soho := uuid.New()
+	x := deeperDiscount(soho)
+	x.Variants = x.Variants[1:2]
+	svc := experiment.NewService([]experiment.Experiment{x})
+	engine := pricing.NewEngine(pricing.Rules{}, pricing.WithStoreDiscounts(percentOff(10)), pricing.WithExperiments(svc))
+	items := []pricing.Item{{Product: "latte", ListPrice: money.New(500, "USD")}}
+
+	q, err := engine.Quote(ctx, pricing.Request{StoreID: soho, CustomerID: uuid.New(), Items: items})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if q.Total.Amount() != 400 || q.DiscountPercent != 20 || q.Experiment.Variant != "twenty" {
+		t.Fatalf("expected the variant's 20%% off but got %d, %v%% in %+v", q.Total.Amount(), q.DiscountPercent, q.Experiment)
+	}
+	q, err = engine.Quote(ctx, pricing.Request{StoreID: soho, Items: items})
+	if err != nil || q.Total.Amount() != 450 || !q.Experiment.IsZero() {
+		t.Fatalf("expected anonymous customers the store's 10%% off but got %d in %+v, %v", q.Total.Amount(), q.Experiment, err)
+	}
+}
+
+func Test_ExperimentsNeedVariantsToCompare(t *testing.T) {
+	x := deeperDiscount()
+	if err := experiment.Validate([]experiment.Experiment{x}); err != nil {
+		t.Fatalf("expected a valid experiment but got %v", err)
+	}
+	x.Variants, x.Percent = x.Variants[:1], 0
+	err := experiment.Validate([]experiment.Experiment{x, deeperDiscount()})
+	if !errors.Is(err, experiment.ErrInvalidExperiment) {
+		t.Fatalf("expected ErrInvalidExperiment but got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 3 {
+		t.Fatalf("expected the cohort, the variants and the duplicate name reported but got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package feature_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/feature"
+)
+
+// newMenu is a flag no service checks, to target stores with.
+const newMenu feature.Flag = "new-menu"
+
+func Test_RulesTargetStoresAndCustomers(t *testing.T) {
+	var (
+		store    = uuid.New()
+		customer = uuid.New()
+		flags    = feature.NewMemory()
+	)
+	flags.Set(newMenu, feature.Rule{Stores: []uuid.UUID{store}})
+	flags.Set(feature.WalletPayments, feature.Rule{Customers: []uuid.UUID{customer}})
+
+	tests := map[string]struct {
+		flag   feature.Flag
+		target feature.Target
+		want   bool
+	}{
+		"targeted store":      {flag: newMenu, target: feature.Target{StoreID: store}, want: true},
+		"other store":         {flag: newMenu, target: feature.Target{StoreID: uuid.New(), CustomerID: customer}, want: false},
+		"targeted customer":   {flag: feature.WalletPayments, target: feature.Target{StoreID: store, CustomerID: customer}, want: true},
+		"anonymous customer":  {flag: feature.WalletPayments, target: feature.Target{StoreID: store}, want: false},
+		"flag without a rule": {flag: "unknown", target: feature.Target{StoreID: store, CustomerID: customer}, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := flags.Enabled(context.Background(), tt.flag, tt.target); got != tt.want {
+				t.Fatalf("expected %v but got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func Test_PercentRolloutIsStablePerCustomer(t *testing.T) {
+	flags := feature.NewMemory()
+	flags.Set(feature.WalletPayments, feature.Rule{Percent: 30})
+	on := 0
+	for i := 0; i < 1000; i++ {
+		target := feature.Target{CustomerID: uuid.New()}
+		first := flags.Enabled(context.Background(), feature.WalletPayments, target)
+		if flags.Enabled(context.Background(), feature.WalletPayments, target) != first {
+			t.Fatalf("expected the same answer for customer %s every time", target.CustomerID)
+		}
+		if first {
+			on++
+		}
+	}
+	if on < 200 || on > 400 {
+		t.Fatalf("expected about 300 of 1000 customers to be on but got %d", on)
+	}
+}
+
+func Test_LoadReplacesTheRules(t *testing.T) {
+	store := uuid.New()
+	flags := feature.NewMemory()
+	flags.Set(feature.WalletPayments, feature.Rule{Everyone: true})
+	if err := flags.Load(strings.NewReader(`{"new-menu": {"stores": ["` + store.String() + `"]}}`)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !flags.Enabled(context.Background(), newMenu, feature.Target{StoreID: store}) {
+		t.Fatal("expected the loaded rule to apply")
+	}
+	if flags.Enabled(context.Background(), feature.WalletPayments, feature.Target{StoreID: store}) {
+		t.Fatal("expected the earlier rule to be gone")
+	}
+}
+
+type provider struct {
+	on      bool
+	err     error
+	evalCtx map[string]any
+}
+
+func (p *provider) BooleanValue(_ context.Context, _ string, _ bool, evalCtx map[string]any) (bool, error) {
+	p.evalCtx = evalCtx
+	return p.on, p.err
+}
+
+func Test_ProviderFailuresLeaveFlagsOff(t *testing.T) {
+	target := feature.Target{StoreID: uuid.New(), CustomerID: uuid.New()}
+	p := &provider{on: true}
+	if !feature.FromProvider(p).Enabled(context.Background(), feature.WalletPayments, target) {
+		t.Fatal("expected the provider's answer")
+	}
+	if p.evalCtx["targetingKey"] != target.CustomerID.String() || p.evalCtx["store_id"] != target.StoreID.String() {
+		t.Fatalf("expected the customer to be the targeting key and the store passed along but got %v", p.evalCtx)
+	}
+	p = &provider{on: true, err: errors.New("flag service unreachable")}
+	if feature.FromProvider(p).Enabled(context.Background(), feature.WalletPayments, target) {
+		t.Fatal("expected the flag to be off when the provider fails")
+	}
+}
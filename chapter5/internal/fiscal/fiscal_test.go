@@ -0,0 +1,153 @@
+package fiscal_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/fiscal"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/testsupport"
+)
+
+var errPrinterDown = errors.New("printer is out of paper")
+
+func Test_BlockingJurisdictionsDoNotChargePurchasesTheirPrinterDoesNotTake(t *testing.T) {
+	ctx := context.Background()
+	berlin := uuid.New()
+	printer := fiscal.NewMockPrinter()
+	receipts := fiscal.NewMemoryRepo()
+	fiscals := fiscal.NewService(receipts, map[uuid.UUID]string{berlin: "DE"}, map[string]fiscal.Jurisdiction{"DE": {Printer: "mock", Mode: fiscal.ModeBlock}},
+		fiscal.WithPrinter("mock", printer))
+	cards := testsupport.NewFakeCards().Approve().Decline()
+	svc := purchase.NewService(cards, testsupport.NewFakePurchases(), testsupport.FakeDiscounts{}, purchase.WithFiscalizer(fiscals))
+	buy := testsupport.NewTestPurchase().WithCurrency("EUR").WithLines("latte", 450, "croissant", 325)
+
+	printer.SetDown(errPrinterDown)
+	if err := svc.CompletePurchase(ctx, berlin, buy.Build(), nil); !errors.Is(err, fiscal.ErrNotFiscalized) {
+		t.Fatalf("expected ErrNotFiscalized but got %v", err)
+	}
+	if n := len(cards.Charges()); n != 0 {
+		t.Fatalf("expected nothing to be charged without a fiscal receipt but got %d charges", n)
+	}
+
+	printer.SetDown(nil)
+	p := buy.Build()
+	if err := svc.CompletePurchase(ctx, berlin, p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	r, err := fiscals.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != fiscal.StatusFiscalized || r.Record().Signature == "" || r.Total != 775 || len(r.Lines) != 2 {
+		t.Fatalf("expected a signed receipt of 7.75 with 2 lines but got %s %+v", r.Status(), r)
+	}
+
+	declined := buy.Build()
+	if err := svc.CompletePurchase(ctx, berlin, declined, nil); !errors.Is(err, purchase.ErrCardChargeFailed) {
+		t.Fatalf("expected ErrCardChargeFailed but got %v", err)
+	}
+	if r, _ := fiscals.Get(ctx, declined.ID); r.Status() != fiscal.StatusVoided || !printer.Voided(declined.ID) {
+		t.Fatalf("expected the receipt of the declined purchase to be voided but it is %s", r.Status())
+	}
+
+	elsewhere := buy.Build()
+	if err := svc.CompletePurchase(ctx, uuid.New(), elsewhere, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := fiscals.Get(ctx, elsewhere.ID); !errors.Is(err, fiscal.ErrNotFound) {
+		t.Fatalf("expected stores without a jurisdiction not to fiscalize but got %v", err)
+	}
+}
+
+func Test_AsyncJurisdictionsForwardReceiptsUntilTheirPrinterTakesThem(t *testing.T) {
+	ctx := context.Background()
+	paris := uuid.New()
+	clock := testsupport.NewClock(time.Time{})
+	printer := fiscal.NewMockPrinter()
+	fiscals := fiscal.NewService(fiscal.NewMemoryRepo(), map[uuid.UUID]string{paris: "FR"}, map[string]fiscal.Jurisdiction{"FR": {Printer: "mock", Mode: fiscal.ModeAsync}},
+		fiscal.WithPrinter("mock", printer), fiscal.WithRetry(fiscal.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute}), fiscal.WithClock(clock.Now))
+	svc := purchase.NewService(testsupport.NewFakeCards(), testsupport.NewFakePurchases(), testsupport.FakeDiscounts{},
+		purchase.WithFiscalizer(fiscals), purchase.WithClock(clock.Now))
+	buy := testsupport.NewTestPurchase().WithCurrency("EUR").WithMeans(payment.MEANS_CASH)
+
+	printer.SetDown(errPrinterDown)
+	p, lost := buy.Build(), buy.Build()
+	for _, p := range []*purchase.Purchase{p, lost} {
+		if err := svc.CompletePurchase(ctx, paris, p, nil); err != nil {
+			t.Fatalf("expected purchases not to wait for the printer but got %v", err)
+		}
+	}
+	if report, _ := fiscals.ForwardDue(ctx); report.Retrying != 2 {
+		t.Fatalf("expected both receipts to be tried again but got %+v", report)
+	}
+	if report, _ := fiscals.ForwardDue(ctx); report != (fiscal.ForwardReport{}) {
+		t.Fatalf("expected nothing to be due before the backoff but got %+v", report)
+	}
+
+	clock.Advance(time.Minute)
+	if report, _ := fiscals.ForwardDue(ctx); report.Failed != 2 {
+		t.Fatalf("expected both receipts to run out of attempts but got %+v", report)
+	}
+	if r, _ := fiscals.Get(ctx, lost.ID); r.LastError() != errPrinterDown.Error() {
+		t.Fatalf("expected the printer's error to be kept but got %q", r.LastError())
+	}
+
+	printer.SetDown(nil)
+	next := buy.Build()
+	if err := svc.CompletePurchase(ctx, paris, next, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if report, _ := fiscals.ForwardDue(ctx); report.Fiscalized != 1 {
+		t.Fatalf("expected the new receipt to be fiscalized but got %+v", report)
+	}
+	if r, _ := fiscals.Get(ctx, next.ID); !r.Cash || r.Record().Number != "1" {
+		t.Fatalf("expected the cash receipt to be number 1 but got %+v", r.Record())
+	}
+}
+
+func Test_FiskalySignsEachReceiptAsATSSTransaction(t *testing.T) {
+	tss, client := uuid.NewString(), uuid.NewString()
+	var finished map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/auth":
+			_, _ = w.Write([]byte(`{"access_token":"token","access_token_expires_in":3600}`))
+		case r.Header.Get("Authorization") != "Bearer token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/api/v2/tss/"+tss+"/tx/") && r.URL.Query().Get("tx_revision") == "1":
+			_, _ = w.Write([]byte(`{"state":"ACTIVE"}`))
+		case r.Method == http.MethodPut && r.URL.Query().Get("tx_revision") == "2":
+			_ = json.NewDecoder(r.Body).Decode(&finished)
+			_, _ = w.Write([]byte(`{"state":"FINISHED","number":42,"time_end":1709280000,"signature":{"value":"c2lnbmVk"},"qr_code_data":"V0;cafe"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	f, err := fiscal.NewFiskaly(fiscal.FiskalyConfig{APIKey: "key", APISecret: "secret", TSSID: tss, ClientID: client, BaseURL: srv.URL}, srv.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	rec, err := f.Print(context.Background(), &fiscal.Receipt{ID: uuid.New(), Country: "DE", Total: 1230, Currency: "EUR", Cash: true})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if rec.Number != "42" || rec.Signature != "c2lnbmVk" || rec.QRCode != "V0;cafe" {
+		t.Fatalf("expected the transaction's number, signature and QR code but got %+v", rec)
+	}
+	receipt := finished["schema"].(map[string]any)["standard_v1"].(map[string]any)["receipt"].(map[string]any)
+	means := receipt["amounts_per_payment_type"].([]any)[0].(map[string]any)
+	if finished["client_id"] != client || means["payment_type"] != "CASH" || means["amount"] != "12.30" {
+		t.Fatalf("expected 12.30 in cash from the client but got %v", finished)
+	}
+}
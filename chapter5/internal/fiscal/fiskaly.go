@@ -0,0 +1,222 @@
+package fiscal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const fiskalyURL = "https://kassensichv-middleware.fiskaly.com"
+
+// FiskalyConfig holds the API key of a fiskaly SIGN DE organization and the TSS and client the stores sign
+// with. Germany requires every receipt to be signed by a technical security system (TSS) under the
+// KassenSichV.
+type FiskalyConfig struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+	TSSID     string `json:"tss_id"`
+	ClientID  string `json:"client_id"`
+	// BaseURL defaults to fiskaly's middleware; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// Fiskaly signs receipts with fiskaly SIGN DE. Each receipt is a transaction of the TSS, identified by the
+// purchase ID, that is started and finished at once.
+type Fiskaly struct {
+	cfg    FiskalyConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewFiskaly(cfg FiskalyConfig, client *http.Client) (*Fiskaly, error) {
+	if cfg.APIKey == "" || cfg.APISecret == "" {
+		return nil, errors.New("fiskaly needs an API key and secret")
+	}
+	if _, err := uuid.Parse(cfg.TSSID); err != nil {
+		return nil, errors.New("fiskaly TSS ID must be a UUID")
+	}
+	if _, err := uuid.Parse(cfg.ClientID); err != nil {
+		return nil, errors.New("fiskaly client ID must be a UUID")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = fiskalyURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Fiskaly{cfg: cfg, client: client}, nil
+}
+
+type fiskalyTx struct {
+	State    string         `json:"state"`
+	ClientID string         `json:"client_id"`
+	Schema   *fiskalySchema `json:"schema,omitempty"`
+	// The fields below are only in responses.
+	Number    int64            `json:"number,omitempty"`
+	TimeEnd   int64            `json:"time_end,omitempty"`
+	Signature fiskalySignature `json:"signature,omitzero"`
+	QRCode    string           `json:"qr_code_data,omitempty"`
+}
+
+type fiskalySchema struct {
+	StandardV1 struct {
+		Receipt fiskalyReceipt `json:"receipt"`
+	} `json:"standard_v1"`
+}
+
+type fiskalyReceipt struct {
+	ReceiptType     string          `json:"receipt_type"`
+	AmountsPerVAT   []fiskalyAmount `json:"amounts_per_vat_rate"`
+	AmountsPerMeans []fiskalyAmount `json:"amounts_per_payment_type"`
+}
+
+type fiskalyAmount struct {
+	VATRate     string `json:"vat_rate,omitempty"`
+	PaymentType string `json:"payment_type,omitempty"`
+	Amount      string `json:"amount"`
+}
+
+type fiskalySignature struct {
+	Value string `json:"value"`
+}
+
+type fiskalyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// fiskalyReceiptOf is the receipt as the DSFinV-K standard_v1 schema has it, negated for a sign of -1.
+// Prices include the normal VAT rate.
+func fiskalyReceiptOf(r *Receipt, receiptType string, sign int64) *fiskalySchema {
+	amount := formatAmount(sign * r.Total)
+	means := "NON_CASH"
+	if r.Cash {
+		means = "CASH"
+	}
+	var s fiskalySchema
+	s.StandardV1.Receipt = fiskalyReceipt{
+		ReceiptType:     receiptType,
+		AmountsPerVAT:   []fiskalyAmount{{VATRate: "NORMAL", Amount: amount}},
+		AmountsPerMeans: []fiskalyAmount{{PaymentType: means, Amount: amount}},
+	}
+	return &s
+}
+
+// formatAmount writes cents as fiskaly expects amounts, e.g. "12.30".
+func formatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Print signs the receipt as a transaction with the purchase's ID. A transaction that was already
+// finished, by an attempt whose answer was lost, is returned as it is.
+func (f *Fiskaly) Print(ctx context.Context, r *Receipt) (Record, error) {
+	return f.sign(ctx, r.ID, fiskalyReceiptOf(r, "RECEIPT", 1))
+}
+
+// Void signs a cancellation of the receipt, with the negated amounts, as its own transaction.
+func (f *Fiskaly) Void(ctx context.Context, r *Receipt) error {
+	_, err := f.sign(ctx, uuid.NewSHA1(r.ID, []byte("void")), fiskalyReceiptOf(r, "CANCELLATION", -1))
+	return err
+}
+
+func (f *Fiskaly) sign(ctx context.Context, txID uuid.UUID, schema *fiskalySchema) (Record, error) {
+	path := "/api/v2/tss/" + f.cfg.TSSID + "/tx/" + txID.String()
+	var tx fiskalyTx
+	status, err := f.do(ctx, http.MethodPut, path+"?tx_revision=1", fiskalyTx{State: "ACTIVE", ClientID: f.cfg.ClientID}, &tx)
+	// A transaction that exists already was started by an earlier attempt.
+	if err != nil && status != http.StatusConflict {
+		return Record{}, err
+	}
+	status, err = f.do(ctx, http.MethodPut, path+"?tx_revision=2", fiskalyTx{State: "FINISHED", ClientID: f.cfg.ClientID, Schema: schema}, &tx)
+	if status == http.StatusConflict {
+		_, err = f.do(ctx, http.MethodGet, path, nil, &tx)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	if tx.State != "FINISHED" {
+		return Record{}, fmt.Errorf("fiskaly transaction %s is %s", txID, tx.State)
+	}
+	return Record{Number: strconv.FormatInt(tx.Number, 10), Signature: tx.Signature.Value, QRCode: tx.QRCode, At: time.Unix(tx.TimeEnd, 0)}, nil
+}
+
+// do sends body, if any, and decodes a successful response into res. It returns the status code even when
+// the request failed, for callers that tell failures apart by it.
+func (f *Fiskaly) do(ctx context.Context, method, path string, body, res any) (int, error) {
+	token, err := f.accessToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return f.send(ctx, method, path, token, body, res)
+}
+
+func (f *Fiskaly) send(ctx context.Context, method, path, token string, body, res any) (int, error) {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode fiskaly request: %w", err)
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, f.cfg.BaseURL+path, payload)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach fiskaly: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e fiskalyError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("fiskaly %s %s: %d %s: %s", method, path, resp.StatusCode, e.Code, e.Message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode fiskaly response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+type fiskalyAuth struct {
+	APIKey      string `json:"api_key,omitempty"`
+	APISecret   string `json:"api_secret,omitempty"`
+	AccessToken string `json:"access_token,omitempty"`
+	ExpiresIn   int64  `json:"access_token_expires_in,omitempty"`
+}
+
+// accessToken is the token fiskaly expects on every request, renewed a minute before it expires.
+func (f *Fiskaly) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Now().Before(f.expires) {
+		return f.token, nil
+	}
+	var res fiskalyAuth
+	if _, err := f.send(ctx, http.MethodPost, "/api/v2/auth", "", fiskalyAuth{APIKey: f.cfg.APIKey, APISecret: f.cfg.APISecret}, &res); err != nil {
+		return "", err
+	}
+	f.token, f.expires = res.AccessToken, time.Now().Add(time.Duration(res.ExpiresIn)*time.Second-time.Minute)
+	return f.token, nil
+}
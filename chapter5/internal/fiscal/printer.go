@@ -0,0 +1,79 @@
+package fiscal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Printer fiscalizes receipts with a country's fiscal device or service, e.g. Fiskaly for Germany's TSE.
+type Printer interface {
+	// Print must be safe to call again for the same receipt ID, returning the same record.
+	Print(ctx context.Context, r *Receipt) (Record, error)
+	// Void cancels a printed receipt, for a purchase that failed after it was printed.
+	Void(ctx context.Context, r *Receipt) error
+}
+
+// MockPrinter numbers receipts and signs them with a hash, without any fiscal authority involved. It is
+// meant for tests and local experiments.
+type MockPrinter struct {
+	mu      sync.Mutex
+	down    error
+	next    int
+	printed map[uuid.UUID]Record
+	voided  map[uuid.UUID]bool
+}
+
+func NewMockPrinter() *MockPrinter {
+	return &MockPrinter{next: 1, printed: map[uuid.UUID]Record{}, voided: map[uuid.UUID]bool{}}
+}
+
+// SetDown makes every call fail with err until it is called with nil.
+func (m *MockPrinter) SetDown(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down = err
+}
+
+func (m *MockPrinter) Print(_ context.Context, r *Receipt) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down != nil {
+		return Record{}, m.down
+	}
+	if rec, ok := m.printed[r.ID]; ok {
+		return rec, nil
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s", r.ID, r.Country, r.Total, r.Currency)))
+	rec := Record{Number: strconv.Itoa(m.next), Signature: hex.EncodeToString(sum[:]), At: time.Now()}
+	m.next++
+	m.printed[r.ID] = rec
+	return rec, nil
+}
+
+func (m *MockPrinter) Void(_ context.Context, r *Receipt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.down != nil {
+		return m.down
+	}
+	if _, ok := m.printed[r.ID]; !ok {
+		return errors.New("receipt was never printed")
+	}
+	m.voided[r.ID] = true
+	return nil
+}
+
+// Voided tells whether the receipt was voided.
+func (m *MockPrinter) Voided(id uuid.UUID) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.voided[id]
+}
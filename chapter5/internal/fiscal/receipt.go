@@ -0,0 +1,124 @@
+package fiscal
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("fiscal receipt not found")
+	ErrConcurrencyConflict = errors.New("fiscal receipt changed since it was read")
+	// ErrNotFiscalized is wrapped with the printer's error when a jurisdiction that blocks on fiscalization
+	// could not fiscalize a purchase, which then is not charged.
+	ErrNotFiscalized = errors.New("purchase could not be fiscalized")
+	ErrNotPending    = errors.New("fiscal receipt is no longer waiting to be printed")
+)
+
+// Status is where a receipt is on its way to the fiscal authority.
+type Status string
+
+const (
+	// StatusPending receipts are stored and wait for their printer.
+	StatusPending    Status = "pending"
+	StatusFiscalized Status = "fiscalized"
+	// StatusFailed receipts could not be printed however often it was tried. They need someone to look
+	// at them, as the law still requires them to be fiscalized.
+	StatusFailed Status = "failed"
+	// StatusCancelled receipts are of purchases that failed before they were printed.
+	StatusCancelled Status = "cancelled"
+	// StatusVoided receipts were printed for purchases that failed afterwards, and cancelled at the printer.
+	StatusVoided Status = "voided"
+)
+
+// Line is an item on a receipt, in the minor unit of the receipt's currency.
+type Line struct {
+	Item   string
+	Amount int64
+}
+
+// Record is what the printer returns for a fiscalized receipt, to be printed on it.
+type Record struct {
+	// Number is the printer's sequence number of the receipt.
+	Number string
+	// Signature is what the fiscal authority checks the receipt against.
+	Signature string
+	// QRCode is the data of the QR code the receipt must carry, where one is required.
+	QRCode string
+	At     time.Time
+}
+
+// Receipt is the receipt of one purchase, identified by the purchase, as it is sent to the fiscal printer of
+// its store's country. It is stored before it is sent, so a receipt is never lost when the printer is down.
+type Receipt struct {
+	ID      uuid.UUID
+	StoreID uuid.UUID
+	// Country is the ISO 3166-1 code of the jurisdiction the receipt is fiscalized in.
+	Country string
+	// Printer is the name of the printer the jurisdiction fiscalizes with.
+	Printer  string
+	Lines    []Line
+	Total    int64
+	Currency string
+	// Cash tells cash purchases apart, which most jurisdictions report separately.
+	Cash        bool
+	PurchasedAt time.Time
+
+	version  int
+	status   Status
+	attempts int
+	// nextAttemptAt is when the receipt may be printed (again). While it is being printed it is when the
+	// attempt is given up on, so a worker that crashed does not keep the receipt forever.
+	nextAttemptAt time.Time
+	lastError     string
+	record        Record
+}
+
+func (r *Receipt) Status() Status {
+	return r.status
+}
+
+// Attempts is how often the receipt was sent to its printer.
+func (r *Receipt) Attempts() int {
+	return r.attempts
+}
+
+// LastError is why the last attempt to print the receipt failed.
+func (r *Receipt) LastError() string {
+	return r.lastError
+}
+
+// Record is what the printer returned, once the receipt is fiscalized.
+func (r *Receipt) Record() Record {
+	return r.record
+}
+
+// claim starts an attempt to print the receipt, which is given up on at until.
+func (r *Receipt) claim(until time.Time) error {
+	if r.status != StatusPending {
+		return fmt.Errorf("%w: %s is %s", ErrNotPending, r.ID, r.status)
+	}
+	r.attempts++
+	r.nextAttemptAt = until.UTC()
+	return nil
+}
+
+func (r *Receipt) fiscalized(rec Record) {
+	r.status = StatusFiscalized
+	rec.At = rec.At.UTC()
+	r.record = rec
+	r.lastError = ""
+}
+
+// retry puts the next attempt off until at.
+func (r *Receipt) retry(reason string, at time.Time) {
+	r.nextAttemptAt = at.UTC()
+	r.lastError = reason
+}
+
+func (r *Receipt) fail(reason string) {
+	r.status = StatusFailed
+	r.lastError = reason
+}
@@ -0,0 +1,252 @@
+package fiscal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if the purchase has no fiscal receipt.
+	Get(ctx context.Context, id uuid.UUID) (*Receipt, error)
+	// Due returns the pending receipts that may be printed at at, oldest purchase first.
+	Due(ctx context.Context, at time.Time) ([]*Receipt, error)
+	// Save returns ErrConcurrencyConflict if the receipt was saved by someone else since it was read, so two
+	// workers never print the same receipt at once.
+	Save(ctx context.Context, r *Receipt) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps receipts versioned.
+type MongoRepository struct {
+	client   *mongo.Client
+	receipts *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	receipts := client.Database("coffeeco").Collection("fiscal_receipts")
+	_, err = receipts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fiscal receipt indexes: %w", err)
+	}
+	return &MongoRepository{client: client, receipts: receipts}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoLine struct {
+	Item   string `bson:"item"`
+	Amount int64  `bson:"amount"`
+}
+
+type mongoReceipt struct {
+	ID            string      `bson:"_id"`
+	Version       int         `bson:"version"`
+	StoreID       string      `bson:"store_id"`
+	Country       string      `bson:"country"`
+	Printer       string      `bson:"printer"`
+	Lines         []mongoLine `bson:"lines"`
+	Total         int64       `bson:"total"`
+	Currency      string      `bson:"currency"`
+	Cash          bool        `bson:"cash,omitempty"`
+	PurchasedAt   time.Time   `bson:"purchased_at"`
+	Status        string      `bson:"status"`
+	Attempts      int         `bson:"attempts"`
+	NextAttemptAt time.Time   `bson:"next_attempt_at"`
+	LastError     string      `bson:"last_error,omitempty"`
+	Number        string      `bson:"number,omitempty"`
+	Signature     string      `bson:"signature,omitempty"`
+	QRCode        string      `bson:"qr_code,omitempty"`
+	FiscalizedAt  time.Time   `bson:"fiscalized_at,omitempty"`
+}
+
+func toMongoReceipt(r *Receipt) mongoReceipt {
+	doc := mongoReceipt{
+		ID:            r.ID.String(),
+		Version:       r.version,
+		StoreID:       r.StoreID.String(),
+		Country:       r.Country,
+		Printer:       r.Printer,
+		Lines:         make([]mongoLine, 0, len(r.Lines)),
+		Total:         r.Total,
+		Currency:      r.Currency,
+		Cash:          r.Cash,
+		PurchasedAt:   r.PurchasedAt,
+		Status:        string(r.status),
+		Attempts:      r.attempts,
+		NextAttemptAt: r.nextAttemptAt,
+		LastError:     r.lastError,
+		Number:        r.record.Number,
+		Signature:     r.record.Signature,
+		QRCode:        r.record.QRCode,
+		FiscalizedAt:  r.record.At,
+	}
+	for _, l := range r.Lines {
+		doc.Lines = append(doc.Lines, mongoLine(l))
+	}
+	return doc
+}
+
+func (m mongoReceipt) toReceipt() *Receipt {
+	r := &Receipt{
+		Country:       m.Country,
+		Printer:       m.Printer,
+		Lines:         make([]Line, 0, len(m.Lines)),
+		Total:         m.Total,
+		Currency:      m.Currency,
+		Cash:          m.Cash,
+		PurchasedAt:   m.PurchasedAt,
+		version:       m.Version,
+		status:        Status(m.Status),
+		attempts:      m.Attempts,
+		nextAttemptAt: m.NextAttemptAt,
+		lastError:     m.LastError,
+		record:        Record{Number: m.Number, Signature: m.Signature, QRCode: m.QRCode, At: m.FiscalizedAt},
+	}
+	for _, l := range m.Lines {
+		r.Lines = append(r.Lines, Line(l))
+	}
+	r.ID, _ = uuid.Parse(m.ID)
+	r.StoreID, _ = uuid.Parse(m.StoreID)
+	return r
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Receipt, err error) {
+	ctx, span := telemetry.StartClient(ctx, "fiscal.MongoRepository.Get", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoReceipt
+	if err := m.receipts.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find fiscal receipt: %w", err)
+	}
+	return doc.toReceipt(), nil
+}
+
+func (m *MongoRepository) Due(ctx context.Context, at time.Time) (_ []*Receipt, err error) {
+	ctx, span := telemetry.StartClient(ctx, "fiscal.MongoRepository.Due")
+	defer telemetry.End(span, &err)
+	cur, err := m.receipts.Find(ctx, bson.D{
+		{Key: "status", Value: string(StatusPending)},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: at}}},
+	}, options.Find().SetSort(bson.D{{Key: "purchased_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find fiscal receipts due: %w", err)
+	}
+	var docs []mongoReceipt
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode fiscal receipts: %w", err)
+	}
+	receipts := make([]*Receipt, 0, len(docs))
+	for _, doc := range docs {
+		receipts = append(receipts, doc.toReceipt())
+	}
+	return receipts, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, r *Receipt) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "fiscal.MongoRepository.Save", attribute.String("purchase.id", r.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoReceipt(r)
+	doc.Version = r.version + 1
+	if r.version == 0 {
+		if _, err := m.receipts.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save fiscal receipt: %w", err)
+		}
+	} else {
+		res, err := m.receipts.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: r.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save fiscal receipt: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	r.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.receipts.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps receipts in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	receipts map[uuid.UUID]mongoReceipt
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{receipts: map[uuid.UUID]mongoReceipt{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.receipts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toReceipt(), nil
+}
+
+func (m *MemoryRepository) Due(_ context.Context, at time.Time) ([]*Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var docs []mongoReceipt
+	for _, doc := range m.receipts {
+		if doc.Status == string(StatusPending) && !doc.NextAttemptAt.After(at) {
+			docs = append(docs, doc)
+		}
+	}
+	slices.SortFunc(docs, func(a, b mongoReceipt) int { return a.PurchasedAt.Compare(b.PurchasedAt) })
+	receipts := make([]*Receipt, 0, len(docs))
+	for _, doc := range docs {
+		receipts = append(receipts, doc.toReceipt())
+	}
+	return receipts, nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, r *Receipt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.receipts[r.ID].Version != r.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoReceipt(r)
+	doc.Version = r.version + 1
+	m.receipts[r.ID] = doc
+	r.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
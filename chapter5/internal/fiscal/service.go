@@ -0,0 +1,282 @@
+package fiscal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/telemetry"
+)
+
+const (
+	// printTimeout bounds a single call to a printer in the background.
+	printTimeout = 30 * time.Second
+	// printLease is how long a claimed receipt is left to its worker. It is longer than printTimeout, so
+	// only a worker that went away loses its receipts to another.
+	printLease = 2 * time.Minute
+)
+
+// Mode is how a jurisdiction fiscalizes purchases.
+type Mode string
+
+const (
+	// ModeBlock prints the receipt before the purchase is charged. A purchase that cannot be fiscalized
+	// fails, as the law of the country does not allow selling without a fiscal receipt.
+	ModeBlock Mode = "block"
+	// ModeAsync stores the receipt and prints it in the background, trying again until the printer takes it.
+	ModeAsync Mode = "async"
+)
+
+// Jurisdiction is how purchases are fiscalized in a country.
+type Jurisdiction struct {
+	// Printer is the name of the printer, as given to WithPrinter, e.g. mock or fiskaly.
+	Printer string `json:"printer"`
+	Mode    Mode   `json:"mode"`
+}
+
+// RetryPolicy says how a receipt that failed to print in the background is tried again: after Backoff,
+// then twice as long after each further failure, until MaxAttempts were made.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+func (r RetryPolicy) delay(attempts int) time.Duration {
+	return r.Backoff << max(attempts-1, 0)
+}
+
+var DefaultRetry = RetryPolicy{MaxAttempts: 10, Backoff: 30 * time.Second}
+
+// ForwardReport is what ForwardDue did.
+type ForwardReport struct {
+	Fiscalized int
+	// Retrying receipts failed to print and are tried again after their backoff.
+	Retrying int
+	// Failed receipts ran out of attempts and need someone to fiscalize them by hand.
+	Failed int
+}
+
+type Service struct {
+	repo          Repository
+	stores        map[uuid.UUID]string
+	jurisdictions map[string]Jurisdiction
+	printers      map[string]Printer
+	retry         RetryPolicy
+	logger        *slog.Logger
+	now           func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithPrinter makes p the printer of the jurisdictions that name it.
+func WithPrinter(name string, p Printer) Option {
+	return func(s *Service) {
+		s.printers[name] = p
+	}
+}
+
+// WithRetry replaces DefaultRetry.
+func WithRetry(r RetryPolicy) Option {
+	return func(s *Service) {
+		s.retry = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when receipts are tried again.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// NewService fiscalizes the purchases of the stores in stores, by the country each is in, as the
+// jurisdiction of the country says. Purchases at other stores are not fiscalized.
+func NewService(repo Repository, stores map[uuid.UUID]string, jurisdictions map[string]Jurisdiction, opts ...Option) *Service {
+	s := &Service{repo: repo, stores: stores, jurisdictions: jurisdictions, printers: map[string]Printer{}, retry: DefaultRetry, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Fiscalize stores the receipt of a purchase about to be charged, for purchase.Service. Jurisdictions
+// that block print it right away and fail with ErrNotFiscalized if the printer does not take it; the others
+// leave it to ForwardDue.
+func (s *Service) Fiscalize(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase) (err error) {
+	country, ok := s.stores[storeID]
+	if !ok {
+		return nil
+	}
+	ctx, span := telemetry.Start(ctx, "fiscal.Service.Fiscalize", attribute.String("store.id", storeID.String()), attribute.String("fiscal.country", country))
+	defer telemetry.End(span, &err)
+	j := s.jurisdictions[country]
+	printer, ok := s.printers[j.Printer]
+	if !ok {
+		return fmt.Errorf("%w: no printer %q for %s", ErrNotFiscalized, j.Printer, country)
+	}
+	total := p.Total()
+	r := &Receipt{
+		ID:          p.ID,
+		StoreID:     storeID,
+		Country:     country,
+		Printer:     j.Printer,
+		Total:       total.Amount(),
+		Currency:    total.Currency().Code,
+		Cash:        p.PaymentMeans == payment.MEANS_CASH,
+		PurchasedAt: p.PurchasedAt().UTC(),
+		status:      StatusPending,
+	}
+	for _, product := range p.ProductsToPurchase {
+		r.Lines = append(r.Lines, Line{Item: product.ItemName, Amount: product.BasePrice.Amount()})
+	}
+	if j.Mode == ModeBlock {
+		// Nobody else sees the receipt before it is saved, so it is claimed for as long as the purchase waits.
+		_ = r.claim(s.now().Add(printLease))
+	} else {
+		r.nextAttemptAt = r.PurchasedAt
+	}
+	if err := s.repo.Save(ctx, r); err != nil {
+		return fmt.Errorf("failed to store fiscal receipt: %w", err)
+	}
+	if j.Mode != ModeBlock {
+		return nil
+	}
+	rec, err := printer.Print(ctx, r)
+	if err != nil {
+		r.status, r.lastError = StatusCancelled, err.Error()
+		if serr := s.repo.Save(context.WithoutCancel(ctx), r); serr != nil {
+			s.logger.ErrorContext(ctx, "fiscal receipt not printed and not cancelled", "purchase", r.ID, "error", serr)
+		}
+		return fmt.Errorf("%w: %w", ErrNotFiscalized, err)
+	}
+	r.fiscalized(rec)
+	if err := s.repo.Save(context.WithoutCancel(ctx), r); err != nil {
+		// The receipt is printed again in the background, which the printer takes as the same receipt.
+		s.logger.ErrorContext(ctx, "fiscal receipt printed but not recorded", "purchase", r.ID, "error", err)
+	}
+	return nil
+}
+
+// Cancel takes back the receipt of a purchase that failed after Fiscalize: one not printed yet is never
+// printed, and one printed is voided at its printer.
+func (s *Service) Cancel(ctx context.Context, purchaseID uuid.UUID) error {
+	r, err := s.repo.Get(ctx, purchaseID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch r.status {
+	case StatusPending, StatusFailed:
+		r.status = StatusCancelled
+	case StatusFiscalized:
+		printer, ok := s.printers[r.Printer]
+		if !ok {
+			return fmt.Errorf("no printer %q to void fiscal receipt %s", r.Printer, r.ID)
+		}
+		if err := printer.Void(ctx, r); err != nil {
+			return fmt.Errorf("failed to void fiscal receipt: %w", err)
+		}
+		r.status = StatusVoided
+	default:
+		return nil
+	}
+	return s.repo.Save(ctx, r)
+}
+
+func (s *Service) Get(ctx context.Context, purchaseID uuid.UUID) (*Receipt, error) {
+	return s.repo.Get(ctx, purchaseID)
+}
+
+// ForwardDue prints every receipt waiting for its printer. Any number of instances can run it at once: a
+// receipt is claimed before it is printed, so only one of them prints it.
+func (s *Service) ForwardDue(ctx context.Context) (ForwardReport, error) {
+	due, err := s.repo.Due(ctx, s.now())
+	if err != nil {
+		return ForwardReport{}, err
+	}
+	var report ForwardReport
+	for _, r := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		switch s.forward(ctx, r) {
+		case StatusFiscalized:
+			report.Fiscalized++
+		case StatusPending:
+			report.Retrying++
+		case StatusFailed:
+			report.Failed++
+		}
+	}
+	return report, ctx.Err()
+}
+
+// forward claims r, prints it and returns where it is now, or "" if another worker has it.
+func (s *Service) forward(ctx context.Context, r *Receipt) Status {
+	printer, ok := s.printers[r.Printer]
+	if !ok {
+		s.logger.WarnContext(ctx, "fiscal receipt due on a printer that is not configured", "purchase", r.ID, "printer", r.Printer)
+		return ""
+	}
+	if err := r.claim(s.now().Add(printLease)); err != nil {
+		return ""
+	}
+	if err := s.repo.Save(ctx, r); err != nil {
+		if !errors.Is(err, ErrConcurrencyConflict) {
+			s.logger.ErrorContext(ctx, "fiscal receipt not claimed", "purchase", r.ID, "error", err)
+		}
+		return ""
+	}
+	printCtx, cancel := context.WithTimeout(ctx, printTimeout)
+	rec, err := printer.Print(printCtx, r)
+	cancel()
+	switch {
+	case err == nil:
+		r.fiscalized(rec)
+	case r.attempts >= s.retry.MaxAttempts:
+		r.fail(err.Error())
+		s.logger.ErrorContext(ctx, "fiscal receipt could not be printed, fiscalize it by hand", "purchase", r.ID, "country", r.Country, "attempts", r.attempts, "error", err)
+	default:
+		r.retry(err.Error(), s.now().Add(s.retry.delay(r.attempts)))
+	}
+	if err := s.repo.Save(context.WithoutCancel(ctx), r); err != nil {
+		// The claim lapses and the receipt is printed again, which the printer takes as the same receipt.
+		s.logger.ErrorContext(ctx, "fiscal receipt attempt not recorded", "purchase", r.ID, "error", err)
+	}
+	return r.status
+}
+
+// Run forwards the receipts that are due every interval until ctx is done.
+func (s *Service) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		report, err := s.ForwardDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "fiscal receipts due not forwarded", "error", err)
+		}
+		if report.Fiscalized+report.Retrying+report.Failed > 0 {
+			s.logger.InfoContext(ctx, "fiscal receipts forwarded", "fiscalized", report.Fiscalized, "retrying", report.Retrying, "failed", report.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type PingFunc func(ctx context.Context) error
+
+func (f PingFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded means only optional dependencies are failing; the service still takes traffic.
+	StatusDegraded    Status = "degraded"
+	StatusUnavailable Status = "unavailable"
+	StatusFailed      Status = "failed"
+)
+
+type CheckResult struct {
+	Status    Status `json:"status"`
+	Optional  bool   `json:"optional,omitempty"`
+	LatencyMS int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name     string
+	pinger   Pinger
+	optional bool
+}
+
+// Checker checks the dependencies of a service. A failing required dependency makes the service not
+// ready; a failing optional one, e.g. the payment gateway when cash still works, only degrades it.
+type Checker struct {
+	// Timeout bounds every check. Checks run concurrently, so it also bounds a whole report.
+	Timeout  time.Duration
+	checks   []check
+	draining atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{Timeout: defaultTimeout}
+}
+
+func (c *Checker) Require(name string, p Pinger) {
+	c.checks = append(c.checks, check{name: name, pinger: p})
+}
+
+func (c *Checker) Optional(name string, p Pinger) {
+	c.checks = append(c.checks, check{name: name, pinger: p, optional: true})
+}
+
+// Check pings every dependency at once.
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, chk := range c.checks {
+		wg.Add(1)
+		go func(i int, chk check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+			start := time.Now()
+			err := chk.pinger.Ping(ctx)
+			results[i] = CheckResult{Status: StatusOK, Optional: chk.optional, LatencyMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusFailed, err.Error()
+			}
+		}(i, chk)
+	}
+	wg.Wait()
+
+	r := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(c.checks))}
+	for i, chk := range c.checks {
+		res := results[i]
+		r.Checks[chk.name] = res
+		switch {
+		case res.Status == StatusOK:
+		case chk.optional && r.Status == StatusOK:
+			r.Status = StatusDegraded
+		case !chk.optional:
+			r.Status = StatusUnavailable
+		}
+	}
+	return r
+}
+
+// Liveness serves /healthz. It only says the process is up and serving, so a database outage does not get
+// every instance restarted.
+func (c *Checker) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: StatusOK})
+	})
+}
+
+// Drain makes the service not ready for good, so load balancers stop sending it traffic while it shuts down.
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Readiness serves /readyz. It checks the dependencies and answers 503 while a required one is failing,
+// so traffic goes to other instances until it recovers, and from the moment the service starts draining.
+func (c *Checker) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.draining.Load() {
+			writeReport(w, Report{Status: StatusUnavailable})
+			return
+		}
+		writeReport(w, c.Check(r.Context()))
+	})
+}
+
+func writeReport(w http.ResponseWriter, r Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Status == StatusUnavailable {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(r)
+}
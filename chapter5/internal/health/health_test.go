@@ -0,0 +1,82 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"coffeeco/internal/health"
+)
+
+var (
+	up   = health.PingFunc(func(context.Context) error { return nil })
+	down = health.PingFunc(func(context.Context) error { return errors.New("connection refused") })
+)
+
+func Test_ReadinessReportsEveryDependency(t *testing.T) {
+	tests := map[string]struct {
+		mongo, stripe health.Pinger
+		status        health.Status
+		code          int
+	}{
+		"all up":            {up, up, health.StatusOK, http.StatusOK},
+		"optional down":     {up, down, health.StatusDegraded, http.StatusOK},
+		"required down":     {down, up, health.StatusUnavailable, http.StatusServiceUnavailable},
+		"everything failed": {down, down, health.StatusUnavailable, http.StatusServiceUnavailable},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := health.NewChecker()
+			c.Require("mongo", tc.mongo)
+			c.Optional("stripe", tc.stripe)
+
+			rec := httptest.NewRecorder()
+			c.Readiness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			var r health.Report
+			if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if rec.Code != tc.code || r.Status != tc.status || len(r.Checks) != 2 {
+				t.Fatalf("expected %d %s with 2 checks but got %d %+v", tc.code, tc.status, rec.Code, r)
+			}
+		})
+	}
+}
+
+func Test_ChecksTimeOut(t *testing.T) {
+	c := health.NewChecker()
+	c.Timeout = 10 * time.Millisecond
+	c.Require("slow", health.PingFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	if r := c.Check(context.Background()); r.Status != health.StatusUnavailable || r.Checks["slow"].Error == "" {
+		t.Fatalf("expected the slow dependency to fail but got %+v", r)
+	}
+}
+
+func Test_LivenessDoesNotCheckDependencies(t *testing.T) {
+	c := health.NewChecker()
+	c.Require("mongo", down)
+	rec := httptest.NewRecorder()
+	c.Liveness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", rec.Code)
+	}
+}
+
+func Test_DrainingServicesAreNotReady(t *testing.T) {
+	c := health.NewChecker()
+	c.Require("mongo", up)
+	c.Drain()
+
+	rec := httptest.NewRecorder()
+	c.Readiness().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package history_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/history"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// entries is a purchase history, newest first.
+type entries []projection.HistoryEntry
+
+func (e entries) ForCustomer(_ context.Context, customerID uuid.UUID, limit int64) ([]projection.HistoryEntry, error) {
+	var res []projection.HistoryEntry
+	for _, entry := range e {
+		if entry.CustomerID == customerID.String() && int64(len(res)) < limit {
+			res = append(res, entry)
+		}
+	}
+	return res, nil
+}
+
+func Test_FavoritesAreTheCombinationsBoughtMostOften(t *testing.T) {
+	alice, soho := uuid.New(), uuid.New()
+	at := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	var bought entries
+	buy := func(items ...string) uuid.UUID {
+		id := uuid.New()
+		at = at.Add(-time.Hour)
+		bought = append(bought, projection.HistoryEntry{PurchaseID: id.String(), CustomerID: alice.String(), StoreID: soho.String(), Items: items, PurchasedAt: at})
+		return id
+	}
+	lastBreakfast := buy("latte", "croissant")
+	lastFlatWhite := buy("flat white")
+	buy("croissant", "latte")
+	buy("flat white")
+	buy("mocha")
+	buy("latte", "croissant")
+	bought = append(bought, projection.HistoryEntry{PurchaseID: uuid.NewString(), CustomerID: uuid.NewString(), Items: []string{"mocha"}})
+	svc := history.NewService(bought, pricing.NewEngine(pricing.Rules{}), inventory.NewService(inventory.NewMemoryRepo(), nil))
+
+	favorites, err := svc.Favorites(context.Background(), alice, 5)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(favorites) != 2 {
+		t.Fatalf("expected the 2 combinations bought more than once but got %+v", favorites)
+	}
+	if got := favorites[0]; !slices.Equal(got.Items, []string{"croissant", "latte"}) || got.Count != 3 || got.LastPurchaseID != lastBreakfast || got.LastStoreID != soho {
+		t.Fatalf("expected a croissant and a latte 3 times, last in %s, but got %+v", lastBreakfast, got)
+	}
+	if got := favorites[1]; !slices.Equal(got.Items, []string{"flat white"}) || got.Count != 2 || got.LastPurchaseID != lastFlatWhite {
+		t.Fatalf("expected a flat white twice but got %+v", got)
+	}
+	if favorites, _ := svc.Favorites(context.Background(), alice, 1); len(favorites) != 1 {
+		t.Fatalf("expected only the favorite asked for but got %+v", favorites)
+	}
+}
+
+func Test_AReorderIsPricedNowWithWhatTheStoreCanMake(t *testing.T) {
+	ctx := context.Background()
+	alice, soho, camden := uuid.New(), uuid.New(), uuid.New()
+	prices := pricing.NewEngine(pricing.Rules{
+		Currency:    "USD",
+		BasePrices:  map[string]int64{"latte": 400, "croissant": 300},
+		StorePrices: map[uuid.UUID]map[string]int64{camden: {"croissant": 350}},
+		Sizes:       map[string]int64{"large": 60},
+		Modifiers:   map[string]int64{"oat milk": 60},
+	})
+	stock := inventory.NewService(inventory.NewMemoryRepo(), inventory.Recipes{"latte": {"milk_ml": 200}})
+	for st, milk := range map[uuid.UUID]int64{soho: 200, camden: 100} {
+		if err := stock.Restock(ctx, st, "milk_ml", milk); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	svc := history.NewService(entries{}, prices, stock)
+	past := purchase.Purchase{
+		Store:      store.Ref(soho),
+		CustomerID: alice,
+		ProductsToPurchase: []coffeeco.Product{
+			{ItemName: "latte", Size: "large", Modifiers: []string{"oat milk"}},
+			{ItemName: "croissant"},
+			{ItemName: "muffin"},
+			{ItemName: "muffin"},
+		},
+	}
+
+	r, err := svc.Reorder(ctx, past, uuid.Nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	p := r.Purchase
+	if p.Store.ID != soho || p.CustomerID != alice || len(p.ProductsToPurchase) != 2 {
+		t.Fatalf("expected alice's latte and croissant at soho but got %+v", p)
+	}
+	if latte := p.ProductsToPurchase[0]; latte.BasePrice.Amount() != 520 || latte.Size != "large" || !slices.Equal(latte.Modifiers, []string{"oat milk"}) {
+		t.Fatalf("expected a large oat latte at 5.20 but got %+v", latte)
+	}
+	if !slices.Equal(r.Unavailable, []string{"muffin"}) {
+		t.Fatalf("expected the muffins to be left out once but got %v", r.Unavailable)
+	}
+
+	r, err = svc.Reorder(ctx, past, camden)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(r.Purchase.ProductsToPurchase) != 1 || r.Purchase.ProductsToPurchase[0].BasePrice.Amount() != 350 || !slices.Equal(r.Unavailable, []string{"latte", "muffin"}) {
+		t.Fatalf("expected only the croissant at camden's price, without milk for the latte, but got %+v, %v", r.Purchase.ProductsToPurchase, r.Unavailable)
+	}
+
+	past.ProductsToPurchase = past.ProductsToPurchase[2:]
+	if _, err := svc.Reorder(ctx, past, uuid.Nil); !errors.Is(err, history.ErrNothingAvailable) {
+		t.Fatalf("expected ErrNothingAvailable but got %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package history
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// favoritesWindow is how many of a customer's latest purchases favorites are derived from, so tastes that
+// changed long ago do not linger.
+const favoritesWindow = 100
+
+var ErrNothingAvailable = errors.New("nothing of the purchase can be ordered at the store now")
+
+// Entries are the customers' past purchases, newest first, e.g. projection.CustomerHistory.
+type Entries interface {
+	ForCustomer(ctx context.Context, customerID uuid.UUID, limit int64) ([]projection.HistoryEntry, error)
+}
+
+// Prices is the price book reorders are priced from, e.g. pricing.Engine.
+type Prices interface {
+	Products(storeID uuid.UUID) []string
+	Quote(ctx context.Context, r pricing.Request) (pricing.Quote, error)
+}
+
+// Stock tells which products a store can make, e.g. inventory.Service.
+type Stock interface {
+	InStock(ctx context.Context, storeID uuid.UUID, products []string) (map[string]bool, error)
+}
+
+// Favorite is a combination of items a customer bought more than once.
+type Favorite struct {
+	// Items are the names of the items, in alphabetical order, once per item bought.
+	Items []string
+	Count int
+	// LastPurchaseID is the latest purchase of the combination, to reorder it.
+	LastPurchaseID  uuid.UUID
+	LastStoreID     uuid.UUID
+	LastPurchasedAt time.Time
+}
+
+// Reorder is a past purchase rebuilt to be completed again.
+type Reorder struct {
+	// Purchase has the products of the past purchase the store can make now, at their current prices, for the
+	// same customer. It still needs a payment means.
+	Purchase *purchase.Purchase
+	// Unavailable are the products of the past purchase left out, as the store no longer sells them or is
+	// out of what it takes to make them.
+	Unavailable []string
+}
+
+type Service struct {
+	entries Entries
+	prices  Prices
+	stock   Stock
+	now     func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithClock replaces time.Now, e.g. to test reorders during a happy hour.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(entries Entries, prices Prices, stock Stock, opts ...Option) *Service {
+	s := &Service{entries: entries, prices: prices, stock: stock, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Purchases are the customer's latest purchases, newest first, at most limit of them.
+func (s *Service) Purchases(ctx context.Context, customerID uuid.UUID, limit int) ([]projection.HistoryEntry, error) {
+	return s.entries.ForCustomer(ctx, customerID, int64(limit))
+}
+
+// Favorites are the combinations of items the customer bought most often among their latest purchases, at
+// most n of them. Combinations bought once are not favorites; ties go to the one bought last.
+func (s *Service) Favorites(ctx context.Context, customerID uuid.UUID, n int) ([]Favorite, error) {
+	entries, err := s.entries.ForCustomer(ctx, customerID, favoritesWindow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get purchase history: %w", err)
+	}
+	byItems := map[string]*Favorite{}
+	var favorites []*Favorite
+	for _, e := range entries {
+		if len(e.Items) == 0 {
+			continue
+		}
+		items := slices.Sorted(slices.Values(e.Items))
+		key := strings.Join(items, "\x00")
+		f, ok := byItems[key]
+		if !ok {
+			// Entries are newest first, so the first one seen is the latest.
+			f = &Favorite{Items: items, LastPurchasedAt: e.PurchasedAt}
+			f.LastPurchaseID, _ = uuid.Parse(e.PurchaseID)
+			f.LastStoreID, _ = uuid.Parse(e.StoreID)
+			byItems[key] = f
+			favorites = append(favorites, f)
+		}
+		f.Count++
+	}
+	slices.SortStableFunc(favorites, func(a, b *Favorite) int {
+		return cmp.Compare(b.Count, a.Count)
+	})
+	res := make([]Favorite, 0, n)
+	for _, f := range favorites {
+		if f.Count < 2 || len(res) == n {
+			break
+		}
+		res = append(res, *f)
+	}
+	return res, nil
+}
+
+// Reorder rebuilds a past purchase to be made at storeID, or where it was made for uuid.Nil: with the products
+// the store sells and can make now, priced as they would be rung up now. Sizes, modifiers and reusable cups
+// are kept; the delivery and the payment are not.
+func (s *Service) Reorder(ctx context.Context, past purchase.Purchase, storeID uuid.UUID) (*Reorder, error) {
+	if storeID == uuid.Nil {
+		storeID = past.Store.ID
+	}
+	names := make([]string, 0, len(past.ProductsToPurchase))
+	for _, p := range past.ProductsToPurchase {
+		names = append(names, p.ItemName)
+	}
+	inStock, err := s.stock.InStock(ctx, storeID, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check stock: %w", err)
+	}
+	menu := s.prices.Products(storeID)
+	r := &Reorder{Purchase: &purchase.Purchase{Store: store.Ref(storeID), CustomerID: past.CustomerID}}
+	req := pricing.Request{StoreID: storeID, CustomerID: past.CustomerID, At: s.now()}
+	var kept []coffeeco.Product
+	for _, p := range past.ProductsToPurchase {
+		if !slices.Contains(menu, p.ItemName) || !inStock[p.ItemName] {
+			if !slices.Contains(r.Unavailable, p.ItemName) {
+				r.Unavailable = append(r.Unavailable, p.ItemName)
+			}
+			continue
+		}
+		kept = append(kept, p)
+		req.Items = append(req.Items, pricing.Item{Product: p.ItemName, Size: p.Size, Modifiers: slices.Clone(p.Modifiers), ReusableCup: p.ReusableCup})
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNothingAvailable, strings.Join(r.Unavailable, ", "))
+	}
+	q, err := s.prices.Quote(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price reorder: %w", err)
+	}
+	for i, p := range kept {
+		r.Purchase.ProductsToPurchase = append(r.Purchase.ProductsToPurchase, coffeeco.Product{
+			ItemName:    p.ItemName,
+			BasePrice:   q.Lines[i].Unit,
+			Size:        p.Size,
+			Modifiers:   slices.Clone(p.Modifiers),
+			ReusableCup: p.ReusableCup,
+		})
+	}
+	return r, nil
+}
@@ -0,0 +1,234 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/moneyfmt"
+)
+
+// ProductText is how a product is shown to customers in a language.
+type ProductText struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Catalog is what customers read in other languages than the English products and messages are written
+// in. Languages are BCP 47 tags, e.g. "de" or "de-CH"; text missing in a tag is looked up in its language,
+// then in English.
+type Catalog struct {
+	// Products are the names and descriptions of products, by product then language, e.g.
+	// {"latte": {"de": {"name": "Milchkaffee"}}}. A product without a name in a language keeps its own.
+	Products map[string]map[string]ProductText `json:"products,omitempty"`
+	// Messages replace or add to DefaultMessages, by language then key.
+	Messages map[string]map[string]string `json:"messages,omitempty"`
+}
+
+// DefaultMessages are the fmt formats of what receipts print besides products and amounts, by language
+// then key. Payment means are under "means." and their name, and the sentences of plain text receipts under
+// "receipt.plain.", see receipt.Render.
+var DefaultMessages = map[string]map[string]string{
+	"en": {
+		"receipt.gift":              "GIFT RECEIPT",
+		"receipt.code":              "Receipt %s",
+		"receipt.total":             "Total",
+		"receipt.paid_with":         "Paid with %s",
+		"receipt.rounding":          "rounding",
+		"receipt.return_code":       "Return code",
+		"receipt.plain.intro":       "CoffeeCo receipt for your purchase on %s.",
+		"receipt.plain.gift":        "This is a gift receipt, so it has no prices.",
+		"receipt.plain.code":        "Receipt number %s.",
+		"receipt.plain.line":        "%d %s, %s.",
+		"receipt.plain.gift_line":   "%d %s.",
+		"receipt.plain.total":       "Total %s, paid with %s.",
+		"receipt.plain.return_code": "Return code %s.",
+	},
+	"de": {
+		"receipt.gift":              "GESCHENKBELEG",
+		"receipt.code":              "Beleg %s",
+		"receipt.total":             "Summe",
+		"receipt.paid_with":         "Bezahlt mit %s",
+		"receipt.rounding":          "Rundung",
+		"receipt.return_code":       "Rückgabecode",
+		"receipt.plain.intro":       "CoffeeCo-Beleg für Ihren Einkauf am %s.",
+		"receipt.plain.gift":        "Dies ist ein Geschenkbeleg, daher ohne Preise.",
+		"receipt.plain.code":        "Belegnummer %s.",
+		"receipt.plain.line":        "%d %s, %s.",
+		"receipt.plain.gift_line":   "%d %s.",
+		"receipt.plain.total":       "Summe %s, bezahlt mit %s.",
+		"receipt.plain.return_code": "Rückgabecode %s.",
+		"means.card":                "Karte",
+		"means.cash":                "Bargeld",
+		"means.wallet":              "Guthaben",
+	},
+	"fr": {
+		"receipt.gift":              "TICKET CADEAU",
+		"receipt.code":              "Ticket %s",
+		"receipt.total":             "Total",
+		"receipt.paid_with":         "Payé par %s",
+		"receipt.rounding":          "arrondi",
+		"receipt.return_code":       "Code de retour",
+		"receipt.plain.intro":       "Ticket CoffeeCo de votre achat du %s.",
+		"receipt.plain.gift":        "Ceci est un ticket cadeau, sans prix.",
+		"receipt.plain.code":        "Ticket numéro %s.",
+		"receipt.plain.line":        "%d %s, %s.",
+		"receipt.plain.gift_line":   "%d %s.",
+		"receipt.plain.total":       "Total %s, payé par %s.",
+		"receipt.plain.return_code": "Code de retour %s.",
+		"means.card":                "carte",
+		"means.cash":                "espèces",
+		"means.wallet":              "porte-monnaie",
+	},
+	"es": {
+		"receipt.gift":              "TIQUE REGALO",
+		"receipt.code":              "Tique %s",
+		"receipt.total":             "Total",
+		"receipt.paid_with":         "Pagado con %s",
+		"receipt.rounding":          "redondeo",
+		"receipt.return_code":       "Código de devolución",
+		"receipt.plain.intro":       "Tique de CoffeeCo de su compra del %s.",
+		"receipt.plain.gift":        "Este es un tique regalo, sin precios.",
+		"receipt.plain.code":        "Tique número %s.",
+		"receipt.plain.line":        "%d %s, %s.",
+		"receipt.plain.gift_line":   "%d %s.",
+		"receipt.plain.total":       "Total %s, pagado con %s.",
+		"receipt.plain.return_code": "Código de devolución %s.",
+		"means.card":                "tarjeta",
+		"means.cash":                "efectivo",
+		"means.wallet":              "monedero",
+	},
+}
+
+// dateTimes are how each locale of moneyfmt.Locales writes a date and time.
+var dateTimes = map[string]string{
+	"en-US": "01/02/2006 3:04 PM",
+	"en-GB": "02/01/2006 15:04",
+	"en-IE": "02/01/2006 15:04",
+	"de-DE": "02.01.2006 15:04",
+	"fr-FR": "02/01/2006 15:04",
+	"es-ES": "02/01/2006 15:04",
+	"it-IT": "02/01/2006 15:04",
+	"nl-NL": "02-01-2006 15:04",
+	"de-CH": "02.01.2006 15:04",
+	"ja-JP": "2006/01/02 15:04",
+}
+
+// Printer writes what customers read in a locale. The zero Printer writes English, amounts the way each
+// currency does and products by their own names.
+type Printer struct {
+	// Tag is the BCP 47 tag of the locale, e.g. "de-CH"; empty for English.
+	Tag string
+	// Money is how amounts are written.
+	Money moneyfmt.Locale
+
+	catalog *Catalog
+}
+
+// In is the printer of tag with c. Amounts and times are written as the locale of tag in moneyfmt.Locales
+// does, or its language's; a tag in a language without one writes them the zero Printer's way.
+func In(tag string, c *Catalog) Printer {
+	loc, _ := moneyfmt.LocaleFor(tag)
+	return Printer{Tag: tag, Money: loc, catalog: c}
+}
+
+// languages are where text is looked up, e.g. "de-CH", "de" and "en".
+func (p Printer) languages() []string {
+	lang, _, _ := strings.Cut(p.Tag, "-")
+	return []string{p.Tag, strings.ToLower(lang), "en"}
+}
+
+// Text formats the message of key with args. A key without a message in the language is written as the
+// English one, and a key without one at all as the key itself.
+func (p Printer) Text(key string, args ...any) string {
+	m, ok := p.message(key)
+	if !ok {
+		return key
+	}
+	return fmt.Sprintf(m, args...)
+}
+
+// Means is the name of a payment means, e.g. "Karte" for card in German.
+func (p Printer) Means(means string) string {
+	if m, ok := p.message("means." + means); ok {
+		return m
+	}
+	return means
+}
+
+func (p Printer) message(key string) (string, bool) {
+	for _, lang := range p.languages() {
+		if p.catalog != nil {
+			if m, ok := p.catalog.Messages[lang][key]; ok {
+				return m, true
+			}
+		}
+		if m, ok := DefaultMessages[lang][key]; ok {
+			return m, true
+		}
+	}
+	return "", false
+}
+
+// Product is how the product called name is shown: its name and description in the language, or else its
+// own name.
+func (p Printer) Product(name string) ProductText {
+	if p.catalog != nil {
+		texts := p.catalog.Products[name]
+		for _, lang := range p.languages() {
+			if t, ok := texts[lang]; ok && t.Name != "" {
+				return t
+			}
+		}
+	}
+	return ProductText{Name: name}
+}
+
+// Amount writes amount, in the minor unit of currency, as the locale does.
+func (p Printer) Amount(amount int64, currency string) string {
+	return moneyfmt.Format(amount, currency, p.Money)
+}
+
+// DateTime writes t as the locale does. Printers without a locale use fallback, so what they print does not
+// change with localization.
+func (p Printer) DateTime(t time.Time, fallback string) string {
+	if layout, ok := dateTimes[p.Money.Tag]; ok {
+		return t.Format(layout)
+	}
+	return t.Format(fallback)
+}
+
+// Localizer tells the locale of each store, for what is printed about its purchases.
+type Localizer struct {
+	catalog Catalog
+	stores  map[uuid.UUID]string
+	tag     string
+}
+
+// NewLocalizer localizes with c the stores, by their BCP 47 tag. Stores without one are in tag, which may
+// be empty for English.
+func NewLocalizer(c Catalog, stores map[uuid.UUID]string, tag string) *Localizer {
+	return &Localizer{catalog: c, stores: stores, tag: tag}
+}
+
+// For is the printer of the store's locale. A nil Localizer is the zero Printer's.
+func (l *Localizer) For(storeID uuid.UUID) Printer {
+	if l == nil {
+		return Printer{}
+	}
+	tag, ok := l.stores[storeID]
+	if !ok {
+		tag = l.tag
+	}
+	return In(tag, &l.catalog)
+}
+
+// In is the printer of tag, e.g. a customer's Accept-Language, with the localizer's catalog.
+func (l *Localizer) In(tag string) Printer {
+	if l == nil {
+		return Printer{}
+	}
+	return In(tag, &l.catalog)
+}
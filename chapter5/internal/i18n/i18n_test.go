@@ -0,0 +1,55 @@
+package i18n_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/i18n"
+)
+
+func Test_PrintersFallBackToTheLanguageThenEnglish(t *testing.T) {
+	vienna, dublin := uuid.New(), uuid.New()
+	catalog := i18n.Catalog{
+		Products: map[string]map[string]i18n.ProductText{
+			"latte": {"de": {Name: "Milchkaffee", Description: "Espresso mit viel heißer Milch"}, "de-AT": {Name: "Melange"}},
+		},
+		Messages: map[string]map[string]string{"de-AT": {"receipt.total": "Gesamt"}},
+	}
+	l := i18n.NewLocalizer(catalog, map[uuid.UUID]string{vienna: "de-AT"}, "en-IE")
+
+	at := l.For(vienna)
+	if got := at.Product("latte"); got.Name != "Melange" || got.Description != "" {
+		t.Fatalf("expected the Austrian name of a latte but got %+v", got)
+	}
+	if got := l.In("de-CH").Product("latte"); got.Name != "Milchkaffee" || got.Description == "" {
+		t.Fatalf("expected the German name and description of a latte but got %+v", got)
+	}
+	if got := at.Product("croissant"); got.Name != "croissant" {
+		t.Fatalf("expected a product without a German name to keep its own but got %+v", got)
+	}
+	if total, gift := at.Text("receipt.total"), at.Text("receipt.gift"); total != "Gesamt" || gift != "GESCHENKBELEG" {
+		t.Fatalf("expected the catalog's message over the German one but got %q and %q", total, gift)
+	}
+	if got := at.Text("receipt.missing"); got != "receipt.missing" {
+		t.Fatalf("expected an unknown key written as is but got %q", got)
+	}
+	if got := at.Amount(123450, "EUR"); got != "1.234,50 €" {
+		t.Fatalf("expected the amount written the German way but got %q", got)
+	}
+
+	ie := l.For(dublin)
+	if got := ie.Means("card"); got != "card" {
+		t.Fatalf("expected stores without a locale in the localizer's but got %q", got)
+	}
+	noon := time.Date(2024, 3, 1, 12, 5, 0, 0, time.UTC)
+	if got := ie.DateTime(noon, time.RFC3339); got != "01/03/2024 12:05" {
+		t.Fatalf("expected the Irish way of writing dates but got %q", got)
+	}
+
+	var none *i18n.Localizer
+	if got := none.For(vienna); got.Product("latte").Name != "latte" || got.DateTime(noon, time.RFC3339) != "2024-03-01T12:05:00Z" {
+		t.Fatalf("expected a nil localizer to write English with the fallback layout but got %+v", got)
+	}
+}
@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxLineBytes = 1 << 20
+
+// invalidRecordError is a record that could not be read. It fails on its own; the records after it are
+// still read.
+type invalidRecordError struct {
+	err error
+}
+
+func (e *invalidRecordError) Error() string {
+	return e.err.Error()
+}
+
+// ndjsonReader reads one Record per line. Blank lines are not records.
+func ndjsonReader(r io.Reader) func() (Record, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	return func() (Record, error) {
+		for sc.Scan() {
+			line := bytes.TrimSpace(sc.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var rec Record
+			if err := json.Unmarshal(line, &rec); err != nil {
+				return rec, &invalidRecordError{fmt.Errorf("invalid JSON: %w", err)}
+			}
+			return rec, nil
+		}
+		if err := sc.Err(); err != nil {
+			return Record{}, err
+		}
+		return Record{}, io.EOF
+	}
+}
+
+// csvColumns are the columns a CSV import needs, in any order. Items are "name=amount" pairs separated by
+// semicolons, all in the row's currency, e.g. "latte=400;flat white=350".
+var csvColumns = []string{"id", "store_id", "customer_id", "purchased_at", "payment_means", "currency", "items"}
+
+func csvReader(r io.Reader) (func() (Record, error), error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	col := map[string]int{}
+	for i, name := range header {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+
+	return func() (Record, error) {
+		row, err := cr.Read()
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return Record{}, &invalidRecordError{err}
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		rec := Record{
+			ID:           row[col["id"]],
+			StoreID:      row[col["store_id"]],
+			CustomerID:   row[col["customer_id"]],
+			PaymentMeans: row[col["payment_means"]],
+		}
+		if rec.PurchasedAt, err = time.Parse(time.RFC3339, row[col["purchased_at"]]); err != nil {
+			return rec, &invalidRecordError{errors.New("purchased_at must be an RFC 3339 time")}
+		}
+		currency := row[col["currency"]]
+		for _, pair := range strings.Split(row[col["items"]], ";") {
+			name, amount, ok := strings.Cut(pair, "=")
+			n, err := strconv.ParseInt(strings.TrimSpace(amount), 10, 64)
+			if !ok || err != nil {
+				return rec, &invalidRecordError{fmt.Errorf("item %q must be name=amount", pair)}
+			}
+			rec.Items = append(rec.Items, Item{Name: strings.TrimSpace(name), Amount: n, Currency: currency})
+		}
+		return rec, nil
+	}, nil
+}
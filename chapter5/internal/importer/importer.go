@@ -0,0 +1,155 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+)
+
+var ErrUnknownFormat = errors.New("format must be ndjson or csv")
+
+// Record is one historical purchase as exported by the system being migrated from.
+type Record struct {
+	ID           string    `json:"id"`
+	StoreID      string    `json:"storeId"`
+	CustomerID   string    `json:"customerId,omitempty"`
+	PurchasedAt  time.Time `json:"purchasedAt"`
+	PaymentMeans string    `json:"paymentMeans"`
+	Items        []Item    `json:"items"`
+}
+
+type Item struct {
+	Name     string `json:"name"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+type Status string
+
+const (
+	StatusImported Status = "imported"
+	// StatusSkipped is a record that was imported before.
+	StatusSkipped Status = "skipped"
+	StatusFailed  Status = "failed"
+)
+
+// Result is what happened to one record. Records are numbered from 1 in the order they were read.
+type Result struct {
+	Record     int    `json:"record"`
+	PurchaseID string `json:"purchaseId,omitempty"`
+	Status     Status `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+type Summary struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+type PurchaseImporter interface {
+	ImportPurchase(ctx context.Context, id uuid.UUID, purchasedAt time.Time, p *purchase.Purchase) error
+}
+
+// Import reads records from r and imports them one by one, passing every result to emit as soon as it is
+// known. Records before from are not looked at, so a long import that was interrupted can carry on where
+// it stopped; running it again from the start is safe too, as records imported before are skipped.
+// A record that cannot be read or imported fails on its own; only errors reading r or from emit stop the
+// import.
+func Import(ctx context.Context, svc PurchaseImporter, r io.Reader, format Format, from int, emit func(Result) error) (Summary, error) {
+	var next func() (Record, error)
+	switch format {
+	case FormatNDJSON:
+		next = ndjsonReader(r)
+	case FormatCSV:
+		var err error
+		if next, err = csvReader(r); err != nil {
+			return Summary{}, err
+		}
+	default:
+		return Summary{}, ErrUnknownFormat
+	}
+
+	var sum Summary
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return sum, err
+		}
+		rec, err := next()
+		if errors.Is(err, io.EOF) {
+			return sum, nil
+		}
+		var invalid *invalidRecordError
+		if err != nil && !errors.As(err, &invalid) {
+			return sum, fmt.Errorf("failed to read record %d: %w", n, err)
+		}
+		if n < from {
+			continue
+		}
+
+		res := Result{Record: n, PurchaseID: rec.ID, Status: StatusImported}
+		if err == nil {
+			err = importRecord(ctx, svc, rec)
+		}
+		switch {
+		case errors.Is(err, purchase.ErrAlreadyImported):
+			res.Status = StatusSkipped
+			sum.Skipped++
+		case err != nil:
+			res.Status, res.Error = StatusFailed, err.Error()
+			sum.Failed++
+		default:
+			sum.Imported++
+		}
+		if err := emit(res); err != nil {
+			return sum, err
+		}
+	}
+}
+
+func importRecord(ctx context.Context, svc PurchaseImporter, rec Record) error {
+	id, err := uuid.Parse(rec.ID)
+	if err != nil {
+		return errors.New("id must be a UUID")
+	}
+	storeID, err := uuid.Parse(rec.StoreID)
+	if err != nil {
+		return errors.New("storeId must be a UUID")
+	}
+	p := &purchase.Purchase{
+		Store:        store.Ref(storeID),
+		PaymentMeans: payment.Means(rec.PaymentMeans),
+	}
+	if rec.CustomerID != "" {
+		if p.CustomerID, err = uuid.Parse(rec.CustomerID); err != nil {
+			return errors.New("customerId must be a UUID")
+		}
+	}
+	for _, item := range rec.Items {
+		if item.Name == "" || item.Amount <= 0 || money.GetCurrency(item.Currency) == nil {
+			return fmt.Errorf("item %q needs a name, a positive amount and an ISO 4217 currency", item.Name)
+		}
+		p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{
+			ItemName:  item.Name,
+			BasePrice: *money.New(item.Amount, item.Currency),
+		})
+	}
+	return svc.ImportPurchase(ctx, id, rec.PurchasedAt, p)
+}
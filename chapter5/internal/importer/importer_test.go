@@ -0,0 +1,91 @@
+package importer_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/importer"
+	"coffeeco/internal/purchase"
+)
+
+type fakePurchases map[uuid.UUID]*purchase.Purchase
+
+func (f fakePurchases) ImportPurchase(_ context.Context, id uuid.UUID, _ time.Time, p *purchase.Purchase) error {
+	if _, ok := f[id]; ok {
+		return purchase.ErrAlreadyImported
+	}
+	f[id] = p
+	return nil
+}
+
+func collect(results *[]importer.Result) func(importer.Result) error {
+	return func(r importer.Result) error {
+		*results = append(*results, r)
+		return nil
+	}
+}
+
+func Test_ImportNDJSONReportsEveryRecord(t *testing.T) {
+	first, second := uuid.NewString(), uuid.NewString()
+	storeID := uuid.NewString()
+	input := strings.Join([]string{
+		`{"id":"` + first + `","storeId":"` + storeID + `","purchasedAt":"2023-01-02T08:00:00Z","paymentMeans":"cash","items":[{"name":"latte","amount":400,"currency":"USD"}]}`,
+		``,
+		`{"id":"` + first + `","storeId":"` + storeID + `","purchasedAt":"2023-01-02T08:00:00Z","paymentMeans":"cash","items":[{"name":"latte","amount":400,"currency":"USD"}]}`,
+		`{not json`,
+		`{"id":"` + second + `","storeId":"nope","purchasedAt":"2023-01-02T08:00:00Z","paymentMeans":"cash","items":[]}`,
+	}, "\n")
+
+	var results []importer.Result
+	purchases := fakePurchases{}
+	sum, err := importer.Import(context.Background(), purchases, strings.NewReader(input), importer.FormatNDJSON, 1, collect(&results))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	want := []importer.Status{importer.StatusImported, importer.StatusSkipped, importer.StatusFailed, importer.StatusFailed}
+	if len(results) != len(want) {
+		t.Fatalf("expected %d results but got %+v", len(want), results)
+	}
+	for i, s := range want {
+		if results[i].Status != s || results[i].Record != i+1 {
+			t.Fatalf("expected record %d to be %s but got %+v", i+1, s, results[i])
+		}
+	}
+	if sum != (importer.Summary{Imported: 1, Skipped: 1, Failed: 2}) {
+		t.Fatalf("expected 1 imported, 1 skipped and 2 failed but got %+v", sum)
+	}
+}
+
+func Test_ImportCSVResumesFromARecord(t *testing.T) {
+	storeID := uuid.NewString()
+	input := "id,store_id,customer_id,purchased_at,payment_means,currency,items\n" +
+		uuid.NewString() + "," + storeID + ",,2023-01-02T08:00:00Z,cash,USD,latte=400\n" +
+		uuid.NewString() + "," + storeID + ",,2023-01-02T08:05:00Z,card,USD,latte=400;flat white=350\n"
+
+	var results []importer.Result
+	purchases := fakePurchases{}
+	sum, err := importer.Import(context.Background(), purchases, strings.NewReader(input), importer.FormatCSV, 2, collect(&results))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if sum.Imported != 1 || len(results) != 1 || results[0].Record != 2 {
+		t.Fatalf("expected only record 2 to be imported but got %+v %+v", sum, results)
+	}
+	for _, p := range purchases {
+		if len(p.ProductsToPurchase) != 2 || p.ProductsToPurchase[1].ItemName != "flat white" {
+			t.Fatalf("expected the latte and flat white but got %+v", p.ProductsToPurchase)
+		}
+	}
+}
+
+func Test_ImportCSVNeedsEveryColumn(t *testing.T) {
+	_, err := importer.Import(context.Background(), fakePurchases{}, strings.NewReader("id,store_id\n"), importer.FormatCSV, 1, func(importer.Result) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "customer_id") {
+		t.Fatalf("expected the missing column to be reported but got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+// Store remembers which events each consumer has already processed.
+type Store interface {
+	Seen(ctx context.Context, consumer string, eventID uuid.UUID) (bool, error)
+	Record(ctx context.Context, consumer string, eventID uuid.UUID) error
+	// Forget drops everything recorded for consumer, e.g. before its read model is rebuilt.
+	Forget(ctx context.Context, consumer string) error
+}
+
+// Idempotent makes h safe under at-least-once delivery: events consumer has already processed are skipped.
+// An event is recorded only after h succeeds, so a crash in between means it is handled again on
+// redelivery; handlers that cannot tolerate that must make their own writes idempotent.
+func Idempotent(store Store, consumer string, h events.Handler) events.Handler {
+	return func(ctx context.Context, msg events.Message) error {
+		if msg.ID == uuid.Nil {
+			return errors.New("message has no ID, cannot deduplicate")
+		}
+		seen, err := store.Seen(ctx, consumer, msg.ID)
+		if err != nil {
+			return err
+		}
+		if seen {
+			return nil
+		}
+		if err := h(ctx, msg); err != nil {
+			return err
+		}
+		return store.Record(ctx, consumer, msg.ID)
+	}
+}
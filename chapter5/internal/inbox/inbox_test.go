@@ -0,0 +1,46 @@
+package inbox_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/inbox"
+)
+
+func Test_IdempotentSkipsRedeliveries(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = inbox.NewMemoryStore()
+		msg   = events.Message{ID: uuid.New(), Type: "purchase.completed"}
+		calls = map[string]int{}
+	)
+	handler := func(consumer string) events.Handler {
+		return inbox.Idempotent(store, consumer, func(context.Context, events.Message) error {
+			calls[consumer]++
+			return nil
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := handler("store_sales")(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if err := handler("top_products")(ctx, msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if calls["store_sales"] != 1 || calls["top_products"] != 1 {
+		t.Fatalf("expected each consumer to handle the event once but got %v", calls)
+	}
+
+	if err := store.Forget(ctx, "store_sales"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	_ = handler("store_sales")(ctx, msg)
+	if calls["store_sales"] != 2 {
+		t.Fatalf("expected the event to be handled again after Forget but got %v", calls)
+	}
+}
@@ -0,0 +1,100 @@
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// retention bounds how long processed IDs are kept; redeliveries older than this are not expected.
+const retention = 30 * 24 * time.Hour
+
+type MongoStore struct {
+	processed *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	processed := client.Database("coffeeco").Collection("processed_events")
+	_, err = processed.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "processed_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(retention.Seconds())),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create retention index: %w", err)
+	}
+	return &MongoStore{processed: processed}, nil
+}
+
+func key(consumer string, eventID uuid.UUID) string {
+	return consumer + ":" + eventID.String()
+}
+
+func (m *MongoStore) Seen(ctx context.Context, consumer string, eventID uuid.UUID) (bool, error) {
+	n, err := m.processed.CountDocuments(ctx, bson.D{{Key: "_id", Value: key(consumer, eventID)}})
+	if err != nil {
+		return false, fmt.Errorf("failed to check processed events: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (m *MongoStore) Record(ctx context.Context, consumer string, eventID uuid.UUID) error {
+	_, err := m.processed.InsertOne(ctx, bson.D{
+		{Key: "_id", Value: key(consumer, eventID)},
+		{Key: "consumer", Value: consumer},
+		{Key: "processed_at", Value: time.Now().UTC()},
+	})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to record processed event: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Forget(ctx context.Context, consumer string) error {
+	if _, err := m.processed.DeleteMany(ctx, bson.D{{Key: "consumer", Value: consumer}}); err != nil {
+		return fmt.Errorf("failed to forget processed events: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps processed IDs in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu   sync.Mutex
+	seen map[string]map[uuid.UUID]bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{seen: map[string]map[uuid.UUID]bool{}}
+}
+
+func (m *MemoryStore) Seen(_ context.Context, consumer string, eventID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seen[consumer][eventID], nil
+}
+
+func (m *MemoryStore) Record(_ context.Context, consumer string, eventID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seen[consumer] == nil {
+		m.seen[consumer] = map[uuid.UUID]bool{}
+	}
+	m.seen[consumer][eventID] = true
+	return nil
+}
+
+func (m *MemoryStore) Forget(_ context.Context, consumer string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.seen, consumer)
+	return nil
+}
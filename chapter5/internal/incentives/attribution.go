@@ -0,0 +1,73 @@
+package incentives
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// Sale is a purchase a barista took. Amounts are in the minor unit of Currency.
+type Sale struct {
+	PurchaseID  string    `bson:"_id"`
+	StoreID     string    `bson:"store_id"`
+	Barista     string    `bson:"barista"`
+	PurchasedAt time.Time `bson:"purchased_at"`
+	Currency    string    `bson:"currency"`
+	// Items has one entry per unit sold; Total is what was paid for all of them.
+	Items []string `bson:"items"`
+	Total int64    `bson:"total"`
+}
+
+// Attribution is the projection that credits purchases to the baristas who took them. Purchases nobody
+// served, e.g. those made in the app, are left out. A sale is keyed by its purchase, so like the analytics
+// facts it needs no inbox to be applied at least once.
+type Attribution struct {
+	store    Store
+	registry *events.Registry
+}
+
+func NewAttribution(store Store) *Attribution {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	return &Attribution{store: store, registry: r}
+}
+
+func (a *Attribution) Name() string {
+	return "incentives"
+}
+
+func (a *Attribution) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted {
+		return nil
+	}
+	evt, err := a.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.Completed)
+	if e.ServedBy == "" {
+		return nil
+	}
+	s := Sale{
+		PurchaseID:  e.PurchaseID.String(),
+		StoreID:     e.StoreID.String(),
+		Barista:     e.ServedBy,
+		PurchasedAt: e.PurchasedAt,
+		Currency:    e.Currency,
+		Total:       e.Total,
+	}
+	for _, l := range e.Lines {
+		s.Items = append(s.Items, l.ItemName)
+	}
+	return a.store.SaveSale(ctx, s)
+}
+
+func (a *Attribution) Reset(ctx context.Context) error {
+	return a.store.Reset(ctx)
+}
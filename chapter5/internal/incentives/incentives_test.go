@@ -0,0 +1,87 @@
+package incentives_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/incentives"
+	"coffeeco/internal/purchase"
+)
+
+func complete(t *testing.T, a *incentives.Attribution, servedBy, currency string, at time.Time, total int64, items ...string) {
+	t.Helper()
+	e := purchase.Completed{PurchaseID: uuid.New(), StoreID: uuid.New(), Total: total, Currency: currency, PurchasedAt: at, ServedBy: servedBy}
+	for _, item := range items {
+		e.Lines = append(e.Lines, purchase.CompletedLine{ItemName: item})
+	}
+	msg, err := events.NewMessage(e, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := a.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_BaristasEarnCommissionAndUpsellBonusesPerPayPeriod(t *testing.T) {
+	plan := incentives.Plan{
+		Currency:          "USD",
+		CommissionPercent: 2.5,
+		UpsellBonuses:     map[string]int64{"croissant": 25},
+		PeriodStart:       "2024-01-01",
+		PeriodDays:        14,
+	}
+	sales := incentives.NewMemoryStore()
+	a := incentives.NewAttribution(sales)
+	svc := incentives.NewService(sales, plan)
+
+	period, err := svc.Period(time.Date(2024, 5, 25, 9, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if want := time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC); !period.Start.Equal(want) || !period.End.Equal(want.AddDate(0, 0, 14)) {
+		t.Fatalf("expected the period from %s but got %+v", want, period)
+	}
+	if before, _ := svc.Period(time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC)); !before.End.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the day before the first period to end the period before it but got %+v", before)
+	}
+
+	in := period.Start.Add(36 * time.Hour)
+	complete(t, a, "ana", "USD", in, 650, "latte", "croissant", "croissant")
+	// A croissant on its own is no upsell.
+	complete(t, a, "ana", "USD", in, 300, "croissant")
+	complete(t, a, "ana", "EUR", in, 400, "latte", "croissant")
+	complete(t, a, "ben", "USD", in, 351, "flat white")
+	// Made in the app, so nobody served it.
+	complete(t, a, "", "USD", in, 400, "latte", "croissant")
+	// The period before.
+	complete(t, a, "ben", "USD", period.Start.Add(-time.Minute), 400, "latte", "croissant")
+
+	earnings, err := svc.Earnings(context.Background(), period, "")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(earnings) != 2 {
+		t.Fatalf("expected earnings of ana and ben but got %+v", earnings)
+	}
+	ana, ben := earnings[0], earnings[1]
+	// 2.5% of 950 is 23.75; two croissants sold with a latte earn 50.
+	if ana.Purchases != 2 || ana.Sales != 950 || ana.Commission != 24 || ana.Upsells != 2 || ana.UpsellBonus != 50 || ana.Total != 74 || ana.Unpaid != 1 {
+		t.Fatalf("unexpected earnings of ana: %+v", ana)
+	}
+	if ben.Purchases != 1 || ben.Commission != 9 || ben.Upsells != 0 || ben.Total != 9 {
+		t.Fatalf("unexpected earnings of ben: %+v", ben)
+	}
+
+	only, err := svc.Earnings(context.Background(), period, "ben")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(only) != 1 || only[0].Barista != "ben" {
+		t.Fatalf("expected only ben's earnings but got %+v", only)
+	}
+}
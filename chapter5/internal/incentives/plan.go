@@ -0,0 +1,59 @@
+package incentives
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrInvalidPlan = errors.New("invalid incentive plan")
+
+// defaultPeriodDays is how long pay periods are when the plan does not say.
+const defaultPeriodDays = 14
+
+// Plan is what baristas earn on top of their wages for the purchases they take.
+type Plan struct {
+	// Currency the plan pays in. Purchases in another currency are counted but earn nothing.
+	Currency string `json:"currency"`
+	// CommissionPercent of what a barista sells is paid to them, e.g. 1.5.
+	CommissionPercent float64 `json:"commission_percent"`
+	// UpsellBonuses are paid for every unit of a product sold alongside something that earns no bonus,
+	// e.g. {"croissant": 25} for a croissant sold with a latte. Amounts are in the minor unit of Currency.
+	UpsellBonuses map[string]int64 `json:"upsell_bonuses"`
+	// PeriodStart is the first day of any pay period, e.g. "2024-01-01"; periods follow each other from
+	// there, PeriodDays long. Days are in UTC.
+	PeriodStart string `json:"period_start"`
+	PeriodDays  int    `json:"period_days"` // 可选, 默认 14 天
+}
+
+// PayPeriod is what earnings are paid for, from Start up to but not including End.
+type PayPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Period returns the pay period at is in.
+func (p Plan) Period(at time.Time) (PayPeriod, error) {
+	start, err := time.Parse(time.DateOnly, p.PeriodStart)
+	if err != nil {
+		return PayPeriod{}, fmt.Errorf("%w: period_start %q is not a date", ErrInvalidPlan, p.PeriodStart)
+	}
+	days := p.PeriodDays
+	if days == 0 {
+		days = defaultPeriodDays
+	}
+	// Rounded down, so days before PeriodStart fall in the periods before it.
+	elapsed := int(math.Floor(at.Sub(start).Hours() / 24))
+	n := elapsed / days
+	if elapsed%days < 0 {
+		n--
+	}
+	start = start.AddDate(0, 0, n*days)
+	return PayPeriod{Start: start, End: start.AddDate(0, 0, days)}, nil
+}
+
+// commission is CommissionPercent of sales, rounded to the nearest minor unit.
+func (p Plan) commission(sales int64) int64 {
+	return int64(math.Round(float64(sales) * p.CommissionPercent / 100))
+}
@@ -0,0 +1,93 @@
+package incentives
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Earnings is what a barista earned in a pay period. Amounts are in the minor unit of the plan's currency.
+type Earnings struct {
+	Barista string
+	// Purchases are those the barista took in the plan's currency; Sales is what they came to.
+	Purchases int
+	Sales     int64
+	// Commission is the plan's percentage of Sales.
+	Commission int64
+	// Upsells are the units sold that earned a bonus; UpsellBonus is what they earned.
+	Upsells     int
+	UpsellBonus int64
+	// Total is Commission and UpsellBonus.
+	Total int64
+	// Unpaid are purchases the barista took in another currency, which earn nothing.
+	Unpaid int
+}
+
+type Service struct {
+	store Store
+	plan  Plan
+}
+
+func NewService(store Store, plan Plan) *Service {
+	return &Service{store: store, plan: plan}
+}
+
+// Period returns the pay period at is in.
+func (s *Service) Period(at time.Time) (PayPeriod, error) {
+	return s.plan.Period(at)
+}
+
+// Earnings returns what every barista who took a purchase in period earned, by barista. An empty barista
+// returns everyone's.
+func (s *Service) Earnings(ctx context.Context, period PayPeriod, barista string) ([]Earnings, error) {
+	byBarista := map[string]*Earnings{}
+	err := s.store.Sales(ctx, period.Start, period.End, func(sale Sale) error {
+		if barista != "" && sale.Barista != barista {
+			return nil
+		}
+		e, ok := byBarista[sale.Barista]
+		if !ok {
+			e = &Earnings{Barista: sale.Barista}
+			byBarista[sale.Barista] = e
+		}
+		if sale.Currency != s.plan.Currency {
+			e.Unpaid++
+			return nil
+		}
+		e.Purchases++
+		e.Sales += sale.Total
+		units, bonus := s.upsells(sale.Items)
+		e.Upsells += units
+		e.UpsellBonus += bonus
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute earnings: %w", err)
+	}
+	res := make([]Earnings, 0, len(byBarista))
+	for _, name := range slices.SortedFunc(maps.Keys(byBarista), cmp.Compare) {
+		e := byBarista[name]
+		e.Commission = s.plan.commission(e.Sales)
+		e.Total = e.Commission + e.UpsellBonus
+		res = append(res, *e)
+	}
+	return res, nil
+}
+
+// upsells counts the items of a purchase that earn a bonus. They only do when something else was bought
+// with them, as selling a croissant on its own is no upsell.
+func (s *Service) upsells(items []string) (units int, bonus int64) {
+	if !slices.ContainsFunc(items, func(item string) bool { return s.plan.UpsellBonuses[item] == 0 }) {
+		return 0, 0
+	}
+	for _, item := range items {
+		if b := s.plan.UpsellBonuses[item]; b > 0 {
+			units++
+			bonus += b
+		}
+	}
+	return units, bonus
+}
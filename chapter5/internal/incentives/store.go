@@ -0,0 +1,132 @@
+package incentives
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// Store keeps the sales incentives are computed from.
+type Store interface {
+	// SaveSale replaces a sale saved before for the same purchase.
+	SaveSale(ctx context.Context, s Sale) error
+	// Sales calls fn with every sale made from from up to but not including to, in no particular order,
+	// stopping at the first error fn returns.
+	Sales(ctx context.Context, from, to time.Time, fn func(Sale) error) error
+	Reset(ctx context.Context) error
+	Ping(ctx context.Context) error
+}
+
+type MongoStore struct {
+	client *mongo.Client
+	sales  *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoStore{client: client, sales: client.Database("coffeeco").Collection("rm_incentive_sales")}, nil
+}
+
+// Close disconnects from Mongo. The store cannot be used afterwards.
+func (m *MongoStore) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+func (m *MongoStore) SaveSale(ctx context.Context, s Sale) error {
+	_, err := m.sales.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.PurchaseID}}, s, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save sale: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStore) Sales(ctx context.Context, from, to time.Time, fn func(Sale) error) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "incentives.MongoStore.Sales", attribute.String("incentives.from", from.String()), attribute.String("incentives.to", to.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.sales.Find(ctx, bson.D{{Key: "purchased_at", Value: bson.D{{Key: "$gte", Value: from.UTC()}, {Key: "$lt", Value: to.UTC()}}}})
+	if err != nil {
+		return fmt.Errorf("failed to query sales: %w", err)
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var s Sale
+		if err := cur.Decode(&s); err != nil {
+			return fmt.Errorf("failed to decode sale: %w", err)
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (m *MongoStore) Reset(ctx context.Context) error {
+	return m.sales.Drop(ctx)
+}
+
+func (m *MongoStore) Ping(ctx context.Context) error {
+	if _, err := m.sales.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore keeps sales in process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu    sync.Mutex
+	sales map[string]Sale
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sales: map[string]Sale{}}
+}
+
+func (m *MemoryStore) SaveSale(_ context.Context, s Sale) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Items = slices.Clone(s.Items)
+	m.sales[s.PurchaseID] = s
+	return nil
+}
+
+func (m *MemoryStore) Sales(_ context.Context, from, to time.Time, fn func(Sale) error) error {
+	m.mu.Lock()
+	var res []Sale
+	for _, s := range m.sales {
+		if !s.PurchasedAt.Before(from) && s.PurchasedAt.Before(to) {
+			res = append(res, s)
+		}
+	}
+	m.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool { return res[i].PurchaseID < res[j].PurchaseID })
+	for _, s := range res {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Reset(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sales = map[string]Sale{}
+	return nil
+}
+
+func (m *MemoryStore) Ping(context.Context) error {
+	return nil
+}
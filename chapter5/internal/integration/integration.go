@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	tckafka "github.com/testcontainers/testcontainers-go/modules/kafka"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// The images are pinned, so a run tests against the same servers as the last one.
+const (
+	MongoImage    = "mongo:7"
+	PostgresImage = "postgres:16-alpine"
+	KafkaImage    = "confluentinc/confluent-local:7.5.0"
+)
+
+// startTimeout bounds how long a container may take to start, pulling its image included.
+const startTimeout = 5 * time.Minute
+
+// server is a container started once per test binary and shared by its tests. Ryuk, the reaper
+// testcontainers starts next to it, removes it when the binary exits.
+type server struct {
+	once sync.Once
+	addr string
+	err  error
+}
+
+func (s *server) get(t *testing.T, name string, start func(ctx context.Context) (string, error)) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skipf("%s is not started in -short mode", name)
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+	s.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+		defer cancel()
+		s.addr, s.err = start(ctx)
+	})
+	if s.err != nil {
+		t.Fatalf("failed to start %s: %v", name, s.err)
+	}
+	return s.addr
+}
+
+var mongo, postgres, kafka server
+
+// Mongo returns the URI of a MongoDB shared by the tests of the binary, as MONGO_URI takes it. It skips the
+// test where Docker is not running and in -short mode.
+func Mongo(t *testing.T) string {
+	return mongo.get(t, "mongo", func(ctx context.Context) (string, error) {
+		c, err := testcontainers.Run(ctx, MongoImage,
+			testcontainers.WithExposedPorts("27017/tcp"),
+			testcontainers.WithWaitStrategy(wait.ForListeningPort("27017/tcp")),
+		)
+		if err != nil {
+			return "", err
+		}
+		endpoint, err := c.PortEndpoint(ctx, "27017/tcp", "")
+		if err != nil {
+			return "", err
+		}
+		return "mongodb://" + endpoint, nil
+	})
+}
+
+// Postgres returns the URL of a PostgreSQL shared by the tests of the binary, as POSTGRES_URL takes it. It
+// skips the test where Docker is not running and in -short mode.
+func Postgres(t *testing.T) string {
+	return postgres.get(t, "postgres", func(ctx context.Context) (string, error) {
+		c, err := tcpostgres.Run(ctx, PostgresImage,
+			tcpostgres.WithDatabase("coffeeco"),
+			tcpostgres.WithUsername("postgres"),
+			tcpostgres.WithPassword("example"),
+			tcpostgres.BasicWaitStrategies(),
+		)
+		if err != nil {
+			return "", err
+		}
+		return c.ConnectionString(ctx, "sslmode=disable")
+	})
+}
+
+// Kafka returns the brokers of a Kafka shared by the tests of the binary, as EVENT_BROKERS takes them. It
+// skips the test where Docker is not running and in -short mode.
+func Kafka(t *testing.T) string {
+	return kafka.get(t, "kafka", func(ctx context.Context) (string, error) {
+		c, err := tckafka.Run(ctx, KafkaImage, tckafka.WithClusterID("coffeeco"))
+		if err != nil {
+			return "", err
+		}
+		brokers, err := c.Brokers(ctx)
+		if err != nil {
+			return "", err
+		}
+		if len(brokers) == 0 {
+			return "", fmt.Errorf("kafka started without brokers")
+		}
+		return strings.Join(brokers, ","), nil
+	})
+}
@@ -0,0 +1,147 @@
+package integration_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/events/kafka"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/integration"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/loyalty/loyaltytest"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/purchase/purchasetest"
+	"coffeeco/internal/store"
+	"coffeeco/internal/store/storetest"
+)
+
+func closeWith(t *testing.T, close func(context.Context) error) {
+	t.Cleanup(func() { _ = close(context.Background()) })
+}
+
+func Test_MongoRepositoriesKeepTheirContracts(t *testing.T) {
+	uri := integration.Mongo(t)
+	ctx := context.Background()
+	storetest.RunRepositoryTests(t, func(t *testing.T) store.Repository {
+		repo, err := store.NewMongoRepo(ctx, uri)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		closeWith(t, repo.Close)
+		return repo
+	})
+	loyaltytest.RunRepositoryTests(t, func(t *testing.T) loyalty.Repository {
+		repo, err := loyalty.NewMongoRepo(ctx, uri)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		closeWith(t, repo.Close)
+		return repo
+	})
+	purchasetest.RunRepositoryTests(t, func(t *testing.T) purchase.Repository {
+		repo, err := purchase.NewMongoRepo(ctx, uri)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		closeWith(t, repo.Close)
+		return repo
+	})
+}
+
+func Test_PostgresEventSourcedPurchasesKeepTheContract(t *testing.T) {
+	url := integration.Postgres(t)
+	purchasetest.RunRepositoryTests(t, func(t *testing.T) purchase.Repository {
+		es, err := eventstore.NewPostgresStore(context.Background(), url, "purchase", eventstore.DefaultPostgresPool)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		closeWith(t, es.Close)
+		repo, err := purchase.NewEventSourcedRepo(es, nil, 1)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		return repo
+	})
+}
+
+func Test_KafkaDeliversWhatIsPublished(t *testing.T) {
+	brokers := strings.Split(integration.Kafka(t), ",")
+	pub, err := kafka.NewPublisher(brokers, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	t.Cleanup(func() { _ = pub.Close() })
+	sent := store.DiscountChanged{StoreID: uuid.New(), Discount: 15}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := pub.Publish(ctx, sent); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	sub, err := kafka.NewSubscriber(brokers, "integration-"+uuid.NewString())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	t.Cleanup(func() { _ = sub.Close() })
+	r := events.NewRegistry()
+	store.RegisterEvents(r)
+	received := make(chan store.DiscountChanged, 1)
+	go func() {
+		_ = sub.Subscribe(ctx, events.TopicFor(sent.EventType()), func(_ context.Context, msg events.Message) error {
+			e, err := r.Decode(msg)
+			if d, ok := e.(store.DiscountChanged); err == nil && ok && d.StoreID == sent.StoreID {
+				received <- d
+			}
+			return nil
+		})
+	}()
+	select {
+	case got := <-received:
+		if got.Discount != sent.Discount {
+			t.Fatalf("expected a %d%% discount but got %d%%", sent.Discount, got.Discount)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the published event delivered within a minute")
+	}
+}
+
+func Test_SeededDataCanBeReadBack(t *testing.T) {
+	uri := integration.Mongo(t)
+	ctx := context.Background()
+	stores, err := store.NewMongoRepo(ctx, uri)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	closeWith(t, stores.Close)
+	cards, err := loyalty.NewMongoRepo(ctx, uri)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	closeWith(t, cards.Close)
+	purchases, err := purchase.NewMongoRepo(ctx, uri)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	closeWith(t, purchases.Close)
+
+	seeded := integration.SeedStores(t, stores, 3)
+	if d, err := stores.GetStoreDiscount(ctx, seeded[0].ID); err != nil || d != 10 {
+		t.Fatalf("expected the first store seeded with a 10%% discount but got %d, %v", d, err)
+	}
+	for _, c := range integration.SeedLoyaltyCards(t, cards, seeded, 12) {
+		got, err := cards.Get(ctx, c.ID)
+		if err != nil || got.FreeDrinksAvailable != c.FreeDrinksAvailable {
+			t.Fatalf("expected card %s seeded with %d free drinks but got %+v, %v", c.ID, c.FreeDrinksAvailable, got, err)
+		}
+	}
+	for _, p := range integration.SeedPurchases(t, purchases, seeded, 4) {
+		if _, err := purchases.Get(ctx, p.ID); err != nil {
+			t.Fatalf("expected purchase %s seeded but got %v", p.ID, err)
+		}
+	}
+}
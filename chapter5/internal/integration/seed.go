@@ -0,0 +1,77 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+// SeedStores saves n stores that sell a latte and an espresso, every third with a 10% discount. Any
+// store.Repository can be seeded, so adapter authors can seed their own.
+func SeedStores(t *testing.T, repo store.Repository, n int) []store.Store {
+	t.Helper()
+	ctx := context.Background()
+	stores := make([]store.Store, 0, n)
+	for i := range n {
+		s := testsupport.NewTestStore().WithLocation(fmt.Sprintf("Seed Street %d", i)).Build()
+		if err := repo.SaveStore(ctx, s); err != nil {
+			t.Fatalf("failed to seed store %d: %v", i, err)
+		}
+		if i%3 == 0 {
+			if err := repo.SetStoreDiscount(ctx, s.ID, 10); err != nil {
+				t.Fatalf("failed to seed the discount of store %d: %v", i, err)
+			}
+		}
+		stores = append(stores, s)
+	}
+	return stores
+}
+
+// SeedLoyaltyCards saves n cards issued at the stores in turn, card i with i stamps.
+func SeedLoyaltyCards(t *testing.T, repo loyalty.Repository, stores []store.Store, n int) []*loyalty.CoffeeBux {
+	t.Helper()
+	ctx := context.Background()
+	cards := make([]*loyalty.CoffeeBux, 0, n)
+	for i := range n {
+		lover := coffeeco.CoffeeLover{ID: uuid.New(), FirstName: "Seed", LastName: fmt.Sprint(i), EmailAddress: fmt.Sprintf("seed-%d@example.com", i)}
+		card := loyalty.NewCoffeeBux(uuid.New(), stores[i%len(stores)], lover)
+		for range i {
+			card.AddStamp()
+		}
+		card.PopEvents()
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("failed to seed card %d: %v", i, err)
+		}
+		cards = append(cards, card)
+	}
+	return cards
+}
+
+// SeedPurchases imports n purchases made at the stores in turn over the last n hours, alternately paid by
+// card and in cash, as the service stores them.
+func SeedPurchases(t *testing.T, repo purchase.Repository, stores []store.Store, n int) []*purchase.Purchase {
+	t.Helper()
+	ctx := context.Background()
+	svc := purchase.NewService(nil, repo, nil)
+	means := []payment.Means{payment.MEANS_CARD, payment.MEANS_CASH}
+	purchases := make([]*purchase.Purchase, 0, n)
+	for i := range n {
+		s := stores[i%len(stores)]
+		p := testsupport.NewTestPurchase().WithStore(s).WithProducts(s.ProductsForSale...).WithMeans(means[i%2]).Build()
+		if err := svc.ImportPurchase(ctx, uuid.New(), time.Now().Add(-time.Duration(n-i)*time.Hour), p); err != nil {
+			t.Fatalf("failed to seed purchase %d: %v", i, err)
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases
+}
@@ -0,0 +1,59 @@
+package invariant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+var ErrViolated = errors.New("invariant violated")
+
+// Checker collects the invariants a value breaks, so one check reports all of them rather than the first.
+// The zero Checker is ready to use.
+type Checker struct {
+	errs []error
+}
+
+// That records a violation, described by format and args, unless ok.
+func (c *Checker) That(ok bool, format string, args ...any) {
+	if !ok {
+		c.errs = append(c.errs, fmt.Errorf(format, args...))
+	}
+}
+
+// Sum records a violation unless the parts add up to total, e.g. the lines of a bill to what is charged.
+func (c *Checker) Sum(what string, total int64, parts ...int64) {
+	var sum int64
+	for _, p := range parts {
+		sum += p
+	}
+	c.That(sum == total, "%s add up to %d, not %d", what, sum, total)
+}
+
+// NonNegative records a violation if amount is below zero.
+func (c *Checker) NonNegative(what string, amount int64) {
+	c.That(amount >= 0, "%s is negative: %d", what, amount)
+}
+
+// Err returns the violations, wrapping ErrViolated, or nil if there were none.
+func (c *Checker) Err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrViolated, errors.Join(c.errs...))
+}
+
+// Assert reports err, as returned by a Checker, if it is not nil. In production it logs it and carries on,
+// as refusing a customer's purchase for a bookkeeping bug helps nobody; in tests it panics, so the bug
+// fails the test that found it.
+func Assert(ctx context.Context, logger *slog.Logger, err error) {
+	if err == nil {
+		return
+	}
+	if testing.Testing() {
+		panic(err)
+	}
+	logger.ErrorContext(ctx, "invariant violated", "error", err)
+}
@@ -0,0 +1,35 @@
+package invariant_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"coffeeco/internal/invariant"
+)
+
+func Test_CheckerReportsEveryViolation(t *testing.T) {
+	var c invariant.Checker
+	c.Sum("lines", 1000, 400, 350, 250)
+	c.NonNegative("total", 0)
+	if err := c.Err(); err != nil {
+		t.Fatalf("expected no violation but got %v", err)
+	}
+
+	c.Sum("lines", 1000, 400, 350)
+	c.NonNegative("total", -5)
+	err := c.Err()
+	if !errors.Is(err, invariant.ErrViolated) || !strings.Contains(err.Error(), "add up to 750, not 1000") || !strings.Contains(err.Error(), "total is negative: -5") {
+		t.Fatalf("expected both violations but got %v", err)
+	}
+
+	invariant.Assert(context.Background(), slog.Default(), nil)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a violation to panic in tests")
+		}
+	}()
+	invariant.Assert(context.Background(), slog.Default(), err)
+}
@@ -0,0 +1,31 @@
+package inventory
+
+import (
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const EventTypeLowStock = "inventory.low_stock"
+
+// LowStock is recorded when an item at a store goes down to its low-stock threshold, so it can be reordered
+// before it runs out.
+type LowStock struct {
+	StoreID   uuid.UUID `json:"store_id"`
+	Item      string    `json:"item"`
+	Available int64     `json:"available"`
+	Threshold int64     `json:"threshold"`
+}
+
+func (e LowStock) EventType() string {
+	return EventTypeLowStock
+}
+
+func (e LowStock) AggregateID() uuid.UUID {
+	return e.StoreID
+}
+
+// RegisterEvents adds decoders for every version of the inventory events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeLowStock, 1, events.JSONDecoder[LowStock]())
+}
@@ -0,0 +1,228 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/events"
+)
+
+var (
+	ErrOutOfStock          = errors.New("out of stock")
+	ErrInvalidQuantity     = errors.New("quantity must be above 0")
+	ErrNotFound            = errors.New("no stock kept at store")
+	ErrConcurrencyConflict = errors.New("stock changed since it was read")
+)
+
+// Recipes say which ingredients a product is made of, by product name, e.g. a latte takes 18 g of beans
+// and 200 ml of milk. A product without a recipe is stocked as it is, one per sale.
+type Recipes map[string]map[string]int64
+
+// Needs is the stock products take.
+func (r Recipes) Needs(products []coffeeco.Product) map[string]int64 {
+	needs := map[string]int64{}
+	for _, p := range products {
+		recipe, ok := r[p.ItemName]
+		if !ok {
+			needs[p.ItemName]++
+			continue
+		}
+		for item, qty := range recipe {
+			needs[item] += qty
+		}
+	}
+	return needs
+}
+
+// Level is the stock of one product or ingredient at a store.
+type Level struct {
+	OnHand   int64
+	Reserved int64
+	// LowAt is the available quantity at or under which LowStock is recorded; 0 means never.
+	LowAt int64
+}
+
+// Available is what can still be reserved.
+func (l Level) Available() int64 {
+	return l.OnHand - l.Reserved
+}
+
+// Reservation holds stock for a purchase while it is paid for.
+type Reservation struct {
+	ID    uuid.UUID
+	Items map[string]int64
+	At    time.Time
+}
+
+// Stock is what a store has of everything it tracks. Items it does not track are never out of stock, so a
+// store only needs to count what can actually run out.
+type Stock struct {
+	storeID       uuid.UUID
+	version       int
+	levels        map[string]Level
+	reservations  map[uuid.UUID]Reservation
+	changed       bool
+	pendingEvents []events.Event
+}
+
+func NewStock(storeID uuid.UUID) *Stock {
+	return &Stock{storeID: storeID, levels: map[string]Level{}, reservations: map[uuid.UUID]Reservation{}}
+}
+
+func (s *Stock) StoreID() uuid.UUID {
+	return s.storeID
+}
+
+func (s *Stock) Level(item string) (Level, bool) {
+	l, ok := s.levels[item]
+	return l, ok
+}
+
+// CanMake tells whether there is enough of every tracked item for needs. Untracked items are never short.
+func (s *Stock) CanMake(needs map[string]int64) bool {
+	for item, qty := range needs {
+		if l, ok := s.levels[item]; ok && l.Available() < qty {
+			return false
+		}
+	}
+	return true
+}
+
+// Items lists the tracked items by name.
+func (s *Stock) Items() []string {
+	items := make([]string, 0, len(s.levels))
+	for item := range s.levels {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return items
+}
+
+// PopEvents returns the events recorded since the last call, for the caller to publish.
+func (s *Stock) PopEvents() []events.Event {
+	evts := s.pendingEvents
+	s.pendingEvents = nil
+	return evts
+}
+
+// Restock adds qty of item, tracking it from now on if it was not yet.
+func (s *Stock) Restock(item string, qty int64) error {
+	if qty <= 0 {
+		return ErrInvalidQuantity
+	}
+	l := s.levels[item]
+	l.OnHand += qty
+	s.levels[item] = l
+	s.changed = true
+	return nil
+}
+
+// SetLowStockThreshold records LowStock when fewer than or exactly n of item are left; 0 turns it off.
+func (s *Stock) SetLowStockThreshold(item string, n int64) error {
+	if n < 0 {
+		return ErrInvalidQuantity
+	}
+	l := s.levels[item]
+	l.LowAt = n
+	s.levels[item] = l
+	s.changed = true
+	return nil
+}
+
+// Reserve holds what a purchase needs, all of it or nothing. The error names every item that is short.
+// Reserving again under the same ID does nothing, so a retried purchase does not hold stock twice.
+func (s *Stock) Reserve(id uuid.UUID, needs map[string]int64) error {
+	if _, ok := s.reservations[id]; ok {
+		return nil
+	}
+	var short []string
+	held := map[string]int64{}
+	for item, qty := range needs {
+		l, ok := s.levels[item]
+		if !ok {
+			continue
+		}
+		if l.Available() < qty {
+			short = append(short, item)
+			continue
+		}
+		held[item] = qty
+	}
+	if len(short) > 0 {
+		sort.Strings(short)
+		return fmt.Errorf("%w: %s", ErrOutOfStock, strings.Join(short, ", "))
+	}
+	if len(held) == 0 {
+		return nil
+	}
+	for item, qty := range held {
+		l := s.levels[item]
+		before := l.Available()
+		l.Reserved += qty
+		s.levels[item] = l
+		s.alertIfLow(item, before, l)
+	}
+	s.reservations[id] = Reservation{ID: id, Items: held, At: time.Now().UTC()}
+	s.changed = true
+	return nil
+}
+
+// Commit turns a reservation into stock used, once its purchase went through.
+func (s *Stock) Commit(id uuid.UUID) {
+	r, ok := s.reservations[id]
+	if !ok {
+		return
+	}
+	for item, qty := range r.Items {
+		l := s.levels[item]
+		l.Reserved -= qty
+		l.OnHand -= qty
+		s.levels[item] = l
+	}
+	delete(s.reservations, id)
+	s.changed = true
+}
+
+// Release gives back the stock of a reservation whose purchase failed or was cancelled. Releasing a
+// reservation that is gone does nothing.
+func (s *Stock) Release(id uuid.UUID) {
+	r, ok := s.reservations[id]
+	if !ok {
+		return
+	}
+	for item, qty := range r.Items {
+		l := s.levels[item]
+		l.Reserved -= qty
+		s.levels[item] = l
+	}
+	delete(s.reservations, id)
+	s.changed = true
+}
+
+// Reservations lists the reservations held, oldest first, e.g. to find those a crashed purchase left.
+func (s *Stock) Reservations() []Reservation {
+	res := make([]Reservation, 0, len(s.reservations))
+	for _, r := range s.reservations {
+		res = append(res, r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].At.Before(res[j].At) })
+	return res
+}
+
+// alertIfLow records LowStock when item just went down to its threshold, not on every sale after that.
+func (s *Stock) alertIfLow(item string, before int64, l Level) {
+	if l.LowAt > 0 && before > l.LowAt && l.Available() <= l.LowAt {
+		s.pendingEvents = append(s.pendingEvents, LowStock{
+			StoreID:   s.storeID,
+			Item:      item,
+			Available: l.Available(),
+			Threshold: l.LowAt,
+		})
+	}
+}
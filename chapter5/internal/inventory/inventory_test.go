@@ -0,0 +1,131 @@
+package inventory_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/events"
+	"coffeeco/internal/inventory"
+)
+
+var recipes = inventory.Recipes{"latte": {"beans_g": 18, "milk_ml": 200}}
+
+func product(name string) coffeeco.Product {
+	return coffeeco.Product{ItemName: name, BasePrice: *money.New(400, "USD")}
+}
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+func Test_ReserveTakesAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	svc := inventory.NewService(inventory.NewMemoryRepo(), recipes)
+	_ = svc.Restock(ctx, storeID, "milk_ml", 1000)
+	_ = svc.Restock(ctx, storeID, "beans_g", 30)
+	_ = svc.Restock(ctx, storeID, "croissant", 1)
+
+	err := svc.Reserve(ctx, storeID, uuid.New(), []coffeeco.Product{product("latte"), product("latte"), product("croissant"), product("croissant")})
+	if !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "beans_g, croissant") {
+		t.Fatalf("expected the error to name what is short but got %v", err)
+	}
+	st, _ := svc.Stock(ctx, storeID)
+	if l, _ := st.Level("milk_ml"); l.Reserved != 0 {
+		t.Fatalf("expected nothing to be held after a failed reservation but %d ml of milk is", l.Reserved)
+	}
+}
+
+func Test_ReservationsAreCommittedOrReleased(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	svc := inventory.NewService(inventory.NewMemoryRepo(), recipes)
+	_ = svc.Restock(ctx, storeID, "milk_ml", 1000)
+	paid, failed := uuid.New(), uuid.New()
+
+	for _, id := range []uuid.UUID{paid, failed, paid} {
+		// Untracked items, like the flat white's ingredients here, never run out.
+		if err := svc.Reserve(ctx, storeID, id, []coffeeco.Product{product("latte"), product("flat white")}); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if err := svc.Commit(ctx, storeID, paid); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Release(ctx, storeID, failed); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	_ = svc.Release(ctx, storeID, failed)
+
+	st, _ := svc.Stock(ctx, storeID)
+	if l, _ := st.Level("milk_ml"); l.OnHand != 800 || l.Reserved != 0 {
+		t.Fatalf("expected 800 ml on hand and none reserved but got %+v", l)
+	}
+}
+
+func Test_LowStockIsRecordedOnceWhenCrossingTheThreshold(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	var published capture
+	svc := inventory.NewService(inventory.NewMemoryRepo(), recipes, inventory.WithEventPublisher(&published))
+	_ = svc.Restock(ctx, storeID, "croissant", 4)
+	_ = svc.SetLowStockThreshold(ctx, storeID, "croissant", 2)
+
+	for range 3 {
+		if err := svc.Reserve(ctx, storeID, uuid.New(), []coffeeco.Product{product("croissant")}); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if len(published) != 1 {
+		t.Fatalf("expected one alert but got %v", published)
+	}
+	if e := published[0].(inventory.LowStock); e.Item != "croissant" || e.Available != 2 || e.StoreID != storeID {
+		t.Fatalf("expected croissants to be low at 2 but got %+v", e)
+	}
+}
+
+// conflicting makes the first save fail as if another purchase at the store had saved first.
+type conflicting struct {
+	*inventory.MemoryRepository
+	conflicts int
+}
+
+func (c *conflicting) Save(ctx context.Context, s *inventory.Stock) error {
+	if c.conflicts > 0 {
+		c.conflicts--
+		other, _ := c.MemoryRepository.Get(ctx, s.StoreID())
+		_ = other.Restock("croissant", 1)
+		_ = c.MemoryRepository.Save(ctx, other)
+		return inventory.ErrConcurrencyConflict
+	}
+	return c.MemoryRepository.Save(ctx, s)
+}
+
+func Test_ReserveStartsOverWhenTheStockChangedMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	repo := &conflicting{MemoryRepository: inventory.NewMemoryRepo()}
+	svc := inventory.NewService(repo, recipes)
+	_ = svc.Restock(ctx, storeID, "croissant", 1)
+	repo.conflicts = 1
+
+	if err := svc.Reserve(ctx, storeID, uuid.New(), []coffeeco.Product{product("croissant")}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	st, _ := svc.Stock(ctx, storeID)
+	if l, _ := st.Level("croissant"); l.OnHand != 2 || l.Reserved != 1 {
+		t.Fatalf("expected the reservation on top of the other change but got %+v", l)
+	}
+}
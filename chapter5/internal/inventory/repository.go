@@ -0,0 +1,184 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if the store has never kept stock.
+	Get(ctx context.Context, storeID uuid.UUID) (*Stock, error)
+	// Save returns ErrConcurrencyConflict if the stock was saved by someone else since it was read.
+	Save(ctx context.Context, s *Stock) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps the stock of a store in one document, versioned so that concurrent purchases at
+// the same store cannot both take the last croissant.
+type MongoRepository struct {
+	client *mongo.Client
+	stock  *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, stock: client.Database("coffeeco").Collection("inventory")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+// Item names are values rather than keys, as names like "milk 2.5%" are not valid field names.
+type mongoStock struct {
+	StoreID      string             `bson:"_id"`
+	Version      int                `bson:"version"`
+	Levels       []mongoLevel       `bson:"levels"`
+	Reservations []mongoReservation `bson:"reservations"`
+}
+
+type mongoLevel struct {
+	Item     string `bson:"item"`
+	OnHand   int64  `bson:"on_hand"`
+	Reserved int64  `bson:"reserved"`
+	LowAt    int64  `bson:"low_at"`
+}
+
+type mongoReservation struct {
+	ID    string       `bson:"id"`
+	Items []mongoLevel `bson:"items"`
+	At    time.Time    `bson:"at"`
+}
+
+func toMongoStock(s *Stock) mongoStock {
+	doc := mongoStock{StoreID: s.storeID.String(), Version: s.version}
+	for _, item := range s.Items() {
+		l := s.levels[item]
+		doc.Levels = append(doc.Levels, mongoLevel{Item: item, OnHand: l.OnHand, Reserved: l.Reserved, LowAt: l.LowAt})
+	}
+	for _, r := range s.Reservations() {
+		mr := mongoReservation{ID: r.ID.String(), At: r.At}
+		for item, qty := range r.Items {
+			mr.Items = append(mr.Items, mongoLevel{Item: item, Reserved: qty})
+		}
+		doc.Reservations = append(doc.Reservations, mr)
+	}
+	return doc
+}
+
+func (m mongoStock) toStock() *Stock {
+	storeID, _ := uuid.Parse(m.StoreID)
+	s := NewStock(storeID)
+	s.version = m.Version
+	for _, l := range m.Levels {
+		s.levels[l.Item] = Level{OnHand: l.OnHand, Reserved: l.Reserved, LowAt: l.LowAt}
+	}
+	for _, mr := range m.Reservations {
+		id, _ := uuid.Parse(mr.ID)
+		r := Reservation{ID: id, Items: map[string]int64{}, At: mr.At}
+		for _, l := range mr.Items {
+			r.Items[l.Item] = l.Reserved
+		}
+		s.reservations[id] = r
+	}
+	return s
+}
+
+func (m *MongoRepository) Get(ctx context.Context, storeID uuid.UUID) (_ *Stock, err error) {
+	ctx, span := telemetry.StartClient(ctx, "inventory.MongoRepository.Get", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoStock
+	if err := m.stock.FindOne(ctx, bson.D{{Key: "_id", Value: storeID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find stock: %w", err)
+	}
+	return doc.toStock(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, s *Stock) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "inventory.MongoRepository.Save", attribute.String("store.id", s.storeID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoStock(s)
+	doc.Version = s.version + 1
+	if s.version == 0 {
+		if _, err := m.stock.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save stock: %w", err)
+		}
+	} else {
+		res, err := m.stock.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.StoreID}, {Key: "version", Value: s.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save stock: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	s.version = doc.Version
+	s.changed = false
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.stock.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps stock in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu    sync.Mutex
+	stock map[uuid.UUID]mongoStock
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{stock: map[uuid.UUID]mongoStock{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, storeID uuid.UUID) (*Stock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.stock[storeID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toStock(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, s *Stock) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stock[s.storeID].Version != s.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoStock(s)
+	doc.Version = s.version + 1
+	m.stock[s.storeID] = doc
+	s.version = doc.Version
+	s.changed = false
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/events"
+)
+
+// saveAttempts bounds how often a change is retried when other purchases at the store keep getting in first.
+const saveAttempts = 5
+
+type Service struct {
+	repo      Repository
+	recipes   Recipes
+	publisher events.Publisher // 可选, 发布库存告警
+	logger    *slog.Logger
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes LowStock alerts.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+func NewService(repo Repository, recipes Recipes, opts ...Option) *Service {
+	s := &Service{repo: repo, recipes: recipes, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Stock returns what the store has; a store that never kept stock has an empty Stock.
+func (s *Service) Stock(ctx context.Context, storeID uuid.UUID) (*Stock, error) {
+	st, err := s.repo.Get(ctx, storeID)
+	if errors.Is(err, ErrNotFound) {
+		return NewStock(storeID), nil
+	}
+	return st, err
+}
+
+// Reserve holds the stock products need at the store under reservationID, e.g. a purchase ID. It fails
+// with ErrOutOfStock, naming what is short, if the store does not have all of it.
+func (s *Service) Reserve(ctx context.Context, storeID, reservationID uuid.UUID, products []coffeeco.Product) error {
+	needs := s.recipes.Needs(products)
+	return s.update(ctx, storeID, func(st *Stock) error {
+		return st.Reserve(reservationID, needs)
+	})
+}
+
+// Commit uses up the stock held by a reservation.
+func (s *Service) Commit(ctx context.Context, storeID, reservationID uuid.UUID) error {
+	return s.update(ctx, storeID, func(st *Stock) error {
+		st.Commit(reservationID)
+		return nil
+	})
+}
+
+// Release gives back the stock held by a reservation.
+func (s *Service) Release(ctx context.Context, storeID, reservationID uuid.UUID) error {
+	return s.update(ctx, storeID, func(st *Stock) error {
+		st.Release(reservationID)
+		return nil
+	})
+}
+
+// InStock tells, by product, whether the store has what it takes to make one of each right now. Products
+// that nothing tracked goes into are always in stock.
+func (s *Service) InStock(ctx context.Context, storeID uuid.UUID, products []string) (map[string]bool, error) {
+	st, err := s.Stock(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool, len(products))
+	for _, p := range products {
+		res[p] = st.CanMake(s.recipes.Needs([]coffeeco.Product{{ItemName: p}}))
+	}
+	return res, nil
+}
+
+func (s *Service) Restock(ctx context.Context, storeID uuid.UUID, item string, qty int64) error {
+	return s.update(ctx, storeID, func(st *Stock) error {
+		return st.Restock(item, qty)
+	})
+}
+
+func (s *Service) SetLowStockThreshold(ctx context.Context, storeID uuid.UUID, item string, n int64) error {
+	return s.update(ctx, storeID, func(st *Stock) error {
+		return st.SetLowStockThreshold(item, n)
+	})
+}
+
+// update applies fn to the latest stock of the store and saves it, starting over if someone else saved
+// in between. Alerts are published once the change is saved; failing to publish them is only logged.
+func (s *Service) update(ctx context.Context, storeID uuid.UUID, fn func(st *Stock) error) error {
+	for range saveAttempts {
+		st, err := s.Stock(ctx, storeID)
+		if err != nil {
+			return err
+		}
+		if err := fn(st); err != nil {
+			return err
+		}
+		if !st.changed {
+			return nil
+		}
+		err = s.repo.Save(ctx, st)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if evts := st.PopEvents(); len(evts) > 0 && s.publisher != nil {
+			if err := s.publisher.Publish(ctx, evts...); err != nil {
+				s.logger.ErrorContext(ctx, "stock saved but low-stock alerts were not published", "store", storeID, "error", err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to update stock after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,270 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Job is a piece of domain housekeeping that runs on a schedule, e.g. expiring loyalty points.
+// Schedule is a standard five-field cron expression or a descriptor such as "@hourly" or "@every 10m".
+type Job struct {
+	Name     string
+	Schedule string
+	// Timeout bounds a single run. It also decides how long the job's lock is held.
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// RunState is what is persisted about a job between runs, so a restarted instance knows whether it
+// missed a run.
+type RunState struct {
+	Job             string
+	LastStartedAt   time.Time
+	LastFinishedAt  time.Time
+	LastSucceededAt time.Time
+	LastError       string
+	LastOwner       string
+}
+
+type StateStore interface {
+	Get(ctx context.Context, job string) (RunState, error)
+	Save(ctx context.Context, state RunState) error
+}
+
+// Locker elects which instance runs a job. A lock that is not released expires after ttl, so a
+// crashed instance cannot block a job forever.
+type Locker interface {
+	Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, job, owner string) error
+}
+
+// Metrics are counted per job by this instance since it started.
+type Metrics struct {
+	Runs         int64
+	Failures     int64
+	Skipped      int64
+	LastDuration time.Duration
+}
+
+const defaultTimeout = 5 * time.Minute
+
+type registered struct {
+	job      Job
+	schedule cron.Schedule
+	running  bool
+	metrics  Metrics
+}
+
+// Scheduler runs registered jobs when they are due. Any number of instances can run a scheduler
+// with the same jobs; the locker makes sure each run happens on only one of them.
+type Scheduler struct {
+	store  StateStore
+	locker Locker
+	owner  string
+	// Tick is how often the scheduler checks for due jobs.
+	Tick time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*registered
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(store StateStore, locker Locker, owner string) (*Scheduler, error) {
+	if store == nil {
+		return nil, errors.New("state store cannot be nil")
+	}
+	if locker == nil {
+		return nil, errors.New("locker cannot be nil")
+	}
+	if owner == "" {
+		return nil, errors.New("owner cannot be empty")
+	}
+	return &Scheduler{
+		store:  store,
+		locker: locker,
+		owner:  owner,
+		Tick:   15 * time.Second,
+		jobs:   map[string]*registered{},
+	}, nil
+}
+
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("job needs a name and a run func")
+	}
+	schedule, err := cron.ParseStandard(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", job.Name, err)
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[job.Name]; ok {
+		return fmt.Errorf("job %s is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &registered{job: job, schedule: schedule}
+	return nil
+}
+
+// Run checks for due jobs every Tick until ctx is done, then waits for running jobs to finish.
+func (s *Scheduler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Tick)
+	defer ticker.Stop()
+	for {
+		s.startDue(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) startDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.jobs {
+		if r.running {
+			continue
+		}
+		r.running = true
+		s.wg.Add(1)
+		go func(r *registered) {
+			defer s.wg.Done()
+			if _, err := s.runIfDue(ctx, r, now); err != nil {
+				log.Printf("job %s: %v", r.job.Name, err)
+			}
+		}(r)
+	}
+}
+
+// RunDue runs, one after the other, every job that is due at now and returns the names of those it ran.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) ([]string, error) {
+	s.mu.Lock()
+	var due []*registered
+	for _, r := range s.jobs {
+		if !r.running {
+			r.running = true
+			due = append(due, r)
+		}
+	}
+	s.mu.Unlock()
+
+	var ran []string
+	var errs []error
+	for _, r := range due {
+		ok, err := s.runIfDue(ctx, r, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("job %s: %w", r.job.Name, err))
+		}
+		if ok {
+			ran = append(ran, r.job.Name)
+		}
+	}
+	return ran, errors.Join(errs...)
+}
+
+func (s *Scheduler) runIfDue(ctx context.Context, r *registered, now time.Time) (bool, error) {
+	defer func() {
+		s.mu.Lock()
+		r.running = false
+		s.mu.Unlock()
+	}()
+
+	state, err := s.store.Get(ctx, r.job.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to load run state: %w", err)
+	}
+	if !isDue(r.schedule, state, now) {
+		return false, nil
+	}
+
+	acquired, err := s.locker.Acquire(ctx, r.job.Name, s.owner, r.job.Timeout+time.Minute)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	if !acquired {
+		s.count(r, func(m *Metrics) { m.Skipped++ })
+		return false, nil
+	}
+	defer func() {
+		if err := s.locker.Release(context.WithoutCancel(ctx), r.job.Name, s.owner); err != nil {
+			log.Printf("job %s: failed to release lock: %v", r.job.Name, err)
+		}
+	}()
+
+	// Another instance may have run the job between our check and taking the lock.
+	if state, err = s.store.Get(ctx, r.job.Name); err != nil {
+		return false, fmt.Errorf("failed to load run state: %w", err)
+	}
+	if !isDue(r.schedule, state, now) {
+		return false, nil
+	}
+
+	state.Job = r.job.Name
+	state.LastOwner = s.owner
+	state.LastStartedAt = now
+	if err := s.store.Save(ctx, state); err != nil {
+		return false, fmt.Errorf("failed to save run state: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, r.job.Timeout)
+	started := time.Now()
+	runErr := r.job.Run(runCtx)
+	cancel()
+	duration := time.Since(started)
+
+	state.LastFinishedAt = now.Add(duration)
+	state.LastError = ""
+	if runErr != nil {
+		state.LastError = runErr.Error()
+	} else {
+		state.LastSucceededAt = state.LastFinishedAt
+	}
+	s.count(r, func(m *Metrics) {
+		m.Runs++
+		m.LastDuration = duration
+		if runErr != nil {
+			m.Failures++
+		}
+	})
+	if err := s.store.Save(context.WithoutCancel(ctx), state); err != nil {
+		return true, fmt.Errorf("failed to save run state: %w", err)
+	}
+	return true, runErr
+}
+
+// isDue reports whether a run was scheduled since the job last started. A job that never ran is due
+// straight away.
+func isDue(schedule cron.Schedule, state RunState, now time.Time) bool {
+	if state.LastStartedAt.IsZero() {
+		return true
+	}
+	return !schedule.Next(state.LastStartedAt).After(now)
+}
+
+func (s *Scheduler) count(r *registered, fn func(m *Metrics)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&r.metrics)
+}
+
+// Metrics returns a snapshot of the per-job counters.
+func (s *Scheduler) Metrics() map[string]Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]Metrics, len(s.jobs))
+	for name, r := range s.jobs {
+		out[name] = r.metrics
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"coffeeco/internal/jobs"
+)
+
+func Test_RunDueRunsEachScheduledRunOnce(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = jobs.NewMemoryStore()
+		runs  int
+	)
+	s, err := jobs.NewScheduler(store, store, "instance-a")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	err = s.Register(jobs.Job{Name: "expire-points", Schedule: "@hourly", Run: func(context.Context) error {
+		runs++
+		return nil
+	}})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+	for _, now := range []time.Time{start, start.Add(10 * time.Minute), start.Add(31 * time.Minute)} {
+		if _, err := s.RunDue(ctx, now); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if runs != 2 {
+		t.Fatalf("expected 2 runs but got %d", runs)
+	}
+
+	// A second instance sharing the state sees the run was already done.
+	other, _ := jobs.NewScheduler(store, store, "instance-b")
+	_ = other.Register(jobs.Job{Name: "expire-points", Schedule: "@hourly", Run: func(context.Context) error {
+		t.Fatal("expected the job not to run again")
+		return nil
+	}})
+	if _, err := other.RunDue(ctx, start.Add(40*time.Minute)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_RunDueSkipsJobsLockedByAnotherInstance(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = jobs.NewMemoryStore()
+	)
+	if ok, _ := store.Acquire(ctx, "expire-holds", "instance-b", time.Minute); !ok {
+		t.Fatal("expected to acquire the lock")
+	}
+	s, _ := jobs.NewScheduler(store, store, "instance-a")
+	_ = s.Register(jobs.Job{Name: "expire-holds", Schedule: "*/5 * * * *", Run: func(context.Context) error {
+		t.Fatal("expected the job not to run")
+		return nil
+	}})
+
+	ran, err := s.RunDue(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Fatalf("expected no runs but got %v", ran)
+	}
+	if m := s.Metrics()["expire-holds"]; m.Skipped != 1 {
+		t.Fatalf("expected 1 skipped run but got %+v", m)
+	}
+}
+
+func Test_FailedRunsAreRecorded(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		store = jobs.NewMemoryStore()
+	)
+	s, _ := jobs.NewScheduler(store, store, "instance-a")
+	_ = s.Register(jobs.Job{Name: "rotate-seasonal", Schedule: "@daily", Run: func(context.Context) error {
+		return errors.New("catalog unavailable")
+	}})
+
+	if _, err := s.RunDue(ctx, time.Now()); err == nil {
+		t.Fatal("expected an error")
+	}
+	state, _ := store.Get(ctx, "rotate-seasonal")
+	if state.LastError != "catalog unavailable" || !state.LastSucceededAt.IsZero() {
+		t.Fatalf("expected the failure to be recorded but got %+v", state)
+	}
+	if m := s.Metrics()["rotate-seasonal"]; m.Runs != 1 || m.Failures != 1 {
+		t.Fatalf("expected 1 failed run but got %+v", m)
+	}
+}
+
+func Test_RegisterRejectsInvalidSchedules(t *testing.T) {
+	s, _ := jobs.NewScheduler(jobs.NewMemoryStore(), jobs.NewMemoryStore(), "instance-a")
+	err := s.Register(jobs.Job{Name: "bad", Schedule: "every tuesday", Run: func(context.Context) error { return nil }})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,143 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore keeps run state in the job_runs collection and locks in job_locks. It is both a
+// StateStore and a Locker.
+type MongoStore struct {
+	runs  *mongo.Collection
+	locks *mongo.Collection
+}
+
+func NewMongoStore(ctx context.Context, connectionString string) (*MongoStore, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	return &MongoStore{runs: db.Collection("job_runs"), locks: db.Collection("job_locks")}, nil
+}
+
+type mongoRunState struct {
+	Job             string    `bson:"_id"`
+	LastStartedAt   time.Time `bson:"last_started_at"`
+	LastFinishedAt  time.Time `bson:"last_finished_at"`
+	LastSucceededAt time.Time `bson:"last_succeeded_at"`
+	LastError       string    `bson:"last_error"`
+	LastOwner       string    `bson:"last_owner"`
+}
+
+func (m *MongoStore) Get(ctx context.Context, job string) (RunState, error) {
+	var doc mongoRunState
+	if err := m.runs.FindOne(ctx, bson.D{{Key: "_id", Value: job}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return RunState{Job: job}, nil
+		}
+		return RunState{}, fmt.Errorf("failed to find run state: %w", err)
+	}
+	return RunState(doc), nil
+}
+
+func (m *MongoStore) Save(ctx context.Context, s RunState) error {
+	_, err := m.runs.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.Job}}, mongoRunState(s), options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save run state: %w", err)
+	}
+	return nil
+}
+
+// Acquire takes the lock if nobody holds it, it has expired, or owner already holds it (which extends it).
+func (m *MongoStore) Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.D{
+		{Key: "_id", Value: job},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "expires_at", Value: bson.D{{Key: "$lt", Value: now}}}},
+			bson.D{{Key: "owner", Value: owner}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "owner", Value: owner},
+		{Key: "expires_at", Value: now.Add(ttl)},
+	}}}
+	_, err := m.locks.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// The filter did not match because someone else holds the lock, so the upsert collided with it.
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return true, nil
+}
+
+func (m *MongoStore) Release(ctx context.Context, job, owner string) error {
+	_, err := m.locks.DeleteOne(ctx, bson.D{{Key: "_id", Value: job}, {Key: "owner", Value: owner}})
+	if err != nil {
+		return fmt.Errorf("failed to release lock: %w", err)
+	}
+	return nil
+}
+
+// MemoryStore is a StateStore and Locker for a single process. It is meant for tests and local experiments.
+type MemoryStore struct {
+	mu    sync.Mutex
+	runs  map[string]RunState
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{runs: map[string]RunState{}, locks: map[string]memoryLock{}}
+}
+
+func (m *MemoryStore) Get(_ context.Context, job string) (RunState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.runs[job]
+	if !ok {
+		return RunState{Job: job}, nil
+	}
+	return s, nil
+}
+
+func (m *MemoryStore) Save(_ context.Context, s RunState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[s.Job] = s
+	return nil
+}
+
+func (m *MemoryStore) Acquire(_ context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if l, ok := m.locks[job]; ok && l.owner != owner && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	m.locks[job] = memoryLock{owner: owner, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *MemoryStore) Release(_ context.Context, job, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.locks[job]; ok && l.owner == owner {
+		delete(m.locks, job)
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package legacypos
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/command"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/validation"
+)
+
+var ErrUnknownStoreCode = errors.New("unknown store code")
+
+// namespace makes the ID of a legacy sale from its store code and transaction number, so a sale sent twice
+// is imported once.
+var namespace = uuid.MustParse("6f1c2a7e-3b0d-4e8a-9c51-2d4b7a9e0f13")
+
+// The legacy POS exports sales as flat XML: one element per sale, holding one element per field, and the
+// items as repeated ItemDesc, ItemPrice and ItemQty elements read in step, e.g.
+//
+//	<POSExport>
+//	  <Sale>
+//	    <TxnNo>1042</TxnNo>
+//	    <StoreCode>LDN01</StoreCode>
+//	    <TxnDate>01/03/2024 08:15</TxnDate>
+//	    <Tender>VISA</Tender>
+//	    <ItemDesc>LATTE</ItemDesc><ItemPrice>4.50</ItemPrice><ItemQty>2</ItemQty>
+//	    <ItemDesc>CROISSANT</ItemDesc><ItemPrice>£3.25</ItemPrice>
+//	  </Sale>
+//	</POSExport>
+//
+// Tills of different ages spell the fields differently, so names are matched whatever their case, and
+// under the aliases below.
+var fieldAliases = map[string][]string{
+	"txn":      {"txnno", "txn", "transactionno", "receiptno"},
+	"store":    {"storecode", "store", "branch"},
+	"date":     {"txndate", "date", "datetime"},
+	"tender":   {"tender", "tendertype", "payment"},
+	"cardref":  {"cardref", "cardtoken"},
+	"currency": {"currency", "curr"},
+	"desc":     {"itemdesc", "item"},
+	"price":    {"itemprice", "price"},
+	"qty":      {"itemqty", "qty"},
+}
+
+// dateLayouts are the ways tills have written times, tried in order.
+var dateLayouts = []string{
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"20060102150405",
+}
+
+// tenders maps what tills call a payment onto payment means. Anything else is untranslatable.
+var tenders = map[string]payment.Means{
+	"CASH":       payment.MEANS_CASH,
+	"CARD":       payment.MEANS_CARD,
+	"VISA":       payment.MEANS_CARD,
+	"MC":         payment.MEANS_CARD,
+	"MASTERCARD": payment.MEANS_CARD,
+	"AMEX":       payment.MEANS_CARD,
+	"DEBIT":      payment.MEANS_CARD,
+	"CREDIT":     payment.MEANS_CARD,
+	"LOYALTY":    payment.MEANS_COFFEEBUX,
+	"BUX":        payment.MEANS_COFFEEBUX,
+}
+
+// StoreCodes tells the store a legacy store code stands for.
+type StoreCodes interface {
+	// StoreID returns ErrUnknownStoreCode for codes of no store.
+	StoreID(ctx context.Context, code string) (uuid.UUID, error)
+}
+
+// StaticStoreCodes are store codes known in advance, e.g. from ParseStoreCodes.
+type StaticStoreCodes map[string]uuid.UUID
+
+func (c StaticStoreCodes) StoreID(_ context.Context, code string) (uuid.UUID, error) {
+	id, ok := c[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("%w %q", ErrUnknownStoreCode, code)
+	}
+	return id, nil
+}
+
+// ParseStoreCodes reads store codes written as "LDN01=<uuid>,LDN02=<uuid>".
+func ParseStoreCodes(s string) (StaticStoreCodes, error) {
+	codes := StaticStoreCodes{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		code, id, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("store code %q must be written CODE=<uuid>", pair)
+		}
+		storeID, err := uuid.Parse(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("store code %q must map to a UUID: %w", code, err)
+		}
+		codes[strings.ToUpper(strings.TrimSpace(code))] = storeID
+	}
+	return codes, nil
+}
+
+// Dispatcher carries out commands; a command.Bus is one.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, cmd command.Command) error
+}
+
+// Summary is what became of the sales of a payload.
+type Summary struct {
+	Imported int
+	// Skipped are the sales that were imported before.
+	Skipped     int
+	Quarantined int
+}
+
+// Translator is the anti-corruption layer between the legacy POS and the purchase context: it turns legacy
+// sales into purchase.ImportPurchaseCommand, so nothing of the legacy format leaks past it. Sales it
+// cannot translate, or that the purchase context rejects, are quarantined with the reason, for someone to
+// look at, rather than failing the whole payload.
+type Translator struct {
+	stores     StoreCodes
+	quarantine Quarantine
+	currency   string
+	location   *time.Location
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+type Option func(t *Translator)
+
+// WithCurrency is the currency of sales that do not say; the default is USD.
+func WithCurrency(code string) Option {
+	return func(t *Translator) {
+		t.currency = code
+	}
+}
+
+// WithLocation is where the tills' clocks are; the default is UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(t *Translator) {
+		t.location = loc
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(t *Translator) {
+		t.logger = l
+	}
+}
+
+func WithClock(now func() time.Time) Option {
+	return func(t *Translator) {
+		t.now = now
+	}
+}
+
+func NewTranslator(stores StoreCodes, quarantine Quarantine, opts ...Option) *Translator {
+	t := &Translator{
+		stores:     stores,
+		quarantine: quarantine,
+		currency:   money.USD,
+		location:   time.UTC,
+		logger:     slog.Default(),
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// untranslatable is why a sale could not be turned into a command.
+type untranslatable struct{ reason string }
+
+func (u *untranslatable) Error() string { return u.reason }
+
+func reject(format string, args ...any) error {
+	return &untranslatable{reason: fmt.Sprintf(format, args...)}
+}
+
+// Ingest translates every sale in r and dispatches it. Only malformed XML, failing to quarantine a sale and
+// errors the purchase context gives for reasons other than the sale itself stop it.
+func (t *Translator) Ingest(ctx context.Context, r io.Reader, d Dispatcher) (Summary, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read legacy payload: %w", err)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) { return input, nil }
+	var sum Summary
+	for {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return sum, nil
+		}
+		if err != nil {
+			return sum, fmt.Errorf("failed to parse legacy payload: %w", err)
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok || !strings.EqualFold(el.Name.Local, "sale") {
+			continue
+		}
+		fields, err := readFields(dec)
+		if err != nil {
+			return sum, fmt.Errorf("failed to parse legacy payload: %w", err)
+		}
+		raw := string(data[start:dec.InputOffset()])
+
+		cmd, err := t.translate(ctx, fields)
+		if err == nil {
+			err = d.Dispatch(ctx, cmd)
+		}
+		var (
+			u    *untranslatable
+			errs validation.Errors
+		)
+		switch {
+		case err == nil:
+			sum.Imported++
+		case errors.Is(err, purchase.ErrAlreadyImported):
+			sum.Skipped++
+		case errors.As(err, &u), errors.As(err, &errs):
+			if err := t.quarantine.Add(ctx, Rejected{
+				ID:            uuid.New(),
+				TransactionNo: first(fields, "txn"),
+				StoreCode:     first(fields, "store"),
+				Reason:        err.Error(),
+				Raw:           raw,
+				At:            t.now().UTC(),
+			}); err != nil {
+				return sum, fmt.Errorf("failed to quarantine legacy sale: %w", err)
+			}
+			t.logger.WarnContext(ctx, "legacy sale quarantined", "txn", first(fields, "txn"), "store_code", first(fields, "store"), "reason", err)
+			sum.Quarantined++
+		default:
+			return sum, fmt.Errorf("failed to import legacy sale %s: %w", first(fields, "txn"), err)
+		}
+	}
+}
+
+// readFields reads the children of a sale as their text by lower-cased name, in order.
+func readFields(dec *xml.Decoder) (map[string][]string, error) {
+	fields := map[string][]string{}
+	var (
+		name  string
+		text  strings.Builder
+		depth int
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			name = strings.ToLower(tok.Name.Local)
+			text.Reset()
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			if depth == 0 {
+				return fields, nil
+			}
+			depth--
+			fields[name] = append(fields[name], strings.TrimSpace(text.String()))
+		}
+	}
+}
+
+// values are the texts of field under any of its aliases.
+func values(fields map[string][]string, field string) []string {
+	for _, alias := range fieldAliases[field] {
+		if v, ok := fields[alias]; ok {
+			return v
+		}
+	}
+	return nil
+}
+
+func first(fields map[string][]string, field string) string {
+	if v := values(fields, field); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (t *Translator) translate(ctx context.Context, fields map[string][]string) (purchase.ImportPurchaseCommand, error) {
+	txn, code := first(fields, "txn"), strings.ToUpper(first(fields, "store"))
+	if txn == "" {
+		return purchase.ImportPurchaseCommand{}, reject("the sale has no transaction number")
+	}
+	storeID, err := t.stores.StoreID(ctx, code)
+	if errors.Is(err, ErrUnknownStoreCode) {
+		return purchase.ImportPurchaseCommand{}, reject("%v", err)
+	}
+	if err != nil {
+		return purchase.ImportPurchaseCommand{}, fmt.Errorf("failed to look up store code %q: %w", code, err)
+	}
+	at, err := t.parseDate(first(fields, "date"))
+	if err != nil {
+		return purchase.ImportPurchaseCommand{}, err
+	}
+	means, ok := tenders[strings.ToUpper(first(fields, "tender"))]
+	if !ok {
+		return purchase.ImportPurchaseCommand{}, reject("unknown tender %q", first(fields, "tender"))
+	}
+	currency := strings.ToUpper(first(fields, "currency"))
+	if currency == "" {
+		currency = t.currency
+	}
+	if money.GetCurrency(currency) == nil {
+		return purchase.ImportPurchaseCommand{}, reject("unknown currency %q", currency)
+	}
+
+	p := &purchase.Purchase{Store: store.Ref(storeID), PaymentMeans: means}
+	if ref := first(fields, "cardref"); ref != "" {
+		p.CardToken = &ref
+	}
+	descs, prices, qtys := values(fields, "desc"), values(fields, "price"), values(fields, "qty")
+	if len(descs) != len(prices) {
+		return purchase.ImportPurchaseCommand{}, reject("%d item descriptions but %d prices", len(descs), len(prices))
+	}
+	for i, desc := range descs {
+		price, err := parsePrice(prices[i], currency)
+		if err != nil {
+			return purchase.ImportPurchaseCommand{}, err
+		}
+		qty := 1
+		if i < len(qtys) && qtys[i] != "" {
+			if qty, err = strconv.Atoi(qtys[i]); err != nil || qty < 1 {
+				return purchase.ImportPurchaseCommand{}, reject("item %q has quantity %q", desc, qtys[i])
+			}
+		}
+		for range qty {
+			p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{
+				ItemName:  strings.ToLower(desc),
+				BasePrice: *money.New(price, currency),
+			})
+		}
+	}
+	return purchase.ImportPurchaseCommand{
+		ID:          uuid.NewSHA1(namespace, []byte(code+"/"+txn)),
+		PurchasedAt: at,
+		Purchase:    p,
+	}, nil
+}
+
+func (t *Translator) parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if at, err := time.ParseInLocation(layout, s, t.location); err == nil {
+			return at.UTC(), nil
+		}
+	}
+	return time.Time{}, reject("unreadable date %q", s)
+}
+
+// parsePrice reads prices as tills write them, e.g. "4.50", "£4.50" or "4,50", in the minor unit of currency.
+func parsePrice(s, currency string) (int64, error) {
+	cleaned := strings.TrimLeft(strings.TrimSpace(s), "£$€ ")
+	if !strings.Contains(cleaned, ".") {
+		cleaned = strings.Replace(cleaned, ",", ".", 1)
+	}
+	f, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil || f < 0 {
+		return 0, reject("unreadable price %q", s)
+	}
+	return int64(math.Round(f * math.Pow10(money.GetCurrency(currency).Fraction))), nil
+}
@@ -0,0 +1,93 @@
+package legacypos_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/command"
+	"coffeeco/internal/legacypos"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/testsupport"
+)
+
+const export = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<POSExport>
+  <Sale>
+    <TxnNo>1042</TxnNo>
+    <StoreCode> ldn01 </StoreCode>
+    <TxnDate>01/03/2024 08:15</TxnDate>
+    <Tender>visa</Tender>
+    <CardRef>tok_legacy</CardRef>
+    <ItemDesc>LATTE</ItemDesc><ItemPrice>£4.50</ItemPrice><ItemQty>2</ItemQty>
+    <ItemDesc>CROISSANT</ItemDesc><ItemPrice>3,25</ItemPrice>
+  </Sale>
+  <SALE>
+    <TXN>1043</TXN><BRANCH>LDN01</BRANCH><DATE>2024-03-01 08:20:00</DATE><TENDER>CASH</TENDER>
+    <ITEM>ESPRESSO</ITEM><PRICE>3.00</PRICE>
+  </SALE>
+  <Sale>
+    <TxnNo>77</TxnNo><StoreCode>MAN09</StoreCode><TxnDate>01/03/2024 09:00</TxnDate><Tender>CASH</Tender>
+    <ItemDesc>LATTE</ItemDesc><ItemPrice>4.50</ItemPrice>
+  </Sale>
+  <Sale>
+    <TxnNo>1044</TxnNo><StoreCode>LDN01</StoreCode><TxnDate>01/03/2024 09:05</TxnDate><Tender>CHEQUE</Tender>
+    <ItemDesc>LATTE</ItemDesc><ItemPrice>4.50</ItemPrice>
+  </Sale>
+  <Sale>
+    <TxnNo>1045</TxnNo><StoreCode>LDN01</StoreCode><TxnDate>01/03/2024 09:10</TxnDate><Tender>CASH</Tender>
+    <ItemDesc>WATER</ItemDesc><ItemPrice>0.00</ItemPrice>
+  </Sale>
+</POSExport>`
+
+func Test_LegacySalesAreImportedOnceAndTheRestQuarantined(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	repo := testsupport.NewFakePurchases()
+	bus := command.NewBus(command.Validate())
+	purchase.NewService(nil, repo, nil).RegisterCommands(bus)
+	quarantine := legacypos.NewMemoryQuarantine()
+	acl := legacypos.NewTranslator(legacypos.StaticStoreCodes{"LDN01": storeID}, quarantine, legacypos.WithCurrency("GBP"))
+
+	sum, err := acl.Ingest(ctx, strings.NewReader(export), bus)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if sum != (legacypos.Summary{Imported: 2, Quarantined: 3}) {
+		t.Fatalf("expected 2 imported and 3 quarantined but got %+v", sum)
+	}
+	stored := repo.Stored()
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 purchases but got %d", len(stored))
+	}
+	card := stored[0]
+	if total := card.Total(); card.Store.ID != storeID || card.PaymentMeans != payment.MEANS_CARD || total.Amount() != 1225 || total.Currency().Code != "GBP" {
+		t.Fatalf("expected a £12.25 card purchase at the store but got %s %s at %s", total.Display(), card.PaymentMeans, card.Store.ID)
+	}
+	if want := time.Date(2024, 3, 1, 8, 15, 0, 0, time.UTC); !card.PurchasedAt().Equal(want) {
+		t.Fatalf("expected it made at %s but got %s", want, card.PurchasedAt())
+	}
+
+	rejected, _ := quarantine.List(ctx)
+	reasons := make([]string, 0, len(rejected))
+	for _, r := range rejected {
+		reasons = append(reasons, r.TransactionNo+": "+r.Reason)
+		if !strings.Contains(r.Raw, r.TransactionNo) {
+			t.Errorf("expected the raw sale kept but got %q", r.Raw)
+		}
+	}
+	for i, want := range []string{"77: unknown store code", "1044: unknown tender", "1045: products: " + purchase.ErrZeroTotal.Error()} {
+		if i >= len(reasons) || !strings.HasPrefix(reasons[i], want) {
+			t.Fatalf("expected reasons starting %q but got %q", want, reasons)
+		}
+	}
+
+	again, err := acl.Ingest(ctx, strings.NewReader(export), bus)
+	if err != nil || again.Skipped != 2 || again.Imported != 0 {
+		t.Fatalf("expected the sales sent again skipped but got %+v, %v", again, err)
+	}
+}
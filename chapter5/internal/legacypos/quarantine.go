@@ -0,0 +1,99 @@
+package legacypos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rejected is a legacy sale that could not be imported, kept as it was sent together with why.
+type Rejected struct {
+	ID            uuid.UUID
+	TransactionNo string
+	StoreCode     string
+	Reason        string
+	// Raw is the sale's XML element, to fix and send again.
+	Raw string
+	At  time.Time
+}
+
+type Quarantine interface {
+	Add(ctx context.Context, r Rejected) error
+	// List returns the quarantined sales, oldest first.
+	List(ctx context.Context) ([]Rejected, error)
+}
+
+type MongoQuarantine struct {
+	rejected *mongo.Collection
+}
+
+func NewMongoQuarantine(ctx context.Context, connectionString string) (*MongoQuarantine, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoQuarantine{rejected: client.Database("coffeeco").Collection("legacy_pos_quarantine")}, nil
+}
+
+type mongoRejected struct {
+	ID            string    `bson:"_id"`
+	TransactionNo string    `bson:"transaction_no"`
+	StoreCode     string    `bson:"store_code"`
+	Reason        string    `bson:"reason"`
+	Raw           string    `bson:"raw"`
+	At            time.Time `bson:"at"`
+}
+
+func (m *MongoQuarantine) Add(ctx context.Context, r Rejected) error {
+	doc := mongoRejected{ID: r.ID.String(), TransactionNo: r.TransactionNo, StoreCode: r.StoreCode, Reason: r.Reason, Raw: r.Raw, At: r.At}
+	if _, err := m.rejected.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to quarantine legacy sale: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoQuarantine) List(ctx context.Context) ([]Rejected, error) {
+	cur, err := m.rejected.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined legacy sales: %w", err)
+	}
+	var docs []mongoRejected
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode quarantined legacy sales: %w", err)
+	}
+	res := make([]Rejected, 0, len(docs))
+	for _, d := range docs {
+		id, _ := uuid.Parse(d.ID)
+		res = append(res, Rejected{ID: id, TransactionNo: d.TransactionNo, StoreCode: d.StoreCode, Reason: d.Reason, Raw: d.Raw, At: d.At})
+	}
+	return res, nil
+}
+
+// MemoryQuarantine keeps quarantined sales in process. It is meant for tests and local experiments.
+type MemoryQuarantine struct {
+	mu       sync.Mutex
+	rejected []Rejected
+}
+
+func NewMemoryQuarantine() *MemoryQuarantine {
+	return &MemoryQuarantine{}
+}
+
+func (m *MemoryQuarantine) Add(_ context.Context, r Rejected) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected = append(m.rejected, r)
+	return nil
+}
+
+func (m *MemoryQuarantine) List(context.Context) ([]Rejected, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Rejected(nil), m.rejected...), nil
+}
@@ -0,0 +1,117 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Phase is a step of a shutdown. Every hook of a phase has returned before the next phase starts.
+type Phase int
+
+const (
+	// Drain stops taking new work and finishes what is in flight, e.g. purchases whose requests are
+	// still being served.
+	Drain Phase = iota
+	// StopConsuming stops reading events, leaving the ones not yet handled to another instance.
+	StopConsuming
+	// Flush pushes out what is buffered, e.g. events waiting in a publisher or a relay, and traces.
+	Flush
+	// Close closes connections to databases and brokers. Its hooks run in the reverse order they were
+	// registered in, like deferred calls.
+	Close
+	phases
+)
+
+func (p Phase) String() string {
+	switch p {
+	case Drain:
+		return "drain"
+	case StopConsuming:
+		return "stop consuming"
+	case Flush:
+		return "flush"
+	case Close:
+		return "close"
+	default:
+		return fmt.Sprintf("phase %d", int(p))
+	}
+}
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Manager shuts a service down in order: drain, stop consuming, flush, close. The whole shutdown has to
+// fit in the drain timeout; hooks still running when it is up see their ctx done, and the hooks after them
+// still run, with a ctx that is already done, so connections get closed either way.
+type Manager struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks [phases][]hook
+	once  sync.Once
+	err   error
+}
+
+func New(drainTimeout time.Duration) *Manager {
+	return &Manager{timeout: drainTimeout}
+}
+
+// Register runs fn in phase p on shutdown. name says what fn stops in the logs and errors.
+func (m *Manager) Register(p Phase, name string, fn func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks[p] = append(m.hooks[p], hook{name: name, fn: fn})
+}
+
+// Shutdown runs every hook, phase by phase, and returns the errors they returned. Only the first call shuts
+// down; later ones wait for it and return the same errors.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		ctx, cancel := context.WithTimeout(ctx, m.timeout)
+		defer cancel()
+		m.mu.Lock()
+		hooks := m.hooks
+		m.mu.Unlock()
+
+		var errs []error
+		for p := Phase(0); p < phases; p++ {
+			hs := hooks[p]
+			for i := range hs {
+				h := hs[i]
+				if p == Close {
+					h = hs[len(hs)-1-i]
+				}
+				start := time.Now()
+				if err := h.fn(ctx); err != nil {
+					slog.Error("shutdown step failed", "phase", p.String(), "step", h.name, "error", err)
+					errs = append(errs, fmt.Errorf("failed to %s %s: %w", p, h.name, err))
+					continue
+				}
+				slog.Info("shutdown step done", "phase", p.String(), "step", h.name, "took", time.Since(start))
+			}
+		}
+		m.err = errors.Join(errs...)
+	})
+	return m.err
+}
+
+// WaitForSignal blocks until the process gets one of sigs, os.Interrupt if none are given, or ctx is done,
+// and then shuts down.
+func (m *Manager) WaitForSignal(ctx context.Context, sigs ...os.Signal) error {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt}
+	}
+	ctx, stop := signal.NotifyContext(ctx, sigs...)
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", m.timeout)
+	return m.Shutdown(context.Background())
+}
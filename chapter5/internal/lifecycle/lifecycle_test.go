@@ -0,0 +1,61 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"coffeeco/internal/lifecycle"
+)
+
+func Test_ShutdownRunsThePhasesInOrder(t *testing.T) {
+	var got []string
+	step := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			got = append(got, name)
+			return nil
+		}
+	}
+	m := lifecycle.New(time.Second)
+	m.Register(lifecycle.Close, "purchases", step("close purchases"))
+	m.Register(lifecycle.Flush, "publisher", step("flush publisher"))
+	m.Register(lifecycle.Close, "broker", step("close broker"))
+	m.Register(lifecycle.StopConsuming, "subscriber", step("stop subscriber"))
+	m.Register(lifecycle.Drain, "http server", step("drain http server"))
+
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	want := []string{"drain http server", "stop subscriber", "flush publisher", "close broker", "close purchases"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+}
+
+func Test_ShutdownGoesOnAfterFailuresAndTheDrainTimeout(t *testing.T) {
+	errFlush := errors.New("broker unreachable")
+	closed := false
+	m := lifecycle.New(10 * time.Millisecond)
+	m.Register(lifecycle.Drain, "http server", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	m.Register(lifecycle.Flush, "publisher", func(context.Context) error { return errFlush })
+	m.Register(lifecycle.Close, "purchases", func(context.Context) error {
+		closed = true
+		return nil
+	})
+
+	err := m.Shutdown(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, errFlush) {
+		t.Fatalf("expected both failures to be returned but got %v", err)
+	}
+	if !closed {
+		t.Fatal("expected the connections to be closed anyway")
+	}
+	if again := m.Shutdown(context.Background()); again == nil || again.Error() != err.Error() {
+		t.Fatalf("expected a second shutdown to return the same errors but got %v", again)
+	}
+}
@@ -0,0 +1,278 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/transport/rest"
+)
+
+// Product is what a line can be of.
+type Product struct {
+	Name  string
+	Price int64
+}
+
+// Mix is what the sampled purchases look like. Weights are relative, e.g. {"card": 6, "cash": 3}.
+type Mix struct {
+	StoreIDs []uuid.UUID
+	Currency string
+	Products []Product
+	// Means weights the payment means. Coffeebux needs LoyaltyCards to pay with.
+	Means map[payment.Means]int
+	// Lines weights how many lines a purchase has: Lines[i] is the weight of i+1 lines.
+	Lines []int
+	// MaxQuantity is the most of a product a line has; lines mostly have one.
+	MaxQuantity int
+	// ReusableCupPercent of the lines are served in the customer's own cup.
+	ReusableCupPercent int
+	// CardToken pays for card purchases, e.g. Stripe's tok_visa in test mode.
+	CardToken    string
+	LoyaltyCards []uuid.UUID
+}
+
+// DefaultMix is a morning at a busy store: mostly one or two drinks, paid by card.
+var DefaultMix = Mix{
+	Currency: "USD",
+	Products: []Product{
+		{"latte", 450}, {"flat white", 425}, {"espresso", 300}, {"cappuccino", 425}, {"croissant", 325},
+	},
+	Means:              map[payment.Means]int{payment.MEANS_CARD: 7, payment.MEANS_CASH: 3},
+	Lines:              []int{55, 30, 10, 5},
+	MaxQuantity:        3,
+	ReusableCupPercent: 10,
+	CardToken:          "tok_visa",
+}
+
+// Sample draws a purchase from the mix.
+func (m Mix) Sample(rnd *rand.Rand) rest.CreatePurchaseRequestV2 {
+	req := rest.CreatePurchaseRequestV2{
+		StoreID: m.StoreIDs[rnd.IntN(len(m.StoreIDs))].String(),
+		Payment: rest.Payment{Means: string(m.means(rnd))},
+	}
+	switch payment.Means(req.Payment.Means) {
+	case payment.MEANS_CARD:
+		req.Payment.CardToken = m.CardToken
+	case payment.MEANS_COFFEEBUX:
+		req.Payment.LoyaltyCardID = m.LoyaltyCards[rnd.IntN(len(m.LoyaltyCards))].String()
+	}
+	lines := 1 + weighted(rnd, m.Lines)
+	for range lines {
+		p := m.Products[rnd.IntN(len(m.Products))]
+		quantity := 1
+		// A third of the lines are of more than one.
+		if m.MaxQuantity > 1 && rnd.IntN(3) == 0 {
+			quantity = 2 + rnd.IntN(m.MaxQuantity-1)
+		}
+		req.Lines = append(req.Lines, rest.Line{
+			Product:     p.Name,
+			Quantity:    quantity,
+			UnitPrice:   rest.Money{Amount: p.Price, Currency: m.Currency},
+			ReusableCup: rnd.IntN(100) < m.ReusableCupPercent,
+		})
+	}
+	return req
+}
+
+func (m Mix) means(rnd *rand.Rand) payment.Means {
+	// Sorted, so a seed samples the same purchases every run.
+	means := make([]payment.Means, 0, len(m.Means))
+	for k := range m.Means {
+		means = append(means, k)
+	}
+	slices.Sort(means)
+	weights := make([]int, 0, len(means))
+	for _, k := range means {
+		weights = append(weights, m.Means[k])
+	}
+	return means[weighted(rnd, weights)]
+}
+
+// weighted picks an index of weights with a chance proportional to its weight.
+func weighted(rnd *rand.Rand, weights []int) int {
+	var total int
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return 0
+	}
+	n := rnd.IntN(total)
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+// Validate checks the mix can be sampled.
+func (m Mix) Validate() error {
+	switch {
+	case len(m.StoreIDs) == 0:
+		return fmt.Errorf("the mix needs at least one store")
+	case len(m.Products) == 0:
+		return fmt.Errorf("the mix needs at least one product")
+	case len(m.Means) == 0:
+		return fmt.Errorf("the mix needs at least one payment means")
+	case m.Means[payment.MEANS_COFFEEBUX] > 0 && len(m.LoyaltyCards) == 0:
+		return fmt.Errorf("coffeebux purchases need loyalty cards to pay with")
+	}
+	return nil
+}
+
+// Target completes a purchase, returning the HTTP status it was answered with.
+type Target func(ctx context.Context, req rest.CreatePurchaseRequestV2) (status int, err error)
+
+// HTTPTarget posts purchases to the v2 API at baseURL, e.g. http://localhost:8080, with token as the bearer
+// token if it is set.
+func HTTPTarget(client *http.Client, baseURL, token string) Target {
+	return func(ctx context.Context, req rest.CreatePurchaseRequestV2) (int, error) {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return 0, err
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v2/purchases", bytes.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := client.Do(r)
+		if err != nil {
+			return 0, err
+		}
+		_ = res.Body.Close()
+		return res.StatusCode, nil
+	}
+}
+
+// Options say how hard to push.
+type Options struct {
+	// Concurrency is how many purchases are in flight at once.
+	Concurrency int
+	// Duration is how long to run, unless Purchases are made first.
+	Duration time.Duration
+	// Purchases stops the run once this many were made; 0 runs for the Duration.
+	Purchases int
+	// Rate is how many purchases are started per second, at most; 0 starts them as fast as they complete.
+	Rate float64
+	// Seed makes the sampled purchases the same every run.
+	Seed uint64
+}
+
+// Report is how a run went.
+type Report struct {
+	Purchases int
+	// Completed purchases were answered 201 Created.
+	Completed int
+	// Failures counts the other answers, by status, or by error for purchases that got no answer.
+	Failures map[string]int
+	Elapsed  time.Duration
+	// latencies of the completed purchases, sorted.
+	latencies []time.Duration
+}
+
+// Throughput is how many purchases were completed per second.
+func (r Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Completed) / r.Elapsed.Seconds()
+}
+
+// Latency is the p-th percentile latency of the completed purchases, e.g. Latency(99).
+func (r Report) Latency(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies))*p/100+0.5) - 1
+	return r.latencies[min(max(i, 0), len(r.latencies)-1)]
+}
+
+// Run makes purchases sampled from mix against target until the options say to stop or ctx is done.
+func Run(ctx context.Context, mix Mix, opts Options, target Target) (Report, error) {
+	if err := mix.Validate(); err != nil {
+		return Report{}, err
+	}
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	// Purchases are sampled up front from one source, so the concurrency does not change which are made.
+	rnd := rand.New(rand.NewPCG(opts.Seed, opts.Seed))
+	queue := make(chan rest.CreatePurchaseRequestV2)
+	go func() {
+		defer close(queue)
+		var tick <-chan time.Time
+		if opts.Rate > 0 {
+			t := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+			defer t.Stop()
+			tick = t.C
+		}
+		for n := 0; opts.Purchases <= 0 || n < opts.Purchases; n++ {
+			if tick != nil {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case queue <- mix.Sample(rnd):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu     sync.Mutex
+		report = Report{Failures: map[string]int{}}
+		wg     sync.WaitGroup
+	)
+	start := time.Now()
+	for range max(opts.Concurrency, 1) {
+		wg.Go(func() {
+			for req := range queue {
+				began := time.Now()
+				status, err := target(ctx, req)
+				took := time.Since(began)
+				if err != nil && ctx.Err() != nil {
+					// Cut short by the end of the run, not a failure of the API.
+					return
+				}
+				mu.Lock()
+				report.Purchases++
+				switch {
+				case err != nil:
+					report.Failures[err.Error()]++
+				case status == http.StatusCreated:
+					report.Completed++
+					report.latencies = append(report.latencies, took)
+				default:
+					report.Failures[fmt.Sprintf("%d %s", status, http.StatusText(status))]++
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+	slices.Sort(report.latencies)
+	return report, nil
+}
@@ -0,0 +1,76 @@
+package loadgen_test
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/loadgen"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/transport/rest"
+)
+
+func Test_SampledPurchasesAreValidAndFollowTheMix(t *testing.T) {
+	mix := loadgen.DefaultMix
+	mix.StoreIDs = []uuid.UUID{uuid.New(), uuid.New()}
+	mix.Means = map[payment.Means]int{payment.MEANS_CARD: 3, payment.MEANS_COFFEEBUX: 1}
+	mix.LoyaltyCards = []uuid.UUID{uuid.New()}
+	rnd := rand.New(rand.NewPCG(1, 1))
+
+	means := map[string]int{}
+	singles := 0
+	for range 4000 {
+		req := mix.Sample(rnd)
+		if err := req.Validate(); err != nil {
+			t.Fatalf("expected a valid purchase but got %v for %+v", err, req)
+		}
+		means[req.Payment.Means]++
+		if len(req.Lines) == 1 {
+			singles++
+		}
+	}
+	if card := means[payment.MEANS_CARD]; card < 2800 || card > 3200 {
+		t.Fatalf("expected about 3 in 4 purchases by card but got %d of 4000", card)
+	}
+	if singles < 2000 || singles > 2400 {
+		t.Fatalf("expected about 55%% of the purchases to have a single line but got %d of 4000", singles)
+	}
+}
+
+func Test_RunReportsCompletedPurchasesAndFailures(t *testing.T) {
+	var cash int
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req rest.CreatePurchaseRequestV2
+		if r.URL.Path != "/v2/purchases" || r.Header.Get("Authorization") != "Bearer t0ken" || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// Cards are declined.
+		if req.Payment.Means == payment.MEANS_CARD {
+			w.WriteHeader(http.StatusPaymentRequired)
+			return
+		}
+		cash++
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer api.Close()
+
+	mix := loadgen.DefaultMix
+	mix.StoreIDs = []uuid.UUID{uuid.New()}
+	report, err := loadgen.Run(context.Background(), mix, loadgen.Options{Concurrency: 1, Purchases: 200, Seed: 7},
+		loadgen.HTTPTarget(api.Client(), api.URL, "t0ken"))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if report.Purchases != 200 || report.Completed != cash || report.Failures["402 Payment Required"] != 200-cash {
+		t.Fatalf("expected %d of 200 purchases completed and the rest declined but got %+v", cash, report)
+	}
+	if report.Throughput() <= 0 || report.Latency(50) <= 0 || report.Latency(50) > report.Latency(99) {
+		t.Fatalf("expected throughput and ordered latencies but got %.1f/s, p50 %s, p99 %s", report.Throughput(), report.Latency(50), report.Latency(99))
+	}
+}
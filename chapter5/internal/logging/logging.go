@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/telemetry"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attributes that are never logged as they are, whatever logged them: payment
+// credentials and what identifies a customer as a person rather than by ID.
+var sensitiveKeys = map[string]bool{
+	"cardtoken":     true,
+	"card_token":    true,
+	"token":         true,
+	"authorization": true,
+	"password":      true,
+	"apikey":        true,
+	"api_key":       true,
+	"email":         true,
+	"emailaddress":  true,
+	"email_address": true,
+	"firstname":     true,
+	"first_name":    true,
+	"lastname":      true,
+	"last_name":     true,
+	"phone":         true,
+	"address":       true,
+}
+
+// secretPrefixes are Stripe card tokens and API keys, which are caught even when logged under an
+// innocent key or inside an error message.
+var secretPrefixes = []string{"tok_", "sk_live_", "sk_test_", "rk_live_", "rk_test_"}
+
+// New returns a logger writing JSON lines to w. Sensitive attributes are redacted and, when ctx carries
+// a span, the trace and span IDs are added, so use the Context variants (InfoContext etc.) in request
+// paths.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	h := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: Redact})
+	return slog.New(traceHandler{h})
+}
+
+// Redact is a slog ReplaceAttr func that hides sensitive attributes by key, and secrets by value.
+// Domain types keep their own secrets out of the logs with LogValue; this catches the rest.
+func Redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	if a.Value.Kind() == slog.KindString || a.Value.Kind() == slog.KindAny {
+		s := a.Value.String()
+		for _, p := range secretPrefixes {
+			if strings.Contains(s, p) {
+				return slog.String(a.Key, redactSecrets(s))
+			}
+		}
+	}
+	return a
+}
+
+// redactSecrets replaces every word of s that starts with a secret prefix.
+func redactSecrets(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		for _, p := range secretPrefixes {
+			if j := strings.Index(w, p); j >= 0 {
+				words[i] = w[:j] + redacted
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// traceHandler adds the trace and span IDs and the correlation ID of the record's context.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if traceID, spanID := telemetry.IDs(ctx); traceID != "" {
+		r.AddAttrs(slog.String("trace_id", traceID), slog.String("span_id", spanID))
+	}
+	if id := correlation.ID(ctx); id != "" {
+		r.AddAttrs(slog.String("correlation_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,51 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/logging"
+)
+
+func Test_SecretsAndPIIAreRedacted(t *testing.T) {
+	lover := coffeeco.CoffeeLover{ID: uuid.New(), FirstName: "Ada", LastName: "Lovelace", EmailAddress: "ada@example.com"}
+	tests := []struct {
+		name   string
+		attrs  []any
+		secret string
+	}{
+		{name: "card token by key", attrs: []any{"card_token", "4242"}, secret: "4242"},
+		{name: "card token by value", attrs: []any{"error", errors.New("charge declined for tok_visa")}, secret: "tok_visa"},
+		{name: "api key in a group", attrs: []any{slog.Group("stripe", "key", "sk_test_4eC39HqLyjWDarjtT1zdp7dc")}, secret: "4eC39"},
+		{name: "email by key", attrs: []any{"email", "ada@example.com"}, secret: "ada@"},
+		{name: "coffee lover", attrs: []any{"customer", lover}, secret: "Lovelace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logging.New(&buf, slog.LevelInfo).InfoContext(context.Background(), "hello", tt.attrs...)
+			if strings.Contains(buf.String(), tt.secret) {
+				t.Fatalf("expected %q to be redacted but got %s", tt.secret, buf.String())
+			}
+			if !strings.Contains(buf.String(), `"msg":"hello"`) {
+				t.Fatalf("expected the message to be logged but got %s", buf.String())
+			}
+		})
+	}
+}
+
+func Test_CoffeeLoversAreLoggedByID(t *testing.T) {
+	var buf bytes.Buffer
+	id := uuid.New()
+	logging.New(&buf, slog.LevelInfo).Info("signed up", "customer", coffeeco.CoffeeLover{ID: id, EmailAddress: "ada@example.com"})
+	if !strings.Contains(buf.String(), id.String()) {
+		t.Fatalf("expected the customer ID to be logged but got %s", buf.String())
+	}
+}
@@ -0,0 +1,135 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+// Accrual is what a run of events did to one card, added up. It applies the same whatever order the events
+// came in, as long as the card never ran out of free drinks in between, which the events guarantee.
+type Accrual struct {
+	CardID uuid.UUID
+	// Stamps earned; every drinksPerFreeDrink of them, counted on from where the card was, is a free drink.
+	Stamps int
+	// FreeDrinks added by adjustments, less those redeemed.
+	FreeDrinks int
+}
+
+// apply adds a to the balance of a card.
+func (a Accrual) apply(freeDrinks, remaining int) (int, int) {
+	stamped := drinksPerFreeDrink - remaining + a.Stamps
+	return freeDrinks + stamped/drinksPerFreeDrink + a.FreeDrinks, drinksPerFreeDrink - stamped%drinksPerFreeDrink
+}
+
+// Accruer applies accruals in bulk. Both repositories are.
+type Accruer interface {
+	// ResetBalances empties every card, as it was issued. The adjustments stay, as the audit trail.
+	ResetBalances(ctx context.Context) error
+	// Accrue applies each accrual to its card in a single write, all of them in one round trip. Accruals for
+	// cards that do not exist are skipped.
+	Accrue(ctx context.Context, accruals []Accrual) error
+}
+
+// DefaultAccrualBatch is how many events BulkAccrual adds up before it writes them.
+const DefaultAccrualBatch = 1000
+
+// BulkAccrual rebuilds card balances from their events, e.g. replayed with projection.Rebuild. Rather than
+// reading and saving a card for every event, it adds the events of a batch up per card and writes each card
+// once per batch. Flush writes what is left of the last batch.
+//
+// It is for replays only: the increments are not idempotent, so live events, which may be redelivered, are
+// not for it.
+type BulkAccrual struct {
+	repo     Accruer
+	registry *events.Registry
+	batch    int
+
+	pending  map[uuid.UUID]*Accrual
+	order    []uuid.UUID
+	buffered int
+	// events and writes are how many were applied, for the log.
+	events int
+	writes int
+}
+
+// NewBulkAccrual writes every batch events, or DefaultAccrualBatch if batch is not positive.
+func NewBulkAccrual(repo Accruer, batch int) *BulkAccrual {
+	if batch <= 0 {
+		batch = DefaultAccrualBatch
+	}
+	r := events.NewRegistry()
+	RegisterEvents(r)
+	return &BulkAccrual{repo: repo, registry: r, batch: batch, pending: map[uuid.UUID]*Accrual{}}
+}
+
+func (b *BulkAccrual) Name() string {
+	return "loyalty_balances"
+}
+
+func (b *BulkAccrual) Reset(ctx context.Context) error {
+	b.pending, b.order, b.buffered = map[uuid.UUID]*Accrual{}, nil, 0
+	return b.repo.ResetBalances(ctx)
+}
+
+func (b *BulkAccrual) Handle(ctx context.Context, msg events.Message) error {
+	e, err := b.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch e := e.(type) {
+	case StampAdded:
+		b.accrual(e.CardID).Stamps++
+	case DrinksRedeemed:
+		b.accrual(e.CardID).FreeDrinks -= e.Count
+	case BalanceAdjusted:
+		b.accrual(e.CardID).FreeDrinks += e.FreeDrinks
+	default:
+		return nil
+	}
+	if b.buffered++; b.buffered >= b.batch {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+func (b *BulkAccrual) accrual(cardID uuid.UUID) *Accrual {
+	a, ok := b.pending[cardID]
+	if !ok {
+		a = &Accrual{CardID: cardID}
+		b.pending[cardID] = a
+		b.order = append(b.order, cardID)
+	}
+	return a
+}
+
+// Flush writes the events added up so far.
+func (b *BulkAccrual) Flush(ctx context.Context) error {
+	if len(b.order) == 0 {
+		return nil
+	}
+	accruals := make([]Accrual, 0, len(b.order))
+	for _, id := range b.order {
+		accruals = append(accruals, *b.pending[id])
+	}
+	if err := b.repo.Accrue(ctx, accruals); err != nil {
+		return fmt.Errorf("failed to accrue %d events on %d cards: %w", b.buffered, len(accruals), err)
+	}
+	b.events += b.buffered
+	b.writes += len(accruals)
+	clear(b.pending)
+	b.order, b.buffered = b.order[:0], 0
+	return nil
+}
+
+// Applied is how many events were written so far, and in how many card writes.
+func (b *BulkAccrual) Applied() (events, writes int) {
+	return b.events, b.writes
+}
@@ -4,29 +4,75 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 
 	coffeeco "coffeeco/internal"
+	"coffeeco/internal/ddd"
 	"coffeeco/internal/store"
 )
 
 // 用户的忠诚计划, 10减1的功能等
 type CoffeeBux struct {
-	ID                                    uuid.UUID
+	ddd.AggregateRoot
 	store                                 store.Store
 	coffeeLover                           coffeeco.CoffeeLover
 	FreeDrinksAvailable                   int
 	RemainingDrinkPurchasesUntilFreeDrink int
+	adjustments                           []Adjustment
+}
+
+// Adjustment is a manual correction of a card's balance, kept on the card as an audit trail.
+type Adjustment struct {
+	FreeDrinks int
+	Note       string
+	By         string
+	At         time.Time
+}
+
+const drinksPerFreeDrink = 10
+
+var (
+	ErrNotFound            = errors.New("loyalty card not found")
+	ErrNotEnoughCoffeeBux  = errors.New("not enough coffeeBux to cover entire purchase")
+	ErrAdjustmentNote      = errors.New("an adjustment needs a note saying why it was made")
+	ErrNegativeBalance     = errors.New("adjustment would leave a negative balance")
+	ErrConcurrencyConflict = errors.New("loyalty card changed since it was read")
+)
+
+// NewCoffeeBux issues a new, empty loyalty card to a customer at a store.
+func NewCoffeeBux(id uuid.UUID, s store.Store, lover coffeeco.CoffeeLover) *CoffeeBux {
+	return &CoffeeBux{
+		AggregateRoot:                         ddd.AggregateRoot{ID: id},
+		store:                                 s,
+		coffeeLover:                           lover,
+		RemainingDrinkPurchasesUntilFreeDrink: drinksPerFreeDrink,
+	}
+}
+
+func (c *CoffeeBux) CustomerID() uuid.UUID {
+	return c.coffeeLover.ID
+}
+
+func (c *CoffeeBux) StoreID() uuid.UUID {
+	return c.store.ID
 }
 
 func (c *CoffeeBux) AddStamp() {
 	if c.RemainingDrinkPurchasesUntilFreeDrink == 1 {
-		c.RemainingDrinkPurchasesUntilFreeDrink = 10
+		c.RemainingDrinkPurchasesUntilFreeDrink = drinksPerFreeDrink
 		c.FreeDrinksAvailable += 1
 	} else {
 		c.RemainingDrinkPurchasesUntilFreeDrink--
 	}
+	c.RecordEvent(StampAdded{
+		CardID:                                c.ID,
+		CustomerID:                            c.coffeeLover.ID,
+		StoreID:                               c.store.ID,
+		FreeDrinksAvailable:                   c.FreeDrinksAvailable,
+		RemainingDrinkPurchasesUntilFreeDrink: c.RemainingDrinkPurchasesUntilFreeDrink,
+	})
 }
 
 func (c *CoffeeBux) Pay(ctx context.Context, purchases []coffeeco.Product) error {
@@ -36,9 +82,49 @@ func (c *CoffeeBux) Pay(ctx context.Context, purchases []coffeeco.Product) error
 	}
 
 	if c.FreeDrinksAvailable < lp {
-		return fmt.Errorf("not enough coffeeBux to cover entire purchase. Have %d, need %d", len(purchases), c.FreeDrinksAvailable)
+		return fmt.Errorf("%w. Have %d, need %d", ErrNotEnoughCoffeeBux, c.FreeDrinksAvailable, lp)
 	}
 
 	c.FreeDrinksAvailable = c.FreeDrinksAvailable - lp
+	c.RecordEvent(DrinksRedeemed{
+		CardID:     c.ID,
+		CustomerID: c.coffeeLover.ID,
+		StoreID:    c.store.ID,
+		Count:      lp,
+	})
+	return nil
+}
+
+// RefundDrinks gives back free drinks taken by Pay, e.g. when the purchase they paid for is rolled back.
+func (c *CoffeeBux) RefundDrinks(n int) {
+	c.FreeDrinksAvailable += n
+}
+
+// AdjustFreeDrinks corrects the number of free drinks on the card by delta, e.g. to make up for a
+// purchase that was not stamped. Every adjustment must say why and who made it.
+func (c *CoffeeBux) AdjustFreeDrinks(delta int, note, by string) error {
+	if note == "" || by == "" {
+		return ErrAdjustmentNote
+	}
+	if c.FreeDrinksAvailable+delta < 0 {
+		return ErrNegativeBalance
+	}
+	c.FreeDrinksAvailable += delta
+	a := Adjustment{FreeDrinks: delta, Note: note, By: by, At: time.Now().UTC()}
+	c.adjustments = append(c.adjustments, a)
+	c.RecordEvent(BalanceAdjusted{
+		CardID:              c.ID,
+		CustomerID:          c.coffeeLover.ID,
+		StoreID:             c.store.ID,
+		FreeDrinks:          delta,
+		FreeDrinksAvailable: c.FreeDrinksAvailable,
+		Note:                note,
+		AdjustedBy:          by,
+		AdjustedAt:          a.At,
+	})
 	return nil
 }
+
+func (c *CoffeeBux) Adjustments() []Adjustment {
+	return c.adjustments
+}
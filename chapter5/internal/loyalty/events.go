@@ -0,0 +1,75 @@
+package loyalty
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const (
+	EventTypeStampAdded     = "loyalty.stamp_added"
+	EventTypeDrinksRedeemed = "loyalty.drinks_redeemed"
+	EventTypeAdjusted       = "loyalty.balance_adjusted"
+)
+
+// StampAdded is recorded every time a purchase earns a stamp on a CoffeeBux card.
+type StampAdded struct {
+	CardID                                uuid.UUID `json:"card_id"`
+	CustomerID                            uuid.UUID `json:"customer_id"`
+	StoreID                               uuid.UUID `json:"store_id"`
+	FreeDrinksAvailable                   int       `json:"free_drinks_available"`
+	RemainingDrinkPurchasesUntilFreeDrink int       `json:"remaining_until_free_drink"`
+}
+
+func (e StampAdded) EventType() string {
+	return EventTypeStampAdded
+}
+
+func (e StampAdded) AggregateID() uuid.UUID {
+	return e.CardID
+}
+
+// DrinksRedeemed is recorded when free drinks are used to pay for a purchase.
+type DrinksRedeemed struct {
+	CardID     uuid.UUID `json:"card_id"`
+	CustomerID uuid.UUID `json:"customer_id"`
+	StoreID    uuid.UUID `json:"store_id"`
+	Count      int       `json:"count"`
+}
+
+func (e DrinksRedeemed) EventType() string {
+	return EventTypeDrinksRedeemed
+}
+
+func (e DrinksRedeemed) AggregateID() uuid.UUID {
+	return e.CardID
+}
+
+// BalanceAdjusted is recorded when an operator corrects a card's free drinks by hand.
+type BalanceAdjusted struct {
+	CardID              uuid.UUID `json:"card_id"`
+	CustomerID          uuid.UUID `json:"customer_id"`
+	StoreID             uuid.UUID `json:"store_id"`
+	FreeDrinks          int       `json:"free_drinks"`
+	FreeDrinksAvailable int       `json:"free_drinks_available"`
+	Note                string    `json:"note"`
+	AdjustedBy          string    `json:"adjusted_by"`
+	AdjustedAt          time.Time `json:"adjusted_at"`
+}
+
+func (e BalanceAdjusted) EventType() string {
+	return EventTypeAdjusted
+}
+
+func (e BalanceAdjusted) AggregateID() uuid.UUID {
+	return e.CardID
+}
+
+// RegisterEvents adds decoders for every version of the loyalty events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeStampAdded, 1, events.JSONDecoder[StampAdded]())
+	r.Register(EventTypeDrinksRedeemed, 1, events.JSONDecoder[DrinksRedeemed]())
+	r.Register(EventTypeAdjusted, 1, events.JSONDecoder[BalanceAdjusted]())
+}
@@ -0,0 +1,198 @@
+package loyaltytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/store"
+)
+
+// RunRepositoryTests checks that a loyalty.Repository behaves as the service relies on. newRepo returns
+// the repository to test; it may share a database with other runs, as every test uses cards of its own. Run
+// it from the tests of an adapter, e.g.
+//
+//	func Test_RepositoryContract(t *testing.T) {
+//		loyaltytest.RunRepositoryTests(t, func(t *testing.T) loyalty.Repository { return newAdapter(t) })
+//	}
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) loyalty.Repository) {
+	t.Run("get of an unknown card is ErrNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Get(context.Background(), uuid.New()); !errors.Is(err, loyalty.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound but got %v", err)
+		}
+	})
+
+	t.Run("a saved card is got back as it was", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		want := newCard(t)
+		if err := repo.Save(ctx, want); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		got, err := repo.Get(ctx, want.ID)
+		if err != nil {
+			t.Fatalf("expected the card but got %v", err)
+		}
+		assertSame(t, got, want)
+	})
+
+	t.Run("saving a card again replaces it", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		card := newCard(t)
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		card.AddStamp()
+		if err := card.AdjustFreeDrinks(-1, "drink spilt", "manager-1"); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		got, err := repo.Get(ctx, card.ID)
+		if err != nil {
+			t.Fatalf("expected the card but got %v", err)
+		}
+		assertSame(t, got, card)
+	})
+
+	t.Run("a card changed after it was saved is not changed in the repository", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		card := newCard(t)
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		free := card.FreeDrinksAvailable
+		card.RefundDrinks(5)
+		got, err := repo.Get(ctx, card.ID)
+		if err != nil {
+			t.Fatalf("expected the card but got %v", err)
+		}
+		if got.FreeDrinksAvailable != free {
+			t.Fatalf("expected %d free drinks as saved but got %d", free, got.FreeDrinksAvailable)
+		}
+	})
+
+	t.Run("of the saves of a card read at once, only the first is kept", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		cards := make([]*loyalty.CoffeeBux, 20)
+		for i := range cards {
+			cards[i] = newCard(t)
+		}
+		type result struct {
+			card *loyalty.CoffeeBux
+			err  error
+		}
+		results := make(chan result, len(cards)*5)
+		var wg sync.WaitGroup
+		for _, c := range cards {
+			for range 5 {
+				// Each save is of a copy, as a service handling requests for the same card would make.
+				saved := *c
+				wg.Go(func() { results <- result{&saved, repo.Save(ctx, &saved)} })
+			}
+		}
+		wg.Wait()
+		close(results)
+		kept := map[uuid.UUID]int{}
+		for r := range results {
+			switch {
+			case r.err == nil:
+				kept[r.card.ID]++
+			case !errors.Is(r.err, loyalty.ErrConcurrencyConflict):
+				t.Fatalf("expected no error or ErrConcurrencyConflict but got %v", r.err)
+			}
+		}
+		for _, c := range cards {
+			if kept[c.ID] != 1 {
+				t.Fatalf("expected card %s saved once but it was saved %d times", c.ID, kept[c.ID])
+			}
+			got, err := repo.Get(ctx, c.ID)
+			if err != nil {
+				t.Fatalf("expected card %s kept but got %v", c.ID, err)
+			}
+			assertSame(t, got, c)
+		}
+	})
+
+	t.Run("a card changed since it was read is not saved over", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		card := newCard(t)
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		stale, err := repo.Get(ctx, card.ID)
+		if err != nil {
+			t.Fatalf("expected the card but got %v", err)
+		}
+		card.AddStamp()
+		if err := repo.Save(ctx, card); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		stale.RefundDrinks(1)
+		if err := repo.Save(ctx, stale); !errors.Is(err, loyalty.ErrConcurrencyConflict) {
+			t.Fatalf("expected ErrConcurrencyConflict but got %v", err)
+		}
+		got, err := repo.Get(ctx, card.ID)
+		if err != nil {
+			t.Fatalf("expected the card but got %v", err)
+		}
+		assertSame(t, got, card)
+	})
+
+	t.Run("ping succeeds", func(t *testing.T) {
+		if err := newRepo(t).Ping(context.Background()); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	})
+}
+
+// newCard is a card with stamps, a free drink and an adjustment, so every field is set.
+func newCard(t *testing.T) *loyalty.CoffeeBux {
+	t.Helper()
+	lover := coffeeco.CoffeeLover{ID: uuid.New(), FirstName: "Ada", LastName: "Lovelace", EmailAddress: "ada@example.com"}
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), lover)
+	for range 12 {
+		card.AddStamp()
+	}
+	if err := card.AdjustFreeDrinks(2, "missed stamps", "manager-1"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	card.PopEvents()
+	return card
+}
+
+func assertSame(t *testing.T, got, want *loyalty.CoffeeBux) {
+	t.Helper()
+	if got.ID != want.ID || got.CustomerID() != want.CustomerID() || got.StoreID() != want.StoreID() {
+		t.Errorf("expected card %s of customer %s at store %s but got card %s of %s at %s",
+			want.ID, want.CustomerID(), want.StoreID(), got.ID, got.CustomerID(), got.StoreID())
+	}
+	if got.FreeDrinksAvailable != want.FreeDrinksAvailable || got.RemainingDrinkPurchasesUntilFreeDrink != want.RemainingDrinkPurchasesUntilFreeDrink {
+		t.Errorf("expected %d free drinks and %d to go but got %d and %d",
+			want.FreeDrinksAvailable, want.RemainingDrinkPurchasesUntilFreeDrink, got.FreeDrinksAvailable, got.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+	ga, wa := got.Adjustments(), want.Adjustments()
+	if len(ga) != len(wa) {
+		t.Fatalf("expected %d adjustments but got %d", len(wa), len(ga))
+	}
+	for i := range wa {
+		// Repositories may keep less than a nanosecond's precision, but not less than a millisecond's.
+		g, w := ga[i], wa[i]
+		g.At, w.At = g.At.Truncate(time.Millisecond), w.At.Truncate(time.Millisecond)
+		if !g.At.Equal(w.At) || g.FreeDrinks != w.FreeDrinks || g.Note != w.Note || g.By != w.By {
+			t.Errorf("expected adjustment %+v but got %+v", w, g)
+		}
+	}
+}
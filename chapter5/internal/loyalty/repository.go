@@ -0,0 +1,301 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/store"
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no card with the given ID.
+	Get(ctx context.Context, id uuid.UUID) (*CoffeeBux, error)
+	// Save returns ErrConcurrencyConflict if the card was changed by someone else since it was read.
+	Save(ctx context.Context, card *CoffeeBux) error
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client *mongo.Client
+	cards  *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, cards: client.Database("coffeeco").Collection("coffeebux_cards")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoCard struct {
+	ID                                    string            `bson:"_id"`
+	StoreID                               string            `bson:"store_id"`
+	CustomerID                            string            `bson:"customer_id"`
+	FirstName                             string            `bson:"first_name"`
+	LastName                              string            `bson:"last_name"`
+	EmailAddress                          string            `bson:"email_address"`
+	FreeDrinksAvailable                   int               `bson:"free_drinks_available"`
+	RemainingDrinkPurchasesUntilFreeDrink int               `bson:"remaining_until_free_drink"`
+	Adjustments                           []mongoAdjustment `bson:"adjustments"`
+	Version                               int               `bson:"version"`
+}
+
+type mongoAdjustment struct {
+	FreeDrinks int       `bson:"free_drinks"`
+	Note       string    `bson:"note"`
+	By         string    `bson:"by"`
+	At         time.Time `bson:"at"`
+}
+
+func toMongoCard(c *CoffeeBux) mongoCard {
+	adjustments := make([]mongoAdjustment, 0, len(c.adjustments))
+	for _, a := range c.adjustments {
+		adjustments = append(adjustments, mongoAdjustment(a))
+	}
+	return mongoCard{
+		Adjustments:                           adjustments,
+		ID:                                    c.ID.String(),
+		StoreID:                               c.store.ID.String(),
+		CustomerID:                            c.coffeeLover.ID.String(),
+		FirstName:                             c.coffeeLover.FirstName,
+		LastName:                              c.coffeeLover.LastName,
+		EmailAddress:                          c.coffeeLover.EmailAddress,
+		FreeDrinksAvailable:                   c.FreeDrinksAvailable,
+		RemainingDrinkPurchasesUntilFreeDrink: c.RemainingDrinkPurchasesUntilFreeDrink,
+		Version:                               c.Version(),
+	}
+}
+
+func (m mongoCard) toCoffeeBux() *CoffeeBux {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	adjustments := make([]Adjustment, 0, len(m.Adjustments))
+	for _, a := range m.Adjustments {
+		adjustments = append(adjustments, Adjustment(a))
+	}
+	card := &CoffeeBux{
+		AggregateRoot: ddd.AggregateRoot{ID: id},
+		adjustments:   adjustments,
+		store:         store.Ref(storeID),
+		coffeeLover: coffeeco.CoffeeLover{
+			ID:           customerID,
+			FirstName:    m.FirstName,
+			LastName:     m.LastName,
+			EmailAddress: m.EmailAddress,
+		},
+		FreeDrinksAvailable:                   m.FreeDrinksAvailable,
+		RemainingDrinkPurchasesUntilFreeDrink: m.RemainingDrinkPurchasesUntilFreeDrink,
+	}
+	card.SetVersion(m.Version)
+	return card
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *CoffeeBux, err error) {
+	ctx, span := telemetry.StartClient(ctx, "loyalty.MongoRepository.Get", attribute.String("loyalty.card.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoCard
+	if err := m.cards.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find loyalty card: %w", err)
+	}
+	return doc.toCoffeeBux(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, card *CoffeeBux) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "loyalty.MongoRepository.Save", attribute.String("loyalty.card.id", card.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoCard(card)
+	doc.Version = card.Version() + 1
+	version := any(card.Version())
+	if card.Version() == 0 {
+		// Cards saved before they were versioned have no version, and count as version 0.
+		version = bson.D{{Key: "$in", Value: bson.A{0, nil}}}
+	}
+	// A card saved since it was read matches nothing, and is then upserted onto an ID that is taken.
+	_, err = m.cards.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: version}}, doc, options.Replace().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConcurrencyConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save loyalty card: %w", err)
+	}
+	card.SetVersion(doc.Version)
+	return nil
+}
+
+// EraseCustomer removes the name, email address and customer ID from the cards of customerID. The cards
+// and their balances stay, unusable, for the books. It returns how many cards were erased.
+func (m *MongoRepository) EraseCustomer(ctx context.Context, customerID uuid.UUID) (_ int, err error) {
+	ctx, span := telemetry.StartClient(ctx, "loyalty.MongoRepository.EraseCustomer")
+	defer telemetry.End(span, &err)
+	res, err := m.cards.UpdateMany(ctx,
+		bson.D{{Key: "customer_id", Value: customerID.String()}},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "customer_id", Value: ""},
+			{Key: "first_name", Value: ""},
+			{Key: "last_name", Value: ""},
+			{Key: "email_address", Value: ""},
+		}}, {Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to erase loyalty cards: %w", err)
+	}
+	return int(res.ModifiedCount), nil
+}
+
+func (m *MongoRepository) ResetBalances(ctx context.Context) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "loyalty.MongoRepository.ResetBalances")
+	defer telemetry.End(span, &err)
+	_, err = m.cards.UpdateMany(ctx, bson.D{}, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "free_drinks_available", Value: 0},
+		{Key: "remaining_until_free_drink", Value: drinksPerFreeDrink},
+	}}, {Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}})
+	if err != nil {
+		return fmt.Errorf("failed to reset loyalty balances: %w", err)
+	}
+	return nil
+}
+
+// Accrue updates each card with a pipeline computing its new balance from the one stored, so a card takes
+// a single write and needs no read, and sends them all in one unordered bulk write.
+func (m *MongoRepository) Accrue(ctx context.Context, accruals []Accrual) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "loyalty.MongoRepository.Accrue", attribute.Int("loyalty.cards", len(accruals)))
+	defer telemetry.End(span, &err)
+	if len(accruals) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, 0, len(accruals))
+	for _, a := range accruals {
+		// stamped is how many stamps the card has towards free drinks, counting those it had.
+		stamped := bson.D{{Key: "$add", Value: bson.A{
+			bson.D{{Key: "$subtract", Value: bson.A{drinksPerFreeDrink, "$remaining_until_free_drink"}}},
+			a.Stamps,
+		}}}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: a.CardID.String()}}).
+			SetUpdate(mongo.Pipeline{{{Key: "$set", Value: bson.D{
+				{Key: "free_drinks_available", Value: bson.D{{Key: "$add", Value: bson.A{
+					"$free_drinks_available",
+					bson.D{{Key: "$trunc", Value: bson.D{{Key: "$divide", Value: bson.A{stamped, drinksPerFreeDrink}}}}},
+					a.FreeDrinks,
+				}}}},
+				{Key: "remaining_until_free_drink", Value: bson.D{{Key: "$subtract", Value: bson.A{
+					drinksPerFreeDrink,
+					bson.D{{Key: "$mod", Value: bson.A{stamped, drinksPerFreeDrink}}},
+				}}}},
+				{Key: "version", Value: bson.D{{Key: "$add", Value: bson.A{bson.D{{Key: "$ifNull", Value: bson.A{"$version", 0}}}, 1}}}},
+			}}}}))
+	}
+	if _, err := m.cards.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("failed to accrue loyalty balances: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.cards.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps loyalty cards in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu    sync.Mutex
+	cards map[uuid.UUID]mongoCard
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{cards: map[uuid.UUID]mongoCard{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*CoffeeBux, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.cards[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toCoffeeBux(), nil
+}
+
+// Save stores a copy, so later changes to card only count once saved again.
+func (m *MemoryRepository) Save(_ context.Context, card *CoffeeBux) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cards[card.ID].Version != card.Version() {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoCard(card)
+	doc.Version++
+	m.cards[card.ID] = doc
+	card.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MemoryRepository) EraseCustomer(_ context.Context, customerID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for id, doc := range m.cards {
+		if doc.CustomerID != customerID.String() {
+			continue
+		}
+		doc.CustomerID, doc.FirstName, doc.LastName, doc.EmailAddress = "", "", "", ""
+		doc.Version++
+		m.cards[id] = doc
+		n++
+	}
+	return n, nil
+}
+
+func (m *MemoryRepository) ResetBalances(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, doc := range m.cards {
+		doc.FreeDrinksAvailable, doc.RemainingDrinkPurchasesUntilFreeDrink = 0, drinksPerFreeDrink
+		doc.Version++
+		m.cards[id] = doc
+	}
+	return nil
+}
+
+func (m *MemoryRepository) Accrue(_ context.Context, accruals []Accrual) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range accruals {
+		doc, ok := m.cards[a.CardID]
+		if !ok {
+			continue
+		}
+		doc.FreeDrinksAvailable, doc.RemainingDrinkPurchasesUntilFreeDrink = a.apply(doc.FreeDrinksAvailable, doc.RemainingDrinkPurchasesUntilFreeDrink)
+		doc.Version++
+		m.cards[a.CardID] = doc
+	}
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,95 @@
+package loyalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+)
+
+// saveAttempts bounds how often an adjustment is retried when someone else keeps saving the card first.
+const saveAttempts = 3
+
+type Service struct {
+	repo      Repository
+	publisher events.Publisher // 可选, 发布卡片上记录的领域事件
+	audit     audit.Recorder   // 可选, 记录人工调整
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher makes the Service publish the events recorded on cards it changes.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithAuditLog records every manual adjustment in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s Service) GetCard(ctx context.Context, id uuid.UUID) (*CoffeeBux, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// AdjustBalance corrects a card's free drinks by delta, keeping note and operator as an audit trail.
+func (s Service) AdjustBalance(ctx context.Context, cardID uuid.UUID, delta int, note, operator string) (*CoffeeBux, error) {
+	card, before, err := s.adjust(ctx, cardID, delta, note, operator)
+	if err != nil {
+		return nil, err
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(audit.WithActor(ctx, operator), audit.ActionLoyaltyAdjustment, "loyalty_card", cardID.String(),
+			fmt.Sprintf("%d free drinks", before), fmt.Sprintf("%d free drinks", card.FreeDrinksAvailable))
+		e.Note = note
+		if err := s.audit.Record(ctx, e); err != nil {
+			return card, fmt.Errorf("adjustment saved but failed to record it in the audit log: %w", err)
+		}
+	}
+	if s.publisher != nil {
+		if err := s.publisher.Publish(ctx, card.PopEvents()...); err != nil {
+			return card, fmt.Errorf("adjustment saved but failed to publish events: %w", err)
+		}
+	}
+	return card, nil
+}
+
+// adjust applies the adjustment to the latest card and saves it, starting over if someone else saved in
+// between. It returns the free drinks the card had before.
+func (s Service) adjust(ctx context.Context, cardID uuid.UUID, delta int, note, operator string) (*CoffeeBux, int, error) {
+	for range saveAttempts {
+		card, err := s.repo.Get(ctx, cardID)
+		if err != nil {
+			return nil, 0, err
+		}
+		before := card.FreeDrinksAvailable
+		if err := card.AdjustFreeDrinks(delta, note, operator); err != nil {
+			return nil, 0, err
+		}
+		err = s.repo.Save(ctx, card)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return card, before, nil
+	}
+	return nil, 0, fmt.Errorf("failed to adjust card after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,138 @@
+package loyalty_test
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/store"
+)
+
+func Test_AdjustBalanceKeepsAnAuditTrail(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		repo = loyalty.NewMemoryRepo()
+		card = loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: uuid.New()})
+		log  = audit.NewMemoryRepo()
+		svc  = loyalty.NewService(repo, loyalty.WithAuditLog(log))
+	)
+	_ = repo.Save(ctx, card)
+
+	if _, err := svc.AdjustBalance(ctx, card.ID, 2, "", "sam"); !errors.Is(err, loyalty.ErrAdjustmentNote) {
+		t.Fatalf("expected ErrAdjustmentNote but got %v", err)
+	}
+	if _, err := svc.AdjustBalance(ctx, card.ID, -1, "mistake", "sam"); !errors.Is(err, loyalty.ErrNegativeBalance) {
+		t.Fatalf("expected ErrNegativeBalance but got %v", err)
+	}
+	if _, err := svc.AdjustBalance(ctx, card.ID, 2, "stamps missed during outage", "sam"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	saved, _ := repo.Get(ctx, card.ID)
+	if saved.FreeDrinksAvailable != 2 {
+		t.Fatalf("expected 2 free drinks but got %d", saved.FreeDrinksAvailable)
+	}
+	if a := saved.Adjustments(); len(a) != 1 || a[0].Note != "stamps missed during outage" || a[0].By != "sam" {
+		t.Fatalf("expected the adjustment to be kept but got %+v", a)
+	}
+	entries, _ := log.Query(ctx, audit.Query{From: time.Now().Add(-time.Minute), To: time.Now().Add(time.Minute)})
+	if len(entries) != 1 || entries[0].Actor != "sam" || entries[0].Before != "0 free drinks" || entries[0].After != "2 free drinks" {
+		t.Fatalf("expected one audit entry for the adjustment but got %+v", entries)
+	}
+}
+
+// countingAccruer counts the round trips of the bulk path.
+type countingAccruer struct {
+	*loyalty.MemoryRepository
+	calls, writes int
+}
+
+func (c *countingAccruer) Accrue(ctx context.Context, accruals []loyalty.Accrual) error {
+	c.calls++
+	c.writes += len(accruals)
+	return c.MemoryRepository.Accrue(ctx, accruals)
+}
+
+func Test_BulkAccrualMatchesApplyingEventsOneByOne(t *testing.T) {
+	ctx := context.Background()
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	// The naive path reads and saves a card for every event, recording the events to replay.
+	naive := loyalty.NewMemoryRepo()
+	var ids []uuid.UUID
+	for range 20 {
+		card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: uuid.New()})
+		_ = naive.Save(ctx, card)
+		ids = append(ids, card.ID)
+	}
+	var history []events.Message
+	for range 2000 {
+		card, _ := naive.Get(ctx, ids[rnd.IntN(len(ids))])
+		switch n := rnd.IntN(10); {
+		case n < 7:
+			card.AddStamp()
+		case n < 9 && card.FreeDrinksAvailable > 0:
+			_ = card.Pay(ctx, make([]coffeeco.Product, 1+rnd.IntN(card.FreeDrinksAvailable)))
+		default:
+			_ = card.AdjustFreeDrinks(rnd.IntN(3), "outage", "sam")
+		}
+		_ = naive.Save(ctx, card)
+		for _, e := range card.PopEvents() {
+			msg, err := events.NewMessage(e, events.JSONCodec{})
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			history = append(history, msg)
+		}
+	}
+
+	for _, batch := range []int{1, 7, 1000} {
+		// The balances to rebuild start out wrong, and the rebuild resets them.
+		bulk := &countingAccruer{MemoryRepository: loyalty.NewMemoryRepo()}
+		for _, id := range ids {
+			card := loyalty.NewCoffeeBux(id, store.Store{}, coffeeco.CoffeeLover{})
+			card.FreeDrinksAvailable = 99
+			_ = bulk.Save(ctx, card)
+		}
+		accrual := loyalty.NewBulkAccrual(bulk, batch)
+		src := projection.SourceFunc(func(ctx context.Context, h events.Handler) error {
+			for _, msg := range history {
+				if err := h(ctx, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err := projection.Rebuild(ctx, src, accrual); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+
+		for _, id := range ids {
+			want, _ := naive.Get(ctx, id)
+			got, _ := bulk.Get(ctx, id)
+			if got.FreeDrinksAvailable != want.FreeDrinksAvailable || got.RemainingDrinkPurchasesUntilFreeDrink != want.RemainingDrinkPurchasesUntilFreeDrink {
+				t.Fatalf("batch %d: expected card %s at %d free drinks, %d to go but got %d, %d", batch, id,
+					want.FreeDrinksAvailable, want.RemainingDrinkPurchasesUntilFreeDrink, got.FreeDrinksAvailable, got.RemainingDrinkPurchasesUntilFreeDrink)
+			}
+		}
+		n, writes := accrual.Applied()
+		if n != len(history) || writes != bulk.writes {
+			t.Fatalf("batch %d: expected %d events applied in %d writes but got %d in %d", batch, len(history), bulk.writes, n, writes)
+		}
+		if wantCalls := (len(history) + batch - 1) / batch; bulk.calls != wantCalls {
+			t.Fatalf("batch %d: expected %d round trips but got %d", batch, wantCalls, bulk.calls)
+		}
+		if batch == 1000 && writes > 2*len(ids) {
+			t.Fatalf("expected a card written once per batch but got %d writes of %d cards", writes, len(ids))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package marketplace
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// DoorDashConfig holds the Authorization header value DoorDash is set up to send with order webhooks, and
+// the provider type DoorDash gave the integration. Stores are linked to ours by their merchant supplied ID.
+type DoorDashConfig struct {
+	WebhookToken string `json:"webhook_token"`
+	ProviderType string `json:"provider_type"`
+}
+
+// DoorDash takes menus in the format of the DoorDash Menu API, and sends the whole order with its order
+// webhooks.
+type DoorDash struct {
+	cfg DoorDashConfig
+}
+
+func NewDoorDash(cfg DoorDashConfig) (*DoorDash, error) {
+	if cfg.WebhookToken == "" {
+		return nil, errors.New("doordash needs a webhook token")
+	}
+	return &DoorDash{cfg: cfg}, nil
+}
+
+func (d *DoorDash) Name() string {
+	return "doordash"
+}
+
+type doorDashMenu struct {
+	Reference string `json:"reference"`
+	Store     struct {
+		MerchantSuppliedID string `json:"merchant_supplied_id"`
+		ProviderType       string `json:"provider_type"`
+	} `json:"store"`
+	Menu struct {
+		Name       string             `json:"name"`
+		Active     bool               `json:"active"`
+		Categories []doorDashCategory `json:"categories"`
+	} `json:"menu"`
+}
+
+type doorDashCategory struct {
+	Name               string         `json:"name"`
+	MerchantSuppliedID string         `json:"merchant_supplied_id"`
+	Active             bool           `json:"active"`
+	Items              []doorDashItem `json:"items"`
+}
+
+type doorDashItem struct {
+	Name               string `json:"name"`
+	MerchantSuppliedID string `json:"merchant_supplied_id"`
+	Price              int64  `json:"price"`
+	Active             bool   `json:"active"`
+}
+
+// Menu lists every product under one category. Products that are out of stock are inactive.
+func (d *DoorDash) Menu(m Menu) any {
+	var res doorDashMenu
+	res.Reference = m.StoreID.String()
+	res.Store.MerchantSuppliedID = m.StoreID.String()
+	res.Store.ProviderType = d.cfg.ProviderType
+	res.Menu.Name = "Menu"
+	res.Menu.Active = true
+	category := doorDashCategory{Name: "Menu", MerchantSuppliedID: "all", Active: true, Items: []doorDashItem{}}
+	for _, it := range m.Items {
+		category.Items = append(category.Items, doorDashItem{Name: it.Product, MerchantSuppliedID: it.Product, Price: it.Price.Amount(), Active: it.Available})
+	}
+	res.Menu.Categories = []doorDashCategory{category}
+	return res
+}
+
+type doorDashOrderEvent struct {
+	Event struct {
+		Type string `json:"type"`
+	} `json:"event"`
+	Order struct {
+		ID    string `json:"id"`
+		Store struct {
+			MerchantSuppliedID string `json:"merchant_supplied_id"`
+		} `json:"store"`
+		Categories []struct {
+			Items []struct {
+				MerchantSuppliedID string `json:"merchant_supplied_id"`
+				Quantity           int    `json:"quantity"`
+			} `json:"items"`
+		} `json:"categories"`
+		// The fees and tip are in cents.
+		DeliveryFee int64 `json:"delivery_fee"`
+		ServiceFee  int64 `json:"service_fee"`
+		DasherTip   int64 `json:"dasher_tip"`
+	} `json:"order"`
+}
+
+// Order checks the Authorization header of the webhook and reads the order it carries.
+func (d *DoorDash) Order(_ context.Context, r *http.Request) (Order, bool, error) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(d.cfg.WebhookToken)) != 1 {
+		return Order{}, false, ErrUnauthorized
+	}
+	var e doorDashOrderEvent
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&e); err != nil {
+		return Order{}, false, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	if e.Event.Type != "OrderCreate" {
+		return Order{}, false, nil
+	}
+	storeID, err := uuid.Parse(e.Order.Store.MerchantSuppliedID)
+	if err != nil {
+		return Order{}, false, fmt.Errorf("%w: store %q is not linked to one of ours", ErrInvalidOrder, e.Order.Store.MerchantSuppliedID)
+	}
+	o := Order{ID: e.Order.ID, StoreID: storeID, Fees: fees(e.Order.DeliveryFee, e.Order.ServiceFee, e.Order.DasherTip)}
+	for _, c := range e.Order.Categories {
+		for _, it := range c.Items {
+			o.Lines = append(o.Lines, Line{Product: it.MerchantSuppliedID, Quantity: it.Quantity})
+		}
+	}
+	return o, true, nil
+}
@@ -0,0 +1,97 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/purchase"
+)
+
+var (
+	ErrUnknownMarketplace = errors.New("unknown marketplace")
+	ErrNoMenu             = errors.New("the price book sells nothing at this store")
+	ErrUnauthorized       = errors.New("webhook was not sent by the marketplace")
+	ErrInvalidOrder       = errors.New("invalid marketplace order")
+	ErrNotOnMenu          = errors.New("product is not on the menu")
+	ErrAlreadyReceived    = errors.New("marketplace order has already been received")
+	ErrNotFound           = errors.New("marketplace order not found")
+)
+
+// Marketplace is a platform customers order from, such as Uber Eats or DoorDash. It speaks its own JSON;
+// Service speaks Menu and Order.
+type Marketplace interface {
+	// Name is how the marketplace is known in URLs, e.g. "ubereats".
+	Name() string
+	// Menu renders a menu the way the marketplace takes it.
+	Menu(m Menu) any
+	// Order reads the order a webhook is about. ok is false for events that are not new orders, which are
+	// acknowledged and ignored. It fails with ErrUnauthorized if the marketplace did not send the request,
+	// and with ErrInvalidOrder if it cannot be read.
+	Order(ctx context.Context, r *http.Request) (o Order, ok bool, err error)
+}
+
+// Config holds the credentials of the marketplaces. A marketplace left unset is not used.
+type Config struct {
+	UberEats UberEatsConfig `json:"ubereats"`
+	DoorDash DoorDashConfig `json:"doordash"`
+}
+
+// Menu is what a store sells on marketplaces, at the prices of the price book.
+type Menu struct {
+	StoreID uuid.UUID
+	At      time.Time
+	Items   []Item
+}
+
+type Item struct {
+	Product string
+	// Price is the unit price before the store's discount, which is taken off the purchase.
+	Price money.Money
+	// Available is false for products the store has run out of what it takes to make.
+	Available bool
+}
+
+// Order is an order placed on a marketplace, for one of our stores.
+type Order struct {
+	Marketplace string
+	// ID is the marketplace's ID of the order.
+	ID      string
+	StoreID uuid.UUID
+	Lines   []Line
+	// Fees are what the customer paid besides the lines, e.g. the marketplace's service fee and the tip of
+	// its courier. They are charged on the purchase, to be settled with whoever they are owed to.
+	Fees []Fee
+}
+
+// Fee is in the minor unit of the currency the lines are priced in.
+type Fee struct {
+	Type   purchase.ChargeType
+	Payee  purchase.Payee
+	Amount int64
+}
+
+// fees are the delivery and service fees the marketplace keeps and the tip its courier gets, leaving out
+// those the order has none of.
+func fees(delivery, service, tip int64) []Fee {
+	var res []Fee
+	for _, f := range []Fee{
+		{Type: purchase.ChargeDeliveryFee, Payee: purchase.PayeeMarketplace, Amount: delivery},
+		{Type: purchase.ChargeServiceFee, Payee: purchase.PayeeMarketplace, Amount: service},
+		{Type: purchase.ChargeCourierTip, Payee: purchase.PayeeCourier, Amount: tip},
+	} {
+		if f.Amount != 0 {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+type Line struct {
+	Product  string
+	Quantity int
+}
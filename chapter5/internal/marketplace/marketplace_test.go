@@ -0,0 +1,126 @@
+package marketplace_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/marketplace"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+)
+
+type noCards struct{}
+
+func (noCards) ChargeCard(context.Context, money.Money, string) error {
+	return errors.New("marketplace orders are not charged")
+}
+
+type noDiscount struct{}
+
+func (noDiscount) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return 0, nil
+}
+
+func Test_MenusAreExportedAndMarketplaceOrdersBecomePurchasesOnce(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	prices := pricing.NewEngine(pricing.Rules{Currency: "USD", BasePrices: map[string]int64{"latte": 400, "croissant": 300}})
+	stock := inventory.NewService(inventory.NewMemoryRepo(), inventory.Recipes{"latte": {"milk_ml": 200}})
+	if err := stock.Restock(ctx, storeID, "milk_ml", 300); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	repo, err := purchase.NewEventSourcedRepo(eventstore.NewMemoryStore(), nil, 1)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	purchases := purchase.NewService(noCards{}, repo, noDiscount{}, purchase.WithPricing(prices), purchase.WithInventory(stock))
+	dd, err := marketplace.NewDoorDash(marketplace.DoorDashConfig{WebhookToken: "secret"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	svc := marketplace.NewService(marketplace.NewMemoryRepo(), prices, stock, purchases, marketplace.WithMarketplace(dd))
+
+	lattes := func() bool {
+		t.Helper()
+		menu, err := svc.ExportMenu(ctx, storeID, "doordash")
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		data, _ := json.Marshal(menu)
+		if !strings.Contains(string(data), `"merchant_supplied_id":"croissant","price":300,"active":true`) {
+			t.Fatalf("expected croissants on the menu at 3.00 but got %s", data)
+		}
+		return strings.Contains(string(data), `"merchant_supplied_id":"latte","price":400,"active":true`)
+	}
+	if !lattes() {
+		t.Fatal("expected lattes on the menu")
+	}
+	if _, err := svc.ExportMenu(ctx, storeID, "grubhub"); !errors.Is(err, marketplace.ErrUnknownMarketplace) {
+		t.Fatalf("expected grubhub to be unknown but got %v", err)
+	}
+
+	webhook := svc.Webhook(dd)
+	send := func(token, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/marketplaces/doordash", strings.NewReader(body))
+		req.Header.Set("Authorization", token)
+		rec := httptest.NewRecorder()
+		webhook.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	order := `{"event": {"type": "OrderCreate"}, "order": {"id": "dd-1", "store": {"merchant_supplied_id": "` + storeID.String() + `"},
+		"categories": [{"items": [{"merchant_supplied_id": "latte", "quantity": 1}, {"merchant_supplied_id": "croissant", "quantity": 2}]}]}}`
+	if code := send("forged", order); code != http.StatusUnauthorized {
+		t.Fatalf("expected a forged webhook to be refused but got %d", code)
+	}
+	// DoorDash retries, but the order is only made once.
+	for range 2 {
+		if code := send("secret", order); code != http.StatusNoContent {
+			t.Fatalf("expected the order to be received but got %d", code)
+		}
+	}
+	if lattes() {
+		t.Fatal("expected lattes off the menu once the milk for one more is gone")
+	}
+	if code := send("secret", strings.Replace(order, `"latte"`, `"cake"`, 1)); code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected an order for something not on the menu to be refused but got %d", code)
+	}
+
+	// An order that could not be made can be sent again once it can.
+	again := marketplace.Order{Marketplace: "doordash", ID: "dd-2", StoreID: storeID, Lines: []marketplace.Line{{Product: "latte", Quantity: 1}}, Fees: []marketplace.Fee{
+		{Type: purchase.ChargeServiceFee, Payee: purchase.PayeeMarketplace, Amount: 99},
+		{Type: purchase.ChargeCourierTip, Payee: purchase.PayeeCourier, Amount: 150},
+	}}
+	if _, err := svc.Receive(ctx, again); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("expected the milk to have run out but got %v", err)
+	}
+	if err := stock.Restock(ctx, storeID, "milk_ml", 1000); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	id, err := svc.Receive(ctx, again)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	p, err := purchases.GetPurchase(ctx, id)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := p.Total(); p.PaymentMeans != payment.MEANS_MARKETPLACE || total.Amount() != 649 || len(p.Charges) != 2 {
+		t.Fatalf("expected a 4.00 latte with its fee and tip paid on the marketplace but got %s by %s, %+v", total.Display(), p.PaymentMeans, p.Charges)
+	}
+	owed := p.Settlement()
+	if store, market, courier := owed[purchase.PayeeStore], owed[purchase.PayeeMarketplace], owed[purchase.PayeeCourier]; store.Amount() != 400 || market.Amount() != 99 || courier.Amount() != 150 {
+		t.Fatalf("expected the latte owed to the store, the fee to the marketplace and the tip to the courier but got %v", owed)
+	}
+}
@@ -0,0 +1,151 @@
+package marketplace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Received is a marketplace order, and the purchase it was made into once it was.
+type Received struct {
+	Marketplace string
+	OrderID     string
+	StoreID     uuid.UUID
+	ReceivedAt  time.Time
+	PurchaseID  uuid.UUID
+}
+
+// Repository remembers the orders received, so an order a marketplace sends twice is only made once.
+type Repository interface {
+	// Claim records an order as received, or returns ErrAlreadyReceived.
+	Claim(ctx context.Context, r Received) error
+	// Complete records the purchase a claimed order was made into.
+	Complete(ctx context.Context, marketplace, orderID string, purchaseID uuid.UUID) error
+	// Release forgets a claimed order that could not be made, so it can be received again.
+	Release(ctx context.Context, marketplace, orderID string) error
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client *mongo.Client
+	orders *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, orders: client.Database("coffeeco").Collection("marketplace_orders")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoReceived struct {
+	ID          string    `bson:"_id"`
+	Marketplace string    `bson:"marketplace"`
+	OrderID     string    `bson:"order_id"`
+	StoreID     string    `bson:"store_id"`
+	ReceivedAt  time.Time `bson:"received_at"`
+	PurchaseID  string    `bson:"purchase_id,omitempty"`
+}
+
+// key identifies an order across marketplaces.
+func key(marketplace, orderID string) string {
+	return marketplace + ":" + orderID
+}
+
+func (m *MongoRepository) Claim(ctx context.Context, r Received) error {
+	_, err := m.orders.InsertOne(ctx, mongoReceived{
+		ID:          key(r.Marketplace, r.OrderID),
+		Marketplace: r.Marketplace,
+		OrderID:     r.OrderID,
+		StoreID:     r.StoreID.String(),
+		ReceivedAt:  r.ReceivedAt,
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %s", ErrAlreadyReceived, key(r.Marketplace, r.OrderID))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim marketplace order: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Complete(ctx context.Context, marketplace, orderID string, purchaseID uuid.UUID) error {
+	res, err := m.orders.UpdateOne(ctx, bson.D{{Key: "_id", Value: key(marketplace, orderID)}}, bson.D{{Key: "$set", Value: bson.D{{Key: "purchase_id", Value: purchaseID.String()}}}})
+	if err != nil {
+		return fmt.Errorf("failed to complete marketplace order: %w", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (m *MongoRepository) Release(ctx context.Context, marketplace, orderID string) error {
+	if _, err := m.orders.DeleteOne(ctx, bson.D{{Key: "_id", Value: key(marketplace, orderID)}}); err != nil {
+		return fmt.Errorf("failed to release marketplace order: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.orders.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps the orders received in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	orders map[string]Received
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{orders: map[string]Received{}}
+}
+
+func (m *MemoryRepository) Claim(_ context.Context, r Received) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key(r.Marketplace, r.OrderID)
+	if _, ok := m.orders[k]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyReceived, k)
+	}
+	m.orders[k] = r
+	return nil
+}
+
+func (m *MemoryRepository) Complete(_ context.Context, marketplace, orderID string, purchaseID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.orders[key(marketplace, orderID)]
+	if !ok {
+		return ErrNotFound
+	}
+	r.PurchaseID = purchaseID
+	m.orders[key(marketplace, orderID)] = r
+	return nil
+}
+
+func (m *MemoryRepository) Release(_ context.Context, marketplace, orderID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.orders, key(marketplace, orderID))
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package marketplace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// Prices is the price book menus are made from, e.g. pricing.Engine.
+type Prices interface {
+	Products(storeID uuid.UUID) []string
+	Quote(ctx context.Context, r pricing.Request) (pricing.Quote, error)
+}
+
+// Stock tells which products a store can make, e.g. inventory.Service.
+type Stock interface {
+	InStock(ctx context.Context, storeID uuid.UUID, products []string) (map[string]bool, error)
+}
+
+// Purchases turns orders into purchases, e.g. purchase.Service.
+type Purchases interface {
+	CompletePurchase(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase, coffeeBuxCard *loyalty.CoffeeBux) error
+}
+
+type Service struct {
+	repo         Repository
+	prices       Prices
+	stock        Stock
+	purchases    Purchases
+	marketplaces map[string]Marketplace
+	logger       *slog.Logger
+	now          func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithMarketplace lets menus be exported to m.
+func WithMarketplace(m Marketplace) Option {
+	return func(s *Service) {
+		s.marketplaces[m.Name()] = m
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test menus during a happy hour.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, prices Prices, stock Stock, purchases Purchases, opts ...Option) *Service {
+	s := &Service{repo: repo, prices: prices, stock: stock, purchases: purchases, marketplaces: map[string]Marketplace{}, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Menu is what the store sells now: every product of the price book, priced as it would be rung up, and
+// whether the store has what it takes to make it.
+func (s *Service) Menu(ctx context.Context, storeID uuid.UUID) (Menu, error) {
+	products := s.prices.Products(storeID)
+	if len(products) == 0 {
+		return Menu{}, ErrNoMenu
+	}
+	m := Menu{StoreID: storeID, At: s.now().UTC()}
+	req := pricing.Request{StoreID: storeID, At: m.At}
+	for _, p := range products {
+		req.Items = append(req.Items, pricing.Item{Product: p})
+	}
+	q, err := s.prices.Quote(ctx, req)
+	if err != nil {
+		return Menu{}, fmt.Errorf("failed to price the menu: %w", err)
+	}
+	inStock, err := s.stock.InStock(ctx, storeID, products)
+	if err != nil {
+		return Menu{}, fmt.Errorf("failed to check the stock of the menu: %w", err)
+	}
+	for i, p := range products {
+		m.Items = append(m.Items, Item{Product: p, Price: q.Lines[i].Unit, Available: inStock[p]})
+	}
+	return m, nil
+}
+
+// ExportMenu renders the store's menu for a marketplace, by name.
+func (s *Service) ExportMenu(ctx context.Context, storeID uuid.UUID, marketplace string) (any, error) {
+	mp, ok := s.marketplaces[marketplace]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMarketplace, marketplace)
+	}
+	m, err := s.Menu(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+	return mp.Menu(m), nil
+}
+
+// Receive makes a purchase of an order, paid with payment.MEANS_MARKETPLACE and priced like any other
+// purchase, and returns its ID. An order is only made once: receiving it again fails with
+// ErrAlreadyReceived, unless the first attempt failed.
+func (s *Service) Receive(ctx context.Context, o Order) (uuid.UUID, error) {
+	if o.ID == "" {
+		return uuid.Nil, fmt.Errorf("%w: the order has no ID", ErrInvalidOrder)
+	}
+	if len(o.Lines) == 0 {
+		return uuid.Nil, fmt.Errorf("%w: %s has no lines", ErrInvalidOrder, o.ID)
+	}
+	menu := s.prices.Products(o.StoreID)
+	p := &purchase.Purchase{Store: store.Ref(o.StoreID), PaymentMeans: payment.MEANS_MARKETPLACE, Channel: purchase.ChannelMarketplace}
+	req := pricing.Request{StoreID: o.StoreID, At: s.now()}
+	for _, l := range o.Lines {
+		if l.Quantity <= 0 {
+			return uuid.Nil, fmt.Errorf("%w: %s has a quantity of %d", ErrInvalidOrder, l.Product, l.Quantity)
+		}
+		if !slices.Contains(menu, l.Product) {
+			return uuid.Nil, fmt.Errorf("%w: %s", ErrNotOnMenu, l.Product)
+		}
+		req.Items = append(req.Items, pricing.Item{Product: l.Product})
+	}
+	// The list prices are only there for the purchase to have something to price; the price book prices it.
+	q, err := s.prices.Quote(ctx, req)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to price marketplace order: %w", err)
+	}
+	for i, l := range o.Lines {
+		for range l.Quantity {
+			p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{ItemName: l.Product, BasePrice: q.Lines[i].Unit})
+		}
+	}
+	for _, f := range o.Fees {
+		if f.Amount <= 0 {
+			return uuid.Nil, fmt.Errorf("%w: %s of %d", ErrInvalidOrder, f.Type, f.Amount)
+		}
+		p.Charges = append(p.Charges, purchase.Charge{Type: f.Type, Payee: f.Payee, Amount: *money.New(f.Amount, q.Total.Currency().Code)})
+	}
+
+	if err := s.repo.Claim(ctx, Received{Marketplace: o.Marketplace, OrderID: o.ID, StoreID: o.StoreID, ReceivedAt: s.now().UTC()}); err != nil {
+		return uuid.Nil, err
+	}
+	if err := s.purchases.CompletePurchase(ctx, o.StoreID, p, nil); err != nil {
+		if rerr := s.repo.Release(context.WithoutCancel(ctx), o.Marketplace, o.ID); rerr != nil {
+			s.logger.ErrorContext(ctx, "failed marketplace order cannot be received again", "marketplace", o.Marketplace, "order_id", o.ID, "error", rerr)
+		}
+		return uuid.Nil, err
+	}
+	if err := s.repo.Complete(ctx, o.Marketplace, o.ID, p.ID); err != nil {
+		s.logger.ErrorContext(ctx, "marketplace order made a purchase that was not recorded against it", "marketplace", o.Marketplace, "order_id", o.ID, "purchase_id", p.ID, "error", err)
+	}
+	return p.ID, nil
+}
+
+// Webhook receives the orders of a marketplace. Marketplaces retry anything but a 2xx, so orders already
+// received are acknowledged, orders that cannot be made are refused with a 422, and failures to make them
+// are returned as 5xx.
+func (s *Service) Webhook(m Marketplace) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o, ok, err := m.Order(r.Context(), r)
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		case errors.Is(err, ErrInvalidOrder):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			s.logger.ErrorContext(r.Context(), "failed to read marketplace order", "marketplace", m.Name(), "error", err)
+			http.Error(w, "order not read", http.StatusBadGateway)
+			return
+		case !ok:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		o.Marketplace = m.Name()
+		id, err := s.Receive(r.Context(), o)
+		switch {
+		case err == nil:
+			s.logger.InfoContext(r.Context(), "marketplace order received", "marketplace", o.Marketplace, "order_id", o.ID, "purchase_id", id)
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrAlreadyReceived):
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, ErrInvalidOrder), errors.Is(err, ErrNotOnMenu), errors.Is(err, inventory.ErrOutOfStock):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			s.logger.ErrorContext(r.Context(), "failed to make a purchase of a marketplace order", "marketplace", o.Marketplace, "order_id", o.ID, "error", err)
+			http.Error(w, "order not received", http.StatusInternalServerError)
+		}
+	})
+}
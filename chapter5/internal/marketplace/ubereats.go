@@ -0,0 +1,282 @@
+package marketplace
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	uberEatsURL     = "https://api.uber.com"
+	uberEatsAuthURL = "https://auth.uber.com"
+)
+
+// UberEatsConfig holds the credentials of the app made in Uber's developer dashboard. Stores are linked to
+// ours by setting their external reference ID to the ID of our store.
+type UberEatsConfig struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// BaseURL and AuthURL default to Uber's; set them to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+	AuthURL string `json:"auth_url,omitempty"`
+}
+
+// UberEats takes menus in the format of the Uber Eats Menu API. Its webhooks only tell that there is an
+// order, which is then read from the Order API.
+type UberEats struct {
+	cfg    UberEatsConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewUberEats(cfg UberEatsConfig, client *http.Client) (*UberEats, error) {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("uber eats needs a client ID and client secret")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = uberEatsURL
+	}
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = uberEatsAuthURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &UberEats{cfg: cfg, client: client}, nil
+}
+
+func (u *UberEats) Name() string {
+	return "ubereats"
+}
+
+type uberEatsText struct {
+	Translations map[string]string `json:"translations"`
+}
+
+func uberEatsTitle(s string) uberEatsText {
+	return uberEatsText{Translations: map[string]string{"en_us": s}}
+}
+
+type uberEatsMenu struct {
+	Menus      []uberEatsMenuEntry `json:"menus"`
+	Categories []uberEatsCategory  `json:"categories"`
+	Items      []uberEatsItem      `json:"items"`
+}
+
+type uberEatsMenuEntry struct {
+	ID                  string                 `json:"id"`
+	Title               uberEatsText           `json:"title"`
+	ServiceAvailability []uberEatsAvailability `json:"service_availability"`
+	CategoryIDs         []string               `json:"category_ids"`
+}
+
+type uberEatsAvailability struct {
+	DayOfWeek   string              `json:"day_of_week"`
+	TimePeriods []map[string]string `json:"time_periods"`
+}
+
+type uberEatsCategory struct {
+	ID       string           `json:"id"`
+	Title    uberEatsText     `json:"title"`
+	Entities []uberEatsEntity `json:"entities"`
+}
+
+type uberEatsEntity struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type uberEatsItem struct {
+	ID             string              `json:"id"`
+	ExternalData   string              `json:"external_data"`
+	Title          uberEatsText        `json:"title"`
+	PriceInfo      map[string]int64    `json:"price_info"`
+	SuspensionInfo *uberEatsSuspension `json:"suspension_info,omitempty"`
+}
+
+type uberEatsSuspension struct {
+	Suspension struct {
+		SuspendUntil int64  `json:"suspend_until"`
+		Reason       string `json:"reason"`
+	} `json:"suspension"`
+}
+
+// Menu lists every product under one menu available all week; the store's own hours still apply. Products
+// that are out of stock are suspended for a day, or until the menu is exported again.
+func (u *UberEats) Menu(m Menu) any {
+	res := uberEatsMenu{
+		Menus:      []uberEatsMenuEntry{{ID: "coffeeco", Title: uberEatsTitle("Menu"), CategoryIDs: []string{"all"}}},
+		Categories: []uberEatsCategory{{ID: "all", Title: uberEatsTitle("Menu")}},
+	}
+	for _, day := range []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"} {
+		res.Menus[0].ServiceAvailability = append(res.Menus[0].ServiceAvailability, uberEatsAvailability{
+			DayOfWeek:   day,
+			TimePeriods: []map[string]string{{"start_time": "00:00", "end_time": "23:59"}},
+		})
+	}
+	for _, it := range m.Items {
+		item := uberEatsItem{
+			ID:           it.Product,
+			ExternalData: it.Product,
+			Title:        uberEatsTitle(it.Product),
+			PriceInfo:    map[string]int64{"price": it.Price.Amount()},
+		}
+		if !it.Available {
+			item.SuspensionInfo = &uberEatsSuspension{}
+			item.SuspensionInfo.Suspension.SuspendUntil = m.At.Add(24 * time.Hour).Unix()
+			item.SuspensionInfo.Suspension.Reason = "out of stock"
+		}
+		res.Categories[0].Entities = append(res.Categories[0].Entities, uberEatsEntity{ID: it.Product, Type: "ITEM"})
+		res.Items = append(res.Items, item)
+	}
+	return res
+}
+
+type uberEatsEvent struct {
+	EventType string `json:"event_type"`
+	Meta      struct {
+		ResourceID string `json:"resource_id"`
+	} `json:"meta"`
+}
+
+type uberEatsOrder struct {
+	ID    string `json:"id"`
+	Store struct {
+		ExternalReferenceID string `json:"external_reference_id"`
+	} `json:"store"`
+	Cart struct {
+		Items []struct {
+			ID           string `json:"id"`
+			ExternalData string `json:"external_data"`
+			Quantity     int    `json:"quantity"`
+		} `json:"items"`
+	} `json:"cart"`
+	Payment struct {
+		Charges struct {
+			DeliveryFee uberEatsAmount `json:"delivery_fee"`
+			ServiceFee  uberEatsAmount `json:"service_fee"`
+			Tip         uberEatsAmount `json:"tip"`
+		} `json:"charges"`
+	} `json:"payment"`
+}
+
+// uberEatsAmount is in the minor unit of the currency.
+type uberEatsAmount struct {
+	Amount int64 `json:"amount"`
+}
+
+// Order checks the X-Uber-Signature of the webhook, an HMAC-SHA256 of the body keyed with the client
+// secret, then reads the order it notifies.
+func (u *UberEats) Order(ctx context.Context, r *http.Request) (Order, bool, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return Order{}, false, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	h := hmac.New(sha256.New, []byte(u.cfg.ClientSecret))
+	h.Write(body)
+	if !hmac.Equal([]byte(strings.ToLower(r.Header.Get("X-Uber-Signature"))), []byte(hex.EncodeToString(h.Sum(nil)))) {
+		return Order{}, false, ErrUnauthorized
+	}
+	var e uberEatsEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return Order{}, false, fmt.Errorf("%w: %w", ErrInvalidOrder, err)
+	}
+	if e.EventType != "orders.notification" {
+		return Order{}, false, nil
+	}
+	if e.Meta.ResourceID == "" {
+		return Order{}, false, fmt.Errorf("%w: the notification names no order", ErrInvalidOrder)
+	}
+	var res uberEatsOrder
+	if err := u.get(ctx, "/v1/eats/order/"+url.PathEscape(e.Meta.ResourceID), &res); err != nil {
+		return Order{}, false, err
+	}
+	storeID, err := uuid.Parse(res.Store.ExternalReferenceID)
+	if err != nil {
+		return Order{}, false, fmt.Errorf("%w: store %q is not linked to one of ours", ErrInvalidOrder, res.Store.ExternalReferenceID)
+	}
+	charges := res.Payment.Charges
+	o := Order{ID: res.ID, StoreID: storeID, Fees: fees(charges.DeliveryFee.Amount, charges.ServiceFee.Amount, charges.Tip.Amount)}
+	for _, it := range res.Cart.Items {
+		o.Lines = append(o.Lines, Line{Product: cmp.Or(it.ExternalData, it.ID), Quantity: it.Quantity})
+	}
+	return o, true, nil
+}
+
+func (u *UberEats) get(ctx context.Context, path string, res any) error {
+	token, err := u.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.cfg.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach uber eats: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("uber eats GET %s: %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("failed to decode uber eats response: %w", err)
+	}
+	return nil
+}
+
+// accessToken gets a client credentials token for the Order API, and keeps it until shortly before it
+// expires.
+func (u *UberEats) accessToken(ctx context.Context) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.token != "" && time.Now().Before(u.expires) {
+		return u.token, nil
+	}
+	form := url.Values{
+		"client_id":     {u.cfg.ClientID},
+		"client_secret": {u.cfg.ClientSecret},
+		"grant_type":    {"client_credentials"},
+		"scope":         {"eats.order"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.cfg.AuthURL+"/oauth/v2/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach uber auth: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("uber auth refused the client credentials: %d", resp.StatusCode)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("failed to decode uber auth token: %w", err)
+	}
+	u.token, u.expires = t.AccessToken, time.Now().Add(time.Duration(t.ExpiresIn)*time.Second-time.Minute)
+	return u.token, nil
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// CardCharges times every charge made through c.
+func (m *Metrics) CardCharges(c purchase.CardChargeService) purchase.CardChargeService {
+	return timedCharges{CardChargeService: c, m: m}
+}
+
+type timedCharges struct {
+	purchase.CardChargeService
+	m *Metrics
+}
+
+func (t timedCharges) ChargeCard(ctx context.Context, amount money.Money, cardToken string) error {
+	start := time.Now()
+	err := t.CardChargeService.ChargeCard(ctx, amount, cardToken)
+	t.m.chargeLatency.WithLabelValues(outcome(err)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Purchases times the operations of r. Looking up a purchase that does not exist is not an error.
+func (m *Metrics) Purchases(r purchase.Repository) purchase.Repository {
+	return timedPurchases{Repository: r, m: m}
+}
+
+type timedPurchases struct {
+	purchase.Repository
+	m *Metrics
+}
+
+func (t timedPurchases) Store(ctx context.Context, p *purchase.Purchase) error {
+	start := time.Now()
+	err := t.Repository.Store(ctx, p)
+	t.m.observeRepository("purchases", "store", start, err)
+	return err
+}
+
+func (t timedPurchases) Get(ctx context.Context, id uuid.UUID) (purchase.Purchase, error) {
+	start := time.Now()
+	p, err := t.Repository.Get(ctx, id)
+	failed := err
+	if errors.Is(err, purchase.ErrNotFound) {
+		failed = nil
+	}
+	t.m.observeRepository("purchases", "get", start, failed)
+	return p, err
+}
+
+// LoyaltyCards times the operations of r. Looking up a card that does not exist is not an error.
+func (m *Metrics) LoyaltyCards(r loyalty.Repository) loyalty.Repository {
+	return timedCards{Repository: r, m: m}
+}
+
+type timedCards struct {
+	loyalty.Repository
+	m *Metrics
+}
+
+func (t timedCards) Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error) {
+	start := time.Now()
+	c, err := t.Repository.Get(ctx, id)
+	failed := err
+	if errors.Is(err, loyalty.ErrNotFound) {
+		failed = nil
+	}
+	t.m.observeRepository("loyalty_cards", "get", start, failed)
+	return c, err
+}
+
+func (t timedCards) Save(ctx context.Context, card *loyalty.CoffeeBux) error {
+	start := time.Now()
+	err := t.Repository.Save(ctx, card)
+	t.m.observeRepository("loyalty_cards", "save", start, err)
+	return err
+}
+
+// Stores times the lookups of r on the purchase path. A store without a discount is not an error.
+func (m *Metrics) Stores(r store.Repository) store.Repository {
+	return timedStores{Repository: r, m: m}
+}
+
+type timedStores struct {
+	store.Repository
+	m *Metrics
+}
+
+func (t timedStores) GetStoreDiscount(ctx context.Context, storeID uuid.UUID) (int64, error) {
+	start := time.Now()
+	d, err := t.Repository.GetStoreDiscount(ctx, storeID)
+	failed := err
+	if errors.Is(err, store.ErrNoDiscount) {
+		failed = nil
+	}
+	t.m.observeRepository("stores", "get_discount", start, failed)
+	return d, err
+}
+
+func (t timedStores) GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	start := time.Now()
+	s, err := t.Repository.GetStores(ctx, ids)
+	t.m.observeRepository("stores", "get_many", start, err)
+	return s, err
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+const namespace = "coffeeco"
+
+// Metrics are the business and technical KPIs of the purchase path, exported for Prometheus. It is a
+// purchase.Recorder and a command.Recorder, and wraps the card gateway and repositories to time them.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	purchasesCompleted *prometheus.CounterVec
+	discounts          *prometheus.HistogramVec
+	failedPayments     *prometheus.CounterVec
+	loyaltyRedemptions prometheus.Counter
+	chargeLatency      *prometheus.HistogramVec
+	repositoryLatency  *prometheus.HistogramVec
+	preOrderCaptures   *prometheus.HistogramVec
+	cacheLookups       *prometheus.CounterVec
+	commands           *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		purchasesCompleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "purchases_completed_total",
+			Help:      "Purchases completed, by payment means.",
+		}, []string{"means"}),
+		discounts: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_discount_percent",
+			Help:      "Store discounts applied to completed purchases, in percent; purchases without one are not observed.",
+			Buckets:   []float64{5, 10, 15, 20, 25, 50, 100},
+		}, []string{"means"}),
+		failedPayments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_failed_total",
+			Help:      "Payments that failed, by payment means and decline code.",
+		}, []string{"means", "decline_code"}),
+		loyaltyRedemptions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "loyalty_drinks_redeemed_total",
+			Help:      "Free drinks paid for with CoffeeBux.",
+		}),
+		chargeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "card_charge_duration_seconds",
+			Help:      "Time taken to charge a card, by outcome.",
+			Buckets:   []float64{.1, .25, .5, 1, 2, 4, 8, 16},
+		}, []string{"outcome"}),
+		repositoryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_operation_duration_seconds",
+			Help:      "Time taken by repository operations, by repository, operation and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"repository", "operation", "outcome"}),
+		preOrderCaptures: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "pre_order_capture_duration_seconds",
+			Help:      "Time taken to capture the authorization of a pre-order, by gateway and outcome; its count is the capture throughput.",
+			Buckets:   []float64{.1, .25, .5, 1, 2, 4, 8, 16},
+		}, []string{"gateway", "outcome"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Cache lookups, by cache and result (hit or miss).",
+		}, []string{"cache", "result"}),
+		commands: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_duration_seconds",
+			Help:      "Time taken to handle commands, by command and outcome.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command", "outcome"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.purchasesCompleted,
+		m.discounts,
+		m.failedPayments,
+		m.loyaltyRedemptions,
+		m.chargeLatency,
+		m.repositoryLatency,
+		m.preOrderCaptures,
+		m.cacheLookups,
+		m.commands,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format, for /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) PurchaseCompleted(p *purchase.Purchase, discountPercent float32) {
+	means := string(p.PaymentMeans)
+	m.purchasesCompleted.WithLabelValues(means).Inc()
+	if discountPercent > 0 {
+		m.discounts.WithLabelValues(means).Observe(float64(discountPercent))
+	}
+	if p.PaymentMeans == payment.MEANS_COFFEEBUX {
+		m.loyaltyRedemptions.Add(float64(len(p.ProductsToPurchase)))
+	}
+}
+
+func (m *Metrics) PaymentFailed(means payment.Means, reason string) {
+	m.failedPayments.WithLabelValues(string(means), reason).Inc()
+}
+
+func (m *Metrics) PreOrderCaptureAttempted(gateway, outcome string, took time.Duration) {
+	m.preOrderCaptures.WithLabelValues(gateway, outcome).Observe(took.Seconds())
+}
+
+func (m *Metrics) CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// CommandHandled makes Metrics a command.Recorder.
+func (m *Metrics) CommandHandled(name string, took time.Duration, err error) {
+	m.commands.WithLabelValues(name, outcome(err)).Observe(took.Seconds())
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+func (m *Metrics) observeRepository(repository, operation string, start time.Time, err error) {
+	m.repositoryLatency.WithLabelValues(repository, operation, outcome(err)).Observe(time.Since(start).Seconds())
+}
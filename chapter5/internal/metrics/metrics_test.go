@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/metrics"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+type missingPurchases struct{}
+
+func (missingPurchases) Store(context.Context, *purchase.Purchase) error {
+	return errors.New("mongo is down")
+}
+
+func (missingPurchases) Get(context.Context, uuid.UUID) (purchase.Purchase, error) {
+	return purchase.Purchase{}, purchase.ErrNotFound
+}
+
+func (missingPurchases) Ping(context.Context) error {
+	return nil
+}
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func Test_KPIsAreExported(t *testing.T) {
+	m := metrics.New()
+	m.PurchaseCompleted(&purchase.Purchase{
+		PaymentMeans:       payment.MEANS_COFFEEBUX,
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte"}, {ItemName: "flat white"}},
+	}, 10)
+	m.PaymentFailed(payment.MEANS_CARD, "insufficient_funds")
+
+	repo := m.Purchases(missingPurchases{})
+	_, _ = repo.Get(context.Background(), uuid.New())
+	_ = repo.Store(context.Background(), &purchase.Purchase{})
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`coffeeco_purchases_completed_total{means="coffeebux"} 1`,
+		`coffeeco_store_discount_percent_sum{means="coffeebux"} 10`,
+		`coffeeco_loyalty_drinks_redeemed_total 2`,
+		`coffeeco_payments_failed_total{decline_code="insufficient_funds",means="card"} 1`,
+		`coffeeco_repository_operation_duration_seconds_count{operation="get",outcome="ok",repository="purchases"} 1`,
+		`coffeeco_repository_operation_duration_seconds_count{operation="store",outcome="error",repository="purchases"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in\n%s", want, out)
+		}
+	}
+}
+
+func Test_PoolSaturationIsExported(t *testing.T) {
+	m := metrics.New()
+	m.PostgresPool("purchase", func() eventstore.PoolStats {
+		return eventstore.PoolStats{Acquired: 10, Max: 10, Acquires: 40, EmptyAcquires: 7, AcquireWait: 1500 * time.Millisecond}
+	})
+	m.PostgresPool("reports", func() eventstore.PoolStats { return eventstore.PoolStats{Idle: 2, Max: 4} })
+
+	out := scrape(t, m)
+	for _, want := range []string{
+		`coffeeco_db_pool_connections{pool="purchase",state="acquired"} 10`,
+		`coffeeco_db_pool_max_connections{pool="purchase"} 10`,
+		`coffeeco_db_pool_acquire_waits_total{pool="purchase"} 7`,
+		`coffeeco_db_pool_acquire_wait_seconds_total{pool="purchase"} 1.5`,
+		`coffeeco_db_pool_connections{pool="reports",state="idle"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %s in\n%s", want, out)
+		}
+	}
+}
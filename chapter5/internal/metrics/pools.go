@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"coffeeco/internal/eventstore"
+)
+
+// poolCollector reads the stats of a database pool when it is scraped. The pool is a constant label, so
+// every pool gets descriptions of its own and any number of them can be registered.
+type poolCollector struct {
+	stats func() eventstore.PoolStats
+
+	connections    *prometheus.Desc
+	maxConnections *prometheus.Desc
+	acquires       *prometheus.Desc
+	waits          *prometheus.Desc
+	canceled       *prometheus.Desc
+	waitSeconds    *prometheus.Desc
+}
+
+func newPoolCollector(name string, stats func() eventstore.PoolStats) poolCollector {
+	desc := func(metric, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", metric), help, labels, prometheus.Labels{"pool": name})
+	}
+	return poolCollector{
+		stats:          stats,
+		connections:    desc("connections", "Connections of a database pool, by state (acquired or idle).", "state"),
+		maxConnections: desc("max_connections", "Connections a database pool opens at most."),
+		acquires:       desc("acquires_total", "Connections handed out by a database pool."),
+		waits:          desc("acquire_waits_total", "Acquires that waited for a connection because all were busy; its rate rising means the pool is saturated."),
+		canceled:       desc("acquires_canceled_total", "Acquires that gave up waiting for a connection."),
+		waitSeconds:    desc("acquire_wait_seconds_total", "Time spent acquiring connections."),
+	}
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.connections, c.maxConnections, c.acquires, c.waits, c.canceled, c.waitSeconds} {
+		ch <- d
+	}
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(s.Acquired), "acquired")
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(s.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(c.maxConnections, prometheus.GaugeValue, float64(s.Max))
+	ch <- prometheus.MustNewConstMetric(c.acquires, prometheus.CounterValue, float64(s.Acquires))
+	ch <- prometheus.MustNewConstMetric(c.waits, prometheus.CounterValue, float64(s.EmptyAcquires))
+	ch <- prometheus.MustNewConstMetric(c.canceled, prometheus.CounterValue, float64(s.CanceledAcquires))
+	ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, s.AcquireWait.Seconds())
+}
+
+// PostgresPool exports the connection pool of a Postgres store under name, e.g. "purchase". stats is read
+// on every scrape, e.g. eventstore.PostgresStore.PoolStats.
+func (m *Metrics) PostgresPool(name string, stats func() eventstore.PoolStats) {
+	m.registry.MustRegister(newPoolCollector(name, stats))
+}
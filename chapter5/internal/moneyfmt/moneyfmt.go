@@ -0,0 +1,169 @@
+package moneyfmt
+
+import (
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Rhymond/go-money"
+)
+
+// Locale is how a country writes amounts. The zero Locale writes each currency the way go-money's Display
+// does, e.g. $4.50 and 4,50 €, whatever the country.
+type Locale struct {
+	// Tag is the BCP 47 tag of the locale, e.g. "de-DE".
+	Tag      string
+	Decimal  string
+	Thousand string
+	// SymbolFirst writes the symbol before the amount, as in £4.50, rather than after it, as in 4,50 €.
+	SymbolFirst bool
+	// Space separates the symbol from the amount.
+	Space bool
+}
+
+// Locales are the locales receipts can be written in, by tag.
+var Locales = map[string]Locale{
+	"en-US": {Tag: "en-US", Decimal: ".", Thousand: ",", SymbolFirst: true},
+	"en-GB": {Tag: "en-GB", Decimal: ".", Thousand: ",", SymbolFirst: true},
+	"en-IE": {Tag: "en-IE", Decimal: ".", Thousand: ",", SymbolFirst: true},
+	"de-DE": {Tag: "de-DE", Decimal: ",", Thousand: ".", Space: true},
+	"fr-FR": {Tag: "fr-FR", Decimal: ",", Thousand: "\u202f", Space: true},
+	"es-ES": {Tag: "es-ES", Decimal: ",", Thousand: ".", Space: true},
+	"it-IT": {Tag: "it-IT", Decimal: ",", Thousand: ".", Space: true},
+	"nl-NL": {Tag: "nl-NL", Decimal: ",", Thousand: ".", SymbolFirst: true, Space: true},
+	"de-CH": {Tag: "de-CH", Decimal: ".", Thousand: "\u2019", SymbolFirst: true, Space: true},
+	"ja-JP": {Tag: "ja-JP", Decimal: ".", Thousand: ",", SymbolFirst: true},
+}
+
+// LocaleFor looks up the locale of tag, falling back to the first of Locales in its language, e.g. "de" and
+// "de-AT" to "de-DE". It is false for a tag in a language there is no locale for.
+func LocaleFor(tag string) (Locale, bool) {
+	if l, ok := Locales[tag]; ok {
+		return l, true
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	// The first of each language in a fixed order, so the fallback does not change from run to run.
+	for _, t := range []string{"en-US", "de-DE", "fr-FR", "es-ES", "it-IT", "nl-NL", "ja-JP"} {
+		if l, _, _ := strings.Cut(t, "-"); strings.EqualFold(l, lang) {
+			return Locales[t], true
+		}
+	}
+	return Locale{}, false
+}
+
+// currency is what go-money knows of code, or what it writes for a currency it does not know.
+func currency(code string) *money.Currency {
+	if c := money.GetCurrency(code); c != nil {
+		return c
+	}
+	return &money.Currency{Code: code, Decimal: ".", Thousand: ",", Fraction: 2, Grapheme: code, Template: "1$"}
+}
+
+// Append appends amount, in the minor unit of currency, to dst as loc writes it. It allocates nothing
+// once dst has room, which is what receipts and logs formatting thousands of amounts want.
+func Append(dst []byte, amount int64, code string, loc Locale) []byte {
+	c := currency(code)
+	if amount < 0 {
+		dst = append(dst, '-')
+	}
+	if loc.Decimal == "" {
+		for i := 0; i < len(c.Template); i++ {
+			switch c.Template[i] {
+			case '1':
+				dst = appendNumber(dst, amount, c.Fraction, c.Decimal, c.Thousand)
+			case '$':
+				dst = append(dst, c.Grapheme...)
+			default:
+				dst = append(dst, c.Template[i])
+			}
+		}
+		return dst
+	}
+	if loc.SymbolFirst {
+		dst = append(dst, c.Grapheme...)
+		if loc.Space {
+			dst = append(dst, ' ')
+		}
+	}
+	dst = appendNumber(dst, amount, c.Fraction, loc.Decimal, loc.Thousand)
+	if !loc.SymbolFirst {
+		if loc.Space {
+			dst = append(dst, ' ')
+		}
+		dst = append(dst, c.Grapheme...)
+	}
+	return dst
+}
+
+// appendNumber appends the absolute amount with fraction digits after the decimal separator.
+func appendNumber(dst []byte, amount int64, fraction int, decimal, thousand string) []byte {
+	var digits [24]byte
+	u := uint64(amount)
+	if amount < 0 {
+		u = -u
+	}
+	d := strconv.AppendUint(digits[:0], u, 10)
+	// Amounts under one unit have a leading zero, e.g. 0.05.
+	var padded [24]byte
+	if len(d) <= fraction {
+		n := copy(padded[:], "0000000000000000000000"[:fraction-len(d)+1])
+		d = append(padded[:n], d...)
+	}
+	whole := len(d) - fraction
+	for i := 0; i < whole; i++ {
+		if i > 0 && (whole-i)%3 == 0 {
+			dst = append(dst, thousand...)
+		}
+		dst = append(dst, d[i])
+	}
+	if fraction > 0 {
+		dst = append(dst, decimal...)
+		dst = append(dst, d[whole:]...)
+	}
+	return dst
+}
+
+var buffers = sync.Pool{New: func() any {
+	b := make([]byte, 0, 64)
+	return &b
+}}
+
+// Format is Append to a string. The string is its only allocation; the buffer it is written in is pooled.
+func Format(amount int64, code string, loc Locale) string {
+	b := buffers.Get().(*[]byte)
+	*b = Append((*b)[:0], amount, code, loc)
+	s := string(*b)
+	buffers.Put(b)
+	return s
+}
+
+// Write writes amount to w as loc writes it, through a pooled buffer, e.g. into a receipt being rendered.
+func Write(w io.Writer, amount int64, code string, loc Locale) (int, error) {
+	b := buffers.Get().(*[]byte)
+	*b = Append((*b)[:0], amount, code, loc)
+	n, err := w.Write(*b)
+	buffers.Put(b)
+	return n, err
+}
+
+// Amount is logged formatted, e.g. slog.Any("total", moneyfmt.Amount{450, "USD"}), only by the handlers
+// that log it: a debug attribute costs nothing at the info level.
+type Amount struct {
+	Amount   int64
+	Currency string
+}
+
+func (a Amount) LogValue() slog.Value {
+	return slog.StringValue(Format(a.Amount, a.Currency, Locale{}))
+}
+
+// AppendText lets encoders that append, such as encoding/json, write the amount without a string.
+func (a Amount) AppendText(dst []byte) ([]byte, error) {
+	return Append(dst, a.Amount, a.Currency, Locale{}), nil
+}
+
+func (a Amount) MarshalText() ([]byte, error) {
+	return a.AppendText(nil)
+}
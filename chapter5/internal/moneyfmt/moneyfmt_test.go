@@ -0,0 +1,104 @@
+package moneyfmt_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/moneyfmt"
+)
+
+func Test_TheZeroLocaleWritesAmountsAsGoMoneyDoes(t *testing.T) {
+	amounts := []int64{0, 5, 45, 450, 1000, 123456, 100000000, -1, -450, -1234567}
+	for _, code := range []string{"USD", "GBP", "EUR", "JPY", "BHD", "CHF", "CLF", "SEK", "INR", "XYZ"} {
+		for _, a := range amounts {
+			want := money.New(a, code).Display()
+			if got := moneyfmt.Format(a, code, moneyfmt.Locale{}); got != want {
+				t.Errorf("expected %d %s written %q but got %q", a, code, want, got)
+			}
+		}
+	}
+}
+
+func Test_LocalesWriteAmountsTheWayTheirCountriesDo(t *testing.T) {
+	tests := []struct {
+		tag    string
+		amount int64
+		code   string
+		want   string
+	}{
+		{"en-US", 123450, "USD", "$1,234.50"},
+		{"en-GB", -450, "GBP", "-£4.50"},
+		{"de-DE", 123450, "EUR", "1.234,50 €"},
+		{"fr-FR", 123450, "EUR", "1\u202f234,50 €"},
+		{"nl-NL", 5, "EUR", "€ 0,05"},
+		{"ja-JP", 1500, "JPY", "¥1,500"},
+		{"de-AT", 450, "EUR", "4,50 €"},
+	}
+	for _, tt := range tests {
+		loc, ok := moneyfmt.LocaleFor(tt.tag)
+		if !ok {
+			t.Fatalf("expected a locale for %s", tt.tag)
+		}
+		if got := moneyfmt.Format(tt.amount, tt.code, loc); got != tt.want {
+			t.Errorf("expected %d %s written %q in %s but got %q", tt.amount, tt.code, tt.want, tt.tag, got)
+		}
+	}
+	if _, ok := moneyfmt.LocaleFor("sw-KE"); ok {
+		t.Error("expected no locale for a language there is none in")
+	}
+}
+
+func Test_AppendAndWriteDoNotAllocate(t *testing.T) {
+	loc, _ := moneyfmt.LocaleFor("de-DE")
+	buf := make([]byte, 0, 64)
+	if n := testing.AllocsPerRun(100, func() { buf = moneyfmt.Append(buf[:0], 123450, "EUR", loc) }); n != 0 {
+		t.Errorf("expected Append not to allocate but it did %.0f times", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { _, _ = moneyfmt.Write(io.Discard, 123450, "EUR", loc) }); n != 0 {
+		t.Errorf("expected Write not to allocate but it did %.0f times", n)
+	}
+}
+
+// The benchmarks compare the ways a receipt line's amount can be written, e.g.
+//
+//	go test -run '^$' -bench Format -benchmem ./internal/moneyfmt
+func BenchmarkFormat(b *testing.B) {
+	b.Run("sprintf", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_ = fmt.Sprintf("$%d.%02d", int64(i)/100, int64(i)%100)
+		}
+	})
+	b.Run("display", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_ = money.New(int64(i), "USD").Display()
+		}
+	})
+	b.Run("format", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_ = moneyfmt.Format(int64(i), "USD", moneyfmt.Locale{})
+		}
+	})
+	b.Run("append", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 64)
+		for i := range b.N {
+			buf = moneyfmt.Append(buf[:0], int64(i), "USD", moneyfmt.Locale{})
+		}
+	})
+	b.Run("write", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			var i int64
+			for pb.Next() {
+				_, _ = moneyfmt.Write(io.Discard, i, "USD", moneyfmt.Locale{})
+				i++
+			}
+		})
+	})
+}
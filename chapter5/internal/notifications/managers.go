@@ -0,0 +1,74 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/cash"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/purchase"
+)
+
+// Managers emails the manager of a store about purchases waiting for their review, see
+// purchase.WithReviewNotifier, and cash that does not add up, see cash.WithNotifier. Stores without a
+// manager's address are not told.
+type Managers struct {
+	email  Notifier
+	to     map[uuid.UUID]string
+	locale moneyfmt.Locale
+}
+
+// NewManagers sends to the address of each store's manager in to, by store ID.
+func NewManagers(email Notifier, to map[uuid.UUID]string, loc moneyfmt.Locale) *Managers {
+	return &Managers{email: email, to: to, locale: loc}
+}
+
+func (m *Managers) ReviewRequested(ctx context.Context, r *purchase.Review) error {
+	to, ok := m.to[r.StoreID]
+	if !ok {
+		return nil
+	}
+	total := r.Purchase.Total()
+	amount := moneyfmt.Format(total.Amount(), total.Currency().Code, m.locale)
+	var body strings.Builder
+	fmt.Fprintf(&body, "A purchase of %s at your store is waiting for your approval before the card is charged.\n\n", amount)
+	for _, p := range r.Purchase.ProductsToPurchase {
+		fmt.Fprintf(&body, "  %s\n", p.ItemName)
+	}
+	fmt.Fprintf(&body, "\nIt is cancelled at %s unless you approve it:\n\n", r.ExpiresAt.Format("15:04 MST"))
+	fmt.Fprintf(&body, "  coffeectl review approve -purchase %s\n  coffeectl review reject -purchase %s -reason ...\n", r.ID(), r.ID())
+	if err := m.email.Send(ctx, Message{To: to, Subject: "Purchase of " + amount + " to review", Body: body.String()}); err != nil {
+		return fmt.Errorf("failed to email the store's manager: %w", err)
+	}
+	return nil
+}
+
+func (m *Managers) CashDiscrepancy(ctx context.Context, d cash.Discrepancy) error {
+	to, ok := m.to[d.StoreID]
+	if !ok {
+		return nil
+	}
+	what, counted, short := "The drawer of your store", "Counted", "short"
+	if d.Kind == "deposit" {
+		what, counted = "A cash deposit of your store", "Banked"
+	}
+	diff := d.Difference()
+	if diff > 0 {
+		short = "over"
+	} else {
+		diff = -diff
+	}
+	amount := moneyfmt.Format(diff, d.Currency, m.locale)
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s is %s %s.\n\n", what, amount, short)
+	fmt.Fprintf(&body, "  Expected  %s\n", moneyfmt.Format(d.Expected, d.Currency, m.locale))
+	fmt.Fprintf(&body, "  %-9s %s\n", counted, moneyfmt.Format(d.Counted, d.Currency, m.locale))
+	fmt.Fprintf(&body, "\n%s by %s at %s.\n", counted, d.By, d.At.Format("2006-01-02 15:04 MST"))
+	if err := m.email.Send(ctx, Message{To: to, Subject: "Cash " + amount + " " + short, Body: body.String()}); err != nil {
+		return fmt.Errorf("failed to email the store's manager: %w", err)
+	}
+	return nil
+}
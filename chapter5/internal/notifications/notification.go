@@ -0,0 +1,146 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/receipt"
+)
+
+var (
+	ErrNotFound       = errors.New("notification preferences not found")
+	ErrUnknownChannel = errors.New("unknown notification channel")
+	ErrUnknownTopic   = errors.New("unknown notification topic")
+)
+
+// Channel is how a customer is reached.
+type Channel string
+
+const (
+	ChannelEmail Channel = "email"
+	ChannelSMS   Channel = "sms"
+	ChannelPush  Channel = "push"
+)
+
+func (c Channel) valid() bool {
+	switch c {
+	case ChannelEmail, ChannelSMS, ChannelPush:
+		return true
+	}
+	return false
+}
+
+// Topic is what a notification is about. Customers choose their channels topic by topic. The comment of
+// each topic lists the Data its templates are rendered with, besides Name.
+type Topic string
+
+const (
+	// TopicReceipt has PurchaseID, PurchasedAt, Lines (each with an Item and Amount), Total and Receipt,
+	// the whole receipt laid out in the customer's receipt profile, empty for the standard one.
+	TopicReceipt Topic = "receipt"
+	// TopicOrderReady has PurchaseID.
+	TopicOrderReady Topic = "order_ready"
+	// TopicPointsExpiring has Drinks and ExpiresOn. Nothing in loyalty expires yet, so it is only sent when
+	// Service.Notify is called for it.
+	TopicPointsExpiring Topic = "points_expiring"
+	// TopicOffer has Headline and Details. It is marketing, sent only when Service.Notify is called for it.
+	TopicOffer Topic = "offer"
+)
+
+// Topics are all the topics, in the order they are shown to customers.
+var Topics = []Topic{TopicReceipt, TopicOrderReady, TopicPointsExpiring, TopicOffer}
+
+// Marketing tells whether t is marketing, which a customer is only sent on the channels they opted in to.
+func (t Topic) Marketing() bool {
+	return t == TopicOffer
+}
+
+// defaultChannels are used for topics a customer has not chosen channels for. Receipts are long, and the
+// order being ready is only worth knowing right away.
+var defaultChannels = map[Topic][]Channel{
+	TopicReceipt:        {ChannelEmail},
+	TopicOrderReady:     {ChannelPush, ChannelSMS},
+	TopicPointsExpiring: {ChannelEmail},
+	TopicOffer:          {ChannelEmail},
+}
+
+// Message is a rendered notification for a single recipient.
+type Message struct {
+	// To is an email address, a phone number in E.164 form or a push token, depending on the channel.
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier sends messages over one channel, e.g. SMTP for email.
+type Notifier interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Preferences are how a customer wants to be notified.
+type Preferences struct {
+	CustomerID uuid.UUID
+	// Channels lists, by topic, the channels to use in order of preference. A topic with no channels is one
+	// the customer opted out of; a topic missing from Channels uses the default.
+	Channels map[Topic][]Channel
+	// PushTokens are the devices the customer's app registered for push notifications.
+	PushTokens []string
+	// ReceiptProfile is how the receipts emailed to the customer are laid out, e.g. as plain text for their
+	// screen reader; empty for the standard layout.
+	ReceiptProfile receipt.Profile
+}
+
+// DefaultPreferences are the preferences of a customer who has not set any.
+func DefaultPreferences(customerID uuid.UUID) *Preferences {
+	return &Preferences{CustomerID: customerID, Channels: map[Topic][]Channel{}}
+}
+
+// ChannelsFor returns the channels to try for t, in order.
+func (p *Preferences) ChannelsFor(t Topic) []Channel {
+	if chs, ok := p.Channels[t]; ok {
+		return chs
+	}
+	return defaultChannels[t]
+}
+
+// Choose sets the channels to try for t, in order. None opts out of t.
+func (p *Preferences) Choose(t Topic, chs ...Channel) error {
+	if _, ok := defaultChannels[t]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTopic, t)
+	}
+	for _, c := range chs {
+		if !c.valid() {
+			return fmt.Errorf("%w: %q", ErrUnknownChannel, c)
+		}
+	}
+	if p.Channels == nil {
+		p.Channels = map[Topic][]Channel{}
+	}
+	p.Channels[t] = slices.Compact(append([]Channel{}, chs...))
+	return nil
+}
+
+// ChooseReceiptProfile lays the customer's receipts out in profile.
+func (p *Preferences) ChooseReceiptProfile(profile receipt.Profile) error {
+	if !slices.Contains(receipt.Profiles, profile) {
+		return fmt.Errorf("%w: %q", receipt.ErrUnknownProfile, profile)
+	}
+	p.ReceiptProfile = profile
+	return nil
+}
+
+// AddPushToken registers a device. Registering it again does nothing.
+func (p *Preferences) AddPushToken(token string) {
+	if token != "" && !slices.Contains(p.PushTokens, token) {
+		p.PushTokens = append(p.PushTokens, token)
+	}
+}
+
+// RemovePushToken forgets a device, e.g. once the app is uninstalled.
+func (p *Preferences) RemovePushToken(token string) {
+	p.PushTokens = slices.DeleteFunc(p.PushTokens, func(t string) bool { return t == token })
+}
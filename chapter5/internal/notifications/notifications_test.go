@@ -0,0 +1,288 @@
+package notifications_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/consent"
+	"coffeeco/internal/customer"
+	"coffeeco/internal/events"
+	"coffeeco/internal/notifications"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+)
+
+type outbox struct {
+	sent []notifications.Message
+	// gone are push tokens of uninstalled apps.
+	gone map[string]bool
+}
+
+func (o *outbox) Send(_ context.Context, m notifications.Message) error {
+	if o.gone[m.To] {
+		return notifications.ErrUnregistered
+	}
+	o.sent = append(o.sent, m)
+	return nil
+}
+
+func message(t *testing.T, e events.Event) events.Message {
+	t.Helper()
+	msg, err := events.NewMessage(e, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	return msg
+}
+
+func Test_CustomersAreNotifiedOnTheirPreferredChannel(t *testing.T) {
+	ctx := context.Background()
+	customers := customer.NewService(customer.NewMemoryRepo())
+	ada, err := customers.Register(ctx, customer.Registration{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Phone: "+44 20 7946 0958"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	email, sms, push := &outbox{}, &outbox{}, &outbox{gone: map[string]bool{"old-phone": true}}
+	svc := notifications.NewService(notifications.NewMemoryRepo(), customers,
+		notifications.WithNotifier(notifications.ChannelEmail, email),
+		notifications.WithNotifier(notifications.ChannelSMS, sms),
+		notifications.WithNotifier(notifications.ChannelPush, push),
+	)
+
+	completed := purchase.Completed{
+		PurchaseID:  uuid.New(),
+		CustomerID:  ada.ID(),
+		Lines:       []purchase.CompletedLine{{ItemName: "latte", Amount: 450}},
+		Total:       450,
+		Currency:    "USD",
+		PurchasedAt: time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+	}
+	anonymous := completed
+	anonymous.PurchaseID, anonymous.CustomerID = uuid.New(), uuid.Nil
+	for _, e := range []events.Event{completed, anonymous} {
+		if err := svc.Handle(ctx, message(t, e)); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if len(email.sent) != 1 || email.sent[0].To != "ada@example.com" || !strings.Contains(email.sent[0].Body, "Hi Ada") || !strings.Contains(email.sent[0].Body, "$4.50") {
+		t.Fatalf("expected one emailed receipt but got %+v", email.sent)
+	}
+
+	// Without a device to push to, the order being ready is texted.
+	ready := purchase.StatusChanged{PurchaseID: completed.PurchaseID, CustomerID: ada.ID(), Status: purchase.StatusReady}
+	if err := svc.Handle(ctx, message(t, ready)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(sms.sent) != 1 || sms.sent[0].To != "+442079460958" || sms.sent[0].Body != "Ada, your CoffeeCo order is ready to collect." {
+		t.Fatalf("expected the order being ready to be texted but got %+v", sms.sent)
+	}
+
+	for _, token := range []string{"old-phone", "new-phone"} {
+		if _, err := svc.AddPushToken(ctx, ada.ID(), token); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if err := svc.Notify(ctx, ada.ID(), notifications.TopicOrderReady, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	p, _ := svc.Preferences(ctx, ada.ID())
+	if len(push.sent) != 1 || push.sent[0].To != "new-phone" || len(p.PushTokens) != 1 {
+		t.Fatalf("expected a push to the new phone only and the old one forgotten but got %+v and %v", push.sent, p.PushTokens)
+	}
+
+	if _, err := svc.Choose(ctx, ada.ID(), notifications.TopicReceipt); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Handle(ctx, message(t, completed)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(email.sent) != 1 {
+		t.Fatalf("expected no receipt once opted out but got %+v", email.sent)
+	}
+	if _, err := svc.Choose(ctx, ada.ID(), notifications.TopicReceipt, "pigeon"); !errors.Is(err, notifications.ErrUnknownChannel) {
+		t.Fatalf("expected an unknown channel to be refused but got %v", err)
+	}
+}
+
+func Test_OffersAreOnlySentOnTheChannelsTheCustomerOptedIn(t *testing.T) {
+	ctx := context.Background()
+	customers := customer.NewService(customer.NewMemoryRepo())
+	ada, err := customers.Register(ctx, customer.Registration{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Phone: "+44 20 7946 0958"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	consents := consent.NewService(consent.NewMemoryRepo())
+	email, sms := &outbox{}, &outbox{}
+	svc := notifications.NewService(notifications.NewMemoryRepo(), customers,
+		notifications.WithNotifier(notifications.ChannelEmail, email),
+		notifications.WithNotifier(notifications.ChannelSMS, sms),
+		notifications.WithConsents(consents),
+	)
+	if _, err := svc.Choose(ctx, ada.ID(), notifications.TopicOffer, notifications.ChannelEmail, notifications.ChannelSMS); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	offer := notifications.Data{"Headline": "Two for one lattes", "Details": "All of Friday."}
+
+	if err := svc.Notify(ctx, ada.ID(), notifications.TopicOffer, offer); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(email.sent)+len(sms.sent) != 0 {
+		t.Fatalf("expected no offer without consent but got %+v and %+v", email.sent, sms.sent)
+	}
+
+	if _, err := consents.Record(ctx, ada.ID(), consent.ChannelSMS, true, "signup_form"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Notify(ctx, ada.ID(), notifications.TopicOffer, offer); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(email.sent) != 0 || len(sms.sent) != 1 || sms.sent[0].Body != "CoffeeCo: Two for one lattes" {
+		t.Fatalf("expected the offer texted, the only channel opted in to, but got %+v and %+v", email.sent, sms.sent)
+	}
+
+	if _, err := consents.Record(ctx, ada.ID(), consent.ChannelSMS, false, "unsubscribe_link"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Notify(ctx, ada.ID(), notifications.TopicOffer, offer); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(sms.sent) != 1 {
+		t.Fatalf("expected no offer once opted out but got %+v", sms.sent)
+	}
+
+	// The order being ready is not marketing, so it needs no consent.
+	if err := svc.Notify(ctx, ada.ID(), notifications.TopicOrderReady, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(sms.sent) != 2 {
+		t.Fatalf("expected the order being ready to be texted but got %+v", sms.sent)
+	}
+}
+
+func Test_ReceiptsAreEmailedInTheCustomersProfile(t *testing.T) {
+	ctx := context.Background()
+	customers := customer.NewService(customer.NewMemoryRepo())
+	ada, err := customers.Register(ctx, customer.Registration{FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	email := &outbox{}
+	svc := notifications.NewService(notifications.NewMemoryRepo(), customers, notifications.WithNotifier(notifications.ChannelEmail, email))
+	if _, err := svc.ChooseReceiptProfile(ctx, ada.ID(), "braille"); !errors.Is(err, receipt.ErrUnknownProfile) {
+		t.Fatalf("expected ErrUnknownProfile but got %v", err)
+	}
+	if _, err := svc.ChooseReceiptProfile(ctx, ada.ID(), receipt.ProfilePlainText); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	completed := purchase.Completed{
+		PurchaseID:   uuid.New(),
+		CustomerID:   ada.ID(),
+		Lines:        []purchase.CompletedLine{{ItemName: "latte", Amount: 450}, {ItemName: "latte", Amount: 450}},
+		Total:        900,
+		Currency:     "USD",
+		PaymentMeans: "card",
+		PurchasedAt:  time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC),
+	}
+	if err := svc.Handle(ctx, message(t, completed)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(email.sent) != 1 {
+		t.Fatalf("expected one emailed receipt but got %+v", email.sent)
+	}
+	body := email.sent[0].Body
+	for _, want := range []string{"Hi Ada", "1 March 2024 at 08:30", "2 latte, $9.00.", "Total $9.00, paid with card."} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in the plain text receipt but got\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "*") {
+		t.Fatalf("expected no barcode for a screen reader to read out but got\n%s", body)
+	}
+}
+
+func Test_TwilioAndFCMSendThroughTheirAPIs(t *testing.T) {
+	var requests []*http.Request
+	var forms []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		requests, forms = append(requests, r), append(forms, r.Form.Encode())
+		switch {
+		case r.URL.Path == "/token":
+			_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "fcm-token", "token_type": "Bearer", "expires_in": 3600})
+		case strings.HasSuffix(r.URL.Path, "/messages:send") && r.Header.Get("Authorization") != "Bearer fcm-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.HasSuffix(r.URL.Path, "/messages:send"):
+			var m map[string]map[string]any
+			_ = json.NewDecoder(r.Body).Decode(&m)
+			if m["message"]["token"] == "gone" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"status":"NOT_FOUND","message":"Requested entity was not found."}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"name":"projects/coffeeco/messages/1"}`))
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"sid":"SM1"}`))
+		}
+	}))
+	defer api.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "coffeeco",
+		"client_email": "push@coffeeco.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    api.URL + "/token",
+	})
+	file := filepath.Join(t.TempDir(), "fcm.json")
+	if err := os.WriteFile(file, creds, 0o600); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	ctx := context.Background()
+	fcm, err := notifications.NewFCM(notifications.FCMConfig{CredentialsFile: file, BaseURL: api.URL}, api.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := fcm.Send(ctx, notifications.Message{To: "device", Subject: "Your order is ready", Body: "Enjoy!"}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := fcm.Send(ctx, notifications.Message{To: "gone", Body: "Enjoy!"}); !errors.Is(err, notifications.ErrUnregistered) {
+		t.Fatalf("expected an uninstalled app to be reported but got %v", err)
+	}
+
+	twilio, err := notifications.NewTwilio(notifications.TwilioConfig{AccountSID: "AC1", AuthToken: "secret", From: "+15555550100", BaseURL: api.URL}, api.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := twilio.Send(ctx, notifications.Message{To: "+442079460958", Subject: "ignored", Body: "Your order is ready"}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	last := requests[len(requests)-1]
+	if user, pass, _ := last.BasicAuth(); last.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" || user != "AC1" || pass != "secret" {
+		t.Fatalf("expected the message to be created with the account's credentials but got %s", last.URL)
+	}
+	if forms[len(forms)-1] != "Body=Your+order+is+ready&From=%2B15555550100&To=%2B442079460958" {
+		t.Fatalf("expected the text to be sent from our number but got %s", forms[len(forms)-1])
+	}
+}
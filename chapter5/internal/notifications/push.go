@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const fcmURL = "https://fcm.googleapis.com"
+
+// ErrUnregistered is returned for a push token whose app was uninstalled or that expired.
+var ErrUnregistered = errors.New("push token is no longer registered")
+
+// FCMConfig names the Firebase service account key, downloaded from Project settings > Service accounts.
+type FCMConfig struct {
+	CredentialsFile string `json:"credentials_file"`
+	// BaseURL defaults to Firebase Cloud Messaging; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// FCM sends push notifications to Android and iOS apps through the Firebase Cloud Messaging HTTP v1 API.
+type FCM struct {
+	projectID string
+	baseURL   string
+	client    *http.Client
+}
+
+type serviceAccount struct {
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// NewFCM authenticates as the service account in cfg.CredentialsFile. Requests, including those for
+// access tokens, go through client.
+func NewFCM(cfg FCMConfig, client *http.Client) (*FCM, error) {
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fcm credentials: %w", err)
+	}
+	var sa serviceAccount
+	if err := json.Unmarshal(data, &sa); err != nil || sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("fcm credentials must be the JSON key of a service account")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = fcmURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	conf := &jwt.Config{
+		Email:        sa.ClientEmail,
+		PrivateKey:   []byte(sa.PrivateKey),
+		PrivateKeyID: sa.PrivateKeyID,
+		Scopes:       []string{"https://www.googleapis.com/auth/firebase.messaging"},
+		TokenURL:     sa.TokenURI,
+	}
+	// The client is kept for as long as the notifier, so it cannot be bound to a caller's context.
+	authed := conf.Client(context.WithValue(context.Background(), oauth2.HTTPClient, client))
+	return &FCM{projectID: sa.ProjectID, baseURL: cfg.BaseURL, client: authed}, nil
+}
+
+type fcmMessage struct {
+	Message struct {
+		Token        string `json:"token"`
+		Notification struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+		} `json:"notification"`
+	} `json:"message"`
+}
+
+type fcmError struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Send pushes m to the device with the token m.To, with the subject as its title. It returns an error
+// matching ErrUnregistered if the device is gone, so its token can be dropped.
+func (f *FCM) Send(ctx context.Context, m Message) error {
+	var msg fcmMessage
+	msg.Message.Token = m.To
+	msg.Message.Notification.Title = m.Subject
+	msg.Message.Notification.Body = m.Body
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode push notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.baseURL+"/v1/projects/"+f.projectID+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach fcm: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e fcmError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		err := fmt.Errorf("fcm %d %s: %s", resp.StatusCode, e.Error.Status, e.Error.Message)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %w", ErrUnregistered, err)
+		}
+		return fmt.Errorf("failed to send push notification: %w", err)
+	}
+	return nil
+}
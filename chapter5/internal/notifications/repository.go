@@ -0,0 +1,153 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if the customer has not set any preferences.
+	Get(ctx context.Context, customerID uuid.UUID) (*Preferences, error)
+	Save(ctx context.Context, p *Preferences) error
+	// EraseCustomer drops a customer's preferences and push tokens, for privacy.Service.
+	EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error)
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client      *mongo.Client
+	preferences *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, preferences: client.Database("coffeeco").Collection("notification_preferences")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoPreferences struct {
+	CustomerID string               `bson:"_id"`
+	Channels   map[string][]Channel `bson:"channels"`
+	PushTokens []string             `bson:"push_tokens,omitempty"`
+	Receipts   string               `bson:"receipt_profile,omitempty"`
+}
+
+func toMongoPreferences(p *Preferences) mongoPreferences {
+	doc := mongoPreferences{CustomerID: p.CustomerID.String(), Channels: map[string][]Channel{}, PushTokens: p.PushTokens, Receipts: string(p.ReceiptProfile)}
+	for t, chs := range p.Channels {
+		// An opted out topic is kept as an empty list, not dropped as a nil one would be.
+		doc.Channels[string(t)] = append([]Channel{}, chs...)
+	}
+	return doc
+}
+
+func (m mongoPreferences) toPreferences() *Preferences {
+	id, _ := uuid.Parse(m.CustomerID)
+	p := DefaultPreferences(id)
+	for t, chs := range m.Channels {
+		p.Channels[Topic(t)] = append([]Channel{}, chs...)
+	}
+	p.PushTokens = append(p.PushTokens, m.PushTokens...)
+	p.ReceiptProfile = receipt.Profile(m.Receipts)
+	return p
+}
+
+func (m *MongoRepository) Get(ctx context.Context, customerID uuid.UUID) (_ *Preferences, err error) {
+	ctx, span := telemetry.StartClient(ctx, "notifications.MongoRepository.Get", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoPreferences
+	if err := m.preferences.FindOne(ctx, bson.D{{Key: "_id", Value: customerID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find notification preferences: %w", err)
+	}
+	return doc.toPreferences(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, p *Preferences) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "notifications.MongoRepository.Save", attribute.String("customer.id", p.CustomerID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoPreferences(p)
+	_, err = m.preferences.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.CustomerID}}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error) {
+	res, err := m.preferences.DeleteOne(ctx, bson.D{{Key: "_id", Value: customerID.String()}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to erase notification preferences: %w", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.preferences.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps preferences in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu          sync.Mutex
+	preferences map[uuid.UUID]mongoPreferences
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{preferences: map[uuid.UUID]mongoPreferences{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, customerID uuid.UUID) (*Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.preferences[customerID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toPreferences(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, p *Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc := toMongoPreferences(p)
+	doc.PushTokens = append([]string{}, p.PushTokens...)
+	m.preferences[p.CustomerID] = doc
+	return nil
+}
+
+func (m *MemoryRepository) EraseCustomer(_ context.Context, customerID uuid.UUID) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.preferences[customerID]; !ok {
+		return 0, nil
+	}
+	delete(m.preferences, customerID)
+	return 1, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,368 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/customer"
+	"coffeeco/internal/events"
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+)
+
+// Contacts tells how to reach customers, e.g. customer.Service.
+type Contacts interface {
+	// Get returns customer.ErrNotFound for customers who never registered or were erased.
+	Get(ctx context.Context, id uuid.UUID) (*customer.Customer, error)
+}
+
+// Consents tells whether customers opted in to marketing on a channel, e.g. consent.Service.
+type Consents interface {
+	Allows(ctx context.Context, customerID uuid.UUID, channel string) (bool, error)
+}
+
+type Service struct {
+	repo      Repository
+	contacts  Contacts
+	consents  Consents             // 可选, 没有时不发送营销消息
+	notifiers map[Channel]Notifier // 可选, 没有配置的渠道会被跳过
+	templates map[Topic]Template
+	// localized are the templates of other languages than English, by language then topic.
+	localized map[string]map[Topic]Template
+	registry  *events.Registry
+	locale    moneyfmt.Locale // 可选, 默认按各币种自己的写法
+	localizer *i18n.Localizer // 可选, 按店铺的语言和地区通知
+	logger    *slog.Logger
+}
+
+type Option func(s *Service)
+
+// WithNotifier sends the notifications of channel c through n. Channels without a notifier are skipped, so
+// customers who prefer them are reached on their next choice.
+func WithNotifier(c Channel, n Notifier) Option {
+	return func(s *Service) {
+		s.notifiers[c] = n
+	}
+}
+
+// WithConsents sends marketing topics to customers on the channels they opted in to. Without it, marketing
+// is sent to nobody.
+func WithConsents(c Consents) Option {
+	return func(s *Service) {
+		s.consents = c
+	}
+}
+
+// WithTemplate replaces the default template of topic t.
+func WithTemplate(t Topic, tmpl Template) Option {
+	return func(s *Service) {
+		s.templates[t] = tmpl
+	}
+}
+
+// WithTemplateIn replaces the template of topic t in lang, a BCP 47 tag such as "de" or "de-CH", or adds
+// it to LocalizedTemplates.
+func WithTemplateIn(lang string, t Topic, tmpl Template) Option {
+	return func(s *Service) {
+		if s.localized[lang] == nil {
+			s.localized[lang] = map[Topic]Template{}
+		}
+		s.localized[lang][t] = tmpl
+	}
+}
+
+// WithLocalizer notifies customers about the purchases of each store in its language, with its products'
+// names and its way of writing amounts and times, rather than WithLocale's.
+func WithLocalizer(l *i18n.Localizer) Option {
+	return func(s *Service) {
+		s.localizer = l
+	}
+}
+
+// WithLocale writes the amounts on receipts as l does.
+func WithLocale(l moneyfmt.Locale) Option {
+	return func(s *Service) {
+		s.locale = l
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+func NewService(repo Repository, contacts Contacts, opts ...Option) *Service {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	s := &Service{
+		repo:      repo,
+		contacts:  contacts,
+		notifiers: map[Channel]Notifier{},
+		templates: maps.Clone(DefaultTemplates),
+		localized: map[string]map[Topic]Template{},
+		registry:  r,
+		logger:    slog.Default(),
+	}
+	for lang, ts := range LocalizedTemplates {
+		s.localized[lang] = maps.Clone(ts)
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Preferences returns how a customer wants to be notified, the defaults if they never said.
+func (s *Service) Preferences(ctx context.Context, customerID uuid.UUID) (*Preferences, error) {
+	p, err := s.repo.Get(ctx, customerID)
+	if errors.Is(err, ErrNotFound) {
+		return DefaultPreferences(customerID), nil
+	}
+	return p, err
+}
+
+// Choose sets the channels a customer is notified on about t, in order of preference. None opts them out.
+func (s *Service) Choose(ctx context.Context, customerID uuid.UUID, t Topic, chs ...Channel) (*Preferences, error) {
+	return s.change(ctx, customerID, func(p *Preferences) error {
+		return p.Choose(t, chs...)
+	})
+}
+
+// ChooseReceiptProfile lays out the receipts emailed to a customer in profile, e.g. as plain text for their
+// screen reader.
+func (s *Service) ChooseReceiptProfile(ctx context.Context, customerID uuid.UUID, profile receipt.Profile) (*Preferences, error) {
+	return s.change(ctx, customerID, func(p *Preferences) error {
+		return p.ChooseReceiptProfile(profile)
+	})
+}
+
+// AddPushToken registers a device of the customer for push notifications.
+func (s *Service) AddPushToken(ctx context.Context, customerID uuid.UUID, token string) (*Preferences, error) {
+	return s.change(ctx, customerID, func(p *Preferences) error {
+		p.AddPushToken(token)
+		return nil
+	})
+}
+
+// RemovePushToken stops push notifications to a device of the customer.
+func (s *Service) RemovePushToken(ctx context.Context, customerID uuid.UUID, token string) (*Preferences, error) {
+	return s.change(ctx, customerID, func(p *Preferences) error {
+		p.RemovePushToken(token)
+		return nil
+	})
+}
+
+func (s *Service) change(ctx context.Context, customerID uuid.UUID, fn func(p *Preferences) error) (*Preferences, error) {
+	p, err := s.Preferences(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Save(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Notify tells a customer about t on the first channel they prefer that they can be reached on. Customers
+// who opted out of t, or cannot be reached on any of their channels, are not notified, and neither are
+// customers we do not know. Marketing topics are only sent on channels the customer consented to.
+func (s *Service) Notify(ctx context.Context, customerID uuid.UUID, t Topic, d Data) error {
+	return s.notify(ctx, customerID, t, d, "")
+}
+
+// notify is Notify in lang, falling back to its language and then to English for topics without a
+// template in it.
+func (s *Service) notify(ctx context.Context, customerID uuid.UUID, t Topic, d Data, lang string) error {
+	tmpl, ok := s.template(t, lang)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTopic, t)
+	}
+	c, err := s.contacts.Get(ctx, customerID)
+	if errors.Is(err, customer.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to look up the customer: %w", err)
+	}
+	p, err := s.Preferences(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	data := maps.Clone(d)
+	if data == nil {
+		data = Data{}
+	}
+	data["Name"], _ = c.Name()
+	if t == TopicReceipt {
+		if data["Receipt"], err = layOut(data["Receipt"], p.ReceiptProfile); err != nil {
+			return err
+		}
+	}
+
+	for _, ch := range p.ChannelsFor(t) {
+		n, ok := s.notifiers[ch]
+		to := recipients(c, p, ch)
+		if !ok || len(to) == 0 {
+			continue
+		}
+		if t.Marketing() {
+			allowed, err := s.allows(ctx, customerID, ch)
+			if err != nil {
+				return err
+			}
+			if !allowed {
+				continue
+			}
+		}
+		m, err := tmpl.Render(ch, data)
+		if err != nil {
+			return err
+		}
+		return s.send(ctx, p, n, to, m)
+	}
+	s.logger.DebugContext(ctx, "customer not notified", "customer", customerID, "topic", t)
+	return nil
+}
+
+// allows tells whether the customer consented to marketing on ch.
+func (s *Service) allows(ctx context.Context, customerID uuid.UUID, ch Channel) (bool, error) {
+	if s.consents == nil {
+		return false, nil
+	}
+	ok, err := s.consents.Allows(ctx, customerID, string(ch))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the customer's consent: %w", err)
+	}
+	return ok, nil
+}
+
+func (s *Service) template(t Topic, lang string) (Template, bool) {
+	base, _, _ := strings.Cut(lang, "-")
+	for _, l := range []string{lang, strings.ToLower(base)} {
+		if tmpl, ok := s.localized[l][t]; ok {
+			return tmpl, true
+		}
+	}
+	tmpl, ok := s.templates[t]
+	return tmpl, ok
+}
+
+// layOut renders the receipt of a receipt notification in profile. It is empty for the standard profile,
+// which templates lay out themselves, and when the notification carries no receipt.Receipt.
+func layOut(r any, profile receipt.Profile) (string, error) {
+	rcpt, ok := r.(receipt.Receipt)
+	if !ok || profile == "" || profile == receipt.ProfileStandard {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := receipt.Render(&b, rcpt, profile); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func recipients(c *customer.Customer, p *Preferences, ch Channel) []string {
+	switch ch {
+	case ChannelEmail:
+		if !c.Email().IsZero() {
+			return []string{c.Email().String()}
+		}
+	case ChannelSMS:
+		if !c.Phone().IsZero() {
+			return []string{c.Phone().String()}
+		}
+	case ChannelPush:
+		return p.PushTokens
+	}
+	return nil
+}
+
+// send sends m to every recipient. Push tokens of devices that are gone are dropped rather than failing
+// the notification.
+func (s *Service) send(ctx context.Context, p *Preferences, n Notifier, to []string, m Message) error {
+	var errs []error
+	for _, r := range to {
+		m.To = r
+		err := n.Send(ctx, m)
+		if errors.Is(err, ErrUnregistered) {
+			if _, err := s.RemovePushToken(ctx, p.CustomerID, r); err != nil {
+				s.logger.ErrorContext(ctx, "unregistered push token not removed", "customer", p.CustomerID, "error", err)
+			}
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Handle is an events.Handler for the purchase topic that sends registered customers their receipt and
+// tells them when their order is ready. Other events are ignored. Wrap it in inbox.Idempotent so
+// redelivered events are not notified twice.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted && msg.Type != purchase.EventTypeStatusChanged {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch e := evt.(type) {
+	case purchase.Completed:
+		if e.CustomerID == uuid.Nil {
+			return nil
+		}
+		pr := s.printer(e.StoreID)
+		return s.notify(ctx, e.CustomerID, TopicReceipt, receiptData(e, pr), pr.Tag)
+	case purchase.StatusChanged:
+		if e.CustomerID == uuid.Nil || e.Status != purchase.StatusReady {
+			return nil
+		}
+		return s.notify(ctx, e.CustomerID, TopicOrderReady, Data{"PurchaseID": e.PurchaseID.String()}, s.printer(e.StoreID).Tag)
+	}
+	return nil
+}
+
+type receiptLine struct {
+	Item   string
+	Amount string
+}
+
+// printer is how the purchases of the store are written to its customers.
+func (s *Service) printer(storeID uuid.UUID) i18n.Printer {
+	if s.localizer == nil {
+		return i18n.Printer{Money: s.locale}
+	}
+	return s.localizer.For(storeID)
+}
+
+func receiptData(e purchase.Completed, pr i18n.Printer) Data {
+	lines := make([]receiptLine, 0, len(e.Lines))
+	for _, l := range e.Lines {
+		lines = append(lines, receiptLine{Item: pr.Product(l.ItemName).Name, Amount: pr.Amount(l.Amount, e.Currency)})
+	}
+	return Data{
+		"PurchaseID":  e.PurchaseID.String(),
+		"PurchasedAt": pr.DateTime(e.PurchasedAt, "2 Jan 2006 15:04"),
+		"Lines":       lines,
+		"Total":       pr.Amount(e.Total, e.Currency),
+		// Laid out in the customer's profile once their preferences are known.
+		"Receipt": receipt.FromCompleted(e, pr),
+	}
+}
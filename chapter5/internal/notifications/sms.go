@@ -0,0 +1,76 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const twilioURL = "https://api.twilio.com"
+
+// TwilioConfig holds the account credentials from the Twilio Console and the number texts are sent from.
+type TwilioConfig struct {
+	AccountSID string `json:"account_sid"`
+	AuthToken  string `json:"auth_token"`
+	// From is a Twilio number in E.164 form or a messaging service SID.
+	From string `json:"from"`
+	// BaseURL defaults to Twilio's API; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// Twilio sends SMS notifications through Twilio's Messaging API.
+type Twilio struct {
+	cfg    TwilioConfig
+	client *http.Client
+}
+
+func NewTwilio(cfg TwilioConfig, client *http.Client) (*Twilio, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" || cfg.From == "" {
+		return nil, errors.New("twilio needs an account SID, auth token and sender")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = twilioURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Twilio{cfg: cfg, client: client}, nil
+}
+
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Send texts the body of m; texts have no subject.
+func (t *Twilio) Send(ctx context.Context, m Message) error {
+	form := url.Values{"To": {m.To}, "Body": {m.Body}}
+	if strings.HasPrefix(t.cfg.From, "MG") {
+		form.Set("MessagingServiceSid", t.cfg.From)
+	} else {
+		form.Set("From", t.cfg.From)
+	}
+	u := t.cfg.BaseURL + "/2010-04-01/Accounts/" + url.PathEscape(t.cfg.AccountSID) + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.cfg.AccountSID, t.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach twilio: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e twilioError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return fmt.Errorf("failed to send sms: twilio %d: %d %s", resp.StatusCode, e.Code, e.Message)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig is the mail server emails are relayed through, e.g. smtp.sendgrid.net:587.
+type SMTPConfig struct {
+	// Addr is host:port. The server must offer STARTTLS unless it is on localhost.
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// From is the sender, e.g. "CoffeeCo <hello@coffeeco.example>".
+	From string `json:"from"`
+}
+
+// SMTP sends email notifications as plain text.
+type SMTP struct {
+	addr string
+	from *mail.Address
+	auth smtp.Auth
+}
+
+func NewSMTP(cfg SMTPConfig) (*SMTP, error) {
+	host, _, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("smtp address must be host:port: %w", err)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("smtp sender must be an email address: %w", err)
+	}
+	s := &SMTP{addr: cfg.Addr, from: from}
+	if cfg.Username != "" {
+		s.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return s, nil
+}
+
+// Send relays m to the mail server. net/smtp cannot be cancelled, so ctx only stops a send that has not
+// started.
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(m.To, "\r\n") {
+		return errors.New("invalid email recipient")
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{m.To}, s.compose(m)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func (s *SMTP) compose(m Message) []byte {
+	var b strings.Builder
+	for _, h := range [][2]string{
+		{"From", s.from.String()},
+		{"To", m.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+	} {
+		b.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,151 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Data is what a template is rendered with. Name is always the customer's first name; the rest depends on
+// the topic.
+type Data map[string]any
+
+// Template renders the notifications of a topic. Email gets the subject and body; SMS and push, which are
+// read at a glance, get the short text, push with the subject as its title.
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+	short   *template.Template
+}
+
+// NewTemplate parses text/template sources for the subject, body and short text of a notification.
+func NewTemplate(subject, body, short string) (Template, error) {
+	var t Template
+	for _, p := range []struct {
+		tmpl **template.Template
+		name string
+		text string
+	}{
+		{&t.subject, "subject", subject},
+		{&t.body, "body", body},
+		{&t.short, "short", short},
+	} {
+		parsed, err := template.New(p.name).Option("missingkey=error").Parse(p.text)
+		if err != nil {
+			return Template{}, fmt.Errorf("failed to parse %s template: %w", p.name, err)
+		}
+		*p.tmpl = parsed
+	}
+	return t, nil
+}
+
+// MustTemplate is NewTemplate for templates known to be valid; it panics otherwise.
+func MustTemplate(subject, body, short string) Template {
+	t, err := NewTemplate(subject, body, short)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Render returns the message for a channel, without a recipient.
+func (t Template) Render(c Channel, d Data) (Message, error) {
+	var m Message
+	var err error
+	if m.Subject, err = execute(t.subject, d); err != nil {
+		return Message{}, err
+	}
+	body := t.short
+	if c == ChannelEmail {
+		body = t.body
+	}
+	if m.Body, err = execute(body, d); err != nil {
+		return Message{}, err
+	}
+	return m, nil
+}
+
+func execute(t *template.Template, d Data) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", fmt.Errorf("failed to render notification: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// DefaultTemplates are used for topics without a template of their own, see WithTemplate.
+var DefaultTemplates = map[Topic]Template{
+	TopicReceipt: MustTemplate(
+		"Your CoffeeCo receipt",
+		`Hi {{.Name}},
+
+{{with .Receipt}}{{.}}{{else}}Thanks for your purchase on {{.PurchasedAt}}.
+
+{{range .Lines}}{{.Item}}  {{.Amount}}
+{{end}}
+Total  {{.Total}}
+
+Purchase {{.PurchaseID}}{{end}}`,
+		"CoffeeCo: thanks {{.Name}}, you paid {{.Total}} on {{.PurchasedAt}}.",
+	),
+	TopicOrderReady: MustTemplate(
+		"Your order is ready",
+		"Hi {{.Name}},\n\nYour order is ready to collect at the counter. Enjoy!",
+		"{{.Name}}, your CoffeeCo order is ready to collect.",
+	),
+	TopicPointsExpiring: MustTemplate(
+		"Your free drinks are about to expire",
+		"Hi {{.Name}},\n\nYou have {{.Drinks}} free drinks that expire on {{.ExpiresOn}}. Treat yourself before then!",
+		"CoffeeCo: {{.Drinks}} free drinks expire on {{.ExpiresOn}}.",
+	),
+	TopicOffer: MustTemplate(
+		"{{.Headline}}",
+		"Hi {{.Name}},\n\n{{.Details}}\n\nYou get this because you asked for CoffeeCo offers. You can opt out in the app at any time.",
+		"CoffeeCo: {{.Headline}}",
+	),
+}
+
+// LocalizedTemplates are the templates of other languages than English, by language then topic. Topics
+// without a template in a language are sent in English.
+var LocalizedTemplates = map[string]map[Topic]Template{
+	"de": {
+		TopicReceipt: MustTemplate(
+			"Ihr CoffeeCo-Beleg",
+			`Hallo {{.Name}},
+
+{{with .Receipt}}{{.}}{{else}}danke für Ihren Einkauf am {{.PurchasedAt}}.
+
+{{range .Lines}}{{.Item}}  {{.Amount}}
+{{end}}
+Summe  {{.Total}}
+
+Einkauf {{.PurchaseID}}{{end}}`,
+			"CoffeeCo: danke {{.Name}}, Sie haben am {{.PurchasedAt}} {{.Total}} bezahlt.",
+		),
+		TopicOrderReady: MustTemplate(
+			"Ihre Bestellung ist fertig",
+			"Hallo {{.Name}},\n\nIhre Bestellung liegt an der Theke für Sie bereit. Guten Appetit!",
+			"{{.Name}}, Ihre CoffeeCo-Bestellung liegt zum Abholen bereit.",
+		),
+	},
+	"fr": {
+		TopicReceipt: MustTemplate(
+			"Votre ticket CoffeeCo",
+			`Bonjour {{.Name}},
+
+{{with .Receipt}}{{.}}{{else}}Merci pour votre achat du {{.PurchasedAt}}.
+
+{{range .Lines}}{{.Item}}  {{.Amount}}
+{{end}}
+Total  {{.Total}}
+
+Achat {{.PurchaseID}}{{end}}`,
+			"CoffeeCo : merci {{.Name}}, vous avez payé {{.Total}} le {{.PurchasedAt}}.",
+		),
+		TopicOrderReady: MustTemplate(
+			"Votre commande est prête",
+			"Bonjour {{.Name}},\n\nVotre commande vous attend au comptoir. Bonne dégustation !",
+			"{{.Name}}, votre commande CoffeeCo est prête.",
+		),
+	},
+}
@@ -0,0 +1,72 @@
+package orders
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultPrepTime is how long an item takes to make when PrepTimes does not say.
+const DefaultPrepTime = 90 * time.Second
+
+// PrepTimes say how long the bar takes to make an item, by product name.
+type PrepTimes map[string]time.Duration
+
+// Of is how long the items of a ticket take to make, one after the other.
+func (p PrepTimes) Of(items []string) time.Duration {
+	var d time.Duration
+	for _, item := range items {
+		if t, ok := p[item]; ok {
+			d += t
+			continue
+		}
+		d += DefaultPrepTime
+	}
+	return d
+}
+
+// Estimate says when each open ticket of a store should be ready, given the queue oldest first. Every
+// barista with a ticket in progress is assumed to take the next queued ticket once theirs is done, and a
+// store with nobody at the bar yet is assumed to have one barista. Ready tickets keep the time they were
+// ready at.
+func (p PrepTimes) Estimate(queue []*Ticket, now time.Time) map[uuid.UUID]time.Time {
+	estimates := make(map[uuid.UUID]time.Time, len(queue))
+	// free is when each barista is done with what they have in hand.
+	free := map[string]time.Time{}
+	for _, t := range queue {
+		switch t.status {
+		case StatusReady, StatusPickedUp:
+			estimates[t.ID] = t.readyAt
+		case StatusInProgress:
+			done := t.startedAt.Add(p.Of(t.Items))
+			if done.Before(now) {
+				done = now
+			}
+			if f, ok := free[t.barista]; ok && f.After(t.startedAt) {
+				done = f.Add(p.Of(t.Items))
+			}
+			free[t.barista] = done
+			estimates[t.ID] = done
+		}
+	}
+	if len(free) == 0 {
+		free[""] = now
+	}
+	baristas := slices.Sorted(maps.Keys(free))
+	for _, t := range queue {
+		if t.status != StatusQueued {
+			continue
+		}
+		next := baristas[0]
+		for _, b := range baristas[1:] {
+			if free[b].Before(free[next]) {
+				next = b
+			}
+		}
+		free[next] = free[next].Add(p.Of(t.Items))
+		estimates[t.ID] = free[next]
+	}
+	return estimates
+}
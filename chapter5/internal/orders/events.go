@@ -0,0 +1,82 @@
+package orders
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const (
+	EventTypeTicketUpdated  = "orders.ticket_updated"
+	EventTypeTicketReleased = "orders.ticket_released"
+)
+
+// TicketUpdated is published when a ticket is queued and every time it moves on, with when it should be
+// ready, so kitchen displays can follow the queue of their store.
+type TicketUpdated struct {
+	TicketID         uuid.UUID `json:"ticket_id"`
+	StoreID          uuid.UUID `json:"store_id"`
+	CustomerID       uuid.UUID `json:"customer_id"`
+	Items            []string  `json:"items"`
+	Status           Status    `json:"status"`
+	Barista          string    `json:"barista,omitempty"`
+	StartedAt        time.Time `json:"started_at,omitzero"`
+	EstimatedReadyAt time.Time `json:"estimated_ready_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+func (e TicketUpdated) EventType() string {
+	return EventTypeTicketUpdated
+}
+
+func (e TicketUpdated) AggregateID() uuid.UUID {
+	return e.TicketID
+}
+
+// EventID is derived from the ticket and status, as a ticket reaches each status only once.
+func (e TicketUpdated) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.TicketID, []byte(EventTypeTicketUpdated+"."+string(e.Status)))
+}
+
+// ReleaseReason is why a scheduled ticket went to the bar.
+type ReleaseReason string
+
+const (
+	// ReleasedNearby tickets were released when the customer's app said they were close.
+	ReleasedNearby ReleaseReason = "nearby"
+	// ReleasedOnTime tickets were released in time for the pickup, as the customer's app never said they
+	// were close.
+	ReleasedOnTime ReleaseReason = "on_time"
+)
+
+// TicketReleased is published when the ticket of a scheduled pickup goes to the bar, e.g. to tell the
+// customer their order is being made.
+type TicketReleased struct {
+	TicketID   uuid.UUID     `json:"ticket_id"`
+	StoreID    uuid.UUID     `json:"store_id"`
+	CustomerID uuid.UUID     `json:"customer_id"`
+	Reason     ReleaseReason `json:"reason"`
+	PickupAt   time.Time     `json:"pickup_at"`
+	ReleasedAt time.Time     `json:"released_at"`
+}
+
+func (e TicketReleased) EventType() string {
+	return EventTypeTicketReleased
+}
+
+func (e TicketReleased) AggregateID() uuid.UUID {
+	return e.TicketID
+}
+
+// EventID is derived from the ticket, as a ticket is only ever released once.
+func (e TicketReleased) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.TicketID, []byte(EventTypeTicketReleased))
+}
+
+// RegisterEvents adds decoders for every version of the orders events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeTicketUpdated, 1, events.JSONDecoder[TicketUpdated]())
+	r.Register(EventTypeTicketReleased, 1, events.JSONDecoder[TicketReleased]())
+}
@@ -0,0 +1,179 @@
+package orders_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/purchase"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+type statuses []purchase.Status
+
+func (s *statuses) UpdateStatus(_ context.Context, _ uuid.UUID, status purchase.Status) error {
+	*s = append(*s, status)
+	return nil
+}
+
+func completed(t *testing.T, storeID uuid.UUID, items ...string) (uuid.UUID, events.Message) {
+	t.Helper()
+	e := purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, CustomerID: uuid.New(), PurchasedAt: time.Now()}
+	for _, item := range items {
+		e.Lines = append(e.Lines, purchase.CompletedLine{ItemName: item, Amount: 400})
+	}
+	msg, err := events.NewMessage(e, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	return e.PurchaseID, msg
+}
+
+func Test_CompletedPurchasesAreQueuedOnce(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	var published capture
+	svc := orders.NewService(orders.NewMemoryRepo(), orders.WithEventPublisher(&published))
+
+	id, msg := completed(t, storeID, "latte", "croissant")
+	for range 2 {
+		if err := svc.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	queue, err := svc.Queue(ctx, storeID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(queue) != 1 || queue[0].Ticket.ID != id || len(queue[0].Ticket.Items) != 2 {
+		t.Fatalf("expected one ticket with both items but got %+v", queue)
+	}
+	if len(published) != 1 || published[0].(orders.TicketUpdated).EstimatedReadyAt.IsZero() {
+		t.Fatalf("expected the queued ticket to be published with an estimate but got %+v", published)
+	}
+}
+
+func Test_TicketsMoveFromTheQueueToTheCounter(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	var updated statuses
+	svc := orders.NewService(orders.NewMemoryRepo(), orders.WithStatusUpdates(&updated))
+	id, msg := completed(t, storeID, "latte")
+	_ = svc.Handle(ctx, msg)
+
+	if err := svc.Ready(ctx, id); !errors.Is(err, orders.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition for a ticket nobody started but got %v", err)
+	}
+	if err := svc.Start(ctx, id, ""); !errors.Is(err, orders.ErrNoBarista) {
+		t.Fatalf("expected ErrNoBarista but got %v", err)
+	}
+	for _, move := range []func() error{
+		func() error { return svc.Start(ctx, id, "sam") },
+		func() error { return svc.Ready(ctx, id) },
+		func() error { return svc.PickUp(ctx, id) },
+	} {
+		if err := move(); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if len(updated) != 2 || updated[0] != purchase.StatusPreparing || updated[1] != purchase.StatusReady {
+		t.Fatalf("expected the purchase to be preparing then ready but got %v", updated)
+	}
+	if queue, _ := svc.Queue(ctx, storeID); len(queue) != 0 {
+		t.Fatalf("expected picked up tickets to leave the queue but got %+v", queue)
+	}
+}
+
+func Test_WaitEstimatesShareTheQueueBetweenBaristas(t *testing.T) {
+	now := time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)
+	prep := orders.PrepTimes{"latte": 2 * time.Minute, "espresso": time.Minute}
+	ticket := func(minutesAgo int, items ...string) *orders.Ticket {
+		return orders.NewTicket(uuid.New(), uuid.New(), uuid.Nil, items, now.Add(-time.Duration(minutesAgo)*time.Minute))
+	}
+	sams, alexs := ticket(5, "latte"), ticket(4, "espresso")
+	_ = sams.Start("sam", now.Add(-30*time.Second))
+	_ = alexs.Start("alex", now)
+	next, after, cookie := ticket(3, "latte"), ticket(2, "espresso"), ticket(1, "cookie")
+
+	got := prep.Estimate([]*orders.Ticket{sams, alexs, next, after, cookie}, now)
+	want := map[*orders.Ticket]time.Duration{
+		sams:   90 * time.Second,
+		alexs:  time.Minute,
+		next:   3 * time.Minute, // alex is free first
+		after:  150 * time.Second,
+		cookie: 4 * time.Minute, // sam is free before alex again
+	}
+	for tk, d := range want {
+		if got[tk.ID] != now.Add(d) {
+			t.Errorf("expected %v to be ready in %v but got %v", tk.Items, d, got[tk.ID].Sub(now))
+		}
+	}
+
+	// Nobody at the bar yet still makes one queue.
+	got = prep.Estimate([]*orders.Ticket{next, after}, now)
+	if got[after.ID] != now.Add(3*time.Minute) {
+		t.Fatalf("expected the second ticket in 3m but got %v", got[after.ID].Sub(now))
+	}
+}
+
+func Test_ScheduledTicketsWaitForTheCustomerOrTheirPickup(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	now := time.Now()
+	var published capture
+	svc := orders.NewService(orders.NewMemoryRepo(), orders.WithEventPublisher(&published), orders.WithClock(func() time.Time { return now }),
+		orders.WithRelease(orders.ReleasePolicy{Radius: 300, Lead: 10 * time.Minute}))
+	schedule := func(in time.Duration) uuid.UUID {
+		e := purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, CustomerID: uuid.New(), PurchasedAt: now, PickupAt: now.Add(in),
+			Lines: []purchase.CompletedLine{{ItemName: "latte", Amount: 400}}}
+		msg, _ := events.NewMessage(e, events.JSONCodec{})
+		if err := svc.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		return e.PurchaseID
+	}
+	walking, forgetful, soon := schedule(time.Hour), schedule(30*time.Minute), schedule(5*time.Minute)
+
+	if queue, _ := svc.Queue(ctx, storeID); len(queue) != 1 || queue[0].Ticket.ID != soon {
+		t.Fatalf("expected only the pickup within the lead queued but got %+v", queue)
+	}
+	if tk, err := svc.Approach(ctx, walking, 800); err != nil || tk.Status() != orders.StatusScheduled {
+		t.Fatalf("expected a customer far away to leave the ticket scheduled but got %v", err)
+	}
+	for range 2 {
+		if tk, err := svc.Approach(ctx, walking, 120); err != nil || tk.Status() != orders.StatusQueued {
+			t.Fatalf("expected a customer close by to release the ticket but got %v", err)
+		}
+	}
+	var releases []orders.TicketReleased
+	for _, e := range published {
+		if r, ok := e.(orders.TicketReleased); ok {
+			releases = append(releases, r)
+		}
+	}
+	if len(releases) != 1 || releases[0].TicketID != walking || releases[0].Reason != orders.ReleasedNearby {
+		t.Fatalf("expected one release of the ticket for the customer being close but got %+v", releases)
+	}
+
+	if n, err := svc.ReleaseDue(ctx); err != nil || n != 0 {
+		t.Fatalf("expected nothing due yet but got %d, %v", n, err)
+	}
+	now = now.Add(25 * time.Minute)
+	if n, err := svc.ReleaseDue(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the forgotten pickup released on time but got %d, %v", n, err)
+	}
+	if queue, _ := svc.Queue(ctx, storeID); len(queue) != 3 || queue[2].Ticket.ID != forgetful {
+		t.Fatalf("expected every ticket queued, the last released last but got %+v", queue)
+	}
+}
@@ -0,0 +1,272 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such ticket.
+	Get(ctx context.Context, id uuid.UUID) (*Ticket, error)
+	// Save returns ErrConcurrencyConflict if the ticket was saved by someone else since it was read, or
+	// if a new ticket already exists.
+	Save(ctx context.Context, t *Ticket) error
+	// Open returns the tickets of a store that are queued and were not picked up yet, oldest first.
+	// Scheduled tickets are not open until they are released.
+	Open(ctx context.Context, storeID uuid.UUID) ([]*Ticket, error)
+	// Scheduled returns the scheduled tickets of every store to be released by by, the earliest first.
+	Scheduled(ctx context.Context, by time.Time) ([]*Ticket, error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps tickets versioned, so two baristas cannot both start the same one.
+type MongoRepository struct {
+	client  *mongo.Client
+	tickets *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	tickets := client.Database("coffeeco").Collection("tickets")
+	_, err = tickets.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "status", Value: 1}, {Key: "queued_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ticket indexes: %w", err)
+	}
+	_, err = tickets.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "release_by", Value: 1}},
+		Options: options.Index().SetPartialFilterExpression(bson.D{{Key: "status", Value: string(StatusScheduled)}}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ticket indexes: %w", err)
+	}
+	return &MongoRepository{client: client, tickets: tickets}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoTicket struct {
+	ID         string    `bson:"_id"`
+	Version    int       `bson:"version"`
+	StoreID    string    `bson:"store_id"`
+	CustomerID string    `bson:"customer_id,omitempty"`
+	Items      []string  `bson:"items"`
+	Status     string    `bson:"status"`
+	Barista    string    `bson:"barista,omitempty"`
+	QueuedAt   time.Time `bson:"queued_at"`
+	StartedAt  time.Time `bson:"started_at,omitempty"`
+	ReadyAt    time.Time `bson:"ready_at,omitempty"`
+	PickedUpAt time.Time `bson:"picked_up_at,omitempty"`
+	PickupAt   time.Time `bson:"pickup_at,omitempty"`
+	ReleaseBy  time.Time `bson:"release_by,omitempty"`
+}
+
+func toMongoTicket(t *Ticket) mongoTicket {
+	doc := mongoTicket{
+		ID:         t.ID.String(),
+		Version:    t.version,
+		StoreID:    t.StoreID.String(),
+		Items:      t.Items,
+		Status:     string(t.status),
+		Barista:    t.barista,
+		QueuedAt:   t.QueuedAt,
+		StartedAt:  t.startedAt,
+		ReadyAt:    t.readyAt,
+		PickedUpAt: t.pickedUpAt,
+		PickupAt:   t.PickupAt,
+		ReleaseBy:  t.releaseBy,
+	}
+	if t.CustomerID != uuid.Nil {
+		doc.CustomerID = t.CustomerID.String()
+	}
+	return doc
+}
+
+func (m mongoTicket) toTicket() *Ticket {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	return &Ticket{
+		ID:         id,
+		StoreID:    storeID,
+		CustomerID: customerID,
+		Items:      m.Items,
+		QueuedAt:   m.QueuedAt,
+		version:    m.Version,
+		status:     Status(m.Status),
+		barista:    m.Barista,
+		startedAt:  m.StartedAt,
+		readyAt:    m.ReadyAt,
+		pickedUpAt: m.PickedUpAt,
+		PickupAt:   m.PickupAt,
+		releaseBy:  m.ReleaseBy,
+	}
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Ticket, err error) {
+	ctx, span := telemetry.StartClient(ctx, "orders.MongoRepository.Get", attribute.String("ticket.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoTicket
+	if err := m.tickets.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find ticket: %w", err)
+	}
+	return doc.toTicket(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, t *Ticket) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "orders.MongoRepository.Save", attribute.String("ticket.id", t.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoTicket(t)
+	doc.Version = t.version + 1
+	if t.version == 0 {
+		if _, err := m.tickets.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save ticket: %w", err)
+		}
+	} else {
+		res, err := m.tickets.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: t.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save ticket: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	t.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Open(ctx context.Context, storeID uuid.UUID) (_ []*Ticket, err error) {
+	ctx, span := telemetry.StartClient(ctx, "orders.MongoRepository.Open", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "status", Value: bson.D{{Key: "$nin", Value: bson.A{string(StatusPickedUp), string(StatusScheduled)}}}},
+	}
+	cur, err := m.tickets.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "queued_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open tickets: %w", err)
+	}
+	return m.decode(ctx, cur)
+}
+
+func (m *MongoRepository) Scheduled(ctx context.Context, by time.Time) (_ []*Ticket, err error) {
+	ctx, span := telemetry.StartClient(ctx, "orders.MongoRepository.Scheduled")
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "status", Value: string(StatusScheduled)},
+		{Key: "release_by", Value: bson.D{{Key: "$lte", Value: by}}},
+	}
+	cur, err := m.tickets.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "release_by", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scheduled tickets: %w", err)
+	}
+	return m.decode(ctx, cur)
+}
+
+func (m *MongoRepository) decode(ctx context.Context, cur *mongo.Cursor) ([]*Ticket, error) {
+	var docs []mongoTicket
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode tickets: %w", err)
+	}
+	tickets := make([]*Ticket, 0, len(docs))
+	for _, doc := range docs {
+		tickets = append(tickets, doc.toTicket())
+	}
+	return tickets, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.tickets.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps tickets in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	tickets map[uuid.UUID]mongoTicket
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{tickets: map[uuid.UUID]mongoTicket{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.tickets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toTicket(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, t *Ticket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tickets[t.ID].Version != t.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoTicket(t)
+	doc.Version = t.version + 1
+	doc.Items = slices.Clone(t.Items)
+	m.tickets[t.ID] = doc
+	t.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Open(_ context.Context, storeID uuid.UUID) ([]*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tickets []*Ticket
+	for _, doc := range m.tickets {
+		if doc.StoreID == storeID.String() && doc.Status != string(StatusPickedUp) && doc.Status != string(StatusScheduled) {
+			tickets = append(tickets, doc.toTicket())
+		}
+	}
+	slices.SortFunc(tickets, func(a, b *Ticket) int { return a.QueuedAt.Compare(b.QueuedAt) })
+	return tickets, nil
+}
+
+func (m *MemoryRepository) Scheduled(_ context.Context, by time.Time) ([]*Ticket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tickets []*Ticket
+	for _, doc := range m.tickets {
+		if doc.Status == string(StatusScheduled) && !doc.ReleaseBy.After(by) {
+			tickets = append(tickets, doc.toTicket())
+		}
+	}
+	slices.SortFunc(tickets, func(a, b *Ticket) int { return a.releaseBy.Compare(b.releaseBy) })
+	return tickets, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
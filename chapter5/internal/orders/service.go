@@ -0,0 +1,322 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the ticket first.
+const saveAttempts = 3
+
+// StatusUpdates tells customers how their purchase is getting on, e.g. purchase.Service.
+type StatusUpdates interface {
+	UpdateStatus(ctx context.Context, id uuid.UUID, status purchase.Status) error
+}
+
+// ReleasePolicy says when the tickets of pickups scheduled in the app go to the bar.
+type ReleasePolicy struct {
+	// Radius is how close to the store, in metres, the customer's app has to say they are.
+	Radius float64
+	// Lead is how long before the pickup the ticket goes to the bar anyway, for customers whose app never
+	// says they are close.
+	Lead time.Duration
+}
+
+var DefaultRelease = ReleasePolicy{Radius: 400, Lead: 10 * time.Minute}
+
+// Entry is an open ticket of a store with when it should be ready.
+type Entry struct {
+	Ticket           *Ticket
+	EstimatedReadyAt time.Time
+}
+
+type Service struct {
+	repo      Repository
+	registry  *events.Registry
+	prepTimes PrepTimes
+	release   ReleasePolicy
+	publisher events.Publisher // 可选, 发布给厨房显示屏
+	statuses  StatusUpdates    // 可选, 同步购买状态
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes TicketUpdated for kitchen displays.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithStatusUpdates moves the purchase to preparing when its ticket is started and to ready when it is,
+// so customers following their order see what the bar does.
+func WithStatusUpdates(u StatusUpdates) Option {
+	return func(s *Service) {
+		s.statuses = u
+	}
+}
+
+// WithPrepTimes says how long items take, for the wait estimates. Items it leaves out take DefaultPrepTime.
+func WithPrepTimes(p PrepTimes) Option {
+	return func(s *Service) {
+		s.prepTimes = p
+	}
+}
+
+// WithRelease replaces DefaultRelease.
+func WithRelease(p ReleasePolicy) Option {
+	return func(s *Service) {
+		s.release = p
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test the wait estimates.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	s := &Service{repo: repo, registry: r, release: DefaultRelease, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handle is an events.Handler for the purchase topic that queues a ticket for every completed purchase.
+// The tickets of pickups scheduled in the app are held until they are released, see Approach and
+// ReleaseDue, unless the pickup is already within the release policy's lead. Other events are ignored, and
+// a purchase delivered twice is only queued once.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.Completed)
+	items := make([]string, 0, len(e.Lines))
+	for _, l := range e.Lines {
+		// Fees are charged on lines of their own, but there is nothing to make for them.
+		if l.ItemName == purchase.DeliveryFeeItem {
+			continue
+		}
+		items = append(items, l.ItemName)
+	}
+	t := NewTicket(e.PurchaseID, e.StoreID, e.CustomerID, items, e.PurchasedAt)
+	if t.PickupAt = e.PickupAt; !e.PickupAt.IsZero() {
+		if releaseBy := e.PickupAt.Add(-s.release.Lead); releaseBy.After(e.PurchasedAt) {
+			t.hold(releaseBy)
+		}
+	}
+	err = s.repo.Save(ctx, t)
+	if errors.Is(err, ErrConcurrencyConflict) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to queue ticket: %w", err)
+	}
+	// Kitchen displays only see a scheduled ticket once it is released.
+	if t.status != StatusScheduled {
+		s.publish(ctx, t)
+	}
+	return nil
+}
+
+// Approach is told by the customer's app how far from the store of a scheduled pickup they are, in metres.
+// The ticket is released to the bar once they are within the release radius. Reports for tickets that are
+// already released change nothing, so the app can keep sending them.
+func (s *Service) Approach(ctx context.Context, id uuid.UUID, distance float64) (*Ticket, error) {
+	t, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if t.status != StatusScheduled || distance > s.release.Radius {
+		return t, nil
+	}
+	return s.releaseTicket(ctx, id, ReleasedNearby)
+}
+
+// ReleaseDue releases the scheduled tickets whose customers never said they were close, in time for their
+// pickup, and tells how many it released. A ticket it fails to release is tried again next time.
+func (s *Service) ReleaseDue(ctx context.Context) (int, error) {
+	due, err := s.repo.Scheduled(ctx, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find scheduled tickets: %w", err)
+	}
+	released := 0
+	var errs []error
+	for _, t := range due {
+		if _, err := s.releaseTicket(ctx, t.ID, ReleasedOnTime); err != nil {
+			errs = append(errs, fmt.Errorf("failed to release ticket %s: %w", t.ID, err))
+			continue
+		}
+		released++
+	}
+	return released, errors.Join(errs...)
+}
+
+// Run releases the scheduled tickets that are due every interval until ctx is done.
+func (s *Service) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		n, err := s.ReleaseDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "scheduled tickets due not released", "error", err)
+		}
+		if n > 0 {
+			s.logger.InfoContext(ctx, "scheduled tickets released", "released", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// releaseTicket puts a scheduled ticket on the queue and publishes that it was released, for why. A
+// ticket someone else released in the meantime is returned as it is.
+func (s *Service) releaseTicket(ctx context.Context, id uuid.UUID, why ReleaseReason) (*Ticket, error) {
+	t, err := s.update(ctx, id, "", func(t *Ticket) error {
+		return t.Release(s.now())
+	})
+	if errors.Is(err, ErrInvalidTransition) {
+		return s.repo.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.publisher != nil {
+		e := TicketReleased{TicketID: t.ID, StoreID: t.StoreID, CustomerID: t.CustomerID, Reason: why, PickupAt: t.PickupAt, ReleasedAt: t.QueuedAt}
+		if err := s.publisher.Publish(ctx, e); err != nil {
+			s.logger.ErrorContext(ctx, "ticket released but not published", "ticket", t.ID, "error", err)
+		}
+	}
+	return t, nil
+}
+
+func (s *Service) Ticket(ctx context.Context, id uuid.UUID) (*Ticket, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Queue returns the open tickets of a store, oldest first, with when each should be ready.
+func (s *Service) Queue(ctx context.Context, storeID uuid.UUID) ([]Entry, error) {
+	open, err := s.repo.Open(ctx, storeID)
+	if err != nil {
+		return nil, err
+	}
+	estimates := s.prepTimes.Estimate(open, s.now())
+	entries := make([]Entry, 0, len(open))
+	for _, t := range open {
+		entries = append(entries, Entry{Ticket: t, EstimatedReadyAt: estimates[t.ID]})
+	}
+	return entries, nil
+}
+
+// Start is called by the barista who takes a ticket from the queue.
+func (s *Service) Start(ctx context.Context, id uuid.UUID, barista string) error {
+	_, err := s.update(ctx, id, purchase.StatusPreparing, func(t *Ticket) error {
+		return t.Start(barista, s.now())
+	})
+	return err
+}
+
+func (s *Service) Ready(ctx context.Context, id uuid.UUID) error {
+	_, err := s.update(ctx, id, purchase.StatusReady, func(t *Ticket) error {
+		return t.Ready(s.now())
+	})
+	return err
+}
+
+func (s *Service) PickUp(ctx context.Context, id uuid.UUID) error {
+	_, err := s.update(ctx, id, "", func(t *Ticket) error {
+		return t.PickUp(s.now())
+	})
+	return err
+}
+
+// update applies fn to the latest ticket and saves it, starting over if someone else saved in between; a
+// barista who lost the race then gets ErrInvalidTransition. Once saved, the purchase is moved to status,
+// if any, and the change is published. Failing either is only logged, the bar has moved on regardless.
+func (s *Service) update(ctx context.Context, id uuid.UUID, status purchase.Status, fn func(t *Ticket) error) (*Ticket, error) {
+	for range saveAttempts {
+		t, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(t); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, t)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status != "" && s.statuses != nil {
+			if err := s.statuses.UpdateStatus(ctx, id, status); err != nil {
+				s.logger.ErrorContext(ctx, "ticket saved but the purchase status was not updated", "ticket", id, "status", status, "error", err)
+			}
+		}
+		s.publish(ctx, t)
+		return t, nil
+	}
+	return nil, fmt.Errorf("failed to update ticket after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) publish(ctx context.Context, t *Ticket) {
+	if s.publisher == nil {
+		return
+	}
+	e := TicketUpdated{
+		TicketID:   t.ID,
+		StoreID:    t.StoreID,
+		CustomerID: t.CustomerID,
+		Items:      t.Items,
+		Status:     t.status,
+		Barista:    t.barista,
+		StartedAt:  t.startedAt,
+		UpdatedAt:  s.now().UTC(),
+	}
+	if t.status != StatusPickedUp {
+		queue, err := s.Queue(ctx, t.StoreID)
+		if err != nil {
+			s.logger.WarnContext(ctx, "ticket published without a wait estimate", "ticket", t.ID, "error", err)
+		}
+		for _, entry := range queue {
+			if entry.Ticket.ID == t.ID {
+				e.EstimatedReadyAt = entry.EstimatedReadyAt
+			}
+		}
+	}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		s.logger.ErrorContext(ctx, "ticket saved but not published", "ticket", t.ID, "error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package orders
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("ticket not found")
+	ErrInvalidTransition   = errors.New("ticket cannot move to that status")
+	ErrNoBarista           = errors.New("a ticket is started by a barista")
+	ErrConcurrencyConflict = errors.New("ticket changed since it was read")
+)
+
+// Status is where a ticket is on the bar, from the till to the pick-up counter.
+type Status string
+
+const (
+	// StatusScheduled tickets are for pickups scheduled in the app. They are kept off the queue until the
+	// customer is close, or the pickup is near.
+	StatusScheduled  Status = "scheduled"
+	StatusQueued     Status = "queued"
+	StatusInProgress Status = "in_progress"
+	StatusReady      Status = "ready"
+	StatusPickedUp   Status = "picked_up"
+)
+
+// Ticket is what the bar makes for one purchase. It shares the purchase's ID, so a purchase never gets
+// two tickets.
+type Ticket struct {
+	ID         uuid.UUID
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID
+	Items      []string
+	// QueuedAt is when the ticket joined the queue; for scheduled tickets, when they were released to it.
+	QueuedAt time.Time
+	// PickupAt is when the customer scheduled to collect the order, zero if they did not.
+	PickupAt time.Time
+
+	version    int
+	status     Status
+	barista    string
+	startedAt  time.Time
+	readyAt    time.Time
+	pickedUpAt time.Time
+	// releaseBy is when a scheduled ticket is released if the customer's app never says they are close.
+	releaseBy time.Time
+}
+
+// NewTicket queues the items of a purchase at its store.
+func NewTicket(purchaseID, storeID, customerID uuid.UUID, items []string, queuedAt time.Time) *Ticket {
+	return &Ticket{
+		ID:         purchaseID,
+		StoreID:    storeID,
+		CustomerID: customerID,
+		Items:      items,
+		QueuedAt:   queuedAt.UTC(),
+		status:     StatusQueued,
+	}
+}
+
+func (t *Ticket) Status() Status {
+	return t.status
+}
+
+// ReleaseBy is when a scheduled ticket goes to the bar at the latest, zero for other tickets.
+func (t *Ticket) ReleaseBy() time.Time {
+	return t.releaseBy
+}
+
+// Barista is who started the ticket, empty while it is queued.
+func (t *Ticket) Barista() string {
+	return t.barista
+}
+
+func (t *Ticket) StartedAt() time.Time {
+	return t.startedAt
+}
+
+func (t *Ticket) ReadyAt() time.Time {
+	return t.readyAt
+}
+
+func (t *Ticket) PickedUpAt() time.Time {
+	return t.pickedUpAt
+}
+
+// hold keeps a queued ticket off the queue until it is released, by releaseBy at the latest.
+func (t *Ticket) hold(releaseBy time.Time) {
+	t.status = StatusScheduled
+	t.releaseBy = releaseBy.UTC()
+}
+
+// Release puts a scheduled ticket at the end of the queue.
+func (t *Ticket) Release(at time.Time) error {
+	if err := t.move(StatusScheduled, StatusQueued); err != nil {
+		return err
+	}
+	t.QueuedAt = at.UTC()
+	return nil
+}
+
+// Start is called by the barista who takes the ticket from the queue.
+func (t *Ticket) Start(barista string, at time.Time) error {
+	if barista == "" {
+		return ErrNoBarista
+	}
+	if err := t.move(StatusQueued, StatusInProgress); err != nil {
+		return err
+	}
+	t.barista = barista
+	t.startedAt = at.UTC()
+	return nil
+}
+
+// Ready is called once everything on the ticket is on the counter.
+func (t *Ticket) Ready(at time.Time) error {
+	if err := t.move(StatusInProgress, StatusReady); err != nil {
+		return err
+	}
+	t.readyAt = at.UTC()
+	return nil
+}
+
+// PickUp is called once the customer took their order, which takes the ticket off the display.
+func (t *Ticket) PickUp(at time.Time) error {
+	if err := t.move(StatusReady, StatusPickedUp); err != nil {
+		return err
+	}
+	t.pickedUpAt = at.UTC()
+	return nil
+}
+
+func (t *Ticket) move(from, to Status) error {
+	if t.status != from {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, t.ID, t.status, from)
+	}
+	t.status = to
+	return nil
+}
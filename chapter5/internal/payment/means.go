@@ -6,6 +6,11 @@ const (
 	MEANS_CARD      = "card"
 	MEANS_CASH      = "cash"
 	MEANS_COFFEEBUX = "coffeebux"
+	// MEANS_MARKETPLACE is an order taken on a marketplace such as Uber Eats, which collects the payment
+	// and settles with us.
+	MEANS_MARKETPLACE = "marketplace"
+	// MEANS_WALLET pays from the balance the customer topped up their CoffeeCo wallet with.
+	MEANS_WALLET = "wallet"
 )
 
 type CardDetails struct {
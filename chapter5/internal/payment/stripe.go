@@ -4,10 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Rhymond/go-money"
 	"github.com/stripe/stripe-go/v73"
 	"github.com/stripe/stripe-go/v73/client"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
 )
 
 type StripeService struct {
@@ -18,20 +25,155 @@ func NewStripeService(apiKey string) (*StripeService, error) {
 	if apiKey == "" {
 		return nil, errors.New("API key cannot be nil ")
 	}
+	// Calls to Stripe carry the trace context, so they show up as children of the purchase that made them.
+	httpClient := &http.Client{Timeout: 80 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	backend := func(b stripe.SupportedBackend) stripe.Backend {
+		return stripe.GetBackendWithConfig(b, &stripe.BackendConfig{HTTPClient: httpClient})
+	}
 	sc := &client.API{}
-	sc.Init(apiKey, nil)
+	sc.Init(apiKey, &stripe.Backends{
+		API:     backend(stripe.APIBackend),
+		Connect: backend(stripe.ConnectBackend),
+		Uploads: backend(stripe.UploadsBackend),
+	})
 	return &StripeService{stripeClient: sc}, nil
 }
 
 func (s StripeService) ChargeCard(ctx context.Context, amount money.Money, cardToken string) error {
+	_, err := s.Charge(ctx, amount, cardToken)
+	return err
+}
+
+// Charge is like ChargeCard but returns the charge ID, which is needed to refund it.
+func (s StripeService) Charge(ctx context.Context, amount money.Money, cardToken string) (_ string, err error) {
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.Charge", attribute.String("payment.currency", amount.Currency().Code))
+	defer telemetry.End(span, &err)
 	params := &stripe.ChargeParams{
 		Amount:   stripe.Int64(amount.Amount()),
-		Currency: stripe.String(string(stripe.CurrencyUSD)),
+		Currency: stripe.String(currency(amount)),
 		Source:   &stripe.PaymentSourceSourceParams{Token: stripe.String(cardToken)},
 	}
-	_, err := s.stripeClient.Charges.New(params)
+	params.Context = ctx
+	ch, err := s.stripeClient.Charges.New(params)
 	if err != nil {
-		return fmt.Errorf("failed to create a charge:%w", err)
+		return "", fmt.Errorf("failed to create a charge:%w", err)
+	}
+	return ch.ID, nil
+}
+
+// Authorize holds amount on the card without charging it, e.g. until a scheduled pickup. It returns the ID
+// of the uncaptured charge, which Capture charges and Void releases. Stripe lets an authorization expire
+// after seven days.
+func (s StripeService) Authorize(ctx context.Context, amount money.Money, cardToken string) (_ string, err error) {
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.Authorize", attribute.String("payment.currency", amount.Currency().Code))
+	defer telemetry.End(span, &err)
+	params := &stripe.ChargeParams{
+		Amount:   stripe.Int64(amount.Amount()),
+		Currency: stripe.String(currency(amount)),
+		Source:   &stripe.PaymentSourceSourceParams{Token: stripe.String(cardToken)},
+		Capture:  stripe.Bool(false),
+	}
+	params.Context = ctx
+	ch, err := s.stripeClient.Charges.New(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to authorize a charge: %w", err)
+	}
+	return ch.ID, nil
+}
+
+// currency is the Stripe currency code of amount, which Stripe wants in lower case.
+func currency(amount money.Money) string {
+	return strings.ToLower(amount.Currency().Code)
+}
+
+// Capture charges amount of an authorization, releasing the rest. It is idempotent, so a capture that timed
+// out can be tried again.
+func (s StripeService) Capture(ctx context.Context, chargeID string, amount money.Money) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.Capture")
+	defer telemetry.End(span, &err)
+	params := &stripe.ChargeCaptureParams{Amount: stripe.Int64(amount.Amount())}
+	params.Context = ctx
+	params.SetIdempotencyKey("capture-" + chargeID)
+	if _, err := s.stripeClient.Charges.Capture(chargeID, params); err != nil {
+		return fmt.Errorf("failed to capture charge %s: %w", chargeID, err)
 	}
 	return nil
 }
+
+// Void releases an authorization that will not be captured.
+func (s StripeService) Void(ctx context.Context, chargeID string) error {
+	return s.Refund(ctx, chargeID)
+}
+
+// Ping is a heartbeat against the Stripe API: fetching the balance is cheap and needs a valid key.
+func (s StripeService) Ping(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	if _, err := s.stripeClient.Balance.Get(params); err != nil {
+		return fmt.Errorf("stripe unavailable: %w", err)
+	}
+	return nil
+}
+
+// Refund returns the full amount of a previous charge to the card.
+func (s StripeService) Refund(ctx context.Context, chargeID string) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.Refund")
+	defer telemetry.End(span, &err)
+	params := &stripe.RefundParams{Charge: stripe.String(chargeID)}
+	params.Context = ctx
+	if _, err := s.stripeClient.Refunds.New(params); err != nil {
+		return fmt.Errorf("failed to refund charge %s: %w", chargeID, err)
+	}
+	return nil
+}
+
+// RefundAmount returns part of a previous charge to the card, e.g. the days left of a cancelled pass.
+func (s StripeService) RefundAmount(ctx context.Context, chargeID string, amount money.Money) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.RefundAmount")
+	defer telemetry.End(span, &err)
+	params := &stripe.RefundParams{Charge: stripe.String(chargeID), Amount: stripe.Int64(amount.Amount())}
+	params.Context = ctx
+	if _, err := s.stripeClient.Refunds.New(params); err != nil {
+		return fmt.Errorf("failed to refund %s of charge %s: %w", amount.Display(), chargeID, err)
+	}
+	return nil
+}
+
+// RevokePaymentMethod detaches a saved payment method (pm_...) from its Stripe customer, so it cannot be
+// charged again, and reports whether there was one to detach. Card tokens (tok_...) are single use and
+// were spent by the charge they paid for, so there is nothing to revoke.
+func (s StripeService) RevokePaymentMethod(ctx context.Context, token string) (_ bool, err error) {
+	if !strings.HasPrefix(token, "pm_") {
+		return false, nil
+	}
+	ctx, span := telemetry.StartClient(ctx, "payment.StripeService.RevokePaymentMethod")
+	defer telemetry.End(span, &err)
+	params := &stripe.PaymentMethodDetachParams{}
+	params.Context = ctx
+	if _, err := s.stripeClient.PaymentMethods.Detach(token, params); err != nil {
+		return false, fmt.Errorf("failed to detach payment method: %w", err)
+	}
+	return true, nil
+}
+
+// DeclineCode is why Stripe refused a charge, e.g. "insufficient_funds", or "unknown" if err did not come
+// from Stripe or gives no reason.
+func DeclineCode(err error) string {
+	var serr *stripe.Error
+	if !errors.As(err, &serr) {
+		return "unknown"
+	}
+	switch {
+	case serr.DeclineCode != "":
+		return string(serr.DeclineCode)
+	case serr.Code != "":
+		return string(serr.Code)
+	}
+	return "unknown"
+}
+
+// IsDecline reports whether err is Stripe refusing the card, which means Stripe itself is up.
+func IsDecline(err error) bool {
+	var serr *stripe.Error
+	return errors.As(err, &serr) && serr.Type == stripe.ErrorTypeCard
+}
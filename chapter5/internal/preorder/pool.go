@@ -0,0 +1,207 @@
+package preorder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// captureTimeout bounds a single call to a gateway.
+	captureTimeout = 30 * time.Second
+	// captureLease is how long a claimed pre-order is left to its worker. It is longer than captureTimeout,
+	// so only a worker that went away loses its pre-orders to another.
+	captureLease = 2 * time.Minute
+)
+
+// Capture outcomes, as recorded.
+const (
+	outcomeCaptured = "captured"
+	outcomeRetrying = "retrying"
+	outcomeFailed   = "failed"
+	outcomeSkipped  = "skipped"
+)
+
+// RetryPolicy says how a capture that failed is tried again: after Backoff, then twice as long after each
+// further failure, until MaxAttempts were made.
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+func (r RetryPolicy) delay(attempts int) time.Duration {
+	return r.Backoff << max(attempts-1, 0)
+}
+
+// PoolConfig sizes the workers that capture pre-orders.
+type PoolConfig struct {
+	// Every is how often pre-orders that are due are looked for.
+	Every time.Duration
+	// Window is how long before the pickup a pre-order is due, so it is paid for by the time it is picked up.
+	Window time.Duration
+	// Workers is how many captures run at once.
+	Workers int
+	// GatewayLimits caps how many of the captures run at once go to a gateway, by gateway name, e.g. to stay
+	// within its rate limits. A gateway without a limit can have all the workers.
+	GatewayLimits map[string]int
+	Retry         RetryPolicy
+}
+
+var DefaultPool = PoolConfig{
+	Every:   time.Minute,
+	Window:  15 * time.Minute,
+	Workers: 4,
+	Retry:   RetryPolicy{MaxAttempts: 5, Backoff: 30 * time.Second},
+}
+
+// CaptureReport is what CaptureDue did.
+type CaptureReport struct {
+	Captured int
+	// Retrying pre-orders failed to capture and are tried again after their backoff.
+	Retrying int
+	// Failed pre-orders ran out of attempts. They stay authorized at the gateway until it lets them expire.
+	Failed int
+	// Skipped pre-orders were claimed by another worker first, or their gateway is not configured here.
+	Skipped int
+	Elapsed time.Duration
+}
+
+// Throughput is how many pre-orders were captured per second.
+func (r CaptureReport) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Captured) / r.Elapsed.Seconds()
+}
+
+func (r *CaptureReport) count(outcome string) {
+	switch outcome {
+	case outcomeCaptured:
+		r.Captured++
+	case outcomeRetrying:
+		r.Retrying++
+	case outcomeFailed:
+		r.Failed++
+	default:
+		r.Skipped++
+	}
+}
+
+// CaptureDue captures the authorizations of every pre-order due within the window, on a bounded pool of
+// workers. Any number of instances can run it at once: a worker claims a pre-order before capturing it, so
+// only one of them captures it.
+func (s *Service) CaptureDue(ctx context.Context) (CaptureReport, error) {
+	start := time.Now()
+	now := s.now()
+	due, err := s.repo.Due(ctx, now.Add(s.pool.Window), now)
+	if err != nil {
+		return CaptureReport{}, err
+	}
+	workers := max(s.pool.Workers, 1)
+	limits := map[string]chan struct{}{}
+	for name := range s.gateways {
+		n := s.pool.GatewayLimits[name]
+		if n <= 0 || n > workers {
+			n = workers
+		}
+		limits[name] = make(chan struct{}, n)
+	}
+
+	var (
+		mu     sync.Mutex
+		report CaptureReport
+		wg     sync.WaitGroup
+	)
+	queue := make(chan *PreOrder)
+	for range workers {
+		wg.Go(func() {
+			for p := range queue {
+				outcome := s.capture(ctx, p, limits[p.Gateway])
+				mu.Lock()
+				report.count(outcome)
+				mu.Unlock()
+			}
+		})
+	}
+feed:
+	for _, p := range due {
+		select {
+		case queue <- p:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	report.Elapsed = time.Since(start)
+	return report, ctx.Err()
+}
+
+// capture claims p, captures it within the limit of its gateway and records how it went.
+func (s *Service) capture(ctx context.Context, p *PreOrder, limit chan struct{}) string {
+	g, ok := s.gateways[p.Gateway]
+	if !ok {
+		s.logger.WarnContext(ctx, "pre-order due on a gateway that is not configured", "pre_order", p.ID, "gateway", p.Gateway)
+		return outcomeSkipped
+	}
+	if err := p.claim(s.now().Add(captureLease)); err != nil {
+		return outcomeSkipped
+	}
+	if err := s.repo.Save(ctx, p); err != nil {
+		if !errors.Is(err, ErrConcurrencyConflict) {
+			s.logger.ErrorContext(ctx, "pre-order not claimed", "pre_order", p.ID, "error", err)
+		}
+		return outcomeSkipped
+	}
+	select {
+	case limit <- struct{}{}:
+	case <-ctx.Done():
+		// The claim lapses, and the pre-order is captured on a later run.
+		return outcomeSkipped
+	}
+	start := time.Now()
+	captureCtx, cancel := context.WithTimeout(ctx, captureTimeout)
+	err := g.Capture(captureCtx, p.AuthorizationID, p.Amount)
+	cancel()
+	<-limit
+
+	outcome := outcomeCaptured
+	switch {
+	case err == nil:
+		_ = p.captured(s.now())
+	case p.attempts >= s.pool.Retry.MaxAttempts:
+		outcome = outcomeFailed
+		p.fail(err.Error())
+		s.logger.WarnContext(ctx, "pre-order capture failed for good", "pre_order", p.ID, "attempts", p.attempts, "error", err)
+	default:
+		outcome = outcomeRetrying
+		p.retry(err.Error(), s.now().Add(s.pool.Retry.delay(p.attempts)))
+	}
+	s.recorder.PreOrderCaptureAttempted(p.Gateway, outcome, time.Since(start))
+	if err := s.repo.Save(context.WithoutCancel(ctx), p); err != nil {
+		// The claim lapses and the capture is tried again, which the gateway takes as the same capture.
+		s.logger.ErrorContext(ctx, "pre-order capture not recorded", "pre_order", p.ID, "outcome", outcome, "error", err)
+	}
+	return outcome
+}
+
+// Run captures the pre-orders that are due every PoolConfig.Every until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.pool.Every)
+	defer ticker.Stop()
+	for {
+		report, err := s.CaptureDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "pre-orders due not captured", "error", err)
+		}
+		if report.Captured+report.Retrying+report.Failed > 0 {
+			s.logger.InfoContext(ctx, "pre-orders captured", "captured", report.Captured, "retrying", report.Retrying, "failed", report.Failed, "per_second", report.Throughput())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
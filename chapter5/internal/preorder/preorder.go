@@ -0,0 +1,121 @@
+package preorder
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("pre-order not found")
+	ErrConcurrencyConflict = errors.New("pre-order changed since it was read")
+	ErrInvalidAmount       = errors.New("pre-order amount must be positive")
+	ErrPickupInPast        = errors.New("pickup must be in the future")
+	ErrPickupTooFar        = errors.New("pickup is further ahead than a card authorization lasts")
+	ErrNoGateway           = errors.New("pre-orders cannot be paid for without a gateway")
+	ErrNotAuthorized       = errors.New("pre-order is no longer waiting to be captured")
+)
+
+// AuthorizationLifetime is how long a card authorization can be relied on; card networks let them expire
+// after about a week, so pickups cannot be scheduled further ahead.
+const AuthorizationLifetime = 7 * 24 * time.Hour
+
+// Status is where the payment of a pre-order is.
+type Status string
+
+const (
+	// StatusAuthorized pre-orders have their amount held on the card until the pickup is due.
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	// StatusFailed pre-orders could not be captured however often it was tried.
+	StatusFailed Status = "failed"
+)
+
+// PreOrder is a pickup scheduled ahead, paid for by a card authorization that is captured shortly before
+// the pickup.
+type PreOrder struct {
+	ID         uuid.UUID
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID
+	Amount     money.Money
+	PickupAt   time.Time
+	// Gateway is the name of the gateway that authorized the card, which has to capture it too.
+	Gateway         string
+	AuthorizationID string
+	PlacedAt        time.Time
+
+	version  int
+	status   Status
+	attempts int
+	// nextAttemptAt is when the capture may be tried (again). While a capture is in progress it is when the
+	// capture is given up on, so a worker that crashed does not keep the pre-order forever.
+	nextAttemptAt time.Time
+	lastError     string
+	capturedAt    time.Time
+}
+
+func NewPreOrder(storeID, customerID uuid.UUID, amount money.Money, pickupAt time.Time, gateway, authorizationID string, at time.Time) *PreOrder {
+	return &PreOrder{
+		ID:              uuid.New(),
+		StoreID:         storeID,
+		CustomerID:      customerID,
+		Amount:          amount,
+		PickupAt:        pickupAt.UTC(),
+		Gateway:         gateway,
+		AuthorizationID: authorizationID,
+		PlacedAt:        at.UTC(),
+		status:          StatusAuthorized,
+	}
+}
+
+func (p *PreOrder) Status() Status {
+	return p.status
+}
+
+// Attempts is how often the capture was started.
+func (p *PreOrder) Attempts() int {
+	return p.attempts
+}
+
+// LastError is why the last capture failed.
+func (p *PreOrder) LastError() string {
+	return p.lastError
+}
+
+func (p *PreOrder) CapturedAt() time.Time {
+	return p.capturedAt
+}
+
+// claim starts a capture, which is given up on at until.
+func (p *PreOrder) claim(until time.Time) error {
+	if p.status != StatusAuthorized {
+		return fmt.Errorf("%w: %s is %s", ErrNotAuthorized, p.ID, p.status)
+	}
+	p.attempts++
+	p.nextAttemptAt = until.UTC()
+	return nil
+}
+
+func (p *PreOrder) captured(at time.Time) error {
+	if p.status != StatusAuthorized {
+		return fmt.Errorf("%w: %s is %s", ErrNotAuthorized, p.ID, p.status)
+	}
+	p.status = StatusCaptured
+	p.capturedAt = at.UTC()
+	p.lastError = ""
+	return nil
+}
+
+// retry puts the capture off until at.
+func (p *PreOrder) retry(reason string, at time.Time) {
+	p.nextAttemptAt = at.UTC()
+	p.lastError = reason
+}
+
+func (p *PreOrder) fail(reason string) {
+	p.status = StatusFailed
+	p.lastError = reason
+}
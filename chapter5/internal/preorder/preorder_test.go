@@ -0,0 +1,174 @@
+package preorder_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/preorder"
+)
+
+// gateway records how many captures it had at once, and fails the first failures of them.
+type gateway struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	captured map[string]int
+	failures int
+}
+
+func newGateway() *gateway {
+	return &gateway{captured: map[string]int{}}
+}
+
+func (g *gateway) Authorize(context.Context, money.Money, string) (string, error) {
+	return "ch_" + uuid.NewString(), nil
+}
+
+func (g *gateway) Capture(_ context.Context, authorizationID string, _ money.Money) error {
+	g.mu.Lock()
+	g.inFlight++
+	g.peak = max(g.peak, g.inFlight)
+	fail := g.failures > 0
+	if fail {
+		g.failures--
+	}
+	g.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	if fail {
+		return errors.New("gateway unavailable")
+	}
+	g.captured[authorizationID]++
+	return nil
+}
+
+func (g *gateway) Void(context.Context, string) error {
+	return nil
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func Test_PickupsAreScheduledWithinAnAuthorization(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)}
+	svc := preorder.NewService(preorder.NewMemoryRepo(), preorder.WithClock(c.Now))
+	storeID, customerID := uuid.New(), uuid.New()
+
+	if _, err := svc.Place(ctx, storeID, customerID, *money.New(450, "USD"), c.now.Add(time.Hour), "tok"); !errors.Is(err, preorder.ErrNoGateway) {
+		t.Fatalf("expected no pre-orders without a gateway but got %v", err)
+	}
+	svc = preorder.NewService(preorder.NewMemoryRepo(), preorder.WithGateway("stripe", newGateway()), preorder.WithClock(c.Now))
+	if _, err := svc.Place(ctx, storeID, customerID, *money.New(450, "USD"), c.now.Add(-time.Minute), "tok"); !errors.Is(err, preorder.ErrPickupInPast) {
+		t.Fatalf("expected a pickup in the past to be turned down but got %v", err)
+	}
+	if _, err := svc.Place(ctx, storeID, customerID, *money.New(450, "USD"), c.now.Add(8*24*time.Hour), "tok"); !errors.Is(err, preorder.ErrPickupTooFar) {
+		t.Fatalf("expected a pickup next week to outlast its authorization but got %v", err)
+	}
+	p, err := svc.Place(ctx, storeID, customerID, *money.New(450, "USD"), c.now.Add(time.Hour), "tok")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if p.Status() != preorder.StatusAuthorized || p.Gateway != "stripe" || p.AuthorizationID == "" {
+		t.Fatalf("expected the pre-order to be authorized on stripe but got %s on %q", p.Status(), p.Gateway)
+	}
+}
+
+func Test_DuePreOrdersAreCapturedWithinTheGatewayLimit(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)}
+	g := newGateway()
+	svc := preorder.NewService(preorder.NewMemoryRepo(), preorder.WithGateway("stripe", g), preorder.WithClock(c.Now),
+		preorder.WithPool(preorder.PoolConfig{
+			Window:        15 * time.Minute,
+			Workers:       8,
+			GatewayLimits: map[string]int{"stripe": 2},
+			Retry:         preorder.RetryPolicy{MaxAttempts: 3, Backoff: time.Minute},
+		}))
+
+	var due []*preorder.PreOrder
+	for i := range 10 {
+		p, err := svc.Place(ctx, uuid.New(), uuid.New(), *money.New(450, "USD"), c.now.Add(time.Duration(i+1)*time.Minute), "tok")
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		due = append(due, p)
+	}
+	later, err := svc.Place(ctx, uuid.New(), uuid.New(), *money.New(450, "USD"), c.now.Add(time.Hour), "tok")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	report, err := svc.CaptureDue(ctx)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if report.Captured != 10 || report.Retrying+report.Failed+report.Skipped != 0 {
+		t.Fatalf("expected the 10 pickups within the window captured but got %+v", report)
+	}
+	if g.peak > 2 {
+		t.Fatalf("expected at most 2 captures at once on stripe but there were %d", g.peak)
+	}
+	for _, p := range due {
+		if g.captured[p.AuthorizationID] != 1 {
+			t.Fatalf("expected %s captured once but it was captured %d times", p.ID, g.captured[p.AuthorizationID])
+		}
+		if p, _ = svc.Get(ctx, p.ID); p.Status() != preorder.StatusCaptured {
+			t.Fatalf("expected %s captured but got %s", p.ID, p.Status())
+		}
+	}
+	if p, _ := svc.Get(ctx, later.ID); p.Status() != preorder.StatusAuthorized {
+		t.Fatalf("expected the pickup in an hour to wait but got %s", p.Status())
+	}
+
+	// Running again captures nothing twice.
+	if report, _ := svc.CaptureDue(ctx); report.Captured != 0 {
+		t.Fatalf("expected nothing left to capture but got %+v", report)
+	}
+}
+
+func Test_FailedCapturesAreRetriedWithBackoffThenGivenUp(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)}
+	g := newGateway()
+	g.failures = 1
+	svc := preorder.NewService(preorder.NewMemoryRepo(), preorder.WithGateway("stripe", g), preorder.WithClock(c.Now),
+		preorder.WithPool(preorder.PoolConfig{Window: 15 * time.Minute, Workers: 1, Retry: preorder.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute}}))
+
+	p, _ := svc.Place(ctx, uuid.New(), uuid.New(), *money.New(450, "USD"), c.now.Add(10*time.Minute), "tok")
+	if report, _ := svc.CaptureDue(ctx); report.Retrying != 1 {
+		t.Fatalf("expected the capture to be retried but got %+v", report)
+	}
+	if report, _ := svc.CaptureDue(ctx); report.Captured+report.Retrying != 0 {
+		t.Fatalf("expected the retry to wait for its backoff but got %+v", report)
+	}
+	c.now = c.now.Add(time.Minute)
+	if report, _ := svc.CaptureDue(ctx); report.Captured != 1 {
+		t.Fatalf("expected the retry to capture but got %+v", report)
+	}
+	if p, _ = svc.Get(ctx, p.ID); p.Status() != preorder.StatusCaptured || p.Attempts() != 2 {
+		t.Fatalf("expected the pre-order captured on the second attempt but got %s after %d", p.Status(), p.Attempts())
+	}
+
+	g.failures = 2
+	q, _ := svc.Place(ctx, uuid.New(), uuid.New(), *money.New(450, "USD"), c.now.Add(10*time.Minute), "tok")
+	_, _ = svc.CaptureDue(ctx)
+	c.now = c.now.Add(time.Minute)
+	if report, _ := svc.CaptureDue(ctx); report.Failed != 1 {
+		t.Fatalf("expected the capture given up after 2 attempts but got %+v", report)
+	}
+	if q, _ = svc.Get(ctx, q.ID); q.Status() != preorder.StatusFailed || q.LastError() == "" {
+		t.Fatalf("expected the pre-order failed with why but got %s %q", q.Status(), q.LastError())
+	}
+}
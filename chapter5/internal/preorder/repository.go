@@ -0,0 +1,236 @@
+package preorder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such pre-order.
+	Get(ctx context.Context, id uuid.UUID) (*PreOrder, error)
+	// Due returns the authorized pre-orders picked up by pickupBy whose capture may be tried at at, earliest
+	// pickup first.
+	Due(ctx context.Context, pickupBy, at time.Time) ([]*PreOrder, error)
+	// Save returns ErrConcurrencyConflict if the pre-order was saved by someone else since it was read, so
+	// two workers never capture the same pre-order at once.
+	Save(ctx context.Context, p *PreOrder) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps pre-orders versioned.
+type MongoRepository struct {
+	client    *mongo.Client
+	preOrders *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	preOrders := client.Database("coffeeco").Collection("pre_orders")
+	_, err = preOrders.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "pickup_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pre-order indexes: %w", err)
+	}
+	return &MongoRepository{client: client, preOrders: preOrders}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoPreOrder struct {
+	ID              string    `bson:"_id"`
+	Version         int       `bson:"version"`
+	StoreID         string    `bson:"store_id"`
+	CustomerID      string    `bson:"customer_id"`
+	Amount          int64     `bson:"amount"`
+	Currency        string    `bson:"currency"`
+	PickupAt        time.Time `bson:"pickup_at"`
+	Gateway         string    `bson:"gateway"`
+	AuthorizationID string    `bson:"authorization_id"`
+	PlacedAt        time.Time `bson:"placed_at"`
+	Status          string    `bson:"status"`
+	Attempts        int       `bson:"attempts"`
+	NextAttemptAt   time.Time `bson:"next_attempt_at"`
+	LastError       string    `bson:"last_error,omitempty"`
+	CapturedAt      time.Time `bson:"captured_at,omitempty"`
+}
+
+func toMongoPreOrder(p *PreOrder) mongoPreOrder {
+	return mongoPreOrder{
+		ID:              p.ID.String(),
+		Version:         p.version,
+		StoreID:         p.StoreID.String(),
+		CustomerID:      p.CustomerID.String(),
+		Amount:          p.Amount.Amount(),
+		Currency:        p.Amount.Currency().Code,
+		PickupAt:        p.PickupAt,
+		Gateway:         p.Gateway,
+		AuthorizationID: p.AuthorizationID,
+		PlacedAt:        p.PlacedAt,
+		Status:          string(p.status),
+		Attempts:        p.attempts,
+		NextAttemptAt:   p.nextAttemptAt,
+		LastError:       p.lastError,
+		CapturedAt:      p.capturedAt,
+	}
+}
+
+func (m mongoPreOrder) toPreOrder() *PreOrder {
+	p := &PreOrder{
+		Amount:          *money.New(m.Amount, m.Currency),
+		PickupAt:        m.PickupAt,
+		Gateway:         m.Gateway,
+		AuthorizationID: m.AuthorizationID,
+		PlacedAt:        m.PlacedAt,
+		version:         m.Version,
+		status:          Status(m.Status),
+		attempts:        m.Attempts,
+		nextAttemptAt:   m.NextAttemptAt,
+		lastError:       m.LastError,
+		capturedAt:      m.CapturedAt,
+	}
+	p.ID, _ = uuid.Parse(m.ID)
+	p.StoreID, _ = uuid.Parse(m.StoreID)
+	p.CustomerID, _ = uuid.Parse(m.CustomerID)
+	return p
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *PreOrder, err error) {
+	ctx, span := telemetry.StartClient(ctx, "preorder.MongoRepository.Get", attribute.String("pre_order.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoPreOrder
+	if err := m.preOrders.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find pre-order: %w", err)
+	}
+	return doc.toPreOrder(), nil
+}
+
+func (m *MongoRepository) Due(ctx context.Context, pickupBy, at time.Time) (_ []*PreOrder, err error) {
+	ctx, span := telemetry.StartClient(ctx, "preorder.MongoRepository.Due")
+	defer telemetry.End(span, &err)
+	cur, err := m.preOrders.Find(ctx, bson.D{
+		{Key: "status", Value: string(StatusAuthorized)},
+		{Key: "pickup_at", Value: bson.D{{Key: "$lte", Value: pickupBy}}},
+		{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: at}}},
+	}, options.Find().SetSort(bson.D{{Key: "pickup_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pre-orders due: %w", err)
+	}
+	var docs []mongoPreOrder
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode pre-orders: %w", err)
+	}
+	preOrders := make([]*PreOrder, 0, len(docs))
+	for _, doc := range docs {
+		preOrders = append(preOrders, doc.toPreOrder())
+	}
+	return preOrders, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, p *PreOrder) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "preorder.MongoRepository.Save", attribute.String("pre_order.id", p.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoPreOrder(p)
+	doc.Version = p.version + 1
+	if p.version == 0 {
+		if _, err := m.preOrders.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save pre-order: %w", err)
+		}
+	} else {
+		res, err := m.preOrders.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: p.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save pre-order: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	p.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.preOrders.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps pre-orders in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu        sync.Mutex
+	preOrders map[uuid.UUID]mongoPreOrder
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{preOrders: map[uuid.UUID]mongoPreOrder{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*PreOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.preOrders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toPreOrder(), nil
+}
+
+func (m *MemoryRepository) Due(_ context.Context, pickupBy, at time.Time) ([]*PreOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var docs []mongoPreOrder
+	for _, doc := range m.preOrders {
+		if doc.Status == string(StatusAuthorized) && !doc.PickupAt.After(pickupBy) && !doc.NextAttemptAt.After(at) {
+			docs = append(docs, doc)
+		}
+	}
+	slices.SortFunc(docs, func(a, b mongoPreOrder) int { return a.PickupAt.Compare(b.PickupAt) })
+	preOrders := make([]*PreOrder, 0, len(docs))
+	for _, doc := range docs {
+		preOrders = append(preOrders, doc.toPreOrder())
+	}
+	return preOrders, nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, p *PreOrder) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.preOrders[p.ID].Version != p.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoPreOrder(p)
+	doc.Version = p.version + 1
+	m.preOrders[p.ID] = doc
+	p.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,119 @@
+package preorder
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+// Gateway authorizes a card when a pickup is scheduled and captures it when the pickup is due, e.g.
+// payment.StripeService. Capture has to be idempotent: a capture cut short, e.g. by a crash, is tried again.
+type Gateway interface {
+	Authorize(ctx context.Context, amount money.Money, cardToken string) (authorizationID string, err error)
+	Capture(ctx context.Context, authorizationID string, amount money.Money) error
+	Void(ctx context.Context, authorizationID string) error
+}
+
+// Recorder is told how every capture went, e.g. metrics.Metrics. outcome is captured, retrying or failed.
+type Recorder interface {
+	PreOrderCaptureAttempted(gateway, outcome string, took time.Duration)
+}
+
+type noRecorder struct{}
+
+func (noRecorder) PreOrderCaptureAttempted(string, string, time.Duration) {}
+
+type Service struct {
+	repo     Repository
+	gateways map[string]Gateway
+	// authorizeOn is the gateway new pre-orders are authorized on.
+	authorizeOn string
+	pool        PoolConfig
+	recorder    Recorder
+	logger      *slog.Logger
+	now         func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithGateway lets pre-orders be paid through g, under name. New pre-orders are authorized on the gateway
+// added last; the others only capture what they authorized before, e.g. while moving to another gateway.
+func WithGateway(name string, g Gateway) Option {
+	return func(s *Service) {
+		s.gateways[name] = g
+		s.authorizeOn = name
+	}
+}
+
+// WithPool replaces DefaultPool.
+func WithPool(p PoolConfig) Option {
+	return func(s *Service) {
+		s.pool = p
+	}
+}
+
+func WithRecorder(r Recorder) Option {
+	return func(s *Service) {
+		s.recorder = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when pre-orders are due.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo, gateways: map[string]Gateway{}, pool: DefaultPool, recorder: noRecorder{}, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Place authorizes amount on the card and schedules the pickup, whose authorization is captured once it is
+// due.
+func (s *Service) Place(ctx context.Context, storeID, customerID uuid.UUID, amount money.Money, pickupAt time.Time, cardToken string) (*PreOrder, error) {
+	if !amount.IsPositive() {
+		return nil, ErrInvalidAmount
+	}
+	now := s.now()
+	if !pickupAt.After(now) {
+		return nil, ErrPickupInPast
+	}
+	if pickupAt.Sub(now) > AuthorizationLifetime {
+		return nil, ErrPickupTooFar
+	}
+	g, ok := s.gateways[s.authorizeOn]
+	if !ok {
+		return nil, ErrNoGateway
+	}
+	authorizationID, err := g.Authorize(ctx, amount, cardToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize the pre-order: %w", err)
+	}
+	p := NewPreOrder(storeID, customerID, amount, pickupAt, s.authorizeOn, authorizationID, now)
+	if err := s.repo.Save(ctx, p); err != nil {
+		if verr := g.Void(context.WithoutCancel(ctx), authorizationID); verr != nil {
+			s.logger.ErrorContext(ctx, "pre-order not saved and its authorization not voided", "customer", customerID, "authorization", authorizationID, "error", verr)
+		}
+		return nil, fmt.Errorf("failed to save pre-order: %w", err)
+	}
+	return p, nil
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*PreOrder, error) {
+	return s.repo.Get(ctx, id)
+}
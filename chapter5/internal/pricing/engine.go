@@ -0,0 +1,487 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/breaker"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/feature"
+	"coffeeco/internal/invariant"
+	"coffeeco/internal/store"
+)
+
+var (
+	ErrNoItems         = errors.New("a quote needs at least one item")
+	ErrUnknownProduct  = errors.New("product has no price")
+	ErrUnknownOption   = errors.New("unknown size or modifier")
+	ErrMixedCurrencies = errors.New("all items of a quote must be in the same currency")
+	ErrUnknownCurrency = errors.New("the price book does not price items in this currency")
+)
+
+// Kind is the rule a component of a price comes from.
+type Kind string
+
+const (
+	KindBase          Kind = "base"
+	KindStorePrice    Kind = "store_price"
+	KindSize          Kind = "size"
+	KindModifier      Kind = "modifier"
+	KindPromotion     Kind = "promotion"
+	KindHappyHour     Kind = "happy_hour"
+	KindStoreDiscount Kind = "store_discount"
+	KindReusableCup   Kind = "reusable_cup"
+	// KindCustomerDiscount is a discount negotiated for the customer, see entitlement.Entitlement.
+	KindCustomerDiscount Kind = "customer_discount"
+	// KindDiscountCap gives back what additive discounts took off beyond their cap.
+	KindDiscountCap Kind = "discount_cap"
+)
+
+// Item is a product to quote.
+type Item struct {
+	Product   string
+	Size      string   // 可选, 如 "large"
+	Modifiers []string // 可选, 如 "oat milk"
+	// ReusableCup is a drink served in the customer's own cup.
+	ReusableCup bool
+	// Quantity is 1 if left at 0.
+	Quantity int
+	// ListPrice is what the product was rung up at, its price if the rules have none. 可选
+	ListPrice *money.Money
+}
+
+// Request asks for the price of some items at a store.
+type Request struct {
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID // uuid.Nil for anonymous customers
+	// At is when the items are bought, now if zero.
+	At    time.Time
+	Items []Item
+}
+
+// Component is one step of a price: what a rule added to it, or took off it when negative.
+type Component struct {
+	Kind Kind
+	// Name tells which size, modifier, promotion, happy hour or negotiated discount it was.
+	Name   string
+	Amount money.Money
+}
+
+// Line is an item priced: Components add up to Unit, and Total is Unit times the quantity.
+type Line struct {
+	Item       Item
+	Components []Component
+	Unit       money.Money
+	Total      money.Money
+
+	// exclusive is set when an exclusive happy hour priced the line, so the store's discount is left off it.
+	exclusive bool
+	// gross is the unit price before any discount.
+	gross int64
+}
+
+// Quote is the itemized price of a request. Adjustments, such as the store's discount, apply to the
+// Subtotal of the lines rather than to any line.
+type Quote struct {
+	StoreID     uuid.UUID
+	At          time.Time
+	Lines       []Line
+	Subtotal    money.Money
+	Adjustments []Component
+	Total       money.Money
+	// DiscountPercent is the store's discount that was taken off, from the lines no exclusive happy hour
+	// priced.
+	DiscountPercent float32
+	// Entitlement is the customer's negotiated discount that was taken off what was left after the store's,
+	// uuid.Nil if none was.
+	Entitlement uuid.UUID
+	// Stacking is how the discounts were combined, and Discounts the ones that were taken, in the order
+	// they were.
+	Stacking  StackingMode
+	Discounts []Kind
+	// Experiment is the variant of a discount experiment the customer is in, whose discount was taken
+	// instead of the store's; the zero Assignment if they are in none.
+	Experiment experiment.Assignment
+}
+
+// Entitlements tell the discount negotiated for a customer that takes the most off at a time;
+// *entitlement.Service is one.
+type Entitlements interface {
+	Best(ctx context.Context, customerID uuid.UUID, at time.Time) (*entitlement.Entitlement, error)
+}
+
+// Experiments tell which variant of a discount experiment a customer is in at a store; *experiment.Service
+// is one. The zero Assignment is for customers in none.
+type Experiments interface {
+	Assign(ctx context.Context, storeID, customerID uuid.UUID, at time.Time) (experiment.Assignment, error)
+}
+
+// StoreDiscounts tells the percentage a store takes off every purchase.
+type StoreDiscounts interface {
+	GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID) (float32, error)
+}
+
+type Engine struct {
+	mu        sync.RWMutex
+	rules     Rules
+	locations map[string]*time.Location
+
+	discounts    StoreDiscounts
+	entitlements Entitlements
+	experiments  Experiments
+	flags        feature.Flags
+	logger       *slog.Logger
+	now          func() time.Time
+}
+
+type Option func(e *Engine)
+
+// WithStoreDiscounts takes the store's discount off every quote. Without it stores have no discount.
+func WithStoreDiscounts(d StoreDiscounts) Option {
+	return func(e *Engine) {
+		e.discounts = d
+	}
+}
+
+// WithEntitlements takes the customer's negotiated discount, if they have one, off what is left after the
+// store's discount. Without it nobody has one.
+func WithEntitlements(en Entitlements) Option {
+	return func(e *Engine) {
+		e.entitlements = en
+	}
+}
+
+// WithExperiments takes the discount of the customer's variant instead of the store's, for customers in a
+// discount experiment. Without it nobody is in one.
+func WithExperiments(x Experiments) Option {
+	return func(e *Engine) {
+		e.experiments = x
+	}
+}
+
+// WithFeatureFlags decides per store and customer whether quotes take paths that are not on for everyone
+// yet. Without it every flag is off.
+func WithFeatureFlags(f feature.Flags) Option {
+	return func(e *Engine) {
+		e.flags = f
+	}
+}
+
+// WithLogger sets where the Engine logs store discounts it had to leave out. It logs to slog.Default()
+// otherwise.
+func WithLogger(l *slog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test happy hours.
+func WithClock(now func() time.Time) Option {
+	return func(e *Engine) {
+		e.now = now
+	}
+}
+
+// NewEngine prices by rules, which are expected to have been validated with Rules.Validate.
+func NewEngine(rules Rules, opts ...Option) *Engine {
+	e := &Engine{flags: feature.Off{}, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.Replace(rules)
+	return e
+}
+
+// Replace swaps every rule for rules at once. Quotes in progress keep the rules they started with.
+func (e *Engine) Replace(rules Rules) {
+	locations := map[string]*time.Location{}
+	for _, h := range rules.HappyHours {
+		if loc, err := time.LoadLocation(h.TimeZone); err == nil {
+			locations[h.TimeZone] = loc
+		}
+	}
+	for _, tz := range rules.StoreTimeZones {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			locations[tz] = loc
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules, e.locations = rules, locations
+}
+
+// Products lists what the price book sells at a store, by name: the products with a base price or a price
+// of the store's own.
+func (e *Engine) Products(storeID uuid.UUID) []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	products := slices.Collect(maps.Keys(e.rules.BasePrices))
+	for product := range e.rules.StorePrices[storeID] {
+		if _, ok := e.rules.BasePrices[product]; !ok {
+			products = append(products, product)
+		}
+	}
+	slices.Sort(products)
+	return products
+}
+
+// Category is what the price book groups product under, or empty if nothing.
+func (e *Engine) Category(product string) string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.rules.Categories[product]
+}
+
+// Quote prices every item by the rules, in this order: the base price, the store's own price, the size and
+// modifiers, the best promotion and happy hour. The store's discount is then taken off the subtotal, less the
+// lines an exclusive happy hour priced, and the customer's negotiated discount off what is left. Which of
+// the discounts are taken, and how they add up, is up to the rules' DiscountStackingPolicy.
+func (e *Engine) Quote(ctx context.Context, r Request) (Quote, error) {
+	if len(r.Items) == 0 {
+		return Quote{}, ErrNoItems
+	}
+	if r.At.IsZero() {
+		r.At = e.now()
+	}
+	e.mu.RLock()
+	rules, locations := e.rules, e.locations
+	e.mu.RUnlock()
+
+	discount, err := e.storeDiscount(ctx, r)
+	if err != nil {
+		return Quote{}, err
+	}
+	assigned := e.experiment(ctx, r)
+	if !assigned.IsZero() {
+		discount = assigned.DiscountPercent
+	}
+	ent, err := e.entitlement(ctx, r)
+	if err != nil {
+		return Quote{}, err
+	}
+	b := basket{
+		req:           r,
+		rules:         rules,
+		locations:     locations,
+		storeDiscount: discount,
+		entitlement:   ent,
+	}
+	q, err := b.stack(rules.Stacking)
+	if err != nil {
+		return Quote{}, err
+	}
+	q.Experiment = assigned
+	invariant.Assert(ctx, e.logger, q.Check())
+	return q, nil
+}
+
+// Check tells which of the invariants of a quote it breaks, if any: the components of a line add up to its
+// unit price, its total is the unit price times the quantity, the lines add up to the subtotal and, with
+// the adjustments, to the total, and nothing is negative.
+func (q Quote) Check() error {
+	var c invariant.Checker
+	lines := make([]int64, 0, len(q.Lines))
+	for i, l := range q.Lines {
+		components := make([]int64, 0, len(l.Components))
+		for _, comp := range l.Components {
+			components = append(components, comp.Amount.Amount())
+		}
+		c.Sum(fmt.Sprintf("components of line %d", i), l.Unit.Amount(), components...)
+		c.That(l.Total.Amount() == l.Unit.Amount()*int64(max(l.Item.Quantity, 1)), "line %d totals %d for %d at %d", i, l.Total.Amount(), l.Item.Quantity, l.Unit.Amount())
+		c.NonNegative(fmt.Sprintf("line %d", i), l.Total.Amount())
+		lines = append(lines, l.Total.Amount())
+	}
+	c.Sum("lines", q.Subtotal.Amount(), lines...)
+	adjusted := []int64{q.Subtotal.Amount()}
+	for _, a := range q.Adjustments {
+		adjusted = append(adjusted, a.Amount.Amount())
+	}
+	c.Sum("subtotal and adjustments", q.Total.Amount(), adjusted...)
+	c.NonNegative("total", q.Total.Amount())
+	return c.Err()
+}
+
+// entitlement is the customer's best negotiated discount, nil for anonymous customers and customers without
+// one.
+func (e *Engine) entitlement(ctx context.Context, r Request) (*entitlement.Entitlement, error) {
+	if e.entitlements == nil || r.CustomerID == uuid.Nil {
+		return nil, nil
+	}
+	ent, err := e.entitlements.Best(ctx, r.CustomerID, r.At)
+	switch {
+	case errors.Is(err, entitlement.ErrNotEntitled):
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to get the customer's discount: %w", err)
+	}
+	return ent, nil
+}
+
+// experiment is the variant the customer is in. A customer whose variant cannot be told is priced as if
+// they were in none, rather than turned away.
+func (e *Engine) experiment(ctx context.Context, r Request) experiment.Assignment {
+	if e.experiments == nil {
+		return experiment.Assignment{}
+	}
+	a, err := e.experiments.Assign(ctx, r.StoreID, r.CustomerID, r.At)
+	if err != nil {
+		e.logger.WarnContext(ctx, "experiments unavailable, pricing with the store's discount", "store_id", r.StoreID, "customer_id", r.CustomerID, "error", err)
+		return experiment.Assignment{}
+	}
+	return a
+}
+
+func (e *Engine) storeDiscount(ctx context.Context, r Request) (float32, error) {
+	if e.discounts == nil {
+		return 0, nil
+	}
+	discount, err := e.discounts.GetStoreSpecificDiscount(ctx, r.StoreID)
+	switch {
+	case errors.Is(err, breaker.ErrOpen):
+		e.logger.WarnContext(ctx, "store discounts unavailable, pricing without one", "store_id", r.StoreID, "error", err)
+		return 0, nil
+	case errors.Is(err, store.ErrNoDiscount):
+		return 0, nil
+	case err != nil:
+		return 0, fmt.Errorf("failed to get discount: %w", err)
+	}
+	return discount, nil
+}
+
+// price prices one item at a store, with the promotion and happy hour d takes.
+func (r Rules) price(storeID uuid.UUID, at time.Time, locations map[string]*time.Location, item Item, d discounts) (Line, error) {
+	if item.Quantity == 0 {
+		item.Quantity = 1
+	}
+	// Room for the base price, size and modifiers the item has, and a promotion if there are any, so most
+	// lines never grow their components.
+	n := 1 + len(item.Modifiers)
+	if item.Size != "" {
+		n++
+	}
+	if len(r.Promotions) > 0 || len(r.HappyHours) > 0 {
+		n++
+	}
+	line := Line{Item: item, Components: make([]Component, 0, n)}
+	currency := r.currency()
+	add := func(kind Kind, name string, amount int64) {
+		line.Components = append(line.Components, Component{Kind: kind, Name: name, Amount: *money.New(amount, currency)})
+	}
+
+	// A price book with prices is the only say on them: a client cannot name its own price by ringing up a
+	// product the book does not price, or in a currency it does not price in.
+	unit, ok := r.BasePrices[item.Product]
+	switch {
+	case item.ListPrice != nil && item.ListPrice.Currency().Code != currency:
+		if r.hasPrices() {
+			return Line{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, item.ListPrice.Currency().Code)
+		}
+		currency = item.ListPrice.Currency().Code
+		add(KindBase, "", item.ListPrice.Amount())
+		line.gross = item.ListPrice.Amount()
+		return line.total(item.ListPrice.Amount()), nil
+	case !ok && item.ListPrice != nil && !r.hasPrices():
+		unit = item.ListPrice.Amount()
+	case !ok:
+		return Line{}, fmt.Errorf("%w: %s", ErrUnknownProduct, item.Product)
+	}
+	add(KindBase, "", unit)
+	if price, ok := r.StorePrices[storeID][item.Product]; ok {
+		add(KindStorePrice, "", price-unit)
+		unit = price
+	}
+	if item.Size != "" {
+		delta, ok := r.Sizes[item.Size]
+		if !ok {
+			return Line{}, fmt.Errorf("%w: size %s", ErrUnknownOption, item.Size)
+		}
+		add(KindSize, item.Size, delta)
+		unit += delta
+	}
+	for _, m := range item.Modifiers {
+		delta, ok := r.Modifiers[m]
+		if !ok {
+			return Line{}, fmt.Errorf("%w: modifier %s", ErrUnknownOption, m)
+		}
+		add(KindModifier, m, delta)
+		unit += delta
+	}
+	// Sizes and modifiers that take off more than the price only take off what there was, the last first.
+	for i := len(line.Components) - 1; unit < 0; i-- {
+		if amount := line.Components[i].Amount.Amount(); amount < 0 {
+			back := min(-amount, -unit)
+			line.Components[i].Amount = *money.New(amount+back, currency)
+			unit += back
+		}
+	}
+
+	line.gross = unit
+
+	var best *Promotion
+	var bestOff int64
+	for i, p := range r.Promotions {
+		if !d.takes(KindPromotion) || !p.applies(storeID, item.Product, at) {
+			continue
+		}
+		if off := min(percentOf(unit, p.PercentOff)+p.AmountOff, unit); best == nil || off > bestOff {
+			best, bestOff = &r.Promotions[i], off
+		}
+	}
+	if best != nil {
+		add(KindPromotion, best.Name, -bestOff)
+		unit -= bestOff
+	}
+	for _, h := range r.HappyHours {
+		if !d.takes(KindHappyHour) {
+			break
+		}
+		tz := h.TimeZone
+		if tz == "" {
+			tz = r.StoreTimeZones[storeID]
+		}
+		loc := locations[tz]
+		if loc == nil {
+			loc = time.UTC
+		}
+		if h.applies(storeID, item.Product, at.In(loc)) {
+			on := unit
+			if d.gross {
+				on = line.gross
+			}
+			off := min(percentOf(on, h.PercentOff), unit)
+			add(KindHappyHour, h.Name, -off)
+			unit -= off
+			line.exclusive = h.Exclusive
+			break
+		}
+	}
+	if item.ReusableCup && r.ReusableCupDiscount > 0 {
+		off := min(r.ReusableCupDiscount, unit)
+		add(KindReusableCup, "", -off)
+		unit -= off
+	}
+	return line.total(unit), nil
+}
+
+func (l Line) total(unit int64) Line {
+	currency := l.Components[0].Amount.Currency().Code
+	l.Unit = *money.New(unit, currency)
+	l.Total = *money.New(unit*int64(l.Item.Quantity), currency)
+	return l
+}
+
+// percentOf rounds half up to the minor unit.
+func percentOf(amount int64, percent float64) int64 {
+	return int64(math.Round(float64(amount) * percent / 100))
+}
@@ -0,0 +1,268 @@
+package pricing_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"pgregory.net/rapid"
+
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/pricing"
+)
+
+type percentOff float32
+
+func (p percentOff) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return float32(p), nil
+}
+
+func Test_QuoteItemizesEveryRule(t *testing.T) {
+	soho := uuid.New()
+	var rules pricing.Rules
+	err := json.Unmarshal([]byte(`{
+		"base_prices": {"latte": 400, "espresso": 250, "cookie": 300},
+		"store_prices": {"`+soho.String()+`": {"latte": 450}},
+		"sizes": {"large": 60},
+		"modifiers": {"oat milk": 50},
+		"promotions": [
+			{"name": "spring", "products": ["latte"], "percent_off": 10, "from": "2024-03-01T00:00:00Z", "to": "2024-06-01T00:00:00Z"},
+			{"name": "fifty off", "amount_off": 50}
+		],
+		"happy_hours": [{"name": "afternoon", "products": ["espresso"], "days": [5], "start": "15:00", "end": "17:00", "time_zone": "Europe/London", "percent_off": 20}]
+	}`), &rules)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatalf("expected valid rules but got %v", err)
+	}
+	// A Friday, 15:30 in London.
+	friday := time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)
+	engine := pricing.NewEngine(rules, pricing.WithStoreDiscounts(percentOff(10)), pricing.WithClock(func() time.Time { return friday }))
+
+	q, err := engine.Quote(context.Background(), pricing.Request{StoreID: soho, Items: []pricing.Item{
+		{Product: "latte", Size: "large", Modifiers: []string{"oat milk"}, Quantity: 2},
+		{Product: "espresso"},
+		{Product: "cookie", ListPrice: money.New(1, "USD")},
+	}})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	// 450 at soho + 60 + 50 = 560, 10% off beats 50 off: 504.
+	latte := q.Lines[0]
+	if len(latte.Components) != 5 || latte.Components[1].Kind != pricing.KindStorePrice || latte.Components[4].Name != "spring" || latte.Unit.Amount() != 504 || latte.Total.Amount() != 1008 {
+		t.Fatalf("expected two large oat lattes at 5.04 but got %+v", latte)
+	}
+	// 250 - 50 = 200, then 20% off at happy hour: 160.
+	if espresso := q.Lines[1]; espresso.Components[2].Kind != pricing.KindHappyHour || espresso.Unit.Amount() != 160 {
+		t.Fatalf("expected a happy hour espresso at 1.60 but got %+v", espresso)
+	}
+	if cookie := q.Lines[2]; cookie.Unit.Amount() != 250 {
+		t.Fatalf("expected the cookie at its book price less 50, whatever it was rung up at, but got %+v", cookie)
+	}
+	if q.Subtotal.Amount() != 1418 || len(q.Adjustments) != 1 || q.Adjustments[0].Amount.Amount() != -142 || q.Total.Amount() != 1276 {
+		t.Fatalf("expected 10%% off 14.18 to be 12.76 but got %+v", q)
+	}
+	for name, tc := range map[string]struct {
+		item pricing.Item
+		want error
+	}{
+		"product without a price":  {pricing.Item{Product: "scone"}, pricing.ErrUnknownProduct},
+		"product at its own price": {pricing.Item{Product: "scone", ListPrice: money.New(1, "USD")}, pricing.ErrUnknownProduct},
+		"another currency":         {pricing.Item{Product: "latte", ListPrice: money.New(1, "GBP")}, pricing.ErrUnknownCurrency},
+		"unknown size":             {pricing.Item{Product: "latte", Size: "venti"}, pricing.ErrUnknownOption},
+	} {
+		if _, err := engine.Quote(context.Background(), pricing.Request{Items: []pricing.Item{tc.item}}); !errors.Is(err, tc.want) {
+			t.Fatalf("%s: expected %v but got %v", name, tc.want, err)
+		}
+	}
+	if err := (pricing.Rules{HappyHours: []pricing.HappyHour{{Name: "never", Start: 17 * 60, End: 15 * 60, PercentOff: 20}}}).Validate(); !errors.Is(err, pricing.ErrInvalidRules) {
+		t.Fatalf("expected a happy hour ending before it starts to be refused but got %v", err)
+	}
+}
+
+func Test_HappyHoursRunOnStoreTimeAndMayExcludeTheStoreDiscount(t *testing.T) {
+	tokyo, soho := uuid.New(), uuid.New()
+	rules := pricing.Rules{
+		BasePrices:     map[string]int64{"espresso": 300, "latte": 400},
+		StoreTimeZones: map[uuid.UUID]string{tokyo: "Asia/Tokyo", soho: "Europe/London"},
+		HappyHours:     []pricing.HappyHour{{Name: "afternoon", Products: []string{"espresso"}, Start: 15 * 60, End: 17 * 60, PercentOff: 20}},
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatalf("expected valid rules but got %v", err)
+	}
+	// 15:30 in Tokyo, 07:30 in London.
+	at := time.Date(2024, 3, 1, 6, 30, 0, 0, time.UTC)
+	quote := func(rules pricing.Rules, storeID uuid.UUID) pricing.Quote {
+		t.Helper()
+		engine := pricing.NewEngine(rules, pricing.WithStoreDiscounts(percentOff(10)), pricing.WithClock(func() time.Time { return at }))
+		q, err := engine.Quote(context.Background(), pricing.Request{StoreID: storeID, Items: []pricing.Item{{Product: "espresso"}, {Product: "latte"}}})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		return q
+	}
+
+	if q := quote(rules, soho); q.Lines[0].Unit.Amount() != 300 {
+		t.Fatalf("expected no happy hour in London in the morning but got %+v", q.Lines[0])
+	}
+	// Stacked: 300 - 20% = 240, plus 400, less 10%: 576.
+	if q := quote(rules, tokyo); q.Lines[0].Unit.Amount() != 240 || q.Total.Amount() != 576 {
+		t.Fatalf("expected the store's discount on top of the happy hour but got %+v", q)
+	}
+	// Exclusive: 240 plus 400 less 10%: 600.
+	rules.HappyHours[0].Exclusive = true
+	if q := quote(rules, tokyo); q.Adjustments[0].Amount.Amount() != -40 || q.Total.Amount() != 600 {
+		t.Fatalf("expected the store's discount only off the latte but got %+v", q)
+	}
+	// An explicit time zone wins over the store's.
+	rules.HappyHours[0].TimeZone = "Europe/London"
+	if q := quote(rules, tokyo); q.Lines[0].Unit.Amount() != 300 {
+		t.Fatalf("expected the happy hour in London time but got %+v", q.Lines[0])
+	}
+
+	rules.StoreTimeZones[soho] = "Mars/Olympus_Mons"
+	if err := rules.Validate(); !errors.Is(err, pricing.ErrInvalidRules) {
+		t.Fatalf("expected an unknown store time zone to be refused but got %v", err)
+	}
+}
+
+type entitled struct{ e *entitlement.Entitlement }
+
+func (en entitled) Best(context.Context, uuid.UUID, time.Time) (*entitlement.Entitlement, error) {
+	return en.e, nil
+}
+
+func Test_StackingPoliciesPickTheDiscountsTaken(t *testing.T) {
+	employee, err := entitlement.New(entitlement.Grant{Kind: entitlement.KindEmployee, PercentOff: 30}, "hr", time.Now())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	tests := map[string]struct {
+		policy    pricing.DiscountStackingPolicy
+		total     int64
+		discounts []pricing.Kind
+	}{
+		// 500 - 10% = 450, - 20% = 360, - 30% = 252.
+		"sequential": {pricing.DiscountStackingPolicy{}, 252, []pricing.Kind{pricing.KindPromotion, pricing.KindStoreDiscount, pricing.KindCustomerDiscount}},
+		"best of":    {pricing.DiscountStackingPolicy{Mode: pricing.StackingBestOf}, 350, []pricing.Kind{pricing.KindCustomerDiscount}},
+		// 50 + 100 + 150 off 500, but at most 40% of it.
+		"additive":         {pricing.DiscountStackingPolicy{Mode: pricing.StackingAdditive}, 200, []pricing.Kind{pricing.KindPromotion, pricing.KindStoreDiscount, pricing.KindCustomerDiscount}},
+		"additive, capped": {pricing.DiscountStackingPolicy{Mode: pricing.StackingAdditive, MaxPercentOff: 40}, 300, []pricing.Kind{pricing.KindPromotion, pricing.KindStoreDiscount, pricing.KindCustomerDiscount}},
+		"priority": {
+			pricing.DiscountStackingPolicy{Mode: pricing.StackingPriority, Priority: []pricing.Kind{pricing.KindStoreDiscount, pricing.KindPromotion}, Limit: 2},
+			360, []pricing.Kind{pricing.KindPromotion, pricing.KindStoreDiscount},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rules := pricing.Rules{
+				BasePrices: map[string]int64{"latte": 500},
+				Promotions: []pricing.Promotion{{Name: "spring", PercentOff: 10}},
+				Stacking:   tc.policy,
+			}
+			if err := rules.Validate(); err != nil {
+				t.Fatalf("expected valid rules but got %v", err)
+			}
+			engine := pricing.NewEngine(rules, pricing.WithStoreDiscounts(percentOff(20)), pricing.WithEntitlements(entitled{employee}))
+			q, err := engine.Quote(context.Background(), pricing.Request{CustomerID: uuid.New(), Items: []pricing.Item{{Product: "latte"}}})
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if err := q.Check(); err != nil {
+				t.Fatalf("expected the quote to add up but got %v", err)
+			}
+			if q.Total.Amount() != tc.total || fmt.Sprint(q.Discounts) != fmt.Sprint(tc.discounts) {
+				t.Fatalf("expected %d with %v but got %d with %v", tc.total, tc.discounts, q.Total.Amount(), q.Discounts)
+			}
+		})
+	}
+
+	invalid := pricing.Rules{Stacking: pricing.DiscountStackingPolicy{Mode: "cheapest", Priority: []pricing.Kind{pricing.KindBase}}}
+	if err := invalid.Validate(); !errors.Is(err, pricing.ErrInvalidRules) {
+		t.Fatalf("expected an unknown stacking mode and priority to be refused but got %v", err)
+	}
+}
+
+// BenchmarkQuote prices a basket of 20 items with a size, a modifier and a promotion each. Run it with
+// -benchmem to see what every line allocates.
+func BenchmarkQuote(b *testing.B) {
+	rules := pricing.Rules{
+		BasePrices: map[string]int64{"latte": 400},
+		Sizes:      map[string]int64{"large": 60},
+		Modifiers:  map[string]int64{"oat milk": 50},
+		Promotions: []pricing.Promotion{{Name: "fifty off", AmountOff: 50}},
+	}
+	engine := pricing.NewEngine(rules, pricing.WithStoreDiscounts(percentOff(10)))
+	req := pricing.Request{StoreID: uuid.New(), At: time.Now()}
+	for range 20 {
+		req.Items = append(req.Items, pricing.Item{Product: "latte", Size: "large", Modifiers: []string{"oat milk"}})
+	}
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := engine.Quote(ctx, req); err != nil {
+			b.Fatalf("expected no error but got %v", err)
+		}
+	}
+}
+
+func Test_QuotesAddUpWhateverTheRules(t *testing.T) {
+	products := []string{"latte", "espresso", "cookie", "tea"}
+	rapid.Check(t, func(t *rapid.T) {
+		rules := pricing.Rules{
+			BasePrices: map[string]int64{},
+			// Sizes and modifiers may take off more than a cheap product costs.
+			Sizes:               map[string]int64{"small": rapid.Int64Range(-600, 0).Draw(t, "small"), "large": rapid.Int64Range(0, 200).Draw(t, "large")},
+			Modifiers:           map[string]int64{"oat milk": rapid.Int64Range(0, 100).Draw(t, "oat milk"), "no milk": rapid.Int64Range(-300, 0).Draw(t, "no milk")},
+			ReusableCupDiscount: rapid.Int64Range(0, 300).Draw(t, "cup"),
+		}
+		for _, p := range products {
+			rules.BasePrices[p] = rapid.Int64Range(0, 2000).Draw(t, p)
+		}
+		for i := range rapid.IntRange(0, 3).Draw(t, "promotions") {
+			p := pricing.Promotion{Name: fmt.Sprint("promotion ", i), Products: rapid.SliceOfDistinct(rapid.SampledFrom(products), rapid.ID).Draw(t, "promoted")}
+			if rapid.Bool().Draw(t, "percentage") {
+				p.PercentOff = float64(rapid.IntRange(1, 100).Draw(t, "percent off"))
+			} else {
+				p.AmountOff = rapid.Int64Range(1, 500).Draw(t, "amount off")
+			}
+			rules.Promotions = append(rules.Promotions, p)
+		}
+		if rapid.Bool().Draw(t, "happy hour") {
+			rules.HappyHours = []pricing.HappyHour{{Name: "all day", Start: 0, End: 24 * 60, PercentOff: float64(rapid.IntRange(1, 100).Draw(t, "happy percent off"))}}
+		}
+		if err := rules.Validate(); err != nil {
+			t.Fatalf("expected valid rules but got %v", err)
+		}
+		var items []pricing.Item
+		for range rapid.IntRange(1, 5).Draw(t, "items") {
+			items = append(items, pricing.Item{
+				Product:     rapid.SampledFrom(products).Draw(t, "product"),
+				Size:        rapid.SampledFrom([]string{"", "small", "large"}).Draw(t, "size"),
+				Modifiers:   rapid.SliceOfDistinct(rapid.SampledFrom([]string{"oat milk", "no milk"}), rapid.ID).Draw(t, "modifiers"),
+				ReusableCup: rapid.Bool().Draw(t, "reusable cup"),
+				Quantity:    rapid.IntRange(0, 3).Draw(t, "quantity"),
+			})
+		}
+		discount := percentOff(rapid.IntRange(0, 100).Draw(t, "discount"))
+		engine := pricing.NewEngine(rules, pricing.WithStoreDiscounts(discount))
+
+		q, err := engine.Quote(context.Background(), pricing.Request{StoreID: uuid.New(), Items: items})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := q.Check(); err != nil {
+			t.Fatalf("expected a consistent quote but got %v", err)
+		}
+		if q.Total.Amount() > q.Subtotal.Amount() {
+			t.Fatalf("expected a discount to take off the subtotal of %d but the total is %d", q.Subtotal.Amount(), q.Total.Amount())
+		}
+	})
+}
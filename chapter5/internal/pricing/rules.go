@@ -0,0 +1,181 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidRules = errors.New("invalid pricing rules")
+
+// Rules are the price book. Amounts are in the minor unit of Currency. A book without prices sells every
+// item at the price it was rung up at; once it has some, items it does not price are refused.
+type Rules struct {
+	// Currency of the amounts below, USD if empty.
+	Currency string `json:"currency,omitempty"`
+	// BasePrices by product. A product without one has no price, unless the book has no prices at all.
+	BasePrices map[string]int64 `json:"base_prices,omitempty"`
+	// StorePrices replace the base price of some products at some stores.
+	StorePrices map[uuid.UUID]map[string]int64 `json:"store_prices,omitempty"`
+	// Categories group products that can stand in for one another, by product, e.g. {"latte": "milk
+	// coffee", "flat white": "milk coffee"}. Products without one stand in for nothing.
+	Categories map[string]string `json:"categories,omitempty"`
+	// Sizes and Modifiers add to the price of a product, or take off it when negative, e.g.
+	// {"small": -50, "large": 60} and {"oat milk": 60, "extra shot": 80}.
+	Sizes     map[string]int64 `json:"sizes,omitempty"`
+	Modifiers map[string]int64 `json:"modifiers,omitempty"`
+	// Promotions run for a period. Only the one that takes the most off a product applies.
+	Promotions []Promotion `json:"promotions,omitempty"`
+	// HappyHours take a percentage off on some days at some time of the day, on top of any promotion.
+	HappyHours []HappyHour `json:"happy_hours,omitempty"`
+	// StoreTimeZones are the IANA time zones of stores, where happy hours without one of their own start
+	// and end. Stores without one are in UTC.
+	StoreTimeZones map[uuid.UUID]string `json:"store_time_zones,omitempty"`
+	// ReusableCupDiscount is taken off every drink served in the customer's own cup, after everything else.
+	ReusableCupDiscount int64 `json:"reusable_cup_discount,omitempty"`
+	// Stacking decides how promotions, happy hours, the store's discount and the customer's combine.
+	Stacking DiscountStackingPolicy `json:"stacking,omitzero"`
+}
+
+// Promotion takes PercentOff or AmountOff the unit price of the products it is for.
+type Promotion struct {
+	Name string `json:"name"`
+	// Products and Stores are empty to run the promotion on every product or at every store.
+	Products   []string    `json:"products,omitempty"`
+	Stores     []uuid.UUID `json:"stores,omitempty"`
+	PercentOff float64     `json:"percent_off,omitempty"`
+	AmountOff  int64       `json:"amount_off,omitempty"`
+	// From is inclusive and To exclusive; either may be left out for a promotion without a start or end.
+	From time.Time `json:"from,omitzero"`
+	To   time.Time `json:"to,omitzero"`
+}
+
+func (p Promotion) applies(storeID uuid.UUID, product string, at time.Time) bool {
+	if !p.From.IsZero() && at.Before(p.From) || !p.To.IsZero() && !at.Before(p.To) {
+		return false
+	}
+	return matches(p.Stores, storeID) && matches(p.Products, product)
+}
+
+// HappyHour takes PercentOff from Start to End, in the time zone it is given in or else in the store's.
+type HappyHour struct {
+	Name     string      `json:"name"`
+	Products []string    `json:"products,omitempty"`
+	Stores   []uuid.UUID `json:"stores,omitempty"`
+	// Days are 0 for Sunday to 6 for Saturday; empty is every day.
+	Days       []time.Weekday `json:"days,omitempty"`
+	Start      TimeOfDay      `json:"start"`
+	End        TimeOfDay      `json:"end"`
+	TimeZone   string         `json:"time_zone,omitempty"` // 可选, IANA名字, 默认店铺所在时区
+	PercentOff float64        `json:"percent_off"`
+	// Exclusive leaves the store's discount off what the happy hour took a percentage off. Otherwise the
+	// store's discount is taken on top.
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+func (h HappyHour) applies(storeID uuid.UUID, product string, at time.Time) bool {
+	if len(h.Days) > 0 && !slices.Contains(h.Days, at.Weekday()) {
+		return false
+	}
+	now := TimeOfDay(at.Hour()*60 + at.Minute())
+	return now >= h.Start && now < h.End && matches(h.Stores, storeID) && matches(h.Products, product)
+}
+
+// TimeOfDay is minutes after midnight, written as "15:04" in JSON.
+type TimeOfDay int
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t/60, t%60)
+}
+
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimeOfDay) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse("15:04", s)
+	if err != nil {
+		return fmt.Errorf("time of day must be written like 15:04: %w", err)
+	}
+	*t = TimeOfDay(parsed.Hour()*60 + parsed.Minute())
+	return nil
+}
+
+func matches[T comparable](in []T, v T) bool {
+	return len(in) == 0 || slices.Contains(in, v)
+}
+
+// hasPrices tells whether the book prices products itself, rather than selling them as rung up.
+func (r Rules) hasPrices() bool {
+	return len(r.BasePrices) > 0 || len(r.StorePrices) > 0
+}
+
+func (r Rules) currency() string {
+	if r.Currency == "" {
+		return money.USD
+	}
+	return r.Currency
+}
+
+// Validate tells what is wrong with the rules, if anything.
+func (r Rules) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidRules}, args...)...))
+	}
+	if money.GetCurrency(r.currency()) == nil {
+		invalid("currency %q is not an ISO 4217 code", r.Currency)
+	}
+	for product, price := range r.BasePrices {
+		if price < 0 {
+			invalid("base price of %s must not be negative", product)
+		}
+	}
+	if r.ReusableCupDiscount < 0 {
+		invalid("reusable cup discount must not be negative")
+	}
+	for storeID, prices := range r.StorePrices {
+		for product, price := range prices {
+			if price < 0 {
+				invalid("price of %s at store %s must not be negative", product, storeID)
+			}
+		}
+	}
+	for _, p := range r.Promotions {
+		if p.PercentOff < 0 || p.PercentOff > 100 || p.AmountOff < 0 || (p.PercentOff == 0) == (p.AmountOff == 0) {
+			invalid("promotion %q must take either a percentage between 0 and 100 or an amount off", p.Name)
+		}
+		if !p.From.IsZero() && !p.To.IsZero() && !p.To.After(p.From) {
+			invalid("promotion %q must end after it starts", p.Name)
+		}
+	}
+	for _, h := range r.HappyHours {
+		if h.PercentOff <= 0 || h.PercentOff > 100 {
+			invalid("happy hour %q must take a percentage between 0 and 100 off", h.Name)
+		}
+		if h.End <= h.Start {
+			invalid("happy hour %q must end after it starts", h.Name)
+		}
+		if _, err := time.LoadLocation(h.TimeZone); err != nil {
+			invalid("happy hour %q is in an unknown time zone %q", h.Name, h.TimeZone)
+		}
+	}
+	for _, problem := range r.Stacking.validate() {
+		invalid("%s", problem)
+	}
+	for storeID, tz := range r.StoreTimeZones {
+		if _, err := time.LoadLocation(tz); tz == "" || err != nil {
+			invalid("store %s is in an unknown time zone %q", storeID, tz)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,239 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/entitlement"
+)
+
+// StackingMode is how the discounts that apply to a purchase combine.
+type StackingMode string
+
+const (
+	// StackingSequential takes every discount, each off what the ones before it left. It is the default.
+	StackingSequential StackingMode = "sequential"
+	// StackingBestOf takes only the discount that takes the most off the purchase.
+	StackingBestOf StackingMode = "best_of"
+	// StackingAdditive takes every discount off the price before any, and adds them up to at most
+	// MaxPercentOff of it.
+	StackingAdditive StackingMode = "additive"
+	// StackingPriority takes the first Limit discounts that apply, in the Priority order, each off what the
+	// ones before it left.
+	StackingPriority StackingMode = "priority"
+)
+
+// discountKinds are the discounts a DiscountStackingPolicy combines, in the order Quote takes them. The
+// reusable cup discount is not one of them: it is always taken, after everything else.
+var discountKinds = []Kind{KindPromotion, KindHappyHour, KindStoreDiscount, KindCustomerDiscount}
+
+// DiscountStackingPolicy decides which of the promotions, happy hours, store discount and customer discount
+// that apply to a purchase are taken, and how they add up.
+type DiscountStackingPolicy struct {
+	Mode StackingMode `json:"mode,omitempty"` // 可选, 默认 sequential
+	// MaxPercentOff caps what additive discounts take off together, in percent of the price before any
+	// discount; 0 for no cap.
+	MaxPercentOff float64 `json:"max_percent_off,omitempty"`
+	// Priority orders the discounts for the priority mode, e.g. ["customer_discount", "promotion"].
+	// Discounts it leaves out come after, in the order Quote takes them.
+	Priority []Kind `json:"priority,omitempty"`
+	// Limit is how many discounts the priority mode takes; 0 for 1.
+	Limit int `json:"limit,omitempty"`
+}
+
+func (p DiscountStackingPolicy) mode() StackingMode {
+	if p.Mode == "" {
+		return StackingSequential
+	}
+	return p.Mode
+}
+
+func (p DiscountStackingPolicy) validate() []string {
+	var problems []string
+	switch p.mode() {
+	case StackingSequential, StackingBestOf, StackingAdditive, StackingPriority:
+	default:
+		problems = append(problems, fmt.Sprintf("stacking mode %q must be sequential, best_of, additive or priority", p.Mode))
+	}
+	if p.MaxPercentOff < 0 || p.MaxPercentOff > 100 {
+		problems = append(problems, "stacking cap must be between 0 and 100 percent")
+	}
+	if p.Limit < 0 {
+		problems = append(problems, "stacking limit must not be negative")
+	}
+	for i, k := range p.Priority {
+		if !slices.Contains(discountKinds, k) || slices.Index(p.Priority, k) != i {
+			problems = append(problems, fmt.Sprintf("stacking priority %q must be a discount listed once", k))
+		}
+	}
+	return problems
+}
+
+// order is every discount kind in the priority order.
+func (p DiscountStackingPolicy) order() []Kind {
+	order := slices.Clone(p.Priority)
+	for _, k := range discountKinds {
+		if !slices.Contains(order, k) {
+			order = append(order, k)
+		}
+	}
+	return order
+}
+
+// discounts selects the discounts a quote takes. The zero value takes every one, each off what the ones
+// before it left.
+type discounts struct {
+	// only is the discounts taken, every one if nil.
+	only map[Kind]bool
+	// gross takes each discount off the price before any, rather than off what the ones before it left.
+	gross bool
+	// capPercent caps what the discounts take off together, in percent of the price before any; 0 for no
+	// cap.
+	capPercent float64
+}
+
+func (d discounts) takes(k Kind) bool {
+	return d.only == nil || d.only[k]
+}
+
+func only(kinds ...Kind) discounts {
+	d := discounts{only: map[Kind]bool{}}
+	for _, k := range kinds {
+		d.only[k] = true
+	}
+	return d
+}
+
+// basket is a request with everything needed to price it, so it can be priced with different discounts.
+type basket struct {
+	req           Request
+	rules         Rules
+	locations     map[string]*time.Location
+	storeDiscount float32
+	entitlement   *entitlement.Entitlement // nil if the customer has none
+}
+
+// stack prices the basket with the discounts p picks.
+func (b basket) stack(p DiscountStackingPolicy) (Quote, error) {
+	every, err := b.quote(discounts{})
+	if err != nil {
+		return Quote{}, err
+	}
+	q := every
+	switch p.mode() {
+	case StackingBestOf:
+		q, _ = b.quote(only())
+		for _, k := range every.Discounts {
+			if alone, _ := b.quote(only(k)); alone.Total.Amount() < q.Total.Amount() {
+				q = alone
+			}
+		}
+	case StackingAdditive:
+		q, _ = b.quote(discounts{gross: true, capPercent: p.MaxPercentOff})
+	case StackingPriority:
+		var taken []Kind
+		for _, k := range p.order() {
+			if len(taken) < max(p.Limit, 1) && slices.Contains(every.Discounts, k) {
+				taken = append(taken, k)
+			}
+		}
+		q, _ = b.quote(only(taken...))
+	}
+	q.Stacking = p.mode()
+	return q, nil
+}
+
+// quote prices the basket with the discounts d selects. Once the basket was priced with every discount
+// without an error, it is priced without one whatever d is.
+func (b basket) quote(d discounts) (Quote, error) {
+	r := b.req
+	q := Quote{StoreID: r.StoreID, At: r.At, Lines: make([]Line, 0, len(r.Items))}
+	var currency string
+	var subtotal, discountable, gross, grossDiscountable int64
+	taken := map[Kind]bool{}
+	for _, item := range r.Items {
+		line, err := b.rules.price(r.StoreID, r.At, b.locations, item, d)
+		if err != nil {
+			return Quote{}, err
+		}
+		if currency != "" && line.Total.Currency().Code != currency {
+			return Quote{}, ErrMixedCurrencies
+		}
+		currency = line.Total.Currency().Code
+		lineGross := line.gross * int64(line.Item.Quantity)
+		subtotal += line.Total.Amount()
+		gross += lineGross
+		if !line.exclusive {
+			discountable += line.Total.Amount()
+			grossDiscountable += lineGross
+		}
+		for _, c := range line.Components {
+			if (c.Kind == KindPromotion || c.Kind == KindHappyHour) && !c.Amount.IsZero() {
+				taken[c.Kind] = true
+			}
+		}
+		q.Lines = append(q.Lines, line)
+	}
+	q.Subtotal = *money.New(subtotal, currency)
+	total := subtotal
+	adjust := func(kind Kind, name string, amount int64) {
+		q.Adjustments = append(q.Adjustments, Component{Kind: kind, Name: name, Amount: *money.New(amount, currency)})
+		total += amount
+	}
+
+	if on := discountable; d.takes(KindStoreDiscount) && b.storeDiscount > 0 {
+		if d.gross {
+			on = grossDiscountable
+		}
+		discounted := int64(math.Round(float64(on) * float64(100-b.storeDiscount) / 100))
+		if off := min(on-discounted, total); off != 0 && on > 0 {
+			q.DiscountPercent = b.storeDiscount
+			adjust(KindStoreDiscount, fmt.Sprintf("%g%%", b.storeDiscount), -off)
+			taken[KindStoreDiscount] = true
+		}
+	}
+	if on := total; d.takes(KindCustomerDiscount) && b.entitlement != nil {
+		if d.gross {
+			on = gross
+		}
+		if off := min(percentOf(on, b.entitlement.PercentOff), total); off > 0 {
+			q.Entitlement = b.entitlement.ID
+			adjust(KindCustomerDiscount, b.entitlement.Name(), -off)
+			taken[KindCustomerDiscount] = true
+		}
+	}
+	if d.capPercent > 0 {
+		if excess := q.discountsOff() - percentOf(gross, d.capPercent); excess > 0 {
+			adjust(KindDiscountCap, fmt.Sprintf("%g%%", d.capPercent), excess)
+		}
+	}
+	q.Total = *money.New(total, currency)
+	for _, k := range discountKinds {
+		if taken[k] {
+			q.Discounts = append(q.Discounts, k)
+		}
+	}
+	return q, nil
+}
+
+// discountsOff is what the discounts took off the quote altogether, as a positive amount.
+func (q Quote) discountsOff() int64 {
+	var off int64
+	for _, l := range q.Lines {
+		for _, c := range l.Components {
+			if slices.Contains(discountKinds, c.Kind) {
+				off -= c.Amount.Amount() * int64(l.Item.Quantity)
+			}
+		}
+	}
+	for _, a := range q.Adjustments {
+		if slices.Contains(discountKinds, a.Kind) {
+			off -= a.Amount.Amount()
+		}
+	}
+	return off
+}
@@ -0,0 +1,174 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+)
+
+var ErrMissingCustomer = errors.New("erasure needs the ID of the customer to forget")
+
+// Purchases anonymizes the purchases of a customer, keeping the totals.
+type Purchases interface {
+	// CardTokens lists the payment methods stored with the customer's purchases.
+	CardTokens(ctx context.Context, customerID uuid.UUID) ([]string, error)
+	AnonymizeCustomer(ctx context.Context, customerID uuid.UUID) (int, error)
+}
+
+// Eraser forgets a customer in one place their data is kept, returning how many records it changed.
+type Eraser interface {
+	EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error)
+}
+
+// PaymentMethods revokes stored payment methods at the gateway, reporting whether there was one to revoke.
+type PaymentMethods interface {
+	RevokePaymentMethod(ctx context.Context, token string) (bool, error)
+}
+
+// Report says what an erasure did. It holds no personal data beyond the ID of the customer, so it can be
+// kept as proof the request was honored.
+type Report struct {
+	CustomerID            uuid.UUID      `json:"customerId"`
+	RequestedBy           string         `json:"requestedBy"`
+	StartedAt             time.Time      `json:"startedAt"`
+	FinishedAt            time.Time      `json:"finishedAt"`
+	PurchasesAnonymized   int            `json:"purchasesAnonymized"`
+	LoyaltyCardsErased    int            `json:"loyaltyCardsErased"`
+	PaymentMethodsRevoked int            `json:"paymentMethodsRevoked"`
+	Erased                map[string]int `json:"erased,omitempty"`
+	// Failures are the steps that did not finish. Erasing again retries them; what was done is not redone.
+	Failures []string `json:"failures,omitempty"`
+}
+
+func (r Report) Complete() bool {
+	return len(r.Failures) == 0
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("%d purchases anonymized, %d loyalty cards erased, %d payment methods revoked",
+		r.PurchasesAnonymized, r.LoyaltyCardsErased, r.PaymentMethodsRevoked)
+	for _, name := range slices.Sorted(maps.Keys(r.Erased)) {
+		s += fmt.Sprintf(", %d %s erased", r.Erased[name], name)
+	}
+	if !r.Complete() {
+		s += fmt.Sprintf(", %d steps failed", len(r.Failures))
+	}
+	return s
+}
+
+type namedEraser struct {
+	name string
+	e    Eraser
+}
+
+type Service struct {
+	purchases Purchases
+	cards     Eraser
+	methods   PaymentMethods
+	others    []namedEraser
+	audit     audit.Recorder
+}
+
+type Option func(s *Service)
+
+// WithEraser also forgets the customer in e, e.g. a read model; name labels it in the report.
+func WithEraser(name string, e Eraser) Option {
+	return func(s *Service) {
+		s.others = append(s.others, namedEraser{name: name, e: e})
+	}
+}
+
+// WithAuditLog records every erasure, with its report, in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+func NewService(purchases Purchases, cards Eraser, methods PaymentMethods, opts ...Option) (*Service, error) {
+	if purchases == nil {
+		return nil, errors.New("purchases cannot be nil")
+	}
+	if cards == nil {
+		return nil, errors.New("loyalty cards cannot be nil")
+	}
+	if methods == nil {
+		return nil, errors.New("payment methods cannot be nil")
+	}
+	s := &Service{purchases: purchases, cards: cards, methods: methods}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// Erase forgets customerID: the payment methods stored with their purchases are revoked, the purchases are
+// anonymized, their loyalty cards lose their name and email address and the other erasers are run. A
+// failing step does not stop the others; the report lists it and the error joins them all. Purchases are
+// only anonymized once all their payment methods are revoked, so that erasing again can still find them.
+func (s *Service) Erase(ctx context.Context, customerID uuid.UUID) (Report, error) {
+	if customerID == uuid.Nil {
+		return Report{}, ErrMissingCustomer
+	}
+	r := Report{CustomerID: customerID, RequestedBy: audit.Actor(ctx), StartedAt: time.Now().UTC()}
+	var errs []error
+	fail := func(step string, err error) {
+		r.Failures = append(r.Failures, step)
+		errs = append(errs, fmt.Errorf("failed to %s: %w", step, err))
+	}
+
+	tokens, err := s.purchases.CardTokens(ctx, customerID)
+	if err != nil {
+		fail("list payment methods", err)
+	}
+	revokedAll := err == nil
+	for i, token := range tokens {
+		revoked, err := s.methods.RevokePaymentMethod(ctx, token)
+		if err != nil {
+			// The token is left out of the report, as it may still be good for paying.
+			fail(fmt.Sprintf("revoke payment method %d of %d", i+1, len(tokens)), err)
+			revokedAll = false
+			continue
+		}
+		if revoked {
+			r.PaymentMethodsRevoked++
+		}
+	}
+	if revokedAll {
+		if r.PurchasesAnonymized, err = s.purchases.AnonymizeCustomer(ctx, customerID); err != nil {
+			fail("anonymize purchases", err)
+		}
+	} else {
+		r.Failures = append(r.Failures, "anonymize purchases")
+	}
+	if r.LoyaltyCardsErased, err = s.cards.EraseCustomer(ctx, customerID); err != nil {
+		fail("erase loyalty cards", err)
+	}
+	for _, o := range s.others {
+		n, err := o.e.EraseCustomer(ctx, customerID)
+		if err != nil {
+			fail("erase "+o.name, err)
+			continue
+		}
+		if r.Erased == nil {
+			r.Erased = map[string]int{}
+		}
+		r.Erased[o.name] = n
+	}
+	r.FinishedAt = time.Now().UTC()
+
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionCustomerErasure, "customer", customerID.String(), "", r.String())
+		if err := s.audit.Record(ctx, e); err != nil {
+			errs = append(errs, fmt.Errorf("failed to record the erasure in the audit log: %w", err))
+		}
+	}
+	return r, errors.Join(errs...)
+}
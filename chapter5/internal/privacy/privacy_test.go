@@ -0,0 +1,111 @@
+package privacy_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/privacy"
+	"coffeeco/internal/store"
+)
+
+type purchases struct {
+	tokens     []string
+	identified int
+}
+
+func (p *purchases) CardTokens(context.Context, uuid.UUID) ([]string, error) {
+	return p.tokens, nil
+}
+
+func (p *purchases) AnonymizeCustomer(context.Context, uuid.UUID) (int, error) {
+	n := p.identified
+	p.identified, p.tokens = 0, nil
+	return n, nil
+}
+
+// gateway revokes payment methods starting with pm_, unless it is down.
+type gateway struct {
+	down bool
+}
+
+func (g gateway) RevokePaymentMethod(_ context.Context, token string) (bool, error) {
+	if g.down {
+		return false, errors.New("gateway unavailable")
+	}
+	return strings.HasPrefix(token, "pm_"), nil
+}
+
+func Test_EraseForgetsTheCustomerEverywhere(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "dpo@coffeeco.example")
+	customerID, otherID := uuid.New(), uuid.New()
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: customerID, FirstName: "Ada", EmailAddress: "ada@example.com"})
+	other := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: otherID})
+	for _, c := range []*loyalty.CoffeeBux{card, other} {
+		if err := cards.Save(ctx, c); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	auditLog := audit.NewMemoryRepo()
+	svc, err := privacy.NewService(&purchases{tokens: []string{"pm_1", "tok_2"}, identified: 3}, cards, gateway{}, privacy.WithAuditLog(auditLog))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	r, err := svc.Erase(ctx, customerID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !r.Complete() || r.PurchasesAnonymized != 3 || r.PaymentMethodsRevoked != 1 || r.LoyaltyCardsErased != 1 {
+		t.Fatalf("expected 3 purchases, 1 payment method and 1 card but got %s", r)
+	}
+	if r.RequestedBy != "dpo@coffeeco.example" {
+		t.Fatalf("expected the erasure to be requested by dpo@coffeeco.example but got %s", r.RequestedBy)
+	}
+	if got, _ := cards.Get(ctx, card.ID); got.CustomerID() != uuid.Nil {
+		t.Fatalf("expected the card to be erased but it still belongs to %s", got.CustomerID())
+	}
+	if got, _ := cards.Get(ctx, other.ID); got.CustomerID() != otherID {
+		t.Fatalf("expected other customers' cards to be left alone but got %s", got.CustomerID())
+	}
+	entries, err := auditLog.Query(ctx, audit.Query{From: time.Now().Add(-time.Minute), To: time.Now().Add(time.Minute)})
+	if err != nil || len(entries) != 1 || entries[0].Action != audit.ActionCustomerErasure || entries[0].After != r.String() {
+		t.Fatalf("expected the erasure in the audit log but got %v (%v)", entries, err)
+	}
+}
+
+func Test_EraseKeepsPurchasesUntilTheirPaymentMethodsAreRevoked(t *testing.T) {
+	ctx := context.Background()
+	customerID := uuid.New()
+	p := &purchases{tokens: []string{"pm_1"}, identified: 2}
+	svc, _ := privacy.NewService(p, loyalty.NewMemoryRepo(), gateway{down: true})
+
+	r, err := svc.Erase(ctx, customerID)
+	if err == nil || r.Complete() {
+		t.Fatalf("expected the erasure to fail but got %s", r)
+	}
+	if p.identified != 2 {
+		t.Fatalf("expected the purchases to be left for a retry but %d are still identified", p.identified)
+	}
+
+	svc, _ = privacy.NewService(p, loyalty.NewMemoryRepo(), gateway{})
+	r, err = svc.Erase(ctx, customerID)
+	if err != nil || r.PurchasesAnonymized != 2 || r.PaymentMethodsRevoked != 1 {
+		t.Fatalf("expected the retry to finish the erasure but got %s (%v)", r, err)
+	}
+}
+
+func Test_EraseNeedsACustomer(t *testing.T) {
+	svc, _ := privacy.NewService(&purchases{}, loyalty.NewMemoryRepo(), gateway{})
+	if _, err := svc.Erase(context.Background(), uuid.Nil); !errors.Is(err, privacy.ErrMissingCustomer) {
+		t.Fatalf("expected ErrMissingCustomer but got %v", err)
+	}
+}
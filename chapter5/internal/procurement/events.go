@@ -0,0 +1,48 @@
+package procurement
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const EventTypeOrderApproved = "procurement.order_approved"
+
+// OrderApproved is published once a manager approved a purchase order, for it to be sent to the supplier.
+type OrderApproved struct {
+	OrderID    uuid.UUID      `json:"order_id"`
+	StoreID    uuid.UUID      `json:"store_id"`
+	SupplierID string         `json:"supplier_id"`
+	Lines      []ApprovedLine `json:"lines"`
+	Currency   string         `json:"currency"`
+	Total      int64          `json:"total"`
+	ApprovedBy string         `json:"approved_by"`
+	ApprovedAt time.Time      `json:"approved_at"`
+}
+
+type ApprovedLine struct {
+	SKU       string `json:"sku"`
+	Item      string `json:"item"`
+	Packs     int64  `json:"packs"`
+	PackPrice int64  `json:"pack_price"`
+}
+
+func (e OrderApproved) EventType() string {
+	return EventTypeOrderApproved
+}
+
+func (e OrderApproved) AggregateID() uuid.UUID {
+	return e.OrderID
+}
+
+// EventID is derived from the order, as an order is approved only once.
+func (e OrderApproved) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.OrderID, []byte(EventTypeOrderApproved))
+}
+
+// RegisterEvents adds decoders for every version of the procurement events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeOrderApproved, 1, events.JSONDecoder[OrderApproved]())
+}
@@ -0,0 +1,209 @@
+package procurement
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("purchase order not found")
+	ErrInvalidTransition   = errors.New("purchase order cannot move to that status")
+	ErrEmptyOrder          = errors.New("purchase order has nothing to order")
+	ErrNoApprover          = errors.New("purchase orders are approved by someone")
+	ErrUnknownItem         = errors.New("item is not on the purchase order")
+	ErrInvalidQuantity     = errors.New("packs cannot be negative")
+	ErrConcurrencyConflict = errors.New("purchase order changed since it was read")
+)
+
+// Status is where a purchase order is, from the draft made on low stock to the delivery at the store.
+type Status string
+
+const (
+	StatusDraft     Status = "draft"
+	StatusApproved  Status = "approved"
+	StatusReceived  Status = "received"
+	StatusCancelled Status = "cancelled"
+)
+
+// Line is one item ordered, in packs of the supplier's offer at the time the line was added.
+type Line struct {
+	Item      string
+	SKU       string
+	Packs     int64
+	PackSize  int64
+	PackPrice int64
+	// Received is how many packs arrived, once the order has.
+	Received int64
+}
+
+// Order is a purchase order of a store from one supplier. There is at most one draft per store and
+// supplier, which low stock adds to until a manager approves it.
+type Order struct {
+	ID         uuid.UUID
+	StoreID    uuid.UUID
+	SupplierID string
+	Currency   string
+	CreatedAt  time.Time
+
+	version    int
+	status     Status
+	lines      []Line
+	approvedBy string
+	approvedAt time.Time
+	receivedAt time.Time
+	// cancelReason is why the order was cancelled, and by whom.
+	cancelReason string
+}
+
+func NewOrder(storeID uuid.UUID, supplierID, currency string, createdAt time.Time) *Order {
+	return &Order{
+		ID:         uuid.New(),
+		StoreID:    storeID,
+		SupplierID: supplierID,
+		Currency:   currency,
+		CreatedAt:  createdAt.UTC(),
+		status:     StatusDraft,
+	}
+}
+
+func (o *Order) Status() Status {
+	return o.status
+}
+
+func (o *Order) Lines() []Line {
+	return slices.Clone(o.lines)
+}
+
+func (o *Order) ApprovedBy() string {
+	return o.approvedBy
+}
+
+func (o *Order) ApprovedAt() time.Time {
+	return o.approvedAt
+}
+
+func (o *Order) ReceivedAt() time.Time {
+	return o.receivedAt
+}
+
+func (o *Order) CancelReason() string {
+	return o.cancelReason
+}
+
+// Has tells whether item is on the order.
+func (o *Order) Has(item string) bool {
+	return slices.ContainsFunc(o.lines, func(l Line) bool { return l.Item == item })
+}
+
+// Total is what the order costs at the prices it was drafted at.
+func (o *Order) Total() *money.Money {
+	var total int64
+	for _, l := range o.lines {
+		total += l.Packs * l.PackPrice
+	}
+	return money.New(total, o.Currency)
+}
+
+// Add puts an item on a draft. An item already on it is left as it is, so an item running low twice is
+// not ordered twice.
+func (o *Order) Add(l Line) error {
+	if o.status != StatusDraft {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, o.ID, o.status, StatusDraft)
+	}
+	if l.Packs <= 0 {
+		return ErrInvalidQuantity
+	}
+	if !o.Has(l.Item) {
+		o.lines = append(o.lines, l)
+	}
+	return nil
+}
+
+// SetPacks changes how many packs of an item a draft orders; 0 takes the item off it.
+func (o *Order) SetPacks(item string, packs int64) error {
+	if o.status != StatusDraft {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, o.ID, o.status, StatusDraft)
+	}
+	if packs < 0 {
+		return ErrInvalidQuantity
+	}
+	i := slices.IndexFunc(o.lines, func(l Line) bool { return l.Item == item })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrUnknownItem, item)
+	}
+	if packs == 0 {
+		o.lines = slices.Delete(o.lines, i, i+1)
+		return nil
+	}
+	o.lines[i].Packs = packs
+	return nil
+}
+
+// Approve is called by the manager who agrees to pay for the order, after which it can be sent.
+func (o *Order) Approve(by string, at time.Time) error {
+	if by == "" {
+		return ErrNoApprover
+	}
+	if len(o.lines) == 0 {
+		return ErrEmptyOrder
+	}
+	if err := o.move(StatusDraft, StatusApproved); err != nil {
+		return err
+	}
+	o.approvedBy = by
+	o.approvedAt = at.UTC()
+	return nil
+}
+
+// Cancel drops an order that was not received yet.
+func (o *Order) Cancel(reason string) error {
+	if o.status != StatusDraft && o.status != StatusApproved {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidTransition, o.ID, o.status)
+	}
+	o.status = StatusCancelled
+	o.cancelReason = reason
+	return nil
+}
+
+// Receive records the delivery of an approved order. received is the packs that arrived by item; a nil map
+// means everything arrived as ordered, and an item left out of a map did not arrive at all. It returns
+// how much of each item to add to the store's stock.
+func (o *Order) Receive(received map[string]int64, at time.Time) (map[string]int64, error) {
+	for item, packs := range received {
+		if !o.Has(item) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownItem, item)
+		}
+		if packs < 0 {
+			return nil, ErrInvalidQuantity
+		}
+	}
+	if err := o.move(StatusApproved, StatusReceived); err != nil {
+		return nil, err
+	}
+	o.receivedAt = at.UTC()
+	restock := map[string]int64{}
+	for i, l := range o.lines {
+		packs := l.Packs
+		if received != nil {
+			packs = received[l.Item]
+		}
+		o.lines[i].Received = packs
+		if packs > 0 {
+			restock[l.Item] = packs * l.PackSize
+		}
+	}
+	return restock, nil
+}
+
+func (o *Order) move(from, to Status) error {
+	if o.status != from {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, o.ID, o.status, from)
+	}
+	o.status = to
+	return nil
+}
@@ -0,0 +1,103 @@
+package procurement_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/procurement"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+func lowStock(t *testing.T, svc *procurement.Service, storeID uuid.UUID, item string, available int64) {
+	t.Helper()
+	msg, err := events.NewMessage(inventory.LowStock{StoreID: storeID, Item: item, Available: available, Threshold: available}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_LowStockIsReorderedOnceApprovedAndReceived(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	suppliers := procurement.Suppliers{
+		"dairy": {Name: "Dairy Co", Currency: "USD", Catalog: map[string]procurement.Offer{
+			"milk_ml": {SKU: "MILK-12L", PackSize: 12000, PackPrice: 1800, OrderUpTo: 30000},
+		}},
+		"roaster": {Name: "Roaster", Currency: "USD", Catalog: map[string]procurement.Offer{
+			"beans_g": {SKU: "BEANS-1KG", PackSize: 1000, PackPrice: 2500, OrderUpTo: 5000},
+			// Dearer per millilitre than the dairy's.
+			"milk_ml": {SKU: "OAT-1L", PackSize: 1000, PackPrice: 200},
+		}},
+	}
+	stock := inventory.NewService(inventory.NewMemoryRepo(), nil)
+	pub := &capture{}
+	svc := procurement.NewService(procurement.NewMemoryRepo(), suppliers, stock, procurement.WithEventPublisher(pub))
+
+	lowStock(t, svc, storeID, "milk_ml", 4000)
+	// Redelivered, or low again before the order arrived.
+	lowStock(t, svc, storeID, "milk_ml", 3000)
+	lowStock(t, svc, storeID, "beans_g", 800)
+	lowStock(t, svc, storeID, "cups", 10)
+
+	open, err := svc.Open(ctx, storeID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(open) != 2 {
+		t.Fatalf("expected a draft for the dairy and one for the roaster but got %d", len(open))
+	}
+	var milk *procurement.Order
+	for _, o := range open {
+		if o.SupplierID == "dairy" {
+			milk = o
+		}
+	}
+	// 26000 ml short of 30000 is three crates.
+	if milk == nil || len(milk.Lines()) != 1 || milk.Lines()[0].Packs != 3 || milk.Total().Amount() != 5400 {
+		t.Fatalf("expected three crates of milk from the dairy but got %+v", milk)
+	}
+
+	if err := svc.Receive(ctx, milk.ID, nil); !errors.Is(err, procurement.ErrInvalidTransition) {
+		t.Fatalf("expected a draft not to be received but got %v", err)
+	}
+	if err := svc.Approve(ctx, milk.ID, ""); !errors.Is(err, procurement.ErrNoApprover) {
+		t.Fatalf("expected an approver to be needed but got %v", err)
+	}
+	if err := svc.Approve(ctx, milk.ID, "maria"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(*pub) != 1 || (*pub)[0].(procurement.OrderApproved).Lines[0].SKU != "MILK-12L" {
+		t.Fatalf("expected the approved order to be published but got %+v", *pub)
+	}
+	// An approved order already has the milk coming.
+	lowStock(t, svc, storeID, "milk_ml", 2000)
+	if open, _ := svc.Open(ctx, storeID); len(open) != 2 {
+		t.Fatalf("expected no new draft but got %d open orders", len(open))
+	}
+
+	// One crate was damaged.
+	if err := svc.Receive(ctx, milk.ID, map[string]int64{"milk_ml": 2}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	st, _ := stock.Stock(ctx, storeID)
+	if l, _ := st.Level("milk_ml"); l.OnHand != 24000 {
+		t.Fatalf("expected two crates of milk in stock but got %d ml", l.OnHand)
+	}
+	if err := svc.Receive(ctx, milk.ID, nil); !errors.Is(err, procurement.ErrInvalidTransition) {
+		t.Fatalf("expected a delivery not to be received twice but got %v", err)
+	}
+}
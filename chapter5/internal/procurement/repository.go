@@ -0,0 +1,251 @@
+package procurement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such order.
+	Get(ctx context.Context, id uuid.UUID) (*Order, error)
+	// Save returns ErrConcurrencyConflict if the order was saved by someone else since it was read, or if
+	// a new order is a second draft of the same store and supplier.
+	Save(ctx context.Context, o *Order) error
+	// Open returns the drafts and approved orders of a store, oldest first.
+	Open(ctx context.Context, storeID uuid.UUID) ([]*Order, error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps purchase orders versioned, so low stock cannot add to a draft as it is approved.
+type MongoRepository struct {
+	client *mongo.Client
+	orders *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	orders := client.Database("coffeeco").Collection("purchase_orders")
+	_, err = orders.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		// One draft per store and supplier.
+		{
+			Keys:    bson.D{{Key: "store_id", Value: 1}, {Key: "supplier_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "status", Value: string(StatusDraft)}}),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create purchase order indexes: %w", err)
+	}
+	return &MongoRepository{client: client, orders: orders}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoOrder struct {
+	ID           string      `bson:"_id"`
+	Version      int         `bson:"version"`
+	StoreID      string      `bson:"store_id"`
+	SupplierID   string      `bson:"supplier_id"`
+	Currency     string      `bson:"currency"`
+	Status       string      `bson:"status"`
+	Lines        []mongoLine `bson:"lines"`
+	CreatedAt    time.Time   `bson:"created_at"`
+	ApprovedBy   string      `bson:"approved_by,omitempty"`
+	ApprovedAt   time.Time   `bson:"approved_at,omitempty"`
+	ReceivedAt   time.Time   `bson:"received_at,omitempty"`
+	CancelReason string      `bson:"cancel_reason,omitempty"`
+}
+
+type mongoLine struct {
+	Item      string `bson:"item"`
+	SKU       string `bson:"sku"`
+	Packs     int64  `bson:"packs"`
+	PackSize  int64  `bson:"pack_size"`
+	PackPrice int64  `bson:"pack_price"`
+	Received  int64  `bson:"received"`
+}
+
+func toMongoOrder(o *Order) mongoOrder {
+	doc := mongoOrder{
+		ID:           o.ID.String(),
+		Version:      o.version,
+		StoreID:      o.StoreID.String(),
+		SupplierID:   o.SupplierID,
+		Currency:     o.Currency,
+		Status:       string(o.status),
+		Lines:        make([]mongoLine, 0, len(o.lines)),
+		CreatedAt:    o.CreatedAt,
+		ApprovedBy:   o.approvedBy,
+		ApprovedAt:   o.approvedAt,
+		ReceivedAt:   o.receivedAt,
+		CancelReason: o.cancelReason,
+	}
+	for _, l := range o.lines {
+		doc.Lines = append(doc.Lines, mongoLine(l))
+	}
+	return doc
+}
+
+func (m mongoOrder) toOrder() *Order {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	o := &Order{
+		ID:           id,
+		StoreID:      storeID,
+		SupplierID:   m.SupplierID,
+		Currency:     m.Currency,
+		CreatedAt:    m.CreatedAt,
+		version:      m.Version,
+		status:       Status(m.Status),
+		approvedBy:   m.ApprovedBy,
+		approvedAt:   m.ApprovedAt,
+		receivedAt:   m.ReceivedAt,
+		cancelReason: m.CancelReason,
+	}
+	for _, l := range m.Lines {
+		o.lines = append(o.lines, Line(l))
+	}
+	return o
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Order, err error) {
+	ctx, span := telemetry.StartClient(ctx, "procurement.MongoRepository.Get", attribute.String("order.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoOrder
+	if err := m.orders.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find purchase order: %w", err)
+	}
+	return doc.toOrder(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, o *Order) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "procurement.MongoRepository.Save", attribute.String("order.id", o.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoOrder(o)
+	doc.Version = o.version + 1
+	if o.version == 0 {
+		if _, err := m.orders.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save purchase order: %w", err)
+		}
+	} else {
+		res, err := m.orders.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: o.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save purchase order: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	o.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Open(ctx context.Context, storeID uuid.UUID) (_ []*Order, err error) {
+	ctx, span := telemetry.StartClient(ctx, "procurement.MongoRepository.Open", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "status", Value: bson.D{{Key: "$in", Value: bson.A{string(StatusDraft), string(StatusApproved)}}}},
+	}
+	cur, err := m.orders.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open purchase orders: %w", err)
+	}
+	var docs []mongoOrder
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode purchase orders: %w", err)
+	}
+	orders := make([]*Order, 0, len(docs))
+	for _, doc := range docs {
+		orders = append(orders, doc.toOrder())
+	}
+	return orders, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.orders.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps purchase orders in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	orders map[uuid.UUID]mongoOrder
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{orders: map[uuid.UUID]mongoOrder{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toOrder(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, o *Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.orders[o.ID].Version != o.version {
+		return ErrConcurrencyConflict
+	}
+	if o.version == 0 {
+		for _, doc := range m.orders {
+			if doc.StoreID == o.StoreID.String() && doc.SupplierID == o.SupplierID && doc.Status == string(StatusDraft) {
+				return ErrConcurrencyConflict
+			}
+		}
+	}
+	doc := toMongoOrder(o)
+	doc.Version = o.version + 1
+	m.orders[o.ID] = doc
+	o.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Open(_ context.Context, storeID uuid.UUID) ([]*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []*Order
+	for _, doc := range m.orders {
+		if doc.StoreID == storeID.String() && (doc.Status == string(StatusDraft) || doc.Status == string(StatusApproved)) {
+			orders = append(orders, doc.toOrder())
+		}
+	}
+	slices.SortFunc(orders, func(a, b *Order) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return orders, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,231 @@
+package procurement
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/inventory"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the order first.
+const saveAttempts = 3
+
+// Stock is where received orders go, e.g. inventory.Service.
+type Stock interface {
+	Restock(ctx context.Context, storeID uuid.UUID, item string, qty int64) error
+}
+
+type Service struct {
+	repo      Repository
+	suppliers Suppliers
+	stock     Stock
+	registry  *events.Registry
+	publisher events.Publisher // 可选, 发布已批准的订单
+	audit     audit.Recorder   // 可选, 记录谁批准了订单
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes OrderApproved, for approved orders to be sent to their supplier.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithAuditLog records every approval in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when orders were approved.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, suppliers Suppliers, stock Stock, opts ...Option) *Service {
+	r := events.NewRegistry()
+	inventory.RegisterEvents(r)
+	s := &Service{repo: repo, suppliers: suppliers, stock: stock, registry: r, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Handle is an events.Handler for the inventory topic that drafts a purchase order for every item that
+// runs low, from the supplier that sells it the cheapest. The item is added to the store's draft for that
+// supplier, unless an open order of the store already has it. Items no supplier sells are only logged.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != inventory.EventTypeLowStock {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(inventory.LowStock)
+	supplierID, offer, ok := s.suppliers.For(e.Item)
+	if !ok {
+		s.logger.WarnContext(ctx, "stock is low but no supplier sells it", "store", e.StoreID, "item", e.Item)
+		return nil
+	}
+	line := Line{Item: e.Item, SKU: offer.SKU, Packs: offer.packs(e.Available), PackSize: offer.PackSize, PackPrice: offer.PackPrice}
+	for range saveAttempts {
+		open, err := s.repo.Open(ctx, e.StoreID)
+		if err != nil {
+			return err
+		}
+		var draft *Order
+		for _, o := range open {
+			if o.Has(e.Item) {
+				return nil
+			}
+			if o.status == StatusDraft && o.SupplierID == supplierID {
+				draft = o
+			}
+		}
+		if draft == nil {
+			draft = NewOrder(e.StoreID, supplierID, s.suppliers[supplierID].Currency, s.now())
+		}
+		if err := draft.Add(line); err != nil {
+			return err
+		}
+		err = s.repo.Save(ctx, draft)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to draft purchase order: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to draft purchase order after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) Order(ctx context.Context, id uuid.UUID) (*Order, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Open returns the drafts and approved orders of a store, oldest first.
+func (s *Service) Open(ctx context.Context, storeID uuid.UUID) ([]*Order, error) {
+	return s.repo.Open(ctx, storeID)
+}
+
+// SetPacks changes how many packs of an item a draft orders; 0 takes the item off it.
+func (s *Service) SetPacks(ctx context.Context, id uuid.UUID, item string, packs int64) error {
+	_, err := s.update(ctx, id, func(o *Order) error {
+		return o.SetPacks(item, packs)
+	})
+	return err
+}
+
+// Approve is called by the manager who agrees to pay for a draft. The order is then published to be sent
+// to the supplier; failing to publish it is only logged.
+func (s *Service) Approve(ctx context.Context, id uuid.UUID, by string) error {
+	o, err := s.update(ctx, id, func(o *Order) error {
+		return o.Approve(by, s.now())
+	})
+	if err != nil {
+		return err
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionPurchaseOrderApproval, "purchase_order", o.ID.String(), string(StatusDraft), fmt.Sprintf("%s by %s for %s", StatusApproved, by, o.Total().Display()))
+		if err := s.audit.Record(ctx, e); err != nil {
+			return fmt.Errorf("purchase order approved but failed to record it in the audit log: %w", err)
+		}
+	}
+	if s.publisher == nil {
+		return nil
+	}
+	e := OrderApproved{
+		OrderID:    o.ID,
+		StoreID:    o.StoreID,
+		SupplierID: o.SupplierID,
+		Currency:   o.Currency,
+		Total:      o.Total().Amount(),
+		ApprovedBy: o.approvedBy,
+		ApprovedAt: o.approvedAt,
+	}
+	for _, l := range o.lines {
+		e.Lines = append(e.Lines, ApprovedLine{SKU: l.SKU, Item: l.Item, Packs: l.Packs, PackPrice: l.PackPrice})
+	}
+	if err := s.publisher.Publish(ctx, e); err != nil {
+		s.logger.ErrorContext(ctx, "purchase order approved but not published", "order", o.ID, "error", err)
+	}
+	return nil
+}
+
+// Cancel drops a draft, or an approved order the supplier will not deliver.
+func (s *Service) Cancel(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := s.update(ctx, id, func(o *Order) error {
+		return o.Cancel(reason)
+	})
+	return err
+}
+
+// Receive records the delivery of an approved order and adds what arrived to the store's stock; see
+// Order.Receive for what received means. The order is received before the stock is topped up, so a
+// delivery is never counted twice. An item that could not be restocked is named in the error, to be
+// restocked by hand.
+func (s *Service) Receive(ctx context.Context, id uuid.UUID, received map[string]int64) error {
+	var restock map[string]int64
+	o, err := s.update(ctx, id, func(o *Order) (err error) {
+		restock, err = o.Receive(received, s.now())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for item, qty := range restock {
+		if err := s.stock.Restock(ctx, o.StoreID, item, qty); err != nil {
+			errs = append(errs, fmt.Errorf("purchase order received but failed to restock %d of %s: %w", qty, item, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// update applies fn to the latest order and saves it, starting over if someone else saved in between.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(o *Order) error) (*Order, error) {
+	for range saveAttempts {
+		o, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(o); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, o)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return o, nil
+	}
+	return nil, fmt.Errorf("failed to update purchase order after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,54 @@
+package procurement
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// Supplier sells stock to the stores, e.g. the roaster or the dairy.
+type Supplier struct {
+	Name  string `json:"name"`
+	Email string `json:"email"` // 可选, 订单发给谁
+	// Currency of the pack prices of the catalog.
+	Currency string `json:"currency"`
+	// Catalog is what the supplier sells, by the inventory item it tops up, e.g. "milk_ml".
+	Catalog map[string]Offer `json:"catalog"`
+}
+
+// Offer is how an item is sold: in packs of PackSize, e.g. crates of 12000 ml of milk.
+type Offer struct {
+	SKU       string `json:"sku"`
+	PackSize  int64  `json:"pack_size"`
+	PackPrice int64  `json:"pack_price"`
+	// OrderUpTo is how much of the item a store should have once an order arrives. At least one pack is
+	// always ordered.
+	OrderUpTo int64 `json:"order_up_to"`
+}
+
+// cheaperThan compares unit prices without dividing, so rounding never picks the wrong supplier.
+func (o Offer) cheaperThan(other Offer) bool {
+	return o.PackPrice*other.PackSize < other.PackPrice*o.PackSize
+}
+
+// packs is how many packs take a store from available up to OrderUpTo.
+func (o Offer) packs(available int64) int64 {
+	short := max(o.OrderUpTo-available, 1)
+	return (short + o.PackSize - 1) / o.PackSize
+}
+
+// Suppliers are every supplier, by supplier ID.
+type Suppliers map[string]Supplier
+
+// For returns the supplier that sells item the cheapest, and its offer. Suppliers in different currencies
+// are compared by the amounts alone.
+func (s Suppliers) For(item string) (supplierID string, offer Offer, ok bool) {
+	// Sorted so that suppliers as cheap as each other are picked the same way every time.
+	for _, id := range slices.SortedFunc(maps.Keys(s), cmp.Compare) {
+		o, sells := s[id].Catalog[item]
+		if sells && (!ok || o.cheaperThan(offer)) {
+			supplierID, offer, ok = id, o, true
+		}
+	}
+	return supplierID, offer, ok
+}
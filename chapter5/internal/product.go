@@ -5,4 +5,8 @@ import "github.com/Rhymond/go-money"
 type Product struct {
 	ItemName  string
 	BasePrice money.Money
+	Size      string   // 可选, 如 "large"; 价格由pricing决定
+	Modifiers []string // 可选, 如 "oat milk"
+	// ReusableCup 可选, 顾客自带杯子, 享受环保折扣
+	ReusableCup bool
 }
@@ -0,0 +1,43 @@
+package projection
+
+import (
+	"context"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/inbox"
+)
+
+// idempotent wraps a projection so redelivered events are not applied twice. This matters for read models
+// built from increments, like StoreSales and TopProducts.
+type idempotent struct {
+	Projection
+	store inbox.Store
+}
+
+// Idempotent wraps each projection with an inbox keyed by the projection's name.
+func Idempotent(store inbox.Store, projections ...Projection) []Projection {
+	res := make([]Projection, 0, len(projections))
+	for _, p := range projections {
+		res = append(res, idempotent{Projection: p, store: store})
+	}
+	return res
+}
+
+func (i idempotent) Handle(ctx context.Context, msg events.Message) error {
+	return inbox.Idempotent(i.store, i.Name(), i.Projection.Handle)(ctx, msg)
+}
+
+// Reset also forgets what was processed, otherwise a rebuild would skip every event.
+func (i idempotent) Reset(ctx context.Context) error {
+	if err := i.Projection.Reset(ctx); err != nil {
+		return err
+	}
+	return i.store.Forget(ctx, i.Name())
+}
+
+func (i idempotent) Flush(ctx context.Context) error {
+	if f, ok := i.Projection.(Flusher); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+
+	"coffeeco/internal/events"
+)
+
+// Projection keeps one query-optimized read model up to date from domain events.
+type Projection interface {
+	Name() string
+	// Handle applies msg to the read model. Messages the projection does not care about are ignored.
+	Handle(ctx context.Context, msg events.Message) error
+	// Reset throws the read model away so it can be rebuilt.
+	Reset(ctx context.Context) error
+}
+
+// Flusher is a projection that buffers what it handles, e.g. to write it in batches. Rebuild flushes it
+// once the history is replayed.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Source replays the full history of events, returning once everything has been delivered.
+type Source interface {
+	Replay(ctx context.Context, h events.Handler) error
+}
+
+// Worker feeds live events from the bus into a set of projections.
+type Worker struct {
+	subscriber  events.Subscriber
+	projections []Projection
+}
+
+func NewWorker(subscriber events.Subscriber, projections ...Projection) (*Worker, error) {
+	if subscriber == nil {
+		return nil, errors.New("subscriber cannot be nil")
+	}
+	if len(projections) == 0 {
+		return nil, errors.New("at least one projection is required")
+	}
+	return &Worker{subscriber: subscriber, projections: projections}, nil
+}
+
+// Run subscribes to every topic and blocks until ctx is cancelled or a subscription fails.
+func (w *Worker) Run(ctx context.Context, topics ...string) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, topic := range topics {
+		topic := topic
+		g.Go(func() error {
+			return w.subscriber.Subscribe(ctx, topic, w.dispatch)
+		})
+	}
+	return g.Wait()
+}
+
+func (w *Worker) dispatch(ctx context.Context, msg events.Message) error {
+	return dispatch(ctx, msg, w.projections)
+}
+
+// Rebuild resets the given projections and replays the full history from src into them.
+func Rebuild(ctx context.Context, src Source, projections ...Projection) error {
+	for _, p := range projections {
+		if err := p.Reset(ctx); err != nil {
+			return fmt.Errorf("failed to reset %s: %w", p.Name(), err)
+		}
+	}
+	err := src.Replay(ctx, func(ctx context.Context, msg events.Message) error {
+		return dispatch(ctx, msg, projections)
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range projections {
+		if f, ok := p.(Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				return fmt.Errorf("failed to flush %s: %w", p.Name(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// SourceFunc replays with a function, e.g. a replay of the topic of a bounded context.
+type SourceFunc func(ctx context.Context, h events.Handler) error
+
+func (f SourceFunc) Replay(ctx context.Context, h events.Handler) error {
+	return f(ctx, h)
+}
+
+func dispatch(ctx context.Context, msg events.Message, projections []Projection) error {
+	for _, p := range projections {
+		if err := p.Handle(ctx, msg); err != nil {
+			return fmt.Errorf("projection %s failed on %s %s: %w", p.Name(), msg.Type, msg.ID, err)
+		}
+	}
+	return nil
+}
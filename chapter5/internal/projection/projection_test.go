@@ -0,0 +1,55 @@
+package projection_test
+
+import (
+	"context"
+	"testing"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/projection"
+)
+
+type recordingProjection struct {
+	calls []string
+}
+
+func (r *recordingProjection) Name() string { return "recording" }
+
+func (r *recordingProjection) Handle(_ context.Context, msg events.Message) error {
+	r.calls = append(r.calls, msg.Type)
+	return nil
+}
+
+func (r *recordingProjection) Reset(context.Context) error {
+	r.calls = append(r.calls, "reset")
+	return nil
+}
+
+type sliceSource []events.Message
+
+func (s sliceSource) Replay(ctx context.Context, h events.Handler) error {
+	for _, m := range s {
+		if err := h(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Test_RebuildResetsBeforeReplaying(t *testing.T) {
+	p := &recordingProjection{calls: []string{"stale"}}
+	src := sliceSource{{Type: "purchase.completed"}, {Type: "loyalty.stamp_added"}}
+
+	if err := projection.Rebuild(context.Background(), src, p); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	want := []string{"stale", "reset", "purchase.completed", "loyalty.stamp_added"}
+	if len(p.calls) != len(want) {
+		t.Fatalf("expected %v but got %v", want, p.calls)
+	}
+	for i := range want {
+		if p.calls[i] != want[i] {
+			t.Fatalf("expected %v but got %v", want, p.calls)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+)
+
+// ReadModels groups the Mongo-backed read models maintained by projections.
+type ReadModels struct {
+	CustomerHistory *CustomerHistory
+	StoreSales      *StoreSales
+	TopProducts     *TopProducts
+}
+
+func NewMongoReadModels(ctx context.Context, connectionString string) (*ReadModels, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	registry := NewRegistry()
+	return &ReadModels{
+		CustomerHistory: &CustomerHistory{registry: registry, entries: db.Collection("rm_customer_history")},
+		StoreSales:      &StoreSales{registry: registry, days: db.Collection("rm_store_sales")},
+		TopProducts:     &TopProducts{registry: registry, products: db.Collection("rm_top_products")},
+	}, nil
+}
+
+// NewRegistry knows how to decode every event the read models are built from.
+func NewRegistry() *events.Registry {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	loyalty.RegisterEvents(r)
+	adjustment.RegisterEvents(r)
+	return r
+}
+
+// decode returns a nil event for messages no decoder is registered for; those are not for us.
+func decode(r *events.Registry, msg events.Message) (events.Event, error) {
+	e, err := r.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil, nil
+	}
+	return e, err
+}
+
+func (r *ReadModels) All() []Projection {
+	return []Projection{r.CustomerHistory, r.StoreSales, r.TopProducts}
+}
+
+// CustomerHistory lists the purchases made by identified customers, newest first.
+type CustomerHistory struct {
+	registry *events.Registry
+	entries  *mongo.Collection
+}
+
+type HistoryEntry struct {
+	PurchaseID  string    `bson:"_id" json:"purchase_id"`
+	CustomerID  string    `bson:"customer_id" json:"customer_id"`
+	StoreID     string    `bson:"store_id" json:"store_id"`
+	Items       []string  `bson:"items" json:"items"`
+	Total       int64     `bson:"total" json:"total"`
+	Currency    string    `bson:"currency" json:"currency"`
+	PurchasedAt time.Time `bson:"purchased_at" json:"purchased_at"`
+}
+
+func (c *CustomerHistory) Name() string {
+	return "customer_history"
+}
+
+func (c *CustomerHistory) Handle(ctx context.Context, msg events.Message) error {
+	evt, err := decode(c.registry, msg)
+	if err != nil {
+		return err
+	}
+	e, ok := evt.(purchase.Completed)
+	if !ok {
+		return nil
+	}
+	if e.CustomerID == uuid.Nil {
+		return nil
+	}
+	entry := HistoryEntry{
+		PurchaseID:  e.PurchaseID.String(),
+		CustomerID:  e.CustomerID.String(),
+		StoreID:     e.StoreID.String(),
+		Total:       e.Total,
+		Currency:    e.Currency,
+		PurchasedAt: e.PurchasedAt,
+	}
+	for _, l := range e.Lines {
+		entry.Items = append(entry.Items, l.ItemName)
+	}
+	// Keyed by purchase ID, so seeing the same event twice is harmless.
+	_, err = c.entries.ReplaceOne(ctx, bson.D{{Key: "_id", Value: entry.PurchaseID}}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to upsert history entry: %w", err)
+	}
+	return nil
+}
+
+func (c *CustomerHistory) Reset(ctx context.Context) error {
+	return c.entries.Drop(ctx)
+}
+
+// EraseCustomer deletes the history of customerID, for when they asked to be forgotten.
+func (c *CustomerHistory) EraseCustomer(ctx context.Context, customerID uuid.UUID) (int, error) {
+	res, err := c.entries.DeleteMany(ctx, bson.D{{Key: "customer_id", Value: customerID.String()}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to erase customer history: %w", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
+func (c *CustomerHistory) ForCustomer(ctx context.Context, customerID uuid.UUID, limit int64) ([]HistoryEntry, error) {
+	cur, err := c.entries.Find(ctx,
+		bson.D{{Key: "customer_id", Value: customerID.String()}},
+		options.Find().SetSort(bson.D{{Key: "purchased_at", Value: -1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer history: %w", err)
+	}
+	var res []HistoryEntry
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode customer history: %w", err)
+	}
+	return res, nil
+}
+
+// StoreSales aggregates sales per store per day for the store dashboard.
+type StoreSales struct {
+	registry *events.Registry
+	days     *mongo.Collection
+}
+
+type DailySales struct {
+	StoreID            string    `bson:"store_id" json:"store_id"`
+	Day                time.Time `bson:"day" json:"day"`
+	PurchaseCount      int64     `bson:"purchase_count" json:"purchase_count"`
+	SalesTotal         int64     `bson:"sales_total" json:"sales_total"`
+	FreeDrinksRedeemed int64     `bson:"free_drinks_redeemed" json:"free_drinks_redeemed"`
+	// PriceOverrides are the prices managers overrode, and Overridden what they gave away doing so.
+	PriceOverrides int64 `bson:"price_overrides" json:"price_overrides"`
+	Overridden     int64 `bson:"overridden" json:"overridden"`
+}
+
+func (s *StoreSales) Name() string {
+	return "store_sales"
+}
+
+func (s *StoreSales) Handle(ctx context.Context, msg events.Message) error {
+	var (
+		storeID uuid.UUID
+		inc     bson.D
+	)
+	evt, err := decode(s.registry, msg)
+	if err != nil {
+		return err
+	}
+	switch e := evt.(type) {
+	case purchase.Completed:
+		storeID = e.StoreID
+		inc = bson.D{{Key: "purchase_count", Value: 1}, {Key: "sales_total", Value: e.Total}}
+		if len(e.Overrides) > 0 {
+			var given int64
+			for _, o := range e.Overrides {
+				given += o.Was - o.Price
+			}
+			inc = append(inc, bson.E{Key: "price_overrides", Value: len(e.Overrides)}, bson.E{Key: "overridden", Value: given})
+		}
+	case loyalty.DrinksRedeemed:
+		storeID = e.StoreID
+		inc = bson.D{{Key: "free_drinks_redeemed", Value: e.Count}}
+	case adjustment.Recorded:
+		return s.move(ctx, e)
+	default:
+		return nil
+	}
+
+	day := msg.OccurredAt.UTC().Truncate(24 * time.Hour)
+	_, err = s.days.UpdateOne(ctx,
+		bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "day", Value: day}},
+		bson.D{{Key: "$inc", Value: inc}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update store sales: %w", err)
+	}
+	return nil
+}
+
+// move takes a purchase finance moved to another store off the sales of the store it was made at, and adds
+// it to the other's, on the day it was made. Adjustments of the tax only do not change the sales.
+func (s *StoreSales) move(ctx context.Context, e adjustment.Recorded) error {
+	if e.StoreID == e.WasStoreID {
+		return nil
+	}
+	day := e.PurchasedAt.UTC().Truncate(24 * time.Hour)
+	for _, m := range []struct {
+		storeID uuid.UUID
+		sign    int64
+	}{{e.WasStoreID, -1}, {e.StoreID, 1}} {
+		_, err := s.days.UpdateOne(ctx,
+			bson.D{{Key: "store_id", Value: m.storeID.String()}, {Key: "day", Value: day}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "purchase_count", Value: m.sign}, {Key: "sales_total", Value: m.sign * e.Total}}}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to move store sales: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *StoreSales) Reset(ctx context.Context) error {
+	return s.days.Drop(ctx)
+}
+
+func (s *StoreSales) ForStore(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]DailySales, error) {
+	cur, err := s.days.Find(ctx,
+		bson.D{
+			{Key: "store_id", Value: storeID.String()},
+			{Key: "day", Value: bson.D{{Key: "$gte", Value: from.UTC()}, {Key: "$lt", Value: to.UTC()}}},
+		},
+		options.Find().SetSort(bson.D{{Key: "day", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query store sales: %w", err)
+	}
+	var res []DailySales
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode store sales: %w", err)
+	}
+	return res, nil
+}
+
+// TopProducts counts how often each product sells across all stores.
+type TopProducts struct {
+	registry *events.Registry
+	products *mongo.Collection
+}
+
+type ProductSales struct {
+	ItemName string `bson:"_id" json:"item_name"`
+	Quantity int64  `bson:"quantity" json:"quantity"`
+	Revenue  int64  `bson:"revenue" json:"revenue"`
+}
+
+func (t *TopProducts) Name() string {
+	return "top_products"
+}
+
+func (t *TopProducts) Handle(ctx context.Context, msg events.Message) error {
+	evt, err := decode(t.registry, msg)
+	if err != nil {
+		return err
+	}
+	e, ok := evt.(purchase.Completed)
+	if !ok {
+		return nil
+	}
+	for _, l := range e.Lines {
+		_, err := t.products.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: l.ItemName}},
+			bson.D{{Key: "$inc", Value: bson.D{{Key: "quantity", Value: 1}, {Key: "revenue", Value: l.Amount}}}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update product sales: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *TopProducts) Reset(ctx context.Context) error {
+	return t.products.Drop(ctx)
+}
+
+func (t *TopProducts) Top(ctx context.Context, n int64) ([]ProductSales, error) {
+	cur, err := t.products.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "quantity", Value: -1}}).SetLimit(n))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top products: %w", err)
+	}
+	var res []ProductSales
+	if err := cur.All(ctx, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode top products: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,95 @@
+package projection
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// SalesReader is the query side of the StoreSales read model.
+type SalesReader interface {
+	ForStore(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]DailySales, error)
+}
+
+// Discrepancy is a store and day where the read model disagrees with the stored purchases.
+type Discrepancy struct {
+	StoreID       uuid.UUID
+	Day           time.Time
+	ExpectedCount int64
+	ActualCount   int64
+	ExpectedTotal int64
+	ActualTotal   int64
+}
+
+// ReconcileStoreSales recomputes daily sales between from and to from the stored purchases and reports
+// every store and day where the read model differs. Only stores with purchases in the period are checked.
+func ReconcileStoreSales(ctx context.Context, src Source, sales SalesReader, from, to time.Time) ([]Discrepancy, error) {
+	type key struct {
+		store uuid.UUID
+		day   time.Time
+	}
+	registry := NewRegistry()
+	expected := map[key]*Discrepancy{}
+	stores := map[uuid.UUID]bool{}
+
+	err := src.Replay(ctx, func(ctx context.Context, msg events.Message) error {
+		evt, err := decode(registry, msg)
+		if err != nil {
+			return err
+		}
+		e, ok := evt.(purchase.Completed)
+		if !ok || msg.OccurredAt.Before(from) || !msg.OccurredAt.Before(to) {
+			return nil
+		}
+		k := key{e.StoreID, msg.OccurredAt.UTC().Truncate(24 * time.Hour)}
+		d, ok := expected[k]
+		if !ok {
+			d = &Discrepancy{StoreID: k.store, Day: k.day}
+			expected[k] = d
+		}
+		d.ExpectedCount++
+		d.ExpectedTotal += e.Total
+		stores[e.StoreID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay purchases: %w", err)
+	}
+
+	for storeID := range stores {
+		days, err := sales.ForStore(ctx, storeID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, ds := range days {
+			k := key{storeID, ds.Day.UTC()}
+			d, ok := expected[k]
+			if !ok {
+				d = &Discrepancy{StoreID: storeID, Day: k.day}
+				expected[k] = d
+			}
+			d.ActualCount = ds.PurchaseCount
+			d.ActualTotal = ds.SalesTotal
+		}
+	}
+
+	var res []Discrepancy
+	for _, d := range expected {
+		if d.ExpectedCount != d.ActualCount || d.ExpectedTotal != d.ActualTotal {
+			res = append(res, *d)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].Day.Equal(res[j].Day) {
+			return res[i].Day.Before(res[j].Day)
+		}
+		return res[i].StoreID.String() < res[j].StoreID.String()
+	})
+	return res, nil
+}
@@ -0,0 +1,54 @@
+package projection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+)
+
+type fixedSales []projection.DailySales
+
+func (f fixedSales) ForStore(context.Context, uuid.UUID, time.Time, time.Time) ([]projection.DailySales, error) {
+	return f, nil
+}
+
+func completedMessage(t *testing.T, storeID uuid.UUID, total int64, at time.Time) events.Message {
+	t.Helper()
+	msg, err := events.NewMessage(purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: total, Currency: "USD"}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	msg.OccurredAt = at
+	return msg
+}
+
+func Test_ReconcileReportsDaysThatDisagree(t *testing.T) {
+	var (
+		storeID = uuid.New()
+		monday  = time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)
+		tuesday = monday.Add(24 * time.Hour)
+	)
+	src := sliceSource{
+		completedMessage(t, storeID, 350, monday.Add(9*time.Hour)),
+		completedMessage(t, storeID, 400, monday.Add(10*time.Hour)),
+		completedMessage(t, storeID, 300, tuesday.Add(9*time.Hour)),
+	}
+	sales := fixedSales{
+		{StoreID: storeID.String(), Day: monday, PurchaseCount: 2, SalesTotal: 750},
+		{StoreID: storeID.String(), Day: tuesday, PurchaseCount: 0, SalesTotal: 0},
+	}
+
+	got, err := projection.ReconcileStoreSales(context.Background(), src, sales, monday, tuesday.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(got) != 1 || !got[0].Day.Equal(tuesday) || got[0].ExpectedTotal != 300 || got[0].ActualTotal != 0 {
+		t.Fatalf("expected only tuesday to disagree but got %+v", got)
+	}
+}
@@ -0,0 +1,38 @@
+package purchase_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+// BenchmarkCompletePurchase measures the purchase path itself, with gateways and repositories that do
+// nothing, by the size of the basket. Run it with -benchmem to see what every purchase allocates.
+func BenchmarkCompletePurchase(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("products=%d", n), func(b *testing.B) {
+			ctx := context.Background()
+			storeID := uuid.New()
+			svc := purchase.NewService(instant{}, noPurchases{}, percentOff(10))
+			products := make([]coffeeco.Product, n)
+			for i := range products {
+				products[i] = coffeeco.Product{ItemName: "latte", BasePrice: *money.New(450, "USD")}
+			}
+			token := "tok_visa"
+			b.ReportAllocs()
+			for b.Loop() {
+				p := &purchase.Purchase{ProductsToPurchase: products, PaymentMeans: payment.MEANS_CARD, CardToken: &token}
+				if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil {
+					b.Fatalf("expected no error but got %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/breaker"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/store"
+)
+
+// BreakingCardCharges calls c through b. Once b is open, card purchases fail fast with
+// ErrCardPaymentsUnavailable instead of waiting on a gateway that is down.
+func BreakingCardCharges(c CardChargeService, b *breaker.Breaker) CardChargeService {
+	return breakingCardCharges{c: c, b: b}
+}
+
+type breakingCardCharges struct {
+	c CardChargeService
+	b *breaker.Breaker
+}
+
+func (bc breakingCardCharges) ChargeCard(ctx context.Context, amount money.Money, cardToken string) error {
+	var chargeErr error
+	if err := bc.b.Do(ctx, func(ctx context.Context) error {
+		chargeErr = bc.c.ChargeCard(ctx, amount, cardToken)
+		return gatewayFailure(chargeErr)
+	}); err != nil {
+		return err
+	}
+	return chargeErr
+}
+
+// gatewayFailure leaves out declined cards: the gateway answered, the card is what failed.
+func gatewayFailure(err error) error {
+	if payment.IsDecline(err) {
+		return nil
+	}
+	return err
+}
+
+// BreakingCardGateway is BreakingCardCharges for the completion saga.
+func BreakingCardGateway(g CardGateway, b *breaker.Breaker) CardGateway {
+	return breakingCardGateway{g: g, b: b}
+}
+
+type breakingCardGateway struct {
+	g CardGateway
+	b *breaker.Breaker
+}
+
+func (bg breakingCardGateway) Charge(ctx context.Context, amount money.Money, cardToken string) (string, error) {
+	var (
+		chargeID  string
+		chargeErr error
+	)
+	if err := bg.b.Do(ctx, func(ctx context.Context) error {
+		chargeID, chargeErr = bg.g.Charge(ctx, amount, cardToken)
+		return gatewayFailure(chargeErr)
+	}); err != nil {
+		return "", err
+	}
+	return chargeID, chargeErr
+}
+
+func (bg breakingCardGateway) Refund(ctx context.Context, chargeID string) error {
+	return bg.b.Do(ctx, func(ctx context.Context) error {
+		return bg.g.Refund(ctx, chargeID)
+	})
+}
+
+// BreakingStoreService calls s through b. Once b is open, purchases are completed without the store's
+// discount rather than not at all.
+func BreakingStoreService(s StoreService, b *breaker.Breaker) StoreService {
+	return breakingStoreService{s: s, b: b}
+}
+
+type breakingStoreService struct {
+	s StoreService
+	b *breaker.Breaker
+}
+
+func (bs breakingStoreService) GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID) (float32, error) {
+	var (
+		discount  float32
+		lookupErr error
+	)
+	if err := bs.b.Do(ctx, func(ctx context.Context) error {
+		discount, lookupErr = bs.s.GetStoreSpecificDiscount(ctx, storeID)
+		if errors.Is(lookupErr, store.ErrNoDiscount) {
+			return nil
+		}
+		return lookupErr
+	}); err != nil {
+		return 0, err
+	}
+	return discount, lookupErr
+}
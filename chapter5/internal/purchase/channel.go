@@ -0,0 +1,83 @@
+package purchase
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/payment"
+)
+
+// Channel is how a purchase was ordered, e.g. at a till in the store, in the app or through a marketplace.
+type Channel string
+
+const (
+	ChannelInStore Channel = "in_store"
+	ChannelApp     Channel = "app"
+	ChannelWeb     Channel = "web"
+	// ChannelDelivery is a delivery ordered without saying through which channel, e.g. by phone.
+	ChannelDelivery    Channel = "delivery"
+	ChannelMarketplace Channel = "marketplace"
+)
+
+// Channels are every channel there is.
+var Channels = []Channel{ChannelInStore, ChannelApp, ChannelWeb, ChannelDelivery, ChannelMarketplace}
+
+// ParseChannel makes Channel a value object: it is one of Channels, or ErrUnknownChannel.
+func ParseChannel(s string) (Channel, error) {
+	if c := Channel(s); slices.Contains(Channels, c) {
+		return c, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownChannel, s)
+}
+
+// inferChannel tells the channel of a purchase that was not given one: marketplace orders are paid by the
+// marketplace, deliveries have an address, and anything else was rung up in the store.
+func (p *Purchase) inferChannel() {
+	switch {
+	case p.Channel != "":
+	case p.PaymentMeans == payment.MEANS_MARKETPLACE:
+		p.Channel = ChannelMarketplace
+	case p.Delivery != nil:
+		p.Channel = ChannelDelivery
+	default:
+		p.Channel = ChannelInStore
+	}
+}
+
+// ChannelFees are what ordering through a channel costs on top of the products, per channel and currency
+// in its minor unit, e.g. {"app": {"USD": 25}}. Channels and currencies they do not list cost nothing.
+type ChannelFees map[Channel]map[string]int64
+
+// WithChannelFees charges the fee of their channel on purchases, on a line of its own owed to the store.
+// Without it no channel costs anything.
+func WithChannelFees(fees ChannelFees) Option {
+	return func(s *Service) {
+		s.channelFees = fees
+	}
+}
+
+// chargeChannelFee adds the fee of the purchase's channel to its charges, once.
+func (p *Purchase) chargeChannelFee(fees ChannelFees) {
+	if len(p.ProductsToPurchase) == 0 || slices.ContainsFunc(p.Charges, func(c Charge) bool { return c.Type == ChargeChannelFee }) {
+		return
+	}
+	currency := p.ProductsToPurchase[0].BasePrice.Currency().Code
+	if fee := fees[p.Channel][currency]; fee > 0 {
+		p.Charges = append(p.Charges, Charge{Type: ChargeChannelFee, Payee: PayeeStore, Amount: *money.New(fee, currency)})
+	}
+}
+
+// WithStampChannels has only purchases ordered through channels earn loyalty stamps, e.g. not marketplace
+// orders, whose customers the marketplace keeps. Without it purchases of every channel earn them.
+func WithStampChannels(channels ...Channel) Option {
+	return func(s *Service) {
+		s.stampChannels = channels
+	}
+}
+
+// earnsStamp tells whether the purchase earns its loyalty card a stamp.
+func (s *Service) earnsStamp(p *Purchase) bool {
+	return s.stampChannels == nil || slices.Contains(s.stampChannels, p.Channel)
+}
@@ -0,0 +1,108 @@
+package purchase
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/validation"
+)
+
+var (
+	ErrUnknownChargeType = errors.New("unknown charge type")
+	ErrUnknownPayee      = errors.New("unknown payee")
+)
+
+// ChargeType is what a charge that is not a product pays for.
+type ChargeType string
+
+const (
+	ChargeDeliveryFee ChargeType = "delivery_fee"
+	ChargeServiceFee  ChargeType = "service_fee"
+	ChargeCourierTip  ChargeType = "courier_tip"
+	// ChargeChannelFee is what ordering through a channel costs, see WithChannelFees.
+	ChargeChannelFee ChargeType = "channel_fee"
+)
+
+// Payee is who a charge is owed to once the purchase is settled.
+type Payee string
+
+const (
+	PayeeStore       Payee = "store"
+	PayeeMarketplace Payee = "marketplace"
+	PayeeCourier     Payee = "courier"
+)
+
+// Charge is what the customer paid besides the products, e.g. the service fee of a marketplace or the tip
+// of its courier. It is part of the total, but owed to its payee, who need not be the store.
+type Charge struct {
+	Type   ChargeType
+	Payee  Payee
+	Amount money.Money
+}
+
+// Validate makes Charge a value object: a known type, owed to a known payee, for more than nothing.
+func (c Charge) Validate() error {
+	var v validation.Validator
+	switch c.Type {
+	case ChargeDeliveryFee, ChargeServiceFee, ChargeCourierTip, ChargeChannelFee:
+	default:
+		v.AddErr("type", ErrUnknownChargeType)
+	}
+	switch c.Payee {
+	case PayeeStore, PayeeMarketplace, PayeeCourier:
+	default:
+		v.AddErr("payee", ErrUnknownPayee)
+	}
+	v.Check(c.Amount.IsPositive(), "amount", "must be positive")
+	return v.Err()
+}
+
+// validateCharges checks every charge, in the currency of the products.
+func (p *Purchase) validateCharges(v *validation.Validator) {
+	if len(p.ProductsToPurchase) == 0 {
+		return
+	}
+	currency := p.ProductsToPurchase[0].BasePrice.Currency().Code
+	for i, c := range p.Charges {
+		field := validation.Index("charges", i)
+		v.Merge(field, c.Validate())
+		if c.Amount.Currency().Code != currency {
+			v.AddErr(validation.Join(field, "amount"), ErrMixedCurrencies)
+		}
+	}
+}
+
+// addCharges adds the charges to the total, after any discount, which only ever applies to products.
+func (p *Purchase) addCharges() error {
+	for _, c := range p.Charges {
+		total, err := p.total.Add(&c.Amount)
+		if err != nil {
+			return fmt.Errorf("%s is not in the currency of the purchase: %w", c.Type, err)
+		}
+		p.total = *total
+	}
+	return nil
+}
+
+// Settlement is what each payee is owed of the total: the charges to the payees they are owed to, and the
+// rest to the store.
+func (p *Purchase) Settlement() map[Payee]money.Money {
+	owed := map[Payee]money.Money{PayeeStore: p.total}
+	for _, c := range p.Charges {
+		if c.Payee == PayeeStore {
+			continue
+		}
+		store := owed[PayeeStore]
+		rest, _ := store.Subtract(&c.Amount)
+		owed[PayeeStore] = *rest
+		sum := c.Amount
+		if prev, ok := owed[c.Payee]; ok {
+			added, _ := prev.Add(&c.Amount)
+			sum = *added
+		}
+		owed[c.Payee] = sum
+	}
+	return owed
+}
@@ -0,0 +1,155 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/command"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/telemetry"
+)
+
+var ErrRefundStoreMismatch = errors.New("purchase was made at another store")
+
+// CompletePurchaseCommand asks for Purchase to be completed at StoreID, see Service.CompletePurchase.
+type CompletePurchaseCommand struct {
+	StoreID  uuid.UUID
+	Purchase *Purchase
+	Card     *loyalty.CoffeeBux // 可选, 盖章或用免费饮品付款
+}
+
+func (CompletePurchaseCommand) CommandName() string { return "purchase.complete" }
+
+func (c CompletePurchaseCommand) Validate() error {
+	return c.Purchase.Validate()
+}
+
+// Authorize lets p buy at the store, for the customer of the purchase and of the card.
+func (c CompletePurchaseCommand) Authorize(p auth.Principal) error {
+	if err := auth.Authorize(p, auth.ActionCreatePurchase, auth.Resource{StoreID: c.StoreID, CustomerID: c.Purchase.CustomerID}); err != nil {
+		return err
+	}
+	if c.Card == nil {
+		return nil
+	}
+	return auth.Authorize(p, auth.ActionCreatePurchase, auth.Resource{StoreID: c.StoreID, CustomerID: c.Card.CustomerID()})
+}
+
+// RefundCommand asks for Amount of a purchase paid from a wallet to be credited back to it, see
+// Service.Refund.
+type RefundCommand struct {
+	// StoreID is where the purchase was made; the refund fails if it was made elsewhere.
+	StoreID    uuid.UUID
+	PurchaseID uuid.UUID
+	Amount     money.Money
+}
+
+func (RefundCommand) CommandName() string { return "purchase.refund" }
+
+func (c RefundCommand) Validate() error {
+	if c.Amount.Currency() == nil || !c.Amount.IsPositive() {
+		return fmt.Errorf("%w: refunds must be of more than 0", ErrInvalidRefund)
+	}
+	return nil
+}
+
+// Authorize lets managers of the store refund its purchases.
+func (c RefundCommand) Authorize(p auth.Principal) error {
+	return auth.Authorize(p, auth.ActionRefundWallet, auth.Resource{StoreID: c.StoreID})
+}
+
+// ImportPurchaseCommand asks for a purchase made elsewhere to be recorded as it was, see
+// Service.ImportPurchase.
+type ImportPurchaseCommand struct {
+	ID          uuid.UUID
+	PurchasedAt time.Time
+	Purchase    *Purchase
+}
+
+func (ImportPurchaseCommand) CommandName() string { return "purchase.import" }
+
+func (c ImportPurchaseCommand) Validate() error {
+	// A copy is checked, as checking a purchase for import fills in its ID, time and total.
+	p := *c.Purchase
+	return p.validateForImport(c.ID, c.PurchasedAt)
+}
+
+// RegisterCommands registers the Service's handlers of CompletePurchaseCommand, RefundCommand and
+// ImportPurchaseCommand on b.
+func (s *Service) RegisterCommands(b *command.Bus) {
+	command.Handle(b, func(ctx context.Context, c CompletePurchaseCommand) error {
+		return s.CompletePurchase(ctx, c.StoreID, c.Purchase, c.Card)
+	})
+	command.Handle(b, func(ctx context.Context, c RefundCommand) error {
+		return s.Refund(ctx, c.StoreID, c.PurchaseID, c.Amount)
+	})
+	command.Handle(b, func(ctx context.Context, c ImportPurchaseCommand) error {
+		return s.ImportPurchase(ctx, c.ID, c.PurchasedAt, c.Purchase)
+	})
+}
+
+// Dispatcher is a Service whose purchases and refunds are dispatched as commands through a Bus, so the
+// bus's middleware applies to them. Transports take it in place of the Service.
+type Dispatcher struct {
+	*Service
+	bus *command.Bus
+}
+
+// NewDispatcher registers the commands of s on b.
+func NewDispatcher(s *Service, b *command.Bus) Dispatcher {
+	s.RegisterCommands(b)
+	return Dispatcher{Service: s, bus: b}
+}
+
+func (d Dispatcher) CompletePurchase(ctx context.Context, storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) error {
+	return d.bus.Dispatch(ctx, CompletePurchaseCommand{StoreID: storeID, Purchase: purchase, Card: coffeeBuxCard})
+}
+
+func (d Dispatcher) Refund(ctx context.Context, storeID, purchaseID uuid.UUID, amount money.Money) error {
+	return d.bus.Dispatch(ctx, RefundCommand{StoreID: storeID, PurchaseID: purchaseID, Amount: amount})
+}
+
+// Refund credits amount of a purchase made at storeID from a wallet back to the wallet, up to what the
+// wallet paid for it, and records it in the audit log.
+func (s *Service) Refund(ctx context.Context, storeID, purchaseID uuid.UUID, amount money.Money) (err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.Refund", attribute.String("purchase.id", purchaseID.String()))
+	defer telemetry.End(span, &err)
+	p, err := s.purchaseRepo.Get(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	if p.Store.ID != storeID {
+		return ErrRefundStoreMismatch
+	}
+	if err := p.Refundable(); err != nil {
+		return err
+	}
+	if _, err := s.wallet.Refund(ctx, p.CustomerID, purchaseID, amount); err != nil {
+		return fmt.Errorf("failed to refund to wallet: %w", err)
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionRefund, "purchase", purchaseID.String(), "paid "+p.total.Display(), "refunded "+amount.Display())
+		if err := s.audit.Record(ctx, e); err != nil {
+			s.logger.ErrorContext(ctx, "refund not recorded in the audit log", "purchase", &p, "error", err)
+		}
+	}
+	return nil
+}
+
+// Refundable tells why the purchase cannot be given back by Refund, or nil if it can: for now only what
+// was paid from a wallet can be.
+func (p *Purchase) Refundable() error {
+	if p.PaymentMeans != payment.MEANS_WALLET {
+		return ErrWalletUnavailable
+	}
+	return nil
+}
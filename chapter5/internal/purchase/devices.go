@@ -0,0 +1,49 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/validation"
+)
+
+// ErrNoDevice means a purchase rung up in the store did not say which registered POS terminal it was made
+// on.
+var ErrNoDevice = errors.New("purchases in store must be made on a registered device")
+
+// Devices tells why a purchase at a store cannot be made on a POS terminal, if it cannot, e.g.
+// device.Service.
+type Devices interface {
+	Check(ctx context.Context, storeID, deviceID uuid.UUID) error
+}
+
+// WithDevices only takes purchases rung up in the store on a terminal registered there and not revoked.
+// Purchases of other channels need not name a terminal, but are checked if they do. Without it purchases
+// may come from anywhere.
+func WithDevices(d Devices) Option {
+	return func(s *Service) {
+		s.devices = d
+	}
+}
+
+// checkDevice turns away a purchase made on a terminal that is not registered at the store or was revoked.
+// Unlike the other checks it does not let the purchase through when the terminal cannot be read, as a
+// revoked terminal must not sell anything.
+func (s *Service) checkDevice(ctx context.Context, storeID uuid.UUID, p *Purchase) error {
+	if s.devices == nil {
+		return nil
+	}
+	if p.DeviceID == uuid.Nil {
+		if p.Channel == ChannelInStore {
+			return validation.Errors{{Field: "deviceId", Message: ErrNoDevice.Error(), Err: ErrNoDevice}}
+		}
+		return nil
+	}
+	if err := s.devices.Check(ctx, storeID, p.DeviceID); err != nil {
+		s.logger.WarnContext(ctx, "purchase turned away from its device", "purchase", p, "device", p.DeviceID, "error", err)
+		return err
+	}
+	return nil
+}
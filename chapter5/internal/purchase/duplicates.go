@@ -0,0 +1,118 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/validation"
+)
+
+// ErrPossibleDuplicate means the same card or customer just bought the same items at the same store,
+// likely by tapping twice. The purchase goes through once it is sent again with ConfirmDuplicate.
+var ErrPossibleDuplicate = errors.New("an identical purchase was just made; confirm to buy it again")
+
+// WithDuplicateCheck turns away a purchase identical to one paid with the same card, or by the same
+// customer, at the same store within window, until the customer confirms it. recent is usually the
+// purchase repository itself. Without it purchases are only deduplicated by their idempotency keys.
+func WithDuplicateCheck(recent Finder, window time.Duration) Option {
+	return func(s *Service) {
+		s.recent, s.duplicateWindow = recent, window
+		s.attempts = &attempts{inFlight: map[uuid.UUID]*Purchase{}}
+	}
+}
+
+// attempts are the purchases being made right now. A purchase is only found among the recent ones once it
+// is stored, after its card was charged, so a second tap while the first is still being charged is caught
+// here instead. They are per process: taps sent to two instances at once are only caught by the recent ones.
+type attempts struct {
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]*Purchase
+}
+
+// reserve records p as being made, unless it duplicates another purchase being made, which it returns.
+func (a *attempts) reserve(p *Purchase) *Purchase {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, other := range a.inFlight {
+		if id != p.ID && p.duplicates(other) {
+			return other
+		}
+	}
+	a.inFlight[p.ID] = p
+	return nil
+}
+
+// forgetAttempt is called once a purchase checked for duplicates was stored or failed: from then on the
+// recent purchases tell whether it was made.
+func (s *Service) forgetAttempt(p *Purchase) {
+	if s.attempts == nil {
+		return
+	}
+	s.attempts.mu.Lock()
+	defer s.attempts.mu.Unlock()
+	if s.attempts.inFlight[p.ID] == p {
+		delete(s.attempts.inFlight, p.ID)
+	}
+}
+
+// checkDuplicate turns away a purchase that looks like one just made, unless the customer confirmed it.
+// Anonymous purchases not paid by card cannot be told apart, so they are never checked. A check that
+// cannot be made lets the purchase through. A purchase let through is recorded as being made until
+// forgetAttempt, so the caller must call it once the purchase is stored or has failed.
+func (s *Service) checkDuplicate(ctx context.Context, storeID uuid.UUID, p *Purchase) error {
+	if s.recent == nil || p.ConfirmDuplicate || (p.CustomerID == uuid.Nil && p.CardToken == nil) {
+		return nil
+	}
+	spec := ByStore(storeID).And(Between(p.timeOfPurchase.Add(-s.duplicateWindow), time.Time{}))
+	if p.CustomerID != uuid.Nil {
+		spec = spec.And(ByCustomer(p.CustomerID))
+	}
+	recent, err := s.recent.Find(ctx, spec)
+	if err != nil {
+		s.logger.WarnContext(ctx, "recent purchases could not be read, only checking purchases being made", "purchase", p, "error", err)
+	}
+	for i := len(recent) - 1; i >= 0; i-- {
+		if earlier := recent[i]; p.duplicates(&earlier) {
+			ago := p.timeOfPurchase.Sub(earlier.timeOfPurchase).Round(time.Second)
+			msg := fmt.Sprintf("purchase %s of the same items was made %s ago; set it to buy them again", earlier.ID, ago)
+			return validation.Errors{{Field: "confirmDuplicate", Message: msg, Err: ErrPossibleDuplicate}}
+		}
+	}
+	if other := s.attempts.reserve(p); other != nil {
+		msg := fmt.Sprintf("purchase %s of the same items is being made; set it to buy them again", other.ID)
+		return validation.Errors{{Field: "confirmDuplicate", Message: msg, Err: ErrPossibleDuplicate}}
+	}
+	return nil
+}
+
+// duplicates tells whether p buys the same items as earlier, paid by the same means, card and customer.
+func (p *Purchase) duplicates(earlier *Purchase) bool {
+	if p.PaymentMeans != earlier.PaymentMeans || p.CustomerID != earlier.CustomerID {
+		return false
+	}
+	if (p.CardToken == nil) != (earlier.CardToken == nil) || p.CardToken != nil && *p.CardToken != *earlier.CardToken {
+		return false
+	}
+	return slices.Equal(p.items(), earlier.items())
+}
+
+// items are the products bought, by name, size and modifiers, sorted, leaving out the delivery fee.
+func (p *Purchase) items() []string {
+	items := make([]string, 0, len(p.ProductsToPurchase))
+	for _, v := range p.ProductsToPurchase {
+		if v.ItemName == DeliveryFeeItem {
+			continue
+		}
+		modifiers := slices.Sorted(slices.Values(v.Modifiers))
+		items = append(items, v.ItemName+"|"+v.Size+"|"+strings.Join(modifiers, ","))
+	}
+	slices.Sort(items)
+	return items
+}
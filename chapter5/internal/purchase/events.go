@@ -0,0 +1,234 @@
+package purchase
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const (
+	EventTypeCompleted     = "purchase.completed"
+	EventTypeStatusChanged = "purchase.status_changed"
+)
+
+// Completed is published once a purchase has been paid for and stored.
+type Completed struct {
+	PurchaseID   uuid.UUID       `json:"purchase_id" avro:"purchase_id"`
+	StoreID      uuid.UUID       `json:"store_id" avro:"store_id"`
+	CustomerID   uuid.UUID       `json:"customer_id" avro:"customer_id"`
+	Lines        []CompletedLine `json:"lines" avro:"lines"`
+	Total        int64           `json:"total" avro:"total"`
+	Currency     string          `json:"currency" avro:"currency"`
+	PaymentMeans string          `json:"payment_means" avro:"payment_means"`
+	PurchasedAt  time.Time       `json:"purchased_at" avro:"purchased_at"`
+	// DeliveryAddress and DeliveryPhone are empty for purchases collected at the store.
+	DeliveryAddress string `json:"delivery_address,omitempty" avro:"delivery_address"`
+	DeliveryPhone   string `json:"delivery_phone,omitempty" avro:"delivery_phone"`
+	// ServedBy is the barista who took the purchase, if it was taken at a till.
+	ServedBy string `json:"served_by,omitempty" avro:"served_by"`
+	// TabID is the tab the purchase settles, or uuid.Nil.
+	TabID uuid.UUID `json:"tab_id,omitzero" avro:"tab_id"`
+	// ReceiptCode is the short code printed on the receipt, if it has one.
+	ReceiptCode string `json:"receipt_code,omitempty" avro:"receipt_code"`
+	// Charges are what was paid besides the lines, and who it is owed to. They are part of Total.
+	Charges []CompletedCharge `json:"charges,omitempty" avro:"charges"`
+	// Rounding is what rounding a cash total added to it, negative if it took some off. It is part of Total.
+	Rounding int64 `json:"rounding,omitempty" avro:"rounding"`
+	// Channel is how the purchase was ordered, e.g. in_store or marketplace.
+	Channel string `json:"channel,omitempty" avro:"channel"`
+	// Overrides are the prices managers overrode, already taken off the lines and Total.
+	Overrides []CompletedOverride `json:"overrides,omitempty" avro:"overrides"`
+	// Experiment and Variant are the discount experiment the customer was priced in and their variant of
+	// it, empty if they were in none.
+	Experiment string `json:"experiment,omitempty" avro:"experiment"`
+	Variant    string `json:"variant,omitempty" avro:"variant"`
+	// PickupAt is when the customer scheduled to collect the purchase in the app, zero if they did not. It
+	// is made once they are close, or in time for the pickup if they never say so.
+	PickupAt time.Time `json:"pickup_at,omitzero" avro:"pickup_at"`
+	// DeviceID is the POS terminal the purchase was rung up on, or uuid.Nil.
+	DeviceID uuid.UUID `json:"device_id,omitzero" avro:"device_id"`
+}
+
+type CompletedLine struct {
+	ItemName string `json:"item_name" avro:"item_name"`
+	Amount   int64  `json:"amount" avro:"amount"`
+	// ReusableCup is a drink served in the customer's own cup.
+	ReusableCup bool `json:"reusable_cup,omitempty" avro:"reusable_cup"`
+}
+
+// CompletedOverride is a price overridden by a manager. Product is the index of the line, or -1 for the
+// whole purchase.
+type CompletedOverride struct {
+	Product int    `json:"product" avro:"product"`
+	Price   int64  `json:"price" avro:"price"`
+	Was     int64  `json:"was" avro:"was"`
+	Reason  string `json:"reason" avro:"reason"`
+	Note    string `json:"note,omitempty" avro:"note"`
+	By      string `json:"by" avro:"by"`
+}
+
+type CompletedCharge struct {
+	Type   string `json:"type" avro:"type"`
+	Payee  string `json:"payee" avro:"payee"`
+	Amount int64  `json:"amount" avro:"amount"`
+}
+
+func (c Completed) EventType() string {
+	return EventTypeCompleted
+}
+
+func (c Completed) AggregateID() uuid.UUID {
+	return c.PurchaseID
+}
+
+// EventID is derived from the purchase, as a purchase only ever completes once.
+func (c Completed) EventID() uuid.UUID {
+	return uuid.NewSHA1(c.PurchaseID, []byte(EventTypeCompleted))
+}
+
+// Status is where a purchase is on its way from the till to the customer.
+type Status string
+
+const (
+	StatusAccepted  Status = "accepted"
+	StatusPreparing Status = "preparing"
+	StatusReady     Status = "ready"
+)
+
+// StatusChanged is published every time a purchase moves to a new Status, so the customer can follow it.
+type StatusChanged struct {
+	PurchaseID uuid.UUID `json:"purchase_id"`
+	StoreID    uuid.UUID `json:"store_id"`
+	CustomerID uuid.UUID `json:"customer_id"`
+	Status     Status    `json:"status"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func (s StatusChanged) EventType() string {
+	return EventTypeStatusChanged
+}
+
+func (s StatusChanged) AggregateID() uuid.UUID {
+	return s.PurchaseID
+}
+
+// EventID is derived from the purchase and status, as a purchase reaches each status only once.
+func (s StatusChanged) EventID() uuid.UUID {
+	return uuid.NewSHA1(s.PurchaseID, []byte(EventTypeStatusChanged+"."+string(s.Status)))
+}
+
+// RegisterEvents adds decoders for every version of the purchase events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeCompleted, 1, events.JSONDecoder[Completed]())
+	r.Register(EventTypeStatusChanged, 1, events.JSONDecoder[StatusChanged]())
+}
+
+// CompletedAvroSchema is the Avro schema for Completed, for use with kafka.NewAvroCodec.
+const CompletedAvroSchema = `{
+	"type": "record",
+	"name": "PurchaseCompleted",
+	"namespace": "coffeeco.purchase",
+	"fields": [
+		{"name": "purchase_id", "type": {"type": "fixed", "name": "uuid", "size": 16}},
+		{"name": "store_id", "type": "uuid"},
+		{"name": "customer_id", "type": "uuid"},
+		{"name": "lines", "type": {"type": "array", "items": {
+			"type": "record",
+			"name": "CompletedLine",
+			"fields": [
+				{"name": "item_name", "type": "string"},
+				{"name": "amount", "type": "long"},
+				{"name": "reusable_cup", "type": "boolean", "default": false}
+			]
+		}}},
+		{"name": "total", "type": "long"},
+		{"name": "currency", "type": "string"},
+		{"name": "payment_means", "type": "string"},
+		{"name": "purchased_at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+		{"name": "delivery_address", "type": "string", "default": ""},
+		{"name": "delivery_phone", "type": "string", "default": ""},
+		{"name": "served_by", "type": "string", "default": ""},
+		{"name": "tab_id", "type": "uuid", "default": "\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000"},
+		{"name": "charges", "type": {"type": "array", "items": {
+			"type": "record",
+			"name": "CompletedCharge",
+			"fields": [
+				{"name": "type", "type": "string"},
+				{"name": "payee", "type": "string"},
+				{"name": "amount", "type": "long"}
+			]
+		}}, "default": []},
+		{"name": "rounding", "type": "long", "default": 0},
+		{"name": "channel", "type": "string", "default": ""},
+		{"name": "overrides", "type": {"type": "array", "items": {
+			"type": "record",
+			"name": "CompletedOverride",
+			"fields": [
+				{"name": "product", "type": "int"},
+				{"name": "price", "type": "long"},
+				{"name": "was", "type": "long"},
+				{"name": "reason", "type": "string"},
+				{"name": "note", "type": "string", "default": ""},
+				{"name": "by", "type": "string"}
+			]
+		}}, "default": []},
+		{"name": "experiment", "type": "string", "default": ""},
+		{"name": "variant", "type": "string", "default": ""},
+		{"name": "pickup_at", "type": {"type": "long", "logicalType": "timestamp-millis"}, "default": 0},
+		{"name": "device_id", "type": "uuid", "default": "\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000\u0000"},
+		{"name": "receipt_code", "type": "string", "default": ""}
+	]
+}`
+
+// completed records that the purchase was completed at at, once it is stored.
+func (p *Purchase) completed(at time.Time) {
+	p.RecordEvent(p.completedEvent(), p.statusChanged(StatusAccepted, at))
+}
+
+func (p *Purchase) completedEvent() Completed {
+	lines := make([]CompletedLine, 0, len(p.ProductsToPurchase))
+	for _, v := range p.ProductsToPurchase {
+		lines = append(lines, CompletedLine{ItemName: v.ItemName, Amount: v.BasePrice.Amount(), ReusableCup: v.ReusableCup})
+	}
+	c := Completed{
+		PurchaseID:   p.ID,
+		StoreID:      p.Store.ID,
+		CustomerID:   p.CustomerID,
+		Lines:        lines,
+		Total:        p.total.Amount(),
+		Currency:     p.total.Currency().Code,
+		PaymentMeans: string(p.PaymentMeans),
+		PurchasedAt:  p.timeOfPurchase,
+		ServedBy:     p.ServedBy,
+		TabID:        p.TabID,
+		ReceiptCode:  p.ReceiptCode,
+		Rounding:     p.rounding,
+		Channel:      string(p.Channel),
+		Experiment:   p.Experiment.Experiment,
+		Variant:      p.Experiment.Variant,
+		PickupAt:     p.PickupAt,
+		DeviceID:     p.DeviceID,
+	}
+	if p.Delivery != nil {
+		c.DeliveryAddress, c.DeliveryPhone = p.Delivery.Address, p.Delivery.Phone
+	}
+	for _, ch := range p.Charges {
+		c.Charges = append(c.Charges, CompletedCharge{Type: string(ch.Type), Payee: string(ch.Payee), Amount: ch.Amount.Amount()})
+	}
+	for _, o := range p.Overrides {
+		c.Overrides = append(c.Overrides, CompletedOverride{Product: o.Product, Price: o.Price.Amount(), Was: o.Was.Amount(), Reason: string(o.Reason), Note: o.Note, By: o.By})
+	}
+	return c
+}
+
+func (p *Purchase) statusChanged(status Status, at time.Time) StatusChanged {
+	return StatusChanged{
+		PurchaseID: p.ID,
+		StoreID:    p.Store.ID,
+		CustomerID: p.CustomerID,
+		Status:     status,
+		ChangedAt:  at.UTC(),
+	}
+}
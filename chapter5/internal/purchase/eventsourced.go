@@ -0,0 +1,209 @@
+package purchase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/telemetry"
+)
+
+const (
+	// completedSchemaVersion is the current shape of the Completed payload in the event store.
+	completedSchemaVersion = 1
+	defaultSnapshotEvery   = 10
+)
+
+// EventSourcedRepository persists purchases as a stream of events rather than a document, so a purchase's
+// full history is kept and its current state is derived by replaying it.
+type EventSourcedRepository struct {
+	store         eventstore.Store
+	upcasters     *eventstore.Upcasters
+	snapshotEvery int
+}
+
+// NewEventSourcedRepo takes a snapshot every snapshotEvery events; 0 uses the default.
+func NewEventSourcedRepo(store eventstore.Store, upcasters *eventstore.Upcasters, snapshotEvery int) (*EventSourcedRepository, error) {
+	if store == nil {
+		return nil, errors.New("event store cannot be nil")
+	}
+	if upcasters == nil {
+		upcasters = eventstore.NewUpcasters()
+	}
+	if snapshotEvery <= 0 {
+		snapshotEvery = defaultSnapshotEvery
+	}
+	return &EventSourcedRepository{store: store, upcasters: upcasters, snapshotEvery: snapshotEvery}, nil
+}
+
+func (r *EventSourcedRepository) Store(ctx context.Context, purchase *Purchase) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.EventSourcedRepository.Store", attribute.String("purchase.id", purchase.ID.String()))
+	defer telemetry.End(span, &err)
+	data, err := json.Marshal(purchase.completedEvent())
+	if err != nil {
+		return fmt.Errorf("failed to encode purchase: %w", err)
+	}
+	records := []eventstore.Record{{
+		Type:          EventTypeCompleted,
+		SchemaVersion: completedSchemaVersion,
+		Data:          data,
+		CorrelationID: purchase.correlationID,
+	}}
+	if ids, ok := correlation.FromContext(ctx); ok {
+		records[0].CausationID = ids.CausationID
+	}
+	if err := r.store.Append(ctx, purchase.ID, purchase.Version(), records); err != nil {
+		return fmt.Errorf("failed to persist purchase: %w", err)
+	}
+	purchase.SetVersion(purchase.Version() + len(records))
+	return r.maybeSnapshot(ctx, purchase, purchase.Version())
+}
+
+// Load rehydrates a purchase from its latest snapshot plus any events recorded after it.
+func (r *EventSourcedRepository) Load(ctx context.Context, id uuid.UUID) (_ Purchase, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.EventSourcedRepository.Load", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	var (
+		p       Purchase
+		version int
+	)
+	snap, err := r.store.LatestSnapshot(ctx, id)
+	switch {
+	case err == nil:
+		var s purchaseSnapshot
+		if err := json.Unmarshal(snap.Data, &s); err != nil {
+			return Purchase{}, fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		p = s.toPurchase()
+		version = snap.Version
+	case errors.Is(err, eventstore.ErrNoSnapshot):
+	default:
+		return Purchase{}, err
+	}
+
+	records, err := r.store.Load(ctx, id, version)
+	if err != nil {
+		return Purchase{}, err
+	}
+	if version == 0 && len(records) == 0 {
+		return Purchase{}, eventstore.ErrAggregateNotFound
+	}
+	for _, rec := range records {
+		rec, err := r.upcasters.Upcast(rec)
+		if err != nil {
+			return Purchase{}, err
+		}
+		if err := p.apply(rec); err != nil {
+			return Purchase{}, err
+		}
+	}
+	p.SetVersion(version + len(records))
+	return p, nil
+}
+
+func (r *EventSourcedRepository) Get(ctx context.Context, id uuid.UUID) (Purchase, error) {
+	p, err := r.Load(ctx, id)
+	if errors.Is(err, eventstore.ErrAggregateNotFound) {
+		return Purchase{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (r *EventSourcedRepository) Ping(ctx context.Context) error {
+	return r.store.Ping(ctx)
+}
+
+func (r *EventSourcedRepository) maybeSnapshot(ctx context.Context, p *Purchase, version int) error {
+	if version%r.snapshotEvery != 0 {
+		return nil
+	}
+	data, err := json.Marshal(toPurchaseSnapshot(p))
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	return r.store.SaveSnapshot(ctx, eventstore.Snapshot{
+		AggregateID: p.ID,
+		Version:     version,
+		Data:        data,
+		TakenAt:     time.Now().UTC(),
+	})
+}
+
+// apply mutates the purchase to reflect a recorded event.
+func (p *Purchase) apply(rec eventstore.Record) error {
+	switch rec.Type {
+	case EventTypeCompleted:
+		var e Completed
+		if err := json.Unmarshal(rec.Data, &e); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", rec.Type, err)
+		}
+		p.applyCompleted(e)
+		p.correlationID = rec.CorrelationID
+		return nil
+	default:
+		return fmt.Errorf("unknown purchase event type %s", rec.Type)
+	}
+}
+
+func (p *Purchase) applyCompleted(e Completed) {
+	p.ID = e.PurchaseID
+	p.Store.ID = e.StoreID
+	p.CustomerID = e.CustomerID
+	p.ProductsToPurchase = make([]coffeeco.Product, 0, len(e.Lines))
+	for _, l := range e.Lines {
+		p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{
+			ItemName:    l.ItemName,
+			BasePrice:   *money.New(l.Amount, e.Currency),
+			ReusableCup: l.ReusableCup,
+		})
+	}
+	p.total = *money.New(e.Total, e.Currency)
+	p.PaymentMeans = payment.Means(e.PaymentMeans)
+	p.timeOfPurchase = e.PurchasedAt
+	p.ServedBy = e.ServedBy
+	p.TabID = e.TabID
+	p.ReceiptCode = e.ReceiptCode
+	p.rounding = e.Rounding
+	p.Channel = Channel(e.Channel)
+	p.Experiment = experiment.Assignment{Experiment: e.Experiment, Variant: e.Variant}
+	p.PickupAt = e.PickupAt
+	p.DeviceID = e.DeviceID
+	p.Charges = nil
+	for _, c := range e.Charges {
+		p.Charges = append(p.Charges, Charge{Type: ChargeType(c.Type), Payee: Payee(c.Payee), Amount: *money.New(c.Amount, e.Currency)})
+	}
+	p.Overrides = nil
+	for _, o := range e.Overrides {
+		p.Overrides = append(p.Overrides, PriceOverride{Product: o.Product, Price: *money.New(o.Price, e.Currency), Was: *money.New(o.Was, e.Currency), Reason: OverrideReason(o.Reason), Note: o.Note, By: o.By})
+	}
+	if e.DeliveryAddress != "" {
+		p.Delivery = &Delivery{Address: e.DeliveryAddress, Phone: e.DeliveryPhone}
+	}
+}
+
+type purchaseSnapshot struct {
+	Completed
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+func toPurchaseSnapshot(p *Purchase) purchaseSnapshot {
+	return purchaseSnapshot{Completed: p.completedEvent(), CorrelationID: p.correlationID}
+}
+
+func (s purchaseSnapshot) toPurchase() Purchase {
+	var p Purchase
+	p.applyCompleted(s.Completed)
+	p.correlationID = s.CorrelationID
+	return p
+}
@@ -0,0 +1,164 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/validation"
+)
+
+var (
+	ErrUnknownOverrideReason = errors.New("unknown price override reason")
+	ErrOverrideProduct       = errors.New("price override is not of a product of the purchase")
+	// ErrOverrideRaisesPrice means an override would charge more than the price it overrides. Overrides
+	// only ever lower prices.
+	ErrOverrideRaisesPrice = errors.New("price override cannot raise the price")
+)
+
+// OverrideReason is the reason code a manager gives for overriding a price.
+type OverrideReason string
+
+const (
+	// OverrideRemake is a drink made again, e.g. after it was spilled, usually for nothing.
+	OverrideRemake     OverrideReason = "remake"
+	OverrideGoodwill   OverrideReason = "goodwill"
+	OverridePriceMatch OverrideReason = "price_match"
+	OverrideStaffError OverrideReason = "staff_error"
+)
+
+// OverrideReasons are every reason code there is.
+var OverrideReasons = []OverrideReason{OverrideRemake, OverrideGoodwill, OverridePriceMatch, OverrideStaffError}
+
+// WholePurchase is the Product of a PriceOverride of every product together.
+const WholePurchase = -1
+
+// PriceOverride charges a product, or the whole purchase, less than it is priced at, as a manager decided.
+// Overrides are applied once the purchase is priced and discounted, products first.
+type PriceOverride struct {
+	// Product is the index of the product in ProductsToPurchase, or WholePurchase.
+	Product int
+	// Price is what the product, or every product together, is charged instead.
+	Price  money.Money
+	Reason OverrideReason
+	Note   string
+	// Was is the price overridden and By the manager who overrode it; both are set as it is applied.
+	Was money.Money
+	By  string
+}
+
+// Given is what the override took off the price.
+func (o PriceOverride) Given() money.Money {
+	if o.Was.Currency() == nil {
+		return money.Money{}
+	}
+	given, _ := o.Was.Subtract(&o.Price)
+	return *given
+}
+
+// validateOverrides checks every override is of a product of the purchase, in its currency, for a known
+// reason, and that the whole purchase is overridden at most once.
+func (p *Purchase) validateOverrides(v *validation.Validator) {
+	if len(p.ProductsToPurchase) == 0 {
+		return
+	}
+	currency := p.ProductsToPurchase[0].BasePrice.Currency().Code
+	whole := 0
+	for i, o := range p.Overrides {
+		field := validation.Index("overrides", i)
+		if o.Product == WholePurchase {
+			whole++
+		}
+		v.CheckErr(o.Product == WholePurchase || o.Product >= 0 && o.Product < len(p.ProductsToPurchase), validation.Join(field, "product"), ErrOverrideProduct)
+		v.CheckErr(slices.Contains(OverrideReasons, o.Reason), validation.Join(field, "reason"), ErrUnknownOverrideReason)
+		if o.Price.Currency() == nil || o.Price.Currency().Code != currency {
+			v.AddErr(validation.Join(field, "price"), ErrMixedCurrencies)
+			continue
+		}
+		v.Check(!o.Price.IsNegative(), validation.Join(field, "price"), "cannot be negative")
+	}
+	v.Check(whole <= 1, "overrides", "can override the whole purchase only once")
+}
+
+// applyOverrides charges the prices the overrides set, products first and then the whole purchase, by
+// whom they were made. The whole purchase is taken off every product in proportion to its price.
+func (p *Purchase) applyOverrides(by string) error {
+	whole := -1
+	for i := range p.Overrides {
+		o := &p.Overrides[i]
+		o.By = by
+		if o.Product == WholePurchase {
+			whole = i
+			continue
+		}
+		o.Was = p.ProductsToPurchase[o.Product].BasePrice
+		if o.Price.Amount() > o.Was.Amount() {
+			return fmt.Errorf("%w: %s is %s, not %s", ErrOverrideRaisesPrice, p.ProductsToPurchase[o.Product].ItemName, o.Was.Display(), o.Price.Display())
+		}
+		p.ProductsToPurchase[o.Product].BasePrice = o.Price
+	}
+	if whole >= 0 {
+		o := &p.Overrides[whole]
+		o.Was = p.sum()
+		if o.Price.Amount() > o.Was.Amount() {
+			return fmt.Errorf("%w: the purchase is %s, not %s", ErrOverrideRaisesPrice, o.Was.Display(), o.Price.Display())
+		}
+		p.spread(o.Price.Amount(), o.Was.Amount())
+	}
+	for _, o := range p.Overrides {
+		given := o.Given()
+		total, err := p.total.Subtract(&given)
+		if err != nil {
+			return err
+		}
+		p.total = *total
+	}
+	return nil
+}
+
+// spread charges the products total instead of was, each in proportion to its price. The cents lost to
+// rounding down go to the first products.
+func (p *Purchase) spread(total, was int64) {
+	if was == 0 {
+		return
+	}
+	currency := p.ProductsToPurchase[0].BasePrice.Currency().Code
+	left := total
+	for i := range p.ProductsToPurchase {
+		amount := p.ProductsToPurchase[i].BasePrice.Amount() * total / was
+		p.ProductsToPurchase[i].BasePrice = *money.New(amount, currency)
+		left -= amount
+	}
+	for i := 0; left > 0; i++ {
+		if p.ProductsToPurchase[i].BasePrice.IsPositive() {
+			p.ProductsToPurchase[i].BasePrice = *money.New(p.ProductsToPurchase[i].BasePrice.Amount()+1, currency)
+			left--
+		}
+	}
+}
+
+// recordOverrides records every override of a completed purchase in the audit log, if there is one. The
+// purchase is paid for by then, so an override that is not recorded is only logged.
+func (s *Service) recordOverrides(ctx context.Context, p *Purchase) {
+	if s.audit == nil {
+		return
+	}
+	for _, o := range p.Overrides {
+		subject := "the whole purchase"
+		if o.Product != WholePurchase {
+			subject = p.ProductsToPurchase[o.Product].ItemName
+		}
+		e := audit.NewEntry(audit.WithActor(ctx, o.By), audit.ActionPriceOverride, "purchase", p.ID.String(), subject+" at "+o.Was.Display(), subject+" at "+o.Price.Display())
+		e.Note = string(o.Reason)
+		if o.Note != "" {
+			e.Note += ": " + o.Note
+		}
+		if err := s.audit.Record(ctx, e); err != nil {
+			s.logger.ErrorContext(ctx, "price override not recorded in the audit log", "purchase", p, "reason", o.Reason, "error", err)
+		}
+	}
+}
@@ -4,49 +4,303 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Rhymond/go-money"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 
 	coffeeco "coffeeco/internal" // 利用go的重命名能力, 把internal重命名为一个"named"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/breaker"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/events"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/feature"
 	"coffeeco/internal/loyalty"
+	"coffeeco/internal/moneyfmt"
 	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/sandbox"
 	"coffeeco/internal/store"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/validation"
+	"coffeeco/internal/wallet"
 )
 
+var (
+	ErrNotFound            = errors.New("purchase not found")
+	ErrNoProducts          = errors.New("purchase must consist of at least one product")
+	ErrZeroTotal           = errors.New("likely mistake; purchase should never be 0. Please validate")
+	ErrUnknownPaymentMeans = errors.New("unknown payment type")
+	ErrUnknownChannel      = errors.New("unknown order channel")
+	ErrCardChargeFailed    = errors.New("card charge failed, cancelling purchase")
+	// ErrCardPaymentsUnavailable means the card gateway is down; the customer can still pay another way.
+	ErrCardPaymentsUnavailable = errors.New("card payments are unavailable, please pay another way")
+	ErrInvalidStatus           = errors.New("purchase can only be moved to preparing or ready")
+	ErrNoPublisher             = errors.New("status changes need an event publisher")
+	ErrMissingID               = errors.New("imported purchases must keep their original ID")
+	ErrInvalidPurchaseTime     = errors.New("imported purchases must have been made in the past")
+	ErrMixedCurrencies         = errors.New("all products of a purchase must be in the same currency")
+	ErrMissingCardToken        = errors.New("card payments need a card token")
+	ErrInvalidRefund           = errors.New("invalid refund")
+	ErrAlreadyImported         = errors.New("purchase has already been imported")
+	ErrNoDelivery              = errors.New("purchases cannot be delivered")
+	ErrDeliveryNotPayable      = errors.New("delivery fees cannot be paid with coffeebux")
+	ErrChargesNotPayable       = errors.New("charges cannot be paid with coffeebux")
+	// ErrMeansNotTaken means the store stopped taking the payment means for a while, e.g. while its card
+	// reader is broken. The violation tells the means it takes instead.
+	ErrMeansNotTaken = errors.New("the store does not take this payment means right now")
+	// ErrWalletUnavailable means the customer cannot pay from a wallet, because the purchase is anonymous or
+	// wallet payments are not on for them.
+	ErrWalletUnavailable = errors.New("wallet payments are not available for this purchase")
+	// ErrPickupNotInApp means a pickup was scheduled for a purchase not ordered in the app, or to be
+	// delivered; only the app can tell the store the customer is close.
+	ErrPickupNotInApp = errors.New("only purchases ordered in the app for collection can be scheduled")
+	ErrPickupInPast   = errors.New("pickup must be in the future")
+	ErrPickupTooFar   = errors.New("pickup must be within a day of ordering")
+)
+
+// MaxPickupAhead is how far ahead a pickup can be scheduled.
+const MaxPickupAhead = 24 * time.Hour
+
+// DeliveryFeeItem is the name of the line a delivery fee is charged on.
+const DeliveryFeeItem = "delivery fee"
+
+// Delivery is where a purchase is taken by a courier, for purchases that are not collected at the store.
+type Delivery struct {
+	Address string
+	// Phone is how the courier reaches the customer.
+	Phone string
+}
+
+// Validate makes Delivery a value object: a courier needs both an address and a phone.
+func (d Delivery) Validate() error {
+	var v validation.Validator
+	v.Check(d.Address != "", "address", "is required")
+	v.Check(d.Phone != "", "phone", "is required")
+	return v.Err()
+}
+
 // 表示一次购买的行为
 type Purchase struct {
-	id                 uuid.UUID
+	ddd.AggregateRoot
 	Store              store.Store
+	CustomerID         uuid.UUID // uuid.Nil for anonymous purchases
 	ProductsToPurchase []coffeeco.Product
 	total              money.Money
 	PaymentMeans       payment.Means
 	timeOfPurchase     time.Time
 	CardToken          *string
+	Delivery           *Delivery       // nil for purchases collected at the store
+	ServedBy           string          // 可选, 收银的店员, 用于计算提成
+	TabID              uuid.UUID       // 可选, 这笔购买结清的账单
+	QuoteToken         string          // 可选, QuotePurchase 给出的报价, 在有效期内按报价收费
+	ReceiptCode        string          // 收据上的短码, 同一店铺同一天内唯一; 没有短码服务时为空
+	Charges            []Charge        // 可选, 商品以外的费用, 如外卖平台的服务费和骑手小费
+	ConfirmDuplicate   bool            // 可选, 顾客确认刚买过同样的东西还要再买, 跳过重复检测
+	Channel            Channel         // 可选, 下单渠道; 为空时按付款方式和是否外卖推断
+	Overrides          []PriceOverride // 可选, 店长改价, 每笔都要有原因代码
+	PickupAt           time.Time       // 可选, 在app里预约的取餐时间; 顾客到店附近才交给吧台, 最迟到点前交给吧台
+	DeviceID           uuid.UUID       // 收银的POS终端; 开启终端登记后店内购买必填, 见 WithDevices
+	// Substitutes 可选, 缺货时顾客接受的替代品, 按原商品名; 见 OutOfStockError
+	Substitutes map[string]string
+	// Experiment is the variant of a discount experiment the customer was priced in, kept for analysing the
+	// experiment; the zero Assignment if they were in none.
+	Experiment experiment.Assignment
+	// rounding is what rounding a cash total added to it, in the minor unit of its currency.
+	rounding int64
+	// correlationID ties the purchase to the request that made it, and to the logs and events of that request.
+	correlationID string
+	// imported is set for purchases brought over from another system with ImportPurchase.
+	imported bool
 }
 
-// 检查购买的行为的合理性 & 分配id & 记录时间等 -> 均为逻辑的操作
-func (p *Purchase) validateAndEnrich() error {
-	if len(p.ProductsToPurchase) == 0 {
-		return errors.New("purchase must consist of at least one product")
+func (p *Purchase) Total() money.Money {
+	return p.total
+}
+
+func (p *Purchase) PurchasedAt() time.Time {
+	return p.timeOfPurchase
+}
+
+func (p *Purchase) CorrelationID() string {
+	return p.correlationID
+}
+
+// Imported tells whether the purchase was made elsewhere and brought over with ImportPurchase, rather than
+// completed here.
+func (p *Purchase) Imported() bool {
+	return p.imported
+}
+
+// Anonymize removes what identifies the customer, for when they asked to be forgotten. What was bought,
+// where, when and for how much stays, as the books need it.
+func (p *Purchase) Anonymize() {
+	p.CustomerID = uuid.Nil
+	p.CardToken = nil
+	p.Delivery = nil
+}
+
+// coverWithPass makes the products a pass paid for, by index, free.
+func (p *Purchase) coverWithPass(covered []int) {
+	if len(covered) == 0 {
+		return
+	}
+	for _, i := range covered {
+		p.ProductsToPurchase[i].BasePrice = *money.New(0, p.ProductsToPurchase[i].BasePrice.Currency().Code)
+	}
+	total := money.New(0, p.total.Currency().Code)
+	for _, v := range p.ProductsToPurchase {
+		total, _ = total.Add(&v.BasePrice)
 	}
-	p.total = *money.New(0, "USD")
+	p.total = *total
+}
 
+// addDeliveryFee charges the fee on its own line, after any discount.
+func (p *Purchase) addDeliveryFee(fee money.Money) error {
+	total, err := p.total.Add(&fee)
+	if err != nil {
+		return fmt.Errorf("delivery fee is not in the currency of the purchase: %w", err)
+	}
+	p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{ItemName: DeliveryFeeItem, BasePrice: fee})
+	p.total = *total
+	return nil
+}
+
+// payable are the products left to pay for once a pass paid for what it could.
+func (p *Purchase) payable() []coffeeco.Product {
+	var products []coffeeco.Product
 	for _, v := range p.ProductsToPurchase {
-		newTotal, _ := p.total.Add(&v.BasePrice)
-		p.total = *newTotal
+		if !v.BasePrice.IsZero() {
+			products = append(products, v)
+		}
+	}
+	return products
+}
+
+// LogValue logs a purchase by what identifies it. The card token is left out.
+func (p Purchase) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("id", p.ID.String()),
+		slog.String("store_id", p.Store.ID.String()),
+		slog.String("payment_means", string(p.PaymentMeans)),
+	}
+	if p.CustomerID != uuid.Nil {
+		attrs = append(attrs, slog.String("customer_id", p.CustomerID.String()))
 	}
-	if p.total.IsZero() {
-		return errors.New("likely mistake; purchase should never be 0. Please validate")
+	if p.total.Currency() != nil {
+		attrs = append(attrs, slog.String("total", moneyfmt.Format(p.total.Amount(), p.total.Currency().Code, moneyfmt.Locale{})))
 	}
+	return slog.GroupValue(attrs...)
+}
 
-	p.id = uuid.New()
-	p.timeOfPurchase = time.Now()
+// 检查购买的行为的合理性 & 分配id & 记录时间等 -> 均为逻辑的操作
+func (p *Purchase) validateAndEnrich(now time.Time) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	p.substitute()
+	if !p.PickupAt.IsZero() {
+		var v validation.Validator
+		v.CheckErr(p.PickupAt.After(now), "pickupAt", ErrPickupInPast)
+		v.CheckErr(p.PickupAt.Sub(now) <= MaxPickupAhead, "pickupAt", ErrPickupTooFar)
+		if err := v.Err(); err != nil {
+			return err
+		}
+		p.PickupAt = p.PickupAt.UTC()
+	}
+	p.total = p.sum()
+	p.ID = uuid.New()
+	p.timeOfPurchase = now
+	p.inferChannel()
 
 	return nil
 }
 
+// Validate tells everything that is wrong with a purchase to complete, each problem at the path of the
+// field it is about.
+func (p *Purchase) Validate() error {
+	var v validation.Validator
+	p.validate(&v)
+	if p.PaymentMeans == payment.MEANS_CARD {
+		v.CheckErr(p.CardToken != nil && *p.CardToken != "", "cardToken", ErrMissingCardToken)
+	}
+	if p.Delivery != nil {
+		v.Merge("delivery", p.Delivery.Validate())
+	}
+	v.CheckErr(len(p.Charges) == 0 || p.PaymentMeans != payment.MEANS_COFFEEBUX, "charges", ErrChargesNotPayable)
+	v.CheckErr(p.PickupAt.IsZero() || (p.Channel == ChannelApp && p.Delivery == nil), "pickupAt", ErrPickupNotInApp)
+	p.validateOverrides(&v)
+	return v.Err()
+}
+
+// validateForImport is the relaxed counterpart of validateAndEnrich for purchases made elsewhere: the ID,
+// time and prices are taken as they were.
+func (p *Purchase) validateForImport(id uuid.UUID, purchasedAt time.Time) error {
+	var v validation.Validator
+	v.CheckErr(id != uuid.Nil, "id", ErrMissingID)
+	v.CheckErr(!purchasedAt.IsZero() && !purchasedAt.After(time.Now()), "purchasedAt", ErrInvalidPurchaseTime)
+	p.validate(&v)
+	if err := v.Err(); err != nil {
+		return err
+	}
+	p.ID = id
+	p.timeOfPurchase = purchasedAt
+	p.imported = true
+	p.total = p.sum()
+	p.inferChannel()
+	return p.addCharges()
+}
+
+// validate checks what every purchase needs: products in a single currency adding up to more than 0, and
+// a payment means.
+func (p *Purchase) validate(v *validation.Validator) {
+	switch p.PaymentMeans {
+	case payment.MEANS_CARD, payment.MEANS_CASH, payment.MEANS_COFFEEBUX, payment.MEANS_MARKETPLACE, payment.MEANS_WALLET:
+	default:
+		v.AddErr("paymentMeans", ErrUnknownPaymentMeans)
+	}
+	v.CheckErr(p.Channel == "" || slices.Contains(Channels, p.Channel), "channel", ErrUnknownChannel)
+	p.validateProducts(v)
+	p.validateCharges(v)
+}
+
+// validateProducts checks the products are in a single currency and add up to more than 0.
+func (p *Purchase) validateProducts(v *validation.Validator) {
+	if len(p.ProductsToPurchase) == 0 {
+		v.AddErr("products", ErrNoProducts)
+		return
+	}
+	currency := p.ProductsToPurchase[0].BasePrice.Currency().Code
+	mixed := false
+	for i, product := range p.ProductsToPurchase {
+		field := validation.Index("products", i)
+		if product.BasePrice.Currency().Code != currency {
+			v.AddErr(validation.Join(field, "price"), ErrMixedCurrencies)
+			mixed = true
+		}
+		v.Check(product.BasePrice.Amount() >= 0, validation.Join(field, "price"), "cannot be negative")
+	}
+	if !mixed {
+		total := p.sum()
+		v.CheckErr(!total.IsZero(), "products", ErrZeroTotal)
+	}
+}
+
+// sum adds up the prices of the products, which validate checked are in one currency.
+func (p *Purchase) sum() money.Money {
+	total := money.New(0, p.ProductsToPurchase[0].BasePrice.Currency().Code)
+	for _, v := range p.ProductsToPurchase {
+		total, _ = total.Add(&v.BasePrice)
+	}
+	return *total
+}
+
 // 利用go的隐士继承方式生命service
 type CardChargeService interface {
 	ChargeCard(ctx context.Context, amount money.Money, cardToken string) error
@@ -57,61 +311,748 @@ type StoreService interface {
 	GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID) (float32, error)
 }
 
+// Inventory holds the stock a purchase needs while it is paid for. Reserve fails with an error matching
+// inventory.ErrOutOfStock when the store has run out; Commit and Release must be safe to call again.
+type Inventory interface {
+	Reserve(ctx context.Context, storeID, purchaseID uuid.UUID, products []coffeeco.Product) error
+	Commit(ctx context.Context, storeID, purchaseID uuid.UUID) error
+	Release(ctx context.Context, storeID, purchaseID uuid.UUID) error
+}
+
+// Passes pays for drinks with the customer's subscription, e.g. subscription.Service. Cover returns the
+// products it paid for, by index, and Uncover gives them back if the purchase fails; both must be safe to
+// call again for the same purchase. Preview returns what Cover would, without using up the pass.
+type Passes interface {
+	Cover(ctx context.Context, customerID, purchaseID uuid.UUID, products []coffeeco.Product) ([]int, error)
+	Preview(ctx context.Context, customerID uuid.UUID, products []coffeeco.Product) ([]int, error)
+	Uncover(ctx context.Context, customerID, purchaseID uuid.UUID) error
+}
+
+// Deliveries quotes what a courier charges to take a purchase from the store to the customer, e.g.
+// delivery.Service. Quote fails with an error matching delivery.ErrNotDeliverable for purchases that
+// cannot be delivered.
+type Deliveries interface {
+	Quote(ctx context.Context, storeID, purchaseID uuid.UUID, to Delivery, orderValue money.Money) (money.Money, error)
+}
+
+// Wallet pays purchases from the stored value of the customer, e.g. wallet.Service. Hold sets the total
+// aside while the purchase is completed, Capture spends it once the purchase is stored and Release gives
+// it back if the purchase fails; all three must be safe to call again for the same purchase.
+type Wallet interface {
+	Hold(ctx context.Context, customerID, purchaseID uuid.UUID, amount money.Money) error
+	Capture(ctx context.Context, customerID, purchaseID uuid.UUID) error
+	Release(ctx context.Context, customerID, purchaseID uuid.UUID) error
+	Refund(ctx context.Context, customerID, purchaseID uuid.UUID, amount money.Money) (*wallet.Account, error)
+}
+
+type noWallet struct{}
+
+func (noWallet) Hold(context.Context, uuid.UUID, uuid.UUID, money.Money) error {
+	return ErrWalletUnavailable
+}
+func (noWallet) Capture(context.Context, uuid.UUID, uuid.UUID) error { return nil }
+func (noWallet) Release(context.Context, uuid.UUID, uuid.UUID) error { return nil }
+func (noWallet) Refund(context.Context, uuid.UUID, uuid.UUID, money.Money) (*wallet.Account, error) {
+	return nil, ErrWalletUnavailable
+}
+
+type noDeliveries struct{}
+
+func (noDeliveries) Quote(context.Context, uuid.UUID, uuid.UUID, Delivery, money.Money) (money.Money, error) {
+	return money.Money{}, ErrNoDelivery
+}
+
+type noPasses struct{}
+
+func (noPasses) Cover(context.Context, uuid.UUID, uuid.UUID, []coffeeco.Product) ([]int, error) {
+	return nil, nil
+}
+func (noPasses) Preview(context.Context, uuid.UUID, []coffeeco.Product) ([]int, error) {
+	return nil, nil
+}
+func (noPasses) Uncover(context.Context, uuid.UUID, uuid.UUID) error { return nil }
+
+type noInventory struct{}
+
+func (noInventory) Reserve(context.Context, uuid.UUID, uuid.UUID, []coffeeco.Product) error {
+	return nil
+}
+func (noInventory) Commit(context.Context, uuid.UUID, uuid.UUID) error  { return nil }
+func (noInventory) Release(context.Context, uuid.UUID, uuid.UUID) error { return nil }
+
 // 利用一个struct存储所有的dep的serivce和repo
 type Service struct {
 	cardService  CardChargeService // 描述付款的逻辑, 使用interface作为service定义
 	purchaseRepo Repository        // 描述存储的逻辑, 使用interface作为repo定义
 	storeService StoreService      // 用于描述“店铺”的相关逻辑, 使用interface作为service定义
+	publisher    events.Publisher  // 可选, 购买完成后发布领域事件
+	logger       *slog.Logger
+	recorder     Recorder
+	timeouts     Timeouts
+	audit        audit.Recorder
+	flags        feature.Flags
+	inventory    Inventory
+	passes       Passes
+	deliveries   Deliveries
+	wallet       Wallet
+	pricing      Pricer
+	entitlements Entitlements
+	now          func() time.Time
+	// quoteSecret signs quote tokens; nil issues none.
+	quoteSecret   []byte
+	quoteValidFor time.Duration
+	taxPercent    float64
+	tipPercents   []float64
+	// reviews 可选, 超过门槛的刷卡购买需店长审批
+	reviews        ReviewRepository
+	reviewPolicy   ReviewPolicy
+	authorizer     CardAuthorizer
+	reviewNotifier ReviewNotifier
+	loyaltyCards   LoyaltyCards
+	fiscal         Fiscalizer
+	receiptCodes   ReceiptCodes
+	cashRounding   CashRounding
+	means          StoreMeans
+	// recent 可选, 用于发现刚刚重复的购买
+	recent          Finder
+	duplicateWindow time.Duration
+	attempts        *attempts
+	// stampChannels 可选, 只有这些渠道的购买才积累集点
+	stampChannels []Channel
+	channelFees   ChannelFees
+	// substitutes 可选, 缺货时推荐替代品
+	substitutes Substitutes
+	// devices 可选, 只接受登记过且未吊销的POS终端上的购买
+	devices Devices
+	// sandboxCards 和 sandboxRepo 可选, 练习模式的购买用测试网关收费, 存入单独的分区
+	sandboxCards CardChargeService
+	sandboxRepo  Repository
+}
+
+// StoreMeans tells which payment means a store takes for now; *store.Service is one.
+type StoreMeans interface {
+	PaymentMeans(ctx context.Context, storeID uuid.UUID) (store.PaymentMeans, error)
+}
+
+type noStoreMeans struct{}
+
+func (noStoreMeans) PaymentMeans(_ context.Context, storeID uuid.UUID) (store.PaymentMeans, error) {
+	return store.PaymentMeans{StoreID: storeID}, nil
+}
+
+// Fiscalizer fiscalizes the receipts of purchases where the law requires it; *fiscal.Service is one.
+type Fiscalizer interface {
+	// Fiscalize fails if the purchase must not be charged without a fiscal receipt.
+	Fiscalize(ctx context.Context, storeID uuid.UUID, p *Purchase) error
+	// Cancel takes back the receipt of a purchase that failed after it was fiscalized.
+	Cancel(ctx context.Context, purchaseID uuid.UUID) error
+}
+
+// ReceiptCodes give purchases the short code printed on their receipt; *receipt.Codes is one.
+type ReceiptCodes interface {
+	Assign(ctx context.Context, storeID, purchaseID uuid.UUID, at time.Time) (string, error)
+}
+
+type noReceiptCodes struct{}
+
+func (noReceiptCodes) Assign(context.Context, uuid.UUID, uuid.UUID, time.Time) (string, error) {
+	return "", nil
+}
+
+type noFiscalizer struct{}
+
+func (noFiscalizer) Fiscalize(context.Context, uuid.UUID, *Purchase) error { return nil }
+func (noFiscalizer) Cancel(context.Context, uuid.UUID) error               { return nil }
+
+// Entitlements count the purchases a customer's negotiated discount was taken off against its monthly cap;
+// *entitlement.Service is one.
+type Entitlements interface {
+	Use(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+type noEntitlements struct{}
+
+func (noEntitlements) Use(context.Context, uuid.UUID, time.Time) error { return nil }
+
+// Pricer prices purchases; *pricing.Engine is one.
+type Pricer interface {
+	Quote(ctx context.Context, r pricing.Request) (pricing.Quote, error)
+}
+
+// Recorder is told how purchases went, e.g. to count them in metrics.
+type Recorder interface {
+	PurchaseCompleted(p *Purchase, discountPercent float32)
+	// PaymentFailed gets why a purchase could not be paid for, e.g. the card's decline code.
+	PaymentFailed(means payment.Means, reason string)
+}
+
+type noRecorder struct{}
+
+func (noRecorder) PurchaseCompleted(*Purchase, float32) {}
+func (noRecorder) PaymentFailed(payment.Means, string)  {}
+
+// Option configures optional collaborators of the Service.
+type Option func(s *Service)
+
+// WithEventPublisher makes the Service publish a Completed event for every successful purchase.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithLogger sets where the Service logs failures it does not pass on as they are, e.g. why a card was
+// declined. It logs to slog.Default() otherwise.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithAuditLog records the refunds made by the completion saga, and the prices managers override, in the
+// audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithFeatureFlags decides per store and customer whether purchases take paths that are not on for
+// everyone yet. Without it every flag is off.
+func WithFeatureFlags(f feature.Flags) Option {
+	return func(s *Service) {
+		s.flags = f
+	}
+}
+
+// WithInventory reserves the stock of every purchase before it is paid for, and gives it back if the
+// purchase fails. Without it stock is not tracked.
+func WithInventory(i Inventory) Option {
+	return func(s *Service) {
+		s.inventory = i
+	}
+}
+
+// WithPasses lets customers with a pass have their drinks paid for by it. Without it nobody has a pass.
+func WithPasses(p Passes) Option {
+	return func(s *Service) {
+		s.passes = p
+	}
+}
+
+// WithDeliveries charges purchases to be delivered the fee quoted by the courier. Without it purchases can
+// only be collected at the store.
+func WithDeliveries(d Deliveries) Option {
+	return func(s *Service) {
+		s.deliveries = d
+	}
+}
+
+// WithWallet lets customers pay from their wallet, where the wallet-payments flag is on for them. Without
+// it nobody has a wallet.
+func WithWallet(w Wallet) Option {
+	return func(s *Service) {
+		s.wallet = w
+	}
+}
+
+// WithPricing prices purchases with p rather than at the prices they were rung up at less the store's
+// discount. p takes the store's discount off too, so it should be built with pricing.WithStoreDiscounts.
+func WithPricing(p Pricer) Option {
+	return func(s *Service) {
+		s.pricing = p
+	}
+}
+
+// WithEntitlements counts every purchase the pricing engine took a customer's negotiated discount off, so
+// its monthly cap holds. The engine should be given the same entitlements with pricing.WithEntitlements.
+func WithEntitlements(e Entitlements) Option {
+	return func(s *Service) {
+		s.entitlements = e
+	}
+}
+
+// WithFiscalizer fiscalizes every purchase before it is charged, and takes the receipt back if the
+// purchase fails afterwards. Without it receipts are not fiscalized.
+func WithFiscalizer(f Fiscalizer) Option {
+	return func(s *Service) {
+		s.fiscal = f
+	}
+}
+
+// WithReceiptCodes prints a short code on every receipt, for support to find the purchase from it.
+func WithReceiptCodes(c ReceiptCodes) Option {
+	return func(s *Service) {
+		s.receiptCodes = c
+	}
+}
+
+// WithCashRounding rounds the totals of purchases paid in cash to the smallest coin of their currency.
+// Without it cash totals are charged to the cent.
+func WithCashRounding(r CashRounding) Option {
+	return func(s *Service) {
+		s.cashRounding = r
+	}
 }
 
-func NewService(cardService CardChargeService, purchaseRepo Repository, storeService StoreService) *Service {
-	return &Service{cardService: cardService, purchaseRepo: purchaseRepo, storeService: storeService}
+// WithStoreMeans turns away purchases paid in a way their store does not take for now. Without it every
+// store takes every means.
+func WithStoreMeans(m StoreMeans) Option {
+	return func(s *Service) {
+		s.means = m
+	}
+}
+
+// WithRecorder reports every completed purchase and failed payment to r.
+func WithRecorder(r Recorder) Option {
+	return func(s *Service) {
+		s.recorder = r
+	}
 }
 
-func (s Service) CompletePurchase(ctx context.Context, storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) error {
-	if err := purchase.validateAndEnrich(); err != nil {
+// WithClock replaces time.Now as the time purchases are made at, e.g. to replay a day of purchases.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(cardService CardChargeService, purchaseRepo Repository, storeService StoreService, opts ...Option) *Service {
+	s := &Service{cardService: cardService, purchaseRepo: purchaseRepo, storeService: storeService, logger: slog.Default(), recorder: noRecorder{}, timeouts: defaultTimeouts, flags: feature.Off{}, inventory: noInventory{}, passes: noPasses{}, deliveries: noDeliveries{}, wallet: noWallet{}, entitlements: noEntitlements{}, now: time.Now, tipPercents: defaultTipPercents, reviewNotifier: noReviewNotifier{}, fiscal: noFiscalizer{}, receiptCodes: noReceiptCodes{}, means: noStoreMeans{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.pricing == nil {
+		s.pricing = pricing.NewEngine(pricing.Rules{}, pricing.WithStoreDiscounts(storeService), pricing.WithFeatureFlags(s.flags), pricing.WithLogger(s.logger))
+	}
+	return s
+}
+
+func (s *Service) CompletePurchase(ctx context.Context, storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) (err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.CompletePurchase", attribute.String("store.id", storeID.String()), attribute.String("payment.means", string(purchase.PaymentMeans)))
+	defer telemetry.End(span, &err)
+	// The purchase is made at storeID, and its events and logs say so.
+	purchase.Store.ID = storeID
+	if sandbox.Enabled(ctx) {
+		return s.practise(ctx, storeID, purchase)
+	}
+	if err := purchase.validateAndEnrich(s.now()); err != nil {
 		return err
 	}
+	if err := s.checkMeans(ctx, storeID, purchase); err != nil {
+		return err
+	}
+	if err := s.checkDevice(ctx, storeID, purchase); err != nil {
+		return err
+	}
+	if err := s.checkDuplicate(ctx, storeID, purchase); err != nil {
+		return err
+	}
+	defer s.forgetAttempt(purchase)
+	purchase.correlationID = correlation.ID(ctx)
+
+	if purchase.CustomerID == uuid.Nil && coffeeBuxCard != nil {
+		purchase.CustomerID = coffeeBuxCard.CustomerID()
+	}
 
-	if err := s.calculateStoreSpecificDiscount(ctx, storeID, purchase); err != nil {
+	stored := false
+	if err := step(ctx, StepPass, s.timeouts.Pass, func(ctx context.Context) error {
+		return s.coverWithPass(ctx, purchase)
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && !stored {
+			s.uncoverPass(ctx, purchase)
+		}
+	}()
+	var (
+		discount    float32
+		entitlement uuid.UUID
+	)
+	if err := step(ctx, StepDiscount, s.timeouts.Discount, func(ctx context.Context) (err error) {
+		discount, entitlement, err = s.price(ctx, storeID, purchase)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := purchase.applyOverrides(audit.Actor(ctx)); err != nil {
+		return err
+	}
+	if err := step(ctx, StepReserve, s.timeouts.Reserve, func(ctx context.Context) error {
+		return s.reserve(ctx, storeID, purchase)
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && !stored {
+			s.releaseStock(ctx, storeID, purchase)
+		}
+	}()
+	if err := step(ctx, StepDelivery, s.timeouts.Delivery, func(ctx context.Context) error {
+		purchase.chargeChannelFee(s.channelFees)
+		if err := purchase.addCharges(); err != nil {
+			return err
+		}
+		return s.addDeliveryFee(ctx, storeID, purchase)
+	}); err != nil {
+		return err
+	}
+	purchase.roundCash(s.cashRounding)
+	if err := step(ctx, StepFiscalize, s.timeouts.Fiscalize, func(ctx context.Context) error {
+		return s.fiscal.Fiscalize(ctx, storeID, purchase)
+	}); err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil && !stored {
+			s.cancelFiscal(ctx, purchase)
+		}
+	}()
+	if s.needsReview(storeID, purchase) {
+		if err := s.holdForReview(ctx, storeID, purchase, coffeeBuxCard, discount, entitlement); err != nil {
+			return err
+		}
+		// The review keeps the stock and the pass's drinks until a manager decides on the purchase.
+		stored = true
+		return ErrHeldForReview
+	}
+	// A purchase the customer's pass paid for in full has nothing left to pay.
+	if !purchase.total.IsZero() {
+		if err := s.pay(ctx, purchase, coffeeBuxCard); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil && !stored {
+				s.releaseWallet(ctx, purchase)
+			}
+		}()
+	}
+
+	s.assignReceiptCode(ctx, storeID, purchase)
+	if err := step(ctx, StepStore, s.timeouts.Store, func(ctx context.Context) error {
+		return s.purchaseRepo.Store(ctx, purchase)
+	}); err != nil {
+		s.logger.ErrorContext(ctx, "failed to store purchase after payment", "purchase", purchase, "error", err)
+		if errors.Is(err, ErrTimeout) {
+			return err
+		}
+		return errors.New("failed to Store purchase")
+	}
+	stored = true
+	if err := s.inventory.Commit(ctx, storeID, purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "purchase stored but its stock is still reserved", "purchase", purchase, "error", err)
+	}
+	if purchase.PaymentMeans == payment.MEANS_WALLET && !purchase.total.IsZero() {
+		if err := s.wallet.Capture(ctx, purchase.CustomerID, purchase.ID); err != nil {
+			s.logger.ErrorContext(ctx, "purchase stored but its wallet hold was not captured", "purchase", purchase, "error", err)
+		}
+	}
+	// A customer buying at two tills at once may go one purchase over the cap, rather than have a paid
+	// purchase fail.
+	if entitlement != uuid.Nil {
+		if err := s.entitlements.Use(ctx, entitlement, purchase.timeOfPurchase); err != nil {
+			s.logger.ErrorContext(ctx, "purchase stored but its negotiated discount was not counted", "purchase", purchase, "entitlement_id", entitlement, "error", err)
+		}
+	}
+	s.recordOverrides(ctx, purchase)
+	if coffeeBuxCard != nil && s.earnsStamp(purchase) {
+		coffeeBuxCard.AddStamp()
+	}
+	purchase.completed(s.now())
+	if s.publisher != nil {
+		evts := purchase.PopEvents()
+		if coffeeBuxCard != nil {
+			evts = append(evts, coffeeBuxCard.PopEvents()...)
+		}
+		if err := step(ctx, StepPublish, s.timeouts.Publish, func(ctx context.Context) error {
+			return s.publisher.Publish(ctx, evts...)
+		}); err != nil {
+			s.logger.ErrorContext(ctx, "purchase stored but its events were not published", "purchase", purchase, "error", err)
+			return fmt.Errorf("purchase stored but failed to publish events: %w", err)
+		}
+	}
+	s.logger.InfoContext(ctx, "purchase completed", "purchase", purchase)
+	s.recorder.PurchaseCompleted(purchase, discount)
+	return nil
+}
+
+// checkMeans turns away a purchase paid in a way the store does not take for now, telling what it takes
+// instead. A store whose means cannot be read is taken to take them all, rather than turn every customer
+// away.
+func (s *Service) checkMeans(ctx context.Context, storeID uuid.UUID, purchase *Purchase) error {
+	taken, err := s.means.PaymentMeans(ctx, storeID)
+	if err != nil {
+		s.logger.WarnContext(ctx, "payment means of the store could not be read, taking any", "purchase", purchase, "error", err)
+		return nil
+	}
+	if taken.Takes(purchase.PaymentMeans) {
+		return nil
+	}
+	msg := fmt.Sprintf("%s is not taken at this store right now", purchase.PaymentMeans)
+	if taken.Reason != "" {
+		msg += " (" + taken.Reason + ")"
+	}
+	if alternatives := taken.Alternatives(purchase.PaymentMeans); len(alternatives) > 0 {
+		names := make([]string, 0, len(alternatives))
+		for _, v := range alternatives {
+			names = append(names, string(v))
+		}
+		msg += "; pay with " + strings.Join(names[:len(names)-1], ", ")
+		if len(names) > 1 {
+			msg += " or "
+		}
+		msg += names[len(names)-1]
+	}
+	return validation.Errors{{Field: "paymentMeans", Message: msg, Err: ErrMeansNotTaken}}
+}
+
+// assignReceiptCode gives the purchase its short receipt code. A paid purchase is not failed for want of
+// one; support can still find it by its ID.
+func (s *Service) assignReceiptCode(ctx context.Context, storeID uuid.UUID, purchase *Purchase) {
+	code, err := s.receiptCodes.Assign(ctx, storeID, purchase.ID, purchase.timeOfPurchase)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "purchase has no short receipt code", "purchase", purchase, "error", err)
+		return
+	}
+	purchase.ReceiptCode = code
+}
+
+// cancelFiscal takes back the fiscal receipt of a purchase that failed.
+func (s *Service) cancelFiscal(ctx context.Context, purchase *Purchase) {
+	if err := s.fiscal.Cancel(context.WithoutCancel(ctx), purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "purchase failed but its fiscal receipt was not cancelled", "purchase", purchase, "error", err)
+	}
+}
+
+// pay charges the purchase to its payment means.
+func (s *Service) pay(ctx context.Context, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) error {
 	switch purchase.PaymentMeans {
 	case payment.MEANS_CARD:
 		// 使用service中的用"卡"付款的service处理, 此处为interface
-		if err := s.cardService.ChargeCard(ctx, purchase.total, *purchase.CardToken); err != nil {
-			return errors.New("card charge failed, cancelling purchase")
+		err := step(ctx, StepCharge, s.timeouts.Charge, func(ctx context.Context) error {
+			return s.cardService.ChargeCard(ctx, purchase.total, *purchase.CardToken)
+		})
+		switch {
+		case errors.Is(err, ErrTimeout):
+			s.logger.WarnContext(ctx, "card charge timed out, it may still have gone through", "purchase", purchase)
+			s.recorder.PaymentFailed(purchase.PaymentMeans, "timeout")
+			return err
+		case errors.Is(err, breaker.ErrOpen):
+			s.recorder.PaymentFailed(purchase.PaymentMeans, "gateway_unavailable")
+			return ErrCardPaymentsUnavailable
+		case err != nil:
+			s.logger.WarnContext(ctx, "card charge failed", "purchase", purchase, "error", err)
+			s.recorder.PaymentFailed(purchase.PaymentMeans, payment.DeclineCode(err))
+			return ErrCardChargeFailed
 		}
 	case payment.MEANS_CASH:
 	// For the reader to add :)
 
+	case payment.MEANS_MARKETPLACE:
+	// The marketplace charged the customer already.
+
+	case payment.MEANS_WALLET:
+		if err := s.holdWallet(ctx, purchase); err != nil {
+			return err
+		}
+
 	case payment.MEANS_COFFEEBUX:
 		// 使用传入的用户忠诚计划的信息付款, 注意, 此处非interface
-		if err := coffeeBuxCard.Pay(ctx, purchase.ProductsToPurchase); err != nil {
+		if err := coffeeBuxCard.Pay(ctx, purchase.payable()); err != nil {
+			s.recorder.PaymentFailed(purchase.PaymentMeans, coffeeBuxDeclineReason(err))
 			return fmt.Errorf("failed to charge loyalty card: %w", err)
 		}
 	default:
-		return errors.New("unknown payment type")
+		return ErrUnknownPaymentMeans
 	}
+	return nil
+}
 
-	if err := s.purchaseRepo.Store(ctx, *purchase); err != nil {
-		return errors.New("failed to Store purchase")
+// holdWallet sets the total aside in the customer's wallet, for customers the wallet-payments flag is on for.
+func (s *Service) holdWallet(ctx context.Context, purchase *Purchase) error {
+	target := feature.Target{StoreID: purchase.Store.ID, CustomerID: purchase.CustomerID}
+	if purchase.CustomerID == uuid.Nil || !s.flags.Enabled(ctx, feature.WalletPayments, target) {
+		return ErrWalletUnavailable
 	}
-	if coffeeBuxCard != nil {
-		coffeeBuxCard.AddStamp()
+	if err := s.wallet.Hold(ctx, purchase.CustomerID, purchase.ID, purchase.total); err != nil {
+		s.recorder.PaymentFailed(purchase.PaymentMeans, walletDeclineReason(err))
+		return fmt.Errorf("failed to pay from wallet: %w", err)
 	}
 	return nil
 }
 
-func (s *Service) calculateStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID, purchase *Purchase) error {
-	discount, err := s.storeService.GetStoreSpecificDiscount(ctx, storeID)
-	if err != nil && err != store.ErrNoDiscount {
-		return fmt.Errorf("failed to get discount: %w", err)
+// releaseWallet gives back what a failed purchase held in the customer's wallet.
+func (s *Service) releaseWallet(ctx context.Context, purchase *Purchase) {
+	if purchase.PaymentMeans != payment.MEANS_WALLET {
+		return
+	}
+	if err := s.wallet.Release(context.WithoutCancel(ctx), purchase.CustomerID, purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "wallet hold of a failed purchase was not released", "purchase", purchase, "error", err)
 	}
+}
 
-	purchasePrice := purchase.total
-	if discount > 0 {
-		purchase.total = *purchasePrice.Multiply(int64(100 - discount))
+// coverWithPass has the customer's pass pay for what it can, before any discount applies to the rest.
+func (s *Service) coverWithPass(ctx context.Context, purchase *Purchase) error {
+	if purchase.CustomerID == uuid.Nil {
+		return nil
+	}
+	covered, err := s.passes.Cover(ctx, purchase.CustomerID, purchase.ID, purchase.ProductsToPurchase)
+	if err != nil {
+		return fmt.Errorf("failed to cover purchase with pass: %w", err)
 	}
+	purchase.coverWithPass(covered)
 	return nil
 }
+
+// addDeliveryFee quotes the delivery of a purchase that is to be delivered and charges it on a line of its
+// own. Free drinks are not money, so they cannot pay for it.
+func (s *Service) addDeliveryFee(ctx context.Context, storeID uuid.UUID, purchase *Purchase) error {
+	if purchase.Delivery == nil {
+		return nil
+	}
+	if purchase.PaymentMeans == payment.MEANS_COFFEEBUX {
+		return ErrDeliveryNotPayable
+	}
+	fee, err := s.deliveries.Quote(ctx, storeID, purchase.ID, *purchase.Delivery, purchase.total)
+	if err != nil {
+		return fmt.Errorf("failed to quote delivery: %w", err)
+	}
+	return purchase.addDeliveryFee(fee)
+}
+
+// uncoverPass gives the drinks of a failed purchase back to the customer's pass.
+func (s *Service) uncoverPass(ctx context.Context, purchase *Purchase) {
+	if purchase.CustomerID == uuid.Nil {
+		return
+	}
+	if err := s.passes.Uncover(context.WithoutCancel(ctx), purchase.CustomerID, purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "drinks of a failed purchase were not given back to the pass", "purchase", purchase, "error", err)
+	}
+}
+
+// releaseStock gives back what a failed purchase reserved, even if the caller has given up on it.
+func (s *Service) releaseStock(ctx context.Context, storeID uuid.UUID, purchase *Purchase) {
+	if err := s.inventory.Release(context.WithoutCancel(ctx), storeID, purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "stock of a failed purchase is still reserved", "purchase", purchase, "error", err)
+	}
+}
+
+func (s *Service) GetPurchase(ctx context.Context, id uuid.UUID) (_ Purchase, err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.GetPurchase", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	// Practice purchases are only found in practice, and real ones only for real.
+	if sandbox.Enabled(ctx) {
+		if s.sandboxRepo == nil {
+			return Purchase{}, ErrNotFound
+		}
+		return s.sandboxRepo.Get(ctx, id)
+	}
+	return s.purchaseRepo.Get(ctx, id)
+}
+
+// ImportPurchase stores a purchase that was made and paid for before it was recorded here, e.g. at a
+// franchise moving onto the platform. Nothing is charged, no discount is applied and no events are
+// published, so rebuild the projections once an import is done. Importing the same purchase twice returns
+// ErrAlreadyImported, so an interrupted import can be run again from the start.
+func (s *Service) ImportPurchase(ctx context.Context, id uuid.UUID, purchasedAt time.Time, purchase *Purchase) (err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.ImportPurchase", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	if err := purchase.validateForImport(id, purchasedAt); err != nil {
+		return err
+	}
+	purchase.correlationID = correlation.ID(ctx)
+	if _, err := s.purchaseRepo.Get(ctx, id); err == nil {
+		return ErrAlreadyImported
+	} else if !errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("failed to check for an earlier import: %w", err)
+	}
+	if err := s.purchaseRepo.Store(ctx, purchase); err != nil {
+		return fmt.Errorf("failed to store imported purchase: %w", err)
+	}
+	return nil
+}
+
+// UpdateStatus tells the customer their purchase is being prepared or ready to collect. Statuses are not
+// stored; they only travel as StatusChanged events.
+func (s *Service) UpdateStatus(ctx context.Context, id uuid.UUID, status Status) (err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.UpdateStatus", attribute.String("purchase.id", id.String()), attribute.String("purchase.status", string(status)))
+	defer telemetry.End(span, &err)
+	if status != StatusPreparing && status != StatusReady {
+		return ErrInvalidStatus
+	}
+	if s.publisher == nil {
+		return ErrNoPublisher
+	}
+	p, err := s.purchaseRepo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.publisher.Publish(ctx, p.statusChanged(status, s.now())); err != nil {
+		return fmt.Errorf("failed to publish status change: %w", err)
+	}
+	return nil
+}
+
+// price has the pricing engine price what is left to pay once a pass paid for what it could, or takes the
+// prices of its quote token if it has one, and returns the store's discount in percent and the customer's
+// negotiated discount taken off, if any. Every product keeps its price before the discounts, which are only
+// taken off the total. The purchase keeps the experiment variant the engine priced it in.
+func (s *Service) price(ctx context.Context, storeID uuid.UUID, purchase *Purchase) (float32, uuid.UUID, error) {
+	req, priced := purchase.pricingRequest(storeID)
+	if len(priced) == 0 {
+		return 0, uuid.Nil, nil
+	}
+	if purchase.QuoteToken != "" {
+		return s.honorQuote(storeID, purchase, req, priced)
+	}
+	q, err := s.pricing.Quote(ctx, req)
+	if err != nil {
+		return 0, uuid.Nil, err
+	}
+	purchase.applyPrices(priced, q.Lines, q.Total)
+	purchase.Experiment = q.Experiment
+	return q.DiscountPercent, q.Entitlement, nil
+}
+
+// pricingRequest asks for the price of every product left to pay for, and returns their indexes.
+func (p *Purchase) pricingRequest(storeID uuid.UUID) (pricing.Request, []int) {
+	products := p.ProductsToPurchase
+	req := pricing.Request{StoreID: storeID, CustomerID: p.CustomerID, At: p.timeOfPurchase, Items: make([]pricing.Item, 0, len(products))}
+	priced := make([]int, 0, len(products))
+	for i := range products {
+		v := &products[i]
+		if v.BasePrice.IsZero() {
+			continue
+		}
+		// The list price is read before the quoted price replaces it, so it need not be copied.
+		req.Items = append(req.Items, pricing.Item{Product: v.ItemName, Size: v.Size, Modifiers: v.Modifiers, ReusableCup: v.ReusableCup, ListPrice: &v.BasePrice})
+		priced = append(priced, i)
+	}
+	return req, priced
+}
+
+// applyPrices charges the products at priced the prices of the lines quoted for them, and the total.
+func (p *Purchase) applyPrices(priced []int, lines []pricing.Line, total money.Money) {
+	for j, i := range priced {
+		p.ProductsToPurchase[i].BasePrice = lines[j].Total
+	}
+	p.total = total
+}
+
+func coffeeBuxDeclineReason(err error) string {
+	if errors.Is(err, loyalty.ErrNotEnoughCoffeeBux) {
+		return "not_enough_coffeebux"
+	}
+	return "unknown"
+}
+
+func walletDeclineReason(err error) string {
+	switch {
+	case errors.Is(err, wallet.ErrInsufficientFunds):
+		return "insufficient_funds"
+	case errors.Is(err, wallet.ErrNotFound):
+		return "no_wallet"
+	}
+	return "unknown"
+}
@@ -0,0 +1,1080 @@
+package purchase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/command"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/feature"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/sandbox"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+	"coffeeco/internal/validation"
+	"coffeeco/internal/wallet"
+)
+
+type percentOff float32
+
+func (p percentOff) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return float32(p), nil
+}
+
+func Test_StoreDiscountsAreTakenOffInCentsRoundingHalfUp(t *testing.T) {
+	for discount, want := range map[percentOff]int64{10: 405, 12.5: 394} {
+		svc := purchase.NewService(instant{}, noPurchases{}, discount)
+		p := &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       payment.MEANS_CASH,
+		}
+		if err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if got := p.Total(); got.Amount() != want {
+			t.Fatalf("expected %v%% off 4.50 to be %d cents but got %s", float32(discount), want, got.Display())
+		}
+	}
+}
+
+func Test_PurchasesKeepTheCorrelationIDOfTheirRequest(t *testing.T) {
+	es := eventstore.NewMemoryStore()
+	repo, err := purchase.NewEventSourcedRepo(es, nil, 1)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	svc := purchase.NewService(instant{}, repo, percentOff(0))
+	ctx := correlation.WithIDs(context.Background(), correlation.IDs{CorrelationID: "till-7:0042", CausationID: "req-1"})
+
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+		PaymentMeans:       payment.MEANS_CASH,
+	}
+	if err := svc.CompletePurchase(ctx, uuid.New(), p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	records, err := es.Load(ctx, p.ID, 0)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected one record but got %v (%v)", records, err)
+	}
+	if records[0].CorrelationID != "till-7:0042" || records[0].CausationID != "req-1" {
+		t.Fatalf("expected till-7:0042 caused by req-1 but got %s caused by %s", records[0].CorrelationID, records[0].CausationID)
+	}
+	// Loaded from the snapshot, as one is taken after every event.
+	got, err := repo.Get(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if got.CorrelationID() != "till-7:0042" {
+		t.Fatalf("expected correlation ID till-7:0042 but got %q", got.CorrelationID())
+	}
+}
+
+func Test_CompletedEventsNameTheStoreThePurchaseWasMadeAt(t *testing.T) {
+	storeID := uuid.New()
+	pub := &published{}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithEventPublisher(pub))
+
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+		PaymentMeans:       payment.MEANS_CASH,
+	}
+	if err := svc.CompletePurchase(context.Background(), storeID, p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if completed, ok := (*pub)[0].(purchase.Completed); !ok || completed.StoreID != storeID {
+		t.Fatalf("expected the purchase completed at %s but got %+v", storeID, (*pub)[0])
+	}
+}
+
+func Test_PurchasesAreAcceptedAtTheTimeOfTheServiceClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	pub := &published{}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithEventPublisher(pub), purchase.WithClock(func() time.Time { return now }))
+
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+		PaymentMeans:       payment.MEANS_CASH,
+	}
+	if err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	accepted, ok := (*pub)[1].(purchase.StatusChanged)
+	if !ok || !accepted.ChangedAt.Equal(now) {
+		t.Fatalf("expected the purchase accepted at %s but got %+v", now, (*pub)[1])
+	}
+}
+
+type declined struct{}
+
+func (declined) ChargeCard(context.Context, money.Money, string) error {
+	return errors.New("card declined")
+}
+
+func Test_PurchasesReserveStockAndGiveItBackWhenTheyFail(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	stock := inventory.NewService(inventory.NewMemoryRepo(), nil)
+	if err := stock.Restock(ctx, storeID, "croissant", 1); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	token := "tok_visa"
+	croissant := func() *purchase.Purchase {
+		return &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "croissant", BasePrice: *money.New(300, "USD")}},
+			PaymentMeans:       payment.MEANS_CARD,
+			CardToken:          &token,
+		}
+	}
+
+	failing := purchase.NewService(declined{}, noPurchases{}, percentOff(0), purchase.WithInventory(stock))
+	if err := failing.CompletePurchase(ctx, storeID, croissant(), nil); !errors.Is(err, purchase.ErrCardChargeFailed) {
+		t.Fatalf("expected ErrCardChargeFailed but got %v", err)
+	}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithInventory(stock))
+	if err := svc.CompletePurchase(ctx, storeID, croissant(), nil); err != nil {
+		t.Fatalf("expected the declined purchase to have given its croissant back but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, storeID, croissant(), nil); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("expected ErrOutOfStock but got %v", err)
+	}
+	st, _ := stock.Stock(ctx, storeID)
+	if l, _ := st.Level("croissant"); l.OnHand != 0 || l.Reserved != 0 {
+		t.Fatalf("expected the sold croissant to be gone but got %+v", l)
+	}
+}
+
+// pass covers the first latte of every purchase.
+type pass struct{ uncovered []uuid.UUID }
+
+func (p *pass) Cover(_ context.Context, _, _ uuid.UUID, products []coffeeco.Product) ([]int, error) {
+	for i, product := range products {
+		if product.ItemName == "latte" {
+			return []int{i}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *pass) Preview(ctx context.Context, customerID uuid.UUID, products []coffeeco.Product) ([]int, error) {
+	return p.Cover(ctx, customerID, uuid.Nil, products)
+}
+
+func (p *pass) Uncover(_ context.Context, _, purchaseID uuid.UUID) error {
+	p.uncovered = append(p.uncovered, purchaseID)
+	return nil
+}
+
+func Test_DrinksCoveredByAPassCostNothing(t *testing.T) {
+	ctx := context.Background()
+	token := "tok_visa"
+	order := func(items ...string) *purchase.Purchase {
+		p := &purchase.Purchase{CustomerID: uuid.New(), PaymentMeans: payment.MEANS_CARD, CardToken: &token}
+		for _, item := range items {
+			p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{ItemName: item, BasePrice: *money.New(400, "USD")})
+		}
+		return p
+	}
+	passes := &pass{}
+
+	// Nothing is left to charge, so the card that would be declined is not.
+	latte := order("latte")
+	if err := purchase.NewService(declined{}, noPurchases{}, percentOff(0), purchase.WithPasses(passes)).CompletePurchase(ctx, uuid.New(), latte, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := latte.Total(); !total.IsZero() {
+		t.Fatalf("expected the latte to cost nothing but got %s", total.Display())
+	}
+
+	withCroissant := order("croissant", "latte")
+	err := purchase.NewService(declined{}, noPurchases{}, percentOff(0), purchase.WithPasses(passes)).CompletePurchase(ctx, uuid.New(), withCroissant, nil)
+	if !errors.Is(err, purchase.ErrCardChargeFailed) {
+		t.Fatalf("expected the croissant to be charged but got %v", err)
+	}
+	if total := withCroissant.Total(); total.Amount() != 400 {
+		t.Fatalf("expected only the croissant to be charged but got %s", total.Display())
+	}
+	if len(passes.uncovered) != 1 || passes.uncovered[0] != withCroissant.ID {
+		t.Fatalf("expected the latte of the declined purchase to go back to the pass but got %v", passes.uncovered)
+	}
+}
+
+type flatFee struct{ quoted money.Money }
+
+func (f *flatFee) Quote(_ context.Context, _, _ uuid.UUID, _ purchase.Delivery, orderValue money.Money) (money.Money, error) {
+	f.quoted = orderValue
+	return *money.New(299, "USD"), nil
+}
+
+func Test_DeliveryFeesAreChargedOnALineOfTheirOwn(t *testing.T) {
+	fees := &flatFee{}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithDeliveries(fees))
+
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(500, "USD")}},
+		PaymentMeans:       payment.MEANS_CASH,
+		Delivery:           &purchase.Delivery{Address: "1 Main St", Phone: "+15555550100"},
+	}
+	if err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if fees.quoted.Amount() != 500 {
+		t.Fatalf("expected the delivery to be quoted for the drinks alone but got %s", fees.quoted.Display())
+	}
+	last := p.ProductsToPurchase[len(p.ProductsToPurchase)-1]
+	if last.ItemName != purchase.DeliveryFeeItem || last.BasePrice.Amount() != 299 {
+		t.Fatalf("expected the fee on the last line but got %+v", p.ProductsToPurchase)
+	}
+	if got := p.Total(); got.Amount() != 799 {
+		t.Fatalf("expected a total of 7.99 but got %s", got.Display())
+	}
+
+	p = &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(500, "USD")}},
+		PaymentMeans:       payment.MEANS_CASH,
+		Delivery:           &purchase.Delivery{Address: "1 Main St", Phone: "+15555550100"},
+	}
+	svc = purchase.NewService(instant{}, noPurchases{}, percentOff(0))
+	if err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil); !errors.Is(err, purchase.ErrNoDelivery) {
+		t.Fatalf("expected ErrNoDelivery without a courier but got %v", err)
+	}
+}
+
+func Test_WalletPaymentsHoldTheTotalAndSpendItOnceStored(t *testing.T) {
+	ctx := context.Background()
+	wallets := wallet.NewService(wallet.NewMemoryRepo(), topUps{}, wallet.Limits{Currency: "USD"})
+	alice := uuid.New()
+	if _, err := wallets.TopUp(ctx, alice, *money.New(1000, "USD"), "tok"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	flags := feature.NewMemory()
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithWallet(wallets), purchase.WithFeatureFlags(flags))
+	latte := func() *purchase.Purchase {
+		return &purchase.Purchase{
+			CustomerID:         alice,
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       payment.MEANS_WALLET,
+		}
+	}
+
+	if err := svc.CompletePurchase(ctx, uuid.New(), latte(), nil); !errors.Is(err, purchase.ErrWalletUnavailable) {
+		t.Fatalf("expected wallets to be off without the flag but got %v", err)
+	}
+	flags.Set(feature.WalletPayments, feature.Rule{Everyone: true})
+	if err := svc.CompletePurchase(ctx, uuid.New(), latte(), nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	a, _ := wallets.Account(ctx, alice)
+	if a.Balance() != 550 || a.Held() != 0 {
+		t.Fatalf("expected 4.50 spent from the wallet but got %d with %d held", a.Balance(), a.Held())
+	}
+
+	failing := purchase.NewService(instant{}, failingPurchases{}, percentOff(0), purchase.WithWallet(wallets), purchase.WithFeatureFlags(flags))
+	if err := failing.CompletePurchase(ctx, uuid.New(), latte(), nil); err == nil {
+		t.Fatal("expected the purchase to fail to be stored")
+	}
+	if a, _ = wallets.Account(ctx, alice); a.Available() != 550 {
+		t.Fatalf("expected the hold of the failed purchase to be released but %d is available", a.Available())
+	}
+}
+
+type topUps struct{}
+
+func (topUps) Charge(context.Context, money.Money, string) (string, error) { return "ch_1", nil }
+func (topUps) RefundAmount(context.Context, string, money.Money) error     { return nil }
+
+type failingPurchases struct{ noPurchases }
+
+func (failingPurchases) Store(context.Context, *purchase.Purchase) error {
+	return errors.New("mongo is down")
+}
+
+func Test_InvalidPurchasesReportEveryViolation(t *testing.T) {
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0))
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{
+			{ItemName: "latte", BasePrice: *money.New(450, "USD")},
+			{ItemName: "croissant", BasePrice: *money.New(300, "EUR")},
+		},
+		PaymentMeans: payment.MEANS_CARD,
+	}
+	err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil)
+	var violations validation.Errors
+	if !errors.As(err, &violations) || len(violations) != 2 {
+		t.Fatalf("expected 2 violations but got %v", err)
+	}
+	if !errors.Is(err, purchase.ErrMixedCurrencies) || violations[0].Field != "products[1].price" {
+		t.Fatalf("expected the croissant to be in the wrong currency but got %v", err)
+	}
+	if !errors.Is(err, purchase.ErrMissingCardToken) || violations[1].Field != "cardToken" {
+		t.Fatalf("expected the card token to be missing but got %v", err)
+	}
+}
+
+func Test_RefundsAreDispatchedThroughTheCommandBus(t *testing.T) {
+	ctx := context.Background()
+	wallets := wallet.NewService(wallet.NewMemoryRepo(), topUps{}, wallet.Limits{Currency: "USD"})
+	alice, storeID := uuid.New(), uuid.New()
+	if _, err := wallets.TopUp(ctx, alice, *money.New(1000, "USD"), "tok"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	flags := feature.NewMemory()
+	flags.Set(feature.WalletPayments, feature.Rule{Everyone: true})
+	svc := purchase.NewService(instant{}, testsupport.NewFakePurchases(), percentOff(0), purchase.WithWallet(wallets), purchase.WithFeatureFlags(flags))
+	commands := purchase.NewDispatcher(svc, command.NewBus(command.Authorize(), command.Validate()))
+
+	manager := auth.WithPrincipal(ctx, auth.Principal{Subject: "manager", Roles: []auth.Role{auth.RoleManager}, Stores: []uuid.UUID{storeID}})
+	p := &purchase.Purchase{
+		Store:              store.Ref(storeID),
+		CustomerID:         alice,
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+		PaymentMeans:       payment.MEANS_WALLET,
+	}
+	if err := commands.CompletePurchase(manager, storeID, p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	if err := commands.Refund(ctx, storeID, p.ID, *money.New(200, "USD")); !errors.Is(err, auth.ErrUnauthenticated) {
+		t.Fatalf("expected refunds to need a caller but got %v", err)
+	}
+	customer := auth.WithPrincipal(ctx, auth.Principal{Subject: alice.String(), CustomerID: alice, Roles: []auth.Role{auth.RoleCustomer}})
+	if err := commands.Refund(customer, storeID, p.ID, *money.New(200, "USD")); !errors.Is(err, auth.ErrForbidden) {
+		t.Fatalf("expected customers not to refund themselves but got %v", err)
+	}
+	if err := commands.Refund(manager, storeID, p.ID, *money.New(0, "USD")); !errors.Is(err, purchase.ErrInvalidRefund) {
+		t.Fatalf("expected a refund of nothing to be invalid but got %v", err)
+	}
+	if err := commands.Refund(manager, storeID, p.ID, *money.New(200, "USD")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if a, _ := wallets.Account(ctx, alice); a.Balance() != 750 {
+		t.Fatalf("expected 2.00 back in the wallet but it holds %d", a.Balance())
+	}
+}
+
+func Test_QuotedPurchasesAreChargedAtTheQuotedPriceUntilTheQuoteExpires(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		storeID  = uuid.New()
+		customer = uuid.New()
+		now      = time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	)
+	engine := pricing.NewEngine(pricing.Rules{BasePrices: map[string]int64{"croissant": 300, "latte": 400}})
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0),
+		purchase.WithPricing(engine), purchase.WithPasses(&pass{}), purchase.WithClock(func() time.Time { return now }),
+		purchase.WithQuoteSigning([]byte("secret"), 10*time.Minute), purchase.WithTax(25))
+	products := func(items ...string) []coffeeco.Product {
+		var res []coffeeco.Product
+		for _, item := range items {
+			res = append(res, coffeeco.Product{ItemName: item, BasePrice: *money.New(1, "USD")})
+		}
+		return res
+	}
+
+	q, err := svc.QuotePurchase(ctx, storeID, products("croissant", "latte"), customer)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(q.Covered) != 1 || q.Covered[0] != 1 || q.Total.Amount() != 300 || q.Tax.Amount() != 60 {
+		t.Fatalf("expected the pass to cover the latte and 3.00 including 0.60 tax but got %v, %s and %s", q.Covered, q.Total.Display(), q.Tax.Display())
+	}
+	if len(q.Tips) != 3 || q.Tips[2].Amount.Amount() != 60 {
+		t.Fatalf("expected 10, 15 and 20%% tips but got %+v", q.Tips)
+	}
+
+	complete := func(token string, items ...string) (*purchase.Purchase, error) {
+		p := &purchase.Purchase{CustomerID: customer, ProductsToPurchase: products(items...), PaymentMeans: payment.MEANS_CASH, QuoteToken: token}
+		return p, svc.CompletePurchase(ctx, storeID, p, nil)
+	}
+	engine.Replace(pricing.Rules{BasePrices: map[string]int64{"croissant": 350, "latte": 400}})
+	now = now.Add(9 * time.Minute)
+	p, err := complete(q.Token, "croissant", "latte")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := p.Total(); total.Amount() != 300 {
+		t.Fatalf("expected the quoted 3.00 rather than the new price but got %s", total.Display())
+	}
+	if _, err := complete(q.Token, "croissant", "croissant", "latte"); !errors.Is(err, purchase.ErrQuoteMismatch) {
+		t.Fatalf("expected ErrQuoteMismatch but got %v", err)
+	}
+	if _, err := complete(q.Token+"x", "croissant", "latte"); !errors.Is(err, purchase.ErrInvalidQuote) {
+		t.Fatalf("expected ErrInvalidQuote but got %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := complete(q.Token, "croissant", "latte"); !errors.Is(err, purchase.ErrQuoteExpired) {
+		t.Fatalf("expected ErrQuoteExpired but got %v", err)
+	}
+}
+
+// authorizations remembers what happened to every card authorization.
+type authorizations map[string]string
+
+func (a authorizations) Authorize(context.Context, money.Money, string) (string, error) {
+	id := uuid.NewString()
+	a[id] = "authorized"
+	return id, nil
+}
+
+func (a authorizations) Capture(_ context.Context, id string, _ money.Money) error {
+	a[id] = "captured"
+	return nil
+}
+
+func (a authorizations) Void(_ context.Context, id string) error {
+	a[id] = "voided"
+	return nil
+}
+
+type managers []uuid.UUID
+
+func (m *managers) ReviewRequested(_ context.Context, r *purchase.Review) error {
+	*m = append(*m, r.ID())
+	return nil
+}
+
+func Test_LargeCardPurchasesWaitForAManagerBeforeTheCardIsCaptured(t *testing.T) {
+	var (
+		ctx      = audit.WithActor(context.Background(), "manager@coffeeco")
+		storeID  = uuid.New()
+		bigStore = uuid.New()
+		now      = time.Now()
+		token    = "tok_visa"
+		cards    = authorizations{}
+		told     managers
+		repo     = testsupport.NewFakePurchases()
+	)
+	policy := purchase.ReviewPolicy{Currency: "USD", Threshold: 1000, Stores: map[uuid.UUID]int64{bigStore: 5000}, Timeout: 30 * time.Minute}
+	svc := purchase.NewService(instant{}, repo, percentOff(0), purchase.WithClock(func() time.Time { return now }),
+		purchase.WithReviews(policy, purchase.NewMemoryReviewRepo(), cards), purchase.WithReviewNotifier(&told))
+	buy := func(storeID uuid.UUID) (*purchase.Purchase, error) {
+		p := &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "espresso machine", BasePrice: *money.New(1200, "USD")}},
+			PaymentMeans:       payment.MEANS_CARD,
+			CardToken:          &token,
+		}
+		return p, svc.CompletePurchase(ctx, storeID, p, nil)
+	}
+
+	if _, err := buy(bigStore); err != nil {
+		t.Fatalf("expected 12.00 to be under the threshold of the big store but got %v", err)
+	}
+	approved, err := buy(storeID)
+	if !errors.Is(err, purchase.ErrHeldForReview) {
+		t.Fatalf("expected ErrHeldForReview but got %v", err)
+	}
+	if _, err := repo.Get(ctx, approved.ID); !errors.Is(err, purchase.ErrNotFound) {
+		t.Fatalf("expected the held purchase not to be stored yet but got %v", err)
+	}
+	if len(told) != 1 || told[0] != approved.ID {
+		t.Fatalf("expected the manager to be told about the held purchase but got %v", told)
+	}
+	r, err := svc.ApproveReview(ctx, approved.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != purchase.ReviewApproved || r.DecidedBy() != "manager@coffeeco" || cards[r.AuthorizationID] != "captured" {
+		t.Fatalf("expected the card to be captured on approval by manager@coffeeco but got %s by %s, %s", r.Status(), r.DecidedBy(), cards[r.AuthorizationID])
+	}
+	if _, err := repo.Get(ctx, approved.ID); err != nil {
+		t.Fatalf("expected the approved purchase to be stored but got %v", err)
+	}
+
+	rejected, _ := buy(storeID)
+	if r, err = svc.RejectReview(ctx, rejected.ID, "customer left"); err != nil || cards[r.AuthorizationID] != "voided" {
+		t.Fatalf("expected the authorization of the rejected purchase to be voided but got %v", err)
+	}
+
+	expired, _ := buy(storeID)
+	now = now.Add(31 * time.Minute)
+	if n, err := svc.ExpireReviews(ctx); n != 1 || err != nil {
+		t.Fatalf("expected 1 review to time out but got %d, %v", n, err)
+	}
+	if _, err := svc.ApproveReview(ctx, expired.ID); !errors.Is(err, purchase.ErrReviewDecided) {
+		t.Fatalf("expected a timed-out purchase not to be approved but got %v", err)
+	}
+	if pending, _ := svc.PendingReviews(ctx, storeID); len(pending) != 0 {
+		t.Fatalf("expected nothing left to review but got %d", len(pending))
+	}
+}
+
+func Test_ApprovedPurchasesStampTheLoyaltyCardTheyWereMadeWith(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "manager@coffeeco")
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Store{}, coffeeco.CoffeeLover{ID: uuid.New()})
+	if err := cards.Save(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+	pub := &published{}
+	policy := purchase.ReviewPolicy{Currency: "USD", Threshold: 1000}
+	svc := purchase.NewService(instant{}, testsupport.NewFakePurchases(), percentOff(0), purchase.WithEventPublisher(pub),
+		purchase.WithReviews(policy, purchase.NewMemoryReviewRepo(), authorizations{}), purchase.WithLoyaltyCards(cards))
+	token := "tok_visa"
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "espresso machine", BasePrice: *money.New(1200, "USD")}},
+		PaymentMeans:       payment.MEANS_CARD,
+		CardToken:          &token,
+	}
+	if err := svc.CompletePurchase(ctx, uuid.New(), p, card); !errors.Is(err, purchase.ErrHeldForReview) {
+		t.Fatalf("expected ErrHeldForReview but got %v", err)
+	}
+	if got, _ := cards.Get(ctx, card.ID); got.RemainingDrinkPurchasesUntilFreeDrink != 10 {
+		t.Fatalf("expected the card not to be stamped while the purchase is held but %d drinks are left", got.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+
+	if _, err := svc.ApproveReview(ctx, p.ID); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if got, _ := cards.Get(ctx, card.ID); got.RemainingDrinkPurchasesUntilFreeDrink != 9 {
+		t.Fatalf("expected the card to be stamped on approval but %d drinks are left", got.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+	var stamped bool
+	for _, e := range *pub {
+		_, ok := e.(loyalty.StampAdded)
+		stamped = stamped || ok
+	}
+	if !stamped {
+		t.Fatalf("expected the stamp to be published but got %v", *pub)
+	}
+}
+
+// decidedElsewhere is a review repository another manager saves every decision to first.
+type decidedElsewhere struct {
+	*purchase.MemoryReviewRepository
+}
+
+func (d decidedElsewhere) Save(ctx context.Context, r *purchase.Review) error {
+	if r.Status() != purchase.ReviewPending {
+		return purchase.ErrReviewConflict
+	}
+	return d.MemoryReviewRepository.Save(ctx, r)
+}
+
+func Test_ApprovalsThatLoseTheRaceDoNotCaptureTheCard(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "manager@coffeeco")
+	cards := authorizations{}
+	policy := purchase.ReviewPolicy{Currency: "USD", Threshold: 1000}
+	svc := purchase.NewService(instant{}, testsupport.NewFakePurchases(), percentOff(0),
+		purchase.WithReviews(policy, decidedElsewhere{purchase.NewMemoryReviewRepo()}, cards))
+	token := "tok_visa"
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "espresso machine", BasePrice: *money.New(1200, "USD")}},
+		PaymentMeans:       payment.MEANS_CARD,
+		CardToken:          &token,
+	}
+	if err := svc.CompletePurchase(ctx, uuid.New(), p, nil); !errors.Is(err, purchase.ErrHeldForReview) {
+		t.Fatalf("expected ErrHeldForReview but got %v", err)
+	}
+
+	if _, err := svc.ApproveReview(ctx, p.ID); !errors.Is(err, purchase.ErrReviewConflict) {
+		t.Fatalf("expected ErrReviewConflict but got %v", err)
+	}
+	for id, state := range cards {
+		if state != "authorized" {
+			t.Fatalf("expected authorization %s to be left for the manager who decided but it was %s", id, state)
+		}
+	}
+}
+
+// brokenCodes cannot hand out short receipt codes.
+type brokenCodes struct{}
+
+func (brokenCodes) Assign(context.Context, uuid.UUID, uuid.UUID, time.Time) (string, error) {
+	return "", errors.New("receipt codes are down")
+}
+
+func Test_CompletedPurchasesGetAShortReceiptCode(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	repo := testsupport.NewFakePurchases()
+	codes := receipt.NewCodes(receipt.NewMemoryCodeRepo())
+	svc := purchase.NewService(instant{}, repo, percentOff(0), purchase.WithReceiptCodes(codes))
+	p := &purchase.Purchase{ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}}, PaymentMeans: payment.MEANS_CASH}
+	if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	stored, err := repo.Get(ctx, p.ID)
+	if err != nil || stored.ReceiptCode == "" || stored.ReceiptCode != p.ReceiptCode {
+		t.Fatalf("expected the purchase to be stored with its code %q but got %q, %v", p.ReceiptCode, stored.ReceiptCode, err)
+	}
+	if got, err := codes.Lookup(ctx, storeID, p.PurchasedAt().UTC().Format(time.DateOnly), p.ReceiptCode); err != nil || got != p.ID {
+		t.Fatalf("expected the code to find %s but got %s, %v", p.ID, got, err)
+	}
+
+	svc = purchase.NewService(instant{}, repo, percentOff(0), purchase.WithReceiptCodes(brokenCodes{}))
+	p = &purchase.Purchase{ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}}, PaymentMeans: payment.MEANS_CASH}
+	if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil || p.ReceiptCode != "" {
+		t.Fatalf("expected the purchase to complete without a code but got %q, %v", p.ReceiptCode, err)
+	}
+}
+
+func Test_CashTotalsAreRoundedToTheSmallestCoin(t *testing.T) {
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithCashRounding(purchase.CashRounding{"CHF": 5}))
+	for _, tc := range []struct {
+		price    int64
+		means    payment.Means
+		total    int64
+		rounding int64
+	}{
+		{423, payment.MEANS_CASH, 425, 2},
+		{422, payment.MEANS_CASH, 420, -2},
+		{420, payment.MEANS_CASH, 420, 0},
+		{423, payment.MEANS_CARD, 423, 0},
+	} {
+		token := "tok"
+		p := &purchase.Purchase{ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(tc.price, "CHF")}}, PaymentMeans: tc.means, CardToken: &token}
+		if err := svc.CompletePurchase(context.Background(), uuid.New(), p, nil); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if got, rounding := p.Total(), p.Rounding(); got.Amount() != tc.total || rounding.Amount() != tc.rounding {
+			t.Fatalf("expected %d paid by %s to be %d rounded by %d but got %d rounded by %d", tc.price, tc.means, tc.total, tc.rounding, got.Amount(), rounding.Amount())
+		}
+	}
+}
+
+func Test_StoresCanStopTakingAPaymentMeansForAWhile(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	stores := store.NewService(store.NewMemoryRepo(), store.WithPaymentMeans(store.NewMemoryMeansRepo()))
+	if _, err := stores.SetPaymentMeans(ctx, storeID, []payment.Means{payment.MEANS_CASH, payment.MEANS_WALLET}, "card reader broken"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithStoreMeans(stores))
+	token := "tok"
+	latte := func(means payment.Means) *purchase.Purchase {
+		return &purchase.Purchase{ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}}, PaymentMeans: means, CardToken: &token}
+	}
+
+	err := svc.CompletePurchase(ctx, storeID, latte(payment.MEANS_CARD), nil)
+	var violations validation.Errors
+	if !errors.Is(err, purchase.ErrMeansNotTaken) || !errors.As(err, &violations) {
+		t.Fatalf("expected card to be turned away but got %v", err)
+	}
+	if want := "card is not taken at this store right now (card reader broken); pay with cash or wallet"; violations[0].Message != want {
+		t.Fatalf("expected %q but got %q", want, violations[0].Message)
+	}
+	if err := svc.CompletePurchase(ctx, storeID, latte(payment.MEANS_CASH), nil); err != nil {
+		t.Fatalf("expected cash to be taken but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, uuid.New(), latte(payment.MEANS_CARD), nil); err != nil {
+		t.Fatalf("expected other stores to take cards but got %v", err)
+	}
+
+	if _, err := stores.SetPaymentMeans(ctx, storeID, nil, ""); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, storeID, latte(payment.MEANS_CARD), nil); err != nil {
+		t.Fatalf("expected cards to be taken again but got %v", err)
+	}
+	if _, err := stores.SetPaymentMeans(ctx, storeID, []payment.Means{"cheque"}, ""); !errors.Is(err, store.ErrUnknownMeans) {
+		t.Fatalf("expected cheques to be unknown but got %v", err)
+	}
+}
+
+func Test_IdenticalPurchasesInQuickSuccessionNeedConfirming(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	now := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	repo := testsupport.NewFakePurchases()
+	options := pricing.NewEngine(pricing.Rules{Sizes: map[string]int64{"large": 60}, Modifiers: map[string]int64{"oat milk": 50}})
+	svc := purchase.NewService(instant{}, repo, percentOff(0), purchase.WithClock(func() time.Time { return now }), purchase.WithDuplicateCheck(repo, time.Minute), purchase.WithPricing(options))
+	tap := func(token string, items ...string) *purchase.Purchase {
+		p := &purchase.Purchase{Store: store.Ref(storeID), PaymentMeans: payment.MEANS_CARD, CardToken: &token}
+		for _, item := range items {
+			p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{ItemName: item, BasePrice: *money.New(400, "USD")})
+		}
+		return p
+	}
+	if err := svc.CompletePurchase(ctx, storeID, tap("tok_1", "latte", "cookie"), nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	now = now.Add(20 * time.Second)
+	again := tap("tok_1", "cookie", "latte")
+	var violations validation.Errors
+	if err := svc.CompletePurchase(ctx, storeID, again, nil); !errors.Is(err, purchase.ErrPossibleDuplicate) || !errors.As(err, &violations) || violations[0].Field != "confirmDuplicate" {
+		t.Fatalf("expected the second tap to need confirming but got %v", err)
+	}
+	for name, p := range map[string]*purchase.Purchase{
+		"another card":    tap("tok_2", "latte", "cookie"),
+		"other items":     tap("tok_1", "latte"),
+		"a confirmed one": func() *purchase.Purchase { p := tap("tok_1", "latte", "cookie"); p.ConfirmDuplicate = true; return p }(),
+		"another size": func() *purchase.Purchase {
+			p := tap("tok_1", "latte", "cookie")
+			p.ProductsToPurchase[0].Size = "large"
+			return p
+		}(),
+		"other modifiers": func() *purchase.Purchase {
+			p := tap("tok_1", "latte", "cookie")
+			p.ProductsToPurchase[0].Modifiers = []string{"oat milk"}
+			return p
+		}(),
+	} {
+		if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil {
+			t.Fatalf("expected %s to go through but got %v", name, err)
+		}
+	}
+	elsewhere := tap("tok_1", "latte", "cookie")
+	elsewhere.Store = store.Ref(uuid.New())
+	if err := svc.CompletePurchase(ctx, elsewhere.Store.ID, elsewhere, nil); err != nil {
+		t.Fatalf("expected the same purchase at another store to go through but got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := svc.CompletePurchase(ctx, storeID, tap("tok_1", "latte", "cookie"), nil); err != nil {
+		t.Fatalf("expected the same purchase after the window to go through but got %v", err)
+	}
+}
+
+// held holds every charge until it is let go, failing it with err.
+type held struct {
+	charging chan struct{}
+	letGo    chan error
+}
+
+func (h held) ChargeCard(context.Context, money.Money, string) error {
+	h.charging <- struct{}{}
+	return <-h.letGo
+}
+
+func Test_ASecondTapWhileTheFirstIsChargedNeedsConfirming(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	repo := testsupport.NewFakePurchases()
+	card := held{charging: make(chan struct{}), letGo: make(chan error)}
+	svc := purchase.NewService(card, repo, percentOff(0), purchase.WithDuplicateCheck(repo, time.Minute))
+	tap := func() *purchase.Purchase {
+		token := "tok_1"
+		return &purchase.Purchase{
+			Store:              store.Ref(storeID),
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}},
+			PaymentMeans:       payment.MEANS_CARD,
+			CardToken:          &token,
+		}
+	}
+	first := make(chan error)
+	charge := func() {
+		go func() { first <- svc.CompletePurchase(ctx, storeID, tap(), nil) }()
+		<-card.charging
+	}
+
+	charge()
+	if err := svc.CompletePurchase(ctx, storeID, tap(), nil); !errors.Is(err, purchase.ErrPossibleDuplicate) {
+		t.Fatalf("expected the second tap to need confirming while the first is charged but got %v", err)
+	}
+	card.letGo <- errors.New("card declined")
+	if err := <-first; err == nil {
+		t.Fatal("expected the first tap to be declined")
+	}
+
+	// A declined tap is not a purchase made, so tapping again is not a duplicate.
+	charge()
+	card.letGo <- nil
+	if err := <-first; err != nil {
+		t.Fatalf("expected the tap after a declined one to go through but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, storeID, tap(), nil); !errors.Is(err, purchase.ErrPossibleDuplicate) {
+		t.Fatalf("expected a tap after the purchase was made to need confirming but got %v", err)
+	}
+}
+
+func Test_OnlyPurchasesOfSomeChannelsEarnStamps(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(storeID), coffeeco.CoffeeLover{ID: uuid.New()})
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithStampChannels(purchase.ChannelInStore, purchase.ChannelDelivery))
+	latte := func(means payment.Means) *purchase.Purchase {
+		return &purchase.Purchase{
+			Store:              store.Ref(storeID),
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       means,
+		}
+	}
+
+	inStore := latte(payment.MEANS_CASH)
+	if err := svc.CompletePurchase(ctx, storeID, inStore, card); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if inStore.Channel != purchase.ChannelInStore || card.RemainingDrinkPurchasesUntilFreeDrink != 9 {
+		t.Fatalf("expected an in_store purchase earning a stamp but got %s with %d to go", inStore.Channel, card.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+	viaMarketplace := latte(payment.MEANS_MARKETPLACE)
+	if err := svc.CompletePurchase(ctx, storeID, viaMarketplace, card); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if viaMarketplace.Channel != purchase.ChannelMarketplace || card.RemainingDrinkPurchasesUntilFreeDrink != 9 {
+		t.Fatalf("expected a marketplace purchase earning nothing but got %s with %d to go", viaMarketplace.Channel, card.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+
+	unknown := latte(payment.MEANS_CASH)
+	unknown.Channel = "carrier_pigeon"
+	if err := svc.CompletePurchase(ctx, storeID, unknown, card); !errors.Is(err, purchase.ErrUnknownChannel) {
+		t.Fatalf("expected ErrUnknownChannel but got %v", err)
+	}
+}
+
+func Test_OrderingThroughAChannelCanCostAFee(t *testing.T) {
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithChannelFees(purchase.ChannelFees{purchase.ChannelApp: {"USD": 25}}))
+	order := func(channel purchase.Channel) *purchase.Purchase {
+		return &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       payment.MEANS_CASH,
+			Channel:            channel,
+		}
+	}
+
+	app := order(purchase.ChannelApp)
+	if err := svc.CompletePurchase(context.Background(), uuid.New(), app, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := app.Total(); total.Amount() != 475 || len(app.Charges) != 1 || app.Charges[0].Type != purchase.ChargeChannelFee || app.Charges[0].Payee != purchase.PayeeStore {
+		t.Fatalf("expected 4.50 and a 0.25 channel fee owed to the store but got %s with %+v", total.Display(), app.Charges)
+	}
+	inStore := order("")
+	if err := svc.CompletePurchase(context.Background(), uuid.New(), inStore, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := inStore.Total(); total.Amount() != 450 || inStore.Channel != purchase.ChannelInStore {
+		t.Fatalf("expected an in_store purchase at 4.50 but got %s at %s", inStore.Channel, total.Display())
+	}
+	if _, err := purchase.ParseChannel("fax"); !errors.Is(err, purchase.ErrUnknownChannel) {
+		t.Fatalf("expected ErrUnknownChannel but got %v", err)
+	}
+}
+
+func Test_ManagersOverridePricesForAReason(t *testing.T) {
+	ctx := audit.WithActor(context.Background(), "manager@coffeeco")
+	log := audit.NewMemoryRepo()
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithAuditLog(log))
+	order := func(overrides ...purchase.PriceOverride) *purchase.Purchase {
+		return &purchase.Purchase{
+			ProductsToPurchase: []coffeeco.Product{
+				{ItemName: "latte", BasePrice: *money.New(450, "USD")},
+				{ItemName: "muffin", BasePrice: *money.New(300, "USD")},
+				{ItemName: "cookie", BasePrice: *money.New(150, "USD")},
+			},
+			PaymentMeans: payment.MEANS_CASH,
+			Overrides:    overrides,
+		}
+	}
+
+	// The spilled latte is made again for nothing, and what is left is halved as a goodwill gesture.
+	p := order(
+		purchase.PriceOverride{Product: purchase.WholePurchase, Price: *money.New(225, "USD"), Reason: purchase.OverrideGoodwill},
+		purchase.PriceOverride{Product: 0, Price: *money.New(0, "USD"), Reason: purchase.OverrideRemake, Note: "spilled"},
+	)
+	if err := svc.CompletePurchase(ctx, uuid.New(), p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := p.Total(); total.Amount() != 225 {
+		t.Fatalf("expected 2.25 but got %s", total.Display())
+	}
+	if muffin, cookie := p.ProductsToPurchase[1].BasePrice, p.ProductsToPurchase[2].BasePrice; muffin.Amount() != 150 || cookie.Amount() != 75 {
+		t.Fatalf("expected the muffin at 1.50 and the cookie at 0.75 but got %s and %s", muffin.Display(), cookie.Display())
+	}
+	for _, o := range p.Overrides {
+		if given := o.Given(); o.By != "manager@coffeeco" || given.Amount() != map[purchase.OverrideReason]int64{purchase.OverrideRemake: 450, purchase.OverrideGoodwill: 225}[o.Reason] {
+			t.Fatalf("expected the overrides to be the manager's and to give 4.50 and 2.25 but got %+v", p.Overrides)
+		}
+	}
+	entries, _ := log.Query(ctx, audit.Query{From: time.Now().Add(-time.Minute), To: time.Now().Add(time.Minute)})
+	if len(entries) != 2 || entries[0].Action != audit.ActionPriceOverride || entries[0].Actor != "manager@coffeeco" {
+		t.Fatalf("expected both overrides in the audit log but got %+v", entries)
+	}
+
+	raised := order(purchase.PriceOverride{Product: 1, Price: *money.New(350, "USD"), Reason: purchase.OverridePriceMatch})
+	if err := svc.CompletePurchase(ctx, uuid.New(), raised, nil); !errors.Is(err, purchase.ErrOverrideRaisesPrice) {
+		t.Fatalf("expected ErrOverrideRaisesPrice but got %v", err)
+	}
+	var violations validation.Errors
+	unexplained := order(purchase.PriceOverride{Product: 3, Price: *money.New(0, "USD")})
+	if err := svc.CompletePurchase(ctx, uuid.New(), unexplained, nil); !errors.As(err, &violations) || len(violations) != 2 {
+		t.Fatalf("expected an override of no product and for no reason to be turned away but got %v", err)
+	}
+}
+
+// testMode is the payment gateway in test mode, keeping what it was asked to charge.
+type testMode []money.Money
+
+func (m *testMode) ChargeCard(_ context.Context, amount money.Money, _ string) error {
+	*m = append(*m, amount)
+	return nil
+}
+
+// kept are the purchases stored, by ID.
+type kept map[uuid.UUID]*purchase.Purchase
+
+func (k kept) Store(_ context.Context, p *purchase.Purchase) error {
+	k[p.ID] = p
+	return nil
+}
+
+func (k kept) Get(_ context.Context, id uuid.UUID) (purchase.Purchase, error) {
+	p, ok := k[id]
+	if !ok {
+		return purchase.Purchase{}, purchase.ErrNotFound
+	}
+	return *p, nil
+}
+
+func (kept) Ping(context.Context) error {
+	return nil
+}
+
+type published []events.Event
+
+func (p *published) Publish(_ context.Context, evts ...events.Event) error {
+	*p = append(*p, evts...)
+	return nil
+}
+
+func Test_PracticePurchasesAreChargedInTestModeAndKeptApart(t *testing.T) {
+	storeID := uuid.New()
+	real, practice := kept{}, kept{}
+	charged, pub := &testMode{}, &published{}
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(storeID), coffeeco.CoffeeLover{ID: uuid.New()})
+	latte := func(means payment.Means) *purchase.Purchase {
+		token := "tok_visa"
+		return &purchase.Purchase{
+			Store:              store.Ref(storeID),
+			ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD")}},
+			PaymentMeans:       means,
+			CardToken:          &token,
+		}
+	}
+	ctx := sandbox.With(context.Background())
+
+	svc := purchase.NewService(declined{}, real, percentOff(0), purchase.WithEventPublisher(pub))
+	if err := svc.CompletePurchase(ctx, storeID, latte(payment.MEANS_CARD), nil); !errors.Is(err, sandbox.ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable without a sandbox but got %v", err)
+	}
+
+	svc = purchase.NewService(declined{}, real, percentOff(0), purchase.WithEventPublisher(pub), purchase.WithSandbox(charged, practice))
+	p := latte(payment.MEANS_CARD)
+	if err := svc.CompletePurchase(ctx, storeID, p, card); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(*charged) != 1 || (*charged)[0].Amount() != 450 {
+		t.Fatalf("expected $4.50 charged in test mode but got %v", *charged)
+	}
+	if practice[p.ID] == nil || len(real) != 0 || len(*pub) != 0 || card.RemainingDrinkPurchasesUntilFreeDrink != 10 {
+		t.Fatalf("expected the purchase kept apart, unpublished and unstamped but got %d real purchases, %d events and %d drinks to go",
+			len(real), len(*pub), card.RemainingDrinkPurchasesUntilFreeDrink)
+	}
+	if _, err := svc.GetPurchase(ctx, p.ID); err != nil {
+		t.Fatalf("expected the purchase found in practice but got %v", err)
+	}
+	if _, err := svc.GetPurchase(context.Background(), p.ID); !errors.Is(err, purchase.ErrNotFound) {
+		t.Fatalf("expected the purchase not found for real but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, storeID, latte(payment.MEANS_COFFEEBUX), card); !errors.Is(err, purchase.ErrPracticeMeans) {
+		t.Fatalf("expected ErrPracticeMeans but got %v", err)
+	}
+}
+
+func Test_SpecificationsTranslateToSQL(t *testing.T) {
+	storeID := uuid.New()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	spec := purchase.ByStore(storeID).
+		And(purchase.Between(from, from.AddDate(0, 1, 0))).
+		And(purchase.MeansIs(payment.MEANS_CARD).Or(purchase.Not(purchase.MeansIs(payment.MEANS_CASH))))
+
+	where, args := purchase.SQLWhere(spec, purchase.SQLColumns{
+		Store: "store_id", Customer: "customer_id", PurchasedAt: "purchased_at", Means: "payment_means",
+	})
+	want := "((store_id = $1 AND (purchased_at >= $2 AND purchased_at < $3)) AND (payment_means = $4 OR NOT (payment_means = $5)))"
+	if where != want {
+		t.Fatalf("expected %s but got %s", want, where)
+	}
+	if len(args) != 5 || args[0] != storeID || args[3] != string(payment.MEANS_CARD) {
+		t.Fatalf("expected the arguments in placeholder order but got %v", args)
+	}
+}
+
+func Test_PurchasesRecordTheExperimentVariantTheyWerePricedIn(t *testing.T) {
+	ctx := context.Background()
+	storeID, customer := uuid.New(), uuid.New()
+	experiments := experiment.NewService([]experiment.Experiment{{
+		Name:     "deeper-discount",
+		Percent:  100,
+		Variants: []experiment.Variant{{Name: "twenty", Weight: 1, DiscountPercent: 20}},
+	}})
+	engine := pricing.NewEngine(pricing.Rules{}, pricing.WithStoreDiscounts(percentOff(10)), pricing.WithExperiments(experiments))
+	pub := &published{}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(10), purchase.WithPricing(engine), purchase.WithEventPublisher(pub))
+
+	p := &purchase.Purchase{CustomerID: customer, ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(500, "USD")}}, PaymentMeans: payment.MEANS_CASH}
+	if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := p.Total(); total.Amount() != 400 || p.Experiment.Variant != "twenty" {
+		t.Fatalf("expected the variant's 20%% off recorded on the purchase but got %s in %+v", total.Display(), p.Experiment)
+	}
+	completed, ok := (*pub)[0].(purchase.Completed)
+	if !ok || completed.Experiment != "deeper-discount" || completed.Variant != "twenty" {
+		t.Fatalf("expected the variant on the completed event but got %+v", (*pub)[0])
+	}
+}
+
+type bakery []purchase.Substitution
+
+func (b bakery) Suggest(context.Context, uuid.UUID, []string) ([]purchase.Substitution, error) {
+	return b, nil
+}
+
+func Test_OutOfStockPurchasesSuggestSubstitutesTheCustomerCanAccept(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	stock := inventory.NewService(inventory.NewMemoryRepo(), nil)
+	if err := stock.Restock(ctx, storeID, "pain au chocolat", 1); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	// The last croissant was sold, so croissants are tracked and none are left.
+	sold := uuid.New()
+	if err := stock.Restock(ctx, storeID, "croissant", 1); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := stock.Reserve(ctx, storeID, sold, []coffeeco.Product{{ItemName: "croissant"}}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := stock.Commit(ctx, storeID, sold); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	suggested := bakery{{Product: "croissant", Substitute: "pain au chocolat", UnitPrice: *money.New(320, "USD")}}
+	svc := purchase.NewService(instant{}, noPurchases{}, percentOff(0), purchase.WithInventory(stock), purchase.WithSubstitutes(suggested))
+	token := "tok_visa"
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "croissant", BasePrice: *money.New(300, "USD")}},
+		PaymentMeans:       payment.MEANS_CARD,
+		CardToken:          &token,
+	}
+
+	err := svc.CompletePurchase(ctx, storeID, p, nil)
+	var oos *purchase.OutOfStockError
+	if !errors.As(err, &oos) || !errors.Is(err, inventory.ErrOutOfStock) || len(oos.Suggestions) != 1 {
+		t.Fatalf("expected the pain au chocolat suggested but got %v", err)
+	}
+	p.Substitutes = map[string]string{"croissant": oos.Suggestions[0].Substitute}
+	if err := svc.CompletePurchase(ctx, storeID, p, nil); err != nil {
+		t.Fatalf("expected the substitute to be sold but got %v", err)
+	}
+	if got := p.ProductsToPurchase[0].ItemName; got != "pain au chocolat" {
+		t.Fatalf("expected the pain au chocolat to be sold but got %s", got)
+	}
+}
@@ -0,0 +1,256 @@
+package purchasetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// RunRepositoryTests checks that a purchase.Repository behaves as the service relies on. newRepo returns
+// the repository to test; it may share a database with other runs, as every test uses IDs of its own. Run
+// it from the tests of an adapter, e.g.
+//
+//	func Test_RepositoryContract(t *testing.T) {
+//		purchasetest.RunRepositoryTests(t, func(t *testing.T) purchase.Repository { return newAdapter(t) })
+//	}
+//
+// Card tokens are not checked, as only some repositories keep them.
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) purchase.Repository) {
+	t.Run("get of an unknown purchase is ErrNotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.Get(context.Background(), uuid.New()); !errors.Is(err, purchase.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound but got %v", err)
+		}
+	})
+
+	t.Run("a stored purchase is got back as it was", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := correlation.Start(context.Background(), "contract-"+uuid.NewString())
+		want, id, at := newPurchase(), uuid.New(), time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+		if err := importPurchase(ctx, repo, id, at, want); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		got, err := repo.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("expected the purchase but got %v", err)
+		}
+		assertSame(t, got, *want)
+	})
+
+	t.Run("a purchase changed after it was stored is not changed in the repository", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		p, id := newPurchase(), uuid.New()
+		if err := importPurchase(ctx, repo, id, time.Now().Add(-time.Minute), p); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		p.ProductsToPurchase[0].ItemName = "changed"
+		p.CustomerID = uuid.New()
+		got, err := repo.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("expected the purchase but got %v", err)
+		}
+		if got.ProductsToPurchase[0].ItemName != "latte" || got.CustomerID == p.CustomerID {
+			t.Fatalf("expected the purchase as it was stored but got %+v", got)
+		}
+	})
+
+	t.Run("a purchase is only imported once", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		id, at := uuid.New(), time.Now().Add(-time.Minute)
+		if err := importPurchase(ctx, repo, id, at, newPurchase()); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := importPurchase(ctx, repo, id, at, newPurchase()); !errors.Is(err, purchase.ErrAlreadyImported) {
+			t.Fatalf("expected ErrAlreadyImported but got %v", err)
+		}
+	})
+
+	t.Run("purchases stored at once are all kept", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		ids := make([]uuid.UUID, 50)
+		errs := make(chan error, len(ids))
+		var wg sync.WaitGroup
+		for i := range ids {
+			ids[i] = uuid.New()
+			wg.Go(func() {
+				errs <- importPurchase(ctx, repo, ids[i], time.Now().Add(-time.Minute), newPurchase())
+			})
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+		for _, id := range ids {
+			if _, err := repo.Get(ctx, id); err != nil {
+				t.Fatalf("expected purchase %s kept but got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("purchases are found by specification, oldest first", func(t *testing.T) {
+		finder, ok := newRepo(t).(purchase.Finder)
+		if !ok {
+			t.Skip("the repository does not find purchases by specification")
+		}
+		repo := finder.(purchase.Repository)
+		ctx := context.Background()
+		storeID, at := uuid.New(), time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+		stored := func(offset time.Duration, means payment.Means, otherStore bool) uuid.UUID {
+			p, id := newPurchase(), uuid.New()
+			if !otherStore {
+				p.Store.ID = storeID
+			}
+			p.PaymentMeans = means
+			if means == payment.MEANS_CARD {
+				token := "tok_contract"
+				p.CardToken = &token
+			}
+			if err := importPurchase(ctx, repo, id, at.Add(offset), p); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			return id
+		}
+		late := stored(2*time.Minute, payment.MEANS_CARD, false)
+		early := stored(time.Minute, payment.MEANS_CARD, false)
+		cash := stored(time.Minute, payment.MEANS_CASH, false)
+		before := stored(-time.Minute, payment.MEANS_CARD, false)
+		stored(time.Minute, payment.MEANS_CARD, true)
+
+		window := purchase.Between(at, at.Add(time.Hour))
+		cases := []struct {
+			name string
+			spec purchase.Specification
+			want []uuid.UUID
+		}{
+			{"store, time and means", purchase.ByStore(storeID).And(window).And(purchase.MeansIs(payment.MEANS_CARD)), []uuid.UUID{early, late}},
+			{"either means", purchase.ByStore(storeID).And(window, purchase.MeansIs(payment.MEANS_CARD).Or(purchase.MeansIs(payment.MEANS_CASH))), []uuid.UUID{early, cash, late}},
+			{"not in the window", purchase.ByStore(storeID).And(purchase.Not(window)), []uuid.UUID{before}},
+		}
+		for _, c := range cases {
+			found, err := finder.Find(ctx, c.spec)
+			if err != nil {
+				t.Fatalf("%s: expected no error but got %v", c.name, err)
+			}
+			got := make([]uuid.UUID, 0, len(found))
+			for _, p := range found {
+				got = append(got, p.ID)
+			}
+			if !sameIDs(got, c.want) {
+				t.Errorf("%s: expected %v but got %v", c.name, c.want, got)
+			}
+		}
+	})
+
+	t.Run("ping succeeds", func(t *testing.T) {
+		if err := newRepo(t).Ping(context.Background()); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	})
+}
+
+// importPurchase stores p through the service, the one way purchases get a time outside the
+// purchase package.
+func importPurchase(ctx context.Context, repo purchase.Repository, id uuid.UUID, at time.Time, p *purchase.Purchase) error {
+	return purchase.NewService(nil, repo, nil).ImportPurchase(ctx, id, at, p)
+}
+
+func newPurchase() *purchase.Purchase {
+	return &purchase.Purchase{
+		Store:      store.Ref(uuid.New()),
+		CustomerID: uuid.New(),
+		ProductsToPurchase: []coffeeco.Product{
+			{ItemName: "latte", BasePrice: *money.New(450, "GBP"), ReusableCup: true},
+			{ItemName: "croissant", BasePrice: *money.New(325, "GBP")},
+		},
+		PaymentMeans: payment.MEANS_CASH,
+		Delivery:     &purchase.Delivery{Address: "1 Test Street", Phone: "+44 20 7946 0000"},
+		ServedBy:     "barista-1",
+		TabID:        uuid.New(),
+		ReceiptCode:  "K7Q2M9XD",
+		Charges:      []purchase.Charge{{Type: purchase.ChargeCourierTip, Payee: purchase.PayeeCourier, Amount: *money.New(150, "GBP")}},
+	}
+}
+
+func assertSame(t *testing.T, got, want purchase.Purchase) {
+	t.Helper()
+	diffs := []struct {
+		field     string
+		got, want any
+	}{
+		{"ID", got.ID, want.ID},
+		{"Store.ID", got.Store.ID, want.Store.ID},
+		{"CustomerID", got.CustomerID, want.CustomerID},
+		{"Total", total(got), total(want)},
+		{"PaymentMeans", got.PaymentMeans, want.PaymentMeans},
+		{"ServedBy", got.ServedBy, want.ServedBy},
+		{"TabID", got.TabID, want.TabID},
+		{"ReceiptCode", got.ReceiptCode, want.ReceiptCode},
+		{"CorrelationID", got.CorrelationID(), want.CorrelationID()},
+		{"Delivery", fmt.Sprint(got.Delivery), fmt.Sprint(want.Delivery)},
+		{"Lines", lines(got), lines(want)},
+		{"Charges", charges(got), charges(want)},
+	}
+	for _, d := range diffs {
+		if d.got != d.want {
+			t.Errorf("expected %s %v but got %v", d.field, d.want, d.got)
+		}
+	}
+	// Repositories may keep less than a nanosecond's precision, but not less than a millisecond's.
+	if !got.PurchasedAt().Truncate(time.Millisecond).Equal(want.PurchasedAt().Truncate(time.Millisecond)) {
+		t.Errorf("expected PurchasedAt %s but got %s", want.PurchasedAt(), got.PurchasedAt())
+	}
+}
+
+func lines(p purchase.Purchase) string {
+	var s string
+	for _, l := range p.ProductsToPurchase {
+		s += fmt.Sprintf("%s %s %t; ", l.ItemName, l.BasePrice.Display(), l.ReusableCup)
+	}
+	return s
+}
+
+func charges(p purchase.Purchase) string {
+	var s string
+	for _, c := range p.Charges {
+		s += fmt.Sprintf("%s to %s %s; ", c.Type, c.Payee, c.Amount.Display())
+	}
+	return s
+}
+
+func total(p purchase.Purchase) string {
+	t := p.Total()
+	return t.Display()
+}
+
+// sameIDs reports whether got and want hold the same IDs, in order where their times differ. Purchases
+// made at the same time may come back either way round.
+func sameIDs(got, want []uuid.UUID) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for _, id := range want {
+		if !slices.Contains(got, id) {
+			return false
+		}
+	}
+	return got[len(got)-1] == want[len(want)-1]
+}
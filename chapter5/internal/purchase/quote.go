@@ -0,0 +1,211 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/experiment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/signing"
+	"coffeeco/internal/telemetry"
+	"coffeeco/internal/validation"
+)
+
+var (
+	ErrInvalidQuote  = errors.New("quote token is invalid")
+	ErrQuoteExpired  = errors.New("quote has expired, please quote the purchase again")
+	ErrQuoteMismatch = errors.New("purchase is not what was quoted, please quote it again")
+)
+
+// defaultTipPercents are the tips quotes suggest without WithTipSuggestions.
+var defaultTipPercents = []float64{10, 15, 20}
+
+// Quote is what a purchase would cost if it were completed now. Nothing is charged, held or used up to
+// quote it.
+type Quote struct {
+	StoreID    uuid.UUID
+	CustomerID uuid.UUID // uuid.Nil for anonymous purchases
+	// Products are the products quoted, each at the price it would be charged; those the pass pays for
+	// cost nothing.
+	Products []coffeeco.Product
+	// Covered are the products the customer's pass would pay for, by index.
+	Covered []int
+	// Pricing itemizes the price of the products the pass does not pay for, with the discounts taken. It is
+	// the zero Quote if the pass pays for everything.
+	Pricing pricing.Quote
+	Total   money.Money
+	// Tax is the part of Total that is sales tax, see WithTax.
+	Tax money.Money
+	// Tips are what the customer may add on top of Total at the terminal.
+	Tips []Tip
+	// Token completes the purchase at this quote until ExpiresAt, set as Purchase.QuoteToken. It is empty
+	// without WithQuoteSigning.
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Tip is a tip suggested on a quote, in percent of its total.
+type Tip struct {
+	Percent float64
+	Amount  money.Money
+}
+
+// WithQuoteSigning signs quotes with secret, so a purchase can be completed at the price it was quoted for
+// validFor afterwards even if the prices changed in between. Without it quotes carry no token.
+func WithQuoteSigning(secret []byte, validFor time.Duration) Option {
+	return func(s *Service) {
+		s.quoteSecret = secret
+		s.quoteValidFor = validFor
+	}
+}
+
+// WithTax shows on quotes how much of the total is sales tax, for prices that include it at percent.
+func WithTax(percent float64) Option {
+	return func(s *Service) {
+		s.taxPercent = percent
+	}
+}
+
+// WithTipSuggestions sets the tips quotes suggest, in percent of the total. It is 10, 15 and 20 otherwise.
+func WithTipSuggestions(percents ...float64) Option {
+	return func(s *Service) {
+		s.tipPercents = percents
+	}
+}
+
+// QuotePurchase prices products as CompletePurchase would for the customer at the store, without charging
+// anything or using up the customer's pass or negotiated discount. Delivery fees are only quoted when the
+// purchase is completed.
+func (s *Service) QuotePurchase(ctx context.Context, storeID uuid.UUID, products []coffeeco.Product, customerID uuid.UUID) (_ *Quote, err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.QuotePurchase", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	p := &Purchase{CustomerID: customerID, ProductsToPurchase: slices.Clone(products)}
+	var v validation.Validator
+	p.validateProducts(&v)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	p.total = p.sum()
+	p.timeOfPurchase = s.now()
+
+	q := &Quote{StoreID: storeID, CustomerID: customerID}
+	if customerID != uuid.Nil {
+		covered, err := s.passes.Preview(ctx, customerID, p.ProductsToPurchase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to preview pass: %w", err)
+		}
+		p.coverWithPass(covered)
+		q.Covered = covered
+	}
+	req, priced := p.pricingRequest(storeID)
+	claims := quoteClaims{StoreID: storeID, CustomerID: customerID, Items: make([]quotedItem, 0, len(priced))}
+	if len(priced) > 0 {
+		if q.Pricing, err = s.pricing.Quote(ctx, req); err != nil {
+			return nil, err
+		}
+		for j, item := range req.Items {
+			quoted := toQuotedItem(item)
+			quoted.Price = q.Pricing.Lines[j].Total.Amount()
+			claims.Items = append(claims.Items, quoted)
+		}
+		claims.DiscountPercent, claims.Entitlement, claims.Experiment = q.Pricing.DiscountPercent, q.Pricing.Entitlement, q.Pricing.Experiment
+		p.applyPrices(priced, q.Pricing.Lines, q.Pricing.Total)
+	}
+	q.Products, q.Total = p.ProductsToPurchase, p.total
+
+	currency := q.Total.Currency().Code
+	// Prices include the tax, so the tax is what is left of the total once the price without it is taken off.
+	q.Tax = *money.New(q.Total.Amount()-int64(math.Round(float64(q.Total.Amount())*100/(100+s.taxPercent))), currency)
+	for _, percent := range s.tipPercents {
+		q.Tips = append(q.Tips, Tip{Percent: percent, Amount: *money.New(int64(math.Round(float64(q.Total.Amount())*percent/100)), currency)})
+	}
+
+	if s.quoteSecret != nil {
+		q.ExpiresAt = p.timeOfPurchase.Add(s.quoteValidFor)
+		claims.Currency, claims.Total, claims.ExpiresAt = currency, q.Total.Amount(), q.ExpiresAt
+		if q.Token, err = signing.Sign(s.quoteSecret, claims); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// quoteClaims are what a quote token vouches for: the price of each product the pass does not pay for, in
+// the order of the purchase.
+type quoteClaims struct {
+	StoreID         uuid.UUID    `json:"store_id"`
+	CustomerID      uuid.UUID    `json:"customer_id"`
+	Items           []quotedItem `json:"items"`
+	Currency        string       `json:"currency"`
+	Total           int64        `json:"total"`
+	DiscountPercent float32      `json:"discount_percent,omitempty"`
+	Entitlement     uuid.UUID    `json:"entitlement_id"`
+	// Experiment is the variant the customer was quoted in, so the purchase records the price it was sold at.
+	Experiment experiment.Assignment `json:"experiment,omitzero"`
+	ExpiresAt  time.Time             `json:"expires_at"`
+}
+
+type quotedItem struct {
+	Product     string   `json:"product"`
+	Size        string   `json:"size,omitempty"`
+	Modifiers   []string `json:"modifiers,omitempty"`
+	ReusableCup bool     `json:"reusable_cup,omitempty"`
+	ListPrice   int64    `json:"list_price"`
+	Price       int64    `json:"price"`
+}
+
+// toQuotedItem is the item as quoted, without its price.
+func toQuotedItem(item pricing.Item) quotedItem {
+	return quotedItem{
+		Product:     item.Product,
+		Size:        item.Size,
+		Modifiers:   item.Modifiers,
+		ReusableCup: item.ReusableCup,
+		ListPrice:   item.ListPrice.Amount(),
+	}
+}
+
+// matches tells whether items are the products that were quoted, at the same list prices.
+func (c quoteClaims) matches(items []pricing.Item) bool {
+	if len(items) != len(c.Items) {
+		return false
+	}
+	for j, item := range items {
+		want, got := toQuotedItem(item), c.Items[j]
+		if got.Product != want.Product || got.Size != want.Size || !slices.Equal(got.Modifiers, want.Modifiers) ||
+			got.ReusableCup != want.ReusableCup || got.ListPrice != want.ListPrice || item.ListPrice.Currency().Code != c.Currency {
+			return false
+		}
+	}
+	return true
+}
+
+// honorQuote prices the purchase as its quote token says, if the quote is still valid and is for what is
+// left to pay once the pass paid for what it could.
+func (s *Service) honorQuote(storeID uuid.UUID, purchase *Purchase, req pricing.Request, priced []int) (float32, uuid.UUID, error) {
+	var c quoteClaims
+	if err := signing.Verify(s.quoteSecret, purchase.QuoteToken, &c); err != nil {
+		return 0, uuid.Nil, ErrInvalidQuote
+	}
+	if !purchase.timeOfPurchase.Before(c.ExpiresAt) {
+		return 0, uuid.Nil, ErrQuoteExpired
+	}
+	if c.StoreID != storeID || c.CustomerID != purchase.CustomerID || !c.matches(req.Items) {
+		return 0, uuid.Nil, ErrQuoteMismatch
+	}
+	for j, i := range priced {
+		purchase.ProductsToPurchase[i].BasePrice = *money.New(c.Items[j].Price, c.Currency)
+	}
+	purchase.total = *money.New(c.Total, c.Currency)
+	purchase.Experiment = c.Experiment
+	return c.DiscountPercent, c.Entitlement, nil
+}
@@ -2,82 +2,234 @@ package purchase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Rhymond/go-money"
 	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
 
 	coffeeco "coffeeco/internal"
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/events"
+	"coffeeco/internal/experiment"
 	"coffeeco/internal/payment"
 	"coffeeco/internal/store"
+	"coffeeco/internal/telemetry"
 )
 
 type Repository interface {
-	Store(ctx context.Context, purchase Purchase) error
+	// Store persists the purchase as the service completed it. It must not change the purchase or keep it.
+	Store(ctx context.Context, purchase *Purchase) error
+	// Get returns ErrNotFound if there is no purchase with the given ID.
+	Get(ctx context.Context, id uuid.UUID) (Purchase, error)
 	Ping(ctx context.Context) error
 }
 
 type MongoRepository struct {
+	client    *mongo.Client
 	purchases *mongo.Collection
 }
 
 func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	return newMongoRepo(ctx, connectionString, "purchases")
+}
+
+// NewMongoSandboxRepo keeps practice purchases, see WithSandbox, in a collection of their own.
+func NewMongoSandboxRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	return newMongoRepo(ctx, connectionString, "sandbox_purchases")
+}
+
+func newMongoRepo(ctx context.Context, connectionString, collection string) (*MongoRepository, error) {
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
 	}
 
-	purchases := client.Database("coffeeco").Collection("purchases")
+	purchases := client.Database("coffeeco").Collection(collection)
 
 	return &MongoRepository{
+		client:    client,
 		purchases: purchases,
 	}, nil
 }
 
-func (mr *MongoRepository) Store(ctx context.Context, purchase Purchase) error {
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (mr *MongoRepository) Close(ctx context.Context) error {
+	return mr.client.Disconnect(ctx)
+}
+
+func (mr *MongoRepository) Store(ctx context.Context, purchase *Purchase) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoRepository.Store", attribute.String("purchase.id", purchase.ID.String()))
+	defer telemetry.End(span, &err)
 	mongoP := toMongoPurchase(purchase)
-	_, err := mr.purchases.InsertOne(ctx, mongoP)
-	if err != nil {
+	if _, err := mr.purchases.InsertOne(ctx, mongoP); err != nil {
 		return fmt.Errorf("failed to persist purchase: %w", err)
 	}
 	return nil
 }
 
+func (mr *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ Purchase, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoRepository.Get", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	var mp mongoPurchase
+	if err := mr.purchases.FindOne(ctx, bson.D{{Key: "ID", Value: id}}).Decode(&mp); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Purchase{}, ErrNotFound
+		}
+		return Purchase{}, fmt.Errorf("failed to find purchase: %w", err)
+	}
+	return mp.ToPurchase(), nil
+}
+
 type mongoPurchase struct {
-	ID                 uuid.UUID          `bson:"ID"`
-	Store              store.Store        `bson:"Store"`
-	ProductsToPurchase []coffeeco.Product `bson:"products_purchased"`
-	Total              int64              `bson:"purchase_total"`
-	PaymentMeans       payment.Means      `bson:"payment_means"`
-	TimeOfPurchase     time.Time          `bson:"created_at"`
-	CardToken          *string            `bson:"card_token"`
-}
-
-func toMongoPurchase(p Purchase) mongoPurchase {
-	return mongoPurchase{
-		ID:                 p.id,
+	ID                 uuid.UUID        `bson:"ID"`
+	Store              store.Store      `bson:"Store"`
+	CustomerID         uuid.UUID        `bson:"customer_id"`
+	ProductsToPurchase []mongoProduct   `bson:"products_purchased"`
+	Total              int64            `bson:"purchase_total"`
+	Currency           string           `bson:"currency"`
+	PaymentMeans       payment.Means    `bson:"payment_means"`
+	TimeOfPurchase     time.Time        `bson:"created_at"`
+	CardToken          *string          `bson:"card_token"`
+	Delivery           *mongoDelivery   `bson:"delivery,omitempty"`
+	CorrelationID      string           `bson:"correlation_id,omitempty"`
+	ServedBy           string           `bson:"served_by,omitempty"`
+	TabID              uuid.UUID        `bson:"tab_id"`
+	ReceiptCode        string           `bson:"receipt_code,omitempty"`
+	Charges            []mongoCharge    `bson:"charges,omitempty"`
+	Rounding           int64            `bson:"rounding,omitempty"`
+	Channel            string           `bson:"channel,omitempty"`
+	Overrides          []mongoOverride  `bson:"overrides,omitempty"`
+	Experiment         *mongoExperiment `bson:"experiment,omitempty"`
+	PickupAt           time.Time        `bson:"pickup_at,omitempty"`
+	DeviceID           uuid.UUID        `bson:"device_id"`
+	Imported           bool             `bson:"imported,omitempty"`
+}
+
+type mongoExperiment struct {
+	Name            string  `bson:"name"`
+	Variant         string  `bson:"variant"`
+	DiscountPercent float32 `bson:"discount_percent"`
+}
+
+type mongoOverride struct {
+	Product int            `bson:"product"`
+	Price   int64          `bson:"price"`
+	Was     int64          `bson:"was"`
+	Reason  OverrideReason `bson:"reason"`
+	Note    string         `bson:"note,omitempty"`
+	By      string         `bson:"by"`
+}
+
+type mongoCharge struct {
+	Type   ChargeType `bson:"type"`
+	Payee  Payee      `bson:"payee"`
+	Amount int64      `bson:"amount"`
+}
+
+type mongoDelivery struct {
+	Address string `bson:"address"`
+	Phone   string `bson:"phone"`
+}
+
+func toMongoPurchase(p *Purchase) mongoPurchase {
+	mp := mongoPurchase{
+		ID:                 p.ID,
 		Store:              p.Store,
-		ProductsToPurchase: p.ProductsToPurchase,
+		CustomerID:         p.CustomerID,
+		ProductsToPurchase: toMongoProducts(p.ProductsToPurchase),
 		Total:              p.total.Amount(),
+		Currency:           p.total.Currency().Code,
 		PaymentMeans:       p.PaymentMeans,
 		TimeOfPurchase:     p.timeOfPurchase,
 		CardToken:          p.CardToken,
+		CorrelationID:      p.correlationID,
+		ServedBy:           p.ServedBy,
+		TabID:              p.TabID,
+		ReceiptCode:        p.ReceiptCode,
+		Rounding:           p.rounding,
+		Channel:            string(p.Channel),
+		PickupAt:           p.PickupAt,
+		DeviceID:           p.DeviceID,
+		Imported:           p.imported,
+	}
+	if p.Delivery != nil {
+		mp.Delivery = &mongoDelivery{Address: p.Delivery.Address, Phone: p.Delivery.Phone}
 	}
+	for _, c := range p.Charges {
+		mp.Charges = append(mp.Charges, mongoCharge{Type: c.Type, Payee: c.Payee, Amount: c.Amount.Amount()})
+	}
+	for _, o := range p.Overrides {
+		mp.Overrides = append(mp.Overrides, mongoOverride{Product: o.Product, Price: o.Price.Amount(), Was: o.Was.Amount(), Reason: o.Reason, Note: o.Note, By: o.By})
+	}
+	if x := p.Experiment; !x.IsZero() {
+		mp.Experiment = &mongoExperiment{Name: x.Experiment, Variant: x.Variant, DiscountPercent: x.DiscountPercent}
+	}
+	return mp
+}
+
+// mongoProduct exists because money.Money has no exported fields, so it cannot be stored as is.
+type mongoProduct struct {
+	ItemName    string `bson:"item_name"`
+	Price       int64  `bson:"price"`
+	Currency    string `bson:"currency"`
+	ReusableCup bool   `bson:"reusable_cup,omitempty"`
+}
+
+func toMongoProducts(products []coffeeco.Product) []mongoProduct {
+	res := make([]mongoProduct, 0, len(products))
+	for _, v := range products {
+		res = append(res, mongoProduct{ItemName: v.ItemName, Price: v.BasePrice.Amount(), Currency: v.BasePrice.Currency().Code, ReusableCup: v.ReusableCup})
+	}
+	return res
 }
 
 func (m mongoPurchase) ToPurchase() Purchase {
-	return Purchase{
-		id:                 m.ID,
+	currency := m.Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	products := make([]coffeeco.Product, 0, len(m.ProductsToPurchase))
+	for _, v := range m.ProductsToPurchase {
+		products = append(products, coffeeco.Product{ItemName: v.ItemName, BasePrice: *money.New(v.Price, currency), ReusableCup: v.ReusableCup})
+	}
+	p := Purchase{
+		AggregateRoot:      ddd.AggregateRoot{ID: m.ID},
 		Store:              m.Store,
-		ProductsToPurchase: m.ProductsToPurchase,
-		total:              *money.New(m.Total, "USD"),
+		CustomerID:         m.CustomerID,
+		ProductsToPurchase: products,
+		total:              *money.New(m.Total, currency),
 		PaymentMeans:       m.PaymentMeans,
 		timeOfPurchase:     m.TimeOfPurchase,
 		CardToken:          m.CardToken,
+		correlationID:      m.CorrelationID,
+		ServedBy:           m.ServedBy,
+		TabID:              m.TabID,
+		ReceiptCode:        m.ReceiptCode,
+		rounding:           m.Rounding,
+		Channel:            Channel(m.Channel),
+		PickupAt:           m.PickupAt,
+		DeviceID:           m.DeviceID,
+		imported:           m.Imported,
 	}
+	if m.Delivery != nil {
+		p.Delivery = &Delivery{Address: m.Delivery.Address, Phone: m.Delivery.Phone}
+	}
+	for _, c := range m.Charges {
+		p.Charges = append(p.Charges, Charge{Type: c.Type, Payee: c.Payee, Amount: *money.New(c.Amount, currency)})
+	}
+	for _, o := range m.Overrides {
+		p.Overrides = append(p.Overrides, PriceOverride{Product: o.Product, Price: *money.New(o.Price, currency), Was: *money.New(o.Was, currency), Reason: o.Reason, Note: o.Note, By: o.By})
+	}
+	if x := m.Experiment; x != nil {
+		p.Experiment = experiment.Assignment{Experiment: x.Name, Variant: x.Variant, DiscountPercent: x.DiscountPercent}
+	}
+	return p
 }
 
 func (mr *MongoRepository) Ping(ctx context.Context) error {
@@ -86,3 +238,169 @@ func (mr *MongoRepository) Ping(ctx context.Context) error {
 	}
 	return nil
 }
+
+// Find returns the purchases spec selects, oldest first.
+func (mr *MongoRepository) Find(ctx context.Context, spec Specification) (_ []Purchase, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoRepository.Find")
+	defer telemetry.End(span, &err)
+	cur, err := mr.purchases.Find(ctx, Translate(spec, mongoSpec{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query purchases: %w", err)
+	}
+	defer cur.Close(ctx)
+	var res []Purchase
+	for cur.Next(ctx) {
+		var mp mongoPurchase
+		if err := cur.Decode(&mp); err != nil {
+			return nil, fmt.Errorf("failed to decode purchase: %w", err)
+		}
+		res = append(res, mp.ToPurchase())
+	}
+	return res, cur.Err()
+}
+
+// mongoSpec translates specifications into filters on the fields of mongoPurchase.
+type mongoSpec struct{}
+
+func (mongoSpec) All() bson.D { return bson.D{} }
+
+func (mongoSpec) Store(id uuid.UUID) bson.D { return bson.D{{Key: "Store.id", Value: id}} }
+
+func (mongoSpec) Customer(id uuid.UUID) bson.D { return bson.D{{Key: "customer_id", Value: id}} }
+
+func (mongoSpec) Between(from, to time.Time) bson.D {
+	between := bson.D{}
+	if !from.IsZero() {
+		between = append(between, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		between = append(between, bson.E{Key: "$lt", Value: to})
+	}
+	if len(between) == 0 {
+		return bson.D{}
+	}
+	return bson.D{{Key: "created_at", Value: between}}
+}
+
+func (mongoSpec) Means(m payment.Means) bson.D { return bson.D{{Key: "payment_means", Value: m}} }
+
+func (mongoSpec) And(filters ...bson.D) bson.D { return bson.D{{Key: "$and", Value: filters}} }
+
+func (mongoSpec) Or(filters ...bson.D) bson.D { return bson.D{{Key: "$or", Value: filters}} }
+
+func (mongoSpec) Not(filter bson.D) bson.D { return bson.D{{Key: "$nor", Value: bson.A{filter}}} }
+
+// CardTokens lists the distinct card tokens stored with the purchases of customerID.
+func (mr *MongoRepository) CardTokens(ctx context.Context, customerID uuid.UUID) (_ []string, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoRepository.CardTokens")
+	defer telemetry.End(span, &err)
+	values, err := mr.purchases.Distinct(ctx, "card_token", bson.D{
+		{Key: "customer_id", Value: customerID},
+		{Key: "card_token", Value: bson.D{{Key: "$type", Value: "string"}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list card tokens: %w", err)
+	}
+	tokens := make([]string, 0, len(values))
+	for _, v := range values {
+		if token, ok := v.(string); ok {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// AnonymizeCustomer anonymizes every purchase of customerID and returns how many there were. Running it
+// again finds nothing left to do.
+func (mr *MongoRepository) AnonymizeCustomer(ctx context.Context, customerID uuid.UUID) (_ int, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoRepository.AnonymizeCustomer")
+	defer telemetry.End(span, &err)
+	if customerID == uuid.Nil {
+		return 0, nil
+	}
+	cur, err := mr.purchases.Find(ctx, Translate(ByCustomer(customerID), mongoSpec{}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query purchases: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var n int
+	for cur.Next(ctx) {
+		var mp mongoPurchase
+		if err := cur.Decode(&mp); err != nil {
+			return n, fmt.Errorf("failed to decode purchase: %w", err)
+		}
+		p := mp.ToPurchase()
+		p.Anonymize()
+		if _, err := mr.purchases.ReplaceOne(ctx, bson.D{{Key: "ID", Value: p.ID}}, toMongoPurchase(&p)); err != nil {
+			return n, fmt.Errorf("failed to anonymize purchase %s: %w", p.ID, err)
+		}
+		n++
+	}
+	return n, cur.Err()
+}
+
+// Replay feeds every stored purchase to h as a Completed message, oldest first. It is the source used to
+// rebuild read models from scratch.
+func (mr *MongoRepository) Replay(ctx context.Context, h events.Handler) error {
+	cur, err := mr.purchases.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to query purchases: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var mp mongoPurchase
+		if err := cur.Decode(&mp); err != nil {
+			return fmt.Errorf("failed to decode purchase: %w", err)
+		}
+		p := mp.ToPurchase()
+		msg, err := events.NewMessage(p.completedEvent(), events.JSONCodec{})
+		if err != nil {
+			return err
+		}
+		msg.OccurredAt = p.timeOfPurchase
+		if err := h(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// Watch tails inserts into the purchases collection with a change stream, calling fn with each new purchase
+// and the resume token to persist once fn succeeds. Pass the last saved token to carry on where a previous
+// watcher stopped, or nil to start from now. Change streams require Mongo to run as a replica set.
+func (mr *MongoRepository) Watch(ctx context.Context, resumeToken bson.Raw, fn func(ctx context.Context, p Purchase, token bson.Raw) error) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	pipeline := mongo.Pipeline{bson.D{{Key: "$match", Value: bson.D{{Key: "operationType", Value: "insert"}}}}}
+	cs, err := mr.purchases.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return fmt.Errorf("failed to open change stream: %w", err)
+	}
+	defer cs.Close(ctx)
+
+	for cs.Next(ctx) {
+		var change struct {
+			FullDocument mongoPurchase `bson:"fullDocument"`
+		}
+		if err := cs.Decode(&change); err != nil {
+			return fmt.Errorf("failed to decode change: %w", err)
+		}
+		if err := fn(ctx, change.FullDocument.ToPurchase(), cs.ResumeToken()); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return cs.Err()
+}
+
+// CompletedEvent returns the event a stored purchase corresponds to, e.g. for publishers that derive
+// events from the database rather than from the service.
+func (p Purchase) CompletedEvent() Completed {
+	return p.completedEvent()
+}
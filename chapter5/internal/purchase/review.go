@@ -0,0 +1,420 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/telemetry"
+)
+
+var (
+	// ErrHeldForReview means the purchase was not completed yet: its card was authorized and a manager of the
+	// store has to approve it before the card is captured.
+	ErrHeldForReview  = errors.New("purchase is held for a manager to review")
+	ErrReviewNotFound = errors.New("review not found")
+	ErrReviewDecided  = errors.New("review has already been decided")
+	ErrReviewExpired  = errors.New("review timed out and the purchase was cancelled")
+	ErrNoReviews      = errors.New("purchases are not reviewed")
+	ErrReviewConflict = errors.New("review changed since it was read")
+)
+
+// defaultReviewTimeout is how long a held purchase waits for a manager without ReviewPolicy.Timeout.
+const defaultReviewTimeout = 30 * time.Minute
+
+// ReviewStatus is where a held purchase is.
+type ReviewStatus string
+
+const (
+	ReviewPending  ReviewStatus = "pending"
+	ReviewApproved ReviewStatus = "approved"
+	ReviewRejected ReviewStatus = "rejected"
+	// ReviewExpired purchases waited longer than ReviewPolicy.Timeout and were cancelled.
+	ReviewExpired ReviewStatus = "expired"
+)
+
+// ReviewPolicy holds card purchases over a store's threshold for a manager of the store to approve before
+// the card is captured.
+type ReviewPolicy struct {
+	// Currency of the thresholds. Purchases in other currencies are not held.
+	Currency string
+	// Threshold is the total over which purchases are held, in the minor unit of Currency; 0 holds none.
+	Threshold int64
+	// Stores replace Threshold at some stores.
+	Stores map[uuid.UUID]int64
+	// Timeout is how long a held purchase waits for a manager before it is cancelled; 30 minutes if 0.
+	Timeout time.Duration
+}
+
+// holds tells whether a purchase of total at the store waits for a manager.
+func (p ReviewPolicy) holds(storeID uuid.UUID, total money.Money) bool {
+	threshold, ok := p.Stores[storeID]
+	if !ok {
+		threshold = p.Threshold
+	}
+	return threshold > 0 && total.Currency().Code == p.Currency && total.Amount() > threshold
+}
+
+func (p ReviewPolicy) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultReviewTimeout
+	}
+	return p.Timeout
+}
+
+// Review is a purchase held for a manager's approval. The card was authorized for the total, which is
+// captured once the purchase is approved; until it is decided, the purchase keeps its stock, the drinks of
+// the customer's pass and their negotiated discount.
+type Review struct {
+	// Purchase is the purchase as it is stored once approved. Its ID is the ID of the review.
+	Purchase        Purchase
+	StoreID         uuid.UUID
+	AuthorizationID string
+	HeldAt          time.Time
+	ExpiresAt       time.Time
+
+	// discount and entitlement are what pricing took off, for when the purchase is completed.
+	discount    float32
+	entitlement uuid.UUID
+	// loyaltyCard is the card the purchase earns a stamp on once it is approved; uuid.Nil if none.
+	loyaltyCard uuid.UUID
+	status      ReviewStatus
+	decidedBy   string
+	decidedAt   time.Time
+	reason      string
+	version     int
+}
+
+func (r *Review) ID() uuid.UUID {
+	return r.Purchase.ID
+}
+
+func (r *Review) Status() ReviewStatus {
+	return r.status
+}
+
+// DecidedBy is the manager who approved or rejected the purchase, or "system" if it expired.
+func (r *Review) DecidedBy() string {
+	return r.decidedBy
+}
+
+func (r *Review) DecidedAt() time.Time {
+	return r.decidedAt
+}
+
+// Reason is why the purchase was rejected.
+func (r *Review) Reason() string {
+	return r.reason
+}
+
+// decide moves a pending review to status.
+func (r *Review) decide(status ReviewStatus, by, reason string, at time.Time) error {
+	if r.status != ReviewPending {
+		return ErrReviewDecided
+	}
+	r.status, r.decidedBy, r.reason, r.decidedAt = status, by, reason, at.UTC()
+	return nil
+}
+
+// reopen puts an approved review whose card could not be captured back to pending, to be decided again.
+func (r *Review) reopen() {
+	r.status, r.decidedBy, r.reason, r.decidedAt = ReviewPending, "", "", time.Time{}
+}
+
+// CardAuthorizer holds an amount on a card and captures or releases it later, e.g. payment.StripeService.
+type CardAuthorizer interface {
+	Authorize(ctx context.Context, amount money.Money, cardToken string) (authorizationID string, err error)
+	Capture(ctx context.Context, authorizationID string, amount money.Money) error
+	Void(ctx context.Context, authorizationID string) error
+}
+
+// ReviewNotifier tells the manager of a store that a purchase is waiting for them, e.g.
+// notifications.Managers.
+type ReviewNotifier interface {
+	ReviewRequested(ctx context.Context, r *Review) error
+}
+
+type noReviewNotifier struct{}
+
+func (noReviewNotifier) ReviewRequested(context.Context, *Review) error { return nil }
+
+// WithReviews holds card purchases over the policy's thresholds in repo until a manager approves them,
+// authorizing the card with cards rather than charging it. CompletePurchase returns ErrHeldForReview for
+// them. The completion saga does not hold purchases.
+func WithReviews(policy ReviewPolicy, repo ReviewRepository, cards CardAuthorizer) Option {
+	return func(s *Service) {
+		s.reviewPolicy = policy
+		s.reviews = repo
+		s.authorizer = cards
+	}
+}
+
+// LoyaltyCards are where the loyalty cards of held purchases are loaded from and saved to, e.g.
+// loyalty.MongoRepository.
+type LoyaltyCards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+	Save(ctx context.Context, card *loyalty.CoffeeBux) error
+}
+
+// WithLoyaltyCards stamps the loyalty card of a held purchase once a manager approves it, as CompletePurchase
+// stamps it for purchases that are not held. Without it approved purchases earn no stamp.
+func WithLoyaltyCards(cards LoyaltyCards) Option {
+	return func(s *Service) {
+		s.loyaltyCards = cards
+	}
+}
+
+// WithReviewNotifier tells the store's manager about every purchase held for their review.
+func WithReviewNotifier(n ReviewNotifier) Option {
+	return func(s *Service) {
+		s.reviewNotifier = n
+	}
+}
+
+// needsReview tells whether a purchase waits for a manager before it is charged.
+func (s *Service) needsReview(storeID uuid.UUID, purchase *Purchase) bool {
+	return s.reviews != nil && purchase.PaymentMeans == payment.MEANS_CARD && s.reviewPolicy.holds(storeID, purchase.total)
+}
+
+// holdForReview authorizes the card for the total and keeps the purchase for a manager to decide on.
+func (s *Service) holdForReview(ctx context.Context, storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux, discount float32, entitlement uuid.UUID) error {
+	authorizationID, err := s.authorizer.Authorize(ctx, purchase.total, *purchase.CardToken)
+	if err != nil {
+		s.logger.WarnContext(ctx, "card authorization failed", "purchase", purchase, "error", err)
+		s.recorder.PaymentFailed(purchase.PaymentMeans, payment.DeclineCode(err))
+		return ErrCardChargeFailed
+	}
+	now := s.now()
+	r := &Review{
+		Purchase:        *purchase,
+		StoreID:         storeID,
+		AuthorizationID: authorizationID,
+		HeldAt:          now.UTC(),
+		ExpiresAt:       now.Add(s.reviewPolicy.timeout()).UTC(),
+		discount:        discount,
+		entitlement:     entitlement,
+		status:          ReviewPending,
+	}
+	if coffeeBuxCard != nil {
+		r.loyaltyCard = coffeeBuxCard.ID
+	}
+	if err := s.reviews.Save(ctx, r); err != nil {
+		if verr := s.authorizer.Void(context.WithoutCancel(ctx), authorizationID); verr != nil {
+			s.logger.ErrorContext(ctx, "review not saved and its authorization not voided", "purchase", purchase, "authorization", authorizationID, "error", verr)
+		}
+		return fmt.Errorf("failed to hold purchase for review: %w", err)
+	}
+	if err := s.reviewNotifier.ReviewRequested(ctx, r); err != nil {
+		s.logger.ErrorContext(ctx, "purchase held for review but the store's manager was not told", "purchase", purchase, "error", err)
+	}
+	s.logger.InfoContext(ctx, "purchase held for review", "purchase", purchase, "expires_at", r.ExpiresAt)
+	return nil
+}
+
+func (s *Service) GetReview(ctx context.Context, id uuid.UUID) (*Review, error) {
+	if s.reviews == nil {
+		return nil, ErrNoReviews
+	}
+	return s.reviews.Get(ctx, id)
+}
+
+// PendingReviews are the purchases waiting for a manager of the store, oldest first.
+func (s *Service) PendingReviews(ctx context.Context, storeID uuid.UUID) ([]*Review, error) {
+	if s.reviews == nil {
+		return nil, ErrNoReviews
+	}
+	return s.reviews.Pending(ctx, storeID)
+}
+
+// ApproveReview approves a held purchase, then captures its card and completes it. Whoever acts in ctx, see
+// audit.Actor, is recorded as having approved it. A purchase whose card cannot be captured is pending again,
+// and one that waited too long is cancelled instead, with ErrReviewExpired.
+func (s *Service) ApproveReview(ctx context.Context, id uuid.UUID) (_ *Review, err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.ApproveReview", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	r, err := s.pendingReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if !now.Before(r.ExpiresAt) {
+		if err := s.cancelReview(ctx, r, ReviewExpired, audit.ActorSystem, "timed out"); err != nil {
+			return nil, err
+		}
+		return r, ErrReviewExpired
+	}
+	// The decision is saved before the card is captured: of two managers approving at once, only the one
+	// who saved it captures, and the other gets ErrReviewConflict.
+	if err := r.decide(ReviewApproved, audit.Actor(ctx), "", now); err != nil {
+		return nil, err
+	}
+	if err := s.reviews.Save(ctx, r); err != nil {
+		return nil, err
+	}
+	if err := s.authorizer.Capture(ctx, r.AuthorizationID, r.Purchase.total); err != nil {
+		s.logger.WarnContext(ctx, "capture of an approved purchase failed", "purchase", r.Purchase, "error", err)
+		r.reopen()
+		if serr := s.reviews.Save(context.WithoutCancel(ctx), r); serr != nil {
+			s.logger.ErrorContext(ctx, "capture failed but the review was left approved", "purchase", r.Purchase, "error", serr)
+		}
+		return nil, fmt.Errorf("failed to capture the card: %w", err)
+	}
+	s.recordReview(ctx, r)
+	return r, s.completeReviewed(ctx, r)
+}
+
+// RejectReview releases the card authorization of a held purchase and cancels it, giving back its stock
+// and the drinks of the customer's pass.
+func (s *Service) RejectReview(ctx context.Context, id uuid.UUID, reason string) (_ *Review, err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.RejectReview", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	r, err := s.pendingReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cancelReview(ctx, r, ReviewRejected, audit.Actor(ctx), reason); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ExpireReviews cancels every held purchase no manager decided on in time, and returns how many it
+// cancelled. It is meant to run regularly, e.g. every minute.
+func (s *Service) ExpireReviews(ctx context.Context) (int, error) {
+	if s.reviews == nil {
+		return 0, ErrNoReviews
+	}
+	due, err := s.reviews.Due(ctx, s.now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to find reviews that timed out: %w", err)
+	}
+	var (
+		n    int
+		errs []error
+	)
+	for _, r := range due {
+		err := s.cancelReview(ctx, r, ReviewExpired, audit.ActorSystem, "timed out")
+		switch {
+		case err == nil:
+			n++
+		case !errors.Is(err, ErrReviewConflict):
+			// A review saved by someone else in between was decided by them.
+			errs = append(errs, fmt.Errorf("review %s: %w", r.ID(), err))
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+func (s *Service) pendingReview(ctx context.Context, id uuid.UUID) (*Review, error) {
+	if s.reviews == nil {
+		return nil, ErrNoReviews
+	}
+	r, err := s.reviews.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.status != ReviewPending {
+		return nil, ErrReviewDecided
+	}
+	return r, nil
+}
+
+// cancelReview decides the review, then gives back what the purchase held. Saving the decision first
+// makes sure only one caller gives it back.
+func (s *Service) cancelReview(ctx context.Context, r *Review, status ReviewStatus, by, reason string) error {
+	if err := r.decide(status, by, reason, s.now()); err != nil {
+		return err
+	}
+	if err := s.reviews.Save(ctx, r); err != nil {
+		return err
+	}
+	s.recordReview(ctx, r)
+	purchase := &r.Purchase
+	if err := s.authorizer.Void(context.WithoutCancel(ctx), r.AuthorizationID); err != nil {
+		s.logger.ErrorContext(ctx, "authorization of a cancelled purchase was not voided", "purchase", purchase, "authorization", r.AuthorizationID, "error", err)
+	}
+	s.releaseStock(ctx, r.StoreID, purchase)
+	s.uncoverPass(ctx, purchase)
+	s.cancelFiscal(ctx, purchase)
+	s.logger.InfoContext(ctx, "held purchase cancelled", "purchase", purchase, "status", status, "by", by)
+	return nil
+}
+
+// completeReviewed does what CompletePurchase does once the card of an approved purchase was captured.
+func (s *Service) completeReviewed(ctx context.Context, r *Review) error {
+	purchase := &r.Purchase
+	s.assignReceiptCode(ctx, r.StoreID, purchase)
+	if err := s.purchaseRepo.Store(ctx, purchase); err != nil {
+		s.logger.ErrorContext(ctx, "failed to store approved purchase after capture", "purchase", purchase, "error", err)
+		if verr := s.authorizer.Void(context.WithoutCancel(ctx), r.AuthorizationID); verr != nil {
+			s.logger.ErrorContext(ctx, "approved purchase not stored and its capture not voided", "purchase", purchase, "authorization", r.AuthorizationID, "error", verr)
+			return fmt.Errorf("card captured but failed to store the purchase: %w", err)
+		}
+		return fmt.Errorf("failed to store the approved purchase, its capture was voided: %w", err)
+	}
+	if err := s.inventory.Commit(ctx, r.StoreID, purchase.ID); err != nil {
+		s.logger.ErrorContext(ctx, "purchase stored but its stock is still reserved", "purchase", purchase, "error", err)
+	}
+	if r.entitlement != uuid.Nil {
+		if err := s.entitlements.Use(ctx, r.entitlement, purchase.timeOfPurchase); err != nil {
+			s.logger.ErrorContext(ctx, "purchase stored but its negotiated discount was not counted", "purchase", purchase, "entitlement_id", r.entitlement, "error", err)
+		}
+	}
+	s.recordOverrides(ctx, purchase)
+	card := s.stampReviewed(ctx, r)
+	purchase.completed(s.now())
+	if s.publisher != nil {
+		evts := purchase.PopEvents()
+		if card != nil {
+			evts = append(evts, card.PopEvents()...)
+		}
+		if err := s.publisher.Publish(ctx, evts...); err != nil {
+			s.logger.ErrorContext(ctx, "purchase stored but its events were not published", "purchase", purchase, "error", err)
+			return fmt.Errorf("purchase stored but failed to publish events: %w", err)
+		}
+	}
+	s.logger.InfoContext(ctx, "purchase completed", "purchase", purchase, "approved_by", r.decidedBy)
+	s.recorder.PurchaseCompleted(purchase, r.discount)
+	return nil
+}
+
+// stampReviewed stamps the loyalty card of an approved purchase and saves it, and returns it to publish its
+// events; nil if the purchase earns no stamp. The purchase is paid for by then, so a card that cannot be
+// stamped is only logged.
+func (s *Service) stampReviewed(ctx context.Context, r *Review) *loyalty.CoffeeBux {
+	purchase := &r.Purchase
+	if r.loyaltyCard == uuid.Nil || s.loyaltyCards == nil || !s.earnsStamp(purchase) {
+		return nil
+	}
+	card, err := s.loyaltyCards.Get(ctx, r.loyaltyCard)
+	if err != nil {
+		s.logger.ErrorContext(ctx, "approved purchase stored but its loyalty card was not read", "purchase", purchase, "card", r.loyaltyCard, "error", err)
+		return nil
+	}
+	card.AddStamp()
+	if err := s.loyaltyCards.Save(ctx, card); err != nil {
+		s.logger.ErrorContext(ctx, "approved purchase stored but its loyalty card was not stamped", "purchase", purchase, "card", r.loyaltyCard, "error", err)
+		return nil
+	}
+	return card
+}
+
+// recordReview records the decision in the audit log, if there is one.
+func (s *Service) recordReview(ctx context.Context, r *Review) {
+	if s.audit == nil {
+		return
+	}
+	e := audit.NewEntry(audit.WithActor(ctx, r.decidedBy), audit.ActionPurchaseReview, "purchase", r.ID().String(), string(ReviewPending), string(r.status))
+	e.Note = r.reason
+	if err := s.audit.Record(ctx, e); err != nil {
+		s.logger.ErrorContext(ctx, "review decided but not recorded in the audit log", "purchase", r.Purchase, "error", err)
+	}
+}
@@ -0,0 +1,243 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type ReviewRepository interface {
+	// Get returns ErrReviewNotFound if the purchase was never held.
+	Get(ctx context.Context, id uuid.UUID) (*Review, error)
+	// Pending returns the reviews waiting at the store, or at every store for uuid.Nil, oldest first.
+	Pending(ctx context.Context, storeID uuid.UUID) ([]*Review, error)
+	// Due returns the pending reviews that expired before at.
+	Due(ctx context.Context, at time.Time) ([]*Review, error)
+	// Save returns ErrReviewConflict if the review was saved by someone else since it was read.
+	Save(ctx context.Context, r *Review) error
+}
+
+// MongoReviewRepository keeps reviews versioned, as two managers may decide on the same purchase at once.
+type MongoReviewRepository struct {
+	client  *mongo.Client
+	reviews *mongo.Collection
+}
+
+func NewMongoReviewRepo(ctx context.Context, connectionString string) (*MongoReviewRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	reviews := client.Database("coffeeco").Collection("purchase_reviews")
+	_, err = reviews.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create review indexes: %w", err)
+	}
+	return &MongoReviewRepository{client: client, reviews: reviews}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoReviewRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoReview struct {
+	ID              string        `bson:"_id"`
+	Version         int           `bson:"version"`
+	Purchase        mongoPurchase `bson:"purchase"`
+	StoreID         string        `bson:"store_id"`
+	AuthorizationID string        `bson:"authorization_id"`
+	HeldAt          time.Time     `bson:"held_at"`
+	ExpiresAt       time.Time     `bson:"expires_at"`
+	Discount        float32       `bson:"discount,omitempty"`
+	EntitlementID   uuid.UUID     `bson:"entitlement_id"`
+	LoyaltyCardID   uuid.UUID     `bson:"loyalty_card_id"`
+	Status          string        `bson:"status"`
+	DecidedBy       string        `bson:"decided_by,omitempty"`
+	DecidedAt       time.Time     `bson:"decided_at,omitempty"`
+	Reason          string        `bson:"reason,omitempty"`
+}
+
+func toMongoReview(r *Review) mongoReview {
+	return mongoReview{
+		ID:              r.ID().String(),
+		Version:         r.version,
+		Purchase:        toMongoPurchase(&r.Purchase),
+		StoreID:         r.StoreID.String(),
+		AuthorizationID: r.AuthorizationID,
+		HeldAt:          r.HeldAt,
+		ExpiresAt:       r.ExpiresAt,
+		Discount:        r.discount,
+		EntitlementID:   r.entitlement,
+		LoyaltyCardID:   r.loyaltyCard,
+		Status:          string(r.status),
+		DecidedBy:       r.decidedBy,
+		DecidedAt:       r.decidedAt,
+		Reason:          r.reason,
+	}
+}
+
+func (m mongoReview) toReview() *Review {
+	storeID, _ := uuid.Parse(m.StoreID)
+	return &Review{
+		Purchase:        m.Purchase.ToPurchase(),
+		StoreID:         storeID,
+		AuthorizationID: m.AuthorizationID,
+		HeldAt:          m.HeldAt,
+		ExpiresAt:       m.ExpiresAt,
+		discount:        m.Discount,
+		entitlement:     m.EntitlementID,
+		loyaltyCard:     m.LoyaltyCardID,
+		status:          ReviewStatus(m.Status),
+		decidedBy:       m.DecidedBy,
+		decidedAt:       m.DecidedAt,
+		reason:          m.Reason,
+		version:         m.Version,
+	}
+}
+
+func (m *MongoReviewRepository) Get(ctx context.Context, id uuid.UUID) (_ *Review, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoReviewRepository.Get", attribute.String("purchase.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoReview
+	if err := m.reviews.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrReviewNotFound
+		}
+		return nil, fmt.Errorf("failed to find review: %w", err)
+	}
+	return doc.toReview(), nil
+}
+
+func (m *MongoReviewRepository) Pending(ctx context.Context, storeID uuid.UUID) (_ []*Review, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoReviewRepository.Pending", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{{Key: "status", Value: string(ReviewPending)}}
+	if storeID != uuid.Nil {
+		filter = append(filter, bson.E{Key: "store_id", Value: storeID.String()})
+	}
+	return m.find(ctx, filter)
+}
+
+func (m *MongoReviewRepository) Due(ctx context.Context, at time.Time) (_ []*Review, err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoReviewRepository.Due")
+	defer telemetry.End(span, &err)
+	return m.find(ctx, bson.D{{Key: "status", Value: string(ReviewPending)}, {Key: "expires_at", Value: bson.D{{Key: "$lte", Value: at}}}})
+}
+
+func (m *MongoReviewRepository) find(ctx context.Context, filter bson.D) ([]*Review, error) {
+	cur, err := m.reviews.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "held_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find reviews: %w", err)
+	}
+	var docs []mongoReview
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode reviews: %w", err)
+	}
+	res := make([]*Review, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.toReview())
+	}
+	return res, nil
+}
+
+func (m *MongoReviewRepository) Save(ctx context.Context, r *Review) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "purchase.MongoReviewRepository.Save", attribute.String("purchase.id", r.ID().String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoReview(r)
+	doc.Version = r.version + 1
+	if r.version == 0 {
+		if _, err := m.reviews.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrReviewConflict
+			}
+			return fmt.Errorf("failed to save review: %w", err)
+		}
+	} else {
+		res, err := m.reviews.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: r.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save review: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrReviewConflict
+		}
+	}
+	r.version = doc.Version
+	return nil
+}
+
+func (m *MongoReviewRepository) Ping(ctx context.Context) error {
+	if _, err := m.reviews.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryReviewRepository keeps reviews in process. It is meant for tests and local experiments.
+type MemoryReviewRepository struct {
+	mu      sync.Mutex
+	reviews map[uuid.UUID]mongoReview
+}
+
+func NewMemoryReviewRepo() *MemoryReviewRepository {
+	return &MemoryReviewRepository{reviews: map[uuid.UUID]mongoReview{}}
+}
+
+func (m *MemoryReviewRepository) Get(_ context.Context, id uuid.UUID) (*Review, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.reviews[id]
+	if !ok {
+		return nil, ErrReviewNotFound
+	}
+	return doc.toReview(), nil
+}
+
+func (m *MemoryReviewRepository) Pending(_ context.Context, storeID uuid.UUID) ([]*Review, error) {
+	return m.find(func(r *Review) bool {
+		return r.status == ReviewPending && (storeID == uuid.Nil || r.StoreID == storeID)
+	}), nil
+}
+
+func (m *MemoryReviewRepository) Due(_ context.Context, at time.Time) ([]*Review, error) {
+	return m.find(func(r *Review) bool {
+		return r.status == ReviewPending && !r.ExpiresAt.After(at)
+	}), nil
+}
+
+func (m *MemoryReviewRepository) find(match func(r *Review) bool) []*Review {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*Review
+	for _, doc := range m.reviews {
+		if r := doc.toReview(); match(r) {
+			res = append(res, r)
+		}
+	}
+	slices.SortFunc(res, func(a, b *Review) int { return a.HeldAt.Compare(b.HeldAt) })
+	return res
+}
+
+func (m *MemoryReviewRepository) Save(_ context.Context, r *Review) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reviews[r.ID()].Version != r.version {
+		return ErrReviewConflict
+	}
+	doc := toMongoReview(r)
+	doc.Version = r.version + 1
+	m.reviews[r.ID()] = doc
+	r.version = doc.Version
+	return nil
+}
@@ -0,0 +1,40 @@
+package purchase
+
+import (
+	"github.com/Rhymond/go-money"
+
+	"coffeeco/internal/payment"
+)
+
+// CashRounding is the smallest coin of each currency that cash totals are rounded to, in its minor unit,
+// e.g. 5 for CHF, which has no 1 or 2 centime coins. Currencies it does not list are not rounded.
+type CashRounding map[string]int64
+
+// round rounds total to the nearest increment of its currency, halves up.
+func (r CashRounding) round(total money.Money) money.Money {
+	increment := r[total.Currency().Code]
+	if increment <= 1 {
+		return total
+	}
+	return *money.New((total.Amount()+increment/2)/increment*increment, total.Currency().Code)
+}
+
+// Rounding is what rounding the cash total added to it, negative when the customer paid less than the
+// lines and charges add up to. It is part of the total.
+func (p *Purchase) Rounding() money.Money {
+	// The zero money.Money has no currency, as purchases not yet priced have no total.
+	if p.total.Currency() == nil {
+		return money.Money{}
+	}
+	return *money.New(p.rounding, p.total.Currency().Code)
+}
+
+// roundCash rounds the total of a purchase paid in cash, once nothing else is added to it.
+func (p *Purchase) roundCash(r CashRounding) {
+	if p.PaymentMeans != payment.MEANS_CASH || p.total.Currency() == nil {
+		return
+	}
+	rounded := r.round(p.total)
+	p.rounding = rounded.Amount() - p.total.Amount()
+	p.total = rounded
+}
@@ -0,0 +1,294 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/breaker"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/saga"
+)
+
+// CardGateway is a card service that can also undo a charge, which the completion saga needs to compensate.
+type CardGateway interface {
+	Charge(ctx context.Context, amount money.Money, cardToken string) (chargeID string, err error)
+	Refund(ctx context.Context, chargeID string) error
+}
+
+// CompletionSaga completes purchases as an orchestrated saga: payment, storing the purchase, loyalty and
+// notification are separate steps with their own timeouts, and a failure before the purchase is stored
+// refunds whatever was already charged. Use it instead of Service.CompletePurchase for flows where a
+// silently half-completed purchase is not acceptable.
+type CompletionSaga struct {
+	svc          *Service
+	gateway      CardGateway
+	orchestrator *saga.Orchestrator
+}
+
+func NewCompletionSaga(svc *Service, gateway CardGateway, orchestrator *saga.Orchestrator) (*CompletionSaga, error) {
+	if svc == nil || gateway == nil || orchestrator == nil {
+		return nil, errors.New("service, gateway and orchestrator are all required")
+	}
+	return &CompletionSaga{svc: svc, gateway: gateway, orchestrator: orchestrator}, nil
+}
+
+// Complete runs the saga and returns its final state, which is also persisted by the orchestrator.
+func (c *CompletionSaga) Complete(ctx context.Context, storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) (saga.State, error) {
+	purchase.Store.ID = storeID
+	defer c.svc.forgetAttempt(purchase)
+	return c.orchestrator.Run(ctx, c.definition(storeID, purchase, coffeeBuxCard))
+}
+
+func (c *CompletionSaga) definition(storeID uuid.UUID, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) saga.Definition {
+	// evts are popped off the purchase and card once, so a retried notification publishes them again.
+	var evts []events.Event
+	return saga.Definition{
+		Name: "purchase.completion",
+		Steps: []saga.Step{
+			{
+				Name:    "price",
+				Timeout: 3 * time.Second,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					if err := purchase.validateAndEnrich(c.svc.now()); err != nil {
+						return err
+					}
+					if err := c.svc.checkMeans(ctx, storeID, purchase); err != nil {
+						return err
+					}
+					if err := c.svc.checkDevice(ctx, storeID, purchase); err != nil {
+						return err
+					}
+					if err := c.svc.checkDuplicate(ctx, storeID, purchase); err != nil {
+						return err
+					}
+					purchase.correlationID = correlation.ID(ctx)
+					if purchase.CustomerID == uuid.Nil && coffeeBuxCard != nil {
+						purchase.CustomerID = coffeeBuxCard.CustomerID()
+					}
+					state.Data["purchase_id"] = purchase.ID.String()
+					if err := c.svc.coverWithPass(ctx, purchase); err != nil {
+						return err
+					}
+					discount, entitlement, err := c.svc.price(ctx, storeID, purchase)
+					if err == nil {
+						err = purchase.applyOverrides(audit.Actor(ctx))
+					}
+					if err != nil {
+						c.svc.uncoverPass(ctx, purchase)
+						return err
+					}
+					state.Data["discount_percent"] = strconv.FormatFloat(float64(discount), 'f', -1, 32)
+					if entitlement != uuid.Nil {
+						state.Data["entitlement_id"] = entitlement.String()
+					}
+					return nil
+				},
+				Compensate: func(ctx context.Context, state *saga.State) error {
+					if purchase.CustomerID == uuid.Nil {
+						return nil
+					}
+					return c.svc.passes.Uncover(ctx, purchase.CustomerID, purchase.ID)
+				},
+			},
+			{
+				Name:    "reserve",
+				Timeout: 3 * time.Second,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					return c.svc.reserve(ctx, storeID, purchase)
+				},
+				Compensate: func(ctx context.Context, state *saga.State) error {
+					return c.svc.inventory.Release(ctx, storeID, purchase.ID)
+				},
+			},
+			{
+				Name:    "delivery",
+				Timeout: 5 * time.Second,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					purchase.chargeChannelFee(c.svc.channelFees)
+					if err := purchase.addCharges(); err != nil {
+						return err
+					}
+					if err := c.svc.addDeliveryFee(ctx, storeID, purchase); err != nil {
+						return err
+					}
+					purchase.roundCash(c.svc.cashRounding)
+					return nil
+				},
+			},
+			{
+				Name:    "payment",
+				Timeout: 10 * time.Second,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					return c.pay(ctx, state, purchase, coffeeBuxCard)
+				},
+				Compensate: func(ctx context.Context, state *saga.State) error {
+					return c.refund(ctx, state, purchase, coffeeBuxCard)
+				},
+			},
+			{
+				Name:    "store",
+				Timeout: 5 * time.Second,
+				Pivot:   true,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					c.svc.assignReceiptCode(ctx, storeID, purchase)
+					if err := c.svc.purchaseRepo.Store(ctx, purchase); err != nil {
+						return err
+					}
+					c.svc.recordOverrides(ctx, purchase)
+					purchase.completed(c.svc.now())
+					discount, _ := strconv.ParseFloat(state.Data["discount_percent"], 32)
+					c.svc.recorder.PurchaseCompleted(purchase, float32(discount))
+					return nil
+				},
+			},
+			{
+				Name:    "inventory",
+				Timeout: 3 * time.Second,
+				Retries: 3,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					return c.svc.inventory.Commit(ctx, storeID, purchase.ID)
+				},
+			},
+			{
+				Name:    "wallet",
+				Timeout: 3 * time.Second,
+				Retries: 3,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					if state.Data["wallet_held"] == "" {
+						return nil
+					}
+					return c.svc.wallet.Capture(ctx, purchase.CustomerID, purchase.ID)
+				},
+			},
+			{
+				Name:    "entitlement",
+				Timeout: 3 * time.Second,
+				Retries: 3,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					id, err := uuid.Parse(state.Data["entitlement_id"])
+					if err != nil || state.Data["entitlement_used"] != "" {
+						return nil
+					}
+					if err := c.svc.entitlements.Use(ctx, id, purchase.timeOfPurchase); err != nil {
+						return err
+					}
+					state.Data["entitlement_used"] = "true"
+					return nil
+				},
+			},
+			{
+				Name: "loyalty",
+				Execute: func(ctx context.Context, state *saga.State) error {
+					if coffeeBuxCard != nil && c.svc.earnsStamp(purchase) && state.Data["stamped"] == "" {
+						coffeeBuxCard.AddStamp()
+						state.Data["stamped"] = "true"
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "notification",
+				Timeout: 5 * time.Second,
+				Retries: 3,
+				Execute: func(ctx context.Context, state *saga.State) error {
+					if c.svc.publisher == nil {
+						return nil
+					}
+					if evts == nil {
+						evts = purchase.PopEvents()
+						if coffeeBuxCard != nil {
+							evts = append(evts, coffeeBuxCard.PopEvents()...)
+						}
+					}
+					return c.svc.publisher.Publish(ctx, evts...)
+				},
+			},
+		},
+	}
+}
+
+func (c *CompletionSaga) pay(ctx context.Context, state *saga.State, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) error {
+	if purchase.total.IsZero() {
+		return nil
+	}
+	switch purchase.PaymentMeans {
+	case payment.MEANS_CARD:
+		if purchase.CardToken == nil {
+			return errors.New("card payment requires a card token")
+		}
+		chargeID, err := c.gateway.Charge(ctx, purchase.total, *purchase.CardToken)
+		if errors.Is(err, breaker.ErrOpen) {
+			c.svc.recorder.PaymentFailed(purchase.PaymentMeans, "gateway_unavailable")
+			return ErrCardPaymentsUnavailable
+		}
+		if err != nil {
+			c.svc.recorder.PaymentFailed(purchase.PaymentMeans, payment.DeclineCode(err))
+			return fmt.Errorf("card charge failed: %w", err)
+		}
+		state.Data["charge_id"] = chargeID
+	case payment.MEANS_CASH, payment.MEANS_MARKETPLACE:
+	case payment.MEANS_COFFEEBUX:
+		if coffeeBuxCard == nil {
+			return errors.New("coffeebux payment requires a loyalty card")
+		}
+		if err := coffeeBuxCard.Pay(ctx, purchase.payable()); err != nil {
+			c.svc.recorder.PaymentFailed(purchase.PaymentMeans, coffeeBuxDeclineReason(err))
+			return fmt.Errorf("failed to charge loyalty card: %w", err)
+		}
+		state.Data["drinks_redeemed"] = fmt.Sprint(len(purchase.payable()))
+	case payment.MEANS_WALLET:
+		if err := c.svc.holdWallet(ctx, purchase); err != nil {
+			return err
+		}
+		state.Data["wallet_held"] = "true"
+	default:
+		return errors.New("unknown payment type")
+	}
+	return nil
+}
+
+func (c *CompletionSaga) refund(ctx context.Context, state *saga.State, purchase *Purchase, coffeeBuxCard *loyalty.CoffeeBux) error {
+	if chargeID := state.Data["charge_id"]; chargeID != "" {
+		if err := c.gateway.Refund(ctx, chargeID); err != nil {
+			return err
+		}
+		delete(state.Data, "charge_id")
+		c.auditRefund(ctx, purchase, chargeID)
+	}
+	if state.Data["wallet_held"] != "" {
+		if err := c.svc.wallet.Release(ctx, purchase.CustomerID, purchase.ID); err != nil {
+			return err
+		}
+		delete(state.Data, "wallet_held")
+	}
+	if state.Data["drinks_redeemed"] != "" && coffeeBuxCard != nil {
+		drinks, _ := strconv.Atoi(state.Data["drinks_redeemed"])
+		coffeeBuxCard.RefundDrinks(drinks)
+		delete(state.Data, "drinks_redeemed")
+	}
+	return nil
+}
+
+// auditRefund records a refund made to compensate a failed purchase. The money is back with the customer
+// by then, so failing to record it is logged rather than failing the compensation.
+func (c *CompletionSaga) auditRefund(ctx context.Context, purchase *Purchase, chargeID string) {
+	if c.svc.audit == nil {
+		return
+	}
+	e := audit.NewEntry(audit.WithActor(ctx, audit.ActorSystem), audit.ActionRefund, "purchase", purchase.ID.String(),
+		"charged "+purchase.total.Display(), "refunded")
+	e.Note = "compensating failed purchase, charge " + chargeID
+	if err := c.svc.audit.Record(ctx, e); err != nil {
+		c.svc.logger.ErrorContext(ctx, "refund not recorded in the audit log", "purchase", purchase, "error", err)
+	}
+}
@@ -0,0 +1,81 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/sandbox"
+	"coffeeco/internal/telemetry"
+)
+
+// ErrPracticeMeans means a practice purchase was not paid by card or cash, the means that touch nothing
+// real in test mode.
+var ErrPracticeMeans = errors.New("practice purchases are paid by card or cash")
+
+// WithSandbox takes practice purchases, see sandbox.With. Their cards are charged with cards, which must be
+// the payment gateway in test mode, and they are stored in repo, apart from the real purchases.
+func WithSandbox(cards CardChargeService, repo Repository) Option {
+	return func(s *Service) {
+		s.sandboxCards, s.sandboxRepo = cards, repo
+	}
+}
+
+// practise completes a purchase made for practice. It is priced and charged as a real one would be, but
+// collected at the store and paid by card or cash. No stock, pass, wallet, loyalty card or fiscal printer is
+// touched, and no event is published, so it never reaches loyalty, the projections or the reports.
+func (s *Service) practise(ctx context.Context, storeID uuid.UUID, purchase *Purchase) (err error) {
+	ctx, span := telemetry.Start(ctx, "purchase.Service.practise", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	if s.sandboxRepo == nil {
+		return sandbox.ErrUnavailable
+	}
+	if err := purchase.validateAndEnrich(s.now()); err != nil {
+		return err
+	}
+	if purchase.PaymentMeans != payment.MEANS_CARD && purchase.PaymentMeans != payment.MEANS_CASH {
+		return ErrPracticeMeans
+	}
+	if purchase.Delivery != nil {
+		return fmt.Errorf("%w: deliveries", sandbox.ErrUnavailable)
+	}
+	if err := s.checkDevice(ctx, storeID, purchase); err != nil {
+		return err
+	}
+	purchase.correlationID = correlation.ID(ctx)
+	if err := step(ctx, StepDiscount, s.timeouts.Discount, func(ctx context.Context) error {
+		_, _, err := s.price(ctx, storeID, purchase)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := purchase.applyOverrides(audit.Actor(ctx)); err != nil {
+		return err
+	}
+	purchase.chargeChannelFee(s.channelFees)
+	if err := purchase.addCharges(); err != nil {
+		return err
+	}
+	purchase.roundCash(s.cashRounding)
+	if purchase.PaymentMeans == payment.MEANS_CARD && !purchase.total.IsZero() {
+		if err := step(ctx, StepCharge, s.timeouts.Charge, func(ctx context.Context) error {
+			return s.sandboxCards.ChargeCard(ctx, purchase.total, *purchase.CardToken)
+		}); err != nil {
+			s.logger.WarnContext(ctx, "practice card charge failed", "purchase", purchase, "error", err)
+			return ErrCardChargeFailed
+		}
+	}
+	if err := step(ctx, StepStore, s.timeouts.Store, func(ctx context.Context) error {
+		return s.sandboxRepo.Store(ctx, purchase)
+	}); err != nil {
+		return fmt.Errorf("failed to store practice purchase: %w", err)
+	}
+	s.logger.InfoContext(ctx, "practice purchase completed", "purchase", purchase)
+	return nil
+}
@@ -0,0 +1,149 @@
+package purchase
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/payment"
+)
+
+type specKind int
+
+const (
+	specAll specKind = iota
+	specStore
+	specCustomer
+	specBetween
+	specMeans
+	specAnd
+	specOr
+	specNot
+)
+
+// Specification selects purchases, e.g. ByStore(id).And(Between(from, to)).And(MeansIs(payment.MEANS_CARD)).
+// It says what to select, not how: repositories translate it into their own queries with Translate, and
+// IsSatisfiedBy tells whether a purchase in hand is selected.
+type Specification struct {
+	kind     specKind
+	id       uuid.UUID
+	from, to time.Time
+	means    payment.Means
+	specs    []Specification
+}
+
+// All selects every purchase.
+func All() Specification {
+	return Specification{kind: specAll}
+}
+
+func ByStore(id uuid.UUID) Specification {
+	return Specification{kind: specStore, id: id}
+}
+
+func ByCustomer(id uuid.UUID) Specification {
+	return Specification{kind: specCustomer, id: id}
+}
+
+// Between selects the purchases made from from, inclusive, to to, exclusive. A zero from or to leaves the
+// period open at that end.
+func Between(from, to time.Time) Specification {
+	return Specification{kind: specBetween, from: from, to: to}
+}
+
+func MeansIs(m payment.Means) Specification {
+	return Specification{kind: specMeans, means: m}
+}
+
+// Not selects the purchases s does not.
+func Not(s Specification) Specification {
+	return Specification{kind: specNot, specs: []Specification{s}}
+}
+
+// And selects the purchases both s and every one of others select.
+func (s Specification) And(others ...Specification) Specification {
+	return Specification{kind: specAnd, specs: append([]Specification{s}, others...)}
+}
+
+// Or selects the purchases s or any of others select.
+func (s Specification) Or(others ...Specification) Specification {
+	return Specification{kind: specOr, specs: append([]Specification{s}, others...)}
+}
+
+func (s Specification) IsSatisfiedBy(p Purchase) bool {
+	switch s.kind {
+	case specStore:
+		return p.Store.ID == s.id
+	case specCustomer:
+		return p.CustomerID == s.id
+	case specBetween:
+		return (s.from.IsZero() || !p.timeOfPurchase.Before(s.from)) && (s.to.IsZero() || p.timeOfPurchase.Before(s.to))
+	case specMeans:
+		return p.PaymentMeans == s.means
+	case specAnd:
+		for _, spec := range s.specs {
+			if !spec.IsSatisfiedBy(p) {
+				return false
+			}
+		}
+		return true
+	case specOr:
+		for _, spec := range s.specs {
+			if spec.IsSatisfiedBy(p) {
+				return true
+			}
+		}
+		return false
+	case specNot:
+		return !s.specs[0].IsSatisfiedBy(p)
+	}
+	return true
+}
+
+// Translator turns each kind of specification into a query of type Q of some backend, e.g. a Mongo
+// filter or an SQL condition.
+type Translator[Q any] interface {
+	All() Q
+	Store(id uuid.UUID) Q
+	Customer(id uuid.UUID) Q
+	Between(from, to time.Time) Q
+	Means(m payment.Means) Q
+	And(qs ...Q) Q
+	Or(qs ...Q) Q
+	Not(q Q) Q
+}
+
+// Translate turns s into a query with t.
+func Translate[Q any](s Specification, t Translator[Q]) Q {
+	translate := func(specs []Specification) []Q {
+		qs := make([]Q, 0, len(specs))
+		for _, spec := range specs {
+			qs = append(qs, Translate(spec, t))
+		}
+		return qs
+	}
+	switch s.kind {
+	case specStore:
+		return t.Store(s.id)
+	case specCustomer:
+		return t.Customer(s.id)
+	case specBetween:
+		return t.Between(s.from, s.to)
+	case specMeans:
+		return t.Means(s.means)
+	case specAnd:
+		return t.And(translate(s.specs)...)
+	case specOr:
+		return t.Or(translate(s.specs)...)
+	case specNot:
+		return t.Not(Translate(s.specs[0], t))
+	}
+	return t.All()
+}
+
+// Finder is a Repository that selects purchases by specification.
+type Finder interface {
+	// Find returns the purchases spec selects, oldest first.
+	Find(ctx context.Context, spec Specification) ([]Purchase, error)
+}
@@ -0,0 +1,90 @@
+package purchase
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/payment"
+)
+
+// SQLColumns names the columns of a table of purchases, for SQLWhere.
+type SQLColumns struct {
+	Store       string
+	Customer    string
+	PurchasedAt string
+	Means       string
+}
+
+// SQLWhere translates spec into the condition of a WHERE clause, with the $1, $2... placeholders Postgres
+// takes and the arguments that go with them.
+func SQLWhere(spec Specification, columns SQLColumns) (string, []any) {
+	c := Translate(spec, sqlSpec{columns})
+	var b strings.Builder
+	n := 0
+	for _, r := range c.text {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String(), c.args
+}
+
+// sqlCondition is a condition with ? where its arguments go, numbered once the whole condition is known.
+type sqlCondition struct {
+	text string
+	args []any
+}
+
+type sqlSpec struct{ cols SQLColumns }
+
+func (sqlSpec) All() sqlCondition { return sqlCondition{text: "TRUE"} }
+
+func (s sqlSpec) Store(id uuid.UUID) sqlCondition {
+	return sqlCondition{text: s.cols.Store + " = ?", args: []any{id}}
+}
+
+func (s sqlSpec) Customer(id uuid.UUID) sqlCondition {
+	return sqlCondition{text: s.cols.Customer + " = ?", args: []any{id}}
+}
+
+func (s sqlSpec) Between(from, to time.Time) sqlCondition {
+	var conds []sqlCondition
+	if !from.IsZero() {
+		conds = append(conds, sqlCondition{text: s.cols.PurchasedAt + " >= ?", args: []any{from}})
+	}
+	if !to.IsZero() {
+		conds = append(conds, sqlCondition{text: s.cols.PurchasedAt + " < ?", args: []any{to}})
+	}
+	if len(conds) == 0 {
+		return s.All()
+	}
+	return s.And(conds...)
+}
+
+func (s sqlSpec) Means(m payment.Means) sqlCondition {
+	return sqlCondition{text: s.cols.Means + " = ?", args: []any{string(m)}}
+}
+
+func (sqlSpec) And(conds ...sqlCondition) sqlCondition { return joinSQL(" AND ", conds) }
+
+func (sqlSpec) Or(conds ...sqlCondition) sqlCondition { return joinSQL(" OR ", conds) }
+
+func (sqlSpec) Not(c sqlCondition) sqlCondition {
+	return sqlCondition{text: "NOT (" + c.text + ")", args: c.args}
+}
+
+func joinSQL(op string, conds []sqlCondition) sqlCondition {
+	texts := make([]string, 0, len(conds))
+	var args []any
+	for _, c := range conds {
+		texts = append(texts, c.text)
+		args = append(args, c.args...)
+	}
+	return sqlCondition{text: "(" + strings.Join(texts, op) + ")", args: args}
+}
@@ -0,0 +1,76 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/inventory"
+)
+
+// Substitution is a product the store can make instead of one it ran out of.
+type Substitution struct {
+	Product    string
+	Substitute string
+	// UnitPrice is what the substitute sells for at the store now, before the customer's own discounts.
+	UnitPrice money.Money
+}
+
+// OutOfStockError is returned when the store ran out of what a purchase needs. It matches
+// inventory.ErrOutOfStock, and suggests what the customer could have instead; the purchase goes through
+// with them once it is sent again with the substitutes the customer accepted.
+type OutOfStockError struct {
+	Err         error
+	Suggestions []Substitution
+}
+
+func (e *OutOfStockError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OutOfStockError) Unwrap() error {
+	return e.Err
+}
+
+// Substitutes suggests what a store can make instead of the products it cannot, e.g. substitution.Service.
+type Substitutes interface {
+	Suggest(ctx context.Context, storeID uuid.UUID, products []string) ([]Substitution, error)
+}
+
+// WithSubstitutes suggests substitutes for what the store ran out of when a purchase is turned away as out
+// of stock. Without it the purchase is only told what is short.
+func WithSubstitutes(sub Substitutes) Option {
+	return func(s *Service) {
+		s.substitutes = sub
+	}
+}
+
+// reserve holds the stock the purchase needs. When the store ran out, the error suggests substitutes for
+// what it cannot make; substitutes that cannot be suggested are only logged.
+func (s *Service) reserve(ctx context.Context, storeID uuid.UUID, p *Purchase) error {
+	err := s.inventory.Reserve(ctx, storeID, p.ID, p.ProductsToPurchase)
+	if s.substitutes == nil || !errors.Is(err, inventory.ErrOutOfStock) {
+		return err
+	}
+	products := make([]string, 0, len(p.ProductsToPurchase))
+	for _, product := range p.ProductsToPurchase {
+		products = append(products, product.ItemName)
+	}
+	suggestions, serr := s.substitutes.Suggest(ctx, storeID, products)
+	if serr != nil {
+		s.logger.WarnContext(ctx, "no substitutes suggested for an out of stock purchase", "store", storeID, "error", serr)
+		return err
+	}
+	return &OutOfStockError{Err: err, Suggestions: suggestions}
+}
+
+// substitute swaps every product the customer accepted a substitute for.
+func (p *Purchase) substitute() {
+	for i, product := range p.ProductsToPurchase {
+		if sub := p.Substitutes[product.ItemName]; sub != "" {
+			p.ProductsToPurchase[i].ItemName = sub
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package purchase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The steps of CompletePurchase, as named in a TimeoutError.
+const (
+	StepPass      = "pass"
+	StepDiscount  = "discount"
+	StepReserve   = "reserve"
+	StepDelivery  = "delivery"
+	StepFiscalize = "fiscalize"
+	StepCharge    = "charge"
+	StepStore     = "store"
+	StepPublish   = "publish"
+)
+
+// ErrTimeout matches every TimeoutError, for callers that do not care which step it was.
+var ErrTimeout = errors.New("purchase timed out")
+
+// TimeoutError is returned when a step of CompletePurchase ran out of time, either its own or the
+// caller's. A charge that timed out may still have gone through at the gateway.
+type TimeoutError struct {
+	Step string
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("purchase timed out during the %s step", e.Step)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout || target == context.DeadlineExceeded
+}
+
+// Timeouts bound each step of CompletePurchase. The caller's deadline still applies on top of them.
+type Timeouts struct {
+	Pass      time.Duration
+	Discount  time.Duration
+	Reserve   time.Duration
+	Delivery  time.Duration
+	Fiscalize time.Duration
+	Charge    time.Duration
+	Store     time.Duration
+	Publish   time.Duration
+}
+
+var defaultTimeouts = Timeouts{
+	Pass:      3 * time.Second,
+	Discount:  3 * time.Second,
+	Reserve:   3 * time.Second,
+	Delivery:  5 * time.Second,
+	Fiscalize: 10 * time.Second,
+	Charge:    10 * time.Second,
+	Store:     5 * time.Second,
+	Publish:   5 * time.Second,
+}
+
+// WithTimeouts replaces the default step timeouts (3s for the pass, the discount lookup and the stock reservation, 5s for the
+// delivery quote, 10s each for the fiscal receipt and the charge and 5s each to store and publish). Zero durations keep their default.
+func WithTimeouts(t Timeouts) Option {
+	return func(s *Service) {
+		if t.Pass > 0 {
+			s.timeouts.Pass = t.Pass
+		}
+		if t.Discount > 0 {
+			s.timeouts.Discount = t.Discount
+		}
+		if t.Reserve > 0 {
+			s.timeouts.Reserve = t.Reserve
+		}
+		if t.Delivery > 0 {
+			s.timeouts.Delivery = t.Delivery
+		}
+		if t.Fiscalize > 0 {
+			s.timeouts.Fiscalize = t.Fiscalize
+		}
+		if t.Charge > 0 {
+			s.timeouts.Charge = t.Charge
+		}
+		if t.Store > 0 {
+			s.timeouts.Store = t.Store
+		}
+		if t.Publish > 0 {
+			s.timeouts.Publish = t.Publish
+		}
+	}
+}
+
+// step runs fn with at most d of the time left in ctx. It does not start once ctx is done, and turns a
+// deadline running out, the step's own or the caller's, into a TimeoutError naming the step. A cancelled
+// ctx is returned as it is.
+func step(ctx context.Context, name string, d time.Duration, fn func(ctx context.Context) error) error {
+	if err := ctx.Err(); err != nil {
+		return stepError(name, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		return stepError(name, ctx.Err())
+	}
+	return err
+}
+
+func stepError(name string, ctxErr error) error {
+	if errors.Is(ctxErr, context.DeadlineExceeded) {
+		return &TimeoutError{Step: name}
+	}
+	return ctxErr
+}
@@ -0,0 +1,96 @@
+package purchase_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+)
+
+// slowUntilDone blocks until its context is done, like a dependency that hangs.
+type slowUntilDone struct{}
+
+func (slowUntilDone) ChargeCard(ctx context.Context, _ money.Money, _ string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (slowUntilDone) GetStoreSpecificDiscount(ctx context.Context, _ uuid.UUID) (float32, error) {
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+type instant struct{}
+
+func (instant) ChargeCard(context.Context, money.Money, string) error {
+	return nil
+}
+
+func (instant) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return 0, nil
+}
+
+type noPurchases struct{}
+
+func (noPurchases) Store(context.Context, *purchase.Purchase) error {
+	return nil
+}
+
+func (noPurchases) Get(context.Context, uuid.UUID) (purchase.Purchase, error) {
+	return purchase.Purchase{}, purchase.ErrNotFound
+}
+
+func (noPurchases) Ping(context.Context) error {
+	return nil
+}
+
+func cardPurchase() *purchase.Purchase {
+	token := "tok_visa"
+	return &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(400, "USD")}},
+		PaymentMeans:       payment.MEANS_CARD,
+		CardToken:          &token,
+	}
+}
+
+func Test_CompletePurchaseNamesTheStepThatTimedOut(t *testing.T) {
+	short := purchase.Timeouts{Discount: 10 * time.Millisecond, Charge: 10 * time.Millisecond}
+	tests := map[string]struct {
+		cards  purchase.CardChargeService
+		stores purchase.StoreService
+		step   string
+	}{
+		"discount lookup": {cards: instant{}, stores: slowUntilDone{}, step: purchase.StepDiscount},
+		"card charge":     {cards: slowUntilDone{}, stores: instant{}, step: purchase.StepCharge},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := purchase.NewService(tt.cards, noPurchases{}, tt.stores, purchase.WithTimeouts(short))
+			err := svc.CompletePurchase(context.Background(), uuid.New(), cardPurchase(), nil)
+
+			var te *purchase.TimeoutError
+			if !errors.As(err, &te) || te.Step != tt.step {
+				t.Fatalf("expected the %s step to time out but got %v", tt.step, err)
+			}
+			if !errors.Is(err, purchase.ErrTimeout) {
+				t.Fatalf("expected %v to match ErrTimeout", err)
+			}
+		})
+	}
+}
+
+func Test_CompletePurchaseStopsOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc := purchase.NewService(instant{}, noPurchases{}, instant{})
+	if err := svc.CompletePurchase(ctx, uuid.New(), cardPurchase(), nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation to be returned but got %v", err)
+	}
+}
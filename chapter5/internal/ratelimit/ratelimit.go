@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"coffeeco/internal/auth"
+)
+
+// idleAfter is how long a client's bucket is kept after its last request. A bucket idle that long is full
+// again anyway, so dropping it changes nothing.
+const idleAfter = 10 * time.Minute
+
+// Quota is a token bucket: Rate requests per second on average, with bursts of up to Burst.
+type Quota struct {
+	Rate  rate.Limit `json:"rate"`
+	Burst int        `json:"burst"`
+}
+
+// Metrics are counted per limited route since the Limiter was created.
+type Metrics struct {
+	Allowed int64
+	Limited int64
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter gives every signed-in client, e.g. a POS terminal, and every client IP their own token bucket. A
+// request has to fit in both. Clients are told apart by the auth.Principal of the request, so the limiter
+// must run after authentication; requests without one are only limited by IP.
+type Limiter struct {
+	PerKey Quota
+	PerIP  Quota
+	// TrustForwardedFor takes the client IP from the last entry of X-Forwarded-For, the one the proxy in
+	// front added. Only set it behind a proxy that appends to it.
+	TrustForwardedFor bool
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	metrics   map[string]*Metrics
+	lastSweep time.Time
+}
+
+func NewLimiter(perKey, perIP Quota) *Limiter {
+	return &Limiter{
+		PerKey:  perKey,
+		PerIP:   perIP,
+		buckets: map[string]*bucket{},
+		metrics: map[string]*Metrics{},
+	}
+}
+
+// SetQuotas changes the quotas, including for clients that already have a bucket.
+func (l *Limiter) SetQuotas(perKey, perIP Quota) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.PerKey, l.PerIP = perKey, perIP
+	for key, b := range l.buckets {
+		q := perIP
+		if strings.HasPrefix(key, "principal:") {
+			q = perKey
+		}
+		b.limiter.SetLimit(q.Rate)
+		b.limiter.SetBurst(q.Burst)
+	}
+}
+
+// Middleware limits the requests to the routes it wraps, counting them under name. Limited requests get a
+// 429 with a Retry-After header.
+func (l *Limiter) Middleware(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if wait, ok := l.allow(name, r); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = w.Write([]byte(`{"error":{"code":"rate_limited","message":"too many requests"}}` + "\n"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Metrics returns a copy of the counters per route name.
+func (l *Limiter) Metrics() map[string]Metrics {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	res := make(map[string]Metrics, len(l.metrics))
+	for name, m := range l.metrics {
+		res[name] = *m
+	}
+	return res
+}
+
+func (l *Limiter) allow(name string, r *http.Request) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.sweep(now)
+
+	m := l.metrics[name]
+	if m == nil {
+		m = &Metrics{}
+		l.metrics[name] = m
+	}
+
+	reservations := []*rate.Reservation{l.bucket("ip:"+l.clientIP(r), l.PerIP, now).ReserveN(now, 1)}
+	if p, ok := auth.FromContext(r.Context()); ok && p.Subject != "" {
+		reservations = append(reservations, l.bucket("principal:"+p.Subject, l.PerKey, now).ReserveN(now, 1))
+	}
+	var wait time.Duration
+	for _, res := range reservations {
+		if !res.OK() {
+			wait = time.Duration(math.MaxInt64)
+		} else if d := res.DelayFrom(now); d > wait {
+			wait = d
+		}
+	}
+	if wait > 0 {
+		// Rejected requests must not use up tokens, or a client that keeps retrying would never get through.
+		for _, res := range reservations {
+			res.CancelAt(now)
+		}
+		m.Limited++
+		if wait == time.Duration(math.MaxInt64) {
+			wait = idleAfter
+		}
+		return wait, false
+	}
+	m.Allowed++
+	return 0, true
+}
+
+func (l *Limiter) bucket(key string, q Quota, now time.Time) *rate.Limiter {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(q.Rate, q.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleAfter {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) > idleAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) clientIP(r *http.Request) string {
+	if l.TrustForwardedFor {
+		// Whatever is left of the last entry was sent by the client, who can put anything there.
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(fwd[strings.LastIndex(fwd, ",")+1:])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,103 @@
+package ratelimit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/ratelimit"
+)
+
+// do makes a request from ip, signed in as subject unless it is empty.
+func do(h http.Handler, ip, subject string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/purchases", nil)
+	r.RemoteAddr = ip + ":51234"
+	if subject != "" {
+		r = r.WithContext(auth.WithPrincipal(context.Background(), auth.Principal{Subject: subject}))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func Test_ClientsOverTheirQuotaAreToldWhenToRetry(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Quota{Rate: 1, Burst: 2}, ratelimit.Quota{Rate: 1, Burst: 100})
+	h := l.Middleware("purchases")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 2; i++ {
+		if rec := do(h, "10.0.0.1", "till-1"); rec.Code != http.StatusOK {
+			t.Fatalf("expected request %d to be allowed but got %d", i, rec.Code)
+		}
+	}
+	rec := do(h, "10.0.0.1", "till-1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After 1 but got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := do(h, "10.0.0.1", "till-2"); rec.Code != http.StatusOK {
+		t.Fatalf("expected another client from the same IP to be allowed but got %d", rec.Code)
+	}
+
+	if m := l.Metrics()["purchases"]; m.Allowed != 3 || m.Limited != 1 {
+		t.Fatalf("expected 3 allowed and 1 limited but got %+v", m)
+	}
+}
+
+func Test_RequestsWithoutAPrincipalAreLimitedByIP(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Quota{Rate: rate.Inf}, ratelimit.Quota{Rate: 1, Burst: 1})
+	h := l.Middleware("loyalty")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if rec := do(h, "10.0.0.1", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed but got %d", rec.Code)
+	}
+	if rec := do(h, "10.0.0.1", "till-1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the IP to be limited whoever signed in but got %d", rec.Code)
+	}
+	if rec := do(h, "10.0.0.2", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected another IP to be allowed but got %d", rec.Code)
+	}
+}
+
+func Test_APIKeysAreNotTakenOnTrust(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Quota{Rate: 1, Burst: 1}, ratelimit.Quota{Rate: rate.Inf})
+	h := l.Middleware("purchases")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if rec := do(h, "10.0.0.1", "till-1"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed but got %d", rec.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/purchases", nil)
+	r = r.WithContext(auth.WithPrincipal(context.Background(), auth.Principal{Subject: "till-1"}))
+	r.Header.Set("X-Api-Key", "made-up")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a made up key not to get the client a new bucket but got %d", rec.Code)
+	}
+}
+
+func Test_OnlyTheProxysEntryOfXForwardedForIsTrusted(t *testing.T) {
+	l := ratelimit.NewLimiter(ratelimit.Quota{Rate: rate.Inf}, ratelimit.Quota{Rate: 1, Burst: 1})
+	l.TrustForwardedFor = true
+	h := l.Middleware("loyalty")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	forwarded := func(fwd string) int {
+		r := httptest.NewRequest(http.MethodGet, "/loyalty-cards/1", nil)
+		r.Header.Set("X-Forwarded-For", fwd)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if code := forwarded("1.1.1.1, 10.0.0.1"); code != http.StatusOK {
+		t.Fatalf("expected the first request to be allowed but got %d", code)
+	}
+	// The client made up the first entry; the proxy saw the request come from 10.0.0.1 again.
+	if code := forwarded("2.2.2.2, 10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the client to be limited whatever it forwarded but got %d", code)
+	}
+	if code := forwarded("10.0.0.2"); code != http.StatusOK {
+		t.Fatalf("expected another IP to be allowed but got %d", code)
+	}
+}
@@ -0,0 +1,142 @@
+package receipt
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// ShortCodeLength is how many characters a short code has: 40 random bits, so codes of a store's day
+// hardly ever collide, and are retried when they do.
+const ShortCodeLength = 8
+
+// shortCodeAlphabet is Crockford's base32, without the letters that read like digits (I, L, O) or make
+// words (U).
+const shortCodeAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// claimAttempts is how many codes are drawn before giving up on a purchase.
+const claimAttempts = 5
+
+var (
+	ErrInvalidShortCode = errors.New("not a short receipt code")
+	ErrShortCodeTaken   = errors.New("short receipt code is taken at the store that day")
+	ErrShortCodeUnknown = errors.New("no purchase has this short receipt code at the store that day")
+	ErrInvalidDay       = errors.New("day must be a date as YYYY-MM-DD")
+)
+
+// NewShortCode draws a random short code.
+func NewShortCode() string {
+	var b [ShortCodeLength]byte
+	_, _ = rand.Read(b[:])
+	for i := range b {
+		b[i] = shortCodeAlphabet[b[i]%32]
+	}
+	return string(b[:])
+}
+
+// FormatShortCode splits a short code in two halves, the way it is printed, e.g. K7Q2-M9XD.
+func FormatShortCode(code string) string {
+	if len(code) != ShortCodeLength {
+		return code
+	}
+	return code[:ShortCodeLength/2] + "-" + code[ShortCodeLength/2:]
+}
+
+// ParseShortCode reads a short code the way support staff type it off a paper receipt: in any case, with
+// spaces or dashes, and with O for 0 or I and L for 1.
+func ParseShortCode(code string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		switch r {
+		case ' ', '-':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		if !strings.ContainsRune(shortCodeAlphabet, r) {
+			return "", ErrInvalidShortCode
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() != ShortCodeLength {
+		return "", ErrInvalidShortCode
+	}
+	return b.String(), nil
+}
+
+// Codes gives every purchase a short code, unique at its store on the day it was made, for support to find
+// the purchase from a paper receipt without its full ID.
+type Codes struct {
+	repo      CodeRepository
+	locations map[uuid.UUID]*time.Location // 可选, 默认按UTC划分日期
+}
+
+type CodesOption func(c *Codes)
+
+// WithTimeZones makes days start and end at midnight where each store is, rather than in UTC.
+func WithTimeZones(locations map[uuid.UUID]*time.Location) CodesOption {
+	return func(c *Codes) {
+		c.locations = locations
+	}
+}
+
+func NewCodes(repo CodeRepository, opts ...CodesOption) *Codes {
+	c := &Codes{repo: repo}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Assign claims a short code for a purchase made at the store at at.
+func (c *Codes) Assign(ctx context.Context, storeID, purchaseID uuid.UUID, at time.Time) (_ string, err error) {
+	ctx, span := telemetry.Start(ctx, "receipt.Codes.Assign", attribute.String("store.id", storeID.String()), attribute.String("purchase.id", purchaseID.String()))
+	defer telemetry.End(span, &err)
+	day := c.day(storeID, at)
+	for range claimAttempts {
+		code := NewShortCode()
+		err := c.repo.Claim(ctx, ShortCode{Code: code, StoreID: storeID, Day: day, PurchaseID: purchaseID})
+		if errors.Is(err, ErrShortCodeTaken) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to claim short receipt code: %w", err)
+		}
+		return code, nil
+	}
+	return "", ErrShortCodeTaken
+}
+
+// Lookup finds the purchase with the short code made at the store on day, the date printed on the receipt
+// as YYYY-MM-DD.
+func (c *Codes) Lookup(ctx context.Context, storeID uuid.UUID, day, code string) (_ uuid.UUID, err error) {
+	ctx, span := telemetry.Start(ctx, "receipt.Codes.Lookup", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	code, err = ParseShortCode(code)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		return uuid.Nil, ErrInvalidDay
+	}
+	return c.repo.Find(ctx, storeID, day, code)
+}
+
+// day is the date at at where the store is, as YYYY-MM-DD.
+func (c *Codes) day(storeID uuid.UUID, at time.Time) string {
+	loc := c.locations[storeID]
+	if loc == nil {
+		loc = time.UTC
+	}
+	return at.In(loc).Format(time.DateOnly)
+}
@@ -0,0 +1,133 @@
+package receipt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// ShortCode is the short code of a purchase, unique at its store on Day.
+type ShortCode struct {
+	Code    string
+	StoreID uuid.UUID
+	// Day is the date the purchase was made where the store is, as YYYY-MM-DD.
+	Day        string
+	PurchaseID uuid.UUID
+}
+
+// key is what makes a code unique.
+func (s ShortCode) key() string {
+	return s.StoreID.String() + "/" + s.Day + "/" + s.Code
+}
+
+type CodeRepository interface {
+	// Claim returns ErrShortCodeTaken if the code is already another purchase's at the store that day.
+	Claim(ctx context.Context, code ShortCode) error
+	// Find returns ErrShortCodeUnknown if no purchase has the code at the store that day.
+	Find(ctx context.Context, storeID uuid.UUID, day, code string) (uuid.UUID, error)
+	Ping(ctx context.Context) error
+}
+
+type MongoCodeRepository struct {
+	client *mongo.Client
+	codes  *mongo.Collection
+}
+
+func NewMongoCodeRepo(ctx context.Context, connectionString string) (*MongoCodeRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoCodeRepository{client: client, codes: client.Database("coffeeco").Collection("receipt_codes")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoCodeRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoShortCode struct {
+	// Key is the store, the day and the code, so Mongo turns away a code taken already.
+	Key        string `bson:"_id"`
+	Code       string `bson:"code"`
+	StoreID    string `bson:"store_id"`
+	Day        string `bson:"day"`
+	PurchaseID string `bson:"purchase_id"`
+}
+
+func (m *MongoCodeRepository) Claim(ctx context.Context, code ShortCode) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "receipt.MongoCodeRepository.Claim", attribute.String("purchase.id", code.PurchaseID.String()))
+	defer telemetry.End(span, &err)
+	doc := mongoShortCode{Key: code.key(), Code: code.Code, StoreID: code.StoreID.String(), Day: code.Day, PurchaseID: code.PurchaseID.String()}
+	if _, err := m.codes.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrShortCodeTaken
+		}
+		return fmt.Errorf("failed to save short receipt code: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoCodeRepository) Find(ctx context.Context, storeID uuid.UUID, day, code string) (_ uuid.UUID, err error) {
+	ctx, span := telemetry.StartClient(ctx, "receipt.MongoCodeRepository.Find", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	key := ShortCode{Code: code, StoreID: storeID, Day: day}.key()
+	var doc mongoShortCode
+	if err := m.codes.FindOne(ctx, bson.D{{Key: "_id", Value: key}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return uuid.Nil, ErrShortCodeUnknown
+		}
+		return uuid.Nil, fmt.Errorf("failed to find short receipt code: %w", err)
+	}
+	return uuid.Parse(doc.PurchaseID)
+}
+
+func (m *MongoCodeRepository) Ping(ctx context.Context) error {
+	if _, err := m.codes.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryCodeRepository keeps codes in process. It is meant for tests and local experiments.
+type MemoryCodeRepository struct {
+	mu    sync.Mutex
+	codes map[string]uuid.UUID
+}
+
+func NewMemoryCodeRepo() *MemoryCodeRepository {
+	return &MemoryCodeRepository{codes: map[string]uuid.UUID{}}
+}
+
+func (m *MemoryCodeRepository) Claim(_ context.Context, code ShortCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.codes[code.key()]; ok {
+		return ErrShortCodeTaken
+	}
+	m.codes[code.key()] = code.PurchaseID
+	return nil
+}
+
+func (m *MemoryCodeRepository) Find(_ context.Context, storeID uuid.UUID, day, code string) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.codes[ShortCode{Code: code, StoreID: storeID, Day: day}.key()]
+	if !ok {
+		return uuid.Nil, ErrShortCodeUnknown
+	}
+	return id, nil
+}
+
+func (m *MemoryCodeRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,206 @@
+package receipt
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/purchase"
+)
+
+// Mode is how much a receipt shows.
+type Mode string
+
+const (
+	ModeStandard Mode = "standard"
+	// ModeGift leaves out every amount and how the purchase was paid, for receipts given away with a gift.
+	// The items and the return code stay, so the gift can still be returned or exchanged.
+	ModeGift Mode = "gift"
+)
+
+var (
+	ErrUnknownMode       = errors.New("receipt mode must be standard or gift")
+	ErrInvalidReturnCode = errors.New("not a return code")
+)
+
+const returnCodePrefix = "RT"
+
+// ReturnCode is what the barcode of a receipt encodes: the purchase ID in the letters and digits Code 39
+// scanners read.
+func ReturnCode(purchaseID uuid.UUID) string {
+	return returnCodePrefix + strings.ToUpper(hex.EncodeToString(purchaseID[:]))
+}
+
+// ParseReturnCode returns the purchase a scanned return code is of.
+func ParseReturnCode(code string) (uuid.UUID, error) {
+	rest, ok := strings.CutPrefix(strings.ToUpper(strings.TrimSpace(code)), returnCodePrefix)
+	if !ok {
+		return uuid.Nil, ErrInvalidReturnCode
+	}
+	b, err := hex.DecodeString(rest)
+	if err != nil || len(b) != len(uuid.UUID{}) {
+		return uuid.Nil, ErrInvalidReturnCode
+	}
+	return uuid.UUID(b), nil
+}
+
+type Line struct {
+	Item     string
+	Quantity int
+	// Amount is what the line cost, written for the purchase's currency; empty on gift receipts.
+	Amount string
+}
+
+type Receipt struct {
+	PurchaseID  uuid.UUID
+	StoreID     uuid.UUID
+	PurchasedAt time.Time
+	Mode        Mode
+	Lines       []Line
+	// Total and PaidWith are empty on gift receipts.
+	Total      string
+	PaidWith   string
+	ReturnCode string
+	// ShortCode is what support asks for to find the purchase, with the store and the date; empty for
+	// purchases without one.
+	ShortCode string
+
+	printer i18n.Printer
+}
+
+// Build is the receipt of p. Identical products at the same price are folded into one line, in the order
+// they were bought; on gift receipts, identical products whatever their price.
+func Build(p purchase.Purchase, mode Mode, loc moneyfmt.Locale) (Receipt, error) {
+	return BuildIn(p, mode, i18n.Printer{Money: loc})
+}
+
+// BuildIn is Build for the customers of a locale: products are named, amounts written and the receipt
+// printed as pr does.
+func BuildIn(p purchase.Purchase, mode Mode, pr i18n.Printer) (Receipt, error) {
+	if mode != ModeStandard && mode != ModeGift {
+		return Receipt{}, ErrUnknownMode
+	}
+	r := Receipt{
+		PurchaseID:  p.ID,
+		StoreID:     p.Store.ID,
+		PurchasedAt: p.PurchasedAt(),
+		Mode:        mode,
+		ReturnCode:  ReturnCode(p.ID),
+		ShortCode:   p.ReceiptCode,
+		printer:     pr,
+	}
+	type key struct {
+		item  string
+		price int64
+	}
+	index := map[key]int{}
+	var prices []int64
+	for _, prod := range p.ProductsToPurchase {
+		k := key{item: prod.ItemName, price: prod.BasePrice.Amount()}
+		if mode == ModeGift {
+			k.price = 0
+		}
+		if i, ok := index[k]; ok {
+			r.Lines[i].Quantity++
+			continue
+		}
+		index[k] = len(r.Lines)
+		r.Lines = append(r.Lines, Line{Item: pr.Product(prod.ItemName).Name, Quantity: 1})
+		prices = append(prices, prod.BasePrice.Amount())
+	}
+	if mode == ModeGift {
+		return r, nil
+	}
+	total := p.Total()
+	currency := total.Currency().Code
+	for i := range r.Lines {
+		r.Lines[i].Amount = pr.Amount(prices[i]*int64(r.Lines[i].Quantity), currency)
+	}
+	// Charges are part of the total, so they are printed for the lines to add up to it.
+	for _, c := range p.Charges {
+		r.Lines = append(r.Lines, Line{Item: strings.ReplaceAll(string(c.Type), "_", " "), Quantity: 1, Amount: pr.Amount(c.Amount.Amount(), currency)})
+	}
+	if rounding := p.Rounding(); !rounding.IsZero() {
+		r.Lines = append(r.Lines, Line{Item: pr.Text("receipt.rounding"), Quantity: 1, Amount: pr.Amount(rounding.Amount(), currency)})
+	}
+	r.Total = pr.Amount(total.Amount(), currency)
+	r.PaidWith = pr.Means(string(p.PaymentMeans))
+	return r, nil
+}
+
+// WriteTo prints the receipt as plain text, in the language it was built in, the return code last,
+// between the asterisks Code 39 barcodes start and end with.
+func (r Receipt) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if r.Mode == ModeGift {
+		b.WriteString(r.printer.Text("receipt.gift") + "\n")
+	}
+	fmt.Fprintf(&b, "CoffeeCo  %s\n", r.printer.DateTime(r.PurchasedAt, "2006-01-02 15:04"))
+	if r.ShortCode != "" {
+		fmt.Fprintf(&b, "%s\n", r.printer.Text("receipt.code", FormatShortCode(r.ShortCode)))
+	}
+	b.WriteString("\n")
+	for _, l := range r.Lines {
+		fmt.Fprintf(&b, "%3d x %-24s %s\n", l.Quantity, l.Item, l.Amount)
+	}
+	if r.Total != "" {
+		fmt.Fprintf(&b, "\n%-30s %s\n%s\n", r.printer.Text("receipt.total"), r.Total, r.printer.Text("receipt.paid_with", r.PaidWith))
+	}
+	fmt.Fprintf(&b, "\n*%s*\n", r.ReturnCode)
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+type Purchases interface {
+	GetPurchase(ctx context.Context, id uuid.UUID) (purchase.Purchase, error)
+}
+
+// Service gives the receipts of purchases made before, e.g. a gift receipt asked for after paying.
+type Service struct {
+	purchases Purchases
+	locale    moneyfmt.Locale // 可选, 默认按各币种自己的写法
+	localizer *i18n.Localizer // 可选, 按店铺的语言和地区打印
+}
+
+type Option func(s *Service)
+
+// WithLocale writes amounts the way loc does.
+func WithLocale(loc moneyfmt.Locale) Option {
+	return func(s *Service) {
+		s.locale = loc
+	}
+}
+
+// WithLocalizer prints the receipts of each store in its language and locale, rather than WithLocale's.
+func WithLocalizer(l *i18n.Localizer) Option {
+	return func(s *Service) {
+		s.localizer = l
+	}
+}
+
+func NewService(purchases Purchases, opts ...Option) *Service {
+	s := &Service{purchases: purchases}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Service) Receipt(ctx context.Context, purchaseID uuid.UUID, mode Mode) (Receipt, error) {
+	p, err := s.purchases.GetPurchase(ctx, purchaseID)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if s.localizer != nil {
+		return BuildIn(p, mode, s.localizer.For(p.Store.ID))
+	}
+	return Build(p, mode, s.locale)
+}
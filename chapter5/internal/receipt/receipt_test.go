@@ -0,0 +1,244 @@
+package receipt_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/testsupport"
+)
+
+// newPurchase is a purchase of 2 lattes and a croissant, paid cash, as it is read back once recorded.
+func newPurchase(t *testing.T) purchase.Purchase {
+	t.Helper()
+	p := &purchase.Purchase{
+		ProductsToPurchase: []coffeeco.Product{
+			{ItemName: "latte", BasePrice: *money.New(450, "EUR")},
+			{ItemName: "croissant", BasePrice: *money.New(325, "EUR")},
+			{ItemName: "latte", BasePrice: *money.New(450, "EUR")},
+		},
+		PaymentMeans: payment.MEANS_CASH,
+	}
+	repo := testsupport.NewFakePurchases()
+	id := uuid.New()
+	if err := purchase.NewService(nil, repo, nil).ImportPurchase(context.Background(), id, time.Now().Add(-time.Minute), p); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	saved, err := repo.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	return saved
+}
+
+func Test_GiftReceiptsKeepTheItemsAndReturnCodeButNoPrices(t *testing.T) {
+	p := newPurchase(t)
+	// Discounted lattes still fold into one line on a gift receipt.
+	p.ProductsToPurchase[2].BasePrice = *money.New(0, "EUR")
+
+	r, err := receipt.Build(p, receipt.ModeGift, moneyfmt.Locale{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(r.Lines) != 2 || r.Lines[0] != (receipt.Line{Item: "latte", Quantity: 2}) || r.Lines[1] != (receipt.Line{Item: "croissant", Quantity: 1}) {
+		t.Fatalf("expected 2 lattes and a croissant without amounts but got %+v", r.Lines)
+	}
+	if r.Total != "" || r.PaidWith != "" {
+		t.Fatalf("expected no total or payment but got %q %q", r.Total, r.PaidWith)
+	}
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	text := b.String()
+	if !strings.HasPrefix(text, "GIFT RECEIPT") || !strings.Contains(text, "*"+receipt.ReturnCode(p.ID)+"*") || strings.Contains(text, "€") {
+		t.Fatalf("expected a gift receipt with the return code and no prices but got\n%s", text)
+	}
+}
+
+func Test_StandardReceiptsWriteAmountsForTheLocale(t *testing.T) {
+	loc, _ := moneyfmt.LocaleFor("de-DE")
+	r, err := receipt.Build(newPurchase(t), receipt.ModeStandard, loc)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Lines[0].Amount != "9,00 €" || r.Total != "12,25 €" || r.PaidWith != string(payment.MEANS_CASH) {
+		t.Fatalf("expected amounts written the German way but got %+v", r)
+	}
+	if _, err := receipt.Build(newPurchase(t), "duplicate", loc); !errors.Is(err, receipt.ErrUnknownMode) {
+		t.Fatalf("expected ErrUnknownMode but got %v", err)
+	}
+}
+
+func Test_ReturnCodesParseBackToThePurchase(t *testing.T) {
+	id := uuid.New()
+	got, err := receipt.ParseReturnCode(" " + strings.ToLower(receipt.ReturnCode(id)) + "\n")
+	if err != nil || got != id {
+		t.Fatalf("expected %s but got %s, %v", id, got, err)
+	}
+	for _, code := range []string{"", "RT", "RTXYZ", "AB" + strings.Repeat("0", 32)} {
+		if _, err := receipt.ParseReturnCode(code); !errors.Is(err, receipt.ErrInvalidReturnCode) {
+			t.Fatalf("expected ErrInvalidReturnCode for %q but got %v", code, err)
+		}
+	}
+}
+
+type purchases map[uuid.UUID]purchase.Purchase
+
+func (ps purchases) GetPurchase(_ context.Context, id uuid.UUID) (purchase.Purchase, error) {
+	p, ok := ps[id]
+	if !ok {
+		return purchase.Purchase{}, purchase.ErrNotFound
+	}
+	return p, nil
+}
+
+func Test_GiftReceiptsCanBeAskedForAfterPaying(t *testing.T) {
+	p := newPurchase(t)
+	svc := receipt.NewService(purchases{p.ID: p})
+
+	r, err := svc.Receipt(context.Background(), p.ID, receipt.ModeGift)
+	if err != nil || r.Mode != receipt.ModeGift || r.ReturnCode != receipt.ReturnCode(p.ID) {
+		t.Fatalf("expected the gift receipt of the purchase but got %+v, %v", r, err)
+	}
+	if _, err := svc.Receipt(context.Background(), uuid.New(), receipt.ModeGift); !errors.Is(err, purchase.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func Test_ReceiptsArePrintedInTheLanguageOfTheStore(t *testing.T) {
+	p := newPurchase(t)
+	catalog := i18n.Catalog{Products: map[string]map[string]i18n.ProductText{"latte": {"de": {Name: "Milchkaffee"}}}}
+	svc := receipt.NewService(purchases{p.ID: p}, receipt.WithLocalizer(i18n.NewLocalizer(catalog, map[uuid.UUID]string{p.Store.ID: "de-CH"}, "")))
+
+	r, err := svc.Receipt(context.Background(), p.ID, receipt.ModeStandard)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Lines[0].Item != "Milchkaffee" || r.Lines[1].Item != "croissant" || r.Total != "€ 12.25" || r.PaidWith != "Bargeld" {
+		t.Fatalf("expected a Swiss German receipt but got %+v", r)
+	}
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if text := b.String(); !strings.Contains(text, p.PurchasedAt().Format("02.01.2006 15:04")) || !strings.Contains(text, "Bezahlt mit Bargeld") {
+		t.Fatalf("expected the date and payment written in German but got\n%s", text)
+	}
+}
+
+func Test_ReceiptsRenderInLargePrintAndPlainText(t *testing.T) {
+	p := newPurchase(t)
+	r, err := receipt.Build(p, receipt.ModeStandard, moneyfmt.Locale{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	var large strings.Builder
+	if err := receipt.Render(&large, r, receipt.ProfileLargePrint); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	for _, line := range strings.Split(large.String(), "\n") {
+		if len(line) > 32 {
+			t.Fatalf("expected short lines in large print but got %q", line)
+		}
+	}
+	if !strings.Contains(large.String(), "\n    "+r.Total+"\n") {
+		t.Fatalf("expected the total on a line of its own but got\n%s", large.String())
+	}
+
+	var plain strings.Builder
+	if err := receipt.Render(&plain, r, receipt.ProfilePlainText); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	text := plain.String()
+	if !strings.Contains(text, "Total "+r.Total+", paid with cash.") || strings.Contains(text, "*") {
+		t.Fatalf("expected the receipt in sentences without a barcode but got\n%s", text)
+	}
+	if strings.Contains(text, r.ReturnCode) || !strings.Contains(text, "Return code ") {
+		t.Fatalf("expected the return code spelled in groups but got\n%s", text)
+	}
+
+	if err := receipt.Render(&plain, r, "braille"); !errors.Is(err, receipt.ErrUnknownProfile) {
+		t.Fatalf("expected ErrUnknownProfile but got %v", err)
+	}
+}
+
+// crowdedDay is a store's day where the first codes drawn are taken already.
+type crowdedDay struct {
+	*receipt.MemoryCodeRepository
+	taken int
+}
+
+func (c *crowdedDay) Claim(ctx context.Context, code receipt.ShortCode) error {
+	if c.taken > 0 {
+		c.taken--
+		return receipt.ErrShortCodeTaken
+	}
+	return c.MemoryCodeRepository.Claim(ctx, code)
+}
+
+func Test_ShortCodesFindThePurchaseAtItsStoreOnItsDay(t *testing.T) {
+	ctx := context.Background()
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	soho, mitte, purchaseID := uuid.New(), uuid.New(), uuid.New()
+	repo := &crowdedDay{MemoryCodeRepository: receipt.NewMemoryCodeRepo(), taken: 2}
+	codes := receipt.NewCodes(repo, receipt.WithTimeZones(map[uuid.UUID]*time.Location{mitte: berlin}))
+	lateEvening := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+
+	code, err := codes.Assign(ctx, mitte, purchaseID, lateEvening)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(code) != receipt.ShortCodeLength || repo.taken != 0 {
+		t.Fatalf("expected an 8 character code drawn past the taken ones but got %q", code)
+	}
+	typed := strings.ToLower(receipt.FormatShortCode(code))
+	if got, err := codes.Lookup(ctx, mitte, "2026-03-03", typed); err != nil || got != purchaseID {
+		t.Fatalf("expected %q to find %s on Berlin's 3 March but got %s, %v", typed, purchaseID, got, err)
+	}
+	for _, miss := range []struct {
+		store uuid.UUID
+		day   string
+	}{{mitte, "2026-03-02"}, {soho, "2026-03-03"}} {
+		if _, err := codes.Lookup(ctx, miss.store, miss.day, code); !errors.Is(err, receipt.ErrShortCodeUnknown) {
+			t.Fatalf("expected ErrShortCodeUnknown at another store or day but got %v", err)
+		}
+	}
+	if _, err := codes.Lookup(ctx, mitte, "2026-03-03", "K7Q2"); !errors.Is(err, receipt.ErrInvalidShortCode) {
+		t.Fatalf("expected ErrInvalidShortCode but got %v", err)
+	}
+
+	repo.taken = 5
+	if _, err := codes.Assign(ctx, soho, uuid.New(), lateEvening); !errors.Is(err, receipt.ErrShortCodeTaken) {
+		t.Fatalf("expected to give up once every code drawn is taken but got %v", err)
+	}
+}
+
+func Test_ShortCodesAreReadTheWayTheyAreTyped(t *testing.T) {
+	for typed, want := range map[string]string{"K7Q2-M9XD": "K7Q2M9XD", "k7q2 m9xd": "K7Q2M9XD", "IOL2M9XD": "1012M9XD"} {
+		if got, err := receipt.ParseShortCode(typed); err != nil || got != want {
+			t.Fatalf("expected %q to read %q but got %q, %v", typed, want, got, err)
+		}
+	}
+	for _, typed := range []string{"", "K7Q2M9X", "K7Q2M9XU"} {
+		if _, err := receipt.ParseShortCode(typed); !errors.Is(err, receipt.ErrInvalidShortCode) {
+			t.Fatalf("expected %q to be ErrInvalidShortCode but got %v", typed, err)
+		}
+	}
+}
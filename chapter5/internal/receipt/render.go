@@ -0,0 +1,164 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/purchase"
+)
+
+// Profile is how a receipt is laid out for whoever reads it.
+type Profile string
+
+const (
+	// ProfileStandard is the receipt printed at the till, in columns, see Receipt.WriteTo.
+	ProfileStandard Profile = "standard"
+	// ProfileLargePrint gives every item, amount and heading a short line of its own, so nothing wraps when
+	// the receipt is zoomed in on or printed large.
+	ProfileLargePrint Profile = "large_print"
+	// ProfilePlainText writes the receipt in sentences, for screen readers: no columns, barcode or
+	// decoration to be read out, and codes in groups of four to be spelled.
+	ProfilePlainText Profile = "plain_text"
+)
+
+var ErrUnknownProfile = errors.New("receipt profile must be standard, large_print or plain_text")
+
+// Profiles are every profile, in the order they are offered to customers.
+var Profiles = []Profile{ProfileStandard, ProfileLargePrint, ProfilePlainText}
+
+// Renderer writes a receipt laid out in a profile.
+type Renderer func(w io.Writer, r Receipt) error
+
+var renderers = map[Profile]Renderer{
+	ProfileStandard: func(w io.Writer, r Receipt) error {
+		_, err := r.WriteTo(w)
+		return err
+	},
+	ProfileLargePrint: largePrint,
+	ProfilePlainText:  plainText,
+}
+
+// Render writes r to w laid out in p. The empty profile is the standard one.
+func Render(w io.Writer, r Receipt, p Profile) error {
+	if p == "" {
+		p = ProfileStandard
+	}
+	render, ok := renderers[p]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownProfile, p)
+	}
+	return render(w, r)
+}
+
+func largePrint(w io.Writer, r Receipt) error {
+	pr := r.printer
+	var b strings.Builder
+	if r.Mode == ModeGift {
+		b.WriteString(pr.Text("receipt.gift") + "\n\n")
+	}
+	fmt.Fprintf(&b, "CoffeeCo\n%s\n", pr.DateTime(r.PurchasedAt, "2006-01-02 15:04"))
+	if r.ShortCode != "" {
+		fmt.Fprintf(&b, "%s\n", pr.Text("receipt.code", FormatShortCode(r.ShortCode)))
+	}
+	for _, l := range r.Lines {
+		fmt.Fprintf(&b, "\n%d x %s\n", l.Quantity, l.Item)
+		if l.Amount != "" {
+			fmt.Fprintf(&b, "    %s\n", l.Amount)
+		}
+	}
+	if r.Total != "" {
+		fmt.Fprintf(&b, "\n%s\n    %s\n%s\n", pr.Text("receipt.total"), r.Total, pr.Text("receipt.paid_with", r.PaidWith))
+	}
+	fmt.Fprintf(&b, "\n%s\n", pr.Text("receipt.return_code"))
+	groups := strings.Fields(spell(r.ReturnCode))
+	for len(groups) > 4 {
+		fmt.Fprintf(&b, "%s\n", strings.Join(groups[:4], " "))
+		groups = groups[4:]
+	}
+	fmt.Fprintf(&b, "%s\n", strings.Join(groups, " "))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func plainText(w io.Writer, r Receipt) error {
+	pr := r.printer
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", pr.Text("receipt.plain.intro", pr.DateTime(r.PurchasedAt, "2 January 2006 at 15:04")))
+	if r.Mode == ModeGift {
+		fmt.Fprintf(&b, "%s\n", pr.Text("receipt.plain.gift"))
+	}
+	if r.ShortCode != "" {
+		fmt.Fprintf(&b, "%s\n", pr.Text("receipt.plain.code", spell(r.ShortCode)))
+	}
+	b.WriteString("\n")
+	for _, l := range r.Lines {
+		if l.Amount == "" {
+			fmt.Fprintf(&b, "%s\n", pr.Text("receipt.plain.gift_line", l.Quantity, l.Item))
+			continue
+		}
+		fmt.Fprintf(&b, "%s\n", pr.Text("receipt.plain.line", l.Quantity, l.Item, l.Amount))
+	}
+	if r.Total != "" {
+		fmt.Fprintf(&b, "\n%s\n", pr.Text("receipt.plain.total", r.Total, r.PaidWith))
+	}
+	fmt.Fprintf(&b, "\n%s\n", pr.Text("receipt.plain.return_code", spell(r.ReturnCode)))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// spell groups code in fours, which screen readers read out a group at a time rather than as one word.
+func spell(code string) string {
+	var b strings.Builder
+	for i, c := range strings.ReplaceAll(code, "-", "") {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// FromCompleted is the standard receipt of a completed purchase, as customers are sent it, with pr's
+// products, amounts and language. Identical lines are folded into one, in the order they were bought.
+func FromCompleted(e purchase.Completed, pr i18n.Printer) Receipt {
+	r := Receipt{
+		PurchaseID:  e.PurchaseID,
+		StoreID:     e.StoreID,
+		PurchasedAt: e.PurchasedAt,
+		Mode:        ModeStandard,
+		ReturnCode:  ReturnCode(e.PurchaseID),
+		ShortCode:   e.ReceiptCode,
+		printer:     pr,
+	}
+	type key struct {
+		item   string
+		amount int64
+	}
+	index := map[key]int{}
+	var amounts []int64
+	for _, l := range e.Lines {
+		k := key{item: l.ItemName, amount: l.Amount}
+		if i, ok := index[k]; ok {
+			r.Lines[i].Quantity++
+			continue
+		}
+		index[k] = len(r.Lines)
+		r.Lines = append(r.Lines, Line{Item: pr.Product(l.ItemName).Name, Quantity: 1})
+		amounts = append(amounts, l.Amount)
+	}
+	for i := range r.Lines {
+		r.Lines[i].Amount = pr.Amount(amounts[i]*int64(r.Lines[i].Quantity), e.Currency)
+	}
+	for _, c := range e.Charges {
+		r.Lines = append(r.Lines, Line{Item: strings.ReplaceAll(c.Type, "_", " "), Quantity: 1, Amount: pr.Amount(c.Amount, e.Currency)})
+	}
+	if e.Rounding != 0 {
+		r.Lines = append(r.Lines, Line{Item: pr.Text("receipt.rounding"), Quantity: 1, Amount: pr.Amount(e.Rounding, e.Currency)})
+	}
+	r.Total = pr.Amount(e.Total, e.Currency)
+	r.PaidWith = pr.Means(e.PaymentMeans)
+	return r
+}
@@ -0,0 +1,105 @@
+package redemption_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/redemption"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+var secret = []byte("scan me")
+
+func Test_ATokenIsRedeemedOnceWhileItIsValid(t *testing.T) {
+	ctx := context.Background()
+	alice := uuid.New()
+	clock := testsupport.NewClock(time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC))
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Store{}, coffeeco.CoffeeLover{ID: alice})
+	if err := cards.Save(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+	entitlements := entitlement.NewService(entitlement.NewMemoryRepo(), entitlement.WithClock(clock.Now))
+	staff, err := entitlements.Grant(ctx, entitlement.Grant{CustomerID: alice, Kind: entitlement.KindEmployee, PercentOff: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := redemption.NewService(secret, redemption.NewMemoryRepo(), cards, entitlements, redemption.WithClock(clock.Now))
+	if err := svc.BindDevice(ctx, alice, "alice-phone"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	for _, sub := range []redemption.Subject{{Kind: redemption.KindCoffeeBux, ID: card.ID}, {Kind: redemption.KindEntitlement, ID: staff.ID}} {
+		token, err := svc.Issue(ctx, alice, "alice-phone", sub)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if want := clock.Now().Add(redemption.DefaultValidity); !token.ExpiresAt.Equal(want) {
+			t.Fatalf("expected the token to expire at %v but got %v", want, token.ExpiresAt)
+		}
+		got, err := svc.Redeem(ctx, token.Value)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if got.Subject != sub || got.CustomerID != alice {
+			t.Fatalf("expected %+v of alice but got %+v", sub, got)
+		}
+		if _, err := svc.Redeem(ctx, token.Value); !errors.Is(err, redemption.ErrReplayed) {
+			t.Fatalf("expected ErrReplayed but got %v", err)
+		}
+	}
+
+	token, _ := svc.Issue(ctx, alice, "alice-phone", redemption.Subject{Kind: redemption.KindCoffeeBux, ID: card.ID})
+	clock.Advance(redemption.DefaultValidity)
+	if _, err := svc.Redeem(ctx, token.Value); !errors.Is(err, redemption.ErrExpired) {
+		t.Fatalf("expected ErrExpired but got %v", err)
+	}
+	if _, err := svc.Redeem(ctx, token.Value+"x"); !errors.Is(err, redemption.ErrInvalidToken) {
+		t.Fatalf("expected a tampered token to be ErrInvalidToken but got %v", err)
+	}
+	other := redemption.NewService([]byte("another secret"), redemption.NewMemoryRepo(), cards, entitlements, redemption.WithClock(clock.Now))
+	if _, err := other.Redeem(ctx, token.Value); !errors.Is(err, redemption.ErrInvalidToken) {
+		t.Fatalf("expected a token signed with another secret to be ErrInvalidToken but got %v", err)
+	}
+}
+
+func Test_TokensAreBoundToTheCustomersDevice(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Store{}, coffeeco.CoffeeLover{ID: alice})
+	if err := cards.Save(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+	svc := redemption.NewService(secret, redemption.NewMemoryRepo(), cards, entitlement.NewService(entitlement.NewMemoryRepo()))
+	sub := redemption.Subject{Kind: redemption.KindCoffeeBux, ID: card.ID}
+
+	if _, err := svc.Issue(ctx, alice, "alice-phone", sub); !errors.Is(err, redemption.ErrNoDevice) {
+		t.Fatalf("expected ErrNoDevice but got %v", err)
+	}
+	_ = svc.BindDevice(ctx, alice, "alice-phone")
+	_ = svc.BindDevice(ctx, bob, "bob-phone")
+	if _, err := svc.Issue(ctx, alice, "bob-phone", sub); !errors.Is(err, redemption.ErrWrongDevice) {
+		t.Fatalf("expected ErrWrongDevice but got %v", err)
+	}
+	if _, err := svc.Issue(ctx, bob, "bob-phone", sub); !errors.Is(err, redemption.ErrNotOwner) {
+		t.Fatalf("expected bob not to get a token for alice's card but got %v", err)
+	}
+
+	token, err := svc.Issue(ctx, alice, "alice-phone", sub)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	_ = svc.BindDevice(ctx, alice, "alice-new-phone")
+	if _, err := svc.Redeem(ctx, token.Value); !errors.Is(err, redemption.ErrWrongDevice) {
+		t.Fatalf("expected a token from alice's old phone to be ErrWrongDevice but got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package redemption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Device returns the device bound to the customer, or "" if there is none.
+	Device(ctx context.Context, customerID uuid.UUID) (string, error)
+	// BindDevice replaces the device bound to the customer.
+	BindDevice(ctx context.Context, customerID uuid.UUID, deviceID string, at time.Time) error
+	// Redeem records that a token was scanned, returning ErrReplayed if it was before. Tokens only need to be
+	// remembered until they expire.
+	Redeem(ctx context.Context, tokenID uuid.UUID, expiresAt time.Time) error
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client   *mongo.Client
+	devices  *mongo.Collection
+	redeemed *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	redeemed := db.Collection("redeemed_tokens")
+	// Mongo deletes tokens once they expire, as they can no longer be scanned anyway.
+	_, err = redeemed.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redeemed token indexes: %w", err)
+	}
+	return &MongoRepository{client: client, devices: db.Collection("customer_devices"), redeemed: redeemed}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoDevice struct {
+	CustomerID string    `bson:"_id"`
+	DeviceID   string    `bson:"device_id"`
+	BoundAt    time.Time `bson:"bound_at"`
+}
+
+func (m *MongoRepository) Device(ctx context.Context, customerID uuid.UUID) (_ string, err error) {
+	ctx, span := telemetry.StartClient(ctx, "redemption.MongoRepository.Device", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoDevice
+	if err := m.devices.FindOne(ctx, bson.D{{Key: "_id", Value: customerID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to find customer device: %w", err)
+	}
+	return doc.DeviceID, nil
+}
+
+func (m *MongoRepository) BindDevice(ctx context.Context, customerID uuid.UUID, deviceID string, at time.Time) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "redemption.MongoRepository.BindDevice", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	doc := mongoDevice{CustomerID: customerID.String(), DeviceID: deviceID, BoundAt: at}
+	_, err = m.devices.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.CustomerID}}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to bind customer device: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Redeem(ctx context.Context, tokenID uuid.UUID, expiresAt time.Time) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "redemption.MongoRepository.Redeem")
+	defer telemetry.End(span, &err)
+	_, err = m.redeemed.InsertOne(ctx, bson.D{{Key: "_id", Value: tokenID.String()}, {Key: "expires_at", Value: expiresAt}})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrReplayed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record redeemed token: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.devices.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps devices and redeemed tokens in process. It is meant for tests and local
+// experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	devices  map[uuid.UUID]string
+	redeemed map[uuid.UUID]bool
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{devices: map[uuid.UUID]string{}, redeemed: map[uuid.UUID]bool{}}
+}
+
+func (m *MemoryRepository) Device(_ context.Context, customerID uuid.UUID) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.devices[customerID], nil
+}
+
+func (m *MemoryRepository) BindDevice(_ context.Context, customerID uuid.UUID, deviceID string, _ time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices[customerID] = deviceID
+	return nil
+}
+
+func (m *MemoryRepository) Redeem(_ context.Context, tokenID uuid.UUID, _ time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.redeemed[tokenID] {
+		return ErrReplayed
+	}
+	m.redeemed[tokenID] = true
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,163 @@
+package redemption
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/signing"
+	"coffeeco/internal/telemetry"
+)
+
+// DefaultValidity is how long a token can be scanned without WithValidity: long enough to walk up to the
+// till, too short to be worth passing on.
+const DefaultValidity = time.Minute
+
+// Cards are the loyalty cards tokens are issued for; loyalty.Repository is one.
+type Cards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+}
+
+// Entitlements are the entitlements tokens are issued for; *entitlement.Service is one.
+type Entitlements interface {
+	Get(ctx context.Context, id uuid.UUID) (*entitlement.Entitlement, error)
+}
+
+type Service struct {
+	secret       []byte
+	repo         Repository
+	cards        Cards
+	entitlements Entitlements
+	validFor     time.Duration
+	now          func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithValidity replaces DefaultValidity.
+func WithValidity(d time.Duration) Option {
+	return func(s *Service) {
+		s.validFor = d
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test expiry.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// NewService issues tokens signed with secret for the customers' loyalty cards and entitlements, and
+// redeems them when scanned.
+func NewService(secret []byte, repo Repository, cards Cards, entitlements Entitlements, opts ...Option) *Service {
+	s := &Service{secret: secret, repo: repo, cards: cards, entitlements: entitlements, validFor: DefaultValidity, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// BindDevice makes deviceID the only device the customer's tokens are issued to and scanned from. Tokens
+// issued to the device bound before can no longer be scanned.
+func (s *Service) BindDevice(ctx context.Context, customerID uuid.UUID, deviceID string) error {
+	deviceID = strings.TrimSpace(deviceID)
+	if deviceID == "" {
+		return ErrNoDevice
+	}
+	return s.repo.BindDevice(ctx, customerID, deviceID, s.now())
+}
+
+// Issue signs a token for a loyalty card or entitlement of the customer, to be shown on the device bound to
+// them.
+func (s *Service) Issue(ctx context.Context, customerID uuid.UUID, deviceID string, sub Subject) (_ *Token, err error) {
+	ctx, span := telemetry.Start(ctx, "redemption.Service.Issue", attribute.String("customer.id", customerID.String()), attribute.String("redemption.kind", string(sub.Kind)))
+	defer telemetry.End(span, &err)
+	if err := s.checkDevice(ctx, customerID, deviceID); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if err := s.checkOwner(ctx, customerID, sub, now); err != nil {
+		return nil, err
+	}
+	c := claims{ID: uuid.New(), Kind: sub.Kind, SubjectID: sub.ID, CustomerID: customerID, DeviceID: deviceID, ExpiresAt: now.Add(s.validFor).Unix()}
+	value, err := signing.Sign(s.secret, c)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{Value: value, ExpiresAt: time.Unix(c.ExpiresAt, 0)}, nil
+}
+
+// Redeem returns what a scanned token stands for. A token is only redeemed once, while it has not expired,
+// the device it was issued to is still the customer's and the customer still owns what it is for.
+func (s *Service) Redeem(ctx context.Context, token string) (_ *Redemption, err error) {
+	ctx, span := telemetry.Start(ctx, "redemption.Service.Redeem")
+	defer telemetry.End(span, &err)
+	var c claims
+	if err := signing.Verify(s.secret, token, &c); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := s.now()
+	expiresAt := time.Unix(c.ExpiresAt, 0)
+	if !now.Before(expiresAt) {
+		return nil, ErrExpired
+	}
+	if err := s.checkDevice(ctx, c.CustomerID, c.DeviceID); err != nil {
+		return nil, err
+	}
+	sub := Subject{Kind: c.Kind, ID: c.SubjectID}
+	if err := s.checkOwner(ctx, c.CustomerID, sub, now); err != nil {
+		return nil, err
+	}
+	// Recorded last, so a token turned away for another reason can be scanned again once it is sorted out.
+	if err := s.repo.Redeem(ctx, c.ID, expiresAt); err != nil {
+		return nil, err
+	}
+	return &Redemption{Subject: sub, CustomerID: c.CustomerID, DeviceID: c.DeviceID}, nil
+}
+
+func (s *Service) checkDevice(ctx context.Context, customerID uuid.UUID, deviceID string) error {
+	bound, err := s.repo.Device(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	if bound == "" {
+		return ErrNoDevice
+	}
+	if bound != deviceID {
+		return ErrWrongDevice
+	}
+	return nil
+}
+
+// checkOwner checks the customer owns what sub is for and, for an entitlement, that it can be used at at.
+func (s *Service) checkOwner(ctx context.Context, customerID uuid.UUID, sub Subject, at time.Time) error {
+	switch sub.Kind {
+	case KindCoffeeBux:
+		card, err := s.cards.Get(ctx, sub.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get loyalty card: %w", err)
+		}
+		if card.CustomerID() != customerID {
+			return ErrNotOwner
+		}
+	case KindEntitlement:
+		e, err := s.entitlements.Get(ctx, sub.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get entitlement: %w", err)
+		}
+		if e.CustomerID != customerID {
+			return ErrNotOwner
+		}
+		return e.Usable(at)
+	default:
+		return ErrUnknownKind
+	}
+	return nil
+}
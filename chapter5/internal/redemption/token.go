@@ -0,0 +1,57 @@
+package redemption
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("QR code is not one of ours")
+	ErrExpired      = errors.New("QR code has expired, please show a new one")
+	ErrReplayed     = errors.New("QR code was already scanned")
+	ErrUnknownKind  = errors.New("QR codes are for a loyalty card or an entitlement")
+	ErrNoDevice     = errors.New("customer has no device bound to show QR codes on")
+	// ErrWrongDevice is for tokens asked for or shown from a device other than the customer's, e.g. a
+	// screenshot sent to a friend after the customer moved to a new phone.
+	ErrWrongDevice = errors.New("QR code is not from the customer's device")
+	ErrNotOwner    = errors.New("customer does not own what the QR code is for")
+)
+
+// Kind is what a token stands for.
+type Kind string
+
+const (
+	KindCoffeeBux   Kind = "coffeebux"
+	KindEntitlement Kind = "entitlement"
+)
+
+// Subject is the loyalty card or entitlement a token stands for.
+type Subject struct {
+	Kind Kind
+	ID   uuid.UUID
+}
+
+// Token is shown as a QR code on the customer's device, for a barista to scan until ExpiresAt.
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// Redemption is what a scanned token stands for.
+type Redemption struct {
+	Subject
+	CustomerID uuid.UUID
+	DeviceID   string
+}
+
+// claims are what a token says, with short names to keep QR codes small.
+type claims struct {
+	ID         uuid.UUID `json:"jti"`
+	Kind       Kind      `json:"k"`
+	SubjectID  uuid.UUID `json:"sub"`
+	CustomerID uuid.UUID `json:"cus"`
+	DeviceID   string    `json:"dev"`
+	ExpiresAt  int64     `json:"exp"`
+}
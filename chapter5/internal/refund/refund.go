@@ -0,0 +1,174 @@
+package refund
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("refund not found")
+	ErrInvalidTransition   = errors.New("refund cannot move to that status")
+	ErrConcurrencyConflict = errors.New("refund changed since it was read")
+	ErrNoReason            = errors.New("refunds need a reason")
+	ErrNoActor             = errors.New("refunds are only requested and decided by someone signed in")
+	// ErrSelfApproval means the approver asked for the refund themselves; a refund that needs approval needs
+	// a second person.
+	ErrSelfApproval = errors.New("refunds cannot be approved by whoever requested them")
+)
+
+// Status is where a refund is, from the request to the money given back.
+type Status string
+
+const (
+	StatusRequested Status = "requested"
+	StatusApproved  Status = "approved"
+	StatusRejected  Status = "rejected"
+	StatusExecuted  Status = "executed"
+)
+
+// Policy says which refunds a manager of the store has to approve before they are made.
+type Policy struct {
+	// Currency of Threshold. Refunds in other currencies always need approval.
+	Currency string
+	// Threshold is the amount over which refunds need approval, in the minor unit of Currency; 0 lets any
+	// amount through.
+	Threshold int64
+	// MaxAge is how old a purchase may be for its refunds to go through without approval; 0 lets any age
+	// through.
+	MaxAge time.Duration
+}
+
+// NeedsApproval tells why a refund for a purchase made at purchasedAt needs approval at at, or "" if it
+// does not. amount is all that is given back for the purchase with the refund, so a refund cannot be split
+// into several under the threshold.
+func (p Policy) NeedsApproval(amount money.Money, purchasedAt, at time.Time) string {
+	switch {
+	case p.Threshold > 0 && amount.Currency().Code != p.Currency:
+		return fmt.Sprintf("refunds in %s need approval", amount.Currency().Code)
+	case p.Threshold > 0 && amount.Amount() > p.Threshold:
+		return fmt.Sprintf("%s in refunds is over the %s limit", amount.Display(), money.New(p.Threshold, p.Currency).Display())
+	case p.MaxAge > 0 && at.Sub(purchasedAt) > p.MaxAge:
+		return fmt.Sprintf("the purchase is older than %d days", int(p.MaxAge.Hours()/24))
+	}
+	return ""
+}
+
+// Refund gives part or all of a purchase back to the customer, once it is approved if it has to be.
+type Refund struct {
+	ID         uuid.UUID
+	PurchaseID uuid.UUID
+	StoreID    uuid.UUID
+	Amount     money.Money
+	// Reason is why the customer gets their money back, e.g. "spilled drink".
+	Reason      string
+	RequestedBy string
+	RequestedAt time.Time
+	// ApprovalReason is why the refund needed approval; empty for refunds that did not.
+	ApprovalReason string
+
+	status     Status
+	decidedBy  string
+	decidedAt  time.Time
+	note       string
+	executedAt time.Time
+	version    int
+}
+
+// New requests a refund of amount for a purchase made at the store.
+func New(purchaseID, storeID uuid.UUID, amount money.Money, reason, by string, at time.Time) (*Refund, error) {
+	if reason == "" {
+		return nil, ErrNoReason
+	}
+	if by == "" {
+		return nil, ErrNoActor
+	}
+	return &Refund{
+		ID:          uuid.New(),
+		PurchaseID:  purchaseID,
+		StoreID:     storeID,
+		Amount:      amount,
+		Reason:      reason,
+		RequestedBy: by,
+		RequestedAt: at.UTC(),
+		status:      StatusRequested,
+	}, nil
+}
+
+func (r *Refund) Status() Status {
+	return r.status
+}
+
+// DecidedBy is the manager who approved or rejected the refund, or the system for refunds within the
+// policy.
+func (r *Refund) DecidedBy() string {
+	return r.decidedBy
+}
+
+func (r *Refund) DecidedAt() time.Time {
+	return r.decidedAt
+}
+
+// Note is what the manager said when deciding, e.g. why they rejected it.
+func (r *Refund) Note() string {
+	return r.note
+}
+
+func (r *Refund) ExecutedAt() time.Time {
+	return r.executedAt
+}
+
+// Approve is called by the manager who agrees to give the money back, who must not be who asked for it.
+func (r *Refund) Approve(by, note string, at time.Time) error {
+	if by == "" {
+		return ErrNoActor
+	}
+	if by == r.RequestedBy {
+		return ErrSelfApproval
+	}
+	return r.decide(StatusApproved, by, note, at)
+}
+
+// Reject turns the refund down for good.
+func (r *Refund) Reject(by, note string, at time.Time) error {
+	if by == "" {
+		return ErrNoActor
+	}
+	if note == "" {
+		return ErrNoReason
+	}
+	return r.decide(StatusRejected, by, note, at)
+}
+
+// approveWithinPolicy approves a refund the policy lets through without a manager.
+func (r *Refund) approveWithinPolicy(by string, at time.Time) error {
+	return r.decide(StatusApproved, by, "", at)
+}
+
+// Executed records that the money was given back.
+func (r *Refund) Executed(at time.Time) error {
+	if err := r.move(StatusApproved, StatusExecuted); err != nil {
+		return err
+	}
+	r.executedAt = at.UTC()
+	return nil
+}
+
+func (r *Refund) decide(status Status, by, note string, at time.Time) error {
+	if err := r.move(StatusRequested, status); err != nil {
+		return err
+	}
+	r.decidedBy, r.note, r.decidedAt = by, note, at.UTC()
+	return nil
+}
+
+func (r *Refund) move(from, to Status) error {
+	if r.status != from {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, r.ID, r.status, from)
+	}
+	r.status = to
+	return nil
+}
@@ -0,0 +1,198 @@
+package refund_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+// wallet records the refunds made, failing them while down.
+type wallet struct {
+	refunded []money.Money
+	down     bool
+}
+
+func (w *wallet) Refund(_ context.Context, _, _ uuid.UUID, amount money.Money) error {
+	if w.down {
+		return errors.New("wallet is down")
+	}
+	w.refunded = append(w.refunded, amount)
+	return nil
+}
+
+// policy has refunds over £10.00 or of purchases older than 30 days approved.
+var policy = refund.Policy{Currency: "GBP", Threshold: 1000, MaxAge: 30 * 24 * time.Hour}
+
+// newService refunds a £25.00 purchase made 40 days ago.
+func newService(t *testing.T, policy refund.Policy, w *wallet, log audit.Recorder) (*refund.Service, uuid.UUID) {
+	return newServiceFor(t, policy, w, log, payment.MEANS_WALLET)
+}
+
+// newServiceFor refunds a £25.00 purchase made 40 days ago, paid by means.
+func newServiceFor(t *testing.T, policy refund.Policy, w *wallet, log audit.Recorder, means payment.Means) (*refund.Service, uuid.UUID) {
+	t.Helper()
+	ps := purchase.NewService(nil, testsupport.NewFakePurchases(), nil)
+	id := uuid.New()
+	p := &purchase.Purchase{
+		Store:              store.Ref(uuid.New()),
+		CustomerID:         uuid.New(),
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "beans", BasePrice: *money.New(2500, "GBP")}},
+		PaymentMeans:       means,
+	}
+	now := time.Now()
+	if err := ps.ImportPurchase(context.Background(), id, now.Add(-40*24*time.Hour), p); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	return refund.NewService(refund.NewMemoryRepo(), ps, w, policy, refund.WithAuditLog(log), refund.WithClock(func() time.Time { return now })), id
+}
+
+func Test_RefundsWithinThePolicyAreMadeAtOnce(t *testing.T) {
+	now := time.Now()
+	if why := policy.NeedsApproval(*money.New(1000, "GBP"), now.Add(-time.Hour), now); why != "" {
+		t.Fatalf("expected a £10.00 refund of today's purchase to need no approval but got %q", why)
+	}
+	for name, why := range map[string]string{
+		"over the limit": policy.NeedsApproval(*money.New(1001, "GBP"), now, now),
+		"in euros":       policy.NeedsApproval(*money.New(100, "EUR"), now, now),
+		"too old":        policy.NeedsApproval(*money.New(100, "GBP"), now.Add(-31*24*time.Hour), now),
+	} {
+		if why == "" {
+			t.Fatalf("expected a refund %s to need approval", name)
+		}
+	}
+
+	w := &wallet{}
+	svc, id := newService(t, refund.Policy{Currency: "GBP", Threshold: 1000}, w, audit.NewMemoryRepo())
+	r, err := svc.Request(audit.WithActor(context.Background(), "barista-1"), id, *money.New(500, "GBP"), "spilled drink")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != refund.StatusExecuted || r.DecidedBy() != audit.ActorSystem || len(w.refunded) != 1 {
+		t.Fatalf("expected the refund to be made without approval but got %+v, refunded %v", r, w.refunded)
+	}
+}
+
+func Test_RefundsOutsideThePolicyWaitForAnotherManager(t *testing.T) {
+	w, log := &wallet{}, audit.NewMemoryRepo()
+	svc, id := newService(t, policy, w, log)
+	barista := audit.WithActor(context.Background(), "barista-1")
+	manager := audit.WithActor(context.Background(), "manager-1")
+
+	if _, err := svc.Request(barista, id, *money.New(2600, "GBP"), "too much"); !errors.Is(err, refund.ErrInvalidAmount) {
+		t.Fatalf("expected ErrInvalidAmount for more than was paid but got %v", err)
+	}
+	if _, err := svc.Request(barista, id, *money.New(500, "GBP"), ""); !errors.Is(err, refund.ErrNoReason) {
+		t.Fatalf("expected ErrNoReason but got %v", err)
+	}
+	r, err := svc.Request(barista, id, *money.New(500, "GBP"), "stale beans")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != refund.StatusRequested || r.ApprovalReason == "" || len(w.refunded) != 0 {
+		t.Fatalf("expected the refund of an old purchase to wait for approval but got %+v", r)
+	}
+	if pending, _ := svc.Pending(context.Background(), r.StoreID); len(pending) != 1 || pending[0].ID != r.ID {
+		t.Fatalf("expected the refund to be pending at the store but got %v", pending)
+	}
+	if _, err := svc.Approve(barista, r.ID, ""); !errors.Is(err, refund.ErrSelfApproval) {
+		t.Fatalf("expected ErrSelfApproval but got %v", err)
+	}
+
+	w.down = true
+	r, err = svc.Approve(manager, r.ID, "regular customer")
+	if err == nil || r.Status() != refund.StatusApproved || r.DecidedBy() != "manager-1" {
+		t.Fatalf("expected the refund approved by manager-1 but not made but got %+v, %v", r, err)
+	}
+	if _, err := svc.Reject(manager, r.ID, "changed my mind"); !errors.Is(err, refund.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition for an approved refund but got %v", err)
+	}
+	w.down = false
+	r, err = svc.Execute(manager, r.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != refund.StatusExecuted || len(w.refunded) != 1 || r.ExecutedAt().IsZero() {
+		t.Fatalf("expected the refund to be made once but got %+v, refunded %v", r, w.refunded)
+	}
+	if _, err := svc.Execute(manager, r.ID); !errors.Is(err, refund.ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition for an executed refund but got %v", err)
+	}
+
+	rejected, _ := svc.Request(barista, id, *money.New(2000, "GBP"), "did not like it")
+	if _, err := svc.Reject(manager, rejected.ID, ""); !errors.Is(err, refund.ErrNoReason) {
+		t.Fatalf("expected ErrNoReason but got %v", err)
+	}
+	if rejected, err = svc.Reject(manager, rejected.ID, "drank it all"); err != nil || rejected.Status() != refund.StatusRejected || rejected.Note() != "drank it all" {
+		t.Fatalf("expected the refund rejected with a reason but got %+v, %v", rejected, err)
+	}
+
+	entries, err := log.Query(context.Background(), audit.Query{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var requests, decisions int
+	for _, e := range entries {
+		switch e.Action {
+		case audit.ActionRefundRequest:
+			requests++
+		case audit.ActionRefundDecision:
+			decisions++
+		}
+	}
+	if requests != 2 || decisions != 2 {
+		t.Fatalf("expected 2 requests and 2 decisions in the audit log but got %+v", entries)
+	}
+}
+
+func Test_RefundsOfAPurchaseAddUp(t *testing.T) {
+	w := &wallet{}
+	svc, id := newService(t, refund.Policy{Currency: "GBP", Threshold: 1000}, w, audit.NewMemoryRepo())
+	barista := audit.WithActor(context.Background(), "barista-1")
+	manager := audit.WithActor(context.Background(), "manager-1")
+
+	for range 2 {
+		if r, err := svc.Request(barista, id, *money.New(500, "GBP"), "spilled drink"); err != nil || r.Status() != refund.StatusExecuted {
+			t.Fatalf("expected £5.00 refunds up to the limit to be made at once but got %+v, %v", r, err)
+		}
+	}
+	r, err := svc.Request(barista, id, *money.New(100, "GBP"), "spilled another")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if r.Status() != refund.StatusRequested || len(w.refunded) != 2 {
+		t.Fatalf("expected a refund taking the purchase over the limit to wait for approval but got %+v", r)
+	}
+	if _, err := svc.Reject(manager, r.ID, "no more"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Request(barista, id, *money.New(1600, "GBP"), "all of it"); !errors.Is(err, refund.ErrInvalidAmount) {
+		t.Fatalf("expected ErrInvalidAmount for more than is left of what was paid but got %v", err)
+	}
+	// The rejected refund was not given back, so the last £15.00 still can be.
+	if _, err := svc.Request(barista, id, *money.New(1500, "GBP"), "all of it"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_RefundsThatCannotBeMadeAreNotAskedFor(t *testing.T) {
+	svc, id := newServiceFor(t, policy, &wallet{}, audit.NewMemoryRepo(), payment.MEANS_CARD)
+	barista := audit.WithActor(context.Background(), "barista-1")
+	if _, err := svc.Request(barista, id, *money.New(500, "GBP"), "stale beans"); !errors.Is(err, purchase.ErrWalletUnavailable) {
+		t.Fatalf("expected ErrWalletUnavailable for a purchase paid by card but got %v", err)
+	}
+	if pending, _ := svc.Pending(context.Background(), uuid.Nil); len(pending) != 0 {
+		t.Fatalf("expected no refund waiting for approval but got %v", pending)
+	}
+}
@@ -0,0 +1,308 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such refund.
+	Get(ctx context.Context, id uuid.UUID) (*Refund, error)
+	// Save returns ErrConcurrencyConflict if the refund was saved by someone else since it was read.
+	Save(ctx context.Context, r *Refund) error
+	// Pending returns the refunds of a store waiting for approval, oldest first.
+	Pending(ctx context.Context, storeID uuid.UUID) ([]*Refund, error)
+	// Executed returns the refunds of the stores made from from (inclusive) to to (exclusive), oldest first.
+	Executed(ctx context.Context, storeIDs []uuid.UUID, from, to time.Time) ([]*Refund, error)
+	// ForPurchase returns every refund asked for of a purchase, whatever became of it, oldest first.
+	ForPurchase(ctx context.Context, purchaseID uuid.UUID) ([]*Refund, error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps refunds versioned, so two managers cannot both decide on the same refund.
+type MongoRepository struct {
+	client  *mongo.Client
+	refunds *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	refunds := client.Database("coffeeco").Collection("refund_requests")
+	_, err = refunds.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "status", Value: 1}, {Key: "requested_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "executed_at", Value: 1}}},
+		{Keys: bson.D{{Key: "purchase_id", Value: 1}, {Key: "requested_at", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund indexes: %w", err)
+	}
+	return &MongoRepository{client: client, refunds: refunds}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoRefund struct {
+	ID             string    `bson:"_id"`
+	Version        int       `bson:"version"`
+	PurchaseID     string    `bson:"purchase_id"`
+	StoreID        string    `bson:"store_id"`
+	Amount         int64     `bson:"amount"`
+	Currency       string    `bson:"currency"`
+	Reason         string    `bson:"reason"`
+	RequestedBy    string    `bson:"requested_by"`
+	RequestedAt    time.Time `bson:"requested_at"`
+	ApprovalReason string    `bson:"approval_reason,omitempty"`
+	Status         string    `bson:"status"`
+	DecidedBy      string    `bson:"decided_by,omitempty"`
+	DecidedAt      time.Time `bson:"decided_at,omitempty"`
+	Note           string    `bson:"note,omitempty"`
+	ExecutedAt     time.Time `bson:"executed_at,omitempty"`
+}
+
+func toMongoRefund(r *Refund) mongoRefund {
+	return mongoRefund{
+		ID:             r.ID.String(),
+		Version:        r.version,
+		PurchaseID:     r.PurchaseID.String(),
+		StoreID:        r.StoreID.String(),
+		Amount:         r.Amount.Amount(),
+		Currency:       r.Amount.Currency().Code,
+		Reason:         r.Reason,
+		RequestedBy:    r.RequestedBy,
+		RequestedAt:    r.RequestedAt,
+		ApprovalReason: r.ApprovalReason,
+		Status:         string(r.status),
+		DecidedBy:      r.decidedBy,
+		DecidedAt:      r.decidedAt,
+		Note:           r.note,
+		ExecutedAt:     r.executedAt,
+	}
+}
+
+func (m mongoRefund) toRefund() *Refund {
+	id, _ := uuid.Parse(m.ID)
+	purchaseID, _ := uuid.Parse(m.PurchaseID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	return &Refund{
+		ID:             id,
+		PurchaseID:     purchaseID,
+		StoreID:        storeID,
+		Amount:         *money.New(m.Amount, m.Currency),
+		Reason:         m.Reason,
+		RequestedBy:    m.RequestedBy,
+		RequestedAt:    m.RequestedAt,
+		ApprovalReason: m.ApprovalReason,
+		status:         Status(m.Status),
+		decidedBy:      m.DecidedBy,
+		decidedAt:      m.DecidedAt,
+		note:           m.Note,
+		executedAt:     m.ExecutedAt,
+		version:        m.Version,
+	}
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Refund, err error) {
+	ctx, span := telemetry.StartClient(ctx, "refund.MongoRepository.Get", attribute.String("refund.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoRefund
+	if err := m.refunds.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find refund: %w", err)
+	}
+	return doc.toRefund(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, r *Refund) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "refund.MongoRepository.Save", attribute.String("refund.id", r.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoRefund(r)
+	doc.Version = r.version + 1
+	if r.version == 0 {
+		if _, err := m.refunds.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+	} else {
+		res, err := m.refunds.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: r.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save refund: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	r.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Pending(ctx context.Context, storeID uuid.UUID) (_ []*Refund, err error) {
+	ctx, span := telemetry.StartClient(ctx, "refund.MongoRepository.Pending", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "status", Value: string(StatusRequested)}}
+	cur, err := m.refunds.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pending refunds: %w", err)
+	}
+	var docs []mongoRefund
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode refunds: %w", err)
+	}
+	refunds := make([]*Refund, 0, len(docs))
+	for _, doc := range docs {
+		refunds = append(refunds, doc.toRefund())
+	}
+	return refunds, nil
+}
+
+func (m *MongoRepository) Executed(ctx context.Context, storeIDs []uuid.UUID, from, to time.Time) (_ []*Refund, err error) {
+	ctx, span := telemetry.StartClient(ctx, "refund.MongoRepository.Executed")
+	defer telemetry.End(span, &err)
+	ids := make([]string, 0, len(storeIDs))
+	for _, id := range storeIDs {
+		ids = append(ids, id.String())
+	}
+	filter := bson.D{
+		{Key: "status", Value: string(StatusExecuted)},
+		{Key: "executed_at", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		{Key: "store_id", Value: bson.D{{Key: "$in", Value: ids}}},
+	}
+	cur, err := m.refunds.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "executed_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find executed refunds: %w", err)
+	}
+	var docs []mongoRefund
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode refunds: %w", err)
+	}
+	refunds := make([]*Refund, 0, len(docs))
+	for _, doc := range docs {
+		refunds = append(refunds, doc.toRefund())
+	}
+	return refunds, nil
+}
+
+func (m *MongoRepository) ForPurchase(ctx context.Context, purchaseID uuid.UUID) (_ []*Refund, err error) {
+	ctx, span := telemetry.StartClient(ctx, "refund.MongoRepository.ForPurchase", attribute.String("purchase.id", purchaseID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{{Key: "purchase_id", Value: purchaseID.String()}}
+	cur, err := m.refunds.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "requested_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find refunds of purchase: %w", err)
+	}
+	var docs []mongoRefund
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode refunds: %w", err)
+	}
+	refunds := make([]*Refund, 0, len(docs))
+	for _, doc := range docs {
+		refunds = append(refunds, doc.toRefund())
+	}
+	return refunds, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.refunds.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps refunds in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	refunds map[uuid.UUID]mongoRefund
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{refunds: map[uuid.UUID]mongoRefund{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.refunds[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toRefund(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, r *Refund) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refunds[r.ID].Version != r.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoRefund(r)
+	doc.Version = r.version + 1
+	m.refunds[r.ID] = doc
+	r.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Pending(_ context.Context, storeID uuid.UUID) ([]*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refunds []*Refund
+	for _, doc := range m.refunds {
+		if doc.StoreID == storeID.String() && doc.Status == string(StatusRequested) {
+			refunds = append(refunds, doc.toRefund())
+		}
+	}
+	slices.SortFunc(refunds, func(a, b *Refund) int { return a.RequestedAt.Compare(b.RequestedAt) })
+	return refunds, nil
+}
+
+func (m *MemoryRepository) Executed(_ context.Context, storeIDs []uuid.UUID, from, to time.Time) ([]*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refunds []*Refund
+	for _, doc := range m.refunds {
+		storeID, _ := uuid.Parse(doc.StoreID)
+		if doc.Status == string(StatusExecuted) && !doc.ExecutedAt.Before(from) && doc.ExecutedAt.Before(to) && slices.Contains(storeIDs, storeID) {
+			refunds = append(refunds, doc.toRefund())
+		}
+	}
+	slices.SortFunc(refunds, func(a, b *Refund) int { return a.ExecutedAt().Compare(b.ExecutedAt()) })
+	return refunds, nil
+}
+
+func (m *MemoryRepository) ForPurchase(_ context.Context, purchaseID uuid.UUID) ([]*Refund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var refunds []*Refund
+	for _, doc := range m.refunds {
+		if doc.PurchaseID == purchaseID.String() {
+			refunds = append(refunds, doc.toRefund())
+		}
+	}
+	slices.SortFunc(refunds, func(a, b *Refund) int { return a.RequestedAt.Compare(b.RequestedAt) })
+	return refunds, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
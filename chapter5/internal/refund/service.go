@@ -0,0 +1,223 @@
+package refund
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/purchase"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the refund first.
+const saveAttempts = 3
+
+var ErrInvalidAmount = errors.New("refunds must be more than zero, in the currency of the purchase and, with the refunds before them, at most what was paid")
+
+// Purchases is where refunded purchases are read from, e.g. purchase.Service.
+type Purchases interface {
+	GetPurchase(ctx context.Context, id uuid.UUID) (purchase.Purchase, error)
+}
+
+// Executor gives the money back, e.g. purchase.Service.
+type Executor interface {
+	Refund(ctx context.Context, storeID, purchaseID uuid.UUID, amount money.Money) error
+}
+
+// Service asks for refunds, has managers approve those the policy does not let through, and makes them.
+type Service struct {
+	repo      Repository
+	purchases Purchases
+	executor  Executor
+	policy    Policy
+	audit     audit.Recorder // 可选, 记录谁申请和审批了退款
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithAuditLog records every request and decision in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test refunds of old purchases.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, purchases Purchases, executor Executor, policy Policy, opts ...Option) *Service {
+	s := &Service{repo: repo, purchases: purchases, executor: executor, policy: policy, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Request asks for amount of a purchase to be given back, for reason. A refund the policy lets through is
+// approved and made at once; any other waits for a manager of the store. The policy weighs the refund with
+// those asked for before it that were not rejected. The refund is returned with the error if it was approved
+// but could not be made, to be made later with Execute.
+func (s *Service) Request(ctx context.Context, purchaseID uuid.UUID, amount money.Money, reason string) (*Refund, error) {
+	p, err := s.purchases.GetPurchase(ctx, purchaseID)
+	if err != nil {
+		return nil, err
+	}
+	total := p.Total()
+	if !amount.IsPositive() || !amount.SameCurrency(&total) || amount.Amount() > total.Amount() {
+		return nil, ErrInvalidAmount
+	}
+	if err := p.Refundable(); err != nil {
+		return nil, err
+	}
+	earlier, err := s.repo.ForPurchase(ctx, purchaseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the refunds of purchase %s: %w", purchaseID, err)
+	}
+	refunded := amount.Amount()
+	for _, e := range earlier {
+		if e.status != StatusRejected {
+			refunded += e.Amount.Amount()
+		}
+	}
+	if refunded > total.Amount() {
+		return nil, ErrInvalidAmount
+	}
+	now := s.now()
+	r, err := New(purchaseID, p.Store.ID, amount, reason, audit.Actor(ctx), now)
+	if err != nil {
+		return nil, err
+	}
+	r.ApprovalReason = s.policy.NeedsApproval(*money.New(refunded, amount.Currency().Code), p.PurchasedAt(), now)
+	if r.ApprovalReason == "" {
+		if err := r.approveWithinPolicy(audit.ActorSystem, now); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Save(ctx, r); err != nil {
+		return nil, fmt.Errorf("failed to save refund: %w", err)
+	}
+	after := fmt.Sprintf("%s %s: %s", r.status, amount.Display(), reason)
+	if r.ApprovalReason != "" {
+		after += " (needs approval: " + r.ApprovalReason + ")"
+	}
+	if err := s.record(ctx, audit.ActionRefundRequest, r, "", after); err != nil {
+		return r, err
+	}
+	if r.status != StatusApproved {
+		return r, nil
+	}
+	return s.execute(ctx, r)
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Refund, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Pending returns the refunds of a store waiting for a manager, oldest first.
+func (s *Service) Pending(ctx context.Context, storeID uuid.UUID) ([]*Refund, error) {
+	return s.repo.Pending(ctx, storeID)
+}
+
+// Approve is called by the manager who agrees to give the money back; the refund is then made. The refund
+// is returned with the error if it was approved but could not be made, to be made later with Execute.
+func (s *Service) Approve(ctx context.Context, id uuid.UUID, note string) (*Refund, error) {
+	by := audit.Actor(ctx)
+	r, err := s.update(ctx, id, func(r *Refund) error {
+		return r.Approve(by, note, s.now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.record(ctx, audit.ActionRefundDecision, r, string(StatusRequested), decision(r)); err != nil {
+		return r, err
+	}
+	return s.execute(ctx, r)
+}
+
+// Reject is called by the manager who turns the refund down, saying why.
+func (s *Service) Reject(ctx context.Context, id uuid.UUID, reason string) (*Refund, error) {
+	by := audit.Actor(ctx)
+	r, err := s.update(ctx, id, func(r *Refund) error {
+		return r.Reject(by, reason, s.now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, s.record(ctx, audit.ActionRefundDecision, r, string(StatusRequested), decision(r))
+}
+
+// Execute makes an approved refund whose money could not be given back when it was approved.
+func (s *Service) Execute(ctx context.Context, id uuid.UUID) (*Refund, error) {
+	r, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if r.status != StatusApproved {
+		return nil, fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, r.ID, r.status, StatusApproved)
+	}
+	return s.execute(ctx, r)
+}
+
+// execute gives the money back and then records the refund as executed. The executor audits the refund
+// itself.
+func (s *Service) execute(ctx context.Context, r *Refund) (*Refund, error) {
+	if err := s.executor.Refund(ctx, r.StoreID, r.PurchaseID, r.Amount); err != nil {
+		return r, fmt.Errorf("refund approved but failed to give the money back: %w", err)
+	}
+	executed, err := s.update(ctx, r.ID, func(r *Refund) error {
+		return r.Executed(s.now())
+	})
+	if err != nil {
+		return r, fmt.Errorf("money given back but failed to record the refund as executed: %w", err)
+	}
+	return executed, nil
+}
+
+// update applies fn to the latest refund and saves it, starting over if someone else saved in between.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(r *Refund) error) (*Refund, error) {
+	for range saveAttempts {
+		r, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(r); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, r)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("failed to update refund after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) record(ctx context.Context, action audit.Action, r *Refund, before, after string) error {
+	if s.audit == nil {
+		return nil
+	}
+	if err := s.audit.Record(ctx, audit.NewEntry(ctx, action, "refund", r.ID.String(), before, after)); err != nil {
+		return fmt.Errorf("refund %s but failed to record it in the audit log: %w", r.status, err)
+	}
+	return nil
+}
+
+func decision(r *Refund) string {
+	d := fmt.Sprintf("%s by %s", r.status, r.decidedBy)
+	if r.note != "" {
+		d += ": " + r.note
+	}
+	return d
+}
@@ -0,0 +1,128 @@
+package royalty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Journal is the entry a statement is booked as: what the franchisee owes, receivable, against royalty
+// revenue.
+type Journal struct {
+	// Reference is the statement's ID; the accounts book a reference once.
+	Reference string        `json:"reference"`
+	Date      string        `json:"date"`
+	Memo      string        `json:"memo"`
+	Currency  string        `json:"currency"`
+	Lines     []JournalLine `json:"lines"`
+}
+
+// JournalLine debits or credits an account, in the minor unit of the journal's currency.
+type JournalLine struct {
+	Account     string `json:"account"`
+	Debit       int64  `json:"debit,omitempty"`
+	Credit      int64  `json:"credit,omitempty"`
+	Description string `json:"description"`
+}
+
+// Accounting books statements in the accounts, returning the reference the accounts keep them under.
+type Accounting interface {
+	Book(ctx context.Context, s *Statement) (string, error)
+}
+
+// AccountingConfig is the ledger API statements are exported to and the accounts they are booked against.
+type AccountingConfig struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+	// ReceivableAccount is debited with what franchisees owe, RevenueAccount credited with it.
+	ReceivableAccount string `json:"receivable_account"`
+	RevenueAccount    string `json:"revenue_account"`
+}
+
+// HTTPAccounting posts journals as JSON to a ledger API, e.g. the accounting system's manual journals
+// endpoint behind a small adapter. The statement ID is sent as the Idempotency-Key, so a journal posted
+// again after its answer was lost is not booked twice.
+type HTTPAccounting struct {
+	cfg    AccountingConfig
+	client *http.Client
+}
+
+func NewHTTPAccounting(cfg AccountingConfig, client *http.Client) (*HTTPAccounting, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("accounting needs the URL journals are posted to")
+	}
+	if cfg.ReceivableAccount == "" || cfg.RevenueAccount == "" {
+		return nil, errors.New("accounting needs the receivable and revenue accounts royalties are booked against")
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPAccounting{cfg: cfg, client: client}, nil
+}
+
+// journal books the royalty of s against the configured accounts, on the last day of its month.
+func (h *HTTPAccounting) journal(s *Statement) (Journal, error) {
+	month, err := time.Parse("2006-01", s.Month)
+	if err != nil {
+		return Journal{}, fmt.Errorf("%w: %q", ErrInvalidMonth, s.Month)
+	}
+	desc := fmt.Sprintf("%s royalty for %s, %g%% of net sales", s.Name, s.Month, s.Percent)
+	return Journal{
+		Reference: s.ID.String(),
+		Date:      month.AddDate(0, 1, -1).Format(time.DateOnly),
+		Memo:      desc,
+		Currency:  s.Currency,
+		Lines: []JournalLine{
+			{Account: h.cfg.ReceivableAccount, Debit: s.Royalty, Description: desc},
+			{Account: h.cfg.RevenueAccount, Credit: s.Royalty, Description: desc},
+		},
+	}, nil
+}
+
+type accountingResponse struct {
+	ID string `json:"id"`
+}
+
+// Book posts the statement's journal and answers the ledger's ID of it. A 409 means it was booked already,
+// and the ledger answers the ID it was booked under.
+func (h *HTTPAccounting) Book(ctx context.Context, s *Statement) (string, error) {
+	j, err := h.journal(s)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(j)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode journal: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	if h.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.Token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", j.Reference)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach accounting: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusConflict {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return "", fmt.Errorf("accounting answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	var res accountingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("failed to decode accounting response: %w", err)
+	}
+	if res.ID == "" {
+		return "", errors.New("accounting answered without the journal's ID")
+	}
+	return res.ID, nil
+}
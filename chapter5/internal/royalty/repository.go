@@ -0,0 +1,253 @@
+package royalty
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such statement.
+	Get(ctx context.Context, id uuid.UUID) (*Statement, error)
+	// Save returns ErrConcurrencyConflict if the statement was saved by someone else since it was read, or
+	// was added by someone else when it was worked out.
+	Save(ctx context.Context, s *Statement) error
+	// ForMonth returns the statements of a month, by franchisee.
+	ForMonth(ctx context.Context, month string) ([]*Statement, error)
+	Ping(ctx context.Context) error
+}
+
+type MongoRepository struct {
+	client     *mongo.Client
+	statements *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	statements := client.Database("coffeeco").Collection("royalty_statements")
+	_, err = statements.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "month", Value: 1}, {Key: "franchisee_id", Value: 1}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create royalty statement indexes: %w", err)
+	}
+	return &MongoRepository{client: client, statements: statements}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoStoreLine struct {
+	StoreID   string `bson:"store_id"`
+	Purchases int64  `bson:"purchases"`
+	Sales     int64  `bson:"sales"`
+	Refunds   int64  `bson:"refunds"`
+}
+
+type mongoAnnotation struct {
+	Resolution bool      `bson:"resolution,omitempty"`
+	Note       string    `bson:"note"`
+	By         string    `bson:"by"`
+	At         time.Time `bson:"at"`
+}
+
+type mongoStatement struct {
+	ID           string            `bson:"_id"`
+	Version      int               `bson:"version"`
+	FranchiseeID string            `bson:"franchisee_id"`
+	Name         string            `bson:"name"`
+	Month        string            `bson:"month"`
+	Currency     string            `bson:"currency"`
+	Percent      float64           `bson:"percent"`
+	Stores       []mongoStoreLine  `bson:"stores"`
+	NetSales     int64             `bson:"net_sales"`
+	Royalty      int64             `bson:"royalty"`
+	GeneratedAt  time.Time         `bson:"generated_at"`
+	Annotations  []mongoAnnotation `bson:"annotations,omitempty"`
+	ExportedAt   time.Time         `bson:"exported_at,omitempty"`
+	ExportRef    string            `bson:"export_ref,omitempty"`
+}
+
+func toMongoStatement(s *Statement) mongoStatement {
+	doc := mongoStatement{
+		ID:           s.ID.String(),
+		Version:      s.version,
+		FranchiseeID: s.FranchiseeID,
+		Name:         s.Name,
+		Month:        s.Month,
+		Currency:     s.Currency,
+		Percent:      s.Percent,
+		NetSales:     s.NetSales,
+		Royalty:      s.Royalty,
+		GeneratedAt:  s.GeneratedAt,
+		ExportedAt:   s.ExportedAt,
+		ExportRef:    s.ExportRef,
+	}
+	for _, l := range s.Stores {
+		doc.Stores = append(doc.Stores, mongoStoreLine{StoreID: l.StoreID.String(), Purchases: l.Purchases, Sales: l.Sales, Refunds: l.Refunds})
+	}
+	for _, a := range s.Annotations {
+		doc.Annotations = append(doc.Annotations, mongoAnnotation(a))
+	}
+	return doc
+}
+
+func (m mongoStatement) toStatement() *Statement {
+	id, _ := uuid.Parse(m.ID)
+	s := &Statement{
+		ID:           id,
+		FranchiseeID: m.FranchiseeID,
+		Name:         m.Name,
+		Month:        m.Month,
+		Currency:     m.Currency,
+		Percent:      m.Percent,
+		NetSales:     m.NetSales,
+		Royalty:      m.Royalty,
+		GeneratedAt:  m.GeneratedAt.UTC(),
+		ExportRef:    m.ExportRef,
+		version:      m.Version,
+	}
+	if !m.ExportedAt.IsZero() {
+		s.ExportedAt = m.ExportedAt.UTC()
+	}
+	for _, l := range m.Stores {
+		storeID, _ := uuid.Parse(l.StoreID)
+		s.Stores = append(s.Stores, StoreLine{StoreID: storeID, Purchases: l.Purchases, Sales: l.Sales, Refunds: l.Refunds})
+	}
+	for _, a := range m.Annotations {
+		a.At = a.At.UTC()
+		s.Annotations = append(s.Annotations, Annotation(a))
+	}
+	return s
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Statement, err error) {
+	ctx, span := telemetry.StartClient(ctx, "royalty.MongoRepository.Get", attribute.String("statement.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoStatement
+	err = m.statements.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get royalty statement: %w", err)
+	}
+	return doc.toStatement(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, s *Statement) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "royalty.MongoRepository.Save", attribute.String("statement.id", s.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoStatement(s)
+	doc.Version = s.version + 1
+	if s.version == 0 {
+		if _, err := m.statements.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save royalty statement: %w", err)
+		}
+	} else {
+		res, err := m.statements.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: s.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save royalty statement: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) ForMonth(ctx context.Context, month string) (_ []*Statement, err error) {
+	ctx, span := telemetry.StartClient(ctx, "royalty.MongoRepository.ForMonth", attribute.String("royalty.month", month))
+	defer telemetry.End(span, &err)
+	cur, err := m.statements.Find(ctx, bson.D{{Key: "month", Value: month}}, options.Find().SetSort(bson.D{{Key: "franchisee_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query royalty statements: %w", err)
+	}
+	var docs []mongoStatement
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode royalty statements: %w", err)
+	}
+	statements := make([]*Statement, 0, len(docs))
+	for _, doc := range docs {
+		statements = append(statements, doc.toStatement())
+	}
+	return statements, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.statements.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps statements in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu         sync.Mutex
+	statements map[uuid.UUID]mongoStatement
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{statements: map[uuid.UUID]mongoStatement{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Statement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.statements[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toStatement(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, s *Statement) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.statements[s.ID].Version != s.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoStatement(s)
+	doc.Version = s.version + 1
+	m.statements[s.ID] = doc
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) ForMonth(_ context.Context, month string) ([]*Statement, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var statements []*Statement
+	for _, doc := range m.statements {
+		if doc.Month == month {
+			statements = append(statements, doc.toStatement())
+		}
+	}
+	slices.SortFunc(statements, func(a, b *Statement) int { return cmp.Compare(a.FranchiseeID, b.FranchiseeID) })
+	return statements, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,161 @@
+package royalty
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("royalty statement not found")
+	// ErrInvalidMonth means the month is not written as 2006-01.
+	ErrInvalidMonth = errors.New("month must be written as 2006-01")
+	// ErrMonthNotOver means statements were asked for a month still going on, whose sales are not final.
+	ErrMonthNotOver = errors.New("royalties are only worked out once the month is over")
+	ErrNoNote       = errors.New("disputes and their resolutions need a note")
+	ErrNoActor      = errors.New("disputes are only noted and resolved by someone signed in")
+	ErrDisputed     = errors.New("royalty statement is disputed")
+	ErrNotDisputed  = errors.New("royalty statement is not disputed")
+	// ErrConcurrencyConflict means the statement was saved by someone else since it was read.
+	ErrConcurrencyConflict = errors.New("royalty statement changed since it was read")
+	// ErrExported means the statement is already in the accounts, and is no longer worked out again.
+	ErrExported = errors.New("royalty statement is already exported")
+)
+
+// Agreement is what a franchisee pays for running some of the stores: Percent of their net sales, the sales
+// less what was refunded, every month.
+type Agreement struct {
+	FranchiseeID string      `json:"franchisee_id"`
+	Name         string      `json:"name"`
+	Stores       []uuid.UUID `json:"stores"`
+	Percent      float64     `json:"percent"`
+	// Currency is the one the stores sell in; sales and refunds in other currencies are left out.
+	Currency string `json:"currency"`
+	// TimeZone is the IANA zone months start in, e.g. Europe/London; UTC if empty.
+	TimeZone string `json:"time_zone,omitempty"`
+}
+
+// Period returns when month, written as 2006-01, starts and ends in the agreement's time zone.
+func (a Agreement) Period(month string) (from, to time.Time, err error) {
+	loc, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to load the time zone of %s: %w", a.FranchiseeID, err)
+	}
+	from, err = time.ParseInLocation("2006-01", month, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: %q", ErrInvalidMonth, month)
+	}
+	return from, from.AddDate(0, 1, 0), nil
+}
+
+// StoreLine is what a store of the franchisee sold and refunded in the month, in the minor unit.
+type StoreLine struct {
+	StoreID   uuid.UUID
+	Purchases int64
+	Sales     int64
+	Refunds   int64
+}
+
+// Annotation is a note on a statement: a dispute raised over it, or how one was resolved.
+type Annotation struct {
+	Resolution bool
+	Note       string
+	By         string
+	At         time.Time
+}
+
+// Statement is what a franchisee owes for a month. It is worked out again until it is exported to the
+// accounts, keeping its annotations.
+type Statement struct {
+	ID           uuid.UUID
+	FranchiseeID string
+	Name         string
+	// Month is written as 2006-01.
+	Month    string
+	Currency string
+	Percent  float64
+	Stores   []StoreLine
+	// NetSales is the sales less refunds of every store, and Royalty Percent of it, never below 0.
+	NetSales    int64
+	Royalty     int64
+	GeneratedAt time.Time
+	Annotations []Annotation
+	// ExportedAt is zero until the statement is in the accounts, under ExportRef.
+	ExportedAt time.Time
+	ExportRef  string
+
+	version int
+}
+
+// StatementID is the same every time a franchisee's statement for a month is worked out.
+func StatementID(franchiseeID, month string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("coffeeco:royalty:"+franchiseeID+":"+month))
+}
+
+// NewStatement works out what the franchisee owes for month from what their stores sold and refunded.
+func NewStatement(a Agreement, month string, stores []StoreLine, at time.Time) *Statement {
+	s := &Statement{
+		ID:           StatementID(a.FranchiseeID, month),
+		FranchiseeID: a.FranchiseeID,
+		Name:         a.Name,
+		Month:        month,
+		Currency:     a.Currency,
+		Percent:      a.Percent,
+		Stores:       stores,
+		GeneratedAt:  at.UTC(),
+	}
+	for _, l := range stores {
+		s.NetSales += l.Sales - l.Refunds
+	}
+	if s.NetSales > 0 {
+		s.Royalty = int64(math.Round(float64(s.NetSales) * a.Percent / 100))
+	}
+	return s
+}
+
+// Disputed tells whether a dispute was raised and not resolved since.
+func (s *Statement) Disputed() bool {
+	return len(s.Annotations) > 0 && !s.Annotations[len(s.Annotations)-1].Resolution
+}
+
+func (s *Statement) Exported() bool {
+	return !s.ExportedAt.IsZero()
+}
+
+// Dispute notes that the franchisee or finance disagrees with the statement; it is not exported until
+// the dispute is resolved.
+func (s *Statement) Dispute(note, by string, at time.Time) error {
+	if err := annotate(note, by); err != nil {
+		return err
+	}
+	if s.Exported() {
+		return ErrExported
+	}
+	s.Annotations = append(s.Annotations, Annotation{Note: note, By: by, At: at.UTC()})
+	return nil
+}
+
+// Resolve notes how the open dispute was settled, e.g. "refund of 12 March was at another store".
+func (s *Statement) Resolve(note, by string, at time.Time) error {
+	if err := annotate(note, by); err != nil {
+		return err
+	}
+	if !s.Disputed() {
+		return ErrNotDisputed
+	}
+	s.Annotations = append(s.Annotations, Annotation{Resolution: true, Note: note, By: by, At: at.UTC()})
+	return nil
+}
+
+func annotate(note, by string) error {
+	if note == "" {
+		return ErrNoNote
+	}
+	if by == "" {
+		return ErrNoActor
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package royalty_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/royalty"
+)
+
+// refunds are the refunds made in March.
+type refunds struct {
+	made []*refund.Refund
+}
+
+func (r *refunds) Executed(context.Context, []uuid.UUID, time.Time, time.Time) ([]*refund.Refund, error) {
+	return r.made, nil
+}
+
+func Test_FranchiseesOweAShareOfTheirNetSales(t *testing.T) {
+	ctx := context.Background()
+	soho, camden, bath, own := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	march := time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	facts := analytics.NewMemoryStore()
+	f := analytics.NewFacts(facts)
+	for _, e := range []purchase.Completed{
+		{PurchaseID: uuid.New(), StoreID: soho, Total: 40000, Currency: "GBP", PurchasedAt: march},
+		{PurchaseID: uuid.New(), StoreID: camden, Total: 10000, Currency: "GBP", PurchasedAt: march},
+		{PurchaseID: uuid.New(), StoreID: bath, Total: 20000, Currency: "GBP", PurchasedAt: march},
+		// Not franchised, and in April.
+		{PurchaseID: uuid.New(), StoreID: own, Total: 99900, Currency: "GBP", PurchasedAt: march},
+		{PurchaseID: uuid.New(), StoreID: soho, Total: 5000, Currency: "GBP", PurchasedAt: march.AddDate(0, 1, 0)},
+	} {
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := f.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	made := &refunds{made: []*refund.Refund{{StoreID: camden, Amount: *money.New(2000, "GBP")}}}
+
+	var journals []royalty.Journal
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var j royalty.Journal
+		_ = json.NewDecoder(r.Body).Decode(&j)
+		if r.Header.Get("Idempotency-Key") != j.Reference {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		journals = append(journals, j)
+		_, _ = w.Write([]byte(`{"id":"MJ-` + j.Reference[:8] + `"}`))
+	}))
+	defer srv.Close()
+	accounting, err := royalty.NewHTTPAccounting(royalty.AccountingConfig{URL: srv.URL, ReceivableAccount: "1200", RevenueAccount: "4100"}, srv.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	agreements := []royalty.Agreement{
+		{FranchiseeID: "north", Name: "North Coffee Ltd", Stores: []uuid.UUID{soho, camden}, Percent: 6, Currency: "GBP", TimeZone: "Europe/London"},
+		{FranchiseeID: "west", Name: "West Beans", Stores: []uuid.UUID{bath}, Percent: 5, Currency: "GBP"},
+	}
+	svc := royalty.NewService(royalty.NewMemoryRepo(), agreements, analytics.NewService(facts), made,
+		royalty.WithAccounting(accounting), royalty.WithAuditLog(audit.NewMemoryRepo()), royalty.WithClock(func() time.Time { return now }))
+
+	if _, err := svc.Generate(ctx, "2024-03"); !errors.Is(err, royalty.ErrMonthNotOver) {
+		t.Fatalf("expected ErrMonthNotOver before the end of March but got %v", err)
+	}
+	now = time.Date(2024, 4, 2, 0, 0, 0, 0, time.UTC)
+	statements, err := svc.Generate(ctx, "2024-03")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	north, west := statements[0], statements[1]
+	if north.NetSales != 48000 || north.Royalty != 2880 || north.Stores[1].Refunds != 2000 {
+		t.Fatalf("expected 6%% of £500.00 sales less a £20.00 refund but got %+v", north)
+	}
+	if west.NetSales != 20000 || west.Royalty != 1000 {
+		t.Fatalf("expected 5%% of £200.00 but got %+v", west)
+	}
+
+	finance := audit.WithActor(ctx, "finance-1")
+	if _, err := svc.Dispute(finance, west.ID, ""); !errors.Is(err, royalty.ErrNoNote) {
+		t.Fatalf("expected ErrNoNote but got %v", err)
+	}
+	if _, err := svc.Dispute(finance, west.ID, "Bath was closed for a week"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	exported, err := svc.Export(ctx, "2024-03")
+	if !errors.Is(err, royalty.ErrDisputed) || len(exported) != 1 || exported[0].ExportRef == "" {
+		t.Fatalf("expected North exported and West held back but got %v and %v", exported, err)
+	}
+	j := journals[0]
+	if j.Date != "2024-03-31" || j.Lines[0].Account != "1200" || j.Lines[0].Debit != 2880 || j.Lines[1].Credit != 2880 {
+		t.Fatalf("expected the royalty booked receivable against revenue at the end of March but got %+v", j)
+	}
+
+	// Exported statements stay as they were booked; the rest are worked out again, keeping their disputes.
+	made.made = append(made.made, &refund.Refund{StoreID: soho, Amount: *money.New(1000, "GBP")}, &refund.Refund{StoreID: bath, Amount: *money.New(1000, "GBP")})
+	statements, err = svc.Generate(ctx, "2024-03")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	north, west = statements[0], statements[1]
+	if north.Royalty != 2880 || west.Royalty != 950 || !west.Disputed() {
+		t.Fatalf("expected North as booked and West worked out again, still disputed, but got %+v and %+v", north, west)
+	}
+	if _, err := svc.Resolve(finance, west.ID, "the closure refunds were missing"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if exported, err := svc.Export(ctx, "2024-03"); err != nil || len(exported) != 1 || exported[0].FranchiseeID != "west" || len(journals) != 2 {
+		t.Fatalf("expected only West exported once resolved but got %v and %v", exported, err)
+	}
+}
@@ -0,0 +1,253 @@
+package royalty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/refund"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the statement first.
+const saveAttempts = 3
+
+// Sales is where the sales of the franchisees' stores are read from: the analytics projection of the
+// purchases, with finance's adjustments applied.
+type Sales interface {
+	SalesByStore(ctx context.Context, q analytics.Query) ([]analytics.StoreSales, error)
+}
+
+// Refunds is where the refunds made at the franchisees' stores are read from, e.g. refund.MongoRepository.
+type Refunds interface {
+	Executed(ctx context.Context, storeIDs []uuid.UUID, from, to time.Time) ([]*refund.Refund, error)
+}
+
+// Service works out the royalties franchisees owe every month and books them in the accounts.
+type Service struct {
+	repo       Repository
+	agreements []Agreement
+	sales      Sales
+	refunds    Refunds
+	accounting Accounting     // 可选, 导出到会计系统; 没有时不能导出
+	audit      audit.Recorder // 可选, 记录争议和解决
+	now        func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithAccounting lets statements be exported, booked in the accounts.
+func WithAccounting(a Accounting) Option {
+	return func(s *Service) {
+		s.accounting = a
+	}
+}
+
+// WithAuditLog records disputes and their resolutions in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test statements of a month that is not over yet.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, agreements []Agreement, sales Sales, refunds Refunds, opts ...Option) *Service {
+	s := &Service{repo: repo, agreements: agreements, sales: sales, refunds: refunds, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Generate works out the statement of every franchisee for month, written as 2006-01, once it is over.
+// Statements worked out before are worked out again, keeping their annotations, unless they were exported.
+func (s *Service) Generate(ctx context.Context, month string) ([]*Statement, error) {
+	statements := make([]*Statement, 0, len(s.agreements))
+	for _, a := range s.agreements {
+		st, err := s.generate(ctx, a, month)
+		if err != nil {
+			return nil, fmt.Errorf("failed to work out the royalties of %s: %w", a.FranchiseeID, err)
+		}
+		statements = append(statements, st)
+	}
+	return statements, nil
+}
+
+func (s *Service) generate(ctx context.Context, a Agreement, month string) (*Statement, error) {
+	from, to, err := a.Period(month)
+	if err != nil {
+		return nil, err
+	}
+	if s.now().Before(to) {
+		return nil, fmt.Errorf("%w: %s", ErrMonthNotOver, month)
+	}
+	lines := make([]StoreLine, len(a.Stores))
+	index := make(map[string]int, len(a.Stores))
+	for i, id := range a.Stores {
+		lines[i].StoreID = id
+		index[id.String()] = i
+	}
+	sales, err := s.sales.SalesByStore(ctx, analytics.Query{From: from, To: to, StoreIDs: a.Stores, Location: from.Location()})
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range sales {
+		if i, ok := index[row.StoreID]; ok && row.Currency == a.Currency {
+			lines[i].Purchases += row.Purchases
+			lines[i].Sales += row.Revenue
+		}
+	}
+	refunds, err := s.refunds.Executed(ctx, a.Stores, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refunds {
+		if i, ok := index[r.StoreID.String()]; ok && r.Amount.Currency().Code == a.Currency {
+			lines[i].Refunds += r.Amount.Amount()
+		}
+	}
+
+	for range saveAttempts {
+		st := NewStatement(a, month, lines, s.now())
+		before, err := s.repo.Get(ctx, st.ID)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return nil, err
+		case before.Exported():
+			return before, nil
+		default:
+			st.Annotations, st.version = before.Annotations, before.version
+		}
+		err = s.repo.Save(ctx, st)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+	return nil, fmt.Errorf("failed to save royalty statement after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// Statements returns the statements worked out for month, by franchisee.
+func (s *Service) Statements(ctx context.Context, month string) ([]*Statement, error) {
+	if _, err := time.Parse("2006-01", month); err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidMonth, month)
+	}
+	return s.repo.ForMonth(ctx, month)
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Statement, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Dispute notes why the franchisee or finance disagrees with a statement. It is kept out of the accounts
+// until the dispute is resolved.
+func (s *Service) Dispute(ctx context.Context, id uuid.UUID, note string) (*Statement, error) {
+	st, err := s.update(ctx, id, func(st *Statement) error {
+		return st.Dispute(note, audit.Actor(ctx), s.now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, s.record(ctx, audit.ActionRoyaltyDispute, st, "undisputed", "disputed", note)
+}
+
+// Resolve notes how the open dispute over a statement was settled, letting it be exported. A statement that
+// was wrong is corrected by adjusting the purchases and generating it again, before or after resolving.
+func (s *Service) Resolve(ctx context.Context, id uuid.UUID, note string) (*Statement, error) {
+	st, err := s.update(ctx, id, func(st *Statement) error {
+		return st.Resolve(note, audit.Actor(ctx), s.now())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return st, s.record(ctx, audit.ActionRoyaltyResolve, st, "disputed", "resolved", note)
+}
+
+// Export books every statement of month that is not in the accounts yet. Disputed statements are left out
+// and reported in the error, with the statements that failed; the rest are exported regardless.
+func (s *Service) Export(ctx context.Context, month string) ([]*Statement, error) {
+	if s.accounting == nil {
+		return nil, errors.New("there is no accounting system to export royalties to")
+	}
+	statements, err := s.Statements(ctx, month)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		exported []*Statement
+		errs     []error
+	)
+	for _, st := range statements {
+		if st.Exported() {
+			continue
+		}
+		if st.Disputed() {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrDisputed, st.FranchiseeID))
+			continue
+		}
+		ref, err := s.accounting.Book(ctx, st)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to export the royalties of %s: %w", st.FranchiseeID, err))
+			continue
+		}
+		// The accounts book a statement once, so one disputed after it was read is exported regardless.
+		marked, err := s.update(ctx, st.ID, func(st *Statement) error {
+			st.ExportedAt, st.ExportRef = s.now().UTC(), ref
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("royalties of %s exported as %s but not marked so: %w", st.FranchiseeID, ref, err))
+			continue
+		}
+		exported = append(exported, marked)
+	}
+	return exported, errors.Join(errs...)
+}
+
+// update applies fn to the latest statement and saves it, starting over if someone else saved in between.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(st *Statement) error) (*Statement, error) {
+	for range saveAttempts {
+		st, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(st); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, st)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return st, nil
+	}
+	return nil, fmt.Errorf("failed to update royalty statement after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) record(ctx context.Context, action audit.Action, st *Statement, before, after, note string) error {
+	if s.audit == nil {
+		return nil
+	}
+	e := audit.NewEntry(ctx, action, "royalty_statement", st.ID.String(), before, after)
+	e.Note = note
+	if err := s.audit.Record(ctx, e); err != nil {
+		return fmt.Errorf("royalty statement %s but failed to record it in the audit log: %w", after, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRepository struct {
+	sagas *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{sagas: client.Database("coffeeco").Collection("sagas")}, nil
+}
+
+type mongoState struct {
+	ID        string            `bson:"_id"`
+	Name      string            `bson:"name"`
+	Status    Status            `bson:"status"`
+	Completed []string          `bson:"completed"`
+	Data      map[string]string `bson:"data"`
+	Error     string            `bson:"error"`
+	StartedAt time.Time         `bson:"started_at"`
+	UpdatedAt time.Time         `bson:"updated_at"`
+}
+
+func (m *MongoRepository) Save(ctx context.Context, s State) error {
+	doc := mongoState{
+		ID:        s.ID.String(),
+		Name:      s.Name,
+		Status:    s.Status,
+		Completed: s.Completed,
+		Data:      s.Data,
+		Error:     s.Error,
+		StartedAt: s.StartedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+	_, err := m.sagas.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save saga: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (State, error) {
+	var doc mongoState
+	if err := m.sagas.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return State{}, ErrNotFound
+		}
+		return State{}, fmt.Errorf("failed to find saga: %w", err)
+	}
+	return State{
+		ID:        id,
+		Name:      doc.Name,
+		Status:    doc.Status,
+		Completed: doc.Completed,
+		Data:      doc.Data,
+		Error:     doc.Error,
+		StartedAt: doc.StartedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}, nil
+}
+
+// MemoryRepository keeps saga state in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	states map[uuid.UUID]State
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{states: map[uuid.UUID]State{}}
+}
+
+func (m *MemoryRepository) Save(_ context.Context, s State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Completed = append([]string(nil), s.Completed...)
+	data := make(map[string]string, len(s.Data))
+	for k, v := range s.Data {
+		data[k] = v
+	}
+	s.Data = data
+	m.states[s.ID] = s
+	return nil
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.states[id]
+	if !ok {
+		return State{}, ErrNotFound
+	}
+	return s, nil
+}
@@ -0,0 +1,213 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("saga not found")
+
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompleted    Status = "completed"
+	StatusCompensating Status = "compensating"
+	StatusCompensated  Status = "compensated"
+	// StatusFailed means a compensation, or a step after the pivot, failed and a human needs to look at it.
+	StatusFailed Status = "failed"
+)
+
+// State is what is persisted about a running saga, after every step.
+type State struct {
+	ID        uuid.UUID
+	Name      string
+	Status    Status
+	Completed []string
+	// Data carries step outputs (e.g. a charge ID) that later steps or compensations need.
+	Data      map[string]string
+	Error     string
+	StartedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Step is one local transaction of the saga. Compensate semantically undoes Execute; steps without one
+// (e.g. sending a notification) are simply skipped when compensating. Both must be safe to run again,
+// since a saga resumed after a crash may repeat the step that was in flight.
+//
+// A Pivot step is the point of no return: once it has completed, later failures are no longer compensated.
+// Steps after the pivot should instead be retried, and if they still fail the saga is marked failed.
+type Step struct {
+	Name       string
+	Timeout    time.Duration
+	Retries    int
+	Pivot      bool
+	Execute    func(ctx context.Context, state *State) error
+	Compensate func(ctx context.Context, state *State) error
+}
+
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+type Repository interface {
+	Save(ctx context.Context, state State) error
+	Get(ctx context.Context, id uuid.UUID) (State, error)
+}
+
+// Orchestrator runs sagas step by step, persisting their state so they can be inspected and resumed.
+type Orchestrator struct {
+	repo Repository
+}
+
+func NewOrchestrator(repo Repository) (*Orchestrator, error) {
+	if repo == nil {
+		return nil, errors.New("repository cannot be nil")
+	}
+	return &Orchestrator{repo: repo}, nil
+}
+
+// StepError reports which step made the saga fail.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("saga step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Run executes def from the start. If a step fails, the completed steps are compensated in reverse order
+// and the step's error is returned as a *StepError.
+func (o *Orchestrator) Run(ctx context.Context, def Definition) (State, error) {
+	now := time.Now().UTC()
+	state := State{
+		ID:        uuid.New(),
+		Name:      def.Name,
+		Status:    StatusRunning,
+		Data:      map[string]string{},
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if err := o.save(ctx, &state); err != nil {
+		return state, err
+	}
+	return o.execute(ctx, def, state)
+}
+
+// Resume continues a saga that was interrupted, e.g. by a crash, from its persisted state.
+func (o *Orchestrator) Resume(ctx context.Context, def Definition, id uuid.UUID) (State, error) {
+	state, err := o.repo.Get(ctx, id)
+	if err != nil {
+		return State{}, err
+	}
+	switch state.Status {
+	case StatusRunning:
+		return o.execute(ctx, def, state)
+	case StatusCompensating:
+		return state, o.compensate(ctx, def, &state, errors.New(state.Error))
+	default:
+		return state, nil
+	}
+}
+
+func (o *Orchestrator) execute(ctx context.Context, def Definition, state State) (State, error) {
+	for _, step := range def.Steps[len(state.Completed):] {
+		if err := runStep(ctx, step, &state); err != nil {
+			stepErr := &StepError{Step: step.Name, Err: err}
+			if pastPivot(def, state) {
+				state.Status = StatusFailed
+				state.Error = stepErr.Error()
+				if err := o.save(ctx, &state); err != nil {
+					return state, err
+				}
+				return state, stepErr
+			}
+			state.Status = StatusCompensating
+			state.Error = stepErr.Error()
+			if err := o.save(ctx, &state); err != nil {
+				return state, err
+			}
+			if err := o.compensate(ctx, def, &state, stepErr); err != nil {
+				return state, err
+			}
+			return state, stepErr
+		}
+		state.Completed = append(state.Completed, step.Name)
+		if err := o.save(ctx, &state); err != nil {
+			return state, err
+		}
+	}
+	state.Status = StatusCompleted
+	return state, o.save(ctx, &state)
+}
+
+func (o *Orchestrator) compensate(ctx context.Context, def Definition, state *State, cause error) error {
+	// Compensations run even if the caller's context is done; leaving a half-applied saga is worse.
+	ctx = context.WithoutCancel(ctx)
+	for i := len(state.Completed) - 1; i >= 0; i-- {
+		step := def.Steps[i]
+		if step.Compensate != nil {
+			if err := runWithTimeout(ctx, step.Timeout, step.Compensate, state); err != nil {
+				state.Status = StatusFailed
+				state.Error = fmt.Sprintf("%v; compensating %s failed: %v", cause, step.Name, err)
+				_ = o.save(ctx, state)
+				return fmt.Errorf("failed to compensate %s after %v: %w", step.Name, cause, err)
+			}
+		}
+		state.Completed = state.Completed[:i]
+		if err := o.save(ctx, state); err != nil {
+			return err
+		}
+	}
+	state.Status = StatusCompensated
+	return o.save(ctx, state)
+}
+
+func (o *Orchestrator) save(ctx context.Context, state *State) error {
+	state.UpdatedAt = time.Now().UTC()
+	if err := o.repo.Save(ctx, *state); err != nil {
+		return fmt.Errorf("failed to persist saga state: %w", err)
+	}
+	return nil
+}
+
+func pastPivot(def Definition, state State) bool {
+	for i := range state.Completed {
+		if def.Steps[i].Pivot {
+			return true
+		}
+	}
+	return false
+}
+
+func runStep(ctx context.Context, step Step, state *State) error {
+	var err error
+	for attempt := 0; attempt <= step.Retries; attempt++ {
+		if err = runWithTimeout(ctx, step.Timeout, step.Execute, state); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context, *State) error, state *State) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx, state)
+}
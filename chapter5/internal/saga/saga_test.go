@@ -0,0 +1,76 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"coffeeco/internal/saga"
+)
+
+func Test_Orchestrator(t *testing.T) {
+	var (
+		ctx  = context.Background()
+		boom = errors.New("boom")
+	)
+	step := func(name string, log *[]string, fail bool, pivot bool) saga.Step {
+		return saga.Step{
+			Name:  name,
+			Pivot: pivot,
+			Execute: func(context.Context, *saga.State) error {
+				*log = append(*log, "do "+name)
+				if fail {
+					return boom
+				}
+				return nil
+			},
+			Compensate: func(context.Context, *saga.State) error {
+				*log = append(*log, "undo "+name)
+				return nil
+			},
+		}
+	}
+
+	t.Run("a failing step compensates completed steps in reverse order", func(t *testing.T) {
+		var log []string
+		repo := saga.NewMemoryRepo()
+		o, _ := saga.NewOrchestrator(repo)
+
+		state, err := o.Run(ctx, saga.Definition{Name: "test", Steps: []saga.Step{
+			step("a", &log, false, false), step("b", &log, false, false), step("c", &log, true, false),
+		}})
+
+		var stepErr *saga.StepError
+		if !errors.As(err, &stepErr) || stepErr.Step != "c" || !errors.Is(err, boom) {
+			t.Fatalf("expected step c to fail with boom but got %v", err)
+		}
+		want := []string{"do a", "do b", "do c", "undo b", "undo a"}
+		if !reflect.DeepEqual(log, want) {
+			t.Fatalf("expected %v but got %v", want, log)
+		}
+		persisted, _ := repo.Get(ctx, state.ID)
+		if persisted.Status != saga.StatusCompensated || len(persisted.Completed) != 0 {
+			t.Fatalf("expected a compensated saga but got %+v", persisted)
+		}
+	})
+
+	t.Run("failures after the pivot are not compensated", func(t *testing.T) {
+		var log []string
+		o, _ := saga.NewOrchestrator(saga.NewMemoryRepo())
+
+		state, err := o.Run(ctx, saga.Definition{Name: "test", Steps: []saga.Step{
+			step("charge", &log, false, false), step("store", &log, false, true), step("notify", &log, true, false),
+		}})
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected boom but got %v", err)
+		}
+		if state.Status != saga.StatusFailed {
+			t.Fatalf("expected the saga to need attention but got %s", state.Status)
+		}
+		want := []string{"do charge", "do store", "do notify"}
+		if !reflect.DeepEqual(log, want) {
+			t.Fatalf("expected %v but got %v", want, log)
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+// ErrUnavailable means what was asked for cannot be practised, or there is nowhere to practise it.
+var ErrUnavailable = errors.New("not available in training mode")
+
+// Header asks for a request to be practice, e.g. "X-Sandbox: true" from a terminal in training mode. Every
+// response to it echoes the header, for terminals to show they are not taking real purchases.
+const Header = "X-Sandbox"
+
+type key struct{}
+
+// With marks the work of ctx as practice: charges go to the test mode of the payment gateway, purchases
+// are kept apart from the real ones and nothing is published about them.
+func With(ctx context.Context) context.Context {
+	return context.WithValue(ctx, key{}, true)
+}
+
+// Enabled tells whether the work of ctx is practice.
+func Enabled(ctx context.Context) bool {
+	on, _ := ctx.Value(key{}).(bool)
+	return on
+}
+
+// Middleware marks requests whose X-Sandbox header is true as practice.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if on, _ := strconv.ParseBool(r.Header.Get(Header)); on {
+			w.Header().Set(Header, "true")
+			r = r.WithContext(With(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
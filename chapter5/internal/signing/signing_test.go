@@ -0,0 +1,48 @@
+package signing_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"coffeeco/internal/signing"
+)
+
+type claims struct {
+	Subject string `json:"sub"`
+	Expires int64  `json:"exp"`
+}
+
+func Test_OnlyTokensSignedWithTheSecretAreVerified(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	token, err := signing.Sign(secret, claims{Subject: "card-1", Expires: 1700000000})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var got claims
+	if err := signing.Verify(secret, token, &got); err != nil || got.Subject != "card-1" || got.Expires != 1700000000 {
+		t.Fatalf("expected the claims back but got %+v, %v", got, err)
+	}
+
+	other, _ := signing.Sign([]byte(strings.Repeat("o", 32)), claims{Subject: "card-2"})
+	body, _, _ := strings.Cut(other, ".")
+	_, sig, _ := strings.Cut(token, ".")
+	for name, token := range map[string]string{
+		"another secret":   other,
+		"changed claims":   body + "." + sig,
+		"not a token":      "card-1",
+		"not base64":       "!!!." + sig,
+		"without a secret": token,
+	} {
+		key := secret
+		if name == "without a secret" {
+			key = nil
+		}
+		if err := signing.Verify(key, token, &got); !errors.Is(err, signing.ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken but got %v", name, err)
+		}
+	}
+	if _, err := signing.Sign(nil, claims{}); err == nil {
+		t.Fatal("expected no token to be signed without a secret")
+	}
+}
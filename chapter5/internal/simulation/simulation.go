@@ -0,0 +1,320 @@
+package simulation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/feature"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/testsupport"
+)
+
+// DeclinedToken is the card token the simulated gateway declines, as Stripe's test mode does.
+const DeclinedToken = "tok_chargeDeclined"
+
+// Day is a day of trading to replay. The same Day, seed included, always replays the same way, so a
+// change to pricing or loyalty that changes its Report is a change in behaviour.
+type Day struct {
+	// Date is the day replayed, in the time zone the purchases are made in.
+	Date time.Time
+	// Opens and Closes are how long after midnight the first and last purchases are made; 7am and 7pm if
+	// zero.
+	Opens, Closes time.Duration
+	// Stores are where purchases are made; two stores selling coffee in USD if empty.
+	Stores []store.Store
+	// Discounts are the stores' discounts in percent.
+	Discounts map[uuid.UUID]int64
+	// Rules price the purchases, e.g. with happy hours and promotions.
+	Rules pricing.Rules
+	// Flags decide the feature flags the services check, e.g. feature.WalletPayments; all off if nil.
+	Flags feature.Flags
+	// Customers hold a loyalty card each; 50 if zero. Some purchases are anonymous.
+	Customers int
+	// Purchases made over the day; 200 if zero.
+	Purchases int
+	// DeclinePercent of the card payments are declined by the gateway.
+	DeclinePercent int
+	Seed           uint64
+}
+
+// visit is a purchase planned before the day is replayed.
+type visit struct {
+	at       time.Time
+	store    int
+	customer int // -1 for anonymous purchases
+	means    payment.Means
+	products []coffeeco.Product
+	token    string
+}
+
+// Outcome is how a purchase went.
+type Outcome struct {
+	At       time.Time
+	Store    int
+	Customer int // -1 for anonymous purchases
+	Means    payment.Means
+	Lines    []string
+	// Total charged, in the minor unit of Currency, once completed.
+	Total    int64
+	Currency string
+	// Error is why the purchase failed; empty if it completed.
+	Error string
+}
+
+// Balance is a loyalty card at the end of the day.
+type Balance struct {
+	FreeDrinks int
+	// Remaining purchases until the next free drink.
+	Remaining int
+}
+
+// Report is how the day went: every purchase in order, the takings and the loyalty cards at closing.
+type Report struct {
+	Outcomes  []Outcome
+	Completed int
+	Failed    int
+	// Takings are what each store took, by currency.
+	Takings  []map[string]int64
+	Balances []Balance
+}
+
+// Run replays day through the purchase service with in-memory repositories, a clock moved from purchase
+// to purchase and a gateway that declines DeclinedToken.
+func Run(ctx context.Context, day Day) (Report, error) {
+	day = day.withDefaults()
+	rnd := rand.New(rand.NewPCG(day.Seed, day.Seed))
+	stores := day.Stores
+	if len(stores) == 0 {
+		stores = defaultStores(rnd)
+	}
+
+	clock := testsupport.NewClock(day.Date)
+	logger := slog.New(slog.DiscardHandler)
+	storeRepo := store.NewMemoryRepo()
+	for _, s := range stores {
+		if err := storeRepo.SaveStore(ctx, s); err != nil {
+			return Report{}, err
+		}
+	}
+	for id, d := range day.Discounts {
+		if err := storeRepo.SetStoreDiscount(ctx, id, d); err != nil {
+			return Report{}, err
+		}
+	}
+	storeSvc := store.NewService(storeRepo)
+	engine := pricing.NewEngine(day.Rules, pricing.WithStoreDiscounts(storeSvc), pricing.WithFeatureFlags(day.Flags), pricing.WithLogger(logger), pricing.WithClock(clock.Now))
+	svc := purchase.NewService(gateway{}, testsupport.NewFakePurchases(), storeSvc,
+		purchase.WithClock(clock.Now), purchase.WithPricing(engine), purchase.WithFeatureFlags(day.Flags), purchase.WithLogger(logger))
+
+	cards := loyalty.NewMemoryRepo()
+	cardIDs := make([]uuid.UUID, day.Customers)
+	for i := range cardIDs {
+		cardIDs[i] = newID(rnd)
+		lover := coffeeco.CoffeeLover{ID: newID(rnd)}
+		if err := cards.Save(ctx, loyalty.NewCoffeeBux(cardIDs[i], stores[i%len(stores)], lover)); err != nil {
+			return Report{}, err
+		}
+	}
+
+	report := Report{Takings: make([]map[string]int64, len(stores))}
+	for i := range report.Takings {
+		report.Takings[i] = map[string]int64{}
+	}
+	for _, v := range day.plan(rnd, stores) {
+		clock.Set(v.at)
+		o := Outcome{At: v.at, Store: v.store, Customer: v.customer, Means: v.means}
+		for _, p := range v.products {
+			o.Lines = append(o.Lines, p.ItemName)
+		}
+		var card *loyalty.CoffeeBux
+		if v.customer >= 0 {
+			c, err := cards.Get(ctx, cardIDs[v.customer])
+			if err != nil {
+				return Report{}, err
+			}
+			card = c
+		}
+		p := &purchase.Purchase{Store: stores[v.store], ProductsToPurchase: v.products, PaymentMeans: v.means}
+		if v.token != "" {
+			p.CardToken = &v.token
+		}
+		err := svc.CompletePurchase(ctx, stores[v.store].ID, p, card)
+		switch {
+		case err != nil:
+			o.Error = err.Error()
+			report.Failed++
+		default:
+			total := p.Total()
+			o.Total, o.Currency = total.Amount(), total.Currency().Code
+			report.Completed++
+			report.Takings[v.store][o.Currency] += o.Total
+			if card != nil {
+				card.PopEvents()
+				if err := cards.Save(ctx, card); err != nil {
+					return Report{}, err
+				}
+			}
+		}
+		report.Outcomes = append(report.Outcomes, o)
+	}
+	for _, id := range cardIDs {
+		c, err := cards.Get(ctx, id)
+		if err != nil {
+			return Report{}, err
+		}
+		report.Balances = append(report.Balances, Balance{FreeDrinks: c.FreeDrinksAvailable, Remaining: c.RemainingDrinkPurchasesUntilFreeDrink})
+	}
+	return report, nil
+}
+
+func (d Day) withDefaults() Day {
+	if d.Date.IsZero() {
+		d.Date = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if d.Opens == 0 {
+		d.Opens = 7 * time.Hour
+	}
+	if d.Closes == 0 {
+		d.Closes = 19 * time.Hour
+	}
+	if d.Flags == nil {
+		d.Flags = feature.Off{}
+	}
+	if d.Customers == 0 {
+		d.Customers = 50
+	}
+	if d.Purchases == 0 {
+		d.Purchases = 200
+	}
+	return d
+}
+
+// plan draws the purchases of the day, in the order they are made.
+func (d Day) plan(rnd *rand.Rand, stores []store.Store) []visit {
+	open := d.Closes - d.Opens
+	visits := make([]visit, 0, d.Purchases)
+	for range d.Purchases {
+		v := visit{at: d.Date.Add(d.Opens + time.Duration(rnd.Int64N(int64(open)))).Truncate(time.Second), store: rnd.IntN(len(stores)), customer: -1}
+		// Seven in ten purchases are by a loyalty card holder.
+		if d.Customers > 0 && rnd.IntN(10) < 7 {
+			v.customer = rnd.IntN(d.Customers)
+		}
+		lines := 1 + rnd.IntN(3)
+		switch n := rnd.IntN(100); {
+		case v.customer >= 0 && n < 15:
+			// Free drinks pay for one drink at a time.
+			v.means, lines = payment.MEANS_COFFEEBUX, 1
+		case n < 75:
+			v.means, v.token = payment.MEANS_CARD, "tok_visa"
+			if rnd.IntN(100) < d.DeclinePercent {
+				v.token = DeclinedToken
+			}
+		default:
+			v.means = payment.MEANS_CASH
+		}
+		products := stores[v.store].ProductsForSale
+		for range lines {
+			p := products[rnd.IntN(len(products))]
+			p.ReusableCup = rnd.IntN(10) == 0
+			v.products = append(v.products, p)
+		}
+		visits = append(visits, v)
+	}
+	slices.SortStableFunc(visits, func(a, b visit) int { return a.at.Compare(b.at) })
+	return visits
+}
+
+func defaultStores(rnd *rand.Rand) []store.Store {
+	menu := func(prices ...int64) []coffeeco.Product {
+		names := []string{"latte", "flat white", "espresso", "cappuccino", "croissant"}
+		products := make([]coffeeco.Product, len(prices))
+		for i, p := range prices {
+			products[i] = coffeeco.Product{ItemName: names[i], BasePrice: *money.New(p, "USD")}
+		}
+		return products
+	}
+	return []store.Store{
+		store.New(newID(rnd), "High Street", menu(450, 425, 300, 425, 325)...),
+		store.New(newID(rnd), "Station", menu(475, 450, 325, 450, 350)...),
+	}
+}
+
+// newID draws an ID from rnd, so the stores and cards of a seed are the same every run.
+func newID(rnd *rand.Rand) uuid.UUID {
+	var id uuid.UUID
+	for i := range 2 {
+		v := rnd.Uint64()
+		for j := range 8 {
+			id[i*8+j] = byte(v >> (8 * j))
+		}
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return id
+}
+
+// gateway approves every charge but those to DeclinedToken.
+type gateway struct{}
+
+var errDeclined = errors.New("card declined")
+
+func (gateway) ChargeCard(_ context.Context, _ money.Money, token string) error {
+	if token == DeclinedToken {
+		return errDeclined
+	}
+	return nil
+}
+
+// WriteTo writes the report as text, one purchase a line, then the takings and the cards. Two runs of a
+// Day write the same text, so it can be kept as a golden file.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for _, o := range r.Outcomes {
+		fmt.Fprintf(&b, "%s store=%d customer=%d %s [%s] ", o.At.Format(time.TimeOnly), o.Store, o.Customer, o.Means, strings.Join(o.Lines, ", "))
+		if o.Error != "" {
+			fmt.Fprintf(&b, "failed: %s\n", o.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "%d %s\n", o.Total, o.Currency)
+	}
+	fmt.Fprintf(&b, "completed=%d failed=%d\n", r.Completed, r.Failed)
+	for i, t := range r.Takings {
+		currencies := make([]string, 0, len(t))
+		for c := range t {
+			currencies = append(currencies, c)
+		}
+		slices.Sort(currencies)
+		for _, c := range currencies {
+			fmt.Fprintf(&b, "takings store=%d %d %s\n", i, t[c], c)
+		}
+	}
+	for i, c := range r.Balances {
+		fmt.Fprintf(&b, "card customer=%d free=%d remaining=%d\n", i, c.FreeDrinks, c.Remaining)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// Digest fingerprints the report, to compare runs at a glance.
+func (r Report) Digest() string {
+	h := sha256.New()
+	_, _ = r.WriteTo(h)
+	return hex.EncodeToString(h.Sum(nil))
+}
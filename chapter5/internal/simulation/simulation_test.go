@@ -0,0 +1,114 @@
+package simulation_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/simulation"
+)
+
+func Test_TheSameDayIsSimulatedTheSameWay(t *testing.T) {
+	day := simulation.Day{Purchases: 300, DeclinePercent: 10, Seed: 7}
+	first, err := simulation.Run(context.Background(), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := simulation.Run(context.Background(), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Digest() != second.Digest() {
+		var a, b strings.Builder
+		_, _ = first.WriteTo(&a)
+		_, _ = second.WriteTo(&b)
+		t.Fatalf("replays differ:\n%s\n---\n%s", a.String(), b.String())
+	}
+
+	other, err := simulation.Run(context.Background(), simulation.Day{Purchases: 300, DeclinePercent: 10, Seed: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Digest() == first.Digest() {
+		t.Fatal("another seed replayed the same day")
+	}
+}
+
+func Test_EverySimulatedPurchaseIsAccountedFor(t *testing.T) {
+	r, err := simulation.Run(context.Background(), simulation.Day{Purchases: 500, DeclinePercent: 20, Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Completed+r.Failed != len(r.Outcomes) || len(r.Outcomes) != 500 {
+		t.Fatalf("completed %d, failed %d of %d purchases", r.Completed, r.Failed, len(r.Outcomes))
+	}
+
+	takings := map[int]int64{}
+	var declined, stamps, freeDrinks int
+	for i, o := range r.Outcomes {
+		if i > 0 && o.At.Before(r.Outcomes[i-1].At) {
+			t.Fatalf("purchase %d made before the one before it", i)
+		}
+		if o.Error != "" {
+			if o.Means == payment.MEANS_CARD {
+				declined++
+			}
+			continue
+		}
+		takings[o.Store] += o.Total
+		if o.Customer < 0 {
+			continue
+		}
+		// Drinks paid for with free drinks are stamped too.
+		stamps++
+		if o.Means == payment.MEANS_COFFEEBUX {
+			freeDrinks++
+		}
+	}
+	for i, took := range r.Takings {
+		if took["USD"] != takings[i] {
+			t.Errorf("store %d took %d, its purchases total %d", i, took["USD"], takings[i])
+		}
+	}
+	if declined == 0 {
+		t.Error("no card payment was declined")
+	}
+
+	// Every card starts with 10 purchases to go and no free drink, and earns one every 10 stamps.
+	earned := freeDrinks * 10
+	for _, b := range r.Balances {
+		earned += b.FreeDrinks*10 + 10 - b.Remaining
+	}
+	if earned != stamps {
+		t.Errorf("cards earned %d stamps, %d purchases were stamped", earned, stamps)
+	}
+}
+
+func Test_HappyHoursLowerPricesOnlyWhileTheyLast(t *testing.T) {
+	day := simulation.Day{Purchases: 200, Seed: 3}
+	before, err := simulation.Run(context.Background(), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day.Rules = pricing.Rules{HappyHours: []pricing.HappyHour{{Name: "afternoon", Start: 15 * 60, End: 17 * 60, PercentOff: 20}}}
+	after, err := simulation.Run(context.Background(), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, o := range after.Outcomes {
+		b := before.Outcomes[i]
+		if o.Error != "" || b.Error != "" || o.Means == payment.MEANS_COFFEEBUX {
+			continue
+		}
+		happy := o.At.Hour() >= 15 && o.At.Hour() < 17
+		switch {
+		case happy && o.Total >= b.Total:
+			t.Errorf("%s: paid %d in the happy hour, %d without", o.At.Format("15:04"), o.Total, b.Total)
+		case !happy && o.Total != b.Total:
+			t.Errorf("%s: paid %d outside the happy hour, %d without", o.At.Format("15:04"), o.Total, b.Total)
+		}
+	}
+}
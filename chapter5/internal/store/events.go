@@ -0,0 +1,46 @@
+package store
+
+import (
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+)
+
+const (
+	EventTypeCatalogChanged  = "store.catalog_changed"
+	EventTypeDiscountChanged = "store.discount_changed"
+)
+
+// CatalogChanged is recorded when a store is created or what it sells changes.
+type CatalogChanged struct {
+	StoreID uuid.UUID `json:"store_id"`
+}
+
+func (e CatalogChanged) EventType() string {
+	return EventTypeCatalogChanged
+}
+
+func (e CatalogChanged) AggregateID() uuid.UUID {
+	return e.StoreID
+}
+
+// DiscountChanged is recorded when the discount of a store is set or removed.
+type DiscountChanged struct {
+	StoreID uuid.UUID `json:"store_id"`
+	// Discount is in percent; 0 means the store has none.
+	Discount int64 `json:"discount"`
+}
+
+func (e DiscountChanged) EventType() string {
+	return EventTypeDiscountChanged
+}
+
+func (e DiscountChanged) AggregateID() uuid.UUID {
+	return e.StoreID
+}
+
+// RegisterEvents adds decoders for every version of the store events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeCatalogChanged, 1, events.JSONDecoder[CatalogChanged]())
+	r.Register(EventTypeDiscountChanged, 1, events.JSONDecoder[DiscountChanged]())
+}
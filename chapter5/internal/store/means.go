@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/telemetry"
+)
+
+var (
+	ErrUnknownMeans = errors.New("unknown payment means")
+	// ErrMeansFixed means the payment means of stores are not kept anywhere, so every store takes them all.
+	ErrMeansFixed = errors.New("stores take every payment means")
+)
+
+// AllMeans are every payment means there is, in the order alternatives are offered to customers.
+var AllMeans = []payment.Means{payment.MEANS_CARD, payment.MEANS_CASH, payment.MEANS_WALLET, payment.MEANS_COFFEEBUX, payment.MEANS_MARKETPLACE}
+
+// PaymentMeans are the payment means a store takes for now, e.g. only cash and wallets while its card
+// reader is broken.
+type PaymentMeans struct {
+	StoreID uuid.UUID
+	// Allowed are the means the store takes; empty takes them all.
+	Allowed []payment.Means
+	// Reason tells customers why the other means are not taken, e.g. "card reader broken".
+	Reason    string
+	UpdatedBy string
+	UpdatedAt time.Time
+}
+
+// Takes tells whether the store takes means.
+func (m PaymentMeans) Takes(means payment.Means) bool {
+	return len(m.Allowed) == 0 || slices.Contains(m.Allowed, means)
+}
+
+// Alternatives are the means the store takes other than means, in the order of AllMeans.
+func (m PaymentMeans) Alternatives(means payment.Means) []payment.Means {
+	var res []payment.Means
+	for _, v := range AllMeans {
+		if v != means && m.Takes(v) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (m PaymentMeans) String() string {
+	if len(m.Allowed) == 0 {
+		return "any"
+	}
+	names := make([]string, 0, len(m.Allowed))
+	for _, v := range m.Allowed {
+		names = append(names, string(v))
+	}
+	return strings.Join(names, ", ")
+}
+
+type MeansRepository interface {
+	// GetPaymentMeans returns the means a store takes; a store never restricted takes them all.
+	GetPaymentMeans(ctx context.Context, storeID uuid.UUID) (PaymentMeans, error)
+	SavePaymentMeans(ctx context.Context, m PaymentMeans) error
+	Ping(ctx context.Context) error
+}
+
+// WithPaymentMeans lets stores stop taking some payment means for a while. Without it every store takes
+// every means.
+func WithPaymentMeans(repo MeansRepository) Option {
+	return func(s *Service) {
+		s.means = repo
+	}
+}
+
+// PaymentMeans returns the means the store takes for now.
+func (s Service) PaymentMeans(ctx context.Context, storeID uuid.UUID) (PaymentMeans, error) {
+	if s.means == nil {
+		return PaymentMeans{StoreID: storeID}, nil
+	}
+	return s.means.GetPaymentMeans(ctx, storeID)
+}
+
+// SetPaymentMeans has the store take only the means allowed, for the reason given; no means takes them
+// all again.
+func (s Service) SetPaymentMeans(ctx context.Context, storeID uuid.UUID, allowed []payment.Means, reason string) (PaymentMeans, error) {
+	if s.means == nil {
+		return PaymentMeans{}, ErrMeansFixed
+	}
+	after := PaymentMeans{StoreID: storeID, Reason: reason, UpdatedBy: audit.Actor(ctx), UpdatedAt: time.Now().UTC()}
+	for _, v := range allowed {
+		if !slices.Contains(AllMeans, v) {
+			return PaymentMeans{}, fmt.Errorf("%w: %q", ErrUnknownMeans, v)
+		}
+		if !slices.Contains(after.Allowed, v) {
+			after.Allowed = append(after.Allowed, v)
+		}
+	}
+	if len(after.Allowed) == 0 {
+		after.Reason = ""
+	}
+	before, err := s.means.GetPaymentMeans(ctx, storeID)
+	if err != nil {
+		return PaymentMeans{}, fmt.Errorf("failed to get the current payment means: %w", err)
+	}
+	if err := s.means.SavePaymentMeans(ctx, after); err != nil {
+		return PaymentMeans{}, err
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionPaymentMeansChange, "store", storeID.String(), before.String(), after.String())
+		e.Note = after.Reason
+		if err := s.audit.Record(ctx, e); err != nil {
+			return after, fmt.Errorf("payment means changed but failed to record it in the audit log: %w", err)
+		}
+	}
+	return after, nil
+}
+
+type MongoMeansRepository struct {
+	client *mongo.Client
+	means  *mongo.Collection
+}
+
+func NewMongoMeansRepo(ctx context.Context, connectionString string) (*MongoMeansRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoMeansRepository{client: client, means: client.Database("coffeeco").Collection("store_payment_means")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoMeansRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoMeans struct {
+	StoreID   string          `bson:"_id"`
+	Allowed   []payment.Means `bson:"allowed"`
+	Reason    string          `bson:"reason,omitempty"`
+	UpdatedBy string          `bson:"updated_by"`
+	UpdatedAt time.Time       `bson:"updated_at"`
+}
+
+func (m *MongoMeansRepository) GetPaymentMeans(ctx context.Context, storeID uuid.UUID) (_ PaymentMeans, err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoMeansRepository.GetPaymentMeans", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoMeans
+	if err := m.means.FindOne(ctx, bson.D{{Key: "_id", Value: storeID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return PaymentMeans{StoreID: storeID}, nil
+		}
+		return PaymentMeans{}, fmt.Errorf("failed to find payment means of store: %w", err)
+	}
+	return PaymentMeans{StoreID: storeID, Allowed: doc.Allowed, Reason: doc.Reason, UpdatedBy: doc.UpdatedBy, UpdatedAt: doc.UpdatedAt}, nil
+}
+
+func (m *MongoMeansRepository) SavePaymentMeans(ctx context.Context, p PaymentMeans) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoMeansRepository.SavePaymentMeans", attribute.String("store.id", p.StoreID.String()))
+	defer telemetry.End(span, &err)
+	doc := mongoMeans{StoreID: p.StoreID.String(), Allowed: p.Allowed, Reason: p.Reason, UpdatedBy: p.UpdatedBy, UpdatedAt: p.UpdatedAt}
+	if _, err := m.means.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.StoreID}}, doc, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to save payment means of store: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoMeansRepository) Ping(ctx context.Context) error {
+	if _, err := m.means.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryMeansRepository keeps the payment means of stores in process. It is meant for tests and local
+// experiments.
+type MemoryMeansRepository struct {
+	mu    sync.Mutex
+	means map[uuid.UUID]PaymentMeans
+}
+
+func NewMemoryMeansRepo() *MemoryMeansRepository {
+	return &MemoryMeansRepository{means: map[uuid.UUID]PaymentMeans{}}
+}
+
+func (m *MemoryMeansRepository) GetPaymentMeans(_ context.Context, storeID uuid.UUID) (PaymentMeans, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.means[storeID]
+	if !ok {
+		return PaymentMeans{StoreID: storeID}, nil
+	}
+	p.Allowed = slices.Clone(p.Allowed)
+	return p, nil
+}
+
+func (m *MemoryMeansRepository) SavePaymentMeans(_ context.Context, p PaymentMeans) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p.Allowed = slices.Clone(p.Allowed)
+	m.means[p.StoreID] = p
+	return nil
+}
+
+func (m *MemoryMeansRepository) Ping(context.Context) error {
+	return nil
+}
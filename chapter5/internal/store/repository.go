@@ -4,22 +4,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 
+	"github.com/Rhymond/go-money"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/telemetry"
 )
 
 var ErrNoDiscount = errors.New("no discount for store")
 
 type Repository interface {
 	GetStoreDiscount(ctx context.Context, storeID uuid.UUID) (int64, error)
+	ListStores(ctx context.Context) ([]Store, error)
+	// GetStores and GetStoreDiscounts look up many stores at once; unknown IDs are left out of the result.
+	GetStores(ctx context.Context, ids []uuid.UUID) ([]Store, error)
+	GetStoreDiscounts(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error)
+	SaveStore(ctx context.Context, s Store) error
+	SetStoreDiscount(ctx context.Context, storeID uuid.UUID, discount int64) error
 	Ping(ctx context.Context) error
 }
 
 type MongoRepository struct {
+	client         *mongo.Client
 	storeDiscounts *mongo.Collection
+	stores         *mongo.Collection
 }
 
 func (m MongoRepository) Ping(ctx context.Context) error {
@@ -36,21 +52,225 @@ func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepositor
 	}
 
 	discounts := client.Database("coffeeco").Collection("store_discounts")
+	stores := client.Database("coffeeco").Collection("stores")
 
 	return &MongoRepository{
+		client:         client,
 		storeDiscounts: discounts,
+		stores:         stores,
 	}, nil
 }
 
-func (m MongoRepository) GetStoreDiscount(ctx context.Context, storeID uuid.UUID) (int64, error) {
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
 
-	var discount int64
-	if err := m.storeDiscounts.FindOne(ctx, bson.D{{"store_id", storeID.String()}}).Decode(&discount); err != nil {
+func (m MongoRepository) GetStoreDiscount(ctx context.Context, storeID uuid.UUID) (_ int64, err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoRepository.GetStoreDiscount", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var discount mongoDiscount
+	if err := m.storeDiscounts.FindOne(ctx, bson.D{{Key: "store_id", Value: storeID.String()}}).Decode(&discount); err != nil {
 		if err == mongo.ErrNoDocuments {
 			// This error means your query did not match any documents.
 			return 0, ErrNoDiscount
 		}
 		return 0, fmt.Errorf("failed to find discount for store: %w", err)
 	}
-	return discount, nil
+	return discount.Discount, nil
+}
+
+type mongoDiscount struct {
+	StoreID  string `bson:"store_id"`
+	Discount int64  `bson:"discount"`
+}
+
+func (m MongoRepository) GetStoreDiscounts(ctx context.Context, ids []uuid.UUID) (_ map[uuid.UUID]int64, err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoRepository.GetStoreDiscounts")
+	defer telemetry.End(span, &err)
+	cur, err := m.storeDiscounts.Find(ctx, bson.D{{Key: "store_id", Value: bson.D{{Key: "$in", Value: idStrings(ids)}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find store discounts: %w", err)
+	}
+	var docs []mongoDiscount
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode store discounts: %w", err)
+	}
+	res := make(map[uuid.UUID]int64, len(docs))
+	for _, d := range docs {
+		id, _ := uuid.Parse(d.StoreID)
+		res[id] = d.Discount
+	}
+	return res, nil
+}
+
+type mongoStore struct {
+	ID       string         `bson:"_id"`
+	Location string         `bson:"location"`
+	Products []mongoProduct `bson:"products_for_sale"`
+}
+
+// mongoProduct exists because money.Money has no exported fields, so it cannot be stored as is.
+type mongoProduct struct {
+	ItemName string `bson:"item_name"`
+	Price    int64  `bson:"price"`
+	Currency string `bson:"currency"`
+}
+
+func (m mongoStore) toStore() Store {
+	id, _ := uuid.Parse(m.ID)
+	products := make([]coffeeco.Product, 0, len(m.Products))
+	for _, p := range m.Products {
+		products = append(products, coffeeco.Product{ItemName: p.ItemName, BasePrice: *money.New(p.Price, p.Currency)})
+	}
+	return New(id, m.Location, products...)
+}
+
+func (m MongoRepository) ListStores(ctx context.Context) (_ []Store, err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoRepository.ListStores")
+	defer telemetry.End(span, &err)
+	cur, err := m.stores.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "location", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stores: %w", err)
+	}
+	var docs []mongoStore
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode stores: %w", err)
+	}
+	stores := make([]Store, 0, len(docs))
+	for _, d := range docs {
+		stores = append(stores, d.toStore())
+	}
+	return stores, nil
+}
+
+func (m MongoRepository) GetStores(ctx context.Context, ids []uuid.UUID) (_ []Store, err error) {
+	ctx, span := telemetry.StartClient(ctx, "store.MongoRepository.GetStores")
+	defer telemetry.End(span, &err)
+	cur, err := m.stores.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: idStrings(ids)}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stores: %w", err)
+	}
+	var docs []mongoStore
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode stores: %w", err)
+	}
+	stores := make([]Store, 0, len(docs))
+	for _, d := range docs {
+		stores = append(stores, d.toStore())
+	}
+	return stores, nil
+}
+
+func idStrings(ids []uuid.UUID) []string {
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, id.String())
+	}
+	return res
+}
+
+func (m MongoRepository) SaveStore(ctx context.Context, s Store) error {
+	doc := mongoStore{ID: s.ID.String(), Location: s.Location, Products: make([]mongoProduct, 0, len(s.ProductsForSale))}
+	for _, p := range s.ProductsForSale {
+		doc.Products = append(doc.Products, mongoProduct{ItemName: p.ItemName, Price: p.BasePrice.Amount(), Currency: p.BasePrice.Currency().Code})
+	}
+	if _, err := m.stores.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}}, doc, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to save store: %w", err)
+	}
+	return nil
+}
+
+func (m MongoRepository) SetStoreDiscount(ctx context.Context, storeID uuid.UUID, discount int64) error {
+	_, err := m.storeDiscounts.ReplaceOne(ctx,
+		bson.D{{Key: "store_id", Value: storeID.String()}},
+		mongoDiscount{StoreID: storeID.String(), Discount: discount},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set store discount: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps stores and their discounts in process. It is meant for tests and local
+// experiments.
+type MemoryRepository struct {
+	mu        sync.Mutex
+	stores    map[uuid.UUID]Store
+	discounts map[uuid.UUID]int64
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{stores: map[uuid.UUID]Store{}, discounts: map[uuid.UUID]int64{}}
+}
+
+func (m *MemoryRepository) GetStoreDiscount(_ context.Context, storeID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.discounts[storeID]
+	if !ok {
+		return 0, ErrNoDiscount
+	}
+	return d, nil
+}
+
+func (m *MemoryRepository) GetStoreDiscounts(_ context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[uuid.UUID]int64, len(ids))
+	for _, id := range ids {
+		if d, ok := m.discounts[id]; ok {
+			res[id] = d
+		}
+	}
+	return res, nil
+}
+
+// ListStores lists the stores by location, as the Mongo repository does.
+func (m *MemoryRepository) ListStores(context.Context) ([]Store, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stores := make([]Store, 0, len(m.stores))
+	for _, s := range m.stores {
+		stores = append(stores, copyStore(s))
+	}
+	slices.SortFunc(stores, func(a, b Store) int { return strings.Compare(a.Location, b.Location) })
+	return stores, nil
+}
+
+func (m *MemoryRepository) GetStores(_ context.Context, ids []uuid.UUID) ([]Store, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stores := make([]Store, 0, len(ids))
+	for _, id := range ids {
+		if s, ok := m.stores[id]; ok {
+			stores = append(stores, copyStore(s))
+		}
+	}
+	return stores, nil
+}
+
+// SaveStore stores a copy, so later changes to s only count once saved again.
+func (m *MemoryRepository) SaveStore(_ context.Context, s Store) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stores[s.ID] = copyStore(s)
+	return nil
+}
+
+func (m *MemoryRepository) SetStoreDiscount(_ context.Context, storeID uuid.UUID, discount int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.discounts[storeID] = discount
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
+
+func copyStore(s Store) Store {
+	s.ProductsForSale = slices.Clone(s.ProductsForSale)
+	return s
 }
@@ -2,24 +2,66 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 
 	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/events"
 )
 
 type Store struct {
-	ID              uuid.UUID
-	Location        string
-	ProductsForSale []coffeeco.Product
+	ddd.AggregateRoot `bson:",inline"`
+	Location          string
+	ProductsForSale   []coffeeco.Product
 }
 
+func New(id uuid.UUID, location string, products ...coffeeco.Product) Store {
+	return Store{AggregateRoot: ddd.AggregateRoot{ID: id}, Location: location, ProductsForSale: products}
+}
+
+// Ref is a store known only by its ID, as purchases and cards refer to it.
+func Ref(id uuid.UUID) Store {
+	return Store{AggregateRoot: ddd.AggregateRoot{ID: id}}
+}
+
+var (
+	ErrInvalidDiscount = errors.New("discount must be between 0 and 100 percent")
+	ErrNoLocation      = errors.New("store must have a location")
+)
+
 type Service struct {
-	repo Repository
+	repo      Repository
+	audit     audit.Recorder
+	publisher events.Publisher // 可选, 发布店铺变更, 让缓存失效
+	means     MeansRepository  // 可选, 店铺暂时只收部分支付方式
 }
 
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+type Option func(s *Service)
+
+// WithAuditLog records every discount and payment means change in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithEventPublisher publishes the changes to stores, so their caches everywhere are invalidated.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	s := &Service{repo: repo}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s Service) GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID) (float32, error) {
@@ -29,3 +71,65 @@ func (s Service) GetStoreSpecificDiscount(ctx context.Context, storeID uuid.UUID
 	}
 	return float32(dis), nil
 }
+
+func (s Service) ListStores(ctx context.Context) ([]Store, error) {
+	return s.repo.ListStores(ctx)
+}
+
+func (s Service) GetStores(ctx context.Context, ids []uuid.UUID) ([]Store, error) {
+	return s.repo.GetStores(ctx, ids)
+}
+
+func (s Service) GetStoreDiscounts(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+	return s.repo.GetStoreDiscounts(ctx, ids)
+}
+
+func (s Service) CreateStore(ctx context.Context, st Store) error {
+	if st.Location == "" {
+		return ErrNoLocation
+	}
+	if st.ID == uuid.Nil {
+		return errors.New("store must have an ID")
+	}
+	st.RecordEvent(CatalogChanged{StoreID: st.ID})
+	if err := s.repo.SaveStore(ctx, st); err != nil {
+		return err
+	}
+	return s.publish(ctx, st.PopEvents()...)
+}
+
+// SetDiscount sets the percentage taken off every purchase at the store; 0 removes the discount.
+func (s Service) SetDiscount(ctx context.Context, storeID uuid.UUID, discount int64) error {
+	if discount < 0 || discount > 100 {
+		return ErrInvalidDiscount
+	}
+	if s.audit == nil {
+		if err := s.repo.SetStoreDiscount(ctx, storeID, discount); err != nil {
+			return err
+		}
+		return s.publish(ctx, DiscountChanged{StoreID: storeID, Discount: discount})
+	}
+
+	before, err := s.repo.GetStoreDiscount(ctx, storeID)
+	if err != nil && !errors.Is(err, ErrNoDiscount) {
+		return fmt.Errorf("failed to get the current discount: %w", err)
+	}
+	if err := s.repo.SetStoreDiscount(ctx, storeID, discount); err != nil {
+		return err
+	}
+	e := audit.NewEntry(ctx, audit.ActionDiscountChange, "store", storeID.String(), fmt.Sprintf("%d%%", before), fmt.Sprintf("%d%%", discount))
+	if err := s.audit.Record(ctx, e); err != nil {
+		return fmt.Errorf("discount changed but failed to record it in the audit log: %w", err)
+	}
+	return s.publish(ctx, DiscountChanged{StoreID: storeID, Discount: discount})
+}
+
+func (s Service) publish(ctx context.Context, evts ...events.Event) error {
+	if s.publisher == nil {
+		return nil
+	}
+	if err := s.publisher.Publish(ctx, evts...); err != nil {
+		return fmt.Errorf("store changed but failed to publish it: %w", err)
+	}
+	return nil
+}
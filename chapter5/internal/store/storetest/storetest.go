@@ -0,0 +1,207 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/store"
+)
+
+// manyStores is more than a Mongo cursor returns in its first batch, so lookups that do not read every
+// batch lose stores.
+const manyStores = 250
+
+// RunRepositoryTests checks that a store.Repository behaves as the services rely on. newRepo returns the
+// repository to test; it may share a database with other runs, as every test uses stores of its own. Run it
+// from the tests of an adapter, e.g.
+//
+//	func Test_RepositoryContract(t *testing.T) {
+//		storetest.RunRepositoryTests(t, func(t *testing.T) store.Repository { return newAdapter(t) })
+//	}
+func RunRepositoryTests(t *testing.T, newRepo func(t *testing.T) store.Repository) {
+	t.Run("a store without a discount is ErrNoDiscount", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetStoreDiscount(context.Background(), uuid.New()); !errors.Is(err, store.ErrNoDiscount) {
+			t.Fatalf("expected ErrNoDiscount but got %v", err)
+		}
+	})
+
+	t.Run("setting a discount again replaces it", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		id := uuid.New()
+		for _, d := range []int64{10, 15} {
+			if err := repo.SetStoreDiscount(ctx, id, d); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			if got, err := repo.GetStoreDiscount(ctx, id); err != nil || got != d {
+				t.Fatalf("expected a %d%% discount but got %d, %v", d, got, err)
+			}
+		}
+	})
+
+	t.Run("a saved store is got back as it was, and saving it again replaces it", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		s := newStore(uuid.NewString())
+		if err := repo.SaveStore(ctx, s); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		s.Location += " (moved)"
+		s.ProductsForSale = append(s.ProductsForSale, coffeeco.Product{ItemName: "cortado", BasePrice: *money.New(375, "GBP")})
+		if err := repo.SaveStore(ctx, s); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		got, err := repo.GetStores(ctx, []uuid.UUID{s.ID})
+		if err != nil || len(got) != 1 {
+			t.Fatalf("expected the store but got %+v, %v", got, err)
+		}
+		assertSame(t, got[0], s)
+	})
+
+	t.Run("every store is listed, by location", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		run := "contract-" + uuid.NewString()
+		saved := saveStores(t, repo, run)
+		all, err := repo.ListStores(ctx)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		var listed []store.Store
+		for _, s := range all {
+			if strings.HasPrefix(s.Location, run) {
+				listed = append(listed, s)
+			}
+		}
+		if len(listed) != len(saved) {
+			t.Fatalf("expected the %d stores saved listed but %d were", len(saved), len(listed))
+		}
+		for i := range saved {
+			assertSame(t, listed[i], saved[i])
+		}
+	})
+
+	t.Run("many stores are looked up at once, and unknown ones left out", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		saved := saveStores(t, repo, "contract-"+uuid.NewString())
+		ids := []uuid.UUID{uuid.New()}
+		for i, s := range saved {
+			ids = append(ids, s.ID)
+			if i%2 == 0 {
+				if err := repo.SetStoreDiscount(ctx, s.ID, int64(i%50)); err != nil {
+					t.Fatalf("expected no error but got %v", err)
+				}
+			}
+		}
+		stores, err := repo.GetStores(ctx, ids)
+		if err != nil || len(stores) != len(saved) {
+			t.Fatalf("expected the %d stores saved but got %d, %v", len(saved), len(stores), err)
+		}
+		discounts, err := repo.GetStoreDiscounts(ctx, ids)
+		if err != nil || len(discounts) != (len(saved)+1)/2 {
+			t.Fatalf("expected the %d discounts set but got %d, %v", (len(saved)+1)/2, len(discounts), err)
+		}
+		for i, s := range saved {
+			d, ok := discounts[s.ID]
+			if set := i%2 == 0; ok != set || (set && d != int64(i%50)) {
+				t.Fatalf("expected store %d to have a discount (%t) of %d but got %d (%t)", i, set, i%50, d, ok)
+			}
+		}
+		if got, err := repo.GetStores(ctx, nil); err != nil || len(got) != 0 {
+			t.Fatalf("expected no stores for no IDs but got %d, %v", len(got), err)
+		}
+	})
+
+	t.Run("stores and discounts written at once are all kept", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		run := "contract-" + uuid.NewString()
+		stores := make([]store.Store, 50)
+		errs := make(chan error, 2*len(stores))
+		var wg sync.WaitGroup
+		for i := range stores {
+			stores[i] = newStore(fmt.Sprintf("%s-%02d", run, i))
+			wg.Go(func() { errs <- repo.SaveStore(ctx, stores[i]) })
+			wg.Go(func() { errs <- repo.SetStoreDiscount(ctx, stores[i].ID, int64(i)) })
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+		for i, s := range stores {
+			if d, err := repo.GetStoreDiscount(ctx, s.ID); err != nil || d != int64(i) {
+				t.Fatalf("expected store %d to have discount %d but got %d, %v", i, i, d, err)
+			}
+		}
+		if got, err := repo.GetStores(ctx, ids(stores)); err != nil || len(got) != len(stores) {
+			t.Fatalf("expected the %d stores saved but got %d, %v", len(stores), len(got), err)
+		}
+	})
+
+	t.Run("ping succeeds", func(t *testing.T) {
+		if err := newRepo(t).Ping(context.Background()); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	})
+}
+
+func newStore(location string) store.Store {
+	return store.New(uuid.New(), location,
+		coffeeco.Product{ItemName: "latte", BasePrice: *money.New(450, "GBP")},
+		coffeeco.Product{ItemName: "espresso", BasePrice: *money.New(300, "GBP")},
+	)
+}
+
+// saveStores saves manyStores stores located at run, in the order ListStores lists them.
+func saveStores(t *testing.T, repo store.Repository, run string) []store.Store {
+	t.Helper()
+	stores := make([]store.Store, manyStores)
+	for i := range stores {
+		stores[i] = newStore(fmt.Sprintf("%s-%03d", run, i))
+	}
+	// Saved out of order, so a repository that lists them as saved is caught.
+	for i := len(stores) - 1; i >= 0; i-- {
+		if err := repo.SaveStore(context.Background(), stores[i]); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	return stores
+}
+
+func ids(stores []store.Store) []uuid.UUID {
+	res := make([]uuid.UUID, 0, len(stores))
+	for _, s := range stores {
+		res = append(res, s.ID)
+	}
+	return res
+}
+
+func assertSame(t *testing.T, got, want store.Store) {
+	t.Helper()
+	if got.ID != want.ID || got.Location != want.Location {
+		t.Fatalf("expected store %s at %q but got %s at %q", want.ID, want.Location, got.ID, got.Location)
+	}
+	if len(got.ProductsForSale) != len(want.ProductsForSale) {
+		t.Fatalf("expected %d products for sale but got %d", len(want.ProductsForSale), len(got.ProductsForSale))
+	}
+	for i, w := range want.ProductsForSale {
+		g := got.ProductsForSale[i]
+		if g.ItemName != w.ItemName || g.BasePrice.Amount() != w.BasePrice.Amount() || g.BasePrice.Currency().Code != w.BasePrice.Currency().Code {
+			t.Errorf("expected %s at %d %s but got %s at %d %s", w.ItemName, w.BasePrice.Amount(), w.BasePrice.Currency().Code,
+				g.ItemName, g.BasePrice.Amount(), g.BasePrice.Currency().Code)
+		}
+	}
+}
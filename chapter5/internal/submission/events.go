@@ -0,0 +1,214 @@
+package submission
+
+import (
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/events"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+const (
+	EventTypePurchaseRequested = "submission.purchase_requested"
+	EventTypeUpdated           = "submission.updated"
+)
+
+// PurchaseRequested is the command to complete a submitted purchase. It travels on the event transport like
+// any event, so whichever worker gets it first completes the purchase.
+type PurchaseRequested struct {
+	TrackingID    uuid.UUID `json:"tracking_id"`
+	StoreID       uuid.UUID `json:"store_id"`
+	CustomerID    uuid.UUID `json:"customer_id"`
+	Products      []Product `json:"products"`
+	PaymentMeans  string    `json:"payment_means"`
+	CardToken     string    `json:"card_token,omitempty"`
+	LoyaltyCardID uuid.UUID `json:"loyalty_card_id"`
+	// DeliveryAddress and DeliveryPhone are set for purchases to be delivered.
+	DeliveryAddress string     `json:"delivery_address,omitempty"`
+	DeliveryPhone   string     `json:"delivery_phone,omitempty"`
+	ServedBy        string     `json:"served_by,omitempty"`
+	DeviceID        uuid.UUID  `json:"device_id"`
+	QuoteToken      string     `json:"quote_token,omitempty"`
+	Charges         []Charge   `json:"charges,omitempty"`
+	Channel         string     `json:"channel,omitempty"`
+	Overrides       []Override `json:"overrides,omitempty"`
+	PickupAt        time.Time  `json:"pickup_at,omitzero"`
+	// Substitutes are what the customer accepted instead of products out of stock, by the product.
+	Substitutes map[string]string `json:"substitutes,omitempty"`
+	// TabID is the tab the purchase settles, if any.
+	TabID uuid.UUID `json:"tab_id,omitzero"`
+	// ConfirmDuplicate is set when the customer confirmed buying the same again.
+	ConfirmDuplicate bool      `json:"confirm_duplicate,omitempty"`
+	RequestedAt      time.Time `json:"requested_at"`
+}
+
+type Product struct {
+	ItemName    string   `json:"item_name"`
+	Amount      int64    `json:"amount"`
+	Currency    string   `json:"currency"`
+	Size        string   `json:"size,omitempty"`
+	Modifiers   []string `json:"modifiers,omitempty"`
+	ReusableCup bool     `json:"reusable_cup,omitempty"`
+}
+
+// Charge is a purchase.Charge the purchase was submitted with, e.g. the tip for the courier of a marketplace.
+type Charge struct {
+	Type     string `json:"type"`
+	Payee    string `json:"payee"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Override is a purchase.PriceOverride the purchase was submitted with. Product is the index of the product,
+// or purchase.WholePurchase.
+type Override struct {
+	Product  int    `json:"product"`
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+	Reason   string `json:"reason"`
+	Note     string `json:"note,omitempty"`
+}
+
+func (e PurchaseRequested) EventType() string {
+	return EventTypePurchaseRequested
+}
+
+func (e PurchaseRequested) AggregateID() uuid.UUID {
+	return e.TrackingID
+}
+
+// EventID is the tracking ID, as a purchase is requested once per submission.
+func (e PurchaseRequested) EventID() uuid.UUID {
+	return e.TrackingID
+}
+
+func requestPurchase(trackingID uuid.UUID, p *purchase.Purchase, loyaltyCardID uuid.UUID, at time.Time) PurchaseRequested {
+	e := PurchaseRequested{
+		TrackingID:       trackingID,
+		StoreID:          p.Store.ID,
+		CustomerID:       p.CustomerID,
+		PaymentMeans:     string(p.PaymentMeans),
+		LoyaltyCardID:    loyaltyCardID,
+		ServedBy:         p.ServedBy,
+		DeviceID:         p.DeviceID,
+		QuoteToken:       p.QuoteToken,
+		Channel:          string(p.Channel),
+		PickupAt:         p.PickupAt,
+		Substitutes:      p.Substitutes,
+		TabID:            p.TabID,
+		ConfirmDuplicate: p.ConfirmDuplicate,
+		RequestedAt:      at.UTC(),
+	}
+	for _, v := range p.ProductsToPurchase {
+		e.Products = append(e.Products, Product{
+			ItemName:    v.ItemName,
+			Amount:      v.BasePrice.Amount(),
+			Currency:    v.BasePrice.Currency().Code,
+			Size:        v.Size,
+			Modifiers:   v.Modifiers,
+			ReusableCup: v.ReusableCup,
+		})
+	}
+	if p.CardToken != nil {
+		e.CardToken = *p.CardToken
+	}
+	for _, c := range p.Charges {
+		e.Charges = append(e.Charges, Charge{Type: string(c.Type), Payee: string(c.Payee), Amount: c.Amount.Amount(), Currency: c.Amount.Currency().Code})
+	}
+	for _, o := range p.Overrides {
+		e.Overrides = append(e.Overrides, Override{Product: o.Product, Price: o.Price.Amount(), Currency: o.Price.Currency().Code, Reason: string(o.Reason), Note: o.Note})
+	}
+	if p.Delivery != nil {
+		e.DeliveryAddress, e.DeliveryPhone = p.Delivery.Address, p.Delivery.Phone
+	}
+	return e
+}
+
+// purchase is the purchase to complete, as it was submitted.
+func (e PurchaseRequested) purchase() *purchase.Purchase {
+	p := &purchase.Purchase{
+		Store:            store.Ref(e.StoreID),
+		CustomerID:       e.CustomerID,
+		PaymentMeans:     payment.Means(e.PaymentMeans),
+		ServedBy:         e.ServedBy,
+		DeviceID:         e.DeviceID,
+		QuoteToken:       e.QuoteToken,
+		Channel:          purchase.Channel(e.Channel),
+		PickupAt:         e.PickupAt,
+		Substitutes:      e.Substitutes,
+		TabID:            e.TabID,
+		ConfirmDuplicate: e.ConfirmDuplicate,
+	}
+	for _, v := range e.Products {
+		p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{
+			ItemName:    v.ItemName,
+			BasePrice:   *money.New(v.Amount, v.Currency),
+			Size:        v.Size,
+			Modifiers:   v.Modifiers,
+			ReusableCup: v.ReusableCup,
+		})
+	}
+	for _, c := range e.Charges {
+		p.Charges = append(p.Charges, purchase.Charge{Type: purchase.ChargeType(c.Type), Payee: purchase.Payee(c.Payee), Amount: *money.New(c.Amount, c.Currency)})
+	}
+	for _, o := range e.Overrides {
+		p.Overrides = append(p.Overrides, purchase.PriceOverride{Product: o.Product, Price: *money.New(o.Price, o.Currency), Reason: purchase.OverrideReason(o.Reason), Note: o.Note})
+	}
+	if e.CardToken != "" {
+		token := e.CardToken
+		p.CardToken = &token
+	}
+	if e.DeliveryAddress != "" {
+		p.Delivery = &purchase.Delivery{Address: e.DeliveryAddress, Phone: e.DeliveryPhone}
+	}
+	return p
+}
+
+// Updated is published every time a submission moves on, so clients can follow it instead of polling.
+type Updated struct {
+	TrackingID     uuid.UUID `json:"tracking_id"`
+	StoreID        uuid.UUID `json:"store_id"`
+	CustomerID     uuid.UUID `json:"customer_id"`
+	Status         Status    `json:"status"`
+	PurchaseID     uuid.UUID `json:"purchase_id"`
+	FailureCode    string    `json:"failure_code,omitempty"`
+	FailureMessage string    `json:"failure_message,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (e Updated) EventType() string {
+	return EventTypeUpdated
+}
+
+func (e Updated) AggregateID() uuid.UUID {
+	return e.TrackingID
+}
+
+// EventID is derived from the submission and status, as a submission reaches each status only once.
+func (e Updated) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.TrackingID, []byte(EventTypeUpdated+"."+string(e.Status)))
+}
+
+func (s *Submission) updated() Updated {
+	return Updated{
+		TrackingID:     s.ID,
+		StoreID:        s.StoreID,
+		CustomerID:     s.CustomerID,
+		Status:         s.status,
+		PurchaseID:     s.purchaseID,
+		FailureCode:    s.failureCode,
+		FailureMessage: s.failureMessage,
+		UpdatedAt:      s.updatedAt,
+	}
+}
+
+// RegisterEvents adds decoders for every version of the submission events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypePurchaseRequested, 1, events.JSONDecoder[PurchaseRequested]())
+	r.Register(EventTypeUpdated, 1, events.JSONDecoder[Updated]())
+}
@@ -0,0 +1,180 @@
+package submission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such submission.
+	Get(ctx context.Context, id uuid.UUID) (*Submission, error)
+	// Save returns ErrConcurrencyConflict if the submission was saved by someone else since it was read, so
+	// two workers never complete the same purchase.
+	Save(ctx context.Context, s *Submission) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps submissions versioned.
+type MongoRepository struct {
+	client      *mongo.Client
+	submissions *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, submissions: client.Database("coffeeco").Collection("purchase_submissions")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoSubmission struct {
+	ID             string    `bson:"_id"`
+	Version        int       `bson:"version"`
+	StoreID        string    `bson:"store_id"`
+	CustomerID     string    `bson:"customer_id,omitempty"`
+	Status         string    `bson:"status"`
+	PurchaseID     string    `bson:"purchase_id,omitempty"`
+	FailureCode    string    `bson:"failure_code,omitempty"`
+	FailureMessage string    `bson:"failure_message,omitempty"`
+	SubmittedAt    time.Time `bson:"submitted_at"`
+	UpdatedAt      time.Time `bson:"updated_at"`
+}
+
+func toMongoSubmission(s *Submission) mongoSubmission {
+	doc := mongoSubmission{
+		ID:             s.ID.String(),
+		Version:        s.version,
+		StoreID:        s.StoreID.String(),
+		Status:         string(s.status),
+		FailureCode:    s.failureCode,
+		FailureMessage: s.failureMessage,
+		SubmittedAt:    s.SubmittedAt,
+		UpdatedAt:      s.updatedAt,
+	}
+	if s.CustomerID != uuid.Nil {
+		doc.CustomerID = s.CustomerID.String()
+	}
+	if s.purchaseID != uuid.Nil {
+		doc.PurchaseID = s.purchaseID.String()
+	}
+	return doc
+}
+
+func (m mongoSubmission) toSubmission() *Submission {
+	s := &Submission{
+		SubmittedAt:    m.SubmittedAt,
+		version:        m.Version,
+		status:         Status(m.Status),
+		failureCode:    m.FailureCode,
+		failureMessage: m.FailureMessage,
+		updatedAt:      m.UpdatedAt,
+	}
+	s.ID, _ = uuid.Parse(m.ID)
+	s.StoreID, _ = uuid.Parse(m.StoreID)
+	if m.CustomerID != "" {
+		s.CustomerID, _ = uuid.Parse(m.CustomerID)
+	}
+	if m.PurchaseID != "" {
+		s.purchaseID, _ = uuid.Parse(m.PurchaseID)
+	}
+	return s
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Submission, err error) {
+	ctx, span := telemetry.StartClient(ctx, "submission.MongoRepository.Get", attribute.String("submission.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoSubmission
+	if err := m.submissions.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find purchase submission: %w", err)
+	}
+	return doc.toSubmission(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, s *Submission) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "submission.MongoRepository.Save", attribute.String("submission.id", s.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoSubmission(s)
+	doc.Version = s.version + 1
+	if s.version == 0 {
+		if _, err := m.submissions.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save purchase submission: %w", err)
+		}
+	} else {
+		res, err := m.submissions.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: s.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save purchase submission: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.submissions.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps submissions in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu          sync.Mutex
+	submissions map[uuid.UUID]mongoSubmission
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{submissions: map[uuid.UUID]mongoSubmission{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Submission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.submissions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toSubmission(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, s *Submission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.submissions[s.ID].Version != s.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoSubmission(s)
+	doc.Version = s.version + 1
+	m.submissions[s.ID] = doc
+	s.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,195 @@
+package submission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+)
+
+// Purchases completes submitted purchases, e.g. purchase.Service.
+type Purchases interface {
+	CompletePurchase(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase, card *loyalty.CoffeeBux) error
+}
+
+// LoyaltyCards are where the loyalty cards of purchases paid with coffeebux are loaded from and saved to.
+type LoyaltyCards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+	Save(ctx context.Context, card *loyalty.CoffeeBux) error
+}
+
+// Describe turns the error a purchase failed with into the code and message the API answers it with.
+type Describe func(err error) (code, message string)
+
+// describeAny is the Describe of a service nobody told how to describe errors.
+func describeAny(error) (string, string) {
+	return "purchase_failed", "the purchase could not be completed"
+}
+
+type Service struct {
+	repo      Repository
+	publisher events.Publisher
+	purchases Purchases
+	cards     LoyaltyCards
+	registry  *events.Registry
+	describe  Describe
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithDescribe records why purchases failed as described by d, e.g. with the error codes of the API.
+func WithDescribe(d Describe) Option {
+	return func(s *Service) {
+		s.describe = d
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when submissions moved on.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// NewService queues purchases on publisher, which has to be the event transport the workers consume.
+func NewService(repo Repository, publisher events.Publisher, purchases Purchases, cards LoyaltyCards, opts ...Option) *Service {
+	r := events.NewRegistry()
+	RegisterEvents(r)
+	s := &Service{repo: repo, publisher: publisher, purchases: purchases, cards: cards, registry: r, describe: describeAny, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Submit queues a purchase to be completed by a worker and returns the submission tracking it. The caller
+// is expected to have checked who may make the purchase and use the loyalty card, as nobody is asked once
+// it is queued.
+func (s *Service) Submit(ctx context.Context, p *purchase.Purchase, loyaltyCardID uuid.UUID) (*Submission, error) {
+	sub := NewSubmission(p.Store.ID, p.CustomerID, s.now())
+	if err := s.repo.Save(ctx, sub); err != nil {
+		return nil, fmt.Errorf("failed to save purchase submission: %w", err)
+	}
+	if err := s.publisher.Publish(ctx, requestPurchase(sub.ID, p, loyaltyCardID, s.now())); err != nil {
+		if ferr := s.finish(ctx, sub, func() error { return sub.fail("not_queued", "the purchase could not be queued", s.now()) }); ferr != nil {
+			s.logger.ErrorContext(ctx, "purchase submission not queued and not failed", "submission", sub.ID, "error", ferr)
+		}
+		return nil, fmt.Errorf("failed to queue purchase: %w", err)
+	}
+	return sub, nil
+}
+
+func (s *Service) Get(ctx context.Context, id uuid.UUID) (*Submission, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Handle is an events.Handler for the submission topic that completes the purchases requested on it. Run
+// as many as there should be workers, in the same consumer group. A purchase is completed at most once: a
+// submission a worker started but did not finish, e.g. because it crashed, fails as interrupted rather than
+// risking a second charge, and the customer is told to check their purchases before trying again.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != EventTypePurchaseRequested {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	cmd := evt.(PurchaseRequested)
+	sub, err := s.repo.Get(ctx, cmd.TrackingID)
+	if errors.Is(err, ErrNotFound) {
+		s.logger.WarnContext(ctx, "purchase requested for an unknown submission", "submission", cmd.TrackingID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch sub.status {
+	case StatusCompleted, StatusFailed:
+		return nil
+	case StatusProcessing:
+		return s.finish(ctx, sub, func() error {
+			return sub.fail("interrupted", "the purchase was interrupted; check your purchases before trying again", s.now())
+		})
+	}
+	if err := sub.start(s.now()); err != nil {
+		return err
+	}
+	err = s.repo.Save(ctx, sub)
+	if errors.Is(err, ErrConcurrencyConflict) {
+		// Another worker got the same command and started it first.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start purchase submission: %w", err)
+	}
+	s.publish(ctx, sub)
+
+	p, err := s.complete(ctx, cmd)
+	return s.finish(ctx, sub, func() error {
+		if err != nil {
+			code, message := s.describe(err)
+			return sub.fail(code, message, s.now())
+		}
+		return sub.complete(p.ID, s.now())
+	})
+}
+
+// complete completes the purchase of cmd as the API would have.
+func (s *Service) complete(ctx context.Context, cmd PurchaseRequested) (*purchase.Purchase, error) {
+	p := cmd.purchase()
+	var card *loyalty.CoffeeBux
+	if cmd.LoyaltyCardID != uuid.Nil {
+		var err error
+		if card, err = s.cards.Get(ctx, cmd.LoyaltyCardID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.purchases.CompletePurchase(ctx, cmd.StoreID, p, card); err != nil {
+		return nil, err
+	}
+	if card != nil {
+		if err := s.cards.Save(ctx, card); err != nil {
+			s.logger.ErrorContext(ctx, "purchase completed but its loyalty card was not saved", "purchase", p.ID, "card", card.ID, "error", err)
+		}
+	}
+	return p, nil
+}
+
+// finish applies fn to sub, saves it and tells whoever follows it.
+func (s *Service) finish(ctx context.Context, sub *Submission, fn func() error) error {
+	if err := fn(); err != nil {
+		return err
+	}
+	if err := s.repo.Save(ctx, sub); err != nil {
+		return fmt.Errorf("failed to save purchase submission: %w", err)
+	}
+	s.publish(ctx, sub)
+	return nil
+}
+
+// publish tells whoever follows the submission it moved on. Clients can always poll, so a failure is only
+// logged.
+func (s *Service) publish(ctx context.Context, sub *Submission) {
+	if err := s.publisher.Publish(ctx, sub.updated()); err != nil {
+		s.logger.ErrorContext(ctx, "purchase submission update not published", "submission", sub.ID, "status", sub.status, "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package submission
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("purchase submission not found")
+	ErrConcurrencyConflict = errors.New("purchase submission changed since it was read")
+	ErrInvalidTransition   = errors.New("purchase submission cannot move to that status")
+)
+
+// Status is where a submitted purchase is, from being queued to being completed or failing.
+type Status string
+
+const (
+	StatusQueued     Status = "queued"
+	StatusProcessing Status = "processing"
+	StatusCompleted  Status = "completed"
+	StatusFailed     Status = "failed"
+)
+
+// Submission tracks a purchase submitted to be completed in the background. Its ID is the tracking ID
+// handed to the client, which the purchase ID replaces once the purchase is completed.
+type Submission struct {
+	ID          uuid.UUID
+	StoreID     uuid.UUID
+	CustomerID  uuid.UUID // uuid.Nil for anonymous purchases
+	SubmittedAt time.Time
+
+	version    int
+	status     Status
+	purchaseID uuid.UUID
+	// failureCode and failureMessage say why the purchase failed, as the API would have answered.
+	failureCode    string
+	failureMessage string
+	updatedAt      time.Time
+}
+
+func NewSubmission(storeID, customerID uuid.UUID, at time.Time) *Submission {
+	return &Submission{
+		ID:          uuid.New(),
+		StoreID:     storeID,
+		CustomerID:  customerID,
+		SubmittedAt: at.UTC(),
+		status:      StatusQueued,
+		updatedAt:   at.UTC(),
+	}
+}
+
+func (s *Submission) Status() Status {
+	return s.status
+}
+
+// PurchaseID is the purchase a completed submission made.
+func (s *Submission) PurchaseID() uuid.UUID {
+	return s.purchaseID
+}
+
+// Failure is why a failed submission failed, e.g. "card_charge_failed".
+func (s *Submission) Failure() (code, message string) {
+	return s.failureCode, s.failureMessage
+}
+
+func (s *Submission) UpdatedAt() time.Time {
+	return s.updatedAt
+}
+
+// Done tells whether the submission is completed or failed, which it stays.
+func (s *Submission) Done() bool {
+	return s.status == StatusCompleted || s.status == StatusFailed
+}
+
+func (s *Submission) start(at time.Time) error {
+	return s.move(StatusQueued, StatusProcessing, at)
+}
+
+func (s *Submission) complete(purchaseID uuid.UUID, at time.Time) error {
+	if err := s.move(StatusProcessing, StatusCompleted, at); err != nil {
+		return err
+	}
+	s.purchaseID = purchaseID
+	return nil
+}
+
+// fail ends a submission that is not done yet.
+func (s *Submission) fail(code, message string, at time.Time) error {
+	if s.Done() {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidTransition, s.ID, s.status)
+	}
+	s.status = StatusFailed
+	s.failureCode = code
+	s.failureMessage = message
+	s.updatedAt = at.UTC()
+	return nil
+}
+
+func (s *Submission) move(from, to Status, at time.Time) error {
+	if s.status != from {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, s.ID, s.status, from)
+	}
+	s.status = to
+	s.updatedAt = at.UTC()
+	return nil
+}
@@ -0,0 +1,278 @@
+package submission_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/device"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/submission"
+	"coffeeco/internal/testsupport"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+// commands are the purchases requested on the queue, as the workers would receive them.
+func (c capture) commands(t *testing.T) []events.Message {
+	t.Helper()
+	var res []events.Message
+	for _, e := range c {
+		if e.EventType() != submission.EventTypePurchaseRequested {
+			continue
+		}
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		res = append(res, msg)
+	}
+	return res
+}
+
+type purchases struct {
+	completed []*purchase.Purchase
+	err       error
+}
+
+func (p *purchases) CompletePurchase(_ context.Context, _ uuid.UUID, pur *purchase.Purchase, _ *loyalty.CoffeeBux) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.completed = append(p.completed, pur)
+	return nil
+}
+
+type noCards struct{}
+
+func (noCards) Get(context.Context, uuid.UUID) (*loyalty.CoffeeBux, error) {
+	return nil, errors.New("no loyalty cards here")
+}
+
+func (noCards) Save(context.Context, *loyalty.CoffeeBux) error {
+	return nil
+}
+
+func latte(customerID uuid.UUID) *purchase.Purchase {
+	return &purchase.Purchase{
+		Store:              store.Ref(uuid.New()),
+		CustomerID:         customerID,
+		ProductsToPurchase: []coffeeco.Product{{ItemName: "latte", BasePrice: *money.New(450, "USD"), Size: "large"}},
+		PaymentMeans:       payment.MEANS_CASH,
+	}
+}
+
+func Test_SubmittedPurchasesAreCompletedOnceByAWorker(t *testing.T) {
+	ctx := context.Background()
+	var published capture
+	done := &purchases{}
+	svc := submission.NewService(submission.NewMemoryRepo(), &published, done, noCards{})
+
+	alice := uuid.New()
+	s, err := svc.Submit(ctx, latte(alice), uuid.Nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if s.Status() != submission.StatusQueued {
+		t.Fatalf("expected the submission to be queued but got %s", s.Status())
+	}
+	cmds := published.commands(t)
+	if len(cmds) != 1 {
+		t.Fatalf("expected one purchase requested but got %d", len(cmds))
+	}
+
+	// A redelivered command does not complete the purchase again.
+	for range 2 {
+		if err := svc.Handle(ctx, cmds[0]); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if len(done.completed) != 1 {
+		t.Fatalf("expected the purchase to be completed once but it was completed %d times", len(done.completed))
+	}
+	p := done.completed[0]
+	if p.CustomerID != alice || len(p.ProductsToPurchase) != 1 || p.ProductsToPurchase[0].Size != "large" || p.ProductsToPurchase[0].BasePrice.Amount() != 450 {
+		t.Fatalf("expected the purchase as it was submitted but got %+v", p)
+	}
+	s, err = svc.Get(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if s.Status() != submission.StatusCompleted {
+		t.Fatalf("expected the submission to be completed but got %s", s.Status())
+	}
+
+	var statuses []submission.Status
+	for _, e := range published {
+		if u, ok := e.(submission.Updated); ok {
+			statuses = append(statuses, u.Status)
+		}
+	}
+	if len(statuses) != 2 || statuses[0] != submission.StatusProcessing || statuses[1] != submission.StatusCompleted {
+		t.Fatalf("expected the submission to be followed through processing to completed but got %v", statuses)
+	}
+}
+
+func Test_FailedPurchasesAreDescribedAsTheAPIWould(t *testing.T) {
+	ctx := context.Background()
+	var published capture
+	declined := errors.New("card declined")
+	svc := submission.NewService(submission.NewMemoryRepo(), &published, &purchases{err: declined}, noCards{},
+		submission.WithDescribe(func(err error) (string, string) {
+			if errors.Is(err, declined) {
+				return "card_charge_failed", "the card was declined"
+			}
+			return "internal", "something went wrong"
+		}))
+
+	s, err := svc.Submit(ctx, latte(uuid.Nil), uuid.Nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Handle(ctx, published.commands(t)[0]); err != nil {
+		t.Fatalf("expected the failure to be recorded rather than returned but got %v", err)
+	}
+	s, _ = svc.Get(ctx, s.ID)
+	if code, _ := s.Failure(); s.Status() != submission.StatusFailed || code != "card_charge_failed" {
+		t.Fatalf("expected the submission to fail with card_charge_failed but got %s %q", s.Status(), code)
+	}
+}
+
+// crashing is a repository a worker stops saving to once it has started a submission, as when it crashes
+// halfway through a purchase.
+type crashing struct {
+	submission.Repository
+}
+
+func (c crashing) Save(ctx context.Context, s *submission.Submission) error {
+	if s.Status() != submission.StatusProcessing {
+		return errors.New("worker crashed")
+	}
+	return c.Repository.Save(ctx, s)
+}
+
+func Test_InterruptedSubmissionsFailRatherThanChargeTwice(t *testing.T) {
+	ctx := context.Background()
+	var published capture
+	repo := submission.NewMemoryRepo()
+	done := &purchases{}
+	svc := submission.NewService(repo, &published, done, noCards{})
+
+	s, err := svc.Submit(ctx, latte(uuid.Nil), uuid.Nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	cmd := published.commands(t)[0]
+	crashed := submission.NewService(crashing{repo}, &published, done, noCards{})
+	if err := crashed.Handle(ctx, cmd); err == nil {
+		t.Fatalf("expected the crashed worker to leave the command unhandled")
+	}
+
+	// The command is redelivered to another worker, which cannot tell whether the customer was charged.
+	if err := svc.Handle(ctx, cmd); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(done.completed) != 1 {
+		t.Fatalf("expected the interrupted purchase not to be completed again but it was completed %d times", len(done.completed))
+	}
+	s, _ = svc.Get(ctx, s.ID)
+	if code, _ := s.Failure(); s.Status() != submission.StatusFailed || code != "interrupted" {
+		t.Fatalf("expected the submission to fail as interrupted but got %s %q", s.Status(), code)
+	}
+}
+
+func Test_SubmittedPurchasesAreCompletedOnTheDeviceTheyWereRungUpOn(t *testing.T) {
+	ctx := context.Background()
+	soho := uuid.New()
+	devices := device.NewService(device.NewMemoryRepo())
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	till, err := devices.Register(ctx, device.Registration{StoreID: soho, Name: "front till", PublicKey: pub, Firmware: "4.2.0"})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var published capture
+	purchases := purchase.NewService(testsupport.NewFakeCards(), testsupport.NewFakePurchases(), testsupport.FakeDiscounts{}, purchase.WithDevices(devices))
+	svc := submission.NewService(submission.NewMemoryRepo(), &published, purchases, noCards{})
+
+	p := latte(uuid.Nil)
+	p.Store, p.DeviceID = store.Ref(soho), till.ID
+	// Without prices for sizes, a large latte would not be priced.
+	p.ProductsToPurchase[0].Size = ""
+	s, err := svc.Submit(ctx, p, uuid.Nil)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Handle(ctx, published.commands(t)[0]); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	s, _ = svc.Get(ctx, s.ID)
+	if code, message := s.Failure(); s.Status() != submission.StatusCompleted {
+		t.Fatalf("expected the purchase rung up on the front till to be completed but got %s %q: %s", s.Status(), code, message)
+	}
+}
+
+func Test_WorkersCompleteThePurchaseWithEverythingTheCustomerAskedFor(t *testing.T) {
+	ctx := context.Background()
+	var published capture
+	done := &purchases{}
+	svc := submission.NewService(submission.NewMemoryRepo(), &published, done, noCards{})
+
+	p := latte(uuid.New())
+	p.QuoteToken = "qt_latte"
+	p.Channel = purchase.ChannelApp
+	p.PickupAt = time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	p.Substitutes = map[string]string{"croissant": "pain au chocolat"}
+	p.TabID = uuid.New()
+	p.ConfirmDuplicate = true
+	p.Overrides = []purchase.PriceOverride{{Product: 0, Price: *money.New(0, "USD"), Reason: purchase.OverrideRemake, Note: "spilled"}}
+	p.Charges = []purchase.Charge{{Type: purchase.ChargeCourierTip, Payee: purchase.PayeeCourier, Amount: *money.New(100, "USD")}}
+	if _, err := svc.Submit(ctx, p, uuid.Nil); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Handle(ctx, published.commands(t)[0]); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	got := done.completed[0]
+	if got.QuoteToken != "qt_latte" {
+		t.Fatalf("expected the purchase to be charged as quoted but got quote %q", got.QuoteToken)
+	}
+	if len(got.Charges) != 1 || got.Charges[0].Type != purchase.ChargeCourierTip || got.Charges[0].Amount.Amount() != 100 {
+		t.Fatalf("expected the courier's tip to be charged but got %+v", got.Charges)
+	}
+	if got.Channel != purchase.ChannelApp {
+		t.Fatalf("expected the purchase to be ordered in the app but got %q", got.Channel)
+	}
+	if len(got.Overrides) != 1 || got.Overrides[0].Reason != purchase.OverrideRemake || !got.Overrides[0].Price.IsZero() || got.Overrides[0].Note != "spilled" {
+		t.Fatalf("expected the remade latte to be free but got %+v", got.Overrides)
+	}
+	if !got.PickupAt.Equal(p.PickupAt) {
+		t.Fatalf("expected the purchase to be picked up at %s but got %s", p.PickupAt, got.PickupAt)
+	}
+	if got.Substitutes["croissant"] != "pain au chocolat" {
+		t.Fatalf("expected the pain au chocolat accepted for a croissant but got %v", got.Substitutes)
+	}
+	if got.TabID != p.TabID {
+		t.Fatalf("expected the purchase to settle tab %s but got %s", p.TabID, got.TabID)
+	}
+	if !got.ConfirmDuplicate {
+		t.Fatal("expected the customer's confirmation to buy the same again to be kept")
+	}
+}
@@ -0,0 +1,202 @@
+package subscription
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+)
+
+var (
+	ErrNotFound            = errors.New("no such pass")
+	ErrUnknownPlan         = errors.New("unknown plan")
+	ErrAlreadySubscribed   = errors.New("customer already has a pass")
+	ErrNotActive           = errors.New("pass is not active")
+	ErrNoCard              = errors.New("a pass is paid for by card")
+	ErrConcurrencyConflict = errors.New("pass changed since it was read")
+)
+
+// Plan is a kind of pass customers can buy, e.g. one drink a day for $30 a month.
+type Plan struct {
+	Name string `json:"name" bson:"name"`
+	// Price is charged every month, in the currency's minor unit.
+	Price        int64  `json:"price" bson:"price"`
+	Currency     string `json:"currency" bson:"currency"`
+	DrinksPerDay int    `json:"drinks_per_day" bson:"drinks_per_day"`
+	// Products the pass pays for, by name. An empty list covers every product.
+	Products []string `json:"products" bson:"products"`
+}
+
+func (p Plan) MonthlyPrice() *money.Money {
+	return money.New(p.Price, p.Currency)
+}
+
+func (p Plan) covers(product string) bool {
+	return len(p.Products) == 0 || slices.Contains(p.Products, product)
+}
+
+// Status is whether a pass covers drinks.
+type Status string
+
+const (
+	StatusActive Status = "active"
+	// StatusPastDue passes could not be renewed; they cover nothing until a renewal goes through.
+	StatusPastDue   Status = "past_due"
+	StatusCancelled Status = "cancelled"
+)
+
+// use is what a pass paid for in one purchase.
+type use struct {
+	day      string
+	products []int
+}
+
+// Pass is a customer's subscription to a plan. It is paid a month at a time, up front, and pays for up to
+// the plan's drinks a day while the month lasts. Days are counted in UTC.
+type Pass struct {
+	ID         uuid.UUID
+	CustomerID uuid.UUID
+	PlanID     string
+	// Plan is the plan as it was subscribed to; later price changes do not apply to existing passes.
+	Plan      Plan
+	CardToken string
+
+	version     int
+	status      Status
+	periodStart time.Time
+	periodEnd   time.Time
+	chargeID    string
+	uses        map[uuid.UUID]use
+}
+
+// NewPass starts a pass whose first month was paid with chargeID.
+func NewPass(customerID uuid.UUID, planID string, plan Plan, cardToken, chargeID string, start time.Time) *Pass {
+	start = start.UTC()
+	return &Pass{
+		ID:          uuid.New(),
+		CustomerID:  customerID,
+		PlanID:      planID,
+		Plan:        plan,
+		CardToken:   cardToken,
+		status:      StatusActive,
+		periodStart: start,
+		periodEnd:   start.AddDate(0, 1, 0),
+		chargeID:    chargeID,
+		uses:        map[uuid.UUID]use{},
+	}
+}
+
+func (p *Pass) Status() Status {
+	return p.status
+}
+
+// Period is the month paid for last.
+func (p *Pass) Period() (start, end time.Time) {
+	return p.periodStart, p.periodEnd
+}
+
+// DrinksLeft is how many drinks the pass still pays for on the day of at.
+func (p *Pass) DrinksLeft(at time.Time) int {
+	if !p.covering(at) {
+		return 0
+	}
+	day := at.UTC().Format(time.DateOnly)
+	left := p.Plan.DrinksPerDay
+	for _, u := range p.uses {
+		if u.day == day {
+			left -= len(u.products)
+		}
+	}
+	return max(left, 0)
+}
+
+// Cover returns the products of a purchase the pass pays for, by index, as many as are left for the day.
+// Covering the same purchase again returns what it covered the first time.
+func (p *Pass) Cover(purchaseID uuid.UUID, products []coffeeco.Product, at time.Time) []int {
+	if u, ok := p.uses[purchaseID]; ok {
+		return u.products
+	}
+	left := p.DrinksLeft(at)
+	var covered []int
+	for i, product := range products {
+		if len(covered) == left {
+			break
+		}
+		if p.Plan.covers(product.ItemName) {
+			covered = append(covered, i)
+		}
+	}
+	if len(covered) == 0 {
+		return nil
+	}
+	day := at.UTC().Format(time.DateOnly)
+	// Only today's uses count towards the limit, and only recent ones can still be uncovered.
+	for id, u := range p.uses {
+		if u.day < day {
+			delete(p.uses, id)
+		}
+	}
+	p.uses[purchaseID] = use{day: day, products: covered}
+	return covered
+}
+
+// Uncover gives the drinks of a purchase that failed back to the pass.
+func (p *Pass) Uncover(purchaseID uuid.UUID) bool {
+	if _, ok := p.uses[purchaseID]; !ok {
+		return false
+	}
+	delete(p.uses, purchaseID)
+	return true
+}
+
+// Due says whether the month paid for is over and the pass should be renewed.
+func (p *Pass) Due(at time.Time) bool {
+	return p.status != StatusCancelled && !at.Before(p.periodEnd)
+}
+
+// Renew starts the next month, paid with chargeID. A pass that was past due starts again from at, so the
+// customer does not pay for the days it covered nothing.
+func (p *Pass) Renew(chargeID string, at time.Time) {
+	start := p.periodEnd
+	if p.status == StatusPastDue {
+		start = at.UTC()
+	}
+	p.periodStart, p.periodEnd = start, start.AddDate(0, 1, 0)
+	p.chargeID = chargeID
+	p.status = StatusActive
+}
+
+// RenewalFailed stops the pass from covering drinks until it is renewed.
+func (p *Pass) RenewalFailed() {
+	p.status = StatusPastDue
+}
+
+// Cancel ends the pass at at and returns what to refund of the month paid for: the share of the month that
+// is left, rounded down to the minor unit, and the charge to refund it from. A pass that is past due has
+// nothing to refund.
+func (p *Pass) Cancel(at time.Time) (refund *money.Money, chargeID string, err error) {
+	if p.status == StatusCancelled {
+		return nil, "", ErrNotActive
+	}
+	refund = money.New(0, p.Plan.Currency)
+	if p.status == StatusActive && at.Before(p.periodEnd) {
+		from := at
+		if from.Before(p.periodStart) {
+			from = p.periodStart
+		}
+		left := p.periodEnd.Sub(from)
+		month := p.periodEnd.Sub(p.periodStart)
+		refund = money.New(int64(float64(p.Plan.Price)*left.Seconds()/month.Seconds()), p.Plan.Currency)
+	}
+	p.status = StatusCancelled
+	p.periodEnd = at.UTC()
+	return refund, p.chargeID, nil
+}
+
+func (p *Pass) covering(at time.Time) bool {
+	return p.status == StatusActive && !at.Before(p.periodStart) && at.Before(p.periodEnd)
+}
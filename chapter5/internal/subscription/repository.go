@@ -0,0 +1,258 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such pass.
+	Get(ctx context.Context, id uuid.UUID) (*Pass, error)
+	// Current returns the pass of a customer that is not cancelled, or ErrNotFound.
+	Current(ctx context.Context, customerID uuid.UUID) (*Pass, error)
+	// Due returns the passes whose month paid for ended by at.
+	Due(ctx context.Context, at time.Time) ([]*Pass, error)
+	// Save returns ErrConcurrencyConflict if the pass was saved by someone else since it was read.
+	Save(ctx context.Context, p *Pass) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps passes versioned, as a customer may buy drinks at two tills at once.
+type MongoRepository struct {
+	client *mongo.Client
+	passes *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	passes := client.Database("coffeeco").Collection("passes")
+	_, err = passes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "customer_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "period_end", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pass indexes: %w", err)
+	}
+	return &MongoRepository{client: client, passes: passes}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoPass struct {
+	ID          string     `bson:"_id"`
+	Version     int        `bson:"version"`
+	CustomerID  string     `bson:"customer_id"`
+	PlanID      string     `bson:"plan_id"`
+	Plan        Plan       `bson:"plan"`
+	CardToken   string     `bson:"card_token"`
+	Status      string     `bson:"status"`
+	PeriodStart time.Time  `bson:"period_start"`
+	PeriodEnd   time.Time  `bson:"period_end"`
+	ChargeID    string     `bson:"charge_id"`
+	Uses        []mongoUse `bson:"uses"`
+}
+
+type mongoUse struct {
+	PurchaseID string `bson:"purchase_id"`
+	Day        string `bson:"day"`
+	Products   []int  `bson:"products"`
+}
+
+func toMongoPass(p *Pass) mongoPass {
+	doc := mongoPass{
+		ID:          p.ID.String(),
+		Version:     p.version,
+		CustomerID:  p.CustomerID.String(),
+		PlanID:      p.PlanID,
+		Plan:        p.Plan,
+		CardToken:   p.CardToken,
+		Status:      string(p.status),
+		PeriodStart: p.periodStart,
+		PeriodEnd:   p.periodEnd,
+		ChargeID:    p.chargeID,
+	}
+	for id, u := range p.uses {
+		doc.Uses = append(doc.Uses, mongoUse{PurchaseID: id.String(), Day: u.day, Products: slices.Clone(u.products)})
+	}
+	return doc
+}
+
+func (m mongoPass) toPass() *Pass {
+	id, _ := uuid.Parse(m.ID)
+	customerID, _ := uuid.Parse(m.CustomerID)
+	p := &Pass{
+		ID:          id,
+		CustomerID:  customerID,
+		PlanID:      m.PlanID,
+		Plan:        m.Plan,
+		CardToken:   m.CardToken,
+		version:     m.Version,
+		status:      Status(m.Status),
+		periodStart: m.PeriodStart,
+		periodEnd:   m.PeriodEnd,
+		chargeID:    m.ChargeID,
+		uses:        map[uuid.UUID]use{},
+	}
+	for _, u := range m.Uses {
+		purchaseID, _ := uuid.Parse(u.PurchaseID)
+		p.uses[purchaseID] = use{day: u.Day, products: u.Products}
+	}
+	return p
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Pass, err error) {
+	ctx, span := telemetry.StartClient(ctx, "subscription.MongoRepository.Get", attribute.String("pass.id", id.String()))
+	defer telemetry.End(span, &err)
+	return m.findOne(ctx, bson.D{{Key: "_id", Value: id.String()}})
+}
+
+func (m *MongoRepository) Current(ctx context.Context, customerID uuid.UUID) (_ *Pass, err error) {
+	ctx, span := telemetry.StartClient(ctx, "subscription.MongoRepository.Current", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	return m.findOne(ctx, bson.D{
+		{Key: "customer_id", Value: customerID.String()},
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: string(StatusCancelled)}}},
+	})
+}
+
+func (m *MongoRepository) findOne(ctx context.Context, filter bson.D) (*Pass, error) {
+	var doc mongoPass
+	if err := m.passes.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find pass: %w", err)
+	}
+	return doc.toPass(), nil
+}
+
+func (m *MongoRepository) Due(ctx context.Context, at time.Time) (_ []*Pass, err error) {
+	ctx, span := telemetry.StartClient(ctx, "subscription.MongoRepository.Due")
+	defer telemetry.End(span, &err)
+	cur, err := m.passes.Find(ctx, bson.D{
+		{Key: "status", Value: bson.D{{Key: "$ne", Value: string(StatusCancelled)}}},
+		{Key: "period_end", Value: bson.D{{Key: "$lte", Value: at}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find passes due: %w", err)
+	}
+	var docs []mongoPass
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode passes: %w", err)
+	}
+	passes := make([]*Pass, 0, len(docs))
+	for _, doc := range docs {
+		passes = append(passes, doc.toPass())
+	}
+	return passes, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, p *Pass) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "subscription.MongoRepository.Save", attribute.String("pass.id", p.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoPass(p)
+	doc.Version = p.version + 1
+	if p.version == 0 {
+		if _, err := m.passes.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save pass: %w", err)
+		}
+	} else {
+		res, err := m.passes.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: p.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save pass: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	p.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.passes.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps passes in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu     sync.Mutex
+	passes map[uuid.UUID]mongoPass
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{passes: map[uuid.UUID]mongoPass{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Pass, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.passes[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toPass(), nil
+}
+
+func (m *MemoryRepository) Current(_ context.Context, customerID uuid.UUID) (*Pass, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, doc := range m.passes {
+		if doc.CustomerID == customerID.String() && doc.Status != string(StatusCancelled) {
+			return doc.toPass(), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MemoryRepository) Due(_ context.Context, at time.Time) ([]*Pass, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var passes []*Pass
+	for _, doc := range m.passes {
+		if doc.Status != string(StatusCancelled) && !doc.PeriodEnd.After(at) {
+			passes = append(passes, doc.toPass())
+		}
+	}
+	return passes, nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, p *Pass) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.passes[p.ID].Version != p.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoPass(p)
+	doc.Version = p.version + 1
+	m.passes[p.ID] = doc
+	p.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package subscription
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+)
+
+// saveAttempts bounds how often a change is retried when other purchases keep saving the pass first.
+const saveAttempts = 3
+
+// CardGateway charges passes every month and refunds what is left of one when it is cancelled, e.g.
+// payment.StripeService. Passes need a card token that can be charged again, such as a saved card.
+type CardGateway interface {
+	Charge(ctx context.Context, amount money.Money, cardToken string) (chargeID string, err error)
+	RefundAmount(ctx context.Context, chargeID string, amount money.Money) error
+}
+
+type Service struct {
+	repo    Repository
+	gateway CardGateway
+	plans   map[string]Plan
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+type Option func(s *Service)
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test renewals and proration.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// NewService sells the plans, by plan ID.
+func NewService(repo Repository, gateway CardGateway, plans map[string]Plan, opts ...Option) *Service {
+	s := &Service{repo: repo, gateway: gateway, plans: plans, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Subscribe charges the first month of a plan to the customer's card and starts their pass.
+func (s *Service) Subscribe(ctx context.Context, customerID uuid.UUID, planID, cardToken string) (*Pass, error) {
+	plan, ok := s.plans[planID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPlan, planID)
+	}
+	if cardToken == "" {
+		return nil, ErrNoCard
+	}
+	if _, err := s.repo.Current(ctx, customerID); err == nil {
+		return nil, ErrAlreadySubscribed
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	chargeID, err := s.gateway.Charge(ctx, *plan.MonthlyPrice(), cardToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to charge the first month: %w", err)
+	}
+	p := NewPass(customerID, planID, plan, cardToken, chargeID, s.now())
+	if err := s.repo.Save(ctx, p); err != nil {
+		if rerr := s.gateway.RefundAmount(context.WithoutCancel(ctx), chargeID, *plan.MonthlyPrice()); rerr != nil {
+			s.logger.ErrorContext(ctx, "pass not saved and its first month not refunded", "customer", customerID, "charge", chargeID, "error", rerr)
+		}
+		return nil, fmt.Errorf("failed to save pass: %w", err)
+	}
+	return p, nil
+}
+
+// Current returns the customer's pass, ErrNotFound if they have none or cancelled it.
+func (s *Service) Current(ctx context.Context, customerID uuid.UUID) (*Pass, error) {
+	return s.repo.Current(ctx, customerID)
+}
+
+// Cancel ends a pass now and refunds the days left of the month paid for, which it returns. The pass
+// stays cancelled if the refund fails; the error then says what is owed.
+func (s *Service) Cancel(ctx context.Context, id uuid.UUID) (*money.Money, error) {
+	var refund *money.Money
+	var chargeID string
+	err := s.update(ctx, func() (*Pass, error) { return s.repo.Get(ctx, id) }, func(p *Pass) (bool, error) {
+		var err error
+		refund, chargeID, err = p.Cancel(s.now())
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refund.IsPositive() {
+		if err := s.gateway.RefundAmount(ctx, chargeID, *refund); err != nil {
+			return refund, fmt.Errorf("pass cancelled but %s was not refunded from %s: %w", refund.Display(), chargeID, err)
+		}
+	}
+	return refund, nil
+}
+
+// RenewalReport is what RenewDue did.
+type RenewalReport struct {
+	Renewed int
+	// Failed passes are past due; they are tried again on the next run until they are renewed or cancelled.
+	Failed int
+}
+
+// RenewDue charges the next month of every pass whose month is over. It is meant to run regularly, e.g.
+// hourly; a pass is only charged once per month however often it runs.
+func (s *Service) RenewDue(ctx context.Context) (RenewalReport, error) {
+	var report RenewalReport
+	due, err := s.repo.Due(ctx, s.now())
+	if err != nil {
+		return report, err
+	}
+	var errs []error
+	for _, p := range due {
+		chargeID, err := s.gateway.Charge(ctx, *p.Plan.MonthlyPrice(), p.CardToken)
+		if err != nil {
+			s.logger.WarnContext(ctx, "pass renewal declined", "pass", p.ID, "error", err)
+			report.Failed++
+			if p.Status() == StatusPastDue {
+				continue
+			}
+			p.RenewalFailed()
+		} else {
+			report.Renewed++
+			p.Renew(chargeID, s.now())
+		}
+		if err := s.repo.Save(ctx, p); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save pass %s after renewing it: %w", p.ID, err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// Cover pays for as many of products as the customer's pass has drinks left for today, and returns them by
+// index. Customers without a pass get nothing covered. It is safe to call again for the same purchase.
+func (s *Service) Cover(ctx context.Context, customerID, purchaseID uuid.UUID, products []coffeeco.Product) ([]int, error) {
+	var covered []int
+	err := s.update(ctx, func() (*Pass, error) { return s.repo.Current(ctx, customerID) }, func(p *Pass) (bool, error) {
+		covered = p.Cover(purchaseID, products, s.now())
+		return len(covered) > 0, nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return covered, err
+}
+
+// Preview returns the products Cover would pay for now, without using up any of the pass.
+func (s *Service) Preview(ctx context.Context, customerID uuid.UUID, products []coffeeco.Product) ([]int, error) {
+	p, err := s.repo.Current(ctx, customerID)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The pass is not saved, so covering a purchase that will never be made uses up nothing.
+	return p.Cover(uuid.New(), products, s.now()), nil
+}
+
+// Uncover gives the drinks covered for a purchase that failed back to the pass.
+func (s *Service) Uncover(ctx context.Context, customerID, purchaseID uuid.UUID) error {
+	err := s.update(ctx, func() (*Pass, error) { return s.repo.Current(ctx, customerID) }, func(p *Pass) (bool, error) {
+		return p.Uncover(purchaseID), nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// update applies fn to the latest pass and saves it if fn changed it, starting over if someone else saved
+// in between.
+func (s *Service) update(ctx context.Context, get func() (*Pass, error), fn func(p *Pass) (bool, error)) error {
+	for range saveAttempts {
+		p, err := get()
+		if err != nil {
+			return err
+		}
+		changed, err := fn(p)
+		if err != nil || !changed {
+			return err
+		}
+		err = s.repo.Save(ctx, p)
+		if !errors.Is(err, ErrConcurrencyConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to update pass after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
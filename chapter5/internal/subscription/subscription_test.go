@@ -0,0 +1,140 @@
+package subscription_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/subscription"
+)
+
+var plans = map[string]subscription.Plan{
+	"daily": {Name: "Coffee pass", Price: 3000, Currency: "USD", DrinksPerDay: 1, Products: []string{"latte", "espresso"}},
+}
+
+// gateway records charges and refunds, and declines every charge once declining is set.
+type gateway struct {
+	charged   []int64
+	refunded  []int64
+	declining bool
+}
+
+func (g *gateway) Charge(_ context.Context, amount money.Money, _ string) (string, error) {
+	if g.declining {
+		return "", errors.New("card declined")
+	}
+	g.charged = append(g.charged, amount.Amount())
+	return "ch_" + uuid.NewString(), nil
+}
+
+func (g *gateway) RefundAmount(_ context.Context, _ string, amount money.Money) error {
+	g.refunded = append(g.refunded, amount.Amount())
+	return nil
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func drinks(names ...string) []coffeeco.Product {
+	var products []coffeeco.Product
+	for _, name := range names {
+		products = append(products, coffeeco.Product{ItemName: name, BasePrice: *money.New(400, "USD")})
+	}
+	return products
+}
+
+func Test_APassCoversItsDrinksOfTheDay(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+	svc := subscription.NewService(subscription.NewMemoryRepo(), &gateway{}, plans, subscription.WithClock(c.Now))
+	customerID := uuid.New()
+	if _, err := svc.Subscribe(ctx, customerID, "daily", "card_1"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	first, second := uuid.New(), uuid.New()
+	covered, err := svc.Cover(ctx, customerID, first, drinks("croissant", "latte", "espresso"))
+	if err != nil || len(covered) != 1 || covered[0] != 1 {
+		t.Fatalf("expected the latte to be covered but got %v, %v", covered, err)
+	}
+	if covered, _ := svc.Cover(ctx, customerID, second, drinks("latte")); len(covered) != 0 {
+		t.Fatalf("expected the day's drink to be used up but got %v", covered)
+	}
+	// The first purchase failed, so its latte is back for the second.
+	if err := svc.Uncover(ctx, customerID, first); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if covered, _ := svc.Cover(ctx, customerID, second, drinks("latte")); len(covered) != 1 {
+		t.Fatalf("expected the given back drink to be covered but got %v", covered)
+	}
+
+	c.now = c.now.Add(24 * time.Hour)
+	if covered, _ := svc.Cover(ctx, customerID, uuid.New(), drinks("latte")); len(covered) != 1 {
+		t.Fatalf("expected a new drink the next day but got %v", covered)
+	}
+}
+
+func Test_CancellingRefundsTheRestOfTheMonth(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)}
+	g := &gateway{}
+	svc := subscription.NewService(subscription.NewMemoryRepo(), g, plans, subscription.WithClock(c.Now))
+	customerID := uuid.New()
+	p, _ := svc.Subscribe(ctx, customerID, "daily", "card_1")
+	if _, err := svc.Subscribe(ctx, customerID, "daily", "card_1"); !errors.Is(err, subscription.ErrAlreadySubscribed) {
+		t.Fatalf("expected ErrAlreadySubscribed but got %v", err)
+	}
+
+	// 20 of April's 30 days are left.
+	c.now = c.now.AddDate(0, 0, 10)
+	refund, err := svc.Cancel(ctx, p.ID)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if refund.Amount() != 2000 || len(g.refunded) != 1 || g.refunded[0] != 2000 {
+		t.Fatalf("expected $20.00 back but got %s and refunds %v", refund.Display(), g.refunded)
+	}
+	if covered, _ := svc.Cover(ctx, customerID, uuid.New(), drinks("latte")); len(covered) != 0 {
+		t.Fatalf("expected a cancelled pass to cover nothing but got %v", covered)
+	}
+	if _, err := svc.Cancel(ctx, p.ID); !errors.Is(err, subscription.ErrNotActive) {
+		t.Fatalf("expected ErrNotActive but got %v", err)
+	}
+}
+
+func Test_RenewalsChargeOncePerMonth(t *testing.T) {
+	ctx := context.Background()
+	c := &clock{now: time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)}
+	g := &gateway{}
+	svc := subscription.NewService(subscription.NewMemoryRepo(), g, plans, subscription.WithClock(c.Now))
+	customerID := uuid.New()
+	_, _ = svc.Subscribe(ctx, customerID, "daily", "card_1")
+
+	c.now = c.now.AddDate(0, 1, 1)
+	g.declining = true
+	if report, err := svc.RenewDue(ctx); err != nil || report.Failed != 1 {
+		t.Fatalf("expected one declined renewal but got %+v, %v", report, err)
+	}
+	if covered, _ := svc.Cover(ctx, customerID, uuid.New(), drinks("latte")); len(covered) != 0 {
+		t.Fatalf("expected a past due pass to cover nothing but got %v", covered)
+	}
+
+	g.declining = false
+	for range 2 {
+		if _, err := svc.RenewDue(ctx); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if len(g.charged) != 2 {
+		t.Fatalf("expected the first month and one renewal to be charged but got %v", g.charged)
+	}
+	if covered, _ := svc.Cover(ctx, customerID, uuid.New(), drinks("latte")); len(covered) != 1 {
+		t.Fatalf("expected the renewed pass to cover the latte but got %v", covered)
+	}
+}
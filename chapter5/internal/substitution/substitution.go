@@ -0,0 +1,143 @@
+package substitution
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+)
+
+// DefaultTolerance is how far, in percent of the product's price, a substitute's price may be from it.
+const DefaultTolerance = 25
+
+// DefaultMax is how many substitutes are suggested for a product at most.
+const DefaultMax = 3
+
+// Menu is the price book of the stores, e.g. *pricing.Engine.
+type Menu interface {
+	Products(storeID uuid.UUID) []string
+	Category(product string) string
+	Quote(ctx context.Context, r pricing.Request) (pricing.Quote, error)
+}
+
+// Stock tells which products a store can make right now, e.g. inventory.Service.
+type Stock interface {
+	InStock(ctx context.Context, storeID uuid.UUID, products []string) (map[string]bool, error)
+}
+
+// Service suggests what a store can make instead of the products it ran out of: products of the same
+// category whose price is close to theirs.
+type Service struct {
+	menu      Menu
+	stock     Stock
+	tolerance float64
+	max       int
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithTolerance replaces DefaultTolerance.
+func WithTolerance(percent float64) Option {
+	return func(s *Service) {
+		s.tolerance = percent
+	}
+}
+
+// WithMax replaces DefaultMax.
+func WithMax(n int) Option {
+	return func(s *Service) {
+		s.max = n
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test suggestions during a happy hour.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(menu Menu, stock Stock, opts ...Option) *Service {
+	s := &Service{menu: menu, stock: stock, tolerance: DefaultTolerance, max: DefaultMax, now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Suggest is what the store can make instead of those of products it cannot make one of right now, closest
+// in price first, and by name for the same price. Products the store can make, or that are not on its menu
+// or in a category, get no suggestions; neither do products short only because of how many were asked for.
+func (s *Service) Suggest(ctx context.Context, storeID uuid.UUID, products []string) ([]purchase.Substitution, error) {
+	menu := s.menu.Products(storeID)
+	if len(menu) == 0 {
+		return nil, nil
+	}
+	inStock, err := s.stock.InStock(ctx, storeID, menu)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the stock of the menu: %w", err)
+	}
+	prices, err := s.prices(ctx, storeID, menu)
+	if err != nil {
+		return nil, err
+	}
+	var res []purchase.Substitution
+	for _, product := range slices.Compact(slices.Sorted(slices.Values(products))) {
+		category := s.menu.Category(product)
+		price, priced := prices[product]
+		if !priced || inStock[product] || category == "" {
+			continue
+		}
+		var candidates []purchase.Substitution
+		for _, other := range menu {
+			p, ok := prices[other]
+			if other == product || !inStock[other] || !ok || s.menu.Category(other) != category {
+				continue
+			}
+			if float64(distance(p.Amount(), price.Amount()))*100 > s.tolerance*float64(price.Amount()) {
+				continue
+			}
+			candidates = append(candidates, purchase.Substitution{Product: product, Substitute: other, UnitPrice: p})
+		}
+		slices.SortStableFunc(candidates, func(a, b purchase.Substitution) int {
+			return cmp.Compare(distance(a.UnitPrice.Amount(), price.Amount()), distance(b.UnitPrice.Amount(), price.Amount()))
+		})
+		res = append(res, candidates[:min(len(candidates), s.max)]...)
+	}
+	return res, nil
+}
+
+// prices are the unit prices of products at the store now, by product. Products given away are left out,
+// as nothing is close to their price.
+func (s *Service) prices(ctx context.Context, storeID uuid.UUID, products []string) (map[string]money.Money, error) {
+	req := pricing.Request{StoreID: storeID, At: s.now()}
+	for _, p := range products {
+		req.Items = append(req.Items, pricing.Item{Product: p})
+	}
+	q, err := s.menu.Quote(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to price the menu: %w", err)
+	}
+	res := make(map[string]money.Money, len(products))
+	for i, p := range products {
+		if unit := q.Lines[i].Unit; unit.Amount() > 0 {
+			res[p] = unit
+		}
+	}
+	return res, nil
+}
+
+func distance(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,67 @@
+package substitution_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/substitution"
+)
+
+type shelf map[string]bool
+
+func (s shelf) InStock(_ context.Context, _ uuid.UUID, products []string) (map[string]bool, error) {
+	res := make(map[string]bool, len(products))
+	for _, p := range products {
+		res[p] = s[p]
+	}
+	return res, nil
+}
+
+func menu() *pricing.Engine {
+	return pricing.NewEngine(pricing.Rules{
+		Currency: "USD",
+		BasePrices: map[string]int64{
+			"latte": 400, "flat white": 420, "cappuccino": 380, "mocha": 600, "tea": 400, "croissant": 300,
+		},
+		Categories: map[string]string{
+			"latte": "milk coffee", "flat white": "milk coffee", "cappuccino": "milk coffee", "mocha": "milk coffee",
+		},
+	})
+}
+
+func Test_SuggestsProductsOfTheSameCategoryAndSimilarPriceClosestFirst(t *testing.T) {
+	out := shelf{"flat white": true, "cappuccino": true, "mocha": true, "tea": true, "croissant": true}
+	svc := substitution.NewService(menu(), out)
+
+	got, err := svc.Suggest(context.Background(), uuid.New(), []string{"latte", "croissant", "latte"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"cappuccino", "flat white"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v but got %+v", want, got)
+	}
+	for i, s := range got {
+		if s.Product != "latte" || s.Substitute != want[i] {
+			t.Fatalf("expected %v but got %+v", want, got)
+		}
+	}
+	if got[0].UnitPrice.Amount() != 380 {
+		t.Fatalf("expected the cappuccino at 380 but got %d", got[0].UnitPrice.Amount())
+	}
+}
+
+func Test_SuggestsNothingWithoutACategoryOrAnythingInStock(t *testing.T) {
+	svc := substitution.NewService(menu(), shelf{"tea": true}, substitution.WithTolerance(100), substitution.WithMax(1))
+
+	got, err := svc.Suggest(context.Background(), uuid.New(), []string{"latte", "croissant"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no suggestions but got %+v", got)
+	}
+}
@@ -0,0 +1,270 @@
+package tab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such tab.
+	Get(ctx context.Context, id uuid.UUID) (*Tab, error)
+	// Save returns ErrConcurrencyConflict if the tab was saved by someone else since it was read, or if a
+	// new tab is a second open tab of the same table.
+	Save(ctx context.Context, t *Tab) error
+	// Open returns the open tabs of a store, oldest first.
+	Open(ctx context.Context, storeID uuid.UUID) ([]*Tab, error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps tabs versioned, so lines added while a guest pays are not lost.
+type MongoRepository struct {
+	client *mongo.Client
+	tabs   *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	tabs := client.Database("coffeeco").Collection("tabs")
+	_, err = tabs.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "status", Value: 1}, {Key: "opened_at", Value: 1}}},
+		// One open tab per table.
+		{
+			Keys:    bson.D{{Key: "store_id", Value: 1}, {Key: "table", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{Key: "status", Value: string(StatusOpen)}}),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tab indexes: %w", err)
+	}
+	return &MongoRepository{client: client, tabs: tabs}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoTab struct {
+	ID        string         `bson:"_id"`
+	Version   int            `bson:"version"`
+	StoreID   string         `bson:"store_id"`
+	Table     string         `bson:"table"`
+	Currency  string         `bson:"currency"`
+	Status    string         `bson:"status"`
+	OpenedAt  time.Time      `bson:"opened_at"`
+	SettledAt time.Time      `bson:"settled_at,omitempty"`
+	Lines     []mongoLine    `bson:"lines"`
+	Payments  []mongoPayment `bson:"payments"`
+}
+
+type mongoLine struct {
+	Item    string    `bson:"item"`
+	Price   int64     `bson:"price"`
+	AddedAt time.Time `bson:"added_at"`
+	Paid    int64     `bson:"paid"`
+}
+
+type mongoPayment struct {
+	ID         string    `bson:"id"`
+	PurchaseID string    `bson:"purchase_id,omitempty"`
+	At         time.Time `bson:"at"`
+	// Amounts are by line index, as a string since that is what BSON keys are.
+	Amounts map[string]int64 `bson:"amounts"`
+}
+
+func toMongoTab(t *Tab) mongoTab {
+	doc := mongoTab{
+		ID:        t.ID.String(),
+		Version:   t.version,
+		StoreID:   t.StoreID.String(),
+		Table:     t.Table,
+		Currency:  t.Currency,
+		Status:    string(t.status),
+		OpenedAt:  t.OpenedAt,
+		SettledAt: t.settledAt,
+		Lines:     make([]mongoLine, 0, len(t.lines)),
+		Payments:  make([]mongoPayment, 0, len(t.payments)),
+	}
+	for _, l := range t.lines {
+		doc.Lines = append(doc.Lines, mongoLine(l))
+	}
+	for _, p := range t.payments {
+		mp := mongoPayment{ID: p.ID.String(), At: p.At, Amounts: make(map[string]int64, len(p.Amounts))}
+		if !p.pending() {
+			mp.PurchaseID = p.PurchaseID.String()
+		}
+		for line, amount := range p.Amounts {
+			mp.Amounts[strconv.Itoa(line)] = amount
+		}
+		doc.Payments = append(doc.Payments, mp)
+	}
+	return doc
+}
+
+func (m mongoTab) toTab() *Tab {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	t := &Tab{
+		ID:        id,
+		StoreID:   storeID,
+		Table:     m.Table,
+		Currency:  m.Currency,
+		OpenedAt:  m.OpenedAt,
+		version:   m.Version,
+		status:    Status(m.Status),
+		settledAt: m.SettledAt,
+	}
+	for _, l := range m.Lines {
+		t.lines = append(t.lines, Line(l))
+	}
+	for _, mp := range m.Payments {
+		p := Payment{At: mp.At, Amounts: make(map[int]int64, len(mp.Amounts))}
+		p.ID, _ = uuid.Parse(mp.ID)
+		if mp.PurchaseID != "" {
+			p.PurchaseID, _ = uuid.Parse(mp.PurchaseID)
+		}
+		for line, amount := range mp.Amounts {
+			i, _ := strconv.Atoi(line)
+			p.Amounts[i] = amount
+		}
+		t.payments = append(t.payments, p)
+	}
+	return t
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Tab, err error) {
+	ctx, span := telemetry.StartClient(ctx, "tab.MongoRepository.Get", attribute.String("tab.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoTab
+	if err := m.tabs.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find tab: %w", err)
+	}
+	return doc.toTab(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, t *Tab) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "tab.MongoRepository.Save", attribute.String("tab.id", t.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoTab(t)
+	doc.Version = t.version + 1
+	if t.version == 0 {
+		if _, err := m.tabs.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save tab: %w", err)
+		}
+	} else {
+		res, err := m.tabs.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: t.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save tab: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	t.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Open(ctx context.Context, storeID uuid.UUID) (_ []*Tab, err error) {
+	ctx, span := telemetry.StartClient(ctx, "tab.MongoRepository.Open", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	filter := bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "status", Value: string(StatusOpen)}}
+	cur, err := m.tabs.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "opened_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find open tabs: %w", err)
+	}
+	var docs []mongoTab
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode tabs: %w", err)
+	}
+	tabs := make([]*Tab, 0, len(docs))
+	for _, doc := range docs {
+		tabs = append(tabs, doc.toTab())
+	}
+	return tabs, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.tabs.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps tabs in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu   sync.Mutex
+	tabs map[uuid.UUID]mongoTab
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{tabs: map[uuid.UUID]mongoTab{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Tab, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.tabs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toTab(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, t *Tab) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tabs[t.ID].Version != t.version {
+		return ErrConcurrencyConflict
+	}
+	if t.version == 0 {
+		for _, doc := range m.tabs {
+			if doc.StoreID == t.StoreID.String() && doc.Table == t.Table && doc.Status == string(StatusOpen) {
+				return ErrConcurrencyConflict
+			}
+		}
+	}
+	doc := toMongoTab(t)
+	doc.Version = t.version + 1
+	m.tabs[t.ID] = doc
+	t.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Open(_ context.Context, storeID uuid.UUID) ([]*Tab, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tabs []*Tab
+	for _, doc := range m.tabs {
+		if doc.StoreID == storeID.String() && doc.Status == string(StatusOpen) {
+			tabs = append(tabs, doc.toTab())
+		}
+	}
+	slices.SortFunc(tabs, func(a, b *Tab) int { return a.OpenedAt.Compare(b.OpenedAt) })
+	return tabs, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
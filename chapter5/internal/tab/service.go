@@ -0,0 +1,190 @@
+package tab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/invariant"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the tab first.
+const saveAttempts = 3
+
+// SharedSuffix marks the purchase lines that pay a share of a tab line rather than all of it, e.g.
+// "latte (shared)", so the price book does not price them as a whole latte.
+const SharedSuffix = " (shared)"
+
+// Purchases is how a tab is paid for, e.g. purchase.Service.
+type Purchases interface {
+	CompletePurchase(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase, card *loyalty.CoffeeBux) error
+}
+
+// Settlement is how one guest pays their part of a tab.
+type Settlement struct {
+	Split        Split
+	PaymentMeans payment.Means
+	CardToken    *string
+	// Card pays with coffeebux; its balance is only changed in memory, for the caller to save.
+	Card       *loyalty.CoffeeBux
+	CustomerID uuid.UUID
+	ServedBy   string
+}
+
+type Service struct {
+	repo      Repository
+	purchases Purchases
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when tabs were settled.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, purchases Purchases, opts ...Option) *Service {
+	s := &Service{repo: repo, purchases: purchases, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Open starts a tab for a table that has none open.
+func (s *Service) Open(ctx context.Context, storeID uuid.UUID, table, currency string) (*Tab, error) {
+	t, err := NewTab(storeID, table, currency, s.now())
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.Save(ctx, t)
+	if errors.Is(err, ErrConcurrencyConflict) {
+		return nil, fmt.Errorf("%w: %s", ErrTableTaken, table)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tab: %w", err)
+	}
+	return t, nil
+}
+
+func (s *Service) Tab(ctx context.Context, id uuid.UUID) (*Tab, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// OpenTabs returns the open tabs of a store, oldest first.
+func (s *Service) OpenTabs(ctx context.Context, storeID uuid.UUID) ([]*Tab, error) {
+	return s.repo.Open(ctx, storeID)
+}
+
+// Order is what a table orders of one product.
+type Order struct {
+	Item     string
+	Price    *money.Money
+	Quantity int
+}
+
+// Add puts what a table ordered on its tab, all of it or none.
+func (s *Service) Add(ctx context.Context, id uuid.UUID, orders ...Order) (*Tab, error) {
+	return s.update(ctx, id, func(t *Tab) error {
+		for _, o := range orders {
+			if err := t.Add(o.Item, o.Price, o.Quantity, s.now()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Service) Cancel(ctx context.Context, id uuid.UUID) error {
+	_, err := s.update(ctx, id, func(t *Tab) error {
+		return t.Cancel()
+	})
+	return err
+}
+
+// Pay makes a purchase for what the split covers, referencing the tab. The lines are reserved on the
+// tab first, so guests paying at once never pay for the same line, and are given back if the purchase
+// fails. A line paid in shares is bought as the item with SharedSuffix, at the price of the share.
+func (s *Service) Pay(ctx context.Context, id uuid.UUID, st Settlement) (*purchase.Purchase, error) {
+	paymentID := uuid.New()
+	var amounts map[int]int64
+	t, err := s.update(ctx, id, func(t *Tab) (err error) {
+		amounts, err = t.Reserve(paymentID, st.Split, s.now())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &purchase.Purchase{
+		Store:        store.Ref(t.StoreID),
+		CustomerID:   st.CustomerID,
+		PaymentMeans: st.PaymentMeans,
+		CardToken:    st.CardToken,
+		ServedBy:     st.ServedBy,
+		TabID:        t.ID,
+	}
+	for _, i := range slices.Sorted(maps.Keys(amounts)) {
+		l := t.lines[i]
+		item := l.Item
+		if amounts[i] != l.Price {
+			item += SharedSuffix
+		}
+		p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{ItemName: item, BasePrice: *money.New(amounts[i], t.Currency)})
+	}
+	if err := s.purchases.CompletePurchase(ctx, t.StoreID, p, st.Card); err != nil {
+		if _, rerr := s.update(ctx, id, func(t *Tab) error { t.Release(paymentID); return nil }); rerr != nil {
+			s.logger.ErrorContext(ctx, "tab payment failed and its lines are still reserved", "tab", id, "payment", paymentID, "error", rerr)
+		}
+		return nil, err
+	}
+	if _, err := s.update(ctx, id, func(t *Tab) error { t.Confirm(paymentID, p.ID, s.now()); return nil }); err != nil {
+		return p, fmt.Errorf("purchase %s completed but failed to record it on the tab: %w", p.ID, err)
+	}
+	return p, nil
+}
+
+// update applies fn to the latest tab and saves it, starting over if someone else saved in between.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(t *Tab) error) (*Tab, error) {
+	for range saveAttempts {
+		t, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(t); err != nil {
+			return nil, err
+		}
+		invariant.Assert(ctx, s.logger, t.Check())
+		err = s.repo.Save(ctx, t)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("failed to update tab after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,278 @@
+package tab
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/invariant"
+)
+
+var (
+	ErrNotFound            = errors.New("tab not found")
+	ErrNotOpen             = errors.New("tab is not open")
+	ErrTableTaken          = errors.New("table already has an open tab")
+	ErrNoTable             = errors.New("tabs are opened for a table")
+	ErrInvalidLine         = errors.New("tab lines need a product, a quantity and a price above 0")
+	ErrCurrencyMismatch    = errors.New("tab lines are all in the currency of the tab")
+	ErrInvalidSplit        = errors.New("invalid split")
+	ErrNothingDue          = errors.New("nothing is left to pay on the tab")
+	ErrHasPayments         = errors.New("tab was paid in part")
+	ErrConcurrencyConflict = errors.New("tab changed since it was read")
+)
+
+// Status is where a tab is, from the table sitting down to the bill being paid.
+type Status string
+
+const (
+	StatusOpen    Status = "open"
+	StatusSettled Status = "settled"
+	// StatusCancelled is a tab closed with nothing paid, e.g. a table that left without ordering.
+	StatusCancelled Status = "cancelled"
+)
+
+// Line is one unit of a product put on the tab. Amounts are in the minor unit of the tab's currency.
+type Line struct {
+	Item    string
+	Price   int64
+	AddedAt time.Time
+	// Paid is how much of Price payments took, including those still being charged.
+	Paid int64
+}
+
+func (l Line) due() int64 {
+	return l.Price - l.Paid
+}
+
+// Payment is part of the bill paid by one purchase.
+type Payment struct {
+	ID uuid.UUID
+	// PurchaseID is uuid.Nil while the purchase is being made.
+	PurchaseID uuid.UUID
+	// Amounts are what the payment took off each line, by line index.
+	Amounts map[int]int64
+	At      time.Time
+}
+
+func (p Payment) pending() bool {
+	return p.PurchaseID == uuid.Nil
+}
+
+// Split is what a payment covers: the lines given, by index, or with Ways an equal share of every line,
+// for a table splitting the bill Ways ways. Neither pays everything left.
+type Split struct {
+	Lines []int
+	Ways  int
+}
+
+// Tab is the bill of a table at a sit-down store. Lines are added as the table orders, and the tab is
+// settled once purchases paid for all of them, in one go or split between the guests.
+type Tab struct {
+	ID       uuid.UUID
+	StoreID  uuid.UUID
+	Table    string
+	Currency string
+	OpenedAt time.Time
+
+	version   int
+	status    Status
+	lines     []Line
+	payments  []Payment
+	settledAt time.Time
+}
+
+func NewTab(storeID uuid.UUID, table, currency string, openedAt time.Time) (*Tab, error) {
+	if table == "" {
+		return nil, ErrNoTable
+	}
+	if money.GetCurrency(currency) == nil {
+		return nil, fmt.Errorf("%w: %q is not an ISO 4217 code", ErrCurrencyMismatch, currency)
+	}
+	return &Tab{
+		ID:       uuid.New(),
+		StoreID:  storeID,
+		Table:    table,
+		Currency: currency,
+		OpenedAt: openedAt.UTC(),
+		status:   StatusOpen,
+	}, nil
+}
+
+func (t *Tab) Status() Status {
+	return t.status
+}
+
+func (t *Tab) Lines() []Line {
+	return slices.Clone(t.lines)
+}
+
+// Payments are the purchases that paid for the tab so far, oldest first.
+func (t *Tab) Payments() []Payment {
+	var res []Payment
+	for _, p := range t.payments {
+		if !p.pending() {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func (t *Tab) SettledAt() time.Time {
+	return t.settledAt
+}
+
+func (t *Tab) Total() *money.Money {
+	var total int64
+	for _, l := range t.lines {
+		total += l.Price
+	}
+	return money.New(total, t.Currency)
+}
+
+// Due is what is left to pay.
+func (t *Tab) Due() *money.Money {
+	var due int64
+	for _, l := range t.lines {
+		due += l.due()
+	}
+	return money.New(due, t.Currency)
+}
+
+// Add puts qty units of a product on an open tab.
+func (t *Tab) Add(item string, price *money.Money, qty int, at time.Time) error {
+	if t.status != StatusOpen {
+		return fmt.Errorf("%w: %s is %s", ErrNotOpen, t.ID, t.status)
+	}
+	if item == "" || qty <= 0 || price == nil || !price.IsPositive() {
+		return ErrInvalidLine
+	}
+	if price.Currency().Code != t.Currency {
+		return fmt.Errorf("%w: %s is in %s, not %s", ErrCurrencyMismatch, item, price.Currency().Code, t.Currency)
+	}
+	for range qty {
+		t.lines = append(t.lines, Line{Item: item, Price: price.Amount(), AddedAt: at.UTC()})
+	}
+	return nil
+}
+
+// Reserve takes what s covers off the lines for a payment being made, so two guests paying at once cannot
+// pay for the same line. The payment is then either confirmed or released. It returns the amounts taken,
+// by line index.
+func (t *Tab) Reserve(paymentID uuid.UUID, s Split, at time.Time) (map[int]int64, error) {
+	if t.status != StatusOpen {
+		return nil, fmt.Errorf("%w: %s is %s", ErrNotOpen, t.ID, t.status)
+	}
+	amounts, err := t.amounts(s)
+	if err != nil {
+		return nil, err
+	}
+	for i, amount := range amounts {
+		t.lines[i].Paid += amount
+	}
+	t.payments = append(t.payments, Payment{ID: paymentID, Amounts: amounts, At: at.UTC()})
+	return amounts, nil
+}
+
+func (t *Tab) amounts(s Split) (map[int]int64, error) {
+	if len(s.Lines) > 0 && s.Ways != 0 {
+		return nil, fmt.Errorf("%w: a payment covers either lines or a share", ErrInvalidSplit)
+	}
+	if s.Ways < 0 {
+		return nil, fmt.Errorf("%w: ways cannot be negative", ErrInvalidSplit)
+	}
+	amounts := map[int]int64{}
+	if len(s.Lines) > 0 {
+		for _, i := range s.Lines {
+			if i < 0 || i >= len(t.lines) {
+				return nil, fmt.Errorf("%w: there is no line %d", ErrInvalidSplit, i)
+			}
+			if t.lines[i].due() == 0 {
+				return nil, fmt.Errorf("%w: line %d is paid", ErrInvalidSplit, i)
+			}
+			amounts[i] = t.lines[i].due()
+		}
+		return amounts, nil
+	}
+	ways := max(s.Ways, 1)
+	for i, l := range t.lines {
+		due := l.due()
+		if due == 0 {
+			continue
+		}
+		// Every share is the same but the last, which takes what does not divide.
+		share := l.Price / int64(ways)
+		if due <= share+l.Price%int64(ways) || share == 0 {
+			share = due
+		}
+		amounts[i] = share
+	}
+	if len(amounts) == 0 {
+		return nil, ErrNothingDue
+	}
+	return amounts, nil
+}
+
+// Release gives back what a payment that failed had reserved.
+func (t *Tab) Release(paymentID uuid.UUID) {
+	i := slices.IndexFunc(t.payments, func(p Payment) bool { return p.ID == paymentID && p.pending() })
+	if i < 0 {
+		return
+	}
+	for line, amount := range t.payments[i].Amounts {
+		t.lines[line].Paid -= amount
+	}
+	t.payments = slices.Delete(t.payments, i, i+1)
+}
+
+// Cancel closes a tab nothing was paid on, e.g. one opened for the wrong table.
+func (t *Tab) Cancel() error {
+	if t.status != StatusOpen {
+		return fmt.Errorf("%w: %s is %s", ErrNotOpen, t.ID, t.status)
+	}
+	if len(t.payments) > 0 {
+		return ErrHasPayments
+	}
+	t.status = StatusCancelled
+	return nil
+}
+
+// Confirm records the purchase a reserved payment was made with. The tab is settled once nothing is due
+// and no payment is pending.
+func (t *Tab) Confirm(paymentID, purchaseID uuid.UUID, at time.Time) {
+	i := slices.IndexFunc(t.payments, func(p Payment) bool { return p.ID == paymentID })
+	if i < 0 {
+		return
+	}
+	t.payments[i].PurchaseID = purchaseID
+	if t.Due().IsZero() && !slices.ContainsFunc(t.payments, Payment.pending) {
+		t.status = StatusSettled
+		t.settledAt = at.UTC()
+	}
+}
+
+// Check tells which of the invariants of a tab it breaks, if any: no line is paid more than its price or
+// less than nothing, the payments add up to what was paid of every line, and a settled tab has nothing due.
+func (t *Tab) Check() error {
+	var c invariant.Checker
+	paid := make([][]int64, len(t.lines))
+	for _, p := range t.payments {
+		for i, amount := range p.Amounts {
+			c.That(i >= 0 && i < len(t.lines), "payment %s paid line %d of %d", p.ID, i, len(t.lines))
+			c.That(amount > 0, "payment %s paid %d of line %d", p.ID, amount, i)
+			if i >= 0 && i < len(t.lines) {
+				paid[i] = append(paid[i], amount)
+			}
+		}
+	}
+	for i, l := range t.lines {
+		c.NonNegative(fmt.Sprintf("what is due of line %d", i), l.due())
+		c.NonNegative(fmt.Sprintf("what was paid of line %d", i), l.Paid)
+		c.Sum(fmt.Sprintf("payments of line %d", i), l.Paid, paid[i]...)
+	}
+	c.That(t.status != StatusSettled || t.Due().IsZero(), "settled tab has %d due", t.Due().Amount())
+	return c.Err()
+}
@@ -0,0 +1,145 @@
+package tab_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"pgregory.net/rapid"
+
+	"coffeeco/internal/eventstore"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/tab"
+)
+
+// gateway declines cards while declining is set.
+type gateway struct{ declining bool }
+
+func (g *gateway) ChargeCard(context.Context, money.Money, string) error {
+	if g.declining {
+		return errors.New("card declined")
+	}
+	return nil
+}
+
+type noDiscount struct{}
+
+func (noDiscount) GetStoreSpecificDiscount(context.Context, uuid.UUID) (float32, error) {
+	return 0, nil
+}
+
+func Test_TabsAreSplitBetweenGuestsAndSettledOnceNothingIsDue(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	purchases, err := purchase.NewEventSourcedRepo(eventstore.NewMemoryStore(), nil, 1)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	cards := &gateway{}
+	svc := tab.NewService(tab.NewMemoryRepo(), purchase.NewService(cards, purchases, noDiscount{}))
+
+	tb, err := svc.Open(ctx, storeID, "7", "USD")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Open(ctx, storeID, "7", "USD"); !errors.Is(err, tab.ErrTableTaken) {
+		t.Fatalf("expected a second tab for table 7 to be refused but got %v", err)
+	}
+	if _, err := svc.Add(ctx, tb.ID, tab.Order{Item: "latte", Price: money.New(450, "USD"), Quantity: 2}, tab.Order{Item: "cake", Price: money.New(1000, "USD"), Quantity: 1}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	// One guest pays for their latte, by card.
+	token := "tok_visa"
+	p, err := svc.Pay(ctx, tb.ID, tab.Settlement{Split: tab.Split{Lines: []int{0}}, PaymentMeans: payment.MEANS_CARD, CardToken: &token})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if total := p.Total(); p.TabID != tb.ID || total.Amount() != 450 {
+		t.Fatalf("expected a 4.50 purchase referencing the tab but got %s for %s", total.Display(), p.TabID)
+	}
+
+	// A declined card gives the lines back.
+	cards.declining = true
+	if _, err := svc.Pay(ctx, tb.ID, tab.Settlement{Split: tab.Split{Lines: []int{1}}, PaymentMeans: payment.MEANS_CARD, CardToken: &token}); err == nil {
+		t.Fatal("expected the declined card to fail the payment")
+	}
+	cards.declining = false
+	tb, _ = svc.Tab(ctx, tb.ID)
+	if tb.Due().Amount() != 1450 || len(tb.Payments()) != 1 {
+		t.Fatalf("expected 14.50 left after one payment but got %s after %d", tb.Due().Display(), len(tb.Payments()))
+	}
+
+	// The rest is split three ways: a third of each line, and the last share takes what does not divide.
+	for _, want := range []int64{483, 483, 484} {
+		if p, err = svc.Pay(ctx, tb.ID, tab.Settlement{Split: tab.Split{Ways: 3}, PaymentMeans: payment.MEANS_CASH}); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if total := p.Total(); total.Amount() != want {
+			t.Fatalf("expected a share of %d but got %d", want, total.Amount())
+		}
+	}
+	tb, _ = svc.Tab(ctx, tb.ID)
+	if tb.Status() != tab.StatusSettled || !tb.Due().IsZero() || len(tb.Payments()) != 4 {
+		t.Fatalf("expected the tab settled by 4 payments but it is %s with %s due", tb.Status(), tb.Due().Display())
+	}
+	if _, err := svc.Pay(ctx, tb.ID, tab.Settlement{PaymentMeans: payment.MEANS_CASH}); !errors.Is(err, tab.ErrNotOpen) {
+		t.Fatalf("expected a settled tab to take no payment but got %v", err)
+	}
+	if _, err := svc.Open(ctx, storeID, "7", "USD"); err != nil {
+		t.Fatalf("expected table 7 to take a new tab once settled but got %v", err)
+	}
+}
+
+func Test_PaymentsAddUpToTheBillHoweverItIsSplit(t *testing.T) {
+	rapid.Check(t, func(t *rapid.T) {
+		at := time.Date(2024, 3, 1, 19, 0, 0, 0, time.UTC)
+		tb, err := tab.NewTab(uuid.New(), "7", "EUR", at)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		for range rapid.IntRange(1, 8).Draw(t, "orders") {
+			price := money.New(rapid.Int64Range(1, 10000).Draw(t, "price"), "EUR")
+			if err := tb.Add(rapid.StringMatching(`[a-z]{1,8}`).Draw(t, "item"), price, rapid.IntRange(1, 3).Draw(t, "qty"), at); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+		total := tb.Total().Amount()
+
+		// Some guests pay for their own lines, then the rest of the table splits what is left.
+		var paid int64
+		pay := func(s tab.Split) {
+			paymentID := uuid.New()
+			amounts, err := tb.Reserve(paymentID, s, at)
+			if err != nil {
+				t.Fatalf("expected no error paying %+v but got %v", s, err)
+			}
+			for _, amount := range amounts {
+				paid += amount
+			}
+			tb.Confirm(paymentID, uuid.New(), at)
+			if err := tb.Check(); err != nil {
+				t.Fatalf("expected a consistent tab but got %v", err)
+			}
+		}
+		for _, i := range rapid.SliceOfDistinct(rapid.IntRange(0, len(tb.Lines())-1), rapid.ID).Draw(t, "own lines") {
+			pay(tab.Split{Lines: []int{i}})
+		}
+		// Lines too cheap to share are paid by the first share, so it may take fewer.
+		ways := rapid.IntRange(1, 6).Draw(t, "ways")
+		for n := 0; !tb.Due().IsZero(); n++ {
+			if n == ways {
+				t.Fatalf("expected %d shares to pay the bill but %d is still due", ways, tb.Due().Amount())
+			}
+			pay(tab.Split{Ways: ways})
+		}
+
+		if paid != total || !tb.Due().IsZero() || tb.Status() != tab.StatusSettled {
+			t.Fatalf("expected %d paid and the tab settled but %d was paid, %d is due and the tab is %s", total, paid, tb.Due().Amount(), tb.Status())
+		}
+	})
+}
@@ -0,0 +1,384 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// Sale is a purchase completed at a store, as it counts towards the store's targets. Total is in the minor
+// unit of Currency.
+type Sale struct {
+	PurchaseID  string    `bson:"_id"`
+	StoreID     string    `bson:"store_id"`
+	PurchasedAt time.Time `bson:"purchased_at"`
+	Currency    string    `bson:"currency"`
+	Total       int64     `bson:"total"`
+}
+
+type Repository interface {
+	// Get returns ErrNotFound if there is no such target.
+	Get(ctx context.Context, id uuid.UUID) (*Target, error)
+	// Find returns the target of a store for a day and shift, or ErrNotFound if none was set.
+	Find(ctx context.Context, storeID uuid.UUID, day, shift string) (*Target, error)
+	// ForDay returns the targets of a store for a day, the whole day first and then by when the shifts start.
+	ForDay(ctx context.Context, storeID uuid.UUID, day string) ([]*Target, error)
+	// Covering returns the targets of a store a purchase completed at at counts towards.
+	Covering(ctx context.Context, storeID uuid.UUID, at time.Time) ([]*Target, error)
+	// Save returns ErrConcurrencyConflict if the target was saved by someone else since it was read, or if
+	// another target was set for the same day and shift.
+	Save(ctx context.Context, t *Target) error
+	// SaveSale replaces a sale saved before for the same purchase, so a purchase is counted once.
+	SaveSale(ctx context.Context, s Sale) error
+	// Sales returns what the sales of a store in currency, from from up to but not including to, came to.
+	Sales(ctx context.Context, storeID uuid.UUID, currency string, from, to time.Time) (total int64, count int, err error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps targets versioned, as a manager may change one while a purchase hits it.
+type MongoRepository struct {
+	client  *mongo.Client
+	targets *mongo.Collection
+	sales   *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	targets, sales := db.Collection("sales_targets"), db.Collection("rm_target_sales")
+	_, err = targets.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "store_id", Value: 1}, {Key: "day", Value: 1}, {Key: "shift", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "from", Value: 1}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sales target indexes: %w", err)
+	}
+	_, err = sales.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "store_id", Value: 1}, {Key: "purchased_at", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create target sales indexes: %w", err)
+	}
+	return &MongoRepository{client: client, targets: targets, sales: sales}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoTarget struct {
+	ID         string        `bson:"_id"`
+	Version    int           `bson:"version"`
+	StoreID    string        `bson:"store_id"`
+	Day        string        `bson:"day"`
+	Shift      string        `bson:"shift"`
+	ShiftStart time.Duration `bson:"shift_start"`
+	ShiftEnd   time.Duration `bson:"shift_end"`
+	From       time.Time     `bson:"from"`
+	To         time.Time     `bson:"to"`
+	Currency   string        `bson:"currency"`
+	Amount     int64         `bson:"amount"`
+	SetBy      string        `bson:"set_by"`
+	SetAt      time.Time     `bson:"set_at"`
+	HitAt      time.Time     `bson:"hit_at,omitempty"`
+}
+
+func toMongoTarget(t *Target) mongoTarget {
+	return mongoTarget{
+		ID:         t.ID.String(),
+		Version:    t.Version(),
+		StoreID:    t.StoreID.String(),
+		Day:        t.Day,
+		Shift:      t.Shift.Name,
+		ShiftStart: t.Shift.Start,
+		ShiftEnd:   t.Shift.End,
+		From:       t.From,
+		To:         t.To,
+		Currency:   t.Currency,
+		Amount:     t.Amount,
+		SetBy:      t.SetBy,
+		SetAt:      t.SetAt,
+		HitAt:      t.hitAt,
+	}
+}
+
+func (m mongoTarget) toTarget() *Target {
+	id, _ := uuid.Parse(m.ID)
+	storeID, _ := uuid.Parse(m.StoreID)
+	t := &Target{
+		StoreID:  storeID,
+		Day:      m.Day,
+		Shift:    Shift{Name: m.Shift, Start: m.ShiftStart, End: m.ShiftEnd},
+		From:     m.From,
+		To:       m.To,
+		Currency: m.Currency,
+		Amount:   m.Amount,
+		SetBy:    m.SetBy,
+		SetAt:    m.SetAt,
+		hitAt:    m.HitAt,
+	}
+	t.ID = id
+	t.SetVersion(m.Version)
+	return t
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (*Target, error) {
+	return m.findOne(ctx, bson.D{{Key: "_id", Value: id.String()}})
+}
+
+func (m *MongoRepository) Find(ctx context.Context, storeID uuid.UUID, day, shift string) (*Target, error) {
+	return m.findOne(ctx, bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "day", Value: day}, {Key: "shift", Value: shift}})
+}
+
+func (m *MongoRepository) findOne(ctx context.Context, filter bson.D) (*Target, error) {
+	var doc mongoTarget
+	if err := m.targets.FindOne(ctx, filter).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find sales target: %w", err)
+	}
+	return doc.toTarget(), nil
+}
+
+func (m *MongoRepository) ForDay(ctx context.Context, storeID uuid.UUID, day string) (_ []*Target, err error) {
+	ctx, span := telemetry.StartClient(ctx, "target.MongoRepository.ForDay", attribute.String("store.id", storeID.String()), attribute.String("target.day", day))
+	defer telemetry.End(span, &err)
+	res, err := m.find(ctx, bson.D{{Key: "store_id", Value: storeID.String()}, {Key: "day", Value: day}})
+	if err != nil {
+		return nil, err
+	}
+	sortTargets(res)
+	return res, nil
+}
+
+func (m *MongoRepository) Covering(ctx context.Context, storeID uuid.UUID, at time.Time) (_ []*Target, err error) {
+	ctx, span := telemetry.StartClient(ctx, "target.MongoRepository.Covering", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	return m.find(ctx, bson.D{
+		{Key: "store_id", Value: storeID.String()},
+		{Key: "from", Value: bson.D{{Key: "$lte", Value: at.UTC()}}},
+		{Key: "to", Value: bson.D{{Key: "$gt", Value: at.UTC()}}},
+	})
+}
+
+func (m *MongoRepository) find(ctx context.Context, filter bson.D) ([]*Target, error) {
+	cur, err := m.targets.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sales targets: %w", err)
+	}
+	var docs []mongoTarget
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode sales targets: %w", err)
+	}
+	res := make([]*Target, 0, len(docs))
+	for _, doc := range docs {
+		res = append(res, doc.toTarget())
+	}
+	return res, nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, t *Target) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "target.MongoRepository.Save", attribute.String("target.id", t.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoTarget(t)
+	doc.Version = t.Version() + 1
+	if t.Version() == 0 {
+		if _, err := m.targets.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save sales target: %w", err)
+		}
+	} else {
+		res, err := m.targets.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: t.Version()}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save sales target: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	t.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MongoRepository) SaveSale(ctx context.Context, s Sale) error {
+	_, err := m.sales.ReplaceOne(ctx, bson.D{{Key: "_id", Value: s.PurchaseID}}, s, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to save sale: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Sales(ctx context.Context, storeID uuid.UUID, currency string, from, to time.Time) (_ int64, _ int, err error) {
+	ctx, span := telemetry.StartClient(ctx, "target.MongoRepository.Sales", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.sales.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			{Key: "store_id", Value: storeID.String()},
+			{Key: "currency", Value: currency},
+			{Key: "purchased_at", Value: bson.D{{Key: "$gte", Value: from.UTC()}, {Key: "$lt", Value: to.UTC()}}},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$total"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to sum sales: %w", err)
+	}
+	var res []struct {
+		Total int64 `bson:"total"`
+		Count int   `bson:"count"`
+	}
+	if err := cur.All(ctx, &res); err != nil {
+		return 0, 0, fmt.Errorf("failed to decode sales: %w", err)
+	}
+	if len(res) == 0 {
+		return 0, 0, nil
+	}
+	return res[0].Total, res[0].Count, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.targets.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps targets and sales in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu      sync.Mutex
+	targets map[uuid.UUID]mongoTarget
+	sales   map[string]Sale
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{targets: map[uuid.UUID]mongoTarget{}, sales: map[string]Sale{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Target, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.targets[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toTarget(), nil
+}
+
+func (m *MemoryRepository) Find(_ context.Context, storeID uuid.UUID, day, shift string) (*Target, error) {
+	res := m.find(func(doc mongoTarget) bool {
+		return doc.StoreID == storeID.String() && doc.Day == day && doc.Shift == shift
+	})
+	if len(res) == 0 {
+		return nil, ErrNotFound
+	}
+	return res[0], nil
+}
+
+func (m *MemoryRepository) ForDay(_ context.Context, storeID uuid.UUID, day string) ([]*Target, error) {
+	res := m.find(func(doc mongoTarget) bool {
+		return doc.StoreID == storeID.String() && doc.Day == day
+	})
+	sortTargets(res)
+	return res, nil
+}
+
+func (m *MemoryRepository) Covering(_ context.Context, storeID uuid.UUID, at time.Time) ([]*Target, error) {
+	return m.find(func(doc mongoTarget) bool {
+		return doc.StoreID == storeID.String() && !at.Before(doc.From) && at.Before(doc.To)
+	}), nil
+}
+
+func (m *MemoryRepository) find(match func(mongoTarget) bool) []*Target {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []*Target
+	for _, doc := range m.targets {
+		if match(doc) {
+			res = append(res, doc.toTarget())
+		}
+	}
+	return res
+}
+
+func (m *MemoryRepository) Save(_ context.Context, t *Target) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.targets[t.ID].Version != t.Version() {
+		return ErrConcurrencyConflict
+	}
+	for id, doc := range m.targets {
+		if id != t.ID && doc.StoreID == t.StoreID.String() && doc.Day == t.Day && doc.Shift == t.Shift.Name {
+			return ErrConcurrencyConflict
+		}
+	}
+	doc := toMongoTarget(t)
+	doc.Version = t.Version() + 1
+	m.targets[t.ID] = doc
+	t.SetVersion(doc.Version)
+	return nil
+}
+
+func (m *MemoryRepository) SaveSale(_ context.Context, s Sale) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sales[s.PurchaseID] = s
+	return nil
+}
+
+func (m *MemoryRepository) Sales(_ context.Context, storeID uuid.UUID, currency string, from, to time.Time) (total int64, count int, _ error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sales {
+		if s.StoreID == storeID.String() && s.Currency == currency && !s.PurchasedAt.Before(from) && s.PurchasedAt.Before(to) {
+			total += s.Total
+			count++
+		}
+	}
+	return total, count, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
+
+// sortTargets puts the target for the whole day first, then those of shifts by when they start.
+func sortTargets(ts []*Target) {
+	slices.SortFunc(ts, func(a, b *Target) int {
+		if c := compareBool(a.Shift.Name != "", b.Shift.Name != ""); c != 0 {
+			return c
+		}
+		return a.From.Compare(b.From)
+	})
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,225 @@
+package target
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving the target first.
+const saveAttempts = 3
+
+type Service struct {
+	repo      Repository
+	registry  *events.Registry
+	publisher events.Publisher             // 可选, 发布达成的目标
+	audit     audit.Recorder               // 可选, 记录谁设定了目标
+	locations map[uuid.UUID]*time.Location // 可选, 默认 UTC
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithEventPublisher publishes Hit once a store's sales reach one of its targets.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithAuditLog records who set every target in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+// WithTimeZones sets where each store is, for its days and shifts to start at its midnight. Stores not in
+// locations are taken to be in UTC.
+func WithTimeZones(locations map[uuid.UUID]*time.Location) Option {
+	return func(s *Service) {
+		s.locations = locations
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when targets were set and hit.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, opts ...Option) *Service {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	s := &Service{repo: repo, registry: r, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Set sets what a store should sell on day, e.g. "2024-03-01", in a shift or, for the zero Shift, the whole
+// day. Setting the target of a day and shift again replaces it, and it has to be hit again; sales made
+// already count towards it, so it may be hit straight away.
+func (s *Service) Set(ctx context.Context, storeID uuid.UUID, day string, shift Shift, amount money.Money) (*Target, error) {
+	midnight, err := time.ParseInLocation(time.DateOnly, day, s.location(storeID))
+	if err != nil {
+		return nil, ErrInvalidDay
+	}
+	setting := Setting{StoreID: storeID, Day: midnight, Shift: shift, Amount: amount}
+	by := audit.Actor(ctx)
+	for range saveAttempts {
+		var before string
+		t, err := s.repo.Find(ctx, storeID, day, shift.Name)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			t, err = New(setting, by, s.now())
+		case err == nil:
+			before = money.New(t.Amount, t.Currency).Display()
+			err = t.Change(setting, by, s.now())
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, t)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if s.audit != nil {
+			e := audit.NewEntry(ctx, audit.ActionTargetSet, "sales_target", t.ID.String(), before, amount.Display())
+			e.Note = t.Day
+			if t.Shift.Name != "" {
+				e.Note += " " + t.Shift.Name
+			}
+			if err := s.audit.Record(ctx, e); err != nil {
+				return nil, fmt.Errorf("sales target set but failed to record it in the audit log: %w", err)
+			}
+		}
+		if err := s.check(ctx, t.ID); err != nil {
+			s.logger.ErrorContext(ctx, "sales target set but not checked", "target", t.ID, "error", err)
+		}
+		return s.repo.Get(ctx, t.ID)
+	}
+	return nil, fmt.Errorf("failed to set sales target after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// Progress returns how far a store is towards each of its targets on day, the whole day first and then the
+// shifts by when they start.
+func (s *Service) Progress(ctx context.Context, storeID uuid.UUID, day string) ([]Progress, error) {
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		return nil, ErrInvalidDay
+	}
+	targets, err := s.repo.ForDay(ctx, storeID, day)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Progress, 0, len(targets))
+	for _, t := range targets {
+		sales, count, err := s.repo.Sales(ctx, storeID, t.Currency, t.From, t.To)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Progress{Target: t, Sales: sales, Purchases: count})
+	}
+	return res, nil
+}
+
+// Today is the date it is now where the store is, e.g. for the dashboard to show today's progress.
+func (s *Service) Today(storeID uuid.UUID) string {
+	return s.now().In(s.location(storeID)).Format(time.DateOnly)
+}
+
+// Handle is an events.Handler for the purchase topic that counts every completed purchase towards the
+// targets of its store, and publishes Hit for those it reaches. A sale is keyed by its purchase, so the
+// purchase is counted once however often it is delivered.
+func (s *Service) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeCompleted {
+		return nil
+	}
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.Completed)
+	sale := Sale{
+		PurchaseID:  e.PurchaseID.String(),
+		StoreID:     e.StoreID.String(),
+		PurchasedAt: e.PurchasedAt.UTC(),
+		Currency:    e.Currency,
+		Total:       e.Total,
+	}
+	if err := s.repo.SaveSale(ctx, sale); err != nil {
+		return err
+	}
+	targets, err := s.repo.Covering(ctx, e.StoreID, e.PurchasedAt)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, t := range targets {
+		if t.Currency == e.Currency && t.hitAt.IsZero() {
+			errs = append(errs, s.check(ctx, t.ID))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check records that the target was hit if sales reached it. Hit is published before the target is saved,
+// so a failure to publish leaves it to be hit again when the purchase is redelivered; consumers see it once
+// as its event ID does not change.
+func (s *Service) check(ctx context.Context, id uuid.UUID) error {
+	for range saveAttempts {
+		t, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		sales, _, err := s.repo.Sales(ctx, t.StoreID, t.Currency, t.From, t.To)
+		if err != nil {
+			return err
+		}
+		if !t.hit(sales, s.now()) {
+			return nil
+		}
+		if s.publisher != nil {
+			if err := s.publisher.Publish(ctx, t.PopEvents()...); err != nil {
+				return fmt.Errorf("sales target hit but not published: %w", err)
+			}
+		}
+		err = s.repo.Save(ctx, t)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("failed to record sales target hit after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+func (s *Service) location(storeID uuid.UUID) *time.Location {
+	if loc := s.locations[storeID]; loc != nil {
+		return loc
+	}
+	return time.UTC
+}
@@ -0,0 +1,208 @@
+package target
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/ddd"
+	"coffeeco/internal/events"
+)
+
+const EventTypeHit = "target.hit"
+
+var (
+	ErrNotFound            = errors.New("no such sales target")
+	ErrInvalidDay          = errors.New("sales target day must be a date such as 2024-03-01")
+	ErrInvalidAmount       = errors.New("sales targets must be positive")
+	ErrInvalidShift        = errors.New("shifts start and end within a day, at a minute")
+	ErrNoShiftName         = errors.New("shifts that are not the whole day need a name")
+	ErrConcurrencyConflict = errors.New("sales target changed since it was read")
+)
+
+// Shift is part of a store's day, from Start to End after midnight. A shift ending at or before it starts
+// ends the next day, e.g. 18:00 to 02:00. The zero Shift is the whole day.
+type Shift struct {
+	// Name is empty for the whole day, e.g. "morning" otherwise.
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+func (s Shift) validate() error {
+	var errs []error
+	for _, d := range []time.Duration{s.Start, s.End} {
+		if d < 0 || d >= 24*time.Hour || d%time.Minute != 0 {
+			errs = append(errs, ErrInvalidShift)
+			break
+		}
+	}
+	if s.Name == "" && (s.Start != 0 || s.End != 0) {
+		errs = append(errs, ErrNoShiftName)
+	}
+	return errors.Join(errs...)
+}
+
+// window is when the shift of day runs, day being midnight where the store is.
+func (s Shift) window(day time.Time) (from, to time.Time) {
+	end := s.End
+	if end <= s.Start {
+		end += 24 * time.Hour
+	}
+	// Adding the clock time, rather than the duration, keeps shifts at their time across DST changes.
+	at := func(d time.Duration) time.Time {
+		h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+		return time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, day.Location())
+	}
+	return at(s.Start).UTC(), at(end).UTC()
+}
+
+// Target is what a store should sell in a day or one of its shifts. It is hit once the purchases completed
+// at the store in that time, in its currency, add up to Amount.
+type Target struct {
+	ddd.AggregateRoot
+	StoreID uuid.UUID
+	// Day is the date of the day the target is for, where the store is, e.g. "2024-03-01".
+	Day   string
+	Shift Shift
+	// From and To are when the shift runs, From inclusive and To exclusive.
+	From     time.Time
+	To       time.Time
+	Currency string
+	Amount   int64
+	// SetBy is who set the target last, as in the audit log.
+	SetBy string
+	SetAt time.Time
+
+	hitAt time.Time
+}
+
+// Setting is what a target is set with.
+type Setting struct {
+	StoreID uuid.UUID
+	// Day is midnight of the day where the store is.
+	Day    time.Time
+	Shift  Shift
+	Amount money.Money
+}
+
+// New sets a target of s at at, by setBy.
+func New(s Setting, setBy string, at time.Time) (*Target, error) {
+	s.Shift.Name = strings.TrimSpace(s.Shift.Name)
+	var errs []error
+	if !s.Amount.IsPositive() {
+		errs = append(errs, ErrInvalidAmount)
+	}
+	errs = append(errs, s.Shift.validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	from, to := s.Shift.window(s.Day)
+	return &Target{
+		AggregateRoot: ddd.AggregateRoot{ID: uuid.New()},
+		StoreID:       s.StoreID,
+		Day:           s.Day.Format(time.DateOnly),
+		Shift:         s.Shift,
+		From:          from,
+		To:            to,
+		Currency:      s.Amount.Currency().Code,
+		Amount:        s.Amount.Amount(),
+		SetBy:         setBy,
+		SetAt:         at.UTC(),
+	}, nil
+}
+
+// Covers tells whether a purchase completed at at counts towards the target.
+func (t *Target) Covers(at time.Time) bool {
+	return !at.Before(t.From) && at.Before(t.To)
+}
+
+// Change sets the target again, for its shift as in s, which has to be hit again.
+func (t *Target) Change(s Setting, setBy string, at time.Time) error {
+	nt, err := New(s, setBy, at)
+	if err != nil {
+		return err
+	}
+	t.Shift, t.From, t.To = nt.Shift, nt.From, nt.To
+	t.Currency, t.Amount = nt.Currency, nt.Amount
+	t.SetBy, t.SetAt = nt.SetBy, nt.SetAt
+	t.hitAt = time.Time{}
+	return nil
+}
+
+// hit records that sales reached the target at at, once, recording Hit.
+func (t *Target) hit(sales int64, at time.Time) bool {
+	if !t.hitAt.IsZero() || sales < t.Amount {
+		return false
+	}
+	t.hitAt = at.UTC()
+	t.RecordEvent(Hit{
+		TargetID: t.ID,
+		StoreID:  t.StoreID,
+		Day:      t.Day,
+		Shift:    t.Shift.Name,
+		Currency: t.Currency,
+		Amount:   t.Amount,
+		Sales:    sales,
+		HitAt:    t.hitAt,
+	})
+	return true
+}
+
+// HitAt is when the target was hit; zero if it was not yet.
+func (t *Target) HitAt() time.Time {
+	return t.hitAt
+}
+
+// Progress is how far a store is towards a target. Amounts are in the minor unit of the target's currency.
+type Progress struct {
+	Target *Target
+	// Sales is what the Purchases the target covers came to.
+	Sales     int64
+	Purchases int
+}
+
+// Percent is how much of the target was sold, over 100 once it is exceeded.
+func (p Progress) Percent() float64 {
+	return float64(p.Sales) * 100 / float64(p.Target.Amount)
+}
+
+// Remaining is what is left to sell to hit the target, 0 once it is.
+func (p Progress) Remaining() int64 {
+	return max(p.Target.Amount-p.Sales, 0)
+}
+
+// Hit is published once a store's sales reach a target. Its ID is the same for every time the same target
+// is hit at the same amount, so consumers deduplicating by event ID see it once.
+type Hit struct {
+	TargetID uuid.UUID `json:"target_id"`
+	StoreID  uuid.UUID `json:"store_id"`
+	Day      string    `json:"day"`
+	// Shift is empty for a target for the whole day.
+	Shift    string    `json:"shift,omitempty"`
+	Currency string    `json:"currency"`
+	Amount   int64     `json:"amount"`
+	Sales    int64     `json:"sales"`
+	HitAt    time.Time `json:"hit_at"`
+}
+
+func (e Hit) EventType() string {
+	return EventTypeHit
+}
+
+func (e Hit) AggregateID() uuid.UUID {
+	return e.StoreID
+}
+
+func (e Hit) EventID() uuid.UUID {
+	return uuid.NewSHA1(e.TargetID, []byte(EventTypeHit+"."+e.Currency+"."+strconv.FormatInt(e.Amount, 10)))
+}
+
+// RegisterEvents adds decoders for every version of the target events still in circulation.
+func RegisterEvents(r *events.Registry) {
+	r.Register(EventTypeHit, 1, events.JSONDecoder[Hit]())
+}
@@ -0,0 +1,116 @@
+package target_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/target"
+)
+
+type capture []events.Event
+
+func (c *capture) Publish(_ context.Context, evts ...events.Event) error {
+	*c = append(*c, evts...)
+	return nil
+}
+
+func complete(t *testing.T, s *target.Service, e purchase.Completed) {
+	t.Helper()
+	msg, err := events.NewMessage(e, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := s.Handle(context.Background(), msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_ShiftTargetsAreHitOnceBySalesInTheShiftWhereTheStoreIs(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	var published capture
+	svc := target.NewService(target.NewMemoryRepo(),
+		target.WithEventPublisher(&published),
+		target.WithTimeZones(map[uuid.UUID]*time.Location{storeID: london}),
+		target.WithClock(func() time.Time { return time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC) }),
+	)
+
+	morning := target.Shift{Name: "morning", Start: 7 * time.Hour, End: 12 * time.Hour}
+	if _, err := svc.Set(ctx, storeID, "2024-07-01", morning, *money.New(1000, "GBP")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Set(ctx, storeID, "2024-07-01", target.Shift{}, *money.New(5000, "GBP")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	// 06:30 UTC is 07:30 in London, in the morning shift; 11:30 UTC is past it.
+	first := purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 600, Currency: "GBP", PurchasedAt: time.Date(2024, 7, 1, 6, 30, 0, 0, time.UTC)}
+	complete(t, svc, first)
+	complete(t, svc, first)
+	complete(t, svc, purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 300, Currency: "GBP", PurchasedAt: time.Date(2024, 7, 1, 11, 30, 0, 0, time.UTC)})
+	if len(published) != 0 {
+		t.Fatalf("expected no target hit yet but got %+v", published)
+	}
+	complete(t, svc, purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 400, Currency: "GBP", PurchasedAt: time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)})
+	complete(t, svc, purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 100, Currency: "GBP", PurchasedAt: time.Date(2024, 7, 1, 10, 5, 0, 0, time.UTC)})
+
+	if len(published) != 1 {
+		t.Fatalf("expected the morning target to be hit once but got %+v", published)
+	}
+	hit := published[0].(target.Hit)
+	if hit.Shift != "morning" || hit.Sales != 1000 || hit.Amount != 1000 {
+		t.Fatalf("expected the morning target hit at 1000 but got %+v", hit)
+	}
+
+	progress, err := svc.Progress(ctx, storeID, "2024-07-01")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(progress) != 2 || progress[0].Target.Shift.Name != "" || progress[1].Target.Shift.Name != "morning" {
+		t.Fatalf("expected the whole day and then the morning but got %+v", progress)
+	}
+	day, shift := progress[0], progress[1]
+	if day.Sales != 1400 || day.Purchases != 4 || day.Remaining() != 3600 || !day.Target.HitAt().IsZero() {
+		t.Fatalf("expected 1400 of 5000 sold in the day but got %+v", day)
+	}
+	if shift.Sales != 1100 || shift.Percent() != 110 || shift.Remaining() != 0 || shift.Target.HitAt().IsZero() {
+		t.Fatalf("expected 1100 of 1000 sold in the morning but got %+v", shift)
+	}
+}
+
+func Test_RaisingAHitTargetHasItHitAgain(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	var published capture
+	svc := target.NewService(target.NewMemoryRepo(), target.WithEventPublisher(&published))
+
+	complete(t, svc, purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 800, Currency: "USD", PurchasedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)})
+	if _, err := svc.Set(ctx, storeID, "2024-03-01", target.Shift{}, *money.New(500, "USD")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	got, err := svc.Set(ctx, storeID, "2024-03-01", target.Shift{}, *money.New(1000, "USD"))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !got.HitAt().IsZero() || len(published) != 1 {
+		t.Fatalf("expected the raised target not to be hit yet but got %+v and %+v", got, published)
+	}
+	complete(t, svc, purchase.Completed{PurchaseID: uuid.New(), StoreID: storeID, Total: 200, Currency: "USD", PurchasedAt: time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)})
+	if len(published) != 2 || published[0].(target.Hit).EventID() == published[1].(target.Hit).EventID() {
+		t.Fatalf("expected the raised target to be hit again but got %+v", published)
+	}
+
+	if _, err := svc.Set(ctx, storeID, "2024-03-01", target.Shift{Start: time.Hour}, *money.New(500, "USD")); err == nil {
+		t.Fatalf("expected a shift without a name to be refused")
+	}
+}
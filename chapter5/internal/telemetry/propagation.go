@@ -0,0 +1,68 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"coffeeco/internal/events"
+)
+
+// caseInsensitive is a TextMapCarrier over headers whose names may have been canonicalized in transit,
+// e.g. "traceparent" arriving as "Traceparent".
+type caseInsensitive map[string]string
+
+func (c caseInsensitive) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return v
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c caseInsensitive) Set(key, value string) {
+	c[key] = value
+}
+
+func (c caseInsensitive) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// StartPublish starts a producer span for publishing m and writes its trace context into m's headers.
+func StartPublish(ctx context.Context, m *events.Message) (context.Context, trace.Span) {
+	ctx, span := otelStart(ctx, "publish "+m.Type, trace.SpanKindProducer, messageAttributes(*m)...)
+	if m.Headers == nil {
+		m.Headers = map[string]string{}
+	}
+	Inject(ctx, m.Headers)
+	return ctx, span
+}
+
+// Handler continues the trace a message was published in and runs h in a consumer span, so an event
+// handler's work, and anything it calls, shows up under the request that raised the event.
+func Handler(h events.Handler) events.Handler {
+	return func(ctx context.Context, m events.Message) (err error) {
+		ctx = Extract(ctx, m.Headers)
+		ctx, span := otelStart(ctx, "handle "+m.Type, trace.SpanKindConsumer, messageAttributes(m)...)
+		defer End(span, &err)
+		return h(ctx, m)
+	}
+}
+
+func messageAttributes(m events.Message) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.destination.name", events.TopicFor(m.Type)),
+		attribute.String("messaging.message.id", m.ID.String()),
+		attribute.String("coffeeco.aggregate.id", m.AggregateID),
+	}
+}
@@ -0,0 +1,89 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "coffeeco"
+
+// Setup installs the global tracer provider and the W3C trace context propagator. Spans are exported over
+// OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set (the exporter reads the rest of the OTEL_* variables);
+// otherwise trace context is still propagated, so the IDs show up in logs and downstream calls, but no
+// spans are recorded. Call shutdown before exiting to flush the spans still buffered.
+func Setup(ctx context.Context, serviceName string) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Start starts a span under whatever span is already in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otelStart(ctx, name, trace.SpanKindInternal, attrs...)
+}
+
+// StartClient starts a span for a call to another system, e.g. a database or the payment gateway.
+func StartClient(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otelStart(ctx, name, trace.SpanKindClient, attrs...)
+}
+
+func otelStart(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed if *err is set. It is meant to be deferred with a named error result:
+//
+//	ctx, span := telemetry.Start(ctx, "purchase.Service.CompletePurchase")
+//	defer telemetry.End(span, &err)
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// IDs returns the trace and span IDs in ctx, or empty strings if there is no span.
+func IDs(ctx context.Context) (traceID, spanID string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
+
+// Inject writes the trace context in ctx into headers, so a consumer or downstream service can continue
+// the trace.
+func Inject(ctx context.Context, headers map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+}
+
+// Extract is the inverse of Inject. Header names are matched case-insensitively, as some transports
+// canonicalize them.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, caseInsensitive(headers))
+}
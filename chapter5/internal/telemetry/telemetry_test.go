@@ -0,0 +1,85 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/telemetry"
+)
+
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func Test_HandlerContinuesThePublishersTrace(t *testing.T) {
+	tests := []struct {
+		name string
+		// canonicalize mimics transports that change the case of header names.
+		canonicalize bool
+	}{
+		{name: "headers as sent"},
+		{name: "canonicalized headers", canonicalize: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := record(t)
+
+			ctx, request := telemetry.Start(context.Background(), "request")
+			m := events.Message{ID: uuid.New(), Type: "purchase.completed"}
+			_, publish := telemetry.StartPublish(ctx, &m)
+			publish.End()
+			request.End()
+			if tt.canonicalize {
+				m.Headers = map[string]string{"Traceparent": m.Headers["traceparent"]}
+			}
+
+			var handledIn string
+			h := telemetry.Handler(func(ctx context.Context, m events.Message) error {
+				handledIn, _ = telemetry.IDs(ctx)
+				return errors.New("boom")
+			})
+			if err := h(context.Background(), m); err == nil {
+				t.Fatal("expected the handler's error to be returned")
+			}
+
+			traceID := request.SpanContext().TraceID().String()
+			if handledIn != traceID {
+				t.Fatalf("expected the handler to run in trace %s but got %q", traceID, handledIn)
+			}
+			spans := rec.Ended()
+			handle := spans[len(spans)-1]
+			if handle.Parent().SpanID() != publish.SpanContext().SpanID() {
+				t.Fatalf("expected the consumer span to be a child of the producer span")
+			}
+			if handle.Status().Code != codes.Error {
+				t.Fatalf("expected the consumer span to be failed but got %v", handle.Status())
+			}
+		})
+	}
+}
+
+func Test_EndOnlyFailsSpansWithAnError(t *testing.T) {
+	rec := record(t)
+
+	var err error
+	_, span := telemetry.Start(context.Background(), "fine")
+	telemetry.End(span, &err)
+	if got := rec.Ended()[0].Status().Code; got != codes.Unset {
+		t.Fatalf("expected an unset status but got %v", got)
+	}
+}
@@ -0,0 +1,152 @@
+package testsupport
+
+import (
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+// DefaultCurrency is what builders price products in unless told otherwise.
+const DefaultCurrency = "USD"
+
+// PurchaseBuilder builds purchases for service tests, e.g.
+//
+//	p := testsupport.NewTestPurchase().WithLines("latte", 450, "croissant", 325).WithMeans(payment.MEANS_CASH).Build()
+//
+// Without lines a purchase is of one latte, and without means it is paid by card.
+type PurchaseBuilder struct {
+	p        purchase.Purchase
+	currency string
+	token    string
+}
+
+func NewTestPurchase() *PurchaseBuilder {
+	return &PurchaseBuilder{p: purchase.Purchase{PaymentMeans: payment.MEANS_CARD}, currency: DefaultCurrency, token: "tok_visa"}
+}
+
+// WithCurrency prices the lines added from now on in code.
+func (b *PurchaseBuilder) WithCurrency(code string) *PurchaseBuilder {
+	b.currency = code
+	return b
+}
+
+// WithLines adds lines from pairs of product names and prices in the minor unit, e.g. "latte", 450. It
+// panics on anything else, as a test that builds a purchase wrongly cannot go on.
+func (b *PurchaseBuilder) WithLines(nameAndPrice ...any) *PurchaseBuilder {
+	if len(nameAndPrice)%2 != 0 {
+		panic("testsupport: WithLines takes pairs of names and prices")
+	}
+	for i := 0; i < len(nameAndPrice); i += 2 {
+		name, ok := nameAndPrice[i].(string)
+		price, ok2 := nameAndPrice[i+1].(int)
+		if !ok || !ok2 {
+			panic("testsupport: WithLines takes pairs of a string name and an int price")
+		}
+		b.p.ProductsToPurchase = append(b.p.ProductsToPurchase, Product(name, int64(price), b.currency))
+	}
+	return b
+}
+
+// WithProducts adds products as they are, e.g. those a TestStore sells.
+func (b *PurchaseBuilder) WithProducts(products ...coffeeco.Product) *PurchaseBuilder {
+	b.p.ProductsToPurchase = append(b.p.ProductsToPurchase, products...)
+	return b
+}
+
+// WithMeans pays with m. Card purchases are charged to tok_visa unless WithCardToken says otherwise.
+func (b *PurchaseBuilder) WithMeans(m payment.Means) *PurchaseBuilder {
+	b.p.PaymentMeans = m
+	return b
+}
+
+func (b *PurchaseBuilder) WithCardToken(token string) *PurchaseBuilder {
+	b.token = token
+	return b
+}
+
+func (b *PurchaseBuilder) WithCustomer(id uuid.UUID) *PurchaseBuilder {
+	b.p.CustomerID = id
+	return b
+}
+
+func (b *PurchaseBuilder) WithStore(s store.Store) *PurchaseBuilder {
+	b.p.Store = s
+	return b
+}
+
+func (b *PurchaseBuilder) WithDelivery(address, phone string) *PurchaseBuilder {
+	b.p.Delivery = &purchase.Delivery{Address: address, Phone: phone}
+	return b
+}
+
+func (b *PurchaseBuilder) ServedBy(barista string) *PurchaseBuilder {
+	b.p.ServedBy = barista
+	return b
+}
+
+// Build returns a new purchase each time it is called, so one builder can make many.
+func (b *PurchaseBuilder) Build() *purchase.Purchase {
+	p := b.p
+	p.ProductsToPurchase = append([]coffeeco.Product(nil), b.p.ProductsToPurchase...)
+	if len(p.ProductsToPurchase) == 0 {
+		p.ProductsToPurchase = []coffeeco.Product{Product("latte", 450, b.currency)}
+	}
+	if p.PaymentMeans == payment.MEANS_CARD {
+		token := b.token
+		p.CardToken = &token
+	}
+	if p.Delivery != nil {
+		d := *p.Delivery
+		p.Delivery = &d
+	}
+	return &p
+}
+
+// Product is a product priced at amount in the minor unit of currency.
+func Product(name string, amount int64, currency string) coffeeco.Product {
+	return coffeeco.Product{ItemName: name, BasePrice: *money.New(amount, currency)}
+}
+
+// StoreBuilder builds stores for service tests. Without products a store sells a latte and an espresso.
+type StoreBuilder struct {
+	s        store.Store
+	currency string
+}
+
+func NewTestStore() *StoreBuilder {
+	return &StoreBuilder{s: store.New(uuid.New(), "Test Street"), currency: DefaultCurrency}
+}
+
+func (b *StoreBuilder) WithID(id uuid.UUID) *StoreBuilder {
+	b.s.ID = id
+	return b
+}
+
+func (b *StoreBuilder) WithLocation(location string) *StoreBuilder {
+	b.s.Location = location
+	return b
+}
+
+func (b *StoreBuilder) WithCurrency(code string) *StoreBuilder {
+	b.currency = code
+	return b
+}
+
+// Selling adds a product the store sells, priced in the minor unit.
+func (b *StoreBuilder) Selling(name string, amount int64) *StoreBuilder {
+	b.s.ProductsForSale = append(b.s.ProductsForSale, Product(name, amount, b.currency))
+	return b
+}
+
+func (b *StoreBuilder) Build() store.Store {
+	s := b.s
+	s.ProductsForSale = append([]coffeeco.Product(nil), b.s.ProductsForSale...)
+	if len(s.ProductsForSale) == 0 {
+		s.ProductsForSale = []coffeeco.Product{Product("latte", 450, b.currency), Product("espresso", 300, b.currency)}
+	}
+	return s
+}
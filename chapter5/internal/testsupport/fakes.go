@@ -0,0 +1,190 @@
+package testsupport
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/purchase"
+)
+
+// ErrDeclined is what FakeCards.Decline scripts a charge to fail with.
+var ErrDeclined = errors.New("testsupport: card declined")
+
+// Charge is a charge FakeCards was asked to make.
+type Charge struct {
+	Amount money.Money
+	Token  string
+}
+
+// FakeCards is a purchase.CardChargeService whose charges fail or succeed as scripted, in order, e.g.
+//
+//	cards := testsupport.NewFakeCards().Decline().Approve()
+//
+// declines the first charge and approves the second. Charges past the script are approved. It is safe for
+// concurrent use.
+type FakeCards struct {
+	mu      sync.Mutex
+	script  []error
+	charges []Charge
+}
+
+func NewFakeCards() *FakeCards {
+	return &FakeCards{}
+}
+
+func (c *FakeCards) Approve() *FakeCards {
+	return c.Then(nil)
+}
+
+func (c *FakeCards) Decline() *FakeCards {
+	return c.Then(ErrDeclined)
+}
+
+// Then scripts the next charge to return err, e.g. context.DeadlineExceeded for a gateway that timed out.
+func (c *FakeCards) Then(err error) *FakeCards {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.script = append(c.script, err)
+	return c
+}
+
+func (c *FakeCards) ChargeCard(_ context.Context, amount money.Money, cardToken string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.charges = append(c.charges, Charge{Amount: amount, Token: cardToken})
+	if len(c.script) == 0 {
+		return nil
+	}
+	err := c.script[0]
+	c.script = c.script[1:]
+	return err
+}
+
+// Charges are the charges asked for so far, declined ones included.
+func (c *FakeCards) Charges() []Charge {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Charge(nil), c.charges...)
+}
+
+// FakeDiscounts is a purchase.StoreService of percentages by store. Stores not in it have no discount.
+type FakeDiscounts map[uuid.UUID]float32
+
+func (d FakeDiscounts) GetStoreSpecificDiscount(_ context.Context, storeID uuid.UUID) (float32, error) {
+	return d[storeID], nil
+}
+
+// FakePurchases is a purchase.Repository that keeps purchases in memory. It is safe for concurrent use.
+type FakePurchases struct {
+	mu        sync.Mutex
+	purchases map[uuid.UUID]purchase.Purchase
+	order     []uuid.UUID
+}
+
+func NewFakePurchases() *FakePurchases {
+	return &FakePurchases{purchases: map[uuid.UUID]purchase.Purchase{}}
+}
+
+func (r *FakePurchases) Store(_ context.Context, p *purchase.Purchase) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.purchases[p.ID]; !ok {
+		r.order = append(r.order, p.ID)
+	}
+	r.purchases[p.ID] = clonePurchase(*p)
+	return nil
+}
+
+// clonePurchase copies what a purchase shares with the one it was copied from, as a repository must not
+// keep the purchases it is given.
+func clonePurchase(p purchase.Purchase) purchase.Purchase {
+	p.ProductsToPurchase = slices.Clone(p.ProductsToPurchase)
+	p.Overrides = slices.Clone(p.Overrides)
+	if p.Delivery != nil {
+		d := *p.Delivery
+		p.Delivery = &d
+	}
+	if p.CardToken != nil {
+		token := *p.CardToken
+		p.CardToken = &token
+	}
+	return p
+}
+
+func (r *FakePurchases) Get(_ context.Context, id uuid.UUID) (purchase.Purchase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.purchases[id]
+	if !ok {
+		return purchase.Purchase{}, purchase.ErrNotFound
+	}
+	return clonePurchase(p), nil
+}
+
+// Find returns the purchases that satisfy spec, oldest first.
+func (r *FakePurchases) Find(_ context.Context, spec purchase.Specification) ([]purchase.Purchase, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var found []purchase.Purchase
+	for _, id := range r.order {
+		if p := r.purchases[id]; spec.IsSatisfiedBy(p) {
+			found = append(found, clonePurchase(p))
+		}
+	}
+	slices.SortStableFunc(found, func(a, b purchase.Purchase) int { return a.PurchasedAt().Compare(b.PurchasedAt()) })
+	return found, nil
+}
+
+func (r *FakePurchases) Ping(context.Context) error {
+	return nil
+}
+
+// Stored are the purchases stored so far, in the order they were first stored.
+func (r *FakePurchases) Stored() []purchase.Purchase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := make([]purchase.Purchase, 0, len(r.order))
+	for _, id := range r.order {
+		stored = append(stored, clonePurchase(r.purchases[id]))
+	}
+	return stored
+}
+
+// Clock is a clock tests move by hand. Pass its Now to the services' WithClock options. It is safe for
+// concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock starts at now, or at 8am on 1 March 2024 UTC, a Friday, if now is zero.
+func NewClock(now time.Time) *Clock {
+	if now.IsZero() {
+		now = time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	}
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
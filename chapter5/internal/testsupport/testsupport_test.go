@@ -0,0 +1,55 @@
+package testsupport_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/testsupport"
+)
+
+func Test_AServiceTestNeedsNoSetupOfItsOwn(t *testing.T) {
+	ctx := context.Background()
+	st := testsupport.NewTestStore().Build()
+	cards := testsupport.NewFakeCards().Decline()
+	purchases := testsupport.NewFakePurchases()
+	svc := purchase.NewService(cards, purchases, testsupport.FakeDiscounts{})
+
+	b := testsupport.NewTestPurchase().WithStore(st).WithLines("latte", 450, "croissant", 325)
+	if err := svc.CompletePurchase(ctx, st.ID, b.Build(), nil); !errors.Is(err, purchase.ErrCardChargeFailed) {
+		t.Fatalf("expected the scripted decline to fail the purchase but got %v", err)
+	}
+	if err := svc.CompletePurchase(ctx, st.ID, b.Build(), nil); err != nil {
+		t.Fatalf("expected the second charge approved but got %v", err)
+	}
+
+	charges := cards.Charges()
+	if len(charges) != 2 || charges[1].Amount.Amount() != 775 || charges[1].Token != "tok_visa" {
+		t.Fatalf("expected two charges of $7.75 to tok_visa but got %+v", charges)
+	}
+	stored := purchases.Stored()
+	if len(stored) != 1 || len(stored[0].ProductsToPurchase) != 2 {
+		t.Fatalf("expected the approved purchase of two lines stored but got %+v", stored)
+	}
+
+	cash := testsupport.NewTestPurchase().WithMeans(payment.MEANS_CASH).Build()
+	if cash.CardToken != nil || cash.ProductsToPurchase[0].ItemName != "latte" {
+		t.Fatalf("expected a cash purchase of a latte without a card token but got %+v", cash)
+	}
+}
+
+func Test_TheClockOnlyMovesWhenTold(t *testing.T) {
+	clock := testsupport.NewClock(time.Time{})
+	start := clock.Now()
+	time.Sleep(time.Millisecond)
+	if !clock.Now().Equal(start) {
+		t.Fatal("expected the clock to stand still")
+	}
+	clock.Advance(time.Hour)
+	if got := clock.Now().Sub(start); got != time.Hour {
+		t.Fatalf("expected the clock an hour on but it moved %s", got)
+	}
+}
@@ -0,0 +1,73 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// loader batches the lookups resolvers make while a query is executed, so resolving the store of fifty
+// purchases costs one repository call instead of fifty. It also caches results, and is meant to live for
+// a single request.
+type loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+	wait  time.Duration
+
+	mu      sync.Mutex
+	results map[K]*result[V]
+	pending []K
+}
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	found bool
+	err   error
+}
+
+func newLoader[K comparable, V any](wait time.Duration, fetch func(ctx context.Context, keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{fetch: fetch, wait: wait, results: map[K]*result[V]{}}
+}
+
+// Load returns the value for key, and false if the batch function did not return one.
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, bool, error) {
+	l.mu.Lock()
+	r, ok := l.results[key]
+	if !ok {
+		r = &result[V]{done: make(chan struct{})}
+		l.results[key] = r
+		if len(l.pending) == 0 {
+			// The first key of a batch waits a moment for the resolvers running alongside it.
+			time.AfterFunc(l.wait, func() { l.dispatch(context.WithoutCancel(ctx)) })
+		}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.value, r.found, r.err
+	case <-ctx.Done():
+		var zero V
+		return zero, false, ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	batch := make([]*result[V], len(keys))
+	for i, k := range keys {
+		batch[i] = l.results[k]
+	}
+	l.mu.Unlock()
+
+	values, err := l.fetch(ctx, keys)
+	for i, k := range keys {
+		r := batch[i]
+		r.err = err
+		r.value, r.found = values[k]
+		close(r.done)
+	}
+}
@@ -0,0 +1,285 @@
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/store"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// batchWait is how long a loader waits for more keys before fetching.
+const batchWait = 2 * time.Millisecond
+
+type PurchaseHistory interface {
+	ForCustomer(ctx context.Context, customerID uuid.UUID, limit int64) ([]projection.HistoryEntry, error)
+}
+
+type StoreService interface {
+	ListStores(ctx context.Context) ([]store.Store, error)
+	GetStores(ctx context.Context, ids []uuid.UUID) ([]store.Store, error)
+	GetStoreDiscounts(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error)
+}
+
+type LoyaltyCards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+}
+
+// NewHandler serves the mobile app's GraphQL API. Every request gets its own loaders, so batching and
+// caching never leak between requests.
+func NewHandler(history PurchaseHistory, stores StoreService, cards LoyaltyCards) (http.Handler, error) {
+	if history == nil {
+		return nil, errors.New("purchase history cannot be nil")
+	}
+	if stores == nil {
+		return nil, errors.New("store service cannot be nil")
+	}
+	if cards == nil {
+		return nil, errors.New("loyalty cards cannot be nil")
+	}
+	s, err := graphql.ParseSchema(schema, &queryResolver{history: history, stores: stores, cards: cards})
+	if err != nil {
+		return nil, err
+	}
+	h := &relay.Handler{Schema: s}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(withLoaders(r.Context(), stores)))
+	}), nil
+}
+
+type loadersKey struct{}
+
+type loaders struct {
+	stores    *loader[uuid.UUID, store.Store]
+	discounts *loader[uuid.UUID, int64]
+}
+
+func withLoaders(ctx context.Context, stores StoreService) context.Context {
+	return context.WithValue(ctx, loadersKey{}, &loaders{
+		stores: newLoader(batchWait, func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]store.Store, error) {
+			found, err := stores.GetStores(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			res := make(map[uuid.UUID]store.Store, len(found))
+			for _, s := range found {
+				res[s.ID] = s
+			}
+			return res, nil
+		}),
+		discounts: newLoader(batchWait, stores.GetStoreDiscounts),
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+type queryResolver struct {
+	history PurchaseHistory
+	stores  StoreService
+	cards   LoyaltyCards
+}
+
+func parseID(id graphql.ID) (uuid.UUID, error) {
+	u, err := uuid.Parse(string(id))
+	if err != nil {
+		return uuid.Nil, errors.New("id must be a UUID")
+	}
+	return u, nil
+}
+
+func (q *queryResolver) Customer(args struct{ ID graphql.ID }) (*customerResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &customerResolver{q: q, id: id}, nil
+}
+
+func (q *queryResolver) Stores(ctx context.Context) ([]*storeResolver, error) {
+	stores, err := q.stores.ListStores(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*storeResolver, 0, len(stores))
+	for _, s := range stores {
+		res = append(res, &storeResolver{s: s})
+	}
+	return res, nil
+}
+
+func (q *queryResolver) Store(ctx context.Context, args struct{ ID graphql.ID }) (*storeResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return loadStore(ctx, id)
+}
+
+func (q *queryResolver) LoyaltyCard(ctx context.Context, args struct{ ID graphql.ID }) (*loyaltyCardResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	card, err := q.cards.Get(ctx, id)
+	if errors.Is(err, loyalty.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &loyaltyCardResolver{card: card}, nil
+}
+
+func loadStore(ctx context.Context, id uuid.UUID) (*storeResolver, error) {
+	s, found, err := loadersFrom(ctx).stores.Load(ctx, id)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &storeResolver{s: s}, nil
+}
+
+type customerResolver struct {
+	q  *queryResolver
+	id uuid.UUID
+}
+
+func (c *customerResolver) ID() graphql.ID {
+	return graphql.ID(c.id.String())
+}
+
+func (c *customerResolver) Purchases(ctx context.Context, args struct{ Limit int32 }) ([]*purchaseResolver, error) {
+	entries, err := c.q.history.ForCustomer(ctx, c.id, int64(args.Limit))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*purchaseResolver, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, &purchaseResolver{e: e})
+	}
+	return res, nil
+}
+
+type purchaseResolver struct {
+	e projection.HistoryEntry
+}
+
+func (p *purchaseResolver) ID() graphql.ID {
+	return graphql.ID(p.e.PurchaseID)
+}
+
+func (p *purchaseResolver) Store(ctx context.Context) (*storeResolver, error) {
+	id, err := uuid.Parse(p.e.StoreID)
+	if err != nil {
+		return nil, nil
+	}
+	return loadStore(ctx, id)
+}
+
+func (p *purchaseResolver) Items() []string {
+	return p.e.Items
+}
+
+func (p *purchaseResolver) Total() *moneyResolver {
+	return &moneyResolver{m: money.New(p.e.Total, p.e.Currency)}
+}
+
+func (p *purchaseResolver) PurchasedAt() graphql.Time {
+	return graphql.Time{Time: p.e.PurchasedAt}
+}
+
+type storeResolver struct {
+	s store.Store
+}
+
+func (s *storeResolver) ID() graphql.ID {
+	return graphql.ID(s.s.ID.String())
+}
+
+func (s *storeResolver) Location() string {
+	return s.s.Location
+}
+
+func (s *storeResolver) Menu(ctx context.Context) ([]*menuItemResolver, error) {
+	discount, _, err := loadersFrom(ctx).discounts.Load(ctx, s.s.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*menuItemResolver, 0, len(s.s.ProductsForSale))
+	for _, p := range s.s.ProductsForSale {
+		base := p.BasePrice
+		price := money.New(base.Amount()*(100-discount)/100, base.Currency().Code)
+		res = append(res, &menuItemResolver{name: p.ItemName, price: price, base: &base})
+	}
+	return res, nil
+}
+
+type menuItemResolver struct {
+	name        string
+	price, base *money.Money
+}
+
+func (m *menuItemResolver) Name() string {
+	return m.name
+}
+
+func (m *menuItemResolver) Price() *moneyResolver {
+	return &moneyResolver{m: m.price}
+}
+
+func (m *menuItemResolver) BasePrice() *moneyResolver {
+	return &moneyResolver{m: m.base}
+}
+
+type loyaltyCardResolver struct {
+	card *loyalty.CoffeeBux
+}
+
+func (l *loyaltyCardResolver) ID() graphql.ID {
+	return graphql.ID(l.card.ID.String())
+}
+
+func (l *loyaltyCardResolver) CustomerID() graphql.ID {
+	return graphql.ID(l.card.CustomerID().String())
+}
+
+func (l *loyaltyCardResolver) Store(ctx context.Context) (*storeResolver, error) {
+	return loadStore(ctx, l.card.StoreID())
+}
+
+func (l *loyaltyCardResolver) FreeDrinksAvailable() int32 {
+	return int32(l.card.FreeDrinksAvailable)
+}
+
+func (l *loyaltyCardResolver) PurchasesUntilFreeDrink() int32 {
+	return int32(l.card.RemainingDrinkPurchasesUntilFreeDrink)
+}
+
+type moneyResolver struct {
+	m *money.Money
+}
+
+func (m *moneyResolver) Amount() int32 {
+	return int32(m.m.Amount())
+}
+
+func (m *moneyResolver) Currency() string {
+	return m.m.Currency().Code
+}
+
+func (m *moneyResolver) Display() string {
+	return m.m.Display()
+}
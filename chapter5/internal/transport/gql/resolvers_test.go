@@ -0,0 +1,137 @@
+package gql_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/store"
+	"coffeeco/internal/transport/gql"
+)
+
+type fakeHistory []projection.HistoryEntry
+
+func (f fakeHistory) ForCustomer(context.Context, uuid.UUID, int64) ([]projection.HistoryEntry, error) {
+	return f, nil
+}
+
+type fakeStores struct {
+	mu      sync.Mutex
+	stores  map[uuid.UUID]store.Store
+	batches [][]uuid.UUID
+}
+
+func (f *fakeStores) ListStores(context.Context) ([]store.Store, error) {
+	var res []store.Store
+	for _, s := range f.stores {
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func (f *fakeStores) GetStores(_ context.Context, ids []uuid.UUID) ([]store.Store, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, ids)
+	var res []store.Store
+	for _, id := range ids {
+		if s, ok := f.stores[id]; ok {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeStores) GetStoreDiscounts(_ context.Context, ids []uuid.UUID) (map[uuid.UUID]int64, error) {
+	res := map[uuid.UUID]int64{}
+	for _, id := range ids {
+		res[id] = 10
+	}
+	return res, nil
+}
+
+func query(t *testing.T, h http.Handler, q string, out any) {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"query": q})
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body))))
+	var res struct {
+		Data   json.RawMessage
+		Errors []struct{ Message string }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(res.Errors) > 0 {
+		t.Fatalf("expected no errors but got %+v", res.Errors)
+	}
+	if err := json.Unmarshal(res.Data, out); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_PurchaseStoresAreLoadedInOneBatch(t *testing.T) {
+	soho, camden := uuid.New(), uuid.New()
+	stores := &fakeStores{stores: map[uuid.UUID]store.Store{
+		soho:   store.New(soho, "Soho"),
+		camden: store.New(camden, "Camden"),
+	}}
+	history := fakeHistory{
+		{PurchaseID: uuid.NewString(), StoreID: soho.String(), Total: 350, Currency: "USD", PurchasedAt: time.Now()},
+		{PurchaseID: uuid.NewString(), StoreID: camden.String(), Total: 400, Currency: "USD", PurchasedAt: time.Now()},
+		{PurchaseID: uuid.NewString(), StoreID: soho.String(), Total: 300, Currency: "USD", PurchasedAt: time.Now()},
+	}
+	h, err := gql.NewHandler(history, stores, loyalty.NewMemoryRepo())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	var data struct {
+		Customer struct {
+			Purchases []struct {
+				Store struct{ Location string }
+			}
+		}
+	}
+	query(t, h, `{ customer(id: "`+uuid.NewString()+`") { purchases { store { location } } } }`, &data)
+
+	if len(data.Customer.Purchases) != 3 || data.Customer.Purchases[1].Store.Location != "Camden" {
+		t.Fatalf("expected 3 purchases with their stores but got %+v", data)
+	}
+	if len(stores.batches) != 1 || len(stores.batches[0]) != 2 {
+		t.Fatalf("expected one batch of 2 stores but got %v", stores.batches)
+	}
+}
+
+func Test_MenuShowsStorePrices(t *testing.T) {
+	id := uuid.New()
+	stores := &fakeStores{stores: map[uuid.UUID]store.Store{
+		id: store.New(id, "Soho", coffeeco.Product{ItemName: "latte", BasePrice: *money.New(400, "USD")}),
+	}}
+	h, _ := gql.NewHandler(fakeHistory{}, stores, loyalty.NewMemoryRepo())
+
+	var data struct {
+		Store struct {
+			Menu []struct {
+				Name  string
+				Price struct{ Amount int }
+			}
+		}
+	}
+	query(t, h, `{ store(id: "`+id.String()+`") { menu { name price { amount } } } }`, &data)
+
+	if len(data.Store.Menu) != 1 || data.Store.Menu[0].Price.Amount != 360 {
+		t.Fatalf("expected the latte at the discounted 360 but got %+v", data)
+	}
+}
@@ -0,0 +1,122 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/validation"
+)
+
+type Adjustments interface {
+	Adjust(ctx context.Context, purchaseID uuid.UUID, to adjustment.Attribution, reason string) (*adjustment.Adjustment, error)
+	ForPurchase(ctx context.Context, purchaseID uuid.UUID) ([]*adjustment.Adjustment, error)
+}
+
+// WithAdjustments lets finance correct the store or tax of stored purchases at
+// /v2/purchases/{purchaseID}/adjustments.
+func WithAdjustments(a Adjustments) Option {
+	return func(h *Handler) {
+		h.adjustments = a
+	}
+}
+
+type AdjustmentRequest struct {
+	// StoreID moves the sale to another store; absent keeps the store it is reported at.
+	StoreID *uuid.UUID `json:"storeId,omitempty"`
+	// TaxPercent is the sales tax the purchase's prices include; absent keeps the rate it is reported at.
+	TaxPercent *float64 `json:"taxPercent,omitempty"`
+	Reason     string   `json:"reason"`
+}
+
+func (r AdjustmentRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.StoreID != nil || r.TaxPercent != nil, "storeId", "or taxPercent is required")
+	v.Check(r.StoreID == nil || *r.StoreID != uuid.Nil, "storeId", "must not be the nil UUID")
+	v.Check(r.TaxPercent == nil || *r.TaxPercent >= 0 && *r.TaxPercent < 100, "taxPercent", "must be at least 0 and below 100")
+	v.Check(r.Reason != "", "reason", "is required")
+	return v.Err()
+}
+
+type AdjustmentResponse struct {
+	ID         uuid.UUID `json:"id"`
+	PurchaseID uuid.UUID `json:"purchaseId"`
+	WasStoreID uuid.UUID `json:"wasStoreId"`
+	StoreID    uuid.UUID `json:"storeId"`
+	// WasTaxPercent and TaxPercent are absent for the default rate.
+	WasTaxPercent *float64  `json:"wasTaxPercent,omitempty"`
+	TaxPercent    *float64  `json:"taxPercent,omitempty"`
+	Reason        string    `json:"reason"`
+	By            string    `json:"by"`
+	At            time.Time `json:"at"`
+}
+
+type AdjustmentListResponse struct {
+	Adjustments []AdjustmentResponse `json:"adjustments"`
+}
+
+func toAdjustmentResponse(a *adjustment.Adjustment) AdjustmentResponse {
+	return AdjustmentResponse{
+		ID:            a.ID,
+		PurchaseID:    a.PurchaseID,
+		WasStoreID:    a.Was.StoreID,
+		StoreID:       a.Now.StoreID,
+		WasTaxPercent: a.Was.TaxPercent,
+		TaxPercent:    a.Now.TaxPercent,
+		Reason:        a.Reason,
+		By:            a.By,
+		At:            a.At,
+	}
+}
+
+// AdjustPurchase corrects how a purchase is reported. The purchase itself stays as it was paid.
+func (h Handler) AdjustPurchase(w http.ResponseWriter, r *http.Request, purchaseID uuid.UUID, req AdjustmentRequest) {
+	if !h.canAdjust(w, r, purchaseID) {
+		return
+	}
+	to := adjustment.Attribution{TaxPercent: req.TaxPercent}
+	if req.StoreID != nil {
+		to.StoreID = *req.StoreID
+	}
+	a, err := h.adjustments.Adjust(r.Context(), purchaseID, to, req.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAdjustmentResponse(a))
+}
+
+// ListAdjustments lists the adjustments of a purchase, oldest first.
+func (h Handler) ListAdjustments(w http.ResponseWriter, r *http.Request, purchaseID uuid.UUID) {
+	if !h.canAdjust(w, r, purchaseID) {
+		return
+	}
+	adjustments, err := h.adjustments.ForPurchase(r.Context(), purchaseID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := AdjustmentListResponse{Adjustments: make([]AdjustmentResponse, 0, len(adjustments))}
+	for _, a := range adjustments {
+		resp.Adjustments = append(resp.Adjustments, toAdjustmentResponse(a))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// canAdjust answers the request and returns false unless adjustments are served, the purchase exists and
+// the caller may adjust it.
+func (h Handler) canAdjust(w http.ResponseWriter, r *http.Request, purchaseID uuid.UUID) bool {
+	if h.adjustments == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no adjustments"}})
+		return false
+	}
+	if _, err := h.getPurchase(r.Context(), purchaseID, auth.ActionAdjustPurchase); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
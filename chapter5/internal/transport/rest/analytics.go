@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/validation"
+)
+
+type Analytics interface {
+	SalesByHour(ctx context.Context, q analytics.Query) ([]analytics.HourSales, error)
+	SalesByStore(ctx context.Context, q analytics.Query) ([]analytics.StoreSales, error)
+	SalesByChannel(ctx context.Context, q analytics.Query) ([]analytics.ChannelSales, error)
+	SalesByProduct(ctx context.Context, q analytics.Query) ([]analytics.ProductSales, error)
+	AverageTicket(ctx context.Context, q analytics.Query) ([]analytics.Totals, error)
+	Discounts(ctx context.Context, q analytics.Query) ([]analytics.DiscountSales, error)
+	Loyalty(ctx context.Context, q analytics.Query) ([]analytics.LoyaltyConversion, error)
+	CupsSavedByStore(ctx context.Context, q analytics.Query) ([]analytics.StoreCups, error)
+	CupsSavedByCustomer(ctx context.Context, q analytics.Query) ([]analytics.CustomerCups, error)
+	Settlements(ctx context.Context, q analytics.Query) ([]analytics.PayeeSettlement, error)
+	Rounding(ctx context.Context, q analytics.Query) ([]analytics.StoreRounding, error)
+	PriceOverrides(ctx context.Context, q analytics.Query) ([]analytics.StoreOverrides, error)
+	Taxes(ctx context.Context, q analytics.Query) ([]analytics.StoreTax, error)
+}
+
+// WithAnalytics serves the analytics reports under /v2/analytics, to analysts and to managers for their
+// own stores.
+func WithAnalytics(a Analytics) Option {
+	return func(h *Handler) {
+		h.analytics = a
+	}
+}
+
+// report serves a report for ?from=&to= (RFC 3339; to defaults to now), optionally one or more &store=
+// and a &tz= time zone such as Europe/London. The rows are JSON, or CSV with &format=csv or Accept: text/csv.
+func report[T any](h *Handler, name string, run func(a Analytics, ctx context.Context, q analytics.Query) ([]T, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := analyticsQuery(r)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		resources := []auth.Resource{{}}
+		if len(q.StoreIDs) > 0 {
+			resources = resources[:0]
+			for _, id := range q.StoreIDs {
+				resources = append(resources, auth.Resource{StoreID: id})
+			}
+		}
+		for _, res := range resources {
+			if err := h.authorize(r.Context(), auth.ActionViewAnalytics, res); err != nil {
+				writeError(w, r, err)
+				return
+			}
+		}
+		if h.analytics == nil {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no analytics"}})
+			return
+		}
+
+		rows, err := run(h.analytics, r.Context(), q)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if r.URL.Query().Get("format") == "csv" || r.Header.Get("Accept") == "text/csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+			_ = analytics.WriteCSV(w, rows)
+			return
+		}
+		if rows == nil {
+			rows = []T{}
+		}
+		writeJSON(w, http.StatusOK, rows)
+	}
+}
+
+func analyticsQuery(r *http.Request) (analytics.Query, error) {
+	params := r.URL.Query()
+	q := analytics.Query{To: time.Now()}
+	var v validation.Validator
+	var err error
+	if q.From, err = time.Parse(time.RFC3339, params.Get("from")); err != nil {
+		v.Add("from", "must be an RFC 3339 time")
+	}
+	if s := params.Get("to"); s != "" {
+		q.To, err = time.Parse(time.RFC3339, s)
+		v.Check(err == nil && q.To.After(q.From), "to", "must be an RFC 3339 time after from")
+	}
+	for _, s := range params["store"] {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			v.Add("store", "must be a UUID")
+			continue
+		}
+		q.StoreIDs = append(q.StoreIDs, id)
+	}
+	if s := params.Get("tz"); s != "" {
+		q.Location, err = time.LoadLocation(s)
+		v.Check(err == nil, "tz", "must be an IANA time zone, e.g. Europe/London")
+	}
+	if f := params.Get("format"); f != "" {
+		v.Check(f == "csv" || f == "json", "format", "must be csv or json")
+	}
+	return q, v.Err()
+}
@@ -0,0 +1,84 @@
+package rest_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/events"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/transport/rest"
+)
+
+func Test_AnalyticsAreExportedToAnalystsAndManagersOfTheStore(t *testing.T) {
+	soho, camden := uuid.New(), uuid.New()
+	facts := analytics.NewMemoryStore()
+	for _, storeID := range []uuid.UUID{soho, camden} {
+		msg, _ := events.NewMessage(purchase.Completed{
+			PurchaseID:  uuid.New(),
+			StoreID:     storeID,
+			Lines:       []purchase.CompletedLine{{ItemName: "latte", Amount: 400}},
+			Total:       400,
+			Currency:    "USD",
+			PurchasedAt: time.Now().Add(-time.Hour),
+		}, events.JSONCodec{})
+		if err := analytics.NewFacts(facts).Handle(context.Background(), msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	h, err := rest.NewHandler(&fakePurchases{}, fakeStores{}, loyalty.NewMemoryRepo(),
+		rest.WithAnalytics(analytics.NewService(facts)),
+		rest.WithAuthenticator(tokens{
+			"analyst": {Roles: []auth.Role{auth.RoleAnalyst}},
+			"manager": {Roles: []auth.Role{auth.RoleManager}, Stores: []uuid.UUID{soho}},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	from := "from=" + time.Now().Add(-24*time.Hour).UTC().Format(time.RFC3339)
+	tests := map[string]struct {
+		query, token string
+		status       int
+		body         string
+	}{
+		"every store for analysts":       {from + "&format=csv", "analyst", http.StatusOK, "store_id,currency,purchases,revenue,average_ticket\n"},
+		"their store for managers":       {from + "&format=csv&store=" + soho.String(), "manager", http.StatusOK, "store_id,currency,purchases,revenue,average_ticket\n" + soho.String() + ",USD,1,400,400\n"},
+		"not every store for managers":   {from, "manager", http.StatusForbidden, ""},
+		"not another store for managers": {from + "&store=" + camden.String(), "manager", http.StatusForbidden, ""},
+		"a period is needed":             {"store=" + soho.String(), "manager", http.StatusBadRequest, ""},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v2/analytics/sales-by-store?"+tc.query, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %d but got %d: %s", tc.status, resp.StatusCode, body)
+			}
+			if tc.status == http.StatusOK && tc.token == "manager" && string(body) != tc.body {
+				t.Fatalf("expected %q but got %q", tc.body, body)
+			}
+			if tc.status == http.StatusOK && tc.token == "analyst" && strings.Count(string(body), "\n") != 3 {
+				t.Fatalf("expected both stores but got %q", body)
+			}
+		})
+	}
+}
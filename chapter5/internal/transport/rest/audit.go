@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"coffeeco/internal/audit"
+	"coffeeco/internal/auth"
+)
+
+type AuditLog interface {
+	Query(ctx context.Context, q audit.Query) ([]audit.Entry, error)
+}
+
+// WithAuditLog serves the audit log at /v2/audit, to admins only.
+func WithAuditLog(l AuditLog) Option {
+	return func(h *Handler) {
+		h.audit = l
+	}
+}
+
+type AuditEntriesResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+// ListAuditEntries answers ?from=&to= (RFC 3339; to defaults to now), optionally &actor= and &limit=.
+func (h Handler) ListAuditEntries(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorize(r.Context(), auth.ActionViewAudit, auth.Resource{}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.audit == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there is no audit log"}})
+		return
+	}
+
+	params := r.URL.Query()
+	q := audit.Query{Actor: params.Get("actor"), To: time.Now()}
+	var verr ValidationError
+	var err error
+	if q.From, err = time.Parse(time.RFC3339, params.Get("from")); err != nil {
+		verr.Fields = append(verr.Fields, FieldError{Field: "from", Message: "must be an RFC 3339 time"})
+	}
+	if v := params.Get("to"); v != "" {
+		if q.To, err = time.Parse(time.RFC3339, v); err != nil || !q.To.After(q.From) {
+			verr.Fields = append(verr.Fields, FieldError{Field: "to", Message: "must be an RFC 3339 time after from"})
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 1 || q.Limit > 1000 {
+			verr.Fields = append(verr.Fields, FieldError{Field: "limit", Message: "must be between 1 and 1000"})
+		}
+	}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, &verr)
+		return
+	}
+
+	entries, err := h.audit.Query(r.Context(), q)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+	writeJSON(w, http.StatusOK, AuditEntriesResponse{Entries: entries})
+}
@@ -0,0 +1,170 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/store"
+	"coffeeco/internal/transport/rest"
+)
+
+// tokens authenticates a bearer token by looking it up.
+type tokens map[string]auth.Principal
+
+func (t tokens) Authenticate(_ context.Context, token string) (auth.Principal, error) {
+	p, ok := t[token]
+	if !ok {
+		return auth.Principal{}, errors.New("unknown token")
+	}
+	return p, nil
+}
+
+func Test_RequestsNeedAValidTokenAndPermission(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: bob})
+	_ = cards.Save(context.Background(), card)
+
+	h, err := rest.NewHandler(&fakePurchases{}, fakeStores{}, cards, rest.WithAuthenticator(tokens{
+		"alice": {Roles: []auth.Role{auth.RoleCustomer}, CustomerID: alice},
+		"bob":   {Roles: []auth.Role{auth.RoleCustomer}, CustomerID: bob},
+	}))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	tests := map[string]struct {
+		path, token string
+		status      int
+	}{
+		"no token":             {"/v2/loyalty-cards/" + card.ID.String(), "", http.StatusUnauthorized},
+		"unknown token":        {"/v2/loyalty-cards/" + card.ID.String(), "mallory", http.StatusUnauthorized},
+		"someone else's card":  {"/v2/loyalty-cards/" + card.ID.String(), "alice", http.StatusForbidden},
+		"own card":             {"/v2/loyalty-cards/" + card.ID.String(), "bob", http.StatusOK},
+		"openapi is public":    {"/openapi.json", "", http.StatusOK},
+		"stores for signed in": {"/v2/stores", "alice", http.StatusOK},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %d but got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_CustomersCannotPayWithSomeoneElsesCard(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	cards := loyalty.NewMemoryRepo()
+	card := loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: bob})
+	_ = cards.Save(context.Background(), card)
+	purchases := &fakePurchases{}
+	h, _ := rest.NewHandler(purchases, fakeStores{}, cards, rest.WithAuthenticator(tokens{
+		"alice": {Roles: []auth.Role{auth.RoleCustomer}, CustomerID: alice},
+	}))
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	body := `{"storeId":"` + uuid.NewString() + `","customerId":"` + alice.String() + `","payment":{"means":"coffeebux","loyaltyCardId":"` + card.ID.String() + `"},
+		"lines":[{"product":"latte","quantity":1,"unitPrice":{"amount":400,"currency":"USD"}}]}`
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v2/purchases", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || len(purchases.completed) != 0 {
+		t.Fatalf("expected 403 and no purchase but got %d and %d purchases", resp.StatusCode, len(purchases.completed))
+	}
+}
+
+func Test_OnlyManagersOverridePrices(t *testing.T) {
+	storeID := uuid.New()
+	purchases := &fakePurchases{}
+	h, _ := rest.NewHandler(purchases, fakeStores{}, loyalty.NewMemoryRepo(), rest.WithAuthenticator(tokens{
+		"barista": {Roles: []auth.Role{auth.RoleBarista}, Stores: []uuid.UUID{storeID}},
+		"manager": {Roles: []auth.Role{auth.RoleManager}, Stores: []uuid.UUID{storeID}},
+	}))
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	body := `{"storeId":"` + storeID.String() + `","payment":{"means":"cash"},
+		"lines":[{"product":"latte","quantity":2,"unitPrice":{"amount":400,"currency":"USD"}}],
+		"overrides":[{"line":0,"price":{"amount":0,"currency":"USD"},"reason":"remake","note":"spilled"}]}`
+	for token, status := range map[string]int{"barista": http.StatusForbidden, "manager": http.StatusCreated} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/v2/purchases", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Fatalf("expected %d for the %s but got %d", status, token, resp.StatusCode)
+		}
+	}
+	if len(purchases.completed) != 1 || len(purchases.completed[0].Overrides) != 2 {
+		t.Fatalf("expected the manager's purchase with both lattes overridden but got %+v", purchases.completed)
+	}
+}
+
+func Test_TrainingModeOnlyTakesPurchasesFromTheStaff(t *testing.T) {
+	storeID, alice := uuid.New(), uuid.New()
+	purchases := &fakePurchases{}
+	h, _ := rest.NewHandler(purchases, fakeStores{}, loyalty.NewMemoryRepo(), rest.WithAuthenticator(tokens{
+		"barista": {Subject: "barista-1", Roles: []auth.Role{auth.RoleBarista}, Stores: []uuid.UUID{storeID}},
+		"alice":   {Roles: []auth.Role{auth.RoleCustomer}, CustomerID: alice},
+	}))
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	body := `{"storeId":"` + storeID.String() + `","customerId":"` + alice.String() + `","payment":{"means":"cash"},
+		"lines":[{"product":"latte","quantity":1,"unitPrice":{"amount":400,"currency":"USD"}}]}`
+	tests := map[string]struct {
+		method, path, token, body string
+		status                    int
+	}{
+		"barista takes a purchase": {http.MethodPost, "/v2/purchases", "barista", body, http.StatusCreated},
+		"customers do not train":   {http.MethodPost, "/v2/purchases", "alice", body, http.StatusForbidden},
+		"nothing else is practice": {http.MethodPut, "/v2/purchases/" + uuid.NewString() + "/status", "barista", `{"status":"preparing"}`, http.StatusUnprocessableEntity},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			req.Header.Set("X-Sandbox", "true")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.status || resp.Header.Get("X-Sandbox") != "true" {
+				t.Fatalf("expected %d in training mode but got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+	if len(purchases.completed) != 1 || purchases.completed[0].ServedBy != "barista-1" {
+		t.Fatalf("expected the barista's practice purchase but got %+v", purchases.completed)
+	}
+}
@@ -0,0 +1,282 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/cash"
+	"coffeeco/internal/validation"
+)
+
+type Cash interface {
+	Open(ctx context.Context, storeID uuid.UUID, float money.Money) (*cash.Session, error)
+	Current(ctx context.Context, storeID uuid.UUID) (*cash.Session, error)
+	Drop(ctx context.Context, storeID uuid.UUID, amount money.Money, bag string) (*cash.Session, error)
+	Close(ctx context.Context, storeID uuid.UUID, counted money.Money, note string) (*cash.Session, error)
+	Deposit(ctx context.Context, storeID uuid.UUID, amount money.Money, slip string) (*cash.Deposit, error)
+	Sessions(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*cash.Session, error)
+	Deposits(ctx context.Context, storeID uuid.UUID, from, to time.Time) ([]*cash.Deposit, error)
+}
+
+// WithCash lets baristas and managers run the drawer of their store at /v2/stores/{storeID}/drawer, and
+// managers bank its cash and reconcile it.
+func WithCash(c Cash) Option {
+	return func(h *Handler) {
+		h.cash = c
+	}
+}
+
+type OpenDrawerRequest struct {
+	// Float is the cash counted into the drawer to give change with; it may be nothing.
+	Float Money `json:"float"`
+}
+
+func (r OpenDrawerRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Float.Amount >= 0, "float.amount", "must not be negative")
+	v.Check(money.GetCurrency(r.Float.Currency) != nil, "float.currency", "must be an ISO 4217 code")
+	return v.Err()
+}
+
+type SafeDropRequest struct {
+	Amount Money `json:"amount"`
+	// Bag is the number of the sealed bag the cash went into.
+	Bag string `json:"bag"`
+}
+
+func (r SafeDropRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	v.Check(r.Bag != "", "bag", "is required")
+	return v.Err()
+}
+
+type CloseDrawerRequest struct {
+	Counted Money `json:"counted"`
+	// Note is anything the manager should know about the count, e.g. a note found in the drawer.
+	Note string `json:"note,omitempty"`
+}
+
+func (r CloseDrawerRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Counted.Amount >= 0, "counted.amount", "must not be negative")
+	v.Check(money.GetCurrency(r.Counted.Currency) != nil, "counted.currency", "must be an ISO 4217 code")
+	return v.Err()
+}
+
+type DepositRequest struct {
+	Amount Money `json:"amount"`
+	// Slip is the number of the bank's deposit slip.
+	Slip string `json:"slip"`
+}
+
+func (r DepositRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	v.Check(r.Slip != "", "slip", "is required")
+	return v.Err()
+}
+
+type SafeDropResponse struct {
+	Amount Money     `json:"amount"`
+	Bag    string    `json:"bag"`
+	By     string    `json:"by"`
+	At     time.Time `json:"at"`
+}
+
+type DrawerSessionResponse struct {
+	ID       uuid.UUID          `json:"id"`
+	StoreID  uuid.UUID          `json:"storeId"`
+	Status   string             `json:"status" enum:"open,closed"`
+	Float    Money              `json:"float"`
+	OpenedBy string             `json:"openedBy"`
+	OpenedAt time.Time          `json:"openedAt"`
+	Drops    []SafeDropResponse `json:"drops"`
+	ClosedBy string             `json:"closedBy,omitempty"`
+	ClosedAt *time.Time         `json:"closedAt,omitempty"`
+	// CashSales is what the cash purchases took while the drawer was open, and Expected the float and
+	// them less the drops. They are only known once it is closed.
+	CashSales   *Money `json:"cashSales,omitempty"`
+	Expected    *Money `json:"expected,omitempty"`
+	Counted     *Money `json:"counted,omitempty"`
+	Discrepancy *Money `json:"discrepancy,omitempty"`
+	Flagged     bool   `json:"flagged"`
+	Note        string `json:"note,omitempty"`
+}
+
+type DepositResponse struct {
+	ID      uuid.UUID `json:"id"`
+	StoreID uuid.UUID `json:"storeId"`
+	Amount  Money     `json:"amount"`
+	Slip    string    `json:"slip"`
+	By      string    `json:"by"`
+	At      time.Time `json:"at"`
+	// Expected is what the Drops made since the previous deposit add up to.
+	Drops       int   `json:"drops"`
+	Expected    Money `json:"expected"`
+	Discrepancy Money `json:"discrepancy"`
+	Flagged     bool  `json:"flagged"`
+}
+
+type CashReportResponse struct {
+	Sessions []DrawerSessionResponse `json:"sessions"`
+	Deposits []DepositResponse       `json:"deposits"`
+}
+
+func toDrawerSessionResponse(s *cash.Session) DrawerSessionResponse {
+	amount := func(a int64) Money { return toMoney(*money.New(a, s.Currency)) }
+	resp := DrawerSessionResponse{
+		ID:       s.ID,
+		StoreID:  s.StoreID,
+		Status:   "open",
+		Float:    amount(s.Float),
+		OpenedBy: s.OpenedBy,
+		OpenedAt: s.OpenedAt,
+		Drops:    make([]SafeDropResponse, 0, len(s.Drops)),
+		Flagged:  s.Flagged,
+		Note:     s.Note,
+	}
+	for _, d := range s.Drops {
+		resp.Drops = append(resp.Drops, SafeDropResponse{Amount: amount(d.Amount), Bag: d.Bag, By: d.By, At: d.At})
+	}
+	if s.Closed() {
+		at := s.ClosedAt
+		cashSales, expected, counted, discrepancy := amount(s.CashSales), amount(s.Expected()), amount(s.Counted), amount(s.Discrepancy())
+		resp.Status, resp.ClosedBy, resp.ClosedAt = "closed", s.ClosedBy, &at
+		resp.CashSales, resp.Expected, resp.Counted, resp.Discrepancy = &cashSales, &expected, &counted, &discrepancy
+	}
+	return resp
+}
+
+func toDepositResponse(d *cash.Deposit) DepositResponse {
+	amount := func(a int64) Money { return toMoney(*money.New(a, d.Currency)) }
+	return DepositResponse{
+		ID:          d.ID,
+		StoreID:     d.StoreID,
+		Amount:      amount(d.Amount),
+		Slip:        d.Slip,
+		By:          d.By,
+		At:          d.At,
+		Drops:       d.Drops,
+		Expected:    amount(d.Expected),
+		Discrepancy: amount(d.Discrepancy()),
+		Flagged:     d.Flagged,
+	}
+}
+
+// OpenDrawer starts a session of the store's drawer with its float. It answers 409 if the drawer is open.
+func (h Handler) OpenDrawer(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req OpenDrawerRequest) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionHandleCash) {
+		return
+	}
+	s, err := h.cash.Open(r.Context(), storeID, *money.New(req.Float.Amount, req.Float.Currency))
+	h.writeDrawerSession(w, r, s, err, http.StatusCreated)
+}
+
+func (h Handler) GetDrawer(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionHandleCash) {
+		return
+	}
+	s, err := h.cash.Current(r.Context(), storeID)
+	h.writeDrawerSession(w, r, s, err, http.StatusOK)
+}
+
+// DropToSafe records cash taken from the open drawer to the safe.
+func (h Handler) DropToSafe(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req SafeDropRequest) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionHandleCash) {
+		return
+	}
+	s, err := h.cash.Drop(r.Context(), storeID, *money.New(req.Amount.Amount, req.Amount.Currency), req.Bag)
+	h.writeDrawerSession(w, r, s, err, http.StatusOK)
+}
+
+// CloseDrawer records the cash counted in the drawer and answers with how it reconciles with the cash
+// purchases. A discrepancy over the threshold is flagged to the store's manager.
+func (h Handler) CloseDrawer(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req CloseDrawerRequest) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionHandleCash) {
+		return
+	}
+	s, err := h.cash.Close(r.Context(), storeID, *money.New(req.Counted.Amount, req.Counted.Currency), req.Note)
+	h.writeDrawerSession(w, r, s, err, http.StatusOK)
+}
+
+// DepositCash records cash of the store banked and answers with how it reconciles with the safe drops.
+func (h Handler) DepositCash(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req DepositRequest) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionDepositCash) {
+		return
+	}
+	d, err := h.cash.Deposit(r.Context(), storeID, *money.New(req.Amount.Amount, req.Amount.Currency), req.Slip)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toDepositResponse(d))
+}
+
+// GetCashReport lists the drawer sessions opened and the deposits made at the store between ?from= and
+// ?to=, RFC 3339 times; to defaults to now.
+func (h Handler) GetCashReport(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if !h.canHandleCash(w, r, storeID, auth.ActionDepositCash) {
+		return
+	}
+	params := r.URL.Query()
+	var v validation.Validator
+	from, err := time.Parse(time.RFC3339, params.Get("from"))
+	v.Check(err == nil, "from", "must be an RFC 3339 time")
+	to := time.Now()
+	if s := params.Get("to"); s != "" {
+		to, err = time.Parse(time.RFC3339, s)
+		v.Check(err == nil && to.After(from), "to", "must be an RFC 3339 time after from")
+	}
+	if err := v.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	sessions, err := h.cash.Sessions(r.Context(), storeID, from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	deposits, err := h.cash.Deposits(r.Context(), storeID, from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := CashReportResponse{Sessions: make([]DrawerSessionResponse, 0, len(sessions)), Deposits: make([]DepositResponse, 0, len(deposits))}
+	for _, s := range sessions {
+		resp.Sessions = append(resp.Sessions, toDrawerSessionResponse(s))
+	}
+	for _, d := range deposits {
+		resp.Deposits = append(resp.Deposits, toDepositResponse(d))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// canHandleCash answers the request and returns false unless cash is tracked and the caller may perform a
+// at the store.
+func (h Handler) canHandleCash(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, a auth.Action) bool {
+	if err := h.authorize(r.Context(), a, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.cash == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "cash is not tracked"}})
+		return false
+	}
+	return true
+}
+
+func (h Handler) writeDrawerSession(w http.ResponseWriter, r *http.Request, s *cash.Session, err error, status int) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, status, toDrawerSessionResponse(s))
+}
@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/consent"
+	"coffeeco/internal/validation"
+)
+
+type Consents interface {
+	Record(ctx context.Context, customerID uuid.UUID, channel consent.Channel, granted bool, source string) (consent.Record, error)
+	History(ctx context.Context, customerID uuid.UUID) ([]consent.Record, error)
+	Export(ctx context.Context, from, to time.Time) ([]consent.Record, error)
+}
+
+// WithConsents lets customers opt in to and out of marketing at /v2/customers/{customerID}/consents, and
+// admins export every decision at /v2/consents.
+func WithConsents(c Consents) Option {
+	return func(h *Handler) {
+		h.consents = c
+	}
+}
+
+type ConsentRequest struct {
+	Channel string `json:"channel" enum:"email,sms,push"`
+	// Granted is true to opt in, false to opt out.
+	Granted *bool `json:"granted"`
+	// Source is where the customer decided, e.g. "app_settings" or "unsubscribe_link".
+	Source string `json:"source"`
+}
+
+func (r ConsentRequest) Validate() error {
+	var v validation.Validator
+	v.Check(slices.Contains(consent.Channels, consent.Channel(r.Channel)), "channel", "must be email, sms or push")
+	v.Check(r.Granted != nil, "granted", "is required")
+	v.Check(r.Source != "", "source", "is required")
+	return v.Err()
+}
+
+type ConsentResponse struct {
+	Channel string     `json:"channel" enum:"email,sms,push"`
+	Granted bool       `json:"granted"`
+	Source  string     `json:"source,omitempty"`
+	At      *time.Time `json:"at,omitempty"`
+}
+
+// ConsentRecordResponse is one decision of a customer, as kept for compliance audits.
+type ConsentRecordResponse struct {
+	ID         uuid.UUID `json:"id"`
+	CustomerID uuid.UUID `json:"customerId"`
+	Channel    string    `json:"channel" enum:"email,sms,push"`
+	Granted    bool      `json:"granted"`
+	Source     string    `json:"source"`
+	At         time.Time `json:"at"`
+	RecordedBy string    `json:"recordedBy"`
+}
+
+// ConsentsResponse is a customer's consent on every channel, and the decisions it follows from.
+type ConsentsResponse struct {
+	CustomerID uuid.UUID               `json:"customerId"`
+	Channels   []ConsentResponse       `json:"channels"`
+	History    []ConsentRecordResponse `json:"history"`
+}
+
+type ConsentExportResponse struct {
+	Records []ConsentRecordResponse `json:"records"`
+}
+
+func toConsentRecords(records []consent.Record) []ConsentRecordResponse {
+	res := make([]ConsentRecordResponse, 0, len(records))
+	for _, r := range records {
+		res = append(res, ConsentRecordResponse{
+			ID:         r.ID,
+			CustomerID: r.CustomerID,
+			Channel:    string(r.Channel),
+			Granted:    r.Granted,
+			Source:     r.Source,
+			At:         r.At,
+			RecordedBy: r.RecordedBy,
+		})
+	}
+	return res
+}
+
+func toConsents(customerID uuid.UUID, history []consent.Record) ConsentsResponse {
+	resp := ConsentsResponse{CustomerID: customerID, History: toConsentRecords(history)}
+	current := consent.Current(history)
+	for _, ch := range consent.Channels {
+		c := ConsentResponse{Channel: string(ch)}
+		if r, ok := current[ch]; ok {
+			c.Granted, c.Source, c.At = r.Granted, r.Source, &r.At
+		}
+		resp.Channels = append(resp.Channels, c)
+	}
+	return resp
+}
+
+// GetConsents is whether the customer may be sent marketing on each channel. Customers never asked are not.
+func (h Handler) GetConsents(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) {
+	if !h.canManageConsent(w, r, customerID) {
+		return
+	}
+	history, err := h.consents.History(r.Context(), customerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toConsents(customerID, history))
+}
+
+// RecordConsent records the customer opting in to marketing on a channel, or out of it.
+func (h Handler) RecordConsent(w http.ResponseWriter, r *http.Request, customerID uuid.UUID, req ConsentRequest) {
+	if !h.canManageConsent(w, r, customerID) {
+		return
+	}
+	if _, err := h.consents.Record(r.Context(), customerID, consent.Channel(req.Channel), *req.Granted, req.Source); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	history, err := h.consents.History(r.Context(), customerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toConsents(customerID, history))
+}
+
+// ExportConsents answers ?from=&to= (RFC 3339; to defaults to now) with every decision recorded in between,
+// oldest first, as JSON or, with &format=csv or Accept: text/csv, as CSV.
+func (h Handler) ExportConsents(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorize(r.Context(), auth.ActionExportConsents, auth.Resource{}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.consents == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "marketing consent is not recorded"}})
+		return
+	}
+
+	params := r.URL.Query()
+	var v validation.Validator
+	from, err := time.Parse(time.RFC3339, params.Get("from"))
+	if err != nil {
+		v.Add("from", "must be an RFC 3339 time")
+	}
+	to := time.Now()
+	if s := params.Get("to"); s != "" {
+		to, err = time.Parse(time.RFC3339, s)
+		v.Check(err == nil && to.After(from), "to", "must be an RFC 3339 time after from")
+	}
+	if f := params.Get("format"); f != "" {
+		v.Check(f == "csv" || f == "json", "format", "must be csv or json")
+	}
+	if err := v.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	records, err := h.consents.Export(r.Context(), from, to)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if params.Get("format") == "csv" || r.Header.Get("Accept") == "text/csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="consents.csv"`)
+		_ = consent.WriteCSV(w, records)
+		return
+	}
+	writeJSON(w, http.StatusOK, ConsentExportResponse{Records: toConsentRecords(records)})
+}
+
+// canManageConsent answers the request and returns false unless consent is recorded and the caller may
+// manage the customer's.
+func (h Handler) canManageConsent(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), auth.ActionManageConsent, auth.Resource{CustomerID: customerID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.consents == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "marketing consent is not recorded"}})
+		return false
+	}
+	return true
+}
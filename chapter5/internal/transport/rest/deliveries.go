@@ -0,0 +1,56 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/delivery"
+)
+
+type Deliveries interface {
+	Job(ctx context.Context, id uuid.UUID) (*delivery.Job, error)
+}
+
+// WithDeliveries lets customers follow the delivery of their purchase at /v2/purchases/{purchaseID}/delivery.
+func WithDeliveries(d Deliveries) Option {
+	return func(h *Handler) {
+		h.deliveries = d
+	}
+}
+
+type DeliveryResponse struct {
+	PurchaseID  uuid.UUID `json:"purchaseId"`
+	Status      string    `json:"status" enum:"pending,requested,courier_assigned,picked_up,delivered,cancelled"`
+	Courier     string    `json:"courier,omitempty"`
+	TrackingURL string    `json:"trackingUrl,omitempty"`
+	Fee         Money     `json:"fee"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (h Handler) GetDelivery(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if _, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.deliveries == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "purchases are not delivered"}})
+		return
+	}
+	j, err := h.deliveries.Job(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, DeliveryResponse{
+		PurchaseID:  j.ID,
+		Status:      string(j.Status()),
+		Courier:     j.Courier(),
+		TrackingURL: j.TrackingURL(),
+		Fee:         toMoney(j.Fee),
+		UpdatedAt:   j.UpdatedAt(),
+	})
+}
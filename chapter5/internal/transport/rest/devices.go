@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/device"
+	"coffeeco/internal/validation"
+)
+
+type Devices interface {
+	Register(ctx context.Context, r device.Registration) (*device.Device, error)
+	Get(ctx context.Context, id uuid.UUID) (*device.Device, error)
+	ForStore(ctx context.Context, storeID uuid.UUID) ([]*device.Device, error)
+	UpdateFirmware(ctx context.Context, id uuid.UUID, version string) (*device.Device, error)
+	Revoke(ctx context.Context, id uuid.UUID, reason string) (*device.Device, error)
+}
+
+// WithDevices lets managers register the POS terminals of their store at /v2/stores/{storeID}/devices,
+// and revoke them at /v2/devices.
+func WithDevices(d Devices) Option {
+	return func(h *Handler) {
+		h.devices = d
+	}
+}
+
+type RegisterDeviceRequest struct {
+	// Name tells the staff which terminal it is, e.g. "front till".
+	Name string `json:"name,omitempty"`
+	// PublicKey is the base64 encoded ed25519 public key of the terminal's key pair. The private key never
+	// leaves the terminal.
+	PublicKey string `json:"publicKey"`
+	Firmware  string `json:"firmware"`
+}
+
+func (r RegisterDeviceRequest) Validate() error {
+	var v validation.Validator
+	_, err := device.ParsePublicKey(r.PublicKey)
+	v.Check(err == nil, "publicKey", "must be a base64 encoded ed25519 public key")
+	v.Check(r.Firmware != "", "firmware", "is required")
+	return v.Err()
+}
+
+type DeviceFirmwareRequest struct {
+	Firmware string `json:"firmware"`
+}
+
+func (r DeviceFirmwareRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Firmware != "", "firmware", "is required")
+	return v.Err()
+}
+
+type RevokeDeviceRequest struct {
+	// Reason is why the device was revoked, e.g. "reported stolen", for the audit log.
+	Reason string `json:"reason"`
+}
+
+func (r RevokeDeviceRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Reason != "", "reason", "is required")
+	return v.Err()
+}
+
+type DeviceResponse struct {
+	ID           uuid.UUID  `json:"id"`
+	StoreID      uuid.UUID  `json:"storeId"`
+	Name         string     `json:"name,omitempty"`
+	PublicKey    string     `json:"publicKey"`
+	Firmware     string     `json:"firmware"`
+	Status       string     `json:"status" enum:"active,revoked"`
+	RegisteredBy string     `json:"registeredBy"`
+	RegisteredAt time.Time  `json:"registeredAt"`
+	RevokedBy    string     `json:"revokedBy,omitempty"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty"`
+	Reason       string     `json:"reason,omitempty"`
+}
+
+type DeviceListResponse struct {
+	Devices []DeviceResponse `json:"devices"`
+}
+
+func toDeviceResponse(d *device.Device) DeviceResponse {
+	resp := DeviceResponse{
+		ID:           d.ID,
+		StoreID:      d.StoreID,
+		Name:         d.Name,
+		PublicKey:    base64.StdEncoding.EncodeToString(d.PublicKey),
+		Firmware:     d.Firmware,
+		Status:       "active",
+		RegisteredBy: d.RegisteredBy,
+		RegisteredAt: d.RegisteredAt,
+	}
+	if at := d.RevokedAt(); !at.IsZero() {
+		resp.Status, resp.RevokedAt = "revoked", &at
+		resp.RevokedBy, resp.Reason = d.RevokedBy()
+	}
+	return resp
+}
+
+// RegisterDevice registers a POS terminal at the store. Purchases rung up on it are taken from then on.
+func (h Handler) RegisterDevice(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req RegisterDeviceRequest) {
+	if !h.canManageDevices(w, r, storeID) {
+		return
+	}
+	key, _ := device.ParsePublicKey(req.PublicKey)
+	d, err := h.devices.Register(r.Context(), device.Registration{StoreID: storeID, Name: req.Name, PublicKey: key, Firmware: req.Firmware})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/devices/"+d.ID.String())
+	writeJSON(w, http.StatusCreated, toDeviceResponse(d))
+}
+
+// ListDevices lists the terminals registered at the store, revoked ones too, oldest first.
+func (h Handler) ListDevices(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if !h.canManageDevices(w, r, storeID) {
+		return
+	}
+	devices, err := h.devices.ForStore(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := DeviceListResponse{Devices: make([]DeviceResponse, 0, len(devices))}
+	for _, d := range devices {
+		resp.Devices = append(resp.Devices, toDeviceResponse(d))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h Handler) GetDevice(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	d, err := h.getDevice(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toDeviceResponse(d))
+}
+
+// UpdateDeviceFirmware records the firmware a terminal was updated to.
+func (h Handler) UpdateDeviceFirmware(w http.ResponseWriter, r *http.Request, id uuid.UUID, req DeviceFirmwareRequest) {
+	if _, err := h.getDevice(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	d, err := h.devices.UpdateFirmware(r.Context(), id, req.Firmware)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toDeviceResponse(d))
+}
+
+// RevokeDevice has a terminal turn away every further purchase, e.g. once it is reported stolen. The caller
+// is recorded as having revoked it.
+func (h Handler) RevokeDevice(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RevokeDeviceRequest) {
+	if _, err := h.getDevice(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	d, err := h.devices.Revoke(r.Context(), id, req.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toDeviceResponse(d))
+}
+
+// getDevice returns the device if the caller may manage the devices of its store.
+func (h Handler) getDevice(ctx context.Context, id uuid.UUID) (*device.Device, error) {
+	if h.devices == nil {
+		return nil, device.ErrNotFound
+	}
+	d, err := h.devices.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.authorize(ctx, auth.ActionManageDevices, auth.Resource{StoreID: d.StoreID}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// canManageDevices answers the request and returns false unless devices are registered and the caller may
+// manage those of the store.
+func (h Handler) canManageDevices(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), auth.ActionManageDevices, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.devices == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "devices are not registered"}})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/validation"
+)
+
+// The types in this file are the API's contract. They are deliberately separate from the aggregates, so
+// the domain can change without breaking clients. CreatePurchaseRequest and ReceiptResponse are the v1
+// purchase contract; see dto_v2.go for the current one.
+
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func toMoney(m money.Money) Money {
+	// The zero money.Money has no currency.
+	if m.Currency() == nil {
+		return Money{}
+	}
+	return Money{Amount: m.Amount(), Currency: m.Currency().Code}
+}
+
+type Item struct {
+	Name  string `json:"name"`
+	Price Money  `json:"price"`
+}
+
+type CreatePurchaseRequest struct {
+	StoreID       string `json:"storeId" format:"uuid"`
+	CustomerID    string `json:"customerId,omitempty" format:"uuid"`
+	LoyaltyCardID string `json:"loyaltyCardId,omitempty" format:"uuid"`
+	PaymentMeans  string `json:"paymentMeans" enum:"card,cash,coffeebux"`
+	CardToken     string `json:"cardToken,omitempty"`
+	Items         []Item `json:"items"`
+}
+
+func (r CreatePurchaseRequest) Validate() error {
+	var v validation.Validator
+	v.UUID("storeId", r.StoreID, true)
+	v.UUID("customerId", r.CustomerID, false)
+	v.UUID("loyaltyCardId", r.LoyaltyCardID, false)
+	switch r.PaymentMeans {
+	case payment.MEANS_CARD:
+		v.Check(r.CardToken != "", "cardToken", "is required when paying by card")
+	case payment.MEANS_CASH:
+	case payment.MEANS_COFFEEBUX:
+		v.Check(r.LoyaltyCardID != "", "loyaltyCardId", "is required when paying with coffeebux")
+	default:
+		v.Add("paymentMeans", "must be one of card, cash, coffeebux")
+	}
+	v.Check(len(r.Items) > 0, "items", "must contain at least one item")
+	for i, item := range r.Items {
+		field := validation.Index("items", i)
+		v.Check(item.Name != "", field+".name", "is required")
+		v.Check(item.Price.Amount > 0, field+".price.amount", "must be positive")
+		v.Check(money.GetCurrency(item.Price.Currency) != nil, field+".price.currency", "must be an ISO 4217 code")
+	}
+	return v.Err()
+}
+
+type UpdateStatusRequest struct {
+	Status string `json:"status" enum:"preparing,ready"`
+}
+
+func (r UpdateStatusRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Status == string(purchase.StatusPreparing) || r.Status == string(purchase.StatusReady),
+		"status", "must be one of preparing, ready")
+	return v.Err()
+}
+
+type ReceiptResponse struct {
+	PurchaseID   uuid.UUID  `json:"purchaseId"`
+	StoreID      uuid.UUID  `json:"storeId"`
+	CustomerID   *uuid.UUID `json:"customerId,omitempty"`
+	Items        []Item     `json:"items"`
+	Total        Money      `json:"total"`
+	PaymentMeans string     `json:"paymentMeans" enum:"card,cash,coffeebux,marketplace,wallet"`
+	PurchasedAt  time.Time  `json:"purchasedAt"`
+}
+
+type LoyaltyBalanceResponse struct {
+	CardID                  uuid.UUID `json:"cardId"`
+	CustomerID              uuid.UUID `json:"customerId"`
+	StoreID                 uuid.UUID `json:"storeId"`
+	FreeDrinksAvailable     int       `json:"freeDrinksAvailable"`
+	PurchasesUntilFreeDrink int       `json:"purchasesUntilFreeDrink"`
+}
+
+func toLoyaltyBalance(c *loyalty.CoffeeBux) LoyaltyBalanceResponse {
+	return LoyaltyBalanceResponse{
+		CardID:                  c.ID,
+		CustomerID:              c.CustomerID(),
+		StoreID:                 c.StoreID(),
+		FreeDrinksAvailable:     c.FreeDrinksAvailable,
+		PurchasesUntilFreeDrink: c.RemainingDrinkPurchasesUntilFreeDrink,
+	}
+}
+
+type StoreResponse struct {
+	ID       uuid.UUID      `json:"id"`
+	Location string         `json:"location"`
+	Products []StoreProduct `json:"products"`
+}
+
+// StoreProduct is a product for sale, with its name and description in the caller's language. Name is what
+// purchases are made of.
+type StoreProduct struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	Price       Money  `json:"price"`
+}
+
+func toStores(stores []store.Store, printer func(storeID uuid.UUID) i18n.Printer) []StoreResponse {
+	res := make([]StoreResponse, 0, len(stores))
+	for _, s := range stores {
+		pr := printer(s.ID)
+		sr := StoreResponse{ID: s.ID, Location: s.Location, Products: make([]StoreProduct, 0, len(s.ProductsForSale))}
+		for _, p := range s.ProductsForSale {
+			text := pr.Product(p.ItemName)
+			sr.Products = append(sr.Products, StoreProduct{Name: p.ItemName, DisplayName: text.Name, Description: text.Description, Price: toMoney(p.BasePrice)})
+		}
+		res = append(res, sr)
+	}
+	return res
+}
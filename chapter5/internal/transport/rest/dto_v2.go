@@ -0,0 +1,337 @@
+package rest
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/moneyfmt"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/store"
+	"coffeeco/internal/validation"
+)
+
+// v2 is the current purchase contract: items are lines with a quantity, and everything about paying is
+// grouped under payment. v1 requests and responses are translated to and from these types in versions.go.
+
+const maxQuantity = 99
+
+type Line struct {
+	Product   string `json:"product"`
+	Quantity  int    `json:"quantity"`
+	UnitPrice Money  `json:"unitPrice"`
+	// ReusableCup is a drink served in the customer's own cup, which takes the reusable cup discount off.
+	ReusableCup bool `json:"reusableCup,omitempty"`
+}
+
+type Payment struct {
+	Means         string `json:"means" enum:"card,cash,coffeebux,wallet"`
+	CardToken     string `json:"cardToken,omitempty"`
+	LoyaltyCardID string `json:"loyaltyCardId,omitempty" format:"uuid"`
+}
+
+type CreatePurchaseRequestV2 struct {
+	StoreID    string  `json:"storeId" format:"uuid"`
+	CustomerID string  `json:"customerId,omitempty" format:"uuid"`
+	Lines      []Line  `json:"lines"`
+	Payment    Payment `json:"payment"`
+	// Delivery has the purchase delivered for a fee, which is added as a line of its own.
+	Delivery *DeliveryRequest `json:"delivery,omitempty"`
+	// ServedBy is the barista the purchase counts towards for their incentives; it defaults to the caller
+	// when they work at a store, and is ignored for customers.
+	ServedBy string `json:"servedBy,omitempty"`
+	// GiftReceipt adds a gift receipt, without prices, to the receipt of the completed purchase.
+	GiftReceipt bool `json:"giftReceipt,omitempty"`
+	// QuoteToken charges the purchase what it was quoted at /v2/stores/{storeID}/purchase-quotes, as long
+	// as the quote has not expired and the lines are the ones quoted.
+	QuoteToken string `json:"quoteToken,omitempty"`
+	// ConfirmDuplicate buys the same items again after the purchase was turned away as a possible_duplicate
+	// of one just made.
+	ConfirmDuplicate bool `json:"confirmDuplicate,omitempty"`
+	// Channel is how the purchase was ordered. Left out, marketplace orders are marketplace, deliveries are
+	// delivery, and anything else in_store.
+	Channel string `json:"channel,omitempty" enum:"in_store,app,web,delivery,marketplace"`
+	// Overrides charge lines, or the whole purchase, less than they are priced at. Only managers of the
+	// store may override prices.
+	Overrides []PriceOverrideRequest `json:"overrides,omitempty"`
+	// PickupAt schedules the pickup of an app order, at most a day ahead. Its ticket goes to the bar once
+	// the app reports the customer close to the store, or shortly before PickupAt otherwise.
+	PickupAt *time.Time `json:"pickupAt,omitempty"`
+	// Substitutes accept what the store suggested instead of the products it ran out of, as the
+	// substitutes of an out_of_stock error, by product, e.g. {"latte": "flat white"}.
+	Substitutes map[string]string `json:"substitutes,omitempty"`
+	// DeviceID is the registered POS terminal the purchase was rung up on. Once terminals must be
+	// registered, in_store purchases need one, and a revoked terminal's purchases are turned away.
+	DeviceID string `json:"deviceId,omitempty" format:"uuid"`
+}
+
+type PriceOverrideRequest struct {
+	// Line is the index of the line whose unit price is overridden; left out, Price is what every line
+	// together is charged.
+	Line   *int   `json:"line,omitempty"`
+	Price  Money  `json:"price"`
+	Reason string `json:"reason" enum:"remake,goodwill,price_match,staff_error"`
+	Note   string `json:"note,omitempty"`
+}
+
+type DeliveryRequest struct {
+	Address string `json:"address"`
+	// Phone is how the courier reaches the customer.
+	Phone string `json:"phone"`
+}
+
+func (r CreatePurchaseRequestV2) Validate() error {
+	var v validation.Validator
+	v.UUID("storeId", r.StoreID, true)
+	v.UUID("customerId", r.CustomerID, false)
+	v.UUID("deviceId", r.DeviceID, false)
+	validatePayment(&v, r.Payment)
+	if r.Payment.Means == payment.MEANS_WALLET {
+		v.Check(r.CustomerID != "", "customerId", "is required when paying from a wallet")
+	}
+	if r.Delivery != nil {
+		v.Check(r.Delivery.Address != "", "delivery.address", "is required")
+		v.Check(r.Delivery.Phone != "", "delivery.phone", "is required")
+		v.Check(r.Payment.Means != payment.MEANS_COFFEEBUX, "payment.means", "cannot be coffeebux for deliveries")
+	}
+	validateLines(&v, r.Lines)
+	if r.Channel != "" {
+		_, err := purchase.ParseChannel(r.Channel)
+		v.Check(err == nil, "channel", "must be one of in_store, app, web, delivery, marketplace")
+	}
+	for product, sub := range r.Substitutes {
+		v.Check(product != "" && sub != "", "substitutes", "must name a product and its substitute")
+	}
+	if r.PickupAt != nil {
+		v.Check(r.Channel == string(purchase.ChannelApp) && r.Delivery == nil, "pickupAt", "is only for app orders picked up in store")
+	}
+	for i, o := range r.Overrides {
+		field := validation.Index("overrides", i)
+		v.Check(o.Line == nil || *o.Line >= 0 && *o.Line < len(r.Lines), field+".line", "must be the index of a line")
+		v.Check(o.Price.Amount >= 0, field+".price.amount", "cannot be negative")
+		v.Check(money.GetCurrency(o.Price.Currency) != nil, field+".price.currency", "must be an ISO 4217 code")
+		v.Check(slices.Contains(purchase.OverrideReasons, purchase.OverrideReason(o.Reason)), field+".reason", "must be one of remake, goodwill, price_match, staff_error")
+	}
+	return v.Err()
+}
+
+func validatePayment(v *validation.Validator, p Payment) {
+	v.UUID("payment.loyaltyCardId", p.LoyaltyCardID, false)
+	switch p.Means {
+	case payment.MEANS_CARD:
+		v.Check(p.CardToken != "", "payment.cardToken", "is required when paying by card")
+	case payment.MEANS_CASH, payment.MEANS_WALLET:
+	case payment.MEANS_COFFEEBUX:
+		v.Check(p.LoyaltyCardID != "", "payment.loyaltyCardId", "is required when paying with coffeebux")
+	default:
+		v.Add("payment.means", "must be one of card, cash, coffeebux, wallet")
+	}
+}
+
+func validateLines(v *validation.Validator, lines []Line) {
+	v.Check(len(lines) > 0, "lines", "must contain at least one line")
+	for i, l := range lines {
+		field := validation.Index("lines", i)
+		v.Check(l.Product != "", field+".product", "is required")
+		v.Check(l.Quantity > 0 && l.Quantity <= maxQuantity, field+".quantity", "must be between 1 and "+strconv.Itoa(maxQuantity))
+		v.Check(l.UnitPrice.Amount > 0, field+".unitPrice.amount", "must be positive")
+		v.Check(money.GetCurrency(l.UnitPrice.Currency) != nil, field+".unitPrice.currency", "must be an ISO 4217 code")
+	}
+}
+
+// toPurchase assumes the request has been validated.
+func (r CreatePurchaseRequestV2) toPurchase() *purchase.Purchase {
+	p := &purchase.Purchase{
+		Store:            store.Ref(uuid.MustParse(r.StoreID)),
+		PaymentMeans:     payment.Means(r.Payment.Means),
+		ServedBy:         r.ServedBy,
+		QuoteToken:       r.QuoteToken,
+		ConfirmDuplicate: r.ConfirmDuplicate,
+		Channel:          purchase.Channel(r.Channel),
+	}
+	if r.CustomerID != "" {
+		p.CustomerID = uuid.MustParse(r.CustomerID)
+	}
+	if r.Payment.CardToken != "" {
+		token := r.Payment.CardToken
+		p.CardToken = &token
+	}
+	if r.DeviceID != "" {
+		p.DeviceID = uuid.MustParse(r.DeviceID)
+	}
+	if r.PickupAt != nil {
+		p.PickupAt = *r.PickupAt
+	}
+	p.Substitutes = r.Substitutes
+	if r.Delivery != nil {
+		p.Delivery = &purchase.Delivery{Address: r.Delivery.Address, Phone: r.Delivery.Phone}
+	}
+	p.ProductsToPurchase = toProducts(r.Lines)
+	p.Overrides = toOverrides(r.Lines, r.Overrides)
+	return p
+}
+
+// toOverrides overrides the price of every product a line is spelled out into.
+func toOverrides(lines []Line, overrides []PriceOverrideRequest) []purchase.PriceOverride {
+	var res []purchase.PriceOverride
+	for _, o := range overrides {
+		override := purchase.PriceOverride{Product: purchase.WholePurchase, Price: *money.New(o.Price.Amount, o.Price.Currency), Reason: purchase.OverrideReason(o.Reason), Note: o.Note}
+		if o.Line == nil {
+			res = append(res, override)
+			continue
+		}
+		first := 0
+		for _, l := range lines[:*o.Line] {
+			first += l.Quantity
+		}
+		for i := range lines[*o.Line].Quantity {
+			override.Product = first + i
+			res = append(res, override)
+		}
+	}
+	return res
+}
+
+// toProducts spells the lines out one product each.
+func toProducts(lines []Line) []coffeeco.Product {
+	var products []coffeeco.Product
+	for _, l := range lines {
+		for i := 0; i < l.Quantity; i++ {
+			products = append(products, coffeeco.Product{
+				ItemName:    l.Product,
+				BasePrice:   *money.New(l.UnitPrice.Amount, l.UnitPrice.Currency),
+				ReusableCup: l.ReusableCup,
+			})
+		}
+	}
+	return products
+}
+
+type ReceiptResponseV2 struct {
+	PurchaseID  uuid.UUID  `json:"purchaseId"`
+	StoreID     uuid.UUID  `json:"storeId"`
+	CustomerID  *uuid.UUID `json:"customerId,omitempty"`
+	Lines       []Line     `json:"lines"`
+	Total       Money      `json:"total"`
+	PaidWith    string     `json:"paidWith" enum:"card,cash,coffeebux,marketplace,wallet"`
+	PurchasedAt time.Time  `json:"purchasedAt"`
+	// Channel is how the purchase was ordered; it is empty for purchases made before channels were recorded.
+	Channel string `json:"channel,omitempty" enum:"in_store,app,web,delivery,marketplace"`
+	// TabID is the tab of a table the purchase paid for, if any.
+	TabID *uuid.UUID `json:"tabId,omitempty"`
+	// ReturnCode is what the receipt's barcode encodes, scanned when something is brought back.
+	ReturnCode string `json:"returnCode"`
+	// ShortCode is printed on the receipt for support to find the purchase with, at its store on its day.
+	ShortCode string `json:"shortCode,omitempty"`
+	// Charges were paid besides the lines, e.g. a marketplace's service fee; they are part of total.
+	Charges []ChargeResponse `json:"charges,omitempty"`
+	// Rounding is what rounding a cash total to the smallest coin added to it, negative if it took some off.
+	Rounding *Money `json:"rounding,omitempty"`
+	// Overrides are the prices managers overrode, already taken off the lines and total.
+	Overrides []OverrideResponse `json:"overrides,omitempty"`
+	// GiftReceipt is there when it was asked for with the purchase.
+	GiftReceipt *GiftReceiptResponse `json:"giftReceipt,omitempty"`
+}
+
+type OverrideResponse struct {
+	// Product is the product whose price was overridden, empty for the whole purchase.
+	Product string `json:"product,omitempty"`
+	Price   Money  `json:"price"`
+	Was     Money  `json:"was"`
+	Reason  string `json:"reason" enum:"remake,goodwill,price_match,staff_error"`
+	Note    string `json:"note,omitempty"`
+	By      string `json:"by"`
+}
+
+type ChargeResponse struct {
+	Type string `json:"type" enum:"delivery_fee,service_fee,courier_tip,channel_fee"`
+	// Payee is who the charge is owed to.
+	Payee  string `json:"payee" enum:"store,marketplace,courier"`
+	Amount Money  `json:"amount"`
+}
+
+// GiftReceiptResponse is a receipt to give away with a gift: what was bought and the return code, but no
+// prices, total or payment.
+type GiftReceiptResponse struct {
+	PurchaseID  uuid.UUID  `json:"purchaseId"`
+	StoreID     uuid.UUID  `json:"storeId"`
+	Lines       []GiftLine `json:"lines"`
+	PurchasedAt time.Time  `json:"purchasedAt"`
+	ReturnCode  string     `json:"returnCode"`
+}
+
+type GiftLine struct {
+	Product  string `json:"product"`
+	Quantity int    `json:"quantity"`
+}
+
+func toGiftReceipt(p purchase.Purchase) GiftReceiptResponse {
+	// Build only fails for unknown modes.
+	gift, _ := receipt.Build(p, receipt.ModeGift, moneyfmt.Locale{})
+	r := GiftReceiptResponse{
+		PurchaseID:  gift.PurchaseID,
+		StoreID:     gift.StoreID,
+		Lines:       make([]GiftLine, 0, len(gift.Lines)),
+		PurchasedAt: gift.PurchasedAt,
+		ReturnCode:  gift.ReturnCode,
+	}
+	for _, l := range gift.Lines {
+		r.Lines = append(r.Lines, GiftLine{Product: l.Item, Quantity: l.Quantity})
+	}
+	return r
+}
+
+// toReceiptV2 folds identical products at the same price into one line, in the order they were bought.
+func toReceiptV2(p purchase.Purchase) ReceiptResponseV2 {
+	r := ReceiptResponseV2{
+		PurchaseID:  p.ID,
+		StoreID:     p.Store.ID,
+		Lines:       make([]Line, 0, len(p.ProductsToPurchase)),
+		Total:       toMoney(p.Total()),
+		PaidWith:    string(p.PaymentMeans),
+		PurchasedAt: p.PurchasedAt(),
+		Channel:     string(p.Channel),
+		ReturnCode:  receipt.ReturnCode(p.ID),
+		ShortCode:   receipt.FormatShortCode(p.ReceiptCode),
+	}
+	if p.CustomerID != uuid.Nil {
+		id := p.CustomerID
+		r.CustomerID = &id
+	}
+	if p.TabID != uuid.Nil {
+		id := p.TabID
+		r.TabID = &id
+	}
+	index := map[Line]int{}
+	for _, prod := range p.ProductsToPurchase {
+		key := Line{Product: prod.ItemName, UnitPrice: toMoney(prod.BasePrice), ReusableCup: prod.ReusableCup}
+		if i, ok := index[key]; ok {
+			r.Lines[i].Quantity++
+			continue
+		}
+		index[key] = len(r.Lines)
+		key.Quantity = 1
+		r.Lines = append(r.Lines, key)
+	}
+	for _, c := range p.Charges {
+		r.Charges = append(r.Charges, ChargeResponse{Type: string(c.Type), Payee: string(c.Payee), Amount: toMoney(c.Amount)})
+	}
+	if rounding := p.Rounding(); !rounding.IsZero() {
+		m := toMoney(rounding)
+		r.Rounding = &m
+	}
+	for _, o := range p.Overrides {
+		resp := OverrideResponse{Price: toMoney(o.Price), Was: toMoney(o.Was), Reason: string(o.Reason), Note: o.Note, By: o.By}
+		if o.Product != purchase.WholePurchase {
+			resp.Product = p.ProductsToPurchase[o.Product].ItemName
+		}
+		r.Overrides = append(r.Overrides, resp)
+	}
+	return r
+}
@@ -0,0 +1,276 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"coffeeco/internal/adjustment"
+	"coffeeco/internal/auth"
+	"coffeeco/internal/cash"
+	"coffeeco/internal/consent"
+	"coffeeco/internal/delivery"
+	"coffeeco/internal/device"
+	"coffeeco/internal/entitlement"
+	"coffeeco/internal/fiscal"
+	"coffeeco/internal/history"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/marketplace"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/preorder"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/receipt"
+	"coffeeco/internal/redemption"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/royalty"
+	"coffeeco/internal/sandbox"
+	"coffeeco/internal/store"
+	"coffeeco/internal/submission"
+	"coffeeco/internal/tab"
+	"coffeeco/internal/target"
+	"coffeeco/internal/validation"
+	"coffeeco/internal/wallet"
+)
+
+// ErrorResponse is the body of every non-2xx response.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	// Code is stable and meant for programs; Message is meant for people.
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	// Substitutes are what the store can make instead, for purchases turned away as out_of_stock. Sending
+	// the purchase again with some of them in substitutes accepts them.
+	Substitutes []SubstituteResponse `json:"substitutes,omitempty"`
+}
+
+type SubstituteResponse struct {
+	Product    string `json:"product"`
+	Substitute string `json:"substitute"`
+	UnitPrice  Money  `json:"unitPrice"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything that is wrong with a request, not just the first problem.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid request"
+}
+
+type mappedError struct {
+	target error
+	status int
+	code   string
+}
+
+// domainErrors maps domain errors onto responses. Anything not listed is a 500 and its details are
+// only logged, never returned.
+var domainErrors = []mappedError{
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+	{auth.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{purchase.ErrNotFound, http.StatusNotFound, "purchase_not_found"},
+	{loyalty.ErrNotFound, http.StatusNotFound, "loyalty_card_not_found"},
+	{purchase.ErrNoProducts, http.StatusUnprocessableEntity, "no_products"},
+	{purchase.ErrZeroTotal, http.StatusUnprocessableEntity, "zero_total"},
+	{purchase.ErrUnknownPaymentMeans, http.StatusUnprocessableEntity, "unknown_payment_means"},
+	{purchase.ErrMissingCardToken, http.StatusUnprocessableEntity, "missing_card_token"},
+	{purchase.ErrMixedCurrencies, http.StatusUnprocessableEntity, "mixed_currencies"},
+	{loyalty.ErrNotEnoughCoffeeBux, http.StatusUnprocessableEntity, "not_enough_coffeebux"},
+	{loyalty.ErrConcurrencyConflict, http.StatusConflict, "loyalty_card_busy"},
+	{inventory.ErrOutOfStock, http.StatusConflict, "out_of_stock"},
+	{purchase.ErrCardChargeFailed, http.StatusPaymentRequired, "card_charge_failed"},
+	{purchase.ErrCardPaymentsUnavailable, http.StatusServiceUnavailable, "card_payments_unavailable"},
+	{purchase.ErrTimeout, http.StatusGatewayTimeout, "timeout"},
+	{purchase.ErrInvalidStatus, http.StatusUnprocessableEntity, "invalid_status"},
+	{purchase.ErrNoPublisher, http.StatusServiceUnavailable, "status_updates_unavailable"},
+	{purchase.ErrNoDelivery, http.StatusUnprocessableEntity, "delivery_unavailable"},
+	{purchase.ErrDeliveryNotPayable, http.StatusUnprocessableEntity, "delivery_not_payable"},
+	{purchase.ErrMeansNotTaken, http.StatusUnprocessableEntity, "payment_means_not_taken"},
+	{purchase.ErrPossibleDuplicate, http.StatusConflict, "possible_duplicate"},
+	{purchase.ErrUnknownOverrideReason, http.StatusUnprocessableEntity, "unknown_override_reason"},
+	{purchase.ErrOverrideProduct, http.StatusUnprocessableEntity, "invalid_override"},
+	{purchase.ErrOverrideRaisesPrice, http.StatusUnprocessableEntity, "override_raises_price"},
+	{store.ErrUnknownMeans, http.StatusUnprocessableEntity, "unknown_payment_means"},
+	{delivery.ErrNotDeliverable, http.StatusUnprocessableEntity, "not_deliverable"},
+	{delivery.ErrNotFound, http.StatusNotFound, "delivery_not_found"},
+	{orders.ErrNotFound, http.StatusNotFound, "ticket_not_found"},
+	{orders.ErrInvalidTransition, http.StatusConflict, "invalid_transition"},
+	{orders.ErrNoBarista, http.StatusUnprocessableEntity, "no_barista"},
+	{pricing.ErrUnknownProduct, http.StatusUnprocessableEntity, "unknown_product"},
+	{pricing.ErrUnknownOption, http.StatusUnprocessableEntity, "unknown_option"},
+	{pricing.ErrMixedCurrencies, http.StatusUnprocessableEntity, "mixed_currencies"},
+	{pricing.ErrUnknownCurrency, http.StatusUnprocessableEntity, "unknown_currency"},
+	{marketplace.ErrUnknownMarketplace, http.StatusNotFound, "unknown_marketplace"},
+	{marketplace.ErrNoMenu, http.StatusNotFound, "no_menu"},
+	{tab.ErrNotFound, http.StatusNotFound, "tab_not_found"},
+	{tab.ErrNotOpen, http.StatusConflict, "tab_not_open"},
+	{tab.ErrTableTaken, http.StatusConflict, "table_taken"},
+	{tab.ErrHasPayments, http.StatusConflict, "tab_has_payments"},
+	{tab.ErrNothingDue, http.StatusConflict, "nothing_due"},
+	{tab.ErrInvalidSplit, http.StatusUnprocessableEntity, "invalid_split"},
+	{tab.ErrInvalidLine, http.StatusUnprocessableEntity, "invalid_line"},
+	{tab.ErrCurrencyMismatch, http.StatusUnprocessableEntity, "currency_mismatch"},
+	{purchase.ErrInvalidQuote, http.StatusUnprocessableEntity, "invalid_quote"},
+	{purchase.ErrQuoteExpired, http.StatusConflict, "quote_expired"},
+	{purchase.ErrQuoteMismatch, http.StatusConflict, "quote_mismatch"},
+	{purchase.ErrHeldForReview, http.StatusAccepted, "held_for_review"},
+	{purchase.ErrReviewNotFound, http.StatusNotFound, "review_not_found"},
+	{purchase.ErrReviewDecided, http.StatusConflict, "review_decided"},
+	{purchase.ErrReviewExpired, http.StatusConflict, "review_expired"},
+	{purchase.ErrReviewConflict, http.StatusConflict, "review_busy"},
+	{purchase.ErrNoReviews, http.StatusNotFound, "reviews_unavailable"},
+	{fiscal.ErrNotFiscalized, http.StatusServiceUnavailable, "not_fiscalized"},
+	{redemption.ErrInvalidToken, http.StatusUnprocessableEntity, "invalid_qr_code"},
+	{redemption.ErrExpired, http.StatusConflict, "qr_code_expired"},
+	{redemption.ErrReplayed, http.StatusConflict, "qr_code_used"},
+	{redemption.ErrUnknownKind, http.StatusUnprocessableEntity, "invalid_qr_code"},
+	{redemption.ErrNoDevice, http.StatusUnprocessableEntity, "no_device"},
+	{redemption.ErrWrongDevice, http.StatusForbidden, "wrong_device"},
+	{redemption.ErrNotOwner, http.StatusForbidden, "not_owner"},
+	{entitlement.ErrNotFound, http.StatusNotFound, "entitlement_not_found"},
+	{entitlement.ErrRevoked, http.StatusConflict, "entitlement_revoked"},
+	{entitlement.ErrExpired, http.StatusConflict, "entitlement_expired"},
+	{entitlement.ErrCapReached, http.StatusConflict, "entitlement_cap_reached"},
+	{history.ErrNothingAvailable, http.StatusUnprocessableEntity, "nothing_available"},
+	{receipt.ErrShortCodeUnknown, http.StatusNotFound, "receipt_not_found"},
+	{refund.ErrNotFound, http.StatusNotFound, "refund_not_found"},
+	{refund.ErrInvalidTransition, http.StatusConflict, "refund_decided"},
+	{refund.ErrConcurrencyConflict, http.StatusConflict, "refund_busy"},
+	{refund.ErrSelfApproval, http.StatusForbidden, "self_approval"},
+	{refund.ErrNoReason, http.StatusUnprocessableEntity, "no_reason"},
+	{refund.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{adjustment.ErrNotFound, http.StatusNotFound, "adjustment_not_found"},
+	{adjustment.ErrNoReason, http.StatusUnprocessableEntity, "no_reason"},
+	{adjustment.ErrNoChange, http.StatusUnprocessableEntity, "no_change"},
+	{adjustment.ErrUnknownStore, http.StatusUnprocessableEntity, "unknown_store"},
+	{adjustment.ErrInvalidTaxPercent, http.StatusUnprocessableEntity, "invalid_tax_percent"},
+	{royalty.ErrNotFound, http.StatusNotFound, "statement_not_found"},
+	{royalty.ErrNoNote, http.StatusUnprocessableEntity, "no_note"},
+	{royalty.ErrNotDisputed, http.StatusConflict, "not_disputed"},
+	{royalty.ErrExported, http.StatusConflict, "statement_exported"},
+	{royalty.ErrConcurrencyConflict, http.StatusConflict, "statement_busy"},
+	{cash.ErrNotFound, http.StatusNotFound, "drawer_closed"},
+	{cash.ErrDrawerOpen, http.StatusConflict, "drawer_open"},
+	{cash.ErrDrawerClosed, http.StatusConflict, "drawer_closed"},
+	{cash.ErrCurrency, http.StatusUnprocessableEntity, "currency_mismatch"},
+	{cash.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{cash.ErrConcurrencyConflict, http.StatusConflict, "drawer_busy"},
+	{sandbox.ErrUnavailable, http.StatusUnprocessableEntity, "sandbox_unavailable"},
+	{purchase.ErrPracticeMeans, http.StatusUnprocessableEntity, "practice_payment_means"},
+	{purchase.ErrWalletUnavailable, http.StatusUnprocessableEntity, "wallet_unavailable"},
+	{purchase.ErrNoDevice, http.StatusUnprocessableEntity, "device_required"},
+	{device.ErrNotFound, http.StatusNotFound, "device_not_found"},
+	{device.ErrUnregistered, http.StatusForbidden, "device_unregistered"},
+	{device.ErrRevoked, http.StatusForbidden, "device_revoked"},
+	{device.ErrInvalidKey, http.StatusUnprocessableEntity, "invalid_public_key"},
+	{device.ErrNoFirmware, http.StatusUnprocessableEntity, "no_firmware"},
+	{device.ErrNoReason, http.StatusUnprocessableEntity, "no_reason"},
+	{device.ErrConcurrencyConflict, http.StatusConflict, "device_busy"},
+	{target.ErrNotFound, http.StatusNotFound, "target_not_found"},
+	{target.ErrInvalidDay, http.StatusUnprocessableEntity, "invalid_date"},
+	{target.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{target.ErrInvalidShift, http.StatusUnprocessableEntity, "invalid_shift"},
+	{target.ErrNoShiftName, http.StatusUnprocessableEntity, "invalid_shift"},
+	{target.ErrConcurrencyConflict, http.StatusConflict, "target_busy"},
+	{consent.ErrUnknownChannel, http.StatusUnprocessableEntity, "unknown_channel"},
+	{consent.ErrNoSource, http.StatusUnprocessableEntity, "no_source"},
+	{consent.ErrMissingCustomer, http.StatusUnprocessableEntity, "missing_customer"},
+	{consent.ErrInvalidQuery, http.StatusBadRequest, "invalid_query"},
+	{wallet.ErrNotFound, http.StatusNotFound, "wallet_not_found"},
+	{wallet.ErrInsufficientFunds, http.StatusPaymentRequired, "insufficient_funds"},
+	{wallet.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{wallet.ErrCurrencyMismatch, http.StatusUnprocessableEntity, "currency_mismatch"},
+	{wallet.ErrBelowMinTopUp, http.StatusUnprocessableEntity, "below_min_top_up"},
+	{wallet.ErrOverMaxBalance, http.StatusUnprocessableEntity, "over_max_balance"},
+	{wallet.ErrOverRefund, http.StatusUnprocessableEntity, "over_refund"},
+	{wallet.ErrConcurrencyConflict, http.StatusConflict, "wallet_busy"},
+	{submission.ErrNotFound, http.StatusNotFound, "submission_not_found"},
+	{preorder.ErrNotFound, http.StatusNotFound, "pre_order_not_found"},
+	{preorder.ErrInvalidAmount, http.StatusUnprocessableEntity, "invalid_amount"},
+	{preorder.ErrPickupInPast, http.StatusUnprocessableEntity, "pickup_in_past"},
+	{preorder.ErrPickupTooFar, http.StatusUnprocessableEntity, "pickup_too_far"},
+	{preorder.ErrNoGateway, http.StatusServiceUnavailable, "no_gateway"},
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: ErrorBody{Code: "invalid_request", Message: ve.Error(), Fields: ve.Fields}})
+		return
+	}
+	// Violations of domain rules are answered as one of their errors, listing every field; any other
+	// violations are a bad request.
+	var violations validation.Errors
+	errors.As(err, &violations)
+	fields := toFieldErrors(violations)
+	if m, ok := mapError(err); ok {
+		writeJSON(w, m.status, ErrorResponse{Error: ErrorBody{Code: m.code, Message: m.target.Error(), Fields: fields, Substitutes: toSubstitutes(err)}})
+		return
+	}
+	if len(violations) > 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: ErrorBody{Code: "invalid_request", Message: "invalid request", Fields: fields}})
+		return
+	}
+	slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: ErrorBody{Code: "internal", Message: "something went wrong"}})
+}
+
+// DescribeError is the code and message the API answers err with, for errors that reach the client some
+// other way, e.g. purchases completed in the background.
+func DescribeError(err error) (code, message string) {
+	if m, ok := mapError(err); ok {
+		return m.code, m.target.Error()
+	}
+	return "internal", "something went wrong"
+}
+
+func mapError(err error) (mappedError, bool) {
+	for _, m := range domainErrors {
+		if errors.Is(err, m.target) {
+			return m, true
+		}
+	}
+	return mappedError{}, false
+}
+
+func toSubstitutes(err error) []SubstituteResponse {
+	var oos *purchase.OutOfStockError
+	if !errors.As(err, &oos) || len(oos.Suggestions) == 0 {
+		return nil
+	}
+	res := make([]SubstituteResponse, 0, len(oos.Suggestions))
+	for _, s := range oos.Suggestions {
+		res = append(res, SubstituteResponse{Product: s.Product, Substitute: s.Substitute, UnitPrice: toMoney(s.UnitPrice)})
+	}
+	return res
+}
+
+func toFieldErrors(violations validation.Errors) []FieldError {
+	if len(violations) == 0 {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, FieldError{Field: v.Field, Message: v.Message})
+	}
+	return fields
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
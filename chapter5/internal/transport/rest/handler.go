@@ -0,0 +1,586 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/i18n"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/ratelimit"
+	"coffeeco/internal/sandbox"
+	"coffeeco/internal/store"
+)
+
+type PurchaseService interface {
+	CompletePurchase(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase, card *loyalty.CoffeeBux) error
+	GetPurchase(ctx context.Context, id uuid.UUID) (purchase.Purchase, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, status purchase.Status) error
+	ImportPurchase(ctx context.Context, id uuid.UUID, purchasedAt time.Time, p *purchase.Purchase) error
+}
+
+type StoreService interface {
+	ListStores(ctx context.Context) ([]store.Store, error)
+}
+
+type LoyaltyCards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+	Save(ctx context.Context, card *loyalty.CoffeeBux) error
+}
+
+type Handler struct {
+	purchases    PurchaseService
+	stores       StoreService
+	cards        LoyaltyCards
+	authn        auth.Authenticator
+	limiter      *ratelimit.Limiter
+	audit        AuditLog
+	orders       Orders
+	deliveries   Deliveries
+	analytics    Analytics
+	prices       Prices
+	waits        WaitTimes
+	tabs         Tabs
+	menus        Menus
+	wallets      Wallets
+	submissions  Submissions
+	preOrders    PreOrders
+	quotes       PurchaseQuotes
+	reviews      Reviews
+	qrCodes      QRCodes
+	history      History
+	receiptCodes ReceiptCodes
+	refunds      Refunds
+	adjustments  Adjustments
+	royalties    Royalties
+	cash         Cash
+	storeMeans   StoreMeans
+	devices      Devices
+	targets      Targets
+	consents     Consents
+	localizer    *i18n.Localizer
+}
+
+// Option configures optional collaborators of the Handler.
+type Option func(h *Handler)
+
+// WithAuthenticator requires a bearer token on every request but /openapi.json, and checks the caller may
+// do what they ask before calling the services. Without it every request is allowed, which is only meant
+// for tests and local experiments.
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(h *Handler) {
+		h.authn = a
+	}
+}
+
+// WithRateLimiter limits purchases and loyalty card lookups, the endpoints worth abusing.
+func WithRateLimiter(l *ratelimit.Limiter) Option {
+	return func(h *Handler) {
+		h.limiter = l
+	}
+}
+
+// WithLocalizer names products in the language of the caller's Accept-Language header, or else of the
+// store. Without it products are shown by their own names.
+func WithLocalizer(l *i18n.Localizer) Option {
+	return func(h *Handler) {
+		h.localizer = l
+	}
+}
+
+func NewHandler(purchases PurchaseService, stores StoreService, cards LoyaltyCards, opts ...Option) (*Handler, error) {
+	if purchases == nil {
+		return nil, errors.New("purchase service cannot be nil")
+	}
+	if stores == nil {
+		return nil, errors.New("store service cannot be nil")
+	}
+	if cards == nil {
+		return nil, errors.New("loyalty cards cannot be nil")
+	}
+	h := &Handler{purchases: purchases, stores: stores, cards: cards}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h, nil
+}
+
+// NewMux serves the current API under /v2 and the previous one under /v1. The unversioned paths predate
+// versioning and stay v1 for the terminals already deployed.
+func NewMux(h *Handler) *mux.Router {
+	m := mux.NewRouter()
+	m.Use(correlation.Middleware, recoverPanics)
+	if h.authn != nil {
+		m.Use(authenticate(h.authn, "/openapi.json"))
+	}
+	m.Use(sandbox.Middleware, practice)
+	h.routesV1(m.PathPrefix("/v1").Subrouter())
+	h.routesV2(m.PathPrefix("/v2").Subrouter())
+	h.routesV1(m)
+	m.HandleFunc("/openapi.json", h.ServeOpenAPI).Methods(http.MethodGet)
+	return m
+}
+
+func (h *Handler) routesV1(r *mux.Router) {
+	r.Handle("/purchases", h.limited("purchases", withBody(h.CreatePurchaseV1))).Methods(http.MethodPost)
+	r.HandleFunc("/purchases/{purchaseID}", withID("purchaseID", h.GetReceiptV1)).Methods(http.MethodGet)
+	h.routes(r)
+}
+
+func (h *Handler) routesV2(r *mux.Router) {
+	r.Handle("/purchases", h.limited("purchases", withBody(h.CreatePurchase))).Methods(http.MethodPost)
+	r.HandleFunc("/purchases/{purchaseID}", withID("purchaseID", h.GetReceipt)).Methods(http.MethodGet)
+	r.HandleFunc("/purchases/{purchaseID}/gift-receipt", withID("purchaseID", h.GetGiftReceipt)).Methods(http.MethodGet)
+	r.HandleFunc("/purchases/{purchaseID}/delivery", withID("purchaseID", h.GetDelivery)).Methods(http.MethodGet)
+	r.HandleFunc("/purchase-submissions/{submissionID}", withID("submissionID", h.GetSubmission)).Methods(http.MethodGet)
+	r.HandleFunc("/pre-orders", withBody(h.PlacePreOrder)).Methods(http.MethodPost)
+	r.HandleFunc("/pre-orders/{preOrderID}", withID("preOrderID", h.GetPreOrder)).Methods(http.MethodGet)
+	r.HandleFunc("/imports/purchases", h.ImportPurchases).Methods(http.MethodPost)
+	r.HandleFunc("/audit", h.ListAuditEntries).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/sales-by-hour", report(h, "sales-by-hour", Analytics.SalesByHour)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/sales-by-store", report(h, "sales-by-store", Analytics.SalesByStore)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/sales-by-channel", report(h, "sales-by-channel", Analytics.SalesByChannel)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/sales-by-product", report(h, "sales-by-product", Analytics.SalesByProduct)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/average-ticket", report(h, "average-ticket", Analytics.AverageTicket)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/discounts", report(h, "discounts", Analytics.Discounts)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/loyalty", report(h, "loyalty", Analytics.Loyalty)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/cups-saved-by-store", report(h, "cups-saved-by-store", Analytics.CupsSavedByStore)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/cups-saved-by-customer", report(h, "cups-saved-by-customer", Analytics.CupsSavedByCustomer)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/settlements", report(h, "settlements", Analytics.Settlements)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/rounding", report(h, "rounding", Analytics.Rounding)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/price-overrides", report(h, "price-overrides", Analytics.PriceOverrides)).Methods(http.MethodGet)
+	r.HandleFunc("/analytics/taxes", report(h, "taxes", Analytics.Taxes)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/tickets", withID("storeID", h.ListTickets)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/tabs", withID("storeID", h.ListTabs)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/tabs", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req OpenTabRequest) {
+			h.OpenTab(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tabs/{tabID}", withID("tabID", h.GetTab)).Methods(http.MethodGet)
+	r.HandleFunc("/tabs/{tabID}/lines", withID("tabID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req AddToTabRequest) {
+			h.AddToTab(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tabs/{tabID}/payments", withID("tabID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req PayTabRequest) {
+			h.PayTab(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tabs/{tabID}/cancel", withID("tabID", h.CancelTab)).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/wait", withID("storeID", h.GetWait)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/menus/{marketplace}", withID("storeID", h.ExportMenu)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/quote", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req QuoteRequest) {
+			h.QuotePrice(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/purchase-quotes", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req QuotePurchaseRequest) {
+			h.QuotePurchase(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tickets/{ticketID}/start", withID("ticketID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req StartTicketRequest) {
+			h.StartTicket(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tickets/{ticketID}/proximity", withID("ticketID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req ProximityRequest) {
+			h.ReportProximity(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/customers/{customerID}/wallet", withID("customerID", h.GetWallet)).Methods(http.MethodGet)
+	r.HandleFunc("/customers/{customerID}/wallet/top-ups", withID("customerID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req TopUpRequest) {
+			h.TopUpWallet(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/purchases/{purchaseID}/wallet-refunds", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req WalletRefundRequest) {
+			h.RefundToWallet(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/customers/{customerID}/device", withID("customerID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req BindDeviceRequest) {
+			h.BindDevice(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPut)
+	r.HandleFunc("/customers/{customerID}/qr-tokens", withID("customerID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req IssueQRTokenRequest) {
+			h.IssueQRToken(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/qr-tokens/redeem", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RedeemQRTokenRequest) {
+			h.RedeemQRToken(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/customers/{customerID}/consents", withID("customerID", h.GetConsents)).Methods(http.MethodGet)
+	r.HandleFunc("/customers/{customerID}/consents", withID("customerID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req ConsentRequest) {
+			h.RecordConsent(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/consents", h.ExportConsents).Methods(http.MethodGet)
+	r.HandleFunc("/customers/{customerID}/purchases", withID("customerID", h.ListCustomerPurchases)).Methods(http.MethodGet)
+	r.HandleFunc("/customers/{customerID}/favorites", withID("customerID", h.ListFavorites)).Methods(http.MethodGet)
+	r.HandleFunc("/purchases/{purchaseID}/reorder", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req ReorderRequest) {
+			h.Reorder(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/receipts/{code}", withID("storeID", h.FindReceipt)).Methods(http.MethodGet)
+	r.HandleFunc("/purchases/{purchaseID}/refunds", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RefundRequest) {
+			h.RequestRefund(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/refunds", withID("storeID", h.ListPendingRefunds)).Methods(http.MethodGet)
+	r.HandleFunc("/refunds/{refundID}", withID("refundID", h.GetRefund)).Methods(http.MethodGet)
+	r.HandleFunc("/refunds/{refundID}/approve", withID("refundID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RefundDecisionRequest) {
+			h.ApproveRefund(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/refunds/{refundID}/reject", withID("refundID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RefundDecisionRequest) {
+			h.RejectRefund(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/refunds/{refundID}/execute", withID("refundID", h.ExecuteRefund)).Methods(http.MethodPost)
+	r.HandleFunc("/purchases/{purchaseID}/adjustments", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req AdjustmentRequest) {
+			h.AdjustPurchase(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/purchases/{purchaseID}/adjustments", withID("purchaseID", h.ListAdjustments)).Methods(http.MethodGet)
+	r.HandleFunc("/royalties/statements", h.ListRoyaltyStatements).Methods(http.MethodGet)
+	r.HandleFunc("/royalties/statements/{statementID}", withID("statementID", h.GetRoyaltyStatement)).Methods(http.MethodGet)
+	r.HandleFunc("/royalties/statements/{statementID}/disputes", withID("statementID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RoyaltyNoteRequest) {
+			h.DisputeRoyaltyStatement(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/royalties/statements/{statementID}/resolution", withID("statementID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RoyaltyNoteRequest) {
+			h.ResolveRoyaltyStatement(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/drawer", withID("storeID", h.GetDrawer)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/drawer", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req OpenDrawerRequest) {
+			h.OpenDrawer(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/drawer/drops", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req SafeDropRequest) {
+			h.DropToSafe(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/drawer/close", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req CloseDrawerRequest) {
+			h.CloseDrawer(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/deposits", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req DepositRequest) {
+			h.DepositCash(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/cash", withID("storeID", h.GetCashReport)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/reviews", withID("storeID", h.ListReviews)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/devices", withID("storeID", h.ListDevices)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/devices", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RegisterDeviceRequest) {
+			h.RegisterDevice(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/devices/{deviceID}", withID("deviceID", h.GetDevice)).Methods(http.MethodGet)
+	r.HandleFunc("/devices/{deviceID}/firmware", withID("deviceID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req DeviceFirmwareRequest) {
+			h.UpdateDeviceFirmware(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPut)
+	r.HandleFunc("/devices/{deviceID}/revoke", withID("deviceID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RevokeDeviceRequest) {
+			h.RevokeDevice(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/stores/{storeID}/targets", withID("storeID", h.GetTargetProgress)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/targets", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req SetTargetRequest) {
+			h.SetTarget(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPut)
+	r.HandleFunc("/stores/{storeID}/payment-means", withID("storeID", h.GetPaymentMeans)).Methods(http.MethodGet)
+	r.HandleFunc("/stores/{storeID}/payment-means", withID("storeID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req PaymentMeansRequest) {
+			h.SetPaymentMeans(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPut)
+	r.HandleFunc("/reviews/{purchaseID}", withID("purchaseID", h.GetReview)).Methods(http.MethodGet)
+	r.HandleFunc("/reviews/{purchaseID}/approve", withID("purchaseID", h.ApproveReview)).Methods(http.MethodPost)
+	r.HandleFunc("/reviews/{purchaseID}/reject", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req RejectReviewRequest) {
+			h.RejectReview(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPost)
+	r.HandleFunc("/tickets/{ticketID}/ready", withID("ticketID", h.TicketReady)).Methods(http.MethodPost)
+	r.HandleFunc("/tickets/{ticketID}/picked-up", withID("ticketID", h.TicketPickedUp)).Methods(http.MethodPost)
+	h.routes(r)
+}
+
+// routes are the same in every version.
+func (h *Handler) routes(r *mux.Router) {
+	r.HandleFunc("/purchases/{purchaseID}/status", withID("purchaseID", func(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+		withBody(func(w http.ResponseWriter, r *http.Request, req UpdateStatusRequest) {
+			h.UpdateStatus(w, r, id, req)
+		})(w, r)
+	})).Methods(http.MethodPut)
+	r.Handle("/loyalty-cards/{cardID}", h.limited("loyalty", withID("cardID", h.GetLoyaltyBalance))).Methods(http.MethodGet)
+	r.HandleFunc("/stores", h.ListStores).Methods(http.MethodGet)
+}
+
+func (h *Handler) limited(name string, next http.HandlerFunc) http.Handler {
+	if h.limiter == nil {
+		return next
+	}
+	return h.limiter.Middleware(name)(next)
+}
+
+// CreatePurchase completes the purchase before answering, unless the client prefers to have it completed in
+// the background with "Prefer: respond-async" and submissions are on. A purchase held for a manager's
+// review is answered 202 with the review.
+func (h Handler) CreatePurchase(w http.ResponseWriter, r *http.Request, req CreatePurchaseRequestV2) {
+	// A practice purchase is completed before answering, as the background would not know it is practice.
+	if h.submissions != nil && prefersAsync(r) && !sandbox.Enabled(r.Context()) {
+		h.SubmitPurchase(w, r, req)
+		return
+	}
+	p, err := h.completePurchase(r.Context(), req.toPurchase(), req.Payment)
+	if errors.Is(err, purchase.ErrHeldForReview) {
+		h.writeHeld(w, r, p, err)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/purchases/"+p.ID.String())
+	res := toReceiptV2(*p)
+	if req.GiftReceipt {
+		gift := toGiftReceipt(*p)
+		res.GiftReceipt = &gift
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (h Handler) CreatePurchaseV1(w http.ResponseWriter, r *http.Request, req CreatePurchaseRequest) {
+	v2 := req.toV2()
+	p, err := h.completePurchase(r.Context(), v2.toPurchase(), v2.Payment)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/purchases/"+p.ID.String())
+	writeJSON(w, http.StatusCreated, toReceiptV2(*p).toV1())
+}
+
+// completePurchase checks the caller may make p, paid as pay says, and completes it, stamping the loyalty
+// card it is paid with.
+func (h Handler) completePurchase(ctx context.Context, p *purchase.Purchase, pay Payment) (*purchase.Purchase, error) {
+	card, err := h.preparePurchase(ctx, p, pay)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.purchases.CompletePurchase(ctx, p.Store.ID, p, card); err != nil {
+		if errors.Is(err, purchase.ErrHeldForReview) {
+			// The card is stamped once the purchase is approved.
+			return p, err
+		}
+		return nil, err
+	}
+	if card != nil {
+		if err := h.cards.Save(ctx, card); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// preparePurchase checks the caller may make p, credits it to who served it and returns the loyalty card it
+// is paid with, if any.
+func (h Handler) preparePurchase(ctx context.Context, p *purchase.Purchase, pay Payment) (*loyalty.CoffeeBux, error) {
+	if sandbox.Enabled(ctx) {
+		// Practice is for the staff of the store, and earns no customer a stamp.
+		if err := h.authorize(ctx, auth.ActionPractise, auth.Resource{StoreID: p.Store.ID}); err != nil {
+			return nil, err
+		}
+		p.ServedBy = servedBy(ctx, p.ServedBy)
+		return nil, nil
+	}
+	if err := h.authorize(ctx, auth.ActionCreatePurchase, auth.Resource{StoreID: p.Store.ID, CustomerID: p.CustomerID}); err != nil {
+		return nil, err
+	}
+	if len(p.Overrides) > 0 {
+		if err := h.authorize(ctx, auth.ActionOverridePrice, auth.Resource{StoreID: p.Store.ID}); err != nil {
+			return nil, err
+		}
+	}
+	p.ServedBy = servedBy(ctx, p.ServedBy)
+	if pay.LoyaltyCardID == "" {
+		return nil, nil
+	}
+	card, err := h.cards.Get(ctx, uuid.MustParse(pay.LoyaltyCardID))
+	if err != nil {
+		return nil, err
+	}
+	// Customers may only use their own card.
+	if err := h.authorize(ctx, auth.ActionCreatePurchase, auth.Resource{StoreID: p.Store.ID, CustomerID: card.CustomerID()}); err != nil {
+		return nil, err
+	}
+	return card, nil
+}
+
+// servedBy is who a purchase is credited to: the barista asked for, or else the caller if they work at a
+// store. Customers do not get to say who earns on their purchase.
+func servedBy(ctx context.Context, requested string) string {
+	p, ok := auth.FromContext(ctx)
+	switch {
+	case !ok:
+		return requested
+	case !p.Has(auth.RoleBarista) && !p.Has(auth.RoleManager):
+		return ""
+	case requested == "":
+		return p.Subject
+	}
+	return requested
+}
+
+func (h Handler) GetReceipt(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	p, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toReceiptV2(p))
+}
+
+// GetGiftReceipt is the gift receipt of a purchase, for when it is asked for after paying.
+func (h Handler) GetGiftReceipt(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	p, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toGiftReceipt(p))
+}
+
+func (h Handler) GetReceiptV1(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	p, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toReceiptV2(p).toV1())
+}
+
+// UpdateStatus is called by the bar as a purchase is being made, so the customer can follow it.
+func (h Handler) UpdateStatus(w http.ResponseWriter, r *http.Request, id uuid.UUID, req UpdateStatusRequest) {
+	if h.authn != nil {
+		if _, err := h.getPurchase(r.Context(), id, auth.ActionUpdateStatus); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+	if err := h.purchases.UpdateStatus(r.Context(), id, purchase.Status(req.Status)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h Handler) GetLoyaltyBalance(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	card, err := h.cards.Get(r.Context(), id)
+	if err == nil {
+		err = h.authorize(r.Context(), auth.ActionViewCard, auth.Resource{StoreID: card.StoreID(), CustomerID: card.CustomerID()})
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toLoyaltyBalance(card))
+}
+
+func (h Handler) ListStores(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorize(r.Context(), auth.ActionListStores, auth.Resource{}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	stores, err := h.stores.ListStores(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	printer := h.localizer.For
+	if lang := acceptedLanguage(r); lang != "" {
+		printer = func(uuid.UUID) i18n.Printer { return h.localizer.In(lang) }
+	}
+	writeJSON(w, http.StatusOK, toStores(stores, printer))
+}
+
+// acceptedLanguage is the language the caller prefers most in their Accept-Language header, e.g. "de-CH"
+// for "de-CH, de;q=0.9, en;q=0.8"; empty if they do not say.
+func acceptedLanguage(r *http.Request) string {
+	var (
+		best string
+		q    = 0.0
+	)
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		if tag != "" && tag != "*" && weight > q {
+			best, q = tag, weight
+		}
+	}
+	return best
+}
+
+// getPurchase loads a purchase and checks the caller may perform a on it.
+func (h Handler) getPurchase(ctx context.Context, id uuid.UUID, a auth.Action) (purchase.Purchase, error) {
+	p, err := h.purchases.GetPurchase(ctx, id)
+	if err != nil {
+		return purchase.Purchase{}, err
+	}
+	if err := h.authorize(ctx, a, auth.Resource{StoreID: p.Store.ID, CustomerID: p.CustomerID}); err != nil {
+		return purchase.Purchase{}, err
+	}
+	return p, nil
+}
+
+func (h Handler) authorize(ctx context.Context, a auth.Action, r auth.Resource) error {
+	if h.authn == nil {
+		return nil
+	}
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return auth.ErrUnauthenticated
+	}
+	return auth.Authorize(p, a, r)
+}
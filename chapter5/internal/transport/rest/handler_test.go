@@ -0,0 +1,207 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/ratelimit"
+	"coffeeco/internal/store"
+	"coffeeco/internal/transport/rest"
+	"coffeeco/internal/validation"
+)
+
+type fakePurchases struct {
+	completed []*purchase.Purchase
+	err       error
+}
+
+func (f *fakePurchases) CompletePurchase(_ context.Context, _ uuid.UUID, p *purchase.Purchase, card *loyalty.CoffeeBux) error {
+	if f.err != nil {
+		return f.err
+	}
+	if card != nil {
+		card.AddStamp()
+	}
+	f.completed = append(f.completed, p)
+	return nil
+}
+
+func (f *fakePurchases) GetPurchase(context.Context, uuid.UUID) (purchase.Purchase, error) {
+	return purchase.Purchase{}, purchase.ErrNotFound
+}
+
+func (f *fakePurchases) UpdateStatus(context.Context, uuid.UUID, purchase.Status) error {
+	return f.err
+}
+
+func (f *fakePurchases) ImportPurchase(_ context.Context, _ uuid.UUID, _ time.Time, p *purchase.Purchase) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.completed = append(f.completed, p)
+	return nil
+}
+
+type fakeStores struct{}
+
+func (fakeStores) ListStores(context.Context) ([]store.Store, error) {
+	return []store.Store{store.New(uuid.New(), "Soho")}, nil
+}
+
+func newServer(t *testing.T, purchases *fakePurchases, cards *loyalty.MemoryRepository) *httptest.Server {
+	t.Helper()
+	h, err := rest.NewHandler(purchases, fakeStores{}, cards)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	srv := httptest.NewServer(rest.NewMux(h))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func Test_CreatePurchaseStampsTheLoyaltyCard(t *testing.T) {
+	var (
+		purchases = &fakePurchases{}
+		cards     = loyalty.NewMemoryRepo()
+		card      = loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: uuid.New()})
+	)
+	_ = cards.Save(context.Background(), card)
+	srv := newServer(t, purchases, cards)
+
+	body := `{"storeId":"` + uuid.NewString() + `","loyaltyCardId":"` + card.ID.String() + `","paymentMeans":"cash",
+		"items":[{"name":"flat white","price":{"amount":350,"currency":"USD"}}]}`
+	resp, err := http.Post(srv.URL+"/purchases", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d", resp.StatusCode)
+	}
+	if len(purchases.completed) != 1 || purchases.completed[0].ProductsToPurchase[0].ItemName != "flat white" {
+		t.Fatalf("expected the purchase to be completed but got %+v", purchases.completed)
+	}
+	saved, _ := cards.Get(context.Background(), card.ID)
+	if saved.RemainingDrinkPurchasesUntilFreeDrink != 9 {
+		t.Fatalf("expected the stamped card to be saved but got %+v", saved)
+	}
+}
+
+func Test_CreatePurchaseReportsEveryInvalidField(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+
+	body := `{"storeId":"not-a-uuid","paymentMeans":"card","items":[{"name":"","price":{"amount":0,"currency":"XXX1"}}]}`
+	resp, err := http.Post(srv.URL+"/purchases", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d", resp.StatusCode)
+	}
+	var er rest.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&er); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if er.Error.Code != "invalid_request" || len(er.Error.Fields) != 5 {
+		t.Fatalf("expected 5 field errors but got %+v", er.Error)
+	}
+}
+
+func Test_DomainErrorsAreMappedToStatusCodes(t *testing.T) {
+	tests := map[string]struct {
+		err    error
+		status int
+		code   string
+	}{
+		"charge failed":     {purchase.ErrCardChargeFailed, http.StatusPaymentRequired, "card_charge_failed"},
+		"gateway down":      {purchase.ErrCardPaymentsUnavailable, http.StatusServiceUnavailable, "card_payments_unavailable"},
+		"not enough drinks": {loyalty.ErrNotEnoughCoffeeBux, http.StatusUnprocessableEntity, "not_enough_coffeebux"},
+		"violations":        {validation.Errors{{Field: "products[1].price", Err: purchase.ErrMixedCurrencies}}, http.StatusUnprocessableEntity, "mixed_currencies"},
+		"unexpected":        {context.DeadlineExceeded, http.StatusInternalServerError, "internal"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newServer(t, &fakePurchases{err: tc.err}, loyalty.NewMemoryRepo())
+			body := `{"storeId":"` + uuid.NewString() + `","paymentMeans":"card","cardToken":"tok_visa",
+				"items":[{"name":"latte","price":{"amount":400,"currency":"USD"}}]}`
+			resp, err := http.Post(srv.URL+"/purchases", "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+			defer resp.Body.Close()
+			var er rest.ErrorResponse
+			_ = json.NewDecoder(resp.Body).Decode(&er)
+			if resp.StatusCode != tc.status || er.Error.Code != tc.code {
+				t.Fatalf("expected %d %s but got %d %s", tc.status, tc.code, resp.StatusCode, er.Error.Code)
+			}
+		})
+	}
+}
+
+func Test_GetReceiptReturns404ForUnknownPurchases(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+	resp, err := http.Get(srv.URL + "/purchases/" + uuid.NewString())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 but got %d", resp.StatusCode)
+	}
+}
+
+func Test_UpdateStatusOnlyAcceptsBarStatuses(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+
+	for status, want := range map[string]int{"preparing": http.StatusNoContent, "accepted": http.StatusBadRequest} {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/purchases/"+uuid.NewString()+"/status", strings.NewReader(`{"status":"`+status+`"}`))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("expected %d for %s but got %d", want, status, resp.StatusCode)
+		}
+	}
+}
+
+func Test_PurchasesAreRateLimited(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Quota{Rate: 1, Burst: 1}, ratelimit.Quota{Rate: 1, Burst: 1})
+	h, _ := rest.NewHandler(&fakePurchases{}, fakeStores{}, loyalty.NewMemoryRepo(), rest.WithRateLimiter(limiter))
+	srv := httptest.NewServer(rest.NewMux(h))
+	defer srv.Close()
+
+	body := `{"storeId":"` + uuid.NewString() + `","paymentMeans":"cash","items":[{"name":"latte","price":{"amount":400,"currency":"USD"}}]}`
+	var statuses []int
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post(srv.URL+"/purchases", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	if statuses[0] != http.StatusCreated || statuses[1] != http.StatusTooManyRequests {
+		t.Fatalf("expected 201 then 429 but got %v", statuses)
+	}
+	// Other endpoints are not limited.
+	for i := 0; i < 2; i++ {
+		resp, _ := http.Get(srv.URL + "/stores")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected stores to be served but got %d", resp.StatusCode)
+		}
+	}
+}
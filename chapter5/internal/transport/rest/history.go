@@ -0,0 +1,203 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/history"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/projection"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/validation"
+)
+
+// defaultHistoryLimit and maxHistoryLimit bound how many past purchases are listed at once.
+const (
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+type History interface {
+	Purchases(ctx context.Context, customerID uuid.UUID, limit int) ([]projection.HistoryEntry, error)
+	Favorites(ctx context.Context, customerID uuid.UUID, n int) ([]history.Favorite, error)
+	Reorder(ctx context.Context, past purchase.Purchase, storeID uuid.UUID) (*history.Reorder, error)
+}
+
+// WithHistory lets customers look back at their purchases and their favorites, and buy one of them again.
+func WithHistory(hs History) Option {
+	return func(h *Handler) {
+		h.history = hs
+	}
+}
+
+type PastPurchase struct {
+	PurchaseID  uuid.UUID `json:"purchaseId"`
+	StoreID     uuid.UUID `json:"storeId"`
+	Items       []string  `json:"items"`
+	Total       Money     `json:"total"`
+	PurchasedAt time.Time `json:"purchasedAt"`
+}
+
+type PurchaseHistoryResponse struct {
+	// Purchases are newest first.
+	Purchases []PastPurchase `json:"purchases"`
+}
+
+type FavoriteResponse struct {
+	// Items are in alphabetical order, once per item bought.
+	Items []string `json:"items"`
+	Count int      `json:"count"`
+	// LastPurchaseID is the purchase to reorder to buy the favorite again.
+	LastPurchaseID  uuid.UUID `json:"lastPurchaseId"`
+	LastStoreID     uuid.UUID `json:"lastStoreId"`
+	LastPurchasedAt time.Time `json:"lastPurchasedAt"`
+}
+
+type FavoritesResponse struct {
+	// Favorites are the most often bought first.
+	Favorites []FavoriteResponse `json:"favorites"`
+}
+
+type ReorderRequest struct {
+	// StoreID is where to buy it again; it defaults to where it was bought.
+	StoreID string  `json:"storeId,omitempty" format:"uuid"`
+	Payment Payment `json:"payment"`
+}
+
+func (r ReorderRequest) Validate() error {
+	var v validation.Validator
+	v.UUID("storeId", r.StoreID, false)
+	validatePayment(&v, r.Payment)
+	return v.Err()
+}
+
+type ReorderResponse struct {
+	Receipt ReceiptResponseV2 `json:"receipt"`
+	// Unavailable are the products of the past purchase left out, as the store no longer sells them or is
+	// out of what it takes to make them.
+	Unavailable []string `json:"unavailable"`
+}
+
+// ListCustomerPurchases lists the customer's latest purchases, newest first, at most limit of them.
+func (h Handler) ListCustomerPurchases(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) {
+	if !h.historyEnabled(w, r, customerID) {
+		return
+	}
+	limit := defaultHistoryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxHistoryLimit {
+			writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "limit", Message: "must be between 1 and " + strconv.Itoa(maxHistoryLimit)}}})
+			return
+		}
+	}
+	entries, err := h.history.Purchases(r.Context(), customerID, limit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := PurchaseHistoryResponse{Purchases: make([]PastPurchase, 0, len(entries))}
+	for _, e := range entries {
+		p := PastPurchase{Items: e.Items, Total: Money{Amount: e.Total, Currency: e.Currency}, PurchasedAt: e.PurchasedAt}
+		p.PurchaseID, _ = uuid.Parse(e.PurchaseID)
+		p.StoreID, _ = uuid.Parse(e.StoreID)
+		res.Purchases = append(res.Purchases, p)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// ListFavorites lists the combinations of items the customer bought most often.
+func (h Handler) ListFavorites(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) {
+	if !h.historyEnabled(w, r, customerID) {
+		return
+	}
+	favorites, err := h.history.Favorites(r.Context(), customerID, defaultHistoryLimit)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := FavoritesResponse{Favorites: make([]FavoriteResponse, 0, len(favorites))}
+	for _, f := range favorites {
+		res.Favorites = append(res.Favorites, FavoriteResponse{
+			Items:           f.Items,
+			Count:           f.Count,
+			LastPurchaseID:  f.LastPurchaseID,
+			LastStoreID:     f.LastStoreID,
+			LastPurchasedAt: f.LastPurchasedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// Reorder buys a past purchase again, at today's prices, leaving out what the store cannot make now. It is
+// completed like any other purchase, so it may be held for a manager's review too.
+func (h Handler) Reorder(w http.ResponseWriter, r *http.Request, id uuid.UUID, req ReorderRequest) {
+	if h.history == nil {
+		writeNoHistory(w)
+		return
+	}
+	// Whoever may see the purchase may buy it again, as long as they may make purchases at the store.
+	past, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if req.Payment.Means == payment.MEANS_WALLET && past.CustomerID == uuid.Nil {
+		writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "payment.means", Message: "cannot be wallet for a purchase without a customer"}}})
+		return
+	}
+	storeID := uuid.Nil
+	if req.StoreID != "" {
+		storeID = uuid.MustParse(req.StoreID)
+	}
+	re, err := h.history.Reorder(r.Context(), past, storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p := re.Purchase
+	p.PaymentMeans = payment.Means(req.Payment.Means)
+	if req.Payment.CardToken != "" {
+		token := req.Payment.CardToken
+		p.CardToken = &token
+	}
+	p, err = h.completePurchase(r.Context(), p, req.Payment)
+	if errors.Is(err, purchase.ErrHeldForReview) {
+		h.writeHeld(w, r, p, err)
+		return
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/purchases/"+p.ID.String())
+	unavailable := re.Unavailable
+	if unavailable == nil {
+		unavailable = []string{}
+	}
+	writeJSON(w, http.StatusCreated, ReorderResponse{Receipt: toReceiptV2(*p), Unavailable: unavailable})
+}
+
+// historyEnabled checks the caller may see the customer's purchases and that there is a purchase history,
+// writing the error response otherwise.
+func (h Handler) historyEnabled(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), auth.ActionViewPurchase, auth.Resource{CustomerID: customerID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.history == nil {
+		writeNoHistory(w)
+		return false
+	}
+	return true
+}
+
+func writeNoHistory(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there is no purchase history"}})
+}
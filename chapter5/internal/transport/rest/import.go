@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/importer"
+)
+
+// ImportSummary is the last line of an import's response.
+type ImportSummary struct {
+	Summary importer.Summary `json:"summary"`
+	// Error is set when the import stopped early, e.g. because the upload was cut off. Resume it from the
+	// record after the last result.
+	Error string `json:"error,omitempty"`
+}
+
+var importFormats = map[string]importer.Format{
+	"application/x-ndjson": importer.FormatNDJSON,
+	"text/csv":             importer.FormatCSV,
+}
+
+// ImportPurchases imports historical purchases uploaded as NDJSON or CSV. The response is NDJSON too: one
+// importer.Result per record as soon as it is imported, then an ImportSummary.
+func (h Handler) ImportPurchases(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorize(r.Context(), auth.ActionImport, auth.Resource{}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := importFormats[ct]
+	if !ok {
+		writeJSON(w, http.StatusUnsupportedMediaType, ErrorResponse{Error: ErrorBody{
+			Code:    "unsupported_media_type",
+			Message: "imports must be application/x-ndjson or text/csv",
+		}})
+		return
+	}
+	from := 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		var err error
+		if from, err = strconv.Atoi(v); err != nil || from < 1 {
+			writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "from", Message: "must be a record number from 1"}}})
+			return
+		}
+	}
+
+	// Results are streamed while the upload is still being read.
+	rc := http.NewResponseController(w)
+	_ = rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	sum, err := importer.Import(r.Context(), h.purchases, r.Body, format, from, func(res importer.Result) error {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	last := ImportSummary{Summary: sum}
+	if err != nil {
+		last.Error = err.Error()
+	}
+	_ = enc.Encode(last)
+}
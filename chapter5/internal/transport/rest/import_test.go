@@ -0,0 +1,66 @@
+package rest_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/importer"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/transport/rest"
+)
+
+func Test_ImportStreamsAResultPerRecord(t *testing.T) {
+	purchases := &fakePurchases{}
+	srv := newServer(t, purchases, loyalty.NewMemoryRepo())
+
+	record := `{"id":"` + uuid.NewString() + `","storeId":"` + uuid.NewString() + `","purchasedAt":"2023-01-02T08:00:00Z",` +
+		`"paymentMeans":"cash","items":[{"name":"latte","amount":400,"currency":"USD"}]}`
+	body := record + "\n" + `{"id":"broken"}` + "\n"
+	resp, err := http.Post(srv.URL+"/v2/imports/purchases", "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", resp.StatusCode)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	var results []importer.Result
+	var summary rest.ImportSummary
+	for sc.Scan() {
+		if strings.Contains(sc.Text(), `"summary"`) {
+			_ = json.Unmarshal(sc.Bytes(), &summary)
+			continue
+		}
+		var res importer.Result
+		_ = json.Unmarshal(sc.Bytes(), &res)
+		results = append(results, res)
+	}
+	if len(results) != 2 || results[0].Status != importer.StatusImported || results[1].Status != importer.StatusFailed {
+		t.Fatalf("expected one imported and one failed record but got %+v", results)
+	}
+	if summary.Summary.Imported != 1 || summary.Summary.Failed != 1 || summary.Error != "" {
+		t.Fatalf("expected a summary of 1 imported and 1 failed but got %+v", summary)
+	}
+	if len(purchases.completed) != 1 {
+		t.Fatalf("expected one purchase to be imported but got %d", len(purchases.completed))
+	}
+}
+
+func Test_ImportRejectsOtherFormats(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+	resp, err := http.Post(srv.URL+"/v2/imports/purchases", "application/json", strings.NewReader(`[]`))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 but got %d", resp.StatusCode)
+	}
+}
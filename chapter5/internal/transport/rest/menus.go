@@ -0,0 +1,41 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"coffeeco/internal/auth"
+)
+
+type Menus interface {
+	ExportMenu(ctx context.Context, storeID uuid.UUID, marketplace string) (any, error)
+}
+
+// WithMenus exports the menus of stores for marketplaces at /v2/stores/{storeID}/menus/{marketplace}.
+func WithMenus(m Menus) Option {
+	return func(h *Handler) {
+		h.menus = m
+	}
+}
+
+// ExportMenu returns the store's menu in the JSON the marketplace takes, ready to be sent to it. Managers
+// of the store only.
+func (h Handler) ExportMenu(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionManageStore, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.menus == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "menus are not exported to marketplaces"}})
+		return
+	}
+	menu, err := h.menus.ExportMenu(r.Context(), storeID, mux.Vars(r)["marketplace"])
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, menu)
+}
@@ -0,0 +1,128 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/sandbox"
+)
+
+const maxBodyBytes = 1 << 20
+
+type validatable interface {
+	Validate() error
+}
+
+// withBody decodes the JSON request body into T and validates it, so handlers only ever see valid requests.
+func withBody[T validatable](next func(w http.ResponseWriter, r *http.Request, body T)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") {
+			writeJSON(w, http.StatusUnsupportedMediaType, ErrorResponse{Error: ErrorBody{
+				Code:    "unsupported_media_type",
+				Message: "request body must be application/json",
+			}})
+			return
+		}
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		dec.DisallowUnknownFields()
+		var body T
+		if err := dec.Decode(&body); err != nil {
+			writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "body", Message: err.Error()}}})
+			return
+		}
+		if err := body.Validate(); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		next(w, r, body)
+	}
+}
+
+// withID parses the path variable name as a UUID.
+func withID(name string, next func(w http.ResponseWriter, r *http.Request, id uuid.UUID)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(mux.Vars(r)[name])
+		if err != nil {
+			writeError(w, r, &ValidationError{Fields: []FieldError{{Field: name, Message: "must be a UUID"}}})
+			return
+		}
+		next(w, r, id)
+	}
+}
+
+// recoverPanics turns a panicking handler into a 500 instead of a dropped connection.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if v := recover(); v != nil {
+				writeError(w, r, fmt.Errorf("panic: %v", v))
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate puts the Principal of the request's bearer token in its context. Paths in public are served
+// without one.
+func authenticate(a auth.Authenticator, public ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range public {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, r, auth.ErrUnauthenticated)
+				return
+			}
+			p, err := a.Authenticate(r.Context(), token)
+			if err != nil {
+				// Why a token was rejected is no business of whoever presented it.
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeError(w, r, auth.ErrUnauthenticated)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// practised are the routes a terminal in training mode may use: taking purchases and reading them back.
+// Anything else, such as refunding or running the drawer, is real whichever mode the terminal is in.
+var practised = map[string]bool{
+	http.MethodPost + " /purchases":                          true,
+	http.MethodGet + " /purchases/{purchaseID}":              true,
+	http.MethodGet + " /purchases/{purchaseID}/gift-receipt": true,
+}
+
+// practice refuses practice requests, see sandbox.Middleware, to every route but the practised ones.
+func practice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !sandbox.Enabled(r.Context()) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var path string
+		if route := mux.CurrentRoute(r); route != nil {
+			path, _ = route.GetPathTemplate()
+		}
+		for _, version := range []string{"/v1", "/v2"} {
+			path = strings.TrimPrefix(path, version)
+		}
+		if !practised[r.Method+" "+path] {
+			writeError(w, r, fmt.Errorf("%w: %s %s", sandbox.ErrUnavailable, r.Method, r.URL.Path))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
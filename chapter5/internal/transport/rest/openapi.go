@@ -0,0 +1,710 @@
+package rest
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/analytics"
+	"coffeeco/internal/importer"
+)
+
+// operation documents one route of NewMux. The request and response bodies are described by example values
+// of the DTOs, so the document is generated from the same types the handlers encode and decode. Operations
+// without a version are served the same way by every version.
+type operation struct {
+	version                   string
+	method, path, id, summary string
+	request                   any
+	responses                 map[int]any
+	// streams is the media type of a request and 200 response made of a stream of the documented values,
+	// instead of a single JSON value.
+	streams string
+	// csv says the 200 response can also be had as CSV, with format=csv.
+	csv bool
+}
+
+// analyticsParams are the query parameters every analytics report takes.
+const analyticsParams = " Covers from to to (RFC 3339, to defaults to now), at every store or at each store given. " +
+	"Analysts see every store, managers their own."
+
+// versions lists the API versions NewMux serves, oldest first. All but the last are deprecated.
+var versions = []string{"v1", "v2"}
+
+var operations = []operation{
+	{
+		version: "v1", method: http.MethodPost, path: "/purchases", id: "createPurchase",
+		summary:   "Complete a purchase, stamping the loyalty card if one is given.",
+		request:   CreatePurchaseRequest{},
+		responses: map[int]any{http.StatusCreated: ReceiptResponse{}, http.StatusPaymentRequired: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}, http.StatusTooManyRequests: ErrorResponse{}, http.StatusServiceUnavailable: ErrorResponse{}},
+	},
+	{
+		version: "v1", method: http.MethodGet, path: "/purchases/{purchaseID}", id: "getReceipt",
+		summary:   "Get the receipt of a purchase.",
+		responses: map[int]any{http.StatusOK: ReceiptResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/purchases", id: "createPurchase",
+		summary:   "Complete a purchase, stamping the loyalty card if one is given. With \"Prefer: respond-async\" the purchase is queued and completed in the background instead, answering 202 with the submission to follow. A card purchase over the store's review threshold is answered 202 with the review a manager has to approve before the card is charged.",
+		request:   CreatePurchaseRequestV2{},
+		responses: map[int]any{http.StatusCreated: ReceiptResponseV2{}, http.StatusAccepted: SubmissionResponse{}, http.StatusPaymentRequired: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}, http.StatusTooManyRequests: ErrorResponse{}, http.StatusServiceUnavailable: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/purchases/{purchaseID}", id: "getReceipt",
+		summary:   "Get the receipt of a purchase.",
+		responses: map[int]any{http.StatusOK: ReceiptResponseV2{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/purchases/{purchaseID}/gift-receipt", id: "getGiftReceipt",
+		summary:   "Get a gift receipt of a purchase: the items and the return code, without prices. Ask for one with the purchase with giftReceipt.",
+		responses: map[int]any{http.StatusOK: GiftReceiptResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/purchase-submissions/{submissionID}", id: "getSubmission",
+		summary:   "Follow a purchase submitted to be completed in the background, until it is completed or failed.",
+		responses: map[int]any{http.StatusOK: SubmissionResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/pre-orders", id: "placePreOrder",
+		summary:   "Schedule a pickup up to a week ahead. The amount is held on the card and charged shortly before the pickup.",
+		request:   PlacePreOrderRequest{},
+		responses: map[int]any{http.StatusCreated: PreOrderResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/pre-orders/{preOrderID}", id: "getPreOrder",
+		summary:   "A scheduled pickup, and whether its card was charged yet.",
+		responses: map[int]any{http.StatusOK: PreOrderResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/purchases/{purchaseID}/delivery", id: "getDelivery",
+		summary:   "Follow the delivery of a purchase.",
+		responses: map[int]any{http.StatusOK: DeliveryResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/imports/purchases", id: "importPurchases",
+		summary: "Import historical purchases without charging them, one importer.Record per line. " +
+			"CSV with the columns id, store_id, customer_id, purchased_at, payment_means, currency and items is accepted too. " +
+			"Results are streamed one per line; pass from to resume an import at a record.",
+		request:   importer.Record{},
+		responses: map[int]any{http.StatusOK: importer.Result{}, http.StatusUnsupportedMediaType: ErrorResponse{}},
+		streams:   "application/x-ndjson",
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/audit", id: "listAuditEntries",
+		summary:   "List audit log entries made between from and to (RFC 3339, to defaults to now), newest first. Filter by actor and cap with limit. Admins only.",
+		responses: map[int]any{http.StatusOK: AuditEntriesResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/sales-by-hour", id: "salesByHour",
+		summary:   "Sales by hour of the day, in the time zone tz (UTC by default), earliest first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.HourSales{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/sales-by-store", id: "salesByStore",
+		summary:   "Sales by store, highest revenue first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.StoreSales{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/sales-by-channel", id: "salesByChannel",
+		summary:   "Sales by the channel purchases were ordered through, e.g. in_store or app, highest revenue first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.ChannelSales{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/sales-by-product", id: "salesByProduct",
+		summary:   "Products by how many were sold, most first. Delivery fees are left out." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.ProductSales{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/average-ticket", id: "averageTicket",
+		summary:   "What a purchase is worth on average, by currency." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.Totals{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/discounts", id: "discountEffectiveness",
+		summary:   "Discounted purchases against full price ones, with what the discounts gave away." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.DiscountSales{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/loyalty", id: "loyaltyConversion",
+		summary:   "Purchases made by registered customers and how many came back, by store, with the free drinks redeemed." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.LoyaltyConversion{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/cups-saved-by-store", id: "cupsSavedByStore",
+		summary:   "Disposable cups saved by customers bringing their own, by store, for sustainability reporting." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.StoreCups{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/cups-saved-by-customer", id: "cupsSavedByCustomer",
+		summary:   "Disposable cups saved by each registered customer bringing their own." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.CustomerCups{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/settlements", id: "settlements",
+		summary:   "What purchases paid that is owed to each payee: the store, the marketplaces their service and delivery fees, and the couriers their tips. The store first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.PayeeSettlement{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/rounding", id: "rounding",
+		summary:   "What rounding cash totals to the smallest coin gained and lost each store each day, in the time zone asked for. Days first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.StoreRounding{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/price-overrides", id: "priceOverrides",
+		summary:   "Prices managers overrode each store each day, by reason, with what they gave away, in the time zone asked for. Days first." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.StoreOverrides{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/analytics/taxes", id: "taxes",
+		summary:   "Sales tax each store collected, by rate, with adjustments applied. Finance, analysts and managers for their own stores." + analyticsParams,
+		responses: map[int]any{http.StatusOK: []analytics.StoreTax{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/tickets", id: "listTickets",
+		summary:   "List the open tickets of a store, oldest first, with when each should be ready. Baristas of the store only.",
+		responses: map[int]any{http.StatusOK: TicketQueueResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/tabs", id: "listTabs",
+		summary:   "List the open tabs of a store, oldest first. Baristas of the store only.",
+		responses: map[int]any{http.StatusOK: []TabResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/tabs", id: "openTab",
+		summary:   "Open a tab for a table of a sit-down store. A table has at most one open tab.",
+		request:   OpenTabRequest{},
+		responses: map[int]any{http.StatusCreated: TabResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/tabs/{tabID}", id: "getTab",
+		summary:   "Get a tab with its lines, what is due and the purchases that paid for it.",
+		responses: map[int]any{http.StatusOK: TabResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tabs/{tabID}/lines", id: "addToTab",
+		summary:   "Put what a table ordered on its tab.",
+		request:   AddToTabRequest{},
+		responses: map[int]any{http.StatusOK: TabResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tabs/{tabID}/payments", id: "payTab",
+		summary:   "Pay for lines of a tab, a share of it, or what is left of it, with a purchase that references the tab. The tab is settled once nothing is due.",
+		request:   PayTabRequest{},
+		responses: map[int]any{http.StatusCreated: PayTabResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusPaymentRequired: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tabs/{tabID}/cancel", id: "cancelTab",
+		summary:   "Close a tab nothing was paid on.",
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/menus/{marketplace}", id: "exportMenu",
+		summary:   "The store's menu, priced and checked against its stock, in the JSON of a marketplace (ubereats or doordash), ready to be sent to it. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: map[string]any{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/customers/{customerID}/wallet", id: "getWallet",
+		summary:   "The balance of a customer's wallet, what is held for purchases being paid for, and its ledger.",
+		responses: map[int]any{http.StatusOK: WalletResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/customers/{customerID}/wallet/top-ups", id: "topUpWallet",
+		summary:   "Charge a card and add the amount to the customer's wallet, within the wallet limits. The first top-up opens the wallet.",
+		request:   TopUpRequest{},
+		responses: map[int]any{http.StatusOK: WalletResponse{}, http.StatusAccepted: RefundResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/purchases/{purchaseID}/refunds", id: "requestRefund",
+		summary:   "Ask for part or all of a purchase to be given back. Refunds within the limits are made at once (201); others wait for another manager of the store (202). Baristas and managers of the store only.",
+		request:   RefundRequest{},
+		responses: map[int]any{http.StatusCreated: RefundResponse{}, http.StatusAccepted: RefundResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/refunds", id: "listPendingRefunds",
+		summary:   "The refunds waiting for a manager of the store, oldest first. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: RefundListResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/refunds/{refundID}", id: "getRefund",
+		summary:   "A refund, and who asked for, decided on and made it.",
+		responses: map[int]any{http.StatusOK: RefundResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/refunds/{refundID}/approve", id: "approveRefund",
+		summary:   "Approve a refund and give the money back. Managers of the store other than who asked for it only.",
+		request:   RefundDecisionRequest{},
+		responses: map[int]any{http.StatusOK: RefundResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/refunds/{refundID}/reject", id: "rejectRefund",
+		summary:   "Turn a refund down, saying why in note.",
+		request:   RefundDecisionRequest{},
+		responses: map[int]any{http.StatusOK: RefundResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/refunds/{refundID}/execute", id: "executeRefund",
+		summary:   "Give back the money of an approved refund that could not be made when it was approved.",
+		responses: map[int]any{http.StatusOK: RefundResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/purchases/{purchaseID}/adjustments", id: "adjustPurchase",
+		summary:   "Correct the store or sales tax a purchase is reported with, saying why. The purchase itself is not changed. Finance only.",
+		request:   AdjustmentRequest{},
+		responses: map[int]any{http.StatusCreated: AdjustmentResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/purchases/{purchaseID}/adjustments", id: "listAdjustments",
+		summary:   "The adjustments of a purchase, oldest first. Finance only.",
+		responses: map[int]any{http.StatusOK: AdjustmentListResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/royalties/statements", id: "listRoyaltyStatements",
+		summary:   "The royalty statements of ?month=YYYY-MM, by franchisee. Finance only.",
+		responses: map[int]any{http.StatusOK: RoyaltyStatementListResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/royalties/statements/{statementID}", id: "getRoyaltyStatement",
+		summary:   "What a franchisee owes for a month, store by store, with the disputes over it. Finance only.",
+		responses: map[int]any{http.StatusOK: RoyaltyStatementResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/royalties/statements/{statementID}/disputes", id: "disputeRoyaltyStatement",
+		summary:   "Note a dispute over a statement. It is not exported to the accounts until the dispute is resolved. Finance only.",
+		request:   RoyaltyNoteRequest{},
+		responses: map[int]any{http.StatusOK: RoyaltyStatementResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/royalties/statements/{statementID}/resolution", id: "resolveRoyaltyStatement",
+		summary:   "Note how the open dispute over a statement was settled. Finance only.",
+		request:   RoyaltyNoteRequest{},
+		responses: map[int]any{http.StatusOK: RoyaltyStatementResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/drawer", id: "getDrawer",
+		summary:   "The open session of the store's drawer: its float and the cash dropped to the safe. Baristas and managers of the store only.",
+		responses: map[int]any{http.StatusOK: DrawerSessionResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/drawer", id: "openDrawer",
+		summary:   "Open the store's drawer with its float. Baristas and managers of the store only.",
+		request:   OpenDrawerRequest{},
+		responses: map[int]any{http.StatusCreated: DrawerSessionResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/drawer/drops", id: "dropToSafe",
+		summary:   "Record cash taken from the open drawer to the safe in a sealed bag. Baristas and managers of the store only.",
+		request:   SafeDropRequest{},
+		responses: map[int]any{http.StatusOK: DrawerSessionResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/drawer/close", id: "closeDrawer",
+		summary:   "Close the drawer with the cash counted in it, reconciled with the cash purchases. A discrepancy over the threshold is flagged to the store's manager. Baristas and managers of the store only.",
+		request:   CloseDrawerRequest{},
+		responses: map[int]any{http.StatusOK: DrawerSessionResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/deposits", id: "depositCash",
+		summary:   "Record cash banked, reconciled with the safe drops made since the previous deposit. A discrepancy over the threshold is flagged to the store's manager. Managers of the store only.",
+		request:   DepositRequest{},
+		responses: map[int]any{http.StatusCreated: DepositResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/cash", id: "getCashReport",
+		summary:   "The drawer sessions opened and deposits made at the store between ?from= and ?to=, flagged when they did not add up. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: CashReportResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/devices", id: "listDevices",
+		summary:   "The POS terminals registered at the store, revoked ones too, oldest first. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: DeviceListResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/devices", id: "registerDevice",
+		summary:   "Register a POS terminal at the store by the public key of its key pair. Managers of the store only.",
+		request:   RegisterDeviceRequest{},
+		responses: map[int]any{http.StatusCreated: DeviceResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/devices/{deviceID}", id: "getDevice",
+		summary:   "A registered POS terminal. Managers of its store only.",
+		responses: map[int]any{http.StatusOK: DeviceResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPut, path: "/devices/{deviceID}/firmware", id: "updateDeviceFirmware",
+		summary:   "Record the firmware a POS terminal was updated to. Managers of its store only.",
+		request:   DeviceFirmwareRequest{},
+		responses: map[int]any{http.StatusOK: DeviceResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/devices/{deviceID}/revoke", id: "revokeDevice",
+		summary:   "Revoke a compromised POS terminal; every purchase rung up on it is turned away from then on. Managers of its store only.",
+		request:   RevokeDeviceRequest{},
+		responses: map[int]any{http.StatusOK: DeviceResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/targets", id: "getTargetProgress",
+		summary:   "How far the store is towards its sales targets on ?date=, today where the store is by default: the whole day first, then its shifts. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: TargetProgressResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPut, path: "/stores/{storeID}/targets", id: "setTarget",
+		summary:   "Set what the store should sell on a day or in a named shift of it, replacing the target set before; target.hit is published once sales reach it. Managers of the store only.",
+		request:   SetTargetRequest{},
+		responses: map[int]any{http.StatusOK: TargetProgressResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/purchases/{purchaseID}/wallet-refunds", id: "refundToWallet",
+		summary:   "Credit part or all of a purchase paid from a wallet back to it. Managers of the store only.",
+		request:   WalletRefundRequest{},
+		responses: map[int]any{http.StatusOK: WalletResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPut, path: "/customers/{customerID}/device", id: "bindDevice",
+		summary:   "Make a device the only one the customer's QR codes are shown on. Codes shown on the device bound before can no longer be scanned.",
+		request:   BindDeviceRequest{},
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/customers/{customerID}/qr-tokens", id: "issueQRToken",
+		summary:   "Sign a short-lived token for one of the customer's loyalty cards or entitlements, to be shown as a QR code on their bound device.",
+		request:   IssueQRTokenRequest{},
+		responses: map[int]any{http.StatusCreated: QRTokenResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/qr-tokens/redeem", id: "redeemQRToken",
+		summary:   "What a scanned QR code stands for. Each code is redeemed once, before it expires. Staff of the store only.",
+		request:   RedeemQRTokenRequest{},
+		responses: map[int]any{http.StatusOK: RedemptionResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/customers/{customerID}/consents", id: "getConsents",
+		summary:   "Whether the customer may be sent marketing on each channel, and every decision it follows from, oldest first. Customers who never opted in are not sent any. The customer themselves only.",
+		responses: map[int]any{http.StatusOK: ConsentsResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/customers/{customerID}/consents", id: "recordConsent",
+		summary:   "Record the customer opting in to marketing on a channel, or out of it, and where they did. Decisions are never changed; the latest one of a channel counts. The customer themselves only.",
+		request:   ConsentRequest{},
+		responses: map[int]any{http.StatusOK: ConsentsResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/consents", id: "exportConsents",
+		summary:   "Every marketing consent decision recorded between ?from= and ?to= (RFC 3339, to defaults to now), oldest first, for compliance audits. Admins only.",
+		responses: map[int]any{http.StatusOK: ConsentExportResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+		csv:       true,
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/customers/{customerID}/purchases", id: "listCustomerPurchases",
+		summary:   "The customer's latest purchases, newest first: limit of them, 20 by default and at most 100.",
+		responses: map[int]any{http.StatusOK: PurchaseHistoryResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/customers/{customerID}/favorites", id: "listFavorites",
+		summary:   "The combinations of items the customer bought more than once among their latest purchases, the most often bought first.",
+		responses: map[int]any{http.StatusOK: FavoritesResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/purchases/{purchaseID}/reorder", id: "reorder",
+		summary:   "Buy a past purchase again, at the same store or another, at today's prices. Products the store no longer sells or cannot make now are left out and listed as unavailable. Completed like any other purchase, so it may be answered 202 with a review.",
+		request:   ReorderRequest{},
+		responses: map[int]any{http.StatusCreated: ReorderResponse{}, http.StatusAccepted: ReviewResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusPaymentRequired: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/receipts/{code}", id: "findReceipt",
+		summary:   "Find the receipt with a short code (e.g. K7Q2-M9XD, in any case) printed on it, of a purchase made at the store on date, the store's day as YYYY-MM-DD. Staff of the store only.",
+		responses: map[int]any{http.StatusOK: ReceiptResponseV2{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/wait", id: "getWait",
+		summary:   "When an order of items (comma separated, e.g. items=latte,croissant) placed now at a store should be ready, from its queue and how long the store takes to make each item.",
+		responses: map[int]any{http.StatusOK: WaitResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/quote", id: "quotePrice",
+		summary:   "Price products at a store without buying them, with every rule that went into the price. unitPrice is only needed for products the price book does not know.",
+		request:   QuoteRequest{},
+		responses: map[int]any{http.StatusOK: QuoteResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/stores/{storeID}/purchase-quotes", id: "quotePurchase",
+		summary:   "Quote a purchase before it is paid for: discounts, tax, suggested tips and what the customer's pass pays for. Nothing is charged; pass quoteToken when creating the purchase to be charged the quoted total until expiresAt.",
+		request:   QuotePurchaseRequest{},
+		responses: map[int]any{http.StatusOK: PurchaseQuoteResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/reviews", id: "listReviews",
+		summary:   "The purchases held for a manager of the store to review, oldest first. Managers of the store only.",
+		responses: map[int]any{http.StatusOK: ReviewListResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/stores/{storeID}/payment-means", id: "getPaymentMeans",
+		summary:   "The payment means the store takes for now, and why it does not take the others.",
+		responses: map[int]any{http.StatusOK: PaymentMeansResponse{}, http.StatusForbidden: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPut, path: "/stores/{storeID}/payment-means", id: "setPaymentMeans",
+		summary:   "Have the store take only some payment means for a while, e.g. while its card reader is broken; no means takes them all again. Purchases paid otherwise are turned away with payment_means_not_taken. Managers of the store and admins only.",
+		request:   PaymentMeansRequest{},
+		responses: map[int]any{http.StatusOK: PaymentMeansResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodGet, path: "/reviews/{purchaseID}", id: "getReview",
+		summary:   "A purchase held for review, and what was decided on it.",
+		responses: map[int]any{http.StatusOK: ReviewResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/reviews/{purchaseID}/approve", id: "approveReview",
+		summary:   "Approve a held purchase: its card is charged and the purchase completed. A purchase that waited too long is cancelled instead.",
+		responses: map[int]any{http.StatusOK: ReviewResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/reviews/{purchaseID}/reject", id: "rejectReview",
+		summary:   "Reject a held purchase: the amount held on its card is released and the purchase cancelled.",
+		request:   RejectReviewRequest{},
+		responses: map[int]any{http.StatusOK: ReviewResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tickets/{ticketID}/start", id: "startTicket",
+		summary:   "Take a ticket from the queue; barista defaults to the caller.",
+		request:   StartTicketRequest{},
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}, http.StatusUnprocessableEntity: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tickets/{ticketID}/ready", id: "ticketReady",
+		summary:   "Put a started ticket on the counter.",
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tickets/{ticketID}/picked-up", id: "ticketPickedUp",
+		summary:   "Take a ready ticket off the display once the customer has their order.",
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusNotFound: ErrorResponse{}, http.StatusConflict: ErrorResponse{}},
+	},
+	{
+		version: "v2", method: http.MethodPost, path: "/tickets/{ticketID}/proximity", id: "reportProximity",
+		summary:   "Tell how far the customer is from the store of their scheduled pickup; the ticket goes to the bar once they are close. The ticket's customer only.",
+		request:   ProximityRequest{},
+		responses: map[int]any{http.StatusOK: ProximityResponse{}, http.StatusBadRequest: ErrorResponse{}, http.StatusForbidden: ErrorResponse{}, http.StatusNotFound: ErrorResponse{}},
+	},
+	{
+		method: http.MethodPut, path: "/purchases/{purchaseID}/status", id: "updatePurchaseStatus",
+		summary:   "Tell the customer their purchase is being prepared or ready.",
+		request:   UpdateStatusRequest{},
+		responses: map[int]any{http.StatusNoContent: nil, http.StatusNotFound: ErrorResponse{}, http.StatusServiceUnavailable: ErrorResponse{}},
+	},
+	{
+		method: http.MethodGet, path: "/loyalty-cards/{cardID}", id: "getLoyaltyBalance",
+		summary:   "Get the free drinks on a loyalty card.",
+		responses: map[int]any{http.StatusOK: LoyaltyBalanceResponse{}, http.StatusNotFound: ErrorResponse{}, http.StatusTooManyRequests: ErrorResponse{}},
+	},
+	{
+		method: http.MethodGet, path: "/stores", id: "listStores",
+		summary:   "List the stores and what they sell, named in the language of the Accept-Language header or else of each store.",
+		responses: map[int]any{http.StatusOK: []StoreResponse{}},
+	},
+}
+
+var (
+	specOnce sync.Once
+	spec     map[string]any
+)
+
+// OpenAPI returns the OpenAPI 3 document describing the versioned paths served by NewMux.
+func OpenAPI() map[string]any {
+	specOnce.Do(func() {
+		schemas := map[string]any{}
+		paths := map[string]any{}
+		for i, v := range versions {
+			for _, op := range operations {
+				if op.version != "" && op.version != v {
+					continue
+				}
+				p := "/" + v + op.path
+				path, _ := paths[p].(map[string]any)
+				if path == nil {
+					path = map[string]any{}
+					paths[p] = path
+				}
+				doc := op.document(schemas)
+				doc["operationId"] = op.id + strings.ToUpper(v)
+				if i < len(versions)-1 {
+					doc["deprecated"] = true
+				}
+				path[strings.ToLower(op.method)] = doc
+			}
+		}
+		spec = map[string]any{
+			"openapi": "3.0.3",
+			"info": map[string]any{
+				"title":   "coffeeco",
+				"version": versions[len(versions)-1],
+			},
+			"paths": paths,
+			"components": map[string]any{
+				"schemas": schemas,
+				"securitySchemes": map[string]any{
+					"bearer": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				},
+			},
+			"security": []any{map[string]any{"bearer": []string{}}},
+		}
+	})
+	return spec
+}
+
+func (op operation) document(schemas map[string]any) map[string]any {
+	doc := map[string]any{"operationId": op.id, "summary": op.summary}
+
+	var params []any
+	for _, segment := range strings.Split(op.path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			name = strings.TrimSuffix(name, "}")
+			// IDs are UUIDs; other parameters, like a marketplace, are names.
+			schema := map[string]any{"type": "string"}
+			if strings.HasSuffix(name, "ID") {
+				schema["format"] = "uuid"
+			}
+			params = append(params, map[string]any{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   schema,
+			})
+		}
+	}
+	if params != nil {
+		doc["parameters"] = params
+	}
+
+	bodies := map[int]any{
+		http.StatusUnauthorized:        ErrorResponse{},
+		http.StatusForbidden:           ErrorResponse{},
+		http.StatusInternalServerError: ErrorResponse{},
+	}
+	if op.request != nil {
+		content := map[string]any{"application/json": map[string]any{"schema": schemaOf(reflect.TypeOf(op.request), schemas)}}
+		if op.streams != "" {
+			content = map[string]any{
+				op.streams: map[string]any{"schema": schemaOf(reflect.TypeOf(op.request), schemas)},
+				"text/csv": map[string]any{"schema": map[string]any{"type": "string"}},
+			}
+		}
+		doc["requestBody"] = map[string]any{"required": true, "content": content}
+		bodies[http.StatusBadRequest] = ErrorResponse{}
+	}
+	for status, body := range op.responses {
+		bodies[status] = body
+	}
+
+	responses := map[string]any{}
+	for status, body := range bodies {
+		res := map[string]any{"description": http.StatusText(status)}
+		mediaType := "application/json"
+		if op.streams != "" && status == http.StatusOK {
+			mediaType = op.streams
+		}
+		if body != nil {
+			res["content"] = map[string]any{mediaType: map[string]any{"schema": schemaOf(reflect.TypeOf(body), schemas)}}
+		}
+		if op.csv && status == http.StatusOK {
+			res["content"].(map[string]any)["text/csv"] = map[string]any{"schema": map[string]any{"type": "string"}}
+		}
+		responses[strconv.Itoa(status)] = res
+	}
+	doc["responses"] = responses
+	return doc
+}
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// schemaOf describes t the way encoding/json encodes it. Named structs are added to schemas and referenced.
+// Fields can narrow their schema with the format and enum struct tags.
+func schemaOf(t reflect.Type, schemas map[string]any) map[string]any {
+	switch t {
+	case uuidType:
+		return map[string]any{"type": "string", "format": "uuid"}
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem(), schemas)
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+		// Reserve the name first, so recursive types terminate.
+		schemas[t.Name()] = nil
+		schemas[t.Name()] = structSchema(t, schemas)
+		return ref
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type, schemas map[string]any) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s := schemaOf(f.Type, schemas)
+		if format := f.Tag.Get("format"); format != "" {
+			s = map[string]any{"type": "string", "format": format}
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			s = map[string]any{"type": "string", "enum": strings.Split(enum, ",")}
+		}
+		props[name] = s
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+	s := map[string]any{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+func (h Handler) ServeOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
@@ -0,0 +1,71 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/transport/rest"
+)
+
+func Test_OpenAPIDocumentsEveryRoute(t *testing.T) {
+	h, err := rest.NewHandler(&fakePurchases{}, fakeStores{}, loyalty.NewMemoryRepo())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	paths := rest.OpenAPI()["paths"].(map[string]any)
+
+	err = rest.NewMux(h).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, _ := route.GetPathTemplate()
+		methods, _ := route.GetMethods()
+		// The unversioned paths are undocumented aliases of v1.
+		if !strings.HasPrefix(tpl, "/v") {
+			return nil
+		}
+		for _, m := range methods {
+			if _, ok := paths[tpl].(map[string]any)[strings.ToLower(m)]; !ok {
+				t.Errorf("expected %s %s to be documented", m, tpl)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+}
+
+func Test_OpenAPIIsServed(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+	resp, err := http.Get(srv.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+
+	var doc struct {
+		OpenAPI    string
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string
+				Properties map[string]struct{ Enum []string }
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	req := doc.Components.Schemas["CreatePurchaseRequest"]
+	if _, ok := doc.Components.Schemas["CreatePurchaseRequestV2"]; !ok {
+		t.Fatalf("expected the v2 purchase request to be documented but got %+v", doc)
+	}
+	if doc.OpenAPI != "3.0.3" || len(req.Properties["paymentMeans"].Enum) != 3 {
+		t.Fatalf("expected the purchase request with its payment means but got %+v", doc)
+	}
+	if strings.Join(req.Required, ",") != "storeId,paymentMeans,items" {
+		t.Fatalf("expected storeId, paymentMeans and items to be required but got %v", req.Required)
+	}
+}
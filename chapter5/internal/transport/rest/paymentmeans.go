@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/store"
+	"coffeeco/internal/validation"
+)
+
+type StoreMeans interface {
+	PaymentMeans(ctx context.Context, storeID uuid.UUID) (store.PaymentMeans, error)
+	SetPaymentMeans(ctx context.Context, storeID uuid.UUID, allowed []payment.Means, reason string) (store.PaymentMeans, error)
+}
+
+// WithStoreMeans lets managers have their store stop taking some payment means for a while, at
+// /v2/stores/{storeID}/payment-means.
+func WithStoreMeans(m StoreMeans) Option {
+	return func(h *Handler) {
+		h.storeMeans = m
+	}
+}
+
+type PaymentMeansRequest struct {
+	// Allowed are the means the store takes from now on, among card, cash, coffeebux, marketplace and
+	// wallet; empty takes them all again.
+	Allowed []string `json:"allowed"`
+	// Reason tells customers why the other means are not taken, e.g. "card reader broken".
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r PaymentMeansRequest) Validate() error {
+	var v validation.Validator
+	for i, means := range r.Allowed {
+		v.Check(slices.Contains(store.AllMeans, payment.Means(means)), validation.Index("allowed", i), "must be card, cash, coffeebux, marketplace or wallet")
+	}
+	return v.Err()
+}
+
+type PaymentMeansResponse struct {
+	StoreID uuid.UUID `json:"storeId"`
+	// Allowed are the means the store takes for now, every means if it is not Restricted.
+	Allowed    []string   `json:"allowed"`
+	Restricted bool       `json:"restricted"`
+	Reason     string     `json:"reason,omitempty"`
+	UpdatedBy  string     `json:"updatedBy,omitempty"`
+	UpdatedAt  *time.Time `json:"updatedAt,omitempty"`
+}
+
+func toPaymentMeansResponse(m store.PaymentMeans) PaymentMeansResponse {
+	resp := PaymentMeansResponse{StoreID: m.StoreID, Allowed: []string{}, Restricted: len(m.Allowed) > 0, Reason: m.Reason, UpdatedBy: m.UpdatedBy}
+	for _, means := range store.AllMeans {
+		if m.Takes(means) {
+			resp.Allowed = append(resp.Allowed, string(means))
+		}
+	}
+	if !m.UpdatedAt.IsZero() {
+		resp.UpdatedAt = &m.UpdatedAt
+	}
+	return resp
+}
+
+// GetPaymentMeans tells which payment means the store takes for now, for tills and apps to offer only
+// those. Anyone signed in may ask.
+func (h Handler) GetPaymentMeans(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionListStores, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.storeMeans == nil {
+		writeJSON(w, http.StatusOK, toPaymentMeansResponse(store.PaymentMeans{StoreID: storeID}))
+		return
+	}
+	m, err := h.storeMeans.PaymentMeans(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toPaymentMeansResponse(m))
+}
+
+// SetPaymentMeans has the store take only some payment means, e.g. while its card reader is broken, or
+// all of them again. Managers of the store and admins only.
+func (h Handler) SetPaymentMeans(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req PaymentMeansRequest) {
+	if err := h.authorize(r.Context(), auth.ActionManageStore, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.storeMeans == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "stores take every payment means"}})
+		return
+	}
+	allowed := make([]payment.Means, 0, len(req.Allowed))
+	for _, means := range req.Allowed {
+		allowed = append(allowed, payment.Means(means))
+	}
+	m, err := h.storeMeans.SetPaymentMeans(r.Context(), storeID, allowed, req.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toPaymentMeansResponse(m))
+}
@@ -0,0 +1,118 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/preorder"
+	"coffeeco/internal/validation"
+)
+
+type PreOrders interface {
+	Place(ctx context.Context, storeID, customerID uuid.UUID, amount money.Money, pickupAt time.Time, cardToken string) (*preorder.PreOrder, error)
+	Get(ctx context.Context, id uuid.UUID) (*preorder.PreOrder, error)
+}
+
+// WithPreOrders lets customers schedule pickups at /v2/pre-orders, paid for by a card authorization that
+// is captured shortly before the pickup.
+func WithPreOrders(p PreOrders) Option {
+	return func(h *Handler) {
+		h.preOrders = p
+	}
+}
+
+type PlacePreOrderRequest struct {
+	StoreID    uuid.UUID `json:"storeId"`
+	CustomerID uuid.UUID `json:"customerId"`
+	Amount     Money     `json:"amount"`
+	PickupAt   time.Time `json:"pickupAt"`
+	// CardToken is the card the amount is held on until the pickup.
+	CardToken string `json:"cardToken"`
+}
+
+func (r PlacePreOrderRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.StoreID != uuid.Nil, "storeId", "is required")
+	v.Check(r.CustomerID != uuid.Nil, "customerId", "is required")
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	v.Check(!r.PickupAt.IsZero(), "pickupAt", "is required")
+	v.Check(r.CardToken != "", "cardToken", "is required")
+	return v.Err()
+}
+
+type PreOrderResponse struct {
+	PreOrderID uuid.UUID `json:"preOrderId"`
+	StoreID    uuid.UUID `json:"storeId"`
+	CustomerID uuid.UUID `json:"customerId"`
+	Amount     Money     `json:"amount"`
+	PickupAt   time.Time `json:"pickupAt"`
+	Status     string    `json:"status" enum:"authorized,captured,failed"`
+	// CapturedAt is when the card was charged, once it was.
+	CapturedAt *time.Time `json:"capturedAt,omitempty"`
+}
+
+func toPreOrderResponse(p *preorder.PreOrder) PreOrderResponse {
+	resp := PreOrderResponse{
+		PreOrderID: p.ID,
+		StoreID:    p.StoreID,
+		CustomerID: p.CustomerID,
+		Amount:     toMoney(p.Amount),
+		PickupAt:   p.PickupAt,
+		Status:     string(p.Status()),
+	}
+	if at := p.CapturedAt(); !at.IsZero() {
+		resp.CapturedAt = &at
+	}
+	return resp
+}
+
+// PlacePreOrder holds the amount on the card and schedules the pickup.
+func (h Handler) PlacePreOrder(w http.ResponseWriter, r *http.Request, req PlacePreOrderRequest) {
+	if !h.preOrdersEnabled(w, r, auth.Resource{StoreID: req.StoreID, CustomerID: req.CustomerID}, auth.ActionCreatePurchase) {
+		return
+	}
+	p, err := h.preOrders.Place(r.Context(), req.StoreID, req.CustomerID, *money.New(req.Amount.Amount, req.Amount.Currency), req.PickupAt, req.CardToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/pre-orders/"+p.ID.String())
+	writeJSON(w, http.StatusCreated, toPreOrderResponse(p))
+}
+
+// GetPreOrder returns a pre-order and whether it was paid for yet. Whoever may see a purchase may see it.
+func (h Handler) GetPreOrder(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if h.preOrders == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no pre-orders"}})
+		return
+	}
+	p, err := h.preOrders.Get(r.Context(), id)
+	if err == nil {
+		err = h.authorize(r.Context(), auth.ActionViewPurchase, auth.Resource{StoreID: p.StoreID, CustomerID: p.CustomerID})
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toPreOrderResponse(p))
+}
+
+// preOrdersEnabled checks the caller may perform a on res and that there are pre-orders, writing the error
+// response otherwise.
+func (h Handler) preOrdersEnabled(w http.ResponseWriter, r *http.Request, res auth.Resource, a auth.Action) bool {
+	if err := h.authorize(r.Context(), a, res); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.preOrders == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no pre-orders"}})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,227 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/pricing"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/validation"
+)
+
+type Prices interface {
+	Quote(ctx context.Context, r pricing.Request) (pricing.Quote, error)
+}
+
+// WithPrices quotes prices at /v2/stores/{storeID}/quote, with every rule that went into them.
+func WithPrices(p Prices) Option {
+	return func(h *Handler) {
+		h.prices = p
+	}
+}
+
+type QuoteRequest struct {
+	CustomerID string             `json:"customerId,omitempty" format:"uuid"`
+	Lines      []QuoteLineRequest `json:"lines"`
+}
+
+type QuoteLineRequest struct {
+	Product   string   `json:"product"`
+	Quantity  int      `json:"quantity"`
+	Size      string   `json:"size,omitempty"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	// ReusableCup is a drink served in the customer's own cup.
+	ReusableCup bool `json:"reusableCup,omitempty"`
+	// UnitPrice is the price of a product the price book does not know.
+	UnitPrice *Money `json:"unitPrice,omitempty"`
+}
+
+func (r QuoteRequest) Validate() error {
+	var v validation.Validator
+	v.UUID("customerId", r.CustomerID, false)
+	v.Check(len(r.Lines) > 0, "lines", "must contain at least one line")
+	for i, l := range r.Lines {
+		field := validation.Index("lines", i)
+		v.Check(l.Product != "", field+".product", "is required")
+		v.Check(l.Quantity > 0 && l.Quantity <= maxQuantity, field+".quantity", "must be between 1 and "+strconv.Itoa(maxQuantity))
+		if l.UnitPrice != nil {
+			v.Check(l.UnitPrice.Amount > 0, field+".unitPrice.amount", "must be positive")
+			v.Check(money.GetCurrency(l.UnitPrice.Currency) != nil, field+".unitPrice.currency", "must be an ISO 4217 code")
+		}
+	}
+	return v.Err()
+}
+
+// QuoteResponse itemizes a price: the components of each line add up to its unit price, and the
+// adjustments are taken off the subtotal.
+type QuoteResponse struct {
+	StoreID     uuid.UUID        `json:"storeId"`
+	QuotedAt    time.Time        `json:"quotedAt"`
+	Lines       []QuotedLine     `json:"lines"`
+	Subtotal    Money            `json:"subtotal"`
+	Adjustments []PriceComponent `json:"adjustments"`
+	Total       Money            `json:"total"`
+	// Stacking is how the discounts were combined, and Discounts the ones that were taken.
+	Stacking  string   `json:"stacking" enum:"sequential,best_of,additive,priority"`
+	Discounts []string `json:"discounts"`
+}
+
+type QuotedLine struct {
+	Product     string           `json:"product"`
+	Size        string           `json:"size,omitempty"`
+	Modifiers   []string         `json:"modifiers,omitempty"`
+	ReusableCup bool             `json:"reusableCup,omitempty"`
+	Quantity    int              `json:"quantity"`
+	Components  []PriceComponent `json:"components"`
+	UnitPrice   Money            `json:"unitPrice"`
+	Total       Money            `json:"total"`
+}
+
+type PriceComponent struct {
+	Kind   string `json:"kind" enum:"base,store_price,size,modifier,promotion,happy_hour,store_discount,reusable_cup,customer_discount,discount_cap"`
+	Name   string `json:"name,omitempty"`
+	Amount Money  `json:"amount"`
+}
+
+func (h Handler) QuotePrice(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req QuoteRequest) {
+	if h.prices == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "prices are not quoted"}})
+		return
+	}
+	pr := pricing.Request{StoreID: storeID}
+	if req.CustomerID != "" {
+		pr.CustomerID = uuid.MustParse(req.CustomerID)
+	}
+	for _, l := range req.Lines {
+		item := pricing.Item{Product: l.Product, Size: l.Size, Modifiers: l.Modifiers, ReusableCup: l.ReusableCup, Quantity: l.Quantity}
+		if l.UnitPrice != nil {
+			item.ListPrice = money.New(l.UnitPrice.Amount, l.UnitPrice.Currency)
+		}
+		pr.Items = append(pr.Items, item)
+	}
+	q, err := h.prices.Quote(r.Context(), pr)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toQuoteResponse(q))
+}
+
+func toQuoteResponse(q pricing.Quote) QuoteResponse {
+	resp := QuoteResponse{
+		StoreID:     q.StoreID,
+		QuotedAt:    q.At,
+		Lines:       make([]QuotedLine, 0, len(q.Lines)),
+		Subtotal:    toMoney(q.Subtotal),
+		Adjustments: toPriceComponents(q.Adjustments),
+		Total:       toMoney(q.Total),
+		Stacking:    string(q.Stacking),
+		Discounts:   make([]string, 0, len(q.Discounts)),
+	}
+	for _, k := range q.Discounts {
+		resp.Discounts = append(resp.Discounts, string(k))
+	}
+	for _, l := range q.Lines {
+		resp.Lines = append(resp.Lines, QuotedLine{
+			Product:     l.Item.Product,
+			Size:        l.Item.Size,
+			Modifiers:   l.Item.Modifiers,
+			ReusableCup: l.Item.ReusableCup,
+			Quantity:    l.Item.Quantity,
+			Components:  toPriceComponents(l.Components),
+			UnitPrice:   toMoney(l.Unit),
+			Total:       toMoney(l.Total),
+		})
+	}
+	return resp
+}
+
+func toPriceComponents(cs []pricing.Component) []PriceComponent {
+	res := make([]PriceComponent, 0, len(cs))
+	for _, c := range cs {
+		res = append(res, PriceComponent{Kind: string(c.Kind), Name: c.Name, Amount: toMoney(c.Amount)})
+	}
+	return res
+}
+
+type PurchaseQuotes interface {
+	QuotePurchase(ctx context.Context, storeID uuid.UUID, products []coffeeco.Product, customerID uuid.UUID) (*purchase.Quote, error)
+}
+
+// WithPurchaseQuotes quotes purchases before they are paid for at /v2/stores/{storeID}/purchase-quotes.
+func WithPurchaseQuotes(q PurchaseQuotes) Option {
+	return func(h *Handler) {
+		h.quotes = q
+	}
+}
+
+type QuotePurchaseRequest struct {
+	CustomerID string `json:"customerId,omitempty" format:"uuid"`
+	Lines      []Line `json:"lines"`
+}
+
+func (r QuotePurchaseRequest) Validate() error {
+	var v validation.Validator
+	v.UUID("customerId", r.CustomerID, false)
+	validateLines(&v, r.Lines)
+	return v.Err()
+}
+
+// PurchaseQuoteResponse is what a purchase would cost. Set quoteToken on the purchase to be charged the
+// total even if prices change before expiresAt.
+type PurchaseQuoteResponse struct {
+	StoreID uuid.UUID `json:"storeId"`
+	// Covered are the indexes, among the lines spelled out one product each, of the products the
+	// customer's pass pays for.
+	Covered []int         `json:"covered"`
+	Pricing QuoteResponse `json:"pricing"`
+	Total   Money         `json:"total"`
+	// Tax is the part of the total that is sales tax.
+	Tax        Money         `json:"tax"`
+	Tips       []TipResponse `json:"tips"`
+	QuoteToken string        `json:"quoteToken,omitempty"`
+	ExpiresAt  *time.Time    `json:"expiresAt,omitempty"`
+}
+
+type TipResponse struct {
+	Percent float64 `json:"percent"`
+	Amount  Money   `json:"amount"`
+}
+
+func (h Handler) QuotePurchase(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req QuotePurchaseRequest) {
+	if h.quotes == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "purchases are not quoted"}})
+		return
+	}
+	var customerID uuid.UUID
+	if req.CustomerID != "" {
+		customerID = uuid.MustParse(req.CustomerID)
+	}
+	q, err := h.quotes.QuotePurchase(r.Context(), storeID, toProducts(req.Lines), customerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := PurchaseQuoteResponse{
+		StoreID:    q.StoreID,
+		Covered:    append([]int{}, q.Covered...),
+		Pricing:    toQuoteResponse(q.Pricing),
+		Total:      toMoney(q.Total),
+		Tax:        toMoney(q.Tax),
+		Tips:       make([]TipResponse, 0, len(q.Tips)),
+		QuoteToken: q.Token,
+	}
+	for _, tip := range q.Tips {
+		resp.Tips = append(resp.Tips, TipResponse{Percent: tip.Percent, Amount: toMoney(tip.Amount)})
+	}
+	if q.Token != "" {
+		resp.ExpiresAt = &q.ExpiresAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/redemption"
+	"coffeeco/internal/validation"
+)
+
+type QRCodes interface {
+	BindDevice(ctx context.Context, customerID uuid.UUID, deviceID string) error
+	Issue(ctx context.Context, customerID uuid.UUID, deviceID string, sub redemption.Subject) (*redemption.Token, error)
+	Redeem(ctx context.Context, token string) (*redemption.Redemption, error)
+}
+
+// WithQRCodes lets customers show their loyalty cards and entitlements as QR codes on their device, for
+// baristas to scan instead of typing IDs.
+func WithQRCodes(q QRCodes) Option {
+	return func(h *Handler) {
+		h.qrCodes = q
+	}
+}
+
+type BindDeviceRequest struct {
+	// DeviceID is the app's installation ID on the customer's device.
+	DeviceID string `json:"deviceId"`
+}
+
+func (r BindDeviceRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.DeviceID != "", "deviceId", "is required")
+	return v.Err()
+}
+
+type IssueQRTokenRequest struct {
+	Kind string    `json:"kind" enum:"coffeebux,entitlement"`
+	ID   uuid.UUID `json:"id"`
+	// DeviceID must be the device bound to the customer.
+	DeviceID string `json:"deviceId"`
+}
+
+func (r IssueQRTokenRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Kind == string(redemption.KindCoffeeBux) || r.Kind == string(redemption.KindEntitlement), "kind", "must be coffeebux or entitlement")
+	v.Check(r.ID != uuid.Nil, "id", "is required")
+	v.Check(r.DeviceID != "", "deviceId", "is required")
+	return v.Err()
+}
+
+type QRTokenResponse struct {
+	// Token is shown as a QR code until ExpiresAt.
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type RedeemQRTokenRequest struct {
+	Token string `json:"token"`
+}
+
+func (r RedeemQRTokenRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Token != "", "token", "is required")
+	return v.Err()
+}
+
+type RedemptionResponse struct {
+	Kind       string    `json:"kind" enum:"coffeebux,entitlement"`
+	ID         uuid.UUID `json:"id"`
+	CustomerID uuid.UUID `json:"customerId"`
+}
+
+// BindDevice makes the device the only one the customer's QR codes are shown on. Codes shown on the device
+// bound before can no longer be scanned.
+func (h Handler) BindDevice(w http.ResponseWriter, r *http.Request, customerID uuid.UUID, req BindDeviceRequest) {
+	if !h.qrCodesEnabled(w, r, auth.ActionIssueQRToken, auth.Resource{CustomerID: customerID}) {
+		return
+	}
+	if err := h.qrCodes.BindDevice(r.Context(), customerID, req.DeviceID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IssueQRToken signs a short-lived token for one of the customer's loyalty cards or entitlements, to be
+// shown as a QR code.
+func (h Handler) IssueQRToken(w http.ResponseWriter, r *http.Request, customerID uuid.UUID, req IssueQRTokenRequest) {
+	if !h.qrCodesEnabled(w, r, auth.ActionIssueQRToken, auth.Resource{CustomerID: customerID}) {
+		return
+	}
+	t, err := h.qrCodes.Issue(r.Context(), customerID, req.DeviceID, redemption.Subject{Kind: redemption.Kind(req.Kind), ID: req.ID})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, QRTokenResponse{Token: t.Value, ExpiresAt: t.ExpiresAt})
+}
+
+// RedeemQRToken is what a scanned QR code stands for. Each code is only redeemed once.
+func (h Handler) RedeemQRToken(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req RedeemQRTokenRequest) {
+	if !h.qrCodesEnabled(w, r, auth.ActionRedeemQRToken, auth.Resource{StoreID: storeID}) {
+		return
+	}
+	rd, err := h.qrCodes.Redeem(r.Context(), req.Token)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, RedemptionResponse{Kind: string(rd.Kind), ID: rd.ID, CustomerID: rd.CustomerID})
+}
+
+// qrCodesEnabled checks the caller may perform a on res and that there are QR codes, writing the error
+// response otherwise.
+func (h Handler) qrCodesEnabled(w http.ResponseWriter, r *http.Request, a auth.Action, res auth.Resource) bool {
+	if err := h.authorize(r.Context(), a, res); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.qrCodes == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no QR codes"}})
+		return false
+	}
+	return true
+}
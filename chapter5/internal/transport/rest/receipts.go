@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/receipt"
+)
+
+type ReceiptCodes interface {
+	Lookup(ctx context.Context, storeID uuid.UUID, day, code string) (uuid.UUID, error)
+}
+
+// WithReceiptCodes lets support find a purchase from the short code on its paper receipt.
+func WithReceiptCodes(c ReceiptCodes) Option {
+	return func(h *Handler) {
+		h.receiptCodes = c
+	}
+}
+
+// FindReceipt is the receipt with the short code printed on it, of a purchase made at the store on date,
+// the store's day as YYYY-MM-DD. Staff of the store and admins may look receipts up.
+func (h Handler) FindReceipt(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionViewPurchase, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.receiptCodes == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "receipts have no short codes"}})
+		return
+	}
+	code, day := mux.Vars(r)["code"], r.URL.Query().Get("date")
+	var verr ValidationError
+	if _, err := receipt.ParseShortCode(code); err != nil {
+		verr.Fields = append(verr.Fields, FieldError{Field: "code", Message: "must be 8 letters and digits, e.g. K7Q2-M9XD"})
+	}
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		verr.Fields = append(verr.Fields, FieldError{Field: "date", Message: "must be a date as YYYY-MM-DD"})
+	}
+	if len(verr.Fields) > 0 {
+		writeError(w, r, &verr)
+		return
+	}
+	id, err := h.receiptCodes.Lookup(r.Context(), storeID, day, code)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	p, err := h.getPurchase(r.Context(), id, auth.ActionViewPurchase)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toReceiptV2(p))
+}
@@ -0,0 +1,215 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/validation"
+)
+
+type Refunds interface {
+	Request(ctx context.Context, purchaseID uuid.UUID, amount money.Money, reason string) (*refund.Refund, error)
+	Get(ctx context.Context, id uuid.UUID) (*refund.Refund, error)
+	Pending(ctx context.Context, storeID uuid.UUID) ([]*refund.Refund, error)
+	Approve(ctx context.Context, id uuid.UUID, note string) (*refund.Refund, error)
+	Reject(ctx context.Context, id uuid.UUID, reason string) (*refund.Refund, error)
+	Execute(ctx context.Context, id uuid.UUID) (*refund.Refund, error)
+}
+
+// WithRefunds lets baristas and managers ask for refunds at /v2/purchases/{purchaseID}/refunds, and
+// managers approve those over the limits. Refunds to wallets go through it too.
+func WithRefunds(rf Refunds) Option {
+	return func(h *Handler) {
+		h.refunds = rf
+	}
+}
+
+type RefundRequest struct {
+	Amount Money `json:"amount"`
+	// Reason is why the customer gets their money back, for the manager approving it and the audit log.
+	Reason string `json:"reason"`
+}
+
+func (r RefundRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	v.Check(r.Reason != "", "reason", "is required")
+	return v.Err()
+}
+
+type RefundDecisionRequest struct {
+	// Note is what the manager says about the decision; it is required to reject a refund.
+	Note string `json:"note,omitempty"`
+}
+
+func (r RefundDecisionRequest) Validate() error {
+	return nil
+}
+
+type RefundResponse struct {
+	ID          uuid.UUID `json:"id"`
+	PurchaseID  uuid.UUID `json:"purchaseId"`
+	StoreID     uuid.UUID `json:"storeId"`
+	Amount      Money     `json:"amount"`
+	Reason      string    `json:"reason"`
+	Status      string    `json:"status" enum:"requested,approved,rejected,executed"`
+	RequestedBy string    `json:"requestedBy"`
+	RequestedAt time.Time `json:"requestedAt"`
+	// ApprovalReason is why the refund needs a manager's approval; empty if it did not.
+	ApprovalReason string     `json:"approvalReason,omitempty"`
+	DecidedBy      string     `json:"decidedBy,omitempty"`
+	DecidedAt      *time.Time `json:"decidedAt,omitempty"`
+	Note           string     `json:"note,omitempty"`
+	ExecutedAt     *time.Time `json:"executedAt,omitempty"`
+}
+
+type RefundListResponse struct {
+	Refunds []RefundResponse `json:"refunds"`
+}
+
+func toRefundResponse(r *refund.Refund) RefundResponse {
+	resp := RefundResponse{
+		ID:             r.ID,
+		PurchaseID:     r.PurchaseID,
+		StoreID:        r.StoreID,
+		Amount:         toMoney(r.Amount),
+		Reason:         r.Reason,
+		Status:         string(r.Status()),
+		RequestedBy:    r.RequestedBy,
+		RequestedAt:    r.RequestedAt,
+		ApprovalReason: r.ApprovalReason,
+		DecidedBy:      r.DecidedBy(),
+		Note:           r.Note(),
+	}
+	if at := r.DecidedAt(); !at.IsZero() {
+		resp.DecidedAt = &at
+	}
+	if at := r.ExecutedAt(); !at.IsZero() {
+		resp.ExecutedAt = &at
+	}
+	return resp
+}
+
+// RequestRefund asks for part or all of a purchase to be given back. It answers 201 with the refund made,
+// or 202 with the refund waiting for a manager of the store.
+func (h Handler) RequestRefund(w http.ResponseWriter, r *http.Request, purchaseID uuid.UUID, req RefundRequest) {
+	if h.refunds == nil {
+		writeNoRefunds(w)
+		return
+	}
+	if _, err := h.getPurchase(r.Context(), purchaseID, auth.ActionRequestRefund); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rf, err := h.refunds.Request(r.Context(), purchaseID, *money.New(req.Amount.Amount, req.Amount.Currency), req.Reason)
+	h.writeRefund(w, r, rf, err, http.StatusCreated)
+}
+
+// ListPendingRefunds lists the refunds waiting for a manager of the store, oldest first.
+func (h Handler) ListPendingRefunds(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionApproveRefund, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.refunds == nil {
+		writeNoRefunds(w)
+		return
+	}
+	refunds, err := h.refunds.Pending(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := RefundListResponse{Refunds: make([]RefundResponse, 0, len(refunds))}
+	for _, rf := range refunds {
+		resp.Refunds = append(resp.Refunds, toRefundResponse(rf))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h Handler) GetRefund(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	rf, err := h.getRefund(r.Context(), id, auth.ActionRequestRefund)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRefundResponse(rf))
+}
+
+// ApproveRefund gives the money back. The caller is recorded as the manager who approved it, and may not
+// be who asked for it.
+func (h Handler) ApproveRefund(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RefundDecisionRequest) {
+	if _, err := h.getRefund(r.Context(), id, auth.ActionApproveRefund); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rf, err := h.refunds.Approve(r.Context(), id, req.Note)
+	h.writeRefund(w, r, rf, err, http.StatusOK)
+}
+
+func (h Handler) RejectRefund(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RefundDecisionRequest) {
+	if req.Note == "" {
+		writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "note", Message: "is required to reject a refund"}}})
+		return
+	}
+	if _, err := h.getRefund(r.Context(), id, auth.ActionApproveRefund); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rf, err := h.refunds.Reject(r.Context(), id, req.Note)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRefundResponse(rf))
+}
+
+// ExecuteRefund gives back the money of an approved refund that could not be made when it was approved.
+func (h Handler) ExecuteRefund(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if _, err := h.getRefund(r.Context(), id, auth.ActionApproveRefund); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rf, err := h.refunds.Execute(r.Context(), id)
+	h.writeRefund(w, r, rf, err, http.StatusOK)
+}
+
+// getRefund returns the refund if the caller may perform a at its store.
+func (h Handler) getRefund(ctx context.Context, id uuid.UUID, a auth.Action) (*refund.Refund, error) {
+	if h.refunds == nil {
+		return nil, refund.ErrNotFound
+	}
+	rf, err := h.refunds.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.authorize(ctx, a, auth.Resource{StoreID: rf.StoreID}); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// writeRefund answers status with a refund made and 202 with one waiting for approval. A refund approved
+// but not made is answered with the error.
+func (h Handler) writeRefund(w http.ResponseWriter, r *http.Request, rf *refund.Refund, err error, status int) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/refunds/"+rf.ID.String())
+	if rf.Status() == refund.StatusRequested {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, toRefundResponse(rf))
+}
+
+func writeNoRefunds(w http.ResponseWriter) {
+	writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no refunds"}})
+}
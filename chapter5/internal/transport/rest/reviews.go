@@ -0,0 +1,176 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/validation"
+)
+
+type Reviews interface {
+	GetReview(ctx context.Context, id uuid.UUID) (*purchase.Review, error)
+	PendingReviews(ctx context.Context, storeID uuid.UUID) ([]*purchase.Review, error)
+	ApproveReview(ctx context.Context, id uuid.UUID) (*purchase.Review, error)
+	RejectReview(ctx context.Context, id uuid.UUID, reason string) (*purchase.Review, error)
+}
+
+// WithReviews lets the managers of a store approve or reject the purchases held for their review at
+// /v2/reviews, and answers 202 with the review to purchases that are held.
+func WithReviews(rv Reviews) Option {
+	return func(h *Handler) {
+		h.reviews = rv
+	}
+}
+
+type RejectReviewRequest struct {
+	// Reason is why the purchase was rejected, for the audit log.
+	Reason string `json:"reason"`
+}
+
+func (r RejectReviewRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Reason != "", "reason", "is required")
+	return v.Err()
+}
+
+type ReviewResponse struct {
+	PurchaseID uuid.UUID `json:"purchaseId"`
+	StoreID    uuid.UUID `json:"storeId"`
+	CustomerID uuid.UUID `json:"customerId,omitempty"`
+	Total      Money     `json:"total"`
+	Status     string    `json:"status" enum:"pending,approved,rejected,expired"`
+	HeldAt     time.Time `json:"heldAt"`
+	// ExpiresAt is when the purchase is cancelled if no manager decided on it.
+	ExpiresAt time.Time  `json:"expiresAt"`
+	DecidedBy string     `json:"decidedBy,omitempty"`
+	DecidedAt *time.Time `json:"decidedAt,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+type ReviewListResponse struct {
+	Reviews []ReviewResponse `json:"reviews"`
+}
+
+func toReviewResponse(r *purchase.Review) ReviewResponse {
+	resp := ReviewResponse{
+		PurchaseID: r.ID(),
+		StoreID:    r.StoreID,
+		CustomerID: r.Purchase.CustomerID,
+		Total:      toMoney(r.Purchase.Total()),
+		Status:     string(r.Status()),
+		HeldAt:     r.HeldAt,
+		ExpiresAt:  r.ExpiresAt,
+		DecidedBy:  r.DecidedBy(),
+		Reason:     r.Reason(),
+	}
+	if at := r.DecidedAt(); !at.IsZero() {
+		resp.DecidedAt = &at
+	}
+	return resp
+}
+
+// ListReviews lists the purchases waiting for a manager of the store, oldest first.
+func (h Handler) ListReviews(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if !h.reviewsEnabled(w, r, storeID) {
+		return
+	}
+	reviews, err := h.reviews.PendingReviews(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := ReviewListResponse{Reviews: make([]ReviewResponse, 0, len(reviews))}
+	for _, rv := range reviews {
+		resp.Reviews = append(resp.Reviews, toReviewResponse(rv))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h Handler) GetReview(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	rv, err := h.getReview(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toReviewResponse(rv))
+}
+
+// ApproveReview captures the card of a held purchase and completes it. The caller is recorded as the
+// manager who approved it.
+func (h Handler) ApproveReview(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if _, err := h.getReview(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rv, err := h.reviews.ApproveReview(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/purchases/"+id.String())
+	writeJSON(w, http.StatusOK, toReviewResponse(rv))
+}
+
+// RejectReview releases the card authorization of a held purchase and cancels it.
+func (h Handler) RejectReview(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RejectReviewRequest) {
+	if _, err := h.getReview(r.Context(), id); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	rv, err := h.reviews.RejectReview(r.Context(), id, req.Reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toReviewResponse(rv))
+}
+
+// getReview returns the review if the caller may decide on purchases at its store.
+func (h Handler) getReview(ctx context.Context, id uuid.UUID) (*purchase.Review, error) {
+	if h.reviews == nil {
+		return nil, purchase.ErrNoReviews
+	}
+	rv, err := h.reviews.GetReview(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.authorize(ctx, auth.ActionReviewPurchase, auth.Resource{StoreID: rv.StoreID}); err != nil {
+		return nil, err
+	}
+	return rv, nil
+}
+
+// reviewsEnabled checks the caller may review the purchases of the store and that purchases are reviewed,
+// writing the error response otherwise.
+func (h Handler) reviewsEnabled(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), auth.ActionReviewPurchase, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.reviews == nil {
+		writeError(w, r, purchase.ErrNoReviews)
+		return false
+	}
+	return true
+}
+
+// writeHeld answers a purchase held for review with the review to follow, or with the error if the review
+// cannot be shown.
+func (h Handler) writeHeld(w http.ResponseWriter, r *http.Request, p *purchase.Purchase, err error) {
+	if h.reviews == nil || p == nil {
+		writeError(w, r, err)
+		return
+	}
+	rv, gerr := h.reviews.GetReview(r.Context(), p.ID)
+	if gerr != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/reviews/"+p.ID.String())
+	writeJSON(w, http.StatusAccepted, toReviewResponse(rv))
+}
@@ -0,0 +1,182 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/royalty"
+)
+
+type Royalties interface {
+	Statements(ctx context.Context, month string) ([]*royalty.Statement, error)
+	Get(ctx context.Context, id uuid.UUID) (*royalty.Statement, error)
+	Dispute(ctx context.Context, id uuid.UUID, note string) (*royalty.Statement, error)
+	Resolve(ctx context.Context, id uuid.UUID, note string) (*royalty.Statement, error)
+}
+
+// WithRoyalties lets finance read the franchisees' royalty statements under /v2/royalties, and note
+// disputes over them. Statements are worked out and exported with coffeectl.
+func WithRoyalties(r Royalties) Option {
+	return func(h *Handler) {
+		h.royalties = r
+	}
+}
+
+type RoyaltyNoteRequest struct {
+	// Note is what the dispute is about, or how it was resolved.
+	Note string `json:"note"`
+}
+
+func (r RoyaltyNoteRequest) Validate() error {
+	if r.Note == "" {
+		return &ValidationError{Fields: []FieldError{{Field: "note", Message: "is required"}}}
+	}
+	return nil
+}
+
+type RoyaltyStoreLine struct {
+	StoreID   uuid.UUID `json:"storeId"`
+	Purchases int64     `json:"purchases"`
+	Sales     int64     `json:"sales"`
+	Refunds   int64     `json:"refunds"`
+}
+
+type RoyaltyAnnotation struct {
+	Kind string    `json:"kind" enum:"dispute,resolution"`
+	Note string    `json:"note"`
+	By   string    `json:"by"`
+	At   time.Time `json:"at"`
+}
+
+type RoyaltyStatementResponse struct {
+	ID           uuid.UUID `json:"id"`
+	FranchiseeID string    `json:"franchiseeId"`
+	Name         string    `json:"name"`
+	Month        string    `json:"month"`
+	Currency     string    `json:"currency"`
+	Percent      float64   `json:"percent"`
+	// Stores and NetSales are in the minor unit of Currency, like Royalty.
+	Stores      []RoyaltyStoreLine  `json:"stores"`
+	NetSales    int64               `json:"netSales"`
+	Royalty     int64               `json:"royalty"`
+	Status      string              `json:"status" enum:"open,disputed,exported"`
+	GeneratedAt time.Time           `json:"generatedAt"`
+	Annotations []RoyaltyAnnotation `json:"annotations"`
+	ExportedAt  *time.Time          `json:"exportedAt,omitempty"`
+	ExportRef   string              `json:"exportRef,omitempty"`
+}
+
+type RoyaltyStatementListResponse struct {
+	Statements []RoyaltyStatementResponse `json:"statements"`
+}
+
+func toRoyaltyStatementResponse(st *royalty.Statement) RoyaltyStatementResponse {
+	resp := RoyaltyStatementResponse{
+		ID:           st.ID,
+		FranchiseeID: st.FranchiseeID,
+		Name:         st.Name,
+		Month:        st.Month,
+		Currency:     st.Currency,
+		Percent:      st.Percent,
+		Stores:       make([]RoyaltyStoreLine, 0, len(st.Stores)),
+		NetSales:     st.NetSales,
+		Royalty:      st.Royalty,
+		Status:       "open",
+		GeneratedAt:  st.GeneratedAt,
+		Annotations:  make([]RoyaltyAnnotation, 0, len(st.Annotations)),
+		ExportRef:    st.ExportRef,
+	}
+	for _, l := range st.Stores {
+		resp.Stores = append(resp.Stores, RoyaltyStoreLine(l))
+	}
+	for _, a := range st.Annotations {
+		kind := "dispute"
+		if a.Resolution {
+			kind = "resolution"
+		}
+		resp.Annotations = append(resp.Annotations, RoyaltyAnnotation{Kind: kind, Note: a.Note, By: a.By, At: a.At})
+	}
+	switch {
+	case st.Exported():
+		resp.Status = "exported"
+		at := st.ExportedAt
+		resp.ExportedAt = &at
+	case st.Disputed():
+		resp.Status = "disputed"
+	}
+	return resp
+}
+
+// ListRoyaltyStatements lists the statements of ?month=2006-01, by franchisee.
+func (h Handler) ListRoyaltyStatements(w http.ResponseWriter, r *http.Request) {
+	if !h.canManageRoyalties(w, r) {
+		return
+	}
+	month := r.URL.Query().Get("month")
+	if _, err := time.Parse("2006-01", month); err != nil {
+		writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "month", Message: "must be a month as YYYY-MM"}}})
+		return
+	}
+	statements, err := h.royalties.Statements(r.Context(), month)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	resp := RoyaltyStatementListResponse{Statements: make([]RoyaltyStatementResponse, 0, len(statements))}
+	for _, st := range statements {
+		resp.Statements = append(resp.Statements, toRoyaltyStatementResponse(st))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h Handler) GetRoyaltyStatement(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if !h.canManageRoyalties(w, r) {
+		return
+	}
+	st, err := h.royalties.Get(r.Context(), id)
+	h.writeRoyaltyStatement(w, r, st, err)
+}
+
+// DisputeRoyaltyStatement notes a dispute over a statement, keeping it out of the accounts until it is
+// resolved.
+func (h Handler) DisputeRoyaltyStatement(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RoyaltyNoteRequest) {
+	if !h.canManageRoyalties(w, r) {
+		return
+	}
+	st, err := h.royalties.Dispute(r.Context(), id, req.Note)
+	h.writeRoyaltyStatement(w, r, st, err)
+}
+
+func (h Handler) ResolveRoyaltyStatement(w http.ResponseWriter, r *http.Request, id uuid.UUID, req RoyaltyNoteRequest) {
+	if !h.canManageRoyalties(w, r) {
+		return
+	}
+	st, err := h.royalties.Resolve(r.Context(), id, req.Note)
+	h.writeRoyaltyStatement(w, r, st, err)
+}
+
+// canManageRoyalties answers the request and returns false unless statements are served and the caller may
+// manage them.
+func (h Handler) canManageRoyalties(w http.ResponseWriter, r *http.Request) bool {
+	if h.royalties == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no franchisees"}})
+		return false
+	}
+	if err := h.authorize(r.Context(), auth.ActionManageRoyalty, auth.Resource{}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+func (h Handler) writeRoyaltyStatement(w http.ResponseWriter, r *http.Request, st *royalty.Statement, err error) {
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toRoyaltyStatementResponse(st))
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/submission"
+)
+
+type Submissions interface {
+	Submit(ctx context.Context, p *purchase.Purchase, loyaltyCardID uuid.UUID) (*submission.Submission, error)
+	Get(ctx context.Context, id uuid.UUID) (*submission.Submission, error)
+}
+
+// WithSubmissions lets clients have purchases completed in the background, answering them at once with
+// where to follow the purchase at /v2/purchase-submissions/{submissionID}.
+func WithSubmissions(s Submissions) Option {
+	return func(h *Handler) {
+		h.submissions = s
+	}
+}
+
+type SubmissionResponse struct {
+	SubmissionID uuid.UUID `json:"submissionId"`
+	Status       string    `json:"status" enum:"queued,processing,completed,failed"`
+	// PurchaseID is the purchase made, once the submission is completed.
+	PurchaseID *uuid.UUID `json:"purchaseId,omitempty"`
+	// Error is why the purchase failed, as the API would have answered it had it been completed at once.
+	Error       *ErrorBody `json:"error,omitempty"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+func toSubmissionResponse(s *submission.Submission) SubmissionResponse {
+	resp := SubmissionResponse{SubmissionID: s.ID, Status: string(s.Status()), SubmittedAt: s.SubmittedAt, UpdatedAt: s.UpdatedAt()}
+	if id := s.PurchaseID(); id != uuid.Nil {
+		resp.PurchaseID = &id
+	}
+	if code, message := s.Failure(); code != "" {
+		resp.Error = &ErrorBody{Code: code, Message: message}
+	}
+	return resp
+}
+
+// prefersAsync tells whether the client asked for the request to be processed in the background, as in
+// RFC 7240.
+func prefersAsync(r *http.Request) bool {
+	for _, v := range r.Header.Values("Prefer") {
+		for pref := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SubmitPurchase checks the caller may make the purchase and queues it, answering 202 with where to
+// follow it.
+func (h Handler) SubmitPurchase(w http.ResponseWriter, r *http.Request, req CreatePurchaseRequestV2) {
+	p := req.toPurchase()
+	card, err := h.preparePurchase(r.Context(), p, req.Payment)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var cardID uuid.UUID
+	if card != nil {
+		cardID = card.ID
+	}
+	s, err := h.submissions.Submit(r.Context(), p, cardID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/v2/purchase-submissions/"+s.ID.String())
+	w.Header().Set("Preference-Applied", "respond-async")
+	writeJSON(w, http.StatusAccepted, toSubmissionResponse(s))
+}
+
+// GetSubmission returns where a purchase submitted to be completed in the background is. Whoever may see
+// the purchase may see its submission.
+func (h Handler) GetSubmission(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	if h.submissions == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "purchases are not submitted in the background"}})
+		return
+	}
+	s, err := h.submissions.Get(r.Context(), id)
+	if err == nil {
+		err = h.authorize(r.Context(), auth.ActionViewPurchase, auth.Resource{StoreID: s.StoreID, CustomerID: s.CustomerID})
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toSubmissionResponse(s))
+}
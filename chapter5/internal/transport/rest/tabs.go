@@ -0,0 +1,288 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/tab"
+	"coffeeco/internal/validation"
+)
+
+type Tabs interface {
+	Open(ctx context.Context, storeID uuid.UUID, table, currency string) (*tab.Tab, error)
+	Tab(ctx context.Context, id uuid.UUID) (*tab.Tab, error)
+	OpenTabs(ctx context.Context, storeID uuid.UUID) ([]*tab.Tab, error)
+	Add(ctx context.Context, id uuid.UUID, orders ...tab.Order) (*tab.Tab, error)
+	Cancel(ctx context.Context, id uuid.UUID) error
+	Pay(ctx context.Context, id uuid.UUID, st tab.Settlement) (*purchase.Purchase, error)
+}
+
+// WithTabs runs the tabs of tables at sit-down stores, under /v2/stores/{storeID}/tabs and /v2/tabs.
+func WithTabs(t Tabs) Option {
+	return func(h *Handler) {
+		h.tabs = t
+	}
+}
+
+type OpenTabRequest struct {
+	Table    string `json:"table"`
+	Currency string `json:"currency"`
+}
+
+func (r OpenTabRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Table != "", "table", "is required")
+	v.Check(money.GetCurrency(r.Currency) != nil, "currency", "must be an ISO 4217 code")
+	return v.Err()
+}
+
+type AddToTabRequest struct {
+	Lines []Line `json:"lines"`
+}
+
+func (r AddToTabRequest) Validate() error {
+	var v validation.Validator
+	v.Check(len(r.Lines) > 0, "lines", "must contain at least one line")
+	for i, l := range r.Lines {
+		field := validation.Index("lines", i)
+		v.Check(l.Product != "", field+".product", "is required")
+		v.Check(l.Quantity > 0 && l.Quantity <= maxQuantity, field+".quantity", "must be between 1 and "+strconv.Itoa(maxQuantity))
+		v.Check(l.UnitPrice.Amount > 0, field+".unitPrice.amount", "must be positive")
+		v.Check(money.GetCurrency(l.UnitPrice.Currency) != nil, field+".unitPrice.currency", "must be an ISO 4217 code")
+	}
+	return v.Err()
+}
+
+// PayTabRequest pays part of a tab: the lines given, by index, or an equal share of every line when the
+// table splits the bill ways ways. Neither pays everything left.
+type PayTabRequest struct {
+	Lines      []int   `json:"lines,omitempty"`
+	Ways       int     `json:"ways,omitempty"`
+	CustomerID string  `json:"customerId,omitempty" format:"uuid"`
+	Payment    Payment `json:"payment"`
+	// ServedBy defaults to the caller, as for purchases.
+	ServedBy string `json:"servedBy,omitempty"`
+}
+
+func (r PayTabRequest) Validate() error {
+	var v validation.Validator
+	v.UUID("customerId", r.CustomerID, false)
+	v.UUID("payment.loyaltyCardId", r.Payment.LoyaltyCardID, false)
+	v.Check(len(r.Lines) == 0 || r.Ways == 0, "ways", "cannot be given with lines")
+	v.Check(r.Ways >= 0 && r.Ways <= maxQuantity, "ways", "must be between 0 and "+strconv.Itoa(maxQuantity))
+	switch r.Payment.Means {
+	case payment.MEANS_CARD:
+		v.Check(r.Payment.CardToken != "", "payment.cardToken", "is required when paying by card")
+	case payment.MEANS_CASH:
+	case payment.MEANS_COFFEEBUX:
+		v.Check(r.Payment.LoyaltyCardID != "", "payment.loyaltyCardId", "is required when paying with coffeebux")
+	case payment.MEANS_WALLET:
+		v.Check(r.CustomerID != "", "customerId", "is required when paying from a wallet")
+	default:
+		v.Add("payment.means", "must be one of card, cash, coffeebux, wallet")
+	}
+	return v.Err()
+}
+
+type TabResponse struct {
+	TabID     uuid.UUID   `json:"tabId"`
+	StoreID   uuid.UUID   `json:"storeId"`
+	Table     string      `json:"table"`
+	Status    string      `json:"status" enum:"open,settled,cancelled"`
+	Lines     []TabLine   `json:"lines"`
+	Total     Money       `json:"total"`
+	Due       Money       `json:"due"`
+	Purchases []uuid.UUID `json:"purchases"`
+	OpenedAt  time.Time   `json:"openedAt"`
+	SettledAt *time.Time  `json:"settledAt,omitempty"`
+}
+
+// TabLine is one unit of a product on a tab; payments refer to it by its index in the tab's lines.
+type TabLine struct {
+	Product string    `json:"product"`
+	Price   Money     `json:"price"`
+	Paid    Money     `json:"paid"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+type PayTabResponse struct {
+	Receipt ReceiptResponseV2 `json:"receipt"`
+	Tab     TabResponse       `json:"tab"`
+}
+
+func toTabResponse(t *tab.Tab) TabResponse {
+	r := TabResponse{
+		TabID:     t.ID,
+		StoreID:   t.StoreID,
+		Table:     t.Table,
+		Status:    string(t.Status()),
+		Lines:     []TabLine{},
+		Total:     toMoney(*t.Total()),
+		Due:       toMoney(*t.Due()),
+		Purchases: []uuid.UUID{},
+		OpenedAt:  t.OpenedAt,
+	}
+	for _, l := range t.Lines() {
+		r.Lines = append(r.Lines, TabLine{
+			Product: l.Item,
+			Price:   Money{Amount: l.Price, Currency: t.Currency},
+			Paid:    Money{Amount: l.Paid, Currency: t.Currency},
+			AddedAt: l.AddedAt,
+		})
+	}
+	for _, p := range t.Payments() {
+		r.Purchases = append(r.Purchases, p.PurchaseID)
+	}
+	if at := t.SettledAt(); !at.IsZero() {
+		r.SettledAt = &at
+	}
+	return r
+}
+
+func (h Handler) OpenTab(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req OpenTabRequest) {
+	if err := h.authorize(r.Context(), auth.ActionManageTabs, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.tabs == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no tabs"}})
+		return
+	}
+	t, err := h.tabs.Open(r.Context(), storeID, req.Table, req.Currency)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toTabResponse(t))
+}
+
+// ListTabs returns the open tabs of a store, oldest first.
+func (h Handler) ListTabs(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionManageTabs, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.tabs == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no tabs"}})
+		return
+	}
+	tabs, err := h.tabs.OpenTabs(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	res := make([]TabResponse, 0, len(tabs))
+	for _, t := range tabs {
+		res = append(res, toTabResponse(t))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (h Handler) GetTab(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	t, err := h.getTab(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTabResponse(t))
+}
+
+func (h Handler) AddToTab(w http.ResponseWriter, r *http.Request, id uuid.UUID, req AddToTabRequest) {
+	_, err := h.getTab(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	orders := make([]tab.Order, 0, len(req.Lines))
+	for _, l := range req.Lines {
+		orders = append(orders, tab.Order{Item: l.Product, Price: money.New(l.UnitPrice.Amount, l.UnitPrice.Currency), Quantity: l.Quantity})
+	}
+	t, err := h.tabs.Add(r.Context(), id, orders...)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTabResponse(t))
+}
+
+func (h Handler) CancelTab(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	_, err := h.getTab(r.Context(), id)
+	if err == nil {
+		err = h.tabs.Cancel(r.Context(), id)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PayTab makes a purchase for part of a tab, or what is left of it, with any payment means.
+func (h Handler) PayTab(w http.ResponseWriter, r *http.Request, id uuid.UUID, req PayTabRequest) {
+	ctx := r.Context()
+	t, err := h.getTab(ctx, id)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	st := tab.Settlement{
+		Split:        tab.Split{Lines: req.Lines, Ways: req.Ways},
+		PaymentMeans: payment.Means(req.Payment.Means),
+		ServedBy:     servedBy(ctx, req.ServedBy),
+	}
+	if req.CustomerID != "" {
+		st.CustomerID = uuid.MustParse(req.CustomerID)
+	}
+	if req.Payment.CardToken != "" {
+		token := req.Payment.CardToken
+		st.CardToken = &token
+	}
+	var card *loyalty.CoffeeBux
+	if req.Payment.LoyaltyCardID != "" {
+		if card, err = h.cards.Get(ctx, uuid.MustParse(req.Payment.LoyaltyCardID)); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		st.Card = card
+	}
+	p, err := h.tabs.Pay(ctx, id, st)
+	// A purchase that was made spent the coffeebux, even if the tab failed to record it.
+	if p != nil && card != nil {
+		if serr := h.cards.Save(ctx, card); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if t, err = h.tabs.Tab(ctx, t.ID); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, PayTabResponse{Receipt: toReceiptV2(*p), Tab: toTabResponse(t)})
+}
+
+// getTab returns a tab if the caller may run the tabs of its store.
+func (h Handler) getTab(ctx context.Context, id uuid.UUID) (*tab.Tab, error) {
+	if h.tabs == nil {
+		return nil, tab.ErrNotFound
+	}
+	t, err := h.tabs.Tab(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.authorize(ctx, auth.ActionManageTabs, auth.Resource{StoreID: t.StoreID}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
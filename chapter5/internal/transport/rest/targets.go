@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/target"
+	"coffeeco/internal/validation"
+)
+
+type Targets interface {
+	Set(ctx context.Context, storeID uuid.UUID, day string, shift target.Shift, amount money.Money) (*target.Target, error)
+	Progress(ctx context.Context, storeID uuid.UUID, day string) ([]target.Progress, error)
+	Today(storeID uuid.UUID) string
+}
+
+// WithTargets lets managers set the sales targets of their store and follow how far it is towards them at
+// /v2/stores/{storeID}/targets.
+func WithTargets(t Targets) Option {
+	return func(h *Handler) {
+		h.targets = t
+	}
+}
+
+// SetTargetRequest sets the target of a day, or of a shift of it. A shift runs from start to end, as HH:MM
+// where the store is, and ends the next day if end is not after start.
+type SetTargetRequest struct {
+	Date  string `json:"date" format:"date"`
+	Shift string `json:"shift,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// Amount is what the store should sell.
+	Amount Money `json:"amount"`
+}
+
+func (r SetTargetRequest) Validate() error {
+	var v validation.Validator
+	_, err := time.Parse(time.DateOnly, r.Date)
+	v.Check(err == nil, "date", "must be a date as YYYY-MM-DD")
+	if r.Shift != "" {
+		_, err = parseClock(r.Start)
+		v.Check(err == nil, "start", "must be a time of day as HH:MM")
+		_, err = parseClock(r.End)
+		v.Check(err == nil, "end", "must be a time of day as HH:MM")
+	} else {
+		v.Check(r.Start == "" && r.End == "", "shift", "is required with start and end")
+	}
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	return v.Err()
+}
+
+// parseClock reads a time of day as HH:MM, as how long after midnight it is.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+type TargetResponse struct {
+	ID uuid.UUID `json:"id"`
+	// Shift is empty for the target of the whole day.
+	Shift string `json:"shift,omitempty"`
+	// From and To are when the day or shift runs.
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Target    Money     `json:"target"`
+	Sales     Money     `json:"sales"`
+	Purchases int       `json:"purchases"`
+	Remaining Money     `json:"remaining"`
+	// Percent is over 100 once the target is exceeded.
+	Percent float64    `json:"percent"`
+	HitAt   *time.Time `json:"hitAt,omitempty"`
+	SetBy   string     `json:"setBy"`
+	SetAt   time.Time  `json:"setAt"`
+}
+
+type TargetProgressResponse struct {
+	StoreID uuid.UUID        `json:"storeId"`
+	Date    string           `json:"date" format:"date"`
+	Targets []TargetResponse `json:"targets"`
+}
+
+func toTargetProgress(storeID uuid.UUID, day string, progress []target.Progress) TargetProgressResponse {
+	resp := TargetProgressResponse{StoreID: storeID, Date: day, Targets: make([]TargetResponse, 0, len(progress))}
+	for _, p := range progress {
+		t := p.Target
+		amount := func(a int64) Money { return toMoney(*money.New(a, t.Currency)) }
+		tr := TargetResponse{
+			ID:        t.ID,
+			Shift:     t.Shift.Name,
+			From:      t.From,
+			To:        t.To,
+			Target:    amount(t.Amount),
+			Sales:     amount(p.Sales),
+			Purchases: p.Purchases,
+			Remaining: amount(p.Remaining()),
+			Percent:   p.Percent(),
+			SetBy:     t.SetBy,
+			SetAt:     t.SetAt,
+		}
+		if at := t.HitAt(); !at.IsZero() {
+			tr.HitAt = &at
+		}
+		resp.Targets = append(resp.Targets, tr)
+	}
+	return resp
+}
+
+// SetTarget sets what the store should sell on a day or in one of its shifts, replacing the target set for
+// it before. It answers with the progress of the day.
+func (h Handler) SetTarget(w http.ResponseWriter, r *http.Request, storeID uuid.UUID, req SetTargetRequest) {
+	if !h.canManageTargets(w, r, storeID) {
+		return
+	}
+	shift := target.Shift{Name: req.Shift}
+	if req.Shift != "" {
+		shift.Start, _ = parseClock(req.Start)
+		shift.End, _ = parseClock(req.End)
+	}
+	if _, err := h.targets.Set(r.Context(), storeID, req.Date, shift, *money.New(req.Amount.Amount, req.Amount.Currency)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	progress, err := h.targets.Progress(r.Context(), storeID, req.Date)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTargetProgress(storeID, req.Date, progress))
+}
+
+// GetTargetProgress is how far the store is towards its targets on ?date=, today where the store is by
+// default, for the manager's dashboard.
+func (h Handler) GetTargetProgress(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if !h.canManageTargets(w, r, storeID) {
+		return
+	}
+	day := r.URL.Query().Get("date")
+	if day == "" {
+		day = h.targets.Today(storeID)
+	}
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "date", Message: "must be a date as YYYY-MM-DD"}}})
+		return
+	}
+	progress, err := h.targets.Progress(r.Context(), storeID, day)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTargetProgress(storeID, day, progress))
+}
+
+// canManageTargets answers the request and returns false unless targets are kept and the caller may
+// manage those of the store.
+func (h Handler) canManageTargets(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), auth.ActionManageTargets, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.targets == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "sales targets are not kept"}})
+		return false
+	}
+	return true
+}
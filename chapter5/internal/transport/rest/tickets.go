@@ -0,0 +1,171 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/validation"
+)
+
+type Orders interface {
+	Ticket(ctx context.Context, id uuid.UUID) (*orders.Ticket, error)
+	Queue(ctx context.Context, storeID uuid.UUID) ([]orders.Entry, error)
+	Start(ctx context.Context, id uuid.UUID, barista string) error
+	Ready(ctx context.Context, id uuid.UUID) error
+	PickUp(ctx context.Context, id uuid.UUID) error
+	Approach(ctx context.Context, id uuid.UUID, distance float64) (*orders.Ticket, error)
+}
+
+// WithOrders serves the ticket queue of each store at /v2/stores/{storeID}/tickets, and lets baristas
+// move tickets along under /v2/tickets. Customers' apps tell how close they are to the store of a
+// scheduled pickup at /v2/tickets/{ticketID}/proximity.
+func WithOrders(o Orders) Option {
+	return func(h *Handler) {
+		h.orders = o
+	}
+}
+
+type StartTicketRequest struct {
+	// Barista defaults to the caller.
+	Barista string `json:"barista,omitempty"`
+}
+
+func (r StartTicketRequest) Validate() error {
+	return nil
+}
+
+type ProximityRequest struct {
+	// DistanceMeters is how far the customer is from the store, as their device reckons.
+	DistanceMeters float64 `json:"distanceMeters"`
+}
+
+func (r ProximityRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.DistanceMeters >= 0, "distanceMeters", "must not be negative")
+	return v.Err()
+}
+
+type ProximityResponse struct {
+	Status string `json:"status" enum:"scheduled,queued,in_progress,ready,picked_up"`
+	// Released tells whether the ticket is with the bar, whether or not this report released it.
+	Released bool `json:"released"`
+}
+
+type TicketResponse struct {
+	TicketID         uuid.UUID  `json:"ticketId"`
+	CustomerID       *uuid.UUID `json:"customerId,omitempty"`
+	Items            []string   `json:"items"`
+	Status           string     `json:"status" enum:"queued,in_progress,ready"`
+	Barista          string     `json:"barista,omitempty"`
+	QueuedAt         time.Time  `json:"queuedAt"`
+	EstimatedReadyAt time.Time  `json:"estimatedReadyAt"`
+}
+
+type TicketQueueResponse struct {
+	Tickets []TicketResponse `json:"tickets"`
+}
+
+func toTicketQueue(entries []orders.Entry) TicketQueueResponse {
+	res := TicketQueueResponse{Tickets: make([]TicketResponse, 0, len(entries))}
+	for _, e := range entries {
+		t := TicketResponse{
+			TicketID:         e.Ticket.ID,
+			Items:            e.Ticket.Items,
+			Status:           string(e.Ticket.Status()),
+			Barista:          e.Ticket.Barista(),
+			QueuedAt:         e.Ticket.QueuedAt,
+			EstimatedReadyAt: e.EstimatedReadyAt,
+		}
+		if e.Ticket.CustomerID != uuid.Nil {
+			id := e.Ticket.CustomerID
+			t.CustomerID = &id
+		}
+		res.Tickets = append(res.Tickets, t)
+	}
+	return res
+}
+
+// ListTickets is what the kitchen display shows: the open tickets of a store, oldest first.
+func (h Handler) ListTickets(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	if err := h.authorize(r.Context(), auth.ActionWorkTickets, auth.Resource{StoreID: storeID}); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.orders == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there is no ticket queue"}})
+		return
+	}
+	entries, err := h.orders.Queue(r.Context(), storeID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toTicketQueue(entries))
+}
+
+func (h Handler) StartTicket(w http.ResponseWriter, r *http.Request, id uuid.UUID, req StartTicketRequest) {
+	h.moveTicket(w, r, id, func(ctx context.Context) error {
+		barista := req.Barista
+		if p, ok := auth.FromContext(ctx); ok && barista == "" {
+			barista = p.Subject
+		}
+		return h.orders.Start(ctx, id, barista)
+	})
+}
+
+func (h Handler) TicketReady(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	h.moveTicket(w, r, id, func(ctx context.Context) error {
+		return h.orders.Ready(ctx, id)
+	})
+}
+
+func (h Handler) TicketPickedUp(w http.ResponseWriter, r *http.Request, id uuid.UUID) {
+	h.moveTicket(w, r, id, func(ctx context.Context) error {
+		return h.orders.PickUp(ctx, id)
+	})
+}
+
+// ReportProximity releases a customer's scheduled ticket to the bar once they are close to the store.
+func (h Handler) ReportProximity(w http.ResponseWriter, r *http.Request, id uuid.UUID, req ProximityRequest) {
+	if h.orders == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there is no ticket queue"}})
+		return
+	}
+	t, err := h.orders.Ticket(r.Context(), id)
+	if err == nil {
+		err = h.authorize(r.Context(), auth.ActionApproach, auth.Resource{CustomerID: t.CustomerID, StoreID: t.StoreID})
+	}
+	if err == nil {
+		t, err = h.orders.Approach(r.Context(), id, req.DistanceMeters)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ProximityResponse{Status: string(t.Status()), Released: t.Status() != orders.StatusScheduled})
+}
+
+// moveTicket checks the caller works at the ticket's store before calling move.
+func (h Handler) moveTicket(w http.ResponseWriter, r *http.Request, id uuid.UUID, move func(ctx context.Context) error) {
+	if h.orders == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there is no ticket queue"}})
+		return
+	}
+	t, err := h.orders.Ticket(r.Context(), id)
+	if err == nil {
+		err = h.authorize(r.Context(), auth.ActionWorkTickets, auth.Resource{StoreID: t.StoreID})
+	}
+	if err == nil {
+		err = move(r.Context())
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
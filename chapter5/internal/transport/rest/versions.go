@@ -0,0 +1,40 @@
+package rest
+
+// Older versions of the API are served by translating their requests into the current ones and the
+// current responses back, so the handlers and the application services only know the current contract.
+// A new version adds translators from the version before it; it never touches the older ones.
+
+func (r CreatePurchaseRequest) toV2() CreatePurchaseRequestV2 {
+	v2 := CreatePurchaseRequestV2{
+		StoreID:    r.StoreID,
+		CustomerID: r.CustomerID,
+		Lines:      make([]Line, 0, len(r.Items)),
+		Payment: Payment{
+			Means:         r.PaymentMeans,
+			CardToken:     r.CardToken,
+			LoyaltyCardID: r.LoyaltyCardID,
+		},
+	}
+	for _, item := range r.Items {
+		v2.Lines = append(v2.Lines, Line{Product: item.Name, Quantity: 1, UnitPrice: item.Price})
+	}
+	return v2
+}
+
+func (r ReceiptResponseV2) toV1() ReceiptResponse {
+	v1 := ReceiptResponse{
+		PurchaseID:   r.PurchaseID,
+		StoreID:      r.StoreID,
+		CustomerID:   r.CustomerID,
+		Items:        []Item{},
+		Total:        r.Total,
+		PaymentMeans: r.PaidWith,
+		PurchasedAt:  r.PurchasedAt,
+	}
+	for _, l := range r.Lines {
+		for i := 0; i < l.Quantity; i++ {
+			v1.Items = append(v1.Items, Item{Name: l.Product, Price: l.UnitPrice})
+		}
+	}
+	return v1
+}
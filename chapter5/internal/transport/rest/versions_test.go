@@ -0,0 +1,78 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/transport/rest"
+)
+
+func Test_V2PurchaseLinesHaveQuantities(t *testing.T) {
+	purchases := &fakePurchases{}
+	srv := newServer(t, purchases, loyalty.NewMemoryRepo())
+
+	body := `{"storeId":"` + uuid.NewString() + `","payment":{"means":"cash"},
+		"lines":[{"product":"latte","quantity":2,"unitPrice":{"amount":400,"currency":"USD"}}]}`
+	resp, err := http.Post(srv.URL+"/v2/purchases", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 but got %d", resp.StatusCode)
+	}
+	var receipt rest.ReceiptResponseV2
+	if err := json.NewDecoder(resp.Body).Decode(&receipt); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(purchases.completed[0].ProductsToPurchase) != 2 {
+		t.Fatalf("expected two lattes to be bought but got %+v", purchases.completed[0].ProductsToPurchase)
+	}
+	if len(receipt.Lines) != 1 || receipt.Lines[0].Quantity != 2 || receipt.PaidWith != "cash" {
+		t.Fatalf("expected one line of two lattes but got %+v", receipt)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Location"), "/v2/purchases/") {
+		t.Fatalf("expected a v2 location but got %q", resp.Header.Get("Location"))
+	}
+}
+
+func Test_V1PurchasesAreTranslated(t *testing.T) {
+	body := `{"storeId":"` + uuid.NewString() + `","paymentMeans":"cash",
+		"items":[{"name":"latte","price":{"amount":400,"currency":"USD"}},{"name":"latte","price":{"amount":400,"currency":"USD"}}]}`
+
+	for _, path := range []string{"/v1/purchases", "/purchases"} {
+		purchases := &fakePurchases{}
+		srv := newServer(t, purchases, loyalty.NewMemoryRepo())
+		resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		var receipt rest.ReceiptResponse
+		_ = json.NewDecoder(resp.Body).Decode(&receipt)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected 201 from %s but got %d", path, resp.StatusCode)
+		}
+		if len(receipt.Items) != 2 || receipt.PaymentMeans != "cash" || len(purchases.completed[0].ProductsToPurchase) != 2 {
+			t.Fatalf("expected the v1 receipt with two items from %s but got %+v", path, receipt)
+		}
+	}
+}
+
+func Test_V2RejectsV1Payloads(t *testing.T) {
+	srv := newServer(t, &fakePurchases{}, loyalty.NewMemoryRepo())
+	body := `{"storeId":"` + uuid.NewString() + `","paymentMeans":"cash","items":[]}`
+	resp, err := http.Post(srv.URL+"/v2/purchases", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d", resp.StatusCode)
+	}
+}
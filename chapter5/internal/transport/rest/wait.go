@@ -0,0 +1,72 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/validation"
+	"coffeeco/internal/waittime"
+)
+
+// maxWaitItems bounds the items a wait is estimated for, as they come in the query string.
+const maxWaitItems = 50
+
+type WaitTimes interface {
+	Estimate(ctx context.Context, storeID uuid.UUID, items []string) (waittime.Estimate, error)
+}
+
+// WithWaitTimes says at /v2/stores/{storeID}/wait when an order placed now should be ready.
+func WithWaitTimes(wt WaitTimes) Option {
+	return func(h *Handler) {
+		h.waits = wt
+	}
+}
+
+type WaitResponse struct {
+	StoreID uuid.UUID `json:"storeId"`
+	ReadyAt time.Time `json:"readyAt"`
+	// ReadyInMinutes is rounded up, for "ready in ~7 min".
+	ReadyInMinutes int `json:"readyInMinutes"`
+	OpenTickets    int `json:"openTickets"`
+	// CalculatedAt is when the store's queue was last looked at; it is omitted for a store with no tickets yet.
+	CalculatedAt time.Time `json:"calculatedAt,omitzero"`
+}
+
+// GetWait estimates when an order of ?items=latte,croissant placed now would be ready. Without items it
+// says when the bar can start on one.
+func (h Handler) GetWait(w http.ResponseWriter, r *http.Request, storeID uuid.UUID) {
+	var items []string
+	if v := r.URL.Query().Get("items"); v != "" {
+		items = strings.Split(v, ",")
+	}
+	var v validation.Validator
+	v.Check(len(items) <= maxWaitItems, "items", "must list at most "+strconv.Itoa(maxWaitItems)+" items")
+	for _, item := range items {
+		v.Check(strings.TrimSpace(item) != "", "items", "must not have empty items")
+	}
+	if err := v.Err(); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if h.waits == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "waits are not estimated"}})
+		return
+	}
+	e, err := h.waits.Estimate(r.Context(), storeID, items)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, WaitResponse{
+		StoreID:        e.StoreID,
+		ReadyAt:        e.ReadyAt,
+		ReadyInMinutes: int((e.ReadyIn + time.Minute - 1) / time.Minute),
+		OpenTickets:    e.OpenTickets,
+		CalculatedAt:   e.CalculatedAt,
+	})
+}
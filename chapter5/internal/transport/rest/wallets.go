@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/auth"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/refund"
+	"coffeeco/internal/validation"
+	"coffeeco/internal/wallet"
+)
+
+type Wallets interface {
+	Account(ctx context.Context, customerID uuid.UUID) (*wallet.Account, error)
+	TopUp(ctx context.Context, customerID uuid.UUID, amount money.Money, cardToken string) (*wallet.Account, error)
+	Refund(ctx context.Context, customerID, purchaseID uuid.UUID, amount money.Money) (*wallet.Account, error)
+}
+
+// WithWallets lets customers see and top up their wallets at /v2/customers/{customerID}/wallet, and
+// managers refund purchases paid from a wallet back to it.
+func WithWallets(wl Wallets) Option {
+	return func(h *Handler) {
+		h.wallets = wl
+	}
+}
+
+type TopUpRequest struct {
+	Amount Money `json:"amount"`
+	// CardToken is the card the top-up is charged to.
+	CardToken string `json:"cardToken"`
+}
+
+func (r TopUpRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	v.Check(r.CardToken != "", "cardToken", "is required")
+	return v.Err()
+}
+
+type WalletRefundRequest struct {
+	Amount Money `json:"amount"`
+	// Reason is why the customer gets their money back; it is required where refunds over the limits need
+	// a manager's approval.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (r WalletRefundRequest) Validate() error {
+	var v validation.Validator
+	v.Check(r.Amount.Amount > 0, "amount.amount", "must be positive")
+	v.Check(money.GetCurrency(r.Amount.Currency) != nil, "amount.currency", "must be an ISO 4217 code")
+	return v.Err()
+}
+
+type WalletResponse struct {
+	CustomerID uuid.UUID `json:"customerId"`
+	Balance    Money     `json:"balance"`
+	// Held is set aside for purchases being paid for, and Available what is left to spend.
+	Held      Money         `json:"held"`
+	Available Money         `json:"available"`
+	Entries   []WalletEntry `json:"entries"`
+}
+
+type WalletEntry struct {
+	ID         uuid.UUID  `json:"id"`
+	Kind       string     `json:"kind" enum:"top_up,hold,capture,release,refund"`
+	Amount     Money      `json:"amount"`
+	PurchaseID *uuid.UUID `json:"purchaseId,omitempty"`
+	At         time.Time  `json:"at"`
+}
+
+func toWalletResponse(a *wallet.Account) WalletResponse {
+	amount := func(cents int64) Money { return Money{Amount: cents, Currency: a.Currency} }
+	resp := WalletResponse{
+		CustomerID: a.CustomerID,
+		Balance:    amount(a.Balance()),
+		Held:       amount(a.Held()),
+		Available:  amount(a.Available()),
+		Entries:    []WalletEntry{},
+	}
+	for _, e := range a.Entries() {
+		entry := WalletEntry{ID: e.ID, Kind: string(e.Kind), Amount: amount(e.Amount), At: e.At}
+		if e.PurchaseID != uuid.Nil {
+			id := e.PurchaseID
+			entry.PurchaseID = &id
+		}
+		resp.Entries = append(resp.Entries, entry)
+	}
+	return resp
+}
+
+// GetWallet returns the balance of a customer's wallet and its ledger.
+func (h Handler) GetWallet(w http.ResponseWriter, r *http.Request, customerID uuid.UUID) {
+	if !h.walletsEnabled(w, r, auth.ActionViewWallet, customerID) {
+		return
+	}
+	a, err := h.wallets.Account(r.Context(), customerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWalletResponse(a))
+}
+
+// TopUpWallet charges the card and adds the amount to the customer's wallet, opening it on the first top-up.
+func (h Handler) TopUpWallet(w http.ResponseWriter, r *http.Request, customerID uuid.UUID, req TopUpRequest) {
+	if !h.walletsEnabled(w, r, auth.ActionTopUpWallet, customerID) {
+		return
+	}
+	a, err := h.wallets.TopUp(r.Context(), customerID, *money.New(req.Amount.Amount, req.Amount.Currency), req.CardToken)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWalletResponse(a))
+}
+
+// RefundToWallet credits part or all of a purchase paid from a wallet back to it. Managers of the store
+// the purchase was made at only. Where refunds are approved, it asks for the refund instead, answering 202
+// with it if it needs another manager's approval.
+func (h Handler) RefundToWallet(w http.ResponseWriter, r *http.Request, purchaseID uuid.UUID, req WalletRefundRequest) {
+	if h.wallets == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no wallets"}})
+		return
+	}
+	p, err := h.getPurchase(r.Context(), purchaseID, auth.ActionRefundWallet)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if p.PaymentMeans != payment.MEANS_WALLET {
+		writeError(w, r, purchase.ErrWalletUnavailable)
+		return
+	}
+	amount := *money.New(req.Amount.Amount, req.Amount.Currency)
+	if h.refunds != nil {
+		h.requestWalletRefund(w, r, p.CustomerID, p.ID, amount, req.Reason)
+		return
+	}
+	a, err := h.wallets.Refund(r.Context(), p.CustomerID, p.ID, amount)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWalletResponse(a))
+}
+
+// requestWalletRefund refunds through the approval workflow, answering with the wallet once the refund
+// is made.
+func (h Handler) requestWalletRefund(w http.ResponseWriter, r *http.Request, customerID, purchaseID uuid.UUID, amount money.Money, reason string) {
+	if reason == "" {
+		writeError(w, r, &ValidationError{Fields: []FieldError{{Field: "reason", Message: "is required"}}})
+		return
+	}
+	rf, err := h.refunds.Request(r.Context(), purchaseID, amount, reason)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if rf.Status() == refund.StatusRequested {
+		w.Header().Set("Location", "/v2/refunds/"+rf.ID.String())
+		writeJSON(w, http.StatusAccepted, toRefundResponse(rf))
+		return
+	}
+	a, err := h.wallets.Account(r.Context(), customerID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toWalletResponse(a))
+}
+
+// walletsEnabled checks the caller may perform a on the customer's wallet and that there are wallets,
+// writing the error response otherwise.
+func (h Handler) walletsEnabled(w http.ResponseWriter, r *http.Request, a auth.Action, customerID uuid.UUID) bool {
+	if err := h.authorize(r.Context(), a, auth.Resource{CustomerID: customerID}); err != nil {
+		writeError(w, r, err)
+		return false
+	}
+	if h.wallets == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: ErrorBody{Code: "not_found", Message: "there are no wallets"}})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	coffeecov1 "coffeeco/grpc/gen/proto/go/coffeeco/v1"
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/payment"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+)
+
+type PurchaseService interface {
+	CompletePurchase(ctx context.Context, storeID uuid.UUID, p *purchase.Purchase, card *loyalty.CoffeeBux) error
+	GetPurchase(ctx context.Context, id uuid.UUID) (purchase.Purchase, error)
+}
+
+type StoreService interface {
+	ListStores(ctx context.Context) ([]store.Store, error)
+}
+
+type LoyaltyCards interface {
+	Get(ctx context.Context, id uuid.UUID) (*loyalty.CoffeeBux, error)
+	Save(ctx context.Context, card *loyalty.CoffeeBux) error
+}
+
+// Server adapts the domain services to the generated gRPC service interfaces.
+type Server struct {
+	purchases PurchaseService
+	stores    StoreService
+	cards     LoyaltyCards
+}
+
+func NewServer(purchases PurchaseService, stores StoreService, cards LoyaltyCards) (*Server, error) {
+	if purchases == nil {
+		return nil, errors.New("purchase service cannot be nil")
+	}
+	if stores == nil {
+		return nil, errors.New("store service cannot be nil")
+	}
+	if cards == nil {
+		return nil, errors.New("loyalty cards cannot be nil")
+	}
+	return &Server{purchases: purchases, stores: stores, cards: cards}, nil
+}
+
+// Register adds the Purchase, Loyalty and Store services to s.
+func (s *Server) Register(gs *grpc.Server) {
+	coffeecov1.RegisterPurchaseServiceServer(gs, purchaseServer{s})
+	coffeecov1.RegisterLoyaltyServiceServer(gs, loyaltyServer{s})
+	coffeecov1.RegisterStoreServiceServer(gs, storeServer{s})
+}
+
+type purchaseServer struct{ *Server }
+
+func (s purchaseServer) CreatePurchase(ctx context.Context, req *coffeecov1.CreatePurchaseRequest) (*coffeecov1.CreatePurchaseResponse, error) {
+	p, cardID, err := toPurchase(req)
+	if err != nil {
+		return nil, err
+	}
+	var card *loyalty.CoffeeBux
+	if cardID != uuid.Nil {
+		if card, err = s.cards.Get(ctx, cardID); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	if err := s.purchases.CompletePurchase(ctx, p.Store.ID, p, card); err != nil {
+		return nil, toStatus(err)
+	}
+	if card != nil {
+		if err := s.cards.Save(ctx, card); err != nil {
+			return nil, toStatus(err)
+		}
+	}
+	return &coffeecov1.CreatePurchaseResponse{Receipt: toReceipt(*p)}, nil
+}
+
+func (s purchaseServer) GetPurchase(ctx context.Context, req *coffeecov1.GetPurchaseRequest) (*coffeecov1.GetPurchaseResponse, error) {
+	id, err := uuid.Parse(req.GetPurchaseId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "purchase_id must be a UUID")
+	}
+	p, err := s.purchases.GetPurchase(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &coffeecov1.GetPurchaseResponse{Receipt: toReceipt(p)}, nil
+}
+
+type loyaltyServer struct{ *Server }
+
+func (s loyaltyServer) GetBalance(ctx context.Context, req *coffeecov1.GetBalanceRequest) (*coffeecov1.GetBalanceResponse, error) {
+	id, err := uuid.Parse(req.GetCardId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "card_id must be a UUID")
+	}
+	card, err := s.cards.Get(ctx, id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &coffeecov1.GetBalanceResponse{
+		CardId:                  card.ID.String(),
+		CustomerId:              card.CustomerID().String(),
+		StoreId:                 card.StoreID().String(),
+		FreeDrinksAvailable:     int32(card.FreeDrinksAvailable),
+		PurchasesUntilFreeDrink: int32(card.RemainingDrinkPurchasesUntilFreeDrink),
+	}, nil
+}
+
+type storeServer struct{ *Server }
+
+func (s storeServer) ListStores(ctx context.Context, _ *coffeecov1.ListStoresRequest) (*coffeecov1.ListStoresResponse, error) {
+	stores, err := s.stores.ListStores(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &coffeecov1.ListStoresResponse{Stores: make([]*coffeecov1.Store, 0, len(stores))}
+	for _, st := range stores {
+		ps := &coffeecov1.Store{Id: st.ID.String(), Location: st.Location}
+		for _, p := range st.ProductsForSale {
+			ps.Products = append(ps.Products, &coffeecov1.Item{Name: p.ItemName, Price: toMoney(p.BasePrice)})
+		}
+		res.Stores = append(res.Stores, ps)
+	}
+	return res, nil
+}
+
+var paymentMeans = map[coffeecov1.PaymentMeans]payment.Means{
+	coffeecov1.PaymentMeans_PAYMENT_MEANS_CARD:      payment.MEANS_CARD,
+	coffeecov1.PaymentMeans_PAYMENT_MEANS_CASH:      payment.MEANS_CASH,
+	coffeecov1.PaymentMeans_PAYMENT_MEANS_COFFEEBUX: payment.MEANS_COFFEEBUX,
+}
+
+// toPurchase validates req and returns the purchase and the loyalty card it is for, if any. Every problem
+// is reported at once in an InvalidArgument status.
+func toPurchase(req *coffeecov1.CreatePurchaseRequest) (*purchase.Purchase, uuid.UUID, error) {
+	var problems []string
+	parse := func(field, value string, required bool) uuid.UUID {
+		if value == "" {
+			if required {
+				problems = append(problems, field+" is required")
+			}
+			return uuid.Nil
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			problems = append(problems, field+" must be a UUID")
+		}
+		return id
+	}
+
+	p := &purchase.Purchase{}
+	p.Store.ID = parse("store_id", req.GetStoreId(), true)
+	p.CustomerID = parse("customer_id", req.GetCustomerId(), false)
+	cardID := parse("loyalty_card_id", req.GetLoyaltyCardId(), false)
+
+	means, ok := paymentMeans[req.GetPaymentMeans()]
+	switch {
+	case !ok:
+		problems = append(problems, "payment_means is required")
+	case means == payment.MEANS_CARD && req.GetCardToken() == "":
+		problems = append(problems, "card_token is required when paying by card")
+	case means == payment.MEANS_COFFEEBUX && req.GetLoyaltyCardId() == "":
+		problems = append(problems, "loyalty_card_id is required when paying with coffeebux")
+	}
+	p.PaymentMeans = means
+	if token := req.GetCardToken(); token != "" {
+		p.CardToken = &token
+	}
+
+	if len(req.GetItems()) == 0 {
+		problems = append(problems, "items must contain at least one item")
+	}
+	for i, item := range req.GetItems() {
+		price := item.GetPrice()
+		if item.GetName() == "" || price.GetAmount() <= 0 || money.GetCurrency(price.GetCurrency()) == nil {
+			problems = append(problems, fmt.Sprintf("items[%d] needs a name and a positive price in an ISO 4217 currency", i))
+			continue
+		}
+		p.ProductsToPurchase = append(p.ProductsToPurchase, coffeeco.Product{
+			ItemName:  item.GetName(),
+			BasePrice: *money.New(price.GetAmount(), price.GetCurrency()),
+		})
+	}
+
+	if len(problems) > 0 {
+		return nil, uuid.Nil, status.Error(codes.InvalidArgument, strings.Join(problems, "; "))
+	}
+	return p, cardID, nil
+}
+
+func toReceipt(p purchase.Purchase) *coffeecov1.Receipt {
+	r := &coffeecov1.Receipt{
+		PurchaseId:  p.ID.String(),
+		StoreId:     p.Store.ID.String(),
+		Total:       toMoney(p.Total()),
+		PurchasedAt: timestamppb.New(p.PurchasedAt()),
+	}
+	if p.CustomerID != uuid.Nil {
+		r.CustomerId = p.CustomerID.String()
+	}
+	for pm, m := range paymentMeans {
+		if m == p.PaymentMeans {
+			r.PaymentMeans = pm
+		}
+	}
+	for _, prod := range p.ProductsToPurchase {
+		r.Items = append(r.Items, &coffeecov1.Item{Name: prod.ItemName, Price: toMoney(prod.BasePrice)})
+	}
+	return r
+}
+
+func toMoney(m money.Money) *coffeecov1.Money {
+	// The zero money.Money has no currency.
+	if m.Currency() == nil {
+		return &coffeecov1.Money{}
+	}
+	return &coffeecov1.Money{Amount: m.Amount(), Currency: m.Currency().Code}
+}
+
+var domainCodes = []struct {
+	target error
+	code   codes.Code
+}{
+	{purchase.ErrNotFound, codes.NotFound},
+	{loyalty.ErrNotFound, codes.NotFound},
+	{purchase.ErrNoProducts, codes.InvalidArgument},
+	{purchase.ErrZeroTotal, codes.InvalidArgument},
+	{purchase.ErrUnknownPaymentMeans, codes.InvalidArgument},
+	{loyalty.ErrNotEnoughCoffeeBux, codes.FailedPrecondition},
+	{inventory.ErrOutOfStock, codes.FailedPrecondition},
+	{purchase.ErrCardChargeFailed, codes.FailedPrecondition},
+	{purchase.ErrCardPaymentsUnavailable, codes.Unavailable},
+	{purchase.ErrTimeout, codes.DeadlineExceeded},
+}
+
+// toStatus maps domain errors onto gRPC codes. Anything else is Internal and its details are only logged.
+func toStatus(err error) error {
+	for _, d := range domainCodes {
+		if errors.Is(err, d.target) {
+			return status.Error(d.code, d.target.Error())
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	slog.Error("grpc request failed", "error", err)
+	return status.Error(codes.Internal, "something went wrong")
+}
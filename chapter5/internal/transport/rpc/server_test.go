@@ -0,0 +1,131 @@
+package rpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	coffeecov1 "coffeeco/grpc/gen/proto/go/coffeeco/v1"
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/loyalty"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/store"
+	"coffeeco/internal/transport/rpc"
+)
+
+type fakePurchases struct {
+	err error
+}
+
+func (f fakePurchases) CompletePurchase(_ context.Context, _ uuid.UUID, _ *purchase.Purchase, card *loyalty.CoffeeBux) error {
+	if f.err != nil {
+		return f.err
+	}
+	if card != nil {
+		card.AddStamp()
+	}
+	return nil
+}
+
+func (fakePurchases) GetPurchase(context.Context, uuid.UUID) (purchase.Purchase, error) {
+	return purchase.Purchase{}, purchase.ErrNotFound
+}
+
+type fakeStores struct{}
+
+func (fakeStores) ListStores(context.Context) ([]store.Store, error) {
+	return []store.Store{store.New(uuid.New(), "Soho")}, nil
+}
+
+func dial(t *testing.T, purchases fakePurchases, cards *loyalty.MemoryRepository) *grpc.ClientConn {
+	t.Helper()
+	srv, err := rpc.NewServer(purchases, fakeStores{}, cards)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	srv.Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func Test_CreatePurchaseStampsTheLoyaltyCard(t *testing.T) {
+	var (
+		ctx   = context.Background()
+		cards = loyalty.NewMemoryRepo()
+		card  = loyalty.NewCoffeeBux(uuid.New(), store.Ref(uuid.New()), coffeeco.CoffeeLover{ID: uuid.New()})
+	)
+	_ = cards.Save(ctx, card)
+	client := coffeecov1.NewPurchaseServiceClient(dial(t, fakePurchases{}, cards))
+
+	_, err := client.CreatePurchase(ctx, &coffeecov1.CreatePurchaseRequest{
+		StoreId:       uuid.NewString(),
+		LoyaltyCardId: card.ID.String(),
+		PaymentMeans:  coffeecov1.PaymentMeans_PAYMENT_MEANS_CASH,
+		Items:         []*coffeecov1.Item{{Name: "flat white", Price: &coffeecov1.Money{Amount: 350, Currency: "USD"}}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	balance, err := coffeecov1.NewLoyaltyServiceClient(dial(t, fakePurchases{}, cards)).
+		GetBalance(ctx, &coffeecov1.GetBalanceRequest{CardId: card.ID.String()})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if balance.GetPurchasesUntilFreeDrink() != 9 {
+		t.Fatalf("expected 9 purchases until a free drink but got %d", balance.GetPurchasesUntilFreeDrink())
+	}
+}
+
+func Test_ErrorsAreMappedToStatusCodes(t *testing.T) {
+	ctx := context.Background()
+	valid := &coffeecov1.CreatePurchaseRequest{
+		StoreId:      uuid.NewString(),
+		PaymentMeans: coffeecov1.PaymentMeans_PAYMENT_MEANS_CARD,
+		CardToken:    "tok_visa",
+		Items:        []*coffeecov1.Item{{Name: "latte", Price: &coffeecov1.Money{Amount: 400, Currency: "USD"}}},
+	}
+	tests := map[string]struct {
+		purchases fakePurchases
+		req       *coffeecov1.CreatePurchaseRequest
+		code      codes.Code
+	}{
+		"invalid request": {fakePurchases{}, &coffeecov1.CreatePurchaseRequest{StoreId: "nope"}, codes.InvalidArgument},
+		"charge failed":   {fakePurchases{err: purchase.ErrCardChargeFailed}, valid, codes.FailedPrecondition},
+		"unexpected":      {fakePurchases{err: net.ErrClosed}, valid, codes.Internal},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := coffeecov1.NewPurchaseServiceClient(dial(t, tc.purchases, loyalty.NewMemoryRepo()))
+			_, err := client.CreatePurchase(ctx, tc.req)
+			if status.Code(err) != tc.code {
+				t.Fatalf("expected %s but got %v", tc.code, err)
+			}
+		})
+	}
+
+	client := coffeecov1.NewPurchaseServiceClient(dial(t, fakePurchases{}, loyalty.NewMemoryRepo()))
+	_, err := client.GetPurchase(ctx, &coffeecov1.GetPurchaseRequest{PurchaseId: uuid.NewString()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound but got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// bufferSize is how many updates a slow connection may fall behind before updates are dropped for it.
+const bufferSize = 16
+
+// fanout hands updates to the connections subscribed to their key, a customer or a store.
+type fanout[E any] struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan E]struct{}
+	closed      bool
+}
+
+func newFanout[E any]() *fanout[E] {
+	return &fanout[E]{subscribers: map[uuid.UUID]map[chan E]struct{}{}}
+}
+
+func (f *fanout[E]) subscribe(key uuid.UUID) (updates <-chan E, cancel func()) {
+	ch := make(chan E, bufferSize)
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		close(ch)
+		return ch, func() {}
+	}
+	if f.subscribers[key] == nil {
+		f.subscribers[key] = map[chan E]struct{}{}
+	}
+	f.subscribers[key][ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[key][ch]; !ok {
+			return
+		}
+		delete(f.subscribers[key], ch)
+		if len(f.subscribers[key]) == 0 {
+			delete(f.subscribers, key)
+		}
+		close(ch)
+	}
+}
+
+func (f *fanout[E]) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for _, chs := range f.subscribers {
+		for ch := range chs {
+			close(ch)
+		}
+	}
+	f.subscribers = map[uuid.UUID]map[chan E]struct{}{}
+}
+
+// send never blocks: a connection that is not keeping up misses e rather than holding up everyone else.
+func (f *fanout[E]) send(key uuid.UUID, e E) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers[key] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
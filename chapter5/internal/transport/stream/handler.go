@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/purchase"
+)
+
+// heartbeat keeps idle connections from being closed by proxies.
+const heartbeat = 15 * time.Second
+
+type statusUpdate struct {
+	PurchaseID string    `json:"purchaseId"`
+	StoreID    string    `json:"storeId"`
+	Status     string    `json:"status"`
+	ChangedAt  time.Time `json:"changedAt"`
+}
+
+// ServeCustomer streams the status of a customer's purchases as server-sent events, one "status" event per
+// change. customerID picks the customer from the request, e.g. from a path variable.
+func (h *Hub) ServeCustomer(customerID func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(customerID(r))
+		if err != nil {
+			http.Error(w, "customer ID must be a UUID", http.StatusBadRequest)
+			return
+		}
+		serveEvents(w, r, h.fanout, id, func(e purchase.StatusChanged) (string, string, any) {
+			return fmt.Sprintf("%s-%s", e.PurchaseID, e.Status), "status", statusUpdate{
+				PurchaseID: e.PurchaseID.String(),
+				StoreID:    e.StoreID.String(),
+				Status:     string(e.Status),
+				ChangedAt:  e.ChangedAt,
+			}
+		})
+	}
+}
+
+// serveEvents streams what f sends to key as server-sent events until the client or f goes away. event
+// gives the id, name and JSON data of each.
+func serveEvents[E any](w http.ResponseWriter, r *http.Request, f *fanout[E], key uuid.UUID, event func(e E) (id, name string, data any)) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, cancel := f.subscribe(key)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-updates:
+			if !ok {
+				return
+			}
+			id, name, v := event(e)
+			data, _ := json.Marshal(v)
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, name, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+)
+
+// Hub fans purchase status changes out to the connections of the customer they belong to.
+type Hub struct {
+	registry *events.Registry
+	fanout   *fanout[purchase.StatusChanged]
+}
+
+func NewHub() *Hub {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	return &Hub{registry: r, fanout: newFanout[purchase.StatusChanged]()}
+}
+
+// Subscribe returns the status changes of customerID's purchases. Call cancel once the connection is gone.
+func (h *Hub) Subscribe(customerID uuid.UUID) (updates <-chan purchase.StatusChanged, cancel func()) {
+	return h.fanout.subscribe(customerID)
+}
+
+// Close ends every stream, so a server shutting down does not wait on connections that never finish.
+func (h *Hub) Close() {
+	h.fanout.close()
+}
+
+// Handle is an events.Handler for the purchase topic. Other purchase events and anonymous purchases are
+// ignored, and a connection that is not keeping up misses updates rather than holding up everyone else.
+func (h *Hub) Handle(_ context.Context, msg events.Message) error {
+	if msg.Type != purchase.EventTypeStatusChanged {
+		return nil
+	}
+	evt, err := h.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(purchase.StatusChanged)
+	if e.CustomerID == uuid.Nil {
+		return nil
+	}
+	h.fanout.send(e.CustomerID, e)
+	return nil
+}
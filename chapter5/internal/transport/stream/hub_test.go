@@ -0,0 +1,108 @@
+package stream_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/transport/stream"
+)
+
+func statusMessage(t *testing.T, customerID uuid.UUID, status purchase.Status) events.Message {
+	t.Helper()
+	msg, err := events.NewMessage(purchase.StatusChanged{
+		PurchaseID: uuid.New(),
+		StoreID:    uuid.New(),
+		CustomerID: customerID,
+		Status:     status,
+		ChangedAt:  time.Now(),
+	}, events.JSONCodec{})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	return msg
+}
+
+func Test_HubOnlyDeliversTheCustomersOwnUpdates(t *testing.T) {
+	hub := stream.NewHub()
+	alice, bob := uuid.New(), uuid.New()
+	updates, cancel := hub.Subscribe(alice)
+	defer cancel()
+
+	for _, msg := range []events.Message{statusMessage(t, bob, purchase.StatusAccepted), statusMessage(t, alice, purchase.StatusReady)} {
+		if err := hub.Handle(context.Background(), msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+
+	select {
+	case e := <-updates:
+		if e.CustomerID != alice || e.Status != purchase.StatusReady {
+			t.Fatalf("expected alice's ready update but got %+v", e)
+		}
+	default:
+		t.Fatal("expected an update for alice")
+	}
+	select {
+	case e := <-updates:
+		t.Fatalf("expected no more updates but got %+v", e)
+	default:
+	}
+}
+
+func Test_ServeCustomerStreamsStatusEvents(t *testing.T) {
+	hub := stream.NewHub()
+	customerID := uuid.New()
+	srv := httptest.NewServer(hub.ServeCustomer(func(r *http.Request) string {
+		return r.URL.Query().Get("customer")
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?customer=" + customerID.String())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream but got %q", ct)
+	}
+
+	// The subscription is in place once the headers have been sent.
+	if err := hub.Handle(context.Background(), statusMessage(t, customerID, purchase.StatusPreparing)); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	var event, data string
+	for event == "" || data == "" {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = strings.TrimSpace(v)
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	if event != "status" || !strings.Contains(data, `"status":"preparing"`) {
+		t.Fatalf("expected a preparing status event but got %q %q", event, data)
+	}
+}
+
+func Test_ServeCustomerRejectsInvalidIDs(t *testing.T) {
+	rec := httptest.NewRecorder()
+	stream.NewHub().ServeCustomer(func(*http.Request) string { return "nope" })(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 but got %d", rec.Code)
+	}
+}
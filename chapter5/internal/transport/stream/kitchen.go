@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/orders"
+)
+
+// TicketHub fans ticket updates out to the kitchen displays of the store they belong to.
+type TicketHub struct {
+	registry *events.Registry
+	fanout   *fanout[orders.TicketUpdated]
+}
+
+func NewTicketHub() *TicketHub {
+	r := events.NewRegistry()
+	orders.RegisterEvents(r)
+	return &TicketHub{registry: r, fanout: newFanout[orders.TicketUpdated]()}
+}
+
+// Subscribe returns the ticket updates of storeID. Call cancel once the display is gone.
+func (h *TicketHub) Subscribe(storeID uuid.UUID) (updates <-chan orders.TicketUpdated, cancel func()) {
+	return h.fanout.subscribe(storeID)
+}
+
+// Close ends every stream, so a server shutting down does not wait on displays that never disconnect.
+func (h *TicketHub) Close() {
+	h.fanout.close()
+}
+
+// Handle is an events.Handler for the orders topic.
+func (h *TicketHub) Handle(_ context.Context, msg events.Message) error {
+	if msg.Type != orders.EventTypeTicketUpdated {
+		return nil
+	}
+	evt, err := h.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(orders.TicketUpdated)
+	h.fanout.send(e.StoreID, e)
+	return nil
+}
+
+type ticketUpdate struct {
+	TicketID         string    `json:"ticketId"`
+	Items            []string  `json:"items"`
+	Status           string    `json:"status"`
+	Barista          string    `json:"barista,omitempty"`
+	EstimatedReadyAt time.Time `json:"estimatedReadyAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// ServeStore streams the tickets of a store as server-sent events, one "ticket" event each time one is
+// queued or moves on. A display fetches the queue first and then applies the events on top of it.
+// storeID picks the store from the request, e.g. from a path variable.
+func (h *TicketHub) ServeStore(storeID func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(storeID(r))
+		if err != nil {
+			http.Error(w, "store ID must be a UUID", http.StatusBadRequest)
+			return
+		}
+		serveEvents(w, r, h.fanout, id, func(e orders.TicketUpdated) (string, string, any) {
+			return fmt.Sprintf("%s-%s", e.TicketID, e.Status), "ticket", ticketUpdate{
+				TicketID:         e.TicketID.String(),
+				Items:            e.Items,
+				Status:           string(e.Status),
+				Barista:          e.Barista,
+				EstimatedReadyAt: e.EstimatedReadyAt,
+				UpdatedAt:        e.UpdatedAt,
+			}
+		})
+	}
+}
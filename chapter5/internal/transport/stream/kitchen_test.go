@@ -0,0 +1,50 @@
+package stream_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/transport/stream"
+)
+
+func Test_TicketHubOnlyDeliversTheStoresOwnTickets(t *testing.T) {
+	hub := stream.NewTicketHub()
+	here, elsewhere := uuid.New(), uuid.New()
+	updates, cancel := hub.Subscribe(here)
+	defer cancel()
+
+	for _, storeID := range []uuid.UUID{elsewhere, here} {
+		msg, err := events.NewMessage(orders.TicketUpdated{
+			TicketID:  uuid.New(),
+			StoreID:   storeID,
+			Items:     []string{"latte"},
+			Status:    orders.StatusQueued,
+			UpdatedAt: time.Now(),
+		}, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		if err := hub.Handle(context.Background(), msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+
+	select {
+	case e := <-updates:
+		if e.StoreID != here {
+			t.Fatalf("expected the ticket of this store but got %+v", e)
+		}
+	default:
+		t.Fatal("expected a ticket for this store")
+	}
+	select {
+	case e := <-updates:
+		t.Fatalf("expected no more tickets but got %+v", e)
+	default:
+	}
+}
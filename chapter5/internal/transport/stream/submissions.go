@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/submission"
+)
+
+// SubmissionHub fans the updates of purchases submitted to be completed in the background out to the
+// clients following them.
+type SubmissionHub struct {
+	registry *events.Registry
+	fanout   *fanout[submission.Updated]
+}
+
+func NewSubmissionHub() *SubmissionHub {
+	r := events.NewRegistry()
+	submission.RegisterEvents(r)
+	return &SubmissionHub{registry: r, fanout: newFanout[submission.Updated]()}
+}
+
+// Close ends every stream, so a server shutting down does not wait on clients that never disconnect.
+func (h *SubmissionHub) Close() {
+	h.fanout.close()
+}
+
+// Handle is an events.Handler for the submission topic.
+func (h *SubmissionHub) Handle(_ context.Context, msg events.Message) error {
+	if msg.Type != submission.EventTypeUpdated {
+		return nil
+	}
+	evt, err := h.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e := evt.(submission.Updated)
+	h.fanout.send(e.TrackingID, e)
+	return nil
+}
+
+type submissionUpdate struct {
+	SubmissionID string    `json:"submissionId"`
+	Status       string    `json:"status"`
+	PurchaseID   string    `json:"purchaseId,omitempty"`
+	ErrorCode    string    `json:"errorCode,omitempty"`
+	ErrorMessage string    `json:"errorMessage,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ServeSubmission streams the updates of a submission as server-sent events, one "submission" event each
+// time it moves on. A client that connects late may have missed some, so it fetches the submission once
+// connected. submissionID picks the submission from the request, e.g. from a path variable.
+func (h *SubmissionHub) ServeSubmission(submissionID func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := uuid.Parse(submissionID(r))
+		if err != nil {
+			http.Error(w, "submission ID must be a UUID", http.StatusBadRequest)
+			return
+		}
+		serveEvents(w, r, h.fanout, id, func(e submission.Updated) (string, string, any) {
+			update := submissionUpdate{
+				SubmissionID: e.TrackingID.String(),
+				Status:       string(e.Status),
+				ErrorCode:    e.FailureCode,
+				ErrorMessage: e.FailureMessage,
+				UpdatedAt:    e.UpdatedAt,
+			}
+			if e.PurchaseID != uuid.Nil {
+				update.PurchaseID = e.PurchaseID.String()
+			}
+			return fmt.Sprintf("%s-%s", e.TrackingID, e.Status), "submission", update
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package validation
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Violation is one thing wrong with a value, at the path of the field it is about, e.g. "items[2].price".
+type Violation struct {
+	Field   string
+	Message string
+	// Err is the domain error the violation stands for, e.g. purchase.ErrNoProducts. 可选
+	Err error
+}
+
+// Errors lists everything wrong with a value, not just the first problem. errors.Is finds the domain
+// errors of its violations.
+type Errors []Violation
+
+func (e Errors) Error() string {
+	var b strings.Builder
+	for i, v := range e {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		if v.Field != "" {
+			b.WriteString(v.Field)
+			b.WriteString(": ")
+		}
+		b.WriteString(v.Message)
+	}
+	return b.String()
+}
+
+func (e Errors) Unwrap() []error {
+	var errs []error
+	for _, v := range e {
+		if v.Err != nil {
+			errs = append(errs, v.Err)
+		}
+	}
+	return errs
+}
+
+// Validator collects violations. The zero Validator is ready to use.
+type Validator struct {
+	violations Errors
+}
+
+func (v *Validator) Add(field, message string) {
+	v.violations = append(v.violations, Violation{Field: field, Message: message})
+}
+
+// AddErr adds a violation standing for a domain error, described by its message.
+func (v *Validator) AddErr(field string, err error) {
+	v.violations = append(v.violations, Violation{Field: field, Message: err.Error(), Err: err})
+}
+
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.Add(field, message)
+	}
+}
+
+func (v *Validator) CheckErr(ok bool, field string, err error) {
+	if !ok {
+		v.AddErr(field, err)
+	}
+}
+
+// UUID checks value is a UUID, or empty if it is not required.
+func (v *Validator) UUID(field, value string, required bool) {
+	if value == "" {
+		v.Check(!required, field, "is required")
+		return
+	}
+	if _, err := uuid.Parse(value); err != nil {
+		v.Add(field, "must be a UUID")
+	}
+}
+
+// Merge adds the violations of err, as returned by another validation, under field. Any other error is
+// added at field.
+func (v *Validator) Merge(field string, err error) {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		if err != nil {
+			v.AddErr(field, err)
+		}
+		return
+	}
+	for _, violation := range errs {
+		violation.Field = Join(field, violation.Field)
+		v.violations = append(v.violations, violation)
+	}
+}
+
+// Err returns the violations as Errors, or nil if there were none.
+func (v *Validator) Err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return v.violations
+}
+
+// Index is the path of the i-th element of field, e.g. "items[2]".
+func Index(field string, i int) string {
+	return field + "[" + strconv.Itoa(i) + "]"
+}
+
+// Join is the path of a field of parent, e.g. "items[2].price".
+func Join(parent, field string) string {
+	switch {
+	case parent == "":
+		return field
+	case field == "":
+		return parent
+	}
+	return parent + "." + field
+}
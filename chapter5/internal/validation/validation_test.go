@@ -0,0 +1,38 @@
+package validation_test
+
+import (
+	"errors"
+	"testing"
+
+	"coffeeco/internal/validation"
+)
+
+var errTooCold = errors.New("too cold")
+
+func Test_ValidatorCollectsViolationsAtTheirPaths(t *testing.T) {
+	var line validation.Validator
+	line.Check(false, "name", "is required")
+	line.AddErr("temperature", errTooCold)
+
+	var v validation.Validator
+	v.UUID("storeId", "", true)
+	v.UUID("customerId", "", false)
+	v.Merge(validation.Index("lines", 2), line.Err())
+	v.Merge(validation.Index("lines", 3), nil)
+
+	err := v.Err()
+	var violations validation.Errors
+	if !errors.As(err, &violations) || len(violations) != 3 {
+		t.Fatalf("expected 3 violations but got %v", err)
+	}
+	if violations[2].Field != "lines[2].temperature" || !errors.Is(err, errTooCold) {
+		t.Fatalf("expected the temperature of line 2 to be too cold but got %+v", violations[2])
+	}
+	if want := "storeId: is required; lines[2].name: is required; lines[2].temperature: too cold"; err.Error() != want {
+		t.Fatalf("expected %q but got %q", want, err.Error())
+	}
+	var none validation.Validator
+	if none.Err() != nil {
+		t.Fatal("expected no error from a validator without violations")
+	}
+}
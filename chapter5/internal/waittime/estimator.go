@@ -0,0 +1,143 @@
+package waittime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/orders"
+)
+
+// saveAttempts bounds how often a wait is recalculated when someone else keeps saving it first.
+const saveAttempts = 3
+
+// Tickets are the open tickets of a store, e.g. orders.Repository.
+type Tickets interface {
+	Open(ctx context.Context, storeID uuid.UUID) ([]*orders.Ticket, error)
+}
+
+// Estimate is when an order placed now should be ready.
+type Estimate struct {
+	StoreID uuid.UUID
+	ReadyAt time.Time
+	ReadyIn time.Duration
+	// OpenTickets are the tickets ahead of the order, queued or in progress.
+	OpenTickets int
+	// CalculatedAt is when the store's queue was last looked at.
+	CalculatedAt time.Time
+}
+
+// Estimator predicts when orders will be ready at each store. It learns how long products take at each
+// store from the tickets the bar makes, and works out how busy the bar is on every ticket event, so
+// estimates are cheap to read.
+type Estimator struct {
+	repo      Repository
+	tickets   Tickets
+	prepTimes orders.PrepTimes
+	registry  *events.Registry
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(e *Estimator)
+
+// WithPrepTimes says how long items take until a store made them often enough to know better. Items it
+// leaves out take orders.DefaultPrepTime.
+func WithPrepTimes(p orders.PrepTimes) Option {
+	return func(e *Estimator) {
+		e.prepTimes = p
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(e *Estimator) {
+		e.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test the estimates.
+func WithClock(now func() time.Time) Option {
+	return func(e *Estimator) {
+		e.now = now
+	}
+}
+
+func NewEstimator(repo Repository, tickets Tickets, opts ...Option) *Estimator {
+	r := events.NewRegistry()
+	orders.RegisterEvents(r)
+	e := &Estimator{repo: repo, tickets: tickets, registry: r, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Handle is an events.Handler for the orders topic. A ticket that is ready teaches the store how long its
+// items take; every ticket event has the store's wait recalculated.
+func (e *Estimator) Handle(ctx context.Context, msg events.Message) error {
+	if msg.Type != orders.EventTypeTicketUpdated {
+		return nil
+	}
+	evt, err := e.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t := evt.(orders.TicketUpdated)
+	for range saveAttempts {
+		w, err := e.repo.Get(ctx, t.StoreID)
+		if errors.Is(err, ErrNotFound) {
+			w = NewWait(t.StoreID)
+		} else if err != nil {
+			return err
+		}
+		if t.Status == orders.StatusReady && !t.StartedAt.IsZero() {
+			w.learn(t.TicketID, t.Items, t.UpdatedAt.Sub(t.StartedAt), e.prepTimes)
+		}
+		open, err := e.tickets.Open(ctx, t.StoreID)
+		if err != nil {
+			return err
+		}
+		w.recalculate(open, w.PrepTimes(e.prepTimes), e.now())
+		err = e.repo.Save(ctx, w)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save store wait: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to save store wait after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// Estimate says when an order of items placed now at a store should be ready: once a barista is free and
+// has made them. A store with no ticket events yet is assumed to have nothing in the queue.
+func (e *Estimator) Estimate(ctx context.Context, storeID uuid.UUID, items []string) (Estimate, error) {
+	now := e.now()
+	w, err := e.repo.Get(ctx, storeID)
+	if errors.Is(err, ErrNotFound) {
+		w = NewWait(storeID)
+	} else if err != nil {
+		return Estimate{}, err
+	}
+	start := now
+	if w.FreeAt.After(now) {
+		start = w.FreeAt
+	}
+	readyAt := start.Add(w.PrepTimes(e.prepTimes).Of(items))
+	return Estimate{
+		StoreID:      storeID,
+		ReadyAt:      readyAt.UTC(),
+		ReadyIn:      readyAt.Sub(now),
+		OpenTickets:  w.OpenTickets,
+		CalculatedAt: w.CalculatedAt,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package waittime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if nothing was learned about the store yet.
+	Get(ctx context.Context, storeID uuid.UUID) (*Wait, error)
+	// Save returns ErrConcurrencyConflict if the wait was saved by someone else since it was read.
+	Save(ctx context.Context, w *Wait) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps the waits versioned, as tickets of a store can be handled at the same time.
+type MongoRepository struct {
+	client *mongo.Client
+	waits  *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, waits: client.Database("coffeeco").Collection("store_waits")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoWait struct {
+	StoreID      string         `bson:"_id"`
+	Version      int            `bson:"version"`
+	FreeAt       time.Time      `bson:"free_at"`
+	OpenTickets  int            `bson:"open_tickets"`
+	CalculatedAt time.Time      `bson:"calculated_at"`
+	Learned      []mongoLearned `bson:"learned"`
+	Recent       []string       `bson:"recent"`
+}
+
+// mongoLearned is a list entry rather than a map value, as product names may have dots in them.
+type mongoLearned struct {
+	Product string `bson:"product"`
+	MeanMS  int64  `bson:"mean_ms"`
+	Samples int    `bson:"samples"`
+}
+
+func toMongoWait(w *Wait) mongoWait {
+	doc := mongoWait{
+		StoreID:      w.StoreID.String(),
+		Version:      w.version,
+		FreeAt:       w.FreeAt,
+		OpenTickets:  w.OpenTickets,
+		CalculatedAt: w.CalculatedAt,
+		Learned:      make([]mongoLearned, 0, len(w.learned)),
+		Recent:       make([]string, 0, len(w.recent)),
+	}
+	for _, product := range slices.Sorted(maps.Keys(w.learned)) {
+		l := w.learned[product]
+		doc.Learned = append(doc.Learned, mongoLearned{Product: product, MeanMS: l.Mean.Milliseconds(), Samples: l.Samples})
+	}
+	for _, id := range w.recent {
+		doc.Recent = append(doc.Recent, id.String())
+	}
+	return doc
+}
+
+func (m mongoWait) toWait() *Wait {
+	storeID, _ := uuid.Parse(m.StoreID)
+	w := NewWait(storeID)
+	w.FreeAt, w.OpenTickets, w.CalculatedAt, w.version = m.FreeAt, m.OpenTickets, m.CalculatedAt, m.Version
+	for _, l := range m.Learned {
+		w.learned[l.Product] = Learned{Mean: time.Duration(l.MeanMS) * time.Millisecond, Samples: l.Samples}
+	}
+	for _, s := range m.Recent {
+		if id, err := uuid.Parse(s); err == nil {
+			w.recent = append(w.recent, id)
+		}
+	}
+	return w
+}
+
+func (m *MongoRepository) Get(ctx context.Context, storeID uuid.UUID) (_ *Wait, err error) {
+	ctx, span := telemetry.StartClient(ctx, "waittime.MongoRepository.Get", attribute.String("store.id", storeID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoWait
+	if err := m.waits.FindOne(ctx, bson.D{{Key: "_id", Value: storeID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find store wait: %w", err)
+	}
+	return doc.toWait(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, w *Wait) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "waittime.MongoRepository.Save", attribute.String("store.id", w.StoreID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoWait(w)
+	doc.Version = w.version + 1
+	if w.version == 0 {
+		if _, err := m.waits.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save store wait: %w", err)
+		}
+	} else {
+		res, err := m.waits.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.StoreID}, {Key: "version", Value: w.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save store wait: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	w.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.waits.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps waits in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu    sync.Mutex
+	waits map[uuid.UUID]mongoWait
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{waits: map[uuid.UUID]mongoWait{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, storeID uuid.UUID) (*Wait, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.waits[storeID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toWait(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, w *Wait) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.waits[w.StoreID].Version != w.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoWait(w)
+	doc.Version = w.version + 1
+	m.waits[w.StoreID] = doc
+	w.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
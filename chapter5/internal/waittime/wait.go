@@ -0,0 +1,116 @@
+package waittime
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/orders"
+)
+
+var (
+	ErrNotFound            = errors.New("store wait not found")
+	ErrConcurrencyConflict = errors.New("store wait changed since it was read")
+)
+
+const (
+	// weight is how much a new preparation moves the learned time of a product, so the estimates follow
+	// a bar that speeds up or slows down without jumping on every ticket.
+	weight = 0.2
+	// minSamples is how many preparations a product needs before its learned time is trusted over the
+	// configured one.
+	minSamples = 3
+	// maxPrepTime is the longest a ticket is believed to have taken; a ticket left in progress for longer
+	// was more likely forgotten than made.
+	maxPrepTime = 30 * time.Minute
+	// recentTickets is how many tickets a wait remembers learning from.
+	recentTickets = 100
+)
+
+// Learned is how long a product takes to make at a store, averaged over the preparations seen so far.
+type Learned struct {
+	Mean    time.Duration
+	Samples int
+}
+
+// Wait is how busy the bar of a store is, as of its last ticket event, and how long each product takes
+// there.
+type Wait struct {
+	StoreID uuid.UUID
+	// FreeAt is when a barista should be free to start on a new order.
+	FreeAt time.Time
+	// OpenTickets are the tickets queued or in progress.
+	OpenTickets  int
+	CalculatedAt time.Time
+
+	version int
+	learned map[string]Learned
+	// recent are the tickets learned from lately, so a redelivered event is not learned from twice.
+	recent []uuid.UUID
+}
+
+func NewWait(storeID uuid.UUID) *Wait {
+	return &Wait{StoreID: storeID, learned: map[string]Learned{}}
+}
+
+// Learned returns what the store's preparations taught about a product.
+func (w *Wait) Learned(product string) (Learned, bool) {
+	l, ok := w.learned[product]
+	return l, ok
+}
+
+// PrepTimes are the learned times of the products made often enough, over the configured ones.
+func (w *Wait) PrepTimes(configured orders.PrepTimes) orders.PrepTimes {
+	p := make(orders.PrepTimes, len(configured)+len(w.learned))
+	for product, d := range configured {
+		p[product] = d
+	}
+	for product, l := range w.learned {
+		if l.Samples >= minSamples {
+			p[product] = l.Mean
+		}
+	}
+	return p
+}
+
+// learn takes in how long a ticket took from being started to being ready. The time is shared out
+// between its items in proportion to how long each was expected to take. Tickets learned from before and
+// implausible times are ignored.
+func (w *Wait) learn(ticketID uuid.UUID, items []string, took time.Duration, configured orders.PrepTimes) {
+	if len(items) == 0 || took <= 0 || took > maxPrepTime || slices.Contains(w.recent, ticketID) {
+		return
+	}
+	prep := w.PrepTimes(configured)
+	expected := prep.Of(items)
+	for _, item := range items {
+		share := time.Duration(float64(took) * float64(prep.Of([]string{item})) / float64(expected))
+		l := w.learned[item]
+		if l.Samples == 0 {
+			l.Mean = share
+		} else {
+			l.Mean += time.Duration(weight * float64(share-l.Mean))
+		}
+		l.Samples++
+		w.learned[item] = l
+	}
+	w.recent = append(w.recent, ticketID)
+	if len(w.recent) > recentTickets {
+		w.recent = slices.Delete(w.recent, 0, len(w.recent)-recentTickets)
+	}
+}
+
+// recalculate works out when the bar is free again from the open tickets of the store.
+func (w *Wait) recalculate(open []*orders.Ticket, prep orders.PrepTimes, now time.Time) {
+	w.OpenTickets = 0
+	for _, t := range open {
+		if s := t.Status(); s == orders.StatusQueued || s == orders.StatusInProgress {
+			w.OpenTickets++
+		}
+	}
+	// A ticket with nothing on it is ready as soon as a barista can start on it.
+	next := orders.NewTicket(uuid.Nil, w.StoreID, uuid.Nil, nil, now)
+	w.FreeAt = prep.Estimate(append(slices.Clone(open), next), now)[uuid.Nil]
+	w.CalculatedAt = now.UTC()
+}
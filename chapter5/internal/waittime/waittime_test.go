@@ -0,0 +1,106 @@
+package waittime_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/orders"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/waittime"
+)
+
+// relay hands the ticket events straight to the estimator, as the broker would.
+type relay struct {
+	t    *testing.T
+	est  *waittime.Estimator
+	sent []events.Message
+}
+
+func (r *relay) Publish(ctx context.Context, evts ...events.Event) error {
+	for _, e := range evts {
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			return err
+		}
+		r.sent = append(r.sent, msg)
+		if err := r.est.Handle(ctx, msg); err != nil {
+			r.t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	return nil
+}
+
+func Test_WaitIsLearnedFromTheBarAndFollowsTheQueue(t *testing.T) {
+	ctx := context.Background()
+	storeID := uuid.New()
+	now := time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	configured := orders.PrepTimes{"latte": 2 * time.Minute}
+
+	ticketRepo := orders.NewMemoryRepo()
+	waits := waittime.NewMemoryRepo()
+	est := waittime.NewEstimator(waits, ticketRepo, waittime.WithPrepTimes(configured), waittime.WithClock(clock))
+	pub := &relay{t: t, est: est}
+	tickets := orders.NewService(ticketRepo, orders.WithEventPublisher(pub), orders.WithPrepTimes(configured), orders.WithClock(clock))
+
+	queue := func() uuid.UUID {
+		t.Helper()
+		id := uuid.New()
+		msg, _ := events.NewMessage(purchase.Completed{PurchaseID: id, StoreID: storeID, Lines: []purchase.CompletedLine{{ItemName: "latte"}}, PurchasedAt: now}, events.JSONCodec{})
+		if err := tickets.Handle(ctx, msg); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		return id
+	}
+	estimate := func() waittime.Estimate {
+		t.Helper()
+		e, err := est.Estimate(ctx, storeID, []string{"latte"})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		return e
+	}
+
+	if e := estimate(); e.ReadyIn != 2*time.Minute || e.OpenTickets != 0 {
+		t.Fatalf("expected a store with no tickets to take the configured time but got %+v", e)
+	}
+
+	// The bar takes 4 minutes a latte rather than 2.
+	for range 3 {
+		id := queue()
+		_ = tickets.Start(ctx, id, "ana")
+		now = now.Add(4 * time.Minute)
+		_ = tickets.Ready(ctx, id)
+		_ = tickets.PickUp(ctx, id)
+	}
+	if e := estimate(); e.ReadyIn != 4*time.Minute {
+		t.Fatalf("expected the learned time of a latte but got %v", e.ReadyIn)
+	}
+
+	// A redelivered ticket is not learned from twice.
+	w, _ := waits.Get(ctx, storeID)
+	before, _ := w.Learned("latte")
+	for _, msg := range pub.sent {
+		_ = est.Handle(ctx, msg)
+	}
+	w, _ = waits.Get(ctx, storeID)
+	if after, _ := w.Learned("latte"); after.Samples != before.Samples || before.Samples != 3 {
+		t.Fatalf("expected 3 samples of a latte but got %d, then %d", before.Samples, after.Samples)
+	}
+
+	// Two lattes in the queue come before a new one.
+	queue()
+	queue()
+	if e := estimate(); e.ReadyIn != 12*time.Minute || e.OpenTickets != 2 || !e.ReadyAt.Equal(now.Add(12*time.Minute)) {
+		t.Fatalf("expected a new latte to wait for the two queued but got %+v", e)
+	}
+	// Nothing happened at the bar for 5 minutes, so the queue is 5 minutes shorter.
+	now = now.Add(5 * time.Minute)
+	if e := estimate(); e.ReadyIn != 7*time.Minute {
+		t.Fatalf("expected ready in 7 minutes but got %v", e.ReadyIn)
+	}
+}
@@ -0,0 +1,222 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound            = errors.New("wallet not found")
+	ErrInvalidAmount       = errors.New("wallet amounts must be above 0")
+	ErrCurrencyMismatch    = errors.New("wallet is kept in another currency")
+	ErrInsufficientFunds   = errors.New("not enough balance in the wallet")
+	ErrBelowMinTopUp       = errors.New("top-up is below the minimum")
+	ErrOverMaxBalance      = errors.New("top-up would take the wallet over its maximum balance")
+	ErrNoHold              = errors.New("wallet holds nothing for that purchase")
+	ErrOverRefund          = errors.New("refund is more than the wallet paid for the purchase")
+	ErrConcurrencyConflict = errors.New("wallet changed since it was read")
+)
+
+// Kind is what an entry of the ledger did to the wallet.
+type Kind string
+
+const (
+	// KindTopUp is money charged to the customer's card and added to the balance.
+	KindTopUp Kind = "top_up"
+	// KindHold sets money aside for a purchase that is being paid for; it stays in the balance but is not
+	// available until the hold is captured or released.
+	KindHold Kind = "hold"
+	// KindCapture takes the money held for a purchase out of the balance once the purchase is stored.
+	KindCapture Kind = "capture"
+	// KindRelease gives the money held for a purchase that failed back.
+	KindRelease Kind = "release"
+	// KindRefund credits money paid for a purchase back to the balance.
+	KindRefund Kind = "refund"
+)
+
+// Entry is one movement of the ledger. Entries are only ever appended, so the ledger is the history of
+// every cent that went through the wallet; the balance is worked out from it.
+type Entry struct {
+	ID   uuid.UUID
+	Kind Kind
+	// Amount is always above 0; Kind says which way it went.
+	Amount int64
+	// PurchaseID is the purchase a hold, capture, release or refund is for.
+	PurchaseID uuid.UUID
+	// ChargeID is the card charge of a top-up, to refund it if needed.
+	ChargeID string
+	At       time.Time
+}
+
+// Account is the stored value of a customer, opened by their first top-up.
+type Account struct {
+	CustomerID uuid.UUID
+	Currency   string
+	OpenedAt   time.Time
+
+	version int
+	entries []Entry
+}
+
+func NewAccount(customerID uuid.UUID, currency string, openedAt time.Time) *Account {
+	return &Account{CustomerID: customerID, Currency: currency, OpenedAt: openedAt.UTC()}
+}
+
+// Entries are the ledger of the wallet, oldest first.
+func (a *Account) Entries() []Entry {
+	return slices.Clone(a.entries)
+}
+
+// Balance is what was topped up or refunded less what purchases took, holds included.
+func (a *Account) Balance() int64 {
+	var balance int64
+	for _, e := range a.entries {
+		switch e.Kind {
+		case KindTopUp, KindRefund:
+			balance += e.Amount
+		case KindCapture:
+			balance -= e.Amount
+		}
+	}
+	return balance
+}
+
+// Held is what is set aside for purchases being paid for.
+func (a *Account) Held() int64 {
+	var held int64
+	for _, e := range a.entries {
+		if e.Kind == KindHold && a.open(e.PurchaseID) {
+			held += e.Amount
+		}
+	}
+	return held
+}
+
+// Available is what the customer can spend: the balance less what is held.
+func (a *Account) Available() int64 {
+	return a.Balance() - a.Held()
+}
+
+// TopUp adds money charged to the customer's card, within the limits.
+func (a *Account) TopUp(amount int64, chargeID string, l Limits, at time.Time) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if amount < l.MinTopUp {
+		return fmt.Errorf("%w of %d", ErrBelowMinTopUp, l.MinTopUp)
+	}
+	if l.MaxBalance > 0 && a.Balance()+amount > l.MaxBalance {
+		return fmt.Errorf("%w of %d", ErrOverMaxBalance, l.MaxBalance)
+	}
+	a.append(Entry{Kind: KindTopUp, Amount: amount, ChargeID: chargeID}, at)
+	return nil
+}
+
+// Hold sets amount aside for a purchase. Holding the same purchase again does nothing, so a retried
+// payment is not held twice.
+func (a *Account) Hold(purchaseID uuid.UUID, amount int64, at time.Time) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if a.held(purchaseID) {
+		return nil
+	}
+	if amount > a.Available() {
+		return ErrInsufficientFunds
+	}
+	a.append(Entry{Kind: KindHold, Amount: amount, PurchaseID: purchaseID}, at)
+	return nil
+}
+
+// Capture takes what is held for a purchase out of the balance. Capturing it again does nothing.
+func (a *Account) Capture(purchaseID uuid.UUID, at time.Time) error {
+	hold, ok := a.hold(purchaseID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoHold, purchaseID)
+	}
+	if !a.open(purchaseID) {
+		if a.captured(purchaseID) > 0 {
+			return nil
+		}
+		return fmt.Errorf("%w: %s was released", ErrNoHold, purchaseID)
+	}
+	a.append(Entry{Kind: KindCapture, Amount: hold.Amount, PurchaseID: purchaseID}, at)
+	return nil
+}
+
+// Release gives back what is held for a purchase. Releasing a purchase that holds nothing, or whose hold
+// was captured, does nothing.
+func (a *Account) Release(purchaseID uuid.UUID, at time.Time) {
+	hold, ok := a.hold(purchaseID)
+	if !ok || !a.open(purchaseID) {
+		return
+	}
+	a.append(Entry{Kind: KindRelease, Amount: hold.Amount, PurchaseID: purchaseID}, at)
+}
+
+// Refund credits money paid for a purchase back to the balance, up to what the wallet paid for it less
+// what was refunded already.
+func (a *Account) Refund(purchaseID uuid.UUID, amount int64, at time.Time) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if amount > a.refundable(purchaseID) {
+		return fmt.Errorf("%w: %d of %s", ErrOverRefund, a.refundable(purchaseID), purchaseID)
+	}
+	a.append(Entry{Kind: KindRefund, Amount: amount, PurchaseID: purchaseID}, at)
+	return nil
+}
+
+// Refundable is what can still be refunded of a purchase.
+func (a *Account) Refundable(purchaseID uuid.UUID) int64 {
+	return a.refundable(purchaseID)
+}
+
+func (a *Account) refundable(purchaseID uuid.UUID) int64 {
+	left := a.captured(purchaseID)
+	for _, e := range a.entries {
+		if e.Kind == KindRefund && e.PurchaseID == purchaseID {
+			left -= e.Amount
+		}
+	}
+	return left
+}
+
+func (a *Account) hold(purchaseID uuid.UUID) (Entry, bool) {
+	i := slices.IndexFunc(a.entries, func(e Entry) bool { return e.Kind == KindHold && e.PurchaseID == purchaseID })
+	if i < 0 {
+		return Entry{}, false
+	}
+	return a.entries[i], true
+}
+
+func (a *Account) held(purchaseID uuid.UUID) bool {
+	_, ok := a.hold(purchaseID)
+	return ok
+}
+
+// open tells whether the hold of a purchase is neither captured nor released.
+func (a *Account) open(purchaseID uuid.UUID) bool {
+	return !slices.ContainsFunc(a.entries, func(e Entry) bool {
+		return (e.Kind == KindCapture || e.Kind == KindRelease) && e.PurchaseID == purchaseID
+	})
+}
+
+func (a *Account) captured(purchaseID uuid.UUID) int64 {
+	for _, e := range a.entries {
+		if e.Kind == KindCapture && e.PurchaseID == purchaseID {
+			return e.Amount
+		}
+	}
+	return 0
+}
+
+func (a *Account) append(e Entry, at time.Time) {
+	e.ID = uuid.New()
+	e.At = at.UTC()
+	a.entries = append(a.entries, e)
+}
@@ -0,0 +1,12 @@
+package wallet
+
+// Limits keep wallets within what stored value may hold without further checks on the customer. Amounts
+// are in the minor unit of Currency.
+type Limits struct {
+	// Currency is what wallets are kept in; purchases in another currency cannot be paid from them.
+	Currency string `json:"currency"`
+	// MaxBalance is the most a wallet may hold; 0 leaves it unlimited.
+	MaxBalance int64 `json:"max_balance"`
+	// MinTopUp is the least a top-up may add, so card fees do not eat it.
+	MinTopUp int64 `json:"min_top_up"`
+}
@@ -0,0 +1,176 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Get returns ErrNotFound if the customer has no wallet.
+	Get(ctx context.Context, customerID uuid.UUID) (*Account, error)
+	// Save returns ErrConcurrencyConflict if the wallet was saved by someone else since it was read, so two
+	// purchases never spend the same balance.
+	Save(ctx context.Context, a *Account) error
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps a wallet and its ledger in one versioned document per customer.
+type MongoRepository struct {
+	client   *mongo.Client
+	accounts *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	return &MongoRepository{client: client, accounts: client.Database("coffeeco").Collection("wallets")}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoAccount struct {
+	ID       string       `bson:"_id"`
+	Version  int          `bson:"version"`
+	Currency string       `bson:"currency"`
+	OpenedAt time.Time    `bson:"opened_at"`
+	Entries  []mongoEntry `bson:"entries"`
+}
+
+type mongoEntry struct {
+	ID         string    `bson:"id"`
+	Kind       string    `bson:"kind"`
+	Amount     int64     `bson:"amount"`
+	PurchaseID string    `bson:"purchase_id,omitempty"`
+	ChargeID   string    `bson:"charge_id,omitempty"`
+	At         time.Time `bson:"at"`
+}
+
+func toMongoAccount(a *Account) mongoAccount {
+	doc := mongoAccount{
+		ID:       a.CustomerID.String(),
+		Version:  a.version,
+		Currency: a.Currency,
+		OpenedAt: a.OpenedAt,
+		Entries:  make([]mongoEntry, 0, len(a.entries)),
+	}
+	for _, e := range a.entries {
+		me := mongoEntry{ID: e.ID.String(), Kind: string(e.Kind), Amount: e.Amount, ChargeID: e.ChargeID, At: e.At}
+		if e.PurchaseID != uuid.Nil {
+			me.PurchaseID = e.PurchaseID.String()
+		}
+		doc.Entries = append(doc.Entries, me)
+	}
+	return doc
+}
+
+func (m mongoAccount) toAccount() *Account {
+	customerID, _ := uuid.Parse(m.ID)
+	a := &Account{CustomerID: customerID, Currency: m.Currency, OpenedAt: m.OpenedAt, version: m.Version}
+	for _, me := range m.Entries {
+		e := Entry{Kind: Kind(me.Kind), Amount: me.Amount, ChargeID: me.ChargeID, At: me.At}
+		e.ID, _ = uuid.Parse(me.ID)
+		if me.PurchaseID != "" {
+			e.PurchaseID, _ = uuid.Parse(me.PurchaseID)
+		}
+		a.entries = append(a.entries, e)
+	}
+	return a
+}
+
+func (m *MongoRepository) Get(ctx context.Context, customerID uuid.UUID) (_ *Account, err error) {
+	ctx, span := telemetry.StartClient(ctx, "wallet.MongoRepository.Get", attribute.String("customer.id", customerID.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoAccount
+	if err := m.accounts.FindOne(ctx, bson.D{{Key: "_id", Value: customerID.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find wallet: %w", err)
+	}
+	return doc.toAccount(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, a *Account) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "wallet.MongoRepository.Save", attribute.String("customer.id", a.CustomerID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoAccount(a)
+	doc.Version = a.version + 1
+	if a.version == 0 {
+		if _, err := m.accounts.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save wallet: %w", err)
+		}
+	} else {
+		res, err := m.accounts.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: a.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save wallet: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	a.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.accounts.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps wallets in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	accounts map[uuid.UUID]mongoAccount
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{accounts: map[uuid.UUID]mongoAccount{}}
+}
+
+func (m *MemoryRepository) Get(_ context.Context, customerID uuid.UUID) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.accounts[customerID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toAccount(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, a *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[a.CustomerID].Version != a.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoAccount(a)
+	doc.Version = a.version + 1
+	m.accounts[a.CustomerID] = doc
+	a.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
@@ -0,0 +1,170 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving first.
+const saveAttempts = 3
+
+// CardGateway charges top-ups to the customer's card, and refunds a top-up that could not be recorded,
+// e.g. payment.StripeService.
+type CardGateway interface {
+	Charge(ctx context.Context, amount money.Money, cardToken string) (chargeID string, err error)
+	RefundAmount(ctx context.Context, chargeID string, amount money.Money) error
+}
+
+type Service struct {
+	repo    Repository
+	gateway CardGateway
+	limits  Limits
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+type Option func(s *Service)
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when entries were made.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, gateway CardGateway, limits Limits, opts ...Option) *Service {
+	s := &Service{repo: repo, gateway: gateway, limits: limits, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Account returns the customer's wallet, ErrNotFound if they never topped it up.
+func (s *Service) Account(ctx context.Context, customerID uuid.UUID) (*Account, error) {
+	return s.repo.Get(ctx, customerID)
+}
+
+// TopUp charges amount to the customer's card and adds it to their wallet, opening it on the first top-up.
+// The limits are checked before the card is charged; if the top-up cannot be recorded after all, the
+// charge is refunded.
+func (s *Service) TopUp(ctx context.Context, customerID uuid.UUID, amount money.Money, cardToken string) (*Account, error) {
+	if err := s.inCurrency(amount); err != nil {
+		return nil, err
+	}
+	a, err := s.account(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.TopUp(amount.Amount(), "", s.limits, s.now()); err != nil {
+		return nil, err
+	}
+	chargeID, err := s.gateway.Charge(ctx, amount, cardToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to charge top-up: %w", err)
+	}
+	a, err = s.update(ctx, customerID, true, func(a *Account) error {
+		return a.TopUp(amount.Amount(), chargeID, s.limits, s.now())
+	})
+	if err != nil {
+		if rerr := s.gateway.RefundAmount(context.WithoutCancel(ctx), chargeID, amount); rerr != nil {
+			s.logger.ErrorContext(ctx, "top-up not recorded and not refunded", "customer", customerID, "charge", chargeID, "error", rerr)
+		}
+		return nil, fmt.Errorf("failed to record top-up: %w", err)
+	}
+	return a, nil
+}
+
+// Hold sets amount aside from the customer's wallet for a purchase being paid for. It is safe to call
+// again for the same purchase.
+func (s *Service) Hold(ctx context.Context, customerID, purchaseID uuid.UUID, amount money.Money) error {
+	if err := s.inCurrency(amount); err != nil {
+		return err
+	}
+	_, err := s.update(ctx, customerID, false, func(a *Account) error {
+		return a.Hold(purchaseID, amount.Amount(), s.now())
+	})
+	return err
+}
+
+// Capture takes what is held for a purchase out of the wallet once the purchase is stored.
+func (s *Service) Capture(ctx context.Context, customerID, purchaseID uuid.UUID) error {
+	_, err := s.update(ctx, customerID, false, func(a *Account) error {
+		return a.Capture(purchaseID, s.now())
+	})
+	return err
+}
+
+// Release gives back what is held for a purchase that failed.
+func (s *Service) Release(ctx context.Context, customerID, purchaseID uuid.UUID) error {
+	_, err := s.update(ctx, customerID, false, func(a *Account) error {
+		a.Release(purchaseID, s.now())
+		return nil
+	})
+	return err
+}
+
+// Refund credits amount paid for a purchase back to the customer's wallet, up to what the wallet paid
+// for it.
+func (s *Service) Refund(ctx context.Context, customerID, purchaseID uuid.UUID, amount money.Money) (*Account, error) {
+	if err := s.inCurrency(amount); err != nil {
+		return nil, err
+	}
+	return s.update(ctx, customerID, false, func(a *Account) error {
+		return a.Refund(purchaseID, amount.Amount(), s.now())
+	})
+}
+
+func (s *Service) inCurrency(amount money.Money) error {
+	if amount.Currency().Code != s.limits.Currency {
+		return fmt.Errorf("%w: %s, not %s", ErrCurrencyMismatch, s.limits.Currency, amount.Currency().Code)
+	}
+	return nil
+}
+
+// account is the customer's wallet, or a new one if they have none yet.
+func (s *Service) account(ctx context.Context, customerID uuid.UUID) (*Account, error) {
+	a, err := s.repo.Get(ctx, customerID)
+	if errors.Is(err, ErrNotFound) {
+		return NewAccount(customerID, s.limits.Currency, s.now()), nil
+	}
+	return a, err
+}
+
+// update applies fn to the latest wallet and saves it, starting over if someone else saved in between.
+// With open, a customer without a wallet gets a new one; otherwise it fails with ErrNotFound.
+func (s *Service) update(ctx context.Context, customerID uuid.UUID, open bool, fn func(a *Account) error) (*Account, error) {
+	for range saveAttempts {
+		a, err := s.repo.Get(ctx, customerID)
+		if open && errors.Is(err, ErrNotFound) {
+			a, err = NewAccount(customerID, s.limits.Currency, s.now()), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(a); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, a)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("failed to update wallet after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
@@ -0,0 +1,105 @@
+package wallet_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	"coffeeco/internal/wallet"
+)
+
+type cards struct {
+	charged  []int64
+	refunded []string
+}
+
+func (c *cards) Charge(_ context.Context, amount money.Money, _ string) (string, error) {
+	c.charged = append(c.charged, amount.Amount())
+	return "ch_" + uuid.NewString(), nil
+}
+
+func (c *cards) RefundAmount(_ context.Context, chargeID string, _ money.Money) error {
+	c.refunded = append(c.refunded, chargeID)
+	return nil
+}
+
+func Test_TopUpHoldCaptureAndRefundToTheBalance(t *testing.T) {
+	ctx := context.Background()
+	gateway := &cards{}
+	svc := wallet.NewService(wallet.NewMemoryRepo(), gateway, wallet.Limits{Currency: "USD", MaxBalance: 10000, MinTopUp: 500})
+	alice := uuid.New()
+
+	if _, err := svc.Account(ctx, alice); !errors.Is(err, wallet.ErrNotFound) {
+		t.Fatalf("expected no wallet before the first top-up but got %v", err)
+	}
+	if _, err := svc.TopUp(ctx, alice, *money.New(100, "USD"), "tok"); !errors.Is(err, wallet.ErrBelowMinTopUp) {
+		t.Fatalf("expected the top-up to be below the minimum but got %v", err)
+	}
+	if _, err := svc.TopUp(ctx, alice, *money.New(1000, "EUR"), "tok"); !errors.Is(err, wallet.ErrCurrencyMismatch) {
+		t.Fatalf("expected euros to be turned down but got %v", err)
+	}
+	a, err := svc.TopUp(ctx, alice, *money.New(2000, "USD"), "tok")
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if a.Balance() != 2000 || len(gateway.charged) != 1 {
+		t.Fatalf("expected 20.00 in the wallet from one charge but got %d from %v", a.Balance(), gateway.charged)
+	}
+	if _, err := svc.TopUp(ctx, alice, *money.New(9000, "USD"), "tok"); !errors.Is(err, wallet.ErrOverMaxBalance) || len(gateway.charged) != 1 {
+		t.Fatalf("expected the top-up over the maximum to be turned down before charging but got %v", err)
+	}
+
+	// A hold keeps the balance but not what is available, and holding the same purchase again is a no-op.
+	coffee, cake := uuid.New(), uuid.New()
+	for range 2 {
+		if err := svc.Hold(ctx, alice, coffee, *money.New(450, "USD")); err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+	}
+	if err := svc.Hold(ctx, alice, cake, *money.New(1600, "USD")); !errors.Is(err, wallet.ErrInsufficientFunds) {
+		t.Fatalf("expected the held coffee to leave too little for the cake but got %v", err)
+	}
+	a, _ = svc.Account(ctx, alice)
+	if a.Balance() != 2000 || a.Held() != 450 || a.Available() != 1550 {
+		t.Fatalf("expected 4.50 held of 20.00 but got %d held of %d", a.Held(), a.Balance())
+	}
+
+	if err := svc.Capture(ctx, alice, coffee); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Hold(ctx, alice, cake, *money.New(500, "USD")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Release(ctx, alice, cake); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Release(ctx, alice, coffee); err != nil {
+		t.Fatalf("expected releasing a captured purchase to do nothing but got %v", err)
+	}
+	a, _ = svc.Account(ctx, alice)
+	if a.Balance() != 1550 || a.Available() != 1550 {
+		t.Fatalf("expected the coffee spent and the cake given back but got %d, %d available", a.Balance(), a.Available())
+	}
+
+	// Refunds go back to the balance, never more than the wallet paid.
+	if _, err := svc.Refund(ctx, alice, coffee, *money.New(200, "USD")); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Refund(ctx, alice, coffee, *money.New(300, "USD")); !errors.Is(err, wallet.ErrOverRefund) {
+		t.Fatalf("expected only 2.50 left to refund but got %v", err)
+	}
+	if _, err := svc.Refund(ctx, alice, cake, *money.New(100, "USD")); !errors.Is(err, wallet.ErrOverRefund) {
+		t.Fatalf("expected the released cake to have nothing to refund but got %v", err)
+	}
+	a, _ = svc.Account(ctx, alice)
+	kinds := map[wallet.Kind]int{}
+	for _, e := range a.Entries() {
+		kinds[e.Kind]++
+	}
+	if a.Balance() != 1750 || kinds[wallet.KindTopUp] != 1 || kinds[wallet.KindHold] != 2 || kinds[wallet.KindCapture] != 1 || kinds[wallet.KindRelease] != 1 || kinds[wallet.KindRefund] != 1 {
+		t.Fatalf("expected 17.50 and every movement in the ledger but got %d and %v", a.Balance(), kinds)
+	}
+}
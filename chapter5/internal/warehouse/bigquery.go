@@ -0,0 +1,316 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const bigQueryURL = "https://bigquery.googleapis.com"
+
+// BigQueryConfig names the service account key, which needs the BigQuery Data Editor and Job User roles,
+// and the dataset tables are kept in.
+type BigQueryConfig struct {
+	CredentialsFile string `json:"credentials_file"`
+	Dataset         string `json:"dataset"`
+	// Location is where the dataset is, e.g. "EU"; empty for US.
+	Location string `json:"location,omitempty"`
+	// BaseURL defaults to BigQuery; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// BigQuery loads batches into BigQuery with load jobs whose IDs are made from the batch IDs. BigQuery
+// refuses a job whose ID it already has, so a batch is loaded once however often it is tried.
+type BigQuery struct {
+	projectID string
+	dataset   string
+	location  string
+	baseURL   string
+	client    *http.Client
+	// pollEvery is how often a running load job is checked on.
+	pollEvery time.Duration
+}
+
+type serviceAccount struct {
+	ProjectID    string `json:"project_id"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// NewBigQuery authenticates as the service account in cfg.CredentialsFile. Requests, including those for
+// access tokens, go through client.
+func NewBigQuery(cfg BigQueryConfig, client *http.Client) (*BigQuery, error) {
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bigquery credentials: %w", err)
+	}
+	var sa serviceAccount
+	if err := json.Unmarshal(data, &sa); err != nil || sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("bigquery credentials must be the JSON key of a service account")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = bigQueryURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	conf := &jwt.Config{
+		Email:        sa.ClientEmail,
+		PrivateKey:   []byte(sa.PrivateKey),
+		PrivateKeyID: sa.PrivateKeyID,
+		Scopes:       []string{"https://www.googleapis.com/auth/bigquery"},
+		TokenURL:     sa.TokenURI,
+	}
+	// The client is kept for as long as the writer, so it cannot be bound to a caller's context.
+	authed := conf.Client(context.WithValue(context.Background(), oauth2.HTTPClient, client))
+	return &BigQuery{projectID: sa.ProjectID, dataset: cfg.Dataset, location: cfg.Location, baseURL: cfg.BaseURL, client: authed, pollEvery: time.Second}, nil
+}
+
+type bqField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Mode string `json:"mode,omitempty"`
+}
+
+type bqTable struct {
+	TableReference struct {
+		ProjectID string `json:"projectId"`
+		DatasetID string `json:"datasetId"`
+		TableID   string `json:"tableId"`
+	} `json:"tableReference"`
+	Schema struct {
+		Fields []bqField `json:"fields"`
+	} `json:"schema"`
+}
+
+type bqError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type bqJob struct {
+	JobReference struct {
+		ProjectID string `json:"projectId"`
+		JobID     string `json:"jobId"`
+		Location  string `json:"location,omitempty"`
+	} `json:"jobReference"`
+	Configuration struct {
+		Load struct {
+			DestinationTable struct {
+				ProjectID string `json:"projectId"`
+				DatasetID string `json:"datasetId"`
+				TableID   string `json:"tableId"`
+			} `json:"destinationTable"`
+			SourceFormat     string `json:"sourceFormat"`
+			WriteDisposition string `json:"writeDisposition"`
+		} `json:"load"`
+	} `json:"configuration"`
+	Status struct {
+		State       string `json:"state"`
+		ErrorResult *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errorResult,omitempty"`
+	} `json:"status,omitzero"`
+}
+
+func (b *BigQuery) tablesURL() string {
+	return b.baseURL + "/bigquery/v2/projects/" + url.PathEscape(b.projectID) + "/datasets/" + url.PathEscape(b.dataset) + "/tables"
+}
+
+// EnsureTable creates the table with every column nullable, or patches in the columns it lacks.
+func (b *BigQuery) EnsureTable(ctx context.Context, table string, schema []Column) error {
+	var t bqTable
+	status, err := b.do(ctx, http.MethodGet, b.tablesURL()+"/"+url.PathEscape(table), nil, "", &t)
+	switch {
+	case status == http.StatusNotFound:
+		t.TableReference.ProjectID, t.TableReference.DatasetID, t.TableReference.TableID = b.projectID, b.dataset, table
+		for _, c := range schema {
+			t.Schema.Fields = append(t.Schema.Fields, bqField{Name: c.Name, Type: string(c.Type), Mode: "NULLABLE"})
+		}
+		_, err = b.doJSON(ctx, http.MethodPost, b.tablesURL(), t, nil)
+		return err
+	case err != nil:
+		return err
+	}
+	existing := map[string]string{}
+	for _, f := range t.Schema.Fields {
+		existing[f.Name] = f.Type
+	}
+	missing := false
+	for _, c := range schema {
+		typ, ok := existing[c.Name]
+		if !ok {
+			t.Schema.Fields = append(t.Schema.Fields, bqField{Name: c.Name, Type: string(c.Type), Mode: "NULLABLE"})
+			missing = true
+			continue
+		}
+		if !sameBigQueryType(typ, c.Type) {
+			return fmt.Errorf("%w: %s.%s is %s, not %s", ErrSchemaMismatch, table, c.Name, typ, c.Type)
+		}
+	}
+	if !missing {
+		return nil
+	}
+	var patch bqTable
+	patch.Schema = t.Schema
+	_, err = b.doJSON(ctx, http.MethodPatch, b.tablesURL()+"/"+url.PathEscape(table), patch, nil)
+	return err
+}
+
+// sameBigQueryType tells whether a type BigQuery reports is typ, which it may call by its legacy name.
+func sameBigQueryType(reported string, typ ColumnType) bool {
+	legacy := map[ColumnType]string{Int64: "INTEGER", Bool: "BOOLEAN"}
+	return reported == string(typ) || reported == legacy[typ]
+}
+
+// maxJobAttempts is how many jobs a batch is loaded with at most. A job that failed loaded nothing, so the
+// batch is tried again under the next job ID; they are numbered so every attempt finds the earlier ones.
+const maxJobAttempts = 5
+
+// Load loads the batch as newline delimited JSON.
+func (b *BigQuery) Load(ctx context.Context, batch Batch) error {
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	for _, r := range batch.Rows {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to encode warehouse row: %w", err)
+		}
+	}
+	var err error
+	for attempt := 1; attempt <= maxJobAttempts; attempt++ {
+		jobID := fmt.Sprintf("coffeeco_%s_%d", batch.ID, attempt)
+		var job bqJob
+		if job, err = b.insertJob(ctx, jobID, batch.Table, data.Bytes()); err != nil {
+			return err
+		}
+		if job, err = b.wait(ctx, job); err != nil {
+			return err
+		}
+		if job.Status.ErrorResult == nil {
+			return nil
+		}
+		err = fmt.Errorf("bigquery load job %s failed: %s: %s", jobID, job.Status.ErrorResult.Reason, job.Status.ErrorResult.Message)
+	}
+	return err
+}
+
+// insertJob starts the load job jobID, or finds it if it was started before.
+func (b *BigQuery) insertJob(ctx context.Context, jobID, table string, data []byte) (bqJob, error) {
+	var job bqJob
+	job.JobReference.ProjectID, job.JobReference.JobID, job.JobReference.Location = b.projectID, jobID, b.location
+	load := &job.Configuration.Load
+	load.DestinationTable.ProjectID, load.DestinationTable.DatasetID, load.DestinationTable.TableID = b.projectID, b.dataset, table
+	load.SourceFormat, load.WriteDisposition = "NEWLINE_DELIMITED_JSON", "WRITE_APPEND"
+	meta, err := json.Marshal(job)
+	if err != nil {
+		return bqJob{}, err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		data        []byte
+	}{{"application/json; charset=UTF-8", meta}, {"application/octet-stream", data}} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return bqJob{}, err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return bqJob{}, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return bqJob{}, err
+	}
+	u := b.baseURL + "/upload/bigquery/v2/projects/" + url.PathEscape(b.projectID) + "/jobs?uploadType=multipart"
+	status, err := b.do(ctx, http.MethodPost, u, &body, "multipart/related; boundary="+mw.Boundary(), &job)
+	if status == http.StatusConflict {
+		return b.job(ctx, jobID)
+	}
+	return job, err
+}
+
+func (b *BigQuery) job(ctx context.Context, jobID string) (bqJob, error) {
+	u := b.baseURL + "/bigquery/v2/projects/" + url.PathEscape(b.projectID) + "/jobs/" + url.PathEscape(jobID)
+	if b.location != "" {
+		u += "?location=" + url.QueryEscape(b.location)
+	}
+	var job bqJob
+	_, err := b.do(ctx, http.MethodGet, u, nil, "", &job)
+	return job, err
+}
+
+// wait checks on the job until it is done.
+func (b *BigQuery) wait(ctx context.Context, job bqJob) (bqJob, error) {
+	for job.Status.State != "DONE" {
+		select {
+		case <-ctx.Done():
+			return bqJob{}, ctx.Err()
+		case <-time.After(b.pollEvery):
+		}
+		var err error
+		if job, err = b.job(ctx, job.JobReference.JobID); err != nil {
+			return bqJob{}, err
+		}
+	}
+	return job, nil
+}
+
+func (b *BigQuery) doJSON(ctx context.Context, method, u string, in, out any) (int, error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return 0, err
+	}
+	return b.do(ctx, method, u, bytes.NewReader(body), "application/json", out)
+}
+
+// do sends a request and decodes the response into out. It returns the status along with the error, for
+// callers that expect some errors, e.g. a table that does not exist yet.
+func (b *BigQuery) do(ctx context.Context, method, u string, body io.Reader, contentType string, out any) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return 0, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reach bigquery: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var e bqError
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("bigquery %d %s: %s", resp.StatusCode, e.Error.Status, e.Error.Message)
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to decode bigquery response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
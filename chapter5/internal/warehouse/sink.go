@@ -0,0 +1,133 @@
+package warehouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/telemetry"
+)
+
+// Sink exports completed purchases to a warehouse, a row per line. Handle stages the rows of each event,
+// and Run loads what is staged in batches through the writer, so a slow or unreachable warehouse holds up
+// neither the broker nor the other consumers.
+type Sink struct {
+	staging   Staging
+	writer    Writer
+	table     string
+	batchSize int
+	registry  *events.Registry
+	logger    *slog.Logger
+}
+
+type Option func(s *Sink)
+
+// WithTable is the table purchases are exported to; the default is purchase_lines.
+func WithTable(name string) Option {
+	return func(s *Sink) {
+		s.table = name
+	}
+}
+
+// WithBatchSize is how many events at most are loaded together; the default is 500.
+func WithBatchSize(n int) Option {
+	return func(s *Sink) {
+		s.batchSize = n
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Sink) {
+		s.logger = l
+	}
+}
+
+func NewSink(staging Staging, writer Writer, opts ...Option) *Sink {
+	r := events.NewRegistry()
+	purchase.RegisterEvents(r)
+	s := &Sink{staging: staging, writer: writer, table: "purchase_lines", batchSize: 500, registry: r, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *Sink) Name() string {
+	return "warehouse"
+}
+
+// Handle stages the rows of a completed purchase. Other events are ignored.
+func (s *Sink) Handle(ctx context.Context, msg events.Message) error {
+	evt, err := s.registry.Decode(msg)
+	if errors.Is(err, events.ErrUnknownEvent) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e, ok := evt.(purchase.Completed)
+	if !ok {
+		return nil
+	}
+	if msg.ID == uuid.Nil {
+		return fmt.Errorf("purchase %s completed has no message ID", e.PurchaseID)
+	}
+	return s.staging.Stage(ctx, s.table, msg.ID.String(), lines(msg.ID, e))
+}
+
+// EnsureTable creates the export table, or adds the columns it lacks.
+func (s *Sink) EnsureTable(ctx context.Context) error {
+	if err := s.writer.EnsureTable(ctx, s.table, PurchaseLines); err != nil {
+		return fmt.Errorf("failed to ensure warehouse table %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// Flush loads everything staged, a batch at a time, starting with a batch whose load was cut short. It
+// stops at the first batch that fails to load, which is tried again, with the same ID, on the next flush.
+func (s *Sink) Flush(ctx context.Context) (err error) {
+	ctx, span := telemetry.Start(ctx, "warehouse.Sink.Flush")
+	defer telemetry.End(span, &err)
+
+	for {
+		b, err := s.staging.Next(ctx, s.table, s.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(b.Rows) == 0 {
+			return nil
+		}
+		for _, r := range b.Rows {
+			r["batch_id"] = b.ID
+		}
+		if err := s.writer.Load(ctx, b); err != nil {
+			return fmt.Errorf("failed to load warehouse batch %s: %w", b.ID, err)
+		}
+		if err := s.staging.Done(ctx, b); err != nil {
+			return err
+		}
+		s.logger.InfoContext(ctx, "warehouse batch loaded", "batch", b.ID, "table", b.Table, "rows", len(b.Rows))
+	}
+}
+
+// Run flushes every interval until ctx is done.
+func (s *Sink) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if err := s.Flush(ctx); err != nil && ctx.Err() == nil {
+			s.logger.ErrorContext(ctx, "warehouse batches not loaded", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
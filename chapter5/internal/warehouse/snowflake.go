@@ -0,0 +1,179 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnowflakeConfig names the account and where tables are kept. Token is a programmatic access token of a
+// user whose role may create tables in Schema and insert into them.
+type SnowflakeConfig struct {
+	// Account is the account identifier, e.g. "myorg-myaccount".
+	Account   string `json:"account"`
+	Token     string `json:"token"`
+	Database  string `json:"database"`
+	Schema    string `json:"schema"`
+	Warehouse string `json:"warehouse"`
+	Role      string `json:"role,omitempty"`
+	// BaseURL defaults to https://<account>.snowflakecomputing.com; set it to test against a fake.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// Snowflake loads batches into Snowflake through its SQL API. Snowflake has no load job IDs, so every row
+// carries its batch_id and a batch is only inserted if its ID is not in the table yet, in the same
+// statement. The statement is sent with the batch ID as its request ID, so Snowflake runs it once even if
+// the request is retried.
+type Snowflake struct {
+	cfg    SnowflakeConfig
+	client *http.Client
+	// pollEvery is how often a running statement is checked on.
+	pollEvery time.Duration
+
+	mu sync.Mutex
+	// schemas are the columns of the tables ensured, which loads insert.
+	schemas map[string][]Column
+}
+
+func NewSnowflake(cfg SnowflakeConfig, client *http.Client) *Snowflake {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = "https://" + cfg.Account + ".snowflakecomputing.com"
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Snowflake{cfg: cfg, client: client, pollEvery: time.Second, schemas: map[string][]Column{}}
+}
+
+// snowflakeTypes are the Snowflake types of the column types.
+var snowflakeTypes = map[ColumnType]string{
+	String:    "VARCHAR",
+	Int64:     "NUMBER(38,0)",
+	Bool:      "BOOLEAN",
+	Timestamp: "TIMESTAMP_TZ",
+}
+
+type sfBinding struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sfStatement struct {
+	Statement string               `json:"statement"`
+	Timeout   int                  `json:"timeout"`
+	Database  string               `json:"database"`
+	Schema    string               `json:"schema"`
+	Warehouse string               `json:"warehouse"`
+	Role      string               `json:"role,omitempty"`
+	Bindings  map[string]sfBinding `json:"bindings,omitempty"`
+}
+
+type sfResponse struct {
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	StatementHandle string `json:"statementHandle"`
+}
+
+// EnsureTable creates the table if it does not exist and adds the columns it lacks. Snowflake keeps
+// column types to itself here, so a column of another type only fails the loads.
+func (s *Snowflake) EnsureTable(ctx context.Context, table string, schema []Column) error {
+	cols := make([]string, 0, len(schema))
+	for _, c := range schema {
+		cols = append(cols, c.Name+" "+snowflakeTypes[c.Type])
+	}
+	if err := s.exec(ctx, uuid.NewString(), "CREATE TABLE IF NOT EXISTS "+table+" ("+strings.Join(cols, ", ")+")", nil); err != nil {
+		return err
+	}
+	for _, col := range cols {
+		if err := s.exec(ctx, uuid.NewString(), "ALTER TABLE "+table+" ADD COLUMN IF NOT EXISTS "+col, nil); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.schemas[table] = schema
+	s.mu.Unlock()
+	return nil
+}
+
+// Load inserts the rows of the batch, bound as a single JSON array, unless rows of the batch are in the
+// table already. The table must have been ensured first.
+func (s *Snowflake) Load(ctx context.Context, b Batch) error {
+	s.mu.Lock()
+	schema, ok := s.schemas[b.Table]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("snowflake table %s was not ensured", b.Table)
+	}
+	data, err := json.Marshal(b.Rows)
+	if err != nil {
+		return fmt.Errorf("failed to encode warehouse rows: %w", err)
+	}
+	names := make([]string, 0, len(schema))
+	values := make([]string, 0, len(schema))
+	for _, c := range schema {
+		names = append(names, c.Name)
+		values = append(values, fmt.Sprintf(`value:"%s"::%s`, c.Name, snowflakeTypes[c.Type]))
+	}
+	stmt := "INSERT INTO " + b.Table + " (" + strings.Join(names, ", ") + ") SELECT " + strings.Join(values, ", ") +
+		" FROM TABLE(FLATTEN(INPUT => PARSE_JSON(?))) WHERE NOT EXISTS (SELECT 1 FROM " + b.Table + " WHERE batch_id = ?)"
+	return s.exec(ctx, b.ID, stmt, map[string]sfBinding{"1": {Type: "TEXT", Value: string(data)}, "2": {Type: "TEXT", Value: b.ID}})
+}
+
+// exec runs a statement and waits for it to finish. requestID makes sending it again a retry of the same
+// statement rather than another one.
+func (s *Snowflake) exec(ctx context.Context, requestID, statement string, bindings map[string]sfBinding) error {
+	body, err := json.Marshal(sfStatement{
+		Statement: statement,
+		Timeout:   300,
+		Database:  s.cfg.Database,
+		Schema:    s.cfg.Schema,
+		Warehouse: s.cfg.Warehouse,
+		Role:      s.cfg.Role,
+		Bindings:  bindings,
+	})
+	if err != nil {
+		return err
+	}
+	u := s.cfg.BaseURL + "/api/v2/statements?requestId=" + url.QueryEscape(requestID) + "&retry=true"
+	res, status, err := s.do(ctx, http.MethodPost, u, body)
+	for err == nil && status == http.StatusAccepted {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollEvery):
+		}
+		res, status, err = s.do(ctx, http.MethodGet, s.cfg.BaseURL+"/api/v2/statements/"+url.PathEscape(res.StatementHandle), nil)
+	}
+	return err
+}
+
+func (s *Snowflake) do(ctx context.Context, method, u string, body []byte) (sfResponse, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return sfResponse{}, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	req.Header.Set("X-Snowflake-Authorization-Token-Type", "PROGRAMMATIC_ACCESS_TOKEN")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return sfResponse{}, 0, fmt.Errorf("failed to reach snowflake: %w", err)
+	}
+	defer resp.Body.Close()
+	var res sfResponse
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return res, resp.StatusCode, fmt.Errorf("snowflake %d %s: %s", resp.StatusCode, res.Code, res.Message)
+	}
+	return res, resp.StatusCode, nil
+}
@@ -0,0 +1,278 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+// Staging keeps the rows of events until they are loaded, so that acknowledging an event does not wait
+// for its batch, and a batch cut short by a crash is loaded again with the same events and ID.
+type Staging interface {
+	// Stage keeps the rows of an event for table. Staging an event again, even once it was loaded, does
+	// nothing, so redelivered events are not exported twice.
+	Stage(ctx context.Context, table, eventID string, rows []Row) error
+	// Next is the batch of table whose load was cut short, if there is one, or else up to max events staged
+	// for it, oldest first, batched together. The batch has no rows when nothing is staged.
+	Next(ctx context.Context, table string, max int) (Batch, error)
+	// Done marks the events of a loaded batch as loaded and forgets their rows.
+	Done(ctx context.Context, b Batch) error
+}
+
+// loadedFor is how long staging remembers events that were loaded, to ignore them if they are redelivered.
+const loadedFor = 30 * 24 * time.Hour
+
+type mongoStaged struct {
+	EventID  string     `bson:"_id"`
+	Table    string     `bson:"table"`
+	Rows     []string   `bson:"rows,omitempty"`
+	StagedAt time.Time  `bson:"staged_at"`
+	Batch    string     `bson:"batch"`
+	LoadedAt *time.Time `bson:"loaded_at,omitempty"`
+}
+
+type MongoStaging struct {
+	client *mongo.Client
+	staged *mongo.Collection
+}
+
+// NewMongoStaging stages rows in the warehouse_staging collection, each row as JSON.
+func NewMongoStaging(ctx context.Context, connectionString string) (*MongoStaging, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	staged := client.Database("coffeeco").Collection("warehouse_staging")
+	_, err = staged.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "table", Value: 1}, {Key: "batch", Value: 1}, {Key: "staged_at", Value: 1}}},
+		{Keys: bson.D{{Key: "loaded_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(loadedFor.Seconds()))},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warehouse staging indexes: %w", err)
+	}
+	return &MongoStaging{client: client, staged: staged}, nil
+}
+
+// Close disconnects from Mongo. The staging cannot be used afterwards.
+func (m *MongoStaging) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+func (m *MongoStaging) Stage(ctx context.Context, table, eventID string, rows []Row) error {
+	encoded, err := encodeRows(rows)
+	if err != nil {
+		return err
+	}
+	doc := bson.D{{Key: "table", Value: table}, {Key: "rows", Value: encoded}, {Key: "staged_at", Value: time.Now().UTC()}, {Key: "batch", Value: ""}}
+	_, err = m.staged.UpdateOne(ctx, bson.D{{Key: "_id", Value: eventID}}, bson.D{{Key: "$setOnInsert", Value: doc}}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to stage warehouse rows: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoStaging) Next(ctx context.Context, table string, max int) (b Batch, err error) {
+	ctx, span := telemetry.StartClient(ctx, "warehouse.MongoStaging.Next", attribute.String("warehouse.table", table))
+	defer telemetry.End(span, &err)
+
+	var pending mongoStaged
+	err = m.staged.FindOne(ctx, bson.D{{Key: "table", Value: table}, {Key: "batch", Value: bson.D{{Key: "$ne", Value: ""}}}, {Key: "loaded_at", Value: nil}}).Decode(&pending)
+	switch {
+	case err == nil:
+		return m.batch(ctx, table, pending.Batch)
+	case err != mongo.ErrNoDocuments:
+		return Batch{}, fmt.Errorf("failed to find the pending warehouse batch: %w", err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "staged_at", Value: 1}}).SetLimit(int64(max)).SetProjection(bson.D{{Key: "_id", Value: 1}})
+	cur, err := m.staged.Find(ctx, bson.D{{Key: "table", Value: table}, {Key: "batch", Value: ""}}, opts)
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to find staged warehouse rows: %w", err)
+	}
+	var staged []mongoStaged
+	if err := cur.All(ctx, &staged); err != nil {
+		return Batch{}, fmt.Errorf("failed to read staged warehouse rows: %w", err)
+	}
+	if len(staged) == 0 {
+		return Batch{Table: table}, nil
+	}
+	ids := make([]string, 0, len(staged))
+	for _, s := range staged {
+		ids = append(ids, s.EventID)
+	}
+	id := batchID(table, ids)
+	_, err = m.staged.UpdateMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}, {Key: "batch", Value: ""}}, bson.D{{Key: "$set", Value: bson.D{{Key: "batch", Value: id}}}})
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to batch staged warehouse rows: %w", err)
+	}
+	return m.batch(ctx, table, id)
+}
+
+func (m *MongoStaging) batch(ctx context.Context, table, id string) (Batch, error) {
+	cur, err := m.staged.Find(ctx, bson.D{{Key: "batch", Value: id}}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return Batch{}, fmt.Errorf("failed to find warehouse batch %s: %w", id, err)
+	}
+	var staged []mongoStaged
+	if err := cur.All(ctx, &staged); err != nil {
+		return Batch{}, fmt.Errorf("failed to read warehouse batch %s: %w", id, err)
+	}
+	b := Batch{ID: id, Table: table}
+	for _, s := range staged {
+		rows, err := decodeRows(s.Rows)
+		if err != nil {
+			return Batch{}, fmt.Errorf("failed to read warehouse batch %s: %w", id, err)
+		}
+		b.Rows = append(b.Rows, rows...)
+	}
+	return b, nil
+}
+
+func (m *MongoStaging) Done(ctx context.Context, b Batch) error {
+	now := time.Now().UTC()
+	_, err := m.staged.UpdateMany(ctx, bson.D{{Key: "batch", Value: b.ID}}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "loaded_at", Value: now}}},
+		{Key: "$unset", Value: bson.D{{Key: "rows", Value: ""}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark warehouse batch %s loaded: %w", b.ID, err)
+	}
+	return nil
+}
+
+func (m *MongoStaging) Ping(ctx context.Context) error {
+	if _, err := m.staged.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// encodeRows and decodeRows keep rows as JSON, so numbers come back as they were and not as BSON types.
+func encodeRows(rows []Row) ([]string, error) {
+	encoded := make([]string, 0, len(rows))
+	for _, r := range rows {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode warehouse row: %w", err)
+		}
+		encoded = append(encoded, string(data))
+	}
+	return encoded, nil
+}
+
+func decodeRows(encoded []string) ([]Row, error) {
+	rows := make([]Row, 0, len(encoded))
+	for _, s := range encoded {
+		d := json.NewDecoder(bytes.NewReader([]byte(s)))
+		d.UseNumber()
+		var r Row
+		if err := d.Decode(&r); err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+// MemoryStaging keeps rows in process. It is meant for tests and local experiments.
+type MemoryStaging struct {
+	mu     sync.Mutex
+	staged map[string]*memoryStaged
+	seq    int
+}
+
+type memoryStaged struct {
+	table  string
+	rows   []Row
+	seq    int
+	batch  string
+	loaded bool
+}
+
+func NewMemoryStaging() *MemoryStaging {
+	return &MemoryStaging{staged: map[string]*memoryStaged{}}
+}
+
+func (m *MemoryStaging) Stage(_ context.Context, table, eventID string, rows []Row) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.staged[eventID]; ok {
+		return nil
+	}
+	m.seq++
+	m.staged[eventID] = &memoryStaged{table: table, rows: rows, seq: m.seq}
+	return nil
+}
+
+func (m *MemoryStaging) Next(_ context.Context, table string, max int) (Batch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.staged {
+		if s.table == table && s.batch != "" && !s.loaded {
+			return m.batch(table, s.batch), nil
+		}
+	}
+	var ids []string
+	for id, s := range m.staged {
+		if s.table == table && s.batch == "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return Batch{Table: table}, nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return m.staged[ids[i]].seq < m.staged[ids[j]].seq })
+	if len(ids) > max {
+		ids = ids[:max]
+	}
+	id := batchID(table, ids)
+	for _, eventID := range ids {
+		m.staged[eventID].batch = id
+	}
+	return m.batch(table, id), nil
+}
+
+func (m *MemoryStaging) batch(table, id string) Batch {
+	var ids []string
+	for eventID, s := range m.staged {
+		if s.batch == id {
+			ids = append(ids, eventID)
+		}
+	}
+	sort.Strings(ids)
+	b := Batch{ID: id, Table: table}
+	for _, eventID := range ids {
+		for _, r := range m.staged[eventID].rows {
+			// Rows are copied, so setting their batch_id does not change the staged rows.
+			b.Rows = append(b.Rows, maps.Clone(r))
+		}
+	}
+	return b
+}
+
+func (m *MemoryStaging) Done(_ context.Context, b Batch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.staged {
+		if s.batch == b.ID {
+			s.loaded, s.rows = true, nil
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStaging) Ping(context.Context) error {
+	return nil
+}
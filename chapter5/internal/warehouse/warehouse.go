@@ -0,0 +1,120 @@
+package warehouse
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/purchase"
+)
+
+// ErrSchemaMismatch means a table in the warehouse has a column of the schema with another type. Columns
+// are only ever added, so the table has to be fixed by hand.
+var ErrSchemaMismatch = errors.New("warehouse table does not match its schema")
+
+// ColumnType is the type of a column, named as BigQuery names it. Writers map it to their own types.
+type ColumnType string
+
+const (
+	String    ColumnType = "STRING"
+	Int64     ColumnType = "INT64"
+	Bool      ColumnType = "BOOL"
+	Timestamp ColumnType = "TIMESTAMP"
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Row is a row of a table by column name. Timestamps are RFC 3339 strings, so rows stage as JSON as is.
+type Row map[string]any
+
+// Batch is rows loaded into a table together. Its ID is made from the events the rows came from, so a
+// batch tried again after a crash keeps its ID, and writers load a batch ID at most once.
+type Batch struct {
+	ID    string
+	Table string
+	Rows  []Row
+}
+
+// Writer loads batches into a warehouse.
+type Writer interface {
+	// EnsureTable creates the table, or adds the columns of schema it lacks. Columns are never dropped or
+	// retyped; a column of another type is an ErrSchemaMismatch.
+	EnsureTable(ctx context.Context, table string, schema []Column) error
+	// Load appends the rows of b to its table, unless a batch with its ID was loaded before.
+	Load(ctx context.Context, b Batch) error
+}
+
+// PurchaseLines is the schema of the table purchases are exported to, one row per line. Columns are only
+// ever added to the end, never removed or retyped, so warehouse queries keep working.
+var PurchaseLines = []Column{
+	{Name: "batch_id", Type: String},
+	{Name: "event_id", Type: String},
+	{Name: "purchase_id", Type: String},
+	{Name: "store_id", Type: String},
+	{Name: "customer_id", Type: String},
+	{Name: "purchased_at", Type: Timestamp},
+	{Name: "currency", Type: String},
+	{Name: "payment_means", Type: String},
+	{Name: "channel", Type: String},
+	{Name: "line_no", Type: Int64},
+	{Name: "item", Type: String},
+	{Name: "amount", Type: Int64},
+	{Name: "reusable_cup", Type: Bool},
+	{Name: "purchase_total", Type: Int64},
+	{Name: "experiment", Type: String},
+	{Name: "variant", Type: String},
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidTable tells whether name can be used as a table name by every writer, unquoted.
+func ValidTable(name string) bool {
+	return identifier.MatchString(name)
+}
+
+// lines flattens a completed purchase into a row per line. Amounts are in the minor unit of currency, and
+// customer_id is empty for anonymous purchases. batch_id is set as the rows are loaded.
+func lines(eventID uuid.UUID, e purchase.Completed) []Row {
+	rows := make([]Row, 0, len(e.Lines))
+	customerID := ""
+	if e.CustomerID != uuid.Nil {
+		customerID = e.CustomerID.String()
+	}
+	for i, l := range e.Lines {
+		rows = append(rows, Row{
+			"event_id":       eventID.String(),
+			"purchase_id":    e.PurchaseID.String(),
+			"store_id":       e.StoreID.String(),
+			"customer_id":    customerID,
+			"purchased_at":   e.PurchasedAt.UTC().Format("2006-01-02T15:04:05.999999Z07:00"),
+			"currency":       e.Currency,
+			"payment_means":  e.PaymentMeans,
+			"channel":        e.Channel,
+			"line_no":        int64(i + 1),
+			"item":           l.ItemName,
+			"amount":         l.Amount,
+			"reusable_cup":   l.ReusableCup,
+			"purchase_total": e.Total,
+			"experiment":     e.Experiment,
+			"variant":        e.Variant,
+		})
+	}
+	return rows
+}
+
+// batchNamespace makes batch IDs, which are name-based UUIDs of the events batched.
+var batchNamespace = uuid.MustParse("4f0d5a9e-59b1-4c43-9a53-0c5e1f0b7d21")
+
+// batchID is the ID of a batch of the rows of eventIDs, whatever their order.
+func batchID(table string, eventIDs []string) string {
+	ids := slices.Clone(eventIDs)
+	slices.Sort(ids)
+	return uuid.NewSHA1(batchNamespace, []byte(table+"\n"+strings.Join(ids, "\n"))).String()
+}
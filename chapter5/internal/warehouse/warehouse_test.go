@@ -0,0 +1,142 @@
+package warehouse_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/purchase"
+	"coffeeco/internal/warehouse"
+)
+
+// flakyWriter fails the first load, and like BigQuery loads a batch ID once.
+type flakyWriter struct {
+	failed bool
+	loads  []warehouse.Batch
+	loaded map[string]bool
+}
+
+func (w *flakyWriter) EnsureTable(context.Context, string, []warehouse.Column) error {
+	return nil
+}
+
+func (w *flakyWriter) Load(_ context.Context, b warehouse.Batch) error {
+	w.loads = append(w.loads, b)
+	if !w.failed {
+		w.failed = true
+		return errors.New("warehouse unreachable")
+	}
+	w.loaded[b.ID] = true
+	return nil
+}
+
+func Test_PurchasesAreExportedInBatchesOnce(t *testing.T) {
+	ctx := context.Background()
+	writer := &flakyWriter{loaded: map[string]bool{}}
+	sink := warehouse.NewSink(warehouse.NewMemoryStaging(), writer, warehouse.WithBatchSize(2))
+	complete := func(lines ...string) {
+		t.Helper()
+		e := purchase.Completed{PurchaseID: uuid.New(), StoreID: uuid.New(), Currency: "USD", PaymentMeans: "card", Channel: "app", PurchasedAt: time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)}
+		for _, l := range lines {
+			e.Lines = append(e.Lines, purchase.CompletedLine{ItemName: l, Amount: 300})
+			e.Total += 300
+		}
+		msg, err := events.NewMessage(e, events.JSONCodec{})
+		if err != nil {
+			t.Fatalf("expected no error but got %v", err)
+		}
+		// Redelivered events must not be exported twice.
+		for range 2 {
+			if err := sink.Handle(ctx, msg); err != nil {
+				t.Fatalf("expected no error but got %v", err)
+			}
+		}
+	}
+	complete("latte", "croissant")
+	complete("flat white")
+	complete("espresso")
+
+	if err := sink.Flush(ctx); err == nil {
+		t.Fatal("expected the first load to fail")
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if len(writer.loads) != 3 {
+		t.Fatalf("expected the failed batch to be tried again, then the last purchase but got %d loads", len(writer.loads))
+	}
+	failed, retried, last := writer.loads[0], writer.loads[1], writer.loads[2]
+	if failed.ID != retried.ID || len(retried.Rows) != 3 || retried.Table != "purchase_lines" {
+		t.Fatalf("expected the batch of the first two purchases tried again under its ID but got %s then %+v", failed.ID, retried)
+	}
+	if last.ID == retried.ID || len(last.Rows) != 1 || !writer.loaded[last.ID] {
+		t.Fatalf("expected the last purchase in a batch of its own but got %+v", last)
+	}
+	r := last.Rows[0]
+	if r["batch_id"] != last.ID || r["item"] != "espresso" || r["line_no"] != int64(1) || r["purchased_at"] != "2024-03-01T15:00:00Z" || r["customer_id"] != "" {
+		t.Fatalf("expected a flattened line tagged with its batch but got %v", r)
+	}
+
+	if err := sink.Flush(ctx); err != nil || len(writer.loads) != 3 {
+		t.Fatalf("expected nothing left to load but got %d loads and %v", len(writer.loads), err)
+	}
+}
+
+func Test_SnowflakeInsertsABatchOnlyIfItIsNotThereYet(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		statements []string
+		requestIDs []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Statement string `json:"statement"`
+			Bindings  map[string]struct {
+				Value string `json:"value"`
+			} `json:"bindings"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		statements = append(statements, body.Statement)
+		requestIDs = append(requestIDs, r.URL.Query().Get("requestId"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":"090001","message":"Statement executed successfully."}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	sf := warehouse.NewSnowflake(warehouse.SnowflakeConfig{Account: "acme", Token: "pat", Database: "analytics", Schema: "coffeeco", Warehouse: "loading", BaseURL: srv.URL}, srv.Client())
+	b := warehouse.Batch{ID: uuid.NewString(), Table: "purchase_lines", Rows: []warehouse.Row{{"item": "latte"}}}
+	if err := sf.Load(ctx, b); err == nil {
+		t.Fatal("expected loading into a table that was not ensured to fail")
+	}
+	if err := sf.EnsureTable(ctx, "purchase_lines", warehouse.PurchaseLines); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if !strings.HasPrefix(statements[0], "CREATE TABLE IF NOT EXISTS purchase_lines (batch_id VARCHAR") || len(statements) != 1+len(warehouse.PurchaseLines) {
+		t.Fatalf("expected the table created and every column added if missing but got %q", statements)
+	}
+	if err := sf.Load(ctx, b); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	insert := statements[len(statements)-1]
+	if !strings.HasPrefix(insert, "INSERT INTO purchase_lines") || !strings.Contains(insert, "WHERE NOT EXISTS (SELECT 1 FROM purchase_lines WHERE batch_id = ?)") {
+		t.Fatalf("expected an insert guarded by the batch ID but got %q", insert)
+	}
+	if requestIDs[len(requestIDs)-1] != b.ID {
+		t.Fatalf("expected the batch ID as the request ID but got %s", requestIDs[len(requestIDs)-1])
+	}
+}
@@ -0,0 +1,210 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoRepository struct {
+	subscriptions *mongo.Collection
+	attempts      *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	return &MongoRepository{
+		subscriptions: db.Collection("webhook_subscriptions"),
+		attempts:      db.Collection("webhook_attempts"),
+	}, nil
+}
+
+type mongoSubscription struct {
+	ID         string    `bson:"_id"`
+	Partner    string    `bson:"partner"`
+	URL        string    `bson:"url"`
+	Secret     string    `bson:"secret"`
+	EventTypes []string  `bson:"event_types"`
+	CreatedAt  time.Time `bson:"created_at"`
+}
+
+type mongoAttempt struct {
+	ID             string        `bson:"_id"`
+	SubscriptionID string        `bson:"subscription_id"`
+	EventID        string        `bson:"event_id"`
+	EventType      string        `bson:"event_type"`
+	Number         int           `bson:"number"`
+	StatusCode     int           `bson:"status_code"`
+	Error          string        `bson:"error"`
+	Duration       time.Duration `bson:"duration"`
+	AttemptedAt    time.Time     `bson:"attempted_at"`
+}
+
+func (m *MongoRepository) AddSubscription(ctx context.Context, s Subscription) error {
+	_, err := m.subscriptions.InsertOne(ctx, mongoSubscription{
+		ID:         s.ID.String(),
+		Partner:    s.Partner,
+		URL:        s.URL,
+		Secret:     s.Secret,
+		EventTypes: s.EventTypes,
+		CreatedAt:  s.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) RemoveSubscription(ctx context.Context, id uuid.UUID) error {
+	if _, err := m.subscriptions.DeleteOne(ctx, bson.D{{Key: "_id", Value: id.String()}}); err != nil {
+		return fmt.Errorf("failed to remove webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Subscriptions(ctx context.Context) ([]Subscription, error) {
+	cur, err := m.subscriptions.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook subscriptions: %w", err)
+	}
+	var docs []mongoSubscription
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook subscriptions: %w", err)
+	}
+	subs := make([]Subscription, 0, len(docs))
+	for _, d := range docs {
+		id, _ := uuid.Parse(d.ID)
+		subs = append(subs, Subscription{
+			ID:         id,
+			Partner:    d.Partner,
+			URL:        d.URL,
+			Secret:     d.Secret,
+			EventTypes: d.EventTypes,
+			CreatedAt:  d.CreatedAt,
+		})
+	}
+	return subs, nil
+}
+
+func (m *MongoRepository) RecordAttempt(ctx context.Context, a Attempt) error {
+	_, err := m.attempts.InsertOne(ctx, mongoAttempt{
+		ID:             a.ID.String(),
+		SubscriptionID: a.SubscriptionID.String(),
+		EventID:        a.EventID.String(),
+		EventType:      a.EventType,
+		Number:         a.Number,
+		StatusCode:     a.StatusCode,
+		Error:          a.Error,
+		Duration:       a.Duration,
+		AttemptedAt:    a.AttemptedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+	return nil
+}
+
+func (m *MongoRepository) Attempts(ctx context.Context, f AttemptFilter) ([]Attempt, error) {
+	filter := bson.D{}
+	if f.SubscriptionID != uuid.Nil {
+		filter = append(filter, bson.E{Key: "subscription_id", Value: f.SubscriptionID.String()})
+	}
+	if f.EventID != uuid.Nil {
+		filter = append(filter, bson.E{Key: "event_id", Value: f.EventID.String()})
+	}
+	if f.FailedOnly {
+		filter = append(filter, bson.E{Key: "error", Value: bson.D{{Key: "$ne", Value: ""}}})
+	}
+	cur, err := m.attempts.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "attempted_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find webhook attempts: %w", err)
+	}
+	var docs []mongoAttempt
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode webhook attempts: %w", err)
+	}
+	attempts := make([]Attempt, 0, len(docs))
+	for _, d := range docs {
+		id, _ := uuid.Parse(d.ID)
+		subID, _ := uuid.Parse(d.SubscriptionID)
+		eventID, _ := uuid.Parse(d.EventID)
+		attempts = append(attempts, Attempt{
+			ID:             id,
+			SubscriptionID: subID,
+			EventID:        eventID,
+			EventType:      d.EventType,
+			Number:         d.Number,
+			StatusCode:     d.StatusCode,
+			Error:          d.Error,
+			Duration:       d.Duration,
+			AttemptedAt:    d.AttemptedAt,
+		})
+	}
+	return attempts, nil
+}
+
+// MemoryRepository keeps subscriptions and attempts in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu            sync.Mutex
+	subscriptions map[uuid.UUID]Subscription
+	attempts      []Attempt
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{subscriptions: map[uuid.UUID]Subscription{}}
+}
+
+func (m *MemoryRepository) AddSubscription(_ context.Context, s Subscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[s.ID] = s
+	return nil
+}
+
+func (m *MemoryRepository) RemoveSubscription(_ context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.subscriptions, id)
+	return nil
+}
+
+func (m *MemoryRepository) Subscriptions(_ context.Context) ([]Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		subs = append(subs, s)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (m *MemoryRepository) RecordAttempt(_ context.Context, a Attempt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, a)
+	return nil
+}
+
+func (m *MemoryRepository) Attempts(_ context.Context, f AttemptFilter) ([]Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Attempt
+	for _, a := range m.attempts {
+		if f.Matches(a) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,268 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"coffeeco/internal/correlation"
+	"coffeeco/internal/events"
+)
+
+const (
+	HeaderSignature = "Coffeeco-Signature"
+	HeaderEventID   = "Coffeeco-Event-Id"
+	HeaderEventType = "Coffeeco-Event-Type"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Subscription is a partner endpoint that wants to be told about some of our events.
+type Subscription struct {
+	ID      uuid.UUID
+	Partner string
+	URL     string
+	// Secret is shared with the partner and used to sign every delivery.
+	Secret string
+	// EventTypes limits which events are delivered; empty means all of them.
+	EventTypes []string
+	CreatedAt  time.Time
+}
+
+func (s Subscription) Wants(eventType string) bool {
+	if len(s.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range s.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt is one try at delivering an event to a subscription, kept so partners' integration
+// problems can be debugged.
+type Attempt struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Number         int
+	StatusCode     int
+	Error          string
+	Duration       time.Duration
+	AttemptedAt    time.Time
+}
+
+func (a Attempt) Succeeded() bool {
+	return a.Error == ""
+}
+
+// AttemptFilter narrows down attempts; zero fields match everything.
+type AttemptFilter struct {
+	SubscriptionID uuid.UUID
+	EventID        uuid.UUID
+	FailedOnly     bool
+}
+
+func (f AttemptFilter) Matches(a Attempt) bool {
+	return (f.SubscriptionID == uuid.Nil || f.SubscriptionID == a.SubscriptionID) &&
+		(f.EventID == uuid.Nil || f.EventID == a.EventID) &&
+		(!f.FailedOnly || !a.Succeeded())
+}
+
+type Repository interface {
+	AddSubscription(ctx context.Context, s Subscription) error
+	RemoveSubscription(ctx context.Context, id uuid.UUID) error
+	Subscriptions(ctx context.Context) ([]Subscription, error)
+	RecordAttempt(ctx context.Context, a Attempt) error
+	Attempts(ctx context.Context, f AttemptFilter) ([]Attempt, error)
+}
+
+// Dispatcher delivers events to every subscription that wants them. Its Handle method is an
+// events.Handler, so it can be plugged into any Subscriber.
+type Dispatcher struct {
+	repo   Repository
+	client *http.Client
+	// MaxAttempts is how often a delivery is tried before giving up; Backoff is the wait before the
+	// second attempt and doubles after that.
+	MaxAttempts int
+	Backoff     time.Duration
+}
+
+func NewDispatcher(repo Repository, client *http.Client) (*Dispatcher, error) {
+	if repo == nil {
+		return nil, errors.New("repository cannot be nil")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	}
+	return &Dispatcher{repo: repo, client: client, MaxAttempts: 5, Backoff: time.Second}, nil
+}
+
+type body struct {
+	ID          uuid.UUID       `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	AggregateID string          `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// Handle delivers msg to all interested subscriptions. If any of them could not be reached the error
+// is returned, so the subscriber redelivers the message; subscriptions that already got it will see
+// the same event ID again and are expected to ignore it.
+func (d *Dispatcher) Handle(ctx context.Context, msg events.Message) error {
+	subs, err := d.repo.Subscriptions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+	if msg.ContentType != "" && msg.ContentType != (events.JSONCodec{}).ContentType() {
+		return fmt.Errorf("webhooks need JSON events, got %s", msg.ContentType)
+	}
+	payload, err := json.Marshal(body{
+		ID:          msg.ID,
+		Type:        msg.Type,
+		Version:     msg.Version,
+		AggregateID: msg.AggregateID,
+		OccurredAt:  msg.OccurredAt,
+		Data:        msg.Payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook body: %w", err)
+	}
+
+	var errs []error
+	for _, s := range subs {
+		if !s.Wants(msg.Type) {
+			continue
+		}
+		if err := d.deliver(ctx, s, msg, payload); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s (%s): %w", s.ID, s.Partner, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, s Subscription, msg events.Message, payload []byte) error {
+	backoff := d.Backoff
+	var err error
+	for n := 1; n <= d.MaxAttempts; n++ {
+		if n > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = d.attempt(ctx, s, msg, payload, n)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, s Subscription, msg events.Message, payload []byte, n int) (bool, error) {
+	a := Attempt{
+		ID:             uuid.New(),
+		SubscriptionID: s.ID,
+		EventID:        msg.ID,
+		EventType:      msg.Type,
+		Number:         n,
+		AttemptedAt:    time.Now().UTC(),
+	}
+	retry, err := d.post(ctx, s, msg, payload, &a)
+	a.Duration = time.Since(a.AttemptedAt)
+	if err != nil {
+		a.Error = err.Error()
+	}
+	if recErr := d.repo.RecordAttempt(ctx, a); recErr != nil {
+		return true, errors.Join(err, fmt.Errorf("failed to record attempt: %w", recErr))
+	}
+	return retry, err
+}
+
+func (d *Dispatcher) post(ctx context.Context, s Subscription, msg events.Message, payload []byte, a *Attempt) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, msg.ID.String())
+	req.Header.Set(HeaderEventType, msg.Type)
+	if msg.CorrelationID != "" {
+		req.Header.Set(correlation.Header, msg.CorrelationID)
+	}
+	req.Header.Set(HeaderSignature, Sign(s.Secret, a.AttemptedAt, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	a.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// Other client errors mean the partner rejected the request; sending it again will not help.
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("partner responded %s", resp.Status)
+}
+
+// Sign returns the signature header value for body: the timestamp and an HMAC-SHA256 of
+// "<timestamp>.<body>", so a captured request cannot be replayed with a new timestamp.
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+// Verify checks a signature header as a partner would, rejecting signatures older than tolerance.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if now.Sub(time.Unix(unix, 0)) > tolerance {
+		return fmt.Errorf("%w: too old", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(mac(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret, ts string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,94 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/events"
+	"coffeeco/internal/webhook"
+)
+
+func Test_DispatcherSignsAndRetriesDeliveries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("s3cret", r.Header.Get(webhook.HeaderSignature), body, time.Minute, time.Now()); err != nil {
+			t.Errorf("expected a valid signature but got %v", err)
+		}
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	var (
+		ctx  = context.Background()
+		repo = webhook.NewMemoryRepo()
+		sub  = webhook.Subscription{ID: uuid.New(), Partner: "beans-r-us", URL: srv.URL, Secret: "s3cret", EventTypes: []string{"purchase.completed"}}
+	)
+	_ = repo.AddSubscription(ctx, sub)
+	d, err := webhook.NewDispatcher(repo, srv.Client())
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	d.Backoff = time.Millisecond
+
+	msg := events.Message{ID: uuid.New(), Type: "purchase.completed", ContentType: "application/json", Payload: []byte(`{"total":350}`)}
+	if err := d.Handle(ctx, msg); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	// Not subscribed to, so not delivered.
+	if err := d.Handle(ctx, events.Message{ID: uuid.New(), Type: "loyalty.stamp_added", Payload: []byte(`{}`)}); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	attempts, _ := repo.Attempts(ctx, webhook.AttemptFilter{EventID: msg.ID})
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts but got %d", len(attempts))
+	}
+	if attempts[0].StatusCode != http.StatusServiceUnavailable || attempts[0].Succeeded() || !attempts[1].Succeeded() {
+		t.Fatalf("expected a failed then a successful attempt but got %+v", attempts)
+	}
+}
+
+func Test_DispatcherDoesNotRetryRejectedDeliveries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	repo := webhook.NewMemoryRepo()
+	_ = repo.AddSubscription(ctx, webhook.Subscription{ID: uuid.New(), URL: srv.URL, Secret: "s3cret"})
+	d, _ := webhook.NewDispatcher(repo, srv.Client())
+	d.Backoff = time.Millisecond
+
+	if err := d.Handle(ctx, events.Message{ID: uuid.New(), Type: "purchase.completed", Payload: []byte(`{}`)}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected 1 call but got %d", calls.Load())
+	}
+}
+
+func Test_VerifyRejectsTamperedBodies(t *testing.T) {
+	now := time.Now()
+	sig := webhook.Sign("s3cret", now, []byte(`{"total":350}`))
+	if err := webhook.Verify("s3cret", sig, []byte(`{"total":1}`), time.Minute, now); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := webhook.Verify("s3cret", sig, []byte(`{"total":350}`), time.Minute, now.Add(time.Hour)); err == nil {
+		t.Fatal("expected an error for an old signature")
+	}
+}
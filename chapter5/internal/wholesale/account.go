@@ -0,0 +1,106 @@
+package wholesale
+
+import (
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrAccountNotFound = errors.New("wholesale account not found")
+	ErrNoName          = errors.New("wholesale accounts are registered with a name")
+	ErrInvalidTerms    = errors.New("credit limits, payment days and prices cannot be negative")
+)
+
+// Account is a café registered to buy beans in bulk, on credit up to a limit and paying invoices within
+// the days it was given.
+type Account struct {
+	ID           uuid.UUID
+	Name         string
+	Email        string // 可选, 发票发给谁
+	RegisteredAt time.Time
+
+	version     int
+	creditLimit int64
+	paymentDays int
+	prices      map[string]int64
+	// owed is what approved orders not paid yet come to, shipped or not.
+	owed int64
+}
+
+func NewAccount(name, email string, creditLimit int64, paymentDays int, registeredAt time.Time) (*Account, error) {
+	if name == "" {
+		return nil, ErrNoName
+	}
+	a := &Account{ID: uuid.New(), Name: name, Email: email, RegisteredAt: registeredAt.UTC(), prices: map[string]int64{}}
+	if err := a.SetTerms(creditLimit, paymentDays); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Account) CreditLimit() int64 {
+	return a.creditLimit
+}
+
+// PaymentDays is how long the café has to pay an invoice; 0 means the days of the Terms.
+func (a *Account) PaymentDays() int {
+	return a.paymentDays
+}
+
+func (a *Account) Owed() int64 {
+	return a.owed
+}
+
+// Available is the credit left for new orders, which is negative once a manager approved orders over it.
+func (a *Account) Available() int64 {
+	return a.creditLimit - a.owed
+}
+
+// Prices are the negotiated prices by product.
+func (a *Account) Prices() map[string]int64 {
+	return maps.Clone(a.prices)
+}
+
+func (a *Account) SetTerms(creditLimit int64, paymentDays int) error {
+	if creditLimit < 0 || paymentDays < 0 {
+		return ErrInvalidTerms
+	}
+	a.creditLimit = creditLimit
+	a.paymentDays = paymentDays
+	return nil
+}
+
+// Negotiate sets the price the café pays for a product; 0 puts it back on the list price.
+func (a *Account) Negotiate(product string, price int64) error {
+	if price < 0 {
+		return ErrInvalidTerms
+	}
+	if price == 0 {
+		delete(a.prices, product)
+		return nil
+	}
+	a.prices[product] = price
+	return nil
+}
+
+// price is what the café pays for a product, its negotiated price or else the list price.
+func (a *Account) price(t Terms, product string) (int64, bool) {
+	if p, ok := a.prices[product]; ok {
+		if _, listed := t.Prices[product]; listed {
+			return p, true
+		}
+	}
+	p, ok := t.Prices[product]
+	return p, ok
+}
+
+func (a *Account) charge(amount int64) {
+	a.owed += amount
+}
+
+func (a *Account) settle(amount int64) {
+	a.owed -= amount
+}
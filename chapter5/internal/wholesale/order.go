@@ -0,0 +1,211 @@
+package wholesale
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rhymond/go-money"
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+)
+
+var (
+	ErrNotFound            = errors.New("wholesale order not found")
+	ErrInvalidTransition   = errors.New("wholesale order cannot move to that status")
+	ErrEmptyOrder          = errors.New("wholesale order has nothing to order")
+	ErrNotSold             = errors.New("product is not sold wholesale")
+	ErrInvalidQuantity     = errors.New("quantity must be above 0")
+	ErrNoApprover          = errors.New("wholesale orders are approved by someone")
+	ErrConcurrencyConflict = errors.New("wholesale order changed since it was read")
+)
+
+// Status is where an order is, from the café placing it to its invoice being paid.
+type Status string
+
+const (
+	// StatusPending is an order held for a manager, for the reasons given by Holds.
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	// StatusShipped is an order delivered and invoiced, until the invoice is paid.
+	StatusShipped   Status = "shipped"
+	StatusPaid      Status = "paid"
+	StatusRejected  Status = "rejected"
+	StatusCancelled Status = "cancelled"
+)
+
+// Line is a product ordered, at the price the café paid for it when the order was placed.
+type Line struct {
+	Product   string
+	Quantity  int64
+	UnitPrice int64
+}
+
+// Order is what a café buys in one go. It is approved as it is placed, unless the approval rules hold it
+// for a manager; stock is reserved at the warehouse from approval until it is shipped.
+type Order struct {
+	ID        uuid.UUID
+	AccountID uuid.UUID
+	Currency  string
+	PlacedAt  time.Time
+
+	version    int
+	status     Status
+	lines      []Line
+	holds      []string
+	approvedBy string
+	approvedAt time.Time
+	shippedAt  time.Time
+	dueAt      time.Time
+	paidAt     time.Time
+	// reason is why the order was rejected or cancelled.
+	reason string
+}
+
+func NewOrder(accountID uuid.UUID, currency string, lines []Line, placedAt time.Time) (*Order, error) {
+	if len(lines) == 0 {
+		return nil, ErrEmptyOrder
+	}
+	for _, l := range lines {
+		if l.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidQuantity, l.Product)
+		}
+	}
+	return &Order{
+		ID:        uuid.New(),
+		AccountID: accountID,
+		Currency:  currency,
+		PlacedAt:  placedAt.UTC(),
+		status:    StatusPending,
+		lines:     slices.Clone(lines),
+	}, nil
+}
+
+func (o *Order) Status() Status {
+	return o.status
+}
+
+func (o *Order) Lines() []Line {
+	return slices.Clone(o.lines)
+}
+
+// Holds are why the order waits for a manager, e.g. "over the credit limit".
+func (o *Order) Holds() []string {
+	return slices.Clone(o.holds)
+}
+
+func (o *Order) ApprovedBy() string {
+	return o.approvedBy
+}
+
+func (o *Order) ApprovedAt() time.Time {
+	return o.approvedAt
+}
+
+func (o *Order) ShippedAt() time.Time {
+	return o.shippedAt
+}
+
+// DueAt is when the invoice of a shipped order is to be paid.
+func (o *Order) DueAt() time.Time {
+	return o.dueAt
+}
+
+func (o *Order) PaidAt() time.Time {
+	return o.paidAt
+}
+
+func (o *Order) Reason() string {
+	return o.reason
+}
+
+func (o *Order) Total() *money.Money {
+	var total int64
+	for _, l := range o.lines {
+		total += l.Quantity * l.UnitPrice
+	}
+	return money.New(total, o.Currency)
+}
+
+// Overdue tells whether the invoice of the order should have been paid by at.
+func (o *Order) Overdue(at time.Time) bool {
+	return o.status == StatusShipped && at.After(o.dueAt)
+}
+
+// products are the order as the warehouse stock knows it, one product per unit.
+func (o *Order) products() []coffeeco.Product {
+	var products []coffeeco.Product
+	for _, l := range o.lines {
+		for range l.Quantity {
+			products = append(products, coffeeco.Product{ItemName: l.Product})
+		}
+	}
+	return products
+}
+
+// hold records why a pending order needs a manager.
+func (o *Order) hold(reasons []string) {
+	o.holds = reasons
+}
+
+// Approve is called by the manager who agrees to ship a pending order, or with by empty when no approval
+// rule held it.
+func (o *Order) Approve(by string, at time.Time) error {
+	if by == "" && len(o.holds) > 0 {
+		return ErrNoApprover
+	}
+	if err := o.move(StatusPending, StatusApproved); err != nil {
+		return err
+	}
+	o.approvedBy = by
+	o.approvedAt = at.UTC()
+	return nil
+}
+
+// Reject turns down a pending order.
+func (o *Order) Reject(reason string) error {
+	if err := o.move(StatusPending, StatusRejected); err != nil {
+		return err
+	}
+	o.reason = reason
+	return nil
+}
+
+// Cancel drops an order that was not shipped yet.
+func (o *Order) Cancel(reason string) error {
+	if o.status != StatusPending && o.status != StatusApproved {
+		return fmt.Errorf("%w: %s is %s", ErrInvalidTransition, o.ID, o.status)
+	}
+	o.status = StatusCancelled
+	o.reason = reason
+	return nil
+}
+
+// Ship records the delivery of an approved order, which invoices it to be paid within paymentDays.
+func (o *Order) Ship(at time.Time, paymentDays int) error {
+	if err := o.move(StatusApproved, StatusShipped); err != nil {
+		return err
+	}
+	o.shippedAt = at.UTC()
+	o.dueAt = o.shippedAt.AddDate(0, 0, paymentDays)
+	return nil
+}
+
+// Pay records that the invoice of a shipped order was paid.
+func (o *Order) Pay(at time.Time) error {
+	if err := o.move(StatusShipped, StatusPaid); err != nil {
+		return err
+	}
+	o.paidAt = at.UTC()
+	return nil
+}
+
+func (o *Order) move(from, to Status) error {
+	if o.status != from {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, o.ID, o.status, from)
+	}
+	o.status = to
+	return nil
+}
@@ -0,0 +1,380 @@
+package wholesale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+
+	"coffeeco/internal/telemetry"
+)
+
+type Repository interface {
+	// Account returns ErrAccountNotFound if there is no such account.
+	Account(ctx context.Context, id uuid.UUID) (*Account, error)
+	// SaveAccount returns ErrConcurrencyConflict if the account was saved by someone else since it was read.
+	SaveAccount(ctx context.Context, a *Account) error
+	// Accounts returns every account, by name.
+	Accounts(ctx context.Context) ([]*Account, error)
+	// Get returns ErrNotFound if there is no such order.
+	Get(ctx context.Context, id uuid.UUID) (*Order, error)
+	// Save returns ErrConcurrencyConflict if the order was saved by someone else since it was read.
+	Save(ctx context.Context, o *Order) error
+	// ForAccount returns the orders of an account, oldest first.
+	ForAccount(ctx context.Context, accountID uuid.UUID) ([]*Order, error)
+	Ping(ctx context.Context) error
+}
+
+// MongoRepository keeps accounts and orders versioned, so two orders never take the same credit.
+type MongoRepository struct {
+	client   *mongo.Client
+	accounts *mongo.Collection
+	orders   *mongo.Collection
+}
+
+func NewMongoRepo(ctx context.Context, connectionString string) (*MongoRepository, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a mongo client: %w", err)
+	}
+	db := client.Database("coffeeco")
+	orders := db.Collection("wholesale_orders")
+	_, err = orders.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "account_id", Value: 1}, {Key: "placed_at", Value: 1}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wholesale order indexes: %w", err)
+	}
+	return &MongoRepository{client: client, accounts: db.Collection("wholesale_accounts"), orders: orders}, nil
+}
+
+// Close disconnects from Mongo. The repository cannot be used afterwards.
+func (m *MongoRepository) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+type mongoAccount struct {
+	ID           string           `bson:"_id"`
+	Version      int              `bson:"version"`
+	Name         string           `bson:"name"`
+	Email        string           `bson:"email,omitempty"`
+	RegisteredAt time.Time        `bson:"registered_at"`
+	CreditLimit  int64            `bson:"credit_limit"`
+	PaymentDays  int              `bson:"payment_days"`
+	Prices       map[string]int64 `bson:"prices"`
+	Owed         int64            `bson:"owed"`
+}
+
+func toMongoAccount(a *Account) mongoAccount {
+	return mongoAccount{
+		ID:           a.ID.String(),
+		Version:      a.version,
+		Name:         a.Name,
+		Email:        a.Email,
+		RegisteredAt: a.RegisteredAt,
+		CreditLimit:  a.creditLimit,
+		PaymentDays:  a.paymentDays,
+		Prices:       a.Prices(),
+		Owed:         a.owed,
+	}
+}
+
+func (m mongoAccount) toAccount() *Account {
+	id, _ := uuid.Parse(m.ID)
+	a := &Account{
+		ID:           id,
+		Name:         m.Name,
+		Email:        m.Email,
+		RegisteredAt: m.RegisteredAt,
+		version:      m.Version,
+		creditLimit:  m.CreditLimit,
+		paymentDays:  m.PaymentDays,
+		prices:       map[string]int64{},
+		owed:         m.Owed,
+	}
+	for product, price := range m.Prices {
+		a.prices[product] = price
+	}
+	return a
+}
+
+type mongoOrder struct {
+	ID         string      `bson:"_id"`
+	Version    int         `bson:"version"`
+	AccountID  string      `bson:"account_id"`
+	Currency   string      `bson:"currency"`
+	Status     string      `bson:"status"`
+	Lines      []mongoLine `bson:"lines"`
+	Holds      []string    `bson:"holds,omitempty"`
+	PlacedAt   time.Time   `bson:"placed_at"`
+	ApprovedBy string      `bson:"approved_by,omitempty"`
+	ApprovedAt time.Time   `bson:"approved_at,omitempty"`
+	ShippedAt  time.Time   `bson:"shipped_at,omitempty"`
+	DueAt      time.Time   `bson:"due_at,omitempty"`
+	PaidAt     time.Time   `bson:"paid_at,omitempty"`
+	Reason     string      `bson:"reason,omitempty"`
+}
+
+type mongoLine struct {
+	Product   string `bson:"product"`
+	Quantity  int64  `bson:"quantity"`
+	UnitPrice int64  `bson:"unit_price"`
+}
+
+func toMongoOrder(o *Order) mongoOrder {
+	doc := mongoOrder{
+		ID:         o.ID.String(),
+		Version:    o.version,
+		AccountID:  o.AccountID.String(),
+		Currency:   o.Currency,
+		Status:     string(o.status),
+		Lines:      make([]mongoLine, 0, len(o.lines)),
+		Holds:      o.holds,
+		PlacedAt:   o.PlacedAt,
+		ApprovedBy: o.approvedBy,
+		ApprovedAt: o.approvedAt,
+		ShippedAt:  o.shippedAt,
+		DueAt:      o.dueAt,
+		PaidAt:     o.paidAt,
+		Reason:     o.reason,
+	}
+	for _, l := range o.lines {
+		doc.Lines = append(doc.Lines, mongoLine(l))
+	}
+	return doc
+}
+
+func (m mongoOrder) toOrder() *Order {
+	id, _ := uuid.Parse(m.ID)
+	accountID, _ := uuid.Parse(m.AccountID)
+	o := &Order{
+		ID:         id,
+		AccountID:  accountID,
+		Currency:   m.Currency,
+		PlacedAt:   m.PlacedAt,
+		version:    m.Version,
+		status:     Status(m.Status),
+		holds:      m.Holds,
+		approvedBy: m.ApprovedBy,
+		approvedAt: m.ApprovedAt,
+		shippedAt:  m.ShippedAt,
+		dueAt:      m.DueAt,
+		paidAt:     m.PaidAt,
+		reason:     m.Reason,
+	}
+	for _, l := range m.Lines {
+		o.lines = append(o.lines, Line(l))
+	}
+	return o
+}
+
+func (m *MongoRepository) Account(ctx context.Context, id uuid.UUID) (_ *Account, err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.Account", attribute.String("account.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoAccount
+	if err := m.accounts.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to find wholesale account: %w", err)
+	}
+	return doc.toAccount(), nil
+}
+
+func (m *MongoRepository) SaveAccount(ctx context.Context, a *Account) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.SaveAccount", attribute.String("account.id", a.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoAccount(a)
+	doc.Version = a.version + 1
+	if a.version == 0 {
+		if _, err := m.accounts.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save wholesale account: %w", err)
+		}
+	} else {
+		res, err := m.accounts.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: a.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save wholesale account: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	a.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) Accounts(ctx context.Context) (_ []*Account, err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.Accounts")
+	defer telemetry.End(span, &err)
+	cur, err := m.accounts.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find wholesale accounts: %w", err)
+	}
+	var docs []mongoAccount
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode wholesale accounts: %w", err)
+	}
+	accounts := make([]*Account, 0, len(docs))
+	for _, doc := range docs {
+		accounts = append(accounts, doc.toAccount())
+	}
+	return accounts, nil
+}
+
+func (m *MongoRepository) Get(ctx context.Context, id uuid.UUID) (_ *Order, err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.Get", attribute.String("order.id", id.String()))
+	defer telemetry.End(span, &err)
+	var doc mongoOrder
+	if err := m.orders.FindOne(ctx, bson.D{{Key: "_id", Value: id.String()}}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to find wholesale order: %w", err)
+	}
+	return doc.toOrder(), nil
+}
+
+func (m *MongoRepository) Save(ctx context.Context, o *Order) (err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.Save", attribute.String("order.id", o.ID.String()))
+	defer telemetry.End(span, &err)
+	doc := toMongoOrder(o)
+	doc.Version = o.version + 1
+	if o.version == 0 {
+		if _, err := m.orders.InsertOne(ctx, doc); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return ErrConcurrencyConflict
+			}
+			return fmt.Errorf("failed to save wholesale order: %w", err)
+		}
+	} else {
+		res, err := m.orders.ReplaceOne(ctx, bson.D{{Key: "_id", Value: doc.ID}, {Key: "version", Value: o.version}}, doc)
+		if err != nil {
+			return fmt.Errorf("failed to save wholesale order: %w", err)
+		}
+		if res.MatchedCount == 0 {
+			return ErrConcurrencyConflict
+		}
+	}
+	o.version = doc.Version
+	return nil
+}
+
+func (m *MongoRepository) ForAccount(ctx context.Context, accountID uuid.UUID) (_ []*Order, err error) {
+	ctx, span := telemetry.StartClient(ctx, "wholesale.MongoRepository.ForAccount", attribute.String("account.id", accountID.String()))
+	defer telemetry.End(span, &err)
+	cur, err := m.orders.Find(ctx, bson.D{{Key: "account_id", Value: accountID.String()}}, options.Find().SetSort(bson.D{{Key: "placed_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find wholesale orders: %w", err)
+	}
+	var docs []mongoOrder
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode wholesale orders: %w", err)
+	}
+	orders := make([]*Order, 0, len(docs))
+	for _, doc := range docs {
+		orders = append(orders, doc.toOrder())
+	}
+	return orders, nil
+}
+
+func (m *MongoRepository) Ping(ctx context.Context) error {
+	if _, err := m.orders.EstimatedDocumentCount(ctx); err != nil {
+		return fmt.Errorf("failed to ping DB: %w", err)
+	}
+	return nil
+}
+
+// MemoryRepository keeps accounts and orders in process. It is meant for tests and local experiments.
+type MemoryRepository struct {
+	mu       sync.Mutex
+	accounts map[uuid.UUID]mongoAccount
+	orders   map[uuid.UUID]mongoOrder
+}
+
+func NewMemoryRepo() *MemoryRepository {
+	return &MemoryRepository{accounts: map[uuid.UUID]mongoAccount{}, orders: map[uuid.UUID]mongoOrder{}}
+}
+
+func (m *MemoryRepository) Account(_ context.Context, id uuid.UUID) (*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.accounts[id]
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	return doc.toAccount(), nil
+}
+
+func (m *MemoryRepository) SaveAccount(_ context.Context, a *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts[a.ID].Version != a.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoAccount(a)
+	doc.Version = a.version + 1
+	m.accounts[a.ID] = doc
+	a.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) Accounts(context.Context) ([]*Account, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var accounts []*Account
+	for _, doc := range m.accounts {
+		accounts = append(accounts, doc.toAccount())
+	}
+	slices.SortFunc(accounts, func(a, b *Account) int { return strings.Compare(a.Name, b.Name) })
+	return accounts, nil
+}
+
+func (m *MemoryRepository) Get(_ context.Context, id uuid.UUID) (*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	doc, ok := m.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc.toOrder(), nil
+}
+
+func (m *MemoryRepository) Save(_ context.Context, o *Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.orders[o.ID].Version != o.version {
+		return ErrConcurrencyConflict
+	}
+	doc := toMongoOrder(o)
+	doc.Version = o.version + 1
+	m.orders[o.ID] = doc
+	o.version = doc.Version
+	return nil
+}
+
+func (m *MemoryRepository) ForAccount(_ context.Context, accountID uuid.UUID) ([]*Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []*Order
+	for _, doc := range m.orders {
+		if doc.AccountID == accountID.String() {
+			orders = append(orders, doc.toOrder())
+		}
+	}
+	slices.SortFunc(orders, func(a, b *Order) int { return a.PlacedAt.Compare(b.PlacedAt) })
+	return orders, nil
+}
+
+func (m *MemoryRepository) Ping(context.Context) error {
+	return nil
+}
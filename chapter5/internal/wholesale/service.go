@@ -0,0 +1,359 @@
+package wholesale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	coffeeco "coffeeco/internal"
+	"coffeeco/internal/audit"
+)
+
+// saveAttempts bounds how often a change is retried when someone else keeps saving first.
+const saveAttempts = 3
+
+// errOverLimit is an order that fit the credit of the café when it was checked, but not once another
+// order took some of it.
+var errOverLimit = errors.New("over the credit limit")
+
+// Stock is where orders are shipped from, e.g. inventory.Service.
+type Stock interface {
+	Reserve(ctx context.Context, storeID, reservationID uuid.UUID, products []coffeeco.Product) error
+	Commit(ctx context.Context, storeID, reservationID uuid.UUID) error
+	Release(ctx context.Context, storeID, reservationID uuid.UUID) error
+}
+
+type Service struct {
+	repo   Repository
+	terms  Terms
+	stock  Stock
+	audit  audit.Recorder // 可选, 记录谁批准了订单
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+type Option func(s *Service)
+
+// WithAuditLog records every approval by a manager in the audit log.
+func WithAuditLog(r audit.Recorder) Option {
+	return func(s *Service) {
+		s.audit = r
+	}
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Service) {
+		s.logger = l
+	}
+}
+
+// WithClock replaces time.Now, e.g. to test when invoices are due.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+func NewService(repo Repository, terms Terms, stock Stock, opts ...Option) *Service {
+	s := &Service{repo: repo, terms: terms, stock: stock, logger: slog.Default(), now: time.Now}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register opens an account for a café. paymentDays 0 gives it the days of the Terms.
+func (s *Service) Register(ctx context.Context, name, email string, creditLimit int64, paymentDays int) (*Account, error) {
+	a, err := NewAccount(name, email, creditLimit, paymentDays, s.now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveAccount(ctx, a); err != nil {
+		return nil, fmt.Errorf("failed to register wholesale account: %w", err)
+	}
+	return a, nil
+}
+
+func (s *Service) Account(ctx context.Context, id uuid.UUID) (*Account, error) {
+	return s.repo.Account(ctx, id)
+}
+
+func (s *Service) Accounts(ctx context.Context) ([]*Account, error) {
+	return s.repo.Accounts(ctx)
+}
+
+// SetTerms changes the credit limit and payment days of a café; orders already placed keep theirs.
+func (s *Service) SetTerms(ctx context.Context, accountID uuid.UUID, creditLimit int64, paymentDays int) error {
+	return s.updateAccount(ctx, accountID, func(a *Account) error {
+		return a.SetTerms(creditLimit, paymentDays)
+	})
+}
+
+// Negotiate sets the price a café pays for a product on the list; 0 puts it back on the list price.
+func (s *Service) Negotiate(ctx context.Context, accountID uuid.UUID, product string, price int64) error {
+	if _, ok := s.terms.Prices[product]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotSold, product)
+	}
+	return s.updateAccount(ctx, accountID, func(a *Account) error {
+		return a.Negotiate(product, price)
+	})
+}
+
+func (s *Service) Order(ctx context.Context, id uuid.UUID) (*Order, error) {
+	return s.repo.Get(ctx, id)
+}
+
+// Orders returns the orders of a café, oldest first.
+func (s *Service) Orders(ctx context.Context, accountID uuid.UUID) ([]*Order, error) {
+	return s.repo.ForAccount(ctx, accountID)
+}
+
+// Place orders quantities of products, by product, at the prices of the café. The order is approved at
+// once, which takes its credit and reserves its stock, unless an approval rule holds it for a manager:
+// it is above the Terms' ApprovalAbove, it goes over the café's credit limit, or an invoice of the café is
+// overdue. An order that cannot be stocked is not placed.
+func (s *Service) Place(ctx context.Context, accountID uuid.UUID, quantities map[string]int64) (*Order, error) {
+	a, err := s.repo.Account(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	var lines []Line
+	for _, product := range slices.Sorted(maps.Keys(quantities)) {
+		price, ok := a.price(s.terms, product)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotSold, product)
+		}
+		lines = append(lines, Line{Product: product, Quantity: quantities[product], UnitPrice: price})
+	}
+	o, err := NewOrder(a.ID, s.terms.Currency, lines, s.now())
+	if err != nil {
+		return nil, err
+	}
+	holds, err := s.holds(ctx, a, o)
+	if err != nil {
+		return nil, err
+	}
+	if len(holds) == 0 {
+		err = s.take(ctx, o, true, func() error {
+			if err := o.Approve("", s.now()); err != nil {
+				return err
+			}
+			return s.repo.Save(ctx, o)
+		})
+		if !errors.Is(err, errOverLimit) {
+			if err != nil {
+				return nil, fmt.Errorf("failed to place wholesale order: %w", err)
+			}
+			return o, nil
+		}
+		holds = []string{errOverLimit.Error()}
+	}
+	o.hold(holds)
+	if err := s.repo.Save(ctx, o); err != nil {
+		return nil, fmt.Errorf("failed to place wholesale order: %w", err)
+	}
+	return o, nil
+}
+
+// holds are the approval rules an order breaks.
+func (s *Service) holds(ctx context.Context, a *Account, o *Order) ([]string, error) {
+	var holds []string
+	total := o.Total()
+	if s.terms.ApprovalAbove > 0 && total.Amount() > s.terms.ApprovalAbove {
+		holds = append(holds, "above the approval threshold")
+	}
+	if total.Amount() > a.Available() {
+		holds = append(holds, errOverLimit.Error())
+	}
+	orders, err := s.repo.ForAccount(ctx, a.ID)
+	if err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(orders, func(prev *Order) bool { return prev.Overdue(s.now()) }) {
+		holds = append(holds, "overdue invoice")
+	}
+	return holds, nil
+}
+
+// Approve is called by the manager who agrees to ship a held order, whatever the approval rules say. Its
+// credit is taken and its stock reserved, or it stays held if there is not enough stock.
+func (s *Service) Approve(ctx context.Context, id uuid.UUID, by string) error {
+	if by == "" {
+		return ErrNoApprover
+	}
+	o, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if o.status != StatusPending {
+		return fmt.Errorf("%w: %s is %s, not %s", ErrInvalidTransition, o.ID, o.status, StatusPending)
+	}
+	err = s.take(ctx, o, false, func() error {
+		_, err := s.update(ctx, id, func(o *Order) error {
+			return o.Approve(by, s.now())
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if s.audit != nil {
+		e := audit.NewEntry(ctx, audit.ActionWholesaleApproval, "wholesale_order", o.ID.String(), string(StatusPending), fmt.Sprintf("%s by %s for %s", StatusApproved, by, o.Total().Display()))
+		if err := s.audit.Record(ctx, e); err != nil {
+			return fmt.Errorf("wholesale order approved but failed to record it in the audit log: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reject turns down a held order.
+func (s *Service) Reject(ctx context.Context, id uuid.UUID, reason string) error {
+	_, err := s.update(ctx, id, func(o *Order) error {
+		return o.Reject(reason)
+	})
+	return err
+}
+
+// Cancel drops an order that was not shipped yet, giving back its credit and stock if it was approved.
+func (s *Service) Cancel(ctx context.Context, id uuid.UUID, reason string) error {
+	var approved bool
+	o, err := s.update(ctx, id, func(o *Order) error {
+		approved = o.status == StatusApproved
+		return o.Cancel(reason)
+	})
+	if err != nil || !approved {
+		return err
+	}
+	return errors.Join(s.release(ctx, o), s.refund(ctx, o))
+}
+
+// Ship records the delivery of an approved order, invoicing it to be paid within the payment days of
+// the café. The order is shipped before its stock is used up, so a delivery is never counted twice.
+func (s *Service) Ship(ctx context.Context, id uuid.UUID) error {
+	o, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	a, err := s.repo.Account(ctx, o.AccountID)
+	if err != nil {
+		return err
+	}
+	days := a.PaymentDays()
+	if days == 0 {
+		days = s.terms.paymentDays()
+	}
+	if _, err := s.update(ctx, id, func(o *Order) error {
+		return o.Ship(s.now(), days)
+	}); err != nil {
+		return err
+	}
+	if err := s.stock.Commit(ctx, s.terms.Warehouse, o.ID); err != nil {
+		return fmt.Errorf("wholesale order shipped but failed to use up its stock: %w", err)
+	}
+	return nil
+}
+
+// Pay records that the invoice of a shipped order was paid, which gives its credit back to the café.
+func (s *Service) Pay(ctx context.Context, id uuid.UUID) error {
+	o, err := s.update(ctx, id, func(o *Order) error {
+		return o.Pay(s.now())
+	})
+	if err != nil {
+		return err
+	}
+	return s.refund(ctx, o)
+}
+
+// take charges the café for an order and reserves its stock at the warehouse, then saves the order with
+// save. Whatever was done is undone if a step fails. With withinLimit, the charge fails with errOverLimit
+// rather than going over the café's credit limit.
+func (s *Service) take(ctx context.Context, o *Order, withinLimit bool, save func() error) error {
+	total := o.Total().Amount()
+	err := s.updateAccount(ctx, o.AccountID, func(a *Account) error {
+		if withinLimit && total > a.Available() {
+			return errOverLimit
+		}
+		a.charge(total)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.stock.Reserve(ctx, s.terms.Warehouse, o.ID, o.products()); err != nil {
+		return errors.Join(err, s.refund(ctx, o))
+	}
+	if err := save(); err != nil {
+		return errors.Join(err, s.release(ctx, o), s.refund(ctx, o))
+	}
+	return nil
+}
+
+func (s *Service) release(ctx context.Context, o *Order) error {
+	if err := s.stock.Release(ctx, s.terms.Warehouse, o.ID); err != nil {
+		return fmt.Errorf("failed to release the stock of wholesale order %s: %w", o.ID, err)
+	}
+	return nil
+}
+
+// refund gives the credit an order took back to the café.
+func (s *Service) refund(ctx context.Context, o *Order) error {
+	total := o.Total().Amount()
+	err := s.updateAccount(ctx, o.AccountID, func(a *Account) error {
+		a.settle(total)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to give the credit of wholesale order %s back: %w", o.ID, err)
+	}
+	return nil
+}
+
+// update applies fn to the latest order and saves it, starting over if someone else saved in between.
+func (s *Service) update(ctx context.Context, id uuid.UUID, fn func(o *Order) error) (*Order, error) {
+	for range saveAttempts {
+		o, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(o); err != nil {
+			return nil, err
+		}
+		err = s.repo.Save(ctx, o)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return o, nil
+	}
+	return nil, fmt.Errorf("failed to update wholesale order after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
+
+// updateAccount is update for accounts.
+func (s *Service) updateAccount(ctx context.Context, id uuid.UUID, fn func(a *Account) error) error {
+	for range saveAttempts {
+		a, err := s.repo.Account(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+		err = s.repo.SaveAccount(ctx, a)
+		if errors.Is(err, ErrConcurrencyConflict) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to update wholesale account after %d attempts: %w", saveAttempts, ErrConcurrencyConflict)
+}
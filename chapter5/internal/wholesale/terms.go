@@ -0,0 +1,25 @@
+package wholesale
+
+import "github.com/google/uuid"
+
+// Terms are how beans are sold to cafés, whatever was negotiated with each of them.
+type Terms struct {
+	// Currency of the prices, the credit limits and the invoices.
+	Currency string `json:"currency"`
+	// Warehouse is the store whose stock wholesale orders are shipped from, e.g. the roastery. Products are
+	// taken off its stock by the recipes of the config file, e.g. {"house blend 1kg": {"beans_g": 1000}}.
+	Warehouse uuid.UUID `json:"warehouse"`
+	// Prices are the list prices by product; only products on the list are sold wholesale.
+	Prices map[string]int64 `json:"prices"`
+	// ApprovalAbove is the total above which every order waits for a manager; 0 means never.
+	ApprovalAbove int64 `json:"approval_above,omitempty"`
+	// PaymentDays is how long cafés have to pay an invoice unless they negotiated otherwise, 30 if 0.
+	PaymentDays int `json:"payment_days,omitempty"`
+}
+
+func (t Terms) paymentDays() int {
+	if t.PaymentDays > 0 {
+		return t.PaymentDays
+	}
+	return 30
+}
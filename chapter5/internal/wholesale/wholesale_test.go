@@ -0,0 +1,120 @@
+package wholesale_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"coffeeco/internal/inventory"
+	"coffeeco/internal/wholesale"
+)
+
+func Test_CafesOrderOnCreditAndHeldOrdersWaitForAManager(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC)
+	roastery := uuid.New()
+	stock := inventory.NewService(inventory.NewMemoryRepo(), inventory.Recipes{"house blend 1kg": {"beans_g": 1000}})
+	if err := stock.Restock(ctx, roastery, "beans_g", 50000); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	terms := wholesale.Terms{
+		Currency:      "USD",
+		Warehouse:     roastery,
+		Prices:        map[string]int64{"house blend 1kg": 2000, "espresso 1kg": 2400},
+		ApprovalAbove: 100000,
+		PaymentDays:   30,
+	}
+	svc := wholesale.NewService(wholesale.NewMemoryRepo(), terms, stock, wholesale.WithClock(func() time.Time { return now }))
+
+	cafe, err := svc.Register(ctx, "Corner Café", "", 50000, 0)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if err := svc.Negotiate(ctx, cafe.ID, "house blend 1kg", 1800); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if _, err := svc.Place(ctx, cafe.ID, map[string]int64{"decaf 1kg": 1}); !errors.Is(err, wholesale.ErrNotSold) {
+		t.Fatalf("expected decaf not to be sold wholesale but got %v", err)
+	}
+	available := func() int64 {
+		t.Helper()
+		st, _ := stock.Stock(ctx, roastery)
+		l, _ := st.Level("beans_g")
+		return l.Available()
+	}
+	owed := func() int64 {
+		t.Helper()
+		a, _ := svc.Account(ctx, cafe.ID)
+		return a.Owed()
+	}
+
+	// Within the credit limit, at the negotiated price.
+	first, err := svc.Place(ctx, cafe.ID, map[string]int64{"house blend 1kg": 10})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if first.Status() != wholesale.StatusApproved || first.Total().Amount() != 18000 || owed() != 18000 || available() != 40000 {
+		t.Fatalf("expected 10 bags at 18.00 approved and reserved but got %s for %d, %d g left", first.Status(), first.Total().Amount(), available())
+	}
+
+	// 36000 does not fit in the 32000 of credit left, so it waits, taking neither credit nor stock.
+	held, err := svc.Place(ctx, cafe.ID, map[string]int64{"house blend 1kg": 20})
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if held.Status() != wholesale.StatusPending || !slices.Equal(held.Holds(), []string{"over the credit limit"}) || owed() != 18000 || available() != 40000 {
+		t.Fatalf("expected the order held over the credit limit but got %s %v", held.Status(), held.Holds())
+	}
+	if err := svc.Approve(ctx, held.ID, ""); !errors.Is(err, wholesale.ErrNoApprover) {
+		t.Fatalf("expected a manager to be needed but got %v", err)
+	}
+	if err := svc.Approve(ctx, held.ID, "maria"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if owed() != 54000 || available() != 20000 {
+		t.Fatalf("expected the approved order to take its credit and stock but %d is owed and %d g left", owed(), available())
+	}
+
+	// Not enough beans: the approval is undone.
+	big, _ := svc.Place(ctx, cafe.ID, map[string]int64{"house blend 1kg": 25})
+	if err := svc.Approve(ctx, big.ID, "maria"); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("expected the beans to run out but got %v", err)
+	}
+	if big, _ = svc.Order(ctx, big.ID); big.Status() != wholesale.StatusPending || owed() != 54000 {
+		t.Fatalf("expected the order still held and its credit given back but got %s with %d owed", big.Status(), owed())
+	}
+
+	// Shipping invoices the order, due in the 30 days of the terms.
+	if err := svc.Ship(ctx, first.ID); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if first, _ = svc.Order(ctx, first.ID); !first.DueAt().Equal(now.AddDate(0, 0, 30)) {
+		t.Fatalf("expected the invoice due in 30 days but got %v", first.DueAt())
+	}
+	st, _ := stock.Stock(ctx, roastery)
+	if l, _ := st.Level("beans_g"); l.OnHand != 40000 {
+		t.Fatalf("expected 10 kg shipped but %d g are on hand", l.OnHand)
+	}
+
+	now = now.AddDate(0, 0, 31)
+	late, _ := svc.Place(ctx, cafe.ID, map[string]int64{"espresso 1kg": 1})
+	if late.Status() != wholesale.StatusPending || !slices.Contains(late.Holds(), "overdue invoice") {
+		t.Fatalf("expected the order held for the overdue invoice but got %s %v", late.Status(), late.Holds())
+	}
+	if err := svc.Pay(ctx, first.ID); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if owed() != 36000 {
+		t.Fatalf("expected the paid invoice to give its credit back but %d is owed", owed())
+	}
+	if err := svc.Cancel(ctx, held.ID, "café closed for works"); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if owed() != 0 || available() != 40000 {
+		t.Fatalf("expected the cancelled order to give back its credit and stock but %d is owed and %d g left", owed(), available())
+	}
+}